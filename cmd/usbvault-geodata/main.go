@@ -0,0 +1,104 @@
+// Command usbvault-geodata builds the dataset the offline reverse geocoder
+// answers from (USBVAULT_GEOCODE_PROVIDER=offline). It reads GeoNames
+// extracts from a folder (-dir), for example ones copied onto an air-gapped
+// vault, or downloads them from GeoNames (-download), and writes the
+// SQLite file named by -out.
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"businessplan/usbvault/internal/geocode"
+)
+
+const geonamesURL = "https://download.geonames.org/export/dump/"
+
+func main() {
+	var (
+		dir      = flag.String("dir", "", "folder holding the GeoNames files")
+		download = flag.Bool("download", false, "download the GeoNames files instead of reading -dir")
+		cities   = flag.String("cities", "cities500", "GeoNames cities extract: cities500, cities1000, cities5000 or cities15000")
+		out      = flag.String("out", "geodata.sqlite", "dataset to write")
+	)
+	flag.Parse()
+	logger := log.New(os.Stderr, "[usbvault-geodata] ", log.LstdFlags)
+	if (*dir == "") == !*download {
+		logger.Fatal("use -dir or -download")
+	}
+
+	fetch := func(name string) ([]byte, error) { return os.ReadFile(filepath.Join(*dir, name)) }
+	if *download {
+		client := &http.Client{Timeout: 10 * time.Minute}
+		fetch = func(name string) ([]byte, error) {
+			logger.Printf("downloading %s", name)
+			resp, err := client.Get(geonamesURL + name)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("%s: %s", name, resp.Status)
+			}
+			return io.ReadAll(resp.Body)
+		}
+	}
+
+	var src geocode.GeoNames
+	for _, f := range []struct {
+		name string
+		dst  *io.Reader
+	}{
+		{"admin1CodesASCII.txt", &src.Admin1},
+		{"admin2Codes.txt", &src.Admin2},
+		{"countryInfo.txt", &src.Countries},
+	} {
+		data, err := fetch(f.name)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		*f.dst = bytes.NewReader(data)
+	}
+	var err error
+	if src.Cities, err = citiesFile(fetch, *cities); err != nil {
+		logger.Fatal(err)
+	}
+
+	n, err := geocode.BuildDataset(context.Background(), *out, src)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Printf("wrote %d places to %s", n, *out)
+}
+
+// citiesFile reads the cities extract, as text or as the zip GeoNames
+// publishes it in.
+func citiesFile(fetch func(string) ([]byte, error), name string) (io.Reader, error) {
+	if data, err := fetch(name + ".txt"); err == nil {
+		return bytes.NewReader(data), nil
+	}
+	data, err := fetch(name + ".zip")
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if path.Base(f.Name) == name+".txt" {
+			return f.Open()
+		}
+	}
+	return nil, fmt.Errorf("%s.zip holds no %s.txt", name, name)
+}
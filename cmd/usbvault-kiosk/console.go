@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/qr"
+)
+
+// consoleRefreshInterval paces the text status screen; ingest progress is
+// the only thing on it that moves.
+const consoleRefreshInterval = 2 * time.Second
+
+// consoleStatus is the part of GET /api/kiosk/console the screen shows.
+type consoleStatus struct {
+	URLs          []string `json:"urls"`
+	SetupRequired bool     `json:"setup_required"`
+	ClockTrusted  bool     `json:"clock_trusted"`
+	PairingURL    string   `json:"pairing_url"`
+	Provisioning  *struct {
+		SSID       string   `json:"ssid"`
+		Passphrase string   `json:"passphrase"`
+		SetupCode  string   `json:"setup_code"`
+		URLs       []string `json:"urls"`
+	} `json:"provisioning"`
+	Ingest struct {
+		State          string  `json:"state"`
+		Paused         bool    `json:"paused"`
+		Mount          string  `json:"mount"`
+		TotalFiles     int     `json:"total_files"`
+		ProcessedFiles int     `json:"processed_files"`
+		Percent        float64 `json:"percent"`
+		Message        string  `json:"message"`
+		LastResult     struct {
+			Copied     int `json:"copied"`
+			Duplicates int `json:"duplicates"`
+			Errors     int `json:"errors"`
+		} `json:"last_result"`
+	} `json:"ingest"`
+}
+
+// runConsole draws a status screen on the text console for a monitor with
+// no browser to show the web UI: the address to open, a QR code of it, and
+// ingest progress. It writes to USBVAULT_KIOSK_TTY (default /dev/tty1), or
+// stdout when that cannot be opened.
+func runConsole(ctx context.Context, baseURL string) {
+	var out io.Writer = os.Stdout
+	tty := strings.TrimSpace(os.Getenv("USBVAULT_KIOSK_TTY"))
+	if tty == "" {
+		tty = "/dev/tty1"
+	}
+	if f, err := os.OpenFile(tty, os.O_WRONLY, 0); err == nil {
+		defer f.Close()
+		out = f
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "console status on stdout: %v\n", err)
+	}
+
+	ticker := time.NewTicker(consoleRefreshInterval)
+	defer ticker.Stop()
+	for {
+		st, err := fetchConsole(baseURL)
+		_, _ = out.Write(renderConsole(st, err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func fetchConsole(baseURL string) (*consoleStatus, error) {
+	client := http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(baseURL + "/api/kiosk/console")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server answered %s", resp.Status)
+	}
+	var st consoleStatus
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func renderConsole(st *consoleStatus, fetchErr error) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x1b[?25l\x1b[H\x1b[2J") // hide cursor, clear
+	b.WriteString("\n  USB Vault\n\n")
+
+	if fetchErr != nil {
+		fmt.Fprintf(&b, "  Waiting for the USB Vault server...\n  (%v)\n", fetchErr)
+		return b.Bytes()
+	}
+
+	if p := st.Provisioning; p != nil {
+		writeProvisioning(&b, p.SSID, p.Passphrase, p.SetupCode, p.URLs)
+	} else if st.PairingURL != "" {
+		b.WriteString("  Pair a phone: scan this code with its camera.\n")
+		b.WriteString("  It works once and expires in a few minutes.\n\n")
+		if code, err := qr.Encode(st.PairingURL); err == nil {
+			writeQR(&b, code)
+		}
+		b.WriteString("\n")
+	} else if len(st.URLs) == 0 {
+		b.WriteString("  The web UI only listens on this device.\n")
+		b.WriteString("  To open it from another computer, set USBVAULT_BIND=0.0.0.0 together with\n")
+		b.WriteString("  USBVAULT_CONFIRM_LAN_EXPOSURE=1 and USBVAULT_ALLOW_INSECURE_LAN=1.\n\n")
+	} else {
+		first, _ := url.Parse(st.URLs[0])
+		writeBigText(&b, first.Hostname())
+		b.WriteString("\n  Open in a browser on the same network:\n")
+		for _, u := range st.URLs {
+			fmt.Fprintf(&b, "    %s\n", u)
+		}
+		b.WriteString("\n")
+		if code, err := qr.Encode(st.URLs[0]); err == nil {
+			writeQR(&b, code)
+		}
+		b.WriteString("\n")
+	}
+
+	if st.SetupRequired && st.Provisioning == nil {
+		b.WriteString("  Setup is not finished. It can only be completed from this machine,\n")
+		b.WriteString("  for example through an SSH tunnel.\n\n")
+	}
+
+	if !st.ClockTrusted {
+		b.WriteString("  The system clock is not set. New files wait for network time,\n")
+		b.WriteString("  then are flagged as having an uncertain ingest time.\n\n")
+	}
+
+	in := st.Ingest
+	switch {
+	case in.Paused:
+		b.WriteString("  Ingest: paused\n")
+	case in.State == "scanning" || in.State == "ingesting":
+		fmt.Fprintf(&b, "  Ingest: %s %s\n", in.State, in.Mount)
+		fmt.Fprintf(&b, "  %s %3.0f%%  %d/%d files\n", progressBar(in.Percent, 40), in.Percent, in.ProcessedFiles, in.TotalFiles)
+	case in.State == "waiting":
+		fmt.Fprintf(&b, "  Ingest: %s\n", in.Message)
+	case in.State == "error":
+		fmt.Fprintf(&b, "  Ingest failed: %s\n", in.Message)
+	default:
+		r := in.LastResult
+		fmt.Fprintf(&b, "  Ingest: idle. Last run copied %d, %d duplicates, %d errors.\n", r.Copied, r.Duplicates, r.Errors)
+	}
+	return b.Bytes()
+}
+
+// writeProvisioning walks a user with only a phone or laptop through
+// first-boot setup: join the access point (a QR code phones can scan to
+// join), open the address, and enter the setup code.
+func writeProvisioning(b *bytes.Buffer, ssid, passphrase, code string, urls []string) {
+	b.WriteString("  First-time setup\n\n")
+	step := 1
+	if ssid != "" {
+		fmt.Fprintf(b, "  %d. Join the Wi-Fi network %q, passphrase %s\n\n", step, ssid, passphrase)
+		if qrCode, err := qr.Encode(wifiQRText(ssid, passphrase)); err == nil {
+			writeQR(b, qrCode)
+		}
+		b.WriteString("\n")
+		step++
+	}
+	fmt.Fprintf(b, "  %d. Open in a browser:\n", step)
+	for _, u := range urls {
+		fmt.Fprintf(b, "       %s\n", u)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(b, "  %d. Enter the setup code:\n\n", step+1)
+	writeBigText(b, code)
+	b.WriteString("\n")
+}
+
+// wifiQRText is the de facto Wi-Fi network QR payload phone cameras offer
+// to join.
+func wifiQRText(ssid, passphrase string) string {
+	esc := strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, `:`, `\:`, `"`, `\"`)
+	return "WIFI:T:WPA;S:" + esc.Replace(ssid) + ";P:" + esc.Replace(passphrase) + ";;"
+}
+
+func progressBar(percent float64, width int) string {
+	filled := int(percent / 100 * float64(width))
+	filled = max(0, min(width, filled))
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
+
+// writeQR draws code two module rows per text row using half blocks, in
+// explicit black and white so it scans on any console palette. It keeps
+// the four-module quiet zone scanners expect.
+func writeQR(b *bytes.Buffer, code *qr.Code) {
+	const quiet = 4
+	color := func(dark bool) int {
+		if dark {
+			return 0 // black
+		}
+		return 7 // white
+	}
+	for y := -quiet; y < code.Size+quiet; y += 2 {
+		b.WriteString("  ")
+		for x := -quiet; x < code.Size+quiet; x++ {
+			// Foreground paints the upper half, background the lower.
+			fmt.Fprintf(b, "\x1b[3%d;4%dm▀", color(code.Dark(x, y)), color(code.Dark(x, y+1)))
+		}
+		b.WriteString("\x1b[0m\n")
+	}
+}
+
+// bigGlyphs is a 3x5 font for IP addresses and ports.
+var bigGlyphs = map[rune][5]string{
+	'0': {"###", "# #", "# #", "# #", "###"},
+	'1': {" # ", "## ", " # ", " # ", "###"},
+	'2': {"###", "  #", "###", "#  ", "###"},
+	'3': {"###", "  #", "###", "  #", "###"},
+	'4': {"# #", "# #", "###", "  #", "  #"},
+	'5': {"###", "#  ", "###", "  #", "###"},
+	'6': {"###", "#  ", "###", "# #", "###"},
+	'7': {"###", "  #", "  #", "  #", "  #"},
+	'8': {"###", "# #", "###", "# #", "###"},
+	'9': {"###", "# #", "###", "  #", "###"},
+	'.': {" ", " ", " ", " ", "#"},
+	':': {" ", "#", " ", "#", " "},
+}
+
+// writeBigText draws text in the big font, or plainly if it has characters
+// the font lacks (IPv6 hex digits, host names).
+func writeBigText(b *bytes.Buffer, text string) {
+	for _, r := range text {
+		if _, ok := bigGlyphs[r]; !ok {
+			fmt.Fprintf(b, "  %s\n", text)
+			return
+		}
+	}
+	for row := range 5 {
+		b.WriteString("  ")
+		for _, r := range text {
+			b.WriteString(strings.ReplaceAll(bigGlyphs[r][row], "#", "█"))
+			b.WriteString(" ")
+		}
+		b.WriteString("\n")
+	}
+}
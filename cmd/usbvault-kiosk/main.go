@@ -1,6 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -13,6 +17,10 @@ import (
 	"businessplan/usbvault/internal/display"
 )
 
+// displayPollInterval is how quickly a plugged or unplugged monitor is
+// noticed.
+const displayPollInterval = 2 * time.Second
+
 func main() {
 	if runtime.GOOS != "linux" {
 		fmt.Println("usbvault-kiosk is supported on Linux (Raspberry Pi) only")
@@ -24,56 +32,86 @@ func main() {
 		baseURL = "http://127.0.0.1:4987"
 	}
 
-	st := display.Detect()
-	if !hasAnyDisplay(st) {
-		// Headless mode: do nothing (server can still run).
-		return
-	}
+	// Best effort: wait for server to come up.
+	waitFor(baseURL+"/api/status", 25*time.Second)
+
+	// Keep watching displays for the life of the session: the server learns
+	// about every change so open kiosk pages can switch between the HDMI and
+	// touch UIs, and a headless start launches the browser once a display
+	// appears. Without a browser the monitor gets a text status screen.
+	ctx := context.Background()
+	launched := false
+	display.Watch(ctx, displayPollInterval, func(st display.State) {
+		if err := report(baseURL, st); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to report display change: %v\n", err)
+		}
+		ui := st.UI()
+		if launched || ui == display.UINone {
+			return
+		}
+		launched = true
+		if err := launch(kioskURL(baseURL, ui)); err != nil {
+			if !errors.Is(err, errConsoleSession) {
+				_, _ = fmt.Fprintf(os.Stderr, "%v; showing console status instead\n", err)
+			}
+			go runConsole(ctx, baseURL)
+		}
+	})
+}
 
-	url := baseURL + "/"
-	if preferTouchUI(st) {
-		url = baseURL + "/web/touch/touch.html"
+// kioskURL opens the page for ui in kiosk mode, in which pages follow
+// display changes reported to the server.
+func kioskURL(baseURL, ui string) string {
+	if ui == display.UITouch {
+		return baseURL + "/web/touch/touch.html?kiosk=1"
 	}
+	return baseURL + "/?kiosk=1"
+}
 
-	// Best effort: wait for server to come up.
-	waitFor(baseURL+"/api/status", 25*time.Second)
+func report(baseURL string, st display.State) error {
+	body, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Post(baseURL+"/api/kiosk/display", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server answered %s", resp.Status)
+	}
+	return nil
+}
 
-	browser, args, err := kioskCommand(url)
+func launch(url string) error {
+	session, err := kioskSession()
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "no supported browser found for kiosk mode: %v\n", err)
-		return
+		return err
+	}
+	if session == sessionConsole {
+		return errConsoleSession
+	}
+	browser, args, err := kioskCommand(url, session)
+	if err != nil {
+		return fmt.Errorf("no supported browser found for kiosk mode: %w", err)
+	}
+	exe, args, env, err := wrapSession(session, browser, args)
+	if err != nil {
+		return err
 	}
 
-	cmd := exec.Command(browser, args...)
+	cmd := exec.Command(exe, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	cmd.Env = os.Environ()
+	cmd.Env = env
 
 	if err := cmd.Start(); err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "failed to start kiosk browser: %v\n", err)
-		return
+		return fmt.Errorf("failed to start kiosk browser: %w", err)
 	}
 	_ = cmd.Process.Release()
-}
-
-func hasAnyDisplay(st display.State) bool {
-	if st.HasHDMI || st.HasDSI {
-		return true
-	}
-	// Some GPIO/SPI tiny screens appear only as fb1+.
-	return len(st.Framebuffers) > 0
-}
-
-func preferTouchUI(st display.State) bool {
-	// Prefer the Mac-like UI on HDMI.
-	if st.HasHDMI {
-		return false
-	}
-	// If there is touch and some non-HDMI display (DSI or framebuffer), use touch UI.
-	if st.HasTouch && (st.HasDSI || len(st.Framebuffers) > 0) {
-		return true
-	}
-	return false
+	return nil
 }
 
 func waitFor(url string, timeout time.Duration) {
@@ -89,7 +127,7 @@ func waitFor(url string, timeout time.Duration) {
 	}
 }
 
-func kioskCommand(url string) (string, []string, error) {
+func kioskCommand(url, session string) (string, []string, error) {
 	// Raspberry Pi OS often uses "chromium-browser" or "chromium".
 	candidates := [][]string{
 		{"chromium-browser"},
@@ -113,15 +151,19 @@ func kioskCommand(url string) (string, []string, error) {
 	base := filepath.Base(exe)
 	switch {
 	case strings.Contains(base, "chromium") || strings.Contains(base, "chrome"):
-		return exe, []string{
+		args := []string{
 			"--kiosk",
 			"--no-first-run",
 			"--disable-infobars",
 			"--disable-session-crashed-bubble",
 			"--autoplay-policy=no-user-gesture-required",
 			"--check-for-update-interval=31536000",
-			"--app=" + url,
-		}, nil
+		}
+		if session != sessionX11 {
+			// Chromium defaults to X11 and would need Xwayland otherwise.
+			args = append(args, "--ozone-platform=wayland", "--enable-features=UseOzonePlatform")
+		}
+		return exe, append(args, "--app="+url), nil
 	case strings.Contains(base, "firefox"):
 		// Firefox kiosk support varies; start fullscreen.
 		return exe, []string{"--kiosk", url}, nil
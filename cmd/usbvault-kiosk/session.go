@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Graphical sessions the kiosk browser can be started in. Current Raspberry
+// Pi OS images run a Wayland compositor (labwc or wayfire) rather than X;
+// Lite images have no desktop at all, so the browser is started inside a
+// kiosk compositor of its own.
+const (
+	sessionAuto    = "auto"
+	sessionX11     = "x11"
+	sessionWayland = "wayland" // an already running compositor
+	sessionCage    = "cage"
+	sessionWeston  = "weston"
+	sessionConsole = "console" // no browser; text status screen only
+)
+
+var errConsoleSession = errors.New("text console requested")
+
+// kioskSession picks the session named by USBVAULT_KIOSK_SESSION, or for
+// "auto" the one the environment provides: a running Wayland compositor,
+// then X, then cage or weston when started from a bare console.
+func kioskSession() (string, error) {
+	session := strings.ToLower(strings.TrimSpace(os.Getenv("USBVAULT_KIOSK_SESSION")))
+	switch session {
+	case sessionX11, sessionWayland, sessionCage, sessionWeston, sessionConsole:
+		return session, nil
+	case "", sessionAuto:
+	default:
+		return "", fmt.Errorf("unknown USBVAULT_KIOSK_SESSION %q (want auto, x11, wayland, cage, weston, or console)", session)
+	}
+
+	if os.Getenv("WAYLAND_DISPLAY") != "" || os.Getenv("XDG_SESSION_TYPE") == "wayland" {
+		return sessionWayland, nil
+	}
+	if os.Getenv("DISPLAY") != "" {
+		return sessionX11, nil
+	}
+	for _, compositor := range []string{sessionCage, sessionWeston} {
+		if _, err := exec.LookPath(compositor); err == nil {
+			return compositor, nil
+		}
+	}
+	return "", fmt.Errorf("no X or Wayland session found and neither cage nor weston is installed")
+}
+
+// wrapSession returns the command line that runs browser args in session,
+// with the environment it needs.
+func wrapSession(session, browser string, args []string) (string, []string, []string, error) {
+	env := os.Environ()
+	if session == sessionX11 {
+		return browser, args, env, nil
+	}
+
+	// Wayland clients find the compositor socket under XDG_RUNTIME_DIR,
+	// which a system service does not get from a login.
+	if os.Getenv("XDG_RUNTIME_DIR") == "" {
+		env = append(env, fmt.Sprintf("XDG_RUNTIME_DIR=/run/user/%d", os.Getuid()))
+	}
+	env = append(env, "MOZ_ENABLE_WAYLAND=1")
+
+	switch session {
+	case sessionWayland:
+		return browser, args, env, nil
+	case sessionCage:
+		exe, err := exec.LookPath("cage")
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("cage not found in PATH")
+		}
+		// -d: no client-side decorations; -s: allow switching VTs.
+		return exe, append([]string{"-d", "-s", "--", browser}, args...), env, nil
+	case sessionWeston:
+		exe, err := exec.LookPath("weston")
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("weston not found in PATH")
+		}
+		// Weston 11 and later start the client given after "--".
+		return exe, append([]string{"--shell=kiosk-shell.so", "--", browser}, args...), env, nil
+	default:
+		return "", nil, nil, fmt.Errorf("unsupported kiosk session: %s", session)
+	}
+}
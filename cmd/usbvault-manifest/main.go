@@ -0,0 +1,111 @@
+// Command usbvault-manifest writes and compares sha256sum manifests, to find
+// which photos and videos two libraries do not share before consolidating
+// them. The local side is this vault's library, a manifest file (-in), or a
+// folder hashed on the spot (-dir). With -compare it prints the files whose
+// content is only on one side:
+//
+//	< path   only on the local side
+//	> path   only in the -compare manifest
+//
+// Without -compare it writes the local side's manifest to stdout.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/dbcrypt"
+	"businessplan/usbvault/internal/manifest"
+)
+
+func main() {
+	var (
+		in      = flag.String("in", "", "read the local side from this manifest instead of the vault")
+		dir     = flag.String("dir", "", "hash the files under this folder instead of reading the vault")
+		compare = flag.String("compare", "", "manifest to compare the local side with")
+		asJSON  = flag.Bool("json", false, "print the comparison as JSON")
+	)
+	flag.Parse()
+	logger := log.New(os.Stderr, "[usbvault-manifest] ", log.LstdFlags)
+	if *in != "" && *dir != "" {
+		logger.Fatal("use -in or -dir, not both")
+	}
+
+	local, err := localEntries(context.Background(), *in, *dir)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if *compare == "" {
+		if err := manifest.Write(os.Stdout, local); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	remote, err := readManifest(*compare)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	diff := manifest.Compare(local, remote)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+	for _, e := range diff.OnlyLocal {
+		fmt.Printf("< %s\n", e.Path)
+	}
+	for _, e := range diff.OnlyRemote {
+		fmt.Printf("> %s\n", e.Path)
+	}
+	logger.Printf("local=%d other=%d shared contents=%d only local=%d only other=%d",
+		diff.LocalFiles, diff.RemoteFiles, diff.Common, len(diff.OnlyLocal), len(diff.OnlyRemote))
+}
+
+func localEntries(ctx context.Context, in, dir string) ([]manifest.Entry, error) {
+	switch {
+	case in != "":
+		return readManifest(in)
+	case dir != "":
+		// A vault folder holds its work area too; those are not library files.
+		return manifest.HashDir(dir, func(d string) bool {
+			return filepath.Base(d) == config.WorkDirName
+		})
+	}
+
+	// Unlocking an encrypted database would replace the running server's
+	// working copy, so that case goes through the server instead.
+	if _, err := os.Stat(dbcrypt.EncryptedPath()); err == nil || config.DBEncryptionEnabled() {
+		return nil, errors.New("the database is encrypted; download the manifest from GET /api/checksums instead")
+	}
+	store, err := db.Open(config.DBPath())
+	if err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	defer store.Close()
+	return manifest.Library(ctx, store)
+}
+
+func readManifest(path string) ([]manifest.Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := manifest.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,95 @@
+// Command usbvault-migrate moves the library to a new base storage folder
+// while the vault is stopped: it copies the whole tree with every file
+// checked by SHA256, points the database at the copy, and only then
+// changes the base storage setting. The old folder is left in place.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"businessplan/usbvault/internal/dbcrypt"
+	"businessplan/usbvault/internal/relocate"
+)
+
+func main() {
+	to := flag.String("to", "", "new base storage folder (absolute, empty or not there yet)")
+	flag.Parse()
+	os.Exit(run(*to))
+}
+
+// run moves the library and returns the exit code. It returns rather than
+// exits so the database is sealed again on failure too.
+func run(to string) int {
+	to = strings.TrimSpace(to)
+
+	logger := log.New(os.Stdout, "[usbvault-migrate] ", log.LstdFlags|log.Lmicroseconds)
+	if to == "" {
+		logger.Printf("-to is required")
+		return 2
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	store, vault, err := dbcrypt.OpenStore(ctx, logger)
+	if err != nil {
+		logger.Printf("open db: %v", err)
+		return 1
+	}
+	defer func() {
+		if vault != nil {
+			if err := vault.Seal(context.Background(), store.Snapshot); err != nil {
+				logger.Printf("seal db: %v (working copy left at %s)", err, vault.WorkPath())
+				_ = store.Close()
+				return
+			}
+			defer vault.Wipe()
+		}
+		_ = store.Close()
+	}()
+
+	from, ok, err := store.GetSetting(ctx, relocate.BaseStorageSetting)
+	if err != nil {
+		logger.Printf("read base_storage_dir: %v", err)
+		return 1
+	}
+	if !ok || strings.TrimSpace(from) == "" {
+		logger.Printf("base_storage_dir not configured")
+		return 1
+	}
+	from = filepath.Clean(strings.TrimSpace(from))
+	logger.Printf("moving library: %s -> %s", from, filepath.Clean(to))
+
+	var (
+		phase string
+		last  time.Time
+	)
+	res, err := relocate.Move(ctx, store, from, to, func(p relocate.Progress) {
+		if p.Phase != phase {
+			phase = p.Phase
+			logger.Printf("%s: %d files, %d bytes", p.Phase, p.TotalFiles, p.TotalBytes)
+		}
+		if time.Since(last) >= 5*time.Second {
+			last = time.Now()
+			logger.Printf("copied %d/%d files, %d/%d bytes", p.CopiedFiles, p.TotalFiles, p.CopiedBytes, p.TotalBytes)
+		}
+	})
+	if err != nil {
+		logger.Printf("migration failed; the library still points at %s: %v", from, err)
+		if res.CopiedFiles > 0 {
+			logger.Printf("empty %s before trying again", res.To)
+		}
+		return 1
+	}
+	logger.Printf("done: %d files, %d bytes copied and verified (%d caught up); %d media, %d sidecars, %d trashed and %d pending purge records moved",
+		res.CopiedFiles, res.CopiedBytes, res.CaughtUp, res.Records.Media, res.Records.Sidecars, res.Records.Trash, res.Records.Purges)
+	logger.Printf("base storage is now %s; %s can be removed once the new copy has been checked", res.To, from)
+	return 0
+}
@@ -0,0 +1,219 @@
+// Command usbvault-reconcile compares the library folder with the database
+// while the vault is stopped. It lists files under base storage that no
+// record knows (orphans) and records whose file is gone, and with -import
+// ingests the orphans that are supported media through the normal metadata
+// pipeline, as an upload would.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/dbcrypt"
+	"businessplan/usbvault/internal/geocode"
+	"businessplan/usbvault/internal/ingest"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/storage"
+)
+
+type orphan struct {
+	Path       string `json:"path"`
+	SizeBytes  int64  `json:"size_bytes"`
+	Kind       string `json:"kind,omitempty"`
+	Importable bool   `json:"importable"`
+}
+
+type missingFile struct {
+	ID        int64  `json:"id"`
+	DestPath  string `json:"dest_path"`
+	SizeBytes int64  `json:"size_bytes"`
+	SHA256    string `json:"sha256"`
+}
+
+type report struct {
+	BaseStorage string         `json:"base_storage"`
+	Orphans     []orphan       `json:"orphans"`
+	Missing     []missingFile  `json:"missing_files"`
+	Imported    *ingest.Result `json:"imported,omitempty"`
+}
+
+func main() {
+	var (
+		doImport = flag.Bool("import", false, "ingest orphans that are supported media (default is report only)")
+		asJSON   = flag.Bool("json", false, "print the report as JSON")
+	)
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "[usbvault-reconcile] ", log.LstdFlags|log.Lmicroseconds)
+	ctx := context.Background()
+
+	store, vault, err := dbcrypt.OpenStore(ctx, logger)
+	if err != nil {
+		logger.Fatalf("open db: %v", err)
+	}
+	defer func() {
+		if vault != nil {
+			if err := vault.Seal(context.Background(), store.Snapshot); err != nil {
+				logger.Printf("seal db: %v (working copy left at %s)", err, vault.WorkPath())
+				_ = store.Close()
+				return
+			}
+			defer vault.Wipe()
+		}
+		_ = store.Close()
+	}()
+
+	base, ok, err := store.GetSetting(ctx, "base_storage_dir")
+	if err != nil {
+		logger.Fatalf("read base_storage_dir: %v", err)
+	}
+	if !ok || strings.TrimSpace(base) == "" {
+		logger.Fatalf("base_storage_dir not configured")
+	}
+	base = filepath.Clean(strings.TrimSpace(base))
+	if info, err := os.Stat(base); err != nil || !info.IsDir() {
+		logger.Fatalf("base storage %s is not available", base)
+	}
+
+	rep, err := scan(ctx, store, base)
+	if err != nil {
+		logger.Fatalf("scan: %v", err)
+	}
+	if *doImport {
+		res, err := importOrphans(ctx, store, rep.Orphans, logger)
+		if err != nil {
+			logger.Fatalf("import: %v", err)
+		}
+		rep.Imported = &res
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			logger.Fatalf("write report: %v", err)
+		}
+		return
+	}
+	for _, o := range rep.Orphans {
+		note := ""
+		if !o.Importable {
+			note = "  (not importable)"
+		}
+		fmt.Printf("orphan   %s  %d bytes%s\n", o.Path, o.SizeBytes, note)
+	}
+	for _, m := range rep.Missing {
+		fmt.Printf("missing  %s  (media %d)\n", m.DestPath, m.ID)
+	}
+	fmt.Printf("%d orphans, %d records without their file\n", len(rep.Orphans), len(rep.Missing))
+	if rep.Imported != nil {
+		fmt.Printf("imported: %d copied, %d duplicates left in place, %d skipped, %d errors\n",
+			rep.Imported.Copied, rep.Imported.Duplicates, rep.Imported.Skipped, rep.Imported.Errors)
+	}
+}
+
+// scan walks base storage, outside the work area and leaving out partial
+// copies, and compares it with the records, their sidecars and the files
+// of deletes waiting to be purged. It changes nothing: moved files are
+// relinked, and missing ones flagged, by the vault's own library check.
+func scan(ctx context.Context, store *db.Store, base string) (report, error) {
+	rep := report{BaseStorage: base, Orphans: []orphan{}, Missing: []missingFile{}}
+	files, err := store.MediaFiles(ctx)
+	if err != nil {
+		return rep, err
+	}
+	known, err := store.AccountedPaths(ctx)
+	if err != nil {
+		return rep, err
+	}
+	for _, f := range files {
+		if !storage.IsLocal(f.DestPath) {
+			continue
+		}
+		known[f.DestPath] = struct{}{}
+		if _, err := os.Stat(f.DestPath); err != nil {
+			rep.Missing = append(rep.Missing, missingFile{ID: f.ID, DestPath: f.DestPath, SizeBytes: f.SizeBytes, SHA256: f.SHA256})
+		}
+	}
+
+	workDir := filepath.Join(base, config.WorkDirName)
+	err = filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == base {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path == workDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(path, ".part") {
+			return nil
+		}
+		if _, ok := known[path]; ok {
+			return nil
+		}
+		o := orphan{Path: path}
+		if info, err := d.Info(); err == nil {
+			o.SizeBytes = info.Size()
+		}
+		if kind, ok := config.IsSupportedMedia(path); ok {
+			o.Kind = kind
+			o.Importable = o.SizeBytes > 0 && !libcrypt.IsEncrypted(path)
+		}
+		rep.Orphans = append(rep.Orphans, o)
+		return nil
+	})
+	sort.Slice(rep.Orphans, func(i, j int) bool { return rep.Orphans[i].Path < rep.Orphans[j].Path })
+	return rep, err
+}
+
+// importOrphans ingests the importable orphans the way the vault would,
+// encrypting them when library encryption is on. Libraries in remote
+// storage are left to the running vault.
+func importOrphans(ctx context.Context, store *db.Store, orphans []orphan, logger *log.Logger) (ingest.Result, error) {
+	spec, err := config.StorageBackend()
+	if err != nil {
+		return ingest.Result{}, err
+	}
+	if spec != "local" {
+		return ingest.Result{}, fmt.Errorf("library storage is %q; import orphans with POST /api/library/reconcile while the vault runs", spec)
+	}
+	ingestor := ingest.NewManager(store, audit.New(store), geocode.New(store), nil, logger)
+	if config.LibraryEncryptionEnabled() {
+		passphrase, err := config.LibraryPassphrase()
+		if err != nil {
+			return ingest.Result{}, err
+		}
+		key, err := libcrypt.LoadOrCreateKey(config.LibraryKeyPath(), passphrase)
+		clear(passphrase)
+		if err != nil {
+			return ingest.Result{}, fmt.Errorf("library key: %w", err)
+		}
+		ingestor.SetLibraryKey(key)
+	}
+	paths := make([]string, 0, len(orphans))
+	for _, o := range orphans {
+		if o.Importable {
+			paths = append(paths, o.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return ingest.Result{}, nil
+	}
+	return ingestor.ImportOrphans(ctx, "usbvault-reconcile", paths)
+}
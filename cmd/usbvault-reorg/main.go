@@ -15,7 +15,8 @@ import (
 	"time"
 
 	"businessplan/usbvault/internal/config"
-	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/dbcrypt"
+	"businessplan/usbvault/internal/pathname"
 )
 
 type mediaRow struct {
@@ -41,11 +42,21 @@ func main() {
 	logger := log.New(os.Stdout, "[usbvault-reorg] ", log.LstdFlags|log.Lmicroseconds)
 	ctx := context.Background()
 
-	store, err := db.Open(config.DBPath())
+	store, vault, err := dbcrypt.OpenStore(ctx, logger)
 	if err != nil {
 		logger.Fatalf("open db: %v", err)
 	}
-	defer store.Close()
+	defer func() {
+		if vault != nil {
+			if err := vault.Seal(context.Background(), store.Snapshot); err != nil {
+				logger.Printf("seal db: %v (working copy left at %s)", err, vault.WorkPath())
+				_ = store.Close()
+				return
+			}
+			defer vault.Wipe()
+		}
+		_ = store.Close()
+	}()
 
 	base, ok, err := store.GetSetting(ctx, "base_storage_dir")
 	if err != nil {
@@ -106,7 +117,7 @@ func main() {
 			continue
 		}
 
-		finalPath, err := allocateUniquePath(ctx, store.DB, newPath, r.ID)
+		finalPath, err := allocateUniquePath(ctx, store.DB, newPath, oldPath, r.ID)
 		if err != nil {
 			errorsCount++
 			logger.Printf("allocate failed id=%d: %v", r.ID, err)
@@ -192,12 +203,15 @@ func computeNewPath(base string, r mediaRow) (string, error) {
 	}
 
 	folderParts := append(parts, tm.Format("2006"), tm.Format("01"), tm.Format("02"))
-	folder := filepath.Join(append([]string{base}, folderParts...)...)
 	filename := filepath.Base(filepath.Clean(r.DestPath))
 	if filename == "" || filename == "." || filename == string(filepath.Separator) {
 		filename = fmt.Sprintf("media_%d", r.ID)
 	}
-	return filepath.Join(folder, filename), nil
+	filename = pathname.File(filename)
+	ext := filepath.Ext(filename)
+	folderParts, stem := pathname.Fit(folderParts, strings.TrimSuffix(filename, ext), ext)
+	folder := filepath.Join(append([]string{base}, folderParts...)...)
+	return filepath.Join(folder, stem+ext), nil
 }
 
 func buildLocationParts(r mediaRow) []string {
@@ -220,37 +234,12 @@ func buildLocationParts(r mediaRow) []string {
 }
 
 func sanitizeFolderName(name string) string {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return ""
-	}
-	name = strings.ReplaceAll(name, string(filepath.Separator), "_")
-	name = strings.Map(func(r rune) rune {
-		switch {
-		case r >= 'a' && r <= 'z':
-			return r
-		case r >= 'A' && r <= 'Z':
-			return r
-		case r >= '0' && r <= '9':
-			return r
-		case r == ' ':
-			return '_'
-		case r == '.', r == '-', r == '_':
-			return r
-		default:
-			return '_'
-		}
-	}, name)
-	name = strings.Trim(name, "_.")
-	if len(name) > 64 {
-		name = name[:64]
-	}
-	return name
+	return pathname.Folder(name, config.ASCIIFolderNames())
 }
 
-func allocateUniquePath(ctx context.Context, dbConn *sql.DB, desired string, id int64) (string, error) {
+func allocateUniquePath(ctx context.Context, dbConn *sql.DB, desired, current string, id int64) (string, error) {
 	candidate := desired
-	if ok, err := pathAvailable(ctx, dbConn, candidate); err != nil {
+	if ok, err := pathAvailable(ctx, dbConn, candidate, current, id); err != nil {
 		return "", err
 	} else if ok {
 		return candidate, nil
@@ -262,7 +251,7 @@ func allocateUniquePath(ctx context.Context, dbConn *sql.DB, desired string, id
 
 	for i := 1; i <= 10000; i++ {
 		alt := filepath.Join(dir, fmt.Sprintf("%s_r%d_%d%s", base, id, i, ext))
-		ok, err := pathAvailable(ctx, dbConn, alt)
+		ok, err := pathAvailable(ctx, dbConn, alt, current, id)
 		if err != nil {
 			return "", err
 		}
@@ -274,11 +263,14 @@ func allocateUniquePath(ctx context.Context, dbConn *sql.DB, desired string, id
 	return "", errors.New("unable to allocate unique destination")
 }
 
-func pathAvailable(ctx context.Context, dbConn *sql.DB, path string) (bool, error) {
-	if _, err := os.Stat(path); err == nil {
+// pathAvailable reports whether record id can move to path, comparing names
+// without case so the library stays valid on case-insensitive volumes. A
+// case-only rename of the record's own current path is allowed.
+func pathAvailable(ctx context.Context, dbConn *sql.DB, path, current string, id int64) (bool, error) {
+	if !strings.EqualFold(path, current) && pathname.ExistsFold(path) {
 		return false, nil
 	}
-	row := dbConn.QueryRowContext(ctx, `SELECT 1 FROM media_files WHERE dest_path = ? LIMIT 1`, path)
+	row := dbConn.QueryRowContext(ctx, `SELECT 1 FROM media_files WHERE dest_path = ? COLLATE NOCASE AND id <> ? LIMIT 1`, path, id)
 	var marker int
 	if err := row.Scan(&marker); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
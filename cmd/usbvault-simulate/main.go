@@ -0,0 +1,202 @@
+// Command usbvault-simulate writes a synthetic camera card and ingests it
+// into a throwaway database and library, the same way a mounted card is
+// ingested. Use it to load-test a unit or to check a new deployment end to
+// end before taking it into the field: it exits non-zero when the library
+// does not end up holding what the card did.
+//
+// The config file and environment are read as the server reads them, so
+// USBVAULT_INGEST_WORKERS and similar settings apply. The running server's
+// database and library are never touched.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/geocode"
+	"businessplan/usbvault/internal/ingest"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/simcard"
+)
+
+type report struct {
+	Card       string        `json:"card"`
+	Library    string        `json:"library"`
+	CardBytes  int64         `json:"card_bytes"`
+	Seconds    float64       `json:"seconds"`
+	MBps       float64       `json:"mbps"`
+	Result     ingest.Result `json:"result"`
+	Records    int           `json:"records"`
+	WithGPS    int           `json:"with_gps"`
+	WithCamera int           `json:"with_camera"`
+	Kept       bool          `json:"kept"`
+	Problems   []string      `json:"problems,omitempty"`
+}
+
+func main() {
+	var (
+		images    = flag.Int("images", 200, "JPEG images with EXIF capture time, camera and GPS")
+		videos    = flag.Int("videos", 10, "MP4 videos")
+		videoMiB  = flag.Int("video-mib", 20, "size of each video in MiB")
+		width     = flag.Int("width", 1024, "image width in pixels")
+		dupes     = flag.Int("dupes", 5, "images copied a second time, which ingest should skip as duplicates")
+		lat       = flag.Float64("lat", 39.7392, "latitude images are placed around")
+		lon       = flag.Float64("lon", -104.9903, "longitude images are placed around")
+		spread    = flag.Float64("spread", 0.05, "degrees images are scattered around -lat/-lon")
+		seed      = flag.Uint64("seed", 1, "seed for image content and positions")
+		work      = flag.String("dir", "", "folder for the card, database and library (default: a new temp folder)")
+		storage   = flag.String("storage", "", "write the library here instead, e.g. on the drive to be checked")
+		keep      = flag.Bool("keep", false, "keep the card, database and library afterwards")
+		encrypt   = flag.Bool("encrypt", false, "encrypt the library with a throwaway key")
+		doGeocode = flag.Bool("geocode", false, "reverse geocode positions (sends requests to the geocoding service)")
+		asJSON    = flag.Bool("json", false, "print the report as JSON")
+	)
+	flag.Parse()
+	logger := log.New(os.Stderr, "[usbvault-simulate] ", log.LstdFlags)
+	if *images < 0 || *videos < 0 || *dupes < 0 || *videoMiB < 0 || *width < 16 {
+		logger.Fatal("counts and sizes must not be negative, and -width at least 16")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if _, err := config.LoadFile(); err != nil {
+		logger.Fatalf("config file: %v", err)
+	}
+
+	root := *work
+	if root == "" {
+		var err error
+		if root, err = os.MkdirTemp("", "usbvault-simulate-"); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	library := filepath.Join(root, "library")
+	if *storage != "" {
+		library = filepath.Join(*storage, fmt.Sprintf("usbvault-simulate-%d", time.Now().Unix()))
+	}
+	rep, err := simulate(ctx, logger, root, library, simcard.Spec{
+		Images:    *images,
+		Videos:    *videos,
+		Dupes:     *dupes,
+		Width:     *width,
+		VideoMiB:  *videoMiB,
+		Start:     time.Now().UTC().Add(-24 * time.Hour).Truncate(time.Second),
+		Lat:       *lat,
+		Lon:       *lon,
+		SpreadDeg: *spread,
+		Seed:      *seed,
+	}, *encrypt, *doGeocode)
+	if !*keep {
+		_ = os.RemoveAll(library)
+		if *work == "" {
+			_ = os.RemoveAll(root)
+		} else {
+			_ = os.RemoveAll(filepath.Join(root, "card"))
+			_ = os.Remove(filepath.Join(root, "usbvault.db"))
+		}
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+	rep.Kept = *keep
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			logger.Fatal(err)
+		}
+	} else {
+		fmt.Printf("card:      %s (%.1f MiB)\n", rep.Card, float64(rep.CardBytes)/(1<<20))
+		fmt.Printf("library:   %s\n", rep.Library)
+		fmt.Printf("ingest:    %.1fs, %.1f MB/s\n", rep.Seconds, rep.MBps)
+		fmt.Printf("result:    scanned=%d copied=%d duplicates=%d skipped=%d errors=%d\n",
+			rep.Result.Scanned, rep.Result.Copied, rep.Result.Duplicates, rep.Result.Skipped, rep.Result.Errors)
+		fmt.Printf("records:   %d, %d with GPS, %d with camera\n", rep.Records, rep.WithGPS, rep.WithCamera)
+		for _, p := range rep.Problems {
+			fmt.Printf("PROBLEM:   %s\n", p)
+		}
+	}
+	if len(rep.Problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+// simulate writes the card under root, ingests it into a new database there
+// and checks the outcome against spec.
+func simulate(ctx context.Context, logger *log.Logger, root, library string, spec simcard.Spec, encrypt, doGeocode bool) (report, error) {
+	rep := report{Card: filepath.Join(root, "card"), Library: library}
+	logger.Printf("writing %d images, %d videos and %d duplicates to %s", spec.Images, spec.Videos, spec.Dupes, rep.Card)
+	var err error
+	if rep.CardBytes, err = simcard.Write(rep.Card, spec); err != nil {
+		return rep, fmt.Errorf("write card: %w", err)
+	}
+
+	store, err := db.Open(filepath.Join(root, "usbvault.db"))
+	if err != nil {
+		return rep, fmt.Errorf("open db: %w", err)
+	}
+	defer store.Close()
+	if err := store.SetSetting(ctx, "base_storage_dir", library); err != nil {
+		return rep, err
+	}
+
+	var geocoder *geocode.ReverseGeocoder
+	if doGeocode {
+		geocoder = geocode.New(store)
+	}
+	ingestor := ingest.NewManager(store, audit.New(store), geocoder, nil, log.New(os.Stderr, "[ingest] ", log.LstdFlags))
+	if encrypt {
+		key, err := libcrypt.LoadOrCreateKey(filepath.Join(root, "library.key"), []byte("usbvault-simulate"))
+		if err != nil {
+			return rep, fmt.Errorf("library key: %w", err)
+		}
+		ingestor.SetLibraryKey(key)
+	}
+
+	logger.Printf("ingesting with %d worker(s)", config.IngestWorkers())
+	start := time.Now()
+	rep.Result, err = ingestor.ProcessMount(ctx, rep.Card, "simulate")
+	rep.Seconds = time.Since(start).Seconds()
+	if err != nil {
+		return rep, fmt.Errorf("ingest: %w", err)
+	}
+	if rep.Seconds > 0 {
+		rep.MBps = float64(rep.CardBytes) / (1 << 20) / rep.Seconds
+	}
+
+	if err := store.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(gps_lat), COUNT(NULLIF(make, ''))
+		FROM media_files`).Scan(&rep.Records, &rep.WithGPS, &rep.WithCamera); err != nil {
+		return rep, fmt.Errorf("count records: %w", err)
+	}
+	unique, dupes := spec.Images+spec.Videos, spec.Dupes
+	if spec.Images == 0 {
+		dupes = 0 // nothing to copy
+	}
+	expect := func(what string, got, want int) {
+		if got != want {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("%s: got %d, want %d", what, got, want))
+		}
+	}
+	expect("scanned", rep.Result.Scanned, unique+dupes)
+	expect("copied", rep.Result.Copied, unique)
+	expect("duplicates", rep.Result.Duplicates, dupes)
+	expect("errors", rep.Result.Errors, 0)
+	expect("records", rep.Records, unique)
+	expect("records with GPS", rep.WithGPS, spec.Images)
+	expect("records with camera", rep.WithCamera, spec.Images)
+	return rep, nil
+}
@@ -0,0 +1,326 @@
+// Command usbvault-soak ingests and backs up synthetic cards over and over
+// while injecting faults: read and write errors, slow reads, and a busy
+// database. After each faulted pass it runs the same work again with the
+// faults off and checks that nothing was left behind: no partial copies,
+// no library files without a record, no records without a matching file,
+// and no unfinished snapshots.
+//
+// Fault injection is compiled in only with the faultinject build tag:
+//
+//	go run -tags faultinject ./cmd/usbvault-soak -rounds 10
+//
+// Everything runs in a throwaway data folder; the server's database and
+// library are never touched. It exits non-zero when a check fails.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/backup"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/fault"
+	"businessplan/usbvault/internal/ingest"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/simcard"
+)
+
+type soak struct {
+	logger   *log.Logger
+	store    *db.Store
+	ingestor *ingest.Manager
+	backuper *backup.Manager
+	root     string
+	library  string
+	snaps    string
+	rules    []fault.Rule
+	seed     uint64
+	unique   int // distinct files on all cards so far
+	problems []string
+}
+
+func main() {
+	var (
+		rounds       = flag.Int("rounds", 5, "cards to ingest and back up")
+		images       = flag.Int("images", 60, "images per card")
+		videos       = flag.Int("videos", 4, "videos per card")
+		videoMiB     = flag.Int("video-mib", 4, "size of each video in MiB")
+		readErrors   = flag.Float64("read-errors", 0.002, "chance each read of a card file fails")
+		writeErrors  = flag.Float64("write-errors", 0.002, "chance each write of a library copy fails")
+		dbBusy       = flag.Float64("db-busy", 0.05, "chance recording a file finds the database locked")
+		backupErrors = flag.Float64("backup-errors", 0.005, "chance each write of a snapshot copy fails")
+		slow         = flag.Float64("slow", 0.01, "chance a read or write stalls")
+		slowDelay    = flag.Duration("slow-delay", 20*time.Millisecond, "how long a stalled read or write takes")
+		seed         = flag.Uint64("seed", 1, "seed for cards and fault decisions")
+		work         = flag.String("dir", "", "folder for cards, data, library and snapshots (default: a new temp folder)")
+		keep         = flag.Bool("keep", false, "keep everything afterwards")
+	)
+	flag.Parse()
+	logger := log.New(os.Stderr, "[usbvault-soak] ", log.LstdFlags)
+	if !fault.Enabled {
+		logger.Fatal("built without fault injection; run with -tags faultinject")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if _, err := config.LoadFile(); err != nil {
+		logger.Fatalf("config file: %v", err)
+	}
+	root := *work
+	if root == "" {
+		var err error
+		if root, err = os.MkdirTemp("", "usbvault-soak-"); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	root, _ = filepath.Abs(root)
+	// Snapshots copy the database from the data folder, so it must be ours.
+	os.Setenv("USBVAULT_DATA_DIR", filepath.Join(root, "data"))
+
+	store, err := db.Open(config.DBPath())
+	if err != nil {
+		logger.Fatalf("open db: %v", err)
+	}
+	s := &soak{
+		logger:   logger,
+		store:    store,
+		ingestor: ingest.NewManager(store, audit.New(store), nil, nil, log.New(os.Stderr, "[ingest] ", log.LstdFlags)),
+		backuper: backup.NewManager(store, nil, log.New(os.Stderr, "[backup] ", log.LstdFlags)),
+		root:     root,
+		library:  filepath.Join(root, "library"),
+		snaps:    filepath.Join(root, "snapshots"),
+		seed:     *seed,
+		rules: []fault.Rule{
+			{Point: fault.MediaRead, ErrorRate: *readErrors, DelayRate: *slow, Delay: *slowDelay},
+			{Point: fault.LibraryWrite, ErrorRate: *writeErrors, DelayRate: *slow, Delay: *slowDelay},
+			{Point: fault.DBWrite, ErrorRate: *dbBusy, Err: fault.ErrDBBusy},
+			{Point: fault.BackupWrite, ErrorRate: *backupErrors},
+		},
+	}
+	err = s.store.SetSetting(ctx, "base_storage_dir", s.library)
+	for round := 1; err == nil && round <= *rounds; round++ {
+		err = s.round(ctx, round, simcard.Spec{
+			Images:    *images,
+			Videos:    *videos,
+			Dupes:     *images / 10,
+			Width:     640,
+			VideoMiB:  *videoMiB,
+			Start:     time.Now().UTC().Add(-time.Duration(round) * 24 * time.Hour).Truncate(time.Second),
+			Lat:       39.7392,
+			Lon:       -104.9903,
+			SpreadDeg: 0.05,
+			Seed:      *seed + uint64(round),
+		})
+	}
+	_ = store.Close()
+	if !*keep && *work == "" {
+		_ = os.RemoveAll(root)
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(s.problems) > 0 {
+		for _, p := range s.problems {
+			fmt.Println("PROBLEM:", p)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("soak passed: %d rounds, %d files\n", *rounds, s.unique)
+}
+
+// round ingests and backs up one new card, first with faults and then
+// without, and checks the library and snapshots after each clean pass.
+func (s *soak) round(ctx context.Context, n int, spec simcard.Spec) error {
+	card := filepath.Join(s.root, fmt.Sprintf("card-%02d", n))
+	if _, err := simcard.Write(card, spec); err != nil {
+		return fmt.Errorf("write card: %w", err)
+	}
+	s.unique += spec.Images + spec.Videos
+
+	fault.Set(s.seed+uint64(n), s.rules...)
+	faulted, err := s.ingestor.ProcessMount(ctx, card, "soak")
+	if err != nil && ctx.Err() != nil {
+		fault.Reset()
+		return err
+	}
+	faultedBackup := s.backup(ctx)
+	fault.Reset()
+	stats := fault.Stats()
+
+	clean, err := s.ingestor.ProcessMount(ctx, card, "soak")
+	if err != nil {
+		return fmt.Errorf("clean ingest: %w", err)
+	}
+	if clean.Errors > 0 {
+		s.problemf("round %d: clean ingest had %d errors", n, clean.Errors)
+	}
+	cleanBackup := s.backup(ctx)
+	if cleanBackup != "success" {
+		s.problemf("round %d: clean backup ended %s", n, cleanBackup)
+	}
+	s.checkLibrary(ctx, n)
+	s.checkSnapshots(n)
+
+	s.logger.Printf("round %d: faulted ingest copied=%d errors=%d, backup %s; clean ingest copied=%d duplicates=%d errors=%d, backup %s; %s",
+		n, faulted.Copied, faulted.Errors, faultedBackup, clean.Copied, clean.Duplicates, clean.Errors, cleanBackup, formatStats(stats))
+	return nil
+}
+
+// backup takes a snapshot and waits for it, returning how it ended.
+func (s *soak) backup(ctx context.Context) string {
+	if err := s.backuper.Start("soak", backup.Request{Mode: "snapshot", Destination: s.snaps}); err != nil {
+		return "error: " + err.Error()
+	}
+	// Snapshots are named by the second; two in the same second clash.
+	defer time.Sleep(time.Second)
+	for {
+		st := s.backuper.GetStatus()
+		if st.State != "running" {
+			return st.State
+		}
+		select {
+		case <-ctx.Done():
+			return "interrupted"
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// checkLibrary compares the library folder with the database: every record
+// has its file with the recorded content, and every file has a record.
+func (s *soak) checkLibrary(ctx context.Context, n int) {
+	rows, err := s.store.DB.QueryContext(ctx, `SELECT dest_path, size_bytes, sha256 FROM media_files`)
+	if err != nil {
+		s.problemf("round %d: list records: %v", n, err)
+		return
+	}
+	recorded := map[string]struct{}{}
+	for rows.Next() {
+		var path, sum string
+		var size int64
+		if err := rows.Scan(&path, &size, &sum); err != nil {
+			s.problemf("round %d: list records: %v", n, err)
+			break
+		}
+		recorded[path] = struct{}{}
+		info, err := os.Stat(path)
+		if err != nil {
+			s.problemf("round %d: record without file: %s", n, path)
+			continue
+		}
+		if info.Size() != size {
+			s.problemf("round %d: %s is %d bytes, recorded %d", n, path, info.Size(), size)
+			continue
+		}
+		if _, got, err := media.ComputeHashes(path); err != nil || got != sum {
+			s.problemf("round %d: %s does not match its recorded sha256", n, path)
+		}
+	}
+	rows.Close()
+	if len(recorded) != s.unique {
+		s.problemf("round %d: %d records, want %d", n, len(recorded), s.unique)
+	}
+
+	for _, rel := range libraryFiles(s.library) {
+		path := filepath.Join(s.library, rel)
+		switch {
+		case strings.HasSuffix(path, ".part"):
+			s.problemf("round %d: partial copy left behind: %s", n, path)
+		default:
+			if _, ok := recorded[path]; !ok {
+				s.problemf("round %d: file without record: %s", n, path)
+			}
+		}
+	}
+}
+
+// checkSnapshots looks for unfinished snapshots and checks the newest
+// holds every library file.
+func (s *soak) checkSnapshots(n int) {
+	entries, err := os.ReadDir(s.snaps)
+	if err != nil {
+		s.problemf("round %d: list snapshots: %v", n, err)
+		return
+	}
+	var done []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".partial") {
+			s.problemf("round %d: unfinished snapshot left behind: %s", n, e.Name())
+		} else {
+			done = append(done, e.Name())
+		}
+	}
+	if len(done) == 0 {
+		s.problemf("round %d: no snapshot", n)
+		return
+	}
+	sort.Strings(done)
+	latest := filepath.Join(s.snaps, done[len(done)-1], "media")
+	have := map[string]struct{}{}
+	for _, rel := range libraryFiles(latest) {
+		have[rel] = struct{}{}
+	}
+	for _, rel := range libraryFiles(s.library) {
+		if _, ok := have[rel]; !ok {
+			s.problemf("round %d: snapshot %s is missing %s", n, done[len(done)-1], rel)
+		}
+	}
+}
+
+// libraryFiles lists the files under dir, relative to it, leaving out the
+// work area, whose thumbnails are still being written.
+func libraryFiles(dir string) []string {
+	var out []string
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() && d.Name() == config.WorkDirName {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() {
+			rel, _ := filepath.Rel(dir, path)
+			out = append(out, rel)
+		}
+		return nil
+	})
+	return out
+}
+
+func (s *soak) problemf(format string, args ...any) {
+	s.problems = append(s.problems, fmt.Sprintf(format, args...))
+}
+
+func formatStats(stats map[string]fault.Count) string {
+	points := make([]string, 0, len(stats))
+	for p := range stats {
+		points = append(points, p)
+	}
+	sort.Strings(points)
+	parts := make([]string, 0, len(points))
+	for _, p := range points {
+		c := stats[p]
+		parts = append(parts, fmt.Sprintf("%s %d/%d failed, %d slow", p, c.Errors, c.Calls, c.Delays))
+	}
+	if len(parts) == 0 {
+		return "no faults reached"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -8,6 +8,7 @@ import (
 	"syscall"
 
 	"businessplan/usbvault/internal/app"
+	"businessplan/usbvault/internal/config"
 )
 
 func main() {
@@ -16,10 +17,25 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	if _, err := config.LoadFile(); err != nil {
+		logger.Fatalf("config file: %v", err)
+	}
+
 	application, err := app.New(logger)
 	if err != nil {
 		logger.Fatalf("failed to initialize app: %v", err)
 	}
+
+	// SIGHUP re-reads the config file without interrupting an ingest.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if _, err := application.Reload(ctx, "system"); err != nil {
+				logger.Printf("reload failed: %v", err)
+			}
+		}
+	}()
 	defer func() {
 		if err := application.Close(); err != nil {
 			logger.Printf("close error: %v", err)
@@ -0,0 +1,238 @@
+package alerts
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/hooks"
+	"businessplan/usbvault/internal/i18n"
+)
+
+const (
+	KindBruteForce = "brute_force"
+	KindNewLoginIP = "new_login_ip"
+	KindMassDelete = "mass_delete"
+	KindGuestShare = "guest_shared"
+	KindRecovery   = "recovery_code_used"
+)
+
+// Detector watches the audit stream for a few intrusion patterns and records
+// a security alert when one trips. It is meant for a single-admin appliance,
+// so thresholds are fixed and state lives in memory apart from the alerts
+// themselves.
+type Detector struct {
+	store  *db.Store
+	hooks  *hooks.Runner
+	logger *log.Logger
+	locale *i18n.Locale // alerts are shared, so they use the vault's locale
+
+	failureThreshold int
+	failureWindow    time.Duration
+	deleteThreshold  int
+	deleteWindow     time.Duration
+	cooldown         time.Duration
+	now              func() time.Time
+
+	mu         sync.Mutex
+	failures   map[string][]time.Time
+	swept      time.Time
+	deletions  []deletion
+	lastRaised map[string]time.Time
+}
+
+type deletion struct {
+	at    time.Time
+	count int
+}
+
+func New(store *db.Store, hookRunner *hooks.Runner, logger *log.Logger) *Detector {
+	return &Detector{
+		store:            store,
+		hooks:            hookRunner,
+		logger:           logger,
+		locale:           i18n.Default(),
+		failureThreshold: 5,
+		failureWindow:    10 * time.Minute,
+		deleteThreshold:  100,
+		deleteWindow:     10 * time.Minute,
+		cooldown:         30 * time.Minute,
+		now:              time.Now,
+		failures:         map[string][]time.Time{},
+		lastRaised:       map[string]time.Time{},
+	}
+}
+
+// Observe implements audit.Observer.
+func (d *Detector) Observe(ctx context.Context, actor, action string, details map[string]any) {
+	switch action {
+	case "login_failed":
+		d.observeLoginFailure(ctx, details)
+	case "login":
+		d.observeLogin(ctx, actor, details)
+	case "media_deleted":
+		d.observeDeletion(ctx, actor, details)
+	case "guest_access_suspicious":
+		d.observeGuestShare(ctx, details)
+	case "recovery_code_used":
+		d.observeRecovery(ctx, actor, details)
+	}
+}
+
+func (d *Detector) observeLoginFailure(ctx context.Context, details map[string]any) {
+	ip := stringValue(details["ip"])
+	username := stringValue(details["username"])
+	for _, key := range []string{"ip:" + ip, "user:" + username} {
+		if key == "ip:" || key == "user:" {
+			continue
+		}
+		if n := d.recordFailure(key); n >= d.failureThreshold {
+			d.raise(ctx, KindBruteForce, key,
+				d.locale.Tf("%d failed logins in %s (%s)", n, d.failureWindow, key),
+				map[string]any{"ip": ip, "username": username, "failures": n})
+		}
+	}
+}
+
+func (d *Detector) recordFailure(key string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	cutoff := now.Add(-d.failureWindow)
+	// Once a window, forget the keys that have not failed within it, so
+	// addresses and usernames tried once do not pile up.
+	if now.Sub(d.swept) >= d.failureWindow {
+		for k, times := range d.failures {
+			if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+				delete(d.failures, k)
+			}
+		}
+		d.swept = now
+	}
+	kept := d.failures[key][:0]
+	for _, at := range d.failures[key] {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	kept = append(kept, now)
+	d.failures[key] = kept
+	return len(kept)
+}
+
+func (d *Detector) observeLogin(ctx context.Context, actor string, details map[string]any) {
+	ip := stringValue(details["ip"])
+	if ip == "" {
+		return
+	}
+	total, fromIP, err := d.store.CountLoginsFromIP(ctx, actor, ip)
+	if err != nil {
+		d.logf("alerts: login history for %s: %v", actor, err)
+		return
+	}
+	// The login being observed is already in the audit log, so a known
+	// address has at least two entries and a first-ever login is skipped.
+	if total > 1 && fromIP == 1 {
+		d.raise(ctx, KindNewLoginIP, "login:"+actor+"@"+ip,
+			d.locale.Tf("%s logged in from new address %s", actor, ip),
+			map[string]any{"username": actor, "ip": ip})
+	}
+}
+
+func (d *Detector) observeDeletion(ctx context.Context, actor string, details map[string]any) {
+	count := intValue(details["deleted"])
+	if count <= 0 {
+		return
+	}
+	d.mu.Lock()
+	now := d.now()
+	cutoff := now.Add(-d.deleteWindow)
+	kept := d.deletions[:0]
+	total := 0
+	for _, del := range d.deletions {
+		if del.at.After(cutoff) {
+			kept = append(kept, del)
+			total += del.count
+		}
+	}
+	kept = append(kept, deletion{at: now, count: count})
+	d.deletions = kept
+	total += count
+	d.mu.Unlock()
+
+	if total >= d.deleteThreshold {
+		d.raise(ctx, KindMassDelete, "delete",
+			d.locale.Tf("%d files deleted in %s (latest by %s)", total, d.deleteWindow, actor),
+			map[string]any{"username": actor, "deleted": total})
+	}
+}
+
+// observeGuestShare alerts on a guest login seen from many addresses,
+// which usually means it was passed on.
+func (d *Detector) observeGuestShare(ctx context.Context, details map[string]any) {
+	username := stringValue(details["username"])
+	message := d.locale.Tf("guest %s used from %d addresses in %s", username, intValue(details["addresses"]), stringValue(details["window"]))
+	if revoked, _ := details["revoked"].(bool); revoked {
+		message += d.locale.T("; the guest was revoked")
+	}
+	d.raise(ctx, KindGuestShare, "guest:"+username, message, details)
+}
+
+// observeRecovery alerts on every password reset with a recovery code, so
+// a code that was found and used by someone else does not go unnoticed.
+func (d *Detector) observeRecovery(ctx context.Context, actor string, details map[string]any) {
+	d.raise(ctx, KindRecovery, "recovery:"+actor+"@"+stringValue(details["ip"]),
+		d.locale.Tf("%s reset their password with a recovery code from %s; %d codes left", actor, stringValue(details["ip"]), intValue(details["remaining"])),
+		map[string]any{"username": actor, "ip": stringValue(details["ip"]), "remaining": intValue(details["remaining"])})
+}
+
+// raise stores an alert unless the same kind/key fired within the cooldown.
+func (d *Detector) raise(ctx context.Context, kind, key, message string, details map[string]any) {
+	d.mu.Lock()
+	dedupe := kind + "|" + key
+	now := d.now()
+	if last, ok := d.lastRaised[dedupe]; ok && now.Sub(last) < d.cooldown {
+		d.mu.Unlock()
+		return
+	}
+	d.lastRaised[dedupe] = now
+	d.mu.Unlock()
+
+	id, err := d.store.InsertSecurityAlert(context.WithoutCancel(ctx), kind, message, details)
+	if err != nil {
+		d.logf("alerts: record %s: %v", kind, err)
+		return
+	}
+	d.logf("SECURITY ALERT #%d [%s] %s", id, kind, message)
+
+	payload := map[string]any{"id": id, "kind": kind, "message": message}
+	for k, v := range details {
+		payload[k] = v
+	}
+	d.hooks.Fire(hooks.EventSecurityAlert, payload)
+}
+
+func (d *Detector) logf(format string, args ...any) {
+	if d.logger != nil {
+		d.logger.Printf(format, args...)
+	}
+}
+
+func stringValue(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func intValue(v any) int {
+	switch t := v.(type) {
+	case int:
+		return t
+	case int64:
+		return int(t)
+	case float64:
+		return int(t)
+	}
+	return 0
+}
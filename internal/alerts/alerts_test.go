@@ -0,0 +1,91 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestDetectorRaisesAlertsFromAuditStream(t *testing.T) {
+	t.Parallel()
+
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault-test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	logger := audit.New(store)
+	logger.SetObserver(New(store, nil, nil))
+
+	for i := 0; i < 6; i++ {
+		if err := logger.Log(ctx, "anonymous", "login_failed", map[string]any{"username": "admin", "ip": "10.0.0.9"}); err != nil {
+			t.Fatalf("Log: %v", err)
+		}
+	}
+	// Two keys (ip and username) trip once each; the cooldown suppresses repeats.
+	assertOpenAlerts(t, store, map[string]int{KindBruteForce: 2})
+
+	_ = logger.Log(ctx, "admin", "login", map[string]any{"ip": "10.0.0.2"})
+	_ = logger.Log(ctx, "admin", "login", map[string]any{"ip": "10.0.0.2"})
+	assertOpenAlerts(t, store, map[string]int{KindBruteForce: 2})
+	_ = logger.Log(ctx, "admin", "login", map[string]any{"ip": "10.0.0.77"})
+	assertOpenAlerts(t, store, map[string]int{KindBruteForce: 2, KindNewLoginIP: 1})
+
+	_ = logger.Log(ctx, "admin", "media_deleted", map[string]any{"deleted": 60})
+	assertOpenAlerts(t, store, map[string]int{KindBruteForce: 2, KindNewLoginIP: 1})
+	_ = logger.Log(ctx, "admin", "media_deleted", map[string]any{"deleted": 45})
+	assertOpenAlerts(t, store, map[string]int{KindBruteForce: 2, KindNewLoginIP: 1, KindMassDelete: 1})
+
+	if n, err := store.AcknowledgeSecurityAlerts(ctx, nil, "admin"); err != nil || n != 4 {
+		t.Fatalf("AcknowledgeSecurityAlerts = %d, %v; want 4", n, err)
+	}
+	if open, err := store.CountOpenSecurityAlerts(ctx); err != nil || open != 0 {
+		t.Fatalf("CountOpenSecurityAlerts = %d, %v; want 0", open, err)
+	}
+}
+
+func TestDetectorForgetsStaleFailures(t *testing.T) {
+	t.Parallel()
+
+	d := New(nil, nil, nil)
+	now := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	for i := 0; i < 50; i++ {
+		d.recordFailure(fmt.Sprintf("ip:10.0.%d.1", i))
+	}
+	now = now.Add(d.failureWindow + time.Second)
+	if n := d.recordFailure("ip:10.0.0.1"); n != 1 {
+		t.Fatalf("failures after the window = %d, want 1", n)
+	}
+	if len(d.failures) != 1 {
+		t.Fatalf("kept %d keys, want only the one that failed again", len(d.failures))
+	}
+}
+
+func assertOpenAlerts(t *testing.T, store *db.Store, want map[string]int) {
+	t.Helper()
+
+	items, err := store.ListSecurityAlerts(context.Background(), false, 100)
+	if err != nil {
+		t.Fatalf("ListSecurityAlerts: %v", err)
+	}
+	got := map[string]int{}
+	for _, item := range items {
+		got[item.Kind]++
+	}
+	if len(got) != len(want) {
+		t.Fatalf("open alerts = %v, want %v", got, want)
+	}
+	for kind, n := range want {
+		if got[kind] != n {
+			t.Fatalf("open alerts = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package app
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"businessplan/usbvault/internal/db"
+)
+
+// openAPISpec describes the calls most useful for scripting. /api/docs
+// turns it into curl examples for whoever asks.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+type apiSpec struct {
+	Info struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	} `json:"info"`
+	Tags []struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	} `json:"tags"`
+	Paths map[string]map[string]apiOperation `json:"paths"`
+}
+
+type apiOperation struct {
+	Tags       []string     `json:"tags"`
+	Summary    string       `json:"summary"`
+	Parameters []apiParam   `json:"parameters"`
+	Security   *[]any       `json:"security"` // set and empty when no sign-in is needed
+	Download   bool         `json:"x-download"`
+	Body       *apiBodySpec `json:"requestBody"`
+}
+
+type apiParam struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+	Example     any    `json:"example"`
+}
+
+type apiBodySpec struct {
+	Content map[string]struct {
+		Example json.RawMessage `json:"example"`
+	} `json:"content"`
+}
+
+func parseAPISpec() (*apiSpec, error) {
+	var spec apiSpec
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// apiExample is one call as a caller can run it.
+type apiExample struct {
+	Tag     string `json:"tag"`
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Summary string `json:"summary"`
+	Curl    string `json:"curl"`
+}
+
+// apiDocs is what /api/docs returns.
+type apiDocs struct {
+	Title   string `json:"title"`
+	BaseURL string `json:"base_url"`
+	// Scope is what the caller may call: admin, guest or field.
+	Scope        string       `json:"scope"`
+	ScopeAlbumID int64        `json:"scope_album_id,omitempty"`
+	Auth         string       `json:"auth"` // how the examples sign in
+	Setup        []string     `json:"setup"`
+	Examples     []apiExample `json:"examples"`
+}
+
+var apiMethodOrder = []string{"get", "post", "patch", "put", "delete"}
+
+func (a *App) handleOpenAPISpec(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(openAPISpec)
+}
+
+// handleAPIDocs lists the calls in the spec the caller may make, as curl
+// commands against this vault with ids from the caller's own library.
+// Browsers get a page; everything else gets JSON.
+func (a *App) handleAPIDocs(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	spec, err := parseAPISpec()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "api description is broken"})
+		return
+	}
+	docs := apiDocs{Title: spec.Info.Title, BaseURL: requestBaseURL(r), Scope: "admin", Examples: []apiExample{}}
+	switch {
+	case authCtx.IsGuest():
+		docs.Scope, docs.ScopeAlbumID = "guest", authCtx.ScopeAlbumID
+	case authCtx.Field:
+		docs.Scope = "field"
+	}
+
+	auth := `-H "Authorization: Bearer $USBVAULT_TOKEN"`
+	switch {
+	case isAPIToken(authCtx.Token) && len(authCtx.Token) >= apiTokenShown:
+		docs.Auth = "API token " + authCtx.Token[:apiTokenShown] + "..., the one this page was fetched with"
+		docs.Setup = []string{"export USBVAULT_TOKEN=uvt_..."}
+	case docs.Scope == "admin":
+		docs.Auth = "an API token; make one with POST /api/tokens, listed below"
+		docs.Setup = []string{"export USBVAULT_TOKEN=uvt_..."}
+	default:
+		// Guests and field sessions cannot make tokens, so scripts sign in.
+		auth = "-b cookies.txt"
+		docs.Auth = "a session cookie from signing in"
+		login, body := "/api/login", `{"username":"`+authCtx.Username+`","password":"..."}`
+		if authCtx.Field {
+			login, body = "/api/field-mode/unlock", `{"pin":"..."}`
+		}
+		docs.Setup = []string{shellJoin("curl", "-s", "-c", "cookies.txt", "-H", "Content-Type: application/json",
+			"-d", body, docs.BaseURL+login)}
+	}
+
+	ids := a.apiDocIDs(r, authCtx)
+	tagOrder := make(map[string]int, len(spec.Tags))
+	for i, t := range spec.Tags {
+		tagOrder[t.Name] = i
+	}
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			pattern := strings.ToUpper(method) + " " + path
+			if op.signIn() && !a.callerMayCall(authCtx, pattern) {
+				continue
+			}
+			tag := ""
+			if len(op.Tags) > 0 {
+				tag = op.Tags[0]
+			}
+			docs.Examples = append(docs.Examples, apiExample{
+				Tag:     tag,
+				Method:  strings.ToUpper(method),
+				Path:    path,
+				Summary: op.Summary,
+				Curl:    op.curl(strings.ToUpper(method), docs.BaseURL, path, auth, ids),
+			})
+		}
+	}
+	slices.SortFunc(docs.Examples, func(x, y apiExample) int {
+		if c := tagOrder[x.Tag] - tagOrder[y.Tag]; c != 0 {
+			return c
+		}
+		if c := strings.Compare(x.Path, y.Path); c != 0 {
+			return c
+		}
+		return slices.Index(apiMethodOrder, strings.ToLower(x.Method)) - slices.Index(apiMethodOrder, strings.ToLower(y.Method))
+	})
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		writeJSON(w, http.StatusOK, docs)
+		return
+	}
+	var page bytes.Buffer
+	if err := apiDocsPage.Execute(&page, docs); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "api description is broken"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(page.Bytes())
+}
+
+// callerMayCall applies the same limits withAuth and the read-only guard
+// do, so the docs offer only calls that will work.
+func (a *App) callerMayCall(authCtx *AuthContext, pattern string) bool {
+	method, path, _ := strings.Cut(pattern, " ")
+	if authCtx.IsGuest() && !guestAllowedRoute(pattern) {
+		return false
+	}
+	if authCtx.Field && !fieldAllowedRoute(pattern) {
+		return false
+	}
+	if a.readOnly && method != http.MethodGet && !readOnlyRoutes[method+" "+path] {
+		return false
+	}
+	return true
+}
+
+// apiDocIDs picks real ids for path parameters: the newest item and an
+// album the caller can see.
+func (a *App) apiDocIDs(r *http.Request, authCtx *AuthContext) map[string]string {
+	ids := map[string]string{}
+	filter := db.MediaFilter{}
+	applyGuestScope(authCtx, &filter)
+	if items, err := a.store.ListMediaFiltered(r.Context(), "capture_time", "desc", 1, 0, filter); err == nil && len(items) > 0 {
+		ids["media"] = strconv.FormatInt(items[0].ID, 10)
+		ids["sha256"] = items[0].SHA256
+	}
+	if authCtx.ScopeAlbumID > 0 {
+		ids["album"] = strconv.FormatInt(authCtx.ScopeAlbumID, 10)
+	} else if albums, err := a.store.ListAlbums(r.Context(), 1); err == nil && len(albums) > 0 {
+		ids["album"] = strconv.FormatInt(albums[0].ID, 10)
+	}
+	return ids
+}
+
+// signIn reports whether the call needs a signed-in caller.
+func (op apiOperation) signIn() bool {
+	return op.Security == nil || len(*op.Security) > 0
+}
+
+// curl builds the command for one operation. Path parameters take a live
+// id when there is one and the spec's example otherwise; query parameters
+// with an example are filled in.
+func (op apiOperation) curl(method, baseURL, path, auth string, ids map[string]string) string {
+	var query []string
+	for _, p := range op.Parameters {
+		value := ""
+		if p.Example != nil {
+			value = fmt.Sprint(p.Example)
+		}
+		switch p.In {
+		case "path":
+			kind := p.Name
+			if p.Name == "id" {
+				kind = "media"
+				if strings.HasPrefix(path, "/api/albums/") {
+					kind = "album"
+				}
+			}
+			if live := ids[kind]; live != "" {
+				value = live
+			}
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", value)
+		case "query":
+			if value != "" {
+				query = append(query, p.Name+"="+value)
+			}
+		}
+	}
+	url := baseURL + path
+	if len(query) > 0 {
+		url += "?" + strings.Join(query, "&")
+	}
+
+	args := []string{"curl", "-s"}
+	if op.Download {
+		args = append(args, "-OJ")
+	}
+	if method != http.MethodGet {
+		args = append(args, "-X", method)
+	}
+	cmd := shellJoin(args...)
+	if op.signIn() {
+		cmd += " " + auth
+	}
+	if op.Body != nil {
+		if c, ok := op.Body.Content["application/json"]; ok {
+			cmd += " " + shellJoin("-H", "Content-Type: application/json", "-d", compactJSON(c.Example))
+		} else if c, ok := op.Body.Content["multipart/form-data"]; ok {
+			var fields map[string]string
+			_ = json.Unmarshal(c.Example, &fields)
+			names := make([]string, 0, len(fields))
+			for k := range fields {
+				names = append(names, k)
+			}
+			slices.Sort(names)
+			for _, k := range names {
+				cmd += " " + shellJoin("-F", k+"="+fields[k])
+			}
+		}
+	}
+	return cmd + " " + shellJoin(url)
+}
+
+func compactJSON(raw json.RawMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, raw); err != nil {
+		return string(raw)
+	}
+	return b.String()
+}
+
+// shellJoin quotes the arguments that need it for a POSIX shell.
+func shellJoin(args ...string) string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@,+", r))
+		}) < 0 {
+			out[i] = arg
+			continue
+		}
+		out[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(out, " ")
+}
+
+// requestBaseURL is the vault's address as the caller reached it.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+var apiDocsPage = template.Must(template.New("docs").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body{font-family:system-ui,sans-serif;margin:0 auto;max-width:60rem;padding:1rem;background:#0b1220;color:#e5e7eb}
+h1{font-size:1.4rem}h2{font-size:1rem;margin:1.5rem 0 .25rem}p{color:#9ca3af}
+pre{background:#02050a;border:1px solid #1f2937;border-radius:8px;padding:.6rem;overflow-x:auto;white-space:pre-wrap;word-break:break-all}
+code{font-family:ui-monospace,monospace;font-size:.85rem}.method{color:#60a5fa;font-weight:600}
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Signed in as {{.Scope}}{{if .ScopeAlbumID}}, limited to album {{.ScopeAlbumID}}{{end}}. The examples call {{.BaseURL}} with {{.Auth}}.</p>
+{{range .Setup}}<pre><code>{{.}}</code></pre>{{end}}
+{{range .Examples}}<h2><span class="method">{{.Method}}</span> {{.Path}}</h2>
+<p>{{.Summary}}</p>
+<pre><code>{{.Curl}}</code></pre>
+{{end}}<p>The full description is at <a href="/api/openapi.json">/api/openapi.json</a>.</p>
+</body>
+</html>
+`))
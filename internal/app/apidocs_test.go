@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	spec, err := parseAPISpec()
+	if err != nil {
+		t.Fatalf("parseAPISpec: %v", err)
+	}
+	mux := http.NewServeMux()
+	(&App{}).registerRoutes(mux)
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			want := strings.ToUpper(method) + " " + path
+			url := path
+			for _, p := range op.Parameters {
+				if p.In == "path" {
+					url = strings.ReplaceAll(url, "{"+p.Name+"}", "1")
+				}
+			}
+			if strings.Contains(url, "{") {
+				t.Errorf("%s: path parameter not described", want)
+			}
+			_, got := mux.Handler(httptest.NewRequest(strings.ToUpper(method), url, nil))
+			if got != want {
+				t.Errorf("%s is routed to %q", want, got)
+			}
+			if op.Summary == "" || len(op.Tags) == 0 {
+				t.Errorf("%s has no summary or tag", want)
+			}
+		}
+	}
+}
+
+func TestAPIDocsFitTheCaller(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	rec := &db.MediaRecord{
+		Kind: "image", FileName: "a.jpg", Extension: ".jpg", SourceMount: "/Volumes/Test", SourcePath: "/DCIM/a.jpg",
+		DestPath: "/tmp/usbvault/a.jpg", SizeBytes: 1, CRC32: "00000001", SHA256: strings.Repeat("ab", 32),
+		CaptureTime: "2026-03-01T10:00:00Z", Metadata: "{}", SourceMTime: "2026-03-01T10:00:00Z", IngestedAt: "2026-03-01T10:00:00Z",
+		Make: sql.NullString{String: "Canon", Valid: true},
+	}
+	if err := store.InsertMedia(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	album, err := store.CreateAlbum(ctx, "Trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{store: store, logger: log.New(io.Discard, "", 0)}
+
+	get := func(authCtx *AuthContext, accept string) (*httptest.ResponseRecorder, apiDocs) {
+		req := httptest.NewRequest(http.MethodGet, "http://vault.local:4987/api/docs", nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		app.handleAPIDocs(rr, req, authCtx)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("docs = %d: %s", rr.Code, rr.Body.String())
+		}
+		var docs apiDocs
+		if accept == "application/json" {
+			if err := json.NewDecoder(rr.Body).Decode(&docs); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rr, docs
+	}
+	find := func(docs apiDocs, method, path string) *apiExample {
+		for i, ex := range docs.Examples {
+			if ex.Method == method && ex.Path == path {
+				return &docs.Examples[i]
+			}
+		}
+		return nil
+	}
+
+	token := "uvt_0123456789abcdef"
+	_, docs := get(&AuthContext{Username: "admin", Role: db.RoleAdmin, Token: token}, "application/json")
+	if docs.Scope != "admin" || !strings.Contains(docs.Auth, "uvt_01234567...") || strings.Contains(docs.Auth, token) {
+		t.Fatalf("admin docs = %+v", docs)
+	}
+	dl := find(docs, "GET", "/api/media/{id}/download")
+	if dl == nil || dl.Curl != `curl -s -OJ -H "Authorization: Bearer $USBVAULT_TOKEN" http://vault.local:4987/api/media/`+fmt.Sprint(rec.ID)+`/download` {
+		t.Fatalf("download example = %+v", dl)
+	}
+	edit := find(docs, "POST", "/api/media/edit")
+	if edit == nil || !strings.Contains(edit.Curl, `-X POST`) || !strings.Contains(edit.Curl, `-d '{"ids":[1,2,3],`) {
+		t.Fatalf("edit example = %+v", edit)
+	}
+	if ex := find(docs, "GET", "/api/albums/{id}"); ex == nil || !strings.Contains(ex.Curl, "/api/albums/"+fmt.Sprint(album.ID)) {
+		t.Fatalf("album example = %+v", ex)
+	}
+	if ex := find(docs, "GET", "/api/health"); ex == nil || strings.Contains(ex.Curl, "Authorization") {
+		t.Fatalf("health example = %+v", ex)
+	}
+
+	_, docs = get(&AuthContext{Username: "visitor", Role: db.RoleGuest, ScopeAlbumID: album.ID}, "application/json")
+	if docs.Scope != "guest" || len(docs.Setup) != 1 || !strings.Contains(docs.Setup[0], "/api/login") {
+		t.Fatalf("guest docs = %+v", docs)
+	}
+	for _, ex := range docs.Examples {
+		if !guestAllowedRoute(ex.Method+" "+ex.Path) && ex.Path != "/api/health" && ex.Path != "/api/status" {
+			t.Errorf("guest offered %s %s", ex.Method, ex.Path)
+		}
+	}
+	if ex := find(docs, "GET", "/api/media"); ex == nil || !strings.Contains(ex.Curl, "-b cookies.txt") {
+		t.Fatalf("guest media example = %+v", ex)
+	}
+
+	rr, _ := get(&AuthContext{Username: "admin", Role: db.RoleAdmin}, "text/html")
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") || !strings.Contains(rr.Body.String(), "/api/media/edit") {
+		t.Fatalf("page = %s %s", ct, rr.Body.String())
+	}
+}
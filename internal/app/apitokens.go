@@ -0,0 +1,117 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/security"
+)
+
+// API tokens let scripts call the API without a session cookie. Each user
+// makes their own; a token acts as that user until it is revoked or
+// expires, and only its hash is kept.
+
+const (
+	apiTokenPrefix    = "uvt_"
+	apiTokenShown     = len(apiTokenPrefix) + 8
+	apiTokenNameMax   = 64
+	apiTokenMaxDays   = 3650
+	apiTokenPerUser   = 50
+	apiTokenBodyLimit = 1 << 16
+)
+
+func isAPIToken(token string) bool {
+	return strings.HasPrefix(token, apiTokenPrefix)
+}
+
+func (a *App) handleAPITokensList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	tokens, err := a.store.ListAPITokens(r.Context(), authCtx.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": tokens})
+}
+
+type apiTokenCreateRequest struct {
+	Name string `json:"name"`
+	Days int    `json:"days"` // 0 never expires
+}
+
+// handleAPITokenCreate makes a token for the signed-in user. The token is
+// returned once and cannot be shown again.
+func (a *App) handleAPITokenCreate(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req apiTokenCreateRequest
+	if err := decodeJSONBody(r, &req, apiTokenBodyLimit); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > apiTokenNameMax {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name must be 1-64 characters"})
+		return
+	}
+	if req.Days < 0 || req.Days > apiTokenMaxDays {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "days must be 0 (never expires) or up to 3650"})
+		return
+	}
+	existing, err := a.store.ListAPITokens(r.Context(), authCtx.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if len(existing) >= apiTokenPerUser {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "too many API tokens; revoke one first"})
+		return
+	}
+
+	secret, err := security.NewSessionToken()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create token"})
+		return
+	}
+	token := apiTokenPrefix + secret
+	var expires time.Time
+	if req.Days > 0 {
+		expires = time.Now().UTC().Add(time.Duration(req.Days) * 24 * time.Hour)
+	}
+	created, err := a.store.CreateAPIToken(r.Context(), authCtx.UserID, req.Name, token[:apiTokenShown], security.TokenHash(token), expires)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create token"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "api_token_created", map[string]any{
+		"id":         created.ID,
+		"name":       created.Name,
+		"prefix":     created.Prefix,
+		"expires_at": created.ExpiresAt,
+	})
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"id":         created.ID,
+		"name":       created.Name,
+		"prefix":     created.Prefix,
+		"token":      token,
+		"created_at": created.CreatedAt,
+		"expires_at": created.ExpiresAt,
+	})
+}
+
+func (a *App) handleAPITokenRevoke(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid token id"})
+		return
+	}
+	name, err := a.store.DeleteAPIToken(r.Context(), authCtx.UserID, id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "revoke failed"})
+		return
+	}
+	if name == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "token not found"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "api_token_revoked", map[string]any{"id": id, "name": name})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
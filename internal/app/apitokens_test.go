@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/security"
+)
+
+func TestAPITokenAuthenticatesUntilRevoked(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	hash, salt, err := security.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminID, err := store.CreateUser(ctx, "admin", hash, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	admin := &AuthContext{UserID: adminID, Username: "admin", Role: db.RoleAdmin}
+
+	rr := httptest.NewRecorder()
+	app.handleAPITokenCreate(rr, httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(`{"name":"nightly rsync","days":30}`)), admin)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", rr.Code, rr.Body.String())
+	}
+	var created struct {
+		ID        int64  `json:"id"`
+		Token     string `json:"token"`
+		Prefix    string `json:"prefix"`
+		ExpiresAt string `json:"expires_at"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Token, created.Prefix) || created.ExpiresAt == "" {
+		t.Fatalf("created = %+v", created)
+	}
+
+	whoami := func(token string) *AuthContext {
+		req := httptest.NewRequest(http.MethodGet, "/api/tokens", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		authCtx, ok := app.authFromRequest(req)
+		if !ok {
+			return nil
+		}
+		return authCtx
+	}
+	if got := whoami(created.Token); got == nil || got.UserID != adminID || got.Role != db.RoleAdmin {
+		t.Fatalf("token resolves to %+v", got)
+	}
+	if got := whoami(created.Token + "x"); got != nil {
+		t.Fatal("altered token accepted")
+	}
+
+	list := httptest.NewRecorder()
+	app.handleAPITokensList(list, httptest.NewRequest(http.MethodGet, "/api/tokens", nil), admin)
+	if body := list.Body.String(); !strings.Contains(body, "nightly rsync") || strings.Contains(body, created.Token) || !strings.Contains(body, `"last_used_at":"20`) {
+		t.Fatalf("list = %s", body)
+	}
+
+	other := &AuthContext{UserID: adminID + 1, Username: "other", Role: db.RoleAdmin}
+	revoke := func(authCtx *AuthContext) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/tokens/%d", created.ID), nil)
+		req.SetPathValue("id", fmt.Sprint(created.ID))
+		app.handleAPITokenRevoke(rr, req, authCtx)
+		return rr.Code
+	}
+	if code := revoke(other); code != http.StatusNotFound {
+		t.Fatalf("revoke by another user = %d", code)
+	}
+	if code := revoke(admin); code != http.StatusOK {
+		t.Fatalf("revoke = %d", code)
+	}
+	if got := whoami(created.Token); got != nil {
+		t.Fatal("revoked token still accepted")
+	}
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"businessplan/usbvault/internal/attest"
+	"businessplan/usbvault/internal/db"
+)
+
+// Attestations are signed statements of a file's SHA256, capture time, and
+// ingest time. Each file is hashed again before signing, so the vault never
+// vouches for a hash its copy no longer matches.
+
+// attestationMaxFiles caps an album attestation, like the zip download.
+const attestationMaxFiles = 5000
+
+func (a *App) handleAttestationKey(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", `attachment; filename="usbvault-attestation.pub"`)
+	w.Header().Set("X-USBVault-Key-ID", a.attester.KeyID())
+	_, _ = w.Write(a.attester.PublicKeyPEM())
+}
+
+func (a *App) handleMediaAttestation(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid media id"})
+		return
+	}
+	rec, err := a.store.GetMediaByID(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if rec == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "media not found"})
+		return
+	}
+	a.writeAttestation(w, r, authCtx, "", []db.MediaRecord{*rec}, rec.FileName, map[string]any{"media_id": id})
+}
+
+func (a *App) handleAlbumAttestation(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	albumID, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || albumID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid album id"})
+		return
+	}
+	album, err := a.store.GetAlbumByID(r.Context(), albumID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if album == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "album not found"})
+		return
+	}
+	links, err := a.store.ListAlbumMediaLinks(r.Context(), albumID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if len(links) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "album is empty"})
+		return
+	}
+	if len(links) > attestationMaxFiles {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("album has more than %d files", attestationMaxFiles)})
+		return
+	}
+	ids := make([]int64, len(links))
+	for i, l := range links {
+		ids[i] = l.ID
+	}
+	records, err := a.store.ListMediaByIDs(r.Context(), ids)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	a.writeAttestation(w, r, authCtx, album.Name, records, "album-"+album.Name, map[string]any{"album_id": albumID})
+}
+
+// writeAttestation re-hashes records, signs a statement covering them, and
+// sends the envelope as a download named after baseName.
+func (a *App) writeAttestation(w http.ResponseWriter, r *http.Request, authCtx *AuthContext, album string, records []db.MediaRecord, baseName string, auditDetail map[string]any) {
+	subjects := make([]attest.Subject, 0, len(records))
+	for _, rec := range records {
+		sum, err := a.hashMediaFile(r.Context(), rec.DestPath)
+		if err != nil {
+			a.logger.Printf("attest media %d: %v", rec.ID, err)
+			writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("%s could not be read: %v", rec.FileName, err)})
+			return
+		}
+		if sum != rec.SHA256 {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": rec.FileName + " no longer matches its recorded SHA256"})
+			return
+		}
+		subjects = append(subjects, attest.Subject{
+			MediaID:        rec.ID,
+			FileName:       rec.FileName,
+			SHA256:         rec.SHA256,
+			SizeBytes:      rec.SizeBytes,
+			CaptureTime:    rec.CaptureTime,
+			IngestedAt:     rec.IngestedAt,
+			Make:           rec.Make.String,
+			Model:          rec.Model.String,
+			ClockUncertain: rec.ClockUncertain,
+		})
+	}
+
+	issuer, _ := os.Hostname()
+	env, err := a.attester.Sign(attest.Statement{
+		IssuedAt: time.Now().UTC().Format(time.RFC3339),
+		Issuer:   issuer,
+		Album:    album,
+		Subjects: subjects,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "signing failed"})
+		return
+	}
+	body, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "encode failed"})
+		return
+	}
+
+	auditDetail["files"] = len(subjects)
+	auditDetail["key_id"] = a.attester.KeyID()
+	_ = a.audit.Log(r.Context(), authCtx.Username, "attestation_exported", auditDetail)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", sanitizeDownloadFilename(baseName+".attestation.json")))
+	w.Header().Set("Cache-Control", "private, no-store")
+	_, _ = w.Write(append(body, '\n'))
+}
+
+// hashMediaFile returns the SHA256 of a library file's original bytes.
+func (a *App) hashMediaFile(ctx context.Context, path string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f, err := a.openMediaFile(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"businessplan/usbvault/internal/attest"
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestAlbumAttestationVerifiesAndSigns(t *testing.T) {
+	dir := t.TempDir()
+	store, err := db.Open(filepath.Join(dir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	signer, err := attest.LoadOrCreateKey(filepath.Join(dir, "attestation.key"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey: %v", err)
+	}
+
+	ctx := context.Background()
+	paths := make([]string, 2)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, "library", fmt.Sprintf("GX01000%d.MP4", i))
+		body := []byte(fmt.Sprintf("footage %d", i))
+		if err := os.MkdirAll(filepath.Dir(paths[i]), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(paths[i], body, 0o640); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(body)
+		rec := &db.MediaRecord{
+			Kind:        "video",
+			FileName:    filepath.Base(paths[i]),
+			Extension:   ".mp4",
+			SourceMount: "/Volumes/Test",
+			SourcePath:  "/DCIM/" + filepath.Base(paths[i]),
+			DestPath:    paths[i],
+			SizeBytes:   int64(len(body)),
+			CRC32:       "00000000",
+			SHA256:      hex.EncodeToString(sum[:]),
+			CaptureTime: "2026-03-10T12:00:00Z",
+			Metadata:    "{}",
+			SourceMTime: "2026-03-10T12:00:00Z",
+			IngestedAt:  "2026-03-11T08:00:00Z",
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+	}
+	album, err := store.CreateAlbum(ctx, "Claim 42")
+	if err != nil {
+		t.Fatalf("CreateAlbum: %v", err)
+	}
+	if _, _, err := store.AddMediaToAlbum(ctx, album.ID, mustMediaIDsByDestPath(t, store, paths)); err != nil {
+		t.Fatalf("AddMediaToAlbum: %v", err)
+	}
+
+	app := &App{store: store, audit: audit.New(store), attester: signer, logger: log.New(io.Discard, "", 0)}
+	get := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/albums/1/attestation", nil)
+		req.SetPathValue("id", fmt.Sprint(album.ID))
+		app.handleAlbumAttestation(rr, req, &AuthContext{Username: "admin"})
+		return rr
+	}
+
+	rr := get()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+	var env attest.Envelope
+	if err := json.Unmarshal(rr.Body.Bytes(), &env); err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	st, err := attest.Verify(&env, signer.PublicKey())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if st.Album != "Claim 42" || len(st.Subjects) != 2 || st.Subjects[0].IngestedAt != "2026-03-11T08:00:00Z" {
+		t.Fatalf("statement = %+v", st)
+	}
+
+	if err := os.WriteFile(paths[1], []byte("edited"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if rr := get(); rr.Code != http.StatusConflict {
+		t.Fatalf("status after edit = %d, want 409", rr.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"businessplan/usbvault/internal/autotag"
+)
+
+const autoTagIntervalMinutes = 10
+
+// handleAutoTagGroups is the machine label facet for the current filter.
+func (a *App) handleAutoTagGroups(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	filter, err := mediaFilterFromRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	applyGuestScope(authCtx, &filter)
+	items, err := a.store.ListAutoTagGroups(r.Context(), filter, 200)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (a *App) handleAutoTagStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	if a.autotagger == nil {
+		writeJSON(w, http.StatusOK, autotag.Status{State: "disabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, a.autotagger.GetStatus(r.Context()))
+}
+
+type autoTagRunRequest struct {
+	// Reset reclassifies the whole library, e.g. after swapping the model.
+	Reset bool `json:"reset"`
+}
+
+func (a *App) handleAutoTagRun(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req autoTagRunRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if a.autotagger == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "auto-tagging is not configured"})
+		return
+	}
+	if a.autotagger.GetStatus(r.Context()).State == "running" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": autotag.ErrBusy.Error()})
+		return
+	}
+	var reset int64
+	if req.Reset {
+		n, err := a.store.ResetAutoTags(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to reset auto-tags"})
+			return
+		}
+		reset = n
+	}
+	go func() {
+		if err := a.autotagger.RunOnce(context.Background()); err != nil && !errors.Is(err, autotag.ErrBusy) {
+			a.logger.Printf("auto-tagging failed: %v", err)
+		}
+	}()
+	_ = a.audit.Log(r.Context(), authCtx.Username, "auto_tag_started", map[string]any{"reset": reset})
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
+}
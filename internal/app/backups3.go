@@ -0,0 +1,111 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"businessplan/usbvault/internal/backup"
+	"businessplan/usbvault/internal/s3"
+)
+
+// s3SettingsView is the stored S3 configuration with secrets left out.
+type s3SettingsView struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretSet       bool   `json:"secret_set"`
+	SessionTokenSet bool   `json:"session_token_set"`
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint"`
+	PathStyle       bool   `json:"path_style"`
+	PartSizeMiB     int    `json:"part_size_mib"`
+	Source          string `json:"source"` // settings, environment, or none
+}
+
+func (a *App) handleBackupS3Get(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	raw, _, err := a.store.GetSetting(r.Context(), backup.S3SettingKey)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	var stored s3.Config
+	_ = json.Unmarshal([]byte(raw), &stored)
+	cfg, err := backup.LoadS3Config(r.Context(), a.store)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	partSize := cfg.PartSizeMiB
+	if partSize == 0 {
+		partSize = s3.DefaultPartSize >> 20
+	}
+	source := "none"
+	switch {
+	case stored.AccessKeyID != "":
+		source = "settings"
+	case cfg.AccessKeyID != "":
+		source = "environment"
+	}
+	writeJSON(w, http.StatusOK, s3SettingsView{
+		AccessKeyID:     cfg.AccessKeyID,
+		SecretSet:       cfg.SecretAccessKey != "",
+		SessionTokenSet: cfg.SessionToken != "",
+		Region:          cfg.Region,
+		Endpoint:        cfg.Endpoint,
+		PathStyle:       cfg.PathStyle,
+		PartSizeMiB:     partSize,
+		Source:          source,
+	})
+}
+
+// handleBackupS3Set stores S3 credentials and options. Leaving the secret
+// empty keeps the stored one for the same access key; an empty access key
+// removes the stored settings so the environment is used again.
+func (a *App) handleBackupS3Set(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req s3.Config
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	ctx := r.Context()
+	if strings.TrimSpace(req.AccessKeyID) == "" {
+		if err := a.store.SetSetting(ctx, backup.S3SettingKey, ""); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update s3 settings"})
+			return
+		}
+		_ = a.audit.Log(ctx, authCtx.Username, "backup_s3_updated", map[string]any{"cleared": true})
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+		return
+	}
+	if strings.TrimSpace(req.SecretAccessKey) == "" {
+		raw, _, err := a.store.GetSetting(ctx, backup.S3SettingKey)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+			return
+		}
+		var stored s3.Config
+		if json.Unmarshal([]byte(raw), &stored) == nil && stored.AccessKeyID == strings.TrimSpace(req.AccessKeyID) {
+			req.SecretAccessKey = stored.SecretAccessKey
+			if req.SessionToken == "" {
+				req.SessionToken = stored.SessionToken
+			}
+		}
+	}
+	cfg, err := req.Normalize()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	raw, _ := json.Marshal(cfg)
+	if err := a.store.SetSetting(ctx, backup.S3SettingKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update s3 settings"})
+		return
+	}
+	_ = a.audit.Log(ctx, authCtx.Username, "backup_s3_updated", map[string]any{
+		"access_key_id": cfg.AccessKeyID,
+		"region":        cfg.Region,
+		"endpoint":      cfg.Endpoint,
+		"path_style":    cfg.PathStyle,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"businessplan/usbvault/internal/backup"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/sftp"
+)
+
+// sshSettingsView is the ssh backup setup without the private key.
+type sshSettingsView struct {
+	KeySet            bool             `json:"key_set"`
+	PublicKey         string           `json:"public_key,omitempty"`
+	Fingerprint       string           `json:"fingerprint,omitempty"`
+	AcceptNewHostKeys bool             `json:"accept_new_host_keys"`
+	KnownHosts        []sftp.KnownHost `json:"known_hosts"`
+}
+
+type sshSettingsRequest struct {
+	GenerateKey       bool    `json:"generate_key"`
+	PrivateKey        string  `json:"private_key"`
+	Passphrase        string  `json:"passphrase"`
+	RemoveKey         bool    `json:"remove_key"`
+	AcceptNewHostKeys *bool   `json:"accept_new_host_keys"`
+	KnownHosts        *string `json:"known_hosts"`
+}
+
+func (a *App) sshSettingsView(r *http.Request) (sshSettingsView, error) {
+	settings, err := backup.LoadSSHSettings(r.Context(), a.store)
+	if err != nil {
+		return sshSettingsView{}, err
+	}
+	view := sshSettingsView{AcceptNewHostKeys: settings.AcceptNewHostKeys}
+	view.PublicKey, view.Fingerprint, err = sftp.PublicKey(config.BackupSSHKeyPath())
+	switch {
+	case err == nil:
+		view.KeySet = true
+	case !errors.Is(err, os.ErrNotExist):
+		return view, err
+	}
+	raw, err := os.ReadFile(config.BackupKnownHostsPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return view, err
+	}
+	if view.KnownHosts, err = sftp.ParseKnownHosts(raw); err != nil {
+		return view, err
+	}
+	return view, nil
+}
+
+func (a *App) handleBackupSSHGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	view, err := a.sshSettingsView(r)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+// handleBackupSSHSet manages the key ssh destinations log in with and the
+// host keys they are checked against. Fields left out are not changed.
+func (a *App) handleBackupSSHSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req sshSettingsRequest
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	keyChanges := 0
+	for _, set := range []bool{req.GenerateKey, strings.TrimSpace(req.PrivateKey) != "", req.RemoveKey} {
+		if set {
+			keyChanges++
+		}
+	}
+	if keyChanges > 1 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "use only one of generate_key, private_key, and remove_key"})
+		return
+	}
+	if req.KnownHosts != nil {
+		if _, err := sftp.ParseKnownHosts([]byte(*req.KnownHosts)); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx := r.Context()
+	details := map[string]any{}
+	keyPath := config.BackupSSHKeyPath()
+	var err error
+	switch {
+	case req.GenerateKey:
+		err = sftp.GenerateKey(keyPath)
+		details["key"] = "generated"
+	case strings.TrimSpace(req.PrivateKey) != "":
+		if err = sftp.ImportKey(keyPath, []byte(req.PrivateKey), []byte(req.Passphrase)); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		details["key"] = "imported"
+	case req.RemoveKey:
+		if err = os.Remove(keyPath); errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		details["key"] = "removed"
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update ssh key: " + err.Error()})
+		return
+	}
+
+	if req.AcceptNewHostKeys != nil {
+		raw, _ := json.Marshal(backup.SSHSettings{AcceptNewHostKeys: *req.AcceptNewHostKeys})
+		if err := a.store.SetSetting(ctx, backup.SSHSettingKey, string(raw)); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update ssh settings"})
+			return
+		}
+		details["accept_new_host_keys"] = *req.AcceptNewHostKeys
+	}
+	if req.KnownHosts != nil {
+		path := config.BackupKnownHostsPath()
+		if strings.TrimSpace(*req.KnownHosts) == "" {
+			err = os.Remove(path)
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		} else {
+			body := strings.TrimRight(*req.KnownHosts, "\n") + "\n"
+			if err = os.MkdirAll(config.DataDir(), 0o700); err == nil {
+				err = os.WriteFile(path, []byte(body), 0o600)
+			}
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update known_hosts"})
+			return
+		}
+		details["known_hosts"] = true
+	}
+
+	view, err := a.sshSettingsView(r)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if view.Fingerprint != "" {
+		details["fingerprint"] = view.Fingerprint
+	}
+	_ = a.audit.Log(ctx, authCtx.Username, "backup_ssh_updated", details)
+	writeJSON(w, http.StatusOK, view)
+}
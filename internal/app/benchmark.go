@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/disk"
+	"businessplan/usbvault/internal/usb"
+)
+
+// A storage benchmark writes and reads back a temporary file, so a new
+// drive or card can be checked before footage is trusted to it.
+
+const (
+	benchDefaultMiB = 256
+	benchMinMiB     = 16
+	benchMaxMiB     = 1024
+	benchTimeout    = 15 * time.Minute
+)
+
+type storageBenchmarkRequest struct {
+	MountPath string `json:"mount_path"` // empty for the storage drive
+	SizeMiB   int    `json:"size_mib"`
+}
+
+func (a *App) handleStorageBenchmarksList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	items, err := a.store.ListStorageBenchmarks(r.Context(), parsePositiveInt(r.URL.Query().Get("limit"), 50))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items, "running": a.benchBusy.Load()})
+}
+
+// handleStorageBenchmarkRun starts a benchmark of the storage drive or an
+// attached card; the result shows up in the list. Only one runs at a time,
+// and not on a drive an ingest is using.
+func (a *App) handleStorageBenchmarkRun(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req storageBenchmarkRequest
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if req.SizeMiB == 0 {
+		req.SizeMiB = benchDefaultMiB
+	}
+	if req.SizeMiB < benchMinMiB || req.SizeMiB > benchMaxMiB {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "size_mib must be between 16 and 1024"})
+		return
+	}
+	size := int64(req.SizeMiB) << 20
+
+	ctx := r.Context()
+	st := a.ingestor.GetStatus()
+	ingesting := st.State == "waiting" || st.State == "scanning" || st.State == "ingesting"
+	bench := db.StorageBenchmark{Target: "storage", Bytes: size, RequestedBy: authCtx.Username}
+	var dir string
+	if mountPath := strings.TrimSpace(req.MountPath); mountPath != "" {
+		mount, ok := a.attachedMount(mountPath)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mount_path is not an attached card"})
+			return
+		}
+		if ingesting && config.PathKey(st.Mount) == config.PathKey(mount) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "this card is being ingested"})
+			return
+		}
+		bench.Target, bench.Path, dir = "mount", mount, mount
+	} else {
+		baseStorage, hasStorage, err := a.store.GetSetting(ctx, baseStorageKey)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+			return
+		}
+		if !hasStorage {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "storage is not configured"})
+			return
+		}
+		if ingesting {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "an ingest is writing to storage"})
+			return
+		}
+		bench.Path = filepath.Clean(strings.TrimSpace(baseStorage))
+		dir = config.WorkAreaDir(bench.Path, config.WorkAreaBenchmark)
+	}
+
+	// Leave as much free again as the test file takes, so a benchmark never
+	// fills a drive.
+	if u, err := disk.Stat(bench.Path); err == nil && u.FreeBytes < uint64(2*size) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "not enough free space for the benchmark"})
+		return
+	}
+	if !a.benchBusy.CompareAndSwap(false, true) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "a storage benchmark is already running"})
+		return
+	}
+	go a.runStorageBenchmark(bench, dir)
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "target": bench.Target, "path": bench.Path, "bytes": size})
+}
+
+// runStorageBenchmark runs and records one benchmark; benchBusy must be set.
+func (a *App) runStorageBenchmark(bench db.StorageBenchmark, dir string) {
+	defer a.benchBusy.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), benchTimeout)
+	defer cancel()
+
+	bench.StartedAt = time.Now().UTC().Format(time.RFC3339)
+	if vol, err := usb.VolumeOf(bench.Path); err == nil {
+		bench.FSType = vol.FSType
+	}
+	bench.State = "success"
+	err := os.MkdirAll(dir, 0o755)
+	if err == nil {
+		var res disk.BenchResult
+		res, err = disk.Bench(ctx, dir, bench.Bytes)
+		bench.Bytes = res.Bytes
+		bench.WriteSeconds, bench.ReadSeconds = res.WriteSeconds, res.ReadSeconds
+		bench.WriteMBps, bench.ReadMBps = res.WriteMBps, res.ReadMBps
+	}
+	if err != nil {
+		bench.State, bench.Message = "error", err.Error()
+		a.logger.Printf("storage benchmark %s: %v", bench.Path, err)
+	}
+	if err := a.store.InsertStorageBenchmark(context.WithoutCancel(ctx), &bench); err != nil {
+		a.logger.Printf("record storage benchmark %s: %v", bench.Path, err)
+	}
+	_ = a.audit.Log(context.Background(), bench.RequestedBy, "storage_benchmark", map[string]any{
+		"id":         bench.ID,
+		"target":     bench.Target,
+		"path":       bench.Path,
+		"bytes":      bench.Bytes,
+		"write_mbps": bench.WriteMBps,
+		"read_mbps":  bench.ReadMBps,
+		"state":      bench.State,
+		"message":    bench.Message,
+	})
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	"businessplan/usbvault/internal/manifest"
+)
+
+// checksumManifestMaxBytes bounds an uploaded manifest; a million files
+// take about 150 MB.
+const checksumManifestMaxBytes = 512 << 20
+
+// handleChecksumsExport downloads the library as a sha256sum manifest.
+func (a *App) handleChecksumsExport(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	entries, err := manifest.Library(r.Context(), a.store)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="usbvault-sha256.txt"`)
+	w.Header().Set("Cache-Control", "no-store")
+	if err := manifest.Write(w, entries); err != nil {
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "checksums_exported", map[string]any{
+		"files": len(entries),
+	})
+}
+
+// handleChecksumsCompare compares the library with an uploaded manifest,
+// from another vault or from sha256sum run over an old archive, and lists
+// the contents each side lacks.
+func (a *App) handleChecksumsCompare(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	r.Body = http.MaxBytesReader(w, r.Body, checksumManifestMaxBytes)
+	remote, err := manifest.Parse(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "manifest too large"})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid manifest: " + err.Error()})
+		return
+	}
+	local, err := manifest.Library(r.Context(), a.store)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	diff := manifest.Compare(local, remote)
+	_ = a.audit.Log(r.Context(), authCtx.Username, "checksums_compared", map[string]any{
+		"local_files":  diff.LocalFiles,
+		"remote_files": diff.RemoteFiles,
+		"common":       diff.Common,
+		"only_local":   len(diff.OnlyLocal),
+		"only_remote":  len(diff.OnlyRemote),
+	})
+	writeJSON(w, http.StatusOK, diff)
+}
@@ -0,0 +1,195 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"businessplan/usbvault/internal/cloudsync"
+	"businessplan/usbvault/internal/db"
+)
+
+// cloudSyncInterval is how often the cloud_sync job looks for media that
+// have not reached their provider.
+const cloudSyncInterval = 15 * time.Minute
+
+// cloudSyncRuleStatus is where the media one rule matches stand with its
+// provider.
+type cloudSyncRuleStatus struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	db.CloudSyncCounts
+}
+
+// loadCloudSync returns the stored cloud sync configuration. One saved
+// before the configuration had a schema is read as disabled.
+func (a *App) loadCloudSync(ctx context.Context) (cloudsync.Config, error) {
+	raw, _, err := a.store.GetSetting(ctx, cloudSyncKey)
+	if err != nil {
+		return cloudsync.Config{}, err
+	}
+	cfg, err := cloudsync.Parse(raw)
+	if err != nil {
+		a.logger.Printf("%v; treating cloud sync as disabled", err)
+		cfg, _ = cloudsync.Parse("")
+	}
+	return cfg, nil
+}
+
+func (a *App) handleCloudSyncGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	cfg, err := a.loadCloudSync(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, cfg.Redacted())
+}
+
+// handleCloudSyncSet replaces the configuration. Secrets left out keep the
+// stored ones of the provider with the same name, and files that failed
+// too often are tried again.
+func (a *App) handleCloudSyncSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var cfg cloudsync.Config
+	if err := decodeJSONBody(r, &cfg, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if cfg.Providers == nil {
+		cfg.Providers = []cloudsync.Provider{}
+	}
+	if cfg.Rules == nil {
+		cfg.Rules = []cloudsync.Rule{}
+	}
+	if err := cfg.Normalize(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	ctx := r.Context()
+	for _, rule := range cfg.Rules {
+		for _, id := range rule.Albums {
+			album, err := a.store.GetAlbumByID(ctx, id)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+				return
+			}
+			if album == nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("rule %q: album %d not found", rule.Name, id)})
+				return
+			}
+		}
+	}
+	old, err := a.loadCloudSync(ctx)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	cfg.KeepSecrets(old)
+
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid payload"})
+		return
+	}
+	if err := a.store.SetSetting(ctx, cloudSyncKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update cloud sync settings"})
+		return
+	}
+	if err := a.store.ResetCloudSyncFailures(ctx); err != nil {
+		a.logger.Printf("cloud sync: reset failures: %v", err)
+	}
+	providers := make([]string, 0, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		providers = append(providers, p.Kind+":"+p.Name)
+	}
+	_ = a.audit.Log(ctx, authCtx.Username, "cloud_sync_config_updated", map[string]any{
+		"enabled":   cfg.Enabled,
+		"providers": providers,
+		"rules":     len(cfg.Rules),
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "config": cfg.Redacted()})
+}
+
+// cloudSyncRuleCounts counts, for each rule, where the media it matches
+// stand with its provider.
+func (a *App) cloudSyncRuleCounts(ctx context.Context, cfg cloudsync.Config) ([]cloudSyncRuleStatus, error) {
+	rules := make([]cloudSyncRuleStatus, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		counts, err := a.store.CountCloudSync(ctx, rule.Filters(), rule.Provider, cloudsync.MaxAttempts)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, cloudSyncRuleStatus{Name: rule.Name, Provider: rule.Provider, CloudSyncCounts: counts})
+	}
+	return rules, nil
+}
+
+// handleCloudSyncStatus reports the running or last pass, and for each
+// rule how many of its files reached the provider and how many are left.
+func (a *App) handleCloudSyncStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	ctx := r.Context()
+	cfg, err := a.loadCloudSync(ctx)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	rules, err := a.cloudSyncRuleCounts(ctx, cfg)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"enabled": cfg.Enabled,
+		"run":     a.cloudSync.GetStatus(),
+		"rules":   rules,
+	})
+}
+
+// cloudSyncProviderPreview is what one provider would receive. Media
+// matched by several of its rules are counted once.
+type cloudSyncProviderPreview struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	db.CloudSyncCounts
+}
+
+// handleCloudSyncPreview evaluates the stored rules without uploading
+// anything, whether or not sync is enabled: for each rule and provider,
+// pending and pending_bytes are what the next pass would upload.
+func (a *App) handleCloudSyncPreview(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	ctx := r.Context()
+	cfg, err := a.loadCloudSync(ctx)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	rules, err := a.cloudSyncRuleCounts(ctx, cfg)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	providers := make([]cloudSyncProviderPreview, 0, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		var filters []db.MediaFilter
+		for _, rule := range cfg.Rules {
+			if rule.Provider == p.Name {
+				filters = append(filters, rule.Filters()...)
+			}
+		}
+		counts, err := a.store.CountCloudSync(ctx, filters, p.Name, cloudsync.MaxAttempts)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+			return
+		}
+		providers = append(providers, cloudSyncProviderPreview{Name: p.Name, Kind: p.Kind, CloudSyncCounts: counts})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"enabled":   cfg.Enabled,
+		"rules":     rules,
+		"providers": providers,
+	})
+}
@@ -0,0 +1,343 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/attest"
+	"businessplan/usbvault/internal/collection"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/custody"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/disk"
+	"businessplan/usbvault/internal/i18n"
+	"businessplan/usbvault/internal/manifest"
+)
+
+// A collections drive is everything a court or an insurer asks for on one
+// removable drive: the originals, a signed manifest of their hashes, the
+// audit entries that concern them, and an index page. It is written to a
+// ".partial" folder and renamed when complete, so a folder without the
+// suffix is always a whole package.
+
+const (
+	collectionMaxFiles = attestationMaxFiles
+	// collectionHeadroom is left free on the drive on top of the originals,
+	// for the manifest, report and index.
+	collectionHeadroom = 64 << 20
+)
+
+type collectionRequest struct {
+	MountPath string  `json:"mount_path"`
+	IDs       []int64 `json:"ids"` // when empty, the media matching the query filter
+	Title     string  `json:"title"`
+}
+
+// collectionStatus is the state of the latest export.
+type collectionStatus struct {
+	State      string `json:"state"` // "idle", "running", "done" or "error"
+	Title      string `json:"title,omitempty"`
+	Mount      string `json:"mount,omitempty"`
+	Folder     string `json:"folder,omitempty"`
+	Files      int    `json:"files"`
+	Copied     int    `json:"copied"`
+	Bytes      int64  `json:"bytes"`
+	Error      string `json:"error,omitempty"`
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+}
+
+func (a *App) collectionState() collectionStatus {
+	a.collectionMu.Lock()
+	defer a.collectionMu.Unlock()
+	if a.collection.State == "" {
+		return collectionStatus{State: "idle"}
+	}
+	return a.collection
+}
+
+func (a *App) updateCollection(fn func(st *collectionStatus)) {
+	a.collectionMu.Lock()
+	fn(&a.collection)
+	a.collectionMu.Unlock()
+}
+
+func (a *App) handleCollectionStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	writeJSON(w, http.StatusOK, a.collectionState())
+}
+
+// handleCollectionExport starts writing a collections drive for the media
+// named by ids, or matching the same query filters as GET /api/media, to
+// an attached drive. Progress is read from GET /api/collections/export.
+func (a *App) handleCollectionExport(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req collectionRequest
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	ctx := r.Context()
+	mount, ok := a.attachedMount(strings.TrimSpace(req.MountPath))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mount_path is not an attached drive"})
+		return
+	}
+	if st := a.ingestor.GetStatus(); config.PathKey(st.Mount) == config.PathKey(mount) {
+		switch st.State {
+		case "waiting", "scanning", "ingesting":
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "this drive is being ingested"})
+			return
+		}
+	}
+
+	filter, err := mediaFilterFromRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	var records []db.MediaRecord
+	if ids := normalizeIDs(req.IDs, collectionMaxFiles+1); len(ids) > 0 {
+		records, err = a.store.ListMediaByIDs(ctx, ids)
+	} else {
+		records, err = a.store.ListMediaFiltered(ctx, "capture_time", "asc", collectionMaxFiles+1, 0, filter)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if len(records) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no media to export"})
+		return
+	}
+	if len(records) > collectionMaxFiles {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("more than %d files; narrow the selection", collectionMaxFiles)})
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" && filter.AlbumID > 0 && len(req.IDs) == 0 {
+		if album, err := a.store.GetAlbumByID(ctx, filter.AlbumID); err == nil && album != nil {
+			title = album.Name
+		}
+	}
+	if title == "" {
+		title = i18n.FromContext(ctx).T("Collection")
+	}
+	if len(title) > 200 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "title too long"})
+		return
+	}
+
+	var total int64
+	for _, rec := range records {
+		total += rec.SizeBytes
+	}
+	if u, err := disk.Stat(mount); err == nil && u.FreeBytes < uint64(total+collectionHeadroom) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("the drive needs %d MiB free", (total+collectionHeadroom)>>20)})
+		return
+	}
+
+	a.collectionMu.Lock()
+	if a.collection.State == "running" {
+		a.collectionMu.Unlock()
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "a collection export is already running"})
+		return
+	}
+	a.collection = collectionStatus{
+		State: "running", Title: title, Mount: mount, Files: len(records),
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	st := a.collection
+	a.collectionMu.Unlock()
+
+	go a.runCollectionExport(i18n.WithLocale(context.Background(), i18n.FromContext(ctx)), authCtx.Username, title, mount, records)
+	writeJSON(w, http.StatusAccepted, st)
+}
+
+func (a *App) runCollectionExport(ctx context.Context, actor, title, mount string, records []db.MediaRecord) {
+	folder, bytes, err := a.writeCollection(ctx, actor, title, mount, records)
+	a.updateCollection(func(st *collectionStatus) {
+		st.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+		if err != nil {
+			st.State, st.Error = "error", err.Error()
+			return
+		}
+		st.State, st.Folder = "done", folder
+	})
+	if err != nil {
+		a.logger.Printf("collection export to %s: %v", mount, err)
+		return
+	}
+	ids := make([]int64, len(records))
+	for i, rec := range records {
+		ids[i] = rec.ID
+	}
+	_ = a.audit.Log(ctx, actor, "collection_exported", map[string]any{
+		"title":     truncateForAudit(title, 200),
+		"mount":     mount,
+		"folder":    folder,
+		"files":     len(records),
+		"bytes":     bytes,
+		"media_ids": ids,
+		"key_id":    a.attester.KeyID(),
+	})
+}
+
+// writeCollection writes the package and returns its folder and the bytes
+// of originals copied. Each original is hashed as it is copied and must
+// match its recorded SHA256, so the package never vouches for a changed
+// file.
+func (a *App) writeCollection(ctx context.Context, actor, title, mount string, records []db.MediaRecord) (string, int64, error) {
+	loc := i18n.FromContext(ctx)
+	now := time.Now().UTC()
+	final := filepath.Join(mount, collection.FolderName(title, now.Format("20060102-150405")))
+	work := final + ".partial"
+	if err := os.MkdirAll(filepath.Join(work, collection.OriginalsDir), 0o755); err != nil {
+		return "", 0, err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			_ = os.RemoveAll(work)
+		}
+	}()
+
+	files := make([]collection.File, 0, len(records))
+	subjects := make([]attest.Subject, 0, len(records))
+	used := make(map[string]struct{}, len(records))
+	var copied int64
+	for _, rec := range records {
+		name := uniqueAlbumLinkName(rec.FileName, used)
+		n, err := a.copyOriginal(ctx, rec, filepath.Join(work, collection.OriginalsDir, name))
+		if err != nil {
+			return "", 0, err
+		}
+		copied += n
+		a.updateCollection(func(st *collectionStatus) { st.Copied++; st.Bytes = copied })
+
+		camera := strings.TrimSpace(rec.Make.String + " " + rec.Model.String)
+		files = append(files, collection.File{
+			MediaID: rec.ID, Path: collection.OriginalsDir + "/" + name, FileName: rec.FileName, Kind: rec.Kind,
+			SHA256: rec.SHA256, SizeBytes: rec.SizeBytes, CaptureTime: loc.Timestamp(rec.CaptureTime), IngestedAt: loc.Timestamp(rec.IngestedAt),
+			Camera: camera,
+		})
+		subjects = append(subjects, attest.Subject{
+			MediaID: rec.ID, FileName: rec.FileName, SHA256: rec.SHA256, SizeBytes: rec.SizeBytes,
+			CaptureTime: rec.CaptureTime, IngestedAt: rec.IngestedAt, Make: rec.Make.String, Model: rec.Model.String,
+			ClockUncertain: rec.ClockUncertain,
+		})
+	}
+
+	issuer, _ := os.Hostname()
+	env, err := a.attester.Sign(attest.Statement{IssuedAt: now.Format(time.RFC3339), Issuer: issuer, Album: title, Subjects: subjects})
+	if err != nil {
+		return "", 0, fmt.Errorf("sign manifest: %w", err)
+	}
+	report, err := custody.ForRecords(ctx, a.store, loc.Tf("Chain of custody: %s", title), records, actor)
+	if err != nil {
+		return "", 0, fmt.Errorf("custody report: %w", err)
+	}
+	events := make(map[int64]int, len(report.Items))
+	for _, item := range report.Items {
+		events[item.Media.ID] = len(item.Events)
+	}
+	for i := range files {
+		files[i].Events = events[files[i].MediaID]
+	}
+
+	sumEntries := make([]manifest.Entry, len(files))
+	for i, f := range files {
+		sumEntries[i] = manifest.Entry{SHA256: f.SHA256, Path: f.Path}
+	}
+	var sums, page bytes.Buffer
+	if err := manifest.Write(&sums, sumEntries); err != nil {
+		return "", 0, err
+	}
+	if err := collection.WriteIndex(&page, collection.Index{
+		Title: title, Locale: loc, GeneratedAt: loc.Time(now), GeneratedBy: actor, Issuer: issuer,
+		KeyID: a.attester.KeyID(), ChainIntact: report.Chain.Intact, ChainHead: report.Chain.HeadHash, Files: files,
+	}); err != nil {
+		return "", 0, err
+	}
+	manifestJSON, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return "", 0, err
+	}
+	custodyJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", 0, err
+	}
+	for name, body := range map[string][]byte{
+		collection.ManifestName:  append(manifestJSON, '\n'),
+		collection.PublicKeyName: a.attester.PublicKeyPEM(),
+		collection.CustodyName:   append(custodyJSON, '\n'),
+		collection.ChecksumsName: sums.Bytes(),
+		collection.IndexName:     page.Bytes(),
+	} {
+		if err := writeFileSynced(filepath.Join(work, name), body); err != nil {
+			return "", 0, err
+		}
+	}
+	if err := os.Rename(work, final); err != nil {
+		return "", 0, err
+	}
+	ok = true
+	return final, copied, nil
+}
+
+// copyOriginal copies rec's original bytes to dst and checks them against
+// the recorded hash.
+func (a *App) copyOriginal(ctx context.Context, rec db.MediaRecord, dst string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	src, err := a.openMediaFile(ctx, rec.DestPath)
+	if err != nil {
+		return 0, fmt.Errorf("%s could not be read: %w", rec.FileName, err)
+	}
+	defer src.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), src)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("copy %s: %w", rec.FileName, err)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != rec.SHA256 {
+		return 0, errors.New(rec.FileName + " no longer matches its recorded SHA256")
+	}
+	return n, nil
+}
+
+func writeFileSynced(path string, body []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(body)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
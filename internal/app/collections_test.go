@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/attest"
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/collection"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestWriteCollectionPackagesOriginalsWithSignedManifest(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	signer, err := attest.LoadOrCreateKey(filepath.Join(root, "attest.key"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey: %v", err)
+	}
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0), attester: signer}
+
+	var records []db.MediaRecord
+	// Two files with the same name from different cards.
+	for i, body := range []string{"first frame", "second frame"} {
+		path := filepath.Join(root, "library", fmt.Sprint(i), "IMG_0001.JPG")
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(body))
+		rec := db.MediaRecord{
+			Kind: "image", FileName: "IMG_0001.JPG", Extension: ".jpg", SourceMount: "/media/card",
+			SourcePath: fmt.Sprintf("/media/card/%d/IMG_0001.JPG", i), DestPath: path, SizeBytes: int64(len(body)),
+			SHA256: hex.EncodeToString(sum[:]), CaptureTime: "2026-10-01T12:00:00Z", IngestedAt: "2026-10-01T12:00:00Z",
+		}
+		if err := store.InsertMedia(ctx, &rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		_ = app.audit.Log(ctx, "system", "file_ingested", map[string]any{"media_id": rec.ID, "dest_path": path})
+		records = append(records, rec)
+	}
+
+	drive := filepath.Join(root, "drive")
+	if err := os.MkdirAll(drive, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	folder, copied, err := app.writeCollection(ctx, "admin", "Claim 2291", drive, records)
+	if err != nil {
+		t.Fatalf("writeCollection: %v", err)
+	}
+	if copied != int64(len("first frame")+len("second frame")) || !strings.HasPrefix(filepath.Base(folder), "collection-claim-2291-") {
+		t.Fatalf("folder %s, copied %d", folder, copied)
+	}
+	for _, name := range []string{"originals/IMG_0001.JPG", "originals/IMG_0001 (2).JPG", collection.PublicKeyName, collection.IndexName} {
+		if _, err := os.Stat(filepath.Join(folder, name)); err != nil {
+			t.Fatalf("missing %s: %v", name, err)
+		}
+	}
+	sums, _ := os.ReadFile(filepath.Join(folder, collection.ChecksumsName))
+	if !strings.Contains(string(sums), records[1].SHA256+"  originals/IMG_0001 (2).JPG\n") {
+		t.Fatalf("SHA256SUMS = %s", sums)
+	}
+
+	raw, _ := os.ReadFile(filepath.Join(folder, collection.ManifestName))
+	var env attest.Envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	st, err := attest.Verify(&env, signer.PublicKey())
+	if err != nil || len(st.Subjects) != 2 || st.Album != "Claim 2291" {
+		t.Fatalf("Verify = %+v, %v", st, err)
+	}
+	raw, _ = os.ReadFile(filepath.Join(folder, collection.CustodyName))
+	var report struct {
+		Items []struct {
+			Events []json.RawMessage `json:"events"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(raw, &report); err != nil || len(report.Items) != 2 || len(report.Items[0].Events) != 1 {
+		t.Fatalf("custody = %s, %v", raw, err)
+	}
+
+	// A library file that no longer matches its hash stops the export and
+	// leaves nothing behind.
+	if err := os.WriteFile(records[0].DestPath, []byte("altered"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := app.writeCollection(ctx, "admin", "Second", drive, records); err == nil {
+		t.Fatal("altered original exported")
+	}
+	entries, _ := os.ReadDir(drive)
+	if len(entries) != 1 {
+		t.Fatalf("drive holds %d entries, want only the first package", len(entries))
+	}
+}
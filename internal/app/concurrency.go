@@ -0,0 +1,189 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"businessplan/usbvault/internal/security"
+)
+
+// Shared settings, albums and face names can be edited from the kiosk and
+// a laptop at once. Reads of them carry an ETag naming the version read; a
+// write that sends it back in If-Match is refused with 412 when someone
+// else changed the thing in between, rather than silently replacing their
+// change. Writes without If-Match work as before, so scripts are unaffected.
+
+// versionFunc returns the current version of what a request edits, or ""
+// when it does not exist.
+type versionFunc func(r *http.Request) (string, error)
+
+// withVersion adds ETags and If-Match checks to a handler. Checked writes
+// run one at a time so two of them cannot both pass against the same
+// version.
+func (a *App) withVersion(version versionFunc, next func(http.ResponseWriter, *http.Request, *AuthContext)) func(http.ResponseWriter, *http.Request, *AuthContext) {
+	return func(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			if v, err := version(r); err == nil && v != "" {
+				w.Header().Set("ETag", entityTag(v))
+			}
+			next(w, r, authCtx)
+			return
+		}
+		a.editMu.Lock()
+		defer a.editMu.Unlock()
+		current, err := version(r)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read current version"})
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && current != "" && !etagMatches(match, current) {
+			w.Header().Set("ETag", entityTag(current))
+			writeJSON(w, http.StatusPreconditionFailed, map[string]string{
+				"error": "changed by someone else since you loaded it; reload and try again",
+				"etag":  entityTag(current),
+			})
+			return
+		}
+		next(&versionWriter{ResponseWriter: w, r: r, version: version}, r, authCtx)
+	}
+}
+
+// settingVersion versions a setting by the hash of its stored value.
+func (a *App) settingVersion(key string) versionFunc {
+	return func(r *http.Request) (string, error) {
+		value, _, err := a.store.GetSetting(r.Context(), key)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:8]), nil
+	}
+}
+
+func (a *App) albumVersion(r *http.Request) (string, error) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok {
+		return "", nil
+	}
+	album, err := a.store.GetAlbumByID(r.Context(), id)
+	if err != nil || album == nil {
+		return "", err
+	}
+	return strconv.FormatInt(album.Version, 10), nil
+}
+
+// faceVersion is the person a face is named as, "0" when it has no name.
+func (a *App) faceVersion(r *http.Request) (string, error) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok {
+		return "", nil
+	}
+	personID, found, err := a.store.FacePerson(r.Context(), id)
+	if err != nil || !found {
+		return "", err
+	}
+	return strconv.FormatInt(personID, 10), nil
+}
+
+func entityTag(version string) string {
+	return `"` + version + `"`
+}
+
+// etagMatches reports whether an If-Match header names version. Weak tags
+// are compared by their value.
+func etagMatches(header, version string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == entityTag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionWriter sets the ETag of the new version on a successful write.
+type versionWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	version versionFunc
+	wrote   bool
+}
+
+func (v *versionWriter) WriteHeader(code int) {
+	if !v.wrote && code < 300 {
+		if current, err := v.version(v.r); err == nil && current != "" {
+			v.Header().Set("ETag", entityTag(current))
+		}
+	}
+	v.wrote = true
+	v.ResponseWriter.WriteHeader(code)
+}
+
+func (v *versionWriter) Write(p []byte) (int, error) {
+	if !v.wrote {
+		v.WriteHeader(http.StatusOK)
+	}
+	return v.ResponseWriter.Write(p)
+}
+
+func (v *versionWriter) Unwrap() http.ResponseWriter {
+	return v.ResponseWriter
+}
+
+// presenceWindow is how long a session counts as active after its last
+// heartbeat. The web UI beats every 30 seconds while it is open.
+const presenceWindow = 90 * time.Second
+
+type presence struct {
+	Username string    `json:"username"`
+	Device   string    `json:"device,omitempty"`
+	View     string    `json:"view,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+type heartbeatRequest struct {
+	View string `json:"view"`
+}
+
+// handleSessionHeartbeat records that a session is open and on which view,
+// and returns the other sessions active now, so the UI can say who else is
+// editing before anyone runs into a 412.
+func (a *App) handleSessionHeartbeat(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req heartbeatRequest
+	if err := decodeJSONBody(r, &req, 1<<12); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	view := strings.TrimSpace(req.View)
+	if utf8.RuneCountInString(view) > 64 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "view must be at most 64 characters"})
+		return
+	}
+	now := time.Now().UTC()
+	self := security.TokenHash(authCtx.Token)
+
+	a.presenceMu.Lock()
+	if a.presence == nil {
+		a.presence = map[string]presence{}
+	}
+	a.presence[self] = presence{Username: authCtx.Username, Device: authCtx.Device, View: view, LastSeen: now}
+	others := make([]presence, 0)
+	for key, p := range a.presence {
+		switch {
+		case now.Sub(p.LastSeen) > presenceWindow:
+			delete(a.presence, key)
+		case key != self:
+			others = append(others, p)
+		}
+	}
+	a.presenceMu.Unlock()
+
+	sort.Slice(others, func(i, j int) bool { return others[i].LastSeen.After(others[j].LastSeen) })
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "items": others})
+}
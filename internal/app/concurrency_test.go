@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestStaleWritesAreRefused(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	admin := &AuthContext{UserID: 1, Username: "admin", Role: db.RoleAdmin}
+
+	call := func(h func(http.ResponseWriter, *http.Request, *AuthContext), method, id, ifMatch, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		if id != "" {
+			req.SetPathValue("id", id)
+		}
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		h(rr, req, admin)
+		return rr
+	}
+
+	get := app.withVersion(app.settingVersion(locationPrivacyKey), app.handleLocationPrivacyGet)
+	set := app.withVersion(app.settingVersion(locationPrivacyKey), app.handleLocationPrivacySet)
+	rr := call(get, http.MethodGet, "", "", "")
+	loaded := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || loaded == "" {
+		t.Fatalf("get = %d etag %q", rr.Code, loaded)
+	}
+	rr = call(set, http.MethodPost, "", loaded, `{"strip_gps":"guests"}`)
+	saved := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || saved == "" || saved == loaded {
+		t.Fatalf("first save = %d etag %q, loaded %q", rr.Code, saved, loaded)
+	}
+	// A second editor still holding the version read before the first save.
+	rr = call(set, http.MethodPost, "", loaded, `{"strip_gps":"all"}`)
+	if rr.Code != http.StatusPreconditionFailed || rr.Header().Get("ETag") != saved {
+		t.Fatalf("stale save = %d etag %q, want 412 %q", rr.Code, rr.Header().Get("ETag"), saved)
+	}
+	if p, _ := app.loadLocationPrivacy(context.Background()); p.StripGPS != stripGPSGuests {
+		t.Fatalf("policy = %q after refused save", p.StripGPS)
+	}
+	if rr := call(set, http.MethodPost, "", `W/`+saved+`, "other"`, `{"strip_gps":"all"}`); rr.Code != http.StatusOK {
+		t.Fatalf("save with weak current tag = %d", rr.Code)
+	}
+	if rr := call(set, http.MethodPost, "", "", `{"strip_gps":"off"}`); rr.Code != http.StatusOK {
+		t.Fatalf("unconditional save = %d", rr.Code)
+	}
+
+	album, err := store.CreateAlbum(context.Background(), "Harvest")
+	if err != nil {
+		t.Fatalf("CreateAlbum: %v", err)
+	}
+	id := strconv.FormatInt(album.ID, 10)
+	add := app.withVersion(app.albumVersion, app.handleAlbumAdd)
+	remove := app.withVersion(app.albumVersion, app.handleAlbumRemove)
+	rr = call(add, http.MethodPost, id, `"1"`, `{"ids":[7]}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("add = %d etag %q, want 200 \"2\"", rr.Code, rr.Header().Get("ETag"))
+	}
+	rr = call(remove, http.MethodPost, id, `"1"`, `{"ids":[7]}`)
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale remove = %d, want 412", rr.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body["etag"] != `"2"` {
+		t.Fatalf("412 body = %s", rr.Body.String())
+	}
+	if rr := call(remove, http.MethodPost, "999", `"1"`, `{"ids":[7]}`); rr.Code == http.StatusPreconditionFailed {
+		t.Fatal("missing album answered 412")
+	}
+}
+
+func TestHeartbeatListsOtherSessions(t *testing.T) {
+	app := &App{logger: log.New(io.Discard, "", 0)}
+	beat := func(authCtx *AuthContext, view string) []presence {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		app.handleSessionHeartbeat(rr, httptest.NewRequest(http.MethodPost, "/api/session/heartbeat", strings.NewReader(`{"view":"`+view+`"}`)), authCtx)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("heartbeat = %d %s", rr.Code, rr.Body.String())
+		}
+		var out struct {
+			Items []presence `json:"items"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.Items
+	}
+	kiosk := &AuthContext{Username: "admin", Token: "kiosk-token", Device: "Kiosk"}
+	laptop := &AuthContext{Username: "admin", Token: "laptop-token"}
+
+	if others := beat(kiosk, "albums"); len(others) != 0 {
+		t.Fatalf("first session sees %+v", others)
+	}
+	others := beat(laptop, "all")
+	if len(others) != 1 || others[0].Device != "Kiosk" || others[0].View != "albums" {
+		t.Fatalf("laptop sees %+v", others)
+	}
+	if others := beat(kiosk, "albums"); len(others) != 1 || others[0].Device != "" {
+		t.Fatalf("kiosk sees %+v", others)
+	}
+}
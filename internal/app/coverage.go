@@ -0,0 +1,69 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"businessplan/usbvault/internal/db"
+)
+
+// Survey teams flying or photographing a road network need to know what is
+// still missing, not what they already have. /api/map/coverage-gaps takes
+// the roads geocoding has found media on, and a grid over the map view, and
+// reports the ones with nothing captured in a date range.
+
+const (
+	coverageDefaultCells = 16
+	coverageDefaultLimit = 500
+	coverageMaxLimit     = 5000
+)
+
+func (a *App) handleCoverageGaps(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	q := r.URL.Query()
+	filter, err := mediaFilterFromRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	// from and to are the range coverage is wanted for, not a filter on
+	// what is counted.
+	from, to := filter.CaptureFrom, filter.CaptureTo
+	if from == "" && to == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "from or to is required"})
+		return
+	}
+	bounds, err := parseBBox(q.Get("bbox"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if bounds.South == bounds.North || bounds.West == bounds.East {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bbox must have an area"})
+		return
+	}
+	cells := coverageDefaultCells
+	if raw := q.Get("cells"); raw != "" {
+		if cells, err = strconv.Atoi(raw); err != nil || cells < 1 || cells > db.MaxCoverageCells {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "cells must be 1-64"})
+			return
+		}
+	}
+	limit := min(parsePositiveInt(q.Get("limit"), coverageDefaultLimit), coverageMaxLimit)
+
+	gaps, err := a.store.ListCoverageGaps(r.Context(), bounds, from, to, cells, limit, filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"from":        from,
+		"to":          to,
+		"bbox":        [4]float64{bounds.South, bounds.West, bounds.North, bounds.East},
+		"roads":       gaps.Roads,
+		"roads_seen":  gaps.RoadsSeen,
+		"truncated":   gaps.Truncated,
+		"cell_deg":    gaps.CellDeg,
+		"cells":       gaps.Cells,
+		"cells_total": gaps.CellsTotal,
+	})
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	"businessplan/usbvault/internal/custody"
+)
+
+func (a *App) handleMediaCustody(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid media id"})
+		return
+	}
+	report, err := custody.ForMedia(r.Context(), a.store, id, authCtx.Username)
+	a.writeCustodyReport(w, r, authCtx, report, err, map[string]any{"media_id": id})
+}
+
+func (a *App) handleAlbumCustody(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid album id"})
+		return
+	}
+	report, err := custody.ForAlbum(r.Context(), a.store, id, authCtx.Username)
+	a.writeCustodyReport(w, r, authCtx, report, err, map[string]any{"album_id": id})
+}
+
+func (a *App) writeCustodyReport(w http.ResponseWriter, r *http.Request, authCtx *AuthContext, report *custody.Report, err error, auditDetail map[string]any) {
+	if errors.Is(err, custody.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		a.logger.Printf("custody report: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "report failed"})
+		return
+	}
+	auditDetail["files"] = len(report.Items)
+	auditDetail["chain_intact"] = report.Chain.Intact
+	_ = a.audit.Log(r.Context(), authCtx.Username, "custody_report_generated", auditDetail)
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"businessplan/usbvault/internal/db"
+)
+
+// Query diagnostics explain why a large library got slow: how SQLite runs
+// the main media list and map queries against the current data, which of
+// them scan or sort the whole table, and what maintenance would help.
+
+const (
+	// diagStaleStats is how far the media row count may drift from the
+	// count ANALYZE saw before its statistics are called stale.
+	diagStaleStats = 0.25
+	// diagVacuumShare and diagVacuumBytes are the free space from which
+	// a VACUUM is worth suggesting.
+	diagVacuumShare = 0.2
+	diagVacuumBytes = 64 << 20
+	// diagWALBytes is the write-ahead log size from which a checkpoint is
+	// worth suggesting.
+	diagWALBytes = 64 << 20
+	// diagMinRows is the library size below which statistics and
+	// full scans do not matter.
+	diagMinRows = 10000
+)
+
+// diagnosticShapes are the queries the dashboard runs most, filled in with
+// real values from the library.
+func (a *App) diagnosticShapes(ctx context.Context) ([]db.QueryShape, error) {
+	albumID, state, tag, err := a.store.DiagnosticSamples(ctx)
+	if err != nil {
+		return nil, err
+	}
+	shapes := []db.QueryShape{
+		db.MediaListShape("media_newest", "media grid, newest first", "capture_time", "desc", 120, 0, db.MediaFilter{}),
+		db.MediaListShape("media_deep_page", "media grid, page 100", "capture_time", "desc", 120, 99*120, db.MediaFilter{}),
+		db.MediaListShape("media_by_name", "media grid sorted by file name", "file_name", "asc", 120, 0, db.MediaFilter{}),
+		db.MediaListShape("media_search", "text search, best match first", "relevance", "desc", 120, 0, db.MediaFilter{Query: "img"}),
+		db.MapPointsShape("map_all", "map of the whole library", 10000, db.MediaFilter{}),
+	}
+	if albumID > 0 {
+		shapes = append(shapes, db.MediaListShape("media_album", fmt.Sprintf("album %d, the largest", albumID), "capture_time", "desc", 120, 0, db.MediaFilter{AlbumID: albumID}))
+	}
+	if state != "" {
+		f := db.MediaFilter{State: state}
+		shapes = append(shapes,
+			db.MediaListShape("media_place", "media in "+state+", the most common state", "capture_time", "desc", 120, 0, f),
+			db.MapPointsShape("map_place", "map of "+state, 10000, f))
+	}
+	if tag != "" {
+		shapes = append(shapes, db.MediaListShape("media_tag", "media tagged "+tag+", the most used tag", "capture_time", "desc", 120, 0, db.MediaFilter{Tag: tag}))
+	}
+	return shapes, nil
+}
+
+// requestShapes are the media list and map queries for the filter, sort,
+// and page in r, as GET /api/media takes them, or none when r has none.
+func requestShapes(r *http.Request) ([]db.QueryShape, error) {
+	q := r.URL.Query()
+	if len(q) == 0 {
+		return nil, nil
+	}
+	filter, err := mediaFilterFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	size := parsePositiveInt(q.Get("size"), 120)
+	if size > 500 {
+		size = 500
+	}
+	offset := (parsePositiveInt(q.Get("page"), 1) - 1) * size
+	return []db.QueryShape{
+		db.MediaListShape("request_media", "media list with this request's filter", q.Get("sort"), q.Get("order"), size, offset, filter),
+		db.MapPointsShape("request_map", "map with this request's filter", 10000, filter),
+	}, nil
+}
+
+// maintenanceSuggestions reads the database health and the query plans
+// and says what would speed things up.
+func maintenanceSuggestions(h db.DBHealth, plans []db.QueryPlan) []string {
+	out := make([]string, 0)
+	for _, name := range h.MissingIndexes {
+		out = append(out, fmt.Sprintf("Index %s is missing; restarting the vault recreates it (%s).", name, db.MissingIndexStatement(name)))
+	}
+	if h.MediaRows >= diagMinRows {
+		switch {
+		case !h.Analyzed:
+			out = append(out, "SQLite has no statistics about this library; run ANALYZE (or PRAGMA optimize) while the vault is idle so it can choose indexes from real row counts.")
+		case h.StatsMediaRows > 0 && absRatio(h.MediaRows, h.StatsMediaRows) > diagStaleStats:
+			out = append(out, fmt.Sprintf("The statistics were gathered at %d media rows and there are now %d; run ANALYZE again.", h.StatsMediaRows, h.MediaRows))
+		}
+	}
+	if free := h.FreePages * h.PageSize; free >= diagVacuumBytes && h.PageCount > 0 && float64(h.FreePages)/float64(h.PageCount) >= diagVacuumShare {
+		out = append(out, fmt.Sprintf("%d MB of the database file is free pages; VACUUM would return it, but it needs as much free disk again and blocks the vault while it runs.", free>>20))
+	}
+	if h.WALBytes >= diagWALBytes {
+		out = append(out, fmt.Sprintf("The write-ahead log is %d MB; PRAGMA wal_checkpoint(TRUNCATE) shrinks it, and a long-running reader may be keeping it from being checkpointed.", h.WALBytes>>20))
+	}
+	for _, p := range plans {
+		if p.TempSort && len(p.FullScans) > 0 && h.MediaRows >= diagMinRows {
+			out = append(out, fmt.Sprintf("%s (%s) reads and sorts every media row; sorting by capture time uses an index and stays fast.", p.Name, p.Description))
+		}
+	}
+	return out
+}
+
+func absRatio(now, then int64) float64 {
+	d := float64(now-then) / float64(then)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// handleQueryDiagnostics runs EXPLAIN QUERY PLAN for the main media list
+// and map queries against the current data. Media filter query parameters,
+// as for GET /api/media, add the plan of that request's query.
+func (a *App) handleQueryDiagnostics(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	ctx := r.Context()
+	requested, err := requestShapes(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	shapes, err := a.diagnosticShapes(ctx)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	shapes = append(shapes, requested...)
+	health, err := a.store.DBHealth(ctx)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read database health: " + err.Error()})
+		return
+	}
+	plans := make([]db.QueryPlan, 0, len(shapes))
+	for _, shape := range shapes {
+		plan, err := a.store.ExplainQuery(ctx, shape)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("explain %s: %v", shape.Name, err)})
+			return
+		}
+		plans = append(plans, plan)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"database":    health,
+		"queries":     plans,
+		"suggestions": maintenanceSuggestions(health, plans),
+	})
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"businessplan/usbvault/internal/backup"
+	"businessplan/usbvault/internal/config"
+)
+
+// runRestoreDrill proves the latest backup can be read back. The scheduler
+// runs it every USBVAULT_RESTORE_DRILL_INTERVAL_HOURS.
+func (a *App) runRestoreDrill(ctx context.Context, actor string) {
+	drill, err := a.backuper.RunDrill(ctx, config.RestoreDrillSampleSize())
+	if errors.Is(err, backup.ErrNoBackup) || errors.Is(err, backup.ErrDrillBusy) {
+		return
+	}
+	if err != nil {
+		a.logger.Printf("restore drill failed: %v", err)
+	}
+	if drill == nil {
+		return
+	}
+	_ = a.audit.Log(context.WithoutCancel(ctx), actor, "restore_drill", map[string]any{
+		"id":          drill.ID,
+		"state":       drill.State,
+		"mode":        drill.Mode,
+		"destination": drill.Destination,
+		"sampled":     drill.Sampled,
+		"verified":    drill.Verified,
+		"missing":     drill.Missing,
+		"mismatched":  drill.Mismatched,
+	})
+}
+
+func (a *App) handleRestoreDrillsList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	items, err := a.store.ListRestoreDrills(r.Context(), 50)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// handleRestoreDrillRun starts a drill now; the result shows up in the list.
+func (a *App) handleRestoreDrillRun(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	if err := a.backuper.CanDrill(r.Context()); err != nil {
+		if errors.Is(err, backup.ErrNoBackup) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	go a.runRestoreDrill(context.Background(), authCtx.Username)
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
+}
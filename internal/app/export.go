@@ -0,0 +1,64 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"businessplan/usbvault/internal/db"
+)
+
+// handleExportDB streams rows changed since the given cursor as JSON Lines.
+// The final line is {"type":"cursor","cursor":N}; pass N as since next time.
+func (a *App) handleExportDB(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	since := int64(0)
+	if raw := strings.TrimSpace(r.URL.Query().Get("since")); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since must be a non-negative cursor"})
+			return
+		}
+		since = v
+	}
+	var types []string
+	if raw := strings.TrimSpace(r.URL.Query().Get("types")); raw != "" {
+		known := db.ExportTypes()
+		for _, t := range strings.Split(raw, ",") {
+			t = strings.TrimSpace(t)
+			if !slices.Contains(known, t) {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown type " + strconv.Quote(t) + "; expected " + strings.Join(known, ", ")})
+				return
+			}
+			types = append(types, t)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	bw := bufio.NewWriterSize(w, 64<<10)
+	enc := json.NewEncoder(bw)
+	count := 0
+	cursor, err := a.store.ExportChanges(r.Context(), since, types, func(row db.ExportRow) error {
+		count++
+		return enc.Encode(row)
+	})
+	if err != nil {
+		// Headers are already sent; end with an error line so consumers do not
+		// mistake a truncated stream for a complete one.
+		a.logger.Printf("db export failed: %v", err)
+		_ = enc.Encode(map[string]any{"type": "error", "error": "export failed"})
+		_ = bw.Flush()
+		return
+	}
+	_ = enc.Encode(map[string]any{"type": "cursor", "cursor": cursor, "rows": count})
+	_ = bw.Flush()
+
+	_ = a.audit.Log(r.Context(), authCtx.Username, "db_exported", map[string]any{
+		"since":  since,
+		"cursor": cursor,
+		"rows":   count,
+	})
+}
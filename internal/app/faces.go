@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"unicode/utf8"
+
+	"businessplan/usbvault/internal/faces"
+)
+
+const faceScanIntervalMinutes = 10
+
+func (a *App) handleFaceScanStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	if a.faces == nil {
+		writeJSON(w, http.StatusOK, faces.Status{State: "disabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, a.faces.GetStatus(r.Context()))
+}
+
+// handleFaceScanRun scans new images now instead of waiting for the next tick.
+func (a *App) handleFaceScanRun(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	if a.faces == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "face detection is not configured"})
+		return
+	}
+	if a.faces.GetStatus(r.Context()).State == "running" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": faces.ErrBusy.Error()})
+		return
+	}
+	go func() {
+		if err := a.faces.RunOnce(context.Background()); err != nil && !errors.Is(err, faces.ErrBusy) {
+			a.logger.Printf("face scan failed: %v", err)
+		}
+	}()
+	_ = a.audit.Log(r.Context(), authCtx.Username, "face_scan_started", map[string]any{})
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
+}
+
+func (a *App) handleMediaFaces(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid media id"})
+		return
+	}
+	items, err := a.store.ListFaces(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+type faceNameRequest struct {
+	Name string `json:"name"`
+}
+
+// handleFaceName names the person in a face region; an empty name clears it.
+func (a *App) handleFaceName(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid face id"})
+		return
+	}
+	var req faceNameRequest
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if utf8.RuneCountInString(req.Name) > 100 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name must be at most 100 characters"})
+		return
+	}
+	face, err := a.store.NameFace(r.Context(), id, req.Name)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to name face"})
+		return
+	}
+	if face == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "face not found"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "face_named", map[string]any{
+		"face_id":   face.ID,
+		"media_id":  face.MediaID,
+		"person_id": face.PersonID,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "face": face})
+}
+
+// handlePeople is the people facet for the current media filter.
+func (a *App) handlePeople(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	filter, err := mediaFilterFromRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	applyGuestScope(authCtx, &filter)
+	items, err := a.store.ListPeople(r.Context(), filter, 200)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
@@ -0,0 +1,373 @@
+package app
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/security"
+	"businessplan/usbvault/internal/usb"
+)
+
+// Field mode is for a vault in a vehicle: while an admin has it switched
+// on, a short PIN (or the vault's hardware button) unlocks a session that
+// can only ingest and eject cards and watch status. Browsing, downloads,
+// deletes and settings still need a full sign-in.
+
+const (
+	fieldModeSettingKey = "field_mode"
+	fieldActorPrefix    = "field:"
+
+	fieldDefaultHours          = 12
+	fieldMaxHours              = 24 * 7
+	fieldDefaultSessionMinutes = 30
+	fieldMaxSessionMinutes     = 8 * 60
+	// fieldPINMaxFailures wrong PINs in a row switch field mode off, so a
+	// four-digit PIN cannot be guessed.
+	fieldPINMaxFailures = 5
+	// fieldButtonWindow is how long a button press unlocks without a PIN.
+	fieldButtonWindow = time.Minute
+	fieldEjectTimeout = 30 * time.Second
+)
+
+// fieldRoutes are the only authenticated routes a field session may call.
+var fieldRoutes = map[string]struct{}{
+	"GET /api/ingest-status":  {},
+	"POST /api/ingest/pause":  {},
+	"POST /api/ingest/resume": {},
+	"GET /api/backup-status":  {},
+	"GET /api/kiosk/summary":  {},
+	"GET /api/kiosk/display":  {},
+	"POST /api/rescan":        {},
+	"POST /api/mounts/eject":  {},
+	"GET /api/docs":           {},
+	"GET /api/openapi.json":   {},
+}
+
+func fieldAllowedRoute(pattern string) bool {
+	_, ok := fieldRoutes[pattern]
+	return ok
+}
+
+// fieldModeSettings is the stored field mode. The zero value is off.
+type fieldModeSettings struct {
+	UserID         int64  `json:"user_id"` // the admin field sessions act for
+	EnabledBy      string `json:"enabled_by"`
+	PINHash        string `json:"pin_hash"`
+	PINSalt        string `json:"pin_salt"`
+	ExpiresAt      string `json:"expires_at"`
+	SessionMinutes int    `json:"session_minutes"`
+}
+
+func (f fieldModeSettings) expires() time.Time {
+	t, _ := time.Parse(time.RFC3339, f.ExpiresAt)
+	return t
+}
+
+func (f fieldModeSettings) active(now time.Time) bool {
+	return f.PINHash != "" && now.Before(f.expires())
+}
+
+func (f fieldModeSettings) checkPIN(pin string) bool {
+	hash, err := hex.DecodeString(f.PINHash)
+	if err != nil {
+		return false
+	}
+	salt, err := hex.DecodeString(f.PINSalt)
+	if err != nil {
+		return false
+	}
+	return security.VerifyPassword(pin, hash, salt)
+}
+
+func (a *App) fieldMode(ctx context.Context) (fieldModeSettings, error) {
+	var f fieldModeSettings
+	raw, ok, err := a.store.GetSetting(ctx, fieldModeSettingKey)
+	if err != nil || !ok || strings.TrimSpace(raw) == "" {
+		return f, err
+	}
+	err = json.Unmarshal([]byte(raw), &f)
+	return f, err
+}
+
+// validateFieldPIN accepts 4 to 8 digits.
+func validateFieldPIN(pin string) error {
+	if len(pin) < 4 || len(pin) > 8 {
+		return errors.New("pin must be 4-8 digits")
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return errors.New("pin must be 4-8 digits")
+		}
+	}
+	return nil
+}
+
+type fieldModeRequest struct {
+	PIN            string `json:"pin"`
+	Hours          int    `json:"hours"`
+	SessionMinutes int    `json:"session_minutes"`
+}
+
+func (a *App) handleFieldModeGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	f, err := a.fieldMode(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	if !f.active(time.Now()) {
+		writeJSON(w, http.StatusOK, map[string]any{"enabled": false})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"enabled":         true,
+		"enabled_by":      f.EnabledBy,
+		"expires_at":      f.ExpiresAt,
+		"session_minutes": f.SessionMinutes,
+	})
+}
+
+func (a *App) handleFieldModeEnable(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req fieldModeRequest
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := validateFieldPIN(req.PIN); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if req.Hours == 0 {
+		req.Hours = fieldDefaultHours
+	}
+	if req.Hours < 1 || req.Hours > fieldMaxHours {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "hours must be 1-168"})
+		return
+	}
+	if req.SessionMinutes == 0 {
+		req.SessionMinutes = fieldDefaultSessionMinutes
+	}
+	if req.SessionMinutes < 1 || req.SessionMinutes > fieldMaxSessionMinutes {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "session_minutes must be 1-480"})
+		return
+	}
+
+	hash, salt, err := security.HashPassword(req.PIN)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to hash pin"})
+		return
+	}
+	f := fieldModeSettings{
+		UserID:         authCtx.UserID,
+		EnabledBy:      authCtx.Username,
+		PINHash:        hex.EncodeToString(hash),
+		PINSalt:        hex.EncodeToString(salt),
+		ExpiresAt:      time.Now().UTC().Add(time.Duration(req.Hours) * time.Hour).Format(time.RFC3339),
+		SessionMinutes: req.SessionMinutes,
+	}
+	raw, _ := json.Marshal(f)
+	if err := a.store.SetSetting(r.Context(), fieldModeSettingKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save field mode"})
+		return
+	}
+	a.fieldMu.Lock()
+	a.fieldFailures = 0
+	a.fieldButtonAt = time.Time{}
+	a.fieldMu.Unlock()
+
+	_ = a.audit.Log(r.Context(), authCtx.Username, "field_mode_enabled", map[string]any{
+		"expires_at":      f.ExpiresAt,
+		"session_minutes": f.SessionMinutes,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"enabled": true, "expires_at": f.ExpiresAt, "session_minutes": f.SessionMinutes})
+}
+
+func (a *App) handleFieldModeDisable(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	ended, err := a.disableFieldMode(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to turn off field mode"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "field_mode_disabled", map[string]any{"sessions_ended": ended})
+	writeJSON(w, http.StatusOK, map[string]any{"enabled": false, "sessions_ended": ended})
+}
+
+// disableFieldMode forgets the PIN and ends every field session.
+func (a *App) disableFieldMode(ctx context.Context) (int64, error) {
+	if err := a.store.SetSetting(ctx, fieldModeSettingKey, ""); err != nil {
+		return 0, err
+	}
+	a.fieldMu.Lock()
+	a.fieldButtonAt = time.Time{}
+	a.fieldMu.Unlock()
+	return a.store.DeleteFieldSessions(ctx)
+}
+
+type fieldUnlockRequest struct {
+	PIN string `json:"pin"`
+}
+
+// handleFieldUnlock opens a field session with the PIN, or without one
+// within a minute of a hardware button press. A wrong PIN is audited as a
+// failed login, so the brute-force alert covers it as well.
+func (a *App) handleFieldUnlock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req fieldUnlockRequest
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	f, err := a.fieldMode(ctx)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	now := time.Now()
+	if !f.active(now) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "field mode is off"})
+		return
+	}
+
+	method := "pin"
+	a.fieldMu.Lock()
+	var ok bool
+	if req.PIN == "" {
+		method = "button"
+		ok = !a.fieldButtonAt.IsZero() && now.Sub(a.fieldButtonAt) <= fieldButtonWindow
+		a.fieldButtonAt = time.Time{}
+	} else {
+		ok = f.checkPIN(req.PIN)
+	}
+	failures := 0
+	if ok {
+		a.fieldFailures = 0
+	} else if method == "pin" {
+		a.fieldFailures++
+		failures = a.fieldFailures
+	}
+	a.fieldMu.Unlock()
+
+	if !ok {
+		if method == "button" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "pin required"})
+			return
+		}
+		_ = a.audit.Log(ctx, "anonymous", "login_failed", map[string]any{
+			"username": "field",
+			"ip":       peerIP(r),
+		})
+		if failures >= fieldPINMaxFailures {
+			ended, _ := a.disableFieldMode(ctx)
+			_ = a.audit.Log(ctx, "system", "field_mode_locked", map[string]any{
+				"failures":       failures,
+				"sessions_ended": ended,
+				"ip":             clientIP(r),
+			})
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "too many wrong pins; field mode is off until an admin turns it on again"})
+			return
+		}
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid pin"})
+		return
+	}
+
+	token, err := security.NewSessionToken()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create session"})
+		return
+	}
+	expires := now.UTC().Add(time.Duration(f.SessionMinutes) * time.Minute)
+	if end := f.expires(); end.Before(expires) {
+		expires = end
+	}
+	if err := a.store.CreateFieldSession(ctx, security.TokenHash(token), f.UserID, expires); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create session"})
+		return
+	}
+	a.setSessionCookie(w, token, expires)
+	_ = a.audit.Log(ctx, fieldActorPrefix+f.EnabledBy, "field_unlock", map[string]any{
+		"method": method,
+		"ip":     clientIP(r),
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "expires_at": expires.Format(time.RFC3339)})
+}
+
+// handleFieldButton records a press of the vault's hardware button, sent
+// by a GPIO helper on the same machine. Like display reports it needs no
+// session, so it only accepts loopback peers.
+func (a *App) handleFieldButton(w http.ResponseWriter, r *http.Request) {
+	if !isLoopbackRequest(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "button presses are only accepted from this machine"})
+		return
+	}
+	f, err := a.fieldMode(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	if !f.active(time.Now()) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "field mode is off"})
+		return
+	}
+	a.fieldMu.Lock()
+	a.fieldButtonAt = time.Now()
+	a.fieldMu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "window_seconds": int(fieldButtonWindow / time.Second)})
+}
+
+// attachedMount returns the attached card mount that path names.
+func (a *App) attachedMount(path string) (string, bool) {
+	key := config.PathKey(filepath.Clean(path))
+	for _, mount := range a.watcher.CurrentMounts() {
+		if config.PathKey(mount) == key {
+			return mount, true
+		}
+	}
+	return "", false
+}
+
+type mountEjectRequest struct {
+	MountPath string `json:"mount_path"`
+}
+
+// handleMountEject unmounts an attached card so it can be pulled safely.
+// A card that is being ingested is refused; pause or wait first.
+func (a *App) handleMountEject(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req mountEjectRequest
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	mount, ok := a.attachedMount(strings.TrimSpace(req.MountPath))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mount_path is not an attached card"})
+		return
+	}
+	st := a.ingestor.GetStatus()
+	if config.PathKey(st.Mount) == config.PathKey(mount) {
+		switch st.State {
+		case "waiting", "scanning", "ingesting":
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "this card is being ingested"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), fieldEjectTimeout)
+	defer cancel()
+	if err := usb.Eject(ctx, mount); err != nil {
+		if errors.Is(err, usb.ErrEjectUnsupported) {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "eject failed: " + err.Error()})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "volume_ejected", map[string]any{"mount": mount})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "mount": mount})
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/security"
+)
+
+func TestFieldModeUnlockAndRestrictions(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	hash, salt, err := security.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminID, err := store.CreateUser(ctx, "admin", hash, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+
+	enable := httptest.NewRequest(http.MethodPost, "/api/field-mode", strings.NewReader(`{"pin":"1234","session_minutes":15}`))
+	rr := httptest.NewRecorder()
+	app.handleFieldModeEnable(rr, enable, &AuthContext{UserID: adminID, Username: "admin", Role: db.RoleAdmin})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("enable = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	unlock := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.handleFieldUnlock(rr, httptest.NewRequest(http.MethodPost, "/api/field-mode/unlock", strings.NewReader(body)))
+		return rr
+	}
+	if rr := unlock(`{"pin":""}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("unlock without pin or button press = %d", rr.Code)
+	}
+	if rr := unlock(`{"pin":"0000"}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong pin = %d", rr.Code)
+	}
+	rr = unlock(`{"pin":"1234"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unlock = %d: %s", rr.Code, rr.Body.String())
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("cookies = %v", cookies)
+	}
+
+	call := func(pattern string) (int, *AuthContext) {
+		var got *AuthContext
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Pattern = pattern
+		req.AddCookie(cookies[0])
+		rr := httptest.NewRecorder()
+		app.withAuth(func(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+			got = authCtx
+			w.WriteHeader(http.StatusNoContent)
+		})(rr, req)
+		return rr.Code, got
+	}
+	if code, authCtx := call("GET /api/ingest-status"); code != http.StatusNoContent || !authCtx.Field || authCtx.Username != "field:admin" {
+		t.Fatalf("ingest status from field session = %d, %+v", code, authCtx)
+	}
+	for _, pattern := range []string{"GET /api/media", "POST /api/media/delete", "POST /api/field-mode", "GET /api/audit"} {
+		if code, _ := call(pattern); code != http.StatusForbidden {
+			t.Fatalf("%s from field session = %d, want 403", pattern, code)
+		}
+	}
+
+	for i := 0; i < fieldPINMaxFailures-1; i++ {
+		unlock(`{"pin":"9999"}`)
+	}
+	if rr := unlock(`{"pin":"9999"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("pin after lockout threshold = %d, want 403", rr.Code)
+	}
+	if code, _ := call("GET /api/ingest-status"); code != http.StatusUnauthorized {
+		t.Fatalf("field session survived the lockout: %d", code)
+	}
+	if rr := unlock(`{"pin":"1234"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("right pin after lockout = %d, want 403", rr.Code)
+	}
+}
@@ -0,0 +1,246 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/gpx"
+)
+
+const (
+	// gpxMaxBytes bounds an uploaded track; a day of one-second fixes is
+	// around 15 MB of GPX.
+	gpxMaxBytes = 64 << 20
+	// gpxDefaultMaxGap is the longest gap between two fixes a position is
+	// interpolated across.
+	gpxDefaultMaxGap            = 5 * time.Minute
+	gpxMaxOffset                = 48 * time.Hour
+	gpxCorrelateIntervalMinutes = 15
+)
+
+var errGPXBusy = errors.New("gpx correlation is already running")
+
+// handleGPXImport stores an uploaded GPX track, sent as the request body,
+// and positions the media taken along it. Query parameters: name, which
+// defaults to the track's own; offset_sec, added to capture times to
+// correct a camera clock that was off; and max_gap_sec, the longest gap
+// between fixes to interpolate across.
+func (a *App) handleGPXImport(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	q := r.URL.Query()
+	offset, err := parseGPXSeconds(q.Get("offset_sec"), 0, -gpxMaxOffset, gpxMaxOffset)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "offset_sec " + err.Error()})
+		return
+	}
+	maxGap, err := parseGPXSeconds(q.Get("max_gap_sec"), gpxDefaultMaxGap, time.Second, 24*time.Hour)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "max_gap_sec " + err.Error()})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, gpxMaxBytes)
+	track, err := gpx.Parse(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "gpx file too large"})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(q.Get("name"))
+	if name == "" {
+		name = track.Name
+	}
+	if name == "" {
+		name = track.Start().Format("2006-01-02 15:04")
+	}
+	if len([]rune(name)) > 200 {
+		name = string([]rune(name)[:200])
+	}
+
+	rec := &db.GPXTrack{
+		Name:       name,
+		StartTime:  track.Start().Format(time.RFC3339),
+		EndTime:    track.End().Format(time.RFC3339),
+		OffsetSec:  int64(offset / time.Second),
+		MaxGapSec:  int64(maxGap / time.Second),
+		ImportedBy: authCtx.Username,
+		ImportedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	points := make([]db.GPXPoint, len(track.Points))
+	for i, p := range track.Points {
+		points[i] = db.GPXPoint{TimeMS: p.Time.UnixMilli(), Lat: p.Lat, Lon: p.Lon}
+		if p.HasEle {
+			points[i].Ele.Float64, points[i].Ele.Valid = p.Ele, true
+		}
+	}
+	if err := a.store.CreateGPXTrack(r.Context(), rec, points); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save track"})
+		return
+	}
+
+	// A busy correlation is left to the next scheduled run.
+	matched, err := a.correlateGPX(r.Context())
+	if err != nil && !errors.Is(err, errGPXBusy) {
+		a.logger.Printf("gpx correlate: %v", err)
+	}
+	rec.Matched = int64(matched)
+	_ = a.audit.Log(r.Context(), authCtx.Username, "gpx_imported", map[string]any{
+		"track_id":   rec.ID,
+		"name":       rec.Name,
+		"points":     rec.PointCount,
+		"start_time": rec.StartTime,
+		"end_time":   rec.EndTime,
+		"offset_sec": rec.OffsetSec,
+		"matched":    matched,
+	})
+	writeJSON(w, http.StatusCreated, map[string]any{"track": rec, "matched": matched})
+}
+
+func parseGPXSeconds(raw string, def, lo, hi time.Duration) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, errors.New("must be a whole number of seconds")
+	}
+	d := time.Duration(n) * time.Second
+	if d < lo || d > hi {
+		return 0, errors.New("is out of range")
+	}
+	return d, nil
+}
+
+func (a *App) handleGPXTracks(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	items, err := a.store.ListGPXTracks(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// handleGPXTrackDelete removes a track and the positions it gave.
+func (a *App) handleGPXTrackDelete(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid track id"})
+		return
+	}
+	found, cleared, err := a.store.DeleteGPXTrack(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete track"})
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "track not found"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "gpx_deleted", map[string]any{
+		"track_id": id,
+		"cleared":  cleared,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": true, "cleared": cleared})
+}
+
+// handleGPXCorrelate matches the library against every track now, rather
+// than at the next scheduled run.
+func (a *App) handleGPXCorrelate(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	matched, err := a.correlateGPX(r.Context())
+	if errors.Is(err, errGPXBusy) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "correlation failed"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "gpx_correlated", map[string]any{"matched": matched})
+	writeJSON(w, http.StatusOK, map[string]any{"matched": matched})
+}
+
+// scheduledGPXCorrelate positions media ingested since the tracks were
+// imported.
+func (a *App) scheduledGPXCorrelate(ctx context.Context) error {
+	matched, err := a.correlateGPX(ctx)
+	if errors.Is(err, errGPXBusy) {
+		return nil
+	}
+	if err == nil && matched > 0 {
+		_ = a.audit.Log(ctx, "system", "gpx_correlated", map[string]any{"matched": matched})
+	}
+	return err
+}
+
+// correlateGPX gives every media item without a position the one its
+// capture time has on a track, trying the most recently recorded tracks
+// first. It returns how many items were positioned.
+func (a *App) correlateGPX(ctx context.Context) (int, error) {
+	if !a.gpxMu.TryLock() {
+		return 0, errGPXBusy
+	}
+	defer a.gpxMu.Unlock()
+
+	tracks, err := a.store.ListGPXTracks(ctx)
+	if err != nil || len(tracks) == 0 {
+		return 0, err
+	}
+	todo, err := a.store.ListUnlocatedMedia(ctx)
+	if err != nil || len(todo) == 0 {
+		return 0, err
+	}
+	captures := make([]time.Time, len(todo))
+	for i, m := range todo {
+		captures[i], _ = time.Parse(time.RFC3339, m.CaptureTime)
+	}
+
+	matched := 0
+	placed := make(map[int64]bool)
+	for _, t := range tracks {
+		if ctx.Err() != nil {
+			return matched, ctx.Err()
+		}
+		points, err := a.store.ListGPXPoints(ctx, t.ID)
+		if err != nil {
+			return matched, err
+		}
+		if len(points) == 0 {
+			continue
+		}
+		track := &gpx.Track{Points: make([]gpx.Point, len(points))}
+		for i, p := range points {
+			track.Points[i] = gpx.Point{Time: time.UnixMilli(p.TimeMS).UTC(), Lat: p.Lat, Lon: p.Lon}
+		}
+		offset := time.Duration(t.OffsetSec) * time.Second
+		maxGap := time.Duration(t.MaxGapSec) * time.Second
+		var found []db.GPXMatch
+		for i, m := range todo {
+			if placed[m.ID] || captures[i].IsZero() {
+				continue
+			}
+			if lat, lon, ok := track.Locate(captures[i].Add(offset), maxGap); ok {
+				found = append(found, db.GPXMatch{MediaID: m.ID, Lat: lat, Lon: lon})
+				placed[m.ID] = true
+			}
+		}
+		if len(found) == 0 {
+			continue
+		}
+		n, err := a.store.ApplyGPXMatches(ctx, t.ID, found)
+		if err != nil {
+			return matched, err
+		}
+		matched += n
+	}
+	return matched, nil
+}
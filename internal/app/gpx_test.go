@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestGPXImportPositionsMediaOnTheTrack(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	admin := &AuthContext{UserID: 1, Username: "admin", Role: db.RoleAdmin}
+
+	insert := func(n int, capture string, gps bool) int64 {
+		t.Helper()
+		rec := &db.MediaRecord{
+			Kind: "video", FileName: fmt.Sprintf("GX%02d.MP4", n), Extension: ".mp4",
+			SourceMount: "/Volumes/GOPRO", SourcePath: fmt.Sprintf("/DCIM/GX%02d.MP4", n),
+			DestPath: fmt.Sprintf("/lib/GX%02d.MP4", n), SizeBytes: 1, CRC32: "00000000",
+			SHA256: fmt.Sprintf("%064x", n), CaptureTime: capture, Metadata: "{}",
+			SourceMTime: capture, IngestedAt: capture,
+		}
+		if gps {
+			rec.GPSLat = sql.NullFloat64{Float64: 1, Valid: true}
+			rec.GPSLon = sql.NullFloat64{Float64: 2, Valid: true}
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+		return rec.ID
+	}
+	// The camera clock ran an hour behind, in a +02:00 zone.
+	onTrack := insert(1, "2026-06-01T11:00:30+02:00", false)
+	located := insert(2, "2026-06-01T11:00:30+02:00", true)
+	offTrack := insert(3, "2026-06-01T13:00:00+02:00", false)
+
+	const track = `<gpx><trk><name>Ride</name><trkseg>
+		<trkpt lat="45.0" lon="-122.0"><time>2026-06-01T10:00:00Z</time></trkpt>
+		<trkpt lat="45.1" lon="-122.2"><time>2026-06-01T10:01:00Z</time></trkpt>
+	</trkseg></trk></gpx>`
+	call := func(h func(http.ResponseWriter, *http.Request, *AuthContext), method, target, id, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if id != "" {
+			req.SetPathValue("id", id)
+		}
+		rr := httptest.NewRecorder()
+		h(rr, req, admin)
+		return rr
+	}
+
+	if rr := call(app.handleGPXImport, http.MethodPost, "/api/gpx/import", "", "<gpx/>"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("empty track = %d, want 400", rr.Code)
+	}
+	if rr := call(app.handleGPXImport, http.MethodPost, "/api/gpx/import?offset_sec=x", "", track); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad offset = %d, want 400", rr.Code)
+	}
+	rr := call(app.handleGPXImport, http.MethodPost, "/api/gpx/import?offset_sec=3600", "", track)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("import = %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Track   db.GPXTrack `json:"track"`
+		Matched int         `json:"matched"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Matched != 1 || resp.Track.Name != "Ride" || resp.Track.PointCount != 2 {
+		t.Fatalf("import = %+v", resp)
+	}
+
+	rec, err := store.GetMediaByID(ctx, onTrack)
+	if err != nil || !rec.GPSLat.Valid || rec.GPSLat.Float64 != 45.05 || rec.GPSLon.Float64 != -122.1 {
+		t.Fatalf("on-track item = %v, %v (%v)", rec.GPSLat, rec.GPSLon, err)
+	}
+	if rec, _ := store.GetMediaByID(ctx, located); rec.GPSLat.Float64 != 1 {
+		t.Fatalf("item with GPS moved to %v", rec.GPSLat)
+	}
+	if rec, _ := store.GetMediaByID(ctx, offTrack); rec.GPSLat.Valid {
+		t.Fatalf("off-track item positioned at %v", rec.GPSLat)
+	}
+	// The positioned item waits for the geocode backfill.
+	todos, err := store.ListGeoTodos(ctx, 10)
+	if err != nil || len(todos) != 2 {
+		t.Fatalf("geocode todos = %+v, %v", todos, err)
+	}
+
+	// Running again finds nothing new.
+	if rr := call(app.handleGPXCorrelate, http.MethodPost, "/api/gpx/correlate", "", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"matched":0`) {
+		t.Fatalf("correlate = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	id := fmt.Sprint(resp.Track.ID)
+	if rr := call(app.handleGPXTrackDelete, http.MethodDelete, "/api/gpx/tracks/"+id, id, ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"cleared":1`) {
+		t.Fatalf("delete = %d: %s", rr.Code, rr.Body.String())
+	}
+	if rec, _ := store.GetMediaByID(ctx, onTrack); rec.GPSLat.Valid {
+		t.Fatalf("position kept after the track was deleted: %v", rec.GPSLat)
+	}
+	if rec, _ := store.GetMediaByID(ctx, located); !rec.GPSLat.Valid {
+		t.Fatal("deleting the track cleared a position it did not give")
+	}
+	if rr := call(app.handleGPXTrackDelete, http.MethodDelete, "/api/gpx/tracks/"+id, id, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("second delete = %d, want 404", rr.Code)
+	}
+}
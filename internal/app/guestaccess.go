@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/security"
+)
+
+// Every request a guest makes is logged, so an admin can see who opened a
+// shared album, from where, and which files they were served.
+
+const (
+	guestAccessRetention = 90 * 24 * time.Hour
+
+	// A guest login used from this many addresses within the window is
+	// taken to have been passed on.
+	guestSuspiciousAddresses = 4
+	guestSuspiciousWindow    = time.Hour
+
+	guestUserAgentMax = 256
+)
+
+// recordGuestAccess logs one guest request and checks the guest's recent
+// use for signs the login was passed on.
+func (a *App) recordGuestAccess(r *http.Request, authCtx *AuthContext) {
+	ctx := context.WithoutCancel(r.Context())
+	e := db.GuestAccess{
+		GuestID:   authCtx.UserID,
+		Username:  authCtx.Username,
+		Session:   security.TokenHash(authCtx.Token),
+		IP:        clientIP(r),
+		UserAgent: truncateForAudit(r.UserAgent(), guestUserAgentMax),
+		Route:     r.Pattern,
+	}
+	if strings.Contains(r.Pattern, "{id}") {
+		if id, ok := parsePathInt64(r.PathValue("id")); ok {
+			e.MediaID = id
+		}
+	}
+	if err := a.store.RecordGuestAccess(ctx, e); err != nil {
+		a.logger.Printf("guest access log %s: %v", authCtx.Username, err)
+		return
+	}
+
+	recent, err := a.store.SummarizeGuestAccess(ctx, authCtx.UserID, time.Now().Add(-guestSuspiciousWindow))
+	if err != nil || recent.Addresses < guestSuspiciousAddresses {
+		return
+	}
+	a.flagGuest(ctx, authCtx, recent)
+}
+
+// flagGuest audits suspicious guest use once per window, which raises a
+// security alert, and revokes the guest when it was created to allow that.
+func (a *App) flagGuest(ctx context.Context, authCtx *AuthContext, recent db.GuestAccessSummary) {
+	now := time.Now()
+	a.guestFlagMu.Lock()
+	if at, ok := a.guestFlagged[authCtx.UserID]; ok && now.Sub(at) < guestSuspiciousWindow {
+		a.guestFlagMu.Unlock()
+		return
+	}
+	if a.guestFlagged == nil {
+		a.guestFlagged = map[int64]time.Time{}
+	}
+	a.guestFlagged[authCtx.UserID] = now
+	a.guestFlagMu.Unlock()
+
+	revoke, err := a.store.GuestAutoRevoke(ctx, authCtx.UserID)
+	if err != nil {
+		a.logger.Printf("guest auto-revoke lookup %s: %v", authCtx.Username, err)
+	}
+	_ = a.audit.Log(ctx, "system", "guest_access_suspicious", map[string]any{
+		"guest_id":  authCtx.UserID,
+		"username":  authCtx.Username,
+		"addresses": recent.Addresses,
+		"sessions":  recent.Sessions,
+		"window":    guestSuspiciousWindow.String(),
+		"revoked":   revoke,
+	})
+	if !revoke {
+		return
+	}
+	if deleted, err := a.store.DeleteGuestUser(ctx, authCtx.UserID); err != nil {
+		a.logger.Printf("guest auto-revoke %s: %v", authCtx.Username, err)
+	} else if deleted {
+		_ = a.audit.Log(ctx, "system", "guest_revoked", map[string]any{
+			"guest_id": authCtx.UserID,
+			"reason":   "suspicious_access",
+		})
+	}
+}
+
+// handleGuestActivity returns a guest's access counters, recent requests and
+// the audit entries by or about the guest. It keeps working after the guest
+// is revoked or expires, until the log entries age out.
+func (a *App) handleGuestActivity(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid guest id"})
+		return
+	}
+	ctx := r.Context()
+	username, err := a.store.GuestUsername(ctx, id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if username == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "guest not found"})
+		return
+	}
+	limit := min(parsePositiveInt(r.URL.Query().Get("limit"), 100), 1000)
+
+	total, err := a.store.SummarizeGuestAccess(ctx, id, time.Time{})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	recent, err := a.store.SummarizeGuestAccess(ctx, id, time.Now().Add(-guestSuspiciousWindow))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	accesses, err := a.store.ListGuestAccess(ctx, id, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	trail, err := a.store.ListAuditForGuest(ctx, username, id, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	revoke, err := a.store.GuestAutoRevoke(ctx, id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	active, err := a.guestExists(ctx, id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"guest_id":    id,
+		"username":    username,
+		"active":      active,
+		"auto_revoke": revoke,
+		"totals":      total,
+		"last_hour":   recent,
+		"suspicious":  recent.Addresses >= guestSuspiciousAddresses,
+		"accesses":    accesses,
+		"audit":       trail,
+	})
+}
+
+func (a *App) guestExists(ctx context.Context, id int64) (bool, error) {
+	guests, err := a.store.ListGuestUsers(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, g := range guests {
+		if g.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/security"
+)
+
+func TestGuestAccessLoggedAndRevokedWhenShared(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+
+	guestID, err := store.CreateGuestUser(ctx, "client", []byte("h"), []byte("s"), time.Now().Add(time.Hour), 0, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetGuestAutoRevoke(ctx, guestID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateSession(ctx, security.TokenHash("guest-token"), guestID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/media/{id}/content", app.withAuth(func(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	fetch := func(ip string, mediaID int) int {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/media/%d/content", mediaID), nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "guest-token"})
+		req.Header.Set("X-Forwarded-For", ip)
+		req.Header.Set("User-Agent", "test-agent")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for i := range guestSuspiciousAddresses - 1 {
+		if code := fetch(fmt.Sprintf("192.0.2.%d", i+1), i+1); code != http.StatusNoContent {
+			t.Fatalf("request %d = %d", i, code)
+		}
+	}
+	// The same addresses again are not suspicious.
+	if code := fetch("192.0.2.1", 7); code != http.StatusNoContent {
+		t.Fatalf("repeat request = %d", code)
+	}
+	if code := fetch("198.51.100.9", 8); code != http.StatusNoContent {
+		t.Fatalf("request from a new address = %d", code)
+	}
+	if code := fetch("192.0.2.1", 9); code != http.StatusUnauthorized {
+		t.Fatalf("request after auto-revoke = %d, want 401", code)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/guests/%d/activity", guestID), nil)
+	req.SetPathValue("id", fmt.Sprint(guestID))
+	app.handleGuestActivity(rr, req, &AuthContext{Username: "admin", Role: db.RoleAdmin})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("activity = %d: %s", rr.Code, rr.Body.String())
+	}
+	var got struct {
+		Active     bool                  `json:"active"`
+		Suspicious bool                  `json:"suspicious"`
+		Totals     db.GuestAccessSummary `json:"totals"`
+		Accesses   []db.GuestAccess      `json:"accesses"`
+		Audit      []db.AuditRecord      `json:"audit"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Active || !got.Suspicious {
+		t.Fatalf("active = %v, suspicious = %v; want a revoked, suspicious guest", got.Active, got.Suspicious)
+	}
+	if got.Totals.Requests != 5 || got.Totals.DistinctMedia != 5 || got.Totals.Addresses != 4 || got.Totals.Sessions != 1 {
+		t.Fatalf("totals = %+v", got.Totals)
+	}
+	if len(got.Accesses) != 5 || got.Accesses[0].MediaID != 8 || got.Accesses[0].UserAgent != "test-agent" {
+		t.Fatalf("accesses = %+v", got.Accesses)
+	}
+	actions := map[string]bool{}
+	for _, rec := range got.Audit {
+		actions[rec.Action] = true
+	}
+	if !actions["guest_access_suspicious"] || !actions["guest_revoked"] {
+		t.Fatalf("audit actions = %v", actions)
+	}
+}
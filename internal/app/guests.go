@@ -0,0 +1,216 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/security"
+	"businessplan/usbvault/internal/watermark"
+)
+
+const (
+	guestMaxHours     = 24 * 14
+	guestDefaultHours = 24
+)
+
+// guestRoutes are the only authenticated routes a guest session may call.
+// Everything else (writes, downloads, settings, audit) is admin-only.
+var guestRoutes = map[string]struct{}{
+	"GET /api/media":              {},
+	"GET /api/media/{id}/content": {},
+	"GET /api/map":                {},
+	"GET /api/map/clusters":       {},
+	"GET /api/albums":             {},
+	"GET /api/albums/{id}":        {},
+	"GET /api/device-groups":      {},
+	"GET /api/location-groups":    {},
+	"GET /api/auto-tags":          {},
+	"GET /api/docs":               {},
+	"GET /api/openapi.json":       {},
+}
+
+func guestAllowedRoute(pattern string) bool {
+	_, ok := guestRoutes[pattern]
+	return ok
+}
+
+// applyGuestScope pins a guest's media filter to their album so query
+// parameters cannot widen what they see.
+func applyGuestScope(authCtx *AuthContext, filter *db.MediaFilter) {
+	if !authCtx.IsGuest() || authCtx.ScopeAlbumID <= 0 {
+		return
+	}
+	filter.AlbumID = authCtx.ScopeAlbumID
+}
+
+type guestCreateRequest struct {
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	ExpiresInHours int    `json:"expires_in_hours"`
+	AlbumID        int64  `json:"album_id"`
+
+	// Watermark, when set, is stamped on every image the guest views, and
+	// files that cannot be stamped are withheld.
+	Watermark *watermark.Spec `json:"watermark"`
+
+	// AutoRevoke deletes the guest as soon as its login is seen from too
+	// many addresses, instead of only raising an alert.
+	AutoRevoke bool `json:"auto_revoke"`
+
+	// StripGPS removes the position from every file the guest views and
+	// hides positions and street addresses from their listings.
+	StripGPS bool `json:"strip_gps"`
+}
+
+func (a *App) handleGuestsList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	guests, err := a.store.ListGuestUsers(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": guests})
+}
+
+func (a *App) handleGuestsCreate(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req guestCreateRequest
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if !security.ValidateUsername(req.Username) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "username must be 3-64 chars [a-zA-Z0-9._-]"})
+		return
+	}
+	if err := security.ValidatePassword(req.Password); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	hours := req.ExpiresInHours
+	if hours <= 0 {
+		hours = guestDefaultHours
+	}
+	if hours > guestMaxHours {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expires_in_hours must be at most 336"})
+		return
+	}
+	if req.AlbumID < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid album_id"})
+		return
+	}
+	if req.AlbumID > 0 {
+		album, err := a.store.GetAlbumByID(r.Context(), req.AlbumID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "album lookup failed"})
+			return
+		}
+		if album == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "album not found"})
+			return
+		}
+	}
+
+	var watermarkJSON string
+	if req.Watermark != nil {
+		// Load rather than Normalize so a missing overlay is caught now.
+		if _, err := watermark.Load(*req.Watermark, config.WatermarksDir()); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		spec, _ := req.Watermark.Normalize()
+		req.Watermark = &spec
+		raw, _ := json.Marshal(spec)
+		watermarkJSON = string(raw)
+	}
+
+	existing, err := a.store.GetUserByUsername(r.Context(), req.Username)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	if existing != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "username already exists"})
+		return
+	}
+
+	hash, salt, err := security.HashPassword(req.Password)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to hash password"})
+		return
+	}
+	expiresAt := time.Now().UTC().Add(time.Duration(hours) * time.Hour).Truncate(time.Second)
+	id, err := a.store.CreateGuestUser(r.Context(), req.Username, hash, salt, expiresAt, req.AlbumID, authCtx.Username)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create guest"})
+		return
+	}
+	if watermarkJSON != "" {
+		if err := a.store.SetGuestWatermark(r.Context(), id, watermarkJSON); err != nil {
+			// Without its watermark the guest would see clean originals.
+			_, _ = a.store.DeleteGuestUser(r.Context(), id)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create guest"})
+			return
+		}
+	}
+
+	if req.AutoRevoke {
+		if err := a.store.SetGuestAutoRevoke(r.Context(), id, true); err != nil {
+			_, _ = a.store.DeleteGuestUser(r.Context(), id)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create guest"})
+			return
+		}
+	}
+
+	if req.StripGPS {
+		if err := a.store.SetGuestStripGPS(r.Context(), id, true); err != nil {
+			_, _ = a.store.DeleteGuestUser(r.Context(), id)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create guest"})
+			return
+		}
+	}
+
+	_ = a.audit.Log(r.Context(), authCtx.Username, "guest_created", map[string]any{
+		"guest_id":    id,
+		"username":    req.Username,
+		"expires_at":  expiresAt.Format(time.RFC3339),
+		"album_id":    req.AlbumID,
+		"watermark":   req.Watermark != nil,
+		"auto_revoke": req.AutoRevoke,
+		"strip_gps":   req.StripGPS,
+	})
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"ok":          true,
+		"id":          id,
+		"username":    req.Username,
+		"expires_at":  expiresAt.Format(time.RFC3339),
+		"album_id":    req.AlbumID,
+		"watermark":   req.Watermark,
+		"auto_revoke": req.AutoRevoke,
+		"strip_gps":   req.StripGPS,
+	})
+}
+
+func (a *App) handleGuestsDelete(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid guest id"})
+		return
+	}
+	deleted, err := a.store.DeleteGuestUser(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete guest"})
+		return
+	}
+	if !deleted {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "guest not found"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "guest_revoked", map[string]any{"guest_id": id})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"businessplan/usbvault/internal/config"
+)
+
+// loadHeaderPolicy reads the saved security header policy. A saved policy
+// that no longer validates is logged and replaced by the default, so a bad
+// value can never drop the headers altogether.
+func (a *App) loadHeaderPolicy(ctx context.Context) error {
+	raw, _, err := a.store.GetSetting(ctx, config.SecurityHeadersSettingKey)
+	if err != nil {
+		return err
+	}
+	policy, err := config.ParseHeaderPolicy(raw)
+	if err != nil {
+		a.logger.Printf("security headers: %v; using the defaults", err)
+		policy, _ = config.HeaderPolicy{}.Normalize()
+	}
+	a.setHeaderPolicy(policy)
+	return nil
+}
+
+func (a *App) setHeaderPolicy(policy config.HeaderPolicy) {
+	a.headerMu.Lock()
+	a.headerPolicy = policy
+	a.csp = policy.ContentSecurityPolicy()
+	a.headerMu.Unlock()
+}
+
+// currentHeaderPolicy is the policy in force and its CSP header. Before
+// the first load it is the default policy.
+func (a *App) currentHeaderPolicy() (config.HeaderPolicy, string) {
+	a.headerMu.RLock()
+	policy, csp := a.headerPolicy, a.csp
+	a.headerMu.RUnlock()
+	if csp == "" {
+		policy, _ = config.HeaderPolicy{}.Normalize()
+		csp = policy.ContentSecurityPolicy()
+	}
+	return policy, csp
+}
+
+func (a *App) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy, csp := a.currentHeaderPolicy()
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// X-Frame-Options cannot name origins; with frame ancestors set,
+		// the CSP alone decides who may embed the UI.
+		if len(policy.FrameAncestors) == 0 {
+			w.Header().Set("X-Frame-Options", "DENY")
+		}
+		w.Header().Set("Referrer-Policy", policy.ReferrerPolicy)
+		w.Header().Set("Cross-Origin-Resource-Policy", "same-origin")
+		w.Header().Set("Cross-Origin-Opener-Policy", "same-origin")
+		// Leaflet is vendored under /web/vendor for offline use; map tiles may still be remote.
+		w.Header().Set("Content-Security-Policy", csp)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *App) handleSecurityHeadersGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	policy, csp := a.currentHeaderPolicy()
+	defaults, _ := config.HeaderPolicy{}.Normalize()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"policy":                  policy,
+		"defaults":                defaults,
+		"content_security_policy": csp,
+	})
+}
+
+// handleSecurityHeadersSet replaces the policy. An empty object restores
+// the defaults.
+func (a *App) handleSecurityHeadersSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req config.HeaderPolicy
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	policy, err := req.Normalize()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save security headers"})
+		return
+	}
+	if err := a.store.SetSetting(r.Context(), config.SecurityHeadersSettingKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save security headers"})
+		return
+	}
+	a.setHeaderPolicy(policy)
+	csp := policy.ContentSecurityPolicy()
+	_ = a.audit.Log(r.Context(), authCtx.Username, "security_headers_updated", map[string]any{
+		"map_tiles":       policy.MapTiles,
+		"img_src":         policy.ImgSrc,
+		"connect_src":     policy.ConnectSrc,
+		"frame_ancestors": policy.FrameAncestors,
+		"referrer_policy": policy.ReferrerPolicy,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "policy": policy, "content_security_policy": csp})
+}
@@ -0,0 +1,237 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/disk"
+	"businessplan/usbvault/internal/display"
+	"businessplan/usbvault/internal/ingest"
+	"businessplan/usbvault/internal/media"
+)
+
+// The kiosk endpoints serve the touch UI on slow Pi hardware: one summary
+// call replaces a poll per widget, and media comes in large slim pages with
+// thumbnails rendered ahead of the scroll.
+
+const (
+	kioskPageSize    = 60
+	kioskMaxPageSize = 200
+)
+
+// handleKioskSummary returns everything the kiosk home screen shows: storage
+// and ingest state with the last ingest result, attached cards waiting to be
+// ingested, free space on the storage drive, and open security alerts.
+func (a *App) handleKioskSummary(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	ctx := r.Context()
+	baseStorage, hasStorage, err := a.store.GetSetting(ctx, baseStorageKey)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	excluded, err := a.getExcludedMounts(ctx)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	openAlerts, err := a.store.CountOpenSecurityAlerts(ctx)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+
+	mounts := make([]string, 0)
+	var space *disk.Usage
+	if hasStorage {
+		baseStorage = filepath.Clean(strings.TrimSpace(baseStorage))
+		if u, err := disk.Stat(baseStorage); err == nil {
+			space = &u
+		}
+	}
+	for _, mount := range a.watcher.CurrentMounts() {
+		if !hasStorage || !ingest.ShouldSkipMount(mount, baseStorage, excluded) {
+			mounts = append(mounts, mount)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"has_storage": hasStorage,
+		"storage_dir": baseStorage,
+		"disk":        space,
+		"mounts":      mounts,
+		"ingest":      a.ingestor.GetStatus(),
+		"backup":      a.backuper.GetStatus(),
+		"open_alerts": openAlerts,
+		"display":     a.displayStatus(),
+		"clock":       a.clockStatus(),
+	})
+}
+
+// handleKioskMedia is a coarse media page with only the fields a grid tile
+// needs. Thumbnails for the page are rendered in the background so they are
+// cached by the time the tiles ask for them.
+func (a *App) handleKioskMedia(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	page := parsePositiveInt(r.URL.Query().Get("page"), 1)
+	size := min(parsePositiveInt(r.URL.Query().Get("size"), kioskPageSize), kioskMaxPageSize)
+	filter, err := mediaFilterFromRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	applyGuestScope(authCtx, &filter)
+	// One extra row tells the UI whether to offer another page.
+	records, err := a.store.ListMediaFiltered(r.Context(), r.URL.Query().Get("sort"), r.URL.Query().Get("order"), size+1, (page-1)*size, filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	hasMore := len(records) > size
+	if hasMore {
+		records = records[:size]
+	}
+	a.warmThumbnails(records)
+
+	items := make([]map[string]any, 0, len(records))
+	for _, rec := range records {
+		items = append(items, map[string]any{
+			"id":           rec.ID,
+			"kind":         rec.Kind,
+			"file_name":    rec.FileName,
+			"capture_time": rec.CaptureTime,
+			"location":     buildLocationPath(rec),
+			"thumb_url":    thumbURL(rec, media.ThumbSmall),
+			"preview_url":  previewURL(rec),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items, "page": page, "size": size, "has_more": hasMore})
+}
+
+// handleKioskDisplayReport receives display changes from usbvault-kiosk on
+// the same machine, which watches for monitors being plugged and unplugged.
+// It needs no session, so it only accepts loopback peers.
+func (a *App) handleKioskDisplayReport(w http.ResponseWriter, r *http.Request) {
+	if !isLoopbackRequest(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "display reports are only accepted from this machine"})
+		return
+	}
+	var st display.State
+	if err := decodeJSONBody(r, &st, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if len(st.Framebuffers) > 32 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "too many framebuffers"})
+		return
+	}
+	a.displayMu.Lock()
+	changed := a.display == nil || a.display.UI() != st.UI()
+	a.display = &st
+	a.displayMu.Unlock()
+	if changed {
+		a.logger.Printf("kiosk display changed: ui=%s", st.UI())
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "ui": st.UI()})
+}
+
+func (a *App) handleKioskDisplayGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	writeJSON(w, http.StatusOK, a.displayStatus())
+}
+
+func (a *App) clockStatus() map[string]any {
+	if a.clock == nil {
+		return nil
+	}
+	return a.clock.Status()
+}
+
+// displayStatus is the UI the kiosk should show. Until the launcher reports,
+// ui is empty and pages keep whatever they were opened with.
+func (a *App) displayStatus() map[string]any {
+	a.displayMu.RLock()
+	defer a.displayMu.RUnlock()
+	if a.display == nil {
+		return map[string]any{"ui": "", "state": nil}
+	}
+	return map[string]any{"ui": a.display.UI(), "state": a.display}
+}
+
+// handleKioskConsole feeds the text status screen usbvault-kiosk draws on a
+// monitor when no browser is installed. Like display reports it needs no
+// session, so it only answers loopback peers.
+func (a *App) handleKioskConsole(w http.ResponseWriter, r *http.Request) {
+	if !isLoopbackRequest(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "console status is only served to this machine"})
+		return
+	}
+	hasUsers, err := a.store.HasUsers(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"urls":           lanURLs(a.scheme()),
+		"setup_required": !hasUsers,
+		"provisioning":   a.provisioningStatus(),
+		"clock_trusted":  a.clock == nil || a.clock.Trusted(),
+		"ingest":         a.ingestor.GetStatus(),
+		"pairing_url":    a.pairingURL(),
+	})
+}
+
+// lanURLs are the addresses other devices can open the web UI on, IPv4
+// first. There are none while the server only listens on loopback.
+func lanURLs(scheme string) []string {
+	host := config.BindAddr()
+	port := strconv.Itoa(config.Port())
+	urls := make([]string, 0)
+	if config.IsLoopbackHost(host) {
+		return urls
+	}
+	bind, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	if err != nil || !bind.IsUnspecified() {
+		return append(urls, scheme+"://"+net.JoinHostPort(strings.Trim(host, "[]"), port)+"/")
+	}
+
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return urls
+	}
+	var addrs []netip.Addr
+	for _, ifaceAddr := range ifaceAddrs {
+		ipNet, ok := ifaceAddr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok {
+			continue
+		}
+		addr = addr.Unmap()
+		// 0.0.0.0 listens on IPv4 only; :: on both.
+		if addr.IsLoopback() || addr.IsLinkLocalUnicast() || (bind.Is4() && !addr.Is4()) {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	slices.SortStableFunc(addrs, func(x, y netip.Addr) int {
+		if x.Is4() != y.Is4() {
+			if x.Is4() {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	})
+	for _, addr := range addrs {
+		urls = append(urls, scheme+"://"+net.JoinHostPort(addr.String(), port)+"/")
+	}
+	return urls
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"maps"
+	"net/http"
+
+	"businessplan/usbvault/internal/i18n"
+)
+
+// withLocale picks the response language from Accept-Language, falling back
+// to USBVAULT_LOCALE. Handlers and the reports they build read it from the
+// request context; writeJSON reads it from the writer to translate errors.
+func withLocale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loc := i18n.Match(r.Header.Get("Accept-Language"))
+		w.Header().Add("Vary", "Accept-Language")
+		lw := &localeWriter{ResponseWriter: w, locale: loc}
+		next.ServeHTTP(lw, r.WithContext(i18n.WithLocale(r.Context(), loc)))
+	})
+}
+
+// localeWriter carries the request's locale down to writeJSON.
+type localeWriter struct {
+	http.ResponseWriter
+	locale *i18n.Locale
+}
+
+func (l *localeWriter) Flush() {
+	if f, ok := l.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (l *localeWriter) Unwrap() http.ResponseWriter {
+	return l.ResponseWriter
+}
+
+// responseLocale finds the locale set by withLocale through any writers
+// wrapped around it.
+func responseLocale(w http.ResponseWriter) *i18n.Locale {
+	for {
+		switch v := w.(type) {
+		case *localeWriter:
+			return v.locale
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// localizeError translates the "error" of an error payload. Messages that
+// are not in the catalog, such as ones that quote a value, stay English.
+func localizeError(w http.ResponseWriter, payload any) any {
+	loc := responseLocale(w)
+	if loc == nil {
+		return payload
+	}
+	switch p := payload.(type) {
+	case map[string]string:
+		if msg, ok := p["error"]; ok {
+			out := maps.Clone(p)
+			out["error"] = loc.T(msg)
+			return out
+		}
+	case map[string]any:
+		if msg, ok := p["error"].(string); ok {
+			out := maps.Clone(p)
+			out["error"] = loc.T(msg)
+			return out
+		}
+	}
+	return payload
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"businessplan/usbvault/internal/i18n"
+)
+
+func TestErrorsFollowAcceptLanguage(t *testing.T) {
+	t.Parallel()
+
+	var reportLocale string
+	handler := withLocale(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reportLocale = i18n.FromContext(r.Context()).Tag
+		// Writers wrapped inside withLocale, as withVersion does, still
+		// reach the locale.
+		w = &statusRecorder{ResponseWriter: w}
+		switch r.URL.Path {
+		case "/known":
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "album not found"})
+		case "/unknown":
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "offset_sec 9 is out of range", "field": "offset_sec"})
+		default:
+			writeJSON(w, http.StatusOK, map[string]string{"error": "album not found"})
+		}
+	}))
+
+	cases := []struct {
+		path, lang, want string
+	}{
+		{"/known", "de-DE,de;q=0.9", "Album nicht gefunden"},
+		{"/known", "es", "álbum no encontrado"},
+		{"/known", "", "album not found"},
+		{"/unknown", "fr", "offset_sec 9 is out of range"},
+		{"/ok", "de", "album not found"}, // only error statuses are translated
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.lang != "" {
+			req.Header.Set("Accept-Language", tc.lang)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: %v", tc.path, tc.lang, err)
+		}
+		if body["error"] != tc.want {
+			t.Errorf("%s with %q: error = %q, want %q", tc.path, tc.lang, body["error"], tc.want)
+		}
+		if rec.Header().Get("Vary") != "Accept-Language" {
+			t.Errorf("Vary = %q", rec.Header().Get("Vary"))
+		}
+	}
+	if reportLocale != "de" {
+		t.Fatalf("context locale = %q, want de", reportLocale)
+	}
+}
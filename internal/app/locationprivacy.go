@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+)
+
+// Files leaving the vault can have their GPS position removed while the
+// library keeps it. Admins ask for it per download or zip export, guests
+// can be created with it, and a global policy can require it for guests or
+// for everyone.
+
+const locationPrivacyKey = "location_privacy"
+
+// Location privacy policies.
+const (
+	stripGPSOff    = "off"    // only when a download or guest asks for it
+	stripGPSGuests = "guests" // always for guests
+	stripGPSAll    = "all"    // every file that leaves the vault
+)
+
+// errLocationKept means a file holds a position that cannot be removed,
+// so it is withheld instead.
+var errLocationKept = errors.New("this file's location cannot be removed, so it is withheld")
+
+type locationPrivacy struct {
+	StripGPS string `json:"strip_gps"`
+}
+
+func (a *App) loadLocationPrivacy(ctx context.Context) (locationPrivacy, error) {
+	p := locationPrivacy{StripGPS: stripGPSOff}
+	raw, ok, err := a.store.GetSetting(ctx, locationPrivacyKey)
+	if err != nil || !ok || strings.TrimSpace(raw) == "" {
+		return p, err
+	}
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		return locationPrivacy{StripGPS: stripGPSOff}, err
+	}
+	return p, nil
+}
+
+// stripLocation decides whether files sent on this request lose their
+// position. requested is the caller's own choice.
+func (a *App) stripLocation(ctx context.Context, authCtx *AuthContext, requested bool) (bool, error) {
+	if requested || (authCtx.IsGuest() && authCtx.StripGPS) {
+		return true, nil
+	}
+	p, err := a.loadLocationPrivacy(ctx)
+	if err != nil {
+		return true, err
+	}
+	switch p.StripGPS {
+	case stripGPSAll:
+		return true, nil
+	case stripGPSGuests:
+		return authCtx.IsGuest(), nil
+	}
+	return false, nil
+}
+
+// withoutLocation wraps a library file so its position is overwritten as it
+// is read. A file whose position cannot be found passes through only when
+// the vault found none in it at ingest; videos never do, since telemetry
+// tracks are not read at ingest.
+func withoutLocation(rec *db.MediaRecord, f io.ReadSeeker) (io.ReadSeeker, error) {
+	hasGPS := rec.GPSLat.Valid || rec.GPSLon.Valid || rec.Kind == "video"
+	if !media.CanStripLocation(rec.Extension) {
+		if hasGPS {
+			return nil, errLocationKept
+		}
+		return f, nil
+	}
+	spans, err := media.LocationSpans(f, rec.Extension)
+	if errors.Is(err, media.ErrLocationNotStrippable) {
+		if hasGPS {
+			return nil, errLocationKept
+		}
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return media.WithoutLocation(f, spans), nil
+}
+
+// hideLocation clears the position and street address of a record shown
+// to someone who only gets files without their location.
+func hideLocation(rec *db.MediaRecord) {
+	rec.GPSLat, rec.GPSLon = sql.NullFloat64{}, sql.NullFloat64{}
+	rec.CameraYaw, rec.CameraPitch, rec.CameraRoll = sql.NullFloat64{}, sql.NullFloat64{}, sql.NullFloat64{}
+	rec.Road, rec.HouseNumber, rec.Postcode, rec.DisplayName = sql.NullString{}, sql.NullString{}, sql.NullString{}, sql.NullString{}
+}
+
+func (a *App) handleLocationPrivacyGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	p, err := a.loadLocationPrivacy(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load location privacy"})
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (a *App) handleLocationPrivacySet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req locationPrivacy
+	if err := decodeJSONBody(r, &req, 1<<12); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	req.StripGPS = strings.ToLower(strings.TrimSpace(req.StripGPS))
+	switch req.StripGPS {
+	case stripGPSOff, stripGPSGuests, stripGPSAll:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "strip_gps must be off, guests, or all"})
+		return
+	}
+	raw, _ := json.Marshal(req)
+	if err := a.store.SetSetting(r.Context(), locationPrivacyKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update location privacy"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "location_privacy_updated", map[string]any{"strip_gps": req.StripGPS})
+	writeJSON(w, http.StatusOK, req)
+}
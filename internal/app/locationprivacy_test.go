@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestLocationPrivacyPolicy(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+
+	admin := &AuthContext{Username: "admin", Role: db.RoleAdmin}
+	guest := &AuthContext{Username: "client", Role: db.RoleGuest}
+	strippedGuest := &AuthContext{Username: "press", Role: db.RoleGuest, StripGPS: true}
+	check := func(authCtx *AuthContext, requested, want bool) {
+		t.Helper()
+		got, err := app.stripLocation(ctx, authCtx, requested)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("stripLocation(%s, %v) = %v, want %v", authCtx.Username, requested, got, want)
+		}
+	}
+	check(admin, false, false)
+	check(admin, true, true)
+	check(guest, false, false)
+	check(strippedGuest, false, true)
+
+	set := func(body string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/location-privacy", strings.NewReader(body))
+		app.handleLocationPrivacySet(rr, req, admin)
+		return rr.Code
+	}
+	if code := set(`{"strip_gps":"sometimes"}`); code != http.StatusBadRequest {
+		t.Fatalf("unknown policy = %d, want 400", code)
+	}
+	if code := set(`{"strip_gps":"guests"}`); code != http.StatusOK {
+		t.Fatalf("set guests = %d", code)
+	}
+	check(admin, false, false)
+	check(guest, false, true)
+	if code := set(`{"strip_gps":"all"}`); code != http.StatusOK {
+		t.Fatalf("set all = %d", code)
+	}
+	check(admin, false, true)
+}
+
+func TestServeMediaWithheldWhenLocationKept(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+
+	data := []byte("\x89PNG\r\n\x1a\nnot really a png")
+	path := filepath.Join(t.TempDir(), "map.png")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rec := &db.MediaRecord{ID: 3, FileName: "map.png", Extension: ".png", Kind: "image", DestPath: path}
+	admin := &AuthContext{Username: "admin", Role: db.RoleAdmin}
+	serve := func(strip bool) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/media/3/download", nil)
+		app.serveMediaRecord(rr, req, admin, rec, true, strip)
+		return rr
+	}
+
+	// Nothing to remove: the file goes out unchanged.
+	if rr := serve(true); rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), data) {
+		t.Fatalf("file without a position = %d", rr.Code)
+	}
+
+	// A position the vault knows of but cannot remove keeps the file in.
+	rec.GPSLat = sql.NullFloat64{Float64: 48.1, Valid: true}
+	rec.GPSLon = sql.NullFloat64{Float64: 11.5, Valid: true}
+	if rr := serve(true); rr.Code != http.StatusConflict {
+		t.Fatalf("file with a kept position = %d, want 409", rr.Code)
+	}
+	if _, err := withoutLocation(rec, bytes.NewReader(data)); !errors.Is(err, errLocationKept) {
+		t.Fatalf("withoutLocation = %v, want errLocationKept", err)
+	}
+	if rr := serve(false); rr.Code != http.StatusOK {
+		t.Fatalf("unstripped download = %d", rr.Code)
+	}
+
+	records, err := store.ListAudit(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("audited %d downloads, want 2 (the withheld one is not)", len(records))
+	}
+}
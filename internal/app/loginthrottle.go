@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failed sign-ins are throttled per client address and per username, so
+// neither guessing one account from many addresses nor many accounts from
+// one address gets far. The first few failures are free; after that each
+// failure locks the key for twice as long as the last, up to
+// loginMaxLockout. Counts live in the database and survive a restart.
+const (
+	loginFreeFailures   = 3
+	loginMaxLockout     = 15 * time.Minute
+	loginFailureMemory  = 24 * time.Hour // a key with no failure for this long starts over
+	loginLockoutAuditAt = 5              // failures from which each new lockout is audited
+)
+
+// loginLockout is how long a key is locked after its nth failure in a row.
+func loginLockout(failures int) time.Duration {
+	if failures <= loginFreeFailures {
+		return 0
+	}
+	return min(time.Second<<min(failures-loginFreeFailures-1, 20), loginMaxLockout)
+}
+
+// loginThrottleKeys are the keys a sign-in counts against. The address is
+// the TCP peer; X-Forwarded-For is for anyone to set.
+func loginThrottleKeys(r *http.Request, username string) []string {
+	keys := make([]string, 0, 2)
+	if addr, ok := remoteAddr(r); ok {
+		keys = append(keys, "ip:"+addr.String())
+	}
+	if username = strings.ToLower(strings.TrimSpace(username)); username != "" {
+		keys = append(keys, "user:"+truncateForAudit(username, 64))
+	}
+	return keys
+}
+
+// loginLocked refuses a sign-in while any of keys is locked, answering 429
+// with Retry-After. It reports whether it did.
+func (a *App) loginLocked(w http.ResponseWriter, r *http.Request, keys []string) bool {
+	until, err := a.store.LoginLockedUntil(r.Context(), time.Now(), keys...)
+	if err != nil || until.IsZero() {
+		return false
+	}
+	wait := int(time.Until(until).Round(time.Second) / time.Second)
+	wait = max(wait, 1)
+	w.Header().Set("Retry-After", strconv.Itoa(wait))
+	writeJSON(w, http.StatusTooManyRequests, map[string]any{
+		"error":       "too many failed sign-ins; try again in " + strconv.Itoa(wait) + "s",
+		"retry_after": wait,
+	})
+	return true
+}
+
+// recordLoginFailure counts a failed sign-in against keys and audits the
+// lockouts repeated failures bring on.
+func (a *App) recordLoginFailure(ctx context.Context, r *http.Request, username string, keys []string) {
+	now := time.Now()
+	for _, key := range keys {
+		failures, until, err := a.store.RecordLoginFailure(ctx, key, now, now.Add(-loginFailureMemory), loginLockout)
+		if err != nil {
+			a.logger.Printf("record failed sign-in for %s: %v", key, err)
+			continue
+		}
+		if failures < loginLockoutAuditAt || until.IsZero() {
+			continue
+		}
+		_ = a.audit.Log(ctx, "anonymous", "login_locked", map[string]any{
+			"key":          key,
+			"username":     truncateForAudit(username, 64),
+			"ip":           clientIP(r),
+			"failures":     failures,
+			"locked_until": until.Format(time.RFC3339),
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/alerts"
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/security"
+)
+
+func TestLoginLockout(t *testing.T) {
+	for failures, want := range map[int]time.Duration{
+		1: 0, 3: 0, 4: time.Second, 5: 2 * time.Second, 8: 16 * time.Second, 40: loginMaxLockout,
+	} {
+		if got := loginLockout(failures); got != want {
+			t.Errorf("loginLockout(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestLoginThrottledPerAddressAndUsername(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	hash, salt, err := security.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateUser(ctx, "admin", hash, salt); err != nil {
+		t.Fatal(err)
+	}
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0), sessionTTL: time.Hour}
+
+	login := func(remote, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"username":"admin","password":"`+password+`"}`))
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		rr := httptest.NewRecorder()
+		app.handleLogin(rr, req)
+		return rr
+	}
+	for i := range loginFreeFailures + 1 {
+		if rr := login("192.0.2.7:4000", "wrong"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d = %d: %s", i+1, rr.Code, rr.Body.String())
+		}
+	}
+
+	// The failures are audited, for the intrusion detector, under the TCP
+	// peer and not the forwarded address the client claims.
+	recs, err := store.ListAudit(ctx, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range recs {
+		if rec.Action == "login_failed" && !strings.Contains(rec.Details, `"ip":"192.0.2.7"`) {
+			t.Fatalf("login_failed details = %s, want the peer address", rec.Details)
+		}
+	}
+
+	// Locked now, even with the right password, and from another address
+	// because the username is locked too.
+	rr := login("192.0.2.7:4000", "correct horse battery")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("locked address = %d, Retry-After %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := login("198.51.100.3:4000", "correct horse battery"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked username from elsewhere = %d", rr.Code)
+	}
+
+	// The count survives in the database; once the lock runs out a good
+	// sign-in clears it.
+	if err := store.ClearLoginFailures(ctx, "user:admin"); err != nil {
+		t.Fatal(err)
+	}
+	if rr := login("198.51.100.3:4000", "correct horse battery"); rr.Code != http.StatusOK {
+		t.Fatalf("other address after username unlock = %d: %s", rr.Code, rr.Body.String())
+	}
+	until, err := store.LoginLockedUntil(ctx, time.Now(), "ip:192.0.2.7")
+	if err != nil || until.IsZero() {
+		t.Fatalf("address lock = %v, %v; want still locked", until, err)
+	}
+}
+
+func TestNewLoginAddressIgnoresForwardedFor(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	hash, salt, err := security.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateUser(ctx, "admin", hash, salt); err != nil {
+		t.Fatal(err)
+	}
+	auditLogger := audit.New(store)
+	auditLogger.SetObserver(alerts.New(store, nil, nil))
+	app := &App{store: store, audit: auditLogger, logger: log.New(io.Discard, "", 0), sessionTTL: time.Hour}
+
+	login := func(remote, forwardedFor string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"username":"admin","password":"correct horse battery"}`))
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rr := httptest.NewRecorder()
+		app.handleLogin(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("login from %s = %d: %s", remote, rr.Code, rr.Body.String())
+		}
+	}
+	// The owner's usual address, whatever the header says.
+	login("192.0.2.7:4000", "203.0.113.1")
+	login("192.0.2.7:4000", "203.0.113.2")
+	if n, _ := store.CountOpenSecurityAlerts(ctx); n != 0 {
+		t.Fatalf("%d alerts for logins from the usual address", n)
+	}
+	// Someone else, claiming to be forwarded for the owner.
+	login("198.51.100.3:4000", "192.0.2.7")
+	items, err := store.ListSecurityAlerts(ctx, false, 10)
+	if err != nil || len(items) != 1 || items[0].Kind != alerts.KindNewLoginIP || !strings.Contains(items[0].Message, "198.51.100.3") {
+		t.Fatalf("alerts = %+v, %v; want a new address alert for the real peer", items, err)
+	}
+}
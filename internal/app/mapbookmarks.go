@@ -0,0 +1,139 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+
+	"businessplan/usbvault/internal/db"
+)
+
+// Map bookmarks are named map views a user saves to jump back to a site.
+// They are kept per user on the server so they follow the user to any
+// device.
+
+const (
+	mapBookmarkNameMax   = 64
+	mapBookmarkMaxZoom   = 19
+	mapBookmarkPerUser   = 200
+	mapBookmarkBodyLimit = 1 << 12
+)
+
+type mapBookmarkRequest struct {
+	Name string   `json:"name"`
+	Lat  *float64 `json:"lat"`
+	Lon  *float64 `json:"lon"`
+	Zoom *int     `json:"zoom"`
+}
+
+// bookmark validates req and returns the bookmark it describes.
+func (req mapBookmarkRequest) bookmark() (db.MapBookmark, string) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > mapBookmarkNameMax {
+		return db.MapBookmark{}, "name must be 1-64 characters"
+	}
+	if req.Lat == nil || req.Lon == nil || math.IsNaN(*req.Lat) || math.IsNaN(*req.Lon) ||
+		*req.Lat < -90 || *req.Lat > 90 || *req.Lon < -180 || *req.Lon > 180 {
+		return db.MapBookmark{}, "lat must be within -90..90 and lon within -180..180"
+	}
+	if req.Zoom == nil || *req.Zoom < 0 || *req.Zoom > mapBookmarkMaxZoom {
+		return db.MapBookmark{}, "zoom must be 0-19"
+	}
+	return db.MapBookmark{Name: name, Lat: *req.Lat, Lon: *req.Lon, Zoom: *req.Zoom}, ""
+}
+
+func (a *App) handleMapBookmarksList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	items, err := a.store.ListMapBookmarks(r.Context(), authCtx.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (a *App) handleMapBookmarkCreate(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req mapBookmarkRequest
+	if err := decodeJSONBody(r, &req, mapBookmarkBodyLimit); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	b, msg := req.bookmark()
+	if msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+	n, err := a.store.CountMapBookmarks(r.Context(), authCtx.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if n >= mapBookmarkPerUser {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "too many bookmarks; delete one first"})
+		return
+	}
+	err = a.store.CreateMapBookmark(r.Context(), authCtx.UserID, &b)
+	if errors.Is(err, db.ErrBookmarkNameTaken) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save bookmark"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "map_bookmark_created", map[string]any{"id": b.ID, "name": b.Name})
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func (a *App) handleMapBookmarkUpdate(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid bookmark id"})
+		return
+	}
+	var req mapBookmarkRequest
+	if err := decodeJSONBody(r, &req, mapBookmarkBodyLimit); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	b, msg := req.bookmark()
+	if msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+	b.ID = id
+	updated, err := a.store.UpdateMapBookmark(r.Context(), authCtx.UserID, b)
+	if errors.Is(err, db.ErrBookmarkNameTaken) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save bookmark"})
+		return
+	}
+	if updated == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "bookmark not found"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "map_bookmark_updated", map[string]any{"id": id, "name": updated.Name})
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (a *App) handleMapBookmarkDelete(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid bookmark id"})
+		return
+	}
+	name, err := a.store.DeleteMapBookmark(r.Context(), authCtx.UserID, id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "delete failed"})
+		return
+	}
+	if name == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "bookmark not found"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "map_bookmark_deleted", map[string]any{"id": id, "name": name})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
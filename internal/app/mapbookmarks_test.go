@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestMapBookmarksArePerUser(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	aliceID, err := store.CreateUser(ctx, "alice", []byte("hash"), []byte("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobID, err := store.CreateUser(ctx, "bob", []byte("hash"), []byte("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	alice := &AuthContext{UserID: aliceID, Username: "alice", Role: db.RoleAdmin}
+	bob := &AuthContext{UserID: bobID, Username: "bob", Role: db.RoleAdmin}
+
+	call := func(h func(http.ResponseWriter, *http.Request, *AuthContext), method, path, id, body string, authCtx *AuthContext) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if id != "" {
+			req.SetPathValue("id", id)
+		}
+		rr := httptest.NewRecorder()
+		h(rr, req, authCtx)
+		return rr
+	}
+
+	for _, body := range []string{
+		`{"name":"","lat":1,"lon":1,"zoom":5}`,
+		`{"name":"north","lat":91,"lon":1,"zoom":5}`,
+		`{"name":"north","lat":1,"lon":1}`,
+		`{"name":"north","lat":1,"lon":1,"zoom":20}`,
+	} {
+		if rr := call(app.handleMapBookmarkCreate, http.MethodPost, "/api/map/bookmarks", "", body, alice); rr.Code != http.StatusBadRequest {
+			t.Fatalf("create %s = %d, want 400", body, rr.Code)
+		}
+	}
+
+	rr := call(app.handleMapBookmarkCreate, http.MethodPost, "/api/map/bookmarks", "", `{"name":" North pasture ","lat":44.5,"lon":-93.25,"zoom":15}`, alice)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", rr.Code, rr.Body.String())
+	}
+	var created db.MapBookmark
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == 0 || created.Name != "North pasture" || created.Zoom != 15 {
+		t.Fatalf("created = %+v", created)
+	}
+	if rr := call(app.handleMapBookmarkCreate, http.MethodPost, "/api/map/bookmarks", "", `{"name":"North pasture","lat":0,"lon":0,"zoom":3}`, alice); rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate name = %d, want 409", rr.Code)
+	}
+	// Names are only unique per user.
+	if rr := call(app.handleMapBookmarkCreate, http.MethodPost, "/api/map/bookmarks", "", `{"name":"North pasture","lat":0,"lon":0,"zoom":3}`, bob); rr.Code != http.StatusCreated {
+		t.Fatalf("bob create = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	id := fmt.Sprint(created.ID)
+	if rr := call(app.handleMapBookmarkUpdate, http.MethodPost, "/api/map/bookmarks/"+id, id, `{"name":"Stolen","lat":0,"lon":0,"zoom":3}`, bob); rr.Code != http.StatusNotFound {
+		t.Fatalf("bob update = %d, want 404", rr.Code)
+	}
+	if rr := call(app.handleMapBookmarkUpdate, http.MethodPost, "/api/map/bookmarks/"+id, id, `{"name":"Barn","lat":44.6,"lon":-93.2,"zoom":17}`, alice); rr.Code != http.StatusOK {
+		t.Fatalf("update = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	list := call(app.handleMapBookmarksList, http.MethodGet, "/api/map/bookmarks", "", "", alice)
+	var listed struct {
+		Items []db.MapBookmark `json:"items"`
+	}
+	if err := json.NewDecoder(list.Body).Decode(&listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Items) != 1 || listed.Items[0].Name != "Barn" || listed.Items[0].Zoom != 17 || listed.Items[0].Lat != 44.6 {
+		t.Fatalf("alice list = %+v", listed.Items)
+	}
+
+	if rr := call(app.handleMapBookmarkDelete, http.MethodDelete, "/api/map/bookmarks/"+id, id, "", bob); rr.Code != http.StatusNotFound {
+		t.Fatalf("bob delete = %d, want 404", rr.Code)
+	}
+	if rr := call(app.handleMapBookmarkDelete, http.MethodDelete, "/api/map/bookmarks/"+id, id, "", alice); rr.Code != http.StatusOK {
+		t.Fatalf("delete = %d: %s", rr.Code, rr.Body.String())
+	}
+	if items, _ := store.ListMapBookmarks(ctx, aliceID); len(items) != 0 {
+		t.Fatalf("alice bookmarks after delete = %+v", items)
+	}
+	if items, _ := store.ListMapBookmarks(ctx, bobID); len(items) != 1 {
+		t.Fatalf("bob bookmarks = %+v", items)
+	}
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+)
+
+// /api/map sends every point, which a library of tens of thousands of
+// located files outgrows. /api/map/clusters groups points into a grid sized
+// to the zoom level instead, so the map draws one marker per cell with a
+// count and a few thumbnails, however many files are behind it.
+
+const (
+	// clusterCellsPerTile sets the grid: four cells across a 256-pixel map
+	// tile makes cells about 64 pixels wide at any zoom.
+	clusterCellsPerTile = 4
+	clusterMaxZoom      = 22
+	clusterDefaultLimit = 1000
+	clusterMaxLimit     = 5000
+)
+
+type mapClusterSample struct {
+	ID       int64  `json:"id"`
+	Kind     string `json:"kind"`
+	ThumbURL string `json:"thumb_url,omitempty"`
+}
+
+type mapCluster struct {
+	db.MapCluster
+	Samples []mapClusterSample `json:"samples"`
+}
+
+// clusterCellDeg is the width of a grid cell in degrees at zoom.
+func clusterCellDeg(zoom int) float64 {
+	return 360 / (math.Exp2(float64(zoom)) * clusterCellsPerTile)
+}
+
+// parseBBox reads west,south,east,north, the order Leaflet's
+// toBBoxString uses. Longitudes outside ±180, which a map panned round the
+// world reports, are wrapped, and a west greater than east crosses the
+// antimeridian.
+func parseBBox(raw string) (db.MapBounds, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return db.WorldBounds, nil
+	}
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return db.MapBounds{}, errors.New("bbox must be west,south,east,north")
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return db.MapBounds{}, errors.New("bbox must be west,south,east,north")
+		}
+		v[i] = f
+	}
+	b := db.MapBounds{West: v[0], South: math.Max(v[1], -90), East: v[2], North: math.Min(v[3], 90)}
+	if b.South > b.North {
+		return db.MapBounds{}, errors.New("bbox south must not exceed north")
+	}
+	if b.East-b.West >= 360 {
+		b.West, b.East = -180, 180
+		return b, nil
+	}
+	b.West, b.East = wrapLon(b.West), wrapLon(b.East)
+	return b, nil
+}
+
+func wrapLon(lon float64) float64 {
+	lon = math.Mod(lon+180, 360)
+	if lon < 0 {
+		lon += 360
+	}
+	return lon - 180
+}
+
+func (a *App) handleMapClusters(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	q := r.URL.Query()
+	filter, err := mediaFilterFromRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	applyGuestScope(authCtx, &filter)
+	bounds, err := parseBBox(q.Get("bbox"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	zoom := 2
+	if raw := q.Get("zoom"); raw != "" {
+		if zoom, err = strconv.Atoi(raw); err != nil || zoom < 0 || zoom > clusterMaxZoom {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "zoom must be 0-22"})
+			return
+		}
+	}
+	limit := parsePositiveInt(q.Get("limit"), clusterDefaultLimit)
+	if limit > clusterMaxLimit {
+		limit = clusterMaxLimit
+	}
+	cellDeg := clusterCellDeg(zoom)
+	resp := map[string]any{"zoom": zoom, "cell_deg": cellDeg, "clusters": []mapCluster{}, "count": 0, "truncated": false}
+	if authCtx.IsGuest() {
+		if hide, _ := a.stripLocation(r.Context(), authCtx, false); hide {
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+	}
+
+	clusters, total, err := a.store.ListMapClusters(r.Context(), bounds, cellDeg, limit, filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	out := make([]mapCluster, len(clusters))
+	var shown int64
+	for i, c := range clusters {
+		out[i] = mapCluster{MapCluster: c, Samples: make([]mapClusterSample, len(c.Samples))}
+		for j, s := range c.Samples {
+			out[i].Samples[j] = mapClusterSample{ID: s.ID, Kind: s.Kind}
+			// Guests cannot fetch thumbnails.
+			if !authCtx.IsGuest() {
+				rec := db.MediaRecord{ID: s.ID, Kind: s.Kind, Extension: s.Extension, PosterStatus: s.PosterStatus}
+				out[i].Samples[j].ThumbURL = thumbURL(rec, media.ThumbSmall)
+			}
+		}
+		shown += c.Count
+	}
+	resp["clusters"] = out
+	resp["count"] = total
+	resp["truncated"] = shown < total
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,39 @@
+package app
+
+import (
+	"testing"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func TestParseBBox(t *testing.T) {
+	for raw, want := range map[string]db.MapBounds{
+		"":                        db.WorldBounds,
+		"-105.2,39.5,-104.6,40.0": {South: 39.5, West: -105.2, North: 40.0, East: -104.6},
+		// Panned once round the world.
+		"255,39.5,255.5,40": {South: 39.5, West: -105, North: 40, East: -104.5},
+		// Straddling the antimeridian, as Leaflet reports it and as given.
+		"170,-20,190,-10":  {South: -20, West: 170, North: -10, East: -170},
+		"170,-20,-170,-10": {South: -20, West: 170, North: -10, East: -170},
+		"-400,-95,400,95":  db.WorldBounds,
+	} {
+		got, err := parseBBox(raw)
+		if err != nil || got != want {
+			t.Errorf("parseBBox(%q) = %+v, %v; want %+v", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"1,2,3", "a,b,c,d", "0,10,1,5", "0,NaN,1,2"} {
+		if _, err := parseBBox(raw); err == nil {
+			t.Errorf("parseBBox(%q) accepted", raw)
+		}
+	}
+}
+
+func TestClusterCellDeg(t *testing.T) {
+	if got := clusterCellDeg(0); got != 90 {
+		t.Fatalf("zoom 0 cell = %v, want 90", got)
+	}
+	if got := clusterCellDeg(10); got != 360.0/4096 {
+		t.Fatalf("zoom 10 cell = %v", got)
+	}
+}
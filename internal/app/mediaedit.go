@@ -0,0 +1,86 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+// maxCaptureOffset bounds a capture time shift; a camera clock is rarely
+// off by more than its battery's lifetime.
+const maxCaptureOffset = 100 * 365 * 24 * time.Hour
+
+// mediaEditRequest is the body of POST /api/media/edit. Fields left out are
+// not changed, and an empty string clears one.
+type mediaEditRequest struct {
+	IDs []int64 `json:"ids"`
+	// CaptureOffsetSeconds is added to every capture time, to correct a
+	// camera clock that was set wrong.
+	CaptureOffsetSeconds int64   `json:"capture_offset_seconds"`
+	State                *string `json:"state"`
+	County               *string `json:"county"`
+	City                 *string `json:"city"`
+	Make                 *string `json:"make"`
+	Model                *string `json:"model"`
+}
+
+func (a *App) handleMediaEdit(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req mediaEditRequest
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	ids := normalizeIDs(req.IDs, 5000)
+	if len(ids) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ids must contain at least one positive id"})
+		return
+	}
+	offset := time.Duration(req.CaptureOffsetSeconds) * time.Second
+	if offset > maxCaptureOffset || offset < -maxCaptureOffset {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "capture_offset_seconds is out of range"})
+		return
+	}
+
+	edit := db.MediaEdit{CaptureOffset: offset}
+	details := map[string]any{"media_ids": ids}
+	if offset != 0 {
+		details["capture_offset_seconds"] = req.CaptureOffsetSeconds
+	}
+	for _, f := range []struct {
+		name string
+		in   *string
+		out  **string
+	}{
+		{"state", req.State, &edit.State},
+		{"county", req.County, &edit.County},
+		{"city", req.City, &edit.City},
+		{"make", req.Make, &edit.Make},
+		{"model", req.Model, &edit.Model},
+	} {
+		if f.in == nil {
+			continue
+		}
+		v := strings.TrimSpace(*f.in)
+		if len(v) > 200 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": f.name + " is too long"})
+			return
+		}
+		*f.out = &v
+		details[f.name] = v
+	}
+	if edit.Empty() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "nothing to change"})
+		return
+	}
+
+	updated, err := a.store.EditMedia(r.Context(), ids, edit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to edit media"})
+		return
+	}
+	details["updated"] = updated
+	_ = a.audit.Log(r.Context(), authCtx.Username, "media_edited", details)
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "updated": updated})
+}
@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"businessplan/usbvault/internal/config"
+)
+
+// checkBindExposure refuses to listen beyond loopback unless the operator
+// has explicitly confirmed it and, unless tlsOn, acknowledged that traffic
+// is plain HTTP.
+func checkBindExposure(host string, tlsOn bool) error {
+	if config.IsLoopbackHost(host) {
+		return nil
+	}
+	if !config.ConfirmLANExposure() {
+		return fmt.Errorf("refusing to bind %q: set USBVAULT_CONFIRM_LAN_EXPOSURE=1 to expose the vault beyond this machine", host)
+	}
+	if !tlsOn && !config.AllowInsecureLAN() {
+		return fmt.Errorf("refusing to bind %q over plain HTTP: set USBVAULT_ALLOW_INSECURE_LAN=1 to accept unencrypted LAN traffic", host)
+	}
+	return nil
+}
+
+// loadAllowedNetworks merges the env allow-list with the saved one. When the
+// vault is LAN-exposed and nothing is configured, private ranges are used.
+func (a *App) loadAllowedNetworks(ctx context.Context) error {
+	raw, _, err := a.store.GetSetting(ctx, config.AllowedNetworksSettingKey)
+	if err != nil {
+		return err
+	}
+	entries := append(config.AllowedNetworksEnv(), config.ParseNetworkList(raw)...)
+	prefixes, err := config.ParseNetworks(entries)
+	if err != nil {
+		return err
+	}
+	a.netMu.Lock()
+	a.allowedNetworks = prefixes
+	a.netMu.Unlock()
+	return nil
+}
+
+func (a *App) effectiveNetworks() []netip.Prefix {
+	a.netMu.RLock()
+	defer a.netMu.RUnlock()
+	if len(a.allowedNetworks) == 0 {
+		return config.PrivateNetworks()
+	}
+	return a.allowedNetworks
+}
+
+// remoteAddr is the TCP peer. Unlike clientIP it ignores X-Forwarded-For,
+// which any client can set.
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// peerIP is the TCP peer's address for audit details that feed the
+// intrusion detector, or "" when it cannot be parsed.
+func peerIP(r *http.Request) string {
+	if addr, ok := remoteAddr(r); ok {
+		return addr.String()
+	}
+	return ""
+}
+
+func isLoopbackRequest(r *http.Request) bool {
+	addr, ok := remoteAddr(r)
+	return ok && addr.IsLoopback()
+}
+
+// allowListMiddleware drops requests from peers outside the allow-list.
+// Loopback is always allowed so the local operator cannot lock themselves out.
+func (a *App) allowListMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, ok := remoteAddr(r)
+		if !ok {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "client address not allowed"})
+			return
+		}
+		if addr.IsLoopback() || config.NetworksContain(a.effectiveNetworks(), addr) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "client address not allowed"})
+	})
+}
+
+type allowedNetworksRequest struct {
+	Networks []string `json:"networks"`
+}
+
+func (a *App) handleAllowedNetworksGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	raw, _, err := a.store.GetSetting(r.Context(), config.AllowedNetworksSettingKey)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	saved := config.ParseNetworkList(raw)
+	if saved == nil {
+		saved = []string{}
+	}
+	envList := config.AllowedNetworksEnv()
+	if envList == nil {
+		envList = []string{}
+	}
+	effective := make([]string, 0)
+	for _, p := range a.effectiveNetworks() {
+		effective = append(effective, p.String())
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"bind":        config.BindAddr(),
+		"lan_exposed": !config.IsLoopbackHost(config.BindAddr()),
+		"networks":    saved,
+		"env":         envList,
+		"effective":   effective,
+	})
+}
+
+func (a *App) handleAllowedNetworksSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req allowedNetworksRequest
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	prefixes, err := config.ParseNetworks(req.Networks)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if addr, ok := remoteAddr(r); ok && !addr.IsLoopback() && len(prefixes) > 0 &&
+		!config.NetworksContain(append(prefixes, mustEnvNetworks()...), addr) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "allow-list would block your own address " + addr.String()})
+		return
+	}
+	if err := a.store.SetSetting(r.Context(), config.AllowedNetworksSettingKey, config.EncodeNetworkList(prefixes)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save allow-list"})
+		return
+	}
+	if err := a.loadAllowedNetworks(r.Context()); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to reload allow-list"})
+		return
+	}
+	saved := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		saved = append(saved, p.String())
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "allowed_networks_updated", map[string]any{"networks": saved})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "networks": saved})
+}
+
+func mustEnvNetworks() []netip.Prefix {
+	prefixes, err := config.ParseNetworks(config.AllowedNetworksEnv())
+	if err != nil {
+		return nil
+	}
+	return prefixes
+}
+
+var errSetupRemote = errors.New("initial setup must be completed from this machine while the vault is exposed to the network")
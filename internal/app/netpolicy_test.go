@@ -0,0 +1,82 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"businessplan/usbvault/internal/config"
+)
+
+func TestAllowListMiddleware(t *testing.T) {
+	t.Parallel()
+
+	prefixes, err := config.ParseNetworks([]string{"203.0.113.0/24", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("ParseNetworks: %v", err)
+	}
+	a := &App{allowedNetworks: prefixes}
+	handler := a.allowListMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		remote string
+		xff    string
+		want   int
+	}{
+		{remote: "127.0.0.1:5000", want: http.StatusNoContent},
+		{remote: "[::1]:5000", want: http.StatusNoContent},
+		{remote: "203.0.113.7:5000", want: http.StatusNoContent},
+		{remote: "[2001:db8::1]:5000", want: http.StatusNoContent},
+		{remote: "[::ffff:203.0.113.9]:5000", want: http.StatusNoContent},
+		{remote: "192.168.1.20:5000", want: http.StatusForbidden},
+		{remote: "198.51.100.4:5000", xff: "203.0.113.7", want: http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+		req.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("remote %s: status = %d, want %d", tc.remote, rec.Code, tc.want)
+		}
+	}
+
+	// With no configured list only private ranges are reachable.
+	a = &App{}
+	handler = a.allowListMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.168.1.20:5000"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("private default: status = %d", rec.Code)
+	}
+	req.RemoteAddr = "8.8.8.8:5000"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("public default: status = %d", rec.Code)
+	}
+}
+
+func TestParseNetworksRejectsInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, entry := range []string{"10.0.0.0/33", "not-an-ip", "192.168.1"} {
+		if _, err := config.ParseNetworks([]string{entry}); err == nil {
+			t.Fatalf("ParseNetworks(%q) expected error", entry)
+		}
+	}
+	got, err := config.ParseNetworks([]string{" 10.1.2.3/8 ", "10.0.0.0/8", "192.168.1.5"})
+	if err != nil {
+		t.Fatalf("ParseNetworks: %v", err)
+	}
+	if len(got) != 2 || got[0].String() != "10.0.0.0/8" || got[1].String() != "192.168.1.5/32" {
+		t.Fatalf("ParseNetworks = %v", got)
+	}
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"businessplan/usbvault/internal/ocr"
+)
+
+const ocrIntervalMinutes = 10
+
+// handleMediaText returns the text read from an image, for display next to
+// it. Items that have not been read have no text.
+func (a *App) handleMediaText(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid media id"})
+		return
+	}
+	text, err := a.store.GetMediaText(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if text == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no text has been read from this item"})
+		return
+	}
+	writeJSON(w, http.StatusOK, text)
+}
+
+func (a *App) handleOCRStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	if a.ocr == nil {
+		writeJSON(w, http.StatusOK, ocr.Status{State: "disabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, a.ocr.GetStatus(r.Context()))
+}
+
+// handleOCRRun reads newly tagged images now instead of waiting for the next
+// tick.
+func (a *App) handleOCRRun(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	if a.ocr == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "OCR is not configured"})
+		return
+	}
+	if a.ocr.GetStatus(r.Context()).State == "running" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": ocr.ErrBusy.Error()})
+		return
+	}
+	go func() {
+		if err := a.ocr.RunOnce(context.Background()); err != nil && !errors.Is(err, ocr.ErrBusy) {
+			a.logger.Printf("text recognition failed: %v", err)
+		}
+	}()
+	_ = a.audit.Log(r.Context(), authCtx.Username, "ocr_started", map[string]any{})
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
+}
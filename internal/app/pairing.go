@@ -0,0 +1,235 @@
+package app
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/qr"
+	"businessplan/usbvault/internal/security"
+)
+
+// Pairing lets a phone connect by scanning a QR code instead of typing an
+// address and password. An admin offers a pairing; the code holds the LAN
+// address and a one-time token, and the web UI trades the token for a
+// long-lived session whose token is also the device's API token.
+
+const (
+	pairingTTL         = 10 * time.Minute
+	pairDefaultDays    = 90
+	pairMaxDays        = 365
+	pairDeviceNameMax  = 64
+	pairingQRPixels    = 320
+	pairingAccessField = "field"
+	pairingAccessFull  = "full"
+)
+
+type pendingPairing struct {
+	tokenHash string
+	url       string
+	device    string
+	field     bool
+	days      int
+	userID    int64
+	createdBy string
+	expires   time.Time
+}
+
+// currentPairing returns the pairing on offer, dropping it once expired.
+// The caller holds pairMu.
+func (a *App) currentPairing(now time.Time) *pendingPairing {
+	if a.pairing != nil && !now.Before(a.pairing.expires) {
+		a.pairing = nil
+	}
+	return a.pairing
+}
+
+// pairingURL is the address the kiosk console shows as a QR code while a
+// pairing is on offer, or "".
+func (a *App) pairingURL() string {
+	a.pairMu.Lock()
+	defer a.pairMu.Unlock()
+	if p := a.currentPairing(time.Now()); p != nil {
+		return p.url
+	}
+	return ""
+}
+
+type pairingStartRequest struct {
+	Device string `json:"device"`
+	Access string `json:"access"` // field (default) or full
+	Days   int    `json:"days"`
+}
+
+// handlePairingStart offers a new pairing, replacing any earlier one. The
+// device gets field-mode access unless full access is asked for.
+func (a *App) handlePairingStart(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req pairingStartRequest
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	req.Device = strings.TrimSpace(req.Device)
+	if req.Device == "" || len(req.Device) > pairDeviceNameMax {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "device must be 1-64 characters"})
+		return
+	}
+	switch req.Access {
+	case "":
+		req.Access = pairingAccessField
+	case pairingAccessField, pairingAccessFull:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "access must be field or full"})
+		return
+	}
+	if req.Days == 0 {
+		req.Days = pairDefaultDays
+	}
+	if req.Days < 1 || req.Days > pairMaxDays {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "days must be 1-365"})
+		return
+	}
+	urls := lanURLs(a.scheme())
+	if len(urls) == 0 {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "the web UI only listens on this device, so a phone cannot reach it"})
+		return
+	}
+
+	token, err := security.NewSessionToken()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create pairing"})
+		return
+	}
+	p := &pendingPairing{
+		tokenHash: security.TokenHash(token),
+		url:       urls[0] + "?pair=" + url.QueryEscape(token),
+		device:    req.Device,
+		field:     req.Access == pairingAccessField,
+		days:      req.Days,
+		userID:    authCtx.UserID,
+		createdBy: authCtx.Username,
+		expires:   time.Now().Add(pairingTTL),
+	}
+	a.pairMu.Lock()
+	a.pairing = p
+	a.pairMu.Unlock()
+
+	_ = a.audit.Log(r.Context(), authCtx.Username, "pairing_started", map[string]any{
+		"device": p.device,
+		"access": req.Access,
+		"days":   p.days,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"url":        p.url,
+		"qr_url":     "/api/pairing/qr",
+		"device":     p.device,
+		"access":     req.Access,
+		"expires_at": p.expires.UTC().Format(time.RFC3339),
+	})
+}
+
+func (a *App) handlePairingCancel(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	a.pairMu.Lock()
+	a.pairing = nil
+	a.pairMu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// handlePairingQR draws the pairing on offer as an SVG QR code.
+func (a *App) handlePairingQR(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	link := a.pairingURL()
+	if link == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no pairing is on offer"})
+		return
+	}
+	code, err := qr.Encode(link)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(code.SVG(pairingQRPixels))
+}
+
+type pairRequest struct {
+	Token string `json:"token"`
+}
+
+// handlePair redeems a pairing token. It works once: the session cookie
+// logs the browser in, and the same token is returned for API use.
+func (a *App) handlePair(w http.ResponseWriter, r *http.Request) {
+	var req pairRequest
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	hash := security.TokenHash(strings.TrimSpace(req.Token))
+
+	a.pairMu.Lock()
+	p := a.currentPairing(time.Now())
+	if p == nil || subtle.ConstantTimeCompare([]byte(hash), []byte(p.tokenHash)) != 1 {
+		a.pairMu.Unlock()
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "pairing code is invalid or expired"})
+		return
+	}
+	a.pairing = nil
+	a.pairMu.Unlock()
+
+	token, err := security.NewSessionToken()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create session"})
+		return
+	}
+	expires := time.Now().UTC().Add(time.Duration(p.days) * 24 * time.Hour)
+	if err := a.store.CreateDeviceSession(r.Context(), security.TokenHash(token), p.userID, expires, p.device, p.field); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create session"})
+		return
+	}
+	a.setSessionCookie(w, token, expires)
+
+	access := pairingAccessFull
+	if p.field {
+		access = pairingAccessField
+	}
+	_ = a.audit.Log(r.Context(), p.createdBy, "device_paired", map[string]any{
+		"device": p.device,
+		"access": access,
+		"ip":     clientIP(r),
+	})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ok":         true,
+		"device":     p.device,
+		"access":     access,
+		"api_token":  token,
+		"expires_at": expires.Format(time.RFC3339),
+	})
+}
+
+func (a *App) handleDevicesList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	devices, err := a.store.ListDeviceSessions(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": devices})
+}
+
+func (a *App) handleDeviceRevoke(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	device, err := a.store.DeleteDeviceSession(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "revoke failed"})
+		return
+	}
+	if device == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "device not found"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "device_revoked", map[string]any{"device": device})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
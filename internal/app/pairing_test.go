@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/security"
+)
+
+func TestPairingMintsOneDeviceToken(t *testing.T) {
+	t.Setenv("USBVAULT_BIND", "192.168.1.20")
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	hash, salt, err := security.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminID, err := store.CreateUser(ctx, "admin", hash, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	admin := &AuthContext{UserID: adminID, Username: "admin", Role: db.RoleAdmin}
+
+	rr := httptest.NewRecorder()
+	app.handlePairingStart(rr, httptest.NewRequest(http.MethodPost, "/api/pairing", strings.NewReader(`{"device":"Truck 2 phone"}`)), admin)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("start = %d: %s", rr.Code, rr.Body.String())
+	}
+	var started struct {
+		URL    string `json:"url"`
+		Access string `json:"access"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&started); err != nil {
+		t.Fatal(err)
+	}
+	link, err := url.Parse(started.URL)
+	if err != nil || link.Host != "192.168.1.20:4987" || started.Access != "field" {
+		t.Fatalf("pairing url = %q, access %q", started.URL, started.Access)
+	}
+	token := link.Query().Get("pair")
+
+	qrRR := httptest.NewRecorder()
+	app.handlePairingQR(qrRR, httptest.NewRequest(http.MethodGet, "/api/pairing/qr", nil), admin)
+	if qrRR.Code != http.StatusOK || !strings.HasPrefix(qrRR.Body.String(), "<svg") {
+		t.Fatalf("qr = %d: %.60s", qrRR.Code, qrRR.Body.String())
+	}
+
+	pair := func(token string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		body, _ := json.Marshal(pairRequest{Token: token})
+		app.handlePair(rr, httptest.NewRequest(http.MethodPost, "/api/pair", strings.NewReader(string(body))))
+		return rr
+	}
+	if rr := pair("not-the-token"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token = %d", rr.Code)
+	}
+	rr = pair(token)
+	if rr.Code != http.StatusOK || len(rr.Result().Cookies()) != 1 {
+		t.Fatalf("pair = %d: %s", rr.Code, rr.Body.String())
+	}
+	var paired struct {
+		APIToken string `json:"api_token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&paired); err != nil || paired.APIToken == "" {
+		t.Fatalf("no api token: %v", err)
+	}
+	if rr := pair(token); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("second use of the token = %d", rr.Code)
+	}
+
+	call := func(pattern string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Pattern = pattern
+		req.Header.Set("Authorization", "Bearer "+paired.APIToken)
+		rr := httptest.NewRecorder()
+		app.withAuth(func(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+			if authCtx.Device != "Truck 2 phone" {
+				t.Errorf("device = %q", authCtx.Device)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})(rr, req)
+		return rr.Code
+	}
+	if code := call("GET /api/ingest-status"); code != http.StatusNoContent {
+		t.Fatalf("field device on ingest status = %d", code)
+	}
+	if code := call("GET /api/media"); code != http.StatusForbidden {
+		t.Fatalf("field device on media = %d, want 403", code)
+	}
+
+	// Turning field mode off leaves paired devices signed in.
+	if _, err := store.DeleteFieldSessions(ctx); err != nil {
+		t.Fatal(err)
+	}
+	devices, err := store.ListDeviceSessions(ctx)
+	if err != nil || len(devices) != 1 {
+		t.Fatalf("devices = %v, %v", devices, err)
+	}
+
+	revoke := httptest.NewRequest(http.MethodDelete, "/api/devices/"+devices[0].ID, nil)
+	revoke.SetPathValue("id", devices[0].ID)
+	rr = httptest.NewRecorder()
+	app.handleDeviceRevoke(rr, revoke, admin)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("revoke = %d: %s", rr.Code, rr.Body.String())
+	}
+	if code := call("GET /api/ingest-status"); code != http.StatusUnauthorized {
+		t.Fatalf("revoked device = %d, want 401", code)
+	}
+}
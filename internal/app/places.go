@@ -0,0 +1,195 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+// Named places are areas such as home or a job site, drawn as a circle or
+// a polygon. Media positioned inside one are tagged with it at ingest, and
+// the place_match job tags the rest: media positioned later, and those in
+// a place that was added or redrawn.
+
+const (
+	placeNameMax       = 64
+	placeRadiusMax     = 50000 // meters
+	placePolygonMax    = 500
+	placeBodyLimit     = 1 << 16
+	placeMatchInterval = 15 * time.Minute
+)
+
+type placeRequest struct {
+	Name    string       `json:"name"`
+	Lat     *float64     `json:"lat"`
+	Lon     *float64     `json:"lon"`
+	RadiusM float64      `json:"radius_m"`
+	Polygon [][2]float64 `json:"polygon"`
+}
+
+func validLatLon(lat, lon float64) bool {
+	return !math.IsNaN(lat) && !math.IsNaN(lon) && lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// place validates req and returns the place it describes.
+func (req placeRequest) place() (db.Place, string) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > placeNameMax {
+		return db.Place{}, "name must be 1-64 characters"
+	}
+	if len(req.Polygon) > 0 {
+		if req.Lat != nil || req.Lon != nil || req.RadiusM != 0 {
+			return db.Place{}, "give lat, lon and radius_m, or polygon, not both"
+		}
+		if len(req.Polygon) < 3 || len(req.Polygon) > placePolygonMax {
+			return db.Place{}, "polygon must have 3-500 corners"
+		}
+		p := db.Place{Name: name, Polygon: req.Polygon}
+		minLon, maxLon := 180.0, -180.0
+		for _, c := range req.Polygon {
+			if !validLatLon(c[0], c[1]) {
+				return db.Place{}, "polygon corners must be [lat, lon] within -90..90 and -180..180"
+			}
+			p.Lat += c[0] / float64(len(req.Polygon))
+			p.Lon += c[1] / float64(len(req.Polygon))
+			minLon, maxLon = math.Min(minLon, c[1]), math.Max(maxLon, c[1])
+		}
+		if maxLon-minLon > 180 {
+			return db.Place{}, "polygon must not cross the antimeridian"
+		}
+		return p, ""
+	}
+	if req.Lat == nil || req.Lon == nil || !validLatLon(*req.Lat, *req.Lon) {
+		return db.Place{}, "lat must be within -90..90 and lon within -180..180"
+	}
+	if math.IsNaN(req.RadiusM) || req.RadiusM < 1 || req.RadiusM > placeRadiusMax {
+		return db.Place{}, "radius_m must be 1-50000"
+	}
+	return db.Place{Name: name, Lat: *req.Lat, Lon: *req.Lon, RadiusM: req.RadiusM}, ""
+}
+
+func (a *App) handlePlacesList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	items, err := a.store.ListPlaces(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// handlePlaceCreate saves a place and tags the media already inside it.
+func (a *App) handlePlaceCreate(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req placeRequest
+	if err := decodeJSONBody(r, &req, placeBodyLimit); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	p, msg := req.place()
+	if msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+	ctx := r.Context()
+	err := a.store.CreatePlace(ctx, &p)
+	if errors.Is(err, db.ErrPlaceNameTaken) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save place"})
+		return
+	}
+	if p.ItemCount, err = a.store.MatchPlace(ctx, p.ID); err != nil {
+		a.logger.Printf("place %q: %v", p.Name, err)
+	}
+	_ = a.audit.Log(ctx, authCtx.Username, "place_created", map[string]any{"id": p.ID, "name": p.Name, "items": p.ItemCount})
+	writeJSON(w, http.StatusCreated, p)
+}
+
+// handlePlaceUpdate replaces a place's name and shape and tags its media
+// again.
+func (a *App) handlePlaceUpdate(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid place id"})
+		return
+	}
+	var req placeRequest
+	if err := decodeJSONBody(r, &req, placeBodyLimit); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	p, msg := req.place()
+	if msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+	p.ID = id
+	ctx := r.Context()
+	found, err := a.store.UpdatePlace(ctx, p)
+	if errors.Is(err, db.ErrPlaceNameTaken) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save place"})
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "place not found"})
+		return
+	}
+	if _, err := a.store.MatchPlace(ctx, id); err != nil {
+		a.logger.Printf("place %q: %v", p.Name, err)
+	}
+	updated, err := a.store.GetPlace(ctx, id)
+	if err != nil || updated == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	_ = a.audit.Log(ctx, authCtx.Username, "place_updated", map[string]any{"id": id, "name": updated.Name, "items": updated.ItemCount})
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (a *App) handlePlaceDelete(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid place id"})
+		return
+	}
+	name, err := a.store.DeletePlace(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "delete failed"})
+		return
+	}
+	if name == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "place not found"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "place_deleted", map[string]any{"id": id, "name": name})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// matchPlaces is the place_match job: it tags every place again, picking
+// up media positioned since ingest, by GPX tracks or by hand.
+func (a *App) matchPlaces(ctx context.Context) error {
+	ids, err := a.store.ListPlaceIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := a.store.MatchPlace(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
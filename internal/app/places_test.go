@@ -0,0 +1,136 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestPlacesTagMediaInside(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	admin := &AuthContext{UserID: 1, Username: "admin", Role: db.RoleAdmin}
+
+	insert := func(n int, lat, lon float64) int64 {
+		t.Helper()
+		rec := &db.MediaRecord{
+			Kind: "image", FileName: fmt.Sprintf("IMG_%04d.JPG", n), Extension: ".jpg",
+			SourceMount: "/Volumes/CARD", SourcePath: fmt.Sprintf("/DCIM/IMG_%04d.JPG", n),
+			DestPath: fmt.Sprintf("/lib/IMG_%04d.JPG", n), SizeBytes: 1, CRC32: "00000000",
+			SHA256: fmt.Sprintf("%064x", n), CaptureTime: "2026-05-01T10:00:00Z", Metadata: "{}",
+			SourceMTime: "2026-05-01T10:00:00Z", IngestedAt: "2026-05-01T10:00:00Z",
+			GPSLat: sql.NullFloat64{Float64: lat, Valid: true}, GPSLon: sql.NullFloat64{Float64: lon, Valid: true},
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+		return rec.ID
+	}
+	call := func(h func(http.ResponseWriter, *http.Request, *AuthContext), method, target, id, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if id != "" {
+			req.SetPathValue("id", id)
+		}
+		rr := httptest.NewRecorder()
+		h(rr, req, admin)
+		return rr
+	}
+	inPlace := func(id int64) []int64 {
+		t.Helper()
+		recs, err := store.ListMediaFiltered(ctx, "id", "asc", 100, 0, db.MediaFilter{PlaceID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, r := range recs {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+
+	// Two roads of the ranch, and the neighbor's yard.
+	barn := insert(1, 44.5000, -93.2500)
+	field := insert(2, 44.5030, -93.2460)
+	neighbor := insert(3, 44.5200, -93.2500)
+
+	for _, body := range []string{
+		`{"name":"","lat":44.5,"lon":-93.25,"radius_m":500}`,
+		`{"name":"Ranch","lat":44.5,"lon":-93.25}`,
+		`{"name":"Ranch","lat":44.5,"lon":-93.25,"radius_m":60000}`,
+		`{"name":"Ranch","polygon":[[44.5,-93.25],[44.6,-93.25]]}`,
+		`{"name":"Ranch","lat":44.5,"polygon":[[44.5,-93.25],[44.6,-93.25],[44.6,-93.2]]}`,
+		`{"name":"Ranch","polygon":[[10,170],[11,-170],[12,175]]}`,
+	} {
+		if rr := call(app.handlePlaceCreate, http.MethodPost, "/api/places", "", body); rr.Code != http.StatusBadRequest {
+			t.Fatalf("create %s = %d, want 400", body, rr.Code)
+		}
+	}
+
+	rr := call(app.handlePlaceCreate, http.MethodPost, "/api/places", "", `{"name":"Smith Ranch","lat":44.5,"lon":-93.25,"radius_m":600}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", rr.Code, rr.Body.String())
+	}
+	var ranch db.Place
+	if err := json.Unmarshal(rr.Body.Bytes(), &ranch); err != nil {
+		t.Fatal(err)
+	}
+	if ranch.ItemCount != 2 || fmt.Sprint(inPlace(ranch.ID)) != fmt.Sprint([]int64{barn, field}) {
+		t.Fatalf("circle holds %d: %v", ranch.ItemCount, inPlace(ranch.ID))
+	}
+	if rr := call(app.handlePlaceCreate, http.MethodPost, "/api/places", "", `{"name":"smith ranch","lat":1,"lon":1,"radius_m":10}`); rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate name = %d, want 409", rr.Code)
+	}
+
+	// Redrawn as a polygon that takes in the neighbor but not the barn.
+	id := fmt.Sprint(ranch.ID)
+	rr = call(app.handlePlaceUpdate, http.MethodPost, "/api/places/"+id, id,
+		`{"name":"Smith Ranch","polygon":[[44.501,-93.26],[44.53,-93.26],[44.53,-93.24],[44.501,-93.24]]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("update = %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := inPlace(ranch.ID); fmt.Sprint(got) != fmt.Sprint([]int64{field, neighbor}) {
+		t.Fatalf("polygon holds %v", got)
+	}
+
+	// Ingest tags new media; the job picks up media positioned later.
+	later := insert(4, 44.52, -93.25)
+	if err := store.MatchMediaPlaces(ctx, barn, 44.5, -93.25); err != nil {
+		t.Fatal(err)
+	}
+	if got := inPlace(ranch.ID); len(got) != 2 {
+		t.Fatalf("barn tagged outside the polygon: %v", got)
+	}
+	if err := app.matchPlaces(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := inPlace(ranch.ID); fmt.Sprint(got) != fmt.Sprint([]int64{field, neighbor, later}) {
+		t.Fatalf("after the job: %v", got)
+	}
+
+	if rr := call(app.handlePlaceDelete, http.MethodDelete, "/api/places/"+id, id, ""); rr.Code != http.StatusOK {
+		t.Fatalf("delete = %d", rr.Code)
+	}
+	if got := inPlace(ranch.ID); len(got) != 0 {
+		t.Fatalf("media still tagged after delete: %v", got)
+	}
+	if rr := call(app.handlePlaceDelete, http.MethodDelete, "/api/places/"+id, id, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("second delete = %d, want 404", rr.Code)
+	}
+}
@@ -0,0 +1,234 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/hooks"
+	"businessplan/usbvault/internal/power"
+)
+
+// powerPollInterval is how often the power state is read and the vault
+// checked for idleness.
+const powerPollInterval = 30 * time.Second
+
+func (a *App) powerSettings(ctx context.Context) (power.Settings, error) {
+	raw, _, err := a.store.GetSetting(ctx, power.SettingKey)
+	if err != nil {
+		return power.Default(), err
+	}
+	return power.Parse(raw)
+}
+
+func (a *App) currentPowerProfile() power.Profile {
+	a.powerMu.Lock()
+	defer a.powerMu.Unlock()
+	return a.powerProfile
+}
+
+// usbScanInterval is the card polling interval: the power profile's, or
+// USBVAULT_SCAN_INTERVAL_SECONDS when the profile leaves it alone.
+func (a *App) usbScanInterval() time.Duration {
+	if s := a.currentPowerProfile().USBScanSeconds; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return time.Duration(config.USBScanIntervalSeconds()) * time.Second
+}
+
+// powerJobsPaused says why background jobs may not run on the current
+// power, or "".
+func (a *App) powerJobsPaused() string {
+	a.powerMu.Lock()
+	defer a.powerMu.Unlock()
+	if a.powerProfile.BackgroundJobs {
+		return ""
+	}
+	return "background jobs are paused on " + a.powerReading.State + " power"
+}
+
+// powerAllowsBackup says why the power profile keeps a backup from starting
+// now, or returns nil.
+func (a *App) powerAllowsBackup() error {
+	a.powerMu.Lock()
+	defer a.powerMu.Unlock()
+	if ok, why := a.powerProfile.BackupAllowed(time.Now()); !ok {
+		return fmt.Errorf("%s on %s power", why, a.powerReading.State)
+	}
+	return nil
+}
+
+// isStatusPoll reports requests that screens and apps repeat on a timer,
+// which do not mean anyone is using the vault.
+func isStatusPoll(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	return strings.HasPrefix(r.URL.Path, "/api/kiosk/") || strings.HasSuffix(r.URL.Path, "-status") || r.URL.Path == "/api/power"
+}
+
+func (a *App) powerWorker(ctx context.Context) {
+	ticker := time.NewTicker(powerPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.updatePower(ctx)
+		}
+	}
+}
+
+// updatePower reads the power state, switches to its profile, and fires
+// the power-idle hook once the vault has been idle for the profile's
+// suspend_after_idle_minutes. A failed reading keeps the last state, so a
+// flaky sensor does not flip profiles.
+func (a *App) updatePower(ctx context.Context) {
+	settings, err := a.powerSettings(ctx)
+	if err != nil {
+		a.logger.Printf("power settings ignored, using defaults: %v", err)
+		settings = power.Default()
+	}
+	reading, readErr := power.Read(ctx, settings)
+	idle := a.workReason() == "" && len(a.scheduler.GetStatus().Running) == 0 &&
+		!a.publishBusy.Load() && !a.benchBusy.Load()
+	lastRequest := time.Unix(0, a.lastRequest.Load())
+	now := time.Now()
+
+	a.powerMu.Lock()
+	if readErr != nil {
+		if a.powerErr != readErr.Error() {
+			a.logger.Printf("power state unreadable, staying on %s: %v", a.powerReading.State, readErr)
+		}
+		a.powerErr = readErr.Error()
+		reading = a.powerReading
+	} else {
+		a.powerErr = ""
+	}
+	from := a.powerReading.State
+	changed := reading.State != from
+	profile := settings.Profiles[reading.State]
+	profileChanged := profile != a.powerProfile
+	a.powerReading, a.powerProfile = reading, profile
+	if changed || a.powerSince.IsZero() {
+		a.powerSince = now
+	}
+	// A long gap between polls means the machine was asleep; idleness
+	// counts again from the wake-up.
+	if !a.powerPolled.IsZero() && now.Sub(a.powerPolled) > 3*powerPollInterval {
+		a.idleSince, a.idleFired = time.Time{}, false
+	}
+	a.powerPolled = now
+	fire := false
+	var idleFor time.Duration
+	if !idle || now.Sub(lastRequest) < powerPollInterval || profile.SuspendAfterIdleMinutes == 0 {
+		a.idleSince, a.idleFired = time.Time{}, false
+	} else {
+		if a.idleSince.IsZero() {
+			a.idleSince = now
+		}
+		idleFor = now.Sub(a.idleSince)
+		if !a.idleFired && idleFor >= time.Duration(profile.SuspendAfterIdleMinutes)*time.Minute {
+			a.idleFired, fire = true, true
+		}
+	}
+	a.powerMu.Unlock()
+
+	if profileChanged {
+		a.applyRuntimeConfig()
+		a.loadResourceBudget(ctx)
+	}
+	if changed {
+		a.logger.Printf("power state %s -> %s (%s)", from, reading.State, reading.Detail)
+		_ = a.audit.Log(ctx, "system", "power_state_changed", map[string]any{
+			"from":           from,
+			"to":             reading.State,
+			"charge_percent": reading.ChargePercent,
+			"detail":         reading.Detail,
+		})
+	}
+	if fire {
+		payload := map[string]any{
+			"state":          reading.State,
+			"charge_percent": reading.ChargePercent,
+			"idle_minutes":   int(idleFor / time.Minute),
+		}
+		_ = a.audit.Log(ctx, "system", "power_idle", payload)
+		a.hooks.Fire(hooks.EventPowerIdle, payload)
+	}
+}
+
+type powerView struct {
+	Settings  power.Settings `json:"settings"`
+	Reading   power.Reading  `json:"reading"`
+	Profile   power.Profile  `json:"profile"`
+	Since     string         `json:"since"`
+	Error     string         `json:"error,omitempty"`
+	IdleSince string         `json:"idle_since,omitempty"`
+}
+
+func (a *App) powerView(ctx context.Context) (powerView, error) {
+	settings, err := a.powerSettings(ctx)
+	if err != nil {
+		return powerView{}, err
+	}
+	a.powerMu.Lock()
+	defer a.powerMu.Unlock()
+	view := powerView{
+		Settings: settings,
+		Reading:  a.powerReading,
+		Profile:  a.powerProfile,
+		Since:    a.powerSince.UTC().Format(time.RFC3339),
+		Error:    a.powerErr,
+	}
+	if !a.idleSince.IsZero() {
+		view.IdleSince = a.idleSince.UTC().Format(time.RFC3339)
+	}
+	return view, nil
+}
+
+func (a *App) handlePowerGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	view, err := a.powerView(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read power settings: " + err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+// handlePowerSet stores the power settings and applies them at once.
+// Profiles left out keep their defaults.
+func (a *App) handlePowerSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req power.Settings
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	settings, err := req.Normalize()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	raw, _ := json.Marshal(settings)
+	if err := a.store.SetSetting(r.Context(), power.SettingKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update power settings"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "power_settings_updated", map[string]any{
+		"source": settings.Source,
+		"state":  settings.State,
+	})
+	a.updatePower(r.Context())
+	view, err := a.powerView(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, view)
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/backup"
+	"businessplan/usbvault/internal/budget"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/hooks"
+	"businessplan/usbvault/internal/ingest"
+	"businessplan/usbvault/internal/power"
+	"businessplan/usbvault/internal/scheduler"
+	"businessplan/usbvault/internal/usb"
+)
+
+func TestPowerProfileFollowsStateAndFiresIdleHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell hooks are not portable to windows")
+	}
+	dir := t.TempDir()
+	t.Setenv("USBVAULT_DATA_DIR", filepath.Join(dir, "data"))
+	store, err := db.Open(filepath.Join(dir, "usbvault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	hookDir := filepath.Join(dir, "hooks")
+	marker := filepath.Join(dir, "suspended")
+	if err := os.MkdirAll(hookDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hookDir, hooks.EventPowerIdle), []byte("#!/bin/sh\ncat > '"+marker+"'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	aud := audit.New(store)
+	runner := hooks.New(hookDir, 5*time.Second, logger)
+	a := &App{
+		store: store, audit: aud, logger: logger, hooks: runner,
+		ingestor:     ingest.NewManager(store, aud, nil, runner, logger),
+		backuper:     backup.NewManager(store, runner, logger),
+		thumbLimiter: budget.NewLimiter(4),
+		powerReading: power.Reading{State: power.StateMains, ChargePercent: -1},
+		powerProfile: power.DefaultProfiles()[power.StateMains],
+	}
+	a.scheduler = scheduler.New(logger, a.busyReason)
+	a.watcher = usb.NewWatcher(5*time.Second, logger, nil)
+	a.logLevel.Store("info")
+	ctx := context.Background()
+
+	if err := a.powerAllowsBackup(); err != nil || a.busyReason() != "" {
+		t.Fatalf("on mains: backup %v, busy %q", err, a.busyReason())
+	}
+
+	if err := store.SetSetting(ctx, power.SettingKey, `{"source": "manual", "state": "critical"}`); err != nil {
+		t.Fatal(err)
+	}
+	a.updatePower(ctx)
+	if got := a.usbScanInterval(); got != time.Minute {
+		t.Fatalf("scan interval on critical power = %s", got)
+	}
+	if err := a.powerAllowsBackup(); err == nil || err.Error() != "backups are off on critical power" {
+		t.Fatalf("backup on critical power = %v", err)
+	}
+	if reason := a.busyReason(); !strings.Contains(reason, "paused on critical power") {
+		t.Fatalf("busy reason = %q", reason)
+	}
+
+	// Idle long enough: the hook runs once for this idle stretch.
+	a.powerMu.Lock()
+	a.idleSince = time.Now().Add(-16 * time.Minute)
+	a.powerMu.Unlock()
+	a.updatePower(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	var payload []byte
+	for time.Now().Before(deadline) {
+		if payload, err = os.ReadFile(marker); strings.Contains(string(payload), `"state":"critical"`) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !strings.Contains(string(payload), `"state":"critical"`) {
+		t.Fatalf("power-idle payload = %q, %v", payload, err)
+	}
+	if !a.idleFired {
+		t.Fatal("idle hook not recorded as fired")
+	}
+
+	if err := store.SetSetting(ctx, power.SettingKey, `{"source": "manual", "state": "mains"}`); err != nil {
+		t.Fatal(err)
+	}
+	a.updatePower(ctx)
+	if a.powerAllowsBackup() != nil || a.busyReason() != "" || a.idleFired {
+		t.Fatal("back on mains, the vault is still held back")
+	}
+}
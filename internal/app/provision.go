@@ -0,0 +1,222 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/provision"
+)
+
+// First-boot provisioning serves the setup flow beyond loopback until an
+// admin account exists: on the wired address when a cable is plugged in,
+// otherwise on a Wi-Fi access point the vault brings up. Remote setup also
+// needs a one-time code shown on the kiosk console and in the log.
+
+// maxSetupCodeAttempts bounds guessing: after this many wrong codes remote
+// setup is refused until the server restarts.
+const maxSetupCodeAttempts = 10
+
+const provisionRequestKey contextKey = "provision"
+
+type provisioner struct {
+	mu         sync.Mutex
+	code       string
+	failures   int
+	ssid       string // access point, empty on Ethernet
+	passphrase string
+	urls       []string
+	servers    []*http.Server
+}
+
+// provisionRoute reports whether r is one of the few routes a provisioning
+// listener serves: the web UI and what its setup form calls.
+func provisionRoute(r *http.Request) bool {
+	switch {
+	case r.Method == http.MethodGet && (r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/web/")):
+		return true
+	case r.Method == http.MethodGet && r.URL.Path == "/api/status":
+		return true
+	case r.Method == http.MethodPost && r.URL.Path == "/api/setup":
+		return true
+	}
+	return false
+}
+
+// startProvisioning opens the provisioning listeners when provisioning is
+// on and setup has not been completed.
+func (a *App) startProvisioning(ctx context.Context, handler http.Handler) error {
+	if !config.ProvisioningEnabled() {
+		return nil
+	}
+	hasUsers, err := a.store.HasUsers(ctx)
+	if err != nil || hasUsers {
+		return err
+	}
+
+	p := &provisioner{code: config.SetupCode()}
+	if p.code == "" {
+		if p.code, err = randomDigits(6); err != nil {
+			return err
+		}
+	}
+	addrs, err := provision.EthernetAddrs()
+	if err != nil {
+		return fmt.Errorf("provisioning: %w", err)
+	}
+	if len(addrs) == 0 {
+		p.ssid, p.passphrase = config.ProvisionSSID(), config.ProvisionPassphrase()
+		if p.passphrase == "" {
+			if p.passphrase, err = randomDigits(10); err != nil {
+				return err
+			}
+		} else if err := provision.ValidatePassphrase(p.passphrase); err != nil {
+			return fmt.Errorf("USBVAULT_PROVISION_PASSPHRASE %w", err)
+		}
+		addr, err := provision.StartHotspot(ctx, config.ProvisionInterface(), p.ssid, p.passphrase)
+		if err != nil {
+			return fmt.Errorf("provisioning access point: %w", err)
+		}
+		addrs = []netip.Addr{addr}
+		a.logger.Printf("provisioning: Wi-Fi access point %q is up, passphrase %s", p.ssid, p.passphrase)
+	}
+
+	wrapped := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !provisionRoute(r) {
+			http.NotFound(w, r)
+			return
+		}
+		next := r.WithContext(context.WithValue(r.Context(), provisionRequestKey, true))
+		handler.ServeHTTP(w, next)
+	})
+	port := strconv.Itoa(config.Port())
+	for _, addr := range addrs {
+		hostPort := net.JoinHostPort(addr.String(), port)
+		srv := &http.Server{
+			Addr:              hostPort,
+			Handler:           wrapped,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			TLSConfig:         a.tlsConfig,
+		}
+		go func() {
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				a.logger.Printf("provisioning listener %s: %v", hostPort, err)
+			}
+		}()
+		p.servers = append(p.servers, srv)
+		p.urls = append(p.urls, a.scheme()+"://"+hostPort+"/")
+	}
+	a.logger.Printf("provisioning: finish setup at %s with setup code %s", strings.Join(p.urls, ", "), p.code)
+
+	a.provMu.Lock()
+	a.prov = p
+	a.provMu.Unlock()
+	go func() {
+		<-ctx.Done()
+		a.stopProvisioning(context.Background(), nil)
+	}()
+	return nil
+}
+
+func isProvisionRequest(r *http.Request) bool {
+	v, _ := r.Context().Value(provisionRequestKey).(bool)
+	return v
+}
+
+// checkSetupCode reports whether code matches, counting failures.
+func (a *App) checkSetupCode(code string) error {
+	a.provMu.Lock()
+	p := a.prov
+	a.provMu.Unlock()
+	if p == nil {
+		return errSetupRemote
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures >= maxSetupCodeAttempts {
+		return errors.New("too many wrong setup codes; restart the vault to try again")
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(code)), []byte(p.code)) != 1 {
+		p.failures++
+		return errors.New("invalid setup code")
+	}
+	return nil
+}
+
+// stopProvisioning closes the provisioning listeners, takes the access point
+// down, and joins wifi if set. It runs after setup has answered, so the
+// client sees the result before the network goes away.
+func (a *App) stopProvisioning(ctx context.Context, wifi *provision.WiFi) {
+	a.provMu.Lock()
+	p := a.prov
+	a.prov = nil
+	a.provMu.Unlock()
+	if p != nil {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		for _, srv := range p.servers {
+			_ = srv.Shutdown(shutdownCtx)
+		}
+		cancel()
+		if p.ssid != "" {
+			if err := provision.StopHotspot(ctx); err != nil {
+				a.logger.Printf("provisioning: stop access point: %v", err)
+			}
+		}
+	}
+	if wifi != nil {
+		if err := provision.JoinWiFi(ctx, config.ProvisionInterface(), *wifi); err != nil {
+			a.logger.Printf("provisioning: join Wi-Fi %q: %v", wifi.SSID, err)
+			return
+		}
+		a.logger.Printf("provisioning: joined Wi-Fi %q", wifi.SSID)
+	}
+}
+
+// provisioningStatus is what the kiosk console shows while provisioning
+// runs, or nil.
+func (a *App) provisioningStatus() map[string]any {
+	a.provMu.Lock()
+	p := a.prov
+	a.provMu.Unlock()
+	if p == nil {
+		return nil
+	}
+	return map[string]any{
+		"ssid":       p.ssid,
+		"passphrase": p.passphrase,
+		"setup_code": p.code,
+		"urls":       p.urls,
+	}
+}
+
+func randomDigits(n int) (string, error) {
+	var b strings.Builder
+	for range n {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(byte('0' + d.Int64()))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestProvisioningSetupNeedsCode(t *testing.T) {
+	rootDir := t.TempDir()
+	store, err := db.Open(filepath.Join(rootDir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	app := &App{
+		store:  store,
+		audit:  audit.New(store),
+		logger: log.New(io.Discard, "", 0),
+		prov:   &provisioner{code: "482913"},
+	}
+	setup := func(code string, viaProvisioning bool) *httptest.ResponseRecorder {
+		body := `{"username":"admin","password":"correct horse battery","base_storage_dir":"` +
+			filepath.ToSlash(filepath.Join(rootDir, "library")) + `","setup_code":"` + code + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/setup", strings.NewReader(body))
+		req.RemoteAddr = "10.42.0.23:50000"
+		if viaProvisioning {
+			req = req.WithContext(context.WithValue(req.Context(), provisionRequestKey, true))
+		}
+		rr := httptest.NewRecorder()
+		app.handleSetup(rr, req)
+		return rr
+	}
+
+	// The main listener still refuses remote setup.
+	if rr := setup("482913", false); rr.Code != http.StatusForbidden {
+		t.Fatalf("remote setup status = %d, want 403", rr.Code)
+	}
+	if rr := setup("000000", true); rr.Code != http.StatusForbidden {
+		t.Fatalf("wrong code status = %d, want 403", rr.Code)
+	}
+	if rr := setup("482913", true); rr.Code != http.StatusCreated {
+		t.Fatalf("setup status = %d: %s", rr.Code, rr.Body.String())
+	}
+	hasUsers, err := store.HasUsers(context.Background())
+	if err != nil || !hasUsers {
+		t.Fatalf("HasUsers = %v, %v", hasUsers, err)
+	}
+}
+
+func TestSetupCodeLocksOutAfterRepeatedFailures(t *testing.T) {
+	t.Parallel()
+
+	app := &App{prov: &provisioner{code: "482913"}}
+	for range maxSetupCodeAttempts {
+		if err := app.checkSetupCode("111111"); err == nil {
+			t.Fatal("wrong code accepted")
+		}
+	}
+	if err := app.checkSetupCode("482913"); err == nil {
+		t.Fatal("correct code accepted after lockout")
+	}
+}
@@ -0,0 +1,492 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/backup"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/preset"
+	"businessplan/usbvault/internal/publish"
+	"businessplan/usbvault/internal/s3"
+	"businessplan/usbvault/internal/watermark"
+)
+
+// publishFilesDir holds the album's files at a destination, so a file
+// named index.html cannot replace the gallery page.
+const publishFilesDir = "files/"
+
+var errPublishBusy = errors.New("an album is already being published")
+
+type publishTargetRequest struct {
+	ID          int64   `json:"id"`
+	AlbumID     int64   `json:"album_id"`
+	Kind        string  `json:"kind"`
+	Destination string  `json:"destination"`
+	Username    string  `json:"username"`
+	Secret      *string `json:"secret"`
+	Preset      string  `json:"preset"`
+	StripGPS    bool    `json:"strip_gps"`
+	Enabled     *bool   `json:"enabled"`
+}
+
+type publishTargetView struct {
+	db.PublishTarget
+	AlbumName string `json:"album_name"`
+	SecretSet bool   `json:"secret_set"`
+	Files     int    `json:"files"`
+}
+
+type publishResult struct {
+	Unchanged bool `json:"unchanged"`
+	Uploaded  int  `json:"uploaded"`
+	Deleted   int  `json:"deleted"`
+	Withheld  int  `json:"withheld"`
+	Skipped   int  `json:"skipped"`
+}
+
+// publishDestination opens the folder a target writes to. S3 targets use
+// the credentials set up for S3 backups.
+func (a *App) publishDestination(ctx context.Context, t db.PublishTarget) (publish.Target, error) {
+	switch t.Kind {
+	case "s3":
+		bucket, prefix, err := publish.ParseS3(t.Destination)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := backup.LoadS3Config(ctx, a.store)
+		if err != nil {
+			return nil, err
+		}
+		client, err := s3.New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return publish.NewS3(client, bucket, prefix), nil
+	case "webdav":
+		return publish.NewWebDAV(t.Destination, t.Username, t.Secret, &http.Client{Timeout: 10 * time.Minute})
+	}
+	return nil, fmt.Errorf("unknown publish target kind %q", t.Kind)
+}
+
+// publishName is the name an album item is published under: the name it
+// was published under before, so links to it keep working, or its file name
+// with the id added when another item already has that name.
+func publishName(rec db.MediaRecord, ext, previous string, used map[string]struct{}) string {
+	name := publishFilesDir + sanitizeDownloadFilename(rec.FileName)
+	if ext != "" {
+		name = strings.TrimSuffix(name, path.Ext(name)) + ext
+	}
+	if _, taken := used[strings.ToLower(previous)]; previous != "" && !taken && path.Ext(previous) == path.Ext(name) {
+		name = previous
+	} else if _, taken := used[strings.ToLower(name)]; taken {
+		name = strings.TrimSuffix(name, path.Ext(name)) + "-" + strconv.FormatInt(rec.ID, 10) + path.Ext(name)
+	}
+	used[strings.ToLower(name)] = struct{}{}
+	return name
+}
+
+// publishAlbum brings a target up to date with its album: changed files are
+// sent, files no longer in the album are deleted, and the gallery page is
+// rewritten. An album unchanged since the last successful run is skipped
+// unless force is set. Progress is kept when a run fails part way, so the
+// next one resumes instead of starting over.
+func (a *App) publishAlbum(ctx context.Context, t db.PublishTarget, actor string, force bool) (publishResult, error) {
+	var res publishResult
+	album, err := a.store.GetAlbumByID(ctx, t.AlbumID)
+	if err != nil {
+		return res, err
+	}
+	if album == nil {
+		return res, errors.New("the album no longer exists")
+	}
+	links, err := a.store.ListAlbumMediaLinks(ctx, album.ID)
+	if err != nil {
+		return res, err
+	}
+	ids := make([]int64, 0, len(links))
+	for _, l := range links {
+		ids = append(ids, l.ID)
+	}
+	records, err := a.store.ListMediaByIDs(ctx, ids)
+	if err != nil {
+		return res, err
+	}
+	byID := make(map[int64]db.MediaRecord, len(records))
+	for _, rec := range records {
+		byID[rec.ID] = rec
+	}
+
+	exportPreset := preset.Default()
+	if t.Preset != "" {
+		user, err := a.loadExportPresets(ctx)
+		if err != nil {
+			return res, err
+		}
+		p, ok := preset.Find(user, t.Preset)
+		if !ok {
+			return res, fmt.Errorf("unknown preset %q", t.Preset)
+		}
+		exportPreset = p
+	}
+	// Published files go to people without an account, so any location
+	// policy other than off applies to them as it does to guests.
+	strip := t.StripGPS
+	if p, err := a.loadLocationPrivacy(ctx); err != nil || p.StripGPS != stripGPSOff {
+		strip = true
+	}
+
+	presetJSON, _ := json.Marshal(exportPreset)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%t\x00%s\n", album.Name, presetJSON, strip, t.Destination)
+	for _, id := range ids {
+		if rec, ok := byID[id]; ok {
+			fmt.Fprintf(h, "%d\x00%s\x00%s\n", rec.ID, rec.SHA256, rec.FileName)
+		}
+	}
+	fingerprint := hex.EncodeToString(h.Sum(nil))
+	if !force && t.LastError == "" && fingerprint == t.Fingerprint {
+		res.Unchanged = true
+		return res, nil
+	}
+
+	dest, err := a.publishDestination(ctx, t)
+	if err != nil {
+		return res, err
+	}
+	var mark *watermark.Mark
+	if exportPreset.Proof {
+		if mark, err = watermark.Load(*exportPreset.Watermark, config.WatermarksDir()); err != nil {
+			return res, fmt.Errorf("preset watermark: %w", err)
+		}
+	}
+
+	manifest := t.Manifest
+	previous := make(map[string]string, len(manifest))
+	for name, source := range manifest {
+		sum, _, _ := strings.Cut(source, "|")
+		previous[sum] = name
+	}
+	want := make(map[string]struct{}, len(ids))
+	used := make(map[string]struct{}, len(ids))
+	items := make([]publish.Item, 0, len(ids))
+	sentIDs := make([]int64, 0)
+	save := func(runErr error) error {
+		if err := a.store.RecordPublish(context.WithoutCancel(ctx), t.ID, fingerprint, manifest, runErr); err != nil {
+			a.logger.Printf("publish target %d: %v", t.ID, err)
+		}
+		return runErr
+	}
+	for _, id := range ids {
+		rec, ok := byID[id]
+		if !ok {
+			continue
+		}
+		if rec.Kind == "video" && exportPreset.Videos == preset.VideosSkip {
+			res.Skipped++
+			continue
+		}
+		converts := exportPreset.Converts(rec.Kind, rec.Extension)
+		// A proof must never fall back to a clean original.
+		if exportPreset.Proof && !converts {
+			res.Skipped++
+			continue
+		}
+		ext := ""
+		if converts {
+			ext = exportPreset.Extension()
+		}
+		source := fmt.Sprintf("%s|%s|%t", rec.SHA256, exportPreset.Name, strip)
+		name := publishName(rec, ext, previous[rec.SHA256], used)
+		item := publish.Item{Name: name, Title: rec.FileName, Kind: rec.Kind, Captured: rec.CaptureTime}
+		if manifest[name] == source {
+			want[name] = struct{}{}
+			items = append(items, item)
+			continue
+		}
+
+		body, closeBody, err := a.publishBody(ctx, rec, exportPreset, mark, converts, strip)
+		if errors.Is(err, errLocationKept) {
+			res.Withheld++
+			continue
+		}
+		if err != nil {
+			a.logger.Printf("publish media %d: %v", rec.ID, err)
+			res.Skipped++
+			continue
+		}
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		err = dest.Put(ctx, name, contentType, body)
+		closeBody()
+		if err != nil {
+			delete(manifest, name)
+			return res, save(err)
+		}
+		manifest[name] = source
+		want[name] = struct{}{}
+		items = append(items, item)
+		sentIDs = append(sentIDs, rec.ID)
+		res.Uploaded++
+	}
+
+	for name := range manifest {
+		if _, ok := want[name]; ok {
+			continue
+		}
+		if err := dest.Delete(ctx, name); err != nil {
+			return res, save(err)
+		}
+		delete(manifest, name)
+		res.Deleted++
+	}
+
+	page, index, err := publish.Gallery(album.Name, items, time.Now())
+	if err != nil {
+		return res, save(err)
+	}
+	if err := dest.Put(ctx, "index.html", "text/html; charset=utf-8", bytes.NewReader(page)); err != nil {
+		return res, save(err)
+	}
+	if err := dest.Put(ctx, "album.json", "application/json", bytes.NewReader(index)); err != nil {
+		return res, save(err)
+	}
+	_ = save(nil)
+	_ = a.audit.Log(ctx, actor, "album_published", map[string]any{
+		"album_id":    album.ID,
+		"target_id":   t.ID,
+		"kind":        t.Kind,
+		"destination": t.Destination,
+		"media_ids":   sentIDs,
+		"uploaded":    res.Uploaded,
+		"deleted":     res.Deleted,
+		"withheld":    res.Withheld,
+		"strip_gps":   strip,
+	})
+	return res, nil
+}
+
+// publishBody opens what is sent for one item: the preset's rendering, or
+// the original with its position removed when strip is set.
+func (a *App) publishBody(ctx context.Context, rec db.MediaRecord, p preset.Preset, mark *watermark.Mark, converts, strip bool) (io.ReadSeeker, func(), error) {
+	src, err := a.openMediaFile(ctx, rec.DestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if converts {
+		defer src.Close()
+		var buf bytes.Buffer
+		if err := p.Render(&buf, src, mark); err != nil {
+			return nil, nil, err
+		}
+		return bytes.NewReader(buf.Bytes()), func() {}, nil
+	}
+	closeSrc := func() { _ = src.Close() }
+	if !strip {
+		return src, closeSrc, nil
+	}
+	body, err := withoutLocation(&rec, src)
+	if err != nil {
+		closeSrc()
+		return nil, nil, err
+	}
+	return body, closeSrc, nil
+}
+
+// publishChangedAlbums is the scheduled run: every enabled target whose
+// album changed, or whose last run failed, is published again.
+func (a *App) publishChangedAlbums(ctx context.Context) error {
+	if !a.publishBusy.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer a.publishBusy.Store(false)
+	targets, err := a.store.ListPublishTargets(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		if !t.Enabled {
+			continue
+		}
+		if _, err := a.publishAlbum(ctx, t, "system", false); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			a.logger.Printf("publish album %d to %s: %v", t.AlbumID, t.Destination, err)
+		}
+	}
+	return nil
+}
+
+func (a *App) handlePublishTargetsList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	targets, err := a.store.ListPublishTargets(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	views := make([]publishTargetView, 0, len(targets))
+	for _, t := range targets {
+		views = append(views, a.publishTargetView(r.Context(), t))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"targets": views, "running": a.publishBusy.Load()})
+}
+
+func (a *App) publishTargetView(ctx context.Context, t db.PublishTarget) publishTargetView {
+	view := publishTargetView{PublishTarget: t, SecretSet: t.Secret != "", Files: len(t.Manifest)}
+	if album, err := a.store.GetAlbumByID(ctx, t.AlbumID); err == nil && album != nil {
+		view.AlbumName = album.Name
+	}
+	return view
+}
+
+// handlePublishTargetSave creates a target, or updates the one named by id.
+// A secret left out keeps the stored one.
+func (a *App) handlePublishTargetSave(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req publishTargetRequest
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	ctx := r.Context()
+	t := &db.PublishTarget{Enabled: true, CreatedBy: authCtx.Username}
+	if req.ID != 0 {
+		existing, err := a.store.GetPublishTarget(ctx, req.ID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+			return
+		}
+		if existing == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "publish target not found"})
+			return
+		}
+		t = existing
+	}
+	t.AlbumID = req.AlbumID
+	t.Kind = strings.ToLower(strings.TrimSpace(req.Kind))
+	t.Destination = strings.TrimSpace(req.Destination)
+	t.Username = strings.TrimSpace(req.Username)
+	t.Preset = strings.TrimSpace(req.Preset)
+	t.StripGPS = req.StripGPS
+	if req.Secret != nil {
+		t.Secret = *req.Secret
+	}
+	if req.Enabled != nil {
+		t.Enabled = *req.Enabled
+	}
+
+	album, err := a.store.GetAlbumByID(ctx, t.AlbumID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if album == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "album not found"})
+		return
+	}
+	switch t.Kind {
+	case "s3":
+		_, _, err = publish.ParseS3(t.Destination)
+		if err == nil && (t.Username != "" || t.Secret != "") {
+			err = errors.New("s3 targets use the S3 backup credentials; leave username and secret empty")
+		}
+	case "webdav":
+		_, err = publish.ParseWebDAV(t.Destination)
+	default:
+		err = errors.New("kind must be s3 or webdav")
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if t.Preset != "" {
+		user, err := a.loadExportPresets(ctx)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if _, ok := preset.Find(user, t.Preset); !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown preset " + strconv.Quote(t.Preset)})
+			return
+		}
+	}
+
+	if err := a.store.SavePublishTarget(ctx, t); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save publish target"})
+		return
+	}
+	_ = a.audit.Log(ctx, authCtx.Username, "publish_target_saved", map[string]any{
+		"target_id":   t.ID,
+		"album_id":    t.AlbumID,
+		"kind":        t.Kind,
+		"destination": t.Destination,
+		"preset":      t.Preset,
+		"strip_gps":   t.StripGPS,
+		"enabled":     t.Enabled,
+	})
+	writeJSON(w, http.StatusOK, a.publishTargetView(ctx, *t))
+}
+
+func (a *App) handlePublishTargetDelete(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+	found, err := a.store.DeletePublishTarget(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete publish target"})
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "publish target not found"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "publish_target_deleted", map[string]any{"target_id": id})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// handlePublishTargetRun publishes one target now, whether or not its album
+// changed. It runs in the background; the outcome shows up in the list.
+func (a *App) handlePublishTargetRun(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+	t, err := a.store.GetPublishTarget(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if t == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "publish target not found"})
+		return
+	}
+	if !a.publishBusy.CompareAndSwap(false, true) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": errPublishBusy.Error()})
+		return
+	}
+	go func() {
+		defer a.publishBusy.Store(false)
+		if _, err := a.publishAlbum(context.Background(), *t, authCtx.Username, true); err != nil {
+			a.logger.Printf("publish album %d to %s: %v", t.AlbumID, t.Destination, err)
+		}
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "target_id": t.ID})
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+// davFolder is a WebDAV server that creates folders implicitly.
+type davFolder struct {
+	mu    sync.Mutex
+	files map[string]string
+	puts  int
+}
+
+func (d *davFolder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		d.files[r.URL.Path] = string(body)
+		d.puts++
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		delete(d.files, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (d *davFolder) names() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]string, 0, len(d.files))
+	for name := range d.files {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return strings.Join(out, " ")
+}
+
+func TestPublishAlbumSendsOnlyChanges(t *testing.T) {
+	dir := t.TempDir()
+	store, err := db.Open(filepath.Join(dir, "usbvault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	a := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	ctx := context.Background()
+
+	album, err := store.CreateAlbum(ctx, "Smith wedding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for i, name := range []string{"IMG_0001.png", "IMG_0001.png", "IMG_0002.png"} {
+		path := filepath.Join(dir, fmt.Sprintf("%d-%s", i, name))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("image %d", i)), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		rec := &db.MediaRecord{
+			Kind: "image", FileName: name, Extension: ".png", SourcePath: path, DestPath: path,
+			SHA256: fmt.Sprintf("%064x", i+1), CaptureTime: "2026-05-02T15:04:05Z", Metadata: "{}",
+			IngestedAt: "2026-05-03T00:00:00Z",
+		}
+		if i == 2 {
+			rec.GPSLat = sql.NullFloat64{Float64: 39.7, Valid: true}
+			rec.GPSLon = sql.NullFloat64{Float64: -104.9, Valid: true}
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, rec.ID)
+	}
+	if _, _, err := store.AddMediaToAlbum(ctx, album.ID, ids); err != nil {
+		t.Fatal(err)
+	}
+
+	dav := &davFolder{files: map[string]string{}}
+	srv := httptest.NewServer(dav)
+	defer srv.Close()
+	target := &db.PublishTarget{AlbumID: album.ID, Kind: "webdav", Destination: srv.URL + "/smith", Enabled: true, CreatedBy: "admin"}
+	if err := store.SavePublishTarget(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	run := func(force bool) publishResult {
+		t.Helper()
+		saved, err := store.GetPublishTarget(ctx, target.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := a.publishAlbum(ctx, *saved, "admin", force)
+		if err != nil {
+			t.Fatalf("publishAlbum: %v", err)
+		}
+		return res
+	}
+
+	if res := run(false); res.Uploaded != 3 {
+		t.Fatalf("first run = %+v", res)
+	}
+	want := fmt.Sprintf("/smith/album.json /smith/files/IMG_0001-%d.png /smith/files/IMG_0001.png /smith/files/IMG_0002.png /smith/index.html", ids[1])
+	if got := dav.names(); got != want {
+		t.Fatalf("published\n%s\nwant\n%s", got, want)
+	}
+	if got := dav.files["/smith/files/IMG_0002.png"]; got != "image 2" {
+		t.Fatalf("IMG_0002.png = %q", got)
+	}
+	if !strings.Contains(dav.files["/smith/index.html"], "Smith wedding") {
+		t.Fatalf("index.html = %s", dav.files["/smith/index.html"])
+	}
+
+	puts := dav.puts
+	if res := run(false); !res.Unchanged || dav.puts != puts {
+		t.Fatalf("unchanged album was published again: %+v", res)
+	}
+	if res := run(true); res.Uploaded != 0 || dav.puts != puts+2 {
+		t.Fatalf("forced run of an unchanged album = %+v, %d puts", res, dav.puts-puts)
+	}
+
+	if _, _, err := store.RemoveMediaFromAlbum(ctx, album.ID, ids[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if res := run(false); res.Deleted != 1 || res.Uploaded != 0 {
+		t.Fatalf("run after removal = %+v", res)
+	}
+
+	// A PNG with a recorded position cannot be stripped, so it is taken
+	// down instead of being sent with its location.
+	saved, _ := store.GetPublishTarget(ctx, target.ID)
+	saved.StripGPS = true
+	if err := store.SavePublishTarget(ctx, saved); err != nil {
+		t.Fatal(err)
+	}
+	if res := run(false); res.Withheld != 1 || res.Deleted != 1 {
+		t.Fatalf("stripped run = %+v", res)
+	}
+	want = fmt.Sprintf("/smith/album.json /smith/files/IMG_0001-%d.png /smith/index.html", ids[1])
+	if got := dav.names(); got != want {
+		t.Fatalf("after stripping\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,275 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/storage"
+)
+
+// A delete can be deferred: the items leave the library at once, but their
+// bytes stay on disk until a purge time such as "sunday 02:00". Until then
+// a mistaken delete can be cancelled, and content placed on legal hold is
+// never purged, however long ago its purge fell due.
+
+const (
+	purgeIntervalMinutes = 15
+	purgeBatch           = 200
+	maxPurgeDelay        = 366 * 24 * time.Hour
+)
+
+var purgeClock = regexp.MustCompile(`^([01]?\d|2[0-3]):([0-5]\d)$`)
+
+// parsePurgeAt reads when deferred bytes are purged: an RFC 3339 time, or
+// "HH:MM" or "<weekday> HH:MM" in local time for the next such moment
+// after now.
+func parsePurgeAt(raw string, now time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	at, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		fields := strings.Fields(strings.ToLower(raw))
+		if len(fields) == 0 || len(fields) > 2 {
+			return time.Time{}, errors.New(`must be an RFC 3339 time, "HH:MM" or "<weekday> HH:MM"`)
+		}
+		day := -1
+		if len(fields) == 2 {
+			if day = parseWeekday(fields[0]); day < 0 {
+				return time.Time{}, fmt.Errorf("unknown weekday %q", fields[0])
+			}
+		}
+		m := purgeClock.FindStringSubmatch(fields[len(fields)-1])
+		if m == nil {
+			return time.Time{}, errors.New("time of day must be HH:MM")
+		}
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		at = time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+		for !at.After(now) || (day >= 0 && int(at.Weekday()) != day) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	if !at.After(now) {
+		return time.Time{}, errors.New("must be in the future")
+	}
+	if at.Sub(now) > maxPurgeDelay {
+		return time.Time{}, errors.New("must be within a year")
+	}
+	return at, nil
+}
+
+// parseWeekday reads a weekday name or its first three letters.
+func parseWeekday(s string) int {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || s == name[:3] {
+			return int(d)
+		}
+	}
+	return -1
+}
+
+func removeThumbnails(baseStorage string, id int64) {
+	if baseStorage == "." || baseStorage == "" {
+		return
+	}
+	for _, size := range media.ThumbnailSizes {
+		_ = os.Remove(media.ThumbnailPath(baseStorage, id, size))
+	}
+	_ = os.Remove(media.RenditionPath(baseStorage, id))
+	_ = os.RemoveAll(media.StreamCacheDir(baseStorage, id))
+}
+
+// purgeDue removes the files of purges whose time has come. A purge that
+// fails is kept with its error and tried again next run.
+func (a *App) purgeDue(ctx context.Context) error {
+	a.purgeMu.Lock()
+	defer a.purgeMu.Unlock()
+
+	due, err := a.store.DuePurges(ctx, time.Now(), purgeBatch)
+	if err != nil || len(due) == 0 {
+		return err
+	}
+	baseStorage, _, _ := a.store.GetSetting(ctx, baseStorageKey)
+	baseStorage = filepath.Clean(strings.TrimSpace(baseStorage))
+
+	var (
+		purged, failed int
+		bytes          int64
+		ids            = make([]int64, 0, len(due))
+	)
+	for _, p := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		destPath, ok := libraryLocation(p.Record.DestPath, baseStorage)
+		if !ok {
+			failed++
+			_ = a.store.SetPurgeError(ctx, p.ID, "file is outside the library")
+			continue
+		}
+		if err := a.libraryStorage().Remove(ctx, destPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			failed++
+			_ = a.store.SetPurgeError(ctx, p.ID, err.Error())
+			continue
+		}
+		for _, sc := range p.Sidecars {
+			_ = a.libraryStorage().Remove(ctx, sc.DestPath)
+		}
+		if storage.IsLocal(destPath) {
+			cleanupEmptyParents(destPath, baseStorage)
+		}
+		if err := a.store.FinishPurge(ctx, p.ID); err != nil {
+			failed++
+			continue
+		}
+		purged++
+		bytes += p.SizeBytes
+		ids = append(ids, p.MediaID)
+	}
+	if purged > 0 || failed > 0 {
+		_ = a.audit.Log(ctx, "system", "media_purged", map[string]any{
+			"purged":    purged,
+			"media_ids": ids,
+			"bytes":     bytes,
+			"failed":    failed,
+		})
+	}
+	return nil
+}
+
+func (a *App) handlePurgesList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	items, err := a.store.ListPurges(r.Context(), parsePositiveInt(r.URL.Query().Get("limit"), 1000))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// handlePurgeCancel puts an item waiting to be purged back in the library.
+// It comes back under a new id, outside the albums it was in.
+func (a *App) handlePurgeCancel(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid purge id"})
+		return
+	}
+	a.purgeMu.Lock()
+	rec, err := a.store.RestorePurge(r.Context(), id)
+	a.purgeMu.Unlock()
+	switch {
+	case errors.Is(err, db.ErrPurgeNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "purge not found"})
+		return
+	case db.IsUniqueViolation(err):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "the same file is already back in the library"})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to restore media"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "media_purge_cancelled", map[string]any{
+		"purge_id":  id,
+		"media_id":  rec.ID,
+		"file_name": rec.FileName,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "media_id": rec.ID})
+}
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type legalHoldRequest struct {
+	IDs    []int64  `json:"ids"`    // media in the library
+	SHA256 []string `json:"sha256"` // content, e.g. of a pending purge
+	Reason string   `json:"reason"`
+}
+
+func (a *App) handleLegalHoldsList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	holds, err := a.store.ListLegalHolds(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": holds})
+}
+
+func (a *App) handleLegalHoldsPlace(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req legalHoldRequest
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > 500 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "reason too long"})
+		return
+	}
+	hashes := make(map[string]bool)
+	for _, h := range req.SHA256 {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if !sha256Hex.MatchString(h) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "sha256 must be 64 hex digits"})
+			return
+		}
+		hashes[h] = true
+	}
+	notFound := 0
+	if ids := normalizeIDs(req.IDs, 5000); len(ids) > 0 {
+		records, err := a.store.ListMediaByIDs(r.Context(), ids)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+			return
+		}
+		notFound = len(ids) - len(records)
+		for _, rec := range records {
+			hashes[rec.SHA256] = true
+		}
+	}
+	if len(hashes) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ids or sha256 must name at least one item"})
+		return
+	}
+	placed := make([]string, 0, len(hashes))
+	for h := range hashes {
+		if err := a.store.PlaceLegalHold(r.Context(), h, reason, authCtx.Username); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to place hold"})
+			return
+		}
+		placed = append(placed, h)
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "legal_hold_placed", map[string]any{
+		"sha256": placed,
+		"reason": truncateForAudit(reason, 200),
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "held": len(placed), "not_found": notFound})
+}
+
+func (a *App) handleLegalHoldRelease(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	sha := strings.ToLower(r.PathValue("sha256"))
+	if !sha256Hex.MatchString(sha) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "sha256 must be 64 hex digits"})
+		return
+	}
+	released, err := a.store.ReleaseLegalHold(r.Context(), sha)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to release hold"})
+		return
+	}
+	if !released {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no hold on that content"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "legal_hold_released", map[string]any{"sha256": sha})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
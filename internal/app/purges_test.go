@@ -0,0 +1,164 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestParsePurgeAt(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2026, 10, 14, 10, 30, 0, 0, time.UTC)
+	cases := []struct {
+		raw  string
+		want time.Time
+	}{
+		{"sunday 02:00", time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)},
+		{"Wed 10:30", time.Date(2026, 10, 21, 10, 30, 0, 0, time.UTC)},
+		{"wed 11:00", time.Date(2026, 10, 14, 11, 0, 0, 0, time.UTC)},
+		{"02:00", time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC)},
+		{"2026-11-01T00:00:00Z", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		got, err := parsePurgeAt(c.raw, now)
+		if err != nil || !got.Equal(c.want) {
+			t.Errorf("parsePurgeAt(%q) = %v, %v; want %v", c.raw, got, err, c.want)
+		}
+	}
+	for _, raw := range []string{"someday 02:00", "25:00", "sunday", "2026-10-01T00:00:00Z", "2028-01-01T00:00:00Z", "sunday 02:00 utc"} {
+		if _, err := parsePurgeAt(raw, now); err == nil {
+			t.Errorf("parsePurgeAt(%q) accepted", raw)
+		}
+	}
+}
+
+func TestDeferredDeleteWaitsForPurgeAndHold(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	library := filepath.Join(root, "library")
+	if err := store.SetSetting(ctx, baseStorageKey, library); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	authCtx := &AuthContext{Username: "admin", Role: db.RoleAdmin}
+	itoa := func(n int64) string { return strconv.FormatInt(n, 10) }
+
+	add := func(name, sha string) (db.MediaRecord, string) {
+		path := filepath.Join(library, "2026", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		rec := db.MediaRecord{
+			Kind: "image", FileName: name, Extension: ".jpg", SourceMount: "/media/card",
+			SourcePath: "/media/card/" + name, DestPath: path, SizeBytes: int64(len(name)),
+			SHA256: sha, CaptureTime: "2026-10-01T12:00:00Z", IngestedAt: "2026-10-01T12:00:00Z",
+		}
+		if err := store.InsertMedia(ctx, &rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		return rec, path
+	}
+	kept, keptPath := add("a.jpg", strings.Repeat("a", 64))
+	held, heldPath := add("b.jpg", strings.Repeat("b", 64))
+
+	call := func(h func(http.ResponseWriter, *http.Request, *AuthContext), method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if i := strings.LastIndex(target, "/"); method == http.MethodDelete {
+			req.SetPathValue("id", target[i+1:])
+			req.SetPathValue("sha256", target[i+1:])
+		}
+		rr := httptest.NewRecorder()
+		h(rr, req, authCtx)
+		return rr
+	}
+
+	// A held item cannot be deleted outright.
+	if rr := call(app.handleLegalHoldsPlace, http.MethodPost, "/api/legal-holds", `{"ids":[`+itoa(held.ID)+`],"reason":"claim"}`); rr.Code != http.StatusOK {
+		t.Fatalf("place hold = %d: %s", rr.Code, rr.Body.String())
+	}
+	rr := call(app.handleMediaDelete, http.MethodPost, "/api/media/delete", `{"ids":[`+itoa(held.ID)+`]}`)
+	if !strings.Contains(rr.Body.String(), `"held":1`) {
+		t.Fatalf("delete held = %s", rr.Body.String())
+	}
+
+	rr = call(app.handleMediaDelete, http.MethodPost, "/api/media/delete",
+		`{"ids":[`+itoa(kept.ID)+`,`+itoa(held.ID)+`],"purge_at":"23:59"}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"scheduled":2`) {
+		t.Fatalf("scheduled delete = %d: %s", rr.Code, rr.Body.String())
+	}
+	if left, _ := store.ListMediaByIDs(ctx, []int64{kept.ID, held.ID}); len(left) != 0 {
+		t.Fatalf("scheduled items still in the library: %d", len(left))
+	}
+
+	// Nothing is due yet.
+	if err := app.purgeDue(ctx); err != nil {
+		t.Fatalf("purgeDue: %v", err)
+	}
+	for _, p := range []string{keptPath, heldPath} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("file purged early: %v", err)
+		}
+	}
+
+	var list struct{ Items []db.Purge }
+	if err := json.Unmarshal(call(app.handlePurgesList, http.MethodGet, "/api/purges", "").Body.Bytes(), &list); err != nil || len(list.Items) != 2 {
+		t.Fatalf("purges = %+v, %v", list.Items, err)
+	}
+	if _, err := store.DB.ExecContext(ctx, `UPDATE media_purges SET purge_after = '2000-01-01T00:00:00Z'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.purgeDue(ctx); err != nil {
+		t.Fatalf("purgeDue: %v", err)
+	}
+	if _, err := os.Stat(keptPath); !os.IsNotExist(err) {
+		t.Fatalf("due file not purged: %v", err)
+	}
+	if _, err := os.Stat(heldPath); err != nil {
+		t.Fatalf("held file purged: %v", err)
+	}
+
+	// Releasing the hold leaves the purge to the next run; cancelling
+	// before then brings the item back.
+	if rr := call(app.handleLegalHoldRelease, http.MethodDelete, "/api/legal-holds/"+held.SHA256, ""); rr.Code != http.StatusOK {
+		t.Fatalf("release = %d: %s", rr.Code, rr.Body.String())
+	}
+	pending, err := store.ListPurges(ctx, 10)
+	if err != nil || len(pending) != 1 || pending[0].Held {
+		t.Fatalf("pending = %+v, %v", pending, err)
+	}
+	rr = call(app.handlePurgeCancel, http.MethodDelete, "/api/purges/"+itoa(pending[0].ID), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("cancel = %d: %s", rr.Code, rr.Body.String())
+	}
+	var restored struct {
+		MediaID int64 `json:"media_id"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &restored)
+	back, err := store.ListMediaByIDs(ctx, []int64{restored.MediaID})
+	if err != nil || len(back) != 1 || back[0].DestPath != heldPath {
+		t.Fatalf("restored = %+v, %v", back, err)
+	}
+	if rr := call(app.handlePurgeCancel, http.MethodDelete, "/api/purges/"+itoa(pending[0].ID), ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("second cancel = %d", rr.Code)
+	}
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The web UI installs as a progressive web app. A service worker at the
+// site root keeps the UI shell and recently viewed thumbnails in the
+// browser, so the kiosk shows the UI at once and keeps showing it while
+// the server restarts mid-ingest.
+
+// recentThumbsMax is how many thumbnails per user the offline manifest
+// lists. It is kept in memory; the service worker holds on to its own
+// copies across a restart.
+const recentThumbsMax = 200
+
+// shellAssets are the files the service worker caches to start the UI
+// without the server.
+var shellAssets = []string{
+	"/",
+	"/web/app.js",
+	"/web/styles.css",
+	"/web/pwa.js",
+	"/web/icon.svg",
+	"/web/vendor/leaflet/leaflet.js",
+	"/web/vendor/leaflet/leaflet.css",
+	"/web/touch/touch.html",
+	"/web/touch/touch.js",
+	"/web/touch/touch.css",
+}
+
+// shellVersion changes whenever a shell file does, which tells the
+// service worker to fetch the shell again.
+func (a *App) shellVersion() string {
+	h := sha256.New()
+	for _, asset := range shellAssets {
+		file := strings.TrimPrefix(asset, "/web/")
+		if asset == "/" {
+			file = "index.html"
+		}
+		if info, err := os.Stat(filepath.Join(a.webDir, filepath.FromSlash(file))); err == nil {
+			fmt.Fprintf(h, "%s %d %d\n", asset, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// withRevalidate makes browsers check static files with the server before
+// using a cached copy. File names carry no version, so a long max-age
+// would pin old scripts after an upgrade.
+func withRevalidate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *App) handleWebManifest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/manifest+json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"name":             "USB Vault",
+		"short_name":       "USB Vault",
+		"description":      "Secure drone media ingest, dedupe, and local gallery",
+		"start_url":        "/",
+		"scope":            "/",
+		"display":          "standalone",
+		"background_color": "#0c111b",
+		"theme_color":      "#0c111b",
+		"icons": []map[string]string{
+			{"src": "/web/icon.svg", "sizes": "any", "type": "image/svg+xml", "purpose": "any"},
+		},
+	})
+}
+
+// handleServiceWorker serves web/sw.js from the site root, which is what
+// lets it control every page. Browsers check it for updates on each
+// navigation, so it must never be cached.
+func (a *App) handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Service-Worker-Allowed", "/")
+	http.ServeFile(w, r, filepath.Join(a.webDir, "sw.js"))
+}
+
+// handleOfflineManifest lists what the service worker should keep: the
+// shell, and the thumbnails the signed-in user viewed most recently. It
+// works signed out too, listing only the shell.
+func (a *App) handleOfflineManifest(w http.ResponseWriter, r *http.Request) {
+	thumbs := []string{}
+	if authCtx, ok := a.authFromRequest(r); ok && !authCtx.IsGuest() && !authCtx.Field {
+		thumbs = a.recentThumbnails(authCtx.UserID)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"version":    a.shellVersion(),
+		"shell":      shellAssets,
+		"thumbnails": thumbs,
+	})
+}
+
+// noteThumbnailView puts url at the front of the user's recent thumbnails.
+func (a *App) noteThumbnailView(userID int64, url string) {
+	a.recentMu.Lock()
+	defer a.recentMu.Unlock()
+	if a.recentThumbs == nil {
+		a.recentThumbs = map[int64][]string{}
+	}
+	list := a.recentThumbs[userID]
+	for i, u := range list {
+		if u == url {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	list = append([]string{url}, list...)
+	if len(list) > recentThumbsMax {
+		list = list[:recentThumbsMax]
+	}
+	a.recentThumbs[userID] = list
+}
+
+func (a *App) recentThumbnails(userID int64) []string {
+	a.recentMu.Lock()
+	defer a.recentMu.Unlock()
+	return append([]string{}, a.recentThumbs[userID]...)
+}
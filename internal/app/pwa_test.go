@@ -0,0 +1,53 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOfflineManifestListsRecentThumbnails(t *testing.T) {
+	webDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(webDir, "sw.js"), []byte("// sw"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	app := &App{webDir: webDir}
+
+	rr := httptest.NewRecorder()
+	app.handleServiceWorker(rr, httptest.NewRequest(http.MethodGet, "/sw.js", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Cache-Control") != "no-cache" || rr.Header().Get("Service-Worker-Allowed") != "/" {
+		t.Fatalf("sw.js = %d, headers %v", rr.Code, rr.Header())
+	}
+
+	for i := 0; i < recentThumbsMax+5; i++ {
+		app.noteThumbnailView(1, fmt.Sprintf("/api/media/%d/thumbnail?size=320", i+10))
+	}
+	app.noteThumbnailView(1, "/api/media/1/thumbnail?size=320")
+	app.noteThumbnailView(1, "/api/media/2/thumbnail?size=1024")
+	got := app.recentThumbnails(1)
+	if len(got) != recentThumbsMax || got[0] != "/api/media/2/thumbnail?size=1024" || got[1] != "/api/media/1/thumbnail?size=320" {
+		t.Fatalf("recent = %d items, starting %v", len(got), got[:2])
+	}
+	if len(app.recentThumbnails(2)) != 0 {
+		t.Fatal("another user sees the first user's thumbnails")
+	}
+
+	// Signed out, only the shell is listed.
+	rr = httptest.NewRecorder()
+	app.handleOfflineManifest(rr, httptest.NewRequest(http.MethodGet, "/api/offline-manifest", nil))
+	var manifest struct {
+		Version    string   `json:"version"`
+		Shell      []string `json:"shell"`
+		Thumbnails []string `json:"thumbnails"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Version == "" || len(manifest.Shell) != len(shellAssets) || len(manifest.Thumbnails) != 0 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"net/http"
+
+	"businessplan/usbvault/internal/db"
+)
+
+// mediaUpdateRequest is the body of PATCH /api/media/{id}. Fields left out
+// are not changed.
+type mediaUpdateRequest struct {
+	Rating   *int  `json:"rating"`
+	Favorite *bool `json:"favorite"`
+}
+
+func (a *App) handleMediaUpdate(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid media id"})
+		return
+	}
+	var req mediaUpdateRequest
+	if err := decodeJSONBody(r, &req, 1<<12); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if req.Rating == nil && req.Favorite == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "rating or favorite is required"})
+		return
+	}
+	if req.Rating != nil && (*req.Rating < 0 || *req.Rating > db.MaxRating) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "rating must be 0-5"})
+		return
+	}
+	rec, err := a.store.SetMediaRating(r.Context(), id, req.Rating, req.Favorite)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update media"})
+		return
+	}
+	if rec == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "media not found"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "media_rated", map[string]any{
+		"media_id": rec.ID,
+		"rating":   rec.Rating,
+		"favorite": rec.Favorite,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "item": rec})
+}
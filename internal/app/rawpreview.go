@@ -0,0 +1,129 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/storage"
+)
+
+// renditionMaxDimension bounds JPEG renditions of RAW files: enough for a
+// 4K screen, and a fraction of the sensor's size.
+const renditionMaxDimension = 4096
+
+var errNoRendition = errors.New("no JPEG rendition can be made of this file")
+
+// previewURL is where the browser shows rec: the file itself, or for RAW
+// files its JPEG rendition.
+func previewURL(rec db.MediaRecord) string {
+	if rec.Kind == "image" && media.IsRAW(rec.Extension) {
+		return fmt.Sprintf("/api/media/%d/content?format=jpeg", rec.ID)
+	}
+	return fmt.Sprintf("/api/media/%d/content", rec.ID)
+}
+
+// serveRendition sends a browser-viewable JPEG of a RAW file, for
+// ?format=jpeg on the content and download routes. The rendition holds no
+// metadata, so it carries no position whatever the location privacy
+// policy.
+func (a *App) serveRendition(w http.ResponseWriter, r *http.Request, authCtx *AuthContext, rec *db.MediaRecord, forceDownload bool) {
+	body, err := a.jpegRendition(r.Context(), rec)
+	if errors.Is(err, errNoRendition) {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		a.logger.Printf("jpeg rendition of media %d: %v", rec.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to render jpeg"})
+		return
+	}
+	name := strings.TrimSuffix(rec.FileName, filepath.Ext(rec.FileName)) + ".jpg"
+	download := forceDownload || isTruthy(r.URL.Query().Get("download"))
+	if download && r.Header.Get("Range") == "" {
+		_ = a.audit.Log(r.Context(), authCtx.Username, "media_downloaded", map[string]any{
+			"media_id": rec.ID,
+			"sha256":   rec.SHA256,
+			"ip":       clientIP(r),
+			"format":   "jpeg",
+		})
+	}
+	if download {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", sanitizeDownloadFilename(name)))
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(body))
+}
+
+// jpegRendition returns the cached JPEG rendition of a RAW file, making it
+// first if need be: from the camera's embedded preview where there is one,
+// and otherwise by developing the file with the RAW converter. The cache
+// is encrypted like the library when library encryption is on.
+func (a *App) jpegRendition(ctx context.Context, rec *db.MediaRecord) ([]byte, error) {
+	if rec.Kind != "image" || !media.IsRAW(rec.Extension) {
+		return nil, errNoRendition
+	}
+	baseStorage, _, err := a.store.GetSetting(ctx, baseStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	cachePath := media.RenditionPath(strings.TrimSpace(baseStorage), rec.ID)
+	if cachePath != "" {
+		if f, err := a.openMediaFile(ctx, cachePath); err == nil {
+			defer f.Close()
+			return io.ReadAll(f)
+		}
+	}
+
+	if err := a.thumbLimiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer a.thumbLimiter.Release()
+	img, err := a.developRAW(ctx, rec)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, media.ResizeToFit(img, renditionMaxDimension), &jpeg.Options{Quality: 88}); err != nil {
+		return nil, err
+	}
+	if cachePath != "" && !a.readOnly {
+		if err := media.WriteThumbnail(cachePath, buf.Bytes(), a.libKey); err != nil {
+			a.logger.Printf("cache jpeg rendition %d: %v", rec.ID, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// developRAW decodes a RAW file's embedded preview, or has the RAW
+// converter develop it. The converter needs a plain file, so encrypted or
+// remote RAW files without a readable preview get no rendition.
+func (a *App) developRAW(ctx context.Context, rec *db.MediaRecord) (*image.RGBA, error) {
+	if media.HasEmbeddedPreview(rec.Extension) {
+		src, err := a.openMediaFile(ctx, rec.DestPath)
+		if err != nil {
+			return nil, err
+		}
+		img, err := media.DecodeThumbnailSource(src, rec.Extension)
+		src.Close()
+		if err == nil {
+			return img, nil
+		}
+	}
+	if a.rawConverter == "" || !storage.IsPlainFile(rec.DestPath) {
+		return nil, errNoRendition
+	}
+	return media.DevelopRAW(ctx, a.rawConverter, rec.DestPath)
+}
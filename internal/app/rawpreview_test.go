@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/budget"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+)
+
+func TestRAWContentAsJPEGFallsBackToConverter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake dcraw is a shell script")
+	}
+	rootDir := t.TempDir()
+	store, err := db.Open(filepath.Join(rootDir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	library := filepath.Join(rootDir, "library")
+	if err := store.SetSetting(ctx, baseStorageKey, library); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	// Sensor data with no preview the media package can read.
+	original := filepath.Join(library, "IMG_0001.CR2")
+	if err := os.MkdirAll(library, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(original, []byte("II*\x00not really"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dcraw := filepath.Join(rootDir, "dcraw")
+	script := "#!/bin/sh\nprintf 'P6\\n2 2\\n255\\n'\nprintf '\\377\\000\\000\\377\\000\\000\\000\\377\\000\\000\\377\\000'\n"
+	if err := os.WriteFile(dcraw, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	rec := &db.MediaRecord{
+		Kind: "image", FileName: "IMG_0001.CR2", Extension: ".cr2",
+		SourceMount: "/Volumes/Test", SourcePath: "/DCIM/IMG_0001.CR2", DestPath: original,
+		SizeBytes: 1, CRC32: "00000001", SHA256: fmt.Sprintf("%064x", 1),
+		CaptureTime: ts, Metadata: "{}", SourceMTime: ts, IngestedAt: ts,
+	}
+	if err := store.InsertMedia(ctx, rec); err != nil {
+		t.Fatalf("InsertMedia: %v", err)
+	}
+
+	app := &App{store: store, logger: log.New(io.Discard, "", 0), thumbLimiter: budget.NewLimiter(1)}
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/media/%d/content?%s", rec.ID, query), nil)
+		req.SetPathValue("id", fmt.Sprint(rec.ID))
+		rr := httptest.NewRecorder()
+		app.handleMediaContent(rr, req, &AuthContext{Username: "admin"})
+		return rr
+	}
+
+	if rr := get("format=jpeg"); rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("without a converter = %d: %s", rr.Code, rr.Body.String())
+	}
+	app.rawConverter = dcraw
+	rr := get("format=jpeg")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("status = %d, %s: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	img, err := jpeg.Decode(rr.Body)
+	if err != nil || img.Bounds().Dx() != 2 || img.Bounds().Dy() != 2 {
+		t.Fatalf("rendition: %v", err)
+	}
+	if _, err := os.Stat(media.RenditionPath(library, rec.ID)); err != nil {
+		t.Fatalf("rendition was not cached: %v", err)
+	}
+	if rr := get("format=png"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("format=png = %d", rr.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"businessplan/usbvault/internal/config"
+)
+
+// Read-only mode serves an existing vault, such as the latest field backup
+// on an office machine, without changing it. The database is opened
+// read-only, ingest, backups, replication and background jobs do not run,
+// and every request that could change something is refused.
+
+// readOnlyRoutes are the mutating routes still allowed: signing in and out
+// only touch the in-memory sessions.
+var readOnlyRoutes = map[string]bool{
+	"POST /api/login":  true,
+	"POST /api/logout": true,
+}
+
+// relocateReadOnlyLibrary points library paths at USBVAULT_READ_ONLY_STORAGE
+// when the library was copied away from the base storage folder recorded
+// in the database.
+func (a *App) relocateReadOnlyLibrary(ctx context.Context) {
+	target := config.ReadOnlyStorage()
+	if target == "" {
+		return
+	}
+	base, ok, err := a.store.GetSetting(ctx, baseStorageKey)
+	if base = strings.TrimSpace(base); err != nil || !ok || base == "" {
+		a.logger.Printf("read-only: the database records no base storage folder, so USBVAULT_READ_ONLY_STORAGE is ignored")
+		return
+	}
+	a.store.Rebase(base, target)
+	a.logger.Printf("read-only: serving the library recorded at %s from %s", base, target)
+}
+
+// readOnlyGuard refuses every request that could change the vault while it
+// is served read-only.
+func (a *App) readOnlyGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !readOnlyRoutes[r.Method+" "+r.URL.Path] {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "this vault is served read-only"})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
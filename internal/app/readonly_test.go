@@ -0,0 +1,41 @@
+package app
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadOnlyGuardRefusesChanges(t *testing.T) {
+	a := &App{logger: log.New(io.Discard, "", 0), readOnly: true}
+	reached := 0
+	guard := a.readOnlyGuard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached++
+		w.WriteHeader(http.StatusOK)
+	}))
+	cases := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/media", http.StatusOK},
+		{http.MethodHead, "/api/media/1/content", http.StatusOK},
+		{http.MethodPost, "/api/login", http.StatusOK},
+		{http.MethodPost, "/api/logout", http.StatusOK},
+		{http.MethodPost, "/api/backup", http.StatusForbidden},
+		{http.MethodDelete, "/api/media", http.StatusForbidden},
+		{http.MethodPatch, "/api/media/1/tags", http.StatusForbidden},
+		{http.MethodPost, "/api/login/extra", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		guard.ServeHTTP(rr, httptest.NewRequest(c.method, c.path, nil))
+		if rr.Code != c.want {
+			t.Errorf("%s %s = %d, want %d", c.method, c.path, rr.Code, c.want)
+		}
+	}
+	if reached != 4 {
+		t.Fatalf("%d requests reached the handler, want 4", reached)
+	}
+}
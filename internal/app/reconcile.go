@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/libcrypt"
+)
+
+// libraryReconcileInterval is how often the library folder is compared with
+// the records while the vault runs.
+const libraryReconcileInterval = 6 * time.Hour
+
+var errReconcileBusy = errors.New("a library check is already running")
+
+// reconcileLibrary runs the library check of crash recovery while the vault
+// runs, so files moved or renamed by hand under base storage are found
+// again by content rather than flagged missing. It returns nil when base
+// storage is not set or not mounted.
+func (a *App) reconcileLibrary(ctx context.Context) (*recoveryReport, error) {
+	if !a.reconcileMu.TryLock() {
+		return nil, errReconcileBusy
+	}
+	defer a.reconcileMu.Unlock()
+
+	baseStorage, _, err := a.store.GetSetting(ctx, baseStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	baseStorage = strings.TrimSpace(baseStorage)
+	if baseStorage == "" {
+		return nil, nil
+	}
+	baseStorage = filepath.Clean(baseStorage)
+	if info, err := os.Stat(baseStorage); err != nil || !info.IsDir() {
+		return nil, nil
+	}
+	rep := &recoveryReport{MovedSample: []string{}, MissingSample: []string{}, UntrackedSample: []string{}}
+	if err := a.checkLibrary(ctx, baseStorage, rep, false); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+// logReconcile audits a check that changed something. Files no record knows
+// are left out: they would be reported again on every run.
+func (a *App) logReconcile(ctx context.Context, actor string, rep *recoveryReport) {
+	if rep.Moved == 0 && rep.Missing == 0 && rep.Found == 0 {
+		return
+	}
+	_ = a.audit.Log(ctx, actor, "library_reconciled", map[string]any{
+		"moved":          rep.Moved,
+		"moved_sample":   rep.MovedSample,
+		"missing":        rep.Missing,
+		"missing_sample": rep.MissingSample,
+		"found":          rep.Found,
+	})
+}
+
+func (a *App) scheduledReconcile(ctx context.Context) error {
+	rep, err := a.reconcileLibrary(ctx)
+	if errors.Is(err, errReconcileBusy) {
+		return nil
+	}
+	if err != nil || rep == nil {
+		return err
+	}
+	if rep.Skipped != "" {
+		a.logger.Printf("library check: %s", rep.Skipped)
+	}
+	a.logReconcile(ctx, "system", rep)
+	return nil
+}
+
+type reconcileRequest struct {
+	// Details lists every orphan and every record without its file, not
+	// just samples.
+	Details bool `json:"details"`
+	// ImportOrphans ingests the orphans found that are supported media, in
+	// the background, as if they had been uploaded.
+	ImportOrphans bool `json:"import_orphans"`
+}
+
+// reconcileOrphan is a file under base storage that no record knows.
+type reconcileOrphan struct {
+	Path       string `json:"path"`
+	SizeBytes  int64  `json:"size_bytes"`
+	Kind       string `json:"kind,omitempty"`
+	Importable bool   `json:"importable"`
+}
+
+func (a *App) handleLibraryReconcile(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req reconcileRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSONBody(r, &req, 1<<12); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if st := a.ingestor.GetStatus(); req.ImportOrphans && (st.State == "waiting" || st.State == "scanning" || st.State == "ingesting") {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "an ingest is running; import orphans when it is done"})
+		return
+	}
+	if req.ImportOrphans && a.migrateState().State == "running" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": errMigrateBusy.Error()})
+		return
+	}
+	rep, err := a.reconcileLibrary(r.Context())
+	if errors.Is(err, errReconcileBusy) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "library check failed"})
+		return
+	}
+	if rep == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "storage is not configured"})
+		return
+	}
+	a.logReconcile(r.Context(), authCtx.Username, rep)
+	resp := map[string]any{
+		"moved":            rep.Moved,
+		"moved_sample":     rep.MovedSample,
+		"missing":          rep.Missing,
+		"missing_sample":   rep.MissingSample,
+		"found":            rep.Found,
+		"untracked":        rep.Untracked,
+		"untracked_sample": rep.UntrackedSample,
+		"skipped":          rep.Skipped,
+	}
+
+	orphans := describeOrphans(rep.Orphans)
+	if req.Details {
+		missing := make([]map[string]any, 0, len(rep.Unlinked))
+		for _, f := range rep.Unlinked {
+			missing = append(missing, map[string]any{"id": f.ID, "dest_path": f.DestPath, "size_bytes": f.SizeBytes, "sha256": f.SHA256})
+		}
+		resp["orphans"] = orphans
+		resp["missing_files"] = missing
+	}
+	if req.ImportOrphans {
+		paths := make([]string, 0, len(orphans))
+		for _, o := range orphans {
+			if o.Importable {
+				paths = append(paths, o.Path)
+			}
+		}
+		if len(paths) > 0 {
+			go func() {
+				if _, err := a.ingestor.ImportOrphans(context.Background(), authCtx.Username, paths); err != nil {
+					a.logger.Printf("orphan import: %v", err)
+				}
+			}()
+		}
+		resp["importing"] = len(paths)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// describeOrphans sizes untracked files and says which of them an orphan
+// import would take: supported media that is not encrypted.
+func describeOrphans(paths []string) []reconcileOrphan {
+	out := make([]reconcileOrphan, 0, len(paths))
+	for _, path := range paths {
+		o := reconcileOrphan{Path: path}
+		if info, err := os.Stat(path); err == nil {
+			o.SizeBytes = info.Size()
+		}
+		if kind, ok := config.IsSupportedMedia(path); ok {
+			o.Kind = kind
+			o.Importable = o.SizeBytes > 0 && !libcrypt.IsEncrypted(path)
+		}
+		out = append(out, o)
+	}
+	return out
+}
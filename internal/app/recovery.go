@@ -0,0 +1,382 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"businessplan/usbvault/internal/backup"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/storage"
+)
+
+// recoverySampleSize caps how many paths the recovery report lists per kind.
+const recoverySampleSize = 20
+
+// recoveryReport is what the startup check found and did.
+type recoveryReport struct {
+	InterruptedJobs   []db.RunningJob
+	PartialSnapshots  int
+	PartialsRestored  int
+	PartialsRemoved   int
+	ThumbTempsRemoved int
+	Missing           int
+	MissingSample     []string
+	Found             int // flagged missing before, back now
+	Moved             int // found again under another name or folder
+	MovedSample       []string
+	Untracked         int
+	UntrackedSample   []string
+	// Orphans lists every untracked file and Unlinked every record still
+	// without its file, for a full reconcile report.
+	Orphans  []string
+	Unlinked []db.MediaFile
+	// Skipped says why the library was not checked.
+	Skipped string
+}
+
+func (r *recoveryReport) empty() bool {
+	return len(r.InterruptedJobs) == 0 && r.PartialSnapshots == 0 && r.PartialsRestored == 0 &&
+		r.PartialsRemoved == 0 && r.ThumbTempsRemoved == 0 && r.Missing == 0 && r.Found == 0 &&
+		r.Moved == 0 && r.Untracked == 0 && r.Skipped == ""
+}
+
+// recoverAfterCrash runs before ingest and the background jobs start and
+// puts back what a power loss can leave half done: jobs that never recorded
+// their end, partial copies next to the library, temp thumbnails, and
+// records whose file is gone. Partial copies that match their record are
+// moved into place and the rest are deleted. Records without a file are
+// pointed at a moved copy when one turns up, and otherwise flagged
+// (missing=yes on /api/media) rather than deleted; files no record knows
+// are only reported. What it did goes to the audit log.
+func (a *App) recoverAfterCrash(ctx context.Context) {
+	rep, err := a.recoverLibrary(ctx)
+	if err != nil {
+		a.logger.Printf("crash recovery: %v", err)
+		return
+	}
+	if rep.empty() {
+		return
+	}
+	a.logger.Printf("crash recovery: %d interrupted jobs, %d partial copies restored, %d removed, %d records missing their file, %d moved, %d untracked files",
+		len(rep.InterruptedJobs), rep.PartialsRestored, rep.PartialsRemoved, rep.Missing, rep.Moved, rep.Untracked)
+	if rep.Skipped != "" {
+		a.logger.Printf("crash recovery: library not checked: %s", rep.Skipped)
+	}
+	_ = a.audit.Log(ctx, "system", "crash_recovery", map[string]any{
+		"interrupted_jobs":          rep.InterruptedJobs,
+		"partial_snapshots_removed": rep.PartialSnapshots,
+		"partials_restored":         rep.PartialsRestored,
+		"partials_removed":          rep.PartialsRemoved,
+		"thumbnail_temps_removed":   rep.ThumbTempsRemoved,
+		"missing":                   rep.Missing,
+		"missing_sample":            rep.MissingSample,
+		"found":                     rep.Found,
+		"moved":                     rep.Moved,
+		"moved_sample":              rep.MovedSample,
+		"untracked":                 rep.Untracked,
+		"untracked_sample":          rep.UntrackedSample,
+		"skipped":                   rep.Skipped,
+	})
+}
+
+func (a *App) recoverLibrary(ctx context.Context) (*recoveryReport, error) {
+	rep := &recoveryReport{InterruptedJobs: []db.RunningJob{}}
+	jobs, err := a.store.TakeRunningJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rep.InterruptedJobs = jobs
+	for _, j := range jobs {
+		if j.Kind == backup.JobKind {
+			rep.PartialSnapshots += a.removePartialSnapshots(j.Detail)
+		}
+	}
+
+	baseStorage, _, err := a.store.GetSetting(ctx, baseStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	baseStorage = strings.TrimSpace(baseStorage)
+	if baseStorage == "" {
+		return rep, nil
+	}
+	baseStorage = filepath.Clean(baseStorage)
+	if info, err := os.Stat(baseStorage); err != nil || !info.IsDir() {
+		rep.Skipped = "base storage is not available"
+		return rep, nil
+	}
+
+	rep.ThumbTempsRemoved = removeThumbTemps(config.WorkAreaDir(baseStorage, config.WorkAreaThumbnails))
+	if err := a.checkLibrary(ctx, baseStorage, rep, true); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+// checkLibrary compares the library folder with the records. A record whose
+// file is gone is matched by SHA256 to a file no record knows, for files
+// moved or renamed by hand, and is flagged missing only when none matches.
+// After a crash it also restores or removes partial copies; at other times
+// they may belong to a copy under way and are left alone.
+func (a *App) checkLibrary(ctx context.Context, baseStorage string, rep *recoveryReport, afterCrash bool) error {
+	onDisk, partials, err := walkLibrary(ctx, baseStorage)
+	if err != nil {
+		return err
+	}
+	files, err := a.store.MediaFiles(ctx)
+	if err != nil {
+		return err
+	}
+	flagged, err := a.store.MissingMediaIDs(ctx)
+	if err != nil {
+		return err
+	}
+	// Sidecars and files waiting to be purged are not untracked.
+	recorded, err := a.store.AccountedPaths(ctx)
+	if err != nil {
+		return err
+	}
+
+	var missing []db.MediaFile
+	present := 0
+	for _, f := range files {
+		// Objects in remote storage are uploaded whole or not at all, and
+		// are not in the library folder to be found.
+		if !storage.IsLocal(f.DestPath) {
+			continue
+		}
+		recorded[f.DestPath] = struct{}{}
+		part := f.DestPath + ".part"
+		if _, ok := onDisk[f.DestPath]; !ok {
+			if _, err := os.Stat(f.DestPath); err != nil {
+				if _, ok := partials[part]; ok && afterCrash && a.restorePartial(ctx, part, f) {
+					delete(partials, part)
+					rep.PartialsRestored++
+				} else {
+					missing = append(missing, f)
+					continue
+				}
+			}
+		}
+		present++
+		if _, ok := flagged[f.ID]; ok {
+			if err := a.store.SetMediaMissing(ctx, f.ID, false); err == nil {
+				rep.Found++
+			}
+		}
+	}
+
+	if afterCrash {
+		for part := range partials {
+			if err := os.Remove(part); err == nil {
+				rep.PartialsRemoved++
+			}
+		}
+	}
+	var untracked []string
+	for path := range onDisk {
+		if _, ok := recorded[path]; !ok {
+			untracked = append(untracked, path)
+		}
+	}
+	sort.Strings(untracked)
+
+	missing, untracked, err = a.relinkMoved(ctx, missing, untracked, rep)
+	if err != nil {
+		return err
+	}
+	present += rep.Moved
+	rep.Orphans = untracked
+	for _, path := range untracked {
+		rep.Untracked++
+		if len(rep.UntrackedSample) < recoverySampleSize {
+			rep.UntrackedSample = append(rep.UntrackedSample, path)
+		}
+	}
+
+	// A library where no recorded file is left is a drive that did not
+	// mount, not a library that lost everything.
+	if present == 0 && len(missing) > 0 {
+		rep.Skipped = "no recorded file was found; is the library drive mounted?"
+		return nil
+	}
+	rep.Unlinked = missing
+	for _, f := range missing {
+		if _, ok := flagged[f.ID]; ok {
+			continue
+		}
+		if err := a.store.SetMediaMissing(ctx, f.ID, true); err != nil {
+			return err
+		}
+		rep.Missing++
+		if len(rep.MissingSample) < recoverySampleSize {
+			rep.MissingSample = append(rep.MissingSample, f.DestPath)
+		}
+	}
+	return nil
+}
+
+// relinkMoved points records whose file is gone at untracked files with the
+// same content, and returns the records and files left unmatched. Only files
+// the size of a missing record, plain or encrypted, are hashed.
+func (a *App) relinkMoved(ctx context.Context, missing []db.MediaFile, untracked []string, rep *recoveryReport) ([]db.MediaFile, []string, error) {
+	if len(missing) == 0 || len(untracked) == 0 {
+		return missing, untracked, nil
+	}
+	sizes := make(map[int64]struct{}, 2*len(missing))
+	bySum := make(map[string][]int, len(missing))
+	for i, f := range missing {
+		sizes[f.SizeBytes] = struct{}{}
+		sizes[libcrypt.EncryptedSize(f.SizeBytes)] = struct{}{}
+		bySum[f.SHA256] = append(bySum[f.SHA256], i)
+	}
+	matched := make(map[int]bool)
+	var left []string
+	for _, path := range untracked {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if _, ok := sizes[info.Size()]; !ok {
+			left = append(left, path)
+			continue
+		}
+		sum, err := a.librarySHA256(ctx, path)
+		if err != nil || len(bySum[sum]) == 0 {
+			left = append(left, path)
+			continue
+		}
+		i := bySum[sum][0]
+		bySum[sum] = bySum[sum][1:]
+		f := missing[i]
+		if err := a.store.SetMediaDestPath(ctx, f.ID, path); err != nil {
+			return nil, nil, err
+		}
+		matched[i] = true
+		rep.Moved++
+		if len(rep.MovedSample) < recoverySampleSize {
+			rep.MovedSample = append(rep.MovedSample, f.DestPath+" -> "+path)
+		}
+	}
+	var still []db.MediaFile
+	for i, f := range missing {
+		if !matched[i] {
+			still = append(still, f)
+		}
+	}
+	return still, left, nil
+}
+
+// walkLibrary lists the files in base storage, outside the work area, and
+// the partial copies among them.
+func walkLibrary(ctx context.Context, baseStorage string) (map[string]struct{}, map[string]struct{}, error) {
+	files := map[string]struct{}{}
+	partials := map[string]struct{}{}
+	workDir := filepath.Join(baseStorage, config.WorkDirName)
+	err := filepath.WalkDir(baseStorage, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == baseStorage {
+				return err
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if path == workDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if strings.HasSuffix(path, ".part") {
+			partials[path] = struct{}{}
+		} else {
+			files[path] = struct{}{}
+		}
+		return nil
+	})
+	return files, partials, err
+}
+
+// restorePartial moves a partial copy into place when its content is the
+// complete file its record describes: the copy finished but the rename did
+// not happen.
+func (a *App) restorePartial(ctx context.Context, part string, f db.MediaFile) bool {
+	if sum, err := a.librarySHA256(ctx, part); err != nil || sum != f.SHA256 {
+		return false
+	}
+	if err := os.Rename(part, f.DestPath); err != nil {
+		a.logger.Printf("crash recovery: restore %s: %v", f.DestPath, err)
+		return false
+	}
+	_ = os.Chmod(f.DestPath, 0o440)
+	return true
+}
+
+// librarySHA256 hashes the content of a library file, decrypted if need be.
+func (a *App) librarySHA256(ctx context.Context, path string) (string, error) {
+	src, err := a.openMediaFile(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, src); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// removeThumbTemps deletes thumbnails that were being written.
+func removeThumbTemps(dir string) int {
+	removed := 0
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasPrefix(d.Name(), ".thumb-") {
+			return nil
+		}
+		if os.Remove(path) == nil {
+			removed++
+		}
+		return nil
+	})
+	return removed
+}
+
+// removePartialSnapshots clears the unfinished snapshots of an interrupted
+// backup. Other modes write nothing locally that a later run does not
+// replace.
+func (a *App) removePartialSnapshots(detail string) int {
+	var dests []backup.Destination
+	if err := json.Unmarshal([]byte(detail), &dests); err != nil {
+		return 0
+	}
+	removed := 0
+	for _, d := range dests {
+		if d.Mode != "snapshot" {
+			continue
+		}
+		n, err := backup.RemovePartialSnapshots(d.Destination)
+		if err != nil {
+			a.logger.Printf("crash recovery: snapshot %s: %v", d.Destination, err)
+		}
+		removed += n
+	}
+	return removed
+}
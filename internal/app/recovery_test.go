@@ -0,0 +1,261 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/backup"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/ingest"
+)
+
+func TestRecoverAfterCrash(t *testing.T) {
+	rootDir := t.TempDir()
+	store, err := db.Open(filepath.Join(rootDir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	ctx := context.Background()
+	library := filepath.Join(rootDir, "library")
+	if err := store.SetSetting(ctx, baseStorageKey, library); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	write := func(rel, content string) string {
+		path := filepath.Join(library, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	insert := func(n int, dest, content string) int64 {
+		sum := sha256.Sum256([]byte(content))
+		rec := &db.MediaRecord{
+			Kind: "image", FileName: filepath.Base(dest), Extension: ".jpg",
+			SourceMount: "/Volumes/Test", SourcePath: fmt.Sprintf("/DCIM/%d.jpg", n), DestPath: dest,
+			SizeBytes: int64(len(content)), CRC32: fmt.Sprintf("%08x", n), SHA256: hex.EncodeToString(sum[:]),
+			CaptureTime: "2026-03-01T10:00:00Z", Metadata: "{}", SourceMTime: "2026-03-01T10:00:00Z",
+			IngestedAt: time.Now().UTC().Format(time.RFC3339),
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		return rec.ID
+	}
+
+	kept := insert(1, write("2026/03/01/kept.jpg", "kept"), "kept")
+	if err := store.SetMediaMissing(ctx, kept, true); err != nil {
+		t.Fatal(err)
+	}
+	renamed := filepath.Join(library, "2026/03/01/renamed.jpg")
+	write("2026/03/01/renamed.jpg.part", "renamed")
+	insert(2, renamed, "renamed")
+	gone := insert(3, filepath.Join(library, "2026/03/01/gone.jpg"), "gone")
+	write("2026/03/01/gone.jpg.part", "go")
+	write("2026/03/01/stray.jpg.part", "stray")
+	write("2026/03/01/orphan.jpg", "orphan")
+	thumbTemp := write(filepath.Join(config.WorkDirName, config.WorkAreaThumbnails, "0", ".thumb-123"), "x")
+
+	snapshots := filepath.Join(rootDir, "snapshots")
+	partial := filepath.Join(snapshots, "20260301-100000.partial")
+	if err := os.MkdirAll(partial, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.BeginJob(ctx, ingest.JobMount, "system", "/media/card"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.BeginJob(ctx, backup.JobKind, "admin", `[{"mode":"snapshot","destination":"`+snapshots+`"}]`); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	rep, err := app.recoverLibrary(ctx)
+	if err != nil {
+		t.Fatalf("recoverLibrary: %v", err)
+	}
+
+	if len(rep.InterruptedJobs) != 2 || rep.InterruptedJobs[0].Detail != "/media/card" {
+		t.Fatalf("interrupted jobs = %+v", rep.InterruptedJobs)
+	}
+	if rep.PartialSnapshots != 1 {
+		t.Fatalf("partial snapshots removed = %d, want 1", rep.PartialSnapshots)
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Fatalf("partial snapshot still there: %v", err)
+	}
+	if rep.PartialsRestored != 1 || rep.PartialsRemoved != 2 || rep.ThumbTempsRemoved != 1 {
+		t.Fatalf("restored %d, removed %d, thumb temps %d; want 1, 2, 1", rep.PartialsRestored, rep.PartialsRemoved, rep.ThumbTempsRemoved)
+	}
+	if b, err := os.ReadFile(renamed); err != nil || string(b) != "renamed" {
+		t.Fatalf("renamed.jpg = %q, %v", b, err)
+	}
+	if _, err := os.Stat(thumbTemp); !os.IsNotExist(err) {
+		t.Fatalf("thumbnail temp still there: %v", err)
+	}
+	if rep.Missing != 1 || rep.Found != 1 || rep.Untracked != 1 {
+		t.Fatalf("missing %d, found %d, untracked %d; want 1, 1, 1", rep.Missing, rep.Found, rep.Untracked)
+	}
+
+	flagged, err := store.ListMediaFiltered(ctx, "", "", 10, 0, db.MediaFilter{Missing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flagged) != 1 || flagged[0].ID != gone {
+		t.Fatalf("flagged missing = %v, want only %d", flagged, gone)
+	}
+
+	again, err := app.recoverLibrary(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.InterruptedJobs) != 0 || again.Missing != 0 || again.PartialsRemoved != 0 {
+		t.Fatalf("second run repeated work: %+v", again)
+	}
+}
+
+func TestRecoverSkipsUnmountedLibrary(t *testing.T) {
+	rootDir := t.TempDir()
+	store, err := db.Open(filepath.Join(rootDir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	ctx := context.Background()
+	library := filepath.Join(rootDir, "library")
+	if err := os.MkdirAll(library, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetSetting(ctx, baseStorageKey, library); err != nil {
+		t.Fatal(err)
+	}
+	rec := &db.MediaRecord{
+		Kind: "image", FileName: "a.jpg", Extension: ".jpg", SourceMount: "/Volumes/Test", SourcePath: "/DCIM/a.jpg",
+		DestPath: filepath.Join(library, "a.jpg"), SizeBytes: 1, CRC32: "00000001", SHA256: fmt.Sprintf("%064x", 1),
+		CaptureTime: "2026-03-01T10:00:00Z", Metadata: "{}", SourceMTime: "2026-03-01T10:00:00Z",
+		IngestedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := store.InsertMedia(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	rep, err := app.recoverLibrary(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Skipped == "" || rep.Missing != 0 {
+		t.Fatalf("empty library flagged %d missing, skipped %q", rep.Missing, rep.Skipped)
+	}
+}
+
+func TestReconcileRelinksMovedFiles(t *testing.T) {
+	rootDir := t.TempDir()
+	store, err := db.Open(filepath.Join(rootDir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	ctx := context.Background()
+	library := filepath.Join(rootDir, "library")
+	if err := store.SetSetting(ctx, baseStorageKey, library); err != nil {
+		t.Fatal(err)
+	}
+	insert := func(n int, rel, content string) int64 {
+		path := filepath.Join(library, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		rec := &db.MediaRecord{
+			Kind: "image", FileName: filepath.Base(rel), Extension: ".jpg",
+			SourceMount: "/Volumes/Test", SourcePath: fmt.Sprintf("/DCIM/%d.jpg", n), DestPath: path,
+			SizeBytes: int64(len(content)), CRC32: fmt.Sprintf("%08x", n), SHA256: hex.EncodeToString(sum[:]),
+			CaptureTime: "2026-03-01T10:00:00Z", Metadata: "{}", SourceMTime: "2026-03-01T10:00:00Z",
+			IngestedAt: time.Now().UTC().Format(time.RFC3339),
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		return rec.ID
+	}
+	kept := insert(1, "2026/03/01/kept.jpg", "kept")
+	// A sidecar has no record of its own but is not untracked.
+	xmp := filepath.Join(library, "2026/03/01/kept.xmp")
+	if err := os.WriteFile(xmp, []byte("<x/>"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddMediaSidecars(ctx, kept, []db.Sidecar{{Kind: "xmp", FileName: "kept.xmp", SourcePath: "/DCIM/1.xmp", DestPath: xmp, SizeBytes: 4, SHA256: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	moved := insert(2, "2026/03/01/beach.jpg", "beach")
+	gone := insert(3, "2026/03/01/gone.jpg", "gone")
+	if err := store.SetMediaMissing(ctx, moved, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rearranged by hand: one file moved and renamed, one deleted, and an
+	// unrelated file of the same size added.
+	newPath := filepath.Join(library, "Trips", "Beach Day.jpg")
+	if err := os.MkdirAll(filepath.Dir(newPath), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(library, "2026/03/01/beach.jpg"), newPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(library, "2026/03/01/gone.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(library, "Trips", "other.jpg"), []byte("other"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	rep, err := app.reconcileLibrary(ctx)
+	if err != nil {
+		t.Fatalf("reconcileLibrary: %v", err)
+	}
+	if rep.Moved != 1 || rep.Missing != 1 || rep.Untracked != 1 || rep.Found != 0 {
+		t.Fatalf("moved %d, missing %d, untracked %d, found %d; want 1, 1, 1, 0", rep.Moved, rep.Missing, rep.Untracked, rep.Found)
+	}
+	if len(rep.Orphans) != 1 || rep.Orphans[0] != filepath.Join(library, "Trips", "other.jpg") || len(rep.Unlinked) != 1 || rep.Unlinked[0].ID != gone {
+		t.Fatalf("orphans %v, unlinked %+v", rep.Orphans, rep.Unlinked)
+	}
+	rec, err := store.GetMediaByID(ctx, moved)
+	if err != nil || rec == nil || rec.DestPath != newPath {
+		t.Fatalf("moved record = %+v, %v", rec, err)
+	}
+	flagged, err := store.MissingMediaIDs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := flagged[gone]; !ok || len(flagged) != 1 {
+		t.Fatalf("flagged missing = %v, want only %d", flagged, gone)
+	}
+
+	again, err := app.reconcileLibrary(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Moved != 0 || again.Missing != 0 {
+		t.Fatalf("second run repeated work: %+v", again)
+	}
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/security"
+)
+
+// A vault is often a headless box with one admin account, so a forgotten
+// password would lock its owner out of their own library. Setup hands out
+// one-time recovery codes that sign in in place of the password and set a
+// new one. Only their hashes are kept.
+
+const recoveryCodeCount = 10
+
+// issueRecoveryCodes makes a new set of codes for userID, replacing any it
+// had, and returns them for showing once.
+func (a *App) issueRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := security.NewRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i], hashes[i] = code, security.RecoveryCodeHash(code)
+	}
+	if err := a.store.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// loginWithRecoveryCode signs in with a recovery code instead of the
+// password. The code is used up, the account gets req.NewPassword, and
+// other sessions are signed out, since the old password may be known to
+// someone else.
+func (a *App) loginWithRecoveryCode(w http.ResponseWriter, r *http.Request, req loginRequest, user *db.User, throttleKeys []string) {
+	ctx := r.Context()
+	if err := security.ValidatePassword(req.NewPassword); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "new_password: " + err.Error()})
+		return
+	}
+	ok := false
+	if user != nil && user.Role != db.RoleGuest {
+		var err error
+		if ok, err = a.store.UseRecoveryCode(ctx, user.ID, security.RecoveryCodeHash(req.RecoveryCode)); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+			return
+		}
+	}
+	if !ok {
+		_ = a.audit.Log(ctx, "anonymous", "login_failed", map[string]any{
+			"username": truncateForAudit(req.Username, 64),
+			"ip":       peerIP(r),
+			"method":   "recovery_code",
+		})
+		a.recordLoginFailure(ctx, r, req.Username, throttleKeys)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
+		return
+	}
+	_ = a.store.ClearLoginFailures(ctx, throttleKeys...)
+
+	hash, salt, err := security.HashPassword(req.NewPassword)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to hash password"})
+		return
+	}
+	if err := a.store.ResetPassword(ctx, user.ID, hash, salt); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to set password"})
+		return
+	}
+	remaining, _ := a.store.RecoveryCodesLeft(ctx, user.ID)
+	_ = a.audit.Log(ctx, user.Username, "recovery_code_used", map[string]any{"ip": peerIP(r), "remaining": remaining})
+
+	if err := a.issueSession(w, user.ID, user.Username, user.ExpiresAt); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create session"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "recovery_codes_left": remaining})
+}
+
+func (a *App) handleRecoveryCodesStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	remaining, err := a.store.RecoveryCodesLeft(r.Context(), authCtx.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"remaining": remaining})
+}
+
+type recoveryCodesRequest struct {
+	Password string `json:"password"`
+}
+
+// handleRecoveryCodesRegenerate replaces the signed-in user's codes. It
+// asks for the password again so an unattended session cannot mint codes.
+func (a *App) handleRecoveryCodesRegenerate(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	ctx := r.Context()
+	var req recoveryCodesRequest
+	if err := decodeJSONBody(r, &req, 1<<12); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	user, err := a.store.GetUserByUsername(ctx, authCtx.Username)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	if user == nil || strings.TrimSpace(req.Password) == "" || !security.VerifyPassword(req.Password, user.PasswordHash, user.Salt) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "password is incorrect"})
+		return
+	}
+	codes, err := a.issueRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create recovery codes"})
+		return
+	}
+	_ = a.audit.Log(ctx, authCtx.Username, "recovery_codes_regenerated", map[string]any{"count": len(codes)})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "recovery_codes": codes})
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestRecoveryCodeReplacesLostPassword(t *testing.T) {
+	rootDir := t.TempDir()
+	store, err := db.Open(filepath.Join(rootDir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0), sessionTTL: time.Hour}
+
+	body := `{"username":"admin","password":"correct horse battery","base_storage_dir":"` +
+		filepath.ToSlash(filepath.Join(rootDir, "library")) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/setup", strings.NewReader(body))
+	req.RemoteAddr = "127.0.0.1:50000"
+	rr := httptest.NewRecorder()
+	app.handleSetup(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("setup = %d: %s", rr.Code, rr.Body.String())
+	}
+	var setup struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &setup); err != nil || len(setup.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("setup codes = %v, %v", setup.RecoveryCodes, err)
+	}
+
+	login := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.7:4000"
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		rr := httptest.NewRecorder()
+		app.handleLogin(rr, req)
+		return rr
+	}
+	admin, err := store.GetUserByUsername(context.Background(), "admin")
+	if err != nil || admin == nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if _, err := store.CreateAPIToken(context.Background(), admin.ID, "backup script", "uvt_abcd", "hash", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	code := setup.RecoveryCodes[3]
+	if rr := login(`{"username":"admin","recovery_code":"` + code + `","new_password":"short"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("weak new password = %d", rr.Code)
+	}
+	if rr := login(`{"username":"admin","recovery_code":"aaaa-bbbb-cccc-dddd","new_password":"a brand new password"}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown code = %d", rr.Code)
+	}
+	// Typed in capitals and without dashes still works.
+	typed := strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+	rr = login(`{"username":"admin","recovery_code":"` + typed + `","new_password":"a brand new password"}`)
+	if rr.Code != http.StatusOK || len(rr.Result().Cookies()) == 0 {
+		t.Fatalf("recovery login = %d: %s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), `"recovery_codes_left":9`) {
+		t.Fatalf("recovery login body = %s", rr.Body.String())
+	}
+	if tokens, err := store.ListAPITokens(context.Background(), admin.ID); err != nil || len(tokens) != 0 {
+		t.Fatalf("API tokens after the reset = %v, %v; want revoked", tokens, err)
+	}
+	// The reset is audited, and alerted on, under the TCP peer rather than
+	// the address the client claims.
+	recs, err := store.ListAudit(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range recs {
+		if rec.Action == "recovery_code_used" && !strings.Contains(rec.Details, `"ip":"192.0.2.7"`) {
+			t.Fatalf("recovery_code_used details = %s, want the peer address", rec.Details)
+		}
+	}
+	if rr := login(`{"username":"admin","recovery_code":"` + code + `","new_password":"another new password"}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("reused code = %d", rr.Code)
+	}
+	if rr := login(`{"username":"admin","password":"correct horse battery"}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("old password = %d", rr.Code)
+	}
+	if rr := login(`{"username":"admin","password":"a brand new password"}`); rr.Code != http.StatusOK {
+		t.Fatalf("new password = %d", rr.Code)
+	}
+
+	user, err := store.GetUserByUsername(context.Background(), "admin")
+	if err != nil || user == nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	authCtx := &AuthContext{UserID: user.ID, Username: "admin", Role: db.RoleAdmin}
+	regen := func(password string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.handleRecoveryCodesRegenerate(rr, httptest.NewRequest(http.MethodPost, "/api/recovery-codes", strings.NewReader(`{"password":"`+password+`"}`)), authCtx)
+		return rr
+	}
+	if rr := regen("correct horse battery"); rr.Code != http.StatusForbidden {
+		t.Fatalf("regenerate with old password = %d", rr.Code)
+	}
+	if rr := regen("a brand new password"); rr.Code != http.StatusOK {
+		t.Fatalf("regenerate = %d: %s", rr.Code, rr.Body.String())
+	}
+	if left, err := store.RecoveryCodesLeft(context.Background(), user.ID); err != nil || left != recoveryCodeCount {
+		t.Fatalf("codes left after regenerate = %d, %v", left, err)
+	}
+	if rr := login(`{"username":"admin","recovery_code":"` + setup.RecoveryCodes[0] + `","new_password":"another new password"}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("code from the replaced set = %d", rr.Code)
+	}
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+)
+
+// Reload re-reads the config file and applies the settings that can change
+// while the server runs. Ingests and backups in progress carry on; they see
+// a changed setting from their next file or run.
+func (a *App) Reload(ctx context.Context, actor string) (config.Reload, error) {
+	rel, err := config.LoadFile()
+	if err != nil {
+		return rel, err
+	}
+	a.applyRuntimeConfig()
+	if err := a.loadAllowedNetworks(ctx); err != nil {
+		return rel, fmt.Errorf("allowed networks: %w", err)
+	}
+	a.logger.Printf("configuration reloaded from %s; changed: %v", rel.File, rel.Changed)
+	if len(rel.Restart) > 0 {
+		a.logger.Printf("restart to apply: %v", rel.Restart)
+	}
+	_ = a.audit.Log(ctx, actor, "config_reloaded", map[string]any{
+		"file":             rel.File,
+		"changed":          rel.Changed,
+		"restart_required": rel.Restart,
+	})
+	return rel, nil
+}
+
+// applyRuntimeConfig pushes settings that are held in memory to where they
+// are used.
+func (a *App) applyRuntimeConfig() {
+	a.logLevel.Store(config.LogLevel())
+	a.hooks.SetTimeout(time.Duration(config.HookTimeoutSeconds()) * time.Second)
+	a.watcher.SetInterval(a.usbScanInterval())
+}
+
+func (a *App) handleSystemReload(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	rel, err := a.Reload(r.Context(), authCtx.Username)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, rel)
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime"
+
+	"businessplan/usbvault/internal/budget"
+)
+
+// resourceBudget returns the stored budget, zero fields left for the
+// machine's defaults, and the budget in effect.
+func (a *App) resourceBudget(ctx context.Context) (budget.Budget, budget.Budget, error) {
+	raw, _, err := a.store.GetSetting(ctx, budget.SettingKey)
+	if err != nil {
+		return budget.Budget{}, budget.Budget{}, err
+	}
+	stored, err := budget.Parse(raw)
+	if err != nil {
+		return budget.Budget{}, budget.Budget{}, err
+	}
+	effective, err := stored.Normalize()
+	return stored, effective, err
+}
+
+// applyResourceBudget hands the limits to the parts that enforce them: the
+// scheduler, ingest hashing, and thumbnail rendering, with hashing held to
+// the power profile's hash workers. The I/O priority covers the whole
+// process, backups and their rsync and ssh children included.
+func (a *App) applyResourceBudget(b budget.Budget) error {
+	a.scheduler.SetMaxJobs(b.MaxJobs)
+	workers := a.currentPowerProfile().HashWorkers
+	threads := b.HashThreads
+	if workers > 0 {
+		threads = min(threads, workers)
+	}
+	a.ingestor.SetHashThreads(threads)
+	a.ingestor.SetMaxWorkers(workers)
+	a.thumbLimiter.SetLimit(threads)
+	return budget.SetIOPriority(b.IOPriority)
+}
+
+func (a *App) loadResourceBudget(ctx context.Context) {
+	_, b, err := a.resourceBudget(ctx)
+	if err != nil {
+		a.logger.Printf("resource budget ignored, using defaults: %v", err)
+		b = budget.Default()
+	}
+	if err := a.applyResourceBudget(b); err != nil {
+		a.logger.Printf("I/O priority %s: %v", b.IOPriority, err)
+	}
+}
+
+func (a *App) handleResourceBudgetGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	stored, b, err := a.resourceBudget(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read resource budget"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"settings": stored,
+		"budget":   b,
+		"defaults": budget.Default(),
+		"cpus":     runtime.NumCPU(),
+	})
+}
+
+func (a *App) handleResourceBudgetSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req budget.Budget
+	if err := decodeJSONBody(r, &req, 1<<16); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	b, err := req.Normalize()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := budget.SetIOPriority(b.IOPriority); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, budget.ErrUnsupported) {
+			status = http.StatusBadRequest
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	// Zero fields are saved as zero so they follow the library to other
+	// machines as "this machine's default".
+	req.IOPriority = b.IOPriority
+	raw, err := json.Marshal(req)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to encode resource budget"})
+		return
+	}
+	if err := a.store.SetSetting(r.Context(), budget.SettingKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save resource budget"})
+		return
+	}
+	_ = a.applyResourceBudget(b)
+	_ = a.audit.Log(r.Context(), authCtx.Username, "resource_budget_updated", map[string]any{
+		"max_jobs":     b.MaxJobs,
+		"hash_threads": b.HashThreads,
+		"io_priority":  b.IOPriority,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"settings": req, "budget": b})
+}
@@ -0,0 +1,270 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/autotag"
+	"businessplan/usbvault/internal/cloudsync"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/faces"
+	"businessplan/usbvault/internal/geocode"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/ocr"
+	"businessplan/usbvault/internal/scheduler"
+	"businessplan/usbvault/internal/similar"
+	"businessplan/usbvault/internal/timelapse"
+)
+
+// schedulerTick is how often the scheduler looks for due work, and how
+// quickly a running task is stopped once ingest or a backup starts.
+const schedulerTick = 30 * time.Second
+
+const (
+	geocodeBackfillBatch  = 30
+	thumbnailBackfillPage = 200
+)
+
+// busyReason reports what keeps heavy jobs from starting, or "": other
+// work, or a power profile that holds background jobs back.
+func (a *App) busyReason() string {
+	if reason := a.workReason(); reason != "" {
+		return reason
+	}
+	return a.powerJobsPaused()
+}
+
+// workReason reports the work under way that the vault must finish first,
+// or "".
+func (a *App) workReason() string {
+	in := a.ingestor.GetStatus()
+	switch in.State {
+	case "scanning", "ingesting", "waiting":
+		return "ingest is " + in.State
+	}
+	if a.backuper.GetStatus().State == "running" {
+		return "a backup is running"
+	}
+	if a.replicator != nil && a.replicator.GetStatus().State == "running" {
+		return "replication is running"
+	}
+	if a.migrateState().State == "running" {
+		return "a storage migration is running"
+	}
+	return ""
+}
+
+// registerScheduledTasks hands the heavy background jobs to the scheduler.
+// A manual run of the same job (POST /api/faces/scan and the like) makes a
+// scheduled one return ErrBusy, which counts as done.
+func (a *App) registerScheduledTasks() {
+	if geocode.Enabled() {
+		a.scheduler.Register(scheduler.Task{Name: "geocode_backfill", Interval: 5 * time.Minute, Priority: 60, Run: a.geocodeBackfill})
+	}
+	a.scheduler.Register(scheduler.Task{Name: "thumbnail_backfill", Interval: time.Hour, Priority: 50, Run: a.thumbnailBackfill})
+	a.scheduler.Register(scheduler.Task{
+		Name: "similar_index", Interval: similarIndexIntervalMinutes * time.Minute, Priority: 40,
+		Run: ignoreBusy(a.similar.RunOnce, similar.ErrBusy),
+	})
+	if a.faces != nil {
+		a.scheduler.Register(scheduler.Task{
+			Name: "face_scan", Interval: faceScanIntervalMinutes * time.Minute, Priority: 30,
+			Run: ignoreBusy(a.faces.RunOnce, faces.ErrBusy),
+		})
+	}
+	if a.autotagger != nil {
+		a.scheduler.Register(scheduler.Task{
+			Name: "auto_tag", Interval: autoTagIntervalMinutes * time.Minute, Priority: 30,
+			Run: ignoreBusy(a.autotagger.RunOnce, autotag.ErrBusy),
+		})
+	}
+	if a.ocr != nil {
+		a.scheduler.Register(scheduler.Task{
+			Name: "ocr", Interval: ocrIntervalMinutes * time.Minute, Priority: 20,
+			Run: ignoreBusy(a.ocr.RunOnce, ocr.ErrBusy),
+		})
+	}
+	if a.timelapse != nil {
+		a.scheduler.Register(scheduler.Task{
+			Name: "timelapse", Interval: timelapseIntervalMinutes * time.Minute, Priority: 15,
+			Run: ignoreBusy(a.timelapse.RunOnce, timelapse.ErrBusy),
+		})
+	}
+	a.scheduler.Register(scheduler.Task{Name: "place_match", Interval: placeMatchInterval, Priority: 50, Run: a.matchPlaces})
+	a.scheduler.Register(scheduler.Task{Name: "gpx_correlate", Interval: gpxCorrelateIntervalMinutes * time.Minute, Priority: 55, Run: a.scheduledGPXCorrelate})
+	a.scheduler.Register(scheduler.Task{Name: "album_publish", Interval: 5 * time.Minute, Priority: 45, Run: a.publishChangedAlbums})
+	a.scheduler.Register(scheduler.Task{
+		Name: "cloud_sync", Interval: cloudSyncInterval, Priority: 45,
+		Run: ignoreBusy(a.cloudSync.RunOnce, cloudsync.ErrBusy),
+	})
+	a.scheduler.Register(scheduler.Task{Name: "library_reconcile", Interval: libraryReconcileInterval, Priority: 25, Run: a.scheduledReconcile})
+	a.scheduler.Register(scheduler.Task{Name: "media_purge", Interval: purgeIntervalMinutes * time.Minute, Priority: 35, Run: a.purgeDue})
+	a.scheduler.Register(scheduler.Task{Name: "trash_purge", Interval: trashPurgeInterval, Priority: 35, Run: a.purgeTrash})
+	if hours := config.ScrubIntervalHours(); hours > 0 {
+		a.scheduler.Register(scheduler.Task{
+			Name: "library_scrub", Interval: time.Duration(hours) * time.Hour, Priority: 5,
+			Run: a.scheduledScrub(a.scrubSample),
+		})
+	}
+	if hours := config.RestoreDrillIntervalHours(); hours > 0 {
+		a.scheduler.Register(scheduler.Task{
+			Name: "restore_drill", Interval: time.Duration(hours) * time.Hour, Priority: 10,
+			Run: func(ctx context.Context) error {
+				a.runRestoreDrill(ctx, "system")
+				return nil
+			},
+		})
+	}
+}
+
+func ignoreBusy(run func(context.Context) error, busy error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if err := run(ctx); err != nil && !errors.Is(err, busy) {
+			return err
+		}
+		return nil
+	}
+}
+
+// loadSchedulerSettings applies the stored scheduler settings. Settings
+// that no longer validate (a task since removed) are logged and dropped.
+func (a *App) loadSchedulerSettings(ctx context.Context) {
+	raw, _, err := a.store.GetSetting(ctx, scheduler.SettingKey)
+	if err != nil {
+		a.logger.Printf("scheduler settings: %v", err)
+		return
+	}
+	settings, err := scheduler.ParseSettings(raw)
+	if err == nil {
+		settings, err = a.scheduler.Normalize(settings)
+	}
+	if err != nil {
+		a.logger.Printf("scheduler settings ignored: %v", err)
+		return
+	}
+	a.scheduler.SetSettings(settings)
+}
+
+// geocodeBackfill looks up places for items with GPS but no location, a
+// batch at a time, until a batch finds nothing more it can resolve.
+func (a *App) geocodeBackfill(ctx context.Context) error {
+	for ctx.Err() == nil {
+		todos, err := a.store.ListGeoTodos(ctx, geocodeBackfillBatch)
+		if err != nil {
+			return err
+		}
+		updated := 0
+		for _, t := range todos {
+			if ctx.Err() != nil {
+				break
+			}
+			loc, err := a.geocoder.Reverse(ctx, t.Lat, t.Lon)
+			if errors.Is(err, geocode.ErrUnavailable) {
+				// Misconfigured; every other item would fail the same way.
+				return err
+			}
+			if err != nil || loc == nil {
+				continue
+			}
+			rec := &db.MediaRecord{
+				LocProvider: toNullString(loc.Provider),
+				Country:     toNullString(loc.Country),
+				State:       toNullString(loc.State),
+				County:      toNullString(loc.County),
+				City:        toNullString(loc.City),
+				Road:        toNullString(loc.Road),
+				HouseNumber: toNullString(loc.HouseNumber),
+				Postcode:    toNullString(loc.Postcode),
+				DisplayName: toNullString(loc.DisplayName),
+			}
+			if err := a.store.UpdateMediaLocation(ctx, t.ID, rec); err == nil {
+				updated++
+			}
+		}
+		if updated == 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// thumbnailBackfill renders the thumbnails that are not cached yet, so the
+// grid never waits on a first view. It resumes after the last item it
+// reached when it was stopped, and starts over once it reaches the end.
+func (a *App) thumbnailBackfill(ctx context.Context) error {
+	baseStorage, _, err := a.store.GetSetting(ctx, baseStorageKey)
+	if err != nil {
+		return err
+	}
+	baseStorage = strings.TrimSpace(baseStorage)
+	if baseStorage == "" {
+		return nil
+	}
+	if err := a.posterBackfill(ctx, baseStorage); err != nil || ctx.Err() != nil {
+		return err
+	}
+	for {
+		page, err := a.store.ListImagesAfter(ctx, a.thumbBackfillAfter, thumbnailBackfillPage)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			a.thumbBackfillAfter = 0
+			return nil
+		}
+		for i := range page {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// Every size is rendered together, so the last one stands for all.
+			if _, err := os.Stat(media.ThumbnailPath(baseStorage, page[i].ID, media.ThumbLarge)); err != nil {
+				if _, err := a.thumbnail(ctx, &page[i], media.ThumbLarge); err != nil && !errors.Is(err, errNoThumbnail) {
+					a.logger.Printf("backfill thumbnail %d: %v", page[i].ID, err)
+				}
+			}
+			a.thumbBackfillAfter = page[i].ID
+		}
+	}
+}
+
+func (a *App) handleSchedulerGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	writeJSON(w, http.StatusOK, map[string]any{
+		"settings": a.scheduler.Settings(),
+		"status":   a.scheduler.GetStatus(),
+	})
+}
+
+func (a *App) handleSchedulerSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req scheduler.Settings
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	settings, err := a.scheduler.Normalize(req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to encode settings"})
+		return
+	}
+	if err := a.store.SetSetting(r.Context(), scheduler.SettingKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save settings"})
+		return
+	}
+	a.scheduler.SetSettings(settings)
+	_ = a.audit.Log(r.Context(), authCtx.Username, "scheduler_updated", map[string]any{
+		"max_load": settings.MaxLoad,
+		"tasks":    settings.Tasks,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"settings": a.scheduler.Settings()})
+}
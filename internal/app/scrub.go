@@ -0,0 +1,314 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/shrink"
+	"businessplan/usbvault/internal/storage"
+)
+
+// The library scrub checks that every recorded file is still at its
+// dest_path and re-hashes a random sample of them, or all of them, against
+// the SHA256 taken at ingest. What it finds goes in integrity_issues.
+
+const (
+	scrubPage        = 500
+	scrubIssueSample = 20
+	maxScrubSample   = 1_000_000
+)
+
+var errScrubBusy = errors.New("a scrub is already running")
+
+// scrubStatus is the progress of the running scrub, or the outcome of the
+// last one.
+type scrubStatus struct {
+	State      string `json:"state"` // idle, running, done, stopped, error
+	Actor      string `json:"actor,omitempty"`
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	// Sample is how many files are re-hashed; 0 re-hashes every file.
+	Sample      int    `json:"sample"`
+	Checked     int    `json:"checked"`
+	Hashed      int    `json:"hashed"`
+	BytesHashed int64  `json:"bytes_hashed"`
+	Missing     int    `json:"missing"`
+	Mismatched  int    `json:"mismatched"`
+	Unreadable  int    `json:"unreadable"`
+	Resolved    int    `json:"resolved"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (a *App) scrubState() scrubStatus {
+	a.scrubStateMu.Lock()
+	defer a.scrubStateMu.Unlock()
+	if a.scrub.State == "" {
+		return scrubStatus{State: "idle"}
+	}
+	return a.scrub
+}
+
+func (a *App) setScrubState(update func(*scrubStatus)) {
+	a.scrubStateMu.Lock()
+	update(&a.scrub)
+	a.scrubStateMu.Unlock()
+}
+
+// runScrub checks the library. sample is how many files to re-hash, or 0
+// for all. A scrub stopped by ctx reports what it got through.
+func (a *App) runScrub(ctx context.Context, actor string, sample int) error {
+	if !a.scrubMu.TryLock() {
+		return errScrubBusy
+	}
+	defer a.scrubMu.Unlock()
+
+	a.setScrubState(func(st *scrubStatus) {
+		*st = scrubStatus{State: "running", Actor: actor, StartedAt: time.Now().UTC().Format(time.RFC3339), Sample: sample}
+	})
+	issues, err := a.scrubLibrary(ctx, sample)
+	st := a.scrubState()
+	switch {
+	case err != nil:
+		st.State, st.Error = "error", err.Error()
+	case ctx.Err() != nil:
+		st.State = "stopped"
+	default:
+		st.State = "done"
+	}
+	st.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	a.setScrubState(func(cur *scrubStatus) { *cur = st })
+	if err != nil {
+		a.logger.Printf("library scrub: %v", err)
+		return err
+	}
+	_ = a.audit.Log(context.WithoutCancel(ctx), actor, "library_scrubbed", map[string]any{
+		"state":        st.State,
+		"sample":       st.Sample,
+		"checked":      st.Checked,
+		"hashed":       st.Hashed,
+		"bytes_hashed": st.BytesHashed,
+		"missing":      st.Missing,
+		"mismatched":   st.Mismatched,
+		"unreadable":   st.Unreadable,
+		"resolved":     st.Resolved,
+		"issue_sample": issues,
+	})
+	return nil
+}
+
+// scrubLibrary walks every record in id order and returns the ids of the
+// first issues it found.
+func (a *App) scrubLibrary(ctx context.Context, sample int) ([]int64, error) {
+	baseStorage, _, err := a.store.GetSetting(ctx, baseStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	// An unmounted drive would make every file look missing.
+	if base := strings.TrimSpace(baseStorage); base != "" && base != "." && storage.IsLocal(base) {
+		if info, err := os.Stat(filepath.Clean(base)); err != nil || !info.IsDir() {
+			return nil, errors.New("base storage is not available")
+		}
+	}
+	var toHash map[int64]bool
+	if sample > 0 {
+		if toHash, err = a.store.SampleMediaIDs(ctx, sample); err != nil {
+			return nil, err
+		}
+	}
+
+	issues := make([]int64, 0)
+	var after int64
+	for ctx.Err() == nil {
+		page, err := a.store.ListScrubTargets(ctx, after, scrubPage)
+		if err != nil {
+			return issues, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, t := range page {
+			if ctx.Err() != nil {
+				break
+			}
+			after = t.ID
+			hash := sample == 0 || toHash[t.ID]
+			issue, err := a.scrubFile(ctx, t, hash)
+			if ctx.Err() != nil {
+				break
+			}
+			if err != nil {
+				return issues, err
+			}
+			a.setScrubState(func(st *scrubStatus) {
+				st.Checked++
+				if hash && (issue == nil || issue.Kind == db.IntegrityMismatch) {
+					st.Hashed++
+					st.BytesHashed += t.SizeBytes
+				}
+				if issue == nil {
+					return
+				}
+				switch issue.Kind {
+				case db.IntegrityMissing:
+					st.Missing++
+				case db.IntegrityMismatch:
+					st.Mismatched++
+				default:
+					st.Unreadable++
+				}
+			})
+			if issue == nil {
+				// A file read whole clears any issue; one only found in
+				// place clears being missing.
+				kind := db.IntegrityMissing
+				if hash {
+					kind = ""
+				}
+				if resolved, err := a.store.ResolveIntegrityIssue(ctx, t.ID, kind); err != nil {
+					return issues, err
+				} else if resolved {
+					a.setScrubState(func(st *scrubStatus) { st.Resolved++ })
+				}
+				continue
+			}
+			if err := a.store.RecordIntegrityIssue(ctx, *issue); err != nil {
+				return issues, err
+			}
+			if len(issues) < scrubIssueSample {
+				issues = append(issues, t.ID)
+			}
+		}
+	}
+	return issues, nil
+}
+
+// scrubFile checks one file, re-hashing it when hash is set. It returns
+// the issue found, or nil; an error stops the scrub.
+func (a *App) scrubFile(ctx context.Context, t db.ScrubTarget, hash bool) (*db.IntegrityIssue, error) {
+	issue := &db.IntegrityIssue{MediaID: t.ID, DestPath: t.DestPath, ExpectedSHA256: t.SHA256}
+	if _, err := a.libraryStorage().Stat(ctx, t.DestPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			issue.Kind = db.IntegrityMissing
+		} else {
+			issue.Kind, issue.Detail = db.IntegrityUnreadable, err.Error()
+		}
+		return issue, nil
+	}
+	if !hash {
+		return nil, nil
+	}
+	f, err := a.openMediaFile(ctx, t.DestPath)
+	if err != nil {
+		issue.Kind, issue.Detail = db.IntegrityUnreadable, err.Error()
+		return issue, nil
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, scrubReader{ctx: ctx, r: f}); err != nil {
+		if errors.Is(err, libcrypt.ErrCorrupt) || errors.Is(err, shrink.ErrCorrupt) {
+			issue.Kind, issue.Detail = db.IntegrityMismatch, err.Error()
+			return issue, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+		issue.Kind, issue.Detail = db.IntegrityUnreadable, err.Error()
+		return issue, nil
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != t.SHA256 {
+		issue.Kind, issue.ActualSHA256 = db.IntegrityMismatch, got
+		return issue, nil
+	}
+	return nil, nil
+}
+
+// scrubReader stops a long hash when the scrub is stopped.
+type scrubReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (s scrubReader) Read(p []byte) (int, error) {
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.r.Read(p)
+}
+
+func (a *App) scheduledScrub(sample int) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if err := a.runScrub(ctx, "system", sample); err != nil && !errors.Is(err, errScrubBusy) {
+			return err
+		}
+		return nil
+	}
+}
+
+func (a *App) handleScrubStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	open, err := a.store.CountOpenIntegrityIssues(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": a.scrubState(), "open_issues": open})
+}
+
+func (a *App) handleScrubIssues(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	q := r.URL.Query()
+	items, err := a.store.ListIntegrityIssues(r.Context(), isTruthy(q.Get("resolved")), parsePositiveInt(q.Get("limit"), 1000))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+type scrubRunRequest struct {
+	// Sample is how many files to re-hash; All re-hashes every one.
+	Sample int  `json:"sample"`
+	All    bool `json:"all"`
+}
+
+// handleScrubRun starts a scrub now; its progress shows in the status.
+func (a *App) handleScrubRun(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req scrubRunRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSONBody(r, &req, 1<<12); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if req.Sample < 0 || req.Sample > maxScrubSample {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("sample must be between 1 and %d", maxScrubSample)})
+		return
+	}
+	sample := a.scrubSample
+	switch {
+	case req.All:
+		sample = 0
+	case req.Sample > 0:
+		sample = req.Sample
+	}
+	if a.scrubState().State == "running" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": errScrubBusy.Error()})
+		return
+	}
+	go func() {
+		_ = a.runScrub(context.Background(), authCtx.Username, sample)
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "sample": sample})
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestScrubFlagsAndClearsIssues(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	library := filepath.Join(root, "library")
+	if err := store.SetSetting(ctx, baseStorageKey, library); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	if err := os.MkdirAll(library, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	ids := map[string]int64{}
+	for _, name := range []string{"good.jpg", "rotten.jpg", "gone.jpg"} {
+		path := filepath.Join(library, name)
+		body := []byte("bytes of " + name)
+		if err := os.WriteFile(path, body, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(body)
+		rec := &db.MediaRecord{
+			Kind: "image", FileName: name, Extension: ".jpg", SourceMount: "/media/card",
+			SourcePath: "/media/card/" + name, DestPath: path, SizeBytes: int64(len(body)),
+			SHA256: hex.EncodeToString(sum[:]), CaptureTime: ts, Metadata: "{}", SourceMTime: ts, IngestedAt: ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		ids[name] = rec.ID
+	}
+	rotten := filepath.Join(library, "rotten.jpg")
+	if err := os.WriteFile(rotten, []byte("bytes of rotten.jpf"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(library, "gone.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+
+	if err := app.runScrub(ctx, "admin", 0); err != nil {
+		t.Fatalf("runScrub: %v", err)
+	}
+	st := app.scrubState()
+	if st.State != "done" || st.Checked != 3 || st.Hashed != 2 || st.Missing != 1 || st.Mismatched != 1 || st.Unreadable != 0 {
+		t.Fatalf("status = %+v", st)
+	}
+	issues, err := store.ListIntegrityIssues(ctx, false, 0)
+	if err != nil || len(issues) != 2 {
+		t.Fatalf("issues = %+v, %v", issues, err)
+	}
+	kinds := map[int64]string{}
+	for _, it := range issues {
+		kinds[it.MediaID] = it.Kind
+	}
+	if kinds[ids["rotten.jpg"]] != db.IntegrityMismatch || kinds[ids["gone.jpg"]] != db.IntegrityMissing {
+		t.Fatalf("kinds = %v", kinds)
+	}
+
+	// Put right from a backup, the file clears its issue at the next scrub.
+	if err := os.WriteFile(rotten, []byte("bytes of rotten.jpg"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.runScrub(ctx, "admin", 0); err != nil {
+		t.Fatalf("runScrub: %v", err)
+	}
+	if st := app.scrubState(); st.Resolved != 1 || st.Mismatched != 0 || st.Missing != 1 {
+		t.Fatalf("second status = %+v", st)
+	}
+	if n, _ := store.CountOpenIntegrityIssues(ctx); n != 1 {
+		t.Fatalf("open issues = %d", n)
+	}
+	if all, _ := store.ListIntegrityIssues(ctx, true, 0); len(all) != 2 {
+		t.Fatalf("all issues = %+v", all)
+	}
+
+	// An unmounted drive is not a library of missing files.
+	if err := os.RemoveAll(library); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.runScrub(ctx, "admin", 0); err == nil || app.scrubState().State != "error" {
+		t.Fatalf("scrub of an unmounted drive = %v, %+v", err, app.scrubState())
+	}
+}
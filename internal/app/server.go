@@ -2,7 +2,9 @@ package app
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -12,6 +14,7 @@ import (
 	"mime/multipart"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/exec"
 	"path"
@@ -19,22 +22,48 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"businessplan/usbvault/internal/alerts"
+	"businessplan/usbvault/internal/attest"
 	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/autotag"
 	"businessplan/usbvault/internal/backup"
+	"businessplan/usbvault/internal/budget"
+	"businessplan/usbvault/internal/clock"
+	"businessplan/usbvault/internal/cloudsync"
 	"businessplan/usbvault/internal/config"
 	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/dbcrypt"
+	"businessplan/usbvault/internal/display"
+	"businessplan/usbvault/internal/faces"
 	"businessplan/usbvault/internal/geocode"
+	"businessplan/usbvault/internal/hooks"
 	"businessplan/usbvault/internal/ingest"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/ocr"
+	"businessplan/usbvault/internal/pathname"
+	"businessplan/usbvault/internal/power"
+	"businessplan/usbvault/internal/preset"
+	"businessplan/usbvault/internal/provision"
+	"businessplan/usbvault/internal/replica"
+	"businessplan/usbvault/internal/rules"
+	"businessplan/usbvault/internal/scheduler"
 	"businessplan/usbvault/internal/security"
+	"businessplan/usbvault/internal/similar"
+	"businessplan/usbvault/internal/storage"
+	"businessplan/usbvault/internal/timelapse"
 	"businessplan/usbvault/internal/usb"
+	"businessplan/usbvault/internal/watermark"
 )
 
 const (
 	sessionCookieName = "uv_session"
 	baseStorageKey    = "base_storage_dir"
-	cloudSyncKey      = "cloud_sync_config"
+	cloudSyncKey      = cloudsync.SettingKey
 
 	uploadMaxRequestBytes = int64(8 << 30) // 8 GiB
 	uploadMaxFiles        = 2000
@@ -42,15 +71,107 @@ const (
 
 type App struct {
 	store      *db.Store
+	vault      *dbcrypt.Vault
+	libKey     *libcrypt.Key
+	storage    storage.Backend
+	attester   *attest.Signer
 	audit      *audit.Logger
 	backuper   *backup.Manager
 	ingestor   *ingest.Manager
 	geocoder   *geocode.ReverseGeocoder
+	hooks      *hooks.Runner
+	replicator *replica.Replicator
+	faces      *faces.Scanner
+	autotagger *autotag.Tagger
+	ocr        *ocr.Reader
+	similar    *similar.Indexer
+	cloudSync  *cloudsync.Syncer
+	timelapse  *timelapse.Assembler // nil unless enabled and ffmpeg is available
+	scheduler  *scheduler.Scheduler
 	watcher    *usb.Watcher
+	clock      *clock.Monitor
 	logger     *log.Logger
 	httpServer *http.Server
 	sessionTTL time.Duration
 	webDir     string
+
+	netMu           sync.RWMutex
+	allowedNetworks []netip.Prefix
+
+	headerMu     sync.RWMutex
+	headerPolicy config.HeaderPolicy
+	csp          string // built from headerPolicy
+
+	logLevel atomic.Value // string, from config.LogLevel
+
+	ffmpeg             string // video posters; empty when ffmpeg is unavailable
+	rawConverter       string // RAW renditions without an embedded preview; may be empty
+	streamCacheBytes   int64  // transcoded video kept for replay; 0 keeps none
+	streamJobs         atomic.Int32
+	streamCacheMu      sync.Mutex // held while the stream cache is trimmed
+	thumbWarmMu        sync.Mutex
+	thumbLimiter       *budget.Limiter
+	thumbBackfillAfter int64 // where the scheduled thumbnail backfill resumes
+
+	gpxMu sync.Mutex // held while media is matched against GPX tracks
+
+	purgeMu sync.Mutex // held while a scheduled purge runs or is cancelled
+
+	trashMu sync.Mutex // held while the trash is purged or restored from
+
+	reconcileMu sync.Mutex // held while the library folder is checked
+
+	scrubMu      sync.Mutex // held while the library is scrubbed
+	scrubStateMu sync.Mutex
+	scrub        scrubStatus
+	scrubSample  int // files a scrub re-hashes unless told otherwise; 0 is all
+
+	migrateStateMu sync.Mutex
+	migrate        migrateStatus
+	heldMounts     []string // cards plugged in while the storage migration runs
+
+	editMu     sync.Mutex // held by writes checked against If-Match
+	presenceMu sync.Mutex
+	presence   map[string]presence // open sessions by token hash
+
+	displayMu sync.RWMutex
+	display   *display.State // last state reported by the kiosk launcher
+
+	provMu sync.Mutex
+	prov   *provisioner // nil unless first-boot provisioning is running
+
+	fieldMu       sync.Mutex
+	fieldFailures int       // wrong PINs since the last unlock
+	fieldButtonAt time.Time // last hardware button press, zero once used
+
+	pairMu  sync.Mutex
+	pairing *pendingPairing // the QR code on offer, nil when none
+
+	recentMu     sync.Mutex
+	recentThumbs map[int64][]string // thumbnail URLs by user, most recent first
+
+	guestFlagMu  sync.Mutex
+	guestFlagged map[int64]time.Time // when each guest was last flagged as suspicious
+
+	benchBusy   atomic.Bool // a storage benchmark is running
+	publishBusy atomic.Bool // an album is being published
+
+	collectionMu sync.Mutex
+	collection   collectionStatus // latest collections drive export
+
+	powerMu      sync.Mutex
+	powerReading power.Reading
+	powerProfile power.Profile
+	powerErr     string    // why the last reading failed, "" when it worked
+	powerSince   time.Time // when the current state began
+	powerPolled  time.Time
+	idleSince    time.Time    // zero while the vault is working
+	idleFired    bool         // the power-idle hook ran for this idle stretch
+	lastRequest  atomic.Int64 // unix nanoseconds of the last request someone made
+
+	readOnly bool // serving an existing vault without changing it
+
+	tlsConfig *tls.Config // nil when serving plain HTTP
 }
 
 type contextKey string
@@ -58,36 +179,154 @@ type contextKey string
 const userKey contextKey = "user"
 
 type AuthContext struct {
-	UserID   int64
-	Username string
-	Token    string
+	UserID       int64
+	Username     string
+	Token        string
+	Role         string
+	ScopeAlbumID int64
+	Watermark    string // guests only; JSON watermark spec for images they view
+	StripGPS     bool   // guests only; files they view lose their position
+	Field        bool   // unlocked with the field-mode PIN
+	Device       string // paired device name, empty for a sign-in
+}
+
+func (c *AuthContext) IsGuest() bool {
+	return c != nil && c.Role == db.RoleGuest
 }
 
 func New(logger *log.Logger) (*App, error) {
-	store, err := db.Open(config.DBPath())
+	store, vault, err := dbcrypt.OpenStore(context.Background(), logger)
 	if err != nil {
 		return nil, err
 	}
 	auditLogger := audit.New(store)
+	clk := clock.New()
+	if latest, err := store.LatestTimestamp(context.Background()); err == nil {
+		clk.Observe(latest)
+	}
+	auditLogger.SetClock(clk)
 	geocoder := geocode.New(store)
-	backuper := backup.NewManager(store, logger)
-	ingestor := ingest.NewManager(store, auditLogger, geocoder, logger)
+	hookRunner := hooks.New(config.HooksDir(), time.Duration(config.HookTimeoutSeconds())*time.Second, logger)
+	auditLogger.SetObserver(alerts.New(store, hookRunner, logger))
+	backuper := backup.NewManager(store, hookRunner, logger)
+	ingestor := ingest.NewManager(store, auditLogger, geocoder, hookRunner, logger)
+	ingestor.SetClock(clk, time.Duration(config.ClockWaitMinutes())*time.Minute)
+	libStorage, err := newStorageBackend(store)
+	if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	ingestor.SetStorage(libStorage)
+
+	var libKey *libcrypt.Key
+	if config.LibraryEncryptionEnabled() {
+		passphrase, err := config.LibraryPassphrase()
+		if err != nil {
+			_ = store.Close()
+			return nil, err
+		}
+		libKey, err = libcrypt.LoadOrCreateKey(config.LibraryKeyPath(), passphrase)
+		clear(passphrase)
+		if err != nil {
+			_ = store.Close()
+			return nil, fmt.Errorf("library key: %w", err)
+		}
+		ingestor.SetLibraryKey(libKey)
+		backuper.SetLibraryKey(libKey)
+	}
+
+	var replicator *replica.Replicator
+	if source := config.ReplicaSource(); source != "" {
+		username, password, err := config.ReplicaCredentials()
+		if err != nil {
+			_ = store.Close()
+			return nil, err
+		}
+		replicator = replica.New(store, auditLogger, logger, source, username, password)
+		replicator.SetLibraryKey(libKey)
+	}
+
+	attester, err := attest.LoadOrCreateKey(config.AttestationKeyPath())
+	if err != nil {
+		_ = store.Close()
+		return nil, fmt.Errorf("attestation key: %w", err)
+	}
+
+	var faceScanner *faces.Scanner
+	if detector := config.FaceDetector(); detector != "" {
+		faceScanner = faces.New(store, logger, detector, time.Duration(config.VisionTimeoutSeconds())*time.Second)
+		faceScanner.SetLibraryKey(libKey)
+	}
+
+	var autotagger *autotag.Tagger
+	if classifier := config.AutoTagClassifier(); classifier != "" {
+		autotagger = autotag.New(store, logger, classifier, time.Duration(config.VisionTimeoutSeconds())*time.Second, config.AutoTagMinScore())
+		autotagger.SetLibraryKey(libKey)
+	}
+
+	similarIndex := similar.New(store, logger)
+	similarIndex.SetLibraryKey(libKey)
+
+	var ocrReader *ocr.Reader
+	if command := config.OCRCommand(); command != "" {
+		ocrReader = ocr.New(store, logger, command, time.Duration(config.VisionTimeoutSeconds())*time.Second, config.OCRTags())
+		ocrReader.SetLibraryKey(libKey)
+	}
 
 	application := &App{
 		store:      store,
+		vault:      vault,
+		libKey:     libKey,
+		storage:    libStorage,
+		attester:   attester,
 		audit:      auditLogger,
 		backuper:   backuper,
 		ingestor:   ingestor,
 		geocoder:   geocoder,
+		hooks:      hookRunner,
+		replicator: replicator,
+		faces:      faceScanner,
+		autotagger: autotagger,
+		ocr:        ocrReader,
+		similar:    similarIndex,
+		clock:      clk,
 		logger:     logger,
 		sessionTTL: time.Duration(config.DefaultSessionTTLHours) * time.Hour,
 		webDir:     resolveWebDir(),
 	}
 
-	interval := time.Duration(config.USBScanIntervalSeconds()) * time.Second
-	application.watcher = usb.NewWatcher(interval, logger, func(mount string) {
-		application.ingestor.QueueMount(mount)
+	application.thumbLimiter = budget.NewLimiter(budget.Default().HashThreads)
+	ingestor.SetThumbnailLimiter(application.thumbLimiter)
+	application.ffmpeg = config.FFmpegPath()
+	application.rawConverter = config.RAWConverterPath()
+	application.streamCacheBytes = int64(config.StreamCacheMB()) << 20
+	application.scrubSample = config.ScrubSampleSize()
+	ingestor.SetFFmpeg(application.ffmpeg)
+	if config.TimelapseEnabled() {
+		if application.ffmpeg == "" {
+			logger.Printf("time-lapse assembly needs ffmpeg, which is not available; it is off")
+		} else {
+			application.timelapse = timelapse.New(store, logger, application.ffmpeg, config.TimelapseFrameRate(), config.TimelapseMinFrames())
+			application.timelapse.SetLibraryKey(libKey)
+		}
+	}
+	application.cloudSync = cloudsync.New(store, logger, func(ctx context.Context, rec db.MediaRecord) (io.ReadSeekCloser, error) {
+		return application.openMediaFile(ctx, rec.DestPath)
+	}, func(rec db.MediaRecord) string {
+		return buildArchiveEntryName(rec, map[string]struct{}{})
 	})
+	application.scheduler = scheduler.New(logger, application.busyReason)
+	application.powerReading = power.Reading{State: power.StateMains, ChargePercent: -1}
+	application.powerProfile = power.DefaultProfiles()[power.StateMains]
+	application.registerScheduledTasks()
+
+	interval := time.Duration(config.USBScanIntervalSeconds()) * time.Second
+	application.watcher = usb.NewWatcher(interval, logger, application.queueMount)
+	application.applyRuntimeConfig()
+	if store.ReadOnly() {
+		application.readOnly = true
+		application.relocateReadOnlyLibrary(context.Background())
+	}
 
 	return application, nil
 }
@@ -98,149 +337,386 @@ func (a *App) Close() error {
 		defer cancel()
 		_ = a.httpServer.Shutdown(ctx)
 	}
-	return a.store.Close()
+	if a.vault == nil {
+		return a.store.Close()
+	}
+	sealErr := a.vault.Seal(context.Background(), a.store.Snapshot)
+	closeErr := a.store.Close()
+	if sealErr != nil {
+		// Keep the working copy so the unsealed changes can be recovered.
+		return fmt.Errorf("seal database: %w (working copy left at %s)", sealErr, a.vault.WorkPath())
+	}
+	a.vault.Wipe()
+	return closeErr
 }
 
 func (a *App) Run(ctx context.Context) error {
-	a.ingestor.Start(ctx)
-	a.watcher.Start(ctx)
+	if !a.clock.Trusted() {
+		a.logger.Printf("system clock reads %s, before the last recorded time; ingest waits for it to be set", time.Now().UTC().Format(time.RFC3339))
+	}
+	if a.readOnly {
+		a.logger.Printf("serving %s read-only; ingest, backups, replication and background jobs are off", config.ReadOnlyDBPath())
+	} else {
+		a.updatePower(ctx)
+		a.loadResourceBudget(ctx)
+		a.recoverAfterCrash(ctx)
+		a.ingestor.Start(ctx)
+		a.watcher.Start(ctx)
+
+		go a.sessionCleanupWorker(ctx)
+		go a.powerWorker(ctx)
+		if a.vault != nil {
+			go a.dbSealWorker(ctx)
+		}
+		if a.replicator != nil {
+			a.replicator.Start(ctx, time.Duration(config.ReplicaIntervalMinutes())*time.Minute)
+		}
+		a.loadSchedulerSettings(ctx)
+		a.scheduler.Start(ctx, schedulerTick)
+	}
 
-	go a.sessionCleanupWorker(ctx)
-	go a.geocodeBackfillWorker(ctx)
+	bindHost := config.BindAddr()
+	if err := a.loadTLS(bindHost); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	if err := checkBindExposure(bindHost, a.tlsConfig != nil); err != nil {
+		return err
+	}
+	if err := a.loadAllowedNetworks(ctx); err != nil {
+		return fmt.Errorf("allowed networks: %w", err)
+	}
+	if err := a.loadHeaderPolicy(ctx); err != nil {
+		return fmt.Errorf("security headers: %w", err)
+	}
+	if !config.IsLoopbackHost(bindHost) && a.tlsConfig == nil {
+		a.logger.Printf("WARNING: USB Vault is exposed beyond loopback on %s over plain HTTP; allowed networks: %v", bindHost, a.effectiveNetworks())
+	}
 
 	mux := http.NewServeMux()
 	a.registerRoutes(mux)
 
-	addr := net.JoinHostPort(defaultBindAddr(), strconv.Itoa(config.Port()))
+	var routes http.Handler = mux
+	if a.readOnly {
+		routes = a.readOnlyGuard(mux)
+	}
+	handler := withLocale(a.allowListMiddleware(a.securityHeaders(a.requestLogger(routes))))
+	if !a.readOnly {
+		if err := a.startProvisioning(ctx, handler); err != nil {
+			a.logger.Printf("provisioning unavailable, finish setup on this machine: %v", err)
+		}
+	}
+
+	addr := net.JoinHostPort(bindHost, strconv.Itoa(config.Port()))
 	a.httpServer = &http.Server{
 		Addr:              addr,
-		Handler:           a.securityHeaders(a.requestLogger(mux)),
+		Handler:           handler,
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       15 * time.Second,
 		WriteTimeout:      30 * time.Minute,
 		IdleTimeout:       60 * time.Second,
+		TLSConfig:         a.tlsConfig,
 	}
 
-	a.logger.Printf("USB Vault listening on http://%s", addr)
-	if err := a.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		return err
-	}
-	return nil
-}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = a.httpServer.Shutdown(shutdownCtx)
+	}()
 
-func (a *App) geocodeBackfillWorker(ctx context.Context) {
-	if !geocode.Enabled() {
-		return
+	a.logger.Printf("USB Vault listening on %s://%s", a.scheme(), addr)
+	var err error
+	if a.tlsConfig != nil {
+		err = a.httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = a.httpServer.ListenAndServe()
 	}
-
-	ticker := time.NewTicker(20 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			todos, err := a.store.ListGeoTodos(context.Background(), 30)
-			if err != nil || len(todos) == 0 {
-				continue
-			}
-			for _, t := range todos {
-				loc, err := a.geocoder.Reverse(context.Background(), t.Lat, t.Lon)
-				if err != nil || loc == nil {
-					continue
-				}
-				rec := &db.MediaRecord{
-					LocProvider: toNullString(loc.Provider),
-					Country:     toNullString(loc.Country),
-					State:       toNullString(loc.State),
-					County:      toNullString(loc.County),
-					City:        toNullString(loc.City),
-					Road:        toNullString(loc.Road),
-					HouseNumber: toNullString(loc.HouseNumber),
-					Postcode:    toNullString(loc.Postcode),
-					DisplayName: toNullString(loc.DisplayName),
-				}
-				_ = a.store.UpdateMediaLocation(context.Background(), t.ID, rec)
-			}
-		}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	return nil
 }
 
 func (a *App) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /", a.handleIndex)
-	mux.Handle("GET /web/", http.StripPrefix("/web/", http.FileServer(http.Dir(a.webDir))))
+	mux.Handle("GET /web/", withRevalidate(http.StripPrefix("/web/", http.FileServer(http.Dir(a.webDir)))))
+	mux.HandleFunc("GET /manifest.webmanifest", a.handleWebManifest)
+	mux.HandleFunc("GET /sw.js", a.handleServiceWorker)
+	mux.HandleFunc("GET /api/offline-manifest", a.handleOfflineManifest)
 
 	mux.HandleFunc("GET /api/status", a.handleStatus)
+	mux.HandleFunc("GET /api/health", a.handleHealth)
 	mux.HandleFunc("GET /api/ingest-status", a.withAuth(a.handleIngestStatus))
 	mux.HandleFunc("POST /api/ingest/pause", a.withAuth(a.handleIngestPause))
 	mux.HandleFunc("POST /api/ingest/resume", a.withAuth(a.handleIngestResume))
 	mux.HandleFunc("GET /api/backup-status", a.withAuth(a.handleBackupStatus))
+	mux.HandleFunc("GET /api/kiosk/summary", a.withAuth(a.handleKioskSummary))
+	mux.HandleFunc("GET /api/kiosk/media", a.withAuth(a.handleKioskMedia))
+	mux.HandleFunc("GET /api/kiosk/display", a.withAuth(a.handleKioskDisplayGet))
+	mux.HandleFunc("POST /api/kiosk/display", a.handleKioskDisplayReport)
+	mux.HandleFunc("GET /api/kiosk/console", a.handleKioskConsole)
 	mux.HandleFunc("POST /api/setup", a.handleSetup)
 	mux.HandleFunc("POST /api/login", a.handleLogin)
 	mux.HandleFunc("POST /api/logout", a.handleLogout)
+	mux.HandleFunc("POST /api/session/heartbeat", a.withAuth(a.handleSessionHeartbeat))
+	mux.HandleFunc("GET /api/recovery-codes", a.withAuth(a.handleRecoveryCodesStatus))
+	mux.HandleFunc("POST /api/recovery-codes", a.withAuth(a.handleRecoveryCodesRegenerate))
+	mux.HandleFunc("POST /api/field-mode/unlock", a.handleFieldUnlock)
+	mux.HandleFunc("POST /api/field-mode/button", a.handleFieldButton)
+	mux.HandleFunc("GET /api/field-mode", a.withAuth(a.handleFieldModeGet))
+	mux.HandleFunc("POST /api/field-mode", a.withAuth(a.handleFieldModeEnable))
+	mux.HandleFunc("DELETE /api/field-mode", a.withAuth(a.handleFieldModeDisable))
+	mux.HandleFunc("POST /api/mounts/eject", a.withAuth(a.handleMountEject))
+	mux.HandleFunc("POST /api/pair", a.handlePair)
+	mux.HandleFunc("POST /api/pairing", a.withAuth(a.handlePairingStart))
+	mux.HandleFunc("DELETE /api/pairing", a.withAuth(a.handlePairingCancel))
+	mux.HandleFunc("GET /api/pairing/qr", a.withAuth(a.handlePairingQR))
+	mux.HandleFunc("GET /api/devices", a.withAuth(a.handleDevicesList))
+	mux.HandleFunc("DELETE /api/devices/{id}", a.withAuth(a.handleDeviceRevoke))
+	mux.HandleFunc("GET /api/docs", a.withAuth(a.handleAPIDocs))
+	mux.HandleFunc("GET /api/openapi.json", a.withAuth(a.handleOpenAPISpec))
+	mux.HandleFunc("GET /api/tokens", a.withAuth(a.handleAPITokensList))
+	mux.HandleFunc("POST /api/tokens", a.withAuth(a.handleAPITokenCreate))
+	mux.HandleFunc("DELETE /api/tokens/{id}", a.withAuth(a.handleAPITokenRevoke))
 
 	mux.HandleFunc("GET /api/media", a.withAuth(a.handleMediaList))
+	mux.HandleFunc("PATCH /api/media/{id}", a.withAuth(a.handleMediaUpdate))
 	mux.HandleFunc("GET /api/media/{id}/content", a.withAuth(a.handleMediaContent))
+	mux.HandleFunc("GET /api/media/{id}/thumb", a.withAuth(a.handleMediaThumb))
+	mux.HandleFunc("GET /api/media/{id}/thumbnail", a.withAuth(a.handleMediaThumb))
 	mux.HandleFunc("GET /api/media/{id}/download", a.withAuth(a.handleMediaDownload))
+	mux.HandleFunc("GET /api/media/{id}/stream", a.withAuth(a.handleMediaStream))
+	mux.HandleFunc("GET /api/media/by-hash/{sha256}/download", a.withAuth(a.handleMediaByHashDownload))
+	mux.HandleFunc("GET /api/media/{id}/sidecars", a.withAuth(a.handleMediaSidecars))
+	mux.HandleFunc("GET /api/media/{id}/sidecars/{sid}/download", a.withAuth(a.handleMediaSidecarDownload))
+	mux.HandleFunc("GET /api/media/{id}/same-content", a.withAuth(a.handleMediaSameContent))
+	mux.HandleFunc("GET /api/media/{id}/faces", a.withAuth(a.handleMediaFaces))
+	mux.HandleFunc("POST /api/faces/{id}/name", a.withAuth(a.withVersion(a.faceVersion, a.handleFaceName)))
+	mux.HandleFunc("GET /api/faces/status", a.withAuth(a.handleFaceScanStatus))
+	mux.HandleFunc("POST /api/faces/scan", a.withAuth(a.handleFaceScanRun))
+	mux.HandleFunc("GET /api/people", a.withAuth(a.handlePeople))
+	mux.HandleFunc("GET /api/auto-tags", a.withAuth(a.handleAutoTagGroups))
+	mux.HandleFunc("GET /api/auto-tags/status", a.withAuth(a.handleAutoTagStatus))
+	mux.HandleFunc("POST /api/auto-tags/scan", a.withAuth(a.handleAutoTagRun))
+	mux.HandleFunc("GET /api/media/{id}/text", a.withAuth(a.handleMediaText))
+	mux.HandleFunc("GET /api/ocr/status", a.withAuth(a.handleOCRStatus))
+	mux.HandleFunc("POST /api/ocr/scan", a.withAuth(a.handleOCRRun))
+	mux.HandleFunc("GET /api/media/{id}/similar", a.withAuth(a.handleMediaSimilar))
+	mux.HandleFunc("GET /api/media/{id}/attestation", a.withAuth(a.handleMediaAttestation))
+	mux.HandleFunc("GET /api/media/{id}/custody", a.withAuth(a.handleMediaCustody))
+	mux.HandleFunc("GET /api/similar/status", a.withAuth(a.handleSimilarStatus))
+	mux.HandleFunc("GET /api/media/{id}/timelapse", a.withAuth(a.handleMediaTimelapse))
+	mux.HandleFunc("POST /api/library/reconcile", a.withAuth(a.handleLibraryReconcile))
+	mux.HandleFunc("POST /api/scrub", a.withAuth(a.handleScrubRun))
+	mux.HandleFunc("GET /api/scrub/status", a.withAuth(a.handleScrubStatus))
+	mux.HandleFunc("GET /api/scrub/issues", a.withAuth(a.handleScrubIssues))
+	mux.HandleFunc("POST /api/gpx/import", a.withAuth(a.handleGPXImport))
+	mux.HandleFunc("POST /api/gpx/correlate", a.withAuth(a.handleGPXCorrelate))
+	mux.HandleFunc("GET /api/gpx/tracks", a.withAuth(a.handleGPXTracks))
+	mux.HandleFunc("DELETE /api/gpx/tracks/{id}", a.withAuth(a.handleGPXTrackDelete))
+	mux.HandleFunc("GET /api/timelapses", a.withAuth(a.handleTimelapses))
+	mux.HandleFunc("GET /api/timelapses/status", a.withAuth(a.handleTimelapseStatus))
+	mux.HandleFunc("POST /api/timelapses/scan", a.withAuth(a.handleTimelapseRun))
+	mux.HandleFunc("GET /api/timelapses/{id}", a.withAuth(a.handleTimelapse))
+	mux.HandleFunc("GET /api/timelapses/{id}/video", a.withAuth(a.handleTimelapseVideo))
+	mux.HandleFunc("POST /api/timelapses/{id}/retry", a.withAuth(a.handleTimelapseRetry))
 	mux.HandleFunc("POST /api/media/download-zip", a.withAuth(a.handleMediaDownloadZip))
 	mux.HandleFunc("POST /api/media/upload", a.withAuth(a.handleMediaUpload))
 	mux.HandleFunc("POST /api/media/delete", a.withAuth(a.handleMediaDelete))
+	mux.HandleFunc("POST /api/media/edit", a.withAuth(a.handleMediaEdit))
+	mux.HandleFunc("GET /api/purges", a.withAuth(a.handlePurgesList))
+	mux.HandleFunc("DELETE /api/purges/{id}", a.withAuth(a.handlePurgeCancel))
+	mux.HandleFunc("GET /api/trash", a.withAuth(a.handleTrashList))
+	mux.HandleFunc("POST /api/trash/restore", a.withAuth(a.handleTrashRestore))
+	mux.HandleFunc("POST /api/trash/retention", a.withAuth(a.handleTrashRetention))
+	mux.HandleFunc("GET /api/legal-holds", a.withAuth(a.handleLegalHoldsList))
+	mux.HandleFunc("POST /api/legal-holds", a.withAuth(a.handleLegalHoldsPlace))
+	mux.HandleFunc("DELETE /api/legal-holds/{sha256}", a.withAuth(a.handleLegalHoldRelease))
 	mux.HandleFunc("GET /api/albums", a.withAuth(a.handleAlbumsList))
 	mux.HandleFunc("POST /api/albums", a.withAuth(a.handleAlbumsCreate))
-	mux.HandleFunc("POST /api/albums/{id}/add", a.withAuth(a.handleAlbumAdd))
-	mux.HandleFunc("POST /api/albums/{id}/remove", a.withAuth(a.handleAlbumRemove))
+	mux.HandleFunc("GET /api/albums/{id}", a.withAuth(a.withVersion(a.albumVersion, a.handleAlbumGet)))
+	mux.HandleFunc("PATCH /api/albums/{id}", a.withAuth(a.withVersion(a.albumVersion, a.handleAlbumRename)))
+	mux.HandleFunc("DELETE /api/albums/{id}", a.withAuth(a.withVersion(a.albumVersion, a.handleAlbumDelete)))
+	mux.HandleFunc("POST /api/albums/{id}/items", a.withAuth(a.withVersion(a.albumVersion, a.handleAlbumAdd)))
+	mux.HandleFunc("POST /api/albums/{id}/add", a.withAuth(a.withVersion(a.albumVersion, a.handleAlbumAdd)))
+	mux.HandleFunc("POST /api/albums/{id}/remove", a.withAuth(a.withVersion(a.albumVersion, a.handleAlbumRemove)))
 	mux.HandleFunc("POST /api/albums/{id}/open-folder", a.withAuth(a.handleAlbumOpenFolder))
+	mux.HandleFunc("GET /api/albums/{id}/attestation", a.withAuth(a.handleAlbumAttestation))
+	mux.HandleFunc("GET /api/albums/{id}/custody", a.withAuth(a.handleAlbumCustody))
+	mux.HandleFunc("GET /api/attestation-key", a.withAuth(a.handleAttestationKey))
+	mux.HandleFunc("GET /api/collections/export", a.withAuth(a.handleCollectionStatus))
+	mux.HandleFunc("POST /api/collections/export", a.withAuth(a.handleCollectionExport))
 	mux.HandleFunc("GET /api/map", a.withAuth(a.handleMap))
+	mux.HandleFunc("GET /api/map/clusters", a.withAuth(a.handleMapClusters))
+	mux.HandleFunc("GET /api/map/coverage-gaps", a.withAuth(a.handleCoverageGaps))
+	mux.HandleFunc("GET /api/map/bookmarks", a.withAuth(a.handleMapBookmarksList))
+	mux.HandleFunc("POST /api/map/bookmarks", a.withAuth(a.handleMapBookmarkCreate))
+	mux.HandleFunc("POST /api/map/bookmarks/{id}", a.withAuth(a.handleMapBookmarkUpdate))
+	mux.HandleFunc("DELETE /api/map/bookmarks/{id}", a.withAuth(a.handleMapBookmarkDelete))
+	mux.HandleFunc("GET /api/places", a.withAuth(a.handlePlacesList))
+	mux.HandleFunc("POST /api/places", a.withAuth(a.handlePlaceCreate))
+	mux.HandleFunc("POST /api/places/{id}", a.withAuth(a.handlePlaceUpdate))
+	mux.HandleFunc("DELETE /api/places/{id}", a.withAuth(a.handlePlaceDelete))
 	mux.HandleFunc("GET /api/device-groups", a.withAuth(a.handleDeviceGroups))
 	mux.HandleFunc("GET /api/location-groups", a.withAuth(a.handleLocationGroups))
+	mux.HandleFunc("GET /api/source-folders", a.withAuth(a.handleSourceFolders))
+	mux.HandleFunc("GET /api/stats", a.withAuth(a.handleStats))
+	mux.HandleFunc("GET /api/stats/ingest-speed", a.withAuth(a.handleIngestSpeed))
+	mux.HandleFunc("GET /api/diagnostics/queries", a.withAuth(a.handleQueryDiagnostics))
 	mux.HandleFunc("GET /api/audit", a.withAuth(a.handleAudit))
+	mux.HandleFunc("GET /api/export/db", a.withAuth(a.handleExportDB))
+	mux.HandleFunc("GET /api/checksums", a.withAuth(a.handleChecksumsExport))
+	mux.HandleFunc("POST /api/checksums/compare", a.withAuth(a.handleChecksumsCompare))
+	mux.HandleFunc("GET /api/alerts", a.withAuth(a.handleAlertsList))
+	mux.HandleFunc("POST /api/alerts/ack", a.withAuth(a.handleAlertsAck))
+	mux.HandleFunc("GET /api/guests", a.withAuth(a.handleGuestsList))
+	mux.HandleFunc("POST /api/guests", a.withAuth(a.handleGuestsCreate))
+	mux.HandleFunc("DELETE /api/guests/{id}", a.withAuth(a.handleGuestsDelete))
+	mux.HandleFunc("GET /api/guests/{id}/activity", a.withAuth(a.handleGuestActivity))
+	mux.HandleFunc("GET /api/watermarks", a.withAuth(a.handleWatermarksList))
+	mux.HandleFunc("POST /api/watermarks", a.withAuth(a.handleWatermarkUpload))
 	mux.HandleFunc("POST /api/backup", a.withAuth(a.handleBackupStart))
+	mux.HandleFunc("GET /api/backup-filter", a.withAuth(a.withVersion(a.settingVersion(backup.FilterSettingKey), a.handleBackupFilterGet)))
+	mux.HandleFunc("POST /api/backup-filter", a.withAuth(a.withVersion(a.settingVersion(backup.FilterSettingKey), a.handleBackupFilterSet)))
+	mux.HandleFunc("GET /api/location-privacy", a.withAuth(a.withVersion(a.settingVersion(locationPrivacyKey), a.handleLocationPrivacyGet)))
+	mux.HandleFunc("POST /api/location-privacy", a.withAuth(a.withVersion(a.settingVersion(locationPrivacyKey), a.handleLocationPrivacySet)))
+	mux.HandleFunc("GET /api/backup-s3", a.withAuth(a.withVersion(a.settingVersion(backup.S3SettingKey), a.handleBackupS3Get)))
+	mux.HandleFunc("POST /api/backup-s3", a.withAuth(a.withVersion(a.settingVersion(backup.S3SettingKey), a.handleBackupS3Set)))
+	mux.HandleFunc("GET /api/backup-ssh", a.withAuth(a.withVersion(a.settingVersion(backup.SSHSettingKey), a.handleBackupSSHGet)))
+	mux.HandleFunc("POST /api/backup-ssh", a.withAuth(a.withVersion(a.settingVersion(backup.SSHSettingKey), a.handleBackupSSHSet)))
+	mux.HandleFunc("GET /api/scheduler", a.withAuth(a.withVersion(a.settingVersion(scheduler.SettingKey), a.handleSchedulerGet)))
+	mux.HandleFunc("POST /api/scheduler", a.withAuth(a.withVersion(a.settingVersion(scheduler.SettingKey), a.handleSchedulerSet)))
+	mux.HandleFunc("GET /api/resource-budget", a.withAuth(a.withVersion(a.settingVersion(budget.SettingKey), a.handleResourceBudgetGet)))
+	mux.HandleFunc("POST /api/system/reload", a.withAuth(a.handleSystemReload))
+	mux.HandleFunc("POST /api/resource-budget", a.withAuth(a.withVersion(a.settingVersion(budget.SettingKey), a.handleResourceBudgetSet)))
+	mux.HandleFunc("GET /api/restore-drills", a.withAuth(a.handleRestoreDrillsList))
+	mux.HandleFunc("POST /api/restore-drills", a.withAuth(a.handleRestoreDrillRun))
+	mux.HandleFunc("GET /api/replica-status", a.withAuth(a.handleReplicaStatus))
+	mux.HandleFunc("POST /api/replica/run", a.withAuth(a.handleReplicaRun))
 	mux.HandleFunc("GET /api/mount-policy", a.withAuth(a.handleMountPolicyGet))
-	mux.HandleFunc("POST /api/excluded-mounts", a.withAuth(a.handleExcludedMountsSet))
-	mux.HandleFunc("POST /api/storage", a.withAuth(a.handleSetStorage))
+	mux.HandleFunc("POST /api/excluded-mounts", a.withAuth(a.withVersion(a.settingVersion(config.ExcludedMountsSettingKey), a.handleExcludedMountsSet)))
+	mux.HandleFunc("POST /api/storage", a.withAuth(a.withVersion(a.settingVersion(baseStorageKey), a.handleSetStorage)))
+	mux.HandleFunc("GET /api/storage/usage", a.withAuth(a.handleStorageUsage))
+	mux.HandleFunc("POST /api/storage/migrate", a.withAuth(a.handleStorageMigrate))
+	mux.HandleFunc("GET /api/storage/migrate", a.withAuth(a.handleStorageMigrateStatus))
+	mux.HandleFunc("GET /api/storage/benchmarks", a.withAuth(a.handleStorageBenchmarksList))
+	mux.HandleFunc("POST /api/storage/benchmarks", a.withAuth(a.handleStorageBenchmarkRun))
 	mux.HandleFunc("POST /api/rescan", a.withAuth(a.handleRescan))
-	mux.HandleFunc("GET /api/cloud-sync", a.withAuth(a.handleCloudSyncGet))
-	mux.HandleFunc("POST /api/cloud-sync", a.withAuth(a.handleCloudSyncSet))
+	mux.HandleFunc("GET /api/allowed-networks", a.withAuth(a.withVersion(a.settingVersion(config.AllowedNetworksSettingKey), a.handleAllowedNetworksGet)))
+	mux.HandleFunc("POST /api/allowed-networks", a.withAuth(a.withVersion(a.settingVersion(config.AllowedNetworksSettingKey), a.handleAllowedNetworksSet)))
+	mux.HandleFunc("GET /api/security-headers", a.withAuth(a.withVersion(a.settingVersion(config.SecurityHeadersSettingKey), a.handleSecurityHeadersGet)))
+	mux.HandleFunc("POST /api/security-headers", a.withAuth(a.withVersion(a.settingVersion(config.SecurityHeadersSettingKey), a.handleSecurityHeadersSet)))
+	mux.HandleFunc("GET /api/ingest-rules", a.withAuth(a.withVersion(a.settingVersion(rules.SettingKey), a.handleIngestRulesGet)))
+	mux.HandleFunc("POST /api/ingest-rules", a.withAuth(a.withVersion(a.settingVersion(rules.SettingKey), a.handleIngestRulesSet)))
+	mux.HandleFunc("GET /api/ingest-skip", a.withAuth(a.withVersion(a.settingVersion(ingest.SkipSettingKey), a.handleIngestSkipGet)))
+	mux.HandleFunc("POST /api/ingest-skip", a.withAuth(a.withVersion(a.settingVersion(ingest.SkipSettingKey), a.handleIngestSkipSet)))
+	mux.HandleFunc("GET /api/export-presets", a.withAuth(a.withVersion(a.settingVersion(preset.SettingKey), a.handleExportPresetsGet)))
+	mux.HandleFunc("POST /api/export-presets", a.withAuth(a.withVersion(a.settingVersion(preset.SettingKey), a.handleExportPresetsSet)))
+	mux.HandleFunc("GET /api/cloud-sync", a.withAuth(a.withVersion(a.settingVersion(cloudSyncKey), a.handleCloudSyncGet)))
+	mux.HandleFunc("POST /api/cloud-sync", a.withAuth(a.withVersion(a.settingVersion(cloudSyncKey), a.handleCloudSyncSet)))
+	mux.HandleFunc("GET /api/cloud-sync/status", a.withAuth(a.handleCloudSyncStatus))
+	mux.HandleFunc("GET /api/cloud-sync/preview", a.withAuth(a.handleCloudSyncPreview))
+	mux.HandleFunc("GET /api/power", a.withAuth(a.withVersion(a.settingVersion(power.SettingKey), a.handlePowerGet)))
+	mux.HandleFunc("POST /api/power", a.withAuth(a.withVersion(a.settingVersion(power.SettingKey), a.handlePowerSet)))
+	mux.HandleFunc("GET /api/publish-targets", a.withAuth(a.handlePublishTargetsList))
+	mux.HandleFunc("POST /api/publish-targets", a.withAuth(a.handlePublishTargetSave))
+	mux.HandleFunc("DELETE /api/publish-targets/{id}", a.withAuth(a.handlePublishTargetDelete))
+	mux.HandleFunc("POST /api/publish-targets/{id}/publish", a.withAuth(a.handlePublishTargetRun))
 }
 
 func (a *App) withAuth(next func(http.ResponseWriter, *http.Request, *AuthContext)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authCtx, ok := a.authFromRequest(r)
-		if !ok {
+		authCtx, err := a.lookupAuth(r)
+		if err != nil {
+			a.logger.Printf("session lookup for %s: %v", r.URL.Path, err)
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "database busy, try again"})
+			return
+		}
+		if authCtx == nil {
 			writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "authentication required"})
 			return
 		}
+		if authCtx.IsGuest() && !guestAllowedRoute(r.Pattern) {
+			writeJSON(w, http.StatusForbidden, map[string]any{"error": "not available to guest accounts"})
+			return
+		}
+		if authCtx.IsGuest() && !a.readOnly {
+			a.recordGuestAccess(r, authCtx)
+		}
+		if authCtx.Field && !fieldAllowedRoute(r.Pattern) {
+			writeJSON(w, http.StatusForbidden, map[string]any{"error": "not available in field mode; sign in with your password"})
+			return
+		}
 		next(w, r, authCtx)
 	}
 }
 
 func (a *App) handleIndex(w http.ResponseWriter, r *http.Request) {
 	indexPath := filepath.Join(a.webDir, "index.html")
+	w.Header().Set("Cache-Control", "no-cache")
 	http.ServeFile(w, r, indexPath)
 }
 
 func (a *App) handleStatus(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	// The UI polls this throughout an ingest; it answers from the read
+	// pool, and fails fast rather than hang if even that is stuck.
+	ctx, cancel := context.WithTimeout(r.Context(), priorityQueryTimeout)
+	defer cancel()
 	hasUsers, err := a.store.HasUsers(ctx)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		writeJSON(w, statusQueryError(err), map[string]string{"error": "database unavailable"})
 		return
 	}
 	storageDir, hasStorage, err := a.store.GetSetting(ctx, baseStorageKey)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		writeJSON(w, statusQueryError(err), map[string]string{"error": "database unavailable"})
 		return
 	}
-	_, authed := a.authFromRequest(r)
+	authCtx, authed := a.authFromRequest(r)
+	role := ""
+	if authed {
+		role = authCtx.Role
+		if authCtx.IsGuest() || authCtx.Field {
+			storageDir = ""
+		}
+	}
+	field, _ := a.fieldMode(ctx)
+	headers, _ := a.currentHeaderPolicy()
 	writeJSON(w, http.StatusOK, map[string]any{
 		"has_users":     hasUsers,
 		"has_storage":   hasStorage,
 		"storage_dir":   storageDir,
 		"authenticated": authed,
+		"role":          role,
+		// Field mode: the session is PIN-limited, and the sign-in screen
+		// can offer the PIN pad.
+		"field_session": authed && authCtx.Field,
+		"field_mode":    field.active(time.Now()),
+		// The map tile source; the CSP allows exactly this origin.
+		"map_tiles":       headers.MapTiles,
+		"map_attribution": headers.MapAttribution,
+		// First-boot provisioning: remote setup needs the code shown on
+		// the vault, and may choose a Wi-Fi network.
+		"setup_code_required": !hasUsers && isProvisionRequest(r),
+		"network_setup":       !hasUsers && config.ProvisioningEnabled(),
+		// Read-only mode: the UI hides what it cannot do.
+		"read_only": a.readOnly,
 	})
 }
 
+// priorityQueryTimeout bounds the lookups every request makes, and the
+// status polls, so they never queue for long behind an ingest or export.
+const priorityQueryTimeout = 3 * time.Second
+
+// statusQueryError is the status code for a failed priority lookup: 503
+// when it ran out of time, so clients retry.
+func statusQueryError(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
 func (a *App) handleIngestStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
 	_ = authCtx
 	writeJSON(w, http.StatusOK, a.ingestor.GetStatus())
@@ -273,10 +749,42 @@ func (a *App) handleBackupStatus(w http.ResponseWriter, r *http.Request, authCtx
 	writeJSON(w, http.StatusOK, a.backuper.GetStatus())
 }
 
+func (a *App) handleReplicaStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	if a.replicator == nil {
+		writeJSON(w, http.StatusOK, replica.Status{State: "disabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, a.replicator.GetStatus())
+}
+
+// handleReplicaRun starts a pull now instead of waiting for the next tick.
+func (a *App) handleReplicaRun(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	if a.replicator == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "replication is not configured"})
+		return
+	}
+	if a.replicator.GetStatus().State == "running" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": replica.ErrBusy.Error()})
+		return
+	}
+	go func() {
+		if err := a.replicator.RunOnce(context.Background()); err != nil && !errors.Is(err, replica.ErrBusy) {
+			a.logger.Printf("replication failed: %v", err)
+		}
+	}()
+	_ = a.audit.Log(r.Context(), authCtx.Username, "replication_started", map[string]any{"source": config.ReplicaSource()})
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
+}
+
 type setupRequest struct {
 	Username       string `json:"username"`
 	Password       string `json:"password"`
 	BaseStorageDir string `json:"base_storage_dir"`
+	// Provisioning only: the code shown on the vault, and optionally the
+	// Wi-Fi network to join once setup is done.
+	SetupCode string          `json:"setup_code"`
+	Network   *provision.WiFi `json:"network"`
 }
 
 func (a *App) handleSetup(w http.ResponseWriter, r *http.Request) {
@@ -290,12 +798,34 @@ func (a *App) handleSetup(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusConflict, map[string]string{"error": "setup already completed"})
 		return
 	}
+	provisioning := isProvisionRequest(r)
+	if !isLoopbackRequest(r) && !provisioning {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": errSetupRemote.Error()})
+		return
+	}
 
 	var req setupRequest
 	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	if provisioning {
+		if err := a.checkSetupCode(req.SetupCode); err != nil {
+			_ = a.audit.Log(ctx, "anonymous", "setup_code_rejected", map[string]any{"ip": clientIP(r)})
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if req.Network != nil {
+		if !config.ProvisioningEnabled() {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "network settings are only accepted in provisioning mode"})
+			return
+		}
+		if err := req.Network.Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
 
 	if !security.ValidateUsername(req.Username) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "username must be 3-64 chars [a-zA-Z0-9._-]"})
@@ -315,6 +845,10 @@ func (a *App) handleSetup(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "base_storage_dir must be an absolute path"})
 		return
 	}
+	if a.migrateState().State == "running" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": errMigrateBusy.Error()})
+		return
+	}
 	if err := os.MkdirAll(base, 0o750); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unable to create base storage directory"})
 		return
@@ -335,22 +869,49 @@ func (a *App) handleSetup(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save storage path"})
 		return
 	}
+	codes, err := a.issueRecoveryCodes(ctx, userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create recovery codes"})
+		return
+	}
 
-	if err := a.audit.Log(ctx, req.Username, "setup_completed", map[string]any{"storage_dir": filepath.Clean(base)}); err != nil {
+	details := map[string]any{"storage_dir": filepath.Clean(base), "recovery_codes": len(codes)}
+	if provisioning {
+		details["ip"] = clientIP(r)
+	}
+	if req.Network != nil {
+		details["wifi_ssid"] = req.Network.SSID
+	}
+	if err := a.audit.Log(ctx, req.Username, "setup_completed", details); err != nil {
 		a.logger.Printf("audit error: %v", err)
 	}
 
-	if err := a.issueSession(w, userID, req.Username); err != nil {
+	if err := a.issueSession(w, userID, req.Username, time.Time{}); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create session"})
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]any{"ok": true})
+	// Provisioning ends with setup. The delay lets this response reach a
+	// client on the access point before it goes down.
+	go func() {
+		time.Sleep(2 * time.Second)
+		a.stopProvisioning(context.Background(), req.Network)
+	}()
+	// The codes are shown this once; only their hashes are kept.
+	resp := map[string]any{"ok": true, "recovery_codes": codes}
+	if req.Network != nil {
+		resp["wifi_ssid"] = req.Network.SSID
+	}
+	writeJSON(w, http.StatusCreated, resp)
 }
 
 type loginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Instead of the password: a recovery code, and the new password it
+	// sets.
+	RecoveryCode string `json:"recovery_code"`
+	NewPassword  string `json:"new_password"`
 }
 
 func (a *App) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -363,21 +924,40 @@ func (a *App) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	throttleKeys := loginThrottleKeys(r, req.Username)
+	if a.loginLocked(w, r, throttleKeys) {
+		return
+	}
+
 	user, err := a.store.GetUserByUsername(ctx, req.Username)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
 		return
 	}
+	if strings.TrimSpace(req.RecoveryCode) != "" {
+		a.loginWithRecoveryCode(w, r, req, user, throttleKeys)
+		return
+	}
 	if user == nil || !security.VerifyPassword(req.Password, user.PasswordHash, user.Salt) {
+		_ = a.audit.Log(ctx, "anonymous", "login_failed", map[string]any{
+			"username": truncateForAudit(req.Username, 64),
+			"ip":       peerIP(r),
+		})
+		a.recordLoginFailure(ctx, r, req.Username, throttleKeys)
 		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
 		return
 	}
+	_ = a.store.ClearLoginFailures(ctx, throttleKeys...)
+	if user.Expired(time.Now().UTC()) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "account expired"})
+		return
+	}
 
-	if err := a.issueSession(w, user.ID, user.Username); err != nil {
+	if err := a.issueSession(w, user.ID, user.Username, user.ExpiresAt); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create session"})
 		return
 	}
-	_ = a.audit.Log(ctx, user.Username, "login", map[string]any{"ip": clientIP(r)})
+	_ = a.audit.Log(ctx, user.Username, "login", map[string]any{"ip": peerIP(r)})
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
 
@@ -396,12 +976,12 @@ func (a *App) handleLogout(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 		SameSite: http.SameSiteStrictMode,
 		MaxAge:   -1,
+		Secure:   a.tlsConfig != nil,
 	})
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
 
 func (a *App) handleMediaList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
-	_ = authCtx
 	page := parsePositiveInt(r.URL.Query().Get("page"), 1)
 	size := parsePositiveInt(r.URL.Query().Get("size"), 120)
 	if size > 500 {
@@ -414,55 +994,141 @@ func (a *App) handleMediaList(w http.ResponseWriter, r *http.Request, authCtx *A
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	applyGuestScope(authCtx, &filter)
 	records, err := a.store.ListMediaFiltered(r.Context(), r.URL.Query().Get("sort"), r.URL.Query().Get("order"), size, offset, filter)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
 		return
 	}
 
+	hide := false
+	if authCtx.IsGuest() {
+		if hide, err = a.stripLocation(r.Context(), authCtx, false); err != nil {
+			a.logger.Printf("location privacy: %v", err)
+		}
+	}
 	items := make([]map[string]any, 0, len(records))
 	for _, rec := range records {
-		locationPath := buildLocationPath(rec)
-		items = append(items, map[string]any{
-			"id":           rec.ID,
-			"kind":         rec.Kind,
-			"file_name":    rec.FileName,
-			"extension":    rec.Extension,
-			"size_bytes":   rec.SizeBytes,
-			"capture_time": rec.CaptureTime,
-			"ingested_at":  rec.IngestedAt,
-			"gps_lat":      nullFloat(rec.GPSLat),
-			"gps_lon":      nullFloat(rec.GPSLon),
-			"make":         nullString(rec.Make),
-			"model":        nullString(rec.Model),
-			"camera_yaw":   nullFloat(rec.CameraYaw),
-			"camera_pitch": nullFloat(rec.CameraPitch),
-			"camera_roll":  nullFloat(rec.CameraRoll),
-			"state":        nullString(rec.State),
-			"county":       nullString(rec.County),
-			"city":         nullString(rec.City),
-			"road":         nullString(rec.Road),
-			"display_name": nullString(rec.DisplayName),
-			"location":     locationPath,
-			"metadata":     rec.Metadata,
-			"preview_url":  fmt.Sprintf("/api/media/%d/content", rec.ID),
-		})
+		if hide {
+			hideLocation(&rec)
+		}
+		item := mediaListItem(rec)
+		if authCtx.IsGuest() {
+			// Thumbnails skip guest album scopes and watermarks.
+			item["thumb_url"], item["large_thumb_url"] = "", ""
+		}
+		items = append(items, item)
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{"items": items, "page": page, "size": size})
 }
 
+// mediaListItem is the JSON shape of a media item in listings.
+func mediaListItem(rec db.MediaRecord) map[string]any {
+	return map[string]any{
+		"id":           rec.ID,
+		"kind":         rec.Kind,
+		"file_name":    rec.FileName,
+		"extension":    rec.Extension,
+		"size_bytes":   rec.SizeBytes,
+		"capture_time": rec.CaptureTime,
+		"ingested_at":  rec.IngestedAt,
+		"gps_lat":      nullFloat(rec.GPSLat),
+		"gps_lon":      nullFloat(rec.GPSLon),
+		"make":         nullString(rec.Make),
+		"model":        nullString(rec.Model),
+		"camera_yaw":   nullFloat(rec.CameraYaw),
+		"camera_pitch": nullFloat(rec.CameraPitch),
+		"camera_roll":  nullFloat(rec.CameraRoll),
+		"state":        nullString(rec.State),
+		"county":       nullString(rec.County),
+		"city":         nullString(rec.City),
+		"road":         nullString(rec.Road),
+		"display_name": nullString(rec.DisplayName),
+		"location":     buildLocationPath(rec),
+		"metadata":     rec.Metadata,
+		"preview_url":  previewURL(rec),
+		// Empty when no thumbnail can be made; fall back to preview_url.
+		"thumb_url":       thumbURL(rec, media.ThumbSmall),
+		"large_thumb_url": thumbURL(rec, media.ThumbLarge),
+
+		"duration_sec":    nullFloat(rec.DurationSec),
+		"video_codec":     nullString(rec.VideoCodec),
+		"width":           nullInt(rec.Width),
+		"height":          nullInt(rec.Height),
+		"same_content_id": nullInt(rec.SameContentID),
+		"clock_uncertain": rec.ClockUncertain,
+		"source_card":     rec.SourceCard,
+		"source_rel_path": rec.SourceRelPath,
+	}
+}
+
 func (a *App) handleMediaContent(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
-	_ = authCtx
-	a.serveMediaByID(w, r, false)
+	if authCtx.IsGuest() && authCtx.ScopeAlbumID > 0 {
+		id, _ := parsePathInt64(r.PathValue("id"))
+		inScope, err := a.store.MediaInAlbum(r.Context(), authCtx.ScopeAlbumID, id)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+			return
+		}
+		if !inScope {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if authCtx.IsGuest() && authCtx.Watermark != "" {
+		id, _ := parsePathInt64(r.PathValue("id"))
+		rec, err := a.store.GetMediaByID(r.Context(), id)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+			return
+		}
+		if rec == nil {
+			http.NotFound(w, r)
+			return
+		}
+		a.serveWatermarked(w, r, rec, authCtx.Watermark)
+		return
+	}
+	a.serveMediaByID(w, r, authCtx, false)
 }
 
 func (a *App) handleMediaDownload(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	a.serveMediaByID(w, r, authCtx, true)
+}
+
+func (a *App) handleMediaSameContent(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
 	_ = authCtx
-	a.serveMediaByID(w, r, true)
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid media id"})
+		return
+	}
+	records, err := a.store.ListSameContent(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if len(records) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "media not found"})
+		return
+	}
+
+	items := make([]map[string]any, 0, len(records))
+	for _, rec := range records {
+		items = append(items, map[string]any{
+			"id":              rec.ID,
+			"file_name":       rec.FileName,
+			"capture_time":    rec.CaptureTime,
+			"source_path":     rec.SourcePath,
+			"dest_path":       rec.DestPath,
+			"same_content_id": nullInt(rec.SameContentID),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sha256": records[0].SHA256, "items": items})
 }
 
-func (a *App) serveMediaByID(w http.ResponseWriter, r *http.Request, forceDownload bool) {
+func (a *App) serveMediaByID(w http.ResponseWriter, r *http.Request, authCtx *AuthContext, forceDownload bool) {
 	idRaw := r.PathValue("id")
 	id, err := strconv.ParseInt(idRaw, 10, 64)
 	if err != nil {
@@ -479,13 +1145,102 @@ func (a *App) serveMediaByID(w http.ResponseWriter, r *http.Request, forceDownlo
 		http.NotFound(w, r)
 		return
 	}
+	switch r.URL.Query().Get("format") {
+	case "":
+	case "jpeg":
+		// Files a browser can show already are sent as they are.
+		if media.IsRAW(rec.Extension) {
+			a.serveRendition(w, r, authCtx, rec, forceDownload)
+			return
+		}
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be jpeg"})
+		return
+	}
+	strip, err := a.stripLocation(r.Context(), authCtx, isTruthy(r.URL.Query().Get("strip_gps")))
+	if err != nil {
+		a.logger.Printf("location privacy: %v", err)
+	}
+	a.serveMediaRecord(w, r, authCtx, rec, forceDownload, strip)
+}
+
+// handleMediaByHashDownload serves original bytes by content hash so another
+// vault can fetch media without knowing local ids.
+func (a *App) handleMediaByHashDownload(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	sum := strings.ToLower(strings.TrimSpace(r.PathValue("sha256")))
+	if len(sum) != 64 || strings.Trim(sum, "0123456789abcdef") != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid sha256"})
+		return
+	}
+	id, err := a.store.FindMediaBySHA256(r.Context(), sum)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if id == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	rec, err := a.store.GetMediaByID(r.Context(), id)
+	if err != nil || rec == nil {
+		http.NotFound(w, r)
+		return
+	}
+	// A replica asks for exactly the bytes the hash names, so the location
+	// privacy policy does not apply here.
+	a.serveMediaRecord(w, r, authCtx, rec, true, isTruthy(r.URL.Query().Get("strip_gps")))
+}
 
-	if _, err := os.Stat(rec.DestPath); err != nil {
+// serveMediaRecord sends a file's original bytes. Downloads, as opposed to
+// inline views, are audited so they show up in chain-of-custody reports.
+// With strip the file's position is removed on the way out.
+func (a *App) serveMediaRecord(w http.ResponseWriter, r *http.Request, authCtx *AuthContext, rec *db.MediaRecord, forceDownload, strip bool) {
+	info, err := a.libraryStorage().Stat(r.Context(), rec.DestPath)
+	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
+	var content io.ReadSeekCloser
+	if strip || !storage.IsPlainFile(rec.DestPath) {
+		content, err = a.openMediaFile(r.Context(), rec.DestPath)
+		if err != nil {
+			a.logger.Printf("decrypt media %d: %v", rec.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "media could not be decrypted"})
+			return
+		}
+		defer content.Close()
+	}
+	var body io.ReadSeeker = content
+	if strip {
+		if body, err = withoutLocation(rec, content); err != nil {
+			if !errors.Is(err, errLocationKept) {
+				a.logger.Printf("strip location of media %d: %v", rec.ID, err)
+			}
+			writeJSON(w, http.StatusConflict, map[string]string{"error": errLocationKept.Error()})
+			return
+		}
+	}
+
+	// The content hash is a strong validator, so a player can seek and
+	// resume with If-Range even where modification times say little, as
+	// for decrypted or remote files.
+	if rec.SHA256 != "" {
+		etag := rec.SHA256
+		if strip {
+			etag += "-nogps"
+		}
+		w.Header().Set("ETag", `"`+etag+`"`)
+	}
 	download := forceDownload || isTruthy(r.URL.Query().Get("download"))
+	if download && r.Header.Get("Range") == "" {
+		_ = a.audit.Log(r.Context(), authCtx.Username, "media_downloaded", map[string]any{
+			"media_id":  rec.ID,
+			"sha256":    rec.SHA256,
+			"ip":        clientIP(r),
+			"strip_gps": strip,
+		})
+	}
 	if download {
 		fileName := sanitizeDownloadFilename(rec.FileName)
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
@@ -493,19 +1248,71 @@ func (a *App) serveMediaByID(w http.ResponseWriter, r *http.Request, forceDownlo
 	} else {
 		w.Header().Set("Cache-Control", "private, max-age=3600")
 	}
-	http.ServeFile(w, r, rec.DestPath)
+	if content == nil {
+		http.ServeFile(w, r, rec.DestPath)
+		return
+	}
+	http.ServeContent(w, r, rec.FileName, info.ModTime(), body)
+}
+
+// libraryLocation cleans a recorded dest_path and checks that a local one
+// lies inside the library folder. Objects in remote storage are taken as
+// recorded.
+func libraryLocation(destPath, baseStorage string) (string, bool) {
+	if !storage.IsLocal(destPath) {
+		return destPath, true
+	}
+	destPath = filepath.Clean(destPath)
+	if baseStorage != "." && baseStorage != "" && !config.IsPathWithin(destPath, baseStorage) {
+		return "", false
+	}
+	return destPath, true
+}
+
+// openMediaFile opens a library file for reading its original bytes,
+// decrypting it when it was stored encrypted.
+func (a *App) openMediaFile(ctx context.Context, path string) (io.ReadSeekCloser, error) {
+	return storage.OpenPlain(ctx, a.libraryStorage(), a.libKey, path)
+}
+
+// libraryStorage is where library files are kept: the configured backend,
+// or the local folder when none is set.
+func (a *App) libraryStorage() storage.Backend {
+	if a.storage == nil {
+		return storage.NewLocal()
+	}
+	return a.storage
 }
 
 type mediaDeleteRequest struct {
 	IDs []int64 `json:"ids"`
+	// PurgeAt defers removing the bytes: the items leave the library now
+	// and their files are purged at this time; see parsePurgeAt. Without
+	// it they go to the trash.
+	PurgeAt string `json:"purge_at"`
 }
 
 type mediaDownloadRequest struct {
-	IDs []int64 `json:"ids"`
+	IDs    []int64 `json:"ids"`
+	Preset string  `json:"preset"`
+	// Layout is "library" (location and date folders, the default) or
+	// "card", which rebuilds each file's folders as they were on the card.
+	Layout string `json:"layout"`
+	// StripGPS removes the position from every file. Files whose position
+	// cannot be removed are left out.
+	StripGPS bool `json:"strip_gps"`
 }
 
 type albumCreateRequest struct {
 	Name string `json:"name"`
+	// Rules, when set, make a smart album whose items are whatever they
+	// match.
+	Rules *db.SmartRules `json:"rules"`
+}
+
+type albumRenameRequest struct {
+	Name  string         `json:"name"`
+	Rules *db.SmartRules `json:"rules"`
 }
 
 type albumItemChangeRequest struct {
@@ -524,6 +1331,15 @@ func (a *App) handleMediaDownloadZip(w http.ResponseWriter, r *http.Request, aut
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ids must contain at least one positive id"})
 		return
 	}
+	layout := strings.ToLower(strings.TrimSpace(req.Layout))
+	switch layout {
+	case "":
+		layout = "library"
+	case "library", "card":
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "layout must be library or card"})
+		return
+	}
 
 	records, err := a.store.ListMediaByIDs(r.Context(), ids)
 	if err != nil {
@@ -535,6 +1351,33 @@ func (a *App) handleMediaDownloadZip(w http.ResponseWriter, r *http.Request, aut
 		return
 	}
 
+	exportPreset := preset.Default()
+	if strings.TrimSpace(req.Preset) != "" {
+		user, err := a.loadExportPresets(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p, ok := preset.Find(user, req.Preset)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown preset " + strconv.Quote(req.Preset)})
+			return
+		}
+		exportPreset = p
+	}
+	var mark *watermark.Mark
+	if exportPreset.Proof {
+		mark, err = watermark.Load(*exportPreset.Watermark, config.WatermarksDir())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "preset watermark: " + err.Error()})
+			return
+		}
+	}
+	strip, err := a.stripLocation(r.Context(), authCtx, req.StripGPS)
+	if err != nil {
+		a.logger.Printf("location privacy: %v", err)
+	}
+
 	recordByID := make(map[int64]db.MediaRecord, len(records))
 	for _, rec := range records {
 		recordByID[rec.ID] = rec
@@ -557,27 +1400,67 @@ func (a *App) handleMediaDownloadZip(w http.ResponseWriter, r *http.Request, aut
 
 	written := 0
 	skipped := 0
+	converted := 0
+	withheld := 0
+	writtenIDs := make([]int64, 0, len(records))
 	usedNames := make(map[string]struct{}, len(records))
+	geo := make([]preset.GeoEntry, 0)
 	for _, id := range ids {
 		rec, ok := recordByID[id]
 		if !ok {
 			skipped++
 			continue
 		}
+		if rec.Kind == "video" && exportPreset.Videos == preset.VideosSkip {
+			skipped++
+			continue
+		}
+		// A proof must never fall back to a clean original.
+		if exportPreset.Proof && !exportPreset.Converts(rec.Kind, rec.Extension) {
+			skipped++
+			continue
+		}
 
-		destPath := filepath.Clean(rec.DestPath)
-		if baseStorage != "." && baseStorage != "" && !config.IsPathWithin(destPath, baseStorage) {
+		destPath, ok := libraryLocation(rec.DestPath, baseStorage)
+		if !ok {
 			skipped++
 			continue
 		}
 
-		info, err := os.Stat(destPath)
+		info, err := a.libraryStorage().Stat(r.Context(), destPath)
 		if err != nil || info.IsDir() {
 			skipped++
 			continue
 		}
 
-		entryName := buildArchiveEntryName(rec, usedNames)
+		// Render before creating the entry so an image that cannot be
+		// decoded is delivered as its original instead of a broken file.
+		var rendered *bytes.Buffer
+		if exportPreset.Converts(rec.Kind, rec.Extension) {
+			if src, err := a.openMediaFile(r.Context(), destPath); err == nil {
+				buf := &bytes.Buffer{}
+				if err := exportPreset.Render(buf, src, mark); err != nil {
+					a.logger.Printf("export preset %s: %s: %v; sending original", exportPreset.Name, rec.DestPath, err)
+				} else {
+					rendered = buf
+				}
+				_ = src.Close()
+			}
+		}
+		if exportPreset.Proof && rendered == nil {
+			skipped++
+			continue
+		}
+		named := rec
+		if rendered != nil {
+			named.FileName = strings.TrimSuffix(rec.FileName, filepath.Ext(rec.FileName)) + exportPreset.Extension()
+		}
+		var entryName string
+		if layout == "card" {
+			entryName = buildCardEntryName(named, usedNames)
+		} else {
+			entryName = buildArchiveEntryName(named, usedNames)
+		}
 		hdr, err := zip.FileInfoHeader(info)
 		if err != nil {
 			skipped++
@@ -585,6 +1468,10 @@ func (a *App) handleMediaDownloadZip(w http.ResponseWriter, r *http.Request, aut
 		}
 		hdr.Name = entryName
 		hdr.Method = zip.Deflate
+		if rendered != nil {
+			// Already-compressed output does not shrink further.
+			hdr.Method = zip.Store
+		}
 
 		dst, err := zw.CreateHeader(hdr)
 		if err != nil {
@@ -592,28 +1479,67 @@ func (a *App) handleMediaDownloadZip(w http.ResponseWriter, r *http.Request, aut
 			continue
 		}
 
-		src, err := os.Open(destPath)
-		if err != nil {
-			skipped++
-			continue
-		}
-		_, copyErr := io.Copy(dst, src)
-		_ = src.Close()
-		if copyErr != nil {
-			skipped++
-			continue
+		if rendered != nil {
+			if _, err := rendered.WriteTo(dst); err != nil {
+				skipped++
+				continue
+			}
+			converted++
+		} else {
+			src, err := a.openMediaFile(r.Context(), destPath)
+			if err != nil {
+				skipped++
+				continue
+			}
+			var body io.Reader = src
+			if strip {
+				if body, err = withoutLocation(&rec, src); err != nil {
+					_ = src.Close()
+					skipped++
+					withheld++
+					continue
+				}
+			}
+			_, copyErr := io.Copy(dst, body)
+			_ = src.Close()
+			if copyErr != nil {
+				skipped++
+				continue
+			}
 		}
 		written++
+		writtenIDs = append(writtenIDs, rec.ID)
+		geo = append(geo, preset.GeoEntry{Name: entryName, Record: rec})
+	}
+
+	// A stripped export must not carry the positions next to the files.
+	if exportPreset.GeoJSON && !strip {
+		if body, err := preset.GeoJSON(geo); err == nil {
+			if dst, err := zw.Create("locations.geojson"); err == nil {
+				_, _ = dst.Write(body)
+			}
+		}
 	}
 
 	_ = a.audit.Log(r.Context(), authCtx.Username, "media_download_zip", map[string]any{
 		"requested": len(ids),
 		"written":   written,
+		"media_ids": writtenIDs,
 		"skipped":   skipped,
+		"preset":    exportPreset.Name,
+		"layout":    layout,
+		"converted": converted,
+		"strip_gps": strip,
+		"withheld":  withheld,
+		"proof":     exportPreset.Proof,
 	})
 }
 
 func (a *App) handleMediaUpload(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	if a.migrateState().State == "running" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "a storage migration is running; try again when it is done"})
+		return
+	}
 	r.Body = http.MaxBytesReader(w, r.Body, uploadMaxRequestBytes)
 	if err := r.ParseMultipartForm(64 << 20); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid multipart upload"})
@@ -718,6 +1644,14 @@ func (a *App) handleMediaDelete(w http.ResponseWriter, r *http.Request, authCtx
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ids must contain at least one positive id"})
 		return
 	}
+	var purgeAt time.Time
+	if strings.TrimSpace(req.PurgeAt) != "" {
+		var err error
+		if purgeAt, err = parsePurgeAt(req.PurgeAt, time.Now()); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "purge_at: " + err.Error()})
+			return
+		}
+	}
 
 	records, err := a.store.ListMediaByIDs(r.Context(), ids)
 	if err != nil {
@@ -735,53 +1669,134 @@ func (a *App) handleMediaDelete(w http.ResponseWriter, r *http.Request, authCtx
 	deleted := 0
 	notFound := 0
 	failed := 0
+	vetoed := 0
+	held := 0
+	scheduled := 0
+	deletedIDs := make([]int64, 0, len(ids))
 	for _, id := range ids {
 		rec, ok := recordByID[id]
 		if !ok {
 			notFound++
 			continue
 		}
+		// Held content may leave the library on a schedule, since the
+		// purge waits for the hold, but its bytes cannot go now.
+		if purgeAt.IsZero() {
+			if onHold, err := a.store.OnLegalHold(r.Context(), rec.SHA256); err != nil || onHold {
+				if err != nil {
+					failed++
+				} else {
+					held++
+				}
+				continue
+			}
+		}
 
-		destPath := filepath.Clean(rec.DestPath)
-		if baseStorage != "." && baseStorage != "" && !config.IsPathWithin(destPath, baseStorage) {
+		destPath, ok := libraryLocation(rec.DestPath, baseStorage)
+		if !ok {
 			failed++
 			continue
 		}
 
-		if err := os.Remove(destPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		// A failing pre-delete hook vetoes removal of this item.
+		if err := a.hooks.Run(r.Context(), hooks.EventPreDelete, map[string]any{
+			"id":        rec.ID,
+			"actor":     authCtx.Username,
+			"file_name": rec.FileName,
+			"dest_path": destPath,
+			"sha256":    rec.SHA256,
+		}); err != nil {
+			vetoed++
+			continue
+		}
+
+		if !purgeAt.IsZero() {
+			sidecars, err := a.store.ListMediaSidecars(r.Context(), id)
+			if err != nil {
+				failed++
+				continue
+			}
+			if _, err := a.store.SchedulePurge(r.Context(), rec, sidecars, authCtx.Username, purgeAt); err != nil {
+				failed++
+				continue
+			}
+			removeThumbnails(baseStorage, id)
+			deleted++
+			scheduled++
+			deletedIDs = append(deletedIDs, id)
+			continue
+		}
+
+		sidecars, err := a.store.ListMediaSidecars(r.Context(), id)
+		if err != nil {
 			failed++
 			continue
 		}
-		if err := a.store.DeleteMediaByID(r.Context(), id); err != nil {
+		trashDir, err := moveToTrash(baseStorage, destPath, id, sidecars)
+		if err != nil {
+			failed++
+			continue
+		}
+		if err := a.store.TrashMedia(r.Context(), rec, sidecars, trashDir, authCtx.Username); err != nil {
+			item := db.TrashItem{Record: rec, TrashDir: trashDir}
+			item.Record.DestPath = destPath
+			for _, sc := range sidecars {
+				item.Sidecars = append(item.Sidecars, db.TrashSidecar{DestPath: sc.DestPath})
+			}
+			if err := moveFromTrash(item); err != nil {
+				a.logger.Printf("delete of %d: %v", id, err)
+			}
 			failed++
 			continue
 		}
-		cleanupEmptyParents(destPath, baseStorage)
 		deleted++
+		deletedIDs = append(deletedIDs, id)
 	}
 
-	_ = a.audit.Log(r.Context(), authCtx.Username, "media_deleted", map[string]any{
+	details := map[string]any{
 		"requested": len(ids),
 		"deleted":   deleted,
+		"media_ids": deletedIDs,
 		"not_found": notFound,
 		"failed":    failed,
-	})
-	writeJSON(w, http.StatusOK, map[string]any{
+		"vetoed":    vetoed,
+		"held":      held,
+	}
+	resp := map[string]any{
 		"ok":        true,
 		"requested": len(ids),
 		"deleted":   deleted,
 		"not_found": notFound,
 		"failed":    failed,
-	})
+		"vetoed":    vetoed,
+		"held":      held,
+	}
+	if purgeAt.IsZero() {
+		details["trash"], resp["trash"] = true, true
+	} else {
+		details["scheduled"], resp["scheduled"] = scheduled, scheduled
+		details["purge_after"] = purgeAt.UTC().Format(time.RFC3339)
+		resp["purge_after"] = details["purge_after"]
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "media_deleted", details)
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (a *App) handleAlbumsList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
-	_ = authCtx
 	albums, err := a.store.ListAlbums(r.Context(), 1000)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
 		return
 	}
+	if authCtx.IsGuest() && authCtx.ScopeAlbumID > 0 {
+		scoped := make([]db.Album, 0, 1)
+		for _, album := range albums {
+			if album.ID == authCtx.ScopeAlbumID {
+				scoped = append(scoped, album)
+			}
+		}
+		albums = scoped
+	}
 	writeJSON(w, http.StatusOK, map[string]any{"items": albums})
 }
 
@@ -791,15 +1806,33 @@ func (a *App) handleAlbumsCreate(w http.ResponseWriter, r *http.Request, authCtx
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
-	album, err := a.store.CreateAlbum(r.Context(), req.Name)
+	var (
+		album *db.Album
+		err   error
+	)
+	if req.Rules != nil {
+		rules, rerr := normalizeSmartRules(*req.Rules)
+		if rerr != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": rerr.Error()})
+			return
+		}
+		album, err = a.store.CreateSmartAlbum(r.Context(), req.Name, rules)
+	} else {
+		album, err = a.store.CreateAlbum(r.Context(), req.Name)
+	}
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
-	_ = a.audit.Log(r.Context(), authCtx.Username, "album_created", map[string]any{
+	details := map[string]any{
 		"album_id": album.ID,
 		"name":     album.Name,
-	})
+	}
+	if album.Smart {
+		details["smart"] = true
+		details["rules"] = album.Rules
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "album_created", details)
 	writeJSON(w, http.StatusCreated, map[string]any{"ok": true, "item": album})
 }
 
@@ -822,6 +1855,10 @@ func (a *App) handleAlbumAdd(w http.ResponseWriter, r *http.Request, authCtx *Au
 	}
 
 	added, skipped, err := a.store.AddMediaToAlbum(r.Context(), albumID, ids)
+	if errors.Is(err, db.ErrSmartAlbum) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
@@ -831,6 +1868,7 @@ func (a *App) handleAlbumAdd(w http.ResponseWriter, r *http.Request, authCtx *Au
 		"requested":  len(ids),
 		"added":      added,
 		"duplicates": skipped,
+		"media_ids":  ids,
 	})
 	writeJSON(w, http.StatusOK, map[string]any{
 		"ok":        true,
@@ -860,6 +1898,10 @@ func (a *App) handleAlbumRemove(w http.ResponseWriter, r *http.Request, authCtx
 	}
 
 	removed, skipped, err := a.store.RemoveMediaFromAlbum(r.Context(), albumID, ids)
+	if errors.Is(err, db.ErrSmartAlbum) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
@@ -869,6 +1911,7 @@ func (a *App) handleAlbumRemove(w http.ResponseWriter, r *http.Request, authCtx
 		"requested": len(ids),
 		"removed":   removed,
 		"missing":   skipped,
+		"media_ids": ids,
 	})
 	writeJSON(w, http.StatusOK, map[string]any{
 		"ok":        true,
@@ -879,6 +1922,130 @@ func (a *App) handleAlbumRemove(w http.ResponseWriter, r *http.Request, authCtx
 	})
 }
 
+func (a *App) handleAlbumGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	albumID, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || albumID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid album id"})
+		return
+	}
+	album, err := a.store.GetAlbumByID(r.Context(), albumID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "album lookup failed"})
+		return
+	}
+	if album == nil || (authCtx.IsGuest() && authCtx.ScopeAlbumID > 0 && authCtx.ScopeAlbumID != albumID) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "album not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"item": album})
+}
+
+func (a *App) handleAlbumRename(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	albumID, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || albumID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid album id"})
+		return
+	}
+	var req albumRenameRequest
+	if err := decodeJSONBody(r, &req, 1<<12); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	old, err := a.store.GetAlbumByID(r.Context(), albumID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "album lookup failed"})
+		return
+	}
+	if old == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "album not found"})
+		return
+	}
+	if req.Rules != nil && !old.Smart {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "only smart albums have rules"})
+		return
+	}
+	var rules db.SmartRules
+	if req.Rules != nil {
+		if rules, err = normalizeSmartRules(*req.Rules); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	album := old
+	rename := req.Rules == nil || strings.TrimSpace(req.Name) != ""
+	if rename {
+		album, err = a.store.RenameAlbum(r.Context(), albumID, req.Name)
+	}
+	switch {
+	case db.IsUniqueViolation(err):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "an album with that name already exists"})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	case album == nil:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "album not found"})
+		return
+	}
+	if rename {
+		// The linked folder is named after the album; the next open makes
+		// it again under the new name.
+		removeAlbumFolder(old)
+		_ = a.audit.Log(r.Context(), authCtx.Username, "album_renamed", map[string]any{
+			"album_id": album.ID,
+			"old_name": old.Name,
+			"name":     album.Name,
+		})
+	}
+	if req.Rules != nil {
+		album, err = a.store.SetSmartAlbumRules(r.Context(), albumID, rules)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save album rules"})
+			return
+		}
+		if album == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "album not found"})
+			return
+		}
+		_ = a.audit.Log(r.Context(), authCtx.Username, "album_rules_changed", map[string]any{
+			"album_id":  album.ID,
+			"old_rules": old.Rules,
+			"rules":     album.Rules,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "item": album})
+}
+
+// handleAlbumDelete removes an album and its publish targets. Its media
+// stay in the library, and what was already published is left in place.
+func (a *App) handleAlbumDelete(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	albumID, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || albumID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid album id"})
+		return
+	}
+	album, err := a.store.GetAlbumByID(r.Context(), albumID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "album lookup failed"})
+		return
+	}
+	if album == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "album not found"})
+		return
+	}
+	if _, err := a.store.DeleteAlbum(r.Context(), albumID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete album"})
+		return
+	}
+	removeAlbumFolder(album)
+	_ = a.audit.Log(r.Context(), authCtx.Username, "album_deleted", map[string]any{
+		"album_id":   album.ID,
+		"name":       album.Name,
+		"item_count": album.ItemCount,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
 func (a *App) handleAlbumOpenFolder(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
 	albumID, ok := parsePathInt64(r.PathValue("id"))
 	if !ok || albumID <= 0 {
@@ -924,16 +2091,22 @@ func (a *App) handleAlbumOpenFolder(w http.ResponseWriter, r *http.Request, auth
 }
 
 func (a *App) handleMap(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
-	_ = authCtx
 	filter, err := mediaFilterFromRequest(r)
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	applyGuestScope(authCtx, &filter)
 	limit := parsePositiveInt(r.URL.Query().Get("limit"), 10000)
 	if limit > 50000 {
 		limit = 50000
 	}
+	if authCtx.IsGuest() {
+		if hide, _ := a.stripLocation(r.Context(), authCtx, false); hide {
+			writeJSON(w, http.StatusOK, map[string]any{"points": []db.MapPoint{}, "count": 0, "limit": limit})
+			return
+		}
+	}
 	points, err := a.store.ListMapPointsFiltered(r.Context(), limit, filter)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
@@ -943,12 +2116,12 @@ func (a *App) handleMap(w http.ResponseWriter, r *http.Request, authCtx *AuthCon
 }
 
 func (a *App) handleDeviceGroups(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
-	_ = authCtx
 	filter, err := mediaFilterFromRequest(r)
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	applyGuestScope(authCtx, &filter)
 	// Device options should reflect the broader current set, not the current device selection.
 	filter.DeviceMake = ""
 	filter.DeviceModel = ""
@@ -963,13 +2136,20 @@ func (a *App) handleDeviceGroups(w http.ResponseWriter, r *http.Request, authCtx
 }
 
 func (a *App) handleLocationGroups(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
-	_ = authCtx
 	level := r.URL.Query().Get("level")
 	filter, err := mediaFilterFromRequest(r)
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	applyGuestScope(authCtx, &filter)
+	// Street names give away as much as the position does.
+	if authCtx.IsGuest() && level == "road" {
+		if hide, _ := a.stripLocation(r.Context(), authCtx, false); hide {
+			writeJSON(w, http.StatusOK, map[string]any{"level": level, "groups": []db.LocationGroup{}})
+			return
+		}
+	}
 	groups, err := a.store.ListLocationGroups(r.Context(), level, filter, 200)
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
@@ -978,6 +2158,33 @@ func (a *App) handleLocationGroups(w http.ResponseWriter, r *http.Request, authC
 	writeJSON(w, http.StatusOK, map[string]any{"level": level, "groups": groups})
 }
 
+// handleSourceFolders browses the card layout: the cards files came from,
+// and the folders directly below source_dir.
+func (a *App) handleSourceFolders(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	filter, err := mediaFilterFromRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	applyGuestScope(authCtx, &filter)
+	cards, err := a.store.ListSourceCards(r.Context(), filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	folders, files, err := a.store.ListSourceFolders(r.Context(), filter.SourceDir, filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"cards":      cards,
+		"source_dir": filter.SourceDir,
+		"folders":    folders,
+		"files":      files,
+	})
+}
+
 func (a *App) handleAudit(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
 	records, err := a.store.ListAudit(r.Context(), 300)
 	if err != nil {
@@ -987,6 +2194,52 @@ func (a *App) handleAudit(w http.ResponseWriter, r *http.Request, authCtx *AuthC
 	writeJSON(w, http.StatusOK, map[string]any{"items": records, "viewer": authCtx.Username})
 }
 
+// handleHealth is unauthenticated so monitors can poll it; it only exposes
+// whether unacknowledged security alerts exist, not their contents.
+func (a *App) handleHealth(w http.ResponseWriter, r *http.Request) {
+	open, err := a.store.CountOpenSecurityAlerts(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"ok": false, "error": "database unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ok":             true,
+		"security_alert": open > 0,
+		"open_alerts":    open,
+		"clock_trusted":  a.clock == nil || a.clock.Trusted(),
+	})
+}
+
+func (a *App) handleAlertsList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	includeAcked := r.URL.Query().Get("all") == "1"
+	items, err := a.store.ListSecurityAlerts(r.Context(), includeAcked, 200)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+type alertsAckRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+func (a *App) handleAlertsAck(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req alertsAckRequest
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	n, err := a.store.AcknowledgeSecurityAlerts(r.Context(), req.IDs, authCtx.Username)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to acknowledge alerts"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "security_alerts_acknowledged", map[string]any{"count": n})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "acknowledged": n})
+}
+
 func (a *App) handleMountPolicyGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
 	_ = authCtx
 	ctx := r.Context()
@@ -1090,7 +2343,21 @@ func (a *App) handleRescan(w http.ResponseWriter, r *http.Request, authCtx *Auth
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mount_path must be an absolute path"})
 		return
 	}
+	// A field session may only ingest a card that is plugged in, not an
+	// arbitrary folder.
+	if authCtx.Field {
+		attached, ok := a.attachedMount(mount)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mount_path is not an attached card"})
+			return
+		}
+		mount = attached
+	}
 
+	if a.migrateState().State == "running" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "a storage migration is running; try again when it is done"})
+		return
+	}
 	res, err := a.ingestor.ProcessMount(r.Context(), mount, authCtx.Username)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
@@ -1099,50 +2366,194 @@ func (a *App) handleRescan(w http.ResponseWriter, r *http.Request, authCtx *Auth
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "result": res})
 }
 
-func (a *App) handleCloudSyncGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+type ingestRulesRequest struct {
+	Rules []rules.Rule `json:"rules"`
+}
+
+func (a *App) handleIngestRulesGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
 	_ = authCtx
-	value, ok, err := a.store.GetSetting(r.Context(), cloudSyncKey)
+	raw, _, err := a.store.GetSetting(r.Context(), rules.SettingKey)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
 		return
 	}
-	if !ok {
-		value = `{"enabled":false,"provider":"none","rules":[]}`
+	set, err := rules.Parse(raw)
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]any{"rules": []rules.Rule{}, "error": err.Error()})
+		return
+	}
+	list := set.Rules()
+	if list == nil {
+		list = []rules.Rule{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"rules": list})
+}
+
+func (a *App) handleIngestRulesSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req ingestRulesRequest
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	set, err := rules.Compile(req.Rules)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	raw, err := json.Marshal(set.Rules())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid payload"})
+		return
+	}
+	if err := a.store.SetSetting(r.Context(), rules.SettingKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update ingest rules"})
+		return
 	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "ingest_rules_updated", map[string]any{"count": len(req.Rules)})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "rules": set.Rules()})
+}
 
-	var payload map[string]any
-	if err := json.Unmarshal([]byte(value), &payload); err != nil {
-		payload = map[string]any{"enabled": false, "provider": "none", "rules": []any{}}
+func (a *App) handleIngestSkipGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	raw, _, err := a.store.GetSetting(r.Context(), ingest.SkipSettingKey)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	skip, err := ingest.ParseSkipRules(raw)
+	if err != nil {
+		skip, _ = ingest.ParseSkipRules("")
+		writeJSON(w, http.StatusOK, map[string]any{"skip": skip, "defaults": ingest.DefaultSkipPatterns, "error": err.Error()})
+		return
 	}
-	writeJSON(w, http.StatusOK, payload)
+	writeJSON(w, http.StatusOK, map[string]any{"skip": skip, "defaults": ingest.DefaultSkipPatterns})
 }
 
-func (a *App) handleCloudSyncSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
-	var payload map[string]any
-	if err := decodeJSONBody(r, &payload, 1<<20); err != nil {
+func (a *App) handleIngestSkipSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req ingest.SkipRules
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	skip, err := req.Normalize()
+	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	raw, err := json.Marshal(skip)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid payload"})
+		return
+	}
+	if err := a.store.SetSetting(r.Context(), ingest.SkipSettingKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update ingest skip rules"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "ingest_skip_updated", map[string]any{"patterns": skip.Patterns})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "skip": skip})
+}
+
+func (a *App) handleBackupFilterGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	raw, _, err := a.store.GetSetting(r.Context(), backup.FilterSettingKey)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	filter, err := backup.ParseFilter(raw)
+	if err != nil {
+		filter, _ = backup.ParseFilter("")
+		writeJSON(w, http.StatusOK, map[string]any{"filter": filter, "work_areas": config.WorkAreas, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"filter": filter, "work_areas": config.WorkAreas})
+}
 
-	raw, err := json.Marshal(payload)
+func (a *App) handleBackupFilterSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req backup.Filter
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	filter, err := req.Normalize()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	raw, err := json.Marshal(filter)
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid payload"})
 		return
 	}
-	if err := a.store.SetSetting(r.Context(), cloudSyncKey, string(raw)); err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update cloud sync settings"})
+	if err := a.store.SetSetting(r.Context(), backup.FilterSettingKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update backup filter"})
 		return
 	}
-	_ = a.audit.Log(r.Context(), authCtx.Username, "cloud_sync_config_updated", map[string]any{"length": len(raw)})
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	_ = a.audit.Log(r.Context(), authCtx.Username, "backup_filter_updated", map[string]any{
+		"work_areas": filter.WorkAreas,
+		"include":    filter.Include,
+		"exclude":    filter.Exclude,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "filter": filter})
+}
+
+func (a *App) loadExportPresets(ctx context.Context) ([]preset.Preset, error) {
+	raw, _, err := a.store.GetSetting(ctx, preset.SettingKey)
+	if err != nil {
+		return nil, errors.New("database unavailable")
+	}
+	return preset.Parse(raw)
+}
+
+func (a *App) handleExportPresetsGet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	user, err := a.loadExportPresets(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]any{"presets": preset.All(nil), "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"presets": preset.All(user)})
+}
+
+type exportPresetsRequest struct {
+	Presets []preset.Preset `json:"presets"`
+}
+
+// handleExportPresetsSet replaces the user presets; built-ins are fixed.
+func (a *App) handleExportPresetsSet(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req exportPresetsRequest
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	list, err := preset.Compile(req.Presets)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	raw, err := json.Marshal(list)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid payload"})
+		return
+	}
+	if err := a.store.SetSetting(r.Context(), preset.SettingKey, string(raw)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update export presets"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "export_presets_updated", map[string]any{"count": len(list)})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "presets": preset.All(list)})
 }
 
 type backupStartRequest struct {
-	Mode        string `json:"mode"`
-	Destination string `json:"destination"`
-	SSHPort     int    `json:"ssh_port"`
-	APIMethod   string `json:"api_method"`
-	APIToken    string `json:"api_token"`
+	Mode         string               `json:"mode"`
+	Destination  string               `json:"destination"`
+	SSHPort      int                  `json:"ssh_port"`
+	APIMethod    string               `json:"api_method"`
+	APIToken     string               `json:"api_token"`
+	Destinations []backup.Destination `json:"destinations"`
+	Parallel     bool                 `json:"parallel"`
+	Incremental  bool                 `json:"incremental"`
+	Full         bool                 `json:"full"`
 }
 
 func (a *App) handleBackupStart(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
@@ -1151,12 +2562,20 @@ func (a *App) handleBackupStart(w http.ResponseWriter, r *http.Request, authCtx
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	if err := a.powerAllowsBackup(); err != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
 	err := a.backuper.Start(authCtx.Username, backup.Request{
-		Mode:        req.Mode,
-		Destination: req.Destination,
-		SSHPort:     req.SSHPort,
-		APIMethod:   req.APIMethod,
-		APIToken:    req.APIToken,
+		Mode:         req.Mode,
+		Destination:  req.Destination,
+		SSHPort:      req.SSHPort,
+		APIMethod:    req.APIMethod,
+		APIToken:     req.APIToken,
+		Destinations: req.Destinations,
+		Parallel:     req.Parallel,
+		Incremental:  req.Incremental,
+		Full:         req.Full,
 	})
 	if err != nil {
 		if errors.Is(err, backup.ErrBusy) {
@@ -1170,24 +2589,44 @@ func (a *App) handleBackupStart(w http.ResponseWriter, r *http.Request, authCtx
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
+	extra := make([]string, 0, len(req.Destinations))
+	for _, d := range req.Destinations {
+		extra = append(extra, d.Mode+" "+d.Destination)
+	}
 	_ = a.audit.Log(r.Context(), authCtx.Username, "backup_started", map[string]any{
-		"mode":        req.Mode,
-		"destination": req.Destination,
+		"mode":         req.Mode,
+		"destination":  req.Destination,
+		"destinations": extra,
+		"parallel":     req.Parallel,
+		"incremental":  req.Incremental,
+		"full":         req.Full,
 	})
 	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
 }
 
-func (a *App) issueSession(w http.ResponseWriter, userID int64, username string) error {
+// issueSession creates a session cookie. A non-zero accountExpiry caps the
+// session lifetime so guest sessions never outlive the guest account.
+func (a *App) issueSession(w http.ResponseWriter, userID int64, username string, accountExpiry time.Time) error {
 	token, err := security.NewSessionToken()
 	if err != nil {
 		return err
 	}
 	tokenHash := security.TokenHash(token)
 	expires := time.Now().UTC().Add(a.sessionTTL)
+	if !accountExpiry.IsZero() && accountExpiry.Before(expires) {
+		expires = accountExpiry.UTC()
+	}
 	if err := a.store.CreateSession(context.Background(), tokenHash, userID, expires); err != nil {
 		return err
 	}
+	a.setSessionCookie(w, token, expires)
+	_ = username
+	return nil
+}
 
+// setSessionCookie marks the cookie Secure when the vault serves HTTPS, so
+// it is never sent over plain HTTP.
+func (a *App) setSessionCookie(w http.ResponseWriter, token string, expires time.Time) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     sessionCookieName,
 		Value:    token,
@@ -1195,23 +2634,63 @@ func (a *App) issueSession(w http.ResponseWriter, userID int64, username string)
 		HttpOnly: true,
 		SameSite: http.SameSiteStrictMode,
 		Expires:  expires,
-		Secure:   false,
+		Secure:   a.tlsConfig != nil,
 	})
-	_ = username
-	return nil
 }
 
+// authFromRequest resolves the session cookie, or a bearer token: the
+// session token of a paired device or a user's API token.
 func (a *App) authFromRequest(r *http.Request) (*AuthContext, bool) {
-	cookie, err := r.Cookie(sessionCookieName)
-	if err != nil || cookie.Value == "" {
-		return nil, false
+	authCtx, err := a.lookupAuth(r)
+	return authCtx, err == nil && authCtx != nil
+}
+
+// lookupAuth resolves the request's session cookie or bearer token. It
+// gives up after priorityQueryTimeout, so a busy database answers with an
+// error rather than a stalled request or a sign-out.
+func (a *App) lookupAuth(r *http.Request) (*AuthContext, error) {
+	token := ""
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		token = cookie.Value
+	}
+	if token == "" {
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			token = strings.TrimSpace(bearer)
+		}
+	}
+	if token == "" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), priorityQueryTimeout)
+	defer cancel()
+	tokenHash := security.TokenHash(token)
+	var (
+		session *db.Session
+		err     error
+	)
+	if isAPIToken(token) {
+		session, err = a.store.LookupAPIToken(ctx, tokenHash)
+	} else {
+		session, err = a.store.LookupSession(ctx, tokenHash)
 	}
-	tokenHash := security.TokenHash(cookie.Value)
-	session, err := a.store.LookupSession(r.Context(), tokenHash)
 	if err != nil || session == nil {
-		return nil, false
+		return nil, err
 	}
-	return &AuthContext{UserID: session.UserID, Username: session.Username, Token: cookie.Value}, true
+	username := session.Username
+	if session.Field {
+		username = fieldActorPrefix + username
+	}
+	return &AuthContext{
+		UserID:       session.UserID,
+		Username:     username,
+		Token:        token,
+		Role:         session.Role,
+		ScopeAlbumID: session.ScopeAlbumID,
+		Watermark:    session.Watermark,
+		StripGPS:     session.StripGPS,
+		Field:        session.Field,
+		Device:       session.Device,
+	}, nil
 }
 
 func (a *App) sessionCleanupWorker(ctx context.Context) {
@@ -1225,36 +2704,75 @@ func (a *App) sessionCleanupWorker(ctx context.Context) {
 			if err := a.store.DeleteExpiredSessions(context.Background()); err != nil {
 				a.logger.Printf("session cleanup failed: %v", err)
 			}
+			if n, err := a.store.DeleteExpiredGuests(context.Background()); err != nil {
+				a.logger.Printf("guest cleanup failed: %v", err)
+			} else if n > 0 {
+				_ = a.audit.Log(context.Background(), "system", "guest_accounts_expired", map[string]any{"count": n})
+			}
+			if _, err := a.store.PruneGuestAccess(context.Background(), time.Now().Add(-guestAccessRetention)); err != nil {
+				a.logger.Printf("guest access log cleanup failed: %v", err)
+			}
+		}
+	}
+}
+
+// dbSealWorker periodically re-encrypts the working database so a crash or
+// power loss only loses changes since the last seal.
+func (a *App) dbSealWorker(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(config.DBSealIntervalMinutes()) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.vault.Seal(context.Background(), a.store.Snapshot); err != nil {
+				a.logger.Printf("database seal failed: %v", err)
+			}
 		}
 	}
 }
 
 func (a *App) requestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		level, _ := a.logLevel.Load().(string)
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		a.logger.Printf("%s %s %s", r.Method, r.URL.Path, time.Since(start))
+		if !isStatusPoll(r) {
+			a.lastRequest.Store(start.UnixNano())
+		}
+		switch level {
+		case "warn":
+			next.ServeHTTP(w, r)
+		case "debug":
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			a.logger.Printf("%s %s %s %d %s", r.RemoteAddr, r.Method, r.URL.Path, rec.status, time.Since(start))
+		default:
+			next.ServeHTTP(w, r)
+			a.logger.Printf("%s %s %s", r.Method, r.URL.Path, time.Since(start))
+		}
 	})
 }
 
-func (a *App) securityHeaders(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "DENY")
-		w.Header().Set("Referrer-Policy", "no-referrer")
-		w.Header().Set("Cross-Origin-Resource-Policy", "same-origin")
-		w.Header().Set("Cross-Origin-Opener-Policy", "same-origin")
-		// Leaflet is vendored under /web/vendor for offline use; map tiles may still be remote.
-		w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src 'self' data: https://tile.openstreetmap.org; style-src 'self' 'unsafe-inline'; script-src 'self'; font-src 'self' data:; connect-src 'self'; media-src 'self'; frame-ancestors 'none';")
-		next.ServeHTTP(w, r)
-	})
+// statusRecorder notes the response status for debug request lines.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
 }
 
-func defaultBindAddr() string {
-	if v := strings.TrimSpace(os.Getenv("USBVAULT_BIND")); v != "" {
-		return v
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
 	}
-	return "127.0.0.1"
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
 }
 
 func resolveWebDir() string {
@@ -1289,6 +2807,9 @@ func decodeJSONBody(r *http.Request, out any, maxBytes int64) error {
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload any) {
+	if status >= 400 {
+		payload = localizeError(w, payload)
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(payload)
@@ -1324,6 +2845,13 @@ func nullFloat(v sql.NullFloat64) any {
 	return nil
 }
 
+func nullInt(v sql.NullInt64) any {
+	if v.Valid {
+		return v.Int64
+	}
+	return nil
+}
+
 func nullString(v sql.NullString) any {
 	if v.Valid {
 		return v.String
@@ -1359,6 +2887,13 @@ func buildLocationPath(rec db.MediaRecord) string {
 	return strings.Join(parts, " / ")
 }
 
+func truncateForAudit(v string, max int) string {
+	if len(v) <= max {
+		return v
+	}
+	return v[:max]
+}
+
 func clientIP(r *http.Request) string {
 	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
 		parts := strings.Split(forwarded, ",")
@@ -1386,17 +2921,65 @@ func mediaFilterFromRequest(r *http.Request) (db.MediaFilter, error) {
 	}
 
 	filter := db.MediaFilter{
-		State:  strings.TrimSpace(r.URL.Query().Get("state")),
-		County: strings.TrimSpace(r.URL.Query().Get("county")),
-		City:   strings.TrimSpace(r.URL.Query().Get("city")),
-		Road:   strings.TrimSpace(r.URL.Query().Get("road")),
-		Kind:   kind,
-		Query:  strings.TrimSpace(r.URL.Query().Get("q")),
-		HasGPS: strings.ToLower(strings.TrimSpace(r.URL.Query().Get("gps"))),
+		State:   strings.TrimSpace(r.URL.Query().Get("state")),
+		County:  strings.TrimSpace(r.URL.Query().Get("county")),
+		City:    strings.TrimSpace(r.URL.Query().Get("city")),
+		Road:    strings.TrimSpace(r.URL.Query().Get("road")),
+		Kind:    kind,
+		Query:   strings.TrimSpace(r.URL.Query().Get("q")),
+		HasGPS:  strings.ToLower(strings.TrimSpace(r.URL.Query().Get("gps"))),
+		Tag:     strings.TrimSpace(r.URL.Query().Get("tag")),
+		AutoTag: strings.TrimSpace(r.URL.Query().Get("auto_tag")),
+
+		SourceCard: strings.TrimSpace(r.URL.Query().Get("source_card")),
+		SourceDir:  strings.Trim(strings.TrimSpace(r.URL.Query().Get("source_dir")), "/"),
 	}
 	if filter.HasGPS != "" && filter.HasGPS != "yes" && filter.HasGPS != "no" {
 		return db.MediaFilter{}, errors.New("invalid gps filter")
 	}
+	switch strings.ToLower(strings.TrimSpace(r.URL.Query().Get("clock_uncertain"))) {
+	case "", "no":
+	case "yes":
+		filter.ClockUncertain = true
+	default:
+		return db.MediaFilter{}, errors.New("invalid clock_uncertain filter")
+	}
+	switch strings.ToLower(strings.TrimSpace(r.URL.Query().Get("missing"))) {
+	case "", "no":
+	case "yes":
+		filter.Missing = true
+	default:
+		return db.MediaFilter{}, errors.New("invalid missing filter")
+	}
+	switch strings.ToLower(strings.TrimSpace(r.URL.Query().Get("favorite"))) {
+	case "", "no":
+	case "yes":
+		filter.Favorite = true
+	default:
+		return db.MediaFilter{}, errors.New("invalid favorite filter")
+	}
+	if ratingRaw := strings.TrimSpace(r.URL.Query().Get("min_rating")); ratingRaw != "" {
+		minRating, err := strconv.Atoi(ratingRaw)
+		if err != nil || minRating < 0 || minRating > db.MaxRating {
+			return db.MediaFilter{}, errors.New("invalid min_rating")
+		}
+		filter.MinRating = minRating
+	}
+
+	if personRaw := strings.TrimSpace(r.URL.Query().Get("person_id")); personRaw != "" {
+		personID, err := strconv.ParseInt(personRaw, 10, 64)
+		if err != nil || personID <= 0 {
+			return db.MediaFilter{}, errors.New("invalid person_id")
+		}
+		filter.PersonID = personID
+	}
+	if placeRaw := strings.TrimSpace(r.URL.Query().Get("place_id")); placeRaw != "" {
+		placeID, err := strconv.ParseInt(placeRaw, 10, 64)
+		if err != nil || placeID <= 0 {
+			return db.MediaFilter{}, errors.New("invalid place_id")
+		}
+		filter.PlaceID = placeID
+	}
 
 	albumRaw := strings.TrimSpace(r.URL.Query().Get("album_id"))
 	if albumRaw != "" {
@@ -1550,7 +3133,11 @@ func buildArchiveEntryName(rec db.MediaRecord, used map[string]struct{}) string
 	if baseName == "" {
 		baseName = fmt.Sprintf("media_%d%s", rec.ID, rec.Extension)
 	}
-	baseName = fmt.Sprintf("%06d_%s", rec.ID, baseName)
+	baseName = pathname.File(fmt.Sprintf("%06d_%s", rec.ID, baseName))
+	// Archives are mostly unpacked on Windows; keep entries under MAX_PATH.
+	baseExt := filepath.Ext(baseName)
+	parts, baseStem := pathname.Fit(parts, strings.TrimSuffix(baseName, baseExt), baseExt)
+	baseName = baseStem + baseExt
 
 	candidate := path.Join(append(parts, baseName)...)
 	if _, ok := used[candidate]; !ok {
@@ -1573,6 +3160,59 @@ func buildArchiveEntryName(rec db.MediaRecord, used map[string]struct{}) string
 	return fallback
 }
 
+// buildCardEntryName places a file where it was on its card, below a folder
+// named after the card: "EOS_DIGITAL/DCIM/100CANON/IMG_0001.JPG". A preset
+// that converts the file changes only its extension. Two files that were
+// at the same place on different ingests of the same card get a numbered
+// suffix.
+func buildCardEntryName(rec db.MediaRecord, used map[string]struct{}) string {
+	parts := make([]string, 0, 6)
+	if card := sanitizeArchiveSegment(rec.SourceCard); card != "" {
+		parts = append(parts, card)
+	} else {
+		parts = append(parts, "Unknown")
+	}
+	rel := rec.SourceRelPath
+	if rel == "" {
+		rel = rec.FileName
+	}
+	segments := strings.Split(rel, "/")
+	for _, seg := range segments[:len(segments)-1] {
+		if seg == "" || seg == "." || seg == ".." {
+			continue
+		}
+		if name := pathname.File(seg); name != "" {
+			parts = append(parts, name)
+		}
+	}
+	baseName := pathname.File(sanitizeDownloadFilename(segments[len(segments)-1]))
+	if ext := filepath.Ext(rec.FileName); ext != "" && !strings.EqualFold(filepath.Ext(baseName), ext) {
+		baseName = strings.TrimSuffix(baseName, filepath.Ext(baseName)) + ext
+	}
+	if baseName == "" {
+		baseName = fmt.Sprintf("media_%d%s", rec.ID, rec.Extension)
+	}
+
+	candidate := path.Join(append(parts, baseName)...)
+	if _, ok := used[candidate]; !ok {
+		used[candidate] = struct{}{}
+		return candidate
+	}
+	ext := filepath.Ext(baseName)
+	stem := strings.TrimSuffix(baseName, ext)
+	for i := 1; i <= 10000; i++ {
+		alt := path.Join(append(parts, fmt.Sprintf("%s_%d%s", stem, i, ext))...)
+		if _, ok := used[alt]; ok {
+			continue
+		}
+		used[alt] = struct{}{}
+		return alt
+	}
+	fallback := path.Join(append(parts, fmt.Sprintf("%d_%d%s", rec.ID, time.Now().UnixNano(), ext))...)
+	used[fallback] = struct{}{}
+	return fallback
+}
+
 func (a *App) materializeAlbumFolder(ctx context.Context, album *db.Album) (string, int, int, error) {
 	if album == nil || album.ID <= 0 {
 		return "", 0, 0, errors.New("invalid album")
@@ -1674,6 +3314,13 @@ func openFolderInFileBrowser(folderPath string) error {
 	return nil
 }
 
+// removeAlbumFolder deletes the linked folder made for album by
+// materializeAlbumFolder, if any. It only holds links, so the library is
+// untouched.
+func removeAlbumFolder(album *db.Album) {
+	_ = os.RemoveAll(filepath.Join(config.DataDir(), "album-folders", albumFolderDirName(album)))
+}
+
 func albumFolderDirName(album *db.Album) string {
 	base := sanitizeFilesystemName(album.Name)
 	if base == "" {
@@ -1731,35 +3378,11 @@ func sanitizeFilesystemName(name string) string {
 	name = strings.ReplaceAll(name, "\r", "_")
 	name = strings.ReplaceAll(name, "\n", "_")
 	name = strings.Trim(name, " .")
-	return name
+	return pathname.File(name)
 }
 
 func sanitizeArchiveSegment(name string) string {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return ""
-	}
-	name = strings.ReplaceAll(name, "/", "_")
-	name = strings.ReplaceAll(name, "\\", "_")
-	name = strings.Map(func(r rune) rune {
-		switch {
-		case r >= 'a' && r <= 'z':
-			return r
-		case r >= 'A' && r <= 'Z':
-			return r
-		case r >= '0' && r <= '9':
-			return r
-		case r == '-', r == '_', r == '.', r == ' ':
-			return r
-		default:
-			return '_'
-		}
-	}, name)
-	name = strings.Trim(name, "_. ")
-	if len(name) > 80 {
-		name = name[:80]
-	}
-	return name
+	return pathname.ArchiveSegment(name, config.ASCIIFolderNames())
 }
 
 func normalizeIDs(ids []int64, max int) []int64 {
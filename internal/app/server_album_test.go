@@ -3,12 +3,20 @@ package app
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"businessplan/usbvault/internal/audit"
 	"businessplan/usbvault/internal/db"
 )
 
@@ -133,3 +141,91 @@ func mustMediaIDsByDestPath(t *testing.T, store *db.Store, destPaths []string) [
 	}
 	return out
 }
+
+func TestAlbumItemsRenameAndDelete(t *testing.T) {
+	rootDir := t.TempDir()
+	t.Setenv("USBVAULT_DATA_DIR", filepath.Join(rootDir, "data"))
+	store, err := db.Open(filepath.Join(rootDir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	ts := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	ids := make([]int64, 0, 3)
+	for i := 0; i < 3; i++ {
+		rec := &db.MediaRecord{
+			Kind: "image", FileName: fmt.Sprintf("IMG_%04d.JPG", i), Extension: ".jpg",
+			SourceMount: "/Volumes/Test", SourcePath: fmt.Sprintf("/DCIM/IMG_%04d.JPG", i),
+			DestPath:  filepath.Join(rootDir, "library", fmt.Sprintf("IMG_%04d.JPG", i)),
+			SizeBytes: 10, SHA256: fmt.Sprintf("%064x", i+1), CaptureTime: ts, Metadata: "{}",
+			SourceMTime: ts, IngestedAt: ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		ids = append(ids, rec.ID)
+	}
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	admin := &AuthContext{Username: "admin", Role: db.RoleAdmin}
+	call := func(h func(http.ResponseWriter, *http.Request, *AuthContext), authCtx *AuthContext, method, target, id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.SetPathValue("id", id)
+		rr := httptest.NewRecorder()
+		h(rr, req, authCtx)
+		return rr
+	}
+
+	album, err := store.CreateAlbum(ctx, "Harvest")
+	if err != nil {
+		t.Fatalf("CreateAlbum: %v", err)
+	}
+	if _, err := store.CreateAlbum(ctx, "Planting"); err != nil {
+		t.Fatalf("CreateAlbum: %v", err)
+	}
+	id := strconv.FormatInt(album.ID, 10)
+	body := fmt.Sprintf(`{"ids":[%d,%d]}`, ids[0], ids[2])
+	if rr := call(app.handleAlbumAdd, admin, http.MethodPost, "/api/albums/"+id+"/items", id, body); rr.Code != http.StatusOK {
+		t.Fatalf("add items = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The media list filtered to the album shows just its items.
+	rr := call(app.handleMediaList, admin, http.MethodGet, "/api/media?album_id="+id, "", "")
+	var list struct {
+		Items []struct {
+			ID int64 `json:"id"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Items) != 2 {
+		t.Fatalf("album media = %s, %v", rr.Body.String(), err)
+	}
+
+	rr = call(app.handleAlbumGet, admin, http.MethodGet, "/api/albums/"+id, id, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"item_count":2`) {
+		t.Fatalf("get album = %d: %s", rr.Code, rr.Body.String())
+	}
+	guest := &AuthContext{Username: "guest", Role: db.RoleGuest, ScopeAlbumID: album.ID + 1}
+	if rr := call(app.handleAlbumGet, guest, http.MethodGet, "/api/albums/"+id, id, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("guest of another album = %d", rr.Code)
+	}
+
+	if rr := call(app.handleAlbumRename, admin, http.MethodPatch, "/api/albums/"+id, id, `{"name":"Planting"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("rename to a taken name = %d", rr.Code)
+	}
+	if rr := call(app.handleAlbumRename, admin, http.MethodPatch, "/api/albums/"+id, id, `{"name":"Harvest 2026"}`); rr.Code != http.StatusOK {
+		t.Fatalf("rename = %d: %s", rr.Code, rr.Body.String())
+	}
+	if got, _ := store.GetAlbumByID(ctx, album.ID); got == nil || got.Name != "Harvest 2026" || got.Version <= album.Version {
+		t.Fatalf("renamed album = %+v", got)
+	}
+
+	if rr := call(app.handleAlbumDelete, admin, http.MethodDelete, "/api/albums/"+id, id, ""); rr.Code != http.StatusOK {
+		t.Fatalf("delete = %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := call(app.handleAlbumGet, admin, http.MethodGet, "/api/albums/"+id, id, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("deleted album = %d", rr.Code)
+	}
+	if left, _ := store.ListMediaByIDs(ctx, ids); len(left) != 3 {
+		t.Fatalf("media after album delete = %d, want 3", len(left))
+	}
+}
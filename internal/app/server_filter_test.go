@@ -84,3 +84,21 @@ func TestMediaFilterFromRequestRejectsInvalidDeviceUnknown(t *testing.T) {
 		t.Fatal("mediaFilterFromRequest expected error for invalid device_unknown")
 	}
 }
+
+func TestMediaFilterFromRequestFavoritesAndRating(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest("GET", "/api/media?favorite=yes&min_rating=4", nil)
+	filter, err := mediaFilterFromRequest(req)
+	if err != nil {
+		t.Fatalf("mediaFilterFromRequest returned error: %v", err)
+	}
+	if !filter.Favorite || filter.MinRating != 4 {
+		t.Fatalf("Favorite = %v, MinRating = %d; want true, 4", filter.Favorite, filter.MinRating)
+	}
+	for _, query := range []string{"favorite=maybe", "min_rating=6", "min_rating=-1", "min_rating=x"} {
+		if _, err := mediaFilterFromRequest(httptest.NewRequest("GET", "/api/media?"+query, nil)); err == nil {
+			t.Fatalf("%s accepted", query)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package app
+
+import (
+	"testing"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func TestBuildCardEntryName(t *testing.T) {
+	t.Parallel()
+
+	used := map[string]struct{}{}
+	rec := db.MediaRecord{
+		ID:            7,
+		FileName:      "IMG_0001.CR3",
+		Extension:     ".cr3",
+		SourceCard:    "EOS_DIGITAL",
+		SourceRelPath: "DCIM/100CANON/IMG_0001.CR3",
+	}
+	if got := buildCardEntryName(rec, used); got != "EOS_DIGITAL/DCIM/100CANON/IMG_0001.CR3" {
+		t.Fatalf("entry = %q", got)
+	}
+	if got := buildCardEntryName(rec, used); got != "EOS_DIGITAL/DCIM/100CANON/IMG_0001_1.CR3" {
+		t.Fatalf("second entry = %q", got)
+	}
+
+	// A preset that renders to JPEG keeps the folders and swaps the extension.
+	rec.FileName = "IMG_0002.jpg"
+	rec.SourceRelPath = "DCIM/100CANON/IMG_0002.HEIC"
+	if got := buildCardEntryName(rec, used); got != "EOS_DIGITAL/DCIM/100CANON/IMG_0002.jpg" {
+		t.Fatalf("converted entry = %q", got)
+	}
+
+	rec.SourceRelPath = "../../etc/IMG_0003.JPG"
+	rec.FileName = "IMG_0003.JPG"
+	if got := buildCardEntryName(rec, used); got != "EOS_DIGITAL/etc/IMG_0003.JPG" {
+		t.Fatalf("escaping entry = %q", got)
+	}
+}
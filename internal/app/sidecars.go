@@ -0,0 +1,60 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+func (a *App) handleMediaSidecars(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid media id"})
+		return
+	}
+	items, err := a.store.ListMediaSidecars(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (a *App) handleMediaSidecarDownload(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	sid, ok2 := parsePathInt64(r.PathValue("sid"))
+	if !ok || !ok2 || id <= 0 || sid <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid sidecar id"})
+		return
+	}
+	sc, err := a.store.GetMediaSidecar(r.Context(), id, sid)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if sc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := a.openMediaFile(r.Context(), sc.DestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "could not open sidecar"})
+		return
+	}
+	defer f.Close()
+
+	_ = a.audit.Log(r.Context(), authCtx.Username, "sidecar_downloaded", map[string]any{
+		"media_id":   id,
+		"sidecar_id": sc.ID,
+		"kind":       sc.Kind,
+	})
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", sanitizeDownloadFilename(sc.FileName)))
+	http.ServeContent(w, r, sc.FileName, time.Time{}, f)
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"businessplan/usbvault/internal/similar"
+)
+
+const similarIndexIntervalMinutes = 10
+
+// handleMediaSimilar lists images that look like the given one, closest
+// first. The usual media filters narrow the candidates, e.g. to a date range.
+func (a *App) handleMediaSimilar(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid media id"})
+		return
+	}
+	filter, err := mediaFilterFromRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	applyGuestScope(authCtx, &filter)
+	maxDistance := similar.DefaultMaxDistance
+	if raw := r.URL.Query().Get("max_distance"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > similar.MaxDistance {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "max_distance must be 0-" + strconv.Itoa(similar.MaxDistance)})
+			return
+		}
+		maxDistance = n
+	}
+	limit := min(parsePositiveInt(r.URL.Query().Get("limit"), 24), 100)
+
+	rec, err := a.store.GetMediaByID(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if rec == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "media not found"})
+		return
+	}
+	if rec.Kind != "image" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "similar search covers images only"})
+		return
+	}
+	target, err := a.store.GetImageHash(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if target == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "image has not been indexed for similarity"})
+		return
+	}
+	candidates, err := a.store.ListImageHashes(r.Context(), filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	matches := similar.Rank(target.Hash, candidates, id, maxDistance, limit)
+
+	ids := make([]int64, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, m.MediaID)
+	}
+	records, err := a.store.ListMediaByIDs(r.Context(), ids)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	byID := make(map[int64]int, len(records))
+	for i, rec := range records {
+		byID[rec.ID] = i
+	}
+	items := make([]map[string]any, 0, len(matches))
+	for _, m := range matches {
+		i, ok := byID[m.MediaID]
+		if !ok {
+			continue
+		}
+		item := mediaListItem(records[i])
+		item["distance"] = m.Distance
+		items = append(items, item)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items, "max_distance": maxDistance})
+}
+
+func (a *App) handleSimilarStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	writeJSON(w, http.StatusOK, a.similar.GetStatus(r.Context()))
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"errors"
+	"strings"
+
+	"businessplan/usbvault/internal/db"
+)
+
+// normalizeSmartRules checks the rules of a smart album the way
+// mediaFilterFromRequest checks the same query parameters, and stores dates
+// as the RFC 3339 bounds they stand for.
+func normalizeSmartRules(in db.SmartRules) (db.SmartRules, error) {
+	out := db.SmartRules{
+		State:         strings.TrimSpace(in.State),
+		County:        strings.TrimSpace(in.County),
+		City:          strings.TrimSpace(in.City),
+		Road:          strings.TrimSpace(in.Road),
+		DeviceMake:    strings.TrimSpace(in.DeviceMake),
+		DeviceModel:   strings.TrimSpace(in.DeviceModel),
+		DeviceUnknown: in.DeviceUnknown,
+		Tag:           strings.ToLower(strings.TrimSpace(in.Tag)),
+		GPS:           strings.ToLower(strings.TrimSpace(in.GPS)),
+	}
+	kind, err := normalizeKindFilterValue(in.Kind)
+	if err != nil {
+		return db.SmartRules{}, err
+	}
+	out.Kind = kind
+	if out.GPS != "" && out.GPS != "yes" && out.GPS != "no" {
+		return db.SmartRules{}, errors.New("invalid gps filter")
+	}
+	if out.DeviceUnknown {
+		out.DeviceMake, out.DeviceModel = "", ""
+	}
+	if out.From, err = normalizeFilterTime(in.From, false); err != nil {
+		return db.SmartRules{}, errors.New("invalid from date")
+	}
+	if out.To, err = normalizeFilterTime(in.To, true); err != nil {
+		return db.SmartRules{}, errors.New("invalid to date")
+	}
+	if out.From != "" && out.To != "" && out.From > out.To {
+		return db.SmartRules{}, errors.New("from date must be before to date")
+	}
+	for _, v := range []string{out.State, out.County, out.City, out.Road, out.DeviceMake, out.DeviceModel, out.Tag} {
+		if len(v) > 200 {
+			return db.SmartRules{}, errors.New("rule value too long")
+		}
+	}
+	if out == (db.SmartRules{}) {
+		return db.SmartRules{}, errors.New("rules must set at least one condition")
+	}
+	return out, nil
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"testing"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func TestNormalizeSmartRules(t *testing.T) {
+	t.Parallel()
+
+	got, err := normalizeSmartRules(db.SmartRules{
+		State:         " Colorado ",
+		Kind:          "Video",
+		From:          "2026-03-01",
+		To:            "2026-03-31",
+		DeviceMake:    "DJI",
+		DeviceUnknown: true,
+		GPS:           "YES",
+		Tag:           " Beach ",
+	})
+	if err != nil {
+		t.Fatalf("normalizeSmartRules: %v", err)
+	}
+	want := db.SmartRules{
+		State:         "Colorado",
+		Kind:          "video",
+		From:          "2026-03-01T00:00:00Z",
+		To:            "2026-03-31T23:59:59Z",
+		DeviceUnknown: true,
+		GPS:           "yes",
+		Tag:           "beach",
+	}
+	if got != want {
+		t.Fatalf("rules = %+v, want %+v", got, want)
+	}
+
+	for name, rules := range map[string]db.SmartRules{
+		"empty":    {State: "  "},
+		"gps":      {GPS: "maybe"},
+		"kind":     {Kind: "sound"},
+		"from":     {From: "March"},
+		"reversed": {From: "2026-04-01", To: "2026-03-01"},
+	} {
+		if _, err := normalizeSmartRules(rules); err == nil {
+			t.Errorf("%s: accepted %+v", name, rules)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+)
+
+// handleStats summarises the library, each album, and each tag for the
+// current filter, so the size of every job can be read at a glance.
+func (a *App) handleStats(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	filter, err := mediaFilterFromRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	ctx := r.Context()
+	library, err := a.store.LibraryStats(ctx, filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	albums, err := a.store.ListAlbumStats(ctx, filter, 500)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	tags, err := a.store.ListTagStats(ctx, filter, 500)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"library": library, "albums": albums, "tags": tags})
+}
+
+// A card whose latest ingest ran at less than this share of its typical
+// speed is flagged as slower.
+const ingestSlowdownRatio = 0.5
+
+// ingestSpeedSummary is one card's ingest speed history at a glance.
+// Typical is the median of the sessions before the latest.
+type ingestSpeedSummary struct {
+	Mount       string  `json:"mount"`
+	FSType      string  `json:"fs_type,omitempty"`
+	Sessions    int     `json:"sessions"`
+	LastAt      string  `json:"last_at"`
+	LastMBps    float64 `json:"last_mbps"`
+	TypicalMBps float64 `json:"typical_mbps"`
+	BestMBps    float64 `json:"best_mbps"`
+	Slower      bool    `json:"slower"`
+}
+
+// handleIngestSpeed lists the ingest speed history of every card, or with
+// mount= the sessions of one card with their MB/s samples.
+func (a *App) handleIngestSpeed(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	ctx := r.Context()
+	if mount := strings.TrimSpace(r.URL.Query().Get("mount")); mount != "" {
+		sessions, err := a.store.ListIngestSpeed(ctx, config.PathKey(filepath.Clean(mount)))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+			return
+		}
+		for i := range sessions {
+			if sessions[i].Samples, err = a.store.IngestSpeedSamples(ctx, sessions[i].ID); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"mount":    mount,
+			"summary":  summarizeIngestSpeed(sessions),
+			"sessions": sessions,
+		})
+		return
+	}
+
+	sessions, err := a.store.ListIngestSpeed(ctx, "")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	byMount := map[string][]db.IngestSpeedSession{}
+	var order []string
+	for _, s := range sessions {
+		if _, ok := byMount[s.MountKey]; !ok {
+			order = append(order, s.MountKey)
+		}
+		byMount[s.MountKey] = append(byMount[s.MountKey], s)
+	}
+	items := make([]ingestSpeedSummary, 0, len(order))
+	for _, key := range order {
+		items = append(items, summarizeIngestSpeed(byMount[key]))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// summarizeIngestSpeed sums up one mount's sessions, given newest first.
+func summarizeIngestSpeed(sessions []db.IngestSpeedSession) ingestSpeedSummary {
+	var sum ingestSpeedSummary
+	if len(sessions) == 0 {
+		return sum
+	}
+	last := sessions[0]
+	sum.Mount, sum.FSType, sum.LastAt, sum.LastMBps = last.Mount, last.FSType, last.StartedAt, last.AvgMBps
+	sum.Sessions = len(sessions)
+	earlier := make([]float64, 0, len(sessions)-1)
+	for i, s := range sessions {
+		sum.BestMBps = max(sum.BestMBps, s.AvgMBps)
+		if i > 0 {
+			earlier = append(earlier, s.AvgMBps)
+		}
+	}
+	if len(earlier) == 0 {
+		sum.TypicalMBps = last.AvgMBps
+		return sum
+	}
+	slices.Sort(earlier)
+	mid := len(earlier) / 2
+	sum.TypicalMBps = earlier[mid]
+	if len(earlier)%2 == 0 {
+		sum.TypicalMBps = (earlier[mid-1] + earlier[mid]) / 2
+	}
+	sum.Slower = len(earlier) >= 2 && last.AvgMBps < sum.TypicalMBps*ingestSlowdownRatio
+	return sum
+}
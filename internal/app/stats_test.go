@@ -0,0 +1,29 @@
+package app
+
+import (
+	"testing"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func TestSummarizeIngestSpeedFlagsSlowerCard(t *testing.T) {
+	sessions := func(mbps ...float64) []db.IngestSpeedSession {
+		out := make([]db.IngestSpeedSession, len(mbps))
+		for i, v := range mbps {
+			out[i] = db.IngestSpeedSession{Mount: "/media/CARD", AvgMBps: v}
+		}
+		return out
+	}
+
+	got := summarizeIngestSpeed(sessions(20, 180, 170, 150))
+	if !got.Slower || got.TypicalMBps != 170 || got.BestMBps != 180 || got.LastMBps != 20 || got.Sessions != 4 {
+		t.Fatalf("summary = %+v, want a slower card typically at 170 MB/s", got)
+	}
+	if got := summarizeIngestSpeed(sessions(160, 180, 150)); got.Slower || got.TypicalMBps != 165 {
+		t.Fatalf("summary = %+v, want typical 165 and not slower", got)
+	}
+	// One earlier session is not enough to call the card slower.
+	if got := summarizeIngestSpeed(sessions(20, 180)); got.Slower {
+		t.Fatalf("summary = %+v, want not slower", got)
+	}
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/disk"
+)
+
+// diskFolderUsage is what a walk of base storage found in one top-level
+// folder, next to what the database records for it.
+type diskFolderUsage struct {
+	Key       string `json:"key"`
+	Count     int64  `json:"count"`
+	Bytes     int64  `json:"bytes"`
+	Missing   int64  `json:"missing"`   // recorded but not on disk
+	Untracked int64  `json:"untracked"` // on disk but not recorded
+}
+
+// handleStorageUsage breaks library storage down by top-level folder,
+// capture year, and kind from the database. With verify=1 it also walks
+// base storage and reports what is actually on disk per folder.
+func (a *App) handleStorageUsage(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	ctx := r.Context()
+	baseStorage, hasStorage, err := a.store.GetSetting(ctx, baseStorageKey)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database unavailable"})
+		return
+	}
+	if !hasStorage {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "storage is not configured"})
+		return
+	}
+	baseStorage = filepath.Clean(strings.TrimSpace(baseStorage))
+
+	usage, err := a.store.StorageUsage(ctx, baseStorage, string(filepath.Separator))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	resp := map[string]any{
+		"storage_dir": baseStorage,
+		"folders":     usage.Folders,
+		"years":       usage.Years,
+		"kinds":       usage.Kinds,
+		"compressed":  usage.Compressed,
+	}
+	if u, err := disk.Stat(baseStorage); err == nil {
+		resp["disk"] = u
+	}
+	if isTruthy(r.URL.Query().Get("verify")) {
+		recorded, err := a.store.DestPaths(ctx)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+			return
+		}
+		onDisk, err := walkStorageUsage(ctx, baseStorage, recorded)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "storage walk failed: " + err.Error()})
+			return
+		}
+		resp["on_disk"] = onDisk
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// walkStorageUsage totals the files under baseStorage per top-level folder
+// and matches them against recorded library paths. The work area and
+// partial copies are left out.
+func walkStorageUsage(ctx context.Context, baseStorage string, recorded map[string]struct{}) ([]diskFolderUsage, error) {
+	folders := map[string]*diskFolderUsage{}
+	folder := func(rel string) *diskFolderUsage {
+		key, _, found := strings.Cut(rel, string(filepath.Separator))
+		if !found {
+			key = "" // a file directly in base storage
+		}
+		f := folders[key]
+		if f == nil {
+			f = &diskFolderUsage{Key: key}
+			folders[key] = f
+		}
+		return f
+	}
+
+	seen := make(map[string]struct{}, len(recorded))
+	err := filepath.WalkDir(baseStorage, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == baseStorage {
+				return err
+			}
+			return nil // unreadable folder: counted as missing below
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if path == filepath.Join(baseStorage, config.WorkDirName) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(path, ".part") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(baseStorage, path)
+		if err != nil {
+			return nil
+		}
+		f := folder(rel)
+		f.Count++
+		f.Bytes += info.Size()
+		if _, ok := recorded[path]; ok {
+			seen[path] = struct{}{}
+		} else {
+			f.Untracked++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for path := range recorded {
+		if _, ok := seen[path]; ok || !config.IsPathWithin(path, baseStorage) {
+			continue
+		}
+		if _, err := os.Lstat(path); err == nil {
+			continue // present but skipped by the walk
+		}
+		rel, _ := filepath.Rel(baseStorage, path)
+		folder(rel).Missing++
+	}
+
+	out := make([]diskFolderUsage, 0, len(folders))
+	for _, f := range folders {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Bytes != out[j].Bytes {
+			return out[i].Bytes > out[j].Bytes
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out, nil
+}
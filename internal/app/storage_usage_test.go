@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestStorageUsageWithDiskCrossCheck(t *testing.T) {
+	rootDir := t.TempDir()
+	store, err := db.Open(filepath.Join(rootDir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	ctx := context.Background()
+	library := filepath.Join(rootDir, "library")
+	if err := store.SetSetting(ctx, baseStorageKey, library); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	write := func(rel string, size int) string {
+		path := filepath.Join(library, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	insert := func(n int, kind, capture, dest string, size int64) {
+		rec := &db.MediaRecord{
+			Kind: kind, FileName: filepath.Base(dest), Extension: filepath.Ext(dest),
+			SourceMount: "/Volumes/Test", SourcePath: fmt.Sprintf("/DCIM/%d", n), DestPath: dest,
+			SizeBytes: size, CRC32: fmt.Sprintf("%08x", n), SHA256: fmt.Sprintf("%064x", n),
+			CaptureTime: capture, Metadata: "{}", SourceMTime: capture,
+			IngestedAt: time.Now().UTC().Format(time.RFC3339),
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+	}
+
+	insert(1, "image", "2025-06-01T10:00:00Z", write("Colorado/2025/06/01/a.jpg", 100), 100)
+	insert(2, "video", "2026-01-02T10:00:00Z", write("Colorado/2026/01/02/b.mp4", 300), 300)
+	insert(3, "image", "2026-02-03T10:00:00Z", filepath.Join(library, "Unknown/2026/02/03/gone.jpg"), 50)
+	write("Unknown/2026/02/03/stray.jpg", 7)
+	write(filepath.Join(config.WorkDirName, "thumbnails", "1.jpg"), 10)
+
+	app := &App{store: store, logger: log.New(io.Discard, "", 0)}
+	req := httptest.NewRequest(http.MethodGet, "/api/storage/usage?verify=1", nil)
+	rr := httptest.NewRecorder()
+	app.handleStorageUsage(rr, req, &AuthContext{Username: "admin"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Folders []db.UsageGroup   `json:"folders"`
+		Years   []db.UsageGroup   `json:"years"`
+		Kinds   []db.UsageGroup   `json:"kinds"`
+		OnDisk  []diskFolderUsage `json:"on_disk"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	wantFolders := []db.UsageGroup{{Key: "Colorado", Count: 2, Bytes: 400}, {Key: "Unknown", Count: 1, Bytes: 50}}
+	if fmt.Sprint(resp.Folders) != fmt.Sprint(wantFolders) {
+		t.Errorf("folders = %v, want %v", resp.Folders, wantFolders)
+	}
+	wantYears := []db.UsageGroup{{Key: "2026", Count: 2, Bytes: 350}, {Key: "2025", Count: 1, Bytes: 100}}
+	if fmt.Sprint(resp.Years) != fmt.Sprint(wantYears) {
+		t.Errorf("years = %v, want %v", resp.Years, wantYears)
+	}
+	if len(resp.Kinds) != 2 || resp.Kinds[0].Key != "video" {
+		t.Errorf("kinds = %v", resp.Kinds)
+	}
+	wantDisk := []diskFolderUsage{
+		{Key: "Colorado", Count: 2, Bytes: 400},
+		{Key: "Unknown", Count: 1, Bytes: 7, Missing: 1, Untracked: 1},
+	}
+	if fmt.Sprint(resp.OnDisk) != fmt.Sprint(wantDisk) {
+		t.Errorf("on_disk = %v, want %v", resp.OnDisk, wantDisk)
+	}
+}
@@ -0,0 +1,33 @@
+package app
+
+import (
+	"context"
+
+	"businessplan/usbvault/internal/backup"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/s3"
+	"businessplan/usbvault/internal/storage"
+)
+
+// newStorageBackend returns the backend USBVAULT_STORAGE_BACKEND names. A
+// bucket is reached with the same S3 settings as backups.
+func newStorageBackend(store *db.Store) (storage.Backend, error) {
+	spec, err := config.StorageBackend()
+	if err != nil {
+		return nil, err
+	}
+	switch spec {
+	case "local":
+		return storage.NewLocal(), nil
+	case "smb":
+		return storage.NewSMB(), nil
+	}
+	return storage.NewS3(spec, func(ctx context.Context) (*s3.Client, error) {
+		cfg, err := backup.LoadS3Config(ctx, store)
+		if err != nil {
+			return nil, err
+		}
+		return s3.New(cfg)
+	})
+}
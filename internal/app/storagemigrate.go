@@ -0,0 +1,170 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/relocate"
+)
+
+// A storage migration moves the library to a new base storage folder, such
+// as a larger drive; see package relocate. Cards plugged in meanwhile are
+// held and ingested into the new folder once it is done, and the scheduled
+// jobs wait.
+
+var errMigrateBusy = errors.New("a storage migration is already running")
+
+// migrateStatus is the progress of the running storage migration, or the
+// outcome of the last one.
+type migrateStatus struct {
+	State      string `json:"state"` // idle, running, done, stopped, error
+	Actor      string `json:"actor,omitempty"`
+	From       string `json:"from,omitempty"`
+	To         string `json:"to,omitempty"`
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	relocate.Progress
+	Records *db.RelocateResult `json:"records,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+func (a *App) migrateState() migrateStatus {
+	a.migrateStateMu.Lock()
+	defer a.migrateStateMu.Unlock()
+	if a.migrate.State == "" {
+		return migrateStatus{State: "idle"}
+	}
+	return a.migrate
+}
+
+// queueMount hands a card to the ingest, or holds it while a storage
+// migration runs so its files go to the new folder.
+func (a *App) queueMount(mount string) {
+	a.migrateStateMu.Lock()
+	if a.migrate.State == "running" {
+		a.heldMounts = append(a.heldMounts, mount)
+		a.migrateStateMu.Unlock()
+		a.logger.Printf("storage migration running; %s is ingested once it is done", mount)
+		return
+	}
+	a.migrateStateMu.Unlock()
+	a.ingestor.QueueMount(mount)
+}
+
+// startMigration marks a migration from the current base storage to to as
+// running, or says why it cannot start, with the HTTP status to answer.
+func (a *App) startMigration(ctx context.Context, actor, to string) (string, int, error) {
+	if reason := a.workReason(); reason != "" {
+		return "", http.StatusConflict, errors.New(reason)
+	}
+	from, _, err := a.store.GetSetting(ctx, baseStorageKey)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	from = strings.TrimSpace(from)
+	if from == "" || from == "." {
+		return "", http.StatusConflict, errors.New("storage is not configured")
+	}
+	from = filepath.Clean(from)
+	if info, err := os.Stat(from); err != nil || !info.IsDir() {
+		return "", http.StatusConflict, errors.New("base storage is not available")
+	}
+	if err := relocate.Check(from, to); err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	a.migrateStateMu.Lock()
+	defer a.migrateStateMu.Unlock()
+	if a.migrate.State == "running" {
+		return "", http.StatusConflict, errMigrateBusy
+	}
+	a.migrate = migrateStatus{
+		State: "running", Actor: actor, From: from, To: filepath.Clean(to),
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	return from, http.StatusAccepted, nil
+}
+
+// runMigration copies the library from from to to and switches to it, then
+// lets held cards through.
+func (a *App) runMigration(ctx context.Context, actor, from, to string) {
+	res, err := relocate.Move(ctx, a.store, from, to, func(p relocate.Progress) {
+		a.migrateStateMu.Lock()
+		a.migrate.Progress = p
+		a.migrateStateMu.Unlock()
+	})
+
+	a.migrateStateMu.Lock()
+	st := &a.migrate
+	st.Progress = res.Progress
+	switch {
+	case ctx.Err() != nil:
+		st.State = "stopped"
+	case err != nil:
+		st.State, st.Error = "error", err.Error()
+	default:
+		st.State = "done"
+		st.Records = &res.Records
+	}
+	st.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	final := *st
+	held := a.heldMounts
+	a.heldMounts = nil
+	a.migrateStateMu.Unlock()
+
+	details := map[string]any{
+		"from":        from,
+		"to":          final.To,
+		"state":       final.State,
+		"files":       final.CopiedFiles,
+		"bytes":       final.CopiedBytes,
+		"caught_up":   final.CaughtUp,
+		"total_files": final.TotalFiles,
+		"total_bytes": final.TotalBytes,
+	}
+	if final.Records != nil {
+		details["records"] = final.Records
+	}
+	if err != nil {
+		details["error"] = err.Error()
+		a.logger.Printf("storage migration to %s: %v", to, err)
+	}
+	_ = a.audit.Log(context.WithoutCancel(ctx), actor, "storage_migrated", details)
+	for _, mount := range held {
+		a.ingestor.QueueMount(mount)
+	}
+}
+
+type storageMigrateRequest struct {
+	BaseStorageDir string `json:"base_storage_dir"`
+}
+
+func (a *App) handleStorageMigrate(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req storageMigrateRequest
+	if err := decodeJSONBody(r, &req, 1<<12); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	to := strings.TrimSpace(req.BaseStorageDir)
+	if to == "" || !filepath.IsAbs(to) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "base_storage_dir must be an absolute path"})
+		return
+	}
+	from, code, err := a.startMigration(r.Context(), authCtx.Username, to)
+	if err != nil {
+		writeJSON(w, code, map[string]string{"error": err.Error()})
+		return
+	}
+	go a.runMigration(context.Background(), authCtx.Username, from, filepath.Clean(to))
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true, "from": from, "to": filepath.Clean(to)})
+}
+
+func (a *App) handleStorageMigrateStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	writeJSON(w, http.StatusOK, a.migrateState())
+}
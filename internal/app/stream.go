@@ -0,0 +1,227 @@
+package app
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/storage"
+)
+
+// maxStreamTranscodes is how many videos are transcoded at once; a Pi has
+// no room for more.
+const maxStreamTranscodes = 2
+
+// handleMediaStream plays a video the browser cannot, such as a .MXF file
+// or 4K footage on a Pi, by having ffmpeg remux or transcode it to MP4 on
+// the fly. Finished outputs are kept in a cache trimmed least recently
+// used first, and served from there with range requests.
+func (a *App) handleMediaStream(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	name := q.Get("profile")
+	if name == "" {
+		name = "720p"
+	}
+	profile, ok := media.StreamProfileByName(name)
+	if !ok {
+		names := make([]string, 0, len(media.StreamProfiles))
+		for _, p := range media.StreamProfiles {
+			names = append(names, p.Name)
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "profile must be one of " + strings.Join(names, ", ")})
+		return
+	}
+	start := 0
+	if raw := q.Get("start"); raw != "" {
+		sec, err := strconv.ParseFloat(raw, 64)
+		if err != nil || sec < 0 || sec > 24*3600 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "start must be a number of seconds"})
+			return
+		}
+		start = int(sec)
+	}
+
+	rec, err := a.store.GetMediaByID(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if rec == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if rec.Kind != "video" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "only videos can be streamed"})
+		return
+	}
+	if a.ffmpeg == "" {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "streaming needs ffmpeg, which is not available"})
+		return
+	}
+	// ffmpeg reads the file itself; encrypted or remote videos are played
+	// from /content as they are.
+	if !storage.IsPlainFile(rec.DestPath) {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "encrypted or remote videos cannot be transcoded"})
+		return
+	}
+
+	baseStorage, _, _ := a.store.GetSetting(r.Context(), baseStorageKey)
+	baseStorage = strings.TrimSpace(baseStorage)
+	cachePath := ""
+	if a.streamCacheBytes > 0 && baseStorage != "" && baseStorage != "." {
+		cachePath = media.StreamCachePath(baseStorage, rec.ID, profile.Name, start)
+	}
+	w.Header().Set("Content-Type", "video/mp4")
+	if cachePath != "" {
+		if f, err := os.Open(cachePath); err == nil {
+			defer f.Close()
+			now := time.Now()
+			_ = os.Chtimes(cachePath, now, now)
+			w.Header().Set("Cache-Control", "private, max-age=3600")
+			http.ServeContent(w, r, filepath.Base(cachePath), time.Time{}, f)
+			return
+		}
+	}
+
+	if a.streamJobs.Add(1) > maxStreamTranscodes {
+		a.streamJobs.Add(-1)
+		w.Header().Del("Content-Type")
+		w.Header().Set("Retry-After", "10")
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "other videos are being transcoded; try again shortly"})
+		return
+	}
+	defer a.streamJobs.Add(-1)
+
+	// The output grows as it is sent, so it cannot be ranged until it is
+	// cached; a player seeks by asking again with start.
+	w.Header().Set("Accept-Ranges", "none")
+	w.Header().Set("Cache-Control", "private, no-store")
+	var (
+		out = &flushWriter{w: w}
+		tmp *os.File
+	)
+	if cachePath != "" {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0o750); err == nil {
+			tmp, _ = os.CreateTemp(filepath.Dir(cachePath), ".stream-*")
+		}
+	}
+	if tmp != nil {
+		defer os.Remove(tmp.Name())
+		out.tee = tmp
+	}
+	err = media.Transcode(r.Context(), a.ffmpeg, rec.DestPath, profile, start, out)
+	if err != nil {
+		if tmp != nil {
+			_ = tmp.Close()
+		}
+		if r.Context().Err() == nil {
+			a.logger.Printf("stream media %d (%s): %v", rec.ID, profile.Name, err)
+		}
+		if !out.wrote {
+			w.Header().Del("Content-Type")
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "video could not be transcoded"})
+		}
+		return
+	}
+	if tmp == nil || out.teeErr != nil {
+		if tmp != nil {
+			_ = tmp.Close()
+		}
+		return
+	}
+	if err := tmp.Close(); err == nil && os.Rename(tmp.Name(), cachePath) == nil {
+		// Stamped like a replay: the kernel's write times are coarser than
+		// time.Now, and would sort a new output before one just replayed.
+		now := time.Now()
+		_ = os.Chtimes(cachePath, now, now)
+		a.trimStreamCache(baseStorage)
+	}
+}
+
+// flushWriter sends transcoded video to the client as ffmpeg writes it,
+// copying it to the cache file when there is one. A failing cache write
+// only stops the copy.
+type flushWriter struct {
+	w      http.ResponseWriter
+	tee    *os.File
+	teeErr error
+	wrote  bool
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	if f.tee != nil && f.teeErr == nil {
+		_, f.teeErr = f.tee.Write(p)
+	}
+	f.wrote = true
+	n, err := f.w.Write(p)
+	if err == nil {
+		_ = http.NewResponseController(f.w).Flush()
+	}
+	return n, err
+}
+
+// trimStreamCache removes the least recently played outputs until the
+// cache fits its size limit.
+func (a *App) trimStreamCache(baseStorage string) {
+	a.streamCacheMu.Lock()
+	defer a.streamCacheMu.Unlock()
+
+	type cached struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var (
+		files []cached
+		total int64
+	)
+	root := media.StreamCacheRoot(baseStorage)
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			// A partial output left by a restart mid-transcode.
+			if time.Since(info.ModTime()) > 24*time.Hour {
+				_ = os.Remove(path)
+			}
+			return nil
+		}
+		files = append(files, cached{path: path, size: info.Size(), used: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	slices.SortFunc(files, func(x, y cached) int { return x.used.Compare(y.used) })
+	for _, f := range files {
+		if total <= a.streamCacheBytes {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			total -= f.size
+			_ = os.Remove(filepath.Dir(f.path)) // the item's folder, once empty
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+)
+
+func TestStreamTranscodesAndCaches(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+	rootDir := t.TempDir()
+	store, err := db.Open(filepath.Join(rootDir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	library := filepath.Join(rootDir, "library")
+	if err := store.SetSetting(ctx, baseStorageKey, library); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	original := filepath.Join(library, "C0001.MXF")
+	if err := os.MkdirAll(library, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(original, []byte("mxf"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The fake ffmpeg writes its arguments as the "video" and counts its
+	// runs.
+	runs := filepath.Join(rootDir, "runs")
+	ffmpeg := filepath.Join(rootDir, "ffmpeg")
+	script := fmt.Sprintf("#!/bin/sh\necho run >> %q\necho \"$@\"\n", runs)
+	if err := os.WriteFile(ffmpeg, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	rec := &db.MediaRecord{
+		Kind: "video", FileName: "C0001.MXF", Extension: ".mxf",
+		SourceMount: "/Volumes/Test", SourcePath: "/XDROOT/C0001.MXF", DestPath: original,
+		SizeBytes: 3, CRC32: "00000001", SHA256: fmt.Sprintf("%064x", 1),
+		CaptureTime: ts, Metadata: "{}", SourceMTime: ts, IngestedAt: ts,
+	}
+	if err := store.InsertMedia(ctx, rec); err != nil {
+		t.Fatalf("InsertMedia: %v", err)
+	}
+
+	app := &App{store: store, logger: log.New(io.Discard, "", 0), ffmpeg: ffmpeg, streamCacheBytes: 1 << 20}
+	get := func(query string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/media/%d/stream?%s", rec.ID, query), nil)
+		req.SetPathValue("id", fmt.Sprint(rec.ID))
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rr := httptest.NewRecorder()
+		app.handleMediaStream(rr, req, &AuthContext{Username: "admin"})
+		return rr
+	}
+
+	rr := get("profile=720p&start=12.5")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "video/mp4" || rr.Header().Get("Accept-Ranges") != "none" {
+		t.Fatalf("first stream = %d %v: %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	args := rr.Body.String()
+	for _, want := range []string{"-ss 12 ", "file:" + original, "min(720,ih)", "-map_metadata -1", "pipe:1"} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("ffmpeg args %q lack %q", args, want)
+		}
+	}
+	if _, err := os.Stat(media.StreamCachePath(library, rec.ID, "720p", 12)); err != nil {
+		t.Fatalf("output was not cached: %v", err)
+	}
+
+	// Played again, it comes from the cache, with ranges.
+	rr = get("profile=720p&start=12", "Range", "bytes=0-1")
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != args[:2] {
+		t.Fatalf("cached range = %d: %q", rr.Code, rr.Body.String())
+	}
+	if b, _ := os.ReadFile(runs); strings.Count(string(b), "run") != 1 {
+		t.Fatalf("ffmpeg ran %d times", strings.Count(string(b), "run"))
+	}
+
+	if rr := get("profile=4k"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("profile=4k = %d", rr.Code)
+	}
+	// Only the most recently played outputs stay within the limit.
+	app.streamCacheBytes = int64(len(args))
+	if rr := get("profile=remux"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "-c copy") {
+		t.Fatalf("remux = %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(media.StreamCachePath(library, rec.ID, "720p", 12)); !os.IsNotExist(err) {
+		t.Fatalf("least recently played output kept: %v", err)
+	}
+	if _, err := os.Stat(media.StreamCachePath(library, rec.ID, "remux", 0)); err != nil {
+		t.Fatalf("newest output trimmed: %v", err)
+	}
+}
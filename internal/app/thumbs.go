@@ -0,0 +1,228 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/storage"
+)
+
+var errNoThumbnail = errors.New("no thumbnail for this item")
+
+// handleMediaThumb serves GET /api/media/{id}/thumbnail?size=, where size
+// is 320 (the default) or 1024. GET /api/media/{id}/thumb is the older
+// name for the 320 px size.
+func (a *App) handleMediaThumb(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid media id"})
+		return
+	}
+	size := media.ThumbSmall
+	if raw := r.URL.Query().Get("size"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || !media.IsThumbnailSize(n) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("size must be %d or %d", media.ThumbSmall, media.ThumbLarge)})
+			return
+		}
+		size = n
+	}
+	rec, err := a.store.GetMediaByID(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if rec == nil {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := a.thumbnail(r.Context(), rec, size)
+	if errors.Is(err, errNoThumbnail) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		a.logger.Printf("thumbnail media %d: %v", rec.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to render thumbnail"})
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	// A media item's content never changes, so neither does its thumbnail.
+	w.Header().Set("Cache-Control", "private, max-age=604800, immutable")
+	_, _ = w.Write(body)
+	a.noteThumbnailView(authCtx.UserID, thumbURL(*rec, size))
+}
+
+// thumbnail returns the cached thumbnail of rec at size. Ingest renders
+// thumbnails as it goes; anything it missed is rendered here, every size
+// at once, and cached. The cache is encrypted like the library when
+// library encryption is on.
+func (a *App) thumbnail(ctx context.Context, rec *db.MediaRecord, size int) ([]byte, error) {
+	if !hasThumbnail(*rec) {
+		return nil, errNoThumbnail
+	}
+	baseStorage, _, err := a.store.GetSetting(ctx, baseStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	baseStorage = strings.TrimSpace(baseStorage)
+	if cachePath := media.ThumbnailPath(baseStorage, rec.ID, size); cachePath != "" {
+		if f, err := a.openMediaFile(ctx, cachePath); err == nil {
+			defer f.Close()
+			return io.ReadAll(f)
+		}
+	}
+
+	// Decoding a full-size image is the expensive part; the resource
+	// budget caps how many run at once.
+	if err := a.thumbLimiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer a.thumbLimiter.Release()
+	var img *image.RGBA
+	if rec.Kind == "video" {
+		img, _, err = a.posterFrame(ctx, rec)
+	} else {
+		img, err = a.decodeThumbnailSource(ctx, rec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.readOnly {
+		baseStorage = "" // rendered, but not cached
+	}
+	thumbs, err := a.cacheThumbnails(baseStorage, rec.ID, img)
+	if err != nil {
+		return nil, err
+	}
+	return thumbs[size], nil
+}
+
+func (a *App) decodeThumbnailSource(ctx context.Context, rec *db.MediaRecord) (*image.RGBA, error) {
+	src, err := a.openMediaFile(ctx, rec.DestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	img, err := media.DecodeThumbnailSource(src, rec.Extension)
+	if err != nil {
+		return nil, errNoThumbnail
+	}
+	return img, nil
+}
+
+// posterFrame extracts a video's poster frame and duration with ffmpeg.
+// ffmpeg needs a plain file, so encrypted or remote library videos only get
+// a poster while ingest can read them from the card.
+func (a *App) posterFrame(ctx context.Context, rec *db.MediaRecord) (*image.RGBA, float64, error) {
+	if a.ffmpeg == "" || !storage.IsPlainFile(rec.DestPath) {
+		return nil, 0, errNoThumbnail
+	}
+	return media.ExtractPoster(ctx, a.ffmpeg, rec.DestPath)
+}
+
+// cacheThumbnails renders img at every thumbnail size and caches the
+// results when base storage is set.
+func (a *App) cacheThumbnails(baseStorage string, id int64, img *image.RGBA) (map[int][]byte, error) {
+	thumbs, err := media.RenderThumbnails(img)
+	if err != nil {
+		return nil, err
+	}
+	if baseStorage != "" {
+		for s, body := range thumbs {
+			if err := media.WriteThumbnail(media.ThumbnailPath(baseStorage, id, s), body, a.libKey); err != nil {
+				a.logger.Printf("cache thumbnail %d: %v", id, err)
+			}
+		}
+	}
+	return thumbs, nil
+}
+
+// posterBackfill extracts posters for videos that have not had one tried,
+// such as those ingested before ffmpeg was installed.
+func (a *App) posterBackfill(ctx context.Context, baseStorage string) error {
+	if a.ffmpeg == "" {
+		return nil
+	}
+	for {
+		page, err := a.store.ListVideosWithoutPoster(ctx, thumbnailBackfillPage)
+		if err != nil || len(page) == 0 {
+			return err
+		}
+		for i := range page {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := a.thumbLimiter.Acquire(ctx); err != nil {
+				return nil
+			}
+			img, duration, err := a.posterFrame(ctx, &page[i])
+			if err == nil {
+				_, err = a.cacheThumbnails(baseStorage, page[i].ID, img)
+			}
+			a.thumbLimiter.Release()
+			if ctx.Err() != nil {
+				return nil
+			}
+			status := db.PosterReady
+			if err != nil {
+				status = db.PosterFailed
+				if !errors.Is(err, errNoThumbnail) {
+					a.logger.Printf("backfill poster %d: %v", page[i].ID, err)
+				}
+			}
+			dur := sql.NullFloat64{Float64: duration, Valid: duration > 0}
+			if err := a.store.SetVideoPoster(ctx, page[i].ID, status, dur); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// warmThumbnails renders missing thumbnails for records in the background
+// so the next page of a grid loads from cache. Only one warm-up runs at a
+// time; a request arriving while one is busy is dropped.
+func (a *App) warmThumbnails(records []db.MediaRecord) {
+	if !a.thumbWarmMu.TryLock() {
+		return
+	}
+	go func() {
+		defer a.thumbWarmMu.Unlock()
+		ctx := context.Background()
+		for i := range records {
+			if _, err := a.thumbnail(ctx, &records[i], media.ThumbSmall); err != nil && !errors.Is(err, errNoThumbnail) {
+				a.logger.Printf("warm thumbnail %d: %v", records[i].ID, err)
+			}
+		}
+	}()
+}
+
+// hasThumbnail reports whether rec has thumbnails: images the media
+// package can render, and videos with a poster.
+func hasThumbnail(rec db.MediaRecord) bool {
+	switch rec.Kind {
+	case "image":
+		return media.CanThumbnail(rec.Extension)
+	case "video":
+		return rec.PosterStatus == db.PosterReady
+	}
+	return false
+}
+
+// thumbURL is where rec's thumbnail at size is served, or "" when none can
+// be made.
+func thumbURL(rec db.MediaRecord, size int) string {
+	if !hasThumbnail(rec) {
+		return ""
+	}
+	return fmt.Sprintf("/api/media/%d/thumbnail?size=%d", rec.ID, size)
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/budget"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+)
+
+func TestMediaThumbIsRenderedOnceAndCached(t *testing.T) {
+	rootDir := t.TempDir()
+	store, err := db.Open(filepath.Join(rootDir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	ctx := context.Background()
+	library := filepath.Join(rootDir, "library")
+	if err := store.SetSetting(ctx, baseStorageKey, library); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	original := filepath.Join(library, "IMG_0001.PNG")
+	if err := os.MkdirAll(library, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 1200, 800))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	ts := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	rec := &db.MediaRecord{
+		Kind: "image", FileName: "IMG_0001.PNG", Extension: ".png",
+		SourceMount: "/Volumes/Test", SourcePath: "/DCIM/IMG_0001.PNG", DestPath: original,
+		SizeBytes: 1, CRC32: "00000001", SHA256: fmt.Sprintf("%064x", 1),
+		CaptureTime: ts, Metadata: "{}", SourceMTime: ts, IngestedAt: ts,
+	}
+	if err := store.InsertMedia(ctx, rec); err != nil {
+		t.Fatalf("InsertMedia: %v", err)
+	}
+
+	app := &App{store: store, logger: log.New(io.Discard, "", 0), thumbLimiter: budget.NewLimiter(1)}
+	get := func(size int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/media/%d/thumbnail?size=%d", rec.ID, size), nil)
+		req.SetPathValue("id", fmt.Sprint(rec.ID))
+		rr := httptest.NewRecorder()
+		app.handleMediaThumb(rr, req, &AuthContext{Username: "admin"})
+		return rr
+	}
+
+	rr := get(media.ThumbSmall)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+	img, err := jpeg.Decode(rr.Body)
+	if err != nil {
+		t.Fatalf("decode thumbnail: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != media.ThumbSmall || b.Dy() > media.ThumbSmall {
+		t.Fatalf("thumbnail is %dx%d", b.Dx(), b.Dy())
+	}
+	for _, size := range media.ThumbnailSizes {
+		if _, err := os.Stat(media.ThumbnailPath(library, rec.ID, size)); err != nil {
+			t.Fatalf("%d px thumbnail was not cached: %v", size, err)
+		}
+	}
+	if rr := get(999); rr.Code != http.StatusBadRequest {
+		t.Fatalf("unsupported size = %d", rr.Code)
+	}
+
+	// With the original gone, the cached copies are still served.
+	if err := os.Remove(original); err != nil {
+		t.Fatal(err)
+	}
+	rr = get(media.ThumbLarge)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("cached status = %d: %s", rr.Code, rr.Body.String())
+	}
+	if img, err := jpeg.Decode(rr.Body); err != nil || img.Bounds().Dx() != media.ThumbLarge {
+		t.Fatalf("large thumbnail: %v", err)
+	}
+}
+
+func TestPosterBackfillRecordsVideoPosters(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+	rootDir := t.TempDir()
+	store, err := db.Open(filepath.Join(rootDir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	library := filepath.Join(rootDir, "library")
+
+	var frame bytes.Buffer
+	if err := jpeg.Encode(&frame, image.NewRGBA(image.Rect(0, 0, 1920, 1080)), nil); err != nil {
+		t.Fatal(err)
+	}
+	framePath := filepath.Join(rootDir, "frame.jpg")
+	if err := os.WriteFile(framePath, frame.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ffmpeg := filepath.Join(rootDir, "ffmpeg")
+	script := "#!/bin/sh\n" +
+		"case \"$*\" in *broken*) echo 'Invalid data found when processing input' >&2; exit 1;; esac\n" +
+		"echo '  Duration: 00:01:05.00, start: 0.000000' >&2\n" +
+		"cat '" + framePath + "'\n"
+	if err := os.WriteFile(ffmpeg, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	insert := func(name string, n int) *db.MediaRecord {
+		rec := &db.MediaRecord{
+			Kind: "video", FileName: name, Extension: ".mp4",
+			SourceMount: "/Volumes/Test", SourcePath: "/DCIM/" + name, DestPath: filepath.Join(library, name),
+			SizeBytes: 1, CRC32: "00000001", SHA256: fmt.Sprintf("%064x", n),
+			CaptureTime: ts, Metadata: "{}", SourceMTime: ts, IngestedAt: ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		return rec
+	}
+	good, broken := insert("DJI_0001.mp4", 1), insert("broken.mp4", 2)
+
+	app := &App{store: store, logger: log.New(io.Discard, "", 0), thumbLimiter: budget.NewLimiter(1), ffmpeg: ffmpeg}
+	if err := app.posterBackfill(ctx, library); err != nil {
+		t.Fatalf("posterBackfill: %v", err)
+	}
+
+	got, err := store.GetMediaByID(ctx, good.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PosterStatus != db.PosterReady || got.DurationSec.Float64 != 65 || thumbURL(*got, media.ThumbSmall) == "" {
+		t.Fatalf("video = %q, %v s", got.PosterStatus, got.DurationSec)
+	}
+	for _, size := range media.ThumbnailSizes {
+		if _, err := os.Stat(media.ThumbnailPath(library, good.ID, size)); err != nil {
+			t.Fatalf("%d px poster was not cached: %v", size, err)
+		}
+	}
+	if got, _ := store.GetMediaByID(ctx, broken.ID); got.PosterStatus != db.PosterFailed || thumbURL(*got, media.ThumbSmall) != "" {
+		t.Fatalf("broken video = %q", got.PosterStatus)
+	}
+	if left, _ := store.ListVideosWithoutPoster(ctx, 10); len(left) != 0 {
+		t.Fatalf("%d videos still waiting for a poster", len(left))
+	}
+}
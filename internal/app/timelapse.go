@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/timelapse"
+)
+
+const timelapseIntervalMinutes = 30
+
+func (a *App) handleTimelapses(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	items, err := a.store.ListTimelapses(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// handleTimelapse returns a sequence with the ids of its stills in order.
+func (a *App) handleTimelapse(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	tl, ok := a.timelapseFromPath(w, r)
+	if !ok {
+		return
+	}
+	frames, err := a.store.ListTimelapseFrames(r.Context(), tl.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	ids := make([]int64, len(frames))
+	for i, f := range frames {
+		ids[i] = f.MediaID
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"timelapse": tl, "media_ids": ids})
+}
+
+// handleMediaTimelapse returns the sequence a still belongs to, so the
+// gallery can offer its video next to it.
+func (a *App) handleMediaTimelapse(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid media id"})
+		return
+	}
+	tl, err := a.store.GetTimelapseForMedia(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if tl == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "item is not part of a time-lapse"})
+		return
+	}
+	writeJSON(w, http.StatusOK, tl)
+}
+
+// handleTimelapseVideo plays a rendered sequence, with range requests so
+// browsers can seek.
+func (a *App) handleTimelapseVideo(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	tl, ok := a.timelapseFromPath(w, r)
+	if !ok {
+		return
+	}
+	if tl.Status != db.TimelapseReady || tl.VideoPath == "" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "time-lapse has not been rendered"})
+		return
+	}
+	info, err := os.Stat(tl.VideoPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := a.openMediaFile(r.Context(), tl.VideoPath)
+	if err != nil {
+		a.logger.Printf("open timelapse %d: %v", tl.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "video could not be read"})
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, fmt.Sprintf("timelapse-%d.mp4", tl.ID), info.ModTime(), body)
+}
+
+func (a *App) timelapseFromPath(w http.ResponseWriter, r *http.Request) (*db.Timelapse, bool) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid time-lapse id"})
+		return nil, false
+	}
+	tl, err := a.store.GetTimelapse(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return nil, false
+	}
+	if tl == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "time-lapse not found"})
+		return nil, false
+	}
+	return tl, true
+}
+
+// handleTimelapseRetry queues a sequence to be rendered again, such as one
+// that failed while ffmpeg was missing a codec.
+func (a *App) handleTimelapseRetry(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	id, ok := parsePathInt64(r.PathValue("id"))
+	if !ok || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid time-lapse id"})
+		return
+	}
+	found, err := a.store.RetryTimelapse(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "time-lapse not found"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "timelapse_retry", map[string]any{"timelapse_id": id})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func (a *App) handleTimelapseStatus(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	if a.timelapse == nil {
+		writeJSON(w, http.StatusOK, timelapse.Status{State: "disabled"})
+		return
+	}
+	writeJSON(w, http.StatusOK, a.timelapse.GetStatus(r.Context()))
+}
+
+// handleTimelapseRun looks for sequences and renders them now instead of
+// waiting for the next tick.
+func (a *App) handleTimelapseRun(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	if a.timelapse == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "time-lapse assembly is not enabled"})
+		return
+	}
+	if a.timelapse.GetStatus(r.Context()).State == "running" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": timelapse.ErrBusy.Error()})
+		return
+	}
+	go func() {
+		if err := a.timelapse.RunOnce(context.Background()); err != nil && !errors.Is(err, timelapse.ErrBusy) {
+			a.logger.Printf("time-lapse assembly failed: %v", err)
+		}
+	}()
+	_ = a.audit.Log(r.Context(), authCtx.Username, "timelapse_started", map[string]any{})
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/tlscert"
+)
+
+// loadTLS prepares the HTTPS certificate when TLS is on, leaving
+// a.tlsConfig nil for plain HTTP. Without an operator certificate a
+// self-signed one is generated on first run for this machine's names and
+// addresses, and its fingerprint logged so users can check it in the
+// browser warning.
+func (a *App) loadTLS(bindHost string) error {
+	if !config.TLSEnabled() {
+		return nil
+	}
+	certPath, keyPath := config.TLSCertPath(), config.TLSKeyPath()
+	var cert tls.Certificate
+	if config.TLSUserProvided() {
+		loaded, err := tlscert.Load(certPath, keyPath)
+		if err != nil {
+			return err
+		}
+		cert = loaded
+	} else {
+		loaded, created, err := tlscert.LoadOrCreate(certPath, keyPath, selfSignedHosts(bindHost))
+		if err != nil {
+			return err
+		}
+		if created {
+			a.logger.Printf("generated a self-signed TLS certificate at %s", certPath)
+		}
+		a.logger.Printf("TLS certificate fingerprint (SHA-256) %s", tlscert.Fingerprint(loaded))
+		cert = loaded
+	}
+	a.tlsConfig = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	return nil
+}
+
+// selfSignedHosts are the names a self-signed certificate is issued for:
+// loopback, the host name with and without .local, the bind address, and
+// the addresses the machine has now.
+func selfSignedHosts(bindHost string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1", bindHost}
+	if name, err := os.Hostname(); err == nil && name != "" {
+		hosts = append(hosts, name, name+".local")
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				hosts = append(hosts, ipNet.IP.String())
+			}
+		}
+	}
+	return hosts
+}
+
+func (a *App) scheme() string {
+	if a.tlsConfig != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,297 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/storage"
+)
+
+// A delete moves the file and its sidecars into the trash work area under
+// base storage, where they stay until the retention period ends. Until
+// then the item can be restored under its old id. Content on legal hold is
+// never purged from the trash.
+
+const (
+	trashRetentionKey         = "trash_retention_days"
+	defaultTrashRetentionDays = 30
+	maxTrashRetentionDays     = 3650
+	trashPurgeInterval        = time.Hour
+	trashPurgeBatch           = 200
+)
+
+// errTrashOccupied means something else now sits where a trashed file
+// would go back.
+var errTrashOccupied = errors.New("another file is now at its place in the library")
+
+// trashRetentionDays is how many days deleted items are kept.
+func (a *App) trashRetentionDays(ctx context.Context) (int, error) {
+	raw, ok, err := a.store.GetSetting(ctx, trashRetentionKey)
+	if err != nil || !ok {
+		return defaultTrashRetentionDays, err
+	}
+	days, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || days < 1 || days > maxTrashRetentionDays {
+		return defaultTrashRetentionDays, nil
+	}
+	return days, nil
+}
+
+// moveToTrash moves a library file and its sidecars into the trash and
+// returns the folder they went to. Files in remote storage, or in a
+// library with no base storage, stay where they are and the folder is
+// empty.
+func moveToTrash(baseStorage, destPath string, id int64, sidecars []db.Sidecar) (string, error) {
+	if !storage.IsLocal(destPath) || baseStorage == "." || baseStorage == "" {
+		return "", nil
+	}
+	dir := filepath.Join(config.WorkAreaDir(baseStorage, config.WorkAreaTrash), strconv.FormatInt(id, 10))
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	if err := os.Rename(destPath, filepath.Join(dir, filepath.Base(destPath))); err != nil && !errors.Is(err, os.ErrNotExist) {
+		_ = os.Remove(dir)
+		return "", err
+	}
+	for _, sc := range sidecars {
+		if storage.IsLocal(sc.DestPath) && sc.DestPath != "" {
+			_ = os.Rename(sc.DestPath, filepath.Join(dir, filepath.Base(sc.DestPath)))
+		}
+	}
+	cleanupEmptyParents(destPath, baseStorage)
+	return dir, nil
+}
+
+// moveFromTrash puts a trashed item's files back where they were. It
+// leaves everything in the trash if the file's place is taken.
+func moveFromTrash(item db.TrashItem) error {
+	if item.TrashDir == "" {
+		return nil
+	}
+	if _, err := os.Lstat(item.Record.DestPath); err == nil {
+		return errTrashOccupied
+	}
+	if err := os.MkdirAll(filepath.Dir(item.Record.DestPath), 0o750); err != nil {
+		return err
+	}
+	if err := os.Rename(filepath.Join(item.TrashDir, filepath.Base(item.Record.DestPath)), item.Record.DestPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, sc := range item.Sidecars {
+		if storage.IsLocal(sc.DestPath) && sc.DestPath != "" {
+			_ = os.Rename(filepath.Join(item.TrashDir, filepath.Base(sc.DestPath)), sc.DestPath)
+		}
+	}
+	_ = os.Remove(item.TrashDir)
+	return nil
+}
+
+// returnToTrash undoes moveFromTrash when the record cannot come back.
+func returnToTrash(item db.TrashItem) error {
+	if item.TrashDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(item.TrashDir, 0o750); err != nil {
+		return err
+	}
+	for _, sc := range item.Sidecars {
+		if storage.IsLocal(sc.DestPath) && sc.DestPath != "" {
+			_ = os.Rename(sc.DestPath, filepath.Join(item.TrashDir, filepath.Base(sc.DestPath)))
+		}
+	}
+	err := os.Rename(item.Record.DestPath, filepath.Join(item.TrashDir, filepath.Base(item.Record.DestPath)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// purgeTrash removes for good the items kept in the trash longer than the
+// retention period. An item that fails is kept with its error and tried
+// again next run.
+func (a *App) purgeTrash(ctx context.Context) error {
+	a.trashMu.Lock()
+	defer a.trashMu.Unlock()
+
+	days, err := a.trashRetentionDays(ctx)
+	if err != nil {
+		return err
+	}
+	due, err := a.store.DueTrash(ctx, time.Now().AddDate(0, 0, -days), trashPurgeBatch)
+	if err != nil || len(due) == 0 {
+		return err
+	}
+	baseStorage, _, _ := a.store.GetSetting(ctx, baseStorageKey)
+	baseStorage = filepath.Clean(strings.TrimSpace(baseStorage))
+	trashRoot := config.WorkAreaDir(baseStorage, config.WorkAreaTrash)
+
+	var (
+		purged, failed int
+		bytes          int64
+		ids            = make([]int64, 0, len(due))
+	)
+	for _, item := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := a.removeTrashed(ctx, item, trashRoot); err != nil {
+			failed++
+			_ = a.store.SetTrashError(ctx, item.MediaID, err.Error())
+			continue
+		}
+		if err := a.store.FinishTrash(ctx, item.MediaID); err != nil {
+			failed++
+			continue
+		}
+		removeThumbnails(baseStorage, item.MediaID)
+		purged++
+		bytes += item.SizeBytes
+		ids = append(ids, item.MediaID)
+	}
+	if purged > 0 || failed > 0 {
+		_ = a.audit.Log(ctx, "system", "trash_purged", map[string]any{
+			"purged":         purged,
+			"media_ids":      ids,
+			"bytes":          bytes,
+			"failed":         failed,
+			"retention_days": days,
+		})
+	}
+	return nil
+}
+
+// removeTrashed deletes a trashed item's files, from the trash folder or,
+// when they stayed in place, from the library.
+func (a *App) removeTrashed(ctx context.Context, item db.TrashItem, trashRoot string) error {
+	if item.TrashDir != "" {
+		if !config.IsPathWithin(item.TrashDir, trashRoot) {
+			return errors.New("trash folder is outside the trash")
+		}
+		return os.RemoveAll(item.TrashDir)
+	}
+	if err := a.libraryStorage().Remove(ctx, item.Record.DestPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, sc := range item.Sidecars {
+		_ = a.libraryStorage().Remove(ctx, sc.DestPath)
+	}
+	return nil
+}
+
+func (a *App) handleTrashList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	items, err := a.store.ListTrash(r.Context(), parsePositiveInt(r.URL.Query().Get("limit"), 1000))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	days, err := a.trashRetentionDays(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items, "retention_days": days})
+}
+
+type trashRestoreRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+// handleTrashRestore brings deleted items back to the library under the
+// ids they had.
+func (a *App) handleTrashRestore(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req trashRestoreRequest
+	if err := decodeJSONBody(r, &req, 1<<20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	ids := normalizeIDs(req.IDs, 5000)
+	if len(ids) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ids must contain at least one positive id"})
+		return
+	}
+
+	a.trashMu.Lock()
+	defer a.trashMu.Unlock()
+	var (
+		notFound, conflict, failed int
+		restored                   = make([]int64, 0, len(ids))
+	)
+	for _, id := range ids {
+		item, err := a.store.GetTrash(r.Context(), id)
+		if errors.Is(err, db.ErrTrashNotFound) {
+			notFound++
+			continue
+		}
+		if err != nil {
+			failed++
+			continue
+		}
+		if err := moveFromTrash(item); err != nil {
+			if errors.Is(err, errTrashOccupied) {
+				conflict++
+			} else {
+				failed++
+			}
+			continue
+		}
+		if _, err := a.store.RestoreTrash(r.Context(), id); err != nil {
+			// Leave the files with the entry that still points at them.
+			if moveErr := returnToTrash(item); moveErr != nil {
+				a.logger.Printf("trash restore of %d: %v", id, moveErr)
+			}
+			if db.IsUniqueViolation(err) {
+				conflict++
+			} else {
+				failed++
+			}
+			continue
+		}
+		restored = append(restored, id)
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "media_restored", map[string]any{
+		"requested": len(ids),
+		"media_ids": restored,
+		"not_found": notFound,
+		"conflict":  conflict,
+		"failed":    failed,
+	})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ok":        true,
+		"requested": len(ids),
+		"restored":  len(restored),
+		"not_found": notFound,
+		"conflict":  conflict,
+		"failed":    failed,
+	})
+}
+
+type trashRetentionRequest struct {
+	Days int `json:"days"`
+}
+
+func (a *App) handleTrashRetention(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	var req trashRetentionRequest
+	if err := decodeJSONBody(r, &req, 1<<12); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if req.Days < 1 || req.Days > maxTrashRetentionDays {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("days must be between 1 and %d", maxTrashRetentionDays)})
+		return
+	}
+	if err := a.store.SetSetting(r.Context(), trashRetentionKey, strconv.Itoa(req.Days)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update trash retention"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "trash_retention_updated", map[string]any{"days": req.Days})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "retention_days": req.Days})
+}
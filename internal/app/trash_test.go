@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestDeleteGoesToTrashAndRestores(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	library := filepath.Join(root, "library")
+	if err := store.SetSetting(ctx, baseStorageKey, library); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	app := &App{store: store, audit: audit.New(store), logger: log.New(io.Discard, "", 0)}
+	authCtx := &AuthContext{Username: "admin", Role: db.RoleAdmin}
+
+	path := filepath.Join(library, "2026", "a.jpg")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rec := db.MediaRecord{
+		Kind: "image", FileName: "a.jpg", Extension: ".jpg", SourceMount: "/media/card",
+		SourcePath: "/media/card/a.jpg", DestPath: path, SizeBytes: 1,
+		SHA256: strings.Repeat("a", 64), CaptureTime: "2026-10-01T12:00:00Z", IngestedAt: "2026-10-01T12:00:00Z",
+	}
+	if err := store.InsertMedia(ctx, &rec); err != nil {
+		t.Fatalf("InsertMedia: %v", err)
+	}
+	album, err := store.CreateAlbum(ctx, "Trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.AddMediaToAlbum(ctx, album.ID, []int64{rec.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AddMediaTags(ctx, rec.ID, []string{"bridge"}, "user"); err != nil {
+		t.Fatal(err)
+	}
+	// What the background jobs and cloud sync recorded comes back too.
+	if err := store.RecordFaceScan(ctx, rec.ID, []db.FaceRegion{{X: 0.1, Y: 0.1, W: 0.2, H: 0.2, Score: 0.9}}, ""); err != nil {
+		t.Fatal(err)
+	}
+	faces, err := store.ListFaces(ctx, rec.ID)
+	if err != nil || len(faces) != 1 {
+		t.Fatalf("ListFaces = %v, %v", faces, err)
+	}
+	if _, err := store.NameFace(ctx, faces[0].ID, "Ann"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RecordOCR(ctx, rec.ID, "Golden Gate", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RecordImageHash(ctx, rec.ID, 0xfedcba9876543210, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RecordCloudSync(ctx, rec.ID, "s3", "2026/a.jpg", rec.SHA256, nil); err != nil {
+		t.Fatal(err)
+	}
+	place := db.Place{Name: "Bridge", Lat: 37.82, Lon: -122.48, RadiusM: 500}
+	if err := store.CreatePlace(ctx, &place); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.MatchMediaPlaces(ctx, rec.ID, 37.82, -122.48); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(h func(http.ResponseWriter, *http.Request, *AuthContext), method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest(method, target, strings.NewReader(body)), authCtx)
+		return rr
+	}
+	ids := fmt.Sprintf(`{"ids":[%d]}`, rec.ID)
+	trashed := filepath.Join(config.WorkAreaDir(library, config.WorkAreaTrash), fmt.Sprint(rec.ID), "a.jpg")
+
+	if rr := call(app.handleMediaDelete, http.MethodPost, "/api/media/delete", ids); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"deleted":1`) {
+		t.Fatalf("delete = %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("file left in the library: %v", err)
+	}
+	if _, err := os.Stat(trashed); err != nil {
+		t.Fatalf("file not in the trash: %v", err)
+	}
+	// Ann's only face went with the item; she is named again on restore.
+	if _, err := store.DB.ExecContext(ctx, `DELETE FROM people`); err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := store.ListMediaByIDs(ctx, []int64{rec.ID}); len(left) != 0 {
+		t.Fatal("trashed item still listed")
+	}
+	var list struct {
+		Items         []db.TrashItem `json:"items"`
+		RetentionDays int            `json:"retention_days"`
+	}
+	if err := json.Unmarshal(call(app.handleTrashList, http.MethodGet, "/api/trash", "").Body.Bytes(), &list); err != nil ||
+		len(list.Items) != 1 || list.Items[0].MediaID != rec.ID || list.RetentionDays != defaultTrashRetentionDays {
+		t.Fatalf("trash = %+v, %v", list, err)
+	}
+
+	if rr := call(app.handleTrashRestore, http.MethodPost, "/api/trash/restore", ids); !strings.Contains(rr.Body.String(), `"restored":1`) {
+		t.Fatalf("restore = %d: %s", rr.Code, rr.Body.String())
+	}
+	back, err := store.ListMediaByIDs(ctx, []int64{rec.ID})
+	if err != nil || len(back) != 1 || back[0].DestPath != path {
+		t.Fatalf("restored = %+v, %v", back, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file not back: %v", err)
+	}
+	if links, _ := store.ListAlbumMediaLinks(ctx, album.ID); len(links) != 1 {
+		t.Fatalf("album membership not restored: %+v", links)
+	}
+	if tags, _ := store.ListMediaTags(ctx, rec.ID); len(tags) != 1 || tags[0] != "bridge" {
+		t.Fatalf("tags = %v", tags)
+	}
+	if back, _ := store.ListFaces(ctx, rec.ID); len(back) != 1 || back[0].ID != faces[0].ID || back[0].PersonName != "Ann" {
+		t.Fatalf("faces = %+v", back)
+	}
+	if text, _ := store.GetMediaText(ctx, rec.ID); text == nil || text.Text != "Golden Gate" {
+		t.Fatalf("OCR text = %+v", text)
+	}
+	if found, _ := store.ListMediaFiltered(ctx, "id", "asc", 10, 0, db.MediaFilter{Query: "golden"}); len(found) != 1 {
+		t.Fatalf("OCR search after restore found %d", len(found))
+	}
+	if hash, _ := store.GetImageHash(ctx, rec.ID); hash == nil || hash.Hash != 0xfedcba9876543210 {
+		t.Fatalf("image hash = %+v", hash)
+	}
+	var synced string
+	if err := store.DB.QueryRowContext(ctx, `SELECT status FROM cloud_sync_files WHERE media_id = ? AND target = 's3'`, rec.ID).Scan(&synced); err != nil || synced != "done" {
+		t.Fatalf("cloud sync = %q, %v", synced, err)
+	}
+	if inPlace, _ := store.ListMediaFiltered(ctx, "id", "asc", 10, 0, db.MediaFilter{PlaceID: place.ID}); len(inPlace) != 1 {
+		t.Fatalf("place holds %d after restore", len(inPlace))
+	}
+	if rr := call(app.handleTrashRestore, http.MethodPost, "/api/trash/restore", ids); !strings.Contains(rr.Body.String(), `"not_found":1`) {
+		t.Fatalf("second restore = %s", rr.Body.String())
+	}
+
+	// Deleted again, it is purged once the retention period has passed.
+	if rr := call(app.handleMediaDelete, http.MethodPost, "/api/media/delete", ids); !strings.Contains(rr.Body.String(), `"deleted":1`) {
+		t.Fatalf("delete again = %s", rr.Body.String())
+	}
+	if err := app.purgeTrash(ctx); err != nil {
+		t.Fatalf("purgeTrash: %v", err)
+	}
+	if _, err := os.Stat(trashed); err != nil {
+		t.Fatalf("file purged early: %v", err)
+	}
+	if _, err := store.DB.ExecContext(ctx, `UPDATE media_trash SET deleted_at = '2000-01-01T00:00:00Z'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.purgeTrash(ctx); err != nil {
+		t.Fatalf("purgeTrash: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(trashed)); !os.IsNotExist(err) {
+		t.Fatalf("trash not purged: %v", err)
+	}
+	if _, err := store.GetTrash(ctx, rec.ID); err != db.ErrTrashNotFound {
+		t.Fatalf("GetTrash after purge = %v", err)
+	}
+}
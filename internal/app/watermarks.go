@@ -0,0 +1,132 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"strings"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/watermark"
+)
+
+const (
+	watermarkUploadMaxBytes = 8 << 20
+	// guestProofMaxDimension bounds watermarked previews, which are rendered
+	// on every request.
+	guestProofMaxDimension = 2048
+)
+
+var errNotWatermarkable = errors.New("this file cannot be watermarked")
+
+func (a *App) handleWatermarksList(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	_ = authCtx
+	names, err := watermark.ListOverlays(config.WatermarksDir())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list watermarks"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"overlays": names})
+}
+
+// handleWatermarkUpload stores a PNG overlay under the name given in the
+// "name" form field, replacing any overlay of that name.
+func (a *App) handleWatermarkUpload(w http.ResponseWriter, r *http.Request, authCtx *AuthContext) {
+	r.Body = http.MaxBytesReader(w, r.Body, watermarkUploadMaxBytes+1<<20)
+	if err := r.ParseMultipartForm(watermarkUploadMaxBytes); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid multipart upload"})
+		return
+	}
+	defer func() {
+		if r.MultipartForm != nil {
+			_ = r.MultipartForm.RemoveAll()
+		}
+	}()
+
+	name := strings.ToLower(strings.TrimSpace(r.FormValue("name")))
+	if !watermark.ValidOverlayName(name) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name must be 1-40 lowercase letters, digits, - or _"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no overlay file provided"})
+		return
+	}
+	defer file.Close()
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(file); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "failed to read overlay"})
+		return
+	}
+	if _, err := watermark.DecodeOverlay(bytes.NewReader(buf.Bytes())); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	dir := config.WatermarksDir()
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create watermarks directory"})
+		return
+	}
+	if err := os.WriteFile(watermark.OverlayPath(dir, name), buf.Bytes(), 0o640); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save overlay"})
+		return
+	}
+	_ = a.audit.Log(r.Context(), authCtx.Username, "watermark_uploaded", map[string]any{"name": name, "bytes": buf.Len()})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "name": name})
+}
+
+// serveWatermarked sends a guest a stamped JPEG of an image instead of its
+// original bytes. Files that cannot be decoded are refused rather than sent
+// clean.
+func (a *App) serveWatermarked(w http.ResponseWriter, r *http.Request, rec *db.MediaRecord, spec string) {
+	body, err := a.renderWatermarked(r.Context(), rec, spec)
+	if err != nil {
+		if errors.Is(err, errNotWatermarkable) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		}
+		a.logger.Printf("watermark media %d: %v", rec.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to render watermarked preview"})
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, no-store")
+	_, _ = w.Write(body)
+}
+
+func (a *App) renderWatermarked(ctx context.Context, rec *db.MediaRecord, spec string) ([]byte, error) {
+	if rec.Kind != "image" || !media.CanDecodeImage(rec.Extension) {
+		return nil, errNotWatermarkable
+	}
+	parsed, err := watermark.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	mark, err := watermark.Load(*parsed, config.WatermarksDir())
+	if err != nil {
+		return nil, err
+	}
+	src, err := a.openMediaFile(ctx, rec.DestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	img, err := media.DecodeImage(src)
+	if err != nil {
+		return nil, errNotWatermarkable
+	}
+	img = media.ResizeToFit(img, guestProofMaxDimension)
+	mark.Apply(img)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,200 @@
+// Package attest signs statements that bind media content hashes to their
+// capture and ingest times, so the provenance of footage can be shown to
+// someone who does not trust the vault itself. Statements are wrapped in a
+// DSSE envelope (https://github.com/secure-systems-lab/dsse) and signed with
+// an Ed25519 key kept in the data directory; anyone holding the public key
+// can check them with a standard DSSE verifier.
+package attest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// PayloadType names the statement format inside the envelope.
+	PayloadType = "application/vnd.usbvault.attestation+json"
+	// StatementType is the version of Statement.
+	StatementType = "usbvault-attestation/v1"
+)
+
+var ErrBadSignature = errors.New("attestation signature does not verify")
+
+// Subject is one media file covered by a statement.
+type Subject struct {
+	MediaID     int64  `json:"media_id"`
+	FileName    string `json:"file_name"`
+	SHA256      string `json:"sha256"`
+	SizeBytes   int64  `json:"size_bytes"`
+	CaptureTime string `json:"capture_time"`
+	IngestedAt  string `json:"ingested_at"`
+	Make        string `json:"make,omitempty"`
+	Model       string `json:"model,omitempty"`
+
+	// ClockUncertain is set when the vault's clock was not trusted at
+	// ingest, so IngestedAt and a capture time taken from the file's
+	// modification time may be wrong.
+	ClockUncertain bool `json:"clock_uncertain,omitempty"`
+}
+
+// Statement is what the vault vouches for: at IssuedAt, each subject's file
+// hashed to its SHA256 and was recorded with the given times.
+type Statement struct {
+	Type     string    `json:"type"`
+	IssuedAt string    `json:"issued_at"`
+	Issuer   string    `json:"issuer,omitempty"`
+	KeyID    string    `json:"key_id"`
+	Album    string    `json:"album,omitempty"`
+	Subjects []Subject `json:"subjects"`
+}
+
+// Envelope is a DSSE envelope in its JSON form.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"` // base64 statement JSON
+	Signatures  []Signature `json:"signatures"`
+}
+
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"` // base64
+}
+
+// Signer holds the vault's attestation key.
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// LoadOrCreateKey reads the PKCS #8 PEM key at path, creating one on first
+// use.
+func LoadOrCreateKey(path string) (*Signer, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("not a PEM private key file")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("attestation key is not Ed25519")
+	}
+	return newSigner(key), nil
+}
+
+func createKey(path string) (*Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	return newSigner(key), nil
+}
+
+func newSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, keyID: KeyID(key.Public().(ed25519.PublicKey))}
+}
+
+// KeyID is the hex SHA256 of the raw public key, shortened to 16 bytes.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:16])
+}
+
+func (s *Signer) KeyID() string { return s.keyID }
+
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// PublicKeyPEM returns the public key as a PKIX PEM block, the form
+// openssl and most DSSE tools accept.
+func (s *Signer) PublicKeyPEM() []byte {
+	der, _ := x509.MarshalPKIXPublicKey(s.PublicKey())
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// Sign fills in the statement's type and key id and wraps it in a signed
+// envelope.
+func (s *Signer) Sign(st Statement) (*Envelope, error) {
+	st.Type = StatementType
+	st.KeyID = s.keyID
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	sig := ed25519.Sign(s.key, pae(PayloadType, payload))
+	return &Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []Signature{{KeyID: s.keyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}, nil
+}
+
+// Verify checks env against pub and returns its statement.
+func Verify(env *Envelope, pub ed25519.PublicKey) (*Statement, error) {
+	if env.PayloadType != PayloadType {
+		return nil, fmt.Errorf("unexpected payload type %q", env.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	msg := pae(env.PayloadType, payload)
+	verified := false
+	for _, s := range env.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err == nil && ed25519.Verify(pub, msg, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrBadSignature
+	}
+	var st Statement
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return nil, fmt.Errorf("decode statement: %w", err)
+	}
+	return &st, nil
+}
+
+// pae is DSSE's pre-authentication encoding, the bytes actually signed.
+func pae(payloadType string, payload []byte) []byte {
+	out := []byte("DSSEv1 " + strconv.Itoa(len(payloadType)) + " " + payloadType + " " + strconv.Itoa(len(payload)) + " ")
+	return append(out, payload...)
+}
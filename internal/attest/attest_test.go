@@ -0,0 +1,57 @@
+package attest
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "attestation.key")
+	s, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file = %v, %v", info, err)
+	}
+	again, err := LoadOrCreateKey(path)
+	if err != nil || again.KeyID() != s.KeyID() {
+		t.Fatalf("reloaded key id = %v, %v; want %s", again, err, s.KeyID())
+	}
+
+	env, err := s.Sign(Statement{
+		IssuedAt: "2026-01-02T03:04:05Z",
+		Subjects: []Subject{{MediaID: 7, FileName: "GX010001.MP4", SHA256: strings.Repeat("a", 64), CaptureTime: "2026-01-01T10:00:00Z", IngestedAt: "2026-01-01T12:00:00Z"}},
+	})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	st, err := Verify(env, again.PublicKey())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if st.Type != StatementType || st.KeyID != s.KeyID() || len(st.Subjects) != 1 || st.Subjects[0].MediaID != 7 {
+		t.Fatalf("statement = %+v", st)
+	}
+
+	payload, _ := base64.StdEncoding.DecodeString(env.Payload)
+	forged := strings.Replace(string(payload), "GX010001", "GX010002", 1)
+	env.Payload = base64.StdEncoding.EncodeToString([]byte(forged))
+	if _, err := Verify(env, s.PublicKey()); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("Verify of edited payload = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestLoadRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "attestation.key")
+	if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOrCreateKey(path); err == nil {
+		t.Fatal("LoadOrCreateKey accepted a non-PEM file")
+	}
+}
@@ -5,14 +5,22 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"maps"
 	"time"
 
+	"businessplan/usbvault/internal/clock"
 	"businessplan/usbvault/internal/db"
 )
 
+// Observer is notified after each entry is committed to the chain.
+type Observer interface {
+	Observe(ctx context.Context, actor, action string, details map[string]any)
+}
+
 type Logger struct {
-	store *db.Store
+	store    *db.Store
+	observer Observer
+	clock    *clock.Monitor
 }
 
 func New(store *db.Store) *Logger {
@@ -20,7 +28,19 @@ func New(store *db.Store) *Logger {
 }
 
 func (l *Logger) Log(ctx context.Context, actor, action string, details map[string]any) error {
-	ts := time.Now().UTC().Format(time.RFC3339Nano)
+	now := time.Now()
+	if l.clock != nil {
+		var trusted bool
+		if now, trusted = l.clock.Now(); !trusted {
+			// The entry keeps the last trusted time so the chain stays in
+			// order, and says so.
+			flagged := make(map[string]any, len(details)+1)
+			maps.Copy(flagged, details)
+			flagged["clock_uncertain"] = true
+			details = flagged
+		}
+	}
+	ts := now.UTC().Format(time.RFC3339Nano)
 	prev, err := l.store.LastAuditHash(ctx)
 	if err != nil {
 		return err
@@ -31,9 +51,33 @@ func (l *Logger) Log(ctx context.Context, actor, action string, details map[stri
 		return err
 	}
 
-	raw := fmt.Sprintf("%s|%s|%s|%s|%s", ts, actor, action, string(detailsJSON), prev)
-	sum := sha256.Sum256([]byte(raw))
-	hash := hex.EncodeToString(sum[:])
+	hash := EntryHash(ts, actor, action, string(detailsJSON), prev)
+
+	if err := l.store.InsertAudit(ctx, ts, actor, action, details, prev, hash); err != nil {
+		return err
+	}
+	if l.observer != nil {
+		l.observer.Observe(ctx, actor, action, details)
+	}
+	return nil
+}
+
+// EntryHash is the chain hash of one entry. Anyone holding an exported
+// entry and its predecessor's hash can recompute it.
+func EntryHash(ts, actor, action, detailsJSON, prevHash string) string {
+	sum := sha256.Sum256([]byte(ts + "|" + actor + "|" + action + "|" + detailsJSON + "|" + prevHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetClock makes entries written while the system clock is untrusted keep
+// the last trusted time instead of the clock's. It must be called before the
+// logger is shared between goroutines.
+func (l *Logger) SetClock(c *clock.Monitor) {
+	l.clock = c
+}
 
-	return l.store.InsertAudit(ctx, ts, actor, action, details, prev, hash)
+// SetObserver registers o to see every logged entry. It must be called
+// before the logger is shared between goroutines.
+func (l *Logger) SetObserver(o Observer) {
+	l.observer = o
 }
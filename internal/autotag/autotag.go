@@ -0,0 +1,217 @@
+// Package autotag labels library images with a local classifier command and
+// stores the labels as machine tags. It is off unless a classifier is
+// configured, and images never leave the machine.
+//
+// The classifier reads one JPEG on stdin and prints
+//
+//	{"labels": [{"label": "roof", "score": 0.91}, {"label": "vehicle", "score": 0.4}]}
+//
+// The label set is the model's; coarse scene labels such as roof, vehicle,
+// water damage, landscape, and document work best for search.
+package autotag
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/vision"
+)
+
+const (
+	batchSize      = 20
+	maxLabels      = 10
+	maxLabelLength = 40
+)
+
+var ErrBusy = errors.New("auto-tagging already running")
+
+type Status struct {
+	Enabled      bool    `json:"enabled"`
+	State        string  `json:"state"` // idle, running, success, error
+	MinScore     float64 `json:"min_score"`
+	LastStarted  string  `json:"last_started"`
+	LastFinished string  `json:"last_finished"`
+	Message      string  `json:"message"`
+	Scanned      int     `json:"scanned"`
+	Labels       int     `json:"labels"`
+	Skipped      int     `json:"skipped"`
+	Pending      int64   `json:"pending"`
+}
+
+type Tagger struct {
+	store      *db.Store
+	logger     *log.Logger
+	classifier string
+	timeout    time.Duration
+	minScore   float64
+	libKey     *libcrypt.Key
+
+	runMu  sync.Mutex
+	mu     sync.Mutex
+	status Status
+}
+
+// New returns a tagger that keeps labels scoring at least minScore.
+func New(store *db.Store, logger *log.Logger, classifier string, timeout time.Duration, minScore float64) *Tagger {
+	return &Tagger{
+		store:      store,
+		logger:     logger,
+		classifier: classifier,
+		timeout:    timeout,
+		minScore:   minScore,
+		status:     Status{Enabled: true, State: "idle", MinScore: minScore, Message: "Waiting for first pass."},
+	}
+}
+
+// SetLibraryKey lets the tagger read encrypted library files.
+func (t *Tagger) SetLibraryKey(key *libcrypt.Key) {
+	t.libKey = key
+}
+
+func (t *Tagger) GetStatus(ctx context.Context) Status {
+	pending, _ := t.store.CountAutoTagTodos(ctx)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := t.status
+	st.Pending = pending
+	return st
+}
+
+// Start tags immediately and then every interval until ctx ends, picking up
+// newly ingested images.
+func (t *Tagger) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := t.RunOnce(ctx); err != nil && !errors.Is(err, ErrBusy) && ctx.Err() == nil {
+				t.logger.Printf("auto-tagging failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce classifies every image that has not been classified yet. A
+// classifier failure stops the pass without marking the image, so it is
+// retried next time; images that cannot be decoded are marked and skipped.
+func (t *Tagger) RunOnce(ctx context.Context) error {
+	if !t.runMu.TryLock() {
+		return ErrBusy
+	}
+	defer t.runMu.Unlock()
+
+	t.mu.Lock()
+	t.status.State = "running"
+	t.status.LastStarted = time.Now().UTC().Format(time.RFC3339)
+	t.status.Message = "Classifying images..."
+	t.mu.Unlock()
+
+	scanned, labelled, skipped, err := t.tagAll(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastFinished = time.Now().UTC().Format(time.RFC3339)
+	t.status.Scanned += scanned
+	t.status.Labels += labelled
+	t.status.Skipped += skipped
+	if err != nil {
+		t.status.State = "error"
+		t.status.Message = err.Error()
+		return err
+	}
+	t.status.State = "success"
+	t.status.Message = fmt.Sprintf("Classified %d images; added %d labels.", scanned, labelled)
+	return nil
+}
+
+func (t *Tagger) tagAll(ctx context.Context) (scanned, labelled, skipped int, err error) {
+	for {
+		todos, err := t.store.ListAutoTagTodos(ctx, batchSize)
+		if err != nil {
+			return scanned, labelled, skipped, err
+		}
+		if len(todos) == 0 {
+			return scanned, labelled, skipped, nil
+		}
+		for _, todo := range todos {
+			if err := ctx.Err(); err != nil {
+				return scanned, labelled, skipped, err
+			}
+			labels, err := t.classify(ctx, todo)
+			scanErr := ""
+			if errors.Is(err, vision.ErrUndecodable) {
+				scanErr = err.Error()
+				skipped++
+			} else if err != nil {
+				return scanned, labelled, skipped, err
+			}
+			if err := t.store.RecordAutoTags(ctx, todo.ID, labels, scanErr); err != nil {
+				return scanned, labelled, skipped, err
+			}
+			scanned++
+			labelled += len(labels)
+		}
+	}
+}
+
+type scoredLabel struct {
+	Label string  `json:"label"`
+	Score float64 `json:"score"`
+}
+
+type classifierOutput struct {
+	Labels []scoredLabel `json:"labels"`
+}
+
+func (t *Tagger) classify(ctx context.Context, todo db.AutoTagTodo) ([]string, error) {
+	img, err := vision.Load(t.libKey, todo.DestPath, todo.Extension)
+	if err != nil {
+		return nil, err
+	}
+	var out classifierOutput
+	if err := vision.Run(ctx, t.classifier, t.timeout, img, &out); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(out.Labels, func(a, b scoredLabel) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	labels := make([]string, 0, maxLabels)
+	for _, l := range out.Labels {
+		if l.Score < t.minScore || len(labels) == maxLabels {
+			break
+		}
+		label := NormalizeLabel(l.Label)
+		if label != "" && !slices.Contains(labels, label) {
+			labels = append(labels, label)
+		}
+	}
+	return labels, nil
+}
+
+// NormalizeLabel lowercases a model label and collapses separators, so
+// "Water_Damage" and "water damage" are the same tag. It returns "" for
+// labels that are empty or too long to be useful.
+func NormalizeLabel(label string) string {
+	label = strings.ToLower(strings.TrimSpace(label))
+	label = strings.Join(strings.FieldsFunc(label, func(r rune) bool {
+		return r == '_' || r == '-' || r == ' ' || r == '\t'
+	}), " ")
+	if label == "" || len(label) > maxLabelLength {
+		return ""
+	}
+	return label
+}
@@ -0,0 +1,120 @@
+package autotag
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func TestTaggerStoresMachineTagsSeparately(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("classifier stub is a shell script")
+	}
+	dir := t.TempDir()
+	store, err := db.Open(filepath.Join(dir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	photo := filepath.Join(dir, "roof.png")
+	f, err := os.Create(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	ts := time.Now().UTC().Format(time.RFC3339)
+	rec := &db.MediaRecord{
+		Kind: "image", FileName: "roof.png", Extension: ".png",
+		SourceMount: "/Volumes/Test", SourcePath: "/DCIM/roof.png", DestPath: photo,
+		SizeBytes: 1, CRC32: "00000001", SHA256: fmt.Sprintf("%064x", 1),
+		CaptureTime: ts, Metadata: "{}", SourceMTime: ts, IngestedAt: ts,
+	}
+	if err := store.InsertMedia(ctx, rec); err != nil {
+		t.Fatalf("InsertMedia: %v", err)
+	}
+	if _, err := store.AddMediaTags(ctx, rec.ID, []string{"landscape"}, "user"); err != nil {
+		t.Fatalf("AddMediaTags: %v", err)
+	}
+
+	classifier := filepath.Join(dir, "classify")
+	script := `#!/bin/sh
+cat >/dev/null
+echo '{"labels":[{"label":"Vehicle","score":0.3},{"label":"Water_Damage","score":0.8},{"label":"roof","score":0.95},{"label":"landscape","score":0.7}]}'
+`
+	if err := os.WriteFile(classifier, []byte(script), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	tagger := New(store, log.New(io.Discard, "", 0), classifier, 10*time.Second, 0.6)
+	if err := tagger.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if st := tagger.GetStatus(ctx); st.Scanned != 1 || st.Labels != 3 || st.Pending != 0 {
+		t.Fatalf("status = %+v", st)
+	}
+
+	groups, err := store.ListAutoTagGroups(ctx, db.MediaFilter{}, 10)
+	if err != nil {
+		t.Fatalf("ListAutoTagGroups: %v", err)
+	}
+	got := map[string]int64{}
+	for _, g := range groups {
+		got[g.Tag] = g.Count
+	}
+	if len(got) != 2 || got["roof"] != 1 || got["water damage"] != 1 {
+		t.Fatalf("auto tags = %v, want roof and water damage (landscape stays a user tag)", got)
+	}
+
+	count := func(filter db.MediaFilter) int {
+		items, err := store.ListMediaFiltered(ctx, "capture_time", "desc", 10, 0, filter)
+		if err != nil {
+			t.Fatalf("ListMediaFiltered: %v", err)
+		}
+		return len(items)
+	}
+	if count(db.MediaFilter{AutoTag: "roof"}) != 1 || count(db.MediaFilter{Tag: "roof"}) != 0 {
+		t.Fatal("auto_tag and tag filters are not separate")
+	}
+	if count(db.MediaFilter{Tag: "landscape"}) != 1 || count(db.MediaFilter{AutoTag: "landscape"}) != 0 {
+		t.Fatal("user tag was taken over by the classifier")
+	}
+
+	// A user tag takes over a matching machine label.
+	if _, err := store.AddMediaTags(ctx, rec.ID, []string{"roof"}, "user"); err != nil {
+		t.Fatalf("AddMediaTags: %v", err)
+	}
+	if count(db.MediaFilter{Tag: "roof"}) != 1 || count(db.MediaFilter{AutoTag: "roof"}) != 0 {
+		t.Fatal("user tag did not take over the machine label")
+	}
+}
+
+func TestNormalizeLabel(t *testing.T) {
+	t.Parallel()
+
+	for in, want := range map[string]string{
+		" Water_Damage ": "water damage",
+		"solar-panel":    "solar panel",
+		"":               "",
+		"___":            "",
+		"an extremely long label that nobody would ever search for": "",
+	} {
+		if got := NormalizeLabel(in); got != want {
+			t.Errorf("NormalizeLabel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package avchd reads the playlists of an AVCHD (or Blu-ray) BDMV folder.
+//
+// Camcorders record to BDMV/STREAM as numbered .MTS clips and split a long
+// recording across several of them, each about 2 GB. The playlists in
+// BDMV/PLAYLIST say which clips follow on from one another; the rest of the
+// folder (CLIPINF, BACKUP, AUXDATA, META) is index data for players.
+package avchd
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// StreamDir is the folder under BDMV that holds the clips.
+const StreamDir = "STREAM"
+
+// Clip is where a stream clip falls in the recording it belongs to.
+type Clip struct {
+	// Recording is the name of the recording's first clip, e.g. "00003".
+	Recording string `json:"recording"`
+	Part      int    `json:"part"` // 1-based
+	Parts     int    `json:"parts"`
+	Playlist  string `json:"playlist"` // e.g. "00000.MPL"
+}
+
+// IsBDMV reports whether dir is a BDMV folder with clips in it.
+func IsBDMV(dir string) bool {
+	if !strings.EqualFold(filepath.Base(dir), "BDMV") {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(dir, StreamDir))
+	return err == nil && info.IsDir()
+}
+
+// Clips reads every playlist in the BDMV folder dir and returns the clips
+// they name, by clip name ("00000"). A clip in several playlists is placed
+// by the first one in name order. Unreadable playlists are skipped; the
+// error reports the first of them.
+func Clips(dir string) (map[string]Clip, error) {
+	out := map[string]Clip{}
+	entries, err := os.ReadDir(filepath.Join(dir, "PLAYLIST"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return out, nil
+		}
+		return out, err
+	}
+	var firstErr error
+	for _, e := range entries {
+		ext := strings.ToUpper(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".MPL" && ext != ".MPLS") {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, "PLAYLIST", e.Name()))
+		if err == nil {
+			var items []PlayItem
+			if items, err = ParsePlaylist(raw); err == nil {
+				for name, c := range group(items) {
+					if _, ok := out[name]; !ok {
+						c.Playlist = e.Name()
+						out[name] = c
+					}
+				}
+				continue
+			}
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return out, firstErr
+}
+
+// PlayItem is one clip of a playlist.
+type PlayItem struct {
+	Clip string // clip name, e.g. "00000"
+	// Continues is set when the clip carries on seamlessly from the one
+	// before, as the clips of a split recording do.
+	Continues bool
+}
+
+var errPlaylist = errors.New("not an AVCHD playlist")
+
+// ParsePlaylist reads the play items of an MPL/MPLS playlist.
+func ParsePlaylist(raw []byte) ([]PlayItem, error) {
+	if len(raw) < 20 || string(raw[:4]) != "MPLS" {
+		return nil, errPlaylist
+	}
+	pos := int(binary.BigEndian.Uint32(raw[8:12]))
+	// PlayList(): length, reserved, number_of_PlayItems, number_of_SubPaths.
+	if pos+10 > len(raw) {
+		return nil, errPlaylist
+	}
+	count := int(binary.BigEndian.Uint16(raw[pos+6 : pos+8]))
+	pos += 10
+	items := make([]PlayItem, 0, count)
+	for range count {
+		// PlayItem(): length, Clip_Information_file_name[5],
+		// Clip_codec_identifier[4], 11 reserved bits, is_multi_angle,
+		// connection_condition[4], ...
+		if pos+14 > len(raw) {
+			return nil, errPlaylist
+		}
+		length := int(binary.BigEndian.Uint16(raw[pos : pos+2]))
+		cc := raw[pos+12] & 0x0f
+		items = append(items, PlayItem{
+			Clip:      string(raw[pos+2 : pos+7]),
+			Continues: cc == 5 || cc == 6,
+		})
+		pos += 2 + length
+	}
+	return items, nil
+}
+
+// group splits play items into recordings.
+func group(items []PlayItem) map[string]Clip {
+	out := map[string]Clip{}
+	var run []string
+	flush := func() {
+		for i, name := range run {
+			out[name] = Clip{Recording: run[0], Part: i + 1, Parts: len(run)}
+		}
+		run = run[:0]
+	}
+	for i, it := range items {
+		if i == 0 || !it.Continues || slices.Contains(run, it.Clip) {
+			flush()
+		}
+		run = append(run, it.Clip)
+	}
+	flush()
+	return out
+}
@@ -0,0 +1,85 @@
+package avchd
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// playlist builds an MPLS file with one play item per clip; a clip name
+// starting with "+" continues the one before.
+func playlist(clips ...string) []byte {
+	var items []byte
+	for _, c := range clips {
+		cc := byte(1)
+		if c[0] == '+' {
+			c, cc = c[1:], 5
+		}
+		item := make([]byte, 2+20)
+		binary.BigEndian.PutUint16(item, 20)
+		copy(item[2:], c)
+		copy(item[7:], "M2TS")
+		item[12] = cc
+		items = append(items, item...)
+	}
+	raw := make([]byte, 20+10)
+	copy(raw, "MPLS0100")
+	binary.BigEndian.PutUint32(raw[8:], 20)
+	binary.BigEndian.PutUint32(raw[20:], uint32(6+len(items)))
+	binary.BigEndian.PutUint16(raw[26:], uint16(len(clips)))
+	return append(raw, items...)
+}
+
+func TestClipsGroupsSplitRecordings(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "BDMV")
+	for _, sub := range []string{"STREAM", "PLAYLIST"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string][]byte{
+		"00000.MPL":  playlist("00000", "00001", "+00002", "+00003", "00004"),
+		"00001.MPL":  playlist("00004", "+00005"), // 00004 is already placed
+		"broken.mpl": []byte("nope"),
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, "PLAYLIST", name), body, 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !IsBDMV(dir) || IsBDMV(filepath.Join(dir, "STREAM")) {
+		t.Fatal("IsBDMV")
+	}
+
+	clips, err := Clips(dir)
+	if err == nil {
+		t.Fatal("broken playlist not reported")
+	}
+	want := map[string]Clip{
+		"00000": {Recording: "00000", Part: 1, Parts: 1, Playlist: "00000.MPL"},
+		"00001": {Recording: "00001", Part: 1, Parts: 3, Playlist: "00000.MPL"},
+		"00002": {Recording: "00001", Part: 2, Parts: 3, Playlist: "00000.MPL"},
+		"00003": {Recording: "00001", Part: 3, Parts: 3, Playlist: "00000.MPL"},
+		"00004": {Recording: "00004", Part: 1, Parts: 1, Playlist: "00000.MPL"},
+		"00005": {Recording: "00004", Part: 2, Parts: 2, Playlist: "00001.MPL"},
+	}
+	if len(clips) != len(want) {
+		t.Fatalf("clips = %+v", clips)
+	}
+	for name, c := range want {
+		if clips[name] != c {
+			t.Errorf("%s = %+v, want %+v", name, clips[name], c)
+		}
+	}
+}
+
+func TestParsePlaylistRejectsTruncatedFiles(t *testing.T) {
+	raw := playlist("00000", "+00001")
+	if _, err := ParsePlaylist(raw[:len(raw)-15]); err == nil {
+		t.Fatal("truncated playlist accepted")
+	}
+	if _, err := ParsePlaylist([]byte("MPLS0100")); err == nil {
+		t.Fatal("short playlist accepted")
+	}
+}
@@ -0,0 +1,344 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/shrink"
+	"businessplan/usbvault/internal/storage"
+)
+
+var (
+	ErrDrillBusy = errors.New("restore drill already running")
+	ErrNoBackup  = errors.New("no successful backup recorded yet")
+)
+
+// SetLibraryKey lets the restore drill verify encrypted media, whose backup
+// copies hold ciphertext.
+func (m *Manager) SetLibraryKey(key *libcrypt.Key) {
+	m.libKey = key
+}
+
+// loadLastBackup returns the record written by recordLastBackup, or
+// ErrNoBackup when there is none.
+func (m *Manager) loadLastBackup(ctx context.Context) (lastBackup, error) {
+	var last lastBackup
+	raw, ok, err := m.store.GetSetting(ctx, lastBackupSetting)
+	if err != nil {
+		return last, err
+	}
+	if !ok || json.Unmarshal([]byte(raw), &last) != nil || len(last.Destinations) == 0 {
+		return last, ErrNoBackup
+	}
+	return last, nil
+}
+
+// CanDrill reports whether a backup exists for a restore drill to check.
+func (m *Manager) CanDrill(ctx context.Context) error {
+	_, err := m.loadLastBackup(ctx)
+	return err
+}
+
+// RunDrill fetches a random sample of media back from the most recent
+// backup, checks each file against the SHA256 in the database, and records
+// the outcome. Only media ingested before that backup started is sampled.
+func (m *Manager) RunDrill(ctx context.Context, sampleSize int) (*db.RestoreDrill, error) {
+	if !m.drillMu.TryLock() {
+		return nil, ErrDrillBusy
+	}
+	defer m.drillMu.Unlock()
+
+	last, err := m.loadLastBackup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dest := last.Destinations[0]
+	drill := &db.RestoreDrill{
+		StartedAt:   time.Now().UTC().Format(time.RFC3339),
+		Mode:        dest.Mode,
+		Destination: dest.Destination,
+		BackupAt:    last.StartedAt,
+	}
+
+	if err := m.drill(ctx, dest, last.StartedAt, sampleSize, drill); err != nil {
+		drill.State = "error"
+		drill.Message = err.Error()
+	} else if drill.Missing > 0 || drill.Mismatched > 0 {
+		drill.State = "failed"
+		drill.Message = fmt.Sprintf("%d of %d sampled files missing, %d corrupted.", drill.Missing, drill.Sampled, drill.Mismatched)
+	} else {
+		drill.State = "success"
+		drill.Message = fmt.Sprintf("Restored and verified %d sampled files.", drill.Verified)
+	}
+	drill.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	if drill.State != "success" {
+		m.logger.Printf("restore drill from %s %s: %s", drill.Mode, drill.Destination, drill.Message)
+	}
+	if err := m.store.InsertRestoreDrill(context.WithoutCancel(ctx), drill); err != nil {
+		return drill, err
+	}
+	return drill, nil
+}
+
+func (m *Manager) drill(ctx context.Context, dest Destination, backupAt string, sampleSize int, drill *db.RestoreDrill) error {
+	baseStorage, ok, err := m.store.GetSetting(ctx, baseStorageSetting)
+	if err != nil {
+		return err
+	}
+	if !ok || strings.TrimSpace(baseStorage) == "" {
+		return errors.New("base storage is not configured")
+	}
+	baseStorage = filepath.Clean(baseStorage)
+	started, err := time.Parse(time.RFC3339Nano, backupAt)
+	if err != nil {
+		return fmt.Errorf("bad backup timestamp %q", backupAt)
+	}
+
+	sample, err := m.store.SampleMediaForDrill(ctx, baseStorage, started.UTC().Truncate(time.Second).Format(time.RFC3339), sampleSize)
+	if err != nil {
+		return err
+	}
+	// Files the backup filter leaves out are not expected at the destination.
+	filter := m.loadFilter(ctx)
+	sample = slices.DeleteFunc(sample, func(rec db.MediaRecord) bool {
+		rel, err := filepath.Rel(baseStorage, rec.DestPath)
+		return err != nil || filter.Excluded(filepath.ToSlash(rel))
+	})
+	if len(sample) == 0 {
+		return errors.New("no media old enough to be in the backup")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "usbvault-drill-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// wanted maps each sampled file's slash path relative to base storage,
+	// which is how both backup layouts name it, to its temp copy.
+	wanted := make(map[string]string, len(sample))
+	for i, rec := range sample {
+		rel, err := filepath.Rel(baseStorage, rec.DestPath)
+		if err != nil {
+			return err
+		}
+		wanted[filepath.ToSlash(rel)] = filepath.Join(tmpDir, strconv.Itoa(i))
+	}
+
+	switch dest.Mode {
+	case "rsync":
+		err = fetchFromMirror(ctx, dest.Destination, wanted)
+	case "snapshot":
+		var latest string
+		if latest, err = latestSnapshot(dest.Destination); err == nil {
+			if latest == "" {
+				return errors.New("no completed snapshot found")
+			}
+			err = fetchFromMirror(ctx, filepath.Join(dest.Destination, latest), wanted)
+		}
+	default:
+		err = m.fetchFromArchive(ctx, dest, wanted)
+	}
+	if err != nil {
+		return err
+	}
+
+	drill.Sampled = len(sample)
+	for _, rec := range sample {
+		rel, _ := filepath.Rel(baseStorage, rec.DestPath)
+		got, err := m.hashRestored(wanted[filepath.ToSlash(rel)])
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			drill.Missing++
+		case err != nil:
+			return fmt.Errorf("%s: %w", rec.FileName, err)
+		case got != rec.SHA256:
+			drill.Mismatched++
+		default:
+			drill.Verified++
+		}
+	}
+	return nil
+}
+
+// hashRestored returns the plaintext SHA256 of a fetched file.
+func (m *Manager) hashRestored(path string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	if libcrypt.IsEncrypted(path) && m.libKey == nil {
+		return "", errors.New("backup holds encrypted media but library encryption is not unlocked")
+	}
+	r, err := storage.OpenPlain(context.Background(), storage.NewLocal(), m.libKey, path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		if errors.Is(err, libcrypt.ErrCorrupt) || errors.Is(err, shrink.ErrCorrupt) {
+			return "", nil
+		}
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fetchFromMirror copies sampled files out of an rsync mirror. Files absent
+// from the mirror are left absent.
+func fetchFromMirror(ctx context.Context, destination string, wanted map[string]string) error {
+	mediaDest := appendDest(destination, "media")
+	for rel, tmp := range wanted {
+		if isLocalPath(destination) {
+			if err := copyLocalFile(filepath.Join(mediaDest, filepath.FromSlash(rel)), tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+		src := strings.TrimRight(mediaDest, "/") + "/" + rel
+		cmd := exec.CommandContext(ctx, "rsync", "-a", src, tmp)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			// rsync exits 23 for a missing source file; anything else means
+			// the mirror could not be read at all.
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitCode() == 23 {
+				continue
+			}
+			return fmt.Errorf("rsync failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	return nil
+}
+
+func copyLocalFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// fetchFromArchive streams the tar.gz back from an archive destination and
+// extracts only the sampled entries. The archive is laid out as
+// <root>/media/<rel>. Reading stops as soon as every sampled file is found.
+func (m *Manager) fetchFromArchive(ctx context.Context, dest Destination, wanted map[string]string) error {
+	body, closeFn, err := m.openArchive(ctx, dest)
+	if err != nil {
+		return err
+	}
+	found, err := extractSample(body, wanted)
+	if err != nil {
+		_ = closeFn(false)
+		return fmt.Errorf("read archive: %w", err)
+	}
+	return closeFn(found < len(wanted))
+}
+
+func extractSample(r io.Reader, wanted map[string]string) (int, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	tr := tar.NewReader(gz)
+	found := 0
+	for found < len(wanted) {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return found, err
+		}
+		parts := strings.SplitN(path.Clean(hdr.Name), "/", 3)
+		if len(parts) != 3 || parts[1] != "media" || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		tmp, ok := wanted[parts[2]]
+		if !ok {
+			continue
+		}
+		out, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return found, err
+		}
+		_, err = io.Copy(out, tr)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return found, err
+		}
+		found++
+	}
+	return found, nil
+}
+
+// openArchive starts reading an archive back from where sendArchive put it.
+// The returned close function reports transfer errors only when the whole
+// stream was expected to be read (drained is true).
+func (m *Manager) openArchive(ctx context.Context, dest Destination) (io.Reader, func(drained bool) error, error) {
+	switch dest.Mode {
+	case "ssh":
+		body, err := m.openSSH(ctx, dest)
+		if err != nil {
+			return nil, nil, err
+		}
+		return body, func(bool) error { return body.Close() }, nil
+	case "s3":
+		body, err := m.openS3(ctx, dest.Destination)
+		if err != nil {
+			return nil, nil, err
+		}
+		return body, func(bool) error { return body.Close() }, nil
+	case "api":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, dest.Destination, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("build api request: %w", err)
+		}
+		if strings.TrimSpace(dest.APIToken) != "" {
+			req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(dest.APIToken))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("api download failed: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			return nil, nil, fmt.Errorf("api download failed: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		return resp.Body, func(bool) error { return resp.Body.Close() }, nil
+	}
+	return nil, nil, fmt.Errorf("%w: unsupported mode %q", ErrInvalidRequest, dest.Mode)
+}
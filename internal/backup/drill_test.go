@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+type drillFixture struct {
+	store   *db.Store
+	manager *Manager
+	library string
+}
+
+func newDrillFixture(t *testing.T, files map[string]string) drillFixture {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("USBVAULT_DATA_DIR", filepath.Join(dir, "data"))
+	store, err := db.Open(filepath.Join(dir, "data", "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	ctx := context.Background()
+	library := filepath.Join(dir, "library")
+	if err := store.SetSetting(ctx, baseStorageSetting, library); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	ingested := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	for rel, body := range files {
+		path := filepath.Join(library, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o640); err != nil {
+			t.Fatalf("write media: %v", err)
+		}
+		sum := sha256.Sum256([]byte(body))
+		rec := &db.MediaRecord{
+			Kind:        "image",
+			FileName:    filepath.Base(path),
+			Extension:   ".jpg",
+			SourceMount: "/Volumes/Test",
+			SourcePath:  "/DCIM/" + filepath.Base(path),
+			DestPath:    path,
+			SizeBytes:   int64(len(body)),
+			CRC32:       "00000000",
+			SHA256:      hex.EncodeToString(sum[:]),
+			CaptureTime: ingested,
+			Metadata:    "{}",
+			SourceMTime: ingested,
+			IngestedAt:  ingested,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+	}
+	return drillFixture{
+		store:   store,
+		manager: NewManager(store, nil, log.New(io.Discard, "", 0)),
+		library: library,
+	}
+}
+
+func (f drillFixture) recordBackup(t *testing.T, dest Destination) {
+	t.Helper()
+	raw, _ := json.Marshal(lastBackup{StartedAt: time.Now().UTC().Format(time.RFC3339Nano), Destinations: []Destination{dest}})
+	if err := f.store.SetSetting(context.Background(), lastBackupSetting, string(raw)); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+}
+
+func TestRestoreDrillFromArchive(t *testing.T) {
+	f := newDrillFixture(t, map[string]string{
+		"2024/01/a.jpg": "alpha",
+		"2024/02/b.jpg": "bravo",
+		"2025/03/c.jpg": "charlie",
+	})
+
+	var archive bytes.Buffer
+	if err := f.manager.writeTarGzArchive(&archive, f.library, nil, Filter{}, nil); err != nil {
+		t.Fatalf("writeTarGzArchive: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write(archive.Bytes())
+	}))
+	defer srv.Close()
+	f.recordBackup(t, Destination{Mode: "api", Destination: srv.URL, APIMethod: http.MethodPut, APIToken: "tok"})
+
+	drill, err := f.manager.RunDrill(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("RunDrill: %v", err)
+	}
+	if drill.State != "success" || drill.Sampled != 3 || drill.Verified != 3 {
+		t.Fatalf("drill = %+v, want 3 of 3 verified", drill)
+	}
+	items, err := f.store.ListRestoreDrills(context.Background(), 10)
+	if err != nil || len(items) != 1 || items[0].ID != drill.ID {
+		t.Fatalf("ListRestoreDrills = %+v, %v", items, err)
+	}
+}
+
+func TestRestoreDrillFromMirrorReportsDamage(t *testing.T) {
+	f := newDrillFixture(t, map[string]string{
+		"2024/01/a.jpg": "alpha",
+		"2024/02/b.jpg": "bravo",
+		"2025/03/c.jpg": "charlie",
+	})
+
+	mirror := t.TempDir()
+	write := func(rel, body string) {
+		path := filepath.Join(mirror, "media", filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o640); err != nil {
+			t.Fatalf("write mirror: %v", err)
+		}
+	}
+	write("2024/01/a.jpg", "alpha")
+	write("2024/02/b.jpg", "bit rot")
+	f.recordBackup(t, Destination{Mode: "rsync", Destination: mirror})
+
+	drill, err := f.manager.RunDrill(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("RunDrill: %v", err)
+	}
+	if drill.State != "failed" || drill.Verified != 1 || drill.Mismatched != 1 || drill.Missing != 1 {
+		t.Fatalf("drill = %+v, want 1 verified, 1 mismatched, 1 missing", drill)
+	}
+}
+
+func TestRestoreDrillWithoutBackup(t *testing.T) {
+	f := newDrillFixture(t, nil)
+	if _, err := f.manager.RunDrill(context.Background(), 5); err != ErrNoBackup {
+		t.Fatalf("RunDrill error = %v, want ErrNoBackup", err)
+	}
+}
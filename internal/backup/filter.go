@@ -0,0 +1,160 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"businessplan/usbvault/internal/config"
+)
+
+const FilterSettingKey = "backup_filter"
+
+const maxFilterPatterns = 100
+
+// Filter decides which files under base storage go into a backup. Work
+// areas (thumbnails, proxies, quarantine, trash, export scratch) are left
+// out unless listed in WorkAreas.
+//
+// Patterns follow rsync: one without a slash matches a file or directory
+// name at any depth, one with a slash is anchored at base storage. "*"
+// does not cross "/". Paths are checked from the top down and, at each
+// level, the first matching include or exclude decides; includes are tried
+// first. Excluding a directory excludes everything below it.
+type Filter struct {
+	WorkAreas []string `json:"work_areas"`
+	Include   []string `json:"include"`
+	Exclude   []string `json:"exclude"`
+}
+
+// Normalize trims patterns and checks their syntax.
+func (f Filter) Normalize() (Filter, error) {
+	out := Filter{WorkAreas: []string{}, Include: []string{}, Exclude: []string{}}
+	for _, area := range f.WorkAreas {
+		area = strings.ToLower(strings.TrimSpace(area))
+		if !slices.Contains(config.WorkAreas, area) {
+			return Filter{}, fmt.Errorf("unknown work area %q; expected one of %s", area, strings.Join(config.WorkAreas, ", "))
+		}
+		if !slices.Contains(out.WorkAreas, area) {
+			out.WorkAreas = append(out.WorkAreas, area)
+		}
+	}
+	if len(f.Include)+len(f.Exclude) > maxFilterPatterns {
+		return Filter{}, fmt.Errorf("at most %d include and exclude patterns", maxFilterPatterns)
+	}
+	clean := func(list []string) ([]string, error) {
+		res := make([]string, 0, len(list))
+		for _, p := range list {
+			p = strings.Trim(strings.TrimSpace(p), "/")
+			if p == "" {
+				continue
+			}
+			if slices.Contains(strings.Split(p, "/"), "..") {
+				return nil, fmt.Errorf("pattern %q must not contain ..", p)
+			}
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("pattern %q: %w", p, err)
+			}
+			res = append(res, p)
+		}
+		return res, nil
+	}
+	var err error
+	if out.Include, err = clean(f.Include); err != nil {
+		return Filter{}, err
+	}
+	if out.Exclude, err = clean(f.Exclude); err != nil {
+		return Filter{}, err
+	}
+	return out, nil
+}
+
+// excludes is the user's exclude list followed by the skipped work areas.
+func (f Filter) excludes() []string {
+	out := append([]string(nil), f.Exclude...)
+	for _, area := range config.WorkAreas {
+		if !slices.Contains(f.WorkAreas, area) {
+			out = append(out, config.WorkDirName+"/"+area)
+		}
+	}
+	return out
+}
+
+// Excluded reports whether rel, a slash path relative to base storage, is
+// left out of the backup.
+func (f Filter) Excluded(rel string) bool {
+	excludes := f.excludes()
+	parts := strings.Split(strings.Trim(rel, "/"), "/")
+	for i := range parts {
+		level := strings.Join(parts[:i+1], "/")
+		if matchAny(f.Include, level, parts[i]) {
+			continue
+		}
+		if matchAny(excludes, level, parts[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, rel, name string) bool {
+	for _, p := range patterns {
+		target := name
+		if strings.Contains(p, "/") {
+			target = rel
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rsyncArgs renders the filter as rsync --include/--exclude options with the
+// same first-match semantics.
+func (f Filter) rsyncArgs() []string {
+	anchor := func(p string) string {
+		if strings.Contains(p, "/") {
+			return "/" + p
+		}
+		return p
+	}
+	out := make([]string, 0, len(f.Include)+len(f.Exclude)+len(config.WorkAreas))
+	for _, p := range f.Include {
+		out = append(out, "--include="+anchor(p))
+	}
+	for _, p := range f.excludes() {
+		out = append(out, "--exclude="+anchor(p))
+	}
+	return out
+}
+
+// ParseFilter reads the saved filter. An empty value is the default filter,
+// which skips every work area.
+func ParseFilter(raw string) (Filter, error) {
+	var f Filter
+	if strings.TrimSpace(raw) != "" {
+		if err := json.Unmarshal([]byte(raw), &f); err != nil {
+			return Filter{}, fmt.Errorf("invalid backup filter: %w", err)
+		}
+	}
+	return f.Normalize()
+}
+
+// loadFilter falls back to the default filter when the saved one is broken,
+// so a bad setting does not stop backups.
+func (m *Manager) loadFilter(ctx context.Context) Filter {
+	raw, _, err := m.store.GetSetting(ctx, FilterSettingKey)
+	if err == nil {
+		var f Filter
+		if f, err = ParseFilter(raw); err == nil {
+			return f
+		}
+	}
+	m.logger.Printf("backup filter: %v; using defaults", err)
+	f, _ := ParseFilter("")
+	return f
+}
@@ -0,0 +1,119 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFilterExcluded(t *testing.T) {
+	t.Parallel()
+
+	f, err := Filter{
+		WorkAreas: []string{"Trash"},
+		Include:   []string{"keep.tmp", "2024/raw/important"},
+		Exclude:   []string{"*.tmp", "2024/raw", "/.usbvault/trash/old/"},
+	}.Normalize()
+	if err != nil {
+		t.Fatalf("Normalize: %v", err)
+	}
+	cases := map[string]bool{
+		"2024/01/a.jpg":                false,
+		"2024/01/a.tmp":                true,
+		"deep/keep.tmp":                false,
+		"2024/raw":                     true,
+		"2024/raw/b.dng":               true,
+		"2024/raw/important":           true, // parent is already excluded
+		"2025/raw/b.dng":               false,
+		".usbvault/thumbnails/x.jpg":   true,
+		".usbvault/proxies/clip.mp4":   true,
+		".usbvault/export/job/out.zip": true,
+		".usbvault/trash/a.jpg":        false,
+		".usbvault/trash/old/a.jpg":    true,
+	}
+	for rel, want := range cases {
+		if got := f.Excluded(rel); got != want {
+			t.Errorf("Excluded(%q) = %v, want %v", rel, got, want)
+		}
+	}
+
+	args := f.rsyncArgs()
+	for _, want := range []string{"--include=keep.tmp", "--include=/2024/raw/important", "--exclude=*.tmp", "--exclude=/.usbvault/trash/old", "--exclude=/.usbvault/quarantine"} {
+		if !slices.Contains(args, want) {
+			t.Errorf("rsyncArgs missing %q: %v", want, args)
+		}
+	}
+	if slices.Contains(args, "--exclude=/.usbvault/trash") {
+		t.Errorf("rsyncArgs excludes a work area that should be backed up: %v", args)
+	}
+}
+
+func TestFilterNormalizeRejectsBadInput(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range []Filter{
+		{WorkAreas: []string{"cache"}},
+		{Exclude: []string{"[abc"}},
+		{Include: []string{"../outside"}},
+	} {
+		if _, err := f.Normalize(); err == nil {
+			t.Errorf("Normalize(%+v) succeeded, want error", f)
+		}
+	}
+}
+
+func TestArchiveSkipsWorkAreas(t *testing.T) {
+	t.Parallel()
+
+	library := t.TempDir()
+	for _, rel := range []string{"2024/a.jpg", ".usbvault/thumbnails/a.jpg", ".usbvault/trash/b.jpg", "2024/scratch.tmp"} {
+		path := filepath.Join(library, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(rel), 0o640); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	f, err := Filter{WorkAreas: []string{"trash"}, Exclude: []string{"*.tmp"}}.Normalize()
+	if err != nil {
+		t.Fatalf("Normalize: %v", err)
+	}
+
+	m := NewManager(nil, nil, log.New(io.Discard, "", 0))
+	var buf bytes.Buffer
+	if err := m.writeTarGzArchive(&buf, library, nil, f, nil); err != nil {
+		t.Fatalf("writeTarGzArchive: %v", err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var files []string
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar: %v", err)
+		}
+		if _, rel, ok := strings.Cut(hdr.Name, "/media/"); ok && hdr.Typeflag == tar.TypeReg {
+			files = append(files, rel)
+		}
+	}
+	slices.Sort(files)
+	want := []string{".usbvault/trash/b.jpg", "2024/a.jpg"}
+	if !slices.Equal(files, want) {
+		t.Fatalf("archived %v, want %v", files, want)
+	}
+}
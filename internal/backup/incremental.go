@@ -0,0 +1,139 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+// archivePlan tracks which library files an archive pass sends, so each
+// destination's manifest can be updated afterwards. In an incremental pass
+// it also holds the destinations' manifests, and files every one of them
+// already has are left out of the archive.
+type archivePlan struct {
+	started     time.Time
+	incremental bool
+	sums        map[string]string // slash path relative to base storage -> media SHA256
+	have        []map[string]db.BackupManifestEntry
+	removed     []string
+
+	sent []db.BackupManifestEntry
+	seen map[string]struct{}
+}
+
+// manifestTarget is the backup_manifest key of an archive destination.
+func manifestTarget(d Destination) string {
+	return d.Mode + ":" + d.Destination
+}
+
+// newArchivePlan prepares an archive pass. It only goes incremental when
+// asked to and every destination has a manifest from an earlier run; one
+// new destination makes the whole pass full, since they share one archive.
+func (m *Manager) newArchivePlan(ctx context.Context, baseStorage string, filter Filter, targets []Destination, idx []int, incremental bool) (*archivePlan, error) {
+	p := &archivePlan{
+		started: time.Now().UTC(),
+		sums:    make(map[string]string),
+		seen:    make(map[string]struct{}),
+	}
+	err := m.store.MediaChecksums(ctx, func(sum, destPath string) error {
+		if rel, err := filepath.Rel(baseStorage, destPath); err == nil && !strings.HasPrefix(rel, "..") {
+			p.sums[filepath.ToSlash(rel)] = sum
+		}
+		return nil
+	})
+	if err != nil || !incremental {
+		return p, err
+	}
+
+	have := make([]map[string]db.BackupManifestEntry, 0, len(idx))
+	for _, i := range idx {
+		got, err := m.store.BackupManifest(ctx, manifestTarget(targets[i]))
+		if err != nil {
+			return nil, err
+		}
+		if len(got) == 0 {
+			return p, nil
+		}
+		have = append(have, got)
+	}
+	p.incremental = true
+	p.have = have
+
+	gone := make(map[string]struct{})
+	for _, h := range have {
+		for rel := range h {
+			if _, ok := gone[rel]; ok {
+				continue
+			}
+			_, err := os.Lstat(filepath.Join(baseStorage, filepath.FromSlash(rel)))
+			if errors.Is(err, fs.ErrNotExist) || filter.Excluded(rel) {
+				gone[rel] = struct{}{}
+			}
+		}
+	}
+	for rel := range gone {
+		p.removed = append(p.removed, rel)
+	}
+	sort.Strings(p.removed)
+	return p, nil
+}
+
+// include records a file found by the archive walk and reports whether it
+// has to go into the archive.
+func (p *archivePlan) include(rel string, info fs.FileInfo) bool {
+	e := db.BackupManifestEntry{
+		Path:       rel,
+		SHA256:     p.sums[rel],
+		Size:       info.Size(),
+		ModTimeNS:  info.ModTime().UnixNano(),
+		BackedUpAt: p.started.Format(time.RFC3339),
+	}
+	p.seen[rel] = struct{}{}
+	if p.incremental && p.unchanged(e) {
+		return false
+	}
+	p.sent = append(p.sent, e)
+	return true
+}
+
+// unchanged reports whether every destination already holds e.
+func (p *archivePlan) unchanged(e db.BackupManifestEntry) bool {
+	for _, h := range p.have {
+		if old, ok := h[e.Path]; !ok || !old.Same(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// kind names the archive for the chain of an incremental backup.
+func (p *archivePlan) kind() string {
+	if p.incremental {
+		return "incr"
+	}
+	return "full"
+}
+
+// chainDestination returns where an archive in an incremental chain is
+// written: the configured name with the kind and time added before the
+// extension, so one run never overwrites the archive another depends on.
+// API destinations keep their URL and get the kind in a header instead.
+func (p *archivePlan) chainDestination(dest Destination) string {
+	if dest.Mode == "api" {
+		return dest.Destination
+	}
+	tag := "-" + p.kind() + "-" + p.started.Format("20060102-150405")
+	for _, ext := range []string{".tar.gz", ".tgz"} {
+		if base, ok := strings.CutSuffix(dest.Destination, ext); ok {
+			return base + tag + ext
+		}
+	}
+	return dest.Destination + tag + ".tar.gz"
+}
@@ -0,0 +1,176 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func TestIncrementalArchiveSendsOnlyChanges(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("USBVAULT_DATA_DIR", filepath.Join(dir, "data"))
+
+	store, err := db.Open(filepath.Join(dir, "data", "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	library := filepath.Join(dir, "library")
+	write := func(rel, body string) {
+		t.Helper()
+		path := filepath.Join(library, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o640); err != nil {
+			t.Fatalf("write %s: %v", rel, err)
+		}
+	}
+	write("2024/a.jpg", "aaaa")
+	write("2024/b.jpg", "bbbb")
+	if err := store.SetSetting(context.Background(), baseStorageSetting, library); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+
+	var mu sync.Mutex
+	var kinds []string
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		kinds = append(kinds, r.Header.Get("X-USBVault-Archive"))
+		bodies = append(bodies, body)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	m := NewManager(store, nil, log.New(io.Discard, "", 0))
+	run := func(req Request) (string, []string, map[string]any) {
+		t.Helper()
+		req.Mode, req.Destination = "api", srv.URL
+		if err := m.Start("admin", req); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		st := m.GetStatus()
+		for st.State == "running" && time.Now().Before(deadline) {
+			time.Sleep(20 * time.Millisecond)
+			st = m.GetStatus()
+		}
+		if st.State != "success" {
+			t.Fatalf("status = %s %q", st.State, st.Message)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		media, manifest := readArchive(t, bodies[len(bodies)-1])
+		return kinds[len(kinds)-1], media, manifest
+	}
+
+	kind, media, _ := run(Request{Incremental: true})
+	if kind != "full" || !slices.Equal(media, []string{"2024/a.jpg", "2024/b.jpg"}) {
+		t.Fatalf("first run: kind %q media %v, want a full archive", kind, media)
+	}
+
+	write("2024/c.jpg", "cccc")
+	if err := os.Remove(filepath.Join(library, "2024", "b.jpg")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	kind, media, manifest := run(Request{Incremental: true})
+	if kind != "incr" || !slices.Equal(media, []string{"2024/c.jpg"}) {
+		t.Fatalf("second run: kind %q media %v, want only 2024/c.jpg", kind, media)
+	}
+	if manifest["incremental"] != true || !strings.Contains(toJSON(manifest["removed"]), "2024/b.jpg") {
+		t.Fatalf("manifest = %v, want incremental with 2024/b.jpg removed", manifest)
+	}
+
+	got, err := store.BackupManifest(context.Background(), "api:"+srv.URL)
+	if err != nil {
+		t.Fatalf("BackupManifest: %v", err)
+	}
+	if _, ok := got["2024/b.jpg"]; ok || len(got) != 2 {
+		t.Fatalf("manifest entries = %v, want a.jpg and c.jpg", got)
+	}
+
+	kind, media, _ = run(Request{Incremental: true, Full: true})
+	if kind != "full" || !slices.Equal(media, []string{"2024/a.jpg", "2024/c.jpg"}) {
+		t.Fatalf("full run: kind %q media %v, want everything", kind, media)
+	}
+
+	last, err := m.loadLastBackup(context.Background())
+	if err != nil || last.Destinations[0].Destination != srv.URL {
+		t.Fatalf("last backup = %+v, %v", last, err)
+	}
+}
+
+func TestChainDestinationTagsName(t *testing.T) {
+	t.Parallel()
+
+	p := &archivePlan{started: time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC), incremental: true}
+	cases := map[string]string{
+		"user@host:/b/vault.tar.gz": "user@host:/b/vault-incr-20260304-050607.tar.gz",
+		"s3://bucket/vault.tgz":     "s3://bucket/vault-incr-20260304-050607.tgz",
+		"s3://bucket/vault":         "s3://bucket/vault-incr-20260304-050607.tar.gz",
+	}
+	for in, want := range cases {
+		if got := p.chainDestination(Destination{Mode: "s3", Destination: in}); got != want {
+			t.Errorf("chainDestination(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := p.chainDestination(Destination{Mode: "api", Destination: "https://x/up"}); got != "https://x/up" {
+		t.Errorf("api destination changed to %q", got)
+	}
+}
+
+// readArchive returns the sorted media paths in a backup archive and its
+// parsed manifest.json.
+func readArchive(t *testing.T, body []byte) ([]string, map[string]any) {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var media []string
+	manifest := map[string]any{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar: %v", err)
+		}
+		_, rel, _ := strings.Cut(hdr.Name, "/")
+		switch {
+		case rel == "manifest.json":
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				t.Fatalf("manifest: %v", err)
+			}
+		case strings.HasPrefix(rel, "media/") && hdr.Typeflag == tar.TypeReg:
+			media = append(media, strings.TrimPrefix(rel, "media/"))
+		}
+	}
+	slices.Sort(media)
+	return media, manifest
+}
+
+func toJSON(v any) string {
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
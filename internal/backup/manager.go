@@ -15,21 +15,27 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"businessplan/usbvault/internal/config"
 	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/hooks"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/s3"
 )
 
-const baseStorageSetting = "base_storage_dir"
+const (
+	baseStorageSetting = "base_storage_dir"
+	lastBackupSetting  = "last_backup"
+)
 
 var ErrBusy = errors.New("backup already running")
 var ErrInvalidRequest = errors.New("invalid backup request")
 
-type Request struct {
+// Destination is one place a backup is sent to.
+type Destination struct {
 	Mode        string `json:"mode"`
 	Destination string `json:"destination"`
 	SSHPort     int    `json:"ssh_port"`
@@ -37,30 +43,91 @@ type Request struct {
 	APIToken    string `json:"api_token"`
 }
 
+// Request describes a backup run. The top-level fields are the original
+// single-destination form; Destinations adds more targets to the same run.
+// Archive destinations (ssh, s3, api) always share one archive pass. rsync
+// and snapshot destinations run after it, or alongside it when Parallel is
+// set. Incremental archives only carry files the archive destinations do
+// not have yet; Full forces a complete archive that starts a new chain.
+type Request struct {
+	Mode         string        `json:"mode"`
+	Destination  string        `json:"destination"`
+	SSHPort      int           `json:"ssh_port"`
+	APIMethod    string        `json:"api_method"`
+	APIToken     string        `json:"api_token"`
+	Destinations []Destination `json:"destinations,omitempty"`
+	Parallel     bool          `json:"parallel"`
+	Incremental  bool          `json:"incremental"`
+	Full         bool          `json:"full"`
+}
+
+const maxDestinations = 8
+
+// targets returns the normalized destination list.
+func (r Request) targets() []Destination {
+	out := make([]Destination, 0, len(r.Destinations)+1)
+	if strings.TrimSpace(r.Mode) != "" || strings.TrimSpace(r.Destination) != "" {
+		out = append(out, Destination{
+			Mode:        r.Mode,
+			Destination: r.Destination,
+			SSHPort:     r.SSHPort,
+			APIMethod:   r.APIMethod,
+			APIToken:    r.APIToken,
+		})
+	}
+	out = append(out, r.Destinations...)
+	for i := range out {
+		out[i].Mode = strings.ToLower(strings.TrimSpace(out[i].Mode))
+		out[i].Destination = strings.TrimSpace(out[i].Destination)
+		out[i].APIMethod = strings.ToUpper(strings.TrimSpace(out[i].APIMethod))
+		if out[i].APIMethod == "" {
+			out[i].APIMethod = http.MethodPut
+		}
+	}
+	return out
+}
+
 type Status struct {
-	State       string `json:"state"` // idle, running, success, error
+	State        string              `json:"state"` // idle, running, success, error
+	Mode         string              `json:"mode"`
+	Destination  string              `json:"destination"`
+	StartedAt    string              `json:"started_at"`
+	UpdatedAt    string              `json:"updated_at"`
+	FinishedAt   string              `json:"finished_at"`
+	Files        int64               `json:"files"`
+	Bytes        int64               `json:"bytes"`
+	CurrentPath  string              `json:"current_path"`
+	Message      string              `json:"message"`
+	Destinations []DestinationStatus `json:"destinations"`
+}
+
+type DestinationStatus struct {
 	Mode        string `json:"mode"`
 	Destination string `json:"destination"`
-	StartedAt   string `json:"started_at"`
-	UpdatedAt   string `json:"updated_at"`
-	FinishedAt  string `json:"finished_at"`
-	Files       int64  `json:"files"`
-	Bytes       int64  `json:"bytes"`
-	CurrentPath string `json:"current_path"`
+	State       string `json:"state"` // pending, running, success, error
 	Message     string `json:"message"`
+	FinishedAt  string `json:"finished_at"`
+	// Bytes is how much of the archive the destination has confirmed so
+	// far. Only ssh destinations report it.
+	Bytes int64 `json:"bytes"`
 }
 
 type Manager struct {
 	store  *db.Store
+	hooks  *hooks.Runner
 	logger *log.Logger
+	libKey *libcrypt.Key
 
 	mu     sync.Mutex
 	status Status
+
+	drillMu sync.Mutex
 }
 
-func NewManager(store *db.Store, logger *log.Logger) *Manager {
+func NewManager(store *db.Store, hookRunner *hooks.Runner, logger *log.Logger) *Manager {
 	return &Manager{
 		store:  store,
+		hooks:  hookRunner,
 		logger: logger,
 		status: Status{State: "idle", Message: "No backup running."},
 	}
@@ -69,19 +136,26 @@ func NewManager(store *db.Store, logger *log.Logger) *Manager {
 func (m *Manager) GetStatus() Status {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.status
+	st := m.status
+	st.Destinations = append([]DestinationStatus(nil), m.status.Destinations...)
+	return st
 }
 
 func (m *Manager) Start(actor string, req Request) error {
-	req.Mode = strings.ToLower(strings.TrimSpace(req.Mode))
-	req.Destination = strings.TrimSpace(req.Destination)
-	req.APIMethod = strings.ToUpper(strings.TrimSpace(req.APIMethod))
-	if req.APIMethod == "" {
-		req.APIMethod = http.MethodPut
-	}
-
-	if err := validateRequest(req); err != nil {
-		return err
+	targets := req.targets()
+	if len(targets) == 0 {
+		return fmt.Errorf("%w: at least one destination is required", ErrInvalidRequest)
+	}
+	if len(targets) > maxDestinations {
+		return fmt.Errorf("%w: at most %d destinations per run", ErrInvalidRequest, maxDestinations)
+	}
+	for i, t := range targets {
+		if err := validateDestination(t); err != nil {
+			if len(targets) > 1 {
+				return fmt.Errorf("destination %d: %w", i+1, err)
+			}
+			return err
+		}
 	}
 
 	m.mu.Lock()
@@ -90,22 +164,35 @@ func (m *Manager) Start(actor string, req Request) error {
 		return ErrBusy
 	}
 	now := time.Now().UTC().Format(time.RFC3339Nano)
+	dests := make([]DestinationStatus, len(targets))
+	for i, t := range targets {
+		dests[i] = DestinationStatus{Mode: t.Mode, Destination: t.Destination, State: "pending"}
+	}
+	mode, destination := targets[0].Mode, targets[0].Destination
+	if len(targets) > 1 {
+		mode = "multi"
+		destination = fmt.Sprintf("%d destinations", len(targets))
+	}
 	m.status = Status{
-		State:       "running",
-		Mode:        req.Mode,
-		Destination: req.Destination,
-		StartedAt:   now,
-		UpdatedAt:   now,
-		Message:     "Backup started...",
+		State:        "running",
+		Mode:         mode,
+		Destination:  destination,
+		StartedAt:    now,
+		UpdatedAt:    now,
+		Message:      "Backup started...",
+		Destinations: dests,
 	}
 	m.mu.Unlock()
 
-	go m.run(actor, req)
+	go m.run(actor, targets, req)
 	return nil
 }
 
-func (m *Manager) run(actor string, req Request) {
+func (m *Manager) run(actor string, targets []Destination, req Request) {
+	defer m.firePostBackup(actor)
+
 	ctx := context.Background()
+	defer m.beginJob(ctx, actor, targets)()
 	baseStorage, ok, err := m.store.GetSetting(ctx, baseStorageSetting)
 	if err != nil {
 		m.failf("database error: %v", err)
@@ -116,15 +203,61 @@ func (m *Manager) run(actor string, req Request) {
 		return
 	}
 	baseStorage = filepath.Clean(baseStorage)
+	filter := m.loadFilter(ctx)
+
+	var archiveIdx, treeIdx []int
+	for i, t := range targets {
+		if t.Mode == "rsync" || t.Mode == "snapshot" {
+			treeIdx = append(treeIdx, i)
+		} else {
+			archiveIdx = append(archiveIdx, i)
+		}
+	}
 
-	var runErr error
-	if req.Mode == "rsync" {
-		runErr = m.runRsync(baseStorage, req.Destination)
-	} else {
-		runErr = m.runArchiveTransfer(baseStorage, req)
+	var wg sync.WaitGroup
+	runTree := func(i int) {
+		if targets[i].Mode == "snapshot" {
+			m.setDestination(i, "running", "Writing snapshot...")
+			m.finishDestination(i, m.runSnapshot(baseStorage, filter, targets[i].Destination))
+			return
+		}
+		m.setDestination(i, "running", "Running rsync transfer...")
+		m.finishDestination(i, m.runRsync(baseStorage, filter, targets[i].Destination))
+	}
+	if req.Parallel {
+		for _, i := range treeIdx {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				runTree(i)
+			}(i)
+		}
 	}
-	if runErr != nil {
-		m.failf("%v", runErr)
+	recorded := append([]Destination(nil), targets...)
+	if len(archiveIdx) > 0 {
+		m.runArchiveTransfer(ctx, baseStorage, filter, targets, archiveIdx, req, recorded)
+	}
+	if !req.Parallel {
+		for _, i := range treeIdx {
+			runTree(i)
+		}
+	}
+	wg.Wait()
+
+	st := m.GetStatus()
+	m.recordLastBackup(ctx, st, recorded)
+	failed := make([]string, 0)
+	for _, d := range st.Destinations {
+		if d.State != "success" {
+			failed = append(failed, fmt.Sprintf("%s %s: %s", d.Mode, d.Destination, d.Message))
+		}
+	}
+	if len(failed) > 0 {
+		if len(targets) == 1 {
+			m.failf("%s", st.Destinations[0].Message)
+			return
+		}
+		m.failf("%d of %d destinations failed: %s", len(failed), len(targets), strings.Join(failed, "; "))
 		return
 	}
 
@@ -134,42 +267,165 @@ func (m *Manager) run(actor string, req Request) {
 	m.status.State = "success"
 	m.status.UpdatedAt = now
 	m.status.FinishedAt = now
-	m.status.Message = fmt.Sprintf("Backup completed by %s.", actor)
+	if len(targets) > 1 {
+		m.status.Message = fmt.Sprintf("Backup to %d destinations completed by %s.", len(targets), actor)
+	} else {
+		m.status.Message = fmt.Sprintf("Backup completed by %s.", actor)
+	}
+}
+
+// lastBackup is what the restore drill needs to read a backup back.
+type lastBackup struct {
+	StartedAt    string        `json:"started_at"`
+	Destinations []Destination `json:"destinations"`
+}
+
+// recordLastBackup remembers the destinations that received this run so the
+// restore drill can fetch from them later. Runs where every destination
+// failed leave the previous record in place. Incremental archives come in
+// with an empty destination and are skipped, since they only hold what
+// changed.
+func (m *Manager) recordLastBackup(ctx context.Context, st Status, targets []Destination) {
+	ok := make([]Destination, 0, len(targets))
+	for i, d := range st.Destinations {
+		if d.State == "success" && targets[i].Destination != "" {
+			ok = append(ok, targets[i])
+		}
+	}
+	if len(ok) == 0 {
+		return
+	}
+	raw, err := json.Marshal(lastBackup{StartedAt: st.StartedAt, Destinations: ok})
+	if err == nil {
+		err = m.store.SetSetting(ctx, lastBackupSetting, string(raw))
+	}
+	if err != nil {
+		m.logger.Printf("record last backup: %v", err)
+	}
 }
 
-func (m *Manager) runArchiveTransfer(baseStorage string, req Request) error {
+// runArchiveTransfer generates the archive once and streams it to every
+// archive destination at the same time. A destination that fails is dropped
+// and the others continue. Destinations that succeed get their manifest
+// updated. recorded receives where each archive was written for the restore
+// drill, or an empty destination when the archive was incremental.
+func (m *Manager) runArchiveTransfer(ctx context.Context, baseStorage string, filter Filter, targets []Destination, idx []int, req Request, recorded []Destination) {
+	plan, err := m.newArchivePlan(ctx, baseStorage, filter, targets, idx, req.Incremental && !req.Full)
+	if err != nil {
+		for _, i := range idx {
+			m.finishDestination(i, fmt.Errorf("load backup manifest: %w", err))
+		}
+		return
+	}
+	kind := ""
+	if req.Incremental {
+		kind = plan.kind()
+	}
+	for _, i := range idx {
+		switch {
+		case plan.incremental:
+			recorded[i].Destination = ""
+		case kind != "":
+			recorded[i].Destination = plan.chainDestination(targets[i])
+		}
+	}
+
 	dbFiles := discoverDBFiles()
-	reader, writer := io.Pipe()
+	readers := make([]*io.PipeReader, len(idx))
+	writers := make([]*io.PipeWriter, len(idx))
+	for n := range idx {
+		readers[n], writers[n] = io.Pipe()
+	}
+	fan := &fanoutWriter{writers: writers, dead: make([]bool, len(writers))}
 	producerErr := make(chan error, 1)
 	go func() {
-		producerErr <- m.writeTarGzArchive(writer, baseStorage, dbFiles)
+		err := m.writeTarGzArchive(fan, baseStorage, dbFiles, filter, plan)
+		for _, w := range writers {
+			_ = w.CloseWithError(err)
+		}
+		producerErr <- err
 	}()
 
-	var transferErr error
-	switch req.Mode {
+	var wg sync.WaitGroup
+	for n, i := range idx {
+		wg.Add(1)
+		go func(n, i int) {
+			defer wg.Done()
+			m.setDestination(i, "running", "Streaming archive...")
+			dest := targets[i]
+			if kind != "" {
+				dest.Destination = plan.chainDestination(dest)
+			}
+			err := m.sendArchive(ctx, readers[n], dest, kind, func(sent int64) { m.destinationBytes(i, sent) })
+			// Always release the pipe so a sender that stops early can
+			// never block the archive writer.
+			_ = readers[n].CloseWithError(err)
+			m.finishDestination(i, err)
+		}(n, i)
+	}
+	wg.Wait()
+
+	if err := <-producerErr; err != nil {
+		for _, i := range idx {
+			m.markArchiveFailed(i, err)
+		}
+		return
+	}
+	st := m.GetStatus()
+	for _, i := range idx {
+		if st.Destinations[i].State != "success" {
+			continue
+		}
+		if err := m.store.UpdateBackupManifest(ctx, manifestTarget(targets[i]), plan.sent, plan.seen); err != nil {
+			m.logger.Printf("update backup manifest for %s %s: %v", targets[i].Mode, targets[i].Destination, err)
+		}
+	}
+}
+
+// sendArchive uploads one archive. kind is "full" or "incr" for archives in
+// an incremental chain and empty otherwise.
+func (m *Manager) sendArchive(ctx context.Context, r io.Reader, dest Destination, kind string, progress func(int64)) error {
+	switch dest.Mode {
 	case "ssh":
-		transferErr = sendViaSSH(reader, req.Destination, req.SSHPort)
+		return m.sendViaSSH(ctx, r, dest, progress)
 	case "s3":
-		transferErr = sendViaS3(reader, req.Destination)
+		return m.sendViaS3(ctx, r, dest.Destination)
 	case "api":
-		transferErr = sendViaAPI(reader, req.Destination, req.APIMethod, req.APIToken)
-	default:
-		transferErr = fmt.Errorf("%w: unsupported mode %q", ErrInvalidRequest, req.Mode)
-	}
-	if transferErr != nil {
-		_ = reader.CloseWithError(transferErr)
+		return sendViaAPI(r, dest.Destination, dest.APIMethod, dest.APIToken, kind)
 	}
+	return fmt.Errorf("%w: unsupported mode %q", ErrInvalidRequest, dest.Mode)
+}
 
-	archiveErr := <-producerErr
-	if transferErr != nil {
-		return transferErr
-	}
-	return archiveErr
+// fanoutWriter copies each write to every live pipe. Pipes whose reader has
+// gone away are skipped from then on; it only fails once all are gone.
+type fanoutWriter struct {
+	writers []*io.PipeWriter
+	dead    []bool
 }
 
-func (m *Manager) writeTarGzArchive(w *io.PipeWriter, baseStorage string, dbFiles []string) error {
-	defer w.Close()
+var errAllDestinationsFailed = errors.New("all archive destinations failed")
+
+func (f *fanoutWriter) Write(p []byte) (int, error) {
+	alive := 0
+	for i, w := range f.writers {
+		if f.dead[i] {
+			continue
+		}
+		if _, err := w.Write(p); err != nil {
+			f.dead[i] = true
+			continue
+		}
+		alive++
+	}
+	if alive == 0 {
+		return 0, errAllDestinationsFailed
+	}
+	return len(p), nil
+}
 
+// writeTarGzArchive writes the library and database as a tar.gz. plan may
+// be nil for a plain full archive.
+func (m *Manager) writeTarGzArchive(w io.Writer, baseStorage string, dbFiles []string, filter Filter, plan *archivePlan) error {
 	gz := gzip.NewWriter(w)
 	defer gz.Close()
 
@@ -183,6 +439,10 @@ func (m *Manager) writeTarGzArchive(w *io.PipeWriter, baseStorage string, dbFile
 		"db_files":       dbFiles,
 		"archive_format": "tar.gz",
 	}
+	if plan != nil && plan.incremental {
+		manifest["incremental"] = true
+		manifest["removed"] = plan.removed
+	}
 	manifestJSON, _ := json.MarshalIndent(manifest, "", "  ")
 	if err := writeTarBytes(tw, filepath.ToSlash(filepath.Join(root, "manifest.json")), manifestJSON); err != nil {
 		return err
@@ -204,9 +464,16 @@ func (m *Manager) writeTarGzArchive(w *io.PipeWriter, baseStorage string, dbFile
 		if rel == "." {
 			return nil
 		}
-		if strings.HasPrefix(d.Name(), ".") && d.IsDir() {
+		slashRel := filepath.ToSlash(rel)
+		if strings.HasPrefix(d.Name(), ".") && d.IsDir() && slashRel != config.WorkDirName {
 			return filepath.SkipDir
 		}
+		if filter.Excluded(slashRel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
 		arcName := filepath.ToSlash(filepath.Join(root, "media", rel))
 		if d.IsDir() {
@@ -215,6 +482,9 @@ func (m *Manager) writeTarGzArchive(w *io.PipeWriter, baseStorage string, dbFile
 		if !info.Mode().IsRegular() {
 			return nil
 		}
+		if plan != nil && !plan.include(slashRel, info) {
+			return nil
+		}
 		if err := writeTarFile(tw, arcName, path, info); err != nil {
 			return err
 		}
@@ -240,13 +510,11 @@ func (m *Manager) writeTarGzArchive(w *io.PipeWriter, baseStorage string, dbFile
 	return nil
 }
 
-func (m *Manager) runRsync(baseStorage, destination string) error {
+func (m *Manager) runRsync(baseStorage string, filter Filter, destination string) error {
 	destination = strings.TrimSpace(destination)
 	if destination == "" {
 		return fmt.Errorf("%w: destination is required", ErrInvalidRequest)
 	}
-	m.setMessage("Running rsync transfer...")
-
 	if isLocalPath(destination) {
 		if err := os.MkdirAll(destination, 0o750); err != nil {
 			return fmt.Errorf("create rsync destination: %w", err)
@@ -264,7 +532,9 @@ func (m *Manager) runRsync(baseStorage, destination string) error {
 	}
 
 	mediaSrc := withTrailingSep(baseStorage)
-	if err := runCommand("rsync", "-az", "--delete", mediaSrc, withTrailingSep(mediaDest)); err != nil {
+	args := append([]string{"-az", "--delete"}, filter.rsyncArgs()...)
+	args = append(args, mediaSrc, withTrailingSep(mediaDest))
+	if err := runCommand("rsync", args...); err != nil {
 		return err
 	}
 
@@ -279,15 +549,23 @@ func (m *Manager) runRsync(baseStorage, destination string) error {
 	return nil
 }
 
-func validateRequest(req Request) error {
+func validateDestination(req Destination) error {
 	switch req.Mode {
-	case "ssh", "s3", "api", "rsync":
+	case "ssh", "s3", "api", "rsync", "snapshot":
 	default:
-		return fmt.Errorf("%w: mode must be ssh, rsync, s3, or api", ErrInvalidRequest)
+		return fmt.Errorf("%w: mode must be ssh, rsync, snapshot, s3, or api", ErrInvalidRequest)
 	}
 	if req.Destination == "" {
 		return fmt.Errorf("%w: destination is required", ErrInvalidRequest)
 	}
+	if req.Mode == "snapshot" && (!isLocalPath(req.Destination) || !filepath.IsAbs(req.Destination)) {
+		return fmt.Errorf("%w: snapshot destination must be an absolute local path", ErrInvalidRequest)
+	}
+	if req.Mode == "s3" {
+		if _, _, err := s3.ParseURL(req.Destination); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+	}
 	if req.Mode == "api" {
 		switch req.APIMethod {
 		case http.MethodPut, http.MethodPost:
@@ -298,43 +576,15 @@ func validateRequest(req Request) error {
 	return nil
 }
 
-func sendViaSSH(r io.Reader, destination string, port int) error {
-	host, remotePath, err := splitSSHDestination(destination)
-	if err != nil {
-		return err
-	}
-	args := make([]string, 0, 6)
-	if port > 0 {
-		args = append(args, "-p", strconv.Itoa(port))
-	}
-	args = append(args, host, "sh", "-c", "cat > "+shellQuote(remotePath))
-	cmd := exec.Command("ssh", args...)
-	cmd.Stdin = r
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ssh upload failed: %w: %s", err, strings.TrimSpace(stderr.String()))
-	}
-	return nil
-}
-
-func sendViaS3(r io.Reader, destination string) error {
-	cmd := exec.Command("aws", "s3", "cp", "-", destination)
-	cmd.Stdin = r
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("s3 upload failed (requires aws cli/config): %w: %s", err, strings.TrimSpace(stderr.String()))
-	}
-	return nil
-}
-
-func sendViaAPI(r io.Reader, destination, method, token string) error {
+func sendViaAPI(r io.Reader, destination, method, token, kind string) error {
 	req, err := http.NewRequest(method, destination, r)
 	if err != nil {
 		return fmt.Errorf("build api request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/gzip")
+	if kind != "" {
+		req.Header.Set("X-USBVault-Archive", kind)
+	}
 	if strings.TrimSpace(token) != "" {
 		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(token))
 	}
@@ -364,10 +614,6 @@ func splitSSHDestination(destination string) (string, string, error) {
 	return host, remotePath, nil
 }
 
-func shellQuote(v string) string {
-	return "'" + strings.ReplaceAll(v, "'", "'\"'\"'") + "'"
-}
-
 func runCommand(name string, args ...string) error {
 	cmd := exec.Command(name, args...)
 	var stderr bytes.Buffer
@@ -448,7 +694,11 @@ func ensureRemoteDirIfSSH(dest string) error {
 
 func discoverDBFiles() []string {
 	base := config.DBPath()
-	out := []string{base, base + "-wal", base + "-shm"}
+	// An encrypted install only has base.enc on disk; the plaintext working
+	// copy lives in the runtime dir and is never archived.
+	// The library key is passphrase-wrapped and is needed to read encrypted
+	// media from a restored backup.
+	out := []string{base, base + "-wal", base + "-shm", base + ".enc", config.LibraryKeyPath()}
 	filtered := make([]string, 0, len(out))
 	for _, p := range out {
 		if _, err := os.Stat(p); err == nil {
@@ -500,6 +750,20 @@ func writeTarBytes(tw *tar.Writer, arcName string, body []byte) error {
 	return err
 }
 
+func (m *Manager) firePostBackup(actor string) {
+	st := m.GetStatus()
+	m.hooks.Fire(hooks.EventPostBackup, map[string]any{
+		"actor":        actor,
+		"state":        st.State,
+		"mode":         st.Mode,
+		"destination":  st.Destination,
+		"files":        st.Files,
+		"bytes":        st.Bytes,
+		"message":      st.Message,
+		"destinations": st.Destinations,
+	})
+}
+
 func (m *Manager) bumpProgress(path string, size int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -509,13 +773,73 @@ func (m *Manager) bumpProgress(path string, size int64) {
 	m.status.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
 }
 
-func (m *Manager) setMessage(message string) {
+func (m *Manager) setDestination(i int, state, message string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.status.Message = message
+	m.status.Destinations[i].State = state
+	m.status.Destinations[i].Message = message
 	m.status.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
 }
 
+func (m *Manager) destinationBytes(i int, sent int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status.Destinations[i].Bytes = sent
+	m.status.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+func (m *Manager) finishDestination(i int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	d := &m.status.Destinations[i]
+	d.FinishedAt = now
+	if err != nil {
+		d.State = "error"
+		d.Message = err.Error()
+		m.logger.Printf("backup to %s %s failed: %v", d.Mode, d.Destination, err)
+	} else {
+		d.State = "success"
+		d.Message = "Completed."
+	}
+	m.status.UpdatedAt = now
+}
+
+// markArchiveFailed marks a destination failed when archive generation
+// broke, even if its sender returned without error.
+func (m *Manager) markArchiveFailed(i int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d := &m.status.Destinations[i]; d.State != "error" {
+		d.State = "error"
+		d.Message = "archive generation failed: " + err.Error()
+	}
+}
+
+// JobKind is the running_jobs kind of a backup run. Its detail is a JSON
+// list of the run's destinations, without credentials.
+const JobKind = "backup"
+
+// beginJob records the run as running until the returned func is called,
+// so one cut off by a crash is reported at the next start.
+func (m *Manager) beginJob(ctx context.Context, actor string, targets []Destination) func() {
+	plain := make([]Destination, len(targets))
+	for i, t := range targets {
+		plain[i] = Destination{Mode: t.Mode, Destination: t.Destination}
+	}
+	detail, _ := json.Marshal(plain)
+	id, err := m.store.BeginJob(ctx, JobKind, actor, string(detail))
+	if err != nil {
+		m.logger.Printf("record backup start: %v", err)
+		return func() {}
+	}
+	return func() {
+		if err := m.store.EndJob(ctx, id); err != nil {
+			m.logger.Printf("record backup end: %v", err)
+		}
+	}
+}
+
 func (m *Manager) failf(format string, args ...any) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
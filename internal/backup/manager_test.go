@@ -0,0 +1,130 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func TestMultiDestinationBackupSharesOneArchive(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("USBVAULT_DATA_DIR", filepath.Join(dir, "data"))
+
+	store, err := db.Open(filepath.Join(dir, "data", "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	library := filepath.Join(dir, "library")
+	if err := os.MkdirAll(filepath.Join(library, "2024"), 0o750); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(library, "2024", "a.jpg"), bytes.Repeat([]byte("x"), 200<<10), 0o640); err != nil {
+		t.Fatalf("write media: %v", err)
+	}
+	if err := store.SetSetting(context.Background(), baseStorageSetting, library); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+
+	var mu sync.Mutex
+	bodies := map[string][]byte{}
+	ok := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			bodies[name] = body
+			mu.Unlock()
+		}))
+	}
+	first, second := ok("first"), ok("second")
+	defer first.Close()
+	defer second.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	m := NewManager(store, nil, log.New(io.Discard, "", 0))
+	err = m.Start("admin", Request{
+		Mode:        "api",
+		Destination: first.URL,
+		Destinations: []Destination{
+			{Mode: "api", Destination: broken.URL},
+			{Mode: "api", Destination: second.URL, APIMethod: "post"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	st := m.GetStatus()
+	for st.State == "running" && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		st = m.GetStatus()
+	}
+	if st.State != "error" || !strings.Contains(st.Message, "1 of 3 destinations failed") {
+		t.Fatalf("status = %s %q", st.State, st.Message)
+	}
+	wantStates := []string{"success", "error", "success"}
+	for i, d := range st.Destinations {
+		if d.State != wantStates[i] {
+			t.Fatalf("destination %d state = %s (%s), want %s", i, d.State, d.Message, wantStates[i])
+		}
+	}
+	if st.Files < 2 {
+		t.Fatalf("Files = %d, want the media file plus db files", st.Files)
+	}
+
+	if !bytes.Equal(bodies["first"], bodies["second"]) {
+		t.Fatalf("destinations received different archives")
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(bodies["first"]))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	found := false
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar: %v", err)
+		}
+		if strings.HasSuffix(hdr.Name, "media/2024/a.jpg") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("archive is missing media/2024/a.jpg")
+	}
+}
+
+func TestStartRejectsInvalidDestination(t *testing.T) {
+	t.Parallel()
+
+	m := NewManager(nil, nil, log.New(io.Discard, "", 0))
+	err := m.Start("admin", Request{Destinations: []Destination{{Mode: "ssh", Destination: "h:/x"}, {Mode: "ftp", Destination: "x"}}})
+	if err == nil || !strings.Contains(err.Error(), "destination 2") {
+		t.Fatalf("Start err = %v", err)
+	}
+	if err := m.Start("admin", Request{}); err == nil {
+		t.Fatalf("Start with no destinations expected error")
+	}
+}
@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"businessplan/usbvault/internal/s3"
+)
+
+// S3SettingKey holds the s3.Config used for s3 destinations.
+const S3SettingKey = "backup_s3"
+
+// LoadS3Config returns the stored S3 settings. When no access key is stored,
+// the standard AWS_* environment variables are used instead, so a vault
+// already set up for the aws CLI keeps working.
+func LoadS3Config(ctx context.Context, settings interface {
+	GetSetting(context.Context, string) (string, bool, error)
+}) (s3.Config, error) {
+	var cfg s3.Config
+	raw, ok, err := settings.GetSetting(ctx, S3SettingKey)
+	if err != nil {
+		return cfg, err
+	}
+	if ok && raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+			return cfg, fmt.Errorf("stored s3 settings: %w", err)
+		}
+	}
+	if cfg.AccessKeyID == "" {
+		cfg.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		cfg.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		cfg.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		if cfg.Region == "" {
+			cfg.Region = os.Getenv("AWS_REGION")
+		}
+		if cfg.Region == "" {
+			cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = os.Getenv("AWS_ENDPOINT_URL")
+		}
+	}
+	return cfg, nil
+}
+
+func (m *Manager) s3Client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := LoadS3Config(ctx, m.store)
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(cfg)
+}
+
+func (m *Manager) sendViaS3(ctx context.Context, r io.Reader, destination string) error {
+	bucket, key, err := s3.ParseURL(destination)
+	if err != nil {
+		return err
+	}
+	client, err := m.s3Client(ctx)
+	if err != nil {
+		return fmt.Errorf("s3 upload failed: %w", err)
+	}
+	if err := client.Upload(ctx, bucket, key, r); err != nil {
+		return fmt.Errorf("s3 upload failed: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) openS3(ctx context.Context, destination string) (io.ReadCloser, error) {
+	bucket, key, err := s3.ParseURL(destination)
+	if err != nil {
+		return nil, err
+	}
+	client, err := m.s3Client(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("s3 download failed: %w", err)
+	}
+	body, err := client.Open(ctx, bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("s3 download failed: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,213 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/fault"
+)
+
+const (
+	snapshotLayout = "20060102-150405"
+	partialSuffix  = ".partial"
+)
+
+// runSnapshot writes a dated, complete copy of the library to a local
+// destination. Files unchanged since the previous snapshot are hardlinked to
+// it, so each snapshot is browsable on its own but only new files use space.
+// The snapshot is built under a .partial name and renamed when done, so an
+// interrupted run never becomes the base for the next one, and one that
+// fails removes it.
+func (m *Manager) runSnapshot(baseStorage string, filter Filter, destination string) (err error) {
+	if err := os.MkdirAll(destination, 0o750); err != nil {
+		return fmt.Errorf("create snapshot destination: %w", err)
+	}
+	prev, err := latestSnapshot(destination)
+	if err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format(snapshotLayout)
+	if name == prev {
+		return errors.New("a snapshot was already taken this second")
+	}
+	final := filepath.Join(destination, name)
+	work := final + partialSuffix
+	if err := os.RemoveAll(work); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(work)
+		}
+	}()
+	var prevDir string
+	if prev != "" {
+		prevDir = filepath.Join(destination, prev, "media")
+	}
+
+	mediaDir := filepath.Join(work, "media")
+	err = filepath.WalkDir(baseStorage, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(baseStorage, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return os.MkdirAll(mediaDir, 0o750)
+		}
+		slashRel := filepath.ToSlash(rel)
+		if strings.HasPrefix(d.Name(), ".") && d.IsDir() && slashRel != config.WorkDirName {
+			return filepath.SkipDir
+		}
+		if filter.Excluded(slashRel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(mediaDir, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o750)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if prevDir != "" && linkUnchanged(filepath.Join(prevDir, rel), target, info) {
+			m.bumpProgress(path, 0)
+			return nil
+		}
+		if err := copyPreservingTime(path, target, info); err != nil {
+			return err
+		}
+		m.bumpProgress(path, info.Size())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dbDir := filepath.Join(work, "db")
+	if err := os.MkdirAll(dbDir, 0o750); err != nil {
+		return err
+	}
+	for _, dbPath := range discoverDBFiles() {
+		info, err := os.Stat(dbPath)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if err := copyPreservingTime(dbPath, filepath.Join(dbDir, filepath.Base(dbPath)), info); err != nil {
+			return err
+		}
+		m.bumpProgress(dbPath, info.Size())
+	}
+	return os.Rename(work, final)
+}
+
+// linkUnchanged hardlinks target to the previous snapshot's copy when it
+// matches the source by size and modification time. It reports false when
+// the caller must copy instead, including on filesystems without hardlinks
+// such as FAT and exFAT.
+func linkUnchanged(prev, target string, src os.FileInfo) bool {
+	info, err := os.Stat(prev)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != src.Size() {
+		return false
+	}
+	// FAT stores times with two-second precision.
+	if d := info.ModTime().Sub(src.ModTime()); d > 2*time.Second || d < -2*time.Second {
+		return false
+	}
+	return os.Link(prev, target) == nil
+}
+
+func copyPreservingTime(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fault.Writer(fault.BackupWrite, out), in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// latestSnapshot returns the name of the newest completed snapshot in
+// destination, or "" when there is none.
+func latestSnapshot(destination string) (string, error) {
+	names, err := listSnapshots(destination)
+	if err != nil || len(names) == 0 {
+		return "", err
+	}
+	return names[len(names)-1], nil
+}
+
+// RemovePartialSnapshots deletes the unfinished snapshots a run cut off
+// by a crash left at destination and returns how many it removed.
+func RemovePartialSnapshots(destination string) (int, error) {
+	entries, err := os.ReadDir(destination)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	removed := 0
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), partialSuffix)
+		if !ok || !e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(snapshotLayout, name); err != nil {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(destination, e.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// listSnapshots returns completed snapshot names, oldest first.
+func listSnapshots(destination string) ([]string, error) {
+	entries, err := os.ReadDir(destination)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	out := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(snapshotLayout, e.Name()); err == nil {
+			out = append(out, e.Name())
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
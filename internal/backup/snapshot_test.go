@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func TestSnapshotHardlinksUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("USBVAULT_DATA_DIR", filepath.Join(dir, "data"))
+	store, err := db.Open(filepath.Join(dir, "data", "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	library := filepath.Join(dir, "library")
+	write := func(rel, body string) {
+		path := filepath.Join(library, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o640); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write("2024/a.jpg", "alpha")
+	write(".usbvault/thumbnails/a.jpg", "thumb")
+
+	m := NewManager(store, nil, log.New(io.Discard, "", 0))
+	dest := filepath.Join(dir, "snapshots")
+
+	if err := m.runSnapshot(library, Filter{}, dest); err != nil {
+		t.Fatalf("first snapshot: %v", err)
+	}
+	// Snapshot names have one-second resolution.
+	time.Sleep(1100 * time.Millisecond)
+	write("2024/b.jpg", "bravo")
+	if err := m.runSnapshot(library, Filter{}, dest); err != nil {
+		t.Fatalf("second snapshot: %v", err)
+	}
+
+	names, err := listSnapshots(dest)
+	if err != nil || len(names) != 2 {
+		t.Fatalf("listSnapshots = %v, %v; want 2 snapshots", names, err)
+	}
+	first := filepath.Join(dest, names[0], "media")
+	second := filepath.Join(dest, names[1], "media")
+
+	a1, err := os.Stat(filepath.Join(first, "2024", "a.jpg"))
+	if err != nil {
+		t.Fatalf("stat first a.jpg: %v", err)
+	}
+	a2, err := os.Stat(filepath.Join(second, "2024", "a.jpg"))
+	if err != nil {
+		t.Fatalf("stat second a.jpg: %v", err)
+	}
+	if !os.SameFile(a1, a2) {
+		t.Fatal("unchanged file was copied instead of hardlinked")
+	}
+	if body, err := os.ReadFile(filepath.Join(second, "2024", "b.jpg")); err != nil || string(body) != "bravo" {
+		t.Fatalf("new file in second snapshot = %q, %v", body, err)
+	}
+	if _, err := os.Stat(filepath.Join(first, "2024", "b.jpg")); !os.IsNotExist(err) {
+		t.Fatalf("first snapshot changed after the fact: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(second, ".usbvault", "thumbnails")); !os.IsNotExist(err) {
+		t.Fatalf("work area was included in snapshot: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, names[1]+partialSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("partial snapshot left behind: %v", err)
+	}
+}
+
+func TestSnapshotRequiresLocalDestination(t *testing.T) {
+	t.Parallel()
+
+	for _, d := range []string{"user@host:/backups", "relative/dir"} {
+		err := validateDestination(Destination{Mode: "snapshot", Destination: d})
+		if err == nil {
+			t.Errorf("validateDestination(%q) succeeded, want error", d)
+		}
+	}
+	if err := validateDestination(Destination{Mode: "snapshot", Destination: filepath.Join(t.TempDir(), "snaps")}); err != nil {
+		t.Fatalf("validateDestination(local): %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/sftp"
+)
+
+// SSHSettingKey holds the SSHSettings used for ssh destinations. The key
+// and known_hosts themselves are files in the data dir.
+const SSHSettingKey = "backup_ssh"
+
+type SSHSettings struct {
+	// AcceptNewHostKeys trusts a host on first contact and records its key;
+	// otherwise it must already be in known_hosts.
+	AcceptNewHostKeys bool `json:"accept_new_host_keys"`
+}
+
+// LoadSSHSettings returns the stored ssh options.
+func LoadSSHSettings(ctx context.Context, settings interface {
+	GetSetting(context.Context, string) (string, bool, error)
+}) (SSHSettings, error) {
+	var s SSHSettings
+	raw, ok, err := settings.GetSetting(ctx, SSHSettingKey)
+	if err != nil || !ok || raw == "" {
+		return s, err
+	}
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return s, fmt.Errorf("stored ssh settings: %w", err)
+	}
+	return s, nil
+}
+
+func (m *Manager) sshDial(ctx context.Context, host string, port int) (*sftp.Client, error) {
+	settings, err := LoadSSHSettings(ctx, m.store)
+	if err != nil {
+		return nil, err
+	}
+	target, err := sftp.ParseTarget(host, port)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	return sftp.Dial(ctx, sftp.Config{
+		KeyFile:           config.BackupSSHKeyPath(),
+		KnownHostsFile:    config.BackupKnownHostsPath(),
+		AcceptNewHostKeys: settings.AcceptNewHostKeys,
+	}, target)
+}
+
+// sendViaSSH uploads the archive over SFTP. It is written as <name>.partial
+// and renamed when complete, so an interrupted run never leaves a truncated
+// archive under the real name. progress gets the bytes the server has
+// acknowledged so far.
+func (m *Manager) sendViaSSH(ctx context.Context, r io.Reader, dest Destination, progress func(int64)) error {
+	host, remotePath, err := splitSSHDestination(dest.Destination)
+	if err != nil {
+		return err
+	}
+	client, err := m.sshDial(ctx, host, dest.SSHPort)
+	if err != nil {
+		return fmt.Errorf("ssh upload failed: %w", err)
+	}
+	defer client.Close()
+
+	if dir := path.Dir(remotePath); dir != "." {
+		if err := client.MkdirAll(dir); err != nil {
+			return fmt.Errorf("ssh upload failed: %w", err)
+		}
+	}
+	partial := remotePath + ".partial"
+	f, err := client.Create(partial)
+	if err != nil {
+		return fmt.Errorf("ssh upload failed: %w", err)
+	}
+	f.Progress = progress
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = client.Rename(partial, remotePath)
+	}
+	if err != nil {
+		_ = client.Remove(partial)
+		return fmt.Errorf("ssh upload failed: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) openSSH(ctx context.Context, dest Destination) (io.ReadCloser, error) {
+	host, remotePath, err := splitSSHDestination(dest.Destination)
+	if err != nil {
+		return nil, err
+	}
+	client, err := m.sshDial(ctx, host, dest.SSHPort)
+	if err != nil {
+		return nil, fmt.Errorf("ssh download failed: %w", err)
+	}
+	f, err := client.Open(remotePath)
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("ssh download failed: %w", err)
+	}
+	return &sftpReader{File: f, client: client}, nil
+}
+
+type sftpReader struct {
+	*sftp.File
+	client *sftp.Client
+}
+
+func (r *sftpReader) Close() error {
+	return errors.Join(r.File.Close(), r.client.Close())
+}
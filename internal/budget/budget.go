@@ -0,0 +1,91 @@
+// Package budget holds the resource limits that let the same binary behave
+// on a Pi 4 and on a many-core desktop: how many background jobs run at
+// once, how many threads hash files and decode images, and the I/O priority
+// the vault's disk traffic gets against other programs.
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// SettingKey stores a Budget as JSON.
+const SettingKey = "resource_budget"
+
+// I/O priority classes. Low and idle only differ from normal when other
+// programs compete for the same disk.
+const (
+	IONormal = "normal"
+	IOLow    = "low"  // lowest best-effort level
+	IOIdle   = "idle" // only disk time no one else wants
+)
+
+const (
+	maxJobsLimit    = 16
+	maxThreadsLimit = 64
+)
+
+// ErrUnsupported is returned by SetIOPriority where the platform has no I/O
+// priority the vault can set.
+var ErrUnsupported = errors.New("I/O priority is not supported on this platform")
+
+type Budget struct {
+	MaxJobs     int    `json:"max_jobs"`     // scheduled background jobs at once
+	HashThreads int    `json:"hash_threads"` // ingest hashing and thumbnail rendering
+	IOPriority  string `json:"io_priority"`
+}
+
+// Default suits the machine it runs on: one background job and two threads
+// on a Pi 4, more on a desktop with cores to spare.
+func Default() Budget {
+	cpus := runtime.NumCPU()
+	return Budget{
+		MaxJobs:     max(1, min(4, cpus/4)),
+		HashThreads: max(1, min(8, cpus/2)),
+		IOPriority:  IONormal,
+	}
+}
+
+// Parse reads a Budget as stored under SettingKey. Zero fields stand for
+// the default of whatever machine the library is attached to, so they are
+// stored as zero and only filled in by Normalize.
+func Parse(raw string) (Budget, error) {
+	var b Budget
+	if strings.TrimSpace(raw) == "" {
+		return b, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &b); err != nil {
+		return Budget{}, err
+	}
+	return b, nil
+}
+
+// Normalize fills in defaults and checks ranges.
+func (b Budget) Normalize() (Budget, error) {
+	def := Default()
+	if b.MaxJobs == 0 {
+		b.MaxJobs = def.MaxJobs
+	}
+	if b.HashThreads == 0 {
+		b.HashThreads = def.HashThreads
+	}
+	b.IOPriority = strings.ToLower(strings.TrimSpace(b.IOPriority))
+	if b.IOPriority == "" {
+		b.IOPriority = def.IOPriority
+	}
+	if b.MaxJobs < 1 || b.MaxJobs > maxJobsLimit {
+		return Budget{}, fmt.Errorf("max_jobs must be between 1 and %d", maxJobsLimit)
+	}
+	if b.HashThreads < 1 || b.HashThreads > maxThreadsLimit {
+		return Budget{}, fmt.Errorf("hash_threads must be between 1 and %d", maxThreadsLimit)
+	}
+	switch b.IOPriority {
+	case IONormal, IOLow, IOIdle:
+	default:
+		return Budget{}, fmt.Errorf("io_priority must be %s, %s, or %s", IONormal, IOLow, IOIdle)
+	}
+	return b, nil
+}
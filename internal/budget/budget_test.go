@@ -0,0 +1,62 @@
+package budget
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNormalizeFillsDefaultsAndChecksRanges(t *testing.T) {
+	def := Default()
+	b, err := Budget{IOPriority: " Idle "}.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.MaxJobs != def.MaxJobs || b.HashThreads != def.HashThreads || b.IOPriority != IOIdle {
+		t.Fatalf("Normalize = %+v, want defaults with idle I/O", b)
+	}
+	for _, bad := range []Budget{{MaxJobs: -1}, {MaxJobs: 17}, {HashThreads: 65}, {IOPriority: "realtime"}} {
+		if _, err := bad.Normalize(); err == nil {
+			t.Errorf("Normalize(%+v) accepted", bad)
+		}
+	}
+}
+
+func TestParseKeepsZeroFields(t *testing.T) {
+	b, err := Parse(`{"hash_threads": 3}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != (Budget{HashThreads: 3}) {
+		t.Fatalf("Parse = %+v", b)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(1)
+	ctx := context.Background()
+	if err := l.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := l.Acquire(short); err == nil {
+		t.Fatal("second Acquire succeeded past the limit")
+	}
+
+	got := make(chan struct{})
+	go func() {
+		if l.Acquire(ctx) == nil {
+			close(got)
+		}
+	}()
+	l.SetLimit(2)
+	select {
+	case <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("raising the limit did not admit a waiter")
+	}
+	l.Release()
+	l.Release()
+}
@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package budget
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// ioprio_set(2) values.
+const (
+	ioprioWhoProcess = 1
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// SetIOPriority sets the I/O priority of every thread of the vault. Linux
+// keeps it per thread; threads started later inherit it, and so do child
+// processes such as rsync and ssh.
+func SetIOPriority(class string) error {
+	prio := 0 // no class: the kernel derives it from the nice value
+	switch class {
+	case IOLow:
+		prio = ioprioClassBE<<ioprioClassShift | 7
+	case IOIdle:
+		prio = ioprioClassIdle << ioprioClassShift
+	}
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, t := range tasks {
+		tid, err := strconv.Atoi(t.Name())
+		if err != nil {
+			continue
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio)); errno != 0 && errno != syscall.ESRCH && firstErr == nil {
+			firstErr = errno
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package budget
+
+// SetIOPriority is only implemented on Linux. Normal priority is what every
+// platform runs at already, so asking for it is not an error.
+func SetIOPriority(class string) error {
+	if class == IONormal {
+		return nil
+	}
+	return ErrUnsupported
+}
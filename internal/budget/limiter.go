@@ -0,0 +1,64 @@
+package budget
+
+import (
+	"context"
+	"sync"
+)
+
+// Limiter bounds how many holders run at once. Unlike a buffered channel
+// its limit can change while it is in use; lowering it lets current holders
+// finish and admits no one new until they are under the new limit.
+type Limiter struct {
+	mu    sync.Mutex
+	limit int
+	inUse int
+	wake  chan struct{} // closed when a slot may have opened
+}
+
+func NewLimiter(limit int) *Limiter {
+	return &Limiter{limit: max(1, limit)}
+}
+
+func (l *Limiter) SetLimit(limit int) {
+	l.mu.Lock()
+	l.limit = max(1, limit)
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+// Acquire waits for a slot or for ctx to end.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inUse < l.limit {
+			l.inUse++
+			l.mu.Unlock()
+			return nil
+		}
+		if l.wake == nil {
+			l.wake = make(chan struct{})
+		}
+		wake := l.wake
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	l.inUse--
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+// broadcast wakes every waiter to retry. Callers hold l.mu.
+func (l *Limiter) broadcast() {
+	if l.wake != nil {
+		close(l.wake)
+		l.wake = nil
+	}
+}
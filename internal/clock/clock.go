@@ -0,0 +1,104 @@
+// Package clock tells whether the system clock can be trusted for
+// timestamps. A Pi has no battery-backed clock: after losing power it boots
+// at 1970, or at whatever time fake-hwclock last saved, until NTP sets it.
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Floor is the earliest believable time; a clock before it has not been set.
+var Floor = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// backstepSlack tolerates the small corrections NTP makes, so a clock a few
+// seconds behind the last recorded timestamp is not flagged.
+const backstepSlack = 5 * time.Minute
+
+// Monitor remembers the latest trusted time seen, from the clock itself and
+// from timestamps already on record. A clock that reads earlier than that
+// high-water mark has been reset and is not trusted until it catches up.
+type Monitor struct {
+	mu        sync.Mutex
+	highWater time.Time
+	now       func() time.Time
+}
+
+func New() *Monitor {
+	return &Monitor{now: time.Now}
+}
+
+// Observe raises the high-water mark to t, a timestamp already recorded.
+// Times before Floor are ignored.
+func (m *Monitor) Observe(t time.Time) {
+	if t.Before(Floor) {
+		return
+	}
+	m.mu.Lock()
+	if t.After(m.highWater) {
+		m.highWater = t
+	}
+	m.mu.Unlock()
+}
+
+// Now returns the time to record and whether the clock is trusted. An
+// untrusted clock is replaced by the high-water mark (or Floor), so recorded
+// timestamps never run backwards.
+func (m *Monitor) Now() (time.Time, bool) {
+	t := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t.Before(Floor) || t.Before(m.highWater.Add(-backstepSlack)) {
+		if m.highWater.IsZero() {
+			return Floor, false
+		}
+		return m.highWater, false
+	}
+	if t.After(m.highWater) {
+		m.highWater = t
+	}
+	return t, true
+}
+
+func (m *Monitor) Trusted() bool {
+	_, ok := m.Now()
+	return ok
+}
+
+// Status describes the clock for status endpoints.
+func (m *Monitor) Status() map[string]any {
+	now := m.now()
+	_, ok := m.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var highWater string
+	if !m.highWater.IsZero() {
+		highWater = m.highWater.UTC().Format(time.RFC3339)
+	}
+	return map[string]any{
+		"trusted":     ok,
+		"system_time": now.UTC().Format(time.RFC3339),
+		"last_known":  highWater,
+	}
+}
+
+// WaitTrusted blocks until the clock is trusted, ctx ends, or maxWait has
+// passed, and reports whether it is trusted. maxWait is measured on the
+// monotonic clock, so the wall clock being set does not cut it short.
+func (m *Monitor) WaitTrusted(ctx context.Context, poll, maxWait time.Duration) bool {
+	deadline := time.Now().Add(maxWait)
+	for {
+		if m.Trusted() {
+			return true
+		}
+		if time.Until(deadline) <= 0 {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(min(poll, time.Until(deadline))):
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonitorNow(t *testing.T) {
+	m := New()
+	wall := time.Date(1970, 1, 1, 0, 1, 0, 0, time.UTC)
+	m.now = func() time.Time { return wall }
+
+	if got, ok := m.Now(); ok || !got.Equal(Floor) {
+		t.Fatalf("unset clock: Now() = %v, %v; want Floor, false", got, ok)
+	}
+
+	last := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	m.Observe(last)
+	if got, ok := m.Now(); ok || !got.Equal(last) {
+		t.Fatalf("unset clock with history: Now() = %v, %v; want %v, false", got, ok, last)
+	}
+
+	// fake-hwclock restores a plausible but stale time.
+	wall = last.Add(-24 * time.Hour)
+	if _, ok := m.Now(); ok {
+		t.Fatal("clock a day behind the last record is trusted")
+	}
+
+	wall = last.Add(-time.Minute)
+	if _, ok := m.Now(); !ok {
+		t.Fatal("small NTP correction is not trusted")
+	}
+
+	wall = last.Add(time.Hour)
+	if got, ok := m.Now(); !ok || !got.Equal(wall) {
+		t.Fatalf("synced clock: Now() = %v, %v; want %v, true", got, ok, wall)
+	}
+	wall = last
+	if _, ok := m.Now(); ok {
+		t.Fatal("trusted reading did not raise the high-water mark")
+	}
+}
@@ -0,0 +1,298 @@
+// Package cloudsync copies library media to cloud storage, one way, the way
+// rclone copy would: each rule picks media by kind, album, place and
+// capture date and names the provider they go to, such as "images from
+// Colorado to the offsite bucket". Every upload is recorded per file and provider, so a file is
+// sent once, and again only when its content changes. Nothing is ever
+// deleted at the provider.
+package cloudsync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/publish"
+)
+
+// SettingKey holds the Config.
+const SettingKey = "cloud_sync_config"
+
+// Provider is somewhere media are uploaded to.
+//
+// Kind "s3" takes an s3://bucket/folder destination and the S3 backup
+// credentials. Kind "webdav" takes a folder URL, with Secret sent as a
+// password when Username is set and as a bearer token otherwise. Kind
+// "drive" takes the id of a Google Drive folder, an OAuth client in
+// ClientID and ClientSecret, and a refresh token for it in Secret.
+type Provider struct {
+	Name         string `json:"name"`
+	Kind         string `json:"kind"`
+	Destination  string `json:"destination"`
+	Username     string `json:"username,omitempty"`
+	Secret       string `json:"secret,omitempty"`
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	// SecretSet is only sent to clients, in place of the secrets.
+	SecretSet bool `json:"secret_set,omitempty"`
+}
+
+// Rule sends the media it matches to Provider. Each list matches any of
+// its entries, and an empty one matches everything; a medium must match
+// every list and fall between From and To.
+type Rule struct {
+	Name     string   `json:"name"`
+	Provider string   `json:"provider"`
+	Kinds    []string `json:"kinds,omitempty"`  // image, video
+	Albums   []int64  `json:"albums,omitempty"` // smart albums included
+	Places   []Place  `json:"places,omitempty"`
+	// From and To bound the capture time, as RFC 3339 or a date; a date
+	// in To includes that whole day.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// Kind and State are the single values rules were first saved with.
+	// Normalize moves them into Kinds and Places.
+	Kind  string `json:"kind,omitempty"`
+	State string `json:"state,omitempty"`
+}
+
+// Place is a state, or a county within it. Both match as the library
+// filters of the same names do, so "unknown" picks media without one.
+type Place struct {
+	State  string `json:"state"`
+	County string `json:"county,omitempty"`
+}
+
+// maxRuleFilters bounds how many library filters one rule expands to.
+const maxRuleFilters = 500
+
+// Filters are the media filters the rule stands for; it matches what any
+// of them matches.
+func (r Rule) Filters() []db.MediaFilter {
+	base := db.MediaFilter{Kind: r.Kind, State: r.State}
+	base.CaptureFrom, _ = normalizeTime(r.From, false)
+	base.CaptureTo, _ = normalizeTime(r.To, true)
+	out := []db.MediaFilter{base}
+	expand := func(n int, set func(f *db.MediaFilter, i int)) {
+		if n == 0 {
+			return
+		}
+		next := make([]db.MediaFilter, 0, len(out)*n)
+		for _, f := range out {
+			for i := range n {
+				g := f
+				set(&g, i)
+				next = append(next, g)
+			}
+		}
+		out = next
+	}
+	expand(len(r.Kinds), func(f *db.MediaFilter, i int) { f.Kind = r.Kinds[i] })
+	expand(len(r.Albums), func(f *db.MediaFilter, i int) { f.AlbumID = r.Albums[i] })
+	expand(len(r.Places), func(f *db.MediaFilter, i int) { f.State, f.County = r.Places[i].State, r.Places[i].County })
+	return out
+}
+
+// Config is the stored cloud sync configuration. Nothing is uploaded
+// unless Enabled is set.
+type Config struct {
+	Enabled   bool       `json:"enabled"`
+	Providers []Provider `json:"providers"`
+	Rules     []Rule     `json:"rules"`
+}
+
+// Parse reads a stored configuration. An empty one is disabled.
+func Parse(raw string) (Config, error) {
+	cfg := Config{Providers: []Provider{}, Rules: []Rule{}}
+	if strings.TrimSpace(raw) == "" {
+		return cfg, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return cfg, fmt.Errorf("cloud sync config: %w", err)
+	}
+	if cfg.Providers == nil {
+		cfg.Providers = []Provider{}
+	}
+	if cfg.Rules == nil {
+		cfg.Rules = []Rule{}
+	}
+	return cfg, nil
+}
+
+// Normalize trims the configuration and reports the first thing wrong
+// with it.
+func (c *Config) Normalize() error {
+	names := make(map[string]struct{}, len(c.Providers))
+	for i := range c.Providers {
+		p := &c.Providers[i]
+		p.Name = strings.TrimSpace(p.Name)
+		p.Kind = strings.ToLower(strings.TrimSpace(p.Kind))
+		p.Destination = strings.TrimSpace(p.Destination)
+		p.Username = strings.TrimSpace(p.Username)
+		p.ClientID = strings.TrimSpace(p.ClientID)
+		p.SecretSet = false
+		if p.Name == "" {
+			return errors.New("every provider needs a name")
+		}
+		if _, dup := names[p.Name]; dup {
+			return fmt.Errorf("provider %q is listed twice", p.Name)
+		}
+		names[p.Name] = struct{}{}
+		var err error
+		switch p.Kind {
+		case "s3":
+			_, _, err = publish.ParseS3(p.Destination)
+			if err == nil && (p.Username != "" || p.Secret != "") {
+				err = errors.New("s3 providers use the S3 backup credentials; leave username and secret empty")
+			}
+		case "webdav":
+			_, err = publish.ParseWebDAV(p.Destination)
+		case "drive":
+			if p.Destination == "" || p.ClientID == "" {
+				err = errors.New("drive providers need the destination folder id and client_id")
+			}
+		default:
+			err = errors.New("kind must be s3, webdav or drive")
+		}
+		if err != nil {
+			return fmt.Errorf("provider %q: %w", p.Name, err)
+		}
+	}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if err := r.normalize(i, names); err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) normalize(i int, providers map[string]struct{}) error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Provider = strings.TrimSpace(r.Provider)
+	if r.Name == "" {
+		r.Name = fmt.Sprintf("rule %d", i+1)
+	}
+	if _, ok := providers[r.Provider]; !ok {
+		return fmt.Errorf("unknown provider %q", r.Provider)
+	}
+	if kind := strings.TrimSpace(r.Kind); kind != "" {
+		r.Kinds = append(r.Kinds, kind)
+	}
+	if state := strings.TrimSpace(r.State); state != "" {
+		r.Places = append(r.Places, Place{State: state})
+	}
+	r.Kind, r.State = "", ""
+
+	kinds := make([]string, 0, len(r.Kinds))
+	for _, k := range r.Kinds {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k != "image" && k != "video" {
+			return errors.New("kinds must be image or video")
+		}
+		if !slices.Contains(kinds, k) {
+			kinds = append(kinds, k)
+		}
+	}
+	r.Kinds = kinds
+	for _, id := range r.Albums {
+		if id <= 0 {
+			return errors.New("albums must be album ids")
+		}
+	}
+	slices.Sort(r.Albums)
+	r.Albums = slices.Compact(r.Albums)
+	places := make([]Place, 0, len(r.Places))
+	for _, p := range r.Places {
+		p.State, p.County = strings.TrimSpace(p.State), strings.TrimSpace(p.County)
+		if p.State == "" {
+			return errors.New("every place needs a state")
+		}
+		if !slices.Contains(places, p) {
+			places = append(places, p)
+		}
+	}
+	r.Places = places
+
+	r.From, r.To = strings.TrimSpace(r.From), strings.TrimSpace(r.To)
+	from, err := normalizeTime(r.From, false)
+	if err != nil {
+		return errors.New("from must be RFC 3339 or YYYY-MM-DD")
+	}
+	to, err := normalizeTime(r.To, true)
+	if err != nil {
+		return errors.New("to must be RFC 3339 or YYYY-MM-DD")
+	}
+	if from != "" && to != "" && from > to {
+		return errors.New("from must be before to")
+	}
+	if n := max(len(r.Kinds), 1) * max(len(r.Albums), 1) * max(len(r.Places), 1); n > maxRuleFilters {
+		return fmt.Errorf("%d kind, album and place combinations; split the rule to stay under %d", n, maxRuleFilters)
+	}
+	return nil
+}
+
+// normalizeTime turns a rule's RFC 3339 time or date into the form capture
+// times are stored in. A date is the start of the day, or its end when
+// endOfDay is set.
+func normalizeTime(raw string, endOfDay bool) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.UTC().Format(time.RFC3339), nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return "", err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// KeepSecrets fills in the secrets left out of c from the provider of the
+// same name in old, so clients can save the configuration they were sent.
+func (c *Config) KeepSecrets(old Config) {
+	for i := range c.Providers {
+		p := &c.Providers[i]
+		prev, ok := old.provider(p.Name)
+		if !ok || prev.Kind != p.Kind {
+			continue
+		}
+		if p.Secret == "" {
+			p.Secret = prev.Secret
+		}
+		if p.ClientSecret == "" {
+			p.ClientSecret = prev.ClientSecret
+		}
+	}
+}
+
+// Redacted is the configuration as sent to clients: secrets are replaced
+// by SecretSet.
+func (c Config) Redacted() Config {
+	out := c
+	out.Providers = make([]Provider, len(c.Providers))
+	for i, p := range c.Providers {
+		p.SecretSet = p.Secret != "" || p.ClientSecret != ""
+		p.Secret, p.ClientSecret = "", ""
+		out.Providers[i] = p
+	}
+	return out
+}
+
+func (c Config) provider(name string) (Provider, bool) {
+	for _, p := range c.Providers {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Provider{}, false
+}
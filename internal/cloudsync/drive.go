@@ -0,0 +1,341 @@
+package cloudsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"businessplan/usbvault/internal/publish"
+)
+
+// Google Drive endpoints; tests point them at a fake server.
+var (
+	driveTokenURL  = "https://oauth2.googleapis.com/token"
+	driveAPIURL    = "https://www.googleapis.com/drive/v3/files"
+	driveUploadURL = "https://www.googleapis.com/upload/drive/v3/files"
+)
+
+const driveFolderType = "application/vnd.google-apps.folder"
+
+// Files up to driveSimpleMax go up in one request. Larger ones go through
+// a resumable session, driveChunkSize at a time, so a dropped connection
+// costs a chunk rather than the file. Drive wants chunks in multiples of
+// 256 KiB.
+var (
+	driveSimpleMax int64 = 5 << 20
+	driveChunkSize int64 = 8 << 20
+)
+
+type driveTarget struct {
+	root                                 string
+	clientID, clientSecret, refreshToken string
+	client                               *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	folders map[string]string // slash path below root -> folder id
+}
+
+// NewDrive uploads below the Google Drive folder with id folderID. Access
+// tokens are taken from refreshToken as needed. Drive allows several files
+// of one name in a folder, so a file already there is replaced rather
+// than added again.
+func NewDrive(folderID, clientID, clientSecret, refreshToken string, client *http.Client) publish.Target {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &driveTarget{
+		root: folderID, clientID: clientID, clientSecret: clientSecret, refreshToken: refreshToken,
+		client: client, folders: map[string]string{},
+	}
+}
+
+func (t *driveTarget) accessToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.refreshToken},
+		"client_id":     {t.clientID},
+		"client_secret": {t.clientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, driveTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := t.send(req, &out); err != nil {
+		return "", fmt.Errorf("drive token: %w", err)
+	}
+	if out.AccessToken == "" {
+		return "", fmt.Errorf("drive token: no access token in the response")
+	}
+	t.token = out.AccessToken
+	// Renew a minute early so a token does not run out mid-upload.
+	t.expires = time.Now().Add(time.Duration(out.ExpiresIn)*time.Second - time.Minute)
+	return t.token, nil
+}
+
+// send does req and decodes a JSON answer into out, when set.
+func (t *driveTarget) send(req *http.Request, out any) error {
+	resp, err := t.call(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// call does req and returns the response when it succeeded, or when Drive
+// answered 308 Resume Incomplete to a chunk of an upload.
+func (t *driveTarget) call(req *http.Request) (*http.Response, error) {
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusPermanentRedirect {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+func (t *driveTarget) do(ctx context.Context, method, rawURL, contentType string, body io.Reader, out any) error {
+	token, err := t.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return t.send(req, out)
+}
+
+// find returns the id of the item called name in the folder parent, or ""
+// when there is none.
+func (t *driveTarget) find(ctx context.Context, parent, name string, folder bool) (string, error) {
+	esc := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	q := fmt.Sprintf("name = '%s' and '%s' in parents and trashed = false", esc.Replace(name), esc.Replace(parent))
+	if folder {
+		q += " and mimeType = '" + driveFolderType + "'"
+	}
+	var out struct {
+		Files []struct {
+			ID string `json:"id"`
+		} `json:"files"`
+	}
+	query := url.Values{"q": {q}, "fields": {"files(id)"}, "pageSize": {"1"}}
+	if err := t.do(ctx, http.MethodGet, driveAPIURL+"?"+query.Encode(), "", nil, &out); err != nil {
+		return "", err
+	}
+	if len(out.Files) == 0 {
+		return "", nil
+	}
+	return out.Files[0].ID, nil
+}
+
+// folder returns the id of the folder dir below the root, creating the
+// folders on the way as needed.
+func (t *driveTarget) folder(ctx context.Context, dir string) (string, error) {
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		return t.root, nil
+	}
+	t.mu.Lock()
+	id, ok := t.folders[dir]
+	t.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	parentDir, name := path.Split(dir)
+	parent, err := t.folder(ctx, parentDir)
+	if err != nil {
+		return "", err
+	}
+	if id, err = t.find(ctx, parent, name, true); err != nil {
+		return "", err
+	}
+	if id == "" {
+		meta, _ := json.Marshal(map[string]any{"name": name, "mimeType": driveFolderType, "parents": []string{parent}})
+		var out struct {
+			ID string `json:"id"`
+		}
+		if err := t.do(ctx, http.MethodPost, driveAPIURL, "application/json", bytes.NewReader(meta), &out); err != nil {
+			return "", err
+		}
+		id = out.ID
+	}
+	t.mu.Lock()
+	t.folders[dir] = id
+	t.mu.Unlock()
+	return id, nil
+}
+
+func (t *driveTarget) Put(ctx context.Context, name, contentType string, body io.ReadSeeker) error {
+	dir, file := path.Split(name)
+	parent, err := t.folder(ctx, dir)
+	if err != nil {
+		return err
+	}
+	existing, err := t.find(ctx, parent, file, false)
+	if err != nil {
+		return err
+	}
+	size, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if size > driveSimpleMax {
+		return t.putResumable(ctx, parent, file, existing, contentType, body, size)
+	}
+	if existing != "" {
+		return t.do(ctx, http.MethodPatch, driveUploadURL+"/"+url.PathEscape(existing)+"?uploadType=media", contentType, body, nil)
+	}
+
+	// A multipart/related upload carries the metadata and the content in
+	// one request.
+	meta, _ := json.Marshal(map[string]any{"name": file, "parents": []string{parent}})
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	head := fmt.Sprintf("--%s\r\nContent-Type: application/json; charset=UTF-8\r\n\r\n%s\r\n--%s\r\nContent-Type: %s\r\n\r\n",
+		boundary, meta, boundary, contentType)
+	tail := fmt.Sprintf("\r\n--%s--\r\n", boundary)
+	upload := io.MultiReader(strings.NewReader(head), body, strings.NewReader(tail))
+	return t.do(ctx, http.MethodPost, driveUploadURL+"?uploadType=multipart", "multipart/related; boundary="+boundary, upload, nil)
+}
+
+// putResumable uploads a large file through a resumable session: one
+// request opens it with the metadata, then the content follows in chunks.
+// After each chunk Drive says how much it holds, and the next chunk starts
+// from there.
+func (t *driveTarget) putResumable(ctx context.Context, parent, file, existing, contentType string, body io.ReadSeeker, size int64) error {
+	method, start := http.MethodPost, driveUploadURL+"?uploadType=resumable"
+	meta := map[string]any{"name": file, "parents": []string{parent}}
+	if existing != "" {
+		method, start = http.MethodPatch, driveUploadURL+"/"+url.PathEscape(existing)+"?uploadType=resumable"
+		meta = map[string]any{}
+	}
+	metaJSON, _ := json.Marshal(meta)
+	token, err := t.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, start, bytes.NewReader(metaJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Type", contentType)
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	resp, err := t.call(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return fmt.Errorf("drive upload of %s: no session in the response", file)
+	}
+
+	var offset int64
+	for stalled := 0; stalled < 3; {
+		n := min(driveChunkSize, size-offset)
+		if _, err := body.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		resp, err := t.putChunk(ctx, session, io.LimitReader(body, n), n, fmt.Sprintf("bytes %d-%d/%d", offset, offset+n-1, size))
+		if err != nil && ctx.Err() == nil {
+			// Ask how much arrived and go on from there.
+			resp, err = t.putChunk(ctx, session, nil, 0, fmt.Sprintf("bytes */%d", size))
+		}
+		if err != nil {
+			return fmt.Errorf("drive upload of %s at byte %d: %w", file, offset, err)
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusPermanentRedirect {
+			return nil
+		}
+		// Range is "bytes=0-N" once Drive holds anything.
+		var held int64
+		if r := resp.Header.Get("Range"); r != "" {
+			_, last, _ := strings.Cut(r, "-")
+			if held, err = strconv.ParseInt(last, 10, 64); err != nil {
+				return fmt.Errorf("drive upload of %s: bad range %q", file, r)
+			}
+			held++
+		}
+		if held >= size {
+			return fmt.Errorf("drive upload of %s: incomplete after every byte was sent", file)
+		}
+		if held <= offset {
+			stalled++
+		} else {
+			stalled = 0
+		}
+		offset = held
+	}
+	return fmt.Errorf("drive upload of %s: no progress at byte %d", file, offset)
+}
+
+// putChunk sends n bytes of an upload to its session. With no body it asks
+// how much the session holds.
+func (t *driveTarget) putChunk(ctx context.Context, session string, body io.Reader, n int64, contentRange string) (*http.Response, error) {
+	token, err := t.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, session, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = n
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Range", contentRange)
+	return t.call(req)
+}
+
+// Delete removes a file; one that is already gone is not an error.
+func (t *driveTarget) Delete(ctx context.Context, name string) error {
+	dir, file := path.Split(name)
+	parent, err := t.folder(ctx, dir)
+	if err != nil {
+		return err
+	}
+	id, err := t.find(ctx, parent, file, false)
+	if err != nil || id == "" {
+		return err
+	}
+	return t.do(ctx, http.MethodDelete, driveAPIURL+"/"+url.PathEscape(id), "", nil, nil)
+}
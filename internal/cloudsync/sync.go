@@ -0,0 +1,241 @@
+package cloudsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"businessplan/usbvault/internal/backup"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/publish"
+	"businessplan/usbvault/internal/s3"
+)
+
+const (
+	pageSize = 100
+	// MaxAttempts is how often a file is tried before it waits for its
+	// content or the configuration to change.
+	MaxAttempts = 5
+)
+
+var ErrBusy = errors.New("cloud sync already running")
+
+// Opener opens the library file of a record, decrypted.
+type Opener func(ctx context.Context, rec db.MediaRecord) (io.ReadSeekCloser, error)
+
+// Status is the progress of the running pass, or the outcome of the last
+// one.
+type Status struct {
+	State        string `json:"state"` // idle, running, success, error, stopped
+	LastStarted  string `json:"last_started,omitempty"`
+	LastFinished string `json:"last_finished,omitempty"`
+	Rule         string `json:"rule,omitempty"` // the rule being worked through
+	Uploaded     int    `json:"uploaded"`
+	Bytes        int64  `json:"bytes"`
+	Failed       int    `json:"failed"`
+	Message      string `json:"message,omitempty"`
+}
+
+// Syncer uploads what the rules match.
+type Syncer struct {
+	store  *db.Store
+	logger *log.Logger
+	open   Opener
+	name   func(db.MediaRecord) string
+
+	// target opens a provider; tests replace it.
+	target func(ctx context.Context, p Provider) (publish.Target, error)
+
+	runMu  sync.Mutex
+	mu     sync.Mutex
+	status Status
+}
+
+// New returns a syncer that reads files with open and uploads each under
+// the slash path name gives it.
+func New(store *db.Store, logger *log.Logger, open Opener, name func(db.MediaRecord) string) *Syncer {
+	s := &Syncer{store: store, logger: logger, open: open, name: name, status: Status{State: "idle"}}
+	s.target = s.openTarget
+	return s
+}
+
+func (s *Syncer) GetStatus() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Load reads the stored configuration.
+func (s *Syncer) Load(ctx context.Context) (Config, error) {
+	raw, _, err := s.store.GetSetting(ctx, SettingKey)
+	if err != nil {
+		return Config{}, err
+	}
+	return Parse(raw)
+}
+
+// openTarget connects to a provider.
+func (s *Syncer) openTarget(ctx context.Context, p Provider) (publish.Target, error) {
+	client := &http.Client{Timeout: 30 * time.Minute}
+	switch p.Kind {
+	case "s3":
+		bucket, prefix, err := publish.ParseS3(p.Destination)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := backup.LoadS3Config(ctx, s.store)
+		if err != nil {
+			return nil, err
+		}
+		c, err := s3.New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return publish.NewS3(c, bucket, prefix), nil
+	case "webdav":
+		return publish.NewWebDAV(p.Destination, p.Username, p.Secret, client)
+	case "drive":
+		return NewDrive(p.Destination, p.ClientID, p.ClientSecret, p.Secret, client), nil
+	}
+	return nil, fmt.Errorf("unknown provider kind %q", p.Kind)
+}
+
+// RunOnce uploads everything the stored rules match that has not reached
+// its provider yet. A file that fails is recorded and the pass goes on; a
+// provider that cannot be reached ends that rule for this pass.
+func (s *Syncer) RunOnce(ctx context.Context) error {
+	if !s.runMu.TryLock() {
+		return ErrBusy
+	}
+	defer s.runMu.Unlock()
+
+	cfg, err := s.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if !cfg.Enabled || len(cfg.Rules) == 0 {
+		return nil
+	}
+	if err := cfg.Normalize(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.status = Status{State: "running", LastStarted: time.Now().UTC().Format(time.RFC3339)}
+	s.mu.Unlock()
+
+	targets := map[string]publish.Target{}
+	var errs []error
+	for _, rule := range cfg.Rules {
+		if ctx.Err() != nil {
+			break
+		}
+		p, _ := cfg.provider(rule.Provider)
+		t, ok := targets[p.Name]
+		if !ok {
+			if t, err = s.target(ctx, p); err != nil {
+				errs = append(errs, fmt.Errorf("provider %q: %w", p.Name, err))
+				continue
+			}
+			targets[p.Name] = t
+		}
+		if err := s.syncRule(ctx, rule, t); err != nil {
+			errs = append(errs, fmt.Errorf("rule %q: %w", rule.Name, err))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := &s.status
+	st.Rule = ""
+	st.LastFinished = time.Now().UTC().Format(time.RFC3339)
+	err = errors.Join(errs...)
+	switch {
+	case ctx.Err() != nil:
+		st.State, st.Message = "stopped", "Stopped before every rule was done."
+	case err != nil:
+		st.State, st.Message = "error", err.Error()
+	default:
+		st.State = "success"
+		st.Message = fmt.Sprintf("%d uploaded, %d failed.", st.Uploaded, st.Failed)
+	}
+	return err
+}
+
+// syncRule uploads the media rule matches that are due at t. Three
+// failures in a row mean the provider is not taking files, and the rule
+// is left for the next pass.
+func (s *Syncer) syncRule(ctx context.Context, rule Rule, t publish.Target) error {
+	s.mu.Lock()
+	s.status.Rule = rule.Name
+	s.mu.Unlock()
+
+	var (
+		after  int64
+		streak int
+	)
+	for {
+		recs, err := s.store.ListCloudSyncPending(ctx, rule.Filters(), rule.Provider, MaxAttempts, after, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(recs) == 0 {
+			return nil
+		}
+		for _, rec := range recs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			after = rec.ID
+			name := s.name(rec)
+			// A library file that cannot be read says nothing about the
+			// provider, so it does not count towards the streak.
+			f, openErr := s.open(ctx, rec)
+			upErr := openErr
+			if openErr == nil {
+				upErr = s.upload(ctx, t, f, name)
+				f.Close()
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := s.store.RecordCloudSync(ctx, rec.ID, rule.Provider, name, rec.SHA256, upErr); err != nil {
+				return err
+			}
+			s.mu.Lock()
+			if upErr != nil {
+				s.status.Failed++
+			} else {
+				s.status.Uploaded++
+				s.status.Bytes += rec.SizeBytes
+			}
+			s.mu.Unlock()
+			if upErr == nil {
+				streak = 0
+				continue
+			}
+			s.logger.Printf("cloud sync %s to %s: %v", rec.DestPath, rule.Provider, upErr)
+			if openErr != nil {
+				continue
+			}
+			if streak++; streak >= 3 {
+				return upErr
+			}
+		}
+	}
+}
+
+func (s *Syncer) upload(ctx context.Context, t publish.Target, body io.ReadSeeker, name string) error {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return t.Put(ctx, name, contentType, body)
+}
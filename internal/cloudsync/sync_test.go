@@ -0,0 +1,388 @@
+package cloudsync
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/publish"
+)
+
+type memTarget struct {
+	mu    sync.Mutex
+	files map[string]string
+	fail  error
+}
+
+func (t *memTarget) Put(ctx context.Context, name, contentType string, body io.ReadSeeker) error {
+	if t.fail != nil {
+		return t.fail
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.files[name] = string(b)
+	return nil
+}
+
+func (t *memTarget) Delete(ctx context.Context, name string) error { return nil }
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
+func TestRunOnce(t *testing.T) {
+	ctx := context.Background()
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	insert := func(n int, kind, state string) db.MediaRecord {
+		t.Helper()
+		rec := db.MediaRecord{
+			Kind: kind, FileName: fmt.Sprintf("%d.jpg", n), Extension: ".jpg",
+			SourceMount: "/Volumes/Test", SourcePath: fmt.Sprintf("/DCIM/%d.jpg", n), DestPath: fmt.Sprintf("/library/%d.jpg", n),
+			SizeBytes: 7, SHA256: fmt.Sprintf("sum%d", n),
+			CaptureTime: "2026-03-01T10:00:00Z", IngestedAt: time.Now().UTC().Format(time.RFC3339),
+			State: sql.NullString{String: state, Valid: state != ""},
+		}
+		if err := store.InsertMedia(ctx, &rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		return rec
+	}
+	colorado := insert(1, "image", "Colorado")
+	insert(2, "image", "Utah")
+	insert(3, "video", "Colorado")
+
+	cfg := Config{
+		Enabled:   true,
+		Providers: []Provider{{Name: "offsite", Kind: "s3", Destination: "s3://bucket/vault"}},
+		Rules:     []Rule{{Name: "colorado images", Provider: "offsite", Kind: "image", State: "colorado"}},
+	}
+	raw, _ := json.Marshal(cfg)
+	if err := store.SetSetting(ctx, SettingKey, string(raw)); err != nil {
+		t.Fatal(err)
+	}
+
+	target := &memTarget{files: map[string]string{}, fail: errors.New("offline")}
+	s := New(store, log.New(io.Discard, "", 0), func(ctx context.Context, rec db.MediaRecord) (io.ReadSeekCloser, error) {
+		return nopCloser{strings.NewReader("media " + rec.SHA256)}, nil
+	}, func(rec db.MediaRecord) string {
+		return "Colorado/" + rec.FileName
+	})
+	s.target = func(ctx context.Context, p Provider) (publish.Target, error) { return target, nil }
+
+	// A failed upload is recorded and tried again on the next pass.
+	if err := s.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if st := s.GetStatus(); st.State != "success" || st.Failed != 1 || st.Uploaded != 0 {
+		t.Fatalf("status = %+v", st)
+	}
+	counts, err := store.CountCloudSync(ctx, cfg.Rules[0].Filters(), "offsite", MaxAttempts)
+	if err != nil || counts.Pending != 1 || counts.Synced != 0 {
+		t.Fatalf("counts = %+v, %v", counts, err)
+	}
+
+	target.fail = nil
+	if err := s.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(target.files) != 1 || target.files["Colorado/1.jpg"] != "media sum1" {
+		t.Fatalf("uploaded = %v", target.files)
+	}
+	counts, err = store.CountCloudSync(ctx, cfg.Rules[0].Filters(), "offsite", MaxAttempts)
+	if err != nil || counts.Pending != 0 || counts.Synced != 1 || counts.SyncedBytes != colorado.SizeBytes {
+		t.Fatalf("counts = %+v, %v", counts, err)
+	}
+
+	// Nothing is sent twice.
+	delete(target.files, "Colorado/1.jpg")
+	if err := s.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if st := s.GetStatus(); st.Uploaded != 0 || len(target.files) != 0 {
+		t.Fatalf("second pass: status %+v, uploaded %v", st, target.files)
+	}
+
+	// A file that keeps failing waits for the configuration to change.
+	insert(4, "image", "Colorado")
+	target.fail = errors.New("quota exceeded")
+	for range MaxAttempts {
+		if err := s.RunOnce(ctx); err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+	}
+	if err := s.RunOnce(ctx); err != nil || s.GetStatus().Failed != 0 {
+		t.Fatalf("gave-up file tried again: %+v, %v", s.GetStatus(), err)
+	}
+	if counts, _ = store.CountCloudSync(ctx, cfg.Rules[0].Filters(), "offsite", MaxAttempts); counts.Failed != 1 || counts.Pending != 0 {
+		t.Fatalf("counts = %+v", counts)
+	}
+	if err := store.ResetCloudSyncFailures(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if counts, _ = store.CountCloudSync(ctx, cfg.Rules[0].Filters(), "offsite", MaxAttempts); counts.Failed != 0 || counts.Pending != 1 {
+		t.Fatalf("counts after reset = %+v", counts)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+	}{
+		{"no name", Config{Providers: []Provider{{Kind: "webdav", Destination: "https://dav.example.com/"}}}},
+		{"bad kind", Config{Providers: []Provider{{Name: "x", Kind: "ftp", Destination: "ftp://x/"}}}},
+		{"s3 secret", Config{Providers: []Provider{{Name: "x", Kind: "s3", Destination: "s3://b/p", Secret: "k"}}}},
+		{"unknown provider", Config{Rules: []Rule{{Provider: "nowhere"}}}},
+		{"bad rule kind", Config{
+			Providers: []Provider{{Name: "x", Kind: "drive", Destination: "folder", ClientID: "id"}},
+			Rules:     []Rule{{Provider: "x", Kind: "audio"}},
+		}},
+	} {
+		if err := tc.cfg.Normalize(); err == nil {
+			t.Errorf("%s: Normalize accepted %+v", tc.name, tc.cfg)
+		}
+	}
+
+	stored := Config{Providers: []Provider{{Name: "nas", Kind: "webdav", Destination: "https://dav.example.com/", Username: "u", Secret: "pw"}}}
+	sent := stored.Redacted()
+	if sent.Providers[0].Secret != "" || !sent.Providers[0].SecretSet {
+		t.Fatalf("redacted = %+v", sent.Providers[0])
+	}
+	if err := sent.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	sent.KeepSecrets(stored)
+	if sent.Providers[0].Secret != "pw" || sent.Providers[0].SecretSet {
+		t.Fatalf("kept = %+v", sent.Providers[0])
+	}
+}
+
+func TestDrivePut(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		folders = map[string]string{} // name -> id
+		uploads []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/token":
+			_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "tok", "expires_in": 3600})
+			return
+		case r.Header.Get("Authorization") != "Bearer tok":
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case r.Method == http.MethodGet && r.URL.Path == "/files":
+			q := r.URL.Query().Get("q")
+			files := []map[string]string{}
+			for name, id := range folders {
+				if strings.Contains(q, "name = '"+name+"'") && strings.Contains(q, "mimeType") {
+					files = append(files, map[string]string{"id": id})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"files": files})
+		case r.Method == http.MethodPost && r.URL.Path == "/files":
+			var meta struct {
+				Name    string   `json:"name"`
+				Parents []string `json:"parents"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&meta)
+			id := "folder-" + meta.Name
+			folders[meta.Name] = id
+			_ = json.NewEncoder(w).Encode(map[string]string{"id": id})
+		case r.Method == http.MethodPost && r.URL.Path == "/upload":
+			body, _ := io.ReadAll(r.Body)
+			uploads = append(uploads, string(body))
+			_, _ = w.Write([]byte(`{"id":"file"}`))
+		default:
+			http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	defer func(token, api, upload string) { driveTokenURL, driveAPIURL, driveUploadURL = token, api, upload }(driveTokenURL, driveAPIURL, driveUploadURL)
+	driveTokenURL, driveAPIURL, driveUploadURL = srv.URL+"/token", srv.URL+"/files", srv.URL+"/upload"
+
+	target := NewDrive("root", "client", "secret", "refresh", srv.Client())
+	for _, name := range []string{"Colorado/2026/a.jpg", "Colorado/2026/b.jpg"} {
+		if err := target.Put(context.Background(), name, "image/jpeg", bytes.NewReader([]byte("jpeg bytes"))); err != nil {
+			t.Fatalf("Put %s: %v", name, err)
+		}
+	}
+	if len(folders) != 2 || folders["Colorado"] == "" || folders["2026"] == "" {
+		t.Fatalf("folders = %v", folders)
+	}
+	if len(uploads) != 2 || !strings.Contains(uploads[0], `"parents":["folder-2026"]`) || !strings.Contains(uploads[0], "jpeg bytes") {
+		t.Fatalf("uploads = %q", uploads)
+	}
+}
+
+func TestDrivePutResumable(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 600<<10/16)
+	var (
+		mu       sync.Mutex
+		received []byte
+		ranges   []string
+		meta     map[string]any
+	)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/token":
+			_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "tok", "expires_in": 3600})
+		case r.Method == http.MethodGet && r.URL.Path == "/files":
+			_, _ = w.Write([]byte(`{"files":[]}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/upload" && r.URL.Query().Get("uploadType") == "resumable":
+			if r.Header.Get("X-Upload-Content-Length") != fmt.Sprint(len(content)) {
+				http.Error(w, "no length", http.StatusBadRequest)
+				return
+			}
+			_ = json.NewDecoder(r.Body).Decode(&meta)
+			w.Header().Set("Location", srv.URL+"/session")
+		case r.Method == http.MethodPut && r.URL.Path == "/session" && strings.HasPrefix(r.Header.Get("Content-Range"), "bytes */"):
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(received)-1))
+			w.WriteHeader(http.StatusPermanentRedirect)
+		case r.Method == http.MethodPut && r.URL.Path == "/session":
+			ranges = append(ranges, r.Header.Get("Content-Range"))
+			if len(ranges) == 3 {
+				// Then a chunk fails outright and has to be sent again.
+				http.Error(w, "backend error", http.StatusServiceUnavailable)
+				return
+			}
+			var start, end, total int
+			if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil || start != len(received) {
+				http.Error(w, "bad range", http.StatusBadRequest)
+				return
+			}
+			chunk, _ := io.ReadAll(r.Body)
+			if len(ranges) == 1 {
+				// The connection drops halfway through the first chunk.
+				chunk = chunk[:len(chunk)/2]
+			}
+			received = append(received, chunk...)
+			if len(received) == total {
+				_, _ = w.Write([]byte(`{"id":"file"}`))
+				return
+			}
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(received)-1))
+			w.WriteHeader(http.StatusPermanentRedirect)
+		default:
+			http.Error(w, "unexpected "+r.Method+" "+r.URL.String(), http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	defer func(token, api, upload string) { driveTokenURL, driveAPIURL, driveUploadURL = token, api, upload }(driveTokenURL, driveAPIURL, driveUploadURL)
+	driveTokenURL, driveAPIURL, driveUploadURL = srv.URL+"/token", srv.URL+"/files", srv.URL+"/upload"
+	defer func(simple, chunk int64) { driveSimpleMax, driveChunkSize = simple, chunk }(driveSimpleMax, driveChunkSize)
+	driveSimpleMax, driveChunkSize = 64<<10, 256<<10
+
+	target := NewDrive("root", "client", "secret", "refresh", srv.Client())
+	if err := target.Put(context.Background(), "clip.mp4", "video/mp4", bytes.NewReader(content)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if !bytes.Equal(received, content) {
+		t.Fatalf("received %d bytes of %d", len(received), len(content))
+	}
+	want := []string{"bytes 0-262143/614400", "bytes 131072-393215/614400", "bytes 393216-614399/614400", "bytes 393216-614399/614400"}
+	if fmt.Sprint(ranges) != fmt.Sprint(want) {
+		t.Fatalf("chunks = %q, want %q", ranges, want)
+	}
+	if meta["name"] != "clip.mp4" {
+		t.Fatalf("session metadata = %v", meta)
+	}
+}
+
+func TestRuleFilters(t *testing.T) {
+	ctx := context.Background()
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	insert := func(n int, kind, state, county, captured string) int64 {
+		t.Helper()
+		rec := db.MediaRecord{
+			Kind: kind, FileName: fmt.Sprintf("%d.jpg", n), Extension: ".jpg",
+			SourceMount: "/Volumes/Test", SourcePath: fmt.Sprintf("/DCIM/%d.jpg", n), DestPath: fmt.Sprintf("/library/%d.jpg", n),
+			SizeBytes: int64(n), SHA256: fmt.Sprintf("sum%d", n),
+			CaptureTime: captured, IngestedAt: time.Now().UTC().Format(time.RFC3339),
+			State:  sql.NullString{String: state, Valid: state != ""},
+			County: sql.NullString{String: county, Valid: county != ""},
+		}
+		if err := store.InsertMedia(ctx, &rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		return rec.ID
+	}
+	boulder := insert(1, "image", "Colorado", "Boulder", "2026-03-01T10:00:00Z")
+	insert(2, "video", "Colorado", "Denver", "2026-03-31T23:00:00Z")
+	insert(3, "image", "Utah", "Grand", "2026-04-02T10:00:00Z")
+	insert(4, "image", "", "", "2025-12-24T10:00:00Z")
+	album, err := store.CreateAlbum(ctx, "Smith")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.AddMediaToAlbum(ctx, album.ID, []int64{boulder}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		Providers: []Provider{{Name: "nas", Kind: "webdav", Destination: "https://dav.example.com/vault"}},
+		Rules: []Rule{
+			{Name: "march", Provider: "nas", From: "2026-03-01", To: "2026-03-31"},
+			{Name: "places", Provider: "nas", Places: []Place{{State: "Colorado", County: "Denver"}, {State: "Utah"}}},
+			{Name: "album images", Provider: "nas", Kinds: []string{"image", "IMAGE"}, Albums: []int64{album.ID}},
+			{Name: "no place", Provider: "nas", State: "unknown"},
+		},
+	}
+	if err := cfg.Normalize(); err != nil {
+		t.Fatalf("Normalize: %v", err)
+	}
+	if k := cfg.Rules[2].Kinds; len(k) != 1 {
+		t.Fatalf("kinds = %v", k)
+	}
+	if p := cfg.Rules[3].Places; len(p) != 1 || p[0].State != "unknown" || cfg.Rules[3].State != "" {
+		t.Fatalf("legacy state not moved: %+v", cfg.Rules[3])
+	}
+	for i, want := range []struct{ files, bytes int64 }{{2, 3}, {2, 5}, {1, 1}, {1, 4}} {
+		counts, err := store.CountCloudSync(ctx, cfg.Rules[i].Filters(), "nas", MaxAttempts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts.Pending != want.files || counts.PendingBytes != want.bytes {
+			t.Errorf("rule %q: pending %d files, %d bytes; want %d, %d", cfg.Rules[i].Name, counts.Pending, counts.PendingBytes, want.files, want.bytes)
+		}
+	}
+
+	bad := Config{
+		Providers: cfg.Providers,
+		Rules:     []Rule{{Provider: "nas", From: "2026-04-01", To: "2026-03-01"}},
+	}
+	if err := bad.Normalize(); err == nil {
+		t.Fatal("Normalize accepted from after to")
+	}
+}
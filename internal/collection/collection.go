@@ -0,0 +1,133 @@
+// Package collection lays out a collections drive: a self-contained package
+// of original files for submission to a court or an insurer, with a signed
+// manifest, the audit entries that concern the files, and an HTML index
+// that opens in any browser without the vault.
+package collection
+
+import (
+	"html/template"
+	"io"
+	"strings"
+
+	"businessplan/usbvault/internal/i18n"
+)
+
+// Names of the parts of a package, relative to its folder.
+const (
+	OriginalsDir  = "originals"
+	ManifestName  = "manifest.json"  // attestation envelope over every file
+	PublicKeyName = "public-key.pem" // verifies the manifest signature
+	CustodyName   = "custody.json"   // chain-of-custody report
+	ChecksumsName = "SHA256SUMS"     // see package manifest
+	IndexName     = "index.html"
+)
+
+// File is one original in the package.
+type File struct {
+	MediaID     int64
+	Path        string // slash-separated, below the package folder
+	FileName    string // name in the library
+	Kind        string
+	SHA256      string
+	SizeBytes   int64
+	CaptureTime string // as displayed
+	IngestedAt  string // as displayed
+	Camera      string
+	Events      int // audit entries in the custody report
+}
+
+// Index describes the package for index.html.
+type Index struct {
+	Title       string
+	Locale      *i18n.Locale // formats sizes
+	GeneratedAt string       // as displayed
+	GeneratedBy string
+	Issuer      string
+	KeyID       string
+	ChainIntact bool
+	ChainHead   string
+	Files       []File
+}
+
+// TotalBytes is the size of every original together.
+func (idx Index) TotalBytes() int64 {
+	var n int64
+	for _, f := range idx.Files {
+		n += f.SizeBytes
+	}
+	return n
+}
+
+var indexPage = template.Must(template.New("index").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!doctype html>
+<html lang="{{.Locale.Tag}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body{margin:2rem;font-family:system-ui,sans-serif;color:#111}
+h1{font-size:1.4rem;margin:0 0 .5rem}
+dl{display:grid;grid-template-columns:max-content 1fr;gap:.2rem 1rem;font-size:.9rem}
+dt{color:#555}
+dd{margin:0}
+table{border-collapse:collapse;width:100%;font-size:.8rem;margin-top:1.5rem}
+th,td{border:1px solid #ccc;padding:.3rem .5rem;text-align:left;vertical-align:top}
+th{background:#f3f3f3}
+code{font-size:.75rem;word-break:break-all}
+.warn{color:#a00;font-weight:600}
+@media print{a{color:inherit;text-decoration:none}}
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<dl>
+<dt>Generated</dt><dd>{{.GeneratedAt}} by {{.GeneratedBy}}{{if .Issuer}} on {{.Issuer}}{{end}}</dd>
+<dt>Files</dt><dd>{{len .Files}} ({{.Locale.Bytes .TotalBytes}})</dd>
+<dt>Signing key</dt><dd><code>{{.KeyID}}</code></dd>
+<dt>Audit chain</dt><dd>{{if .ChainIntact}}intact, head <code>{{.ChainHead}}</code>{{else}}<span class="warn">does not verify</span>{{end}}</dd>
+</dl>
+<p>Every original is in <code>originals/</code> exactly as it was ingested. <code>SHA256SUMS</code> lists their hashes
+(check with <code>sha256sum -c SHA256SUMS</code>), <code>manifest.json</code> is a signed statement of the same hashes
+that verifies against <code>public-key.pem</code>, and <code>custody.json</code> holds every audit entry concerning the files.</p>
+<table>
+<thead><tr><th>#</th><th>File</th><th>Kind</th><th>Captured</th><th>Ingested</th><th>Camera</th><th>Size</th><th>SHA-256</th><th>Audit entries</th></tr></thead>
+<tbody>
+{{- range $i, $f := .Files}}
+<tr><td>{{inc $i}}</td><td><a href="{{$f.Path}}">{{$f.FileName}}</a></td><td>{{$f.Kind}}</td><td>{{$f.CaptureTime}}</td><td>{{$f.IngestedAt}}</td><td>{{$f.Camera}}</td><td>{{$.Locale.Bytes $f.SizeBytes}}</td><td><code>{{$f.SHA256}}</code></td><td>{{$f.Events}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+// WriteIndex writes index.html. A nil Locale is English.
+func WriteIndex(w io.Writer, idx Index) error {
+	if idx.Locale == nil {
+		idx.Locale, _ = i18n.Lookup("en")
+	}
+	return indexPage.Execute(w, idx)
+}
+
+// FolderName is the package folder for title, made at stamp.
+func FolderName(title, stamp string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteByte('-')
+		}
+	}
+	slug := strings.Trim(b.String(), "-")
+	if len(slug) > 48 {
+		slug = strings.Trim(slug[:48], "-")
+	}
+	if slug == "" {
+		return "collection-" + stamp
+	}
+	return "collection-" + slug + "-" + stamp
+}
@@ -0,0 +1,34 @@
+package collection
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestIndexEscapesNamesAndLinksOriginals(t *testing.T) {
+	files := []File{{
+		Path: "originals/a<b>.jpg", FileName: "a<b>.jpg", Kind: "image",
+		SHA256: strings.Repeat("ab", 32), SizeBytes: 3 << 20,
+	}}
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, Index{Title: "Claim <42>", KeyID: "k1", ChainIntact: true, Files: files}); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	page := buf.String()
+	if strings.Contains(page, "<b>") || strings.Contains(page, "Claim <42>") {
+		t.Fatal("names are not escaped")
+	}
+	if !strings.Contains(page, `href="originals/a%3cb%3e.jpg"`) || !strings.Contains(page, "3.0 MiB") {
+		t.Fatalf("index does not link the original:\n%s", page)
+	}
+}
+
+func TestFolderName(t *testing.T) {
+	if got := FolderName("Claim #2291: Hail damage!", "20261016-101500"); got != "collection-claim-2291-hail-damage-20261016-101500" {
+		t.Fatalf("FolderName = %q", got)
+	}
+	if got := FolderName("  ", "s"); got != "collection-s" {
+		t.Fatalf("FolderName(blank) = %q", got)
+	}
+}
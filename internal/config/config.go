@@ -1,19 +1,64 @@
 package config
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
+	_ "time/tzdata" // zone names must resolve on Windows and minimal images
 )
 
 const (
 	DefaultPort            = 4987
 	DefaultUSBScanInterval = 10
 	DefaultSessionTTLHours = 12
+	DefaultHookTimeout     = 30
+	DefaultDBSealMinutes   = 5
+	DefaultReplicaMinutes  = 15
+	DefaultDrillHours      = 24
+	DefaultDrillSample     = 5
+	DefaultScrubHours      = 168
+	DefaultScrubSample     = 200
+	DefaultVisionTimeout   = 60
+	DefaultAutoTagMinScore = 0.6
+	MaxIngestWorkers       = 16
+	DefaultIngestBatchSize = 50
+	MaxIngestBatchSize     = 1000
+
+	DefaultTimelapseMinFrames = 30
+	DefaultTimelapseFrameRate = 24
+	MaxTimelapseFrameRate     = 60
+
+	DefaultStreamCacheMB = 2048
+)
+
+// WorkDirName is the directory inside base storage that holds files which
+// are not library originals: regenerable derivatives and transient areas.
+// Features that need such space must use WorkAreaDir so backups can tell
+// them apart from media.
+const WorkDirName = ".usbvault"
+
+const (
+	WorkAreaThumbnails = "thumbnails"
+	WorkAreaProxies    = "proxies"
+	WorkAreaQuarantine = "quarantine"
+	WorkAreaTrash      = "trash"
+	WorkAreaExport     = "export"
+	WorkAreaBenchmark  = "benchmark" // storage benchmark scratch files; never backed up
 )
 
+var WorkAreas = []string{WorkAreaThumbnails, WorkAreaProxies, WorkAreaQuarantine, WorkAreaTrash, WorkAreaExport}
+
+func WorkAreaDir(baseStorage, area string) string {
+	return filepath.Join(baseStorage, WorkDirName, area)
+}
+
 var SupportedImageExtensions = map[string]struct{}{
 	".jpg": {}, ".jpeg": {}, ".jpe": {}, ".png": {}, ".tif": {}, ".tiff": {}, ".bmp": {}, ".webp": {}, ".gif": {},
 	".heic": {}, ".heif": {}, ".dng": {}, ".arw": {}, ".cr2": {}, ".cr3": {}, ".nef": {}, ".orf": {}, ".raf": {}, ".rw2": {},
@@ -68,10 +113,539 @@ func DataDir() string {
 	return filepath.Join(cwd, "data")
 }
 
+// HooksDir is where event hook executables live. Hooks are disabled when the
+// directory does not exist.
+func HooksDir() string {
+	if raw := strings.TrimSpace(os.Getenv("USBVAULT_HOOKS_DIR")); raw != "" {
+		return raw
+	}
+	return filepath.Join(DataDir(), "hooks")
+}
+
+// WatermarksDir holds the PNG overlays that watermarks can name.
+func WatermarksDir() string {
+	return filepath.Join(DataDir(), "watermarks")
+}
+
+func HookTimeoutSeconds() int {
+	if raw := os.Getenv("USBVAULT_HOOK_TIMEOUT_SECONDS"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return DefaultHookTimeout
+}
+
+// BindAddr is the listen host. Anything other than loopback exposes the
+// vault to the network and requires ConfirmLANExposure.
+func BindAddr() string {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_BIND")); v != "" {
+		return v
+	}
+	return "127.0.0.1"
+}
+
+func ConfirmLANExposure() bool {
+	return envBool("USBVAULT_CONFIRM_LAN_EXPOSURE")
+}
+
+// AllowInsecureLAN acknowledges serving non-loopback clients over plain
+// HTTP. Without it a LAN bind is refused, unless TLS is on, because
+// passwords and session cookies would cross the network in the clear.
+func AllowInsecureLAN() bool {
+	return envBool("USBVAULT_ALLOW_INSECURE_LAN")
+}
+
+// TLSEnabled serves HTTPS instead of plain HTTP: with the certificate from
+// USBVAULT_TLS_CERT and USBVAULT_TLS_KEY when both are set, or else with a
+// self-signed one kept in the data directory when USBVAULT_TLS is on.
+func TLSEnabled() bool {
+	return envBool("USBVAULT_TLS") || TLSUserProvided()
+}
+
+// TLSUserProvided reports whether the operator supplied the certificate.
+func TLSUserProvided() bool {
+	return strings.TrimSpace(os.Getenv("USBVAULT_TLS_CERT")) != "" && strings.TrimSpace(os.Getenv("USBVAULT_TLS_KEY")) != ""
+}
+
+// TLSCertPath is the PEM certificate chain HTTPS is served with.
+func TLSCertPath() string {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_TLS_CERT")); v != "" && TLSUserProvided() {
+		return v
+	}
+	return filepath.Join(DataDir(), "tls", "cert.pem")
+}
+
+// TLSKeyPath is the PEM private key for TLSCertPath.
+func TLSKeyPath() string {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_TLS_KEY")); v != "" && TLSUserProvided() {
+		return v
+	}
+	return filepath.Join(DataDir(), "tls", "key.pem")
+}
+
+// ASCIIFolderNames transliterates location folder and archive names to
+// ASCII instead of keeping their original script.
+func ASCIIFolderNames() bool {
+	return envBool("USBVAULT_ASCII_FOLDER_NAMES")
+}
+
+func envBool(key string) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// AllowedNetworksEnv returns allow-list entries from USBVAULT_ALLOWED_NETWORKS.
+// They are merged with entries saved through the API.
+func AllowedNetworksEnv() []string {
+	raw := strings.TrimSpace(os.Getenv("USBVAULT_ALLOWED_NETWORKS"))
+	if raw == "" {
+		return nil
+	}
+	return strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n'
+	})
+}
+
+// DBEncryptionEnabled keeps the database encrypted at rest; see DBPassphrase.
+func DBEncryptionEnabled() bool {
+	return envBool("USBVAULT_DB_ENCRYPTION")
+}
+
+// DBPassphrase reads the unlock passphrase from USBVAULT_DB_PASSPHRASE_FILE,
+// USBVAULT_DB_PASSPHRASE, or, when the latter is "-", the first line of stdin.
+func DBPassphrase() ([]byte, error) {
+	return readPassphrase("USBVAULT_DB_PASSPHRASE", "database")
+}
+
+// LibraryEncryptionEnabled stores newly ingested media encrypted at rest.
+func LibraryEncryptionEnabled() bool {
+	return envBool("USBVAULT_LIBRARY_ENCRYPTION")
+}
+
+// LosslessCompressionEnabled stores newly ingested PNG, TIFF and BMP files
+// compressed when that saves space; see package shrink.
+func LosslessCompressionEnabled() bool {
+	return envBool("USBVAULT_LOSSLESS_COMPRESSION")
+}
+
+// LibraryPassphrase unwraps the library master key. It is read the same way
+// as DBPassphrase, from USBVAULT_LIBRARY_PASSPHRASE(_FILE).
+func LibraryPassphrase() ([]byte, error) {
+	return readPassphrase("USBVAULT_LIBRARY_PASSPHRASE", "library")
+}
+
+func LibraryKeyPath() string {
+	return filepath.Join(DataDir(), "library.key")
+}
+
+// AttestationKeyPath is the Ed25519 key that signs media attestations.
+func AttestationKeyPath() string {
+	return filepath.Join(DataDir(), "attestation.key")
+}
+
+// BackupSSHKeyPath is the private key ssh backup destinations log in with.
+func BackupSSHKeyPath() string {
+	return filepath.Join(DataDir(), "backup_ssh_key")
+}
+
+// BackupKnownHostsPath is the known_hosts file ssh backup destinations are
+// checked against, next to the user's own.
+func BackupKnownHostsPath() string {
+	return filepath.Join(DataDir(), "backup_known_hosts")
+}
+
+func readPassphrase(envKey, label string) ([]byte, error) {
+	if path := strings.TrimSpace(os.Getenv(envKey + "_FILE")); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read passphrase file: %w", err)
+		}
+		return bytes.TrimRight(raw, "\r\n"), nil
+	}
+	v := os.Getenv(envKey)
+	if v == "-" {
+		fmt.Fprintf(os.Stderr, "USB Vault %s passphrase: ", label)
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return nil, fmt.Errorf("read passphrase: %w", err)
+		}
+		v = strings.TrimRight(line, "\r\n")
+	}
+	if v == "" {
+		return nil, fmt.Errorf("%s encryption is enabled but no passphrase was provided (%s or %s_FILE)", label, envKey, envKey)
+	}
+	return []byte(v), nil
+}
+
+// DBRuntimeDir holds the decrypted working copy. tmpfs is preferred so the
+// plaintext never reaches the vault drive.
+func DBRuntimeDir() string {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_DB_RUNTIME_DIR")); v != "" {
+		return v
+	}
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return filepath.Join("/dev/shm", "usbvault")
+	}
+	return filepath.Join(os.TempDir(), "usbvault-runtime")
+}
+
+func DBSealIntervalMinutes() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_DB_SEAL_INTERVAL_MINUTES")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return DefaultDBSealMinutes
+}
+
+// ClockWaitMinutes is how long a card ingest waits for an untrusted system
+// clock to be set before going ahead with flagged records. 0 does not wait.
+func ClockWaitMinutes() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_CLOCK_WAIT_MINUTES")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return 10
+}
+
+// IngestWorkers is how many card files are hashed and copied at once, from
+// USBVAULT_INGEST_WORKERS. One, the default, ingests file by file with
+// hashing running ahead on the resource budget's hash threads.
+func IngestWorkers() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_INGEST_WORKERS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return min(n, MaxIngestWorkers)
+		}
+	}
+	return 1
+}
+
+// IngestBatchSize is how many copied files have their records committed
+// together in one transaction, from USBVAULT_INGEST_BATCH_SIZE. A batch is
+// also committed when ingest moves on to another folder. One commits every
+// file on its own.
+func IngestBatchSize() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_INGEST_BATCH_SIZE")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return min(n, MaxIngestBatchSize)
+		}
+	}
+	return DefaultIngestBatchSize
+}
+
+// CardTimezone is the zone camera clocks are set to, used to read the
+// zoneless file times on FAT and exFAT cards. Nil when
+// USBVAULT_CARD_TIMEZONE is unset, which leaves file times as the operating
+// system reads them; "Local" is this machine's zone.
+func CardTimezone() (*time.Location, error) {
+	v := strings.TrimSpace(os.Getenv("USBVAULT_CARD_TIMEZONE"))
+	if v == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(v)
+	if err != nil {
+		return nil, fmt.Errorf("USBVAULT_CARD_TIMEZONE: %w", err)
+	}
+	return loc, nil
+}
+
+// Locale is the language tag used when a request does not ask for a
+// supported one, and for alerts. English when empty.
+func Locale() string {
+	return strings.TrimSpace(os.Getenv("USBVAULT_LOCALE"))
+}
+
+// ReplicaSource is the base URL of the vault this one replicates from.
+// Replication is off when it is empty.
+func ReplicaSource() string {
+	return strings.TrimRight(strings.TrimSpace(os.Getenv("USBVAULT_REPLICA_SOURCE")), "/")
+}
+
+// ReplicaCredentials returns the account used to log in to the source vault.
+// The password may come from USBVAULT_REPLICA_PASSWORD_FILE instead.
+func ReplicaCredentials() (string, string, error) {
+	username := strings.TrimSpace(os.Getenv("USBVAULT_REPLICA_USERNAME"))
+	password := os.Getenv("USBVAULT_REPLICA_PASSWORD")
+	if path := strings.TrimSpace(os.Getenv("USBVAULT_REPLICA_PASSWORD_FILE")); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("read replica password file: %w", err)
+		}
+		password = string(bytes.TrimRight(raw, "\r\n"))
+	}
+	if username == "" || password == "" {
+		return "", "", fmt.Errorf("replication needs USBVAULT_REPLICA_USERNAME and USBVAULT_REPLICA_PASSWORD")
+	}
+	return username, password, nil
+}
+
+func ReplicaIntervalMinutes() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_REPLICA_INTERVAL_MINUTES")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return DefaultReplicaMinutes
+}
+
+// RestoreDrillIntervalHours is how often a restore drill runs against the
+// most recent backup. 0 turns the scheduled drill off.
+func RestoreDrillIntervalHours() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_RESTORE_DRILL_HOURS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return DefaultDrillHours
+}
+
+func RestoreDrillSampleSize() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_RESTORE_DRILL_SAMPLE")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return min(n, 500)
+		}
+	}
+	return DefaultDrillSample
+}
+
+// ScrubIntervalHours is how often the library scrub runs, from
+// USBVAULT_SCRUB_HOURS. 0 turns the scheduled scrub off.
+func ScrubIntervalHours() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_SCRUB_HOURS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return DefaultScrubHours
+}
+
+// ScrubSampleSize is how many files a scheduled scrub re-hashes, from
+// USBVAULT_SCRUB_SAMPLE. 0, set as "all", re-hashes every file.
+func ScrubSampleSize() int {
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("USBVAULT_SCRUB_SAMPLE"))); v {
+	case "":
+	case "all":
+		return 0
+	default:
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return DefaultScrubSample
+}
+
+// FaceDetector is the local command that finds faces in images. Face
+// detection is off when it is empty.
+func FaceDetector() string {
+	return strings.TrimSpace(os.Getenv("USBVAULT_FACE_DETECTOR"))
+}
+
+// AutoTagClassifier is the local command that labels image scenes.
+// Auto-tagging is off when it is empty.
+func AutoTagClassifier() string {
+	return strings.TrimSpace(os.Getenv("USBVAULT_AUTOTAG_CLASSIFIER"))
+}
+
+// AutoTagMinScore is the lowest classifier score kept as a tag.
+func AutoTagMinScore() float64 {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_AUTOTAG_MIN_SCORE")); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 && f <= 1 {
+			return f
+		}
+	}
+	return DefaultAutoTagMinScore
+}
+
+// FFmpegPath is the ffmpeg binary that extracts video poster frames, from
+// USBVAULT_FFMPEG or else ffmpeg on PATH. It is empty, and videos get no
+// poster, when neither is found or USBVAULT_FFMPEG is "off".
+func FFmpegPath() string {
+	switch v := strings.TrimSpace(os.Getenv("USBVAULT_FFMPEG")); v {
+	case "off":
+		return ""
+	case "":
+		p, _ := exec.LookPath("ffmpeg")
+		return p
+	default:
+		return v
+	}
+}
+
+// RAWConverterPath is the dcraw-compatible program that develops RAW files
+// whose embedded preview cannot be read, from USBVAULT_RAW_CONVERTER or else
+// dcraw on PATH. It is empty, and such files get no JPEG rendition, when
+// neither is found or USBVAULT_RAW_CONVERTER is "off".
+func RAWConverterPath() string {
+	switch v := strings.TrimSpace(os.Getenv("USBVAULT_RAW_CONVERTER")); v {
+	case "off":
+		return ""
+	case "":
+		p, _ := exec.LookPath("dcraw")
+		return p
+	default:
+		return v
+	}
+}
+
+// StreamCacheMB is how much transcoded video is kept for replay, from
+// USBVAULT_STREAM_CACHE_MB. 0 keeps none.
+func StreamCacheMB() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_STREAM_CACHE_MB")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return DefaultStreamCacheMB
+}
+
+// TimelapseEnabled reports whether runs of stills shot as a time-lapse or
+// burst are rendered into videos, from USBVAULT_TIMELAPSE. Rendering also
+// needs ffmpeg.
+func TimelapseEnabled() bool {
+	return envBool("USBVAULT_TIMELAPSE")
+}
+
+// TimelapseMinFrames is the fewest stills that make a sequence, from
+// USBVAULT_TIMELAPSE_MIN_FRAMES.
+func TimelapseMinFrames() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_TIMELAPSE_MIN_FRAMES")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 2 {
+			return n
+		}
+	}
+	return DefaultTimelapseMinFrames
+}
+
+// TimelapseFrameRate is the frames per second rendered videos play at,
+// from USBVAULT_TIMELAPSE_FPS.
+func TimelapseFrameRate() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_TIMELAPSE_FPS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return min(n, MaxTimelapseFrameRate)
+		}
+	}
+	return DefaultTimelapseFrameRate
+}
+
+// OCRCommand is the local command that reads text from images. OCR is off
+// when it is empty.
+func OCRCommand() string {
+	return strings.TrimSpace(os.Getenv("USBVAULT_OCR_COMMAND"))
+}
+
+// OCRTags lists the tags that mark an image for OCR, comma separated in
+// USBVAULT_OCR_TAGS. Tags may contain spaces.
+func OCRTags() []string {
+	raw := strings.TrimSpace(os.Getenv("USBVAULT_OCR_TAGS"))
+	if raw == "" {
+		return []string{"document", "whiteboard"}
+	}
+	var tags []string
+	for _, tag := range strings.Split(raw, ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// VisionTimeoutSeconds bounds each run of a local model command.
+func VisionTimeoutSeconds() int {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_VISION_TIMEOUT_SECONDS")); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return DefaultVisionTimeout
+}
+
+// ProvisioningEnabled turns on first-boot provisioning for the Pi build:
+// until setup is done, the setup flow is also served on the Ethernet
+// address or on a Wi-Fi access point the vault brings up.
+func ProvisioningEnabled() bool {
+	return envBool("USBVAULT_PROVISION")
+}
+
+// ProvisionInterface is the Wi-Fi interface used for the access point and
+// for joining the network chosen during setup.
+func ProvisionInterface() string {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_PROVISION_IFACE")); v != "" {
+		return v
+	}
+	return "wlan0"
+}
+
+func ProvisionSSID() string {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_PROVISION_SSID")); v != "" {
+		return v
+	}
+	return "USBVault-Setup"
+}
+
+// ProvisionPassphrase is the access point's WPA2 passphrase. When it is
+// empty a random one is generated and shown on the kiosk console and in the
+// log.
+func ProvisionPassphrase() string {
+	return strings.TrimSpace(os.Getenv("USBVAULT_PROVISION_PASSPHRASE"))
+}
+
+// SetupCode is the code remote clients must enter to complete provisioning.
+// When it is empty a random one is generated like the passphrase.
+func SetupCode() string {
+	return strings.TrimSpace(os.Getenv("USBVAULT_SETUP_CODE"))
+}
+
 func DBPath() string {
 	return filepath.Join(DataDir(), "usbvault.db")
 }
 
+// ReadOnly serves an existing vault without changing it: the database and
+// library are opened read-only and every mutating endpoint is refused.
+func ReadOnly() bool {
+	return envBool("USBVAULT_READ_ONLY")
+}
+
+// ReadOnlyDBPath is the database served in read-only mode: the
+// USBVAULT_READ_ONLY_DB file, such as the db folder of a backup snapshot,
+// or the vault's own database.
+func ReadOnlyDBPath() string {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_READ_ONLY_DB")); v != "" {
+		return filepath.Clean(v)
+	}
+	return DBPath()
+}
+
+// ReadOnlyStorage is where the library lives in read-only mode when it is
+// not at the base storage path recorded in the database, such as the media
+// folder of a backup snapshot. Empty keeps the recorded path.
+func ReadOnlyStorage() string {
+	if v := strings.TrimSpace(os.Getenv("USBVAULT_READ_ONLY_STORAGE")); v != "" {
+		return filepath.Clean(v)
+	}
+	return ""
+}
+
+// StorageBackend is where library files are written: "local" (the
+// default), "smb" for a library folder on a mounted SMB share, or an
+// s3://bucket/prefix URL.
+func StorageBackend() (string, error) {
+	v := strings.TrimSpace(os.Getenv("USBVAULT_STORAGE_BACKEND"))
+	switch {
+	case v == "" || strings.EqualFold(v, "local"):
+		return "local", nil
+	case strings.EqualFold(v, "smb"):
+		return "smb", nil
+	case strings.HasPrefix(v, "s3://"):
+		return v, nil
+	}
+	return "", fmt.Errorf("USBVAULT_STORAGE_BACKEND %q must be local, smb, or s3://bucket/prefix", v)
+}
+
 func MountRoots() []string {
 	switch runtime.GOOS {
 	case "darwin":
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The config file holds USBVAULT_ settings as KEY=VALUE lines, the format
+// of a systemd EnvironmentFile. Its values override the process environment
+// and, unlike it, can be changed while the server runs: LoadFile applies
+// them again on SIGHUP or POST /api/system/reload.
+
+// reloadableKeys are the settings read when they are used, or re-applied on
+// reload, so a change takes effect without a restart.
+var reloadableKeys = map[string]bool{
+	"USBVAULT_LOG_LEVEL":               true,
+	"USBVAULT_REVERSE_GEOCODE":         true,
+	"USBVAULT_GEOCODE_URL":             true,
+	"USBVAULT_GEOCODE_PROVIDER":        true,
+	"USBVAULT_GEOCODE_API_KEY":         true,
+	"USBVAULT_GEOCODE_OFFLINE_DB":      true,
+	"USBVAULT_GEOCODE_FALLBACK":        true,
+	"USBVAULT_GEOCODE_UA":              true,
+	"USBVAULT_GEOCODE_MIN_INTERVAL_MS": true,
+	"USBVAULT_SCAN_INTERVAL_SECONDS":   true,
+	"USBVAULT_HOOK_TIMEOUT_SECONDS":    true,
+	"USBVAULT_ALLOWED_NETWORKS":        true,
+	"USBVAULT_CARD_TIMEZONE":           true,
+	"USBVAULT_ASCII_FOLDER_NAMES":      true,
+	"USBVAULT_RESTORE_DRILL_SAMPLE":    true,
+	"USBVAULT_INGEST_WORKERS":          true,
+	"USBVAULT_INGEST_BATCH_SIZE":       true,
+}
+
+// Reload reports what a LoadFile call changed.
+type Reload struct {
+	File    string   `json:"file"`
+	Changed []string `json:"changed"`
+	// Restart lists changed settings that are only read at startup.
+	Restart []string `json:"restart_required"`
+}
+
+var fileState struct {
+	mu       sync.Mutex
+	applied  map[string]string  // values the file has set
+	original map[string]*string // environment before the file, nil when unset
+}
+
+// ConfigFile is the config file path: USBVAULT_CONFIG_FILE, which has to
+// come from the environment, or usbvault.conf in the data directory.
+func ConfigFile() string {
+	if raw := strings.TrimSpace(os.Getenv("USBVAULT_CONFIG_FILE")); raw != "" {
+		return raw
+	}
+	return filepath.Join(DataDir(), "usbvault.conf")
+}
+
+// LoadFile applies the config file to the environment. A setting removed
+// from the file goes back to its value from the process environment. A
+// missing file is the same as an empty one. On a parse error nothing is
+// changed.
+func LoadFile() (Reload, error) {
+	path := ConfigFile()
+	rel := Reload{File: path, Changed: []string{}, Restart: []string{}}
+	values, err := readConfigFile(path)
+	if err != nil {
+		return rel, err
+	}
+
+	fileState.mu.Lock()
+	defer fileState.mu.Unlock()
+	if fileState.original == nil {
+		fileState.applied = map[string]string{}
+		fileState.original = map[string]*string{}
+	}
+
+	changed := map[string]bool{}
+	for key, value := range values {
+		if _, ok := fileState.original[key]; !ok {
+			if v, set := os.LookupEnv(key); set {
+				fileState.original[key] = &v
+			} else {
+				fileState.original[key] = nil
+			}
+		}
+		if os.Getenv(key) != value {
+			changed[key] = true
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return rel, err
+		}
+		fileState.applied[key] = value
+	}
+	for key := range fileState.applied {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		before := os.Getenv(key)
+		if orig := fileState.original[key]; orig != nil {
+			_ = os.Setenv(key, *orig)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+		if os.Getenv(key) != before {
+			changed[key] = true
+		}
+		delete(fileState.applied, key)
+		delete(fileState.original, key)
+	}
+
+	for key := range changed {
+		rel.Changed = append(rel.Changed, key)
+		if !reloadableKeys[key] {
+			rel.Restart = append(rel.Restart, key)
+		}
+	}
+	sort.Strings(rel.Changed)
+	sort.Strings(rel.Restart)
+	return rel, nil
+}
+
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !strings.HasPrefix(key, "USBVAULT_") {
+			return nil, fmt.Errorf("%s:%d: expected USBVAULT_NAME=value", path, line)
+		}
+		if key == "USBVAULT_CONFIG_FILE" {
+			return nil, fmt.Errorf("%s:%d: USBVAULT_CONFIG_FILE can only be set in the environment", path, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values, sc.Err()
+}
+
+// LogLevel is how much the server logs: "debug" adds the client and status
+// to each request line, "info" (the default) logs every request, and
+// "warn" leaves request lines out.
+func LogLevel() string {
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("USBVAULT_LOG_LEVEL"))); v {
+	case "debug", "warn":
+		return v
+	}
+	return "info"
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoadFileAppliesAndRestores(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usbvault.conf")
+	t.Setenv("USBVAULT_CONFIG_FILE", path)
+	t.Setenv("USBVAULT_LOG_LEVEL", "info")
+	t.Setenv("USBVAULT_PORT", "4987")
+	t.Setenv("USBVAULT_GEOCODE_UA", "")
+	os.Unsetenv("USBVAULT_GEOCODE_UA")
+
+	write := func(body string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("# comment\nUSBVAULT_LOG_LEVEL=debug\nUSBVAULT_PORT = 5000\nUSBVAULT_GEOCODE_UA=\"Vault Test\"\n")
+	rel, err := LoadFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if LogLevel() != "debug" || Port() != 5000 || os.Getenv("USBVAULT_GEOCODE_UA") != "Vault Test" {
+		t.Fatalf("file not applied: level %s, port %d, ua %q", LogLevel(), Port(), os.Getenv("USBVAULT_GEOCODE_UA"))
+	}
+	if !slices.Equal(rel.Changed, []string{"USBVAULT_GEOCODE_UA", "USBVAULT_LOG_LEVEL", "USBVAULT_PORT"}) {
+		t.Fatalf("changed = %v", rel.Changed)
+	}
+	if !slices.Equal(rel.Restart, []string{"USBVAULT_PORT"}) {
+		t.Fatalf("restart = %v", rel.Restart)
+	}
+
+	// Dropping lines goes back to the process environment.
+	write("USBVAULT_PORT=5000\n")
+	rel, err = LoadFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if LogLevel() != "info" {
+		t.Fatalf("log level = %s, want info from the environment", LogLevel())
+	}
+	if _, set := os.LookupEnv("USBVAULT_GEOCODE_UA"); set {
+		t.Fatal("USBVAULT_GEOCODE_UA still set after leaving the file")
+	}
+	if !slices.Equal(rel.Changed, []string{"USBVAULT_GEOCODE_UA", "USBVAULT_LOG_LEVEL"}) || len(rel.Restart) != 0 {
+		t.Fatalf("second reload = %+v", rel)
+	}
+
+	// A bad file changes nothing.
+	write("USBVAULT_PORT=6000\nPATH=/tmp\n")
+	if _, err := LoadFile(); err == nil {
+		t.Fatal("non-USBVAULT key accepted")
+	}
+	if Port() != 5000 {
+		t.Fatalf("port = %d after a rejected file", Port())
+	}
+
+	write("")
+	if _, err := LoadFile(); err != nil {
+		t.Fatal(err)
+	}
+	if Port() != 4987 {
+		t.Fatalf("port = %d, want 4987 from the environment", Port())
+	}
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const SecurityHeadersSettingKey = "security_headers"
+
+const (
+	DefaultMapTiles       = "https://tile.openstreetmap.org/{z}/{x}/{y}.png"
+	DefaultMapAttribution = "&copy; OpenStreetMap contributors"
+	DefaultReferrerPolicy = "no-referrer"
+)
+
+// HeaderPolicy is the configurable part of the security headers sent with
+// every response. The fixed part (script-src 'self', nosniff, and so on)
+// is not configurable. Empty fields take the defaults.
+type HeaderPolicy struct {
+	// MapTiles is the Leaflet tile URL template. A path such as
+	// /tiles/{z}/{x}/{y}.png serves self-hosted tiles from this origin.
+	MapTiles       string `json:"map_tiles"`
+	MapAttribution string `json:"map_attribution"`
+	// ImgSrc and ConnectSrc are extra origins for img-src and connect-src.
+	ImgSrc     []string `json:"img_src"`
+	ConnectSrc []string `json:"connect_src"`
+	// FrameAncestors are origins allowed to embed the UI, for a dashboard
+	// that frames it. Empty forbids framing.
+	FrameAncestors []string `json:"frame_ancestors"`
+	ReferrerPolicy string   `json:"referrer_policy"`
+}
+
+// cspSource is an origin that may appear in a CSP source list. Keywords,
+// paths, and wildcards other than a leading "*." are rejected so a setting
+// cannot loosen the policy beyond naming hosts.
+var cspSource = regexp.MustCompile(`^(https?|wss?)://(\*\.)?[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*(:[0-9]{1,5})?$`)
+
+var referrerPolicies = map[string]struct{}{
+	"no-referrer": {}, "no-referrer-when-downgrade": {}, "origin": {}, "origin-when-cross-origin": {},
+	"same-origin": {}, "strict-origin": {}, "strict-origin-when-cross-origin": {}, "unsafe-url": {},
+}
+
+// ParseHeaderPolicy reads a saved policy. An empty value is the default
+// policy.
+func ParseHeaderPolicy(raw string) (HeaderPolicy, error) {
+	var p HeaderPolicy
+	if strings.TrimSpace(raw) != "" {
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			return HeaderPolicy{}, fmt.Errorf("invalid security headers: %w", err)
+		}
+	}
+	return p.Normalize()
+}
+
+// Normalize validates p and fills in defaults.
+func (p HeaderPolicy) Normalize() (HeaderPolicy, error) {
+	p.MapTiles = strings.TrimSpace(p.MapTiles)
+	if p.MapTiles == "" {
+		p.MapTiles = DefaultMapTiles
+		if strings.TrimSpace(p.MapAttribution) == "" {
+			p.MapAttribution = DefaultMapAttribution
+		}
+	}
+	if _, err := mapTilesOrigin(p.MapTiles); err != nil {
+		return HeaderPolicy{}, err
+	}
+	p.MapAttribution = strings.TrimSpace(p.MapAttribution)
+	// Leaflet renders the attribution as HTML, so it may hold entities
+	// such as &copy; but no markup.
+	if len(p.MapAttribution) > 256 || strings.ContainsAny(p.MapAttribution, "<>\"") {
+		return HeaderPolicy{}, fmt.Errorf("map_attribution must be plain text of at most 256 characters")
+	}
+	var err error
+	if p.ImgSrc, err = normalizeSources("img_src", p.ImgSrc); err != nil {
+		return HeaderPolicy{}, err
+	}
+	if p.ConnectSrc, err = normalizeSources("connect_src", p.ConnectSrc); err != nil {
+		return HeaderPolicy{}, err
+	}
+	if p.FrameAncestors, err = normalizeSources("frame_ancestors", p.FrameAncestors); err != nil {
+		return HeaderPolicy{}, err
+	}
+	p.ReferrerPolicy = strings.ToLower(strings.TrimSpace(p.ReferrerPolicy))
+	if p.ReferrerPolicy == "" {
+		p.ReferrerPolicy = DefaultReferrerPolicy
+	}
+	if _, ok := referrerPolicies[p.ReferrerPolicy]; !ok {
+		return HeaderPolicy{}, fmt.Errorf("invalid referrer_policy %q", p.ReferrerPolicy)
+	}
+	return p, nil
+}
+
+func normalizeSources(field string, in []string) ([]string, error) {
+	out := make([]string, 0, len(in))
+	seen := map[string]struct{}{}
+	for _, raw := range in {
+		src := strings.TrimRight(strings.ToLower(strings.TrimSpace(raw)), "/")
+		if src == "" {
+			continue
+		}
+		if !cspSource.MatchString(src) {
+			return nil, fmt.Errorf("invalid %s entry %q: use an origin such as https://tiles.example.org", field, raw)
+		}
+		if _, dup := seen[src]; !dup {
+			seen[src] = struct{}{}
+			out = append(out, src)
+		}
+	}
+	return out, nil
+}
+
+// mapTilesOrigin is the CSP source for a tile URL template: "" for tiles on
+// this origin, or scheme://host with a {s} subdomain placeholder turned
+// into a wildcard.
+func mapTilesOrigin(tiles string) (string, error) {
+	for _, ph := range []string{"{z}", "{x}", "{y}"} {
+		if !strings.Contains(tiles, ph) {
+			return "", fmt.Errorf("map_tiles must contain {z}, {x} and {y}")
+		}
+	}
+	if strings.ContainsAny(tiles, " \t\r\n;,'\"") {
+		return "", fmt.Errorf("map_tiles contains characters not allowed in a URL")
+	}
+	if strings.HasPrefix(tiles, "/") && !strings.HasPrefix(tiles, "//") {
+		return "", nil
+	}
+	u, err := url.Parse(strings.NewReplacer("{s}", "s", "{z}", "0", "{x}", "0", "{y}", "0", "{r}", "").Replace(tiles))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return "", fmt.Errorf("map_tiles must be an http(s) URL or a path on this server")
+	}
+	host := tiles[len(u.Scheme)+3:]
+	if i := strings.IndexByte(host, '/'); i >= 0 {
+		host = host[:i]
+	}
+	if strings.HasPrefix(host, "{s}.") {
+		host = "*." + host[len("{s}."):]
+	}
+	origin := strings.ToLower(u.Scheme + "://" + host)
+	if !cspSource.MatchString(origin) {
+		return "", fmt.Errorf("map_tiles host %q is not allowed", host)
+	}
+	return origin, nil
+}
+
+// ContentSecurityPolicy builds the CSP header for p. The map tile origin
+// is added to img-src and connect-src.
+func (p HeaderPolicy) ContentSecurityPolicy() string {
+	img := []string{"'self'", "data:"}
+	connect := []string{"'self'"}
+	if origin, err := mapTilesOrigin(p.MapTiles); err == nil && origin != "" {
+		img = append(img, origin)
+		connect = append(connect, origin)
+	}
+	img = appendMissing(img, p.ImgSrc)
+	connect = appendMissing(connect, p.ConnectSrc)
+	frame := []string{"'none'"}
+	if len(p.FrameAncestors) > 0 {
+		frame = p.FrameAncestors
+	}
+	return "default-src 'self'; img-src " + strings.Join(img, " ") +
+		"; style-src 'self' 'unsafe-inline'; script-src 'self'; font-src 'self' data:; connect-src " + strings.Join(connect, " ") +
+		"; media-src 'self'; frame-ancestors " + strings.Join(frame, " ") + ";"
+}
+
+func appendMissing(list, extra []string) []string {
+	for _, s := range extra {
+		found := false
+		for _, have := range list {
+			if have == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeaderPolicyDefaultsMatchTheBuiltInCSP(t *testing.T) {
+	p, err := ParseHeaderPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "default-src 'self'; img-src 'self' data: https://tile.openstreetmap.org; style-src 'self' 'unsafe-inline'; script-src 'self'; font-src 'self' data:; connect-src 'self' https://tile.openstreetmap.org; media-src 'self'; frame-ancestors 'none';"
+	if got := p.ContentSecurityPolicy(); got != want {
+		t.Fatalf("csp = %s", got)
+	}
+	if p.ReferrerPolicy != "no-referrer" || p.MapAttribution == "" {
+		t.Fatalf("defaults = %+v", p)
+	}
+}
+
+func TestHeaderPolicyFollowsTheMapSource(t *testing.T) {
+	p, err := HeaderPolicy{
+		MapTiles:       "https://{s}.tiles.example.org/{z}/{x}/{y}.png",
+		ImgSrc:         []string{"https://cdn.example.org/"},
+		FrameAncestors: []string{"https://dash.example.org"},
+	}.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	csp := p.ContentSecurityPolicy()
+	for _, want := range []string{
+		"img-src 'self' data: https://*.tiles.example.org https://cdn.example.org;",
+		"connect-src 'self' https://*.tiles.example.org;",
+		"frame-ancestors https://dash.example.org;",
+	} {
+		if !strings.Contains(csp, want) {
+			t.Fatalf("csp %q lacks %q", csp, want)
+		}
+	}
+
+	// Self-hosted tiles need no extra origin.
+	p, err = HeaderPolicy{MapTiles: "/tiles/{z}/{x}/{y}.png"}.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csp := p.ContentSecurityPolicy(); !strings.Contains(csp, "img-src 'self' data:;") {
+		t.Fatalf("self-hosted csp = %s", csp)
+	}
+}
+
+func TestHeaderPolicyRejectsLooseSources(t *testing.T) {
+	for _, p := range []HeaderPolicy{
+		{ImgSrc: []string{"*"}},
+		{ConnectSrc: []string{"'unsafe-eval'"}},
+		{ImgSrc: []string{"https://a.example.org; script-src *"}},
+		{FrameAncestors: []string{"https://a.example.org/path"}},
+		{MapTiles: "https://tiles.example.org/tile.png"},
+		{MapTiles: "javascript:{z}{x}{y}"},
+		{MapTiles: "https://tiles.example.org/{z}/{x}/{y}.png; script-src *"},
+		{MapAttribution: "<img src=x onerror=alert(1)>"},
+		{ReferrerPolicy: "everything"},
+	} {
+		if _, err := p.Normalize(); err == nil {
+			t.Errorf("%+v was accepted", p)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+// Package custody compiles chain-of-custody reports: for one media file or
+// an album, every audit entry that touched the files (ingest, downloads,
+// album changes, shares, attestations) plus guest views, each with the hash
+// that ties it into the audit chain. The report is plain JSON laid out to be
+// printed or rendered to PDF as is.
+package custody
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/i18n"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Report is a chain-of-custody report. Its title, summaries and *_text
+// times are in the locale of the request context.
+type Report struct {
+	Title           string     `json:"title"`
+	Locale          string     `json:"locale"`
+	GeneratedAt     string     `json:"generated_at"`
+	GeneratedAtText string     `json:"generated_at_text"`
+	GeneratedBy     string     `json:"generated_by"`
+	Album           *Album     `json:"album,omitempty"`
+	AlbumEvents     []Event    `json:"album_events,omitempty"`
+	Items           []Item     `json:"items"`
+	Chain           ChainCheck `json:"chain"`
+
+	loc *i18n.Locale
+}
+
+type Album struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Item is one media file and what happened to it.
+type Item struct {
+	Media      Media            `json:"media"`
+	Events     []Event          `json:"events"`
+	GuestViews []db.GuestAccess `json:"guest_views"`
+}
+
+type Media struct {
+	ID             int64  `json:"id"`
+	FileName       string `json:"file_name"`
+	Kind           string `json:"kind"`
+	SHA256         string `json:"sha256"`
+	SizeBytes      int64  `json:"size_bytes"`
+	CaptureTime    string `json:"capture_time"`
+	IngestedAt     string `json:"ingested_at"`
+	SourceMount    string `json:"source_mount"`
+	SourcePath     string `json:"source_path"`
+	LibraryPath    string `json:"library_path"`
+	ClockUncertain bool   `json:"clock_uncertain,omitempty"`
+}
+
+// Event is one audit entry. PrevHash and Hash let a reader recompute the
+// chain link with audit.EntryHash; Verified says the vault did so.
+type Event struct {
+	AuditID  int64           `json:"audit_id"`
+	TS       string          `json:"ts"`
+	TSText   string          `json:"ts_text"`
+	Actor    string          `json:"actor"`
+	Action   string          `json:"action"`
+	Category string          `json:"category"`
+	Summary  string          `json:"summary"`
+	Details  json.RawMessage `json:"details"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+	Verified bool            `json:"verified"`
+}
+
+// ChainCheck is the result of re-verifying the whole audit chain.
+type ChainCheck struct {
+	Entries  int64  `json:"entries"`
+	Intact   bool   `json:"intact"`
+	HeadHash string `json:"head_hash"`
+	BrokenAt int64  `json:"broken_at,omitempty"` // first entry that does not verify
+}
+
+// ForMedia builds the report for a single media file.
+func ForMedia(ctx context.Context, store *db.Store, mediaID int64, generatedBy string) (*Report, error) {
+	rec, err := store.GetMediaByID(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, fmt.Errorf("media %d: %w", mediaID, ErrNotFound)
+	}
+	loc := i18n.FromContext(ctx)
+	r := newReport(loc, loc.Tf("Chain of custody: %s", rec.FileName), generatedBy)
+	if err := r.fill(ctx, store, []db.MediaRecord{*rec}, 0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ForAlbum builds the report for every file in an album, in album order.
+func ForAlbum(ctx context.Context, store *db.Store, albumID int64, generatedBy string) (*Report, error) {
+	album, err := store.GetAlbumByID(ctx, albumID)
+	if err != nil {
+		return nil, err
+	}
+	if album == nil {
+		return nil, fmt.Errorf("album %d: %w", albumID, ErrNotFound)
+	}
+	links, err := store.ListAlbumMediaLinks(ctx, albumID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(links))
+	for i, l := range links {
+		ids[i] = l.ID
+	}
+	records, err := store.ListMediaByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	order := make(map[int64]int, len(ids))
+	for i, id := range ids {
+		order[id] = i
+	}
+	slices.SortFunc(records, func(a, b db.MediaRecord) int { return order[a.ID] - order[b.ID] })
+
+	loc := i18n.FromContext(ctx)
+	r := newReport(loc, loc.Tf("Chain of custody: album %s", album.Name), generatedBy)
+	r.Album = &Album{ID: album.ID, Name: album.Name, CreatedAt: album.CreatedAt}
+	r.AlbumEvents = []Event{}
+	if err := r.fill(ctx, store, records, albumID); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ForRecords builds the report for any set of media files, in the order
+// given.
+func ForRecords(ctx context.Context, store *db.Store, title string, records []db.MediaRecord, generatedBy string) (*Report, error) {
+	r := newReport(i18n.FromContext(ctx), title, generatedBy)
+	if err := r.fill(ctx, store, records, 0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func newReport(loc *i18n.Locale, title, generatedBy string) *Report {
+	now := time.Now().UTC()
+	return &Report{
+		Title:           title,
+		Locale:          loc.Tag,
+		GeneratedAt:     now.Format(time.RFC3339),
+		GeneratedAtText: loc.Time(now),
+		GeneratedBy:     generatedBy,
+		Items:           []Item{},
+		loc:             loc,
+	}
+}
+
+// fill walks the audit chain once, verifying it and sorting entries that
+// mention the records (or, when albumID is set, the album) into the report.
+func (r *Report) fill(ctx context.Context, store *db.Store, records []db.MediaRecord, albumID int64) error {
+	ids := make([]int64, len(records))
+	byID := make(map[int64]int, len(records))
+	bySHA := make(map[string][]int, len(records))
+	byPath := make(map[string]int, len(records))
+	for i, rec := range records {
+		ids[i] = rec.ID
+		byID[rec.ID] = i
+		bySHA[rec.SHA256] = append(bySHA[rec.SHA256], i)
+		byPath[rec.DestPath] = i
+		r.Items = append(r.Items, Item{
+			Media: Media{
+				ID:             rec.ID,
+				FileName:       rec.FileName,
+				Kind:           rec.Kind,
+				SHA256:         rec.SHA256,
+				SizeBytes:      rec.SizeBytes,
+				CaptureTime:    rec.CaptureTime,
+				IngestedAt:     rec.IngestedAt,
+				SourceMount:    rec.SourceMount,
+				SourcePath:     rec.SourcePath,
+				LibraryPath:    rec.DestPath,
+				ClockUncertain: rec.ClockUncertain,
+			},
+			Events:     []Event{},
+			GuestViews: []db.GuestAccess{},
+		})
+	}
+	// Sharing an album a file is in shares the file, so guest accounts
+	// scoped to any of those albums belong in the file's history.
+	albums, err := store.MediaAlbumIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	r.Chain.Intact = true
+	prevHash := ""
+	err = store.WalkAudit(ctx, func(rec db.AuditRecord, prev string) error {
+		r.Chain.Entries++
+		verified := prev == prevHash && audit.EntryHash(rec.TS, rec.Actor, rec.Action, rec.Details, prev) == rec.Hash
+		if !verified && r.Chain.Intact {
+			r.Chain.Intact = false
+			r.Chain.BrokenAt = rec.ID
+		}
+		prevHash = rec.Hash
+
+		var d map[string]any
+		if json.Unmarshal([]byte(rec.Details), &d) != nil {
+			return nil
+		}
+		ev := Event{
+			AuditID:  rec.ID,
+			TS:       rec.TS,
+			TSText:   r.loc.Timestamp(rec.TS),
+			Actor:    rec.Actor,
+			Action:   rec.Action,
+			Category: category(rec.Action),
+			Summary:  summary(r.loc, rec.Actor, rec.Action, d),
+			Details:  json.RawMessage(rec.Details),
+			PrevHash: prev,
+			Hash:     rec.Hash,
+			Verified: verified,
+		}
+		matched := make(map[int]bool)
+		if id, ok := num(d["media_id"]); ok {
+			if i, ok := byID[id]; ok {
+				matched[i] = true
+			}
+		}
+		if id, ok := num(d["existing_id"]); ok {
+			if i, ok := byID[id]; ok {
+				matched[i] = true
+			}
+		}
+		if list, ok := d["media_ids"].([]any); ok {
+			for _, v := range list {
+				if id, ok := num(v); ok {
+					if i, ok := byID[id]; ok {
+						matched[i] = true
+					}
+				}
+			}
+		}
+		if sum, ok := d["sha256"].(string); ok {
+			for _, i := range bySHA[sum] {
+				matched[i] = true
+			}
+		}
+		if path, ok := d["dest_path"].(string); ok {
+			if i, ok := byPath[path]; ok {
+				matched[i] = true
+			}
+		}
+		aid, hasAlbum := num(d["album_id"])
+		if hasAlbum && rec.Action == "guest_created" {
+			for i, id := range ids {
+				if slices.Contains(albums[id], aid) {
+					matched[i] = true
+				}
+			}
+		}
+		for i := range matched {
+			r.Items[i].Events = append(r.Items[i].Events, ev)
+		}
+		if albumID > 0 && hasAlbum && aid == albumID {
+			r.AlbumEvents = append(r.AlbumEvents, ev)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.Chain.HeadHash = prevHash
+
+	views, err := store.ListGuestAccessForMedia(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, v := range views {
+		if i, ok := byID[v.MediaID]; ok {
+			r.Items[i].GuestViews = append(r.Items[i].GuestViews, v)
+		}
+	}
+	return nil
+}
+
+// category groups actions into the headings a report is read by.
+func category(action string) string {
+	switch action {
+	case "file_ingested", "duplicate_skipped", "media_uploaded", "replication_applied":
+		return "ingest"
+	case "media_downloaded", "media_download_zip", "collection_exported":
+		return "download"
+	case "guest_created", "guest_revoked", "album_folder_opened", "album_published":
+		return "share"
+	case "album_created", "album_items_added", "album_items_removed", "album_renamed", "album_rules_changed", "album_deleted":
+		return "album"
+	case "media_edited":
+		return "edit"
+	case "attestation_exported":
+		return "attestation"
+	case "media_deleted", "media_purged", "media_purge_cancelled", "media_restored", "trash_purged":
+		return "delete"
+	case "custody_report_generated":
+		return "report"
+	}
+	return "other"
+}
+
+// summary is a one-line description for printing.
+func summary(loc *i18n.Locale, actor, action string, d map[string]any) string {
+	str := func(k string) string { s, _ := d[k].(string); return s }
+	switch action {
+	case "file_ingested":
+		return loc.Tf("Ingested from %s to %s", str("source_path"), str("dest_path"))
+	case "duplicate_skipped":
+		return loc.Tf("Same content seen again at %s and skipped", str("source_path"))
+	case "media_downloaded":
+		return loc.Tf("Original downloaded by %s from %s", actor, str("ip"))
+	case "media_download_zip":
+		return loc.Tf("Included in a zip download by %s", actor)
+	case "collection_exported":
+		return loc.Tf("Exported to collections drive %s by %s", str("folder"), actor)
+	case "guest_created":
+		return loc.Tf("Shared with guest %s until %s", str("username"), loc.Timestamp(str("expires_at")))
+	case "guest_revoked":
+		return loc.Tf("Guest access revoked by %s", actor)
+	case "album_folder_opened":
+		return loc.Tf("Album folder opened by %s", actor)
+	case "album_published":
+		return loc.Tf("Published to %s by %s", str("destination"), actor)
+	case "album_created":
+		return loc.Tf("Album %q created by %s", str("name"), actor)
+	case "album_items_added":
+		return loc.Tf("Added to album by %s", actor)
+	case "album_items_removed":
+		return loc.Tf("Removed from album by %s", actor)
+	case "album_renamed":
+		return loc.Tf("Album renamed from %q to %q by %s", str("old_name"), str("name"), actor)
+	case "album_rules_changed":
+		return loc.Tf("Smart album rules changed by %s", actor)
+	case "album_deleted":
+		return loc.Tf("Album %q deleted by %s", str("name"), actor)
+	case "media_edited":
+		return loc.Tf("Metadata edited by %s", actor)
+	case "attestation_exported":
+		return loc.Tf("Integrity attestation issued to %s", actor)
+	case "media_deleted":
+		if at := str("purge_after"); at != "" {
+			return loc.Tf("Removed from the library by %s, bytes to be purged after %s", actor, loc.Timestamp(at))
+		}
+		if trash, _ := d["trash"].(bool); trash {
+			return loc.Tf("Moved to the trash by %s", actor)
+		}
+		return loc.Tf("Deleted by %s", actor)
+	case "media_purged":
+		return loc.T("Bytes purged from storage")
+	case "media_purge_cancelled":
+		return loc.Tf("Purge cancelled and restored to the library by %s", actor)
+	case "media_restored":
+		return loc.Tf("Restored from the trash by %s", actor)
+	case "trash_purged":
+		return loc.T("Bytes purged from the trash")
+	case "custody_report_generated":
+		return loc.Tf("Custody report generated by %s", actor)
+	}
+	return loc.Tf("%s by %s", action, actor)
+}
+
+// num reads a JSON number as an id.
+func num(v any) (int64, bool) {
+	f, ok := v.(float64)
+	if !ok || f != float64(int64(f)) {
+		return 0, false
+	}
+	return int64(f), true
+}
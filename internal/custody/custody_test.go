@@ -0,0 +1,104 @@
+package custody
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/i18n"
+)
+
+func TestAlbumReportCollectsTrailAndChecksChain(t *testing.T) {
+	ctx := context.Background()
+	store, err := db.Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer store.Close()
+	log := audit.New(store)
+
+	ids := make([]int64, 2)
+	for i := range ids {
+		rec := &db.MediaRecord{
+			Kind:        "video",
+			FileName:    fmt.Sprintf("GX01000%d.MP4", i),
+			Extension:   ".mp4",
+			SourceMount: "/Volumes/Test",
+			SourcePath:  fmt.Sprintf("/DCIM/GX01000%d.MP4", i),
+			DestPath:    fmt.Sprintf("/library/GX01000%d.MP4", i),
+			SizeBytes:   10,
+			CRC32:       "00000000",
+			SHA256:      fmt.Sprintf("%064x", i+1),
+			CaptureTime: "2026-03-10T12:00:00Z",
+			Metadata:    "{}",
+			SourceMTime: "2026-03-10T12:00:00Z",
+			IngestedAt:  "2026-03-11T08:00:00Z",
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		ids[i] = rec.ID
+		_ = log.Log(ctx, "usb", "file_ingested", map[string]any{"media_id": rec.ID, "sha256": rec.SHA256, "dest_path": rec.DestPath})
+	}
+	album, err := store.CreateAlbum(ctx, "Claim 42")
+	if err != nil {
+		t.Fatalf("CreateAlbum: %v", err)
+	}
+	if _, _, err := store.AddMediaToAlbum(ctx, album.ID, ids); err != nil {
+		t.Fatalf("AddMediaToAlbum: %v", err)
+	}
+	_ = log.Log(ctx, "admin", "album_items_added", map[string]any{"album_id": album.ID, "media_ids": ids})
+	_ = log.Log(ctx, "admin", "media_downloaded", map[string]any{"media_id": ids[0], "ip": "10.0.0.5"})
+	_ = log.Log(ctx, "admin", "guest_created", map[string]any{"guest_id": 9, "username": "adjuster", "album_id": album.ID})
+	_ = log.Log(ctx, "admin", "login", map[string]any{"ip": "10.0.0.5"})
+
+	r, err := ForAlbum(ctx, store, album.ID, "admin")
+	if err != nil {
+		t.Fatalf("ForAlbum: %v", err)
+	}
+	if !r.Chain.Intact || r.Chain.Entries != 6 {
+		t.Fatalf("chain = %+v", r.Chain)
+	}
+	if len(r.Items) != 2 || len(r.AlbumEvents) != 2 {
+		t.Fatalf("items = %d, album events = %d", len(r.Items), len(r.AlbumEvents))
+	}
+	var got []string
+	for _, ev := range r.Items[0].Events {
+		if !ev.Verified {
+			t.Errorf("event %d not verified", ev.AuditID)
+		}
+		got = append(got, ev.Category)
+	}
+	if fmt.Sprint(got) != "[ingest album download share]" {
+		t.Fatalf("first item categories = %v", got)
+	}
+	if n := len(r.Items[1].Events); n != 3 {
+		t.Fatalf("second item has %d events, want ingest, album, and share", n)
+	}
+
+	if _, err := store.DB.ExecContext(ctx, `UPDATE audit_logs SET actor = 'someone' WHERE action = 'media_downloaded'`); err != nil {
+		t.Fatal(err)
+	}
+	r, err = ForMedia(ctx, store, ids[0], "admin")
+	if err != nil {
+		t.Fatalf("ForMedia: %v", err)
+	}
+	if r.Chain.Intact || r.Chain.BrokenAt != r.Items[0].Events[2].AuditID || r.Items[0].Events[2].Verified {
+		t.Fatalf("tampered chain = %+v, event %+v", r.Chain, r.Items[0].Events[2])
+	}
+
+	es, _ := i18n.Lookup("es")
+	r, err = ForMedia(i18n.WithLocale(ctx, es), store, ids[0], "admin")
+	if err != nil {
+		t.Fatalf("ForMedia(es): %v", err)
+	}
+	if r.Locale != "es" || r.Title != "Cadena de custodia: "+r.Items[0].Media.FileName || r.Items[0].Events[2].Summary != "Original descargado por someone desde 10.0.0.5" {
+		t.Fatalf("localized report = %q %q %q", r.Locale, r.Title, r.Items[0].Events[2].Summary)
+	}
+	if r.Items[0].Events[2].TSText == "" || r.Items[0].Events[2].TSText == r.Items[0].Events[2].TS {
+		t.Fatalf("ts_text = %q", r.Items[0].Events[2].TSText)
+	}
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// APIToken is a long-lived bearer token a user made for scripts and other
+// headless clients. Only its hash is stored; Prefix is the start of the
+// token, kept so the owner can tell tokens apart.
+type APIToken struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Prefix     string `json:"prefix"`
+	CreatedAt  string `json:"created_at"`
+	ExpiresAt  string `json:"expires_at"` // "" for a token that never expires
+	LastUsedAt string `json:"last_used_at"`
+}
+
+// apiTokenTouchInterval limits how often last_used_at is written for a
+// token in steady use.
+const apiTokenTouchInterval = time.Minute
+
+// CreateAPIToken stores a new token for userID. A zero expiresAt never
+// expires.
+func (s *Store) CreateAPIToken(ctx context.Context, userID int64, name, prefix, tokenHash string, expiresAt time.Time) (*APIToken, error) {
+	t := &APIToken{Name: name, Prefix: prefix, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	if !expiresAt.IsZero() {
+		t.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	}
+	res, err := s.DB.ExecContext(ctx,
+		`INSERT INTO api_tokens (user_id, name, prefix, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, t.Name, t.Prefix, tokenHash, t.CreatedAt, t.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if t.ID, err = res.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ListAPITokens returns the tokens of userID, newest first.
+func (s *Store) ListAPITokens(ctx context.Context, userID int64) ([]APIToken, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, name, prefix, created_at, expires_at, last_used_at
+		FROM api_tokens WHERE user_id = ? ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]APIToken, 0)
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// DeleteAPIToken revokes a token of userID and returns its name, or ""
+// when userID has no such token.
+func (s *Store) DeleteAPIToken(ctx context.Context, userID, id int64) (string, error) {
+	var name string
+	err := s.DB.QueryRowContext(ctx, `SELECT name FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = s.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	return name, err
+}
+
+// LookupAPIToken resolves a token hash to the session of its owner, or nil
+// when the token is unknown or expired, or the account has expired. It
+// records when the token was last used.
+func (s *Store) LookupAPIToken(ctx context.Context, tokenHash string) (*Session, error) {
+	row := s.reader().QueryRowContext(ctx,
+		`SELECT t.id, t.expires_at, t.last_used_at, u.id, u.username, u.role, u.expires_at, u.scope_album_id, COALESCE(u.watermark, ''), u.strip_gps
+		 FROM api_tokens t JOIN users u ON u.id = t.user_id
+		 WHERE t.token_hash = ?`,
+		tokenHash,
+	)
+	var (
+		session       Session
+		id            int64
+		expiresAt     string
+		lastUsedAt    string
+		userExpiresAt sql.NullString
+		scope         sql.NullInt64
+	)
+	if err := row.Scan(&id, &expiresAt, &lastUsedAt, &session.UserID, &session.Username, &session.Role, &userExpiresAt, &scope, &session.Watermark, &session.StripGPS); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if expiresAt != "" {
+		parsed, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		if !now.Before(parsed) {
+			return nil, nil
+		}
+		session.ExpiresAt = parsed
+	}
+	if userExpiresAt.Valid {
+		if accountExpiry, err := time.Parse(time.RFC3339, userExpiresAt.String); err == nil && !now.Before(accountExpiry) {
+			return nil, nil
+		}
+	}
+	session.ScopeAlbumID = scope.Int64
+	if last, err := time.Parse(time.RFC3339, lastUsedAt); err != nil || now.Sub(last) >= apiTokenTouchInterval {
+		s.touch(ctx, `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now.Format(time.RFC3339), id)
+	}
+	return &session, nil
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TagSourceAuto marks media_tags rows written by the auto-tagger. They are
+// replaced on every rescan and filtered separately from user tags.
+const TagSourceAuto = "auto"
+
+type AutoTagTodo struct {
+	ID        int64
+	DestPath  string
+	Extension string
+}
+
+type AutoTagGroup struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// ListAutoTagTodos returns images the auto-tagger has not seen, oldest
+// first.
+func (s *Store) ListAutoTagTodos(ctx context.Context, limit int) ([]AutoTagTodo, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, dest_path, extension
+		FROM media_files
+		WHERE kind = 'image' AND id NOT IN (SELECT media_id FROM autotag_scans)
+		ORDER BY id ASC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]AutoTagTodo, 0)
+	for rows.Next() {
+		var t AutoTagTodo
+		if err := rows.Scan(&t.ID, &t.DestPath, &t.Extension); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CountAutoTagTodos(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(1) FROM media_files
+		WHERE kind = 'image' AND id NOT IN (SELECT media_id FROM autotag_scans)
+	`).Scan(&n)
+	return n, err
+}
+
+// RecordAutoTags replaces the machine labels on a media item and marks it
+// scanned. Labels that collide with an existing user or rule tag are left
+// to that tag. scanErr notes why an image could not be classified.
+func (s *Store) RecordAutoTags(ctx context.Context, mediaID int64, labels []string, scanErr string) (err error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err = tx.ExecContext(ctx, `DELETE FROM media_tags WHERE media_id = ? AND source = ?`, mediaID, TagSourceAuto); err != nil {
+		return err
+	}
+	for _, label := range labels {
+		if _, err = tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO media_tags (media_id, tag, source, created_at) VALUES (?, ?, ?, ?)`,
+			mediaID, label, TagSourceAuto, now,
+		); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO autotag_scans (media_id, scanned_at, labels, error) VALUES (?, ?, ?, ?)
+		ON CONFLICT(media_id) DO UPDATE SET scanned_at = excluded.scanned_at, labels = excluded.labels, error = excluded.error
+	`, mediaID, now, len(labels), nullable(scanErr)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetAutoTags forgets every auto-tag scan so the next pass reclassifies
+// the whole library, for example after the model is replaced. Existing
+// labels stay until each image is rescanned.
+func (s *Store) ResetAutoTags(ctx context.Context) (int64, error) {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM autotag_scans`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ListAutoTagGroups is the machine label facet for media matching filter.
+func (s *Store) ListAutoTagGroups(ctx context.Context, filter MediaFilter, limit int) ([]AutoTagGroup, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	where, args := buildLocationWhere(filter)
+	query := fmt.Sprintf(`
+		SELECT tag, COUNT(1)
+		FROM media_tags
+		WHERE source = ? AND media_id IN (SELECT id FROM media_files WHERE %s)
+		GROUP BY tag
+		ORDER BY COUNT(1) DESC, tag ASC
+		LIMIT ?
+	`, where)
+	args = append([]any{TagSourceAuto}, args...)
+	args = append(args, limit)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]AutoTagGroup, 0)
+	for rows.Next() {
+		var g AutoTagGroup
+		if err := rows.Scan(&g.Tag, &g.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+)
+
+// BackupManifestEntry is one library file an archive destination already
+// holds. SHA256 is the media hash for files in media_files and empty for
+// other files, which are matched on size and modification time instead.
+type BackupManifestEntry struct {
+	Path       string `json:"path"` // slash path relative to base storage
+	SHA256     string `json:"sha256,omitempty"`
+	Size       int64  `json:"size"`
+	ModTimeNS  int64  `json:"mod_time_ns"`
+	BackedUpAt string `json:"backed_up_at"`
+}
+
+// Same reports whether e and o describe the same file contents.
+func (e BackupManifestEntry) Same(o BackupManifestEntry) bool {
+	if e.Size != o.Size || e.SHA256 != o.SHA256 {
+		return false
+	}
+	return e.SHA256 != "" || e.ModTimeNS == o.ModTimeNS
+}
+
+// BackupManifest returns the files recorded for target, keyed by path.
+func (s *Store) BackupManifest(ctx context.Context, target string) (map[string]BackupManifestEntry, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT path, sha256, size, mod_time_ns, backed_up_at
+		FROM backup_manifest
+		WHERE target = ?`, target)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]BackupManifestEntry)
+	for rows.Next() {
+		var e BackupManifestEntry
+		if err := rows.Scan(&e.Path, &e.SHA256, &e.Size, &e.ModTimeNS, &e.BackedUpAt); err != nil {
+			return nil, err
+		}
+		out[e.Path] = e
+	}
+	return out, rows.Err()
+}
+
+// UpdateBackupManifest records the files a run sent to target and drops
+// entries whose path is no longer in present, so the manifest follows the
+// library as files are deleted.
+func (s *Store) UpdateBackupManifest(ctx context.Context, target string, sent []BackupManifestEntry, present map[string]struct{}) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT path FROM backup_manifest WHERE target = ?`, target)
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, ok := present[p]; !ok {
+			stale = append(stale, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, p := range stale {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM backup_manifest WHERE target = ? AND path = ?`, target, p); err != nil {
+			return err
+		}
+	}
+	for _, e := range sent {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR REPLACE INTO backup_manifest (target, path, sha256, size, mod_time_ns, backed_up_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			target, e.Path, e.SHA256, e.Size, e.ModTimeNS, e.BackedUpAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+)
+
+// storageBenchmarkKeep is how many benchmark results are kept.
+const storageBenchmarkKeep = 200
+
+// StorageBenchmark is one sequential write and read-back run on the storage
+// drive or an attached card.
+type StorageBenchmark struct {
+	ID           int64   `json:"id"`
+	Target       string  `json:"target"` // storage or mount
+	Path         string  `json:"path"`
+	FSType       string  `json:"fs_type,omitempty"`
+	StartedAt    string  `json:"started_at"`
+	Bytes        int64   `json:"bytes"`
+	WriteSeconds float64 `json:"write_seconds"`
+	ReadSeconds  float64 `json:"read_seconds"`
+	WriteMBps    float64 `json:"write_mbps"`
+	ReadMBps     float64 `json:"read_mbps"`
+	State        string  `json:"state"` // success or error
+	Message      string  `json:"message"`
+	RequestedBy  string  `json:"requested_by"`
+}
+
+// InsertStorageBenchmark stores a result and drops the oldest beyond
+// storageBenchmarkKeep.
+func (s *Store) InsertStorageBenchmark(ctx context.Context, b *StorageBenchmark) error {
+	res, err := s.DB.ExecContext(ctx, `
+		INSERT INTO storage_benchmarks
+			(target, path, fs_type, started_at, bytes, write_seconds, read_seconds, write_mbps, read_mbps, state, message, requested_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.Target, b.Path, b.FSType, b.StartedAt, b.Bytes, b.WriteSeconds, b.ReadSeconds, b.WriteMBps, b.ReadMBps,
+		b.State, b.Message, b.RequestedBy)
+	if err != nil {
+		return err
+	}
+	if b.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, `
+		DELETE FROM storage_benchmarks
+		WHERE id NOT IN (SELECT id FROM storage_benchmarks ORDER BY id DESC LIMIT ?)`, storageBenchmarkKeep)
+	return err
+}
+
+// ListStorageBenchmarks returns results newest first.
+func (s *Store) ListStorageBenchmarks(ctx context.Context, limit int) ([]StorageBenchmark, error) {
+	if limit <= 0 || limit > storageBenchmarkKeep {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, target, path, fs_type, started_at, bytes, write_seconds, read_seconds, write_mbps, read_mbps, state, message, requested_by
+		FROM storage_benchmarks
+		ORDER BY id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]StorageBenchmark, 0)
+	for rows.Next() {
+		var b StorageBenchmark
+		if err := rows.Scan(&b.ID, &b.Target, &b.Path, &b.FSType, &b.StartedAt, &b.Bytes, &b.WriteSeconds, &b.ReadSeconds,
+			&b.WriteMBps, &b.ReadMBps, &b.State, &b.Message, &b.RequestedBy); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
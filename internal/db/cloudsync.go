@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CloudSyncCounts is where the media matching a cloud sync rule stand with
+// one target.
+type CloudSyncCounts struct {
+	Synced       int64 `json:"synced"`
+	SyncedBytes  int64 `json:"synced_bytes"`
+	Pending      int64 `json:"pending"`
+	PendingBytes int64 `json:"pending_bytes"`
+	// Failed counts files that failed maxAttempts times in a row and are
+	// not tried again until their content or the configuration changes.
+	Failed int64 `json:"failed"`
+}
+
+// cloudSyncSettled matches media rows that need nothing more for target:
+// the current content was uploaded, or failed too often. A file whose
+// content changed since, as after an edit, is due again.
+const cloudSyncSettled = `EXISTS (SELECT 1 FROM cloud_sync_files c
+	WHERE c.media_id = media_files.id AND c.target = ? AND c.sha256 = media_files.sha256
+	AND (c.status = 'done' OR c.attempts >= ?))`
+
+// anyFilterWhere builds a condition matching media that match any of
+// filters; none matches nothing.
+func (s *Store) anyFilterWhere(ctx context.Context, filters []MediaFilter) (string, []any, error) {
+	if len(filters) == 0 {
+		return "0", nil, nil
+	}
+	clauses := make([]string, 0, len(filters))
+	args := make([]any, 0)
+	for _, filter := range filters {
+		if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+			return "", nil, err
+		}
+		where, filterArgs := buildLocationWhere(filter)
+		clauses = append(clauses, "("+where+")")
+		args = append(args, filterArgs...)
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args, nil
+}
+
+// ListCloudSyncPending returns up to limit media matching any of filters
+// that are due for upload to target, in id order from after afterID.
+func (s *Store) ListCloudSyncPending(ctx context.Context, filters []MediaFilter, target string, maxAttempts int, afterID int64, limit int) ([]MediaRecord, error) {
+	where, args, err := s.anyFilterWhere(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, afterID, target, maxAttempts, limit)
+	rows, err := s.reader().QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM media_files
+		WHERE %s AND id > ? AND NOT %s
+		ORDER BY id LIMIT ?
+	`, mediaSelectColumns, where, cloudSyncSettled), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]MediaRecord, 0)
+	for rows.Next() {
+		var rec MediaRecord
+		if err := s.scanMediaRecord(rows, &rec); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// CountCloudSync sums up the media matching any of filters by where they
+// stand with target.
+func (s *Store) CountCloudSync(ctx context.Context, filters []MediaFilter, target string, maxAttempts int) (CloudSyncCounts, error) {
+	var out CloudSyncCounts
+	where, args, err := s.anyFilterWhere(ctx, filters)
+	if err != nil {
+		return out, err
+	}
+	args = append([]any{maxAttempts, maxAttempts}, args...)
+	args = append(args, target)
+	var total, totalBytes, failedBytes int64
+	err = s.reader().QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT
+			COUNT(m.id),
+			COALESCE(SUM(m.size_bytes), 0),
+			COALESCE(SUM(c.status = 'done'), 0),
+			COALESCE(SUM(CASE WHEN c.status = 'done' THEN m.size_bytes END), 0),
+			COALESCE(SUM(c.status = 'failed' AND c.attempts >= ?), 0),
+			COALESCE(SUM(CASE WHEN c.status = 'failed' AND c.attempts >= ? THEN m.size_bytes END), 0)
+		FROM (SELECT id, sha256, size_bytes FROM media_files WHERE %s) m
+		LEFT JOIN cloud_sync_files c ON c.media_id = m.id AND c.target = ? AND c.sha256 = m.sha256
+	`, where), args...).Scan(&total, &totalBytes, &out.Synced, &out.SyncedBytes, &out.Failed, &failedBytes)
+	out.Pending = total - out.Synced - out.Failed
+	out.PendingBytes = totalBytes - out.SyncedBytes - failedBytes
+	return out, err
+}
+
+// RecordCloudSync notes how uploading the content sha256 of a media item
+// to target went. A failure counts towards the attempts on that content;
+// a success, or new content, starts the count again.
+func (s *Store) RecordCloudSync(ctx context.Context, mediaID int64, target, remoteName, sha256 string, runErr error) error {
+	status, lastError := "done", ""
+	if runErr != nil {
+		status, lastError = "failed", runErr.Error()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO cloud_sync_files (media_id, target, remote_name, sha256, status, attempts, last_error, updated_at)
+		VALUES (?, ?, ?, ?, ?, CASE WHEN ? = 'failed' THEN 1 ELSE 0 END, ?, ?)
+		ON CONFLICT(media_id, target) DO UPDATE SET
+			remote_name = excluded.remote_name,
+			attempts = CASE
+				WHEN excluded.status = 'done' THEN 0
+				WHEN cloud_sync_files.sha256 = excluded.sha256 AND cloud_sync_files.status = 'failed' THEN cloud_sync_files.attempts + 1
+				ELSE 1 END,
+			sha256 = excluded.sha256,
+			status = excluded.status,
+			last_error = excluded.last_error,
+			updated_at = excluded.updated_at
+	`, mediaID, target, remoteName, sha256, status, status, lastError, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// ResetCloudSyncFailures lets files that failed too often be tried again,
+// as after the credentials were fixed.
+func (s *Store) ResetCloudSyncFailures(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.DB.ExecContext(ctx, `UPDATE cloud_sync_files SET attempts = 0 WHERE status = 'failed' AND attempts > 0`)
+	return err
+}
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// CoverageRoad is a road with located media inside the bounds, none of
+// them captured in the date range asked about.
+type CoverageRoad struct {
+	State  string  `json:"state"`
+	County string  `json:"county"`
+	City   string  `json:"city"`
+	Road   string  `json:"road"`
+	Lat    float64 `json:"lat"` // mean position of the road's media
+	Lon    float64 `json:"lon"`
+	// Bounds of the road's media, as [south, west, north, east].
+	Bounds [4]float64 `json:"bounds"`
+	Count  int64      `json:"count"` // media on the road at any time
+	// LastCapture is the newest capture time on the road, which falls
+	// outside the range.
+	LastCapture string `json:"last_capture,omitempty"`
+}
+
+// CoverageCell is a grid cell of the bounds with no media captured in the
+// date range. Count is what it holds from other times; 0 means it was
+// never covered.
+type CoverageCell struct {
+	Bounds      [4]float64 `json:"bounds"` // [south, west, north, east]
+	Count       int64      `json:"count"`
+	LastCapture string     `json:"last_capture,omitempty"`
+}
+
+// CoverageGaps is what ListCoverageGaps finds.
+type CoverageGaps struct {
+	Roads []CoverageRoad `json:"roads"`
+	// RoadsSeen is every road with located media in the bounds, covered
+	// or not.
+	RoadsSeen int            `json:"roads_seen"`
+	Truncated bool           `json:"truncated"` // limit left roads out
+	CellDeg   float64        `json:"cell_deg"`
+	Cells     []CoverageCell `json:"cells"`
+	// CellsTotal is the number of cells in the grid.
+	CellsTotal int `json:"cells_total"`
+}
+
+// MaxCoverageCells is the most cells a side of the coverage grid may have.
+const MaxCoverageCells = 64
+
+// ListCoverageGaps reports the roads and the grid cells inside bounds that
+// have no media matching filter captured between from and to. Roads are the
+// ones geocoded media in bounds were found on, at any time; the oldest
+// covered come first, and at most limit are returned. The grid has cells
+// squares along the longer side of bounds.
+func (s *Store) ListCoverageGaps(ctx context.Context, bounds MapBounds, from, to string, cells, limit int, filter MediaFilter) (*CoverageGaps, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if from == "" && to == "" {
+		return nil, errors.New("a date range is required")
+	}
+	if cells <= 0 || cells > MaxCoverageCells {
+		return nil, fmt.Errorf("invalid grid size %d", cells)
+	}
+	if limit <= 0 || limit > 5000 {
+		limit = 500
+	}
+
+	// The range is counted, not filtered on, so roads and cells covered
+	// only at other times still show up.
+	var (
+		inRange   []string
+		rangeArgs []any
+	)
+	if from != "" {
+		inRange = append(inRange, "capture_time >= ?")
+		rangeArgs = append(rangeArgs, from)
+	}
+	if to != "" {
+		inRange = append(inRange, "capture_time <= ?")
+		rangeArgs = append(rangeArgs, to)
+	}
+	inRangeExpr := "SUM(CASE WHEN " + strings.Join(inRange, " AND ") + " THEN 1 ELSE 0 END)"
+
+	filter.CaptureFrom, filter.CaptureTo = "", ""
+	where, args := buildLocationWhere(filter)
+	lonClause := "gps_lon BETWEEN ? AND ?"
+	if bounds.West > bounds.East {
+		lonClause = "(gps_lon >= ? OR gps_lon <= ?)"
+	}
+	located := fmt.Sprintf(`gps_lat IS NOT NULL AND gps_lon IS NOT NULL
+		AND gps_lat BETWEEN ? AND ? AND %s AND %s`, lonClause, where)
+	locatedArgs := append([]any{bounds.South, bounds.North, bounds.West, bounds.East}, args...)
+
+	out := &CoverageGaps{Roads: []CoverageRoad{}, Cells: []CoverageCell{}}
+	if err := s.coverageRoads(ctx, out, inRangeExpr, rangeArgs, located, locatedArgs); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(out.Roads, func(i, j int) bool { return out.Roads[i].LastCapture < out.Roads[j].LastCapture })
+	if len(out.Roads) > limit {
+		out.Roads = out.Roads[:limit]
+		out.Truncated = true
+	}
+	if err := s.coverageCells(ctx, out, bounds, cells, inRangeExpr, rangeArgs, located, locatedArgs); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) coverageRoads(ctx context.Context, out *CoverageGaps, inRangeExpr string, rangeArgs []any, located string, locatedArgs []any) error {
+	query := fmt.Sprintf(`
+		SELECT COALESCE(loc_state, ''), COALESCE(loc_county, ''), COALESCE(loc_city, ''), loc_road,
+			COUNT(*), AVG(gps_lat), AVG(gps_lon),
+			MIN(gps_lat), MIN(gps_lon), MAX(gps_lat), MAX(gps_lon),
+			COALESCE(MAX(capture_time), ''), %s
+		FROM media_files
+		WHERE COALESCE(TRIM(loc_road), '') <> '' AND %s
+		GROUP BY 1, 2, 3, 4
+		ORDER BY 1, 2, 3, 4
+	`, inRangeExpr, located)
+	rows, err := s.DB.QueryContext(ctx, query, append(append([]any{}, rangeArgs...), locatedArgs...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			r       CoverageRoad
+			inRange int64
+		)
+		if err := rows.Scan(&r.State, &r.County, &r.City, &r.Road, &r.Count, &r.Lat, &r.Lon,
+			&r.Bounds[0], &r.Bounds[1], &r.Bounds[2], &r.Bounds[3], &r.LastCapture, &inRange); err != nil {
+			return err
+		}
+		out.RoadsSeen++
+		if inRange == 0 {
+			out.Roads = append(out.Roads, r)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *Store) coverageCells(ctx context.Context, out *CoverageGaps, bounds MapBounds, cells int, inRangeExpr string, rangeArgs []any, located string, locatedArgs []any) error {
+	lonSpan := bounds.East - bounds.West
+	if lonSpan < 0 {
+		lonSpan += 360
+	}
+	latSpan := bounds.North - bounds.South
+	deg := math.Max(lonSpan, latSpan) / float64(cells)
+	if deg <= 0 {
+		return errors.New("bounds have no area")
+	}
+	nx := max(1, int(math.Ceil(lonSpan/deg-1e-9)))
+	ny := max(1, int(math.Ceil(latSpan/deg-1e-9)))
+	out.CellDeg = deg
+	out.CellsTotal = nx * ny
+
+	// Longitudes are measured east of the west edge, so a box across the
+	// antimeridian counts on past 180.
+	query := fmt.Sprintf(`
+		SELECT CAST((CASE WHEN gps_lon >= ? THEN gps_lon - ? ELSE gps_lon - ? + 360.0 END) / ? AS INTEGER),
+			CAST((gps_lat - ?) / ? AS INTEGER),
+			COUNT(*), COALESCE(MAX(capture_time), ''), %s
+		FROM media_files
+		WHERE %s
+		GROUP BY 1, 2
+	`, inRangeExpr, located)
+	args := []any{bounds.West, bounds.West, bounds.West, deg, bounds.South, deg}
+	args = append(append(args, rangeArgs...), locatedArgs...)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type tally struct {
+		count, inRange int64
+		last           string
+	}
+	grid := make(map[[2]int]*tally)
+	for rows.Next() {
+		var (
+			cx, cy int
+			t      tally
+		)
+		if err := rows.Scan(&cx, &cy, &t.count, &t.last, &t.inRange); err != nil {
+			return err
+		}
+		// Media on the north or east edge belong to the last cell.
+		key := [2]int{min(cx, nx-1), min(cy, ny-1)}
+		if g := grid[key]; g != nil {
+			g.count += t.count
+			g.inRange += t.inRange
+			g.last = max(g.last, t.last)
+		} else {
+			grid[key] = &t
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for cy := range ny {
+		for cx := range nx {
+			cell := CoverageCell{}
+			if g := grid[[2]int{cx, cy}]; g != nil {
+				if g.inRange > 0 {
+					continue
+				}
+				cell.Count, cell.LastCapture = g.count, g.last
+			}
+			south := bounds.South + float64(cy)*deg
+			west := bounds.West + float64(cx)*deg
+			if west >= 180 {
+				west -= 360
+			}
+			cell.Bounds = [4]float64{south, west, math.Min(south+deg, bounds.North), west + math.Min(deg, lonSpan-float64(cx)*deg)}
+			out.Cells = append(out.Cells, cell)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// WalkAudit calls fn with every audit entry and the hash it was chained to,
+// oldest first.
+func (s *Store) WalkAudit(ctx context.Context, fn func(rec AuditRecord, prevHash string) error) error {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, ts, actor, action, details_json, prev_hash, entry_hash
+		FROM audit_logs
+		ORDER BY id ASC`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			rec  AuditRecord
+			prev string
+		)
+		if err := rows.Scan(&rec.ID, &rec.TS, &rec.Actor, &rec.Action, &rec.Details, &prev, &rec.Hash); err != nil {
+			return err
+		}
+		if err := fn(rec, prev); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ListGuestAccessForMedia returns guest requests that served any of ids,
+// oldest first.
+func (s *Store) ListGuestAccessForMedia(ctx context.Context, ids []int64) ([]GuestAccess, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	query := fmt.Sprintf(`
+		SELECT id, guest_id, username, session, ip, user_agent, route, media_id, accessed_at
+		FROM guest_access
+		WHERE media_id IN (%s)
+		ORDER BY id ASC`, idPlaceholders(len(ids)))
+	rows, err := s.DB.QueryContext(ctx, query, idArgs(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]GuestAccess, 0)
+	for rows.Next() {
+		var (
+			e       GuestAccess
+			mediaID sql.NullInt64
+		)
+		if err := rows.Scan(&e.ID, &e.GuestID, &e.Username, &e.Session, &e.IP, &e.UserAgent, &e.Route, &mediaID, &e.AccessedAt); err != nil {
+			return nil, err
+		}
+		e.MediaID = mediaID.Int64
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// MediaAlbumIDs returns the albums each of ids belongs to.
+func (s *Store) MediaAlbumIDs(ctx context.Context, ids []int64) (map[int64][]int64, error) {
+	out := make(map[int64][]int64, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	query := fmt.Sprintf(`
+		SELECT media_id, album_id
+		FROM album_items
+		WHERE media_id IN (%s)
+		ORDER BY album_id ASC`, idPlaceholders(len(ids)))
+	rows, err := s.DB.QueryContext(ctx, query, idArgs(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mediaID, albumID int64
+		if err := rows.Scan(&mediaID, &albumID); err != nil {
+			return nil, err
+		}
+		out[mediaID] = append(out[mediaID], albumID)
+	}
+	return out, rows.Err()
+}
+
+func idPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func idArgs(ids []int64) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
@@ -0,0 +1,292 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Export entity types. Each maps to one table; keys identify a row across
+// vaults so consumers can upsert and delete idempotently.
+const (
+	ExportMedia      = "media"
+	ExportAlbum      = "album"
+	ExportAlbumItem  = "album_item"
+	ExportSmartAlbum = "smart_album"
+	ExportMediaTag   = "media_tag"
+	ExportAudit      = "audit"
+)
+
+type exportEntity struct {
+	name    string
+	table   string
+	keyCols []string
+}
+
+var exportEntities = []exportEntity{
+	{ExportMedia, "media_files", []string{"id"}},
+	{ExportAlbum, "albums", []string{"id"}},
+	{ExportAlbumItem, "album_items", []string{"album_id", "media_id"}},
+	{ExportSmartAlbum, "smart_albums", []string{"album_id"}},
+	{ExportMediaTag, "media_tags", []string{"media_id", "tag"}},
+	{ExportAudit, "audit_logs", []string{"id"}},
+}
+
+func ExportTypes() []string {
+	out := make([]string, 0, len(exportEntities))
+	for _, e := range exportEntities {
+		out = append(out, e.name)
+	}
+	return out
+}
+
+// ExportRow is one JSON Lines record. Upserts carry the full row; deletes
+// carry only the key.
+type ExportRow struct {
+	Type string         `json:"type"`
+	Op   string         `json:"op"`
+	Key  map[string]any `json:"key"`
+	Row  map[string]any `json:"row,omitempty"`
+}
+
+// ensureChangeTriggers records every insert, update, and delete of the
+// exported tables in change_log, whose seq is the export cursor. Keys are
+// stored as JSON arrays in keyCols order.
+func (s *Store) ensureChangeTriggers(ctx context.Context) error {
+	for _, e := range exportEntities {
+		newKey := keyExpr("NEW", e.keyCols)
+		oldKey := keyExpr("OLD", e.keyCols)
+		stmts := []string{
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS trg_%[1]s_changelog_ins AFTER INSERT ON %[1]s BEGIN
+				INSERT INTO change_log (entity, entity_key, op, changed_at) VALUES ('%[2]s', %[3]s, 'upsert', strftime('%%Y-%%m-%%dT%%H:%%M:%%fZ', 'now'));
+			END;`, e.table, e.name, newKey),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS trg_%[1]s_changelog_del AFTER DELETE ON %[1]s BEGIN
+				INSERT INTO change_log (entity, entity_key, op, changed_at) VALUES ('%[2]s', %[3]s, 'delete', strftime('%%Y-%%m-%%dT%%H:%%M:%%fZ', 'now'));
+			END;`, e.table, e.name, oldKey),
+		}
+		if e.name != ExportAudit {
+			stmts = append(stmts, fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS trg_%[1]s_changelog_upd AFTER UPDATE ON %[1]s BEGIN
+				INSERT INTO change_log (entity, entity_key, op, changed_at) VALUES ('%[2]s', %[3]s, 'upsert', strftime('%%Y-%%m-%%dT%%H:%%M:%%fZ', 'now'));
+			END;`, e.table, e.name, newKey))
+		}
+		for _, stmt := range stmts {
+			if _, err := s.DB.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("create change trigger on %s: %w", e.table, err)
+			}
+		}
+	}
+	return nil
+}
+
+func keyExpr(ref string, cols []string) string {
+	parts := make([]string, len(cols))
+	for i, c := range cols {
+		parts[i] = ref + "." + c
+	}
+	return "json_array(" + strings.Join(parts, ", ") + ")"
+}
+
+// ChangeCursor is the latest change_log sequence number.
+func (s *Store) ChangeCursor(ctx context.Context) (int64, error) {
+	var seq int64
+	err := s.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM change_log`).Scan(&seq)
+	return seq, err
+}
+
+// ExportChanges streams rows of the requested types that changed after
+// since, up to the cursor observed when the export began, which it returns.
+// since == 0 exports every current row. Rows may be newer than the returned
+// cursor; re-applying them on the next export is harmless.
+func (s *Store) ExportChanges(ctx context.Context, since int64, types []string, emit func(ExportRow) error) (int64, error) {
+	cursor, err := s.ChangeCursor(ctx)
+	if err != nil {
+		return 0, err
+	}
+	want := map[string]bool{}
+	for _, t := range types {
+		want[t] = true
+	}
+	for _, e := range exportEntities {
+		if len(want) > 0 && !want[e.name] {
+			continue
+		}
+		if since <= 0 {
+			err = s.exportAll(ctx, e, emit)
+		} else {
+			err = s.exportDelta(ctx, e, since, cursor, emit)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return cursor, nil
+}
+
+func (s *Store) exportAll(ctx context.Context, e exportEntity, emit func(ExportRow) error) error {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM %s ORDER BY %s`, e.table, strings.Join(e.keyCols, ", ")))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return scanExportRows(rows, e, func(row map[string]any) error {
+		return emit(ExportRow{Type: e.name, Op: "upsert", Key: rowKey(e, row), Row: row})
+	})
+}
+
+func (s *Store) exportDelta(ctx context.Context, e exportEntity, since, cursor int64, emit func(ExportRow) error) error {
+	// Collect keys first: with a single connection we cannot hold the
+	// change_log cursor open while loading rows.
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT entity_key FROM change_log
+		WHERE entity = ? AND seq > ? AND seq <= ?
+		GROUP BY entity_key
+		ORDER BY MAX(seq)
+	`, e.name, since, cursor)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0)
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			rows.Close()
+			return err
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	const batch = 200
+	for start := 0; start < len(keys); start += batch {
+		end := min(start+batch, len(keys))
+		chunk := keys[start:end]
+		found := map[string]map[string]any{}
+
+		// Filter on the leading key column so the primary key index is used;
+		// the full key is matched below.
+		seen := map[any]struct{}{}
+		args := make([]any, 0, len(chunk))
+		for _, k := range chunk {
+			var vals []any
+			if err := json.Unmarshal([]byte(k), &vals); err != nil || len(vals) == 0 {
+				continue
+			}
+			if _, ok := seen[vals[0]]; ok {
+				continue
+			}
+			seen[vals[0]] = struct{}{}
+			args = append(args, vals[0])
+		}
+		if len(args) == 0 {
+			continue
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+		q := fmt.Sprintf(`SELECT * FROM %s WHERE %s IN (%s)`, e.table, e.keyCols[0], placeholders)
+		rows, err := s.DB.QueryContext(ctx, q, args...)
+		if err != nil {
+			return err
+		}
+		err = scanExportRows(rows, e, func(row map[string]any) error {
+			raw, err := json.Marshal(keyValues(e, row))
+			if err != nil {
+				return err
+			}
+			found[string(raw)] = row
+			return nil
+		})
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, k := range chunk {
+			if row, ok := found[normalizeKey(k)]; ok {
+				if err := emit(ExportRow{Type: e.name, Op: "upsert", Key: rowKey(e, row), Row: row}); err != nil {
+					return err
+				}
+				continue
+			}
+			var vals []any
+			if err := json.Unmarshal([]byte(k), &vals); err != nil || len(vals) != len(e.keyCols) {
+				continue
+			}
+			key := map[string]any{}
+			for i, c := range e.keyCols {
+				key[c] = vals[i]
+			}
+			if err := emit(ExportRow{Type: e.name, Op: "delete", Key: key}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeKey re-encodes a json_array key the way encoding/json would.
+func normalizeKey(k string) string {
+	var vals []any
+	if err := json.Unmarshal([]byte(k), &vals); err != nil {
+		return k
+	}
+	raw, err := json.Marshal(vals)
+	if err != nil {
+		return k
+	}
+	return string(raw)
+}
+
+type exportRows interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+}
+
+func scanExportRows(rows exportRows, e exportEntity, fn func(map[string]any) error) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		row := make(map[string]any, len(cols))
+		for i, c := range cols {
+			if b, ok := vals[i].([]byte); ok {
+				row[c] = string(b)
+				continue
+			}
+			row[c] = vals[i]
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func keyValues(e exportEntity, row map[string]any) []any {
+	out := make([]any, len(e.keyCols))
+	for i, c := range e.keyCols {
+		out[i] = row[c]
+	}
+	return out
+}
+
+func rowKey(e exportEntity, row map[string]any) map[string]any {
+	key := make(map[string]any, len(e.keyCols))
+	for _, c := range e.keyCols {
+		key[c] = row[c]
+	}
+	return key
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExportChangesFullThenDelta(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+
+	ids := make([]int64, 0, 3)
+	for i := 1; i <= 3; i++ {
+		rec := &MediaRecord{
+			Kind:        "image",
+			FileName:    fmt.Sprintf("IMG_%04d.JPG", i),
+			Extension:   ".jpg",
+			SourceMount: "/Volumes/Test",
+			SourcePath:  fmt.Sprintf("/DCIM/%04d.JPG", i),
+			DestPath:    fmt.Sprintf("/tmp/usbvault/%04d.JPG", i),
+			SizeBytes:   int64(1000 + i),
+			CRC32:       fmt.Sprintf("%08x", i),
+			SHA256:      fmt.Sprintf("%064x", i),
+			CaptureTime: ts,
+			Metadata:    "{}",
+			SourceMTime: ts,
+			IngestedAt:  ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		ids = append(ids, rec.ID)
+	}
+	album, err := store.CreateAlbum(ctx, "Trip")
+	if err != nil {
+		t.Fatalf("CreateAlbum: %v", err)
+	}
+	if _, _, err := store.AddMediaToAlbum(ctx, album.ID, ids[:2]); err != nil {
+		t.Fatalf("AddMediaToAlbum: %v", err)
+	}
+
+	collect := func(since int64, types ...string) ([]ExportRow, int64) {
+		t.Helper()
+		var rows []ExportRow
+		cursor, err := store.ExportChanges(ctx, since, types, func(r ExportRow) error {
+			rows = append(rows, r)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ExportChanges(%d): %v", since, err)
+		}
+		return rows, cursor
+	}
+
+	full, cursor := collect(0)
+	counts := map[string]int{}
+	for _, r := range full {
+		if r.Op != "upsert" {
+			t.Fatalf("full export op = %s", r.Op)
+		}
+		counts[r.Type]++
+	}
+	if counts[ExportMedia] != 3 || counts[ExportAlbum] != 1 || counts[ExportAlbumItem] != 2 {
+		t.Fatalf("full export counts = %v", counts)
+	}
+	if full[0].Row["file_name"] != "IMG_0001.JPG" {
+		t.Fatalf("media row = %#v", full[0].Row)
+	}
+
+	if rows, next := collect(cursor); len(rows) != 0 || next != cursor {
+		t.Fatalf("idle delta = %d rows, cursor %d -> %d", len(rows), cursor, next)
+	}
+
+	if _, err := store.AddMediaTags(ctx, ids[2], []string{"beach"}, "user"); err != nil {
+		t.Fatalf("AddMediaTags: %v", err)
+	}
+	if err := store.DeleteMediaByID(ctx, ids[0]); err != nil {
+		t.Fatalf("DeleteMediaByID: %v", err)
+	}
+
+	delta, _ := collect(cursor, ExportMedia, ExportAlbumItem, ExportMediaTag)
+	got := map[string]int{}
+	for _, r := range delta {
+		got[r.Type+":"+r.Op]++
+	}
+	want := map[string]int{"media:delete": 1, "album_item:delete": 1, "media_tag:upsert": 1}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("delta = %v, want %v", got, want)
+	}
+	for _, r := range delta {
+		if r.Type == ExportMedia && fmt.Sprint(r.Key["id"]) != fmt.Sprint(ids[0]) {
+			t.Fatalf("media delete key = %#v", r.Key)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FaceRegion is a detected face. X, Y, W, and H are fractions of the
+// displayed (EXIF-rotated) image, with the origin at the top left.
+type FaceRegion struct {
+	ID         int64   `json:"id"`
+	MediaID    int64   `json:"media_id"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	W          float64 `json:"w"`
+	H          float64 `json:"h"`
+	Score      float64 `json:"score"`
+	PersonID   int64   `json:"person_id,omitempty"`
+	PersonName string  `json:"person_name,omitempty"`
+}
+
+type Person struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	FaceCount  int64  `json:"face_count"`
+	MediaCount int64  `json:"media_count"`
+}
+
+// FaceScanTodo is an image that has not been through face detection yet.
+type FaceScanTodo struct {
+	ID        int64
+	DestPath  string
+	Extension string
+}
+
+// ListFaceScanTodos returns images without a face scan, oldest first.
+func (s *Store) ListFaceScanTodos(ctx context.Context, limit int) ([]FaceScanTodo, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, dest_path, extension
+		FROM media_files
+		WHERE kind = 'image' AND id NOT IN (SELECT media_id FROM face_scans)
+		ORDER BY id ASC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]FaceScanTodo, 0)
+	for rows.Next() {
+		var t FaceScanTodo
+		if err := rows.Scan(&t.ID, &t.DestPath, &t.Extension); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// CountFaceScanTodos reports how many images still need a face scan.
+func (s *Store) CountFaceScanTodos(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(1) FROM media_files
+		WHERE kind = 'image' AND id NOT IN (SELECT media_id FROM face_scans)
+	`).Scan(&n)
+	return n, err
+}
+
+// RecordFaceScan replaces the detected faces for a media item and marks it
+// scanned. scanErr notes why an image could not be scanned; it is still
+// marked so it is not retried on every pass.
+func (s *Store) RecordFaceScan(ctx context.Context, mediaID int64, regions []FaceRegion, scanErr string) (err error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err = tx.ExecContext(ctx, `DELETE FROM face_regions WHERE media_id = ?`, mediaID); err != nil {
+		return err
+	}
+	for _, r := range regions {
+		if _, err = tx.ExecContext(ctx,
+			`INSERT INTO face_regions (media_id, x, y, w, h, score, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			mediaID, r.X, r.Y, r.W, r.H, r.Score, now,
+		); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO face_scans (media_id, scanned_at, faces, error) VALUES (?, ?, ?, ?)
+		ON CONFLICT(media_id) DO UPDATE SET scanned_at = excluded.scanned_at, faces = excluded.faces, error = excluded.error
+	`, mediaID, now, len(regions), nullable(scanErr)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) ListFaces(ctx context.Context, mediaID int64) ([]FaceRegion, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT f.id, f.media_id, f.x, f.y, f.w, f.h, f.score, COALESCE(f.person_id, 0), COALESCE(p.name, '')
+		FROM face_regions f LEFT JOIN people p ON p.id = f.person_id
+		WHERE f.media_id = ?
+		ORDER BY f.x ASC, f.id ASC
+	`, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]FaceRegion, 0)
+	for rows.Next() {
+		var f FaceRegion
+		if err := rows.Scan(&f.ID, &f.MediaID, &f.X, &f.Y, &f.W, &f.H, &f.Score, &f.PersonID, &f.PersonName); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// FacePerson returns the person a face is assigned to, 0 when none, and
+// whether the face exists.
+func (s *Store) FacePerson(ctx context.Context, faceID int64) (int64, bool, error) {
+	var personID int64
+	err := s.DB.QueryRowContext(ctx, `SELECT COALESCE(person_id, 0) FROM face_regions WHERE id = ?`, faceID).Scan(&personID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return personID, err == nil, err
+}
+
+// NameFace assigns a face to the person called name, creating the person if
+// needed. An empty name clears the assignment. People left without faces are
+// removed. It returns the face as updated, or nil when there is no such
+// face.
+func (s *Store) NameFace(ctx context.Context, faceID int64, name string) (face *FaceRegion, err error) {
+	name = strings.TrimSpace(name)
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var mediaID int64
+	if err = tx.QueryRowContext(ctx, `SELECT media_id FROM face_regions WHERE id = ?`, faceID).Scan(&mediaID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+			_ = tx.Rollback()
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var personID any
+	if name != "" {
+		now := time.Now().UTC().Format(time.RFC3339)
+		if _, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO people (name, created_at) VALUES (?, ?)`, name, now); err != nil {
+			return nil, err
+		}
+		var id int64
+		if err = tx.QueryRowContext(ctx, `SELECT id FROM people WHERE name = ?`, name).Scan(&id); err != nil {
+			return nil, fmt.Errorf("look up person: %w", err)
+		}
+		personID = id
+	}
+	if _, err = tx.ExecContext(ctx, `UPDATE face_regions SET person_id = ? WHERE id = ?`, personID, faceID); err != nil {
+		return nil, err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM people WHERE id NOT IN (SELECT person_id FROM face_regions WHERE person_id IS NOT NULL)`); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	faces, err := s.ListFaces(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range faces {
+		if faces[i].ID == faceID {
+			return &faces[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ListPeople is the people facet: everyone named on at least one face in
+// media matching filter, with counts.
+func (s *Store) ListPeople(ctx context.Context, filter MediaFilter, limit int) ([]Person, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	where, args := buildLocationWhere(filter)
+	query := fmt.Sprintf(`
+		SELECT p.id, p.name, COUNT(f.id), COUNT(DISTINCT f.media_id)
+		FROM people p
+		JOIN face_regions f ON f.person_id = p.id
+		WHERE f.media_id IN (SELECT id FROM media_files WHERE %s)
+		GROUP BY p.id
+		ORDER BY COUNT(DISTINCT f.media_id) DESC, p.name ASC
+		LIMIT ?
+	`, where)
+	args = append(args, limit)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]Person, 0)
+	for rows.Next() {
+		var p Person
+		if err := rows.Scan(&p.ID, &p.Name, &p.FaceCount, &p.MediaCount); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
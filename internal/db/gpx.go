@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// GPXTrack is an imported GPS track. Media is placed on it by capture time
+// plus OffsetSec, which corrects a camera clock that was off.
+type GPXTrack struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time"`
+	PointCount int    `json:"point_count"`
+	OffsetSec  int64  `json:"offset_sec"`
+	MaxGapSec  int64  `json:"max_gap_sec"`
+	ImportedBy string `json:"imported_by"`
+	ImportedAt string `json:"imported_at"`
+	Matched    int64  `json:"matched"` // media positioned from this track
+}
+
+// GPXPoint is one fix of a track; TimeMS is Unix milliseconds.
+type GPXPoint struct {
+	TimeMS int64
+	Lat    float64
+	Lon    float64
+	Ele    sql.NullFloat64
+}
+
+// GPXMatch is a position found on a track for a media item without one.
+type GPXMatch struct {
+	MediaID int64
+	Lat     float64
+	Lon     float64
+}
+
+// UnlocatedMedia is a media item without a position.
+type UnlocatedMedia struct {
+	ID          int64
+	CaptureTime string
+}
+
+// CreateGPXTrack stores t and its points and fills in t's id.
+func (s *Store) CreateGPXTrack(ctx context.Context, t *GPXTrack, points []GPXPoint) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO gpx_tracks (name, start_time, end_time, point_count, offset_sec, max_gap_sec, imported_by, imported_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.Name, t.StartTime, t.EndTime, len(points), t.OffsetSec, t.MaxGapSec, t.ImportedBy, t.ImportedAt)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO gpx_points (track_id, time_ms, lat, lon, ele) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range points {
+		if _, err := stmt.ExecContext(ctx, id, p.TimeMS, p.Lat, p.Lon, nullFloatToAny(p.Ele)); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	t.ID, t.PointCount = id, len(points)
+	return nil
+}
+
+// ListGPXTracks returns every track, latest first.
+func (s *Store) ListGPXTracks(ctx context.Context) ([]GPXTrack, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT t.id, t.name, t.start_time, t.end_time, t.point_count, t.offset_sec, t.max_gap_sec,
+		       t.imported_by, t.imported_at,
+		       (SELECT COUNT(1) FROM media_gpx_matches m WHERE m.track_id = t.id)
+		FROM gpx_tracks t ORDER BY t.start_time DESC, t.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]GPXTrack, 0)
+	for rows.Next() {
+		var t GPXTrack
+		if err := rows.Scan(&t.ID, &t.Name, &t.StartTime, &t.EndTime, &t.PointCount, &t.OffsetSec, &t.MaxGapSec,
+			&t.ImportedBy, &t.ImportedAt, &t.Matched); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// ListGPXPoints returns the points of track id in time order.
+func (s *Store) ListGPXPoints(ctx context.Context, id int64) ([]GPXPoint, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT time_ms, lat, lon, ele FROM gpx_points WHERE track_id = ? ORDER BY time_ms`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]GPXPoint, 0)
+	for rows.Next() {
+		var p GPXPoint
+		if err := rows.Scan(&p.TimeMS, &p.Lat, &p.Lon, &p.Ele); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// ListUnlocatedMedia returns the media with a capture time but no position.
+func (s *Store) ListUnlocatedMedia(ctx context.Context) ([]UnlocatedMedia, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, capture_time FROM media_files
+		WHERE (gps_lat IS NULL OR gps_lon IS NULL) AND capture_time <> ''
+		ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]UnlocatedMedia, 0)
+	for rows.Next() {
+		var m UnlocatedMedia
+		if err := rows.Scan(&m.ID, &m.CaptureTime); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// ApplyGPXMatches positions media from track trackID. Items that gained a
+// position some other way in the meantime are left alone. With no place
+// recorded yet, the positioned items are what the geocode backfill picks
+// up next. It returns how many items were positioned.
+func (s *Store) ApplyGPXMatches(ctx context.Context, trackID int64, matches []GPXMatch) (int, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC().Format(time.RFC3339)
+	applied := 0
+	for _, m := range matches {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE media_files SET gps_lat = ?, gps_lon = ?
+			WHERE id = ? AND (gps_lat IS NULL OR gps_lon IS NULL)`, m.Lat, m.Lon, m.MediaID)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO media_gpx_matches (media_id, track_id, matched_at) VALUES (?, ?, ?)
+			ON CONFLICT (media_id) DO UPDATE SET track_id = excluded.track_id, matched_at = excluded.matched_at`,
+			m.MediaID, trackID, now); err != nil {
+			return 0, err
+		}
+		applied++
+	}
+	return applied, tx.Commit()
+}
+
+// DeleteGPXTrack removes track id and takes back the positions it gave,
+// along with the places looked up for them. It reports whether the track
+// existed and how many items lost their position.
+func (s *Store) DeleteGPXTrack(ctx context.Context, id int64) (bool, int64, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `
+		UPDATE media_files SET gps_lat = NULL, gps_lon = NULL,
+			loc_provider = NULL, loc_country = NULL, loc_state = NULL, loc_county = NULL, loc_city = NULL,
+			loc_road = NULL, loc_house_number = NULL, loc_postcode = NULL, loc_display_name = NULL
+		WHERE id IN (SELECT media_id FROM media_gpx_matches WHERE track_id = ?)`, id)
+	if err != nil {
+		return false, 0, err
+	}
+	cleared, _ := res.RowsAffected()
+	res, err = tx.ExecContext(ctx, `DELETE FROM gpx_tracks WHERE id = ?`, id)
+	if err != nil {
+		return false, 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, 0, nil
+	}
+	return true, cleared, tx.Commit()
+}
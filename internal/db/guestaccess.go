@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// GuestAccess is one authenticated request made by a guest account.
+type GuestAccess struct {
+	ID         int64  `json:"id"`
+	GuestID    int64  `json:"guest_id"`
+	Username   string `json:"username"`
+	Session    string `json:"session"` // leading characters of the session token hash
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	Route      string `json:"route"`
+	MediaID    int64  `json:"media_id,omitempty"`
+	AccessedAt string `json:"accessed_at"`
+}
+
+// GuestAccessSummary holds the counters kept for one guest account.
+type GuestAccessSummary struct {
+	Requests      int64  `json:"requests"`
+	MediaServed   int64  `json:"media_served"`
+	DistinctMedia int64  `json:"distinct_media"`
+	Sessions      int64  `json:"sessions"`
+	Addresses     int64  `json:"addresses"`
+	UserAgents    int64  `json:"user_agents"`
+	FirstAt       string `json:"first_at,omitempty"`
+	LastAt        string `json:"last_at,omitempty"`
+}
+
+// RecordGuestAccess appends a guest request to the access log. The session
+// is cut to the same 16 characters of the token hash used for device IDs.
+func (s *Store) RecordGuestAccess(ctx context.Context, e GuestAccess) error {
+	if len(e.Session) > 16 {
+		e.Session = e.Session[:16]
+	}
+	if e.AccessedAt == "" {
+		e.AccessedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	var mediaID any
+	if e.MediaID > 0 {
+		mediaID = e.MediaID
+	}
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO guest_access (guest_id, username, session, ip, user_agent, route, media_id, accessed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.GuestID, e.Username, e.Session, e.IP, e.UserAgent, e.Route, mediaID, e.AccessedAt)
+	return err
+}
+
+// ListGuestAccess returns a guest's most recent requests, newest first.
+func (s *Store) ListGuestAccess(ctx context.Context, guestID int64, limit int) ([]GuestAccess, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, guest_id, username, session, ip, user_agent, route, media_id, accessed_at
+		FROM guest_access
+		WHERE guest_id = ?
+		ORDER BY id DESC
+		LIMIT ?`, guestID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]GuestAccess, 0)
+	for rows.Next() {
+		var (
+			e       GuestAccess
+			mediaID sql.NullInt64
+		)
+		if err := rows.Scan(&e.ID, &e.GuestID, &e.Username, &e.Session, &e.IP, &e.UserAgent, &e.Route, &mediaID, &e.AccessedAt); err != nil {
+			return nil, err
+		}
+		e.MediaID = mediaID.Int64
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// SummarizeGuestAccess counts a guest's requests made at or after since;
+// a zero since counts them all.
+func (s *Store) SummarizeGuestAccess(ctx context.Context, guestID int64, since time.Time) (GuestAccessSummary, error) {
+	from := ""
+	if !since.IsZero() {
+		from = since.UTC().Format(time.RFC3339)
+	}
+	var sum GuestAccessSummary
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(1), COUNT(media_id), COUNT(DISTINCT media_id), COUNT(DISTINCT session),
+		       COUNT(DISTINCT ip), COUNT(DISTINCT user_agent),
+		       COALESCE(MIN(accessed_at), ''), COALESCE(MAX(accessed_at), '')
+		FROM guest_access
+		WHERE guest_id = ? AND accessed_at >= ?`, guestID, from).Scan(
+		&sum.Requests, &sum.MediaServed, &sum.DistinctMedia, &sum.Sessions,
+		&sum.Addresses, &sum.UserAgents, &sum.FirstAt, &sum.LastAt)
+	return sum, err
+}
+
+// ListAuditForGuest returns audit entries made by a guest account or about
+// it (created, revoked, flagged), newest first.
+func (s *Store) ListAuditForGuest(ctx context.Context, username string, guestID int64, limit int) ([]AuditRecord, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, ts, actor, action, details_json, entry_hash
+		FROM audit_logs
+		WHERE actor = ? OR json_extract(details_json, '$.guest_id') = ?
+		ORDER BY id DESC
+		LIMIT ?`, username, guestID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]AuditRecord, 0)
+	for rows.Next() {
+		var rec AuditRecord
+		if err := rows.Scan(&rec.ID, &rec.TS, &rec.Actor, &rec.Action, &rec.Details, &rec.Hash); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// GuestUsername returns the name a guest account had, from the account
+// itself or, once it is gone, from its access log.
+func (s *Store) GuestUsername(ctx context.Context, guestID int64) (string, error) {
+	var name string
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT username FROM users WHERE id = ? AND role = ?
+		UNION ALL
+		SELECT username FROM guest_access WHERE guest_id = ?
+		LIMIT 1`, guestID, RoleGuest, guestID).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return name, err
+}
+
+// PruneGuestAccess drops access log entries older than before.
+func (s *Store) PruneGuestAccess(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM guest_access WHERE accessed_at < ?`, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SetGuestAutoRevoke sets whether a guest account is deleted as soon as
+// its use looks suspicious.
+func (s *Store) SetGuestAutoRevoke(ctx context.Context, id int64, on bool) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE users SET auto_revoke = ? WHERE id = ? AND role = ?`, on, id, RoleGuest)
+	return err
+}
+
+// SetGuestStripGPS sets whether files a guest views have their position
+// removed.
+func (s *Store) SetGuestStripGPS(ctx context.Context, id int64, on bool) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE users SET strip_gps = ? WHERE id = ? AND role = ?`, on, id, RoleGuest)
+	return err
+}
+
+// GuestAutoRevoke reports whether a guest account is set to be revoked on
+// suspicious use.
+func (s *Store) GuestAutoRevoke(ctx context.Context, id int64) (bool, error) {
+	var on bool
+	err := s.DB.QueryRowContext(ctx, `SELECT auto_revoke FROM users WHERE id = ? AND role = ?`, id, RoleGuest).Scan(&on)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return on, err
+}
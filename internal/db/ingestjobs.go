@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// IngestCheckpoint is a card file an unfinished mount ingest already dealt
+// with. It only counts while the file's size and modification time match.
+type IngestCheckpoint struct {
+	SizeBytes int64
+	MTime     string
+}
+
+// OpenIngestJob returns the unfinished ingest job for a mount, creating
+// one when there is none, with the files it already dealt with. Jobs not
+// touched since staleBefore are dropped first.
+func (s *Store) OpenIngestJob(ctx context.Context, mountKey string, staleBefore time.Time) (int64, map[string]IngestCheckpoint, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM ingest_jobs WHERE updated_at < ?`, staleBefore.UTC().Format(time.RFC3339)); err != nil {
+		return 0, nil, err
+	}
+	var id int64
+	err := s.DB.QueryRowContext(ctx, `SELECT id FROM ingest_jobs WHERE mount_key = ?`, mountKey).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		res, err := s.DB.ExecContext(ctx,
+			`INSERT INTO ingest_jobs (mount_key, started_at, updated_at) VALUES (?, ?, ?)`, mountKey, now, now)
+		if err != nil {
+			return 0, nil, err
+		}
+		id, err = res.LastInsertId()
+		return id, map[string]IngestCheckpoint{}, err
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rows, err := s.DB.QueryContext(ctx, `SELECT source_path, size_bytes, mtime FROM ingest_job_files WHERE job_id = ?`, id)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+	done := map[string]IngestCheckpoint{}
+	for rows.Next() {
+		var path string
+		var cp IngestCheckpoint
+		if err := rows.Scan(&path, &cp.SizeBytes, &cp.MTime); err != nil {
+			return 0, nil, err
+		}
+		done[path] = cp
+	}
+	return id, done, rows.Err()
+}
+
+// CheckpointIngestFile records that a job dealt with a card file, and
+// how: copied, duplicate, or skipped.
+func (s *Store) CheckpointIngestFile(ctx context.Context, jobID int64, sourcePath string, cp IngestCheckpoint, outcome string) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO ingest_job_files (job_id, source_path, size_bytes, mtime, outcome) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(job_id, source_path) DO UPDATE SET size_bytes = excluded.size_bytes, mtime = excluded.mtime, outcome = excluded.outcome`,
+		jobID, sourcePath, cp.SizeBytes, cp.MTime, outcome)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, `UPDATE ingest_jobs SET updated_at = ? WHERE id = ?`, time.Now().UTC().Format(time.RFC3339), jobID)
+	return err
+}
+
+// FinishIngestJob forgets a job that ran to the end, with its checkpoints.
+func (s *Store) FinishIngestJob(ctx context.Context, jobID int64) error {
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM ingest_job_files WHERE job_id = ?`, jobID); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM ingest_jobs WHERE id = ?`, jobID)
+	return err
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+)
+
+// ingestSpeedKeep is how many sessions are kept per mount.
+const ingestSpeedKeep = 50
+
+// IngestSpeedSession is the throughput of one card ingest. MB/s counts the
+// bytes read for hashing and copied, as the live ingest status does, over
+// the time the ingest was not paused.
+type IngestSpeedSession struct {
+	ID        int64   `json:"id"`
+	Mount     string  `json:"mount"`
+	MountKey  string  `json:"-"`
+	FSType    string  `json:"fs_type,omitempty"`
+	StartedAt string  `json:"started_at"`
+	Seconds   float64 `json:"seconds"`
+	Bytes     int64   `json:"bytes"`
+	Files     int     `json:"files"`
+	AvgMBps   float64 `json:"avg_mbps"`
+	PeakMBps  float64 `json:"peak_mbps"`
+	Outcome   string  `json:"outcome"` // completed or failed
+
+	Samples []IngestSpeedSample `json:"samples,omitempty"`
+}
+
+// IngestSpeedSample is the MB/s seen some seconds into a session.
+type IngestSpeedSample struct {
+	OffsetSec int     `json:"offset_sec"`
+	MBps      float64 `json:"mbps"`
+}
+
+// RecordIngestSpeed stores a session with its samples and drops the
+// mount's sessions beyond the newest ingestSpeedKeep.
+func (s *Store) RecordIngestSpeed(ctx context.Context, sess IngestSpeedSession) (int64, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO ingest_speed_sessions
+			(mount, mount_key, fs_type, started_at, seconds, bytes, files, avg_mbps, peak_mbps, outcome)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sess.Mount, sess.MountKey, sess.FSType, sess.StartedAt, sess.Seconds, sess.Bytes, sess.Files,
+		sess.AvgMBps, sess.PeakMBps, sess.Outcome)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, sample := range sess.Samples {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO ingest_speed_samples (session_id, offset_sec, mbps) VALUES (?, ?, ?)`,
+			id, sample.OffsetSec, sample.MBps); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM ingest_speed_sessions
+		WHERE mount_key = ? AND id NOT IN (
+			SELECT id FROM ingest_speed_sessions WHERE mount_key = ? ORDER BY id DESC LIMIT ?
+		)`, sess.MountKey, sess.MountKey, ingestSpeedKeep); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// ListIngestSpeed returns recorded sessions newest first, for one mount key
+// or, when it is empty, for every mount. Samples are not loaded.
+func (s *Store) ListIngestSpeed(ctx context.Context, mountKey string) ([]IngestSpeedSession, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, mount, mount_key, fs_type, started_at, seconds, bytes, files, avg_mbps, peak_mbps, outcome
+		FROM ingest_speed_sessions
+		WHERE ? = '' OR mount_key = ?
+		ORDER BY id DESC`, mountKey, mountKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]IngestSpeedSession, 0)
+	for rows.Next() {
+		var sess IngestSpeedSession
+		if err := rows.Scan(&sess.ID, &sess.Mount, &sess.MountKey, &sess.FSType, &sess.StartedAt, &sess.Seconds,
+			&sess.Bytes, &sess.Files, &sess.AvgMBps, &sess.PeakMBps, &sess.Outcome); err != nil {
+			return nil, err
+		}
+		out = append(out, sess)
+	}
+	return out, rows.Err()
+}
+
+// IngestSpeedSamples returns a session's samples in time order.
+func (s *Store) IngestSpeedSamples(ctx context.Context, sessionID int64) ([]IngestSpeedSample, error) {
+	rows, err := s.DB.QueryContext(ctx,
+		`SELECT offset_sec, mbps FROM ingest_speed_samples WHERE session_id = ? ORDER BY offset_sec`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]IngestSpeedSample, 0)
+	for rows.Next() {
+		var sample IngestSpeedSample
+		if err := rows.Scan(&sample.OffsetSec, &sample.MBps); err != nil {
+			return nil, err
+		}
+		out = append(out, sample)
+	}
+	return out, rows.Err()
+}
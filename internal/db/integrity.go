@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Kinds of integrity issue the library scrub finds.
+const (
+	IntegrityMissing    = "missing"    // the file is not at its dest_path
+	IntegrityMismatch   = "mismatch"   // its bytes no longer hash to the stored SHA256
+	IntegrityUnreadable = "unreadable" // it could not be read to the end
+)
+
+// IntegrityIssue is a problem the scrub found with a library file. There
+// is at most one per media item; it is resolved once a later scrub finds
+// the file whole again.
+type IntegrityIssue struct {
+	MediaID        int64  `json:"media_id"`
+	FileName       string `json:"file_name"`
+	Kind           string `json:"kind"`
+	DestPath       string `json:"dest_path"`
+	ExpectedSHA256 string `json:"expected_sha256"`
+	ActualSHA256   string `json:"actual_sha256,omitempty"`
+	Detail         string `json:"detail,omitempty"`
+	FirstSeenAt    string `json:"first_seen_at"`
+	LastSeenAt     string `json:"last_seen_at"`
+	ResolvedAt     string `json:"resolved_at,omitempty"`
+}
+
+// ScrubTarget is what the scrub needs to know of a media item.
+type ScrubTarget struct {
+	ID        int64
+	FileName  string
+	DestPath  string
+	SHA256    string
+	SizeBytes int64
+}
+
+// ListScrubTargets returns up to limit media items with ids above afterID,
+// in id order.
+func (s *Store) ListScrubTargets(ctx context.Context, afterID int64, limit int) ([]ScrubTarget, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, file_name, dest_path, sha256, size_bytes
+		FROM media_files
+		WHERE id > ?
+		ORDER BY id
+		LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]ScrubTarget, 0, limit)
+	for rows.Next() {
+		var t ScrubTarget
+		if err := rows.Scan(&t.ID, &t.FileName, &t.DestPath, &t.SHA256, &t.SizeBytes); err != nil {
+			return nil, err
+		}
+		t.DestPath = s.rebase(t.DestPath)
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// SampleMediaIDs picks up to limit media ids at random.
+func (s *Store) SampleMediaIDs(ctx context.Context, limit int) (map[int64]bool, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id FROM media_files ORDER BY RANDOM() LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[int64]bool, limit)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out[id] = true
+	}
+	return out, rows.Err()
+}
+
+// RecordIntegrityIssue notes an issue with a media item, replacing any
+// earlier one. An issue found again keeps the time it was first seen.
+func (s *Store) RecordIntegrityIssue(ctx context.Context, issue IntegrityIssue) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO integrity_issues (media_id, kind, dest_path, expected_sha256, actual_sha256, detail, first_seen_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(media_id) DO UPDATE SET
+			kind = excluded.kind,
+			dest_path = excluded.dest_path,
+			expected_sha256 = excluded.expected_sha256,
+			actual_sha256 = excluded.actual_sha256,
+			detail = excluded.detail,
+			first_seen_at = CASE WHEN integrity_issues.resolved_at IS NULL AND integrity_issues.kind = excluded.kind
+				THEN integrity_issues.first_seen_at ELSE excluded.first_seen_at END,
+			last_seen_at = excluded.last_seen_at,
+			resolved_at = NULL`,
+		issue.MediaID, issue.Kind, issue.DestPath, issue.ExpectedSHA256, issue.ActualSHA256, issue.Detail, now, now)
+	return err
+}
+
+// ResolveIntegrityIssue marks a media item's open issue resolved. With
+// kind set, only an issue of that kind is.
+func (s *Store) ResolveIntegrityIssue(ctx context.Context, mediaID int64, kind string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE integrity_issues SET resolved_at = ?
+		WHERE media_id = ? AND resolved_at IS NULL AND (? = '' OR kind = ?)`,
+		time.Now().UTC().Format(time.RFC3339), mediaID, kind, kind)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListIntegrityIssues returns the open issues, or with resolved all of
+// them, most recently seen first.
+func (s *Store) ListIntegrityIssues(ctx context.Context, resolved bool, limit int) ([]IntegrityIssue, error) {
+	if limit <= 0 || limit > 5000 {
+		limit = 1000
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT i.media_id, COALESCE(m.file_name, ''), i.kind, i.dest_path, i.expected_sha256, i.actual_sha256,
+			i.detail, i.first_seen_at, i.last_seen_at, i.resolved_at
+		FROM integrity_issues i LEFT JOIN media_files m ON m.id = i.media_id
+		WHERE ? OR i.resolved_at IS NULL
+		ORDER BY i.last_seen_at DESC, i.media_id
+		LIMIT ?`, resolved, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]IntegrityIssue, 0)
+	for rows.Next() {
+		var (
+			it         IntegrityIssue
+			resolvedAt sql.NullString
+		)
+		if err := rows.Scan(&it.MediaID, &it.FileName, &it.Kind, &it.DestPath, &it.ExpectedSHA256, &it.ActualSHA256,
+			&it.Detail, &it.FirstSeenAt, &it.LastSeenAt, &resolvedAt); err != nil {
+			return nil, err
+		}
+		it.DestPath = s.rebase(it.DestPath)
+		it.ResolvedAt = resolvedAt.String
+		out = append(out, it)
+	}
+	return out, rows.Err()
+}
+
+// CountOpenIntegrityIssues counts the issues not yet resolved.
+func (s *Store) CountOpenIntegrityIssues(ctx context.Context) (int, error) {
+	var n int
+	err := s.DB.QueryRowContext(ctx, `SELECT COUNT(1) FROM integrity_issues WHERE resolved_at IS NULL`).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// LegalHold keeps content with the given sha256 from being deleted or
+// purged until it is released. Holds are by content rather than media id so
+// that they still apply once an item has left the library and is waiting
+// to be purged.
+type LegalHold struct {
+	SHA256   string `json:"sha256"`
+	FileName string `json:"file_name"` // of a library or pending item, if any
+	Reason   string `json:"reason"`
+	PlacedBy string `json:"placed_by"`
+	PlacedAt string `json:"placed_at"`
+}
+
+// PlaceLegalHold holds content sha256. Placing a hold that exists updates
+// its reason.
+func (s *Store) PlaceLegalHold(ctx context.Context, sha256, reason, placedBy string) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO legal_holds (sha256, reason, placed_by, placed_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(sha256) DO UPDATE SET reason = excluded.reason`,
+		sha256, reason, placedBy, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// ReleaseLegalHold lifts the hold on sha256 and reports whether there was
+// one.
+func (s *Store) ReleaseLegalHold(ctx context.Context, sha256 string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM legal_holds WHERE sha256 = ?`, sha256)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// OnLegalHold reports whether content sha256 is held.
+func (s *Store) OnLegalHold(ctx context.Context, sha256 string) (bool, error) {
+	var held bool
+	err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM legal_holds WHERE sha256 = ?)`, sha256).Scan(&held)
+	return held, err
+}
+
+// ListLegalHolds returns every hold, newest first.
+func (s *Store) ListLegalHolds(ctx context.Context) ([]LegalHold, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT h.sha256, COALESCE(
+				(SELECT file_name FROM media_files WHERE sha256 = h.sha256 ORDER BY id LIMIT 1),
+				(SELECT file_name FROM media_purges WHERE sha256 = h.sha256 ORDER BY id LIMIT 1),
+				''),
+			h.reason, h.placed_by, h.placed_at
+		FROM legal_holds h
+		ORDER BY h.placed_at DESC, h.sha256`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]LegalHold, 0)
+	for rows.Next() {
+		var h LegalHold
+		if err := rows.Scan(&h.SHA256, &h.FileName, &h.Reason, &h.PlacedBy, &h.PlacedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
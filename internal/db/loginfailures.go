@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Failed sign-ins are counted per key, such as "ip:192.0.2.7" or
+// "user:admin", so throttling survives a restart. A key's count starts
+// over once it has gone without a failure for the forget window the caller
+// passes in.
+
+// RecordLoginFailure counts a failed sign-in for key and locks the key
+// until now plus lockout(failures), when that is not zero. Keys that have
+// not failed since forgetBefore are dropped, and key itself counts from
+// one again.
+func (s *Store) RecordLoginFailure(ctx context.Context, key string, now, forgetBefore time.Time, lockout func(failures int) time.Duration) (failures int, lockedUntil time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	forget := forgetBefore.UTC().Format(time.RFC3339Nano)
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM login_failures WHERE last_failure_at < ? AND key <> ?`, forget, key); err != nil {
+		return 0, time.Time{}, err
+	}
+	err = s.DB.QueryRowContext(ctx, `
+		INSERT INTO login_failures (key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			failures = CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures`,
+		key, now.UTC().Format(time.RFC3339Nano), forget,
+	).Scan(&failures)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	locked := ""
+	if d := lockout(failures); d > 0 {
+		lockedUntil = now.Add(d).UTC()
+		locked = lockedUntil.Format(time.RFC3339Nano)
+	}
+	_, err = s.DB.ExecContext(ctx, `UPDATE login_failures SET locked_until = ? WHERE key = ?`, locked, key)
+	return failures, lockedUntil, err
+}
+
+// LoginLockedUntil is the latest time any of keys stays locked until, or
+// zero when none is locked at now.
+func (s *Store) LoginLockedUntil(ctx context.Context, now time.Time, keys ...string) (time.Time, error) {
+	var latest time.Time
+	for _, key := range keys {
+		var raw string
+		err := s.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(locked_until), '') FROM login_failures WHERE key = ?`, key).Scan(&raw)
+		if err != nil {
+			return time.Time{}, err
+		}
+		until, err := time.Parse(time.RFC3339Nano, raw)
+		if err == nil && until.After(now) && until.After(latest) {
+			latest = until
+		}
+	}
+	return latest, nil
+}
+
+// ClearLoginFailures forgets the failures counted for keys, after a
+// successful sign-in.
+func (s *Store) ClearLoginFailures(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if _, err := s.DB.ExecContext(ctx, `DELETE FROM login_failures WHERE key = ?`, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// MapBookmark is a place on the map a user saved to jump back to.
+type MapBookmark struct {
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	Lat       float64 `json:"lat"`
+	Lon       float64 `json:"lon"`
+	Zoom      int     `json:"zoom"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+// ErrBookmarkNameTaken is returned when a user already has a bookmark with
+// the name.
+var ErrBookmarkNameTaken = errors.New("a bookmark with this name already exists")
+
+// ListMapBookmarks returns the bookmarks of userID by name.
+func (s *Store) ListMapBookmarks(ctx context.Context, userID int64) ([]MapBookmark, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, name, lat, lon, zoom, created_at, updated_at
+		FROM map_bookmarks WHERE user_id = ? ORDER BY name COLLATE NOCASE, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]MapBookmark, 0)
+	for rows.Next() {
+		var b MapBookmark
+		if err := rows.Scan(&b.ID, &b.Name, &b.Lat, &b.Lon, &b.Zoom, &b.CreatedAt, &b.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// CountMapBookmarks returns how many bookmarks userID has.
+func (s *Store) CountMapBookmarks(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := s.DB.QueryRowContext(ctx, `SELECT COUNT(1) FROM map_bookmarks WHERE user_id = ?`, userID).Scan(&n)
+	return n, err
+}
+
+// CreateMapBookmark saves b for userID and fills in its id and times.
+func (s *Store) CreateMapBookmark(ctx context.Context, userID int64, b *MapBookmark) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.DB.ExecContext(ctx, `
+		INSERT INTO map_bookmarks (user_id, name, lat, lon, zoom, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, userID, b.Name, b.Lat, b.Lon, b.Zoom, now, now)
+	if IsUniqueViolation(err) {
+		return ErrBookmarkNameTaken
+	}
+	if err != nil {
+		return err
+	}
+	if b.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+	b.CreatedAt, b.UpdatedAt = now, now
+	return nil
+}
+
+// UpdateMapBookmark replaces the name and view of bookmark b.ID of userID.
+// It returns the stored bookmark, or nil when userID has no such bookmark.
+func (s *Store) UpdateMapBookmark(ctx context.Context, userID int64, b MapBookmark) (*MapBookmark, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE map_bookmarks SET name = ?, lat = ?, lon = ?, zoom = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?`, b.Name, b.Lat, b.Lon, b.Zoom, now, b.ID, userID)
+	if IsUniqueViolation(err) {
+		return nil, ErrBookmarkNameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, err
+	}
+	var out MapBookmark
+	err = s.DB.QueryRowContext(ctx, `
+		SELECT id, name, lat, lon, zoom, created_at, updated_at FROM map_bookmarks WHERE id = ?`, b.ID).
+		Scan(&out.ID, &out.Name, &out.Lat, &out.Lon, &out.Zoom, &out.CreatedAt, &out.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteMapBookmark removes a bookmark of userID and returns its name, or
+// "" when userID has no such bookmark.
+func (s *Store) DeleteMapBookmark(ctx context.Context, userID, id int64) (string, error) {
+	var name string
+	err := s.DB.QueryRowContext(ctx, `SELECT name FROM map_bookmarks WHERE id = ? AND user_id = ?`, id, userID).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = s.DB.ExecContext(ctx, `DELETE FROM map_bookmarks WHERE id = ? AND user_id = ?`, id, userID)
+	return name, err
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MapBounds is the part of the map a request covers. West may be greater
+// than East for a view across the antimeridian.
+type MapBounds struct {
+	South, West, North, East float64
+}
+
+// WorldBounds covers the whole map.
+var WorldBounds = MapBounds{South: -90, West: -180, North: 90, East: 180}
+
+// MapCluster is the located media in one grid cell of the map.
+type MapCluster struct {
+	Lat   float64 `json:"lat"` // mean position of the media in the cell
+	Lon   float64 `json:"lon"`
+	Count int64   `json:"count"`
+	// Bounds of the media in the cell, as [south, west, north, east], for
+	// zooming to fit.
+	Bounds [4]float64 `json:"bounds"`
+	From   string     `json:"from"` // earliest and latest capture time
+	To     string     `json:"to"`
+	// Samples are a few of the newest items, preferring ones with a
+	// thumbnail.
+	Samples []MapClusterSample `json:"samples"`
+}
+
+// MapClusterSample is a media item shown for a cluster.
+type MapClusterSample struct {
+	ID           int64  `json:"id"`
+	Kind         string `json:"kind"`
+	Extension    string `json:"-"`
+	PosterStatus string `json:"-"`
+}
+
+// MapClusterSamples is how many samples each cluster has at most.
+const MapClusterSamples = 3
+
+// ListMapClusters groups the located media matching filter inside bounds
+// into square cells cellDeg degrees across, largest first, and returns at
+// most limit clusters along with the number of media in all cells.
+func (s *Store) ListMapClusters(ctx context.Context, bounds MapBounds, cellDeg float64, limit int, filter MediaFilter) ([]MapCluster, int64, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, 0, err
+	}
+	if cellDeg <= 0 {
+		return nil, 0, fmt.Errorf("invalid cell size %v", cellDeg)
+	}
+	if limit <= 0 || limit > 5000 {
+		limit = 1000
+	}
+	where, args := buildLocationWhere(filter)
+	lonClause := "gps_lon BETWEEN ? AND ?"
+	if bounds.West > bounds.East {
+		lonClause = "(gps_lon >= ? OR gps_lon <= ?)"
+	}
+	query := fmt.Sprintf(`
+		WITH cells AS (
+			SELECT id, gps_lat, gps_lon, capture_time, kind, extension, poster_status,
+				CAST((gps_lon + 180.0) / ? AS INTEGER) AS cx,
+				CAST((gps_lat + 90.0) / ? AS INTEGER) AS cy
+			FROM media_files
+			WHERE gps_lat IS NOT NULL AND gps_lon IS NOT NULL
+			  AND gps_lat BETWEEN ? AND ? AND %s
+			  AND %s
+		), ranked AS (
+			SELECT *, ROW_NUMBER() OVER (
+				PARTITION BY cx, cy
+				ORDER BY (kind = 'image' OR poster_status = ?) DESC, capture_time DESC, id DESC
+			) AS rn
+			FROM cells
+		)
+		SELECT COUNT(*), AVG(gps_lat), AVG(gps_lon),
+			MIN(gps_lat), MIN(gps_lon), MAX(gps_lat), MAX(gps_lon),
+			MIN(capture_time), MAX(capture_time),
+			GROUP_CONCAT(CASE WHEN rn <= ? THEN rn || ':' || id || ':' || kind || ':' || extension || ':' || poster_status END, '|'),
+			SUM(COUNT(*)) OVER ()
+		FROM ranked
+		GROUP BY cx, cy
+		ORDER BY COUNT(*) DESC, cx, cy
+		LIMIT ?
+	`, lonClause, where)
+	queryArgs := []any{cellDeg, cellDeg, bounds.South, bounds.North, bounds.West, bounds.East}
+	queryArgs = append(queryArgs, args...)
+	queryArgs = append(queryArgs, PosterReady, MapClusterSamples, limit)
+
+	rows, err := s.DB.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	out := make([]MapCluster, 0)
+	var total int64
+	for rows.Next() {
+		var (
+			c       MapCluster
+			samples string
+		)
+		if err := rows.Scan(&c.Count, &c.Lat, &c.Lon,
+			&c.Bounds[0], &c.Bounds[1], &c.Bounds[2], &c.Bounds[3],
+			&c.From, &c.To, &samples, &total); err != nil {
+			return nil, 0, err
+		}
+		c.Samples = parseClusterSamples(samples)
+		out = append(out, c)
+	}
+	return out, total, rows.Err()
+}
+
+// parseClusterSamples reads the rank:id:kind:extension:poster_status list
+// built by ListMapClusters, in rank order.
+func parseClusterSamples(raw string) []MapClusterSample {
+	type ranked struct {
+		rank int
+		MapClusterSample
+	}
+	var list []ranked
+	for _, part := range strings.Split(raw, "|") {
+		f := strings.SplitN(part, ":", 5)
+		if len(f) != 5 {
+			continue
+		}
+		rank, err1 := strconv.Atoi(f[0])
+		id, err2 := strconv.ParseInt(f[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		list = append(list, ranked{rank, MapClusterSample{ID: id, Kind: f[2], Extension: f[3], PosterStatus: f[4]}})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].rank < list[j].rank })
+	out := make([]MapClusterSample, len(list))
+	for i, r := range list {
+		out[i] = r.MapClusterSample
+	}
+	return out
+}
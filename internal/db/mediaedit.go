@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MediaEdit is a correction applied to many media items at once, such as a
+// card whose camera clock was wrong. Nil fields are left alone; an empty
+// string clears the field.
+type MediaEdit struct {
+	// CaptureOffset is added to each item's capture time.
+	CaptureOffset time.Duration
+	State         *string
+	County        *string
+	City          *string
+	Make          *string
+	Model         *string
+}
+
+// Empty reports whether the edit changes nothing.
+func (e MediaEdit) Empty() bool {
+	return e.CaptureOffset == 0 && e.State == nil && e.County == nil && e.City == nil && e.Make == nil && e.Model == nil
+}
+
+// EditMedia applies edit to the media items in ids, in one transaction, and
+// returns how many exist. A place set by hand is recorded with the "manual"
+// location provider. Capture times that do not parse are left as they are.
+func (s *Store) EditMedia(ctx context.Context, ids []int64, edit MediaEdit) (int, error) {
+	if len(ids) == 0 || edit.Empty() {
+		return 0, nil
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var (
+		sets []string
+		args []any
+	)
+	set := func(col string, v *string) {
+		if v != nil {
+			sets = append(sets, col+" = ?")
+			args = append(args, nullIfEmpty(*v))
+		}
+	}
+	set("loc_state", edit.State)
+	set("loc_county", edit.County)
+	set("loc_city", edit.City)
+	if len(sets) > 0 {
+		sets = append(sets, "loc_provider = 'manual'")
+	}
+	set("make", edit.Make)
+	set("model", edit.Model)
+
+	found := 0
+	for _, id := range ids {
+		var captured string
+		err := tx.QueryRowContext(ctx, `SELECT capture_time FROM media_files WHERE id = ?`, id).Scan(&captured)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		found++
+		rowSets, rowArgs := slices.Clone(sets), slices.Clone(args)
+		if edit.CaptureOffset != 0 {
+			if t, err := time.Parse(time.RFC3339, captured); err == nil {
+				rowSets = append(rowSets, "capture_time = ?")
+				rowArgs = append(rowArgs, t.Add(edit.CaptureOffset).UTC().Format(time.RFC3339))
+			}
+		}
+		if len(rowSets) == 0 {
+			continue
+		}
+		query := fmt.Sprintf(`UPDATE media_files SET %s WHERE id = ?`, strings.Join(rowSets, ", "))
+		if _, err := tx.ExecContext(ctx, query, append(rowArgs, id)...); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return found, nil
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
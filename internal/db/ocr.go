@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+type OCRTodo struct {
+	ID        int64
+	DestPath  string
+	Extension string
+}
+
+// MediaText is the text read from one image.
+type MediaText struct {
+	MediaID   int64  `json:"media_id"`
+	Text      string `json:"text"`
+	ScannedAt string `json:"scanned_at"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ocrTodoWhere selects images carrying one of tags that have not been read.
+func ocrTodoWhere(tags []string) (string, []any) {
+	marks := make([]string, 0, len(tags))
+	args := make([]any, 0, len(tags))
+	for _, tag := range tags {
+		marks = append(marks, "?")
+		args = append(args, strings.ToLower(strings.TrimSpace(tag)))
+	}
+	return `kind = 'image'
+		AND id NOT IN (SELECT media_id FROM ocr_scans)
+		AND id IN (SELECT media_id FROM media_tags WHERE tag IN (` + strings.Join(marks, ", ") + `))`, args
+}
+
+// ListOCRTodos returns unread images tagged with any of tags, by a user, a
+// rule, or the auto-tagger, oldest first.
+func (s *Store) ListOCRTodos(ctx context.Context, tags []string, limit int) ([]OCRTodo, error) {
+	if len(tags) == 0 {
+		return []OCRTodo{}, nil
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	where, args := ocrTodoWhere(tags)
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, dest_path, extension
+		FROM media_files
+		WHERE `+where+`
+		ORDER BY id ASC
+		LIMIT ?
+	`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]OCRTodo, 0)
+	for rows.Next() {
+		var t OCRTodo
+		if err := rows.Scan(&t.ID, &t.DestPath, &t.Extension); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CountOCRTodos(ctx context.Context, tags []string) (int64, error) {
+	if len(tags) == 0 {
+		return 0, nil
+	}
+	where, args := ocrTodoWhere(tags)
+	var n int64
+	err := s.DB.QueryRowContext(ctx, `SELECT COUNT(1) FROM media_files WHERE `+where, args...).Scan(&n)
+	return n, err
+}
+
+// RecordOCR stores the text read from an image, replacing any earlier
+// result, and makes it searchable. scanErr notes why an image could not be
+// read.
+func (s *Store) RecordOCR(ctx context.Context, mediaID int64, text, scanErr string) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO ocr_scans (media_id, scanned_at, text, error) VALUES (?, ?, ?, ?)
+		ON CONFLICT(media_id) DO UPDATE SET scanned_at = excluded.scanned_at, text = excluded.text, error = excluded.error
+	`, mediaID, time.Now().UTC().Format(time.RFC3339), text, nullable(scanErr))
+	return err
+}
+
+// GetMediaText returns the OCR result for a media item, or nil when the item
+// has not been read.
+func (s *Store) GetMediaText(ctx context.Context, mediaID int64) (*MediaText, error) {
+	var (
+		out     MediaText
+		scanErr sql.NullString
+	)
+	err := s.DB.QueryRowContext(ctx,
+		`SELECT media_id, text, scanned_at, error FROM ocr_scans WHERE media_id = ?`, mediaID,
+	).Scan(&out.MediaID, &out.Text, &out.ScannedAt, &scanErr)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out.Error = scanErr.String
+	return &out, nil
+}
@@ -0,0 +1,291 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+)
+
+// Place is a named area, such as home or a job site, that media are tagged
+// with when their position falls inside it. It is a circle of RadiusM
+// meters around Lat, Lon, or the Polygon of [lat, lon] corners, whose
+// centroid Lat, Lon then is. Unlike the geocoded location, one place can
+// span several roads, counties or states.
+type Place struct {
+	ID        int64        `json:"id"`
+	Name      string       `json:"name"`
+	Lat       float64      `json:"lat"`
+	Lon       float64      `json:"lon"`
+	RadiusM   float64      `json:"radius_m,omitempty"`
+	Polygon   [][2]float64 `json:"polygon,omitempty"`
+	ItemCount int64        `json:"item_count"`
+	CreatedAt string       `json:"created_at"`
+	UpdatedAt string       `json:"updated_at"`
+}
+
+// ErrPlaceNameTaken is returned when another place has the name.
+var ErrPlaceNameTaken = errors.New("a place with this name already exists")
+
+// Contains reports whether the position lies in the place. Polygons are
+// taken as drawn on a flat map, which is close enough at the size of a
+// site.
+func (p Place) Contains(lat, lon float64) bool {
+	if len(p.Polygon) >= 3 {
+		in := false
+		for i, j := 0, len(p.Polygon)-1; i < len(p.Polygon); j, i = i, i+1 {
+			a, b := p.Polygon[i], p.Polygon[j]
+			if (a[0] > lat) != (b[0] > lat) && lon < (b[1]-a[1])*(lat-a[0])/(b[0]-a[0])+a[1] {
+				in = !in
+			}
+		}
+		return in
+	}
+	return p.RadiusM > 0 && distanceMeters(p.Lat, p.Lon, lat, lon) <= p.RadiusM
+}
+
+// bounds is the box around the place, to narrow the media to test.
+func (p Place) bounds() (minLat, maxLat, minLon, maxLon float64) {
+	if len(p.Polygon) >= 3 {
+		minLat, maxLat, minLon, maxLon = 90, -90, 180, -180
+		for _, c := range p.Polygon {
+			minLat, maxLat = math.Min(minLat, c[0]), math.Max(maxLat, c[0])
+			minLon, maxLon = math.Min(minLon, c[1]), math.Max(maxLon, c[1])
+		}
+		return
+	}
+	dLat := p.RadiusM / 111320
+	dLon := dLat / math.Max(math.Cos(p.Lat*math.Pi/180), 0.01)
+	return p.Lat - dLat, p.Lat + dLat, p.Lon - dLon, p.Lon + dLon
+}
+
+func distanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthM = 6371000.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthM * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+const placeColumns = `id, name, lat, lon, radius_m, polygon, created_at, updated_at,
+	(SELECT COUNT(1) FROM media_places WHERE place_id = named_places.id)`
+
+func scanPlace(row interface{ Scan(...any) error }, p *Place) error {
+	var polygon string
+	if err := row.Scan(&p.ID, &p.Name, &p.Lat, &p.Lon, &p.RadiusM, &polygon, &p.CreatedAt, &p.UpdatedAt, &p.ItemCount); err != nil {
+		return err
+	}
+	p.Polygon = nil
+	if polygon != "" {
+		return json.Unmarshal([]byte(polygon), &p.Polygon)
+	}
+	return nil
+}
+
+// ListPlaces returns every place by name, with how many media it holds.
+func (s *Store) ListPlaces(ctx context.Context) ([]Place, error) {
+	rows, err := s.reader().QueryContext(ctx, `SELECT `+placeColumns+` FROM named_places ORDER BY name COLLATE NOCASE, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]Place, 0)
+	for rows.Next() {
+		var p Place
+		if err := scanPlace(rows, &p); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// GetPlace returns a place, or nil when there is none with the id.
+func (s *Store) GetPlace(ctx context.Context, id int64) (*Place, error) {
+	var p Place
+	err := scanPlace(s.DB.QueryRowContext(ctx, `SELECT `+placeColumns+` FROM named_places WHERE id = ?`, id), &p)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func placeShape(p Place) (polygon string, err error) {
+	if len(p.Polygon) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(p.Polygon)
+	return string(b), err
+}
+
+// CreatePlace saves p and fills in its id and times. It holds no media
+// until MatchPlace runs.
+func (s *Store) CreatePlace(ctx context.Context, p *Place) error {
+	polygon, err := placeShape(*p)
+	if err != nil {
+		return err
+	}
+	minLat, maxLat, minLon, maxLon := p.bounds()
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.DB.ExecContext(ctx, `
+		INSERT INTO named_places (name, lat, lon, radius_m, polygon, min_lat, max_lat, min_lon, max_lon, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.Name, p.Lat, p.Lon, p.RadiusM, polygon, minLat, maxLat, minLon, maxLon, now, now)
+	if IsUniqueViolation(err) {
+		return ErrPlaceNameTaken
+	}
+	if err != nil {
+		return err
+	}
+	if p.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+	p.CreatedAt, p.UpdatedAt, p.ItemCount = now, now, 0
+	return nil
+}
+
+// UpdatePlace replaces the name and shape of place p.ID. It returns false
+// when there is no such place. The media it holds are left as they were
+// until MatchPlace runs.
+func (s *Store) UpdatePlace(ctx context.Context, p Place) (bool, error) {
+	polygon, err := placeShape(p)
+	if err != nil {
+		return false, err
+	}
+	minLat, maxLat, minLon, maxLon := p.bounds()
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE named_places SET name = ?, lat = ?, lon = ?, radius_m = ?, polygon = ?,
+			min_lat = ?, max_lat = ?, min_lon = ?, max_lon = ?, updated_at = ?
+		WHERE id = ?`,
+		p.Name, p.Lat, p.Lon, p.RadiusM, polygon, minLat, maxLat, minLon, maxLon,
+		time.Now().UTC().Format(time.RFC3339), p.ID)
+	if IsUniqueViolation(err) {
+		return false, ErrPlaceNameTaken
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeletePlace removes a place, untagging its media, and returns its name,
+// or "" when there is no such place.
+func (s *Store) DeletePlace(ctx context.Context, id int64) (string, error) {
+	var name string
+	err := s.DB.QueryRowContext(ctx, `SELECT name FROM named_places WHERE id = ?`, id).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = s.DB.ExecContext(ctx, `DELETE FROM named_places WHERE id = ?`, id)
+	return name, err
+}
+
+// MatchPlace tags the place onto every positioned item inside it, and off
+// those no longer inside, and returns how many it holds.
+func (s *Store) MatchPlace(ctx context.Context, id int64) (int64, error) {
+	p, err := s.GetPlace(ctx, id)
+	if err != nil || p == nil {
+		return 0, err
+	}
+	minLat, maxLat, minLon, maxLon := p.bounds()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, gps_lat, gps_lon FROM media_files
+		WHERE gps_lat BETWEEN ? AND ? AND gps_lon BETWEEN ? AND ?`,
+		minLat, maxLat, minLon, maxLon)
+	if err != nil {
+		return 0, err
+	}
+	var inside []int64
+	for rows.Next() {
+		var (
+			mediaID  int64
+			lat, lon float64
+		)
+		if err := rows.Scan(&mediaID, &lat, &lon); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if p.Contains(lat, lon) {
+			inside = append(inside, mediaID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM media_places WHERE place_id = ?`, id); err != nil {
+		return 0, err
+	}
+	for _, mediaID := range inside {
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO media_places (media_id, place_id) VALUES (?, ?)`, mediaID, id); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(inside)), tx.Commit()
+}
+
+// MatchMediaPlaces tags a newly positioned item with every place it lies
+// in.
+func (s *Store) MatchMediaPlaces(ctx context.Context, mediaID int64, lat, lon float64) error {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+placeColumns+` FROM named_places
+		WHERE ? BETWEEN min_lat AND max_lat AND ? BETWEEN min_lon AND max_lon`, lat, lon)
+	if err != nil {
+		return err
+	}
+	var matched []Place
+	for rows.Next() {
+		var p Place
+		if err := scanPlace(rows, &p); err != nil {
+			rows.Close()
+			return err
+		}
+		if p.Contains(lat, lon) {
+			matched = append(matched, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, p := range matched {
+		if _, err := s.DB.ExecContext(ctx, `INSERT OR IGNORE INTO media_places (media_id, place_id) VALUES (?, ?)`, mediaID, p.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListPlaceIDs returns the id of every place, for the backfill.
+func (s *Store) ListPlaceIDs(ctx context.Context) ([]int64, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id FROM named_places ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Poster states of a video record. An empty status means no extraction has
+// been tried yet.
+const (
+	PosterReady  = "ready"
+	PosterFailed = "failed"
+)
+
+// SetVideoPoster records the outcome of poster extraction for a video and
+// its duration, when known.
+func (s *Store) SetVideoPoster(ctx context.Context, id int64, status string, duration sql.NullFloat64) error {
+	_, err := s.DB.ExecContext(ctx,
+		`UPDATE media_files SET poster_status = ?, duration_sec = COALESCE(?, duration_sec) WHERE id = ?`,
+		status, nullFloatToAny(duration), id)
+	return err
+}
+
+// ListVideosWithoutPoster returns up to limit videos whose poster has not
+// been tried yet, oldest first.
+func (s *Store) ListVideosWithoutPoster(ctx context.Context, limit int) ([]MediaRecord, error) {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM media_files
+		WHERE kind = 'video' AND poster_status = ''
+		ORDER BY id
+		LIMIT ?
+	`, mediaSelectColumns), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]MediaRecord, 0, limit)
+	for rows.Next() {
+		var rec MediaRecord
+		if err := s.scanMediaRecord(rows, &rec); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// PublishTarget pushes one album to a folder outside the vault. Secret is
+// the WebDAV password or token and is never sent back to clients.
+type PublishTarget struct {
+	ID          int64  `json:"id"`
+	AlbumID     int64  `json:"album_id"`
+	Kind        string `json:"kind"` // "s3" or "webdav"
+	Destination string `json:"destination"`
+	Username    string `json:"username"`
+	Secret      string `json:"-"`
+	Preset      string `json:"preset"`
+	StripGPS    bool   `json:"strip_gps"`
+	Enabled     bool   `json:"enabled"`
+	// Fingerprint covers the album contents and settings last published,
+	// so an unchanged album is not sent again.
+	Fingerprint string `json:"-"`
+	// Manifest maps each published file name to what it was made from.
+	Manifest    map[string]string `json:"-"`
+	PublishedAt string            `json:"published_at"`
+	LastError   string            `json:"last_error"`
+	CreatedBy   string            `json:"created_by"`
+	CreatedAt   string            `json:"created_at"`
+}
+
+const publishTargetColumns = `id, album_id, kind, destination, username, secret, preset, strip_gps, enabled,
+	fingerprint, manifest_json, published_at, last_error, created_by, created_at`
+
+func scanPublishTarget(row interface{ Scan(...any) error }) (PublishTarget, error) {
+	var t PublishTarget
+	var manifest string
+	err := row.Scan(&t.ID, &t.AlbumID, &t.Kind, &t.Destination, &t.Username, &t.Secret, &t.Preset, &t.StripGPS, &t.Enabled,
+		&t.Fingerprint, &manifest, &t.PublishedAt, &t.LastError, &t.CreatedBy, &t.CreatedAt)
+	if err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal([]byte(manifest), &t.Manifest); err != nil || t.Manifest == nil {
+		t.Manifest = map[string]string{}
+	}
+	return t, nil
+}
+
+// ListPublishTargets returns every publish target, oldest first.
+func (s *Store) ListPublishTargets(ctx context.Context) ([]PublishTarget, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+publishTargetColumns+` FROM publish_targets ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]PublishTarget, 0)
+	for rows.Next() {
+		t, err := scanPublishTarget(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// GetPublishTarget returns one target, or nil when there is none with id.
+func (s *Store) GetPublishTarget(ctx context.Context, id int64) (*PublishTarget, error) {
+	t, err := scanPublishTarget(s.DB.QueryRowContext(ctx, `SELECT `+publishTargetColumns+` FROM publish_targets WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SavePublishTarget inserts t when its ID is zero and otherwise updates
+// its settings. Changing the settings clears the fingerprint so the next
+// run publishes again; the manifest is kept so only changed files are sent.
+func (s *Store) SavePublishTarget(ctx context.Context, t *PublishTarget) error {
+	if t.ID == 0 {
+		t.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+		res, err := s.DB.ExecContext(ctx, `
+			INSERT INTO publish_targets (album_id, kind, destination, username, secret, preset, strip_gps, enabled, created_by, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			t.AlbumID, t.Kind, t.Destination, t.Username, t.Secret, t.Preset, t.StripGPS, t.Enabled, t.CreatedBy, t.CreatedAt)
+		if err != nil {
+			return err
+		}
+		t.ID, err = res.LastInsertId()
+		return err
+	}
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE publish_targets
+		SET album_id = ?, kind = ?, destination = ?, username = ?, secret = ?, preset = ?, strip_gps = ?, enabled = ?, fingerprint = ''
+		WHERE id = ?`,
+		t.AlbumID, t.Kind, t.Destination, t.Username, t.Secret, t.Preset, t.StripGPS, t.Enabled, t.ID)
+	return err
+}
+
+// RecordPublish stores the outcome of a run. The manifest is saved even
+// when the run failed, so files already sent are not sent again.
+func (s *Store) RecordPublish(ctx context.Context, id int64, fingerprint string, manifest map[string]string, runErr error) error {
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if runErr != nil {
+		_, err = s.DB.ExecContext(ctx, `UPDATE publish_targets SET manifest_json = ?, last_error = ? WHERE id = ?`,
+			string(raw), runErr.Error(), id)
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, `
+		UPDATE publish_targets SET fingerprint = ?, manifest_json = ?, published_at = ?, last_error = '' WHERE id = ?`,
+		fingerprint, string(raw), time.Now().UTC().Format(time.RFC3339), id)
+	return err
+}
+
+// DeletePublishTarget removes a target. Files it published are left where
+// they are.
+func (s *Store) DeletePublishTarget(ctx context.Context, id int64) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM publish_targets WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
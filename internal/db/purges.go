@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Purge is a media file removed from the library whose bytes are still on
+// disk, waiting for PurgeAfter. Until then it can be put back with
+// RestorePurge.
+type Purge struct {
+	ID          int64  `json:"id"`
+	MediaID     int64  `json:"media_id"` // the id it had in the library
+	FileName    string `json:"file_name"`
+	SHA256      string `json:"sha256"`
+	SizeBytes   int64  `json:"size_bytes"`
+	RequestedBy string `json:"requested_by"`
+	RequestedAt string `json:"requested_at"`
+	PurgeAfter  string `json:"purge_after"`
+	LastError   string `json:"last_error,omitempty"`
+	// Held is set while the content is on legal hold; the purge waits
+	// until the hold is released.
+	Held bool `json:"held"`
+
+	Record   MediaRecord `json:"-"`
+	Sidecars []Sidecar   `json:"-"`
+}
+
+// ErrPurgeNotFound is returned for a purge that is not pending, because it
+// ran, was restored or never existed.
+var ErrPurgeNotFound = errors.New("purge not found")
+
+// SchedulePurge removes rec from the library and records its file and
+// sidecars for purging after the given time. Album membership, tags and
+// other rows hanging off the media id go with it.
+func (s *Store) SchedulePurge(ctx context.Context, rec MediaRecord, sidecars []Sidecar, requestedBy string, after time.Time) (id int64, err error) {
+	recJSON, err := json.Marshal(rec)
+	if err != nil {
+		return 0, err
+	}
+	if sidecars == nil {
+		sidecars = []Sidecar{}
+	}
+	scJSON, err := json.Marshal(sidecars)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO media_purges (media_id, file_name, sha256, size_bytes, record_json, sidecars_json, requested_by, requested_at, purge_after)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.ID, rec.FileName, rec.SHA256, rec.SizeBytes, string(recJSON), string(scJSON), requestedBy,
+		time.Now().UTC().Format(time.RFC3339), after.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return 0, err
+	}
+	if id, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM media_files WHERE id = ?`, rec.ID); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+const purgeColumns = `p.id, p.media_id, p.file_name, p.sha256, p.size_bytes, p.requested_by, p.requested_at,
+	p.purge_after, p.last_error, p.record_json, p.sidecars_json,
+	EXISTS (SELECT 1 FROM legal_holds h WHERE h.sha256 = p.sha256)`
+
+func scanPurge(row interface{ Scan(...any) error }) (Purge, error) {
+	var (
+		p               Purge
+		recJSON, scJSON string
+	)
+	if err := row.Scan(&p.ID, &p.MediaID, &p.FileName, &p.SHA256, &p.SizeBytes, &p.RequestedBy, &p.RequestedAt,
+		&p.PurgeAfter, &p.LastError, &recJSON, &scJSON, &p.Held); err != nil {
+		return Purge{}, err
+	}
+	if err := json.Unmarshal([]byte(recJSON), &p.Record); err != nil {
+		return Purge{}, err
+	}
+	if err := json.Unmarshal([]byte(scJSON), &p.Sidecars); err != nil {
+		return Purge{}, err
+	}
+	return p, nil
+}
+
+func (s *Store) queryPurges(ctx context.Context, query string, args ...any) ([]Purge, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]Purge, 0)
+	for rows.Next() {
+		p, err := scanPurge(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// ListPurges returns the pending purges, soonest first.
+func (s *Store) ListPurges(ctx context.Context, limit int) ([]Purge, error) {
+	if limit <= 0 || limit > 5000 {
+		limit = 1000
+	}
+	return s.queryPurges(ctx, `SELECT `+purgeColumns+` FROM media_purges p ORDER BY p.purge_after, p.id LIMIT ?`, limit)
+}
+
+// DuePurges returns up to limit purges whose time has come, leaving out
+// content on legal hold.
+func (s *Store) DuePurges(ctx context.Context, now time.Time, limit int) ([]Purge, error) {
+	return s.queryPurges(ctx, `
+		SELECT `+purgeColumns+` FROM media_purges p
+		WHERE p.purge_after <= ?
+		  AND NOT EXISTS (SELECT 1 FROM legal_holds h WHERE h.sha256 = p.sha256)
+		ORDER BY p.purge_after, p.id
+		LIMIT ?`,
+		now.UTC().Format(time.RFC3339), limit)
+}
+
+// GetPurge returns a pending purge, or ErrPurgeNotFound.
+func (s *Store) GetPurge(ctx context.Context, id int64) (Purge, error) {
+	p, err := scanPurge(s.DB.QueryRowContext(ctx, `SELECT `+purgeColumns+` FROM media_purges p WHERE p.id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Purge{}, ErrPurgeNotFound
+	}
+	return p, err
+}
+
+// FinishPurge drops a purge once its files are gone.
+func (s *Store) FinishPurge(ctx context.Context, id int64) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM media_purges WHERE id = ?`, id)
+	return err
+}
+
+// SetPurgeError records why a purge failed; it is tried again next run.
+func (s *Store) SetPurgeError(ctx context.Context, id int64, msg string) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE media_purges SET last_error = ? WHERE id = ?`, msg, id)
+	return err
+}
+
+// RestorePurge cancels a pending purge and puts the file and its sidecars
+// back in the library under a new id. It fails with a uniqueness error if
+// the same content has been ingested again in the meantime.
+func (s *Store) RestorePurge(ctx context.Context, id int64) (rec MediaRecord, err error) {
+	p, err := s.GetPurge(ctx, id)
+	if err != nil {
+		return MediaRecord{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return MediaRecord{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	res, err := tx.ExecContext(ctx, `DELETE FROM media_purges WHERE id = ?`, id)
+	if err != nil {
+		return MediaRecord{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		err = ErrPurgeNotFound
+		return MediaRecord{}, err
+	}
+	rec = p.Record
+	rec.ID, rec.SameContentID = 0, sql.NullInt64{}
+	if err = insertMedia(ctx, tx, &rec); err != nil {
+		return MediaRecord{}, err
+	}
+	for _, sc := range p.Sidecars {
+		if _, err = tx.ExecContext(ctx, `
+			INSERT INTO media_sidecars (media_id, kind, file_name, source_path, dest_path, size_bytes, sha256)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			rec.ID, sc.Kind, sc.FileName, sc.SourcePath, sc.DestPath, sc.SizeBytes, sc.SHA256); err != nil {
+			return MediaRecord{}, err
+		}
+	}
+	return rec, tx.Commit()
+}
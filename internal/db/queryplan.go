@@ -0,0 +1,370 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryShape is one of the library's main queries with concrete arguments,
+// built exactly as the API runs it.
+type QueryShape struct {
+	Name        string
+	Description string
+	Query       string
+	Args        []any
+}
+
+// MediaListShape is the query ListMediaFiltered runs for these arguments.
+func MediaListShape(name, description, sortBy, order string, limit, offset int, filter MediaFilter) QueryShape {
+	query, args := mediaListQuery(sortBy, order, limit, offset, filter)
+	return QueryShape{Name: name, Description: description, Query: query, Args: args}
+}
+
+// MapPointsShape is the query ListMapPointsFiltered runs for these
+// arguments.
+func MapPointsShape(name, description string, limit int, filter MediaFilter) QueryShape {
+	query, args := mapPointsQuery(limit, filter)
+	return QueryShape{Name: name, Description: description, Query: query, Args: args}
+}
+
+// PlanStep is one line of EXPLAIN QUERY PLAN. EstimatedRows is how many
+// rows the step may visit, from the table size and the statistics ANALYZE
+// gathered, or -1 when it cannot be told.
+type PlanStep struct {
+	ID            int    `json:"id"`
+	Parent        int    `json:"parent"`
+	Detail        string `json:"detail"`
+	EstimatedRows int64  `json:"estimated_rows"`
+}
+
+// QueryPlan is how SQLite runs one query shape against the current data,
+// and what it cost to run it.
+type QueryPlan struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	SQL         string     `json:"sql"`
+	Steps       []PlanStep `json:"steps"`
+	Indexes     []string   `json:"indexes"`
+	FullScans   []string   `json:"full_scans"`
+	TempSort    bool       `json:"temp_sort"` // sorts in a temporary b-tree instead of reading an index in order
+	Rows        int        `json:"rows"`
+	ElapsedMS   float64    `json:"elapsed_ms"`
+	Warnings    []string   `json:"warnings"`
+}
+
+const (
+	// planScanWarnRows is the table size from which a full scan is
+	// worth a warning.
+	planScanWarnRows = 10000
+	// planSlowQuery is how long a shape may take before it is called slow.
+	planSlowQuery = 250 * time.Millisecond
+)
+
+var (
+	planTable   = regexp.MustCompile(`^(?:SCAN|SEARCH) (\w+)`)
+	planIndex   = regexp.MustCompile(`USING (?:COVERING )?INDEX (\w+)`)
+	planEqCols  = regexp.MustCompile(`\(([^)]*)\)`)
+	planRowidEq = regexp.MustCompile(`USING INTEGER PRIMARY KEY \(rowid=\?\)`)
+)
+
+// ExplainQuery runs EXPLAIN QUERY PLAN for shape, estimates the rows each
+// step visits, then runs the query itself and times it.
+func (s *Store) ExplainQuery(ctx context.Context, shape QueryShape) (QueryPlan, error) {
+	plan := QueryPlan{
+		Name:        shape.Name,
+		Description: shape.Description,
+		SQL:         strings.Join(strings.Fields(shape.Query), " "),
+		Steps:       make([]PlanStep, 0),
+		Indexes:     make([]string, 0),
+		FullScans:   make([]string, 0),
+		Warnings:    make([]string, 0),
+	}
+	rows, err := s.DB.QueryContext(ctx, "EXPLAIN QUERY PLAN "+shape.Query, shape.Args...)
+	if err != nil {
+		return plan, err
+	}
+	for rows.Next() {
+		var step PlanStep
+		var unused int
+		if err := rows.Scan(&step.ID, &step.Parent, &unused, &step.Detail); err != nil {
+			_ = rows.Close()
+			return plan, err
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	if err := rows.Close(); err != nil {
+		return plan, err
+	}
+
+	counts := map[string]int64{}
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		step.EstimatedRows = -1
+		if strings.HasPrefix(step.Detail, "USE TEMP B-TREE FOR ORDER BY") {
+			plan.TempSort = true
+			continue
+		}
+		m := planTable.FindStringSubmatch(step.Detail)
+		if m == nil {
+			continue
+		}
+		table := m[1]
+		total, ok := counts[table]
+		if !ok {
+			if total, err = s.tableRows(ctx, table); err != nil {
+				total = -1
+			}
+			counts[table] = total
+		}
+		index := ""
+		if im := planIndex.FindStringSubmatch(step.Detail); im != nil {
+			index = im[1]
+			plan.Indexes = appendUnique(plan.Indexes, index)
+		}
+		switch {
+		case strings.HasPrefix(step.Detail, "SCAN"):
+			step.EstimatedRows = total
+			if index == "" && !strings.Contains(step.Detail, "VIRTUAL TABLE") {
+				plan.FullScans = appendUnique(plan.FullScans, table)
+				if total >= planScanWarnRows {
+					plan.Warnings = append(plan.Warnings, fmt.Sprintf("reads every row of %s (%d rows) because no index matches the filter", table, total))
+				}
+			}
+		case planRowidEq.MatchString(step.Detail):
+			step.EstimatedRows = 1
+		case index != "":
+			step.EstimatedRows = s.indexRowsPerKey(ctx, table, index, step.Detail)
+		}
+	}
+	if plan.TempSort {
+		if n := counts["media_files"]; n >= planScanWarnRows {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("sorts the matching rows in a temporary b-tree; with %d media rows this needs an index on the sort column", n))
+		}
+	}
+
+	start := time.Now()
+	result, err := s.DB.QueryContext(ctx, shape.Query, shape.Args...)
+	if err != nil {
+		return plan, err
+	}
+	for result.Next() {
+		plan.Rows++
+	}
+	err = errors.Join(result.Err(), result.Close())
+	elapsed := time.Since(start)
+	plan.ElapsedMS = float64(elapsed.Microseconds()) / 1000
+	if err != nil {
+		return plan, err
+	}
+	if elapsed >= planSlowQuery {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("took %s", elapsed.Round(time.Millisecond)))
+	}
+	return plan, nil
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, have := range list {
+		if have == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// tableRows counts a table, whose name comes from a query plan.
+func (s *Store) tableRows(ctx context.Context, table string) (int64, error) {
+	var n int64
+	err := s.DB.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM "%s"`, strings.ReplaceAll(table, `"`, `""`))).Scan(&n)
+	return n, err
+}
+
+// indexRowsPerKey reads how many rows an index search visits from the
+// statistics ANALYZE keeps in sqlite_stat1: its stat column holds the row
+// count, then the average rows per key for each leading column prefix.
+func (s *Store) indexRowsPerKey(ctx context.Context, table, index, detail string) int64 {
+	var stat string
+	err := s.DB.QueryRowContext(ctx, `SELECT stat FROM sqlite_stat1 WHERE tbl = ? AND idx = ?`, table, index).Scan(&stat)
+	if err != nil {
+		return -1
+	}
+	fields := strings.Fields(stat)
+	if len(fields) == 0 {
+		return -1
+	}
+	eq := 0
+	if m := planEqCols.FindStringSubmatch(detail); m != nil {
+		for _, term := range strings.Split(m[1], " AND ") {
+			if strings.HasSuffix(term, "=?") {
+				eq++
+			}
+		}
+	}
+	if eq == 0 || eq >= len(fields) {
+		// A range or an unconstrained walk of the index.
+		if n, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			return n
+		}
+		return -1
+	}
+	n, err := strconv.ParseInt(fields[eq], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// expectedMediaIndexes are the indexes the library queries rely on, with
+// the statements that create them.
+var expectedMediaIndexes = map[string]string{
+	"idx_media_capture_time":   `CREATE INDEX idx_media_capture_time ON media_files(capture_time)`,
+	"idx_media_gps":            `CREATE INDEX idx_media_gps ON media_files(gps_lat, gps_lon)`,
+	"idx_media_sha256":         `CREATE INDEX idx_media_sha256 ON media_files(sha256)`,
+	"idx_media_same_content":   `CREATE INDEX idx_media_same_content ON media_files(same_content_id)`,
+	"idx_media_loc_state":      `CREATE INDEX idx_media_loc_state ON media_files(loc_state)`,
+	"idx_media_loc_county":     `CREATE INDEX idx_media_loc_county ON media_files(loc_county)`,
+	"idx_media_loc_city":       `CREATE INDEX idx_media_loc_city ON media_files(loc_city)`,
+	"idx_album_items_media_id": `CREATE INDEX idx_album_items_media_id ON album_items(media_id)`,
+	"idx_media_tags_tag":       `CREATE INDEX idx_media_tags_tag ON media_tags(tag)`,
+}
+
+// DBHealth is the state of the database file and its statistics.
+type DBHealth struct {
+	MediaRows   int64  `json:"media_rows"`
+	PageSize    int64  `json:"page_size"`
+	PageCount   int64  `json:"page_count"`
+	FreePages   int64  `json:"free_pages"`
+	SizeBytes   int64  `json:"size_bytes"`
+	WALBytes    int64  `json:"wal_bytes"`
+	JournalMode string `json:"journal_mode"`
+	// Analyzed is whether ANALYZE has gathered statistics; StatsMediaRows
+	// is how many media rows there were when it last ran.
+	Analyzed       bool     `json:"analyzed"`
+	StatsMediaRows int64    `json:"stats_media_rows"`
+	MissingIndexes []string `json:"missing_indexes"`
+}
+
+// DBHealth reports the database size, free pages, write-ahead log,
+// statistics, and any index the library queries expect but lack.
+func (s *Store) DBHealth(ctx context.Context) (DBHealth, error) {
+	h := DBHealth{MissingIndexes: make([]string, 0)}
+	for _, p := range []struct {
+		pragma string
+		dest   any
+	}{
+		{"page_size", &h.PageSize},
+		{"page_count", &h.PageCount},
+		{"freelist_count", &h.FreePages},
+		{"journal_mode", &h.JournalMode},
+	} {
+		if err := s.DB.QueryRowContext(ctx, "PRAGMA "+p.pragma).Scan(p.dest); err != nil {
+			return h, err
+		}
+	}
+	h.SizeBytes = h.PageSize * h.PageCount
+	var err error
+	if h.MediaRows, err = s.tableRows(ctx, "media_files"); err != nil {
+		return h, err
+	}
+
+	var file string
+	rows, err := s.DB.QueryContext(ctx, `PRAGMA database_list`)
+	if err != nil {
+		return h, err
+	}
+	for rows.Next() {
+		var seq int
+		var name, path string
+		if err := rows.Scan(&seq, &name, &path); err != nil {
+			_ = rows.Close()
+			return h, err
+		}
+		if name == "main" {
+			file = path
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return h, err
+	}
+	if file != "" {
+		if info, err := os.Stat(file + "-wal"); err == nil {
+			h.WALBytes = info.Size()
+		}
+	}
+
+	var stat string
+	err = s.DB.QueryRowContext(ctx, `SELECT stat FROM sqlite_stat1 WHERE tbl = 'media_files' ORDER BY idx IS NULL LIMIT 1`).Scan(&stat)
+	switch {
+	case err == nil:
+		h.Analyzed = true
+		if fields := strings.Fields(stat); len(fields) > 0 {
+			h.StatsMediaRows, _ = strconv.ParseInt(fields[0], 10, 64)
+		}
+	case errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), "no such table"):
+	default:
+		return h, err
+	}
+
+	present := map[string]bool{}
+	idx, err := s.DB.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'index'`)
+	if err != nil {
+		return h, err
+	}
+	for idx.Next() {
+		var name string
+		if err := idx.Scan(&name); err != nil {
+			_ = idx.Close()
+			return h, err
+		}
+		present[name] = true
+	}
+	if err := idx.Close(); err != nil {
+		return h, err
+	}
+	for name := range expectedMediaIndexes {
+		if !present[name] {
+			h.MissingIndexes = append(h.MissingIndexes, name)
+		}
+	}
+	if !present["idx_media_dest_path_nocase"] && !present["idx_media_dest_path_fold"] {
+		h.MissingIndexes = append(h.MissingIndexes, "idx_media_dest_path_nocase")
+	}
+	slices.Sort(h.MissingIndexes)
+	return h, nil
+}
+
+// MissingIndexStatement is the statement that creates a missing index.
+func MissingIndexStatement(name string) string {
+	if name == "idx_media_dest_path_nocase" {
+		return `CREATE UNIQUE INDEX idx_media_dest_path_nocase ON media_files(dest_path COLLATE NOCASE)`
+	}
+	return expectedMediaIndexes[name]
+}
+
+// DiagnosticSamples picks real values to fill in the query shapes: the
+// biggest album, the most common state, and the most used tag. Each is
+// empty when the library has none.
+func (s *Store) DiagnosticSamples(ctx context.Context) (albumID int64, state, tag string, err error) {
+	err = s.DB.QueryRowContext(ctx, `SELECT album_id FROM album_items GROUP BY album_id ORDER BY COUNT(*) DESC LIMIT 1`).Scan(&albumID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, "", "", err
+	}
+	err = s.DB.QueryRowContext(ctx, `
+		SELECT loc_state FROM media_files WHERE TRIM(COALESCE(loc_state, '')) <> ''
+		GROUP BY loc_state ORDER BY COUNT(*) DESC LIMIT 1`).Scan(&state)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, "", "", err
+	}
+	err = s.DB.QueryRowContext(ctx, `SELECT tag FROM media_tags WHERE source <> ? GROUP BY tag ORDER BY COUNT(*) DESC LIMIT 1`, TagSourceAuto).Scan(&tag)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, "", "", err
+	}
+	return albumID, state, tag, nil
+}
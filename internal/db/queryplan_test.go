@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExplainQueryFindsIndexesAndScans(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 50 {
+		capture := ts.Add(time.Duration(i) * time.Hour).Format(time.RFC3339)
+		rec := &MediaRecord{
+			Kind: "image", FileName: fmt.Sprintf("IMG_%04d.jpg", i), Extension: ".jpg", SourceMount: "/Volumes/Card",
+			SourcePath: fmt.Sprintf("/DCIM/IMG_%04d.jpg", i), DestPath: fmt.Sprintf("/lib/IMG_%04d.jpg", i),
+			SizeBytes: int64(1000 + i), CRC32: fmt.Sprintf("%08x", i), SHA256: fmt.Sprintf("%064x", i),
+			CaptureTime: capture, Metadata: "{}", SourceMTime: capture, IngestedAt: capture,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newest, err := store.ExplainQuery(ctx, MediaListShape("newest", "", "capture_time", "desc", 20, 0, MediaFilter{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(newest.Indexes, "idx_media_capture_time") || newest.TempSort || len(newest.FullScans) != 0 || newest.Rows != 20 {
+		t.Fatalf("newest plan = %+v", newest)
+	}
+
+	byName, err := store.ExplainQuery(ctx, MediaListShape("by_name", "", "file_name", "asc", 20, 0, MediaFilter{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !byName.TempSort || !slices.Contains(byName.FullScans, "media_files") {
+		t.Fatalf("file name plan = %+v", byName)
+	}
+	for _, step := range byName.Steps {
+		if step.Detail == "SCAN media_files" && step.EstimatedRows != 50 {
+			t.Fatalf("scan estimate = %d, want 50", step.EstimatedRows)
+		}
+	}
+
+	if _, err := store.DB.ExecContext(ctx, `ANALYZE`); err != nil {
+		t.Fatal(err)
+	}
+	health, err := store.DBHealth(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.MediaRows != 50 || !health.Analyzed || health.StatsMediaRows != 50 || len(health.MissingIndexes) != 0 {
+		t.Fatalf("health = %+v", health)
+	}
+	if _, err := store.DB.ExecContext(ctx, `DROP INDEX idx_media_gps`); err != nil {
+		t.Fatal(err)
+	}
+	if health, err = store.DBHealth(ctx); err != nil || !slices.Equal(health.MissingIndexes, []string{"idx_media_gps"}) {
+		t.Fatalf("missing indexes = %v, %v", health.MissingIndexes, err)
+	}
+}
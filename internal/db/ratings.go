@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxRating is the most stars a media item can be given.
+const MaxRating = 5
+
+// SetMediaRating sets the star rating and favorite flag of media id, each
+// only when not nil, and returns the updated record, or nil if there is no
+// such media.
+func (s *Store) SetMediaRating(ctx context.Context, id int64, rating *int, favorite *bool) (*MediaRecord, error) {
+	var (
+		sets []string
+		args []any
+	)
+	if rating != nil {
+		if *rating < 0 || *rating > MaxRating {
+			return nil, fmt.Errorf("rating must be 0-%d", MaxRating)
+		}
+		sets = append(sets, "rating = ?")
+		args = append(args, *rating)
+	}
+	if favorite != nil {
+		sets = append(sets, "favorite = ?")
+		args = append(args, *favorite)
+	}
+	if len(sets) == 0 {
+		return nil, errors.New("nothing to change")
+	}
+	res, err := s.DB.ExecContext(ctx, `UPDATE media_files SET `+strings.Join(sets, ", ")+` WHERE id = ?`, append(args, id)...)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	return s.GetMediaByID(ctx, id)
+}
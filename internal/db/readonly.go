@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OpenReadOnly opens an existing database, such as the copy in a backup
+// snapshot, without ever writing to it. No migrations run, so the database
+// has to come from this version of the vault. Sign-ins, and failed
+// sign-in counts, are kept in temporary tables in memory, which shadow the
+// stored ones and are lost on restart.
+func OpenReadOnly(path string) (*Store, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("open read-only database: %w", err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openReadOnly(abs, false)
+	if err != nil {
+		// A database in WAL mode on read-only media cannot get the shared
+		// memory file that readers need; nothing can change it there, so
+		// it is opened as immutable instead.
+		store, err = openReadOnly(abs, true)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open read-only database: %w", err)
+	}
+	return store, nil
+}
+
+func openReadOnly(path string, immutable bool) (*Store, error) {
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed // a Windows drive letter
+	}
+	dsn := (&url.URL{Scheme: "file", Path: slashed}).String() + "?mode=ro"
+	if immutable {
+		dsn += "&immutable=1"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// The in-memory sessions belong to the connection, so it is kept open
+	// for good.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxIdleTime(0)
+	db.SetConnMaxLifetime(0)
+
+	store := &Store{DB: db, readOnly: true}
+	ctx := context.Background()
+	var users int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM users`).Scan(&users); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("not a USB Vault database: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, `CREATE TEMP TABLE sessions (
+			token_hash TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			expires_at TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			field INTEGER NOT NULL DEFAULT 0,
+			device TEXT NOT NULL DEFAULT ''
+		);`); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, `CREATE TEMP TABLE login_failures (
+			key TEXT PRIMARY KEY,
+			failures INTEGER NOT NULL,
+			last_failure_at TEXT NOT NULL,
+			locked_until TEXT NOT NULL DEFAULT ''
+		);`); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// ReadOnly reports a store opened with OpenReadOnly.
+func (s *Store) ReadOnly() bool {
+	return s.readOnly
+}
+
+// Rebase makes library paths recorded under from read as if they were
+// under to: media file paths, and settings holding such a path, such as the
+// base storage folder. It lets a read-only store serve a library copied
+// elsewhere, such as the media folder of a backup snapshot.
+func (s *Store) Rebase(from, to string) {
+	s.rebaseFrom, s.rebaseTo = filepath.Clean(from), filepath.Clean(to)
+}
+
+func (s *Store) rebase(path string) string {
+	if s.rebaseFrom == "" || path == "" {
+		return path
+	}
+	rel, err := filepath.Rel(s.rebaseFrom, filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return path
+	}
+	return filepath.Join(s.rebaseTo, rel)
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenReadOnlyServesACopyWithoutWriting(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "usbvault.db")
+	src, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := src.CreateUser(ctx, "admin", []byte("hash"), []byte("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	rec := &MediaRecord{
+		Kind: "image", FileName: "IMG_001.jpg", Extension: ".jpg", SourceMount: "/Volumes/Card",
+		SourcePath: "/DCIM/IMG_001.jpg", DestPath: "/lib/2026/03/01/IMG_001.jpg", SizeBytes: 1000,
+		CRC32: "00000001", SHA256: "01", CaptureTime: ts, Metadata: "{}", SourceMTime: ts, IngestedAt: ts,
+	}
+	if err := src.InsertMedia(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetSetting(ctx, "base_storage_dir", "/lib"); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	if !store.ReadOnly() {
+		t.Fatal("store does not report read-only")
+	}
+	if err := store.SetSetting(ctx, "base_storage_dir", "/elsewhere"); err == nil {
+		t.Fatal("read-only store accepted a write")
+	}
+
+	if err := store.CreateSession(ctx, "token-hash", userID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if s, err := store.LookupSession(ctx, "token-hash"); err != nil || s == nil || s.Username != "admin" {
+		t.Fatalf("LookupSession = %+v, %v", s, err)
+	}
+
+	store.Rebase("/lib", "/mnt/backup/20260301-020000/media")
+	got, err := store.GetMediaByID(ctx, rec.ID)
+	if err != nil || got == nil {
+		t.Fatalf("GetMediaByID = %v, %v", got, err)
+	}
+	if want := filepath.FromSlash("/mnt/backup/20260301-020000/media/2026/03/01/IMG_001.jpg"); got.DestPath != want {
+		t.Fatalf("rebased path = %s, want %s", got.DestPath, want)
+	}
+	if base, _, _ := store.GetSetting(ctx, "base_storage_dir"); base != filepath.FromSlash("/mnt/backup/20260301-020000/media") {
+		t.Fatalf("rebased base storage = %s", base)
+	}
+}
+
+func TestOpenReadOnlyRejectsMissingDatabase(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "usbvault.db")
+	if _, err := OpenReadOnly(path); err == nil {
+		t.Fatal("OpenReadOnly created a database")
+	}
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The library has one writer connection, and an ingest or a big export can
+// hold it for seconds at a time. The lookups every request makes, such as
+// the session behind a cookie and the settings /api/status shows, read
+// through a small pool of query-only connections instead, which WAL mode
+// lets run alongside the writer.
+
+const (
+	readPoolConns = 4
+	// readBusyTimeout bounds how long a reader waits out a checkpoint
+	// or WAL recovery.
+	readBusyTimeout = 2 * time.Second
+	// touchTimeout bounds the small writes a lookup makes on the side,
+	// such as dropping an expired session; they are skipped rather than
+	// wait behind a long write.
+	touchTimeout = 250 * time.Millisecond
+)
+
+// openReadPool opens query-only connections to the database at path.
+func openReadPool(path string) (*sql.DB, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	slashed := filepath.ToSlash(abs)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed // a Windows drive letter
+	}
+	q := url.Values{}
+	q.Add("_pragma", "query_only(1)")
+	q.Add("_pragma", "busy_timeout("+strconv.FormatInt(readBusyTimeout.Milliseconds(), 10)+")")
+	dsn := (&url.URL{Scheme: "file", Path: slashed}).String() + "?" + q.Encode()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetConnMaxIdleTime(1 * time.Minute)
+	db.SetMaxIdleConns(readPoolConns)
+	db.SetMaxOpenConns(readPoolConns)
+	return db, nil
+}
+
+// reader is where lookups that must stay quick read from: the read pool,
+// or the only connection of a read-only store.
+func (s *Store) reader() *sql.DB {
+	if s.read != nil {
+		return s.read
+	}
+	return s.DB
+}
+
+// touch runs a side write of a lookup, giving up after touchTimeout.
+func (s *Store) touch(ctx context.Context, query string, args ...any) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), touchTimeout)
+	defer cancel()
+	_, _ = s.DB.ExecContext(ctx, query, args...)
+}
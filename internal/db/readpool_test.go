@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLookupsReadPastALongWrite(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store, err := Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer store.Close()
+	if err := store.SetSetting(ctx, "base_storage", "/library"); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	userID, err := store.CreateUser(ctx, "admin", []byte("hash"), []byte("salt"))
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := store.CreateSession(ctx, "token", userID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	// An ingest batch holds the only writer connection.
+	tx, err := store.DB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE settings SET value = '/elsewhere' WHERE key = 'base_storage'`); err != nil {
+		t.Fatal(err)
+	}
+
+	quick, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	value, ok, err := store.GetSetting(quick, "base_storage")
+	if err != nil || !ok || value != "/library" {
+		t.Fatalf("GetSetting during a write = %q, %v, %v", value, ok, err)
+	}
+	if has, err := store.HasUsers(quick); err != nil || !has {
+		t.Fatalf("HasUsers during a write = %v, %v", has, err)
+	}
+	session, err := store.LookupSession(quick, "token")
+	if err != nil || session == nil || session.Username != "admin" {
+		t.Fatalf("LookupSession during a write = %+v, %v", session, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, _ := store.GetSetting(ctx, "base_storage"); value != "/elsewhere" {
+		t.Fatalf("GetSetting after commit = %q", value)
+	}
+	// The read pool never writes.
+	if _, err := store.read.ExecContext(ctx, `DELETE FROM settings`); err == nil {
+		t.Fatal("read pool accepted a write")
+	}
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RunningJob is a job that recorded its start and has not recorded its end.
+// One found at startup was cut off by a crash or power loss.
+type RunningJob struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	Actor     string `json:"actor"`
+	Detail    string `json:"detail"`
+	StartedAt string `json:"started_at"`
+}
+
+// MediaFile is the library path, size and content hash of a media item.
+type MediaFile struct {
+	ID        int64
+	DestPath  string
+	SizeBytes int64
+	SHA256    string
+}
+
+// BeginJob records that a job started and returns its id for EndJob.
+func (s *Store) BeginJob(ctx context.Context, kind, actor, detail string) (int64, error) {
+	res, err := s.DB.ExecContext(ctx,
+		`INSERT INTO running_jobs (kind, actor, detail, started_at) VALUES (?, ?, ?, ?)`,
+		kind, actor, detail, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// EndJob records that a job finished, whatever its outcome.
+func (s *Store) EndJob(ctx context.Context, id int64) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM running_jobs WHERE id = ?`, id)
+	return err
+}
+
+// TakeRunningJobs returns the jobs that never recorded their end and
+// forgets them. It is only meaningful before any job starts.
+func (s *Store) TakeRunningJobs(ctx context.Context) ([]RunningJob, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, kind, actor, detail, started_at FROM running_jobs ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]RunningJob, 0)
+	for rows.Next() {
+		var j RunningJob
+		if err := rows.Scan(&j.ID, &j.Kind, &j.Actor, &j.Detail, &j.StartedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) > 0 {
+		if _, err := s.DB.ExecContext(ctx, `DELETE FROM running_jobs WHERE id <= ?`, out[len(out)-1].ID); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// MediaFiles returns the library path, size and hash of every media item.
+func (s *Store) MediaFiles(ctx context.Context) ([]MediaFile, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, dest_path, size_bytes, sha256 FROM media_files ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]MediaFile, 0)
+	for rows.Next() {
+		var f MediaFile
+		if err := rows.Scan(&f.ID, &f.DestPath, &f.SizeBytes, &f.SHA256); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// AccountedPaths returns the library files that belong to no media record
+// but are still known: sidecars, and the files of deletes waiting to be
+// purged. A library check must not take them for orphans.
+func (s *Store) AccountedPaths(ctx context.Context) (map[string]struct{}, error) {
+	out := make(map[string]struct{})
+	rows, err := s.DB.QueryContext(ctx, `SELECT dest_path FROM media_sidecars`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out[path] = struct{}{}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	purges, err := s.queryPurges(ctx, `SELECT `+purgeColumns+` FROM media_purges p`)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range purges {
+		dest := p.Record.DestPath
+		out[dest] = struct{}{}
+		// Sidecars sit next to their media under its name; see
+		// sidecar.DestPath.
+		for _, sc := range p.Sidecars {
+			out[strings.TrimSuffix(dest, filepath.Ext(dest))+strings.ToLower(filepath.Ext(sc.SourcePath))] = struct{}{}
+		}
+	}
+	return out, nil
+}
+
+// SetMediaDestPath records that a media item's library file is now at path,
+// and clears its missing flag.
+func (s *Store) SetMediaDestPath(ctx context.Context, id int64, path string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE media_files SET dest_path = ? WHERE id = ?`, path, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM missing_media WHERE media_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetMediaMissing flags or clears a media item whose library file is gone.
+func (s *Store) SetMediaMissing(ctx context.Context, id int64, missing bool) error {
+	if !missing {
+		_, err := s.DB.ExecContext(ctx, `DELETE FROM missing_media WHERE media_id = ?`, id)
+		return err
+	}
+	_, err := s.DB.ExecContext(ctx,
+		`INSERT INTO missing_media (media_id, detected_at) VALUES (?, ?) ON CONFLICT(media_id) DO NOTHING`,
+		id, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// MissingMediaIDs returns the media items flagged as missing.
+func (s *Store) MissingMediaIDs(ctx context.Context) (map[int64]struct{}, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT media_id FROM missing_media`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[int64]struct{})
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out[id] = struct{}{}
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// ReplaceRecoveryCodes stores a fresh set of recovery code hashes for
+// userID, discarding the old set, used or not.
+func (s *Store) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) (err error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if _, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, hash := range hashes {
+		if _, err = tx.ExecContext(ctx,
+			`INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`,
+			userID, hash, now,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused code of userID as used and reports
+// whether there was one. A code works once.
+func (s *Store) UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx,
+		`UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at = ''`,
+		time.Now().UTC().Format(time.RFC3339), userID, hash,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// RecoveryCodesLeft counts the unused recovery codes of userID.
+func (s *Store) RecoveryCodesLeft(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at = ''`, userID).Scan(&n)
+	return n, err
+}
+
+// ResetPassword replaces the password of userID, signs out every session
+// made with the old one and revokes the account's API tokens, which whoever
+// had the old password could have minted.
+func (s *Store) ResetPassword(ctx context.Context, userID int64, hash, salt []byte) (err error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if _, err = tx.ExecContext(ctx, `UPDATE users SET password_hash = ?, salt = ? WHERE id = ?`, hash, salt, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM api_tokens WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
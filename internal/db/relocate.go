@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// RelocateResult counts the rows RelocateLibrary pointed at the new folder.
+type RelocateResult struct {
+	Media     int64 `json:"media"`
+	Sidecars  int64 `json:"sidecars"`
+	Trash     int64 `json:"trash"`
+	Purges    int64 `json:"purges"`
+	Other     int64 `json:"other"` // timelapse videos and integrity issues
+	Unchanged int64 `json:"unchanged"`
+}
+
+// RelocateLibrary points every library path recorded under from at the same
+// place under to, and sets the setting settingKey, the base storage folder,
+// to to, all in one transaction. Paths outside from, such as objects in
+// remote storage, are left as they are. Before anything is rewritten,
+// ensure is called with the paths that will move: the recorded files, the
+// trash folders and the files waiting to be purged. Writes are held off
+// while it runs, so it can copy what changed since the tree was copied; if
+// it fails, nothing is changed.
+func (s *Store) RelocateLibrary(ctx context.Context, from, to, settingKey string, ensure func(paths []string) error) (res RelocateResult, err error) {
+	from, to = filepath.Clean(from), filepath.Clean(to)
+	prefix := from + string(filepath.Separator)
+	// substr counts characters, not bytes.
+	cut := utf8.RuneCountInString(from) + 1
+	move := func(path string) (string, bool) {
+		if !strings.HasPrefix(path, prefix) {
+			return path, false
+		}
+		return to + path[len(from):], true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var paths []string
+	rows, err := tx.QueryContext(ctx, `
+		SELECT dest_path FROM media_files
+		UNION ALL SELECT dest_path FROM media_sidecars
+		UNION ALL SELECT trash_dir FROM media_trash WHERE trash_dir != ''
+		UNION ALL SELECT json_extract(record_json, '$.dest_path') FROM media_purges`)
+	if err != nil {
+		return res, err
+	}
+	for rows.Next() {
+		var path sql.NullString
+		if err = rows.Scan(&path); err != nil {
+			rows.Close()
+			return res, err
+		}
+		if _, ok := move(path.String); ok {
+			paths = append(paths, path.String)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+	if err = ensure(paths); err != nil {
+		return res, err
+	}
+
+	rewrite := func(query string, args ...any) (int64, error) {
+		r, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		return r.RowsAffected()
+	}
+	if res.Media, err = rewrite(`UPDATE media_files SET dest_path = ? || substr(dest_path, ?) WHERE substr(dest_path, 1, ?) = ?`,
+		to, cut, cut, prefix); err != nil {
+		return res, err
+	}
+	if res.Sidecars, err = rewrite(`UPDATE media_sidecars SET dest_path = ? || substr(dest_path, ?) WHERE substr(dest_path, 1, ?) = ?`,
+		to, cut, cut, prefix); err != nil {
+		return res, err
+	}
+	n, err := rewrite(`UPDATE timelapses SET video_path = ? || substr(video_path, ?) WHERE substr(video_path, 1, ?) = ?`,
+		to, cut, cut, prefix)
+	if err != nil {
+		return res, err
+	}
+	res.Other += n
+	if n, err = rewrite(`UPDATE integrity_issues SET dest_path = ? || substr(dest_path, ?) WHERE substr(dest_path, 1, ?) = ?`,
+		to, cut, cut, prefix); err != nil {
+		return res, err
+	}
+	res.Other += n
+	if res.Purges, err = rewrite(`
+		UPDATE media_purges
+		SET record_json = json_set(record_json, '$.dest_path', ? || substr(json_extract(record_json, '$.dest_path'), ?))
+		WHERE substr(json_extract(record_json, '$.dest_path'), 1, ?) = ?`,
+		to, cut, cut, prefix); err != nil {
+		return res, err
+	}
+
+	// Trashed items keep their record and sidecars as JSON, with paths in
+	// both.
+	type trashRow struct {
+		id                   int64
+		dir, recJSON, scJSON string
+	}
+	var trashed []trashRow
+	rows, err = tx.QueryContext(ctx, `SELECT media_id, trash_dir, record_json, sidecars_json FROM media_trash`)
+	if err != nil {
+		return res, err
+	}
+	for rows.Next() {
+		var t trashRow
+		if err = rows.Scan(&t.id, &t.dir, &t.recJSON, &t.scJSON); err != nil {
+			rows.Close()
+			return res, err
+		}
+		trashed = append(trashed, t)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+	for _, t := range trashed {
+		var (
+			rec      MediaRecord
+			sidecars []TrashSidecar
+		)
+		if err = json.Unmarshal([]byte(t.recJSON), &rec); err != nil {
+			return res, err
+		}
+		if err = json.Unmarshal([]byte(t.scJSON), &sidecars); err != nil {
+			return res, err
+		}
+		dir, moved := move(t.dir)
+		var ok bool
+		if rec.DestPath, ok = move(rec.DestPath); ok {
+			moved = true
+		}
+		for i := range sidecars {
+			if sidecars[i].DestPath, ok = move(sidecars[i].DestPath); ok {
+				moved = true
+			}
+		}
+		if !moved {
+			continue
+		}
+		recJSON, _ := json.Marshal(rec)
+		scJSON, _ := json.Marshal(sidecars)
+		if _, err = tx.ExecContext(ctx, `UPDATE media_trash SET trash_dir = ?, record_json = ?, sidecars_json = ? WHERE media_id = ?`,
+			dir, string(recJSON), string(scJSON), t.id); err != nil {
+			return res, err
+		}
+		res.Trash++
+	}
+
+	var total int64
+	if err = tx.QueryRowContext(ctx, `SELECT COUNT(1) FROM media_files`).Scan(&total); err != nil {
+		return res, err
+	}
+	res.Unchanged = total - res.Media
+	if _, err = tx.ExecContext(ctx,
+		`INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		settingKey, to, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return res, err
+	}
+	return res, tx.Commit()
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// searchColumns are the media_search columns and how each is built from a
+// media_files row, referred to as %[1]s. Metadata is flattened to its leaf
+// keys and values, so `LensModel` and `RF24-105mm` both find a file.
+var searchColumns = []struct{ name, expr string }{
+	{"file_name", `%[1]s.file_name`},
+	{"camera", `COALESCE(%[1]s.make, '') || ' ' || COALESCE(%[1]s.model, '')`},
+	{"place", `COALESCE(%[1]s.loc_display_name, '') || ' ' || COALESCE(%[1]s.loc_road, '') || ' ' ||
+		COALESCE(%[1]s.loc_city, '') || ' ' || COALESCE(%[1]s.loc_county, '') || ' ' || COALESCE(%[1]s.loc_state, '') || ' ' ||
+		COALESCE(%[1]s.loc_country, '') || ' ' || COALESCE(%[1]s.loc_postcode, '')`},
+	{"metadata", `COALESCE((SELECT group_concat(CASE WHEN typeof(key) = 'text' THEN key || ' ' ELSE '' END || COALESCE(atom, ''), ' ')
+		FROM json_tree(CASE WHEN json_valid(%[1]s.metadata_json) THEN %[1]s.metadata_json ELSE '{}' END)
+		WHERE type NOT IN ('object', 'array')), '')`},
+}
+
+// searchRank weighs a match in the file name above one in the camera or
+// place, and those above one deep in the metadata.
+const searchRank = `bm25(media_search, 10.0, 4.0, 4.0, 1.0)`
+
+// ensureSearchIndex creates the full-text index over media_files, the
+// triggers that keep it in step, and indexes rows it does not hold yet:
+// every row the first time, and rows left out while a rebuild of
+// media_files had dropped the triggers.
+func (s *Store) ensureSearchIndex(ctx context.Context) error {
+	names := make([]string, len(searchColumns))
+	newValues := make([]string, len(searchColumns))
+	rowValues := make([]string, len(searchColumns))
+	for i, c := range searchColumns {
+		names[i] = c.name
+		newValues[i] = fmt.Sprintf(c.expr, "new")
+		rowValues[i] = fmt.Sprintf(c.expr, "m")
+	}
+	cols := strings.Join(names, ", ")
+	stmts := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS media_search USING fts5(` + cols + `, tokenize = 'unicode61 remove_diacritics 2');`,
+		`CREATE TRIGGER IF NOT EXISTS media_search_ai AFTER INSERT ON media_files BEGIN
+			INSERT INTO media_search (rowid, ` + cols + `) VALUES (new.id, ` + strings.Join(newValues, ", ") + `);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS media_search_ad AFTER DELETE ON media_files BEGIN
+			DELETE FROM media_search WHERE rowid = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS media_search_au AFTER UPDATE OF file_name, make, model, loc_display_name, loc_road,
+			loc_city, loc_county, loc_state, loc_country, loc_postcode, metadata_json ON media_files BEGIN
+			DELETE FROM media_search WHERE rowid = old.id;
+			INSERT INTO media_search (rowid, ` + cols + `) VALUES (new.id, ` + strings.Join(newValues, ", ") + `);
+		END;`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create search index: %w", err)
+		}
+	}
+
+	var one int
+	err := s.DB.QueryRowContext(ctx, `SELECT 1 FROM media_files WHERE id NOT IN (SELECT rowid FROM media_search) LIMIT 1`).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO media_search (rowid, `+cols+`)
+		SELECT m.id, `+strings.Join(rowValues, ", ")+`
+		FROM media_files m
+		WHERE m.id NOT IN (SELECT rowid FROM media_search)
+	`)
+	if err != nil {
+		return fmt.Errorf("build search index: %w", err)
+	}
+	return nil
+}
+
+// matchQuery turns a search box query into an FTS5 expression: every word
+// must appear, and the last may be a prefix so partial serial numbers and
+// names match while typing. Punctuation only separates words, as in the
+// index, so user input can never form FTS syntax.
+func matchQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	for i, w := range words {
+		words[i] = `"` + w + `"`
+	}
+	return strings.Join(words, " ") + "*"
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// Sidecar is a companion file kept next to a media file, such as a DJI
+// .SRT telemetry subtitle or an .XMP edit.
+type Sidecar struct {
+	ID         int64  `json:"id"`
+	MediaID    int64  `json:"media_id"`
+	Kind       string `json:"kind"`
+	FileName   string `json:"file_name"`
+	SourcePath string `json:"source_path"`
+	DestPath   string `json:"-"`
+	SizeBytes  int64  `json:"size_bytes"`
+	SHA256     string `json:"sha256"`
+}
+
+// AddMediaSidecars records the sidecars copied with media file mediaID.
+func (s *Store) AddMediaSidecars(ctx context.Context, mediaID int64, sidecars []Sidecar) error {
+	if len(sidecars) == 0 {
+		return nil
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, sc := range sidecars {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO media_sidecars (media_id, kind, file_name, source_path, dest_path, size_bytes, sha256)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			mediaID, sc.Kind, sc.FileName, sc.SourcePath, sc.DestPath, sc.SizeBytes, sc.SHA256); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const sidecarColumns = `id, media_id, kind, file_name, source_path, dest_path, size_bytes, sha256`
+
+func (s *Store) scanSidecar(row interface{ Scan(...any) error }) (Sidecar, error) {
+	var sc Sidecar
+	err := row.Scan(&sc.ID, &sc.MediaID, &sc.Kind, &sc.FileName, &sc.SourcePath, &sc.DestPath, &sc.SizeBytes, &sc.SHA256)
+	sc.DestPath = s.rebase(sc.DestPath)
+	return sc, err
+}
+
+// ListMediaSidecars returns the sidecars of media file mediaID by kind.
+func (s *Store) ListMediaSidecars(ctx context.Context, mediaID int64) ([]Sidecar, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+sidecarColumns+` FROM media_sidecars WHERE media_id = ? ORDER BY kind`, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]Sidecar, 0)
+	for rows.Next() {
+		sc, err := s.scanSidecar(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sc)
+	}
+	return out, rows.Err()
+}
+
+// GetMediaSidecar returns sidecar id of media file mediaID, or nil.
+func (s *Store) GetMediaSidecar(ctx context.Context, mediaID, id int64) (*Sidecar, error) {
+	sc, err := s.scanSidecar(s.DB.QueryRowContext(ctx, `SELECT `+sidecarColumns+` FROM media_sidecars WHERE id = ? AND media_id = ?`, id, mediaID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
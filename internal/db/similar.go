@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type ImageHashTodo struct {
+	ID        int64
+	DestPath  string
+	Extension string
+}
+
+// ImageHash is the 64-bit perceptual hash of a library image.
+type ImageHash struct {
+	MediaID int64
+	Hash    uint64
+}
+
+// ListImageHashTodos returns images that have not been hashed, oldest first.
+func (s *Store) ListImageHashTodos(ctx context.Context, limit int) ([]ImageHashTodo, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, dest_path, extension
+		FROM media_files
+		WHERE kind = 'image' AND id NOT IN (SELECT media_id FROM image_hashes)
+		ORDER BY id ASC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]ImageHashTodo, 0)
+	for rows.Next() {
+		var t ImageHashTodo
+		if err := rows.Scan(&t.ID, &t.DestPath, &t.Extension); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CountImageHashTodos(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(1) FROM media_files
+		WHERE kind = 'image' AND id NOT IN (SELECT media_id FROM image_hashes)
+	`).Scan(&n)
+	return n, err
+}
+
+// RecordImageHash stores the hash of an image. When scanErr is set the image
+// is marked as unhashable instead and hash is ignored.
+func (s *Store) RecordImageHash(ctx context.Context, mediaID int64, hash uint64, scanErr string) error {
+	var value any = int64(hash)
+	if scanErr != "" {
+		value = nil
+	}
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO image_hashes (media_id, dhash, hashed_at, error) VALUES (?, ?, ?, ?)
+		ON CONFLICT(media_id) DO UPDATE SET dhash = excluded.dhash, hashed_at = excluded.hashed_at, error = excluded.error
+	`, mediaID, value, time.Now().UTC().Format(time.RFC3339), nullable(scanErr))
+	return err
+}
+
+// GetImageHash returns the hash of a media item, or nil when it has none.
+func (s *Store) GetImageHash(ctx context.Context, mediaID int64) (*ImageHash, error) {
+	var hash sql.NullInt64
+	err := s.DB.QueryRowContext(ctx, `SELECT dhash FROM image_hashes WHERE media_id = ?`, mediaID).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !hash.Valid) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ImageHash{MediaID: mediaID, Hash: uint64(hash.Int64)}, nil
+}
+
+// ListImageHashes returns the hashes of every hashed image matching filter.
+// SQLite cannot count bits, so callers compare hashes in memory; at 16 bytes
+// a row even a large library fits easily.
+func (s *Store) ListImageHashes(ctx context.Context, filter MediaFilter) ([]ImageHash, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
+	where, args := buildLocationWhere(filter)
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT media_id, dhash
+		FROM image_hashes
+		WHERE dhash IS NOT NULL AND media_id IN (SELECT id FROM media_files WHERE %s)
+	`, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]ImageHash, 0)
+	for rows.Next() {
+		var (
+			h    ImageHash
+			hash int64
+		)
+		if err := rows.Scan(&h.MediaID, &hash); err != nil {
+			return nil, err
+		}
+		h.Hash = uint64(hash)
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
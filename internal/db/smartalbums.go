@@ -0,0 +1,187 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SmartRules is the saved filter of a smart album. Its items are whatever
+// the rules match when the album is read, so new media join on their own.
+// The fields are the GET /api/media query parameters of the same names.
+type SmartRules struct {
+	State         string `json:"state,omitempty"`
+	County        string `json:"county,omitempty"`
+	City          string `json:"city,omitempty"`
+	Road          string `json:"road,omitempty"`
+	Kind          string `json:"kind,omitempty"`
+	From          string `json:"from,omitempty"` // RFC 3339
+	To            string `json:"to,omitempty"`
+	DeviceMake    string `json:"device_make,omitempty"`
+	DeviceModel   string `json:"device_model,omitempty"`
+	DeviceUnknown bool   `json:"device_unknown,omitempty"`
+	Tag           string `json:"tag,omitempty"`
+	GPS           string `json:"gps,omitempty"` // "yes" or "no"
+}
+
+// Filter is the media filter the rules stand for.
+func (r SmartRules) Filter() MediaFilter {
+	return MediaFilter{
+		State:       r.State,
+		County:      r.County,
+		City:        r.City,
+		Road:        r.Road,
+		Kind:        r.Kind,
+		CaptureFrom: r.From,
+		CaptureTo:   r.To,
+		DeviceMake:  r.DeviceMake,
+		DeviceModel: r.DeviceModel,
+		DeviceUnset: r.DeviceUnknown,
+		Tag:         r.Tag,
+		HasGPS:      r.GPS,
+	}
+}
+
+// ErrSmartAlbum is returned when items are added to or removed from a smart
+// album.
+var ErrSmartAlbum = errors.New("smart albums take their items from their rules")
+
+// CreateSmartAlbum creates an album whose items are whatever rules match.
+func (s *Store) CreateSmartAlbum(ctx context.Context, name string, rules SmartRules) (*Album, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("album name is required")
+	}
+	if len(name) > 120 {
+		return nil, errors.New("album name too long")
+	}
+	raw, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := tx.ExecContext(ctx, `INSERT INTO albums (name, created_at, updated_at) VALUES (?, ?, ?)`, name, now, now)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO smart_albums (album_id, rules_json) VALUES (?, ?)`, id, string(raw)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetAlbumByID(ctx, id)
+}
+
+// SetSmartAlbumRules saves the rules of album id, making it a smart album
+// if it was not one, and returns it, or nil if there is no such album.
+func (s *Store) SetSmartAlbumRules(ctx context.Context, id int64, rules SmartRules) (*Album, error) {
+	raw, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE albums SET updated_at = ?, version = version + 1 WHERE id = ?`,
+		time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO smart_albums (album_id, rules_json) VALUES (?, ?)
+		ON CONFLICT(album_id) DO UPDATE SET rules_json = excluded.rules_json
+	`, id, string(raw)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetAlbumByID(ctx, id)
+}
+
+// smartAlbumRules returns the rules of album id, or nil for a manual album.
+func (s *Store) smartAlbumRules(ctx context.Context, id int64) (*SmartRules, error) {
+	var raw string
+	err := s.DB.QueryRowContext(ctx, `SELECT rules_json FROM smart_albums WHERE album_id = ?`, id).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rules SmartRules
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("smart album %d: %w", id, err)
+	}
+	return &rules, nil
+}
+
+// resolveSmartAlbum looks up the rules of the album filter.AlbumID names,
+// if it is a smart album, for buildLocationWhere to use in place of its
+// items. Every query that takes a MediaFilter calls it first.
+func (s *Store) resolveSmartAlbum(ctx context.Context, filter *MediaFilter) error {
+	filter.smart = nil
+	if filter.AlbumID <= 0 {
+		return nil
+	}
+	rules, err := s.smartAlbumRules(ctx, filter.AlbumID)
+	if err != nil || rules == nil {
+		return err
+	}
+	f := rules.Filter()
+	filter.smart = &f
+	return nil
+}
+
+// fillSmartAlbums sets the rules and current item count of the smart
+// albums among albums, given each album's rules_json.
+func (s *Store) fillSmartAlbums(ctx context.Context, albums []Album, rulesJSON []sql.NullString) error {
+	for i := range albums {
+		if !rulesJSON[i].Valid {
+			continue
+		}
+		var rules SmartRules
+		if err := json.Unmarshal([]byte(rulesJSON[i].String), &rules); err != nil {
+			return fmt.Errorf("smart album %d: %w", albums[i].ID, err)
+		}
+		where, args := buildLocationWhere(rules.Filter())
+		if err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM media_files WHERE `+where, args...).Scan(&albums[i].ItemCount); err != nil {
+			return err
+		}
+		albums[i].Smart = true
+		albums[i].Rules = &rules
+	}
+	return nil
+}
+
+// checkManualAlbum returns ErrSmartAlbum if album id is a smart album.
+func checkManualAlbum(ctx context.Context, tx *sql.Tx, id int64) error {
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM smart_albums WHERE album_id = ?`, id).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrSmartAlbum
+	}
+	return nil
+}
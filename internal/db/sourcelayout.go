@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// SourceFolder is one folder of the card layout and how many files were
+// shot into it or below it.
+type SourceFolder struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Count int64  `json:"count"`
+}
+
+// SourceLayout splits a source file into its card's volume name and its
+// slash-separated path below the card root. Files that are not below mount
+// (uploads, replicas) keep only their file name.
+func SourceLayout(mount, path string) (card, rel string) {
+	mount = filepath.Clean(mount)
+	if base := filepath.Base(mount); base != "." && base != string(filepath.Separator) {
+		card = base
+	}
+	rel, err := filepath.Rel(mount, filepath.Clean(path))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(path)
+	}
+	return card, filepath.ToSlash(rel)
+}
+
+// backfillSourceLayout fills in the card layout for records ingested before
+// it was stored.
+func (s *Store) backfillSourceLayout(ctx context.Context) error {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, source_mount, source_path FROM media_files WHERE source_rel_path = ''`)
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id          int64
+		mount, path string
+	}
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.mount, &p.path); err != nil {
+			rows.Close()
+			return err
+		}
+		todo = append(todo, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	for _, p := range todo {
+		card, rel := SourceLayout(p.mount, p.path)
+		if _, err := tx.ExecContext(ctx, `UPDATE media_files SET source_card = ?, source_rel_path = ? WHERE id = ?`, card, rel, p.id); err != nil {
+			return fmt.Errorf("backfill source layout: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ListSourceFolders returns the folders directly below parent in the card
+// layout ("" for the card root) with the number of matching files in each.
+// It also returns how many matching files sit in parent itself.
+func (s *Store) ListSourceFolders(ctx context.Context, parent string, filter MediaFilter) ([]SourceFolder, int64, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, 0, err
+	}
+	parent = strings.Trim(parent, "/")
+	filter.SourceDir = parent
+	where, args := buildLocationWhere(filter)
+	prefix := ""
+	if parent != "" {
+		prefix = parent + "/"
+	}
+	query := fmt.Sprintf(`
+		SELECT CASE WHEN instr(rest, '/') > 0 THEN substr(rest, 1, instr(rest, '/') - 1) ELSE '' END AS name,
+		       COUNT(1) AS count
+		FROM (SELECT substr(source_rel_path, ?) AS rest FROM media_files WHERE %s)
+		GROUP BY name
+		ORDER BY name ASC
+	`, where)
+	args = append([]any{utf8.RuneCountInString(prefix) + 1}, args...)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	out := make([]SourceFolder, 0)
+	var files int64
+	for rows.Next() {
+		var f SourceFolder
+		if err := rows.Scan(&f.Name, &f.Count); err != nil {
+			return nil, 0, err
+		}
+		if f.Name == "" {
+			files = f.Count
+			continue
+		}
+		f.Path = prefix + f.Name
+		out = append(out, f)
+	}
+	return out, files, rows.Err()
+}
+
+// ListSourceCards returns the card volume names files came from, with the
+// number of matching files from each.
+func (s *Store) ListSourceCards(ctx context.Context, filter MediaFilter) ([]SourceFolder, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
+	filter.SourceCard = ""
+	where, args := buildLocationWhere(filter)
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT source_card, COUNT(1) AS count
+		FROM media_files
+		WHERE %s
+		GROUP BY source_card
+		ORDER BY source_card ASC
+	`, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]SourceFolder, 0)
+	for rows.Next() {
+		var f SourceFolder
+		if err := rows.Scan(&f.Name, &f.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
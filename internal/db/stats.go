@@ -0,0 +1,238 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// MediaStats summarises a set of media items: how much there is, the
+// capture dates it spans, and how far apart it was taken.
+type MediaStats struct {
+	Count        int64           `json:"count"`
+	Bytes        int64           `json:"bytes"`
+	Images       int64           `json:"images"`
+	Videos       int64           `json:"videos"`
+	FirstCapture string          `json:"first_capture"`
+	LastCapture  string          `json:"last_capture"`
+	WithGPS      int64           `json:"with_gps"`
+	Places       int64           `json:"places"` // distinct state/county/city
+	MinLat       sql.NullFloat64 `json:"min_lat"`
+	MinLon       sql.NullFloat64 `json:"min_lon"`
+	MaxLat       sql.NullFloat64 `json:"max_lat"`
+	MaxLon       sql.NullFloat64 `json:"max_lon"`
+}
+
+type AlbumStats struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	MediaStats
+}
+
+type TagStats struct {
+	Tag string `json:"tag"`
+	MediaStats
+}
+
+// statsColumns aggregates media_files rows aliased as m. COUNT(m.id) stays
+// zero when an outer join finds no media.
+const statsColumns = `
+	COUNT(m.id),
+	COALESCE(SUM(m.size_bytes), 0),
+	COALESCE(SUM(m.kind = 'image'), 0),
+	COALESCE(SUM(m.kind = 'video'), 0),
+	COALESCE(MIN(NULLIF(m.capture_time, '')), ''),
+	COALESCE(MAX(NULLIF(m.capture_time, '')), ''),
+	COUNT(m.gps_lat),
+	COUNT(DISTINCT CASE WHEN TRIM(COALESCE(m.loc_city, '')) <> ''
+		THEN COALESCE(m.loc_state, '') || '|' || COALESCE(m.loc_county, '') || '|' || m.loc_city END),
+	MIN(m.gps_lat), MIN(m.gps_lon), MAX(m.gps_lat), MAX(m.gps_lon)`
+
+func (st *MediaStats) scanDest() []any {
+	return []any{
+		&st.Count, &st.Bytes, &st.Images, &st.Videos,
+		&st.FirstCapture, &st.LastCapture, &st.WithGPS, &st.Places,
+		&st.MinLat, &st.MinLon, &st.MaxLat, &st.MaxLon,
+	}
+}
+
+// LibraryStats aggregates every media item matching filter.
+func (s *Store) LibraryStats(ctx context.Context, filter MediaFilter) (MediaStats, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return MediaStats{}, err
+	}
+	where, args := buildLocationWhere(filter)
+	var st MediaStats
+	err := s.DB.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM (SELECT * FROM media_files WHERE %s) m
+	`, statsColumns, where), args...).Scan(st.scanDest()...)
+	return st, err
+}
+
+// ListAlbumStats aggregates each album's items that match filter. Albums
+// with no matching items are included with zero counts, largest first.
+func (s *Store) ListAlbumStats(ctx context.Context, filter MediaFilter, limit int) ([]AlbumStats, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	where, args := buildLocationWhere(filter)
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT a.id, a.name, %s
+		FROM albums a
+		LEFT JOIN album_items ai ON ai.album_id = a.id
+			AND ai.media_id IN (SELECT id FROM media_files WHERE %s)
+		LEFT JOIN media_files m ON m.id = ai.media_id
+		GROUP BY a.id
+		ORDER BY COUNT(m.id) DESC, a.name ASC
+		LIMIT ?
+	`, statsColumns, where), append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]AlbumStats, 0)
+	for rows.Next() {
+		var st AlbumStats
+		if err := rows.Scan(append([]any{&st.ID, &st.Name}, st.scanDest()...)...); err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+// ListTagStats aggregates the media under each user or rule tag among items
+// matching filter, largest first. Machine tags are left out.
+func (s *Store) ListTagStats(ctx context.Context, filter MediaFilter, limit int) ([]TagStats, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	where, args := buildLocationWhere(filter)
+	args = append([]any{TagSourceAuto}, args...)
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT t.tag, %s
+		FROM media_tags t
+		JOIN media_files m ON m.id = t.media_id
+		WHERE t.source <> ? AND t.media_id IN (SELECT id FROM media_files WHERE %s)
+		GROUP BY t.tag
+		ORDER BY COUNT(m.id) DESC, t.tag ASC
+		LIMIT ?
+	`, statsColumns, where), append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]TagStats, 0)
+	for rows.Next() {
+		var st TagStats
+		if err := rows.Scan(append([]any{&st.Tag}, st.scanDest()...)...); err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+// UsageGroup is the media recorded under one folder, year, or kind.
+type UsageGroup struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// StorageUsage breaks the library down the ways that matter when deciding
+// what to move off the primary drive.
+type StorageUsage struct {
+	Folders []UsageGroup `json:"folders"` // first folder below base storage
+	Years   []UsageGroup `json:"years"`   // capture year
+	Kinds   []UsageGroup `json:"kinds"`
+	// Compressed covers the files kept compressed: their original size
+	// in Bytes and what they take in the library in StoredBytes.
+	Compressed struct {
+		Count       int64 `json:"count"`
+		Bytes       int64 `json:"bytes"`
+		StoredBytes int64 `json:"stored_bytes"`
+	} `json:"compressed"`
+}
+
+// StorageUsage groups every media item by its top-level folder below base
+// (sep is the path separator), capture year, and kind, largest first.
+// Files stored outside base are grouped under "".
+func (s *Store) StorageUsage(ctx context.Context, base, sep string) (StorageUsage, error) {
+	var out StorageUsage
+	var err error
+	prefix := base + sep
+	out.Folders, err = s.usageGroups(ctx, `
+		SELECT CASE WHEN substr(dest_path, 1, length(?1)) <> ?1 THEN ''
+			WHEN instr(substr(dest_path, length(?1) + 1), ?2) = 0 THEN ''
+			ELSE substr(dest_path, length(?1) + 1, instr(substr(dest_path, length(?1) + 1), ?2) - 1)
+			END AS k,
+			COUNT(*), COALESCE(SUM(size_bytes), 0)
+		FROM media_files GROUP BY k ORDER BY 3 DESC, k ASC
+	`, prefix, sep)
+	if err != nil {
+		return out, err
+	}
+	out.Years, err = s.usageGroups(ctx, `
+		SELECT substr(capture_time, 1, 4) AS k, COUNT(*), COALESCE(SUM(size_bytes), 0)
+		FROM media_files GROUP BY k ORDER BY k DESC
+	`)
+	if err != nil {
+		return out, err
+	}
+	out.Kinds, err = s.usageGroups(ctx, `
+		SELECT kind AS k, COUNT(*), COALESCE(SUM(size_bytes), 0)
+		FROM media_files GROUP BY k ORDER BY 3 DESC, k ASC
+	`)
+	if err != nil {
+		return out, err
+	}
+	err = s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(size_bytes), 0), COALESCE(SUM(stored_bytes), 0)
+		FROM media_files WHERE stored_bytes IS NOT NULL
+	`).Scan(&out.Compressed.Count, &out.Compressed.Bytes, &out.Compressed.StoredBytes)
+	return out, err
+}
+
+func (s *Store) usageGroups(ctx context.Context, query string, args ...any) ([]UsageGroup, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]UsageGroup, 0)
+	for rows.Next() {
+		var g UsageGroup
+		if err := rows.Scan(&g.Key, &g.Count, &g.Bytes); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// DestPaths returns the library path of every media item and sidecar.
+func (s *Store) DestPaths(ctx context.Context) (map[string]struct{}, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT dest_path FROM media_files UNION ALL SELECT dest_path FROM media_sidecars`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]struct{})
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		out[p] = struct{}{}
+	}
+	return out, rows.Err()
+}
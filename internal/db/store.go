@@ -13,24 +13,78 @@ import (
 	"time"
 
 	_ "modernc.org/sqlite"
+
+	"businessplan/usbvault/internal/fault"
 )
 
 type Store struct {
 	DB *sql.DB
 	mu sync.Mutex
+	// read serves the lookups that must not queue behind the writer; see
+	// reader.
+	read *sql.DB
+
+	readOnly bool
+	// rebaseFrom and rebaseTo relocate library paths; see Rebase.
+	rebaseFrom, rebaseTo string
 }
 
+const (
+	RoleAdmin = "admin"
+	RoleGuest = "guest"
+)
+
 type User struct {
 	ID           int64
 	Username     string
 	PasswordHash []byte
 	Salt         []byte
+	Role         string
+	ExpiresAt    time.Time // zero for non-expiring accounts
+	ScopeAlbumID int64     // guests only see this album when set
+}
+
+func (u *User) Expired(now time.Time) bool {
+	return !u.ExpiresAt.IsZero() && !now.Before(u.ExpiresAt)
 }
 
 type Session struct {
-	UserID    int64
-	Username  string
-	ExpiresAt time.Time
+	UserID       int64
+	Username     string
+	ExpiresAt    time.Time
+	Role         string
+	ScopeAlbumID int64
+	Watermark    string // guest watermark JSON, empty for none
+	StripGPS     bool   // guest sees files with their position removed
+	Field        bool   // unlocked by the field-mode PIN, limited to ingest and status
+	Device       string // name of the paired device, empty for a sign-in
+}
+
+// DeviceSession is a long-lived session minted for a device paired by QR
+// code. Its token doubles as the device's API token.
+type DeviceSession struct {
+	ID        string `json:"id"` // leading characters of the token hash
+	Device    string `json:"device"`
+	Username  string `json:"username"`
+	Field     bool   `json:"field"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type GuestUser struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	ExpiresAt    string `json:"expires_at"`
+	ScopeAlbumID int64  `json:"album_id"`
+	CreatedBy    string `json:"created_by"`
+	CreatedAt    string `json:"created_at"`
+	ActiveTokens int64  `json:"active_sessions"`
+	Requests     int64  `json:"requests"`
+	LastAccessAt string `json:"last_access_at,omitempty"`
+	AutoRevoke   bool   `json:"auto_revoke"`
+	StripGPS     bool   `json:"strip_gps"`
+
+	Watermark json.RawMessage `json:"watermark,omitempty"`
 }
 
 type MediaRecord struct {
@@ -64,6 +118,39 @@ type MediaRecord struct {
 	Metadata    string          `json:"metadata"`
 	SourceMTime string          `json:"source_mtime"`
 	IngestedAt  string          `json:"ingested_at"`
+
+	// SameContentID links a record to the earliest record with identical
+	// sha256 content (legacy capture-time variants).
+	SameContentID sql.NullInt64 `json:"same_content_id"`
+
+	// ClockUncertain marks records ingested while the system clock was not
+	// trusted: ingested_at, and a capture time taken from the file's
+	// modification time, may be wrong.
+	ClockUncertain bool `json:"clock_uncertain"`
+
+	// DurationSec is read from the video at ingest, or filled in once a
+	// poster frame has been extracted; see SetVideoPoster.
+	DurationSec  sql.NullFloat64 `json:"duration_sec"`
+	PosterStatus string          `json:"poster_status"`
+
+	// VideoCodec, Width and Height describe a video's first video track.
+	VideoCodec sql.NullString `json:"video_codec"`
+	Width      sql.NullInt64  `json:"width"`
+	Height     sql.NullInt64  `json:"height"`
+
+	// StoredBytes is the length of the library copy when it is stored
+	// compressed, before any encryption; see package shrink.
+	StoredBytes sql.NullInt64 `json:"stored_bytes"`
+
+	// Rating is 0 (unrated) to 5 stars; see SetMediaRating.
+	Rating   int  `json:"rating"`
+	Favorite bool `json:"favorite"`
+
+	// SourceCard is the card's volume name and SourceRelPath the file's
+	// slash-separated path below the card root, e.g. "DCIM/100CANON/IMG_0001.JPG".
+	// InsertMedia fills them in from SourceMount and SourcePath when empty.
+	SourceCard    string `json:"source_card"`
+	SourceRelPath string `json:"source_rel_path"`
 }
 
 type MapPoint struct {
@@ -75,6 +162,33 @@ type MapPoint struct {
 	Kind        string  `json:"kind"`
 }
 
+// RestoreDrill is the result of one restore-drill run: a random sample of
+// media fetched back from a backup destination and checked against its hash.
+type RestoreDrill struct {
+	ID          int64  `json:"id"`
+	StartedAt   string `json:"started_at"`
+	FinishedAt  string `json:"finished_at"`
+	Mode        string `json:"mode"`
+	Destination string `json:"destination"`
+	BackupAt    string `json:"backup_at"`
+	Sampled     int    `json:"sampled"`
+	Verified    int    `json:"verified"`
+	Missing     int    `json:"missing"`
+	Mismatched  int    `json:"mismatched"`
+	State       string `json:"state"` // success, failed, error
+	Message     string `json:"message"`
+}
+
+type SecurityAlert struct {
+	ID             int64  `json:"id"`
+	Kind           string `json:"kind"`
+	Message        string `json:"message"`
+	Details        string `json:"details"`
+	CreatedAt      string `json:"created_at"`
+	AcknowledgedAt string `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string `json:"acknowledged_by,omitempty"`
+}
+
 type AuditRecord struct {
 	ID      int64  `json:"id"`
 	TS      string `json:"ts"`
@@ -116,6 +230,29 @@ type MediaFilter struct {
 	DeviceMake  string
 	DeviceModel string
 	DeviceUnset bool
+	Tag         string // user and rule tags
+	AutoTag     string // machine labels from the auto-tagger
+	PersonID    int64
+	PlaceID     int64 // a named place, see places.go
+	// ClockUncertain limits results to records ingested while the system
+	// clock was not trusted.
+	ClockUncertain bool
+	// Missing limits results to records whose library file was not found
+	// by the last startup check.
+	Missing bool
+	// SourceCard and SourceDir limit results to files from one card's
+	// volume and to those shot into a card folder or below it, e.g.
+	// "DCIM/100CANON".
+	SourceCard string
+	SourceDir  string
+	// Favorite limits results to favorites, and MinRating to media rated
+	// at least that many stars.
+	Favorite  bool
+	MinRating int
+
+	// smart holds the rules of a smart album named by AlbumID, set by
+	// resolveSmartAlbum.
+	smart *MediaFilter
 }
 
 type Album struct {
@@ -124,6 +261,11 @@ type Album struct {
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
 	ItemCount int64  `json:"item_count"`
+	Version   int64  `json:"version"` // bumped by every change to the album
+	// Smart albums hold whatever their rules match; ItemCount is the
+	// current number of matches.
+	Smart bool        `json:"smart"`
+	Rules *SmartRules `json:"rules,omitempty"`
 }
 
 type AlbumMediaLink struct {
@@ -155,6 +297,51 @@ type GeoTodo struct {
 	Lon float64
 }
 
+const mediaFilesTableDDL = `CREATE TABLE IF NOT EXISTS %s (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind TEXT NOT NULL,
+	file_name TEXT NOT NULL,
+	extension TEXT NOT NULL,
+	source_mount TEXT NOT NULL,
+	source_path TEXT NOT NULL,
+	dest_path TEXT NOT NULL UNIQUE,
+	size_bytes INTEGER NOT NULL,
+	crc32 TEXT NOT NULL,
+	sha256 TEXT NOT NULL,
+	capture_time TEXT NOT NULL,
+	gps_lat REAL,
+	gps_lon REAL,
+	make TEXT,
+	model TEXT,
+	camera_yaw REAL,
+	camera_pitch REAL,
+	camera_roll REAL,
+	loc_provider TEXT,
+	loc_country TEXT,
+	loc_state TEXT,
+	loc_county TEXT,
+	loc_city TEXT,
+	loc_road TEXT,
+	loc_house_number TEXT,
+	loc_postcode TEXT,
+	loc_display_name TEXT,
+	metadata_json TEXT NOT NULL,
+	source_mtime TEXT NOT NULL,
+	ingested_at TEXT NOT NULL,
+	same_content_id INTEGER REFERENCES media_files(id) ON DELETE SET NULL,
+	clock_uncertain INTEGER NOT NULL DEFAULT 0,
+	duration_sec REAL,
+	poster_status TEXT NOT NULL DEFAULT '',
+	video_codec TEXT,
+	width INTEGER,
+	height INTEGER,
+	source_card TEXT NOT NULL DEFAULT '',
+	source_rel_path TEXT NOT NULL DEFAULT '',
+	stored_bytes INTEGER,
+	rating INTEGER NOT NULL DEFAULT 0,
+	favorite INTEGER NOT NULL DEFAULT 0
+);`
+
 func Open(path string) (*Store, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
 		return nil, fmt.Errorf("create data dir: %w", err)
@@ -174,11 +361,24 @@ func Open(path string) (*Store, error) {
 		_ = db.Close()
 		return nil, err
 	}
+	if store.read, err = openReadPool(path); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("open sqlite read pool: %w", err)
+	}
 
 	return store, nil
 }
 
+// Snapshot writes a transactionally consistent copy of the database to dst.
+func (s *Store) Snapshot(ctx context.Context, dst string) error {
+	_, err := s.DB.ExecContext(ctx, `VACUUM INTO ?`, dst)
+	return err
+}
+
 func (s *Store) Close() error {
+	if s.read != nil {
+		_ = s.read.Close()
+	}
 	return s.DB.Close()
 }
 
@@ -196,7 +396,11 @@ func (s *Store) migrate(ctx context.Context) error {
 			username TEXT NOT NULL UNIQUE,
 			password_hash BLOB NOT NULL,
 			salt BLOB NOT NULL,
-			created_at TEXT NOT NULL
+			created_at TEXT NOT NULL,
+			role TEXT NOT NULL DEFAULT 'admin',
+			expires_at TEXT,
+			scope_album_id INTEGER,
+			created_by TEXT
 		);`,
 		`CREATE TABLE IF NOT EXISTS sessions (
 			token_hash TEXT PRIMARY KEY,
@@ -205,46 +409,13 @@ func (s *Store) migrate(ctx context.Context) error {
 			created_at TEXT NOT NULL,
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 		);`,
-		`CREATE TABLE IF NOT EXISTS media_files (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			kind TEXT NOT NULL,
-			file_name TEXT NOT NULL,
-			extension TEXT NOT NULL,
-			source_mount TEXT NOT NULL,
-			source_path TEXT NOT NULL,
-			dest_path TEXT NOT NULL UNIQUE,
-			size_bytes INTEGER NOT NULL,
-			crc32 TEXT NOT NULL,
-			sha256 TEXT NOT NULL,
-			capture_time TEXT NOT NULL,
-			gps_lat REAL,
-			gps_lon REAL,
-			make TEXT,
-			model TEXT,
-			camera_yaw REAL,
-			camera_pitch REAL,
-			camera_roll REAL,
-			loc_provider TEXT,
-			loc_country TEXT,
-			loc_state TEXT,
-			loc_county TEXT,
-			loc_city TEXT,
-			loc_road TEXT,
-			loc_house_number TEXT,
-			loc_postcode TEXT,
-			loc_display_name TEXT,
-			metadata_json TEXT NOT NULL,
-			source_mtime TEXT NOT NULL,
-			ingested_at TEXT NOT NULL,
-			UNIQUE (crc32, size_bytes, capture_time)
-		);`,
-		`CREATE INDEX IF NOT EXISTS idx_media_capture_time ON media_files(capture_time);`,
-		`CREATE INDEX IF NOT EXISTS idx_media_gps ON media_files(gps_lat, gps_lon);`,
+		fmt.Sprintf(mediaFilesTableDDL, "media_files"),
 		`CREATE TABLE IF NOT EXISTS albums (
 				id INTEGER PRIMARY KEY AUTOINCREMENT,
 				name TEXT NOT NULL UNIQUE,
 				created_at TEXT NOT NULL,
-				updated_at TEXT NOT NULL
+				updated_at TEXT NOT NULL,
+				version INTEGER NOT NULL DEFAULT 1
 			);`,
 		`CREATE TABLE IF NOT EXISTS album_items (
 				album_id INTEGER NOT NULL,
@@ -255,6 +426,20 @@ func (s *Store) migrate(ctx context.Context) error {
 				FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE
 			);`,
 		`CREATE INDEX IF NOT EXISTS idx_album_items_media_id ON album_items(media_id);`,
+		`CREATE TABLE IF NOT EXISTS smart_albums (
+				album_id INTEGER PRIMARY KEY,
+				rules_json TEXT NOT NULL,
+				FOREIGN KEY (album_id) REFERENCES albums(id) ON DELETE CASCADE
+			);`,
+		`CREATE TABLE IF NOT EXISTS media_tags (
+				media_id INTEGER NOT NULL,
+				tag TEXT NOT NULL,
+				source TEXT NOT NULL DEFAULT 'user',
+				created_at TEXT NOT NULL,
+				PRIMARY KEY (media_id, tag),
+				FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE
+			);`,
+		`CREATE INDEX IF NOT EXISTS idx_media_tags_tag ON media_tags(tag);`,
 		`CREATE TABLE IF NOT EXISTS audit_logs (
 				id INTEGER PRIMARY KEY AUTOINCREMENT,
 				ts TEXT NOT NULL,
@@ -264,6 +449,16 @@ func (s *Store) migrate(ctx context.Context) error {
 			prev_hash TEXT NOT NULL,
 			entry_hash TEXT NOT NULL
 		);`,
+		`CREATE TABLE IF NOT EXISTS security_alerts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			message TEXT NOT NULL,
+			details_json TEXT NOT NULL DEFAULT '{}',
+			created_at TEXT NOT NULL,
+			acknowledged_at TEXT,
+			acknowledged_by TEXT
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_security_alerts_open ON security_alerts(acknowledged_at, id);`,
 		`CREATE TABLE IF NOT EXISTS cloud_sync_settings (
 			id INTEGER PRIMARY KEY CHECK (id = 1),
 			enabled INTEGER NOT NULL DEFAULT 0,
@@ -271,6 +466,94 @@ func (s *Store) migrate(ctx context.Context) error {
 			config_json TEXT NOT NULL DEFAULT '{}',
 			updated_at TEXT NOT NULL
 		);`,
+		`CREATE TABLE IF NOT EXISTS restore_drills (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			started_at TEXT NOT NULL,
+			finished_at TEXT NOT NULL,
+			mode TEXT NOT NULL,
+			destination TEXT NOT NULL,
+			backup_at TEXT NOT NULL,
+			sampled INTEGER NOT NULL,
+			verified INTEGER NOT NULL,
+			missing INTEGER NOT NULL,
+			mismatched INTEGER NOT NULL,
+			state TEXT NOT NULL,
+			message TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS people (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS face_regions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			media_id INTEGER NOT NULL,
+			x REAL NOT NULL,
+			y REAL NOT NULL,
+			w REAL NOT NULL,
+			h REAL NOT NULL,
+			score REAL NOT NULL,
+			person_id INTEGER,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE,
+			FOREIGN KEY (person_id) REFERENCES people(id) ON DELETE SET NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_face_regions_media ON face_regions(media_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_face_regions_person ON face_regions(person_id);`,
+		`CREATE TABLE IF NOT EXISTS face_scans (
+			media_id INTEGER PRIMARY KEY,
+			scanned_at TEXT NOT NULL,
+			faces INTEGER NOT NULL,
+			error TEXT,
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS autotag_scans (
+			media_id INTEGER PRIMARY KEY,
+			scanned_at TEXT NOT NULL,
+			labels INTEGER NOT NULL,
+			error TEXT,
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS ocr_scans (
+			media_id INTEGER PRIMARY KEY,
+			scanned_at TEXT NOT NULL,
+			text TEXT NOT NULL DEFAULT '',
+			error TEXT,
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE
+		);`,
+		// ocr_text indexes ocr_scans.text; the triggers keep it in step,
+		// including when a media delete cascades into ocr_scans.
+		`CREATE VIRTUAL TABLE IF NOT EXISTS ocr_text USING fts5(text, content='ocr_scans', content_rowid='media_id');`,
+		`CREATE TRIGGER IF NOT EXISTS ocr_scans_ai AFTER INSERT ON ocr_scans BEGIN
+			INSERT INTO ocr_text (rowid, text) VALUES (new.media_id, new.text);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS ocr_scans_ad AFTER DELETE ON ocr_scans BEGIN
+			INSERT INTO ocr_text (ocr_text, rowid, text) VALUES ('delete', old.media_id, old.text);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS ocr_scans_au AFTER UPDATE ON ocr_scans BEGIN
+			INSERT INTO ocr_text (ocr_text, rowid, text) VALUES ('delete', old.media_id, old.text);
+			INSERT INTO ocr_text (rowid, text) VALUES (new.media_id, new.text);
+		END;`,
+		`CREATE TABLE IF NOT EXISTS image_hashes (
+			media_id INTEGER PRIMARY KEY,
+			dhash INTEGER,
+			hashed_at TEXT NOT NULL,
+			error TEXT,
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS replica_map (
+			entity TEXT NOT NULL,
+			remote_id INTEGER NOT NULL,
+			local_id INTEGER NOT NULL,
+			PRIMARY KEY (entity, remote_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS change_log (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			entity TEXT NOT NULL,
+			entity_key TEXT NOT NULL,
+			op TEXT NOT NULL,
+			changed_at TEXT NOT NULL
+		);`,
 		`CREATE TABLE IF NOT EXISTS geocode_cache (
 			provider TEXT NOT NULL,
 			geocode_key TEXT NOT NULL,
@@ -286,6 +569,294 @@ func (s *Store) migrate(ctx context.Context) error {
 			updated_at TEXT NOT NULL,
 			PRIMARY KEY (provider, geocode_key)
 		);`,
+		`CREATE TABLE IF NOT EXISTS missing_media (
+			media_id INTEGER PRIMARY KEY,
+			detected_at TEXT NOT NULL,
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS running_jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			detail TEXT NOT NULL,
+			started_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS ingest_jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			mount_key TEXT NOT NULL UNIQUE,
+			started_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS ingest_job_files (
+			job_id INTEGER NOT NULL,
+			source_path TEXT NOT NULL,
+			size_bytes INTEGER NOT NULL,
+			mtime TEXT NOT NULL,
+			outcome TEXT NOT NULL,
+			PRIMARY KEY (job_id, source_path),
+			FOREIGN KEY (job_id) REFERENCES ingest_jobs(id) ON DELETE CASCADE
+		);`,
+		// guest_access outlives the guest account on purpose, so a revoked
+		// guest's activity can still be reviewed.
+		`CREATE TABLE IF NOT EXISTS guest_access (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			guest_id INTEGER NOT NULL,
+			username TEXT NOT NULL,
+			session TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			user_agent TEXT NOT NULL,
+			route TEXT NOT NULL,
+			media_id INTEGER,
+			accessed_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_guest_access_guest ON guest_access(guest_id, id);`,
+		`CREATE TABLE IF NOT EXISTS ingest_speed_sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			mount TEXT NOT NULL,
+			mount_key TEXT NOT NULL,
+			fs_type TEXT NOT NULL DEFAULT '',
+			started_at TEXT NOT NULL,
+			seconds REAL NOT NULL,
+			bytes INTEGER NOT NULL,
+			files INTEGER NOT NULL,
+			avg_mbps REAL NOT NULL,
+			peak_mbps REAL NOT NULL,
+			outcome TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_ingest_speed_sessions_mount ON ingest_speed_sessions(mount_key, id);`,
+		`CREATE TABLE IF NOT EXISTS ingest_speed_samples (
+			session_id INTEGER NOT NULL,
+			offset_sec INTEGER NOT NULL,
+			mbps REAL NOT NULL,
+			PRIMARY KEY (session_id, offset_sec),
+			FOREIGN KEY (session_id) REFERENCES ingest_speed_sessions(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS storage_benchmarks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			target TEXT NOT NULL,
+			path TEXT NOT NULL,
+			fs_type TEXT NOT NULL DEFAULT '',
+			started_at TEXT NOT NULL,
+			bytes INTEGER NOT NULL,
+			write_seconds REAL NOT NULL,
+			read_seconds REAL NOT NULL,
+			write_mbps REAL NOT NULL,
+			read_mbps REAL NOT NULL,
+			state TEXT NOT NULL,
+			message TEXT NOT NULL,
+			requested_by TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS backup_manifest (
+			target TEXT NOT NULL,
+			path TEXT NOT NULL,
+			sha256 TEXT NOT NULL DEFAULT '',
+			size INTEGER NOT NULL,
+			mod_time_ns INTEGER NOT NULL,
+			backed_up_at TEXT NOT NULL,
+			PRIMARY KEY (target, path)
+		);`,
+		`CREATE TABLE IF NOT EXISTS publish_targets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			album_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			destination TEXT NOT NULL,
+			username TEXT NOT NULL DEFAULT '',
+			secret TEXT NOT NULL DEFAULT '',
+			preset TEXT NOT NULL DEFAULT '',
+			strip_gps INTEGER NOT NULL DEFAULT 0,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			fingerprint TEXT NOT NULL DEFAULT '',
+			manifest_json TEXT NOT NULL DEFAULT '{}',
+			published_at TEXT NOT NULL DEFAULT '',
+			last_error TEXT NOT NULL DEFAULT '',
+			created_by TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			FOREIGN KEY (album_id) REFERENCES albums(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL DEFAULT '',
+			last_used_at TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS recovery_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			code_hash TEXT NOT NULL UNIQUE,
+			created_at TEXT NOT NULL,
+			used_at TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id);`,
+		`CREATE TABLE IF NOT EXISTS media_purges (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			media_id INTEGER NOT NULL,
+			file_name TEXT NOT NULL,
+			sha256 TEXT NOT NULL,
+			size_bytes INTEGER NOT NULL,
+			record_json TEXT NOT NULL,
+			sidecars_json TEXT NOT NULL DEFAULT '[]',
+			requested_by TEXT NOT NULL,
+			requested_at TEXT NOT NULL,
+			purge_after TEXT NOT NULL,
+			last_error TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_media_purges_after ON media_purges(purge_after);`,
+		`CREATE TABLE IF NOT EXISTS media_trash (
+			media_id INTEGER PRIMARY KEY,
+			kind TEXT NOT NULL,
+			file_name TEXT NOT NULL,
+			sha256 TEXT NOT NULL,
+			size_bytes INTEGER NOT NULL,
+			record_json TEXT NOT NULL,
+			sidecars_json TEXT NOT NULL DEFAULT '[]',
+			albums_json TEXT NOT NULL DEFAULT '[]',
+			tags_json TEXT NOT NULL DEFAULT '[]',
+			extras_json TEXT NOT NULL DEFAULT '{}',
+			trash_dir TEXT NOT NULL DEFAULT '',
+			deleted_by TEXT NOT NULL,
+			deleted_at TEXT NOT NULL,
+			last_error TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_media_trash_deleted_at ON media_trash(deleted_at);`,
+		`CREATE TABLE IF NOT EXISTS integrity_issues (
+			media_id INTEGER PRIMARY KEY,
+			kind TEXT NOT NULL,
+			dest_path TEXT NOT NULL,
+			expected_sha256 TEXT NOT NULL,
+			actual_sha256 TEXT NOT NULL DEFAULT '',
+			detail TEXT NOT NULL DEFAULT '',
+			first_seen_at TEXT NOT NULL,
+			last_seen_at TEXT NOT NULL,
+			resolved_at TEXT,
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS legal_holds (
+			sha256 TEXT PRIMARY KEY,
+			reason TEXT NOT NULL DEFAULT '',
+			placed_by TEXT NOT NULL,
+			placed_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS login_failures (
+			key TEXT PRIMARY KEY,
+			failures INTEGER NOT NULL,
+			last_failure_at TEXT NOT NULL,
+			locked_until TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE TABLE IF NOT EXISTS timelapses (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			first_media_id INTEGER NOT NULL UNIQUE,
+			frame_count INTEGER NOT NULL,
+			start_time TEXT NOT NULL,
+			end_time TEXT NOT NULL,
+			interval_sec REAL NOT NULL,
+			status TEXT NOT NULL,
+			video_path TEXT NOT NULL DEFAULT '',
+			size_bytes INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			detected_at TEXT NOT NULL,
+			rendered_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE TABLE IF NOT EXISTS timelapse_frames (
+			timelapse_id INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			media_id INTEGER NOT NULL,
+			PRIMARY KEY (timelapse_id, position),
+			FOREIGN KEY (timelapse_id) REFERENCES timelapses(id) ON DELETE CASCADE,
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_timelapse_frames_media ON timelapse_frames(media_id);`,
+		`CREATE TABLE IF NOT EXISTS media_sidecars (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			media_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			file_name TEXT NOT NULL,
+			source_path TEXT NOT NULL,
+			dest_path TEXT NOT NULL,
+			size_bytes INTEGER NOT NULL,
+			sha256 TEXT NOT NULL,
+			UNIQUE (media_id, kind),
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS map_bookmarks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			lat REAL NOT NULL,
+			lon REAL NOT NULL,
+			zoom INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			UNIQUE (user_id, name),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS gpx_tracks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			start_time TEXT NOT NULL,
+			end_time TEXT NOT NULL,
+			point_count INTEGER NOT NULL,
+			offset_sec INTEGER NOT NULL DEFAULT 0,
+			max_gap_sec INTEGER NOT NULL,
+			imported_by TEXT NOT NULL,
+			imported_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS gpx_points (
+			track_id INTEGER NOT NULL,
+			time_ms INTEGER NOT NULL,
+			lat REAL NOT NULL,
+			lon REAL NOT NULL,
+			ele REAL,
+			FOREIGN KEY (track_id) REFERENCES gpx_tracks(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_gpx_points_track ON gpx_points(track_id, time_ms);`,
+		`CREATE TABLE IF NOT EXISTS media_gpx_matches (
+			media_id INTEGER PRIMARY KEY,
+			track_id INTEGER NOT NULL,
+			matched_at TEXT NOT NULL,
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE,
+			FOREIGN KEY (track_id) REFERENCES gpx_tracks(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_media_gpx_matches_track ON media_gpx_matches(track_id);`,
+		`CREATE TABLE IF NOT EXISTS cloud_sync_files (
+			media_id INTEGER NOT NULL,
+			target TEXT NOT NULL,
+			remote_name TEXT NOT NULL,
+			sha256 TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			updated_at TEXT NOT NULL,
+			PRIMARY KEY (media_id, target),
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS named_places (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			lat REAL NOT NULL,
+			lon REAL NOT NULL,
+			radius_m REAL NOT NULL DEFAULT 0,
+			polygon TEXT NOT NULL DEFAULT '',
+			min_lat REAL NOT NULL,
+			max_lat REAL NOT NULL,
+			min_lon REAL NOT NULL,
+			max_lon REAL NOT NULL,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS media_places (
+			media_id INTEGER NOT NULL,
+			place_id INTEGER NOT NULL,
+			PRIMARY KEY (media_id, place_id),
+			FOREIGN KEY (media_id) REFERENCES media_files(id) ON DELETE CASCADE,
+			FOREIGN KEY (place_id) REFERENCES named_places(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_media_places_place ON media_places(place_id);`,
 	}
 
 	for _, stmt := range schema {
@@ -299,6 +870,67 @@ func (s *Store) migrate(ctx context.Context) error {
 		return err
 	}
 
+	if err := s.ensureColumns(ctx, "users", []columnDef{
+		{"role", "TEXT NOT NULL DEFAULT 'admin'"},
+		{"expires_at", "TEXT"},
+		{"scope_album_id", "INTEGER"},
+		{"created_by", "TEXT"},
+		{"watermark", "TEXT"},
+		{"auto_revoke", "INTEGER NOT NULL DEFAULT 0"},
+		{"strip_gps", "INTEGER NOT NULL DEFAULT 0"},
+	}); err != nil {
+		return err
+	}
+	if err := s.ensureColumns(ctx, "albums", []columnDef{
+		{"version", "INTEGER NOT NULL DEFAULT 1"},
+	}); err != nil {
+		return err
+	}
+	if err := s.ensureColumns(ctx, "sessions", []columnDef{
+		{"field", "INTEGER NOT NULL DEFAULT 0"},
+		{"device", "TEXT NOT NULL DEFAULT ''"},
+	}); err != nil {
+		return err
+	}
+	if err := s.ensureColumns(ctx, "media_trash", []columnDef{
+		{"extras_json", "TEXT NOT NULL DEFAULT '{}'"},
+	}); err != nil {
+		return err
+	}
+
+	// For DBs created while duplicates were keyed on (crc32, size_bytes, capture_time).
+	if err := s.dropLegacyMediaUnique(ctx); err != nil {
+		return err
+	}
+
+	if err := s.backfillSourceLayout(ctx); err != nil {
+		return err
+	}
+
+	// After any media_files rebuild, which would drop its triggers.
+	if err := s.ensureChangeTriggers(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureSearchIndex(ctx); err != nil {
+		return err
+	}
+
+	if err := s.ensureDestPathFoldIndex(ctx); err != nil {
+		return err
+	}
+
+	if _, err := s.DB.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_media_capture_time ON media_files(capture_time);`); err != nil {
+		return err
+	}
+	if _, err := s.DB.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_media_gps ON media_files(gps_lat, gps_lon);`); err != nil {
+		return err
+	}
+	if _, err := s.DB.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_media_sha256 ON media_files(sha256);`); err != nil {
+		return err
+	}
+	if _, err := s.DB.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_media_same_content ON media_files(same_content_id);`); err != nil {
+		return err
+	}
 	if _, err := s.DB.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_media_loc_state ON media_files(loc_state);`); err != nil {
 		return err
 	}
@@ -312,32 +944,43 @@ func (s *Store) migrate(ctx context.Context) error {
 	return nil
 }
 
-func (s *Store) ensureMediaLocationColumns(ctx context.Context) error {
-	existing := map[string]struct{}{}
-	rows, err := s.DB.QueryContext(ctx, `PRAGMA table_info(media_files)`)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var cid int
-		var name, ctype string
-		var notnull int
-		var dflt sql.NullString
-		var pk int
-		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
-			return err
+// ensureDestPathFoldIndex makes library paths unique ignoring case, since
+// paths differing only in case collide on APFS, exFAT and NTFS. A library
+// built on a case-sensitive volume may already hold such pairs; it keeps
+// working with a plain index until no such pairs remain.
+func (s *Store) ensureDestPathFoldIndex(ctx context.Context) error {
+	var conflict int
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT 1 FROM media_files
+		GROUP BY dest_path COLLATE NOCASE
+		HAVING COUNT(*) > 1
+		LIMIT 1
+	`).Scan(&conflict)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = s.DB.ExecContext(ctx, `DROP INDEX IF EXISTS idx_media_dest_path_fold;`)
+		if err == nil {
+			_, err = s.DB.ExecContext(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS idx_media_dest_path_nocase ON media_files(dest_path COLLATE NOCASE);`)
 		}
-		existing[name] = struct{}{}
+	case err == nil:
+		_, err = s.DB.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_media_dest_path_fold ON media_files(dest_path COLLATE NOCASE);`)
 	}
-	if err := rows.Err(); err != nil {
-		return err
+	return err
+}
+
+// DestPathTaken reports whether a media record already uses path, ignoring
+// case.
+func (s *Store) DestPathTaken(ctx context.Context, path string) (bool, error) {
+	var one int
+	err := s.DB.QueryRowContext(ctx, `SELECT 1 FROM media_files WHERE dest_path = ? COLLATE NOCASE LIMIT 1`, path).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
 	}
+	return err == nil, err
+}
 
-	cols := []struct {
-		name    string
-		typeDef string
-	}{
+func (s *Store) ensureMediaLocationColumns(ctx context.Context) error {
+	return s.ensureColumns(ctx, "media_files", []columnDef{
 		{"loc_provider", "TEXT"},
 		{"loc_country", "TEXT"},
 		{"loc_state", "TEXT"},
@@ -347,13 +990,42 @@ func (s *Store) ensureMediaLocationColumns(ctx context.Context) error {
 		{"loc_house_number", "TEXT"},
 		{"loc_postcode", "TEXT"},
 		{"loc_display_name", "TEXT"},
+		{"same_content_id", "INTEGER REFERENCES media_files(id) ON DELETE SET NULL"},
+		{"clock_uncertain", "INTEGER NOT NULL DEFAULT 0"},
+		{"duration_sec", "REAL"},
+		{"poster_status", "TEXT NOT NULL DEFAULT ''"},
+		{"video_codec", "TEXT"},
+		{"width", "INTEGER"},
+		{"height", "INTEGER"},
+		{"source_card", "TEXT NOT NULL DEFAULT ''"},
+		{"source_rel_path", "TEXT NOT NULL DEFAULT ''"},
+		{"stored_bytes", "INTEGER"},
+		{"rating", "INTEGER NOT NULL DEFAULT 0"},
+		{"favorite", "INTEGER NOT NULL DEFAULT 0"},
+	})
+}
+
+type columnDef struct {
+	name    string
+	typeDef string
+}
+
+// ensureColumns adds any missing columns to an existing table.
+func (s *Store) ensureColumns(ctx context.Context, table string, cols []columnDef) error {
+	names, err := s.tableColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		existing[name] = struct{}{}
 	}
 
 	for _, col := range cols {
 		if _, ok := existing[col.name]; ok {
 			continue
 		}
-		stmt := fmt.Sprintf("ALTER TABLE media_files ADD COLUMN %s %s", col.name, col.typeDef)
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col.name, col.typeDef)
 		if _, err := s.DB.ExecContext(ctx, stmt); err != nil {
 			return err
 		}
@@ -361,8 +1033,94 @@ func (s *Store) ensureMediaLocationColumns(ctx context.Context) error {
 	return nil
 }
 
+// dropLegacyMediaUnique rebuilds media_files without the old
+// UNIQUE (crc32, size_bytes, capture_time) constraint. Content identity is
+// keyed on sha256 now, and rows that previously slipped past the legacy key
+// (same bytes, different capture_time fallback) are kept and linked to the
+// earliest record holding the same content via same_content_id.
+func (s *Store) dropLegacyMediaUnique(ctx context.Context) error {
+	var tableSQL string
+	row := s.DB.QueryRowContext(ctx, `SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'media_files'`)
+	if err := row.Scan(&tableSQL); err != nil {
+		return err
+	}
+	normalized := strings.Join(strings.Fields(strings.ToLower(tableSQL)), " ")
+	if !strings.Contains(normalized, "unique (crc32, size_bytes, capture_time)") {
+		return nil
+	}
+
+	cols, err := s.tableColumns(ctx, "media_files")
+	if err != nil {
+		return err
+	}
+	colList := strings.Join(cols, ", ")
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Foreign key enforcement must be off while the parent table is swapped,
+	// otherwise dropping media_files would cascade into album_items.
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF;`); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), `PRAGMA foreign_keys = ON;`)
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	stmts := []string{
+		`DROP TABLE IF EXISTS media_files_rebuild;`,
+		fmt.Sprintf(mediaFilesTableDDL, "media_files_rebuild"),
+		fmt.Sprintf(`INSERT INTO media_files_rebuild (%s) SELECT %s FROM media_files;`, colList, colList),
+		`DROP TABLE media_files;`,
+		`ALTER TABLE media_files_rebuild RENAME TO media_files;`,
+		`UPDATE media_files SET same_content_id = (
+			SELECT MIN(m2.id) FROM media_files m2
+			WHERE m2.sha256 = media_files.sha256 AND m2.id < media_files.id
+		) WHERE same_content_id IS NULL;`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("rebuild media_files: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) tableColumns(ctx context.Context, table string) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]string, 0, 32)
+	for rows.Next() {
+		var cid int
+		var name, ctype string
+		var notnull int
+		var dflt sql.NullString
+		var pk int
+		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
+
 func (s *Store) GetSetting(ctx context.Context, key string) (string, bool, error) {
-	row := s.DB.QueryRowContext(ctx, `SELECT value FROM settings WHERE key = ?`, key)
+	row := s.reader().QueryRowContext(ctx, `SELECT value FROM settings WHERE key = ?`, key)
 	var value string
 	if err := row.Scan(&value); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -370,7 +1128,7 @@ func (s *Store) GetSetting(ctx context.Context, key string) (string, bool, error
 		}
 		return "", false, err
 	}
-	return value, true, nil
+	return s.rebase(value), true, nil
 }
 
 func (s *Store) SetSetting(ctx context.Context, key, value string) error {
@@ -384,7 +1142,7 @@ func (s *Store) SetSetting(ctx context.Context, key, value string) error {
 }
 
 func (s *Store) HasUsers(ctx context.Context) (bool, error) {
-	row := s.DB.QueryRowContext(ctx, `SELECT COUNT(1) FROM users`)
+	row := s.reader().QueryRowContext(ctx, `SELECT COUNT(1) FROM users`)
 	var count int
 	if err := row.Scan(&count); err != nil {
 		return false, err
@@ -406,19 +1164,125 @@ func (s *Store) CreateUser(ctx context.Context, username string, hash, salt []by
 
 func (s *Store) GetUserByUsername(ctx context.Context, username string) (*User, error) {
 	row := s.DB.QueryRowContext(ctx,
-		`SELECT id, username, password_hash, salt FROM users WHERE username = ?`,
+		`SELECT id, username, password_hash, salt, role, expires_at, scope_album_id FROM users WHERE username = ?`,
 		username,
 	)
-	var user User
-	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Salt); err != nil {
+	var (
+		user      User
+		expiresAt sql.NullString
+		scope     sql.NullInt64
+	)
+	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Salt, &user.Role, &expiresAt, &scope); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
+	if expiresAt.Valid {
+		if parsed, err := time.Parse(time.RFC3339, expiresAt.String); err == nil {
+			user.ExpiresAt = parsed
+		}
+	}
+	user.ScopeAlbumID = scope.Int64
 	return &user, nil
 }
 
+// CreateGuestUser adds a time-limited, view-only account. albumID of 0 leaves
+// the guest unscoped.
+func (s *Store) CreateGuestUser(ctx context.Context, username string, hash, salt []byte, expiresAt time.Time, albumID int64, createdBy string) (int64, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	var scope any
+	if albumID > 0 {
+		scope = albumID
+	}
+	res, err := s.DB.ExecContext(ctx,
+		`INSERT INTO users (username, password_hash, salt, created_at, role, expires_at, scope_album_id, created_by)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		username, hash, salt, now, RoleGuest, expiresAt.UTC().Format(time.RFC3339), scope, createdBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// SetGuestWatermark stores the watermark applied to images a guest views.
+// An empty spec removes it.
+func (s *Store) SetGuestWatermark(ctx context.Context, id int64, spec string) error {
+	var value any
+	if spec != "" {
+		value = spec
+	}
+	_, err := s.DB.ExecContext(ctx, `UPDATE users SET watermark = ? WHERE id = ? AND role = ?`, value, id, RoleGuest)
+	return err
+}
+
+func (s *Store) ListGuestUsers(ctx context.Context) ([]GuestUser, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT u.id, u.username, COALESCE(u.expires_at, ''), COALESCE(u.scope_album_id, 0),
+		       COALESCE(u.created_by, ''), u.created_at,
+		       (SELECT COUNT(1) FROM sessions s WHERE s.user_id = u.id AND s.expires_at > ?),
+		       (SELECT COUNT(1) FROM guest_access g WHERE g.guest_id = u.id),
+		       COALESCE((SELECT MAX(g.accessed_at) FROM guest_access g WHERE g.guest_id = u.id), ''),
+		       u.auto_revoke, u.strip_gps, COALESCE(u.watermark, '')
+		FROM users u
+		WHERE u.role = ?
+		ORDER BY u.expires_at ASC, u.id ASC
+	`, now, RoleGuest)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]GuestUser, 0)
+	for rows.Next() {
+		var (
+			g         GuestUser
+			watermark string
+		)
+		if err := rows.Scan(&g.ID, &g.Username, &g.ExpiresAt, &g.ScopeAlbumID, &g.CreatedBy, &g.CreatedAt, &g.ActiveTokens, &g.Requests, &g.LastAccessAt, &g.AutoRevoke, &g.StripGPS, &watermark); err != nil {
+			return nil, err
+		}
+		if watermark != "" {
+			g.Watermark = json.RawMessage(watermark)
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// DeleteGuestUser removes a guest account and, via cascade, its sessions.
+func (s *Store) DeleteGuestUser(ctx context.Context, id int64) (bool, error) {
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ? AND user_id IN (SELECT id FROM users WHERE role = ?)`, id, RoleGuest); err != nil {
+		return false, err
+	}
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM users WHERE id = ? AND role = ?`, id, RoleGuest)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *Store) DeleteExpiredGuests(ctx context.Context) (int64, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := s.DB.ExecContext(ctx, `
+		DELETE FROM sessions WHERE user_id IN (
+			SELECT id FROM users WHERE role = ? AND expires_at IS NOT NULL AND expires_at <= ?
+		)`, RoleGuest, now); err != nil {
+		return 0, err
+	}
+	res, err := s.DB.ExecContext(ctx,
+		`DELETE FROM users WHERE role = ? AND expires_at IS NOT NULL AND expires_at <= ?`,
+		RoleGuest, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (s *Store) CreateSession(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error {
 	now := time.Now().UTC().Format(time.RFC3339)
 	_, err := s.DB.ExecContext(ctx,
@@ -428,6 +1292,78 @@ func (s *Store) CreateSession(ctx context.Context, tokenHash string, userID int6
 	return err
 }
 
+// CreateFieldSession creates a session unlocked by the field-mode PIN. It
+// acts for userID but is limited to the field-mode routes.
+func (s *Store) CreateFieldSession(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := s.DB.ExecContext(ctx,
+		`INSERT INTO sessions (token_hash, user_id, expires_at, created_at, field) VALUES (?, ?, ?, ?, 1)`,
+		tokenHash, userID, expiresAt.UTC().Format(time.RFC3339), now,
+	)
+	return err
+}
+
+// DeleteFieldSessions ends every field-mode session. Paired devices keep
+// theirs.
+func (s *Store) DeleteFieldSessions(ctx context.Context) (int64, error) {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM sessions WHERE field = 1 AND device = ''`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CreateDeviceSession creates the session of a paired device. A field
+// device is limited to the field-mode routes.
+func (s *Store) CreateDeviceSession(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time, device string, field bool) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := s.DB.ExecContext(ctx,
+		`INSERT INTO sessions (token_hash, user_id, expires_at, created_at, field, device) VALUES (?, ?, ?, ?, ?, ?)`,
+		tokenHash, userID, expiresAt.UTC().Format(time.RFC3339), now, field, device,
+	)
+	return err
+}
+
+// ListDeviceSessions returns the paired devices that have not expired.
+func (s *Store) ListDeviceSessions(ctx context.Context) ([]DeviceSession, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT substr(s.token_hash, 1, 16), s.device, u.username, s.field, s.created_at, s.expires_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.device <> '' AND s.expires_at > ?
+		ORDER BY s.created_at DESC`, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]DeviceSession, 0)
+	for rows.Next() {
+		var d DeviceSession
+		if err := rows.Scan(&d.ID, &d.Device, &d.Username, &d.Field, &d.CreatedAt, &d.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// DeleteDeviceSession revokes a paired device and returns its name, or ""
+// when there is no such device.
+func (s *Store) DeleteDeviceSession(ctx context.Context, id string) (string, error) {
+	if len(id) != 16 {
+		return "", nil
+	}
+	var device string
+	err := s.DB.QueryRowContext(ctx, `SELECT device FROM sessions WHERE substr(token_hash, 1, 16) = ? AND device <> ''`, id).Scan(&device)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = s.DB.ExecContext(ctx, `DELETE FROM sessions WHERE substr(token_hash, 1, 16) = ? AND device <> ''`, id)
+	return device, err
+}
+
 func (s *Store) DeleteSession(ctx context.Context, tokenHash string) error {
 	_, err := s.DB.ExecContext(ctx, `DELETE FROM sessions WHERE token_hash = ?`, tokenHash)
 	return err
@@ -440,17 +1376,19 @@ func (s *Store) DeleteExpiredSessions(ctx context.Context) error {
 }
 
 func (s *Store) LookupSession(ctx context.Context, tokenHash string) (*Session, error) {
-	row := s.DB.QueryRowContext(ctx,
-		`SELECT s.user_id, u.username, s.expires_at
+	row := s.reader().QueryRowContext(ctx,
+		`SELECT s.user_id, u.username, s.expires_at, u.role, u.expires_at, u.scope_album_id, COALESCE(u.watermark, ''), u.strip_gps, s.field, s.device
 		 FROM sessions s JOIN users u ON u.id = s.user_id
 		 WHERE s.token_hash = ?`,
 		tokenHash,
 	)
 	var (
-		session   Session
-		expiresAt string
+		session       Session
+		expiresAt     string
+		userExpiresAt sql.NullString
+		scope         sql.NullInt64
 	)
-	if err := row.Scan(&session.UserID, &session.Username, &expiresAt); err != nil {
+	if err := row.Scan(&session.UserID, &session.Username, &expiresAt, &session.Role, &userExpiresAt, &scope, &session.Watermark, &session.StripGPS, &session.Field, &session.Device); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -461,18 +1399,28 @@ func (s *Store) LookupSession(ctx context.Context, tokenHash string) (*Session,
 		return nil, err
 	}
 	session.ExpiresAt = parsed
-	if time.Now().UTC().After(parsed) {
-		_ = s.DeleteSession(ctx, tokenHash)
+	session.ScopeAlbumID = scope.Int64
+	now := time.Now().UTC()
+	if now.After(parsed) {
+		s.touch(ctx, `DELETE FROM sessions WHERE token_hash = ?`, tokenHash)
 		return nil, nil
 	}
+	if userExpiresAt.Valid {
+		if accountExpiry, err := time.Parse(time.RFC3339, userExpiresAt.String); err == nil && !now.Before(accountExpiry) {
+			s.touch(ctx, `DELETE FROM sessions WHERE token_hash = ?`, tokenHash)
+			return nil, nil
+		}
+	}
 	return &session, nil
 }
 
-func (s *Store) MediaExists(ctx context.Context, crc32 string, size int64, captureTime string) (bool, error) {
-	row := s.DB.QueryRowContext(ctx,
-		`SELECT 1 FROM media_files WHERE crc32 = ? AND size_bytes = ? AND capture_time = ? LIMIT 1`,
-		crc32, size, captureTime,
-	)
+func (s *Store) MediaInAlbum(ctx context.Context, albumID, mediaID int64) (bool, error) {
+	filter := MediaFilter{AlbumID: albumID}
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return false, err
+	}
+	where, args := buildLocationWhere(filter)
+	row := s.DB.QueryRowContext(ctx, `SELECT 1 FROM media_files WHERE id = ? AND `+where+` LIMIT 1`, append([]any{mediaID}, args...)...)
 	var marker int
 	if err := row.Scan(&marker); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -483,18 +1431,114 @@ func (s *Store) MediaExists(ctx context.Context, crc32 string, size int64, captu
 	return true, nil
 }
 
+// FindMediaBySHA256 returns the id of the earliest record holding the given
+// content hash, or 0 when the content has not been ingested yet.
+func (s *Store) FindMediaBySHA256(ctx context.Context, sha256 string) (int64, error) {
+	row := s.DB.QueryRowContext(ctx,
+		`SELECT id FROM media_files WHERE sha256 = ? ORDER BY id ASC LIMIT 1`,
+		strings.ToLower(strings.TrimSpace(sha256)),
+	)
+	var id int64
+	if err := row.Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// MediaChecksums calls fn with the content hash and library path of every
+// media item, in id order.
+func (s *Store) MediaChecksums(ctx context.Context, fn func(sha256, destPath string) error) error {
+	rows, err := s.DB.QueryContext(ctx, `SELECT sha256, dest_path FROM media_files ORDER BY id ASC`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sum, dest string
+		if err := rows.Scan(&sum, &dest); err != nil {
+			return err
+		}
+		if err := fn(sum, dest); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 func (s *Store) InsertMedia(ctx context.Context, rec *MediaRecord) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return insertMedia(ctx, s.DB, rec)
+}
 
-	_, err := s.DB.ExecContext(ctx,
+// InsertMediaBatch inserts recs in one transaction. A record that breaks a
+// uniqueness constraint, such as content already in the library, is left
+// out with its error in rejected, and the rest still go in. Any other
+// failure rolls the whole batch back: err is set and no record has an ID.
+func (s *Store) InsertMediaBatch(ctx context.Context, recs []*MediaRecord) (rejected []error, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rejected = make([]error, len(recs))
+	defer func() {
+		if err != nil {
+			for _, rec := range recs {
+				rec.ID = 0
+			}
+		}
+	}()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return rejected, err
+	}
+	defer tx.Rollback()
+
+	for i, rec := range recs {
+		if insertErr := insertMedia(ctx, tx, rec); insertErr != nil {
+			// SQLite undoes only the failed statement on a constraint
+			// error; the transaction carries on.
+			if !IsUniqueViolation(insertErr) {
+				return rejected, insertErr
+			}
+			rejected[i] = insertErr
+		}
+	}
+	return rejected, tx.Commit()
+}
+
+// IsUniqueViolation reports whether err is SQLite refusing a duplicate
+// value in a unique column.
+func IsUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "unique")
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertMedia adds rec and sets its ID. A record that already has an ID
+// keeps it, as one coming back from the trash does.
+func insertMedia(ctx context.Context, db execer, rec *MediaRecord) error {
+	if err := fault.Check(fault.DBWrite); err != nil {
+		return err
+	}
+	if rec.SourceRelPath == "" {
+		rec.SourceCard, rec.SourceRelPath = SourceLayout(rec.SourceMount, rec.SourcePath)
+	}
+	res, err := db.ExecContext(ctx,
 		`INSERT INTO media_files (
-				kind, file_name, extension, source_mount, source_path, dest_path,
+				id, kind, file_name, extension, source_mount, source_path, dest_path,
 				size_bytes, crc32, sha256, capture_time, gps_lat, gps_lon, make, model,
 				camera_yaw, camera_pitch, camera_roll,
 				loc_provider, loc_country, loc_state, loc_county, loc_city, loc_road, loc_house_number, loc_postcode, loc_display_name,
-				metadata_json, source_mtime, ingested_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				metadata_json, source_mtime, ingested_at, same_content_id, clock_uncertain,
+				duration_sec, video_codec, width, height, source_card, source_rel_path, stored_bytes
+		) VALUES (NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+			(SELECT MIN(id) FROM media_files WHERE sha256 = ?), ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.ID,
 		rec.Kind,
 		rec.FileName,
 		rec.Extension,
@@ -524,8 +1568,23 @@ func (s *Store) InsertMedia(ctx context.Context, rec *MediaRecord) error {
 		rec.Metadata,
 		rec.SourceMTime,
 		rec.IngestedAt,
+		rec.SHA256,
+		rec.ClockUncertain,
+		nullFloatToAny(rec.DurationSec),
+		nullStringToAny(rec.VideoCodec),
+		nullIntToAny(rec.Width),
+		nullIntToAny(rec.Height),
+		rec.SourceCard,
+		rec.SourceRelPath,
+		nullIntToAny(rec.StoredBytes),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if id, err := res.LastInsertId(); err == nil {
+		rec.ID = id
+	}
+	return nil
 }
 
 func (s *Store) ListMedia(ctx context.Context, sortBy, order string, limit, offset int) ([]MediaRecord, error) {
@@ -533,7 +1592,32 @@ func (s *Store) ListMedia(ctx context.Context, sortBy, order string, limit, offs
 }
 
 func (s *Store) ListMediaFiltered(ctx context.Context, sortBy, order string, limit, offset int, filter MediaFilter) ([]MediaRecord, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
+	query, args := mediaListQuery(sortBy, order, limit, offset, filter)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]MediaRecord, 0)
+	for rows.Next() {
+		var rec MediaRecord
+		if err := s.scanMediaRecord(rows, &rec); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+
+	return out, rows.Err()
+}
+
+// mediaListQuery builds the query behind ListMediaFiltered.
+func mediaListQuery(sortBy, order string, limit, offset int, filter MediaFilter) (string, []any) {
 	safeSort := "capture_time"
+	tieBreak := ""
 	sortArgs := make([]any, 0, 4)
 	switch sortBy {
 	case "capture_time":
@@ -570,6 +1654,11 @@ func (s *Store) ListMediaFiltered(ctx context.Context, sortBy, order string, lim
 		safeSort = "loc_road"
 	case "extension":
 		safeSort = "extension"
+	case "rating":
+		// Most media share a few ratings; newest first within each keeps
+		// pages stable.
+		safeSort = "rating"
+		tieBreak = ", capture_time DESC, id DESC"
 	case "distance":
 		if filter.HasNear {
 			// Use squared distance in lat/lon space for fast regional proximity sorting.
@@ -590,78 +1679,51 @@ func (s *Store) ListMediaFiltered(ctx context.Context, sortBy, order string, lim
 
 	where, args := buildLocationWhere(filter)
 
+	// Searches are ranked best match first unless another order is asked
+	// for; items matched only by their OCR text follow.
+	match := matchQuery(strings.ToLower(strings.TrimSpace(filter.Query)))
+	if match != "" && (sortBy == "" || sortBy == "relevance") {
+		query := fmt.Sprintf(`
+			SELECT %s
+			FROM media_files
+			LEFT JOIN (SELECT rowid AS search_id, %s AS search_rank FROM media_search WHERE media_search MATCH ?) AS hits
+				ON hits.search_id = media_files.id
+			WHERE %s
+			ORDER BY hits.search_rank IS NULL, hits.search_rank, capture_time DESC
+			LIMIT ? OFFSET ?
+		`, mediaSelectColumns, searchRank, where)
+		args = append([]any{match}, args...)
+		args = append(args, limit, offset)
+		return query, args
+	}
+
 	query := fmt.Sprintf(`
-		SELECT id, kind, file_name, extension, source_mount, source_path, dest_path, size_bytes, crc32, sha256,
-		       capture_time, gps_lat, gps_lon, make, model, camera_yaw, camera_pitch, camera_roll,
-		       loc_provider, loc_country, loc_state, loc_county, loc_city, loc_road, loc_house_number, loc_postcode, loc_display_name,
-		       metadata_json, source_mtime, ingested_at
+		SELECT %s
 		FROM media_files
 		WHERE %s
-		ORDER BY %s %s
+		ORDER BY %s %s%s
 		LIMIT ? OFFSET ?
-	`, where, safeSort, safeOrder)
+	`, mediaSelectColumns, where, safeSort, safeOrder, tieBreak)
 
 	args = append(args, sortArgs...)
 	args = append(args, limit, offset)
-	rows, err := s.DB.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	out := make([]MediaRecord, 0)
-	for rows.Next() {
-		var rec MediaRecord
-		if err := rows.Scan(
-			&rec.ID,
-			&rec.Kind,
-			&rec.FileName,
-			&rec.Extension,
-			&rec.SourceMount,
-			&rec.SourcePath,
-			&rec.DestPath,
-			&rec.SizeBytes,
-			&rec.CRC32,
-			&rec.SHA256,
-			&rec.CaptureTime,
-			&rec.GPSLat,
-			&rec.GPSLon,
-			&rec.Make,
-			&rec.Model,
-			&rec.CameraYaw,
-			&rec.CameraPitch,
-			&rec.CameraRoll,
-			&rec.LocProvider,
-			&rec.Country,
-			&rec.State,
-			&rec.County,
-			&rec.City,
-			&rec.Road,
-			&rec.HouseNumber,
-			&rec.Postcode,
-			&rec.DisplayName,
-			&rec.Metadata,
-			&rec.SourceMTime,
-			&rec.IngestedAt,
-		); err != nil {
-			return nil, err
-		}
-		out = append(out, rec)
-	}
-
-	return out, rows.Err()
+	return query, args
 }
 
-func (s *Store) GetMediaByID(ctx context.Context, id int64) (*MediaRecord, error) {
-	row := s.DB.QueryRowContext(ctx, `
-		SELECT id, kind, file_name, extension, source_mount, source_path, dest_path, size_bytes, crc32, sha256,
+const mediaSelectColumns = `id, kind, file_name, extension, source_mount, source_path, dest_path, size_bytes, crc32, sha256,
 		       capture_time, gps_lat, gps_lon, make, model, camera_yaw, camera_pitch, camera_roll,
 		       loc_provider, loc_country, loc_state, loc_county, loc_city, loc_road, loc_house_number, loc_postcode, loc_display_name,
-		       metadata_json, source_mtime, ingested_at
-		FROM media_files WHERE id = ?
-	`, id)
-	var rec MediaRecord
-	if err := row.Scan(
+		       metadata_json, source_mtime, ingested_at, same_content_id, clock_uncertain, duration_sec, poster_status,
+		       video_codec, width, height, source_card, source_rel_path, stored_bytes, rating, favorite`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanMediaRecord reads one media row. The stored path is rebased when the
+// store was opened with a relocated library; see Rebase.
+func (s *Store) scanMediaRecord(row rowScanner, rec *MediaRecord) error {
+	err := row.Scan(
 		&rec.ID,
 		&rec.Kind,
 		&rec.FileName,
@@ -692,7 +1754,32 @@ func (s *Store) GetMediaByID(ctx context.Context, id int64) (*MediaRecord, error
 		&rec.Metadata,
 		&rec.SourceMTime,
 		&rec.IngestedAt,
-	); err != nil {
+		&rec.SameContentID,
+		&rec.ClockUncertain,
+		&rec.DurationSec,
+		&rec.PosterStatus,
+		&rec.VideoCodec,
+		&rec.Width,
+		&rec.Height,
+		&rec.SourceCard,
+		&rec.SourceRelPath,
+		&rec.StoredBytes,
+		&rec.Rating,
+		&rec.Favorite,
+	)
+	if err == nil {
+		rec.DestPath = s.rebase(rec.DestPath)
+	}
+	return err
+}
+
+func (s *Store) GetMediaByID(ctx context.Context, id int64) (*MediaRecord, error) {
+	row := s.DB.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM media_files WHERE id = ?
+	`, mediaSelectColumns), id)
+	var rec MediaRecord
+	if err := s.scanMediaRecord(row, &rec); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -713,13 +1800,10 @@ func (s *Store) ListMediaByIDs(ctx context.Context, ids []int64) ([]MediaRecord,
 	}
 
 	query := fmt.Sprintf(`
-		SELECT id, kind, file_name, extension, source_mount, source_path, dest_path, size_bytes, crc32, sha256,
-		       capture_time, gps_lat, gps_lon, make, model, camera_yaw, camera_pitch, camera_roll,
-		       loc_provider, loc_country, loc_state, loc_county, loc_city, loc_road, loc_house_number, loc_postcode, loc_display_name,
-		       metadata_json, source_mtime, ingested_at
+		SELECT %s
 		FROM media_files
 		WHERE id IN (%s)
-	`, strings.Join(placeholders, ","))
+	`, mediaSelectColumns, strings.Join(placeholders, ","))
 
 	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -730,38 +1814,32 @@ func (s *Store) ListMediaByIDs(ctx context.Context, ids []int64) ([]MediaRecord,
 	out := make([]MediaRecord, 0, len(ids))
 	for rows.Next() {
 		var rec MediaRecord
-		if err := rows.Scan(
-			&rec.ID,
-			&rec.Kind,
-			&rec.FileName,
-			&rec.Extension,
-			&rec.SourceMount,
-			&rec.SourcePath,
-			&rec.DestPath,
-			&rec.SizeBytes,
-			&rec.CRC32,
-			&rec.SHA256,
-			&rec.CaptureTime,
-			&rec.GPSLat,
-			&rec.GPSLon,
-			&rec.Make,
-			&rec.Model,
-			&rec.CameraYaw,
-			&rec.CameraPitch,
-			&rec.CameraRoll,
-			&rec.LocProvider,
-			&rec.Country,
-			&rec.State,
-			&rec.County,
-			&rec.City,
-			&rec.Road,
-			&rec.HouseNumber,
-			&rec.Postcode,
-			&rec.DisplayName,
-			&rec.Metadata,
-			&rec.SourceMTime,
-			&rec.IngestedAt,
-		); err != nil {
+		if err := s.scanMediaRecord(rows, &rec); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// ListSameContent returns every record sharing content with id: the
+// canonical record plus any capture-time variants linked to it.
+func (s *Store) ListSameContent(ctx context.Context, id int64) ([]MediaRecord, error) {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM media_files
+		WHERE sha256 = (SELECT sha256 FROM media_files WHERE id = ?)
+		ORDER BY id ASC
+	`, mediaSelectColumns), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]MediaRecord, 0)
+	for rows.Next() {
+		var rec MediaRecord
+		if err := s.scanMediaRecord(rows, &rec); err != nil {
 			return nil, err
 		}
 		out = append(out, rec)
@@ -800,10 +1878,11 @@ func (s *Store) ListAlbums(ctx context.Context, limit int) ([]Album, error) {
 		limit = 500
 	}
 	rows, err := s.DB.QueryContext(ctx, `
-		SELECT a.id, a.name, a.created_at, a.updated_at, COUNT(ai.media_id) AS item_count
+		SELECT a.id, a.name, a.created_at, a.updated_at, COUNT(ai.media_id) AS item_count, a.version, sa.rules_json
 		FROM albums a
 		LEFT JOIN album_items ai ON ai.album_id = a.id
-		GROUP BY a.id, a.name, a.created_at, a.updated_at
+		LEFT JOIN smart_albums sa ON sa.album_id = a.id
+		GROUP BY a.id, a.name, a.created_at, a.updated_at, a.version, sa.rules_json
 		ORDER BY LOWER(a.name) ASC
 		LIMIT ?
 	`, limit)
@@ -813,33 +1892,102 @@ func (s *Store) ListAlbums(ctx context.Context, limit int) ([]Album, error) {
 	defer rows.Close()
 
 	out := make([]Album, 0)
+	rules := make([]sql.NullString, 0)
 	for rows.Next() {
 		var a Album
-		if err := rows.Scan(&a.ID, &a.Name, &a.CreatedAt, &a.UpdatedAt, &a.ItemCount); err != nil {
+		var r sql.NullString
+		if err := rows.Scan(&a.ID, &a.Name, &a.CreatedAt, &a.UpdatedAt, &a.ItemCount, &a.Version, &r); err != nil {
 			return nil, err
 		}
 		out = append(out, a)
+		rules = append(rules, r)
 	}
-	return out, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if err := s.fillSmartAlbums(ctx, out, rules); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
 func (s *Store) GetAlbumByID(ctx context.Context, id int64) (*Album, error) {
 	row := s.DB.QueryRowContext(ctx, `
-		SELECT a.id, a.name, a.created_at, a.updated_at, COUNT(ai.media_id) AS item_count
+		SELECT a.id, a.name, a.created_at, a.updated_at, COUNT(ai.media_id) AS item_count, a.version, sa.rules_json
 		FROM albums a
 		LEFT JOIN album_items ai ON ai.album_id = a.id
+		LEFT JOIN smart_albums sa ON sa.album_id = a.id
 		WHERE a.id = ?
-		GROUP BY a.id, a.name, a.created_at, a.updated_at
+		GROUP BY a.id, a.name, a.created_at, a.updated_at, a.version, sa.rules_json
 	`, id)
 
 	var a Album
-	if err := row.Scan(&a.ID, &a.Name, &a.CreatedAt, &a.UpdatedAt, &a.ItemCount); err != nil {
+	var rules sql.NullString
+	if err := row.Scan(&a.ID, &a.Name, &a.CreatedAt, &a.UpdatedAt, &a.ItemCount, &a.Version, &rules); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &a, nil
+	albums := []Album{a}
+	if err := s.fillSmartAlbums(ctx, albums, []sql.NullString{rules}); err != nil {
+		return nil, err
+	}
+	return &albums[0], nil
+}
+
+func (s *Store) GetAlbumByName(ctx context.Context, name string) (*Album, error) {
+	var id int64
+	row := s.DB.QueryRowContext(ctx, `SELECT id FROM albums WHERE name = ?`, strings.TrimSpace(name))
+	if err := row.Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return s.GetAlbumByID(ctx, id)
+}
+
+// EnsureAlbum returns the album with the given name, creating it if needed.
+func (s *Store) EnsureAlbum(ctx context.Context, name string) (*Album, error) {
+	album, err := s.GetAlbumByName(ctx, name)
+	if err != nil || album != nil {
+		return album, err
+	}
+	return s.CreateAlbum(ctx, name)
+}
+
+// RenameAlbum gives album id a new name and returns it, or nil if there is
+// no such album. A name another album has is a uniqueness error.
+func (s *Store) RenameAlbum(ctx context.Context, id int64, name string) (*Album, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("album name is required")
+	}
+	if len(name) > 120 {
+		return nil, errors.New("album name too long")
+	}
+	res, err := s.DB.ExecContext(ctx, `UPDATE albums SET name = ?, updated_at = ?, version = version + 1 WHERE id = ?`,
+		name, time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	return s.GetAlbumByID(ctx, id)
+}
+
+// DeleteAlbum removes album id and its publish targets. The media in it
+// stay in the library.
+func (s *Store) DeleteAlbum(ctx context.Context, id int64) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM albums WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
 }
 
 func (s *Store) AddMediaToAlbum(ctx context.Context, albumID int64, ids []int64) (added int, skipped int, err error) {
@@ -859,6 +2007,9 @@ func (s *Store) AddMediaToAlbum(ctx context.Context, albumID int64, ids []int64)
 			_ = tx.Rollback()
 		}
 	}()
+	if err = checkManualAlbum(ctx, tx, albumID); err != nil {
+		return 0, len(ids), err
+	}
 
 	now := time.Now().UTC().Format(time.RFC3339)
 	for _, id := range ids {
@@ -878,7 +2029,7 @@ func (s *Store) AddMediaToAlbum(ctx context.Context, albumID int64, ids []int64)
 			skipped++
 		}
 	}
-	if _, err = tx.ExecContext(ctx, `UPDATE albums SET updated_at = ? WHERE id = ?`, now, albumID); err != nil {
+	if _, err = tx.ExecContext(ctx, `UPDATE albums SET updated_at = ?, version = version + 1 WHERE id = ?`, now, albumID); err != nil {
 		return added, skipped, err
 	}
 	if err = tx.Commit(); err != nil {
@@ -904,6 +2055,9 @@ func (s *Store) RemoveMediaFromAlbum(ctx context.Context, albumID int64, ids []i
 			_ = tx.Rollback()
 		}
 	}()
+	if err = checkManualAlbum(ctx, tx, albumID); err != nil {
+		return 0, len(ids), err
+	}
 
 	now := time.Now().UTC().Format(time.RFC3339)
 	for _, id := range ids {
@@ -923,7 +2077,7 @@ func (s *Store) RemoveMediaFromAlbum(ctx context.Context, albumID int64, ids []i
 			skipped++
 		}
 	}
-	if _, err = tx.ExecContext(ctx, `UPDATE albums SET updated_at = ? WHERE id = ?`, now, albumID); err != nil {
+	if _, err = tx.ExecContext(ctx, `UPDATE albums SET updated_at = ?, version = version + 1 WHERE id = ?`, now, albumID); err != nil {
 		return removed, skipped, err
 	}
 	if err = tx.Commit(); err != nil {
@@ -937,13 +2091,17 @@ func (s *Store) ListAlbumMediaLinks(ctx context.Context, albumID int64) ([]Album
 		return nil, errors.New("invalid album_id")
 	}
 
+	filter := MediaFilter{AlbumID: albumID}
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
+	where, args := buildLocationWhere(filter)
 	rows, err := s.DB.QueryContext(ctx, `
-		SELECT m.id, m.file_name, m.dest_path
-		FROM album_items ai
-		INNER JOIN media_files m ON m.id = ai.media_id
-		WHERE ai.album_id = ?
-		ORDER BY LOWER(m.file_name) ASC, m.id ASC
-	`, albumID)
+		SELECT id, file_name, dest_path
+		FROM media_files
+		WHERE `+where+`
+		ORDER BY LOWER(file_name) ASC, id ASC
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -960,11 +2118,84 @@ func (s *Store) ListAlbumMediaLinks(ctx context.Context, albumID int64) ([]Album
 	return out, rows.Err()
 }
 
+// AddMediaTags attaches tags to a media record. Existing tags are kept, but
+// a tag the auto-tagger guessed is taken over by an explicit one.
+func (s *Store) AddMediaTags(ctx context.Context, mediaID int64, tags []string, source string) (int, error) {
+	if mediaID <= 0 {
+		return 0, errors.New("invalid media id")
+	}
+	if strings.TrimSpace(source) == "" {
+		source = "user"
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	added := 0
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		res, err := s.DB.ExecContext(ctx,
+			`INSERT INTO media_tags (media_id, tag, source, created_at) VALUES (?, ?, ?, ?)
+			 ON CONFLICT(media_id, tag) DO UPDATE SET source = excluded.source, created_at = excluded.created_at
+			 WHERE media_tags.source = ? AND excluded.source <> ?`,
+			mediaID, tag, source, now, TagSourceAuto, TagSourceAuto,
+		)
+		if err != nil {
+			return added, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (s *Store) ListMediaTags(ctx context.Context, mediaID int64) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT tag FROM media_tags WHERE media_id = ? ORDER BY tag ASC`, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]string, 0)
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		out = append(out, tag)
+	}
+	return out, rows.Err()
+}
+
 func (s *Store) ListMapPoints(ctx context.Context, limit int) ([]MapPoint, error) {
 	return s.ListMapPointsFiltered(ctx, limit, MediaFilter{})
 }
 
 func (s *Store) ListMapPointsFiltered(ctx context.Context, limit int, filter MediaFilter) ([]MapPoint, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
+	query, args := mapPointsQuery(limit, filter)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make([]MapPoint, 0)
+	for rows.Next() {
+		var p MapPoint
+		if err := rows.Scan(&p.ID, &p.Lat, &p.Lon, &p.CaptureTime, &p.FileName, &p.Kind); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// mapPointsQuery builds the query behind ListMapPointsFiltered.
+func mapPointsQuery(limit int, filter MediaFilter) (string, []any) {
 	if limit <= 0 {
 		limit = 10000
 	}
@@ -983,24 +2214,13 @@ func (s *Store) ListMapPointsFiltered(ctx context.Context, limit int, filter Med
 	`, where)
 
 	args = append(args, limit)
-	rows, err := s.DB.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	points := make([]MapPoint, 0)
-	for rows.Next() {
-		var p MapPoint
-		if err := rows.Scan(&p.ID, &p.Lat, &p.Lon, &p.CaptureTime, &p.FileName, &p.Kind); err != nil {
-			return nil, err
-		}
-		points = append(points, p)
-	}
-	return points, rows.Err()
+	return query, args
 }
 
 func (s *Store) ListLocationGroups(ctx context.Context, level string, filter MediaFilter, limit int) ([]LocationGroup, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
 	if limit <= 0 || limit > 500 {
 		limit = 200
 	}
@@ -1051,6 +2271,9 @@ func (s *Store) ListLocationGroups(ctx context.Context, level string, filter Med
 }
 
 func (s *Store) ListDeviceGroups(ctx context.Context, filter MediaFilter, limit int) ([]DeviceGroup, error) {
+	if err := s.resolveSmartAlbum(ctx, &filter); err != nil {
+		return nil, err
+	}
 	if limit <= 0 || limit > 500 {
 		limit = 200
 	}
@@ -1178,6 +2401,26 @@ func (s *Store) LastAuditHash(ctx context.Context) (string, error) {
 	return hash, nil
 }
 
+// LatestTimestamp is the newest audit or ingest timestamp on record, or the
+// zero time when there are none. It seeds the clock's high-water mark.
+func (s *Store) LatestTimestamp(ctx context.Context) (time.Time, error) {
+	var raw sql.NullString
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT MAX(ts) FROM (
+			SELECT MAX(ts) AS ts FROM audit_logs
+			UNION ALL
+			SELECT MAX(ingested_at) FROM media_files WHERE clock_uncertain = 0
+		)`).Scan(&raw)
+	if err != nil || !raw.Valid {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw.String)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	return t, nil
+}
+
 func (s *Store) ListAudit(ctx context.Context, limit int) ([]AuditRecord, error) {
 	if limit <= 0 || limit > 2000 {
 		limit = 200
@@ -1204,6 +2447,170 @@ func (s *Store) ListAudit(ctx context.Context, limit int) ([]AuditRecord, error)
 	return out, rows.Err()
 }
 
+// CountLoginsFromIP returns how many successful logins the user has and how
+// many of them came from ip, based on the audit trail.
+func (s *Store) CountLoginsFromIP(ctx context.Context, username, ip string) (total, fromIP int64, err error) {
+	err = s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(1), COALESCE(SUM(CASE WHEN json_extract(details_json, '$.ip') = ? THEN 1 ELSE 0 END), 0)
+		FROM audit_logs
+		WHERE action = 'login' AND actor = ?
+	`, ip, username).Scan(&total, &fromIP)
+	return total, fromIP, err
+}
+
+func (s *Store) InsertSecurityAlert(ctx context.Context, kind, message string, details map[string]any) (int64, error) {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.DB.ExecContext(ctx,
+		`INSERT INTO security_alerts (kind, message, details_json, created_at) VALUES (?, ?, ?, ?)`,
+		kind, message, string(detailsJSON), time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *Store) ListSecurityAlerts(ctx context.Context, includeAcknowledged bool, limit int) ([]SecurityAlert, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	query := `
+		SELECT id, kind, message, details_json, created_at, COALESCE(acknowledged_at, ''), COALESCE(acknowledged_by, '')
+		FROM security_alerts`
+	if !includeAcknowledged {
+		query += ` WHERE acknowledged_at IS NULL`
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	rows, err := s.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]SecurityAlert, 0)
+	for rows.Next() {
+		var a SecurityAlert
+		if err := rows.Scan(&a.ID, &a.Kind, &a.Message, &a.Details, &a.CreatedAt, &a.AcknowledgedAt, &a.AcknowledgedBy); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CountOpenSecurityAlerts(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.DB.QueryRowContext(ctx, `SELECT COUNT(1) FROM security_alerts WHERE acknowledged_at IS NULL`).Scan(&n)
+	return n, err
+}
+
+// AcknowledgeSecurityAlerts marks the given alerts (or all open ones when ids
+// is empty) as handled.
+func (s *Store) AcknowledgeSecurityAlerts(ctx context.Context, ids []int64, actor string) (int64, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	query := `UPDATE security_alerts SET acknowledged_at = ?, acknowledged_by = ? WHERE acknowledged_at IS NULL`
+	args := []any{now, actor}
+	if len(ids) > 0 {
+		query += ` AND id IN (` + strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",") + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	res, err := s.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SampleMediaForDrill picks up to limit random media stored under baseDir
+// that were ingested before the given RFC3339 time, i.e. that a backup
+// started then must contain.
+func (s *Store) SampleMediaForDrill(ctx context.Context, baseDir, before string, limit int) ([]MediaRecord, error) {
+	prefix := strings.TrimRight(baseDir, `/\`) + string(filepath.Separator)
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM media_files
+		WHERE ingested_at < ? AND substr(dest_path, 1, length(?)) = ?
+		ORDER BY RANDOM()
+		LIMIT ?
+	`, mediaSelectColumns), before, prefix, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]MediaRecord, 0, limit)
+	for rows.Next() {
+		var rec MediaRecord
+		if err := s.scanMediaRecord(rows, &rec); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) InsertRestoreDrill(ctx context.Context, d *RestoreDrill) error {
+	res, err := s.DB.ExecContext(ctx, `
+		INSERT INTO restore_drills (started_at, finished_at, mode, destination, backup_at, sampled, verified, missing, mismatched, state, message)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, d.StartedAt, d.FinishedAt, d.Mode, d.Destination, d.BackupAt, d.Sampled, d.Verified, d.Missing, d.Mismatched, d.State, d.Message)
+	if err != nil {
+		return err
+	}
+	d.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *Store) ListRestoreDrills(ctx context.Context, limit int) ([]RestoreDrill, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, started_at, finished_at, mode, destination, backup_at, sampled, verified, missing, mismatched, state, message
+		FROM restore_drills
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]RestoreDrill, 0)
+	for rows.Next() {
+		var d RestoreDrill
+		if err := rows.Scan(&d.ID, &d.StartedAt, &d.FinishedAt, &d.Mode, &d.Destination, &d.BackupAt, &d.Sampled, &d.Verified, &d.Missing, &d.Mismatched, &d.State, &d.Message); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// ReplicaLocalID maps an id from the replication source to the local row,
+// returning 0 when the row has not been replicated yet.
+func (s *Store) ReplicaLocalID(ctx context.Context, entity string, remoteID int64) (int64, error) {
+	var id int64
+	err := s.DB.QueryRowContext(ctx, `SELECT local_id FROM replica_map WHERE entity = ? AND remote_id = ?`, entity, remoteID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (s *Store) SetReplicaLocalID(ctx context.Context, entity string, remoteID, localID int64) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO replica_map (entity, remote_id, local_id) VALUES (?, ?, ?)
+		ON CONFLICT(entity, remote_id) DO UPDATE SET local_id = excluded.local_id
+	`, entity, remoteID, localID)
+	return err
+}
+
 func (s *Store) GetGeocodeCache(ctx context.Context, provider, geocodeKey string) (*GeocodeCacheEntry, bool, error) {
 	row := s.DB.QueryRowContext(ctx, `
 		SELECT provider, geocode_key, country, state, county, city, road, house_number, postcode, display_name, raw_json, updated_at
@@ -1296,6 +2703,13 @@ func nullStringToAny(v sql.NullString) any {
 	return nil
 }
 
+func nullIntToAny(v sql.NullInt64) any {
+	if v.Valid {
+		return v.Int64
+	}
+	return nil
+}
+
 func nullable(v string) any {
 	if strings.TrimSpace(v) == "" {
 		return nil
@@ -1332,11 +2746,13 @@ func buildLocationWhere(filter MediaFilter) (string, []any) {
 	}
 
 	q := strings.ToLower(strings.TrimSpace(filter.Query))
-	if q != "" {
-		q = escapeLikePattern(q)
-		like := "%" + q + "%"
-		clauses = append(clauses, `(LOWER(file_name) LIKE ? ESCAPE '\' OR LOWER(extension) LIKE ? ESCAPE '\' OR LOWER(COALESCE(make,'')) LIKE ? ESCAPE '\' OR LOWER(COALESCE(model,'')) LIKE ? ESCAPE '\' OR LOWER(COALESCE(loc_display_name,'')) LIKE ? ESCAPE '\')`)
-		args = append(args, like, like, like, like, like)
+	if match := matchQuery(q); match != "" {
+		clauses = append(clauses, `(id IN (SELECT rowid FROM media_search WHERE media_search MATCH ?) OR id IN (SELECT rowid FROM ocr_text WHERE ocr_text MATCH ?))`)
+		args = append(args, match, match)
+	} else if q != "" {
+		// Nothing but punctuation, which the index leaves out.
+		clauses = append(clauses, `LOWER(file_name) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLikePattern(q)+"%")
 	}
 
 	if strings.TrimSpace(filter.CaptureFrom) != "" {
@@ -1354,13 +2770,54 @@ func buildLocationWhere(filter MediaFilter) (string, []any) {
 	case "no":
 		clauses = append(clauses, "(gps_lat IS NULL OR gps_lon IS NULL)")
 	}
-	if filter.AlbumID > 0 {
+	if filter.ClockUncertain {
+		clauses = append(clauses, "clock_uncertain = 1")
+	}
+	if filter.Favorite {
+		clauses = append(clauses, "favorite = 1")
+	}
+	if filter.MinRating > 0 {
+		clauses = append(clauses, "rating >= ?")
+		args = append(args, filter.MinRating)
+	}
+	if filter.Missing {
+		clauses = append(clauses, "id IN (SELECT media_id FROM missing_media)")
+	}
+	if card := strings.TrimSpace(filter.SourceCard); card != "" {
+		clauses = append(clauses, "source_card = ?")
+		args = append(args, card)
+	}
+	if dir := strings.Trim(filter.SourceDir, "/"); dir != "" {
+		clauses = append(clauses, `source_rel_path LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLikePattern(dir)+"/%")
+	}
+	if filter.AlbumID > 0 && filter.smart != nil {
+		where, smartArgs := buildLocationWhere(*filter.smart)
+		clauses = append(clauses, "("+where+")")
+		args = append(args, smartArgs...)
+	} else if filter.AlbumID > 0 {
 		clauses = append(clauses, "id IN (SELECT media_id FROM album_items WHERE album_id = ?)")
 		args = append(args, filter.AlbumID)
 	}
 	if filter.HasNear {
 		clauses = append(clauses, "gps_lat IS NOT NULL AND gps_lon IS NOT NULL")
 	}
+	if tag := strings.ToLower(strings.TrimSpace(filter.Tag)); tag != "" {
+		clauses = append(clauses, "id IN (SELECT media_id FROM media_tags WHERE tag = ? AND source <> ?)")
+		args = append(args, tag, TagSourceAuto)
+	}
+	if tag := strings.ToLower(strings.TrimSpace(filter.AutoTag)); tag != "" {
+		clauses = append(clauses, "id IN (SELECT media_id FROM media_tags WHERE tag = ? AND source = ?)")
+		args = append(args, tag, TagSourceAuto)
+	}
+	if filter.PersonID > 0 {
+		clauses = append(clauses, "id IN (SELECT media_id FROM face_regions WHERE person_id = ?)")
+		args = append(args, filter.PersonID)
+	}
+	if filter.PlaceID > 0 {
+		clauses = append(clauses, "id IN (SELECT media_id FROM media_places WHERE place_id = ?)")
+		args = append(args, filter.PlaceID)
+	}
 	if filter.DeviceUnset {
 		clauses = append(clauses, "TRIM(COALESCE(make, '')) = '' AND TRIM(COALESCE(model, '')) = ''")
 	} else {
@@ -1383,3 +2840,29 @@ func escapeLikePattern(value string) string {
 	value = strings.ReplaceAll(value, `_`, `\_`)
 	return value
 }
+
+// ListImagesAfter returns up to limit image records with ids above afterID,
+// in id order, for passes that walk the whole library a page at a time.
+func (s *Store) ListImagesAfter(ctx context.Context, afterID int64, limit int) ([]MediaRecord, error) {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM media_files
+		WHERE kind = 'image' AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`, mediaSelectColumns), afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]MediaRecord, 0, limit)
+	for rows.Next() {
+		var rec MediaRecord
+		if err := s.scanMediaRecord(rows, &rec); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
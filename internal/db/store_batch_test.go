@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInsertMediaBatchRejectsDuplicatesOnly(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	newRec := func(n int, dest string) *MediaRecord {
+		return &MediaRecord{
+			Kind: "image", FileName: "IMG.jpg", Extension: ".jpg",
+			SourceMount: "/mnt/card", SourcePath: "/mnt/card/IMG.jpg", DestPath: dest,
+			SizeBytes: 10, CRC32: "00000000", SHA256: strings.Repeat(string(rune('a'+n)), 64),
+			CaptureTime: "2026-03-01T10:00:00Z", Metadata: "{}", SourceMTime: "2026-03-01T10:00:00Z", IngestedAt: "2026-03-01T10:00:00Z",
+		}
+	}
+	recs := []*MediaRecord{
+		newRec(0, "/lib/a.jpg"),
+		newRec(1, "/lib/A.JPG"), // same path but for case
+		newRec(2, "/lib/c.jpg"),
+	}
+	rejected, err := store.InsertMediaBatch(ctx, recs)
+	if err != nil {
+		t.Fatalf("InsertMediaBatch: %v", err)
+	}
+	if rejected[0] != nil || rejected[1] == nil || rejected[2] != nil {
+		t.Fatalf("rejected = %v, want only the second", rejected)
+	}
+	if recs[0].ID == 0 || recs[2].ID == 0 {
+		t.Fatalf("ids = %d, %d", recs[0].ID, recs[2].ID)
+	}
+	items, err := store.ListMedia(ctx, "", "", 10, 0)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("records = %d, %v; want 2", len(items), err)
+	}
+}
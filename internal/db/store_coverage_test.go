@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestListCoverageGapsReportsRoadsAndCellsWithoutRecentMedia(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+
+	old := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	recent := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	shots := []struct {
+		road     string
+		lat, lon float64
+		at       time.Time
+	}{
+		{"Main Street", 39.1, -105.9, old},
+		{"Main Street", 39.2, -105.8, recent}, // covered
+		{"Canyon Road", 39.6, -105.4, old},
+		{"Canyon Road", 39.7, -105.3, old.AddDate(0, 1, 0)},
+		{"", 39.9, -105.1, recent},
+		{"Far Road", 45.0, -100.0, old}, // outside the box
+	}
+	for i, s := range shots {
+		ts := s.at.Format(time.RFC3339)
+		rec := &MediaRecord{
+			Kind:        "image",
+			FileName:    fmt.Sprintf("IMG_%04d.JPG", i),
+			Extension:   ".jpg",
+			SourceMount: "/Volumes/Test",
+			SourcePath:  fmt.Sprintf("/DCIM/%04d.JPG", i),
+			DestPath:    fmt.Sprintf("/tmp/usbvault/%04d.JPG", i),
+			SizeBytes:   int64(1000 + i),
+			CRC32:       fmt.Sprintf("%08x", i),
+			SHA256:      fmt.Sprintf("%064x", i),
+			CaptureTime: ts,
+			GPSLat:      sql.NullFloat64{Float64: s.lat, Valid: true},
+			GPSLon:      sql.NullFloat64{Float64: s.lon, Valid: true},
+			State:       sql.NullString{String: "Colorado", Valid: true},
+			City:        sql.NullString{String: "Fairplay", Valid: true},
+			Road:        sql.NullString{String: s.road, Valid: s.road != ""},
+			Metadata:    "{}",
+			SourceMTime: ts,
+			IngestedAt:  ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("insert media %d: %v", i, err)
+		}
+	}
+
+	bounds := MapBounds{South: 39, West: -106, North: 40, East: -105}
+	gaps, err := store.ListCoverageGaps(ctx, bounds, "2026-08-01T00:00:00Z", "", 2, 100, MediaFilter{})
+	if err != nil {
+		t.Fatalf("ListCoverageGaps: %v", err)
+	}
+	if gaps.RoadsSeen != 2 || len(gaps.Roads) != 1 {
+		t.Fatalf("roads seen %d, gaps %+v", gaps.RoadsSeen, gaps.Roads)
+	}
+	road := gaps.Roads[0]
+	if road.Road != "Canyon Road" || road.Count != 2 || road.LastCapture != "2025-07-01T12:00:00Z" {
+		t.Fatalf("road = %+v", road)
+	}
+	if road.Bounds != [4]float64{39.6, -105.4, 39.7, -105.3} {
+		t.Fatalf("road bounds = %v", road.Bounds)
+	}
+
+	// A 2x2 grid: Main Street's cell (south-west) and the north-east cell
+	// have recent media; the north-west cell was never covered.
+	if gaps.CellsTotal != 4 || gaps.CellDeg != 0.5 || len(gaps.Cells) != 2 {
+		t.Fatalf("cells total %d deg %v gaps %+v", gaps.CellsTotal, gaps.CellDeg, gaps.Cells)
+	}
+	if c := gaps.Cells[0]; c.Bounds != [4]float64{39, -105.5, 39.5, -105} || c.Count != 0 {
+		t.Fatalf("south-east cell = %+v", c)
+	}
+	if c := gaps.Cells[1]; c.Bounds != [4]float64{39.5, -106, 40, -105.5} || c.Count != 0 {
+		t.Fatalf("north-west cell = %+v", c)
+	}
+
+	// Narrowed to a range with nothing in it, Main Street is a gap too.
+	gaps, err = store.ListCoverageGaps(ctx, bounds, "", "2025-01-01T00:00:00Z", 2, 1, MediaFilter{})
+	if err != nil {
+		t.Fatalf("ListCoverageGaps: %v", err)
+	}
+	if len(gaps.Roads) != 1 || !gaps.Truncated || gaps.Roads[0].Road != "Canyon Road" || len(gaps.Cells) != 4 {
+		t.Fatalf("gaps = %+v", gaps)
+	}
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenMigratesLegacyDuplicateKeyToSHA256(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	legacy, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open legacy db: %v", err)
+	}
+	if _, err := legacy.Exec(`CREATE TABLE media_files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		file_name TEXT NOT NULL,
+		extension TEXT NOT NULL,
+		source_mount TEXT NOT NULL,
+		source_path TEXT NOT NULL,
+		dest_path TEXT NOT NULL UNIQUE,
+		size_bytes INTEGER NOT NULL,
+		crc32 TEXT NOT NULL,
+		sha256 TEXT NOT NULL,
+		capture_time TEXT NOT NULL,
+		gps_lat REAL,
+		gps_lon REAL,
+		make TEXT,
+		model TEXT,
+		camera_yaw REAL,
+		camera_pitch REAL,
+		camera_roll REAL,
+		metadata_json TEXT NOT NULL,
+		source_mtime TEXT NOT NULL,
+		ingested_at TEXT NOT NULL,
+		UNIQUE (crc32, size_bytes, capture_time)
+	)`); err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+	sum := fmt.Sprintf("%064x", 7)
+	for i, capture := range []string{"2026-01-01T00:00:00Z", "2026-01-02T00:00:00Z"} {
+		if _, err := legacy.Exec(`INSERT INTO media_files (
+			kind, file_name, extension, source_mount, source_path, dest_path, size_bytes, crc32, sha256,
+			capture_time, metadata_json, source_mtime, ingested_at
+		) VALUES ('image', 'A.JPG', '.jpg', '/Volumes/Test', ?, ?, 10, 'deadbeef', ?, ?, '{}', ?, ?)`,
+			fmt.Sprintf("/DCIM/%d/A.JPG", i), fmt.Sprintf("/tmp/usbvault/%d/A.JPG", i), sum, capture, capture, capture,
+		); err != nil {
+			t.Fatalf("insert legacy row %d: %v", i, err)
+		}
+	}
+	_ = legacy.Close()
+
+	store, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	firstID, err := store.FindMediaBySHA256(ctx, sum)
+	if err != nil {
+		t.Fatalf("FindMediaBySHA256: %v", err)
+	}
+	variants, err := store.ListSameContent(ctx, firstID)
+	if err != nil {
+		t.Fatalf("ListSameContent: %v", err)
+	}
+	if len(variants) != 2 {
+		t.Fatalf("ListSameContent returned %d rows, want 2", len(variants))
+	}
+	if variants[0].SameContentID.Valid {
+		t.Fatalf("canonical record linked to %d, want unlinked", variants[0].SameContentID.Int64)
+	}
+	if !variants[1].SameContentID.Valid || variants[1].SameContentID.Int64 != firstID {
+		t.Fatalf("variant same_content_id = %#v, want %d", variants[1].SameContentID, firstID)
+	}
+
+	// Same crc32/size/capture_time but different content must no longer collide.
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	rec := &MediaRecord{
+		Kind:        "image",
+		FileName:    "B.JPG",
+		Extension:   ".jpg",
+		SourceMount: "/Volumes/Test",
+		SourcePath:  "/DCIM/B.JPG",
+		DestPath:    "/tmp/usbvault/B.JPG",
+		SizeBytes:   10,
+		CRC32:       "deadbeef",
+		SHA256:      fmt.Sprintf("%064x", 8),
+		CaptureTime: ts,
+		Metadata:    "{}",
+		SourceMTime: ts,
+		IngestedAt:  ts,
+	}
+	if err := store.InsertMedia(ctx, rec); err != nil {
+		t.Fatalf("InsertMedia with crc32 collision: %v", err)
+	}
+
+	var albumItemsTable int
+	if err := store.DB.QueryRow(`SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name = 'album_items'`).Scan(&albumItemsTable); err != nil {
+		t.Fatalf("inspect schema: %v", err)
+	}
+	if albumItemsTable != 1 {
+		t.Fatalf("album_items table missing after migration")
+	}
+}
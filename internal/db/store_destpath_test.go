@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDestPathUniqueIgnoringCase(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	newRec := func(n int, dest string) *MediaRecord {
+		return &MediaRecord{
+			Kind:        "image",
+			FileName:    "IMG_001.jpg",
+			Extension:   ".jpg",
+			SourceMount: "/Volumes/Test",
+			SourcePath:  fmt.Sprintf("/DCIM/%d.jpg", n),
+			DestPath:    dest,
+			SizeBytes:   int64(1000 + n),
+			CRC32:       fmt.Sprintf("%08x", n),
+			SHA256:      fmt.Sprintf("%064x", n),
+			CaptureTime: ts,
+			Metadata:    "{}",
+			SourceMTime: ts,
+			IngestedAt:  ts,
+		}
+	}
+
+	if err := store.InsertMedia(ctx, newRec(1, "/lib/2026/03/01/IMG_001.jpg")); err != nil {
+		t.Fatalf("InsertMedia: %v", err)
+	}
+	taken, err := store.DestPathTaken(ctx, "/lib/2026/03/01/img_001.JPG")
+	if err != nil || !taken {
+		t.Fatalf("DestPathTaken = %v, %v; want true", taken, err)
+	}
+	if err := store.InsertMedia(ctx, newRec(2, "/lib/2026/03/01/img_001.JPG")); err == nil {
+		t.Fatal("InsertMedia accepted a path differing only in case")
+	}
+}
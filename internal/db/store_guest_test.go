@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGuestSessionEndsWithAccountExpiry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+
+	album, err := store.CreateAlbum(ctx, "Client Review")
+	if err != nil {
+		t.Fatalf("CreateAlbum: %v", err)
+	}
+
+	guestID, err := store.CreateGuestUser(ctx, "client", []byte("h"), []byte("s"), time.Now().UTC().Add(time.Hour), album.ID, "admin")
+	if err != nil {
+		t.Fatalf("CreateGuestUser: %v", err)
+	}
+	if err := store.CreateSession(ctx, "live", guestID, time.Now().UTC().Add(2*time.Hour)); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	session, err := store.LookupSession(ctx, "live")
+	if err != nil {
+		t.Fatalf("LookupSession: %v", err)
+	}
+	if session == nil || session.Role != RoleGuest || session.ScopeAlbumID != album.ID {
+		t.Fatalf("LookupSession = %#v, want guest scoped to album %d", session, album.ID)
+	}
+
+	expiredID, err := store.CreateGuestUser(ctx, "old-client", []byte("h"), []byte("s"), time.Now().UTC().Add(-time.Minute), 0, "admin")
+	if err != nil {
+		t.Fatalf("CreateGuestUser expired: %v", err)
+	}
+	if err := store.CreateSession(ctx, "stale", expiredID, time.Now().UTC().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateSession stale: %v", err)
+	}
+	if session, err := store.LookupSession(ctx, "stale"); err != nil || session != nil {
+		t.Fatalf("LookupSession(stale) = %#v, %v; want nil", session, err)
+	}
+
+	n, err := store.DeleteExpiredGuests(ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpiredGuests: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("DeleteExpiredGuests removed %d, want 1", n)
+	}
+	guests, err := store.ListGuestUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListGuestUsers: %v", err)
+	}
+	if len(guests) != 1 || guests[0].Username != "client" || guests[0].ActiveTokens != 1 {
+		t.Fatalf("ListGuestUsers = %#v", guests)
+	}
+}
+
+func TestGuestWatermarkReachesSession(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+
+	guestID, err := store.CreateGuestUser(ctx, "client", []byte("h"), []byte("s"), time.Now().UTC().Add(time.Hour), 0, "admin")
+	if err != nil {
+		t.Fatalf("CreateGuestUser: %v", err)
+	}
+	if err := store.SetGuestWatermark(ctx, guestID, `{"text":"PROOF"}`); err != nil {
+		t.Fatalf("SetGuestWatermark: %v", err)
+	}
+	if err := store.CreateSession(ctx, "tok", guestID, time.Now().UTC().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	session, err := store.LookupSession(ctx, "tok")
+	if err != nil || session == nil || session.Watermark != `{"text":"PROOF"}` {
+		t.Fatalf("LookupSession = %#v, %v", session, err)
+	}
+	guests, err := store.ListGuestUsers(ctx)
+	if err != nil || len(guests) != 1 || string(guests[0].Watermark) != `{"text":"PROOF"}` {
+		t.Fatalf("ListGuestUsers = %#v, %v", guests, err)
+	}
+}
@@ -64,3 +64,73 @@ func openTestStore(t *testing.T) *Store {
 	})
 	return store
 }
+
+func TestListMapClustersGroupsByCell(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+	base := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+	insert := func(i int, kind, ext string, lat, lon float64) {
+		t.Helper()
+		ts := base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		rec := &MediaRecord{
+			Kind:        kind,
+			FileName:    fmt.Sprintf("F_%04d%s", i, ext),
+			Extension:   ext,
+			SourceMount: "/Volumes/Test",
+			SourcePath:  fmt.Sprintf("/DCIM/%04d%s", i, ext),
+			DestPath:    fmt.Sprintf("/tmp/usbvault/%04d%s", i, ext),
+			SizeBytes:   int64(1000 + i),
+			CRC32:       fmt.Sprintf("%08x", i),
+			SHA256:      fmt.Sprintf("%064x", i),
+			CaptureTime: ts,
+			GPSLat:      sql.NullFloat64{Float64: lat, Valid: true},
+			GPSLon:      sql.NullFloat64{Float64: lon, Valid: true},
+			Metadata:    "{}",
+			SourceMTime: ts,
+			IngestedAt:  ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("insert media %d: %v", i, err)
+		}
+	}
+	// Four images around Denver and, newest, a video without a poster
+	// there, then one image in Fiji east of the antimeridian and one west
+	// of it.
+	for i := range 4 {
+		insert(i, "image", ".jpg", 39.70+float64(i)*0.01, -104.99)
+	}
+	insert(4, "video", ".mp4", 39.74, -104.98)
+	insert(5, "image", ".jpg", -17.7, 179.9)
+	insert(6, "image", ".jpg", -16.5, -179.9)
+
+	clusters, total, err := store.ListMapClusters(ctx, WorldBounds, 1, 100, MediaFilter{})
+	if err != nil {
+		t.Fatalf("ListMapClusters: %v", err)
+	}
+	if total != 7 || len(clusters) != 3 {
+		t.Fatalf("got %d clusters of %d media, want 3 of 7", len(clusters), total)
+	}
+	denver := clusters[0]
+	if denver.Count != 5 || denver.Bounds[0] != 39.70 || denver.Bounds[2] != 39.74 || denver.To != base.Add(4*time.Minute).Format(time.RFC3339) {
+		t.Fatalf("denver cluster = %+v", denver)
+	}
+	if len(denver.Samples) != MapClusterSamples || denver.Samples[0].Kind != "image" || denver.Samples[0].ID != 4 {
+		t.Fatalf("denver samples = %+v, want newest image first", denver.Samples)
+	}
+
+	fiji := MapBounds{South: -20, West: 179, North: -15, East: -179}
+	clusters, total, err = store.ListMapClusters(ctx, fiji, 0.5, 100, MediaFilter{})
+	if err != nil {
+		t.Fatalf("ListMapClusters across antimeridian: %v", err)
+	}
+	if total != 2 || len(clusters) != 2 {
+		t.Fatalf("across antimeridian: %d clusters of %d media, want 2 of 2", len(clusters), total)
+	}
+
+	clusters, total, err = store.ListMapClusters(ctx, WorldBounds, 1, 1, MediaFilter{})
+	if err != nil || len(clusters) != 1 || total != 7 {
+		t.Fatalf("limited: %d clusters of %d, %v", len(clusters), total, err)
+	}
+}
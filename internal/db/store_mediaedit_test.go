@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEditMediaShiftsCaptureTimeAndSetsFields(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+
+	ts := time.Date(2026, 1, 1, 0, 5, 0, 0, time.UTC).Format(time.RFC3339)
+	var ids []int64
+	for i := range 3 {
+		rec := &MediaRecord{
+			Kind:        "image",
+			FileName:    fmt.Sprintf("IMG_%04d.JPG", i),
+			Extension:   ".jpg",
+			SourceMount: "/Volumes/Test",
+			SourcePath:  fmt.Sprintf("/DCIM/%04d.JPG", i),
+			DestPath:    fmt.Sprintf("/tmp/usbvault/%04d.JPG", i),
+			SizeBytes:   int64(1000 + i),
+			CRC32:       fmt.Sprintf("%08x", i),
+			SHA256:      fmt.Sprintf("%064x", i),
+			CaptureTime: ts,
+			Make:        sql.NullString{String: "Unknown", Valid: true},
+			State:       sql.NullString{String: "Utah", Valid: true},
+			County:      sql.NullString{String: "Grand", Valid: true},
+			Metadata:    "{}",
+			SourceMTime: ts,
+			IngestedAt:  ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("insert media %d: %v", i, err)
+		}
+		ids = append(ids, rec.ID)
+	}
+
+	state, county, mk := "Colorado", "", "Canon"
+	edit := MediaEdit{CaptureOffset: -10 * time.Minute, State: &state, County: &county, Make: &mk}
+	n, err := store.EditMedia(ctx, []int64{ids[0], ids[1], 9999}, edit)
+	if err != nil {
+		t.Fatalf("EditMedia: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("edited %d, want 2", n)
+	}
+
+	rec, err := store.GetMediaByID(ctx, ids[0])
+	if err != nil || rec == nil {
+		t.Fatalf("GetMediaByID: %v", err)
+	}
+	if rec.CaptureTime != "2025-12-31T23:55:00Z" {
+		t.Fatalf("capture time = %s", rec.CaptureTime)
+	}
+	if rec.State.String != "Colorado" || rec.County.Valid || rec.Make.String != "Canon" || rec.LocProvider.String != "manual" {
+		t.Fatalf("edited record = state %v county %v make %v provider %v", rec.State, rec.County, rec.Make, rec.LocProvider)
+	}
+
+	// Items left out of the list are untouched, and the index follows.
+	other, err := store.GetMediaByID(ctx, ids[2])
+	if err != nil || other.CaptureTime != ts || other.State.String != "Utah" {
+		t.Fatalf("other record = %+v, %v", other, err)
+	}
+	found, err := store.ListMediaFiltered(ctx, "", "", 10, 0, MediaFilter{Query: "canon"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("search found %d, want 2", len(found))
+	}
+
+	if n, err := store.EditMedia(ctx, ids, MediaEdit{}); err != nil || n != 0 {
+		t.Fatalf("empty edit = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMediaRatingsFilterAndSort(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ids := make([]int64, 4)
+	for i := range ids {
+		ts := base.Add(time.Duration(i) * time.Hour).Format(time.RFC3339)
+		rec := &MediaRecord{
+			Kind:        "image",
+			FileName:    fmt.Sprintf("IMG_%04d.JPG", i),
+			Extension:   ".jpg",
+			SourceMount: "/Volumes/Test",
+			SourcePath:  fmt.Sprintf("/DCIM/%04d.JPG", i),
+			DestPath:    fmt.Sprintf("/tmp/usbvault/%04d.JPG", i),
+			SizeBytes:   int64(1000 + i),
+			CRC32:       fmt.Sprintf("%08x", i),
+			SHA256:      fmt.Sprintf("%064x", i),
+			CaptureTime: ts,
+			Metadata:    "{}",
+			SourceMTime: ts,
+			IngestedAt:  ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("insert media %d: %v", i, err)
+		}
+		ids[i] = rec.ID
+	}
+
+	rate := func(id int64, rating int, favorite bool) {
+		t.Helper()
+		rec, err := store.SetMediaRating(ctx, id, &rating, &favorite)
+		if err != nil || rec == nil || rec.Rating != rating || rec.Favorite != favorite {
+			t.Fatalf("SetMediaRating(%d) = %+v, %v", id, rec, err)
+		}
+	}
+	rate(ids[0], 5, false)
+	rate(ids[1], 3, true)
+	rate(ids[2], 5, true)
+
+	// Only the flag changes; the rating stays.
+	unfavorite := false
+	if rec, err := store.SetMediaRating(ctx, ids[1], nil, &unfavorite); err != nil || rec.Rating != 3 || rec.Favorite {
+		t.Fatalf("SetMediaRating(favorite only) = %+v, %v", rec, err)
+	}
+	bad := 6
+	if _, err := store.SetMediaRating(ctx, ids[0], &bad, nil); err == nil {
+		t.Fatal("rating 6 accepted")
+	}
+	if rec, err := store.SetMediaRating(ctx, 9999, nil, &unfavorite); err != nil || rec != nil {
+		t.Fatalf("SetMediaRating(missing) = %+v, %v", rec, err)
+	}
+
+	names := func(filter MediaFilter) string {
+		t.Helper()
+		items, err := store.ListMediaFiltered(ctx, "rating", "desc", 10, 0, filter)
+		if err != nil {
+			t.Fatalf("ListMediaFiltered: %v", err)
+		}
+		out := make([]string, len(items))
+		for i, it := range items {
+			out[i] = it.FileName
+		}
+		return fmt.Sprint(out)
+	}
+	if got := names(MediaFilter{}); got != "[IMG_0002.JPG IMG_0000.JPG IMG_0001.JPG IMG_0003.JPG]" {
+		t.Fatalf("by rating = %s", got)
+	}
+	if got := names(MediaFilter{Favorite: true}); got != "[IMG_0002.JPG]" {
+		t.Fatalf("favorites = %s", got)
+	}
+	if got := names(MediaFilter{MinRating: 3}); got != "[IMG_0002.JPG IMG_0000.JPG IMG_0001.JPG]" {
+		t.Fatalf("min rating 3 = %s", got)
+	}
+}
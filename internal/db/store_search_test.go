@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMediaSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usbvault.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	ctx := context.Background()
+
+	insert := func(n int, name, metadata string, mk string) int64 {
+		rec := &MediaRecord{
+			Kind: "image", FileName: name, Extension: ".jpg",
+			SourceMount: "/mnt/card", SourcePath: "/mnt/card/" + name, DestPath: "/lib/" + name,
+			SizeBytes: 10, CRC32: "00000000", SHA256: strings.Repeat(string(rune('a'+n)), 64),
+			CaptureTime: "2026-03-01T10:00:00Z", Metadata: metadata, SourceMTime: "2026-03-01T10:00:00Z", IngestedAt: "2026-03-01T10:00:00Z",
+			Make: sql.NullString{String: mk, Valid: mk != ""},
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		return rec.ID
+	}
+	beach := insert(0, "IMG_0001.jpg", `{"lens":{"model":"RF24-105mm"}}`, "Canon")
+	harbor := insert(1, "harbor_canon_test.jpg", `{}`, "Nikon")
+	insert(2, "DSC_0003.jpg", `{"capture_time_fallback":"source_mod_time"}`, "Sony")
+
+	search := func(q, sortBy string) []int64 {
+		t.Helper()
+		items, err := store.ListMediaFiltered(ctx, sortBy, "asc", 10, 0, MediaFilter{Query: q})
+		if err != nil {
+			t.Fatalf("search %q: %v", q, err)
+		}
+		ids := make([]int64, len(items))
+		for i, it := range items {
+			ids[i] = it.ID
+		}
+		return ids
+	}
+
+	if got := search("rf24", ""); len(got) != 1 || got[0] != beach {
+		t.Fatalf("metadata value search = %v, want [%d]", got, beach)
+	}
+	if got := search("fallback", ""); len(got) != 1 {
+		t.Fatalf("metadata key search = %v, want one hit", got)
+	}
+	// A file name hit ranks above a camera make hit.
+	if got := search("canon", ""); len(got) != 2 || got[0] != harbor || got[1] != beach {
+		t.Fatalf("ranked search = %v, want [%d %d]", got, harbor, beach)
+	}
+	if got := search("canon", "file_name"); len(got) != 2 || got[0] != beach {
+		t.Fatalf("search sorted by name = %v, want %d first", got, beach)
+	}
+
+	// Places looked up after ingest are searchable.
+	rec, err := store.GetMediaByID(ctx, beach)
+	if err != nil || rec == nil {
+		t.Fatalf("GetMediaByID: %v", err)
+	}
+	rec.City = sql.NullString{String: "Köln", Valid: true}
+	if err := store.UpdateMediaLocation(ctx, beach, rec); err != nil {
+		t.Fatalf("UpdateMediaLocation: %v", err)
+	}
+	if got := search("koln", ""); len(got) != 1 || got[0] != beach {
+		t.Fatalf("place search = %v, want [%d]", got, beach)
+	}
+
+	// Rows missing from the index, as after a table rebuild, are indexed
+	// on the next start.
+	if _, err := store.DB.ExecContext(ctx, `DELETE FROM media_search`); err != nil {
+		t.Fatalf("clear index: %v", err)
+	}
+	_ = store.Close()
+	if store, err = Open(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	if got := search("harbor", ""); len(got) != 1 || got[0] != harbor {
+		t.Fatalf("search after rebuild = %v, want [%d]", got, harbor)
+	}
+}
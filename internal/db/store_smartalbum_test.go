@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSmartAlbumFollowsItsRules(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+
+	for i, name := range []string{"A.JPG", "B.MP4", "C.MP4"} {
+		kind, ext := "image", ".jpg"
+		if i > 0 {
+			kind, ext = "video", ".mp4"
+		}
+		rec := &MediaRecord{
+			Kind:        kind,
+			FileName:    name,
+			Extension:   ext,
+			SourceMount: "/Volumes/Test",
+			SourcePath:  "/DCIM/" + name,
+			DestPath:    "/tmp/usbvault/" + name,
+			SizeBytes:   int64(1000 + i),
+			CRC32:       fmt.Sprintf("%08x", i),
+			SHA256:      fmt.Sprintf("%064x", i+1),
+			CaptureTime: ts,
+			Metadata:    "{}",
+			SourceMTime: ts,
+			IngestedAt:  ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia(%s): %v", name, err)
+		}
+	}
+	ids := mustMediaIDsByDestPath(t, store, []string{"/tmp/usbvault/A.JPG", "/tmp/usbvault/B.MP4"})
+
+	album, err := store.CreateSmartAlbum(ctx, "Videos", SmartRules{Kind: "video"})
+	if err != nil {
+		t.Fatalf("CreateSmartAlbum: %v", err)
+	}
+	if !album.Smart || album.Rules == nil || album.Rules.Kind != "video" || album.ItemCount != 2 {
+		t.Fatalf("album = %+v", album)
+	}
+
+	items, err := store.ListMediaFiltered(ctx, "name", "asc", 10, 0, MediaFilter{AlbumID: album.ID})
+	if err != nil {
+		t.Fatalf("ListMediaFiltered: %v", err)
+	}
+	if len(items) != 2 || items[0].FileName != "B.MP4" || items[1].FileName != "C.MP4" {
+		t.Fatalf("items = %v", items)
+	}
+	if in, err := store.MediaInAlbum(ctx, album.ID, ids[0]); err != nil || in {
+		t.Fatalf("MediaInAlbum(image) = %v, %v", in, err)
+	}
+	if links, err := store.ListAlbumMediaLinks(ctx, album.ID); err != nil || len(links) != 2 {
+		t.Fatalf("ListAlbumMediaLinks = %d, %v", len(links), err)
+	}
+
+	if _, _, err := store.AddMediaToAlbum(ctx, album.ID, ids[:1]); !errors.Is(err, ErrSmartAlbum) {
+		t.Fatalf("AddMediaToAlbum err = %v, want ErrSmartAlbum", err)
+	}
+	if _, _, err := store.RemoveMediaFromAlbum(ctx, album.ID, ids[1:]); !errors.Is(err, ErrSmartAlbum) {
+		t.Fatalf("RemoveMediaFromAlbum err = %v, want ErrSmartAlbum", err)
+	}
+
+	updated, err := store.SetSmartAlbumRules(ctx, album.ID, SmartRules{Kind: "image"})
+	if err != nil {
+		t.Fatalf("SetSmartAlbumRules: %v", err)
+	}
+	if updated.Version != album.Version+1 || updated.ItemCount != 1 {
+		t.Fatalf("updated = %+v", updated)
+	}
+	if in, err := store.MediaInAlbum(ctx, album.ID, ids[0]); err != nil || !in {
+		t.Fatalf("MediaInAlbum(image) after rules change = %v, %v", in, err)
+	}
+
+	albums, err := store.ListAlbums(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListAlbums: %v", err)
+	}
+	if len(albums) != 1 || !albums[0].Smart || albums[0].ItemCount != 1 {
+		t.Fatalf("ListAlbums = %+v", albums)
+	}
+	if missing, err := store.SetSmartAlbumRules(ctx, album.ID+100, SmartRules{Kind: "image"}); err != nil || missing != nil {
+		t.Fatalf("SetSmartAlbumRules(missing) = %v, %v", missing, err)
+	}
+}
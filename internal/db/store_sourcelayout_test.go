@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSourceLayout(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		mount, path, card, rel string
+	}{
+		{"/media/pi/EOS_DIGITAL", "/media/pi/EOS_DIGITAL/DCIM/100CANON/IMG_0001.JPG", "EOS_DIGITAL", "DCIM/100CANON/IMG_0001.JPG"},
+		{"/media/pi/EOS_DIGITAL/", "/media/pi/EOS_DIGITAL/IMG_0002.JPG", "EOS_DIGITAL", "IMG_0002.JPG"},
+		{"manual_upload", "/tmp/usbvault-upload-1/photo.jpg", "manual_upload", "photo.jpg"},
+		{"/", "/DCIM/x.jpg", "", "DCIM/x.jpg"},
+	}
+	for _, tc := range cases {
+		card, rel := SourceLayout(tc.mount, tc.path)
+		if card != tc.card || rel != tc.rel {
+			t.Errorf("SourceLayout(%q, %q) = %q, %q; want %q, %q", tc.mount, tc.path, card, rel, tc.card, tc.rel)
+		}
+	}
+}
+
+func TestSourceFoldersAndFilter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+	ts := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC).Format(time.RFC3339)
+
+	paths := []struct{ mount, rel string }{
+		{"/media/pi/EOS_DIGITAL", "DCIM/100CANON/IMG_0001.JPG"},
+		{"/media/pi/EOS_DIGITAL", "DCIM/100CANON/IMG_0002.CR3"},
+		{"/media/pi/EOS_DIGITAL", "DCIM/101CANON/IMG_0100.JPG"},
+		{"/media/pi/EOS_DIGITAL", "PRIVATE/M4ROOT/CLIP/C0001.MP4"},
+		{"/media/pi/EOS_DIGITAL", "DCIM/IMG_9999.JPG"},
+		{"/media/pi/DJI", "DCIM/100MEDIA/DJI_0001.JPG"},
+	}
+	for i, p := range paths {
+		rec := &MediaRecord{
+			Kind:        "image",
+			FileName:    fmt.Sprintf("f%d.jpg", i),
+			Extension:   ".jpg",
+			SourceMount: p.mount,
+			SourcePath:  p.mount + "/" + p.rel,
+			DestPath:    fmt.Sprintf("/tmp/usbvault/f%d.jpg", i),
+			SizeBytes:   int64(100 + i),
+			CRC32:       "00000000",
+			SHA256:      fmt.Sprintf("%064x", i+1),
+			CaptureTime: ts,
+			Metadata:    "{}",
+			SourceMTime: ts,
+			IngestedAt:  ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+	}
+
+	got, err := store.GetMediaByID(ctx, 1)
+	if err != nil || got == nil {
+		t.Fatalf("GetMediaByID: %v", err)
+	}
+	if got.SourceCard != "EOS_DIGITAL" || got.SourceRelPath != "DCIM/100CANON/IMG_0001.JPG" {
+		t.Fatalf("layout = %q %q", got.SourceCard, got.SourceRelPath)
+	}
+
+	filter := MediaFilter{SourceCard: "EOS_DIGITAL"}
+	folders, files, err := store.ListSourceFolders(ctx, "", filter)
+	if err != nil {
+		t.Fatalf("ListSourceFolders root: %v", err)
+	}
+	if files != 0 || len(folders) != 2 || folders[0].Path != "DCIM" || folders[0].Count != 4 || folders[1].Path != "PRIVATE" {
+		t.Fatalf("root folders = %+v, files %d", folders, files)
+	}
+
+	folders, files, err = store.ListSourceFolders(ctx, "DCIM/", filter)
+	if err != nil {
+		t.Fatalf("ListSourceFolders DCIM: %v", err)
+	}
+	if files != 1 || len(folders) != 2 || folders[0].Path != "DCIM/100CANON" || folders[0].Count != 2 || folders[1].Name != "101CANON" {
+		t.Fatalf("DCIM folders = %+v, files %d", folders, files)
+	}
+
+	records, err := store.ListMediaFiltered(ctx, "capture_time", "asc", 50, 0, MediaFilter{SourceDir: "DCIM/100CANON"})
+	if err != nil {
+		t.Fatalf("ListMediaFiltered: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("files in DCIM/100CANON = %d, want 2", len(records))
+	}
+
+	cards, err := store.ListSourceCards(ctx, MediaFilter{SourceDir: "DCIM"})
+	if err != nil {
+		t.Fatalf("ListSourceCards: %v", err)
+	}
+	if len(cards) != 2 || cards[0].Name != "DJI" || cards[0].Count != 1 || cards[1].Count != 4 {
+		t.Fatalf("cards = %+v", cards)
+	}
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAlbumAndTagStats(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := openTestStore(t)
+
+	insert := func(n int, kind string, size int64, day int, lat, lon float64, city string) int64 {
+		ts := time.Date(2026, 3, day, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		rec := &MediaRecord{
+			Kind:        kind,
+			FileName:    fmt.Sprintf("IMG_%d.JPG", n),
+			Extension:   ".jpg",
+			SourceMount: "/Volumes/Test",
+			SourcePath:  fmt.Sprintf("/DCIM/IMG_%d.JPG", n),
+			DestPath:    fmt.Sprintf("/tmp/usbvault/IMG_%d.JPG", n),
+			SizeBytes:   size,
+			CRC32:       fmt.Sprintf("%08x", n),
+			SHA256:      fmt.Sprintf("%064x", n),
+			CaptureTime: ts,
+			Metadata:    "{}",
+			SourceMTime: ts,
+			IngestedAt:  ts,
+		}
+		if lat != 0 {
+			rec.GPSLat = sql.NullFloat64{Float64: lat, Valid: true}
+			rec.GPSLon = sql.NullFloat64{Float64: lon, Valid: true}
+		}
+		if city != "" {
+			rec.State = sql.NullString{String: "Colorado", Valid: true}
+			rec.City = sql.NullString{String: city, Valid: true}
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		return rec.ID
+	}
+	a := insert(1, "image", 100, 1, 39.7, -104.9, "Denver")
+	b := insert(2, "video", 1000, 5, 40.0, -105.2, "Boulder")
+	c := insert(3, "image", 10, 9, 0, 0, "Denver")
+	insert(4, "image", 1, 20, 0, 0, "")
+
+	job, err := store.CreateAlbum(ctx, "Job 114")
+	if err != nil {
+		t.Fatalf("CreateAlbum: %v", err)
+	}
+	if _, err := store.CreateAlbum(ctx, "Empty Job"); err != nil {
+		t.Fatalf("CreateAlbum: %v", err)
+	}
+	if _, _, err := store.AddMediaToAlbum(ctx, job.ID, []int64{a, b, c}); err != nil {
+		t.Fatalf("AddMediaToAlbum: %v", err)
+	}
+	for _, id := range []int64{a, b} {
+		if _, err := store.AddMediaTags(ctx, id, []string{"roof"}, "user"); err != nil {
+			t.Fatalf("AddMediaTags: %v", err)
+		}
+	}
+	if _, err := store.AddMediaTags(ctx, c, []string{"vehicle"}, TagSourceAuto); err != nil {
+		t.Fatalf("AddMediaTags: %v", err)
+	}
+
+	lib, err := store.LibraryStats(ctx, MediaFilter{})
+	if err != nil {
+		t.Fatalf("LibraryStats: %v", err)
+	}
+	if lib.Count != 4 || lib.Bytes != 1111 || lib.Images != 3 || lib.Videos != 1 || lib.Places != 2 {
+		t.Fatalf("library stats = %+v", lib)
+	}
+
+	albums, err := store.ListAlbumStats(ctx, MediaFilter{}, 10)
+	if err != nil {
+		t.Fatalf("ListAlbumStats: %v", err)
+	}
+	if len(albums) != 2 || albums[0].Name != "Job 114" || albums[1].Count != 0 {
+		t.Fatalf("album stats = %+v", albums)
+	}
+	got := albums[0]
+	if got.Count != 3 || got.Bytes != 1110 || got.WithGPS != 2 || got.Places != 2 {
+		t.Fatalf("job stats = %+v", got)
+	}
+	if got.FirstCapture != "2026-03-01T12:00:00Z" || got.LastCapture != "2026-03-09T12:00:00Z" {
+		t.Fatalf("job span = %s..%s", got.FirstCapture, got.LastCapture)
+	}
+	if got.MinLat.Float64 != 39.7 || got.MaxLat.Float64 != 40.0 || got.MinLon.Float64 != -105.2 || got.MaxLon.Float64 != -104.9 {
+		t.Fatalf("job bounds = %+v", got)
+	}
+
+	filtered, err := store.ListAlbumStats(ctx, MediaFilter{Kind: "image"}, 10)
+	if err != nil {
+		t.Fatalf("ListAlbumStats(filtered): %v", err)
+	}
+	if filtered[0].Count != 2 || filtered[0].Bytes != 110 {
+		t.Fatalf("filtered job stats = %+v", filtered[0])
+	}
+
+	tags, err := store.ListTagStats(ctx, MediaFilter{}, 10)
+	if err != nil {
+		t.Fatalf("ListTagStats: %v", err)
+	}
+	if len(tags) != 1 || tags[0].Tag != "roof" || tags[0].Count != 2 || tags[0].Bytes != 1100 {
+		t.Fatalf("tag stats = %+v, want only roof", tags)
+	}
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSyncTimelapses(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	ids := make([]int64, 6)
+	for i := range ids {
+		rec := &MediaRecord{
+			Kind: "image", FileName: fmt.Sprintf("IMG_%d.jpg", i), Extension: ".jpg",
+			SourceMount: "/mnt/card", SourcePath: fmt.Sprintf("/mnt/card/IMG_%d.jpg", i), DestPath: fmt.Sprintf("/lib/IMG_%d.jpg", i),
+			SizeBytes: 10, CRC32: "00000000", SHA256: strings.Repeat(string(rune('a'+i)), 64),
+			CaptureTime: "2026-03-01T10:00:00Z", Metadata: "{}", SourceMTime: "2026-03-01T10:00:00Z", IngestedAt: "2026-03-01T10:00:00Z",
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		ids[i] = rec.ID
+	}
+	spec := func(mediaIDs ...int64) TimelapseSpec {
+		return TimelapseSpec{MediaIDs: mediaIDs, StartTime: "2026-03-01T10:00:00Z", EndTime: "2026-03-01T10:05:00Z", IntervalSec: 5}
+	}
+
+	added, changed, removed, _, err := store.SyncTimelapses(ctx, []TimelapseSpec{spec(ids[0], ids[1], ids[2]), spec(ids[3], ids[4])})
+	if err != nil || added != 2 || changed != 0 || removed != 0 {
+		t.Fatalf("first sync = %d added, %d changed, %d removed, %v", added, changed, removed, err)
+	}
+	first, err := store.GetTimelapseForMedia(ctx, ids[1])
+	if err != nil || first == nil || first.FrameCount != 3 || first.Status != TimelapsePending {
+		t.Fatalf("timelapse of frame = %+v, %v", first, err)
+	}
+	if err := store.RecordTimelapseRender(ctx, first.ID, "/lib/.usbvault/proxies/timelapse/1.mp4", 100, ""); err != nil {
+		t.Fatalf("RecordTimelapseRender: %v", err)
+	}
+
+	// The first sequence grew by a frame and the second is gone.
+	added, changed, removed, stale, err := store.SyncTimelapses(ctx, []TimelapseSpec{spec(ids[0], ids[1], ids[2], ids[5])})
+	if err != nil || added != 0 || changed != 1 || removed != 1 {
+		t.Fatalf("second sync = %d added, %d changed, %d removed, %v", added, changed, removed, err)
+	}
+	if len(stale) != 1 || stale[0] != "/lib/.usbvault/proxies/timelapse/1.mp4" {
+		t.Fatalf("stale = %v", stale)
+	}
+	got, err := store.GetTimelapse(ctx, first.ID)
+	if err != nil || got == nil || got.FrameCount != 4 || got.Status != TimelapsePending || got.VideoPath != "" {
+		t.Fatalf("changed timelapse = %+v, %v", got, err)
+	}
+	frames, err := store.ListTimelapseFrames(ctx, first.ID)
+	if err != nil || len(frames) != 4 || frames[3].MediaID != ids[5] {
+		t.Fatalf("frames = %+v, %v", frames, err)
+	}
+	if all, _ := store.ListTimelapses(ctx); len(all) != 1 {
+		t.Fatalf("timelapses = %d, want 1", len(all))
+	}
+
+	// Unchanged sequences are left alone.
+	added, changed, removed, _, err = store.SyncTimelapses(ctx, []TimelapseSpec{spec(ids[0], ids[1], ids[2], ids[5])})
+	if err != nil || added+changed+removed != 0 {
+		t.Fatalf("third sync = %d added, %d changed, %d removed, %v", added, changed, removed, err)
+	}
+}
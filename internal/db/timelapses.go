@@ -0,0 +1,344 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+)
+
+const (
+	TimelapsePending = "pending"
+	TimelapseReady   = "ready"
+	TimelapseFailed  = "failed"
+)
+
+// TimelapseCandidate is a library still considered for time-lapse
+// detection.
+type TimelapseCandidate struct {
+	MediaID       int64
+	FileName      string
+	SourceMount   string
+	SourcePath    string
+	SourceCard    string
+	SourceRelPath string
+	Make          string
+	Model         string
+	CaptureTime   string
+}
+
+// Timelapse is a detected run of stills and the video rendered from them.
+type Timelapse struct {
+	ID           int64   `json:"id"`
+	FirstMediaID int64   `json:"first_media_id"`
+	FrameCount   int64   `json:"frame_count"`
+	StartTime    string  `json:"start_time"`
+	EndTime      string  `json:"end_time"`
+	IntervalSec  float64 `json:"interval_sec"`
+	Status       string  `json:"status"` // pending, ready, failed
+	VideoPath    string  `json:"-"`
+	SizeBytes    int64   `json:"size_bytes"`
+	Error        string  `json:"error,omitempty"`
+	DetectedAt   string  `json:"detected_at"`
+	RenderedAt   string  `json:"rendered_at,omitempty"`
+}
+
+// TimelapseSpec is a sequence as detection found it, frames in order.
+type TimelapseSpec struct {
+	MediaIDs    []int64
+	StartTime   string
+	EndTime     string
+	IntervalSec float64
+}
+
+// TimelapseFrame is one still of a sequence, for rendering.
+type TimelapseFrame struct {
+	MediaID   int64
+	DestPath  string
+	Extension string
+}
+
+const timelapseColumns = `id, first_media_id, frame_count, start_time, end_time, interval_sec,
+	status, video_path, size_bytes, error, detected_at, rendered_at`
+
+// ListTimelapseCandidates returns every image with a capture time, leaving
+// out legacy records that repeat another record's content.
+func (s *Store) ListTimelapseCandidates(ctx context.Context) ([]TimelapseCandidate, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, file_name, source_mount, source_path, source_card, source_rel_path,
+		       COALESCE(make, ''), COALESCE(model, ''), capture_time
+		FROM media_files
+		WHERE kind = 'image' AND capture_time <> '' AND same_content_id IS NULL
+		ORDER BY id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]TimelapseCandidate, 0)
+	for rows.Next() {
+		var c TimelapseCandidate
+		if err := rows.Scan(&c.MediaID, &c.FileName, &c.SourceMount, &c.SourcePath, &c.SourceCard,
+			&c.SourceRelPath, &c.Make, &c.Model, &c.CaptureTime); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// SyncTimelapses makes the stored sequences match specs. A sequence is
+// known by its first frame: one whose frames changed goes back to pending,
+// and sequences no longer detected are dropped. stale lists the videos
+// that no longer match their frames, for the caller to remove.
+func (s *Store) SyncTimelapses(ctx context.Context, specs []TimelapseSpec) (added, changed, removed int, stale []string, err error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	type existing struct {
+		id        int64
+		frames    []int64
+		videoPath string
+	}
+	byFirst := map[int64]*existing{}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT t.id, t.first_media_id, t.video_path, f.media_id
+		FROM timelapses t JOIN timelapse_frames f ON f.timelapse_id = t.id
+		ORDER BY t.id, f.position
+	`)
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	for rows.Next() {
+		var id, first, mediaID int64
+		var videoPath string
+		if err := rows.Scan(&id, &first, &videoPath, &mediaID); err != nil {
+			_ = rows.Close()
+			return 0, 0, 0, nil, err
+		}
+		e := byFirst[first]
+		if e == nil {
+			e = &existing{id: id, videoPath: videoPath}
+			byFirst[first] = e
+		}
+		e.frames = append(e.frames, mediaID)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, 0, 0, nil, err
+	}
+	// Sequences whose frames were all deleted have no rows above.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM timelapses WHERE id NOT IN (SELECT timelapse_id FROM timelapse_frames)`); err != nil {
+		return 0, 0, 0, nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	kept := map[int64]bool{}
+	for _, spec := range specs {
+		if len(spec.MediaIDs) == 0 {
+			continue
+		}
+		first := spec.MediaIDs[0]
+		kept[first] = true
+		e := byFirst[first]
+		switch {
+		case e == nil:
+			res, err := tx.ExecContext(ctx, `
+				INSERT INTO timelapses (first_media_id, frame_count, start_time, end_time, interval_sec, status, detected_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, first, len(spec.MediaIDs), spec.StartTime, spec.EndTime, spec.IntervalSec, TimelapsePending, now)
+			if err != nil {
+				return 0, 0, 0, nil, err
+			}
+			id, err := res.LastInsertId()
+			if err != nil {
+				return 0, 0, 0, nil, err
+			}
+			if err := insertTimelapseFrames(ctx, tx, id, spec.MediaIDs); err != nil {
+				return 0, 0, 0, nil, err
+			}
+			added++
+		case !slices.Equal(e.frames, spec.MediaIDs):
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE timelapses SET frame_count = ?, start_time = ?, end_time = ?, interval_sec = ?,
+					status = ?, video_path = '', size_bytes = 0, error = '', detected_at = ?, rendered_at = ''
+				WHERE id = ?
+			`, len(spec.MediaIDs), spec.StartTime, spec.EndTime, spec.IntervalSec, TimelapsePending, now, e.id); err != nil {
+				return 0, 0, 0, nil, err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM timelapse_frames WHERE timelapse_id = ?`, e.id); err != nil {
+				return 0, 0, 0, nil, err
+			}
+			if err := insertTimelapseFrames(ctx, tx, e.id, spec.MediaIDs); err != nil {
+				return 0, 0, 0, nil, err
+			}
+			if e.videoPath != "" {
+				stale = append(stale, e.videoPath)
+			}
+			changed++
+		}
+	}
+	for first, e := range byFirst {
+		if kept[first] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM timelapses WHERE id = ?`, e.id); err != nil {
+			return 0, 0, 0, nil, err
+		}
+		if e.videoPath != "" {
+			stale = append(stale, e.videoPath)
+		}
+		removed++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, 0, nil, err
+	}
+	return added, changed, removed, stale, nil
+}
+
+func insertTimelapseFrames(ctx context.Context, tx *sql.Tx, id int64, mediaIDs []int64) error {
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO timelapse_frames (timelapse_id, position, media_id) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, mediaID := range mediaIDs {
+		if _, err := stmt.ExecContext(ctx, id, i, mediaID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) scanTimelapse(row interface{ Scan(...any) error }) (Timelapse, error) {
+	var t Timelapse
+	err := row.Scan(&t.ID, &t.FirstMediaID, &t.FrameCount, &t.StartTime, &t.EndTime, &t.IntervalSec,
+		&t.Status, &t.VideoPath, &t.SizeBytes, &t.Error, &t.DetectedAt, &t.RenderedAt)
+	t.VideoPath = s.rebase(t.VideoPath)
+	return t, err
+}
+
+// ListTimelapses returns the detected sequences, most recent first.
+func (s *Store) ListTimelapses(ctx context.Context) ([]Timelapse, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+timelapseColumns+` FROM timelapses ORDER BY start_time DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]Timelapse, 0)
+	for rows.Next() {
+		t, err := s.scanTimelapse(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// GetTimelapse returns a sequence, or nil when there is none with id.
+func (s *Store) GetTimelapse(ctx context.Context, id int64) (*Timelapse, error) {
+	t, err := s.scanTimelapse(s.DB.QueryRowContext(ctx, `SELECT `+timelapseColumns+` FROM timelapses WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetTimelapseForMedia returns the sequence a still belongs to, or nil.
+func (s *Store) GetTimelapseForMedia(ctx context.Context, mediaID int64) (*Timelapse, error) {
+	t, err := s.scanTimelapse(s.DB.QueryRowContext(ctx, `
+		SELECT `+timelapseColumns+` FROM timelapses
+		WHERE id = (SELECT timelapse_id FROM timelapse_frames WHERE media_id = ? LIMIT 1)
+	`, mediaID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListTimelapseFrames returns a sequence's stills in order.
+func (s *Store) ListTimelapseFrames(ctx context.Context, id int64) ([]TimelapseFrame, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT m.id, m.dest_path, m.extension
+		FROM timelapse_frames f JOIN media_files m ON m.id = f.media_id
+		WHERE f.timelapse_id = ?
+		ORDER BY f.position
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]TimelapseFrame, 0)
+	for rows.Next() {
+		var f TimelapseFrame
+		if err := rows.Scan(&f.MediaID, &f.DestPath, &f.Extension); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// ListPendingTimelapses returns sequences waiting to be rendered, oldest
+// first.
+func (s *Store) ListPendingTimelapses(ctx context.Context) ([]Timelapse, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+timelapseColumns+` FROM timelapses WHERE status = ? ORDER BY id`, TimelapsePending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]Timelapse, 0)
+	for rows.Next() {
+		t, err := s.scanTimelapse(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CountPendingTimelapses(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.DB.QueryRowContext(ctx, `SELECT COUNT(1) FROM timelapses WHERE status = ?`, TimelapsePending).Scan(&n)
+	return n, err
+}
+
+// RecordTimelapseRender stores the result of rendering a sequence. When
+// renderErr is set the sequence is marked failed and videoPath ignored.
+func (s *Store) RecordTimelapseRender(ctx context.Context, id int64, videoPath string, sizeBytes int64, renderErr string) error {
+	status := TimelapseReady
+	if renderErr != "" {
+		status, videoPath, sizeBytes = TimelapseFailed, "", 0
+	}
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE timelapses SET status = ?, video_path = ?, size_bytes = ?, error = ?, rendered_at = ?
+		WHERE id = ?
+	`, status, videoPath, sizeBytes, renderErr, time.Now().UTC().Format(time.RFC3339), id)
+	return err
+}
+
+// RetryTimelapse puts a sequence back in line for rendering. It reports
+// false when there is no such sequence.
+func (s *Store) RetryTimelapse(ctx context.Context, id int64) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `UPDATE timelapses SET status = ?, error = '' WHERE id = ?`, TimelapsePending, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,533 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// TrashItem is a media item deleted from the library whose files wait in
+// the trash until they are purged. Restoring it brings it back under the
+// same id, in the albums and with the tags it had, and with what the
+// background jobs and cloud sync had recorded about it.
+type TrashItem struct {
+	MediaID   int64  `json:"media_id"`
+	Kind      string `json:"kind"`
+	FileName  string `json:"file_name"`
+	SHA256    string `json:"sha256"`
+	SizeBytes int64  `json:"size_bytes"`
+	DeletedBy string `json:"deleted_by"`
+	DeletedAt string `json:"deleted_at"`
+	LastError string `json:"last_error,omitempty"`
+	// Held is set while the content is on legal hold; it is not purged
+	// until the hold is released.
+	Held bool `json:"held"`
+	// TrashDir holds the file and its sidecars while they are in the
+	// trash. It is empty when they stayed where they were, as in remote
+	// storage.
+	TrashDir string `json:"-"`
+
+	Record   MediaRecord    `json:"-"`
+	Sidecars []TrashSidecar `json:"-"`
+}
+
+// TrashSidecar is a sidecar as it was in the library, with the path it is
+// put back at.
+type TrashSidecar struct {
+	Kind       string `json:"kind"`
+	FileName   string `json:"file_name"`
+	SourcePath string `json:"source_path"`
+	DestPath   string `json:"dest_path"`
+	SizeBytes  int64  `json:"size_bytes"`
+	SHA256     string `json:"sha256"`
+}
+
+type trashTag struct {
+	Tag       string `json:"tag"`
+	Source    string `json:"source"`
+	CreatedAt string `json:"created_at"`
+}
+
+// trashExtras is what the background jobs and cloud sync had recorded about
+// a trashed item: its faces and who they are, the scans that found them,
+// its text and hash, its uploads, and the places and track it was matched
+// to. Putting it back saves doing all of that again.
+type trashExtras struct {
+	Faces       []trashFace      `json:"faces,omitempty"`
+	FaceScan    *trashScan       `json:"face_scan,omitempty"`
+	AutotagScan *trashScan       `json:"autotag_scan,omitempty"`
+	OCRScan     *trashScan       `json:"ocr_scan,omitempty"`
+	ImageHash   *trashImageHash  `json:"image_hash,omitempty"`
+	CloudSync   []trashCloudSync `json:"cloud_sync,omitempty"`
+	Places      []int64          `json:"places,omitempty"`
+	GPXMatch    *trashGPXMatch   `json:"gpx_match,omitempty"`
+}
+
+type trashFace struct {
+	ID         int64   `json:"id"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	W          float64 `json:"w"`
+	H          float64 `json:"h"`
+	Score      float64 `json:"score"`
+	PersonName string  `json:"person_name,omitempty"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+// trashScan is a row of face_scans or autotag_scans, where Count is the
+// faces or labels found, or of ocr_scans, where Text is what was read.
+type trashScan struct {
+	ScannedAt string `json:"scanned_at"`
+	Count     int64  `json:"count,omitempty"`
+	Text      string `json:"text,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type trashImageHash struct {
+	DHash    *int64 `json:"dhash"`
+	HashedAt string `json:"hashed_at"`
+	Error    string `json:"error,omitempty"`
+}
+
+type trashCloudSync struct {
+	Target     string `json:"target"`
+	RemoteName string `json:"remote_name"`
+	SHA256     string `json:"sha256"`
+	Status     string `json:"status"`
+	Attempts   int64  `json:"attempts"`
+	LastError  string `json:"last_error"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+type trashGPXMatch struct {
+	TrackID   int64  `json:"track_id"`
+	MatchedAt string `json:"matched_at"`
+}
+
+// ErrTrashNotFound is returned for a media id that is not in the trash.
+var ErrTrashNotFound = errors.New("not in the trash")
+
+// TrashMedia removes rec from the library and records it in the trash,
+// with its sidecars, album membership, tags and extras. trashDir is where its
+// files now are, or empty when they were left in place.
+func (s *Store) TrashMedia(ctx context.Context, rec MediaRecord, sidecars []Sidecar, trashDir, deletedBy string) (err error) {
+	recJSON, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	trashed := make([]TrashSidecar, 0, len(sidecars))
+	for _, sc := range sidecars {
+		trashed = append(trashed, TrashSidecar{
+			Kind: sc.Kind, FileName: sc.FileName, SourcePath: sc.SourcePath,
+			DestPath: sc.DestPath, SizeBytes: sc.SizeBytes, SHA256: sc.SHA256,
+		})
+	}
+	scJSON, err := json.Marshal(trashed)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	albums := make([]int64, 0)
+	rows, err := tx.QueryContext(ctx, `SELECT album_id FROM album_items WHERE media_id = ? ORDER BY album_id`, rec.ID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		albums = append(albums, id)
+	}
+	rows.Close()
+	tags := make([]trashTag, 0)
+	rows, err = tx.QueryContext(ctx, `SELECT tag, source, created_at FROM media_tags WHERE media_id = ? ORDER BY tag`, rec.ID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var t trashTag
+		if err = rows.Scan(&t.Tag, &t.Source, &t.CreatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		tags = append(tags, t)
+	}
+	rows.Close()
+	extras, err := snapshotExtras(ctx, tx, rec.ID)
+	if err != nil {
+		return err
+	}
+	albumsJSON, _ := json.Marshal(albums)
+	tagsJSON, _ := json.Marshal(tags)
+	extrasJSON, _ := json.Marshal(extras)
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO media_trash (media_id, kind, file_name, sha256, size_bytes, record_json, sidecars_json,
+			albums_json, tags_json, extras_json, trash_dir, deleted_by, deleted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.ID, rec.Kind, rec.FileName, rec.SHA256, rec.SizeBytes, string(recJSON), string(scJSON),
+		string(albumsJSON), string(tagsJSON), string(extrasJSON), trashDir, deletedBy, time.Now().UTC().Format(time.RFC3339),
+	); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM media_files WHERE id = ?`, rec.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// snapshotExtras reads the extras of mediaID, before deleting the item
+// takes them with it.
+func snapshotExtras(ctx context.Context, tx *sql.Tx, mediaID int64) (x trashExtras, err error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT f.id, f.x, f.y, f.w, f.h, f.score, COALESCE(p.name, ''), f.created_at
+		FROM face_regions f LEFT JOIN people p ON p.id = f.person_id
+		WHERE f.media_id = ? ORDER BY f.id`, mediaID)
+	if err != nil {
+		return x, err
+	}
+	for rows.Next() {
+		var f trashFace
+		if err = rows.Scan(&f.ID, &f.X, &f.Y, &f.W, &f.H, &f.Score, &f.PersonName, &f.CreatedAt); err != nil {
+			rows.Close()
+			return x, err
+		}
+		x.Faces = append(x.Faces, f)
+	}
+	rows.Close()
+
+	for _, scan := range []struct {
+		query string
+		dest  **trashScan
+	}{
+		{`SELECT scanned_at, faces, '', COALESCE(error, '') FROM face_scans WHERE media_id = ?`, &x.FaceScan},
+		{`SELECT scanned_at, labels, '', COALESCE(error, '') FROM autotag_scans WHERE media_id = ?`, &x.AutotagScan},
+		{`SELECT scanned_at, 0, text, COALESCE(error, '') FROM ocr_scans WHERE media_id = ?`, &x.OCRScan},
+	} {
+		var sc trashScan
+		err = tx.QueryRowContext(ctx, scan.query, mediaID).Scan(&sc.ScannedAt, &sc.Count, &sc.Text, &sc.Error)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return x, err
+		}
+		*scan.dest = &sc
+	}
+
+	var (
+		hash  trashImageHash
+		dhash sql.NullInt64
+	)
+	err = tx.QueryRowContext(ctx, `SELECT dhash, hashed_at, COALESCE(error, '') FROM image_hashes WHERE media_id = ?`, mediaID).
+		Scan(&dhash, &hash.HashedAt, &hash.Error)
+	if err == nil {
+		if dhash.Valid {
+			hash.DHash = &dhash.Int64
+		}
+		x.ImageHash = &hash
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return x, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT target, remote_name, sha256, status, attempts, last_error, updated_at
+		FROM cloud_sync_files WHERE media_id = ? ORDER BY target`, mediaID)
+	if err != nil {
+		return x, err
+	}
+	for rows.Next() {
+		var c trashCloudSync
+		if err = rows.Scan(&c.Target, &c.RemoteName, &c.SHA256, &c.Status, &c.Attempts, &c.LastError, &c.UpdatedAt); err != nil {
+			rows.Close()
+			return x, err
+		}
+		x.CloudSync = append(x.CloudSync, c)
+	}
+	rows.Close()
+
+	rows, err = tx.QueryContext(ctx, `SELECT place_id FROM media_places WHERE media_id = ? ORDER BY place_id`, mediaID)
+	if err != nil {
+		return x, err
+	}
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return x, err
+		}
+		x.Places = append(x.Places, id)
+	}
+	rows.Close()
+
+	var gpx trashGPXMatch
+	err = tx.QueryRowContext(ctx, `SELECT track_id, matched_at FROM media_gpx_matches WHERE media_id = ?`, mediaID).
+		Scan(&gpx.TrackID, &gpx.MatchedAt)
+	if err == nil {
+		x.GPXMatch = &gpx
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return x, err
+	}
+	return x, nil
+}
+
+// restoreExtras puts the extras back on a restored item. Named people are
+// created again if they have gone since; places and tracks that have gone
+// are left out.
+func restoreExtras(ctx context.Context, tx *sql.Tx, mediaID int64, x trashExtras) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, f := range x.Faces {
+		var personID any
+		if f.PersonName != "" {
+			if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO people (name, created_at) VALUES (?, ?)`, f.PersonName, now); err != nil {
+				return err
+			}
+			var id int64
+			if err := tx.QueryRowContext(ctx, `SELECT id FROM people WHERE name = ?`, f.PersonName).Scan(&id); err != nil {
+				return err
+			}
+			personID = id
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO face_regions (id, media_id, x, y, w, h, score, person_id, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			f.ID, mediaID, f.X, f.Y, f.W, f.H, f.Score, personID, f.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if sc := x.FaceScan; sc != nil {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO face_scans (media_id, scanned_at, faces, error) VALUES (?, ?, ?, ?)`,
+			mediaID, sc.ScannedAt, sc.Count, nullable(sc.Error)); err != nil {
+			return err
+		}
+	}
+	if sc := x.AutotagScan; sc != nil {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO autotag_scans (media_id, scanned_at, labels, error) VALUES (?, ?, ?, ?)`,
+			mediaID, sc.ScannedAt, sc.Count, nullable(sc.Error)); err != nil {
+			return err
+		}
+	}
+	if sc := x.OCRScan; sc != nil {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO ocr_scans (media_id, scanned_at, text, error) VALUES (?, ?, ?, ?)`,
+			mediaID, sc.ScannedAt, sc.Text, nullable(sc.Error)); err != nil {
+			return err
+		}
+	}
+	if h := x.ImageHash; h != nil {
+		var dhash any
+		if h.DHash != nil {
+			dhash = *h.DHash
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO image_hashes (media_id, dhash, hashed_at, error) VALUES (?, ?, ?, ?)`,
+			mediaID, dhash, h.HashedAt, nullable(h.Error)); err != nil {
+			return err
+		}
+	}
+	for _, c := range x.CloudSync {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO cloud_sync_files (media_id, target, remote_name, sha256, status, attempts, last_error, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			mediaID, c.Target, c.RemoteName, c.SHA256, c.Status, c.Attempts, c.LastError, c.UpdatedAt); err != nil {
+			return err
+		}
+	}
+	for _, placeID := range x.Places {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO media_places (media_id, place_id)
+			SELECT ?, id FROM named_places WHERE id = ?`, mediaID, placeID); err != nil {
+			return err
+		}
+	}
+	if g := x.GPXMatch; g != nil {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO media_gpx_matches (media_id, track_id, matched_at)
+			SELECT ?, id, ? FROM gpx_tracks WHERE id = ?`, mediaID, g.MatchedAt, g.TrackID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const trashColumns = `t.media_id, t.kind, t.file_name, t.sha256, t.size_bytes, t.deleted_by, t.deleted_at,
+	t.last_error, t.trash_dir, t.record_json, t.sidecars_json,
+	EXISTS (SELECT 1 FROM legal_holds h WHERE h.sha256 = t.sha256)`
+
+func scanTrash(row interface{ Scan(...any) error }) (TrashItem, error) {
+	var (
+		t               TrashItem
+		recJSON, scJSON string
+	)
+	if err := row.Scan(&t.MediaID, &t.Kind, &t.FileName, &t.SHA256, &t.SizeBytes, &t.DeletedBy, &t.DeletedAt,
+		&t.LastError, &t.TrashDir, &recJSON, &scJSON, &t.Held); err != nil {
+		return TrashItem{}, err
+	}
+	if err := json.Unmarshal([]byte(recJSON), &t.Record); err != nil {
+		return TrashItem{}, err
+	}
+	if err := json.Unmarshal([]byte(scJSON), &t.Sidecars); err != nil {
+		return TrashItem{}, err
+	}
+	return t, nil
+}
+
+func (s *Store) queryTrash(ctx context.Context, query string, args ...any) ([]TrashItem, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]TrashItem, 0)
+	for rows.Next() {
+		t, err := scanTrash(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// ListTrash returns what is in the trash, most recently deleted first.
+func (s *Store) ListTrash(ctx context.Context, limit int) ([]TrashItem, error) {
+	if limit <= 0 || limit > 5000 {
+		limit = 1000
+	}
+	return s.queryTrash(ctx, `SELECT `+trashColumns+` FROM media_trash t ORDER BY t.deleted_at DESC, t.media_id DESC LIMIT ?`, limit)
+}
+
+// DueTrash returns up to limit items deleted at or before cutoff, leaving
+// out content on legal hold.
+func (s *Store) DueTrash(ctx context.Context, cutoff time.Time, limit int) ([]TrashItem, error) {
+	return s.queryTrash(ctx, `
+		SELECT `+trashColumns+` FROM media_trash t
+		WHERE t.deleted_at <= ?
+		  AND NOT EXISTS (SELECT 1 FROM legal_holds h WHERE h.sha256 = t.sha256)
+		ORDER BY t.deleted_at, t.media_id
+		LIMIT ?`,
+		cutoff.UTC().Format(time.RFC3339), limit)
+}
+
+// GetTrash returns the trashed item that had media id mediaID, or
+// ErrTrashNotFound.
+func (s *Store) GetTrash(ctx context.Context, mediaID int64) (TrashItem, error) {
+	t, err := scanTrash(s.DB.QueryRowContext(ctx, `SELECT `+trashColumns+` FROM media_trash t WHERE t.media_id = ?`, mediaID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return TrashItem{}, ErrTrashNotFound
+	}
+	return t, err
+}
+
+// FinishTrash forgets a trashed item once its files are gone.
+func (s *Store) FinishTrash(ctx context.Context, mediaID int64) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM media_trash WHERE media_id = ?`, mediaID)
+	return err
+}
+
+// SetTrashError records why purging a trashed item failed; it is tried
+// again next run.
+func (s *Store) SetTrashError(ctx context.Context, mediaID int64, msg string) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE media_trash SET last_error = ? WHERE media_id = ?`, msg, mediaID)
+	return err
+}
+
+// RestoreTrash puts a trashed item back in the library under its old id,
+// with its sidecars, rating, tags, extras and the albums it was in that
+// still exist. The caller moves the files back first. It fails with a uniqueness
+// error if the same file has been ingested again in the meantime.
+func (s *Store) RestoreTrash(ctx context.Context, mediaID int64) (rec MediaRecord, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return MediaRecord{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	var recJSON, scJSON, albumsJSON, tagsJSON, extrasJSON string
+	err = tx.QueryRowContext(ctx, `SELECT record_json, sidecars_json, albums_json, tags_json, extras_json FROM media_trash WHERE media_id = ?`, mediaID).
+		Scan(&recJSON, &scJSON, &albumsJSON, &tagsJSON, &extrasJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrTrashNotFound
+	}
+	if err != nil {
+		return MediaRecord{}, err
+	}
+	var (
+		sidecars []TrashSidecar
+		albums   []int64
+		tags     []trashTag
+		extras   trashExtras
+	)
+	if err = json.Unmarshal([]byte(recJSON), &rec); err != nil {
+		return MediaRecord{}, err
+	}
+	if err = json.Unmarshal([]byte(scJSON), &sidecars); err != nil {
+		return MediaRecord{}, err
+	}
+	if err = json.Unmarshal([]byte(albumsJSON), &albums); err != nil {
+		return MediaRecord{}, err
+	}
+	if err = json.Unmarshal([]byte(tagsJSON), &tags); err != nil {
+		return MediaRecord{}, err
+	}
+	if err = json.Unmarshal([]byte(extrasJSON), &extras); err != nil {
+		return MediaRecord{}, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM media_trash WHERE media_id = ?`, mediaID); err != nil {
+		return MediaRecord{}, err
+	}
+	rec.ID, rec.SameContentID = mediaID, sql.NullInt64{}
+	if err = insertMedia(ctx, tx, &rec); err != nil {
+		return MediaRecord{}, err
+	}
+	if rec.Rating != 0 || rec.Favorite {
+		if _, err = tx.ExecContext(ctx, `UPDATE media_files SET rating = ?, favorite = ? WHERE id = ?`, rec.Rating, rec.Favorite, rec.ID); err != nil {
+			return MediaRecord{}, err
+		}
+	}
+	for _, sc := range sidecars {
+		if _, err = tx.ExecContext(ctx, `
+			INSERT INTO media_sidecars (media_id, kind, file_name, source_path, dest_path, size_bytes, sha256)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			rec.ID, sc.Kind, sc.FileName, sc.SourcePath, sc.DestPath, sc.SizeBytes, sc.SHA256); err != nil {
+			return MediaRecord{}, err
+		}
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, albumID := range albums {
+		if _, err = tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO album_items (album_id, media_id, added_at)
+			SELECT id, ?, ? FROM albums WHERE id = ?`, rec.ID, now, albumID); err != nil {
+			return MediaRecord{}, err
+		}
+	}
+	for _, t := range tags {
+		if _, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO media_tags (media_id, tag, source, created_at) VALUES (?, ?, ?, ?)`,
+			rec.ID, t.Tag, t.Source, t.CreatedAt); err != nil {
+			return MediaRecord{}, err
+		}
+	}
+	if err = restoreExtras(ctx, tx, rec.ID, extras); err != nil {
+		return MediaRecord{}, err
+	}
+	return rec, tx.Commit()
+}
@@ -0,0 +1,330 @@
+// Package dbcrypt keeps the SQLite database encrypted at rest. The live
+// database runs from a working copy (ideally on tmpfs); Seal snapshots it and
+// replaces the encrypted file atomically.
+package dbcrypt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	magic       = "UVDBENC2"
+	legacyMagic = "UVDBENC1"
+	saltSize    = 16
+	keySize     = 32
+	chunkSize   = 1 << 20
+
+	// magic | salt | wrap nonce | wrapped data key | chunk nonce prefix
+	headerSize = len(magic) + saltSize + 12 + keySize + 16 + 4
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted encrypted database")
+
+// Vault owns the encrypted file and its decrypted working copy.
+type Vault struct {
+	encPath  string
+	workPath string
+	salt     []byte
+	kek      []byte // from the passphrase; wraps the data key of each seal
+
+	mu sync.Mutex
+}
+
+// Unlock derives the key and, if encPath exists, decrypts it to a working
+// copy in workDir. A missing encPath starts a new vault with a fresh salt.
+func Unlock(encPath, workDir string, passphrase []byte) (*Vault, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	if err := os.MkdirAll(workDir, 0o700); err != nil {
+		return nil, fmt.Errorf("create working dir: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(encPath), 0o750); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	v := &Vault{
+		encPath:  encPath,
+		workPath: filepath.Join(workDir, filepath.Base(encPath)+".work.db"),
+	}
+
+	f, err := os.Open(encPath)
+	if errors.Is(err, os.ErrNotExist) {
+		v.salt = make([]byte, saltSize)
+		if _, err := rand.Read(v.salt); err != nil {
+			return nil, err
+		}
+		if v.kek, err = deriveKey(passphrase, v.salt); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Decrypt beside the working copy and swap it in only on success, so a
+	// wrong passphrase never disturbs an existing copy.
+	tmp := v.workPath + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	err = v.decrypt(f, out, passphrase)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	v.Wipe()
+	if err := os.Rename(tmp, v.workPath); err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	return v, nil
+}
+
+// Exists reports whether an encrypted database has been written before.
+func (v *Vault) Exists() bool {
+	_, err := os.Stat(v.encPath)
+	return err == nil
+}
+
+func (v *Vault) WorkPath() string { return v.workPath }
+
+// Seal writes a consistent snapshot (produced by snapshot into the given
+// path) to the encrypted file. The previous encrypted file is only replaced
+// once the new one is fully written.
+func (v *Vault) Seal(ctx context.Context, snapshot func(ctx context.Context, dst string) error) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	snap := v.workPath + ".snapshot"
+	_ = os.Remove(snap)
+	defer os.Remove(snap)
+	if err := snapshot(ctx, snap); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+
+	in, err := os.Open(snap)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := v.encPath + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	err = v.encrypt(in, out)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, v.encPath)
+}
+
+// Wipe removes the plaintext working copy and its SQLite side files.
+func (v *Vault) Wipe() {
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal", ".snapshot"} {
+		_ = os.Remove(v.workPath + suffix)
+	}
+}
+
+func deriveKey(passphrase, salt []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, keySize)
+}
+
+// File layout: magic | salt | wrap nonce | wrapped data key | nonce prefix
+// (4) | chunks. Every seal draws a new random data key, wrapped with
+// AES-GCM under the key derived from the passphrase and salt, so no two
+// seals share a key however often the database is sealed. Each chunk is
+// up to chunkSize bytes of plaintext sealed with AES-GCM under the data
+// key; the nonce is the prefix followed by a 64-bit counter, and the
+// header plus a final-chunk flag are authenticated so truncation and
+// reordering are detected.
+//
+// Files written before data keys (magic UVDBENC1) have no wrap nonce or
+// wrapped key, and their chunks are sealed under the derived key itself.
+// They are still read, and the next seal rewrites them.
+
+func (v *Vault) encrypt(in io.Reader, out io.Writer) error {
+	kek, err := newAEAD(v.kek)
+	if err != nil {
+		return err
+	}
+	dataKey := make([]byte, keySize)
+	wrapNonce := make([]byte, 12)
+	prefix := make([]byte, 4)
+	for _, b := range [][]byte{dataKey, wrapNonce, prefix} {
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+	}
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, v.salt...)
+	header = append(header, wrapNonce...)
+	header = kek.Seal(header, wrapNonce, dataKey, header[:len(magic)+saltSize])
+	header = append(header, prefix...)
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(in)
+	buf := make([]byte, chunkSize)
+	sealed := make([]byte, 0, chunkSize+aead.Overhead())
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		last := n < chunkSize
+		if !last {
+			if _, perr := r.Peek(1); errors.Is(perr, io.EOF) {
+				last = true
+			}
+		}
+		sealed = aead.Seal(sealed[:0], chunkNonce(prefix, counter), buf[:n], chunkAAD(header, last))
+		if _, err := out.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// readHeader reads the header of an encrypted file, sets the vault's salt
+// and passphrase key from it, and returns it with the data key of the
+// chunks and their nonce prefix.
+func (v *Vault) readHeader(r io.Reader, passphrase []byte) (header, dataKey, prefix []byte, err error) {
+	header = make([]byte, len(magic)+saltSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, nil, fmt.Errorf("read header: %w", err)
+	}
+	legacy := bytes.Equal(header[:len(magic)], []byte(legacyMagic))
+	if !legacy && !bytes.Equal(header[:len(magic)], []byte(magic)) {
+		return nil, nil, nil, errors.New("not an encrypted usbvault database")
+	}
+	v.salt = append([]byte(nil), header[len(magic):]...)
+	if v.kek, err = deriveKey(passphrase, v.salt); err != nil {
+		return nil, nil, nil, err
+	}
+	rest := headerSize - len(header)
+	if legacy {
+		rest = 4
+	}
+	header = append(header, make([]byte, rest)...)
+	if _, err := io.ReadFull(r, header[len(magic)+saltSize:]); err != nil {
+		return nil, nil, nil, fmt.Errorf("read header: %w", err)
+	}
+	prefix = header[len(header)-4:]
+	if legacy {
+		return header, v.kek, prefix, nil
+	}
+	kek, err := newAEAD(v.kek)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	wrapNonce := header[len(magic)+saltSize : len(magic)+saltSize+12]
+	wrapped := header[len(magic)+saltSize+12 : len(header)-4]
+	if dataKey, err = kek.Open(nil, wrapNonce, wrapped, header[:len(magic)+saltSize]); err != nil {
+		return nil, nil, nil, ErrWrongPassphrase
+	}
+	return header, dataKey, prefix, nil
+}
+
+func (v *Vault) decrypt(in io.Reader, out io.Writer, passphrase []byte) error {
+	r := bufio.NewReader(in)
+	header, dataKey, prefix, err := v.readHeader(r, passphrase)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, chunkSize+aead.Overhead())
+	plain := make([]byte, 0, chunkSize)
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			if errors.Is(err, io.EOF) {
+				return ErrWrongPassphrase
+			}
+			return err
+		}
+		last := n < len(buf)
+		if !last {
+			if _, perr := r.Peek(1); errors.Is(perr, io.EOF) {
+				last = true
+			}
+		}
+		plain, err = aead.Open(plain[:0], chunkNonce(prefix, counter), buf[:n], chunkAAD(header, last))
+		if err != nil {
+			return ErrWrongPassphrase
+		}
+		if _, err := out.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint64) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+func chunkAAD(header []byte, last bool) []byte {
+	aad := append([]byte(nil), header...)
+	if last {
+		return append(aad, 1)
+	}
+	return append(aad, 0)
+}
@@ -0,0 +1,162 @@
+package dbcrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSealAndUnlockRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	encPath := filepath.Join(dir, "usbvault.db.enc")
+	workDir := filepath.Join(dir, "run")
+
+	for _, size := range []int{0, 1234, chunkSize, 2*chunkSize + 17} {
+		want := make([]byte, size)
+		if _, err := rand.Read(want); err != nil {
+			t.Fatalf("rand: %v", err)
+		}
+
+		vault, err := Unlock(encPath, workDir, []byte("correct horse"))
+		if err != nil {
+			t.Fatalf("Unlock(size=%d): %v", size, err)
+		}
+		err = vault.Seal(context.Background(), func(_ context.Context, dst string) error {
+			return os.WriteFile(dst, want, 0o600)
+		})
+		if err != nil {
+			t.Fatalf("Seal(size=%d): %v", size, err)
+		}
+		vault.Wipe()
+
+		sealed, err := os.ReadFile(encPath)
+		if err != nil {
+			t.Fatalf("read sealed: %v", err)
+		}
+		if size > 64 && bytes.Contains(sealed, want[:64]) {
+			t.Fatalf("sealed file contains plaintext")
+		}
+
+		reopened, err := Unlock(encPath, workDir, []byte("correct horse"))
+		if err != nil {
+			t.Fatalf("re-Unlock(size=%d): %v", size, err)
+		}
+		got, err := os.ReadFile(reopened.WorkPath())
+		if err != nil {
+			t.Fatalf("read work copy: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("round trip mismatch for size %d", size)
+		}
+		reopened.Wipe()
+	}
+
+	if _, err := Unlock(encPath, workDir, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Unlock(wrong) err = %v, want ErrWrongPassphrase", err)
+	}
+
+	// Dropping the final chunk must be detected rather than yielding a
+	// silently shortened database.
+	sealed, _ := os.ReadFile(encPath)
+	if err := os.WriteFile(encPath, sealed[:len(sealed)-20], 0o600); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	if _, err := Unlock(encPath, workDir, []byte("correct horse")); err == nil {
+		t.Fatalf("Unlock(truncated) expected error")
+	}
+}
+
+func TestEachSealHasItsOwnDataKey(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	encPath := filepath.Join(dir, "usbvault.db.enc")
+	vault, err := Unlock(encPath, filepath.Join(dir, "run"), []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	plain := bytes.Repeat([]byte("same database "), 1000)
+	var keys, sealed [][]byte
+	for range 2 {
+		if err := vault.Seal(context.Background(), func(_ context.Context, dst string) error {
+			return os.WriteFile(dst, plain, 0o600)
+		}); err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		raw, err := os.ReadFile(encPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, dataKey, _, err := (&Vault{}).readHeader(bytes.NewReader(raw), []byte("correct horse"))
+		if err != nil {
+			t.Fatalf("readHeader: %v", err)
+		}
+		keys, sealed = append(keys, dataKey), append(sealed, raw)
+	}
+	if len(keys[0]) != keySize || bytes.Equal(keys[0], keys[1]) {
+		t.Fatalf("two seals share the data key %x", keys[0])
+	}
+	if bytes.Equal(sealed[0][headerSize:], sealed[1][headerSize:]) {
+		t.Fatal("two seals of the same plaintext give the same ciphertext")
+	}
+}
+
+func TestUnlockReadsLegacyFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	encPath := filepath.Join(dir, "usbvault.db.enc")
+	workDir := filepath.Join(dir, "run")
+	want := bytes.Repeat([]byte("written before data keys "), 100)
+
+	// The old layout: magic | salt | nonce prefix | chunks sealed under the
+	// key derived from the passphrase.
+	salt, prefix := make([]byte, saltSize), make([]byte, 4)
+	_, _ = rand.Read(salt)
+	_, _ = rand.Read(prefix)
+	key, err := deriveKey([]byte("correct horse"), salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := append(append([]byte(legacyMagic), salt...), prefix...)
+	file := aead.Seal(append([]byte(nil), header...), chunkNonce(prefix, 0), want, chunkAAD(header, true))
+	if err := os.WriteFile(encPath, file, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	vault, err := Unlock(encPath, workDir, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Unlock(legacy): %v", err)
+	}
+	if got, _ := os.ReadFile(vault.WorkPath()); !bytes.Equal(got, want) {
+		t.Fatal("legacy file decrypted wrong")
+	}
+	// The next seal writes the current layout under the same passphrase.
+	if err := vault.Seal(context.Background(), func(_ context.Context, dst string) error {
+		return os.WriteFile(dst, want, 0o600)
+	}); err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	vault.Wipe()
+	if raw, _ := os.ReadFile(encPath); !bytes.HasPrefix(raw, []byte(magic)) {
+		t.Fatalf("resealed file starts %q", raw[:len(magic)])
+	}
+	reopened, err := Unlock(encPath, workDir, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Unlock(resealed): %v", err)
+	}
+	if got, _ := os.ReadFile(reopened.WorkPath()); !bytes.Equal(got, want) {
+		t.Fatal("resealed file decrypted wrong")
+	}
+	reopened.Wipe()
+}
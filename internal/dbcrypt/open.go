@@ -0,0 +1,89 @@
+package dbcrypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+)
+
+func EncryptedPath() string {
+	return config.DBPath() + ".enc"
+}
+
+// OpenStore opens the configured database. With encryption enabled it
+// unlocks the vault, migrates an existing plaintext database on first use,
+// and returns the Vault the caller must Seal and Wipe on shutdown. Without
+// encryption the returned Vault is nil. In read-only mode it opens the
+// read-only database, which has to be unencrypted.
+func OpenStore(ctx context.Context, logger *log.Logger) (*db.Store, *Vault, error) {
+	if config.ReadOnly() {
+		if config.DBEncryptionEnabled() {
+			return nil, nil, errors.New("read-only mode cannot open an encrypted database; unset USBVAULT_DB_ENCRYPTION")
+		}
+		store, err := db.OpenReadOnly(config.ReadOnlyDBPath())
+		return store, nil, err
+	}
+	plainPath := config.DBPath()
+	if !config.DBEncryptionEnabled() {
+		if _, err := os.Stat(EncryptedPath()); err == nil {
+			return nil, nil, errors.New("found an encrypted database; set USBVAULT_DB_ENCRYPTION=1 and provide the passphrase")
+		}
+		store, err := db.Open(plainPath)
+		return store, nil, err
+	}
+
+	passphrase, err := config.DBPassphrase()
+	if err != nil {
+		return nil, nil, err
+	}
+	vault, err := Unlock(EncryptedPath(), config.DBRuntimeDir(), passphrase)
+	clear(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrated := false
+	if !vault.Exists() {
+		if _, err := os.Stat(plainPath); err == nil {
+			legacy, err := db.Open(plainPath)
+			if err != nil {
+				vault.Wipe()
+				return nil, nil, fmt.Errorf("open plaintext database: %w", err)
+			}
+			err = legacy.Snapshot(ctx, vault.WorkPath())
+			_ = legacy.Close()
+			if err != nil {
+				vault.Wipe()
+				return nil, nil, fmt.Errorf("copy plaintext database: %w", err)
+			}
+			migrated = true
+		}
+	}
+
+	store, err := db.Open(vault.WorkPath())
+	if err != nil {
+		vault.Wipe()
+		return nil, nil, err
+	}
+	if !vault.Exists() {
+		if err := vault.Seal(ctx, store.Snapshot); err != nil {
+			_ = store.Close()
+			vault.Wipe()
+			return nil, nil, fmt.Errorf("seal database: %w", err)
+		}
+	}
+	if migrated {
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			_ = os.Remove(plainPath + suffix)
+		}
+		if logger != nil {
+			logger.Printf("encrypted existing database to %s and removed the plaintext copy", EncryptedPath())
+		}
+	}
+	return store, vault, nil
+}
@@ -0,0 +1,91 @@
+package disk
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const benchBlock = 4 << 20
+
+// BenchResult is one sequential write and read-back of a temporary file.
+type BenchResult struct {
+	Bytes        int64   `json:"bytes"`
+	WriteSeconds float64 `json:"write_seconds"`
+	ReadSeconds  float64 `json:"read_seconds"`
+	WriteMBps    float64 `json:"write_mbps"`
+	ReadMBps     float64 `json:"read_mbps"`
+}
+
+// Bench writes size bytes to a temporary file in dir, syncs it, reads it
+// back and removes it. Each block carries its offset, so a drive that
+// returns other data than was written (as counterfeit flash does once its
+// real capacity is used up) fails rather than reporting a speed. Reads skip
+// the page cache where the platform allows it.
+func Bench(ctx context.Context, dir string, size int64) (BenchResult, error) {
+	size = (size + benchBlock - 1) / benchBlock * benchBlock
+	f, err := os.CreateTemp(dir, ".usbvault-bench-*")
+	if err != nil {
+		return BenchResult{}, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	uncache(f)
+
+	pattern := make([]byte, benchBlock)
+	if _, err := rand.Read(pattern); err != nil {
+		return BenchResult{}, err
+	}
+	block := func(off int64) []byte {
+		binary.LittleEndian.PutUint64(pattern, uint64(off))
+		return pattern
+	}
+
+	res := BenchResult{Bytes: size}
+	start := time.Now()
+	for off := int64(0); off < size; off += benchBlock {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if _, err := f.Write(block(off)); err != nil {
+			return res, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return res, err
+	}
+	res.WriteSeconds = time.Since(start).Seconds()
+	uncache(f)
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return res, err
+	}
+	buf := make([]byte, benchBlock)
+	start = time.Now()
+	for off := int64(0); off < size; off += benchBlock {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if _, err := io.ReadFull(f, buf); err != nil {
+			return res, err
+		}
+		if !bytes.Equal(buf, block(off)) {
+			return res, fmt.Errorf("data read back differs from what was written at offset %d", off)
+		}
+	}
+	res.ReadSeconds = time.Since(start).Seconds()
+
+	const mib = 1024 * 1024
+	if res.WriteSeconds > 0 {
+		res.WriteMBps = float64(size) / mib / res.WriteSeconds
+	}
+	if res.ReadSeconds > 0 {
+		res.ReadMBps = float64(size) / mib / res.ReadSeconds
+	}
+	return res, nil
+}
@@ -0,0 +1,15 @@
+//go:build darwin
+// +build darwin
+
+package disk
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// uncache turns off the buffer cache for the file.
+func uncache(f *os.File) {
+	_, _ = unix.FcntlInt(f.Fd(), unix.F_NOCACHE, 1)
+}
@@ -0,0 +1,15 @@
+//go:build linux
+// +build linux
+
+package disk
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// uncache drops the file's pages from the page cache once they are on disk.
+func uncache(f *os.File) {
+	_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package disk
+
+import "os"
+
+// uncache does nothing here; read speeds may come from the cache.
+func uncache(f *os.File) {}
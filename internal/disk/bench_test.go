@@ -0,0 +1,36 @@
+package disk
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestBenchRoundsUpAndCleansUp(t *testing.T) {
+	dir := t.TempDir()
+	res, err := Bench(context.Background(), dir, 5<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Bytes != 8<<20 {
+		t.Fatalf("bytes = %d, want two whole blocks", res.Bytes)
+	}
+	if res.WriteMBps <= 0 || res.ReadMBps <= 0 {
+		t.Fatalf("speeds = %v / %v", res.WriteMBps, res.ReadMBps)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("left %d files behind", len(entries))
+	}
+}
+
+func TestBenchStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Bench(ctx, t.TempDir(), 8<<20); err == nil {
+		t.Fatal("cancelled benchmark succeeded")
+	}
+}
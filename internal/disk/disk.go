@@ -0,0 +1,9 @@
+// Package disk reports free space on the volume holding a path and measures
+// how fast the volume reads and writes.
+package disk
+
+// Usage is the size of a volume and the space left for unprivileged writes.
+type Usage struct {
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package disk
+
+import "syscall"
+
+func Stat(path string) (Usage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Usage{}, err
+	}
+	bsize := uint64(st.Bsize)
+	return Usage{TotalBytes: st.Blocks * bsize, FreeBytes: st.Bavail * bsize}, nil
+}
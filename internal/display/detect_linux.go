@@ -10,14 +10,6 @@ import (
 	"strings"
 )
 
-type State struct {
-	HasHDMI      bool
-	HasDSI       bool
-	HasAnyDRM    bool
-	Framebuffers []string
-	HasTouch     bool
-}
-
 func Detect() State {
 	st := State{}
 
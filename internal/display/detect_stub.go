@@ -3,14 +3,6 @@
 
 package display
 
-type State struct {
-	HasHDMI      bool
-	HasDSI       bool
-	HasAnyDRM    bool
-	Framebuffers []string
-	HasTouch     bool
-}
-
 func Detect() State {
 	return State{}
 }
@@ -0,0 +1,68 @@
+package display
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+type State struct {
+	HasHDMI      bool     `json:"hdmi"`
+	HasDSI       bool     `json:"dsi"`
+	HasAnyDRM    bool     `json:"drm"`
+	Framebuffers []string `json:"framebuffers"`
+	HasTouch     bool     `json:"touch"`
+}
+
+// UI values name the interface a display setup should show.
+const (
+	UINone    = "none"    // headless
+	UIDesktop = "desktop" // the Mac-like UI, on HDMI
+	UITouch   = "touch"   // the touch UI, on DSI or small framebuffer screens
+)
+
+// UI picks the interface for st.
+func (st State) UI() string {
+	// Prefer the Mac-like UI on HDMI.
+	if st.HasHDMI {
+		return UIDesktop
+	}
+	// If there is touch and some non-HDMI display (DSI or framebuffer), use touch UI.
+	if st.HasTouch && (st.HasDSI || len(st.Framebuffers) > 0) {
+		return UITouch
+	}
+	// Some GPIO/SPI tiny screens appear only as fb1+.
+	if st.HasDSI || len(st.Framebuffers) > 0 {
+		return UIDesktop
+	}
+	return UINone
+}
+
+func (st State) Equal(other State) bool {
+	return st.HasHDMI == other.HasHDMI &&
+		st.HasDSI == other.HasDSI &&
+		st.HasAnyDRM == other.HasAnyDRM &&
+		st.HasTouch == other.HasTouch &&
+		slices.Equal(st.Framebuffers, other.Framebuffers)
+}
+
+// Watch calls onChange with the current state and again whenever a monitor
+// or touch device is plugged or unplugged, until ctx ends. DRM connector
+// status in sysfs has no change notification, so it polls every interval.
+func Watch(ctx context.Context, interval time.Duration, onChange func(State)) {
+	last := Detect()
+	onChange(last)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if st := Detect(); !st.Equal(last) {
+			last = st
+			onChange(st)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package display
+
+import "testing"
+
+func TestStateUI(t *testing.T) {
+	cases := []struct {
+		name string
+		st   State
+		want string
+	}{
+		{"headless", State{}, UINone},
+		{"hdmi", State{HasHDMI: true, HasAnyDRM: true}, UIDesktop},
+		{"hdmi wins over touch", State{HasHDMI: true, HasDSI: true, HasTouch: true}, UIDesktop},
+		{"dsi touch", State{HasDSI: true, HasTouch: true}, UITouch},
+		{"spi touch", State{Framebuffers: []string{"fb1"}, HasTouch: true}, UITouch},
+		{"framebuffer without touch", State{Framebuffers: []string{"fb1"}}, UIDesktop},
+		{"touch without display", State{HasTouch: true}, UINone},
+	}
+	for _, tc := range cases {
+		if got := tc.st.UI(); got != tc.want {
+			t.Errorf("%s: UI() = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
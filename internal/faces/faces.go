@@ -0,0 +1,205 @@
+// Package faces finds face regions in library images with a local detector
+// command and stores them so people can be named. It is off unless a
+// detector is configured, and images never leave the machine.
+//
+// The detector reads one JPEG on stdin and prints
+//
+//	{"faces": [{"x": 0.41, "y": 0.2, "w": 0.12, "h": 0.16, "score": 0.97}]}
+//
+// with coordinates as fractions of the image size.
+package faces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/vision"
+)
+
+const (
+	batchSize = 20
+	// minScore drops detections too weak to be worth naming.
+	minScore = 0.5
+	maxFaces = 200
+)
+
+var ErrBusy = errors.New("face scan already running")
+
+type Status struct {
+	Enabled      bool   `json:"enabled"`
+	State        string `json:"state"` // idle, running, success, error
+	LastStarted  string `json:"last_started"`
+	LastFinished string `json:"last_finished"`
+	Message      string `json:"message"`
+	Scanned      int    `json:"scanned"`
+	Faces        int    `json:"faces"`
+	Skipped      int    `json:"skipped"`
+	Pending      int64  `json:"pending"`
+}
+
+type Scanner struct {
+	store    *db.Store
+	logger   *log.Logger
+	detector string
+	timeout  time.Duration
+	libKey   *libcrypt.Key
+
+	runMu  sync.Mutex
+	mu     sync.Mutex
+	status Status
+}
+
+func New(store *db.Store, logger *log.Logger, detector string, timeout time.Duration) *Scanner {
+	return &Scanner{
+		store:    store,
+		logger:   logger,
+		detector: detector,
+		timeout:  timeout,
+		status:   Status{Enabled: true, State: "idle", Message: "Waiting for first scan."},
+	}
+}
+
+// SetLibraryKey lets the scanner read encrypted library files.
+func (s *Scanner) SetLibraryKey(key *libcrypt.Key) {
+	s.libKey = key
+}
+
+func (s *Scanner) GetStatus(ctx context.Context) Status {
+	pending, _ := s.store.CountFaceScanTodos(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.status
+	st.Pending = pending
+	return st
+}
+
+// Start scans immediately and then every interval until ctx ends, picking up
+// newly ingested images.
+func (s *Scanner) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.RunOnce(ctx); err != nil && !errors.Is(err, ErrBusy) && ctx.Err() == nil {
+				s.logger.Printf("face scan failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce scans every image that has not been scanned yet. A detector
+// failure stops the pass without marking the image, so it is retried next
+// time; images that cannot be decoded are marked and skipped.
+func (s *Scanner) RunOnce(ctx context.Context) error {
+	if !s.runMu.TryLock() {
+		return ErrBusy
+	}
+	defer s.runMu.Unlock()
+
+	s.mu.Lock()
+	s.status.State = "running"
+	s.status.LastStarted = time.Now().UTC().Format(time.RFC3339)
+	s.status.Message = "Scanning for faces..."
+	s.mu.Unlock()
+
+	scanned, found, skipped, err := s.scanAll(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LastFinished = time.Now().UTC().Format(time.RFC3339)
+	s.status.Scanned += scanned
+	s.status.Faces += found
+	s.status.Skipped += skipped
+	if err != nil {
+		s.status.State = "error"
+		s.status.Message = err.Error()
+		return err
+	}
+	s.status.State = "success"
+	s.status.Message = fmt.Sprintf("Scanned %d images; found %d faces.", scanned, found)
+	return nil
+}
+
+func (s *Scanner) scanAll(ctx context.Context) (scanned, found, skipped int, err error) {
+	for {
+		todos, err := s.store.ListFaceScanTodos(ctx, batchSize)
+		if err != nil {
+			return scanned, found, skipped, err
+		}
+		if len(todos) == 0 {
+			return scanned, found, skipped, nil
+		}
+		for _, t := range todos {
+			if err := ctx.Err(); err != nil {
+				return scanned, found, skipped, err
+			}
+			regions, err := s.detect(ctx, t)
+			scanErr := ""
+			if errors.Is(err, vision.ErrUndecodable) {
+				scanErr = err.Error()
+				skipped++
+			} else if err != nil {
+				return scanned, found, skipped, err
+			}
+			if err := s.store.RecordFaceScan(ctx, t.ID, regions, scanErr); err != nil {
+				return scanned, found, skipped, err
+			}
+			scanned++
+			found += len(regions)
+		}
+	}
+}
+
+type detectorOutput struct {
+	Faces []struct {
+		X     float64 `json:"x"`
+		Y     float64 `json:"y"`
+		W     float64 `json:"w"`
+		H     float64 `json:"h"`
+		Score float64 `json:"score"`
+	} `json:"faces"`
+}
+
+func (s *Scanner) detect(ctx context.Context, t db.FaceScanTodo) ([]db.FaceRegion, error) {
+	img, err := vision.Load(s.libKey, t.DestPath, t.Extension)
+	if err != nil {
+		return nil, err
+	}
+	var out detectorOutput
+	if err := vision.Run(ctx, s.detector, s.timeout, img, &out); err != nil {
+		return nil, err
+	}
+	regions := make([]db.FaceRegion, 0, len(out.Faces))
+	for _, f := range out.Faces {
+		if f.Score < minScore || len(regions) == maxFaces {
+			continue
+		}
+		x, y := clamp01(f.X), clamp01(f.Y)
+		w, h := clamp01(f.W), clamp01(f.H)
+		w, h = math.Min(w, 1-x), math.Min(h, 1-y)
+		if w <= 0 || h <= 0 {
+			continue
+		}
+		regions = append(regions, db.FaceRegion{MediaID: t.ID, X: x, Y: y, W: w, H: h, Score: math.Min(f.Score, 1)})
+	}
+	return regions, nil
+}
+
+func clamp01(v float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return math.Max(0, math.Min(1, v))
+}
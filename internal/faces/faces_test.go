@@ -0,0 +1,143 @@
+package faces
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func writeDetector(t *testing.T, dir, output string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("detector stub is a shell script")
+	}
+	path := filepath.Join(dir, "detect")
+	script := fmt.Sprintf("#!/bin/sh\ncat >/dev/null\necho '%s'\n", output)
+	if err := os.WriteFile(path, []byte(script), 0o750); err != nil {
+		t.Fatalf("write detector: %v", err)
+	}
+	return path
+}
+
+func insertMedia(t *testing.T, store *db.Store, path, ext string, n int) int64 {
+	t.Helper()
+	ts := time.Now().UTC().Format(time.RFC3339)
+	rec := &db.MediaRecord{
+		Kind:        "image",
+		FileName:    filepath.Base(path),
+		Extension:   ext,
+		SourceMount: "/Volumes/Test",
+		SourcePath:  "/DCIM/" + filepath.Base(path),
+		DestPath:    path,
+		SizeBytes:   int64(n),
+		CRC32:       fmt.Sprintf("%08x", n),
+		SHA256:      fmt.Sprintf("%064x", n),
+		CaptureTime: ts,
+		Metadata:    "{}",
+		SourceMTime: ts,
+		IngestedAt:  ts,
+	}
+	if err := store.InsertMedia(context.Background(), rec); err != nil {
+		t.Fatalf("InsertMedia: %v", err)
+	}
+	return rec.ID
+}
+
+func TestScanStoresFacesAndPeopleFilter(t *testing.T) {
+	dir := t.TempDir()
+	store, err := db.Open(filepath.Join(dir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	photo := filepath.Join(dir, "a.png")
+	f, err := os.Create(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	photoID := insertMedia(t, store, photo, ".png", 1)
+	rawID := insertMedia(t, store, filepath.Join(dir, "b.dng"), ".dng", 2)
+
+	detector := writeDetector(t, dir, `{"faces":[{"x":0.1,"y":0.2,"w":0.3,"h":0.4,"score":0.9},{"x":0.8,"y":0.8,"w":0.5,"h":0.5,"score":0.7},{"x":0.5,"y":0.5,"w":0.1,"h":0.1,"score":0.2}]}`)
+	s := New(store, log.New(io.Discard, "", 0), detector, 10*time.Second)
+	if err := s.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	st := s.GetStatus(ctx)
+	if st.State != "success" || st.Scanned != 2 || st.Skipped != 1 || st.Faces != 2 || st.Pending != 0 {
+		t.Fatalf("status = %+v", st)
+	}
+
+	regions, err := store.ListFaces(ctx, photoID)
+	if err != nil || len(regions) != 2 {
+		t.Fatalf("ListFaces = %+v, %v; want 2 (weak detection dropped)", regions, err)
+	}
+	if r := regions[1]; r.X != 0.8 || r.W > 0.2+1e-9 {
+		t.Fatalf("edge region not clipped to the image: %+v", r)
+	}
+	if raw, _ := store.ListFaces(ctx, rawID); len(raw) != 0 {
+		t.Fatalf("undecodable image got faces: %+v", raw)
+	}
+
+	face, err := store.NameFace(ctx, regions[0].ID, "Ada")
+	if err != nil || face == nil || face.PersonName != "Ada" {
+		t.Fatalf("NameFace = %+v, %v", face, err)
+	}
+	people, err := store.ListPeople(ctx, db.MediaFilter{}, 10)
+	if err != nil || len(people) != 1 || people[0].Name != "Ada" || people[0].MediaCount != 1 {
+		t.Fatalf("ListPeople = %+v, %v", people, err)
+	}
+	items, err := store.ListMediaFiltered(ctx, "capture_time", "desc", 10, 0, db.MediaFilter{PersonID: people[0].ID})
+	if err != nil || len(items) != 1 || items[0].ID != photoID {
+		t.Fatalf("ListMedia by person = %+v, %v", items, err)
+	}
+
+	if _, err := store.NameFace(ctx, regions[0].ID, ""); err != nil {
+		t.Fatalf("NameFace clear: %v", err)
+	}
+	if people, _ := store.ListPeople(ctx, db.MediaFilter{}, 10); len(people) != 0 {
+		t.Fatalf("person without faces was kept: %+v", people)
+	}
+}
+
+func TestDetectorFailureLeavesImagePending(t *testing.T) {
+	dir := t.TempDir()
+	store, err := db.Open(filepath.Join(dir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	photo := filepath.Join(dir, "a.png")
+	f, _ := os.Create(photo)
+	_ = png.Encode(f, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	f.Close()
+	insertMedia(t, store, photo, ".png", 1)
+
+	s := New(store, log.New(io.Discard, "", 0), filepath.Join(dir, "missing-detector"), time.Second)
+	if err := s.RunOnce(context.Background()); err == nil {
+		t.Fatal("RunOnce with a missing detector succeeded")
+	}
+	if st := s.GetStatus(context.Background()); st.State != "error" || st.Pending != 1 {
+		t.Fatalf("status = %+v, want error with 1 pending", st)
+	}
+}
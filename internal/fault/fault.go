@@ -0,0 +1,44 @@
+// Package fault injects errors and delays at named points in ingest,
+// backup and the database, so the rollback paths that normally run only on
+// a failing card or a busy disk can be exercised on purpose.
+//
+// Injection is compiled in only with -tags faultinject. In a normal build
+// every hook passes straight through and Set does nothing.
+package fault
+
+import (
+	"errors"
+	"time"
+)
+
+// Points where faults can be injected.
+const (
+	MediaRead    = "media.read"    // reading a source file to hash or copy it
+	LibraryWrite = "library.write" // writing a library copy
+	DBWrite      = "db.write"      // recording a media file
+	BackupWrite  = "backup.write"  // writing a snapshot copy
+)
+
+var (
+	// ErrInjected is returned by a rule that names no error of its own.
+	ErrInjected = errors.New("injected fault")
+	// ErrDBBusy reads like the error SQLite returns when another
+	// connection holds the write lock.
+	ErrDBBusy = errors.New("database is locked (5) (SQLITE_BUSY)")
+)
+
+// Rule says how often calls at Point fail or stall.
+type Rule struct {
+	Point     string
+	ErrorRate float64 // chance each call fails, 0 to 1
+	Err       error   // ErrInjected when nil
+	DelayRate float64 // chance each call sleeps first, 0 to 1
+	Delay     time.Duration
+}
+
+// Count is what happened at one point since the last Set.
+type Count struct {
+	Calls  int64 `json:"calls"`
+	Errors int64 `json:"errors"`
+	Delays int64 `json:"delays"`
+}
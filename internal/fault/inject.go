@@ -0,0 +1,122 @@
+//go:build faultinject
+// +build faultinject
+
+package fault
+
+import (
+	"io"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Enabled reports whether faults can be injected in this build.
+const Enabled = true
+
+var (
+	mu     sync.Mutex
+	rules  map[string]Rule
+	counts map[string]*Count
+	rng    = rand.New(rand.NewPCG(1, 1))
+)
+
+// Set replaces the active rules and clears the counters. Decisions are
+// drawn from a generator seeded with seed, though with several goroutines
+// the order calls arrive in still varies between runs.
+func Set(seed uint64, rs ...Rule) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules = make(map[string]Rule, len(rs))
+	for _, r := range rs {
+		rules[r.Point] = r
+	}
+	counts = map[string]*Count{}
+	rng = rand.New(rand.NewPCG(seed, seed^0xfa17))
+}
+
+// Reset turns every rule off. The counters are kept for Stats.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	rules = nil
+}
+
+// Stats returns the counters of each point that was reached.
+func Stats() map[string]Count {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make(map[string]Count, len(counts))
+	for p, c := range counts {
+		out[p] = *c
+	}
+	return out
+}
+
+// Check is called at point before the guarded operation; it may sleep, and
+// returns the error to fail with, if any.
+func Check(point string) error {
+	mu.Lock()
+	r, ok := rules[point]
+	if !ok {
+		mu.Unlock()
+		return nil
+	}
+	c := counts[point]
+	if c == nil {
+		c = &Count{}
+		counts[point] = c
+	}
+	c.Calls++
+	var delay time.Duration
+	if r.DelayRate > 0 && rng.Float64() < r.DelayRate {
+		c.Delays++
+		delay = r.Delay
+	}
+	var err error
+	if r.ErrorRate > 0 && rng.Float64() < r.ErrorRate {
+		c.Errors++
+		if err = r.Err; err == nil {
+			err = ErrInjected
+		}
+	}
+	mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return err
+}
+
+// Reader checks point before each read from r.
+func Reader(point string, r io.Reader) io.Reader {
+	return &reader{point: point, r: r}
+}
+
+// Writer checks point before each write to w.
+func Writer(point string, w io.Writer) io.Writer {
+	return &writer{point: point, w: w}
+}
+
+type reader struct {
+	point string
+	r     io.Reader
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if err := Check(r.point); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+type writer struct {
+	point string
+	w     io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if err := Check(w.point); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
@@ -0,0 +1,30 @@
+//go:build faultinject
+// +build faultinject
+
+package fault
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReaderFailsAtRuleRate(t *testing.T) {
+	Set(1, Rule{Point: MediaRead, ErrorRate: 1})
+	defer Reset()
+	if _, err := io.ReadAll(Reader(MediaRead, strings.NewReader("card"))); !errors.Is(err, ErrInjected) {
+		t.Fatalf("read error = %v", err)
+	}
+	if _, err := Writer(LibraryWrite, &bytes.Buffer{}).Write([]byte("x")); err != nil {
+		t.Fatalf("write at a point without a rule: %v", err)
+	}
+	if got := Stats()[MediaRead]; got.Calls != 1 || got.Errors != 1 {
+		t.Fatalf("stats = %+v", got)
+	}
+	Reset()
+	if err := Check(MediaRead); err != nil {
+		t.Fatalf("check after reset: %v", err)
+	}
+}
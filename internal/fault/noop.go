@@ -0,0 +1,21 @@
+//go:build !faultinject
+// +build !faultinject
+
+package fault
+
+import "io"
+
+// Enabled reports whether faults can be injected in this build.
+const Enabled = false
+
+func Set(seed uint64, rs ...Rule) {}
+
+func Reset() {}
+
+func Stats() map[string]Count { return nil }
+
+func Check(point string) error { return nil }
+
+func Reader(point string, r io.Reader) io.Reader { return r }
+
+func Writer(point string, w io.Writer) io.Writer { return w }
@@ -2,12 +2,12 @@ package geocode
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -78,6 +78,29 @@ func userAgent() string {
 	return "USBVault/0.2 (local reverse geocoder)"
 }
 
+// publicNominatim is the OpenStreetMap Nominatim service, whose usage
+// policy allows at most one request a second.
+const publicNominatim = "https://nominatim.openstreetmap.org/reverse"
+
+const publicMinInterval = 1100 * time.Millisecond
+
+// requestInterval is the least time between lookups, from
+// USBVAULT_GEOCODE_MIN_INTERVAL_MS. The public OpenStreetMap services are
+// never asked faster than their usage policies allow.
+func requestInterval(endpoint string) time.Duration {
+	interval := publicMinInterval
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("USBVAULT_GEOCODE_MIN_INTERVAL_MS"))); err == nil && v >= 0 {
+		interval = time.Duration(v) * time.Millisecond
+	}
+	if endpoint == publicNominatim || endpoint == publicPhoton {
+		interval = max(interval, publicMinInterval)
+	}
+	return interval
+}
+
+// Reverse returns the place at lat, lon from the provider the settings
+// select. Places are cached per provider, so switching providers looks
+// places up again rather than mixing answers.
 func (g *ReverseGeocoder) Reverse(ctx context.Context, lat, lon float64) (*Location, error) {
 	if g == nil {
 		return nil, nil
@@ -85,36 +108,23 @@ func (g *ReverseGeocoder) Reverse(ctx context.Context, lat, lon float64) (*Locat
 	if !Enabled() {
 		return nil, nil
 	}
+	provider, err := CurrentProvider()
+	if err != nil {
+		return nil, err
+	}
 
 	keyLat := round(lat, 3)
 	keyLon := round(lon, 3)
 	geoKey := fmt.Sprintf("%.3f,%.3f", keyLat, keyLon)
-	provider := "nominatim"
 
-	if cached, ok, err := g.store.GetGeocodeCache(ctx, provider, geoKey); err == nil && ok && cached != nil {
-		loc := &Location{
-			Provider:     cached.Provider,
-			Country:      cached.Country,
-			State:        cached.State,
-			County:       cached.County,
-			City:         cached.City,
-			Road:         cached.Road,
-			HouseNumber:  cached.HouseNumber,
-			Postcode:     cached.Postcode,
-			DisplayName:  cached.DisplayName,
-			RawJSON:      cached.RawJSON,
-			GeocodeKey:   cached.GeocodeKey,
-			GeocodeLat:   keyLat,
-			GeocodeLon:   keyLon,
-			RequestedLat: lat,
-			RequestedLon: lon,
-		}
+	if loc := g.cached(ctx, provider.Name(), geoKey, lat, lon, keyLat, keyLon); loc != nil {
 		return loc, nil
 	}
 
-	// Coalesce concurrent requests per key.
+	// Coalesce concurrent requests per provider and key.
+	callKey := provider.Name() + "|" + geoKey
 	g.inflightMu.Lock()
-	if call, exists := g.inflight[geoKey]; exists {
+	if call, exists := g.inflight[callKey]; exists {
 		g.inflightMu.Unlock()
 		select {
 		case <-ctx.Done():
@@ -124,104 +134,64 @@ func (g *ReverseGeocoder) Reverse(ctx context.Context, lat, lon float64) (*Locat
 		}
 	}
 	call := &inflightCall{done: make(chan struct{})}
-	g.inflight[geoKey] = call
+	g.inflight[callKey] = call
 	g.inflightMu.Unlock()
 
-	loc, err := g.reverseNominatim(ctx, lat, lon, keyLat, keyLon, geoKey)
+	loc, err := g.lookup(ctx, provider, lat, lon, keyLat, keyLon, geoKey)
 	call.loc = loc
 	call.err = err
 	close(call.done)
 
 	g.inflightMu.Lock()
-	delete(g.inflight, geoKey)
+	delete(g.inflight, callKey)
 	g.inflightMu.Unlock()
 
 	return loc, err
 }
 
-func (g *ReverseGeocoder) reverseNominatim(ctx context.Context, lat, lon, keyLat, keyLon float64, geoKey string) (*Location, error) {
-	// Respect Nominatim usage policy (keep it slow, cached).
-	g.rateMu.Lock()
-	minInterval := 1100 * time.Millisecond
-	if wait := time.Until(g.nextAt); wait > 0 {
-		timer := time.NewTimer(wait)
-		g.rateMu.Unlock()
-		select {
-		case <-ctx.Done():
-			timer.Stop()
-			return nil, ctx.Err()
-		case <-timer.C:
-		}
-		g.rateMu.Lock()
-	}
-	g.nextAt = time.Now().Add(minInterval)
-	g.rateMu.Unlock()
-
-	url := fmt.Sprintf("https://nominatim.openstreetmap.org/reverse?format=jsonv2&lat=%.8f&lon=%.8f&zoom=18&addressdetails=1", lat, lon)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("User-Agent", userAgent())
-
-	resp, err := g.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("geocoder status: %s", resp.Status)
-	}
-
-	var parsed struct {
-		DisplayName string                 `json:"display_name"`
-		Address     map[string]any         `json:"address"`
-		Extra       map[string]interface{} `json:"-"`
-	}
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&parsed); err != nil {
-		return nil, err
-	}
-
-	addr := parsed.Address
-	get := func(key string) string {
-		v, ok := addr[key]
-		if !ok || v == nil {
-			return ""
-		}
-		s, _ := v.(string)
-		return strings.TrimSpace(s)
+// cached returns the place a provider gave for geoKey before, or nil.
+func (g *ReverseGeocoder) cached(ctx context.Context, provider, geoKey string, lat, lon, keyLat, keyLon float64) *Location {
+	cached, ok, err := g.store.GetGeocodeCache(ctx, provider, geoKey)
+	if err != nil || !ok || cached == nil {
+		return nil
 	}
-
-	city := firstNonEmpty(get("city"), get("town"), get("village"), get("hamlet"), get("municipality"))
-	loc := &Location{
-		Provider:     "nominatim",
-		Country:      get("country"),
-		State:        get("state"),
-		County:       get("county"),
-		City:         city,
-		Road:         get("road"),
-		HouseNumber:  get("house_number"),
-		Postcode:     get("postcode"),
-		DisplayName:  strings.TrimSpace(parsed.DisplayName),
-		GeocodeKey:   geoKey,
+	return &Location{
+		Provider:     cached.Provider,
+		Country:      cached.Country,
+		State:        cached.State,
+		County:       cached.County,
+		City:         cached.City,
+		Road:         cached.Road,
+		HouseNumber:  cached.HouseNumber,
+		Postcode:     cached.Postcode,
+		DisplayName:  cached.DisplayName,
+		RawJSON:      cached.RawJSON,
+		GeocodeKey:   cached.GeocodeKey,
 		GeocodeLat:   keyLat,
 		GeocodeLon:   keyLon,
 		RequestedLat: lat,
 		RequestedLon: lon,
 	}
+}
 
-	// Store raw JSON for debugging (bounded size).
-	rawObj := map[string]any{
-		"display_name": parsed.DisplayName,
-		"address":      parsed.Address,
-	}
-	if b, err := json.Marshal(rawObj); err == nil {
-		if len(b) > 64*1024 {
-			loc.RawJSON = string(b[:64*1024])
-		} else {
-			loc.RawJSON = string(b)
+func (g *ReverseGeocoder) lookup(ctx context.Context, provider Provider, lat, lon, keyLat, keyLon float64, geoKey string) (*Location, error) {
+	loc, err := g.ask(ctx, provider, lat, lon)
+	if off, ok := provider.(offline); ok && errors.Is(err, errNoPlace) && off.fallback != nil {
+		// Places outside the dataset were answered online before.
+		if loc := g.cached(ctx, off.fallback.Name(), geoKey, lat, lon, keyLat, keyLon); loc != nil {
+			return loc, nil
 		}
+		loc, err = g.ask(ctx, off.fallback, lat, lon)
+	}
+	if err != nil {
+		return nil, err
+	}
+	loc.GeocodeKey = geoKey
+	loc.GeocodeLat, loc.GeocodeLon = keyLat, keyLon
+	loc.RequestedLat, loc.RequestedLon = lat, lon
+	if loc.Provider == "offline" {
+		// Local answers are not cached, so a new dataset takes effect.
+		return loc, nil
 	}
 
 	if err := g.store.UpsertGeocodeCache(ctx, &db.GeocodeCacheEntry{
@@ -243,6 +213,34 @@ func (g *ReverseGeocoder) reverseNominatim(ctx context.Context, lat, lon, keyLat
 	return loc, nil
 }
 
+// ask looks lat, lon up with one provider, keeping to the request
+// interval for online ones.
+func (g *ReverseGeocoder) ask(ctx context.Context, provider Provider, lat, lon float64) (*Location, error) {
+	if endpoint := provider.Endpoint(); endpoint != "" {
+		g.rateMu.Lock()
+		minInterval := requestInterval(endpoint)
+		if wait := time.Until(g.nextAt); wait > 0 {
+			timer := time.NewTimer(wait)
+			g.rateMu.Unlock()
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+			g.rateMu.Lock()
+		}
+		g.nextAt = time.Now().Add(minInterval)
+		g.rateMu.Unlock()
+	}
+	loc, err := provider.Lookup(ctx, g.client, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	loc.Provider = provider.Name()
+	return loc, nil
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if strings.TrimSpace(v) != "" {
@@ -0,0 +1,285 @@
+package geocode
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The offline provider answers from a dataset of populated places in a
+// SQLite file, built from GeoNames extracts by usbvault-geodata, so
+// location folders work on a vault with no internet. It knows the
+// country, state, county and city, never the road. A position with no
+// place near it is passed to Nominatim when one can be reached.
+const (
+	// offlineRadiusKm is how far the nearest place may be for its
+	// country, state and county to be used.
+	offlineRadiusKm = 50
+	// offlineCityKm is how far it may be to also be the city.
+	offlineCityKm = 10
+)
+
+// errNoPlace is the offline answer for a position with no place near it.
+var errNoPlace = errors.New("no place in the offline dataset near this position")
+
+// offlineSchema is the dataset layout; user_version marks the format.
+const offlineSchema = `
+PRAGMA user_version = 1;
+CREATE TABLE places (
+	name TEXT NOT NULL,
+	county TEXT NOT NULL DEFAULT '',
+	state TEXT NOT NULL DEFAULT '',
+	country TEXT NOT NULL DEFAULT '',
+	lat REAL NOT NULL,
+	lon REAL NOT NULL
+);`
+
+type offline struct {
+	path string
+	// fallback is asked when the dataset has no answer; nil when
+	// USBVAULT_GEOCODE_FALLBACK is off.
+	fallback Provider
+}
+
+func (offline) Name() string { return "offline" }
+
+// Endpoint is empty: the dataset is local and is not rate limited.
+func (offline) Endpoint() string { return "" }
+
+// datasets keeps the open dataset, so each lookup does not reopen it.
+var datasets struct {
+	sync.Mutex
+	path string
+	db   *sql.DB
+}
+
+func openDataset(path string) (*sql.DB, error) {
+	datasets.Lock()
+	defer datasets.Unlock()
+	if datasets.db != nil && datasets.path == path {
+		return datasets.db, nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("%w: offline dataset: %v", ErrUnavailable, err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	slashed := filepath.ToSlash(abs)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed // a Windows drive letter
+	}
+	db, err := sql.Open("sqlite", (&url.URL{Scheme: "file", Path: slashed}).String()+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil || version != 1 {
+		_ = db.Close()
+		return nil, fmt.Errorf("%w: %s is not an offline geocoding dataset", ErrUnavailable, path)
+	}
+	if datasets.db != nil {
+		_ = datasets.db.Close()
+	}
+	datasets.path, datasets.db = path, db
+	return db, nil
+}
+
+func (p offline) Lookup(ctx context.Context, _ *http.Client, lat, lon float64) (*Location, error) {
+	db, err := openDataset(p.path)
+	if err != nil {
+		return nil, err
+	}
+	dLat := offlineRadiusKm / 111.0
+	dLon := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+	rows, err := db.QueryContext(ctx, `
+		SELECT name, county, state, country, lat, lon FROM places
+		WHERE lat BETWEEN ? AND ? AND lon BETWEEN ? AND ?`,
+		lat-dLat, lat+dLat, lon-dLon, lon+dLon)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var (
+		best offlinePlace
+		dist = math.Inf(1)
+	)
+	for rows.Next() {
+		var pl offlinePlace
+		if err := rows.Scan(&pl.Name, &pl.County, &pl.State, &pl.Country, &pl.Lat, &pl.Lon); err != nil {
+			return nil, err
+		}
+		if d := distanceKm(lat, lon, pl.Lat, pl.Lon); d < dist {
+			best, dist = pl, d
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if dist > offlineRadiusKm {
+		return nil, errNoPlace
+	}
+	loc := &Location{Country: best.Country, State: best.State, County: best.County}
+	if dist <= offlineCityKm {
+		loc.City = best.Name
+	}
+	var parts []string
+	for _, v := range []string{loc.City, loc.County, loc.State, loc.Country} {
+		if v != "" {
+			parts = append(parts, v)
+		}
+	}
+	loc.DisplayName = strings.Join(parts, ", ")
+	loc.RawJSON = rawJSON(map[string]any{"place": best, "distance_km": math.Round(dist*10) / 10})
+	return loc, nil
+}
+
+type offlinePlace struct {
+	Name    string  `json:"name"`
+	County  string  `json:"county,omitempty"`
+	State   string  `json:"state,omitempty"`
+	Country string  `json:"country,omitempty"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+}
+
+// distanceKm is the great-circle distance between two positions.
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthKm = 6371.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// GeoNames are the GeoNames extracts an offline dataset is built from, as
+// published at download.geonames.org/export/dump: a cities file such as
+// cities500.txt, admin1CodesASCII.txt, admin2Codes.txt and countryInfo.txt.
+type GeoNames struct {
+	Cities, Admin1, Admin2, Countries io.Reader
+}
+
+// BuildDataset writes an offline dataset to path from the GeoNames
+// extracts and returns how many places it holds. The file is replaced
+// only once it is complete.
+func BuildDataset(ctx context.Context, path string, src GeoNames) (int, error) {
+	names := func(r io.Reader, keyCol, nameCol int) (map[string]string, error) {
+		out := map[string]string{}
+		err := eachRow(r, func(cols []string) error {
+			if len(cols) > max(keyCol, nameCol) {
+				out[cols[keyCol]] = strings.TrimSpace(cols[nameCol])
+			}
+			return nil
+		})
+		return out, err
+	}
+	admin1, err := names(src.Admin1, 0, 1)
+	if err != nil {
+		return 0, fmt.Errorf("admin1 codes: %w", err)
+	}
+	admin2, err := names(src.Admin2, 0, 1)
+	if err != nil {
+		return 0, fmt.Errorf("admin2 codes: %w", err)
+	}
+	countries, err := names(src.Countries, 0, 4)
+	if err != nil {
+		return 0, fmt.Errorf("country info: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	_ = os.Remove(tmp)
+	db, err := sql.Open("sqlite", tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, offlineSchema); err != nil {
+		return 0, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO places(name, county, state, country, lat, lon) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	n := 0
+	err = eachRow(src.Cities, func(cols []string) error {
+		// geonameid, name, asciiname, alternatenames, latitude, longitude,
+		// feature class, feature code, country code, cc2, admin1, admin2, ...
+		if len(cols) < 12 {
+			return nil
+		}
+		lat, err1 := strconv.ParseFloat(cols[4], 64)
+		lon, err2 := strconv.ParseFloat(cols[5], 64)
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		cc := cols[8]
+		country := firstNonEmpty(countries[cc], cc)
+		state := admin1[cc+"."+cols[10]]
+		county := admin2[cc+"."+cols[10]+"."+cols[11]]
+		if _, err := stmt.ExecContext(ctx, strings.TrimSpace(cols[1]), county, state, country, lat, lon); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cities: %w", err)
+	}
+	if n == 0 {
+		return 0, errors.New("cities: no places read")
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE INDEX places_lat_lon ON places(lat, lon)`); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if err := db.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// eachRow calls fn with the tab-separated columns of each line of r,
+// skipping blank lines and # comments.
+func eachRow(r io.Reader, fn func(cols []string) error) error {
+	if r == nil {
+		return errors.New("missing")
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(strings.Split(line, "\t")); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,90 @@
+package geocode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func TestOffline(t *testing.T) {
+	dir := t.TempDir()
+	dataset := filepath.Join(dir, "geodata.sqlite")
+	src := GeoNames{
+		Cities: strings.NewReader(strings.Join([]string{
+			"5419384\tDenver\tDenver\t\t39.73915\t-104.9847\tP\tPPLA\tUS\t\tCO\t031\t\t\t715522",
+			"5576882\tFort Collins\tFort Collins\t\t40.58526\t-105.08442\tP\tPPL\tUS\t\tCO\t069\t\t\t170243",
+		}, "\n")),
+		Admin1:    strings.NewReader("US.CO\tColorado\tColorado\t5417618\n"),
+		Admin2:    strings.NewReader("US.CO.031\tDenver County\tDenver County\t5419396\nUS.CO.069\tLarimer County\tLarimer County\t5577592\n"),
+		Countries: strings.NewReader("#ISO\tISO3\tISO-Numeric\tfips\tCountry\nUS\tUSA\t840\tUS\tUnited States\n"),
+	}
+	if n, err := BuildDataset(context.Background(), dataset, src); err != nil || n != 2 {
+		t.Fatalf("build: %d places, %v", n, err)
+	}
+
+	var asked int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked++
+		w.Write([]byte(`{"display_name":"Pacific Ocean","address":{"country":"Ocean"}}`))
+	}))
+	defer srv.Close()
+	t.Setenv("USBVAULT_REVERSE_GEOCODE", "1")
+	t.Setenv("USBVAULT_GEOCODE_PROVIDER", "offline")
+	t.Setenv("USBVAULT_GEOCODE_OFFLINE_DB", dataset)
+	t.Setenv("USBVAULT_GEOCODE_URL", srv.URL)
+	t.Setenv("USBVAULT_GEOCODE_MIN_INTERVAL_MS", "0")
+
+	store, err := db.Open(filepath.Join(dir, "usbvault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	g := New(store)
+	ctx := context.Background()
+
+	// In town: every field, from the dataset.
+	loc, err := g.Reverse(ctx, 39.75, -104.99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Provider != "offline" || loc.City != "Denver" || loc.County != "Denver County" || loc.State != "Colorado" || loc.Country != "United States" {
+		t.Fatalf("Denver: got %+v", loc)
+	}
+	// 30 km out: the county and state, but no city.
+	loc, err = g.Reverse(ctx, 40.85, -105.08)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.City != "" || loc.County != "Larimer County" || loc.State != "Colorado" {
+		t.Fatalf("north of Fort Collins: got %+v", loc)
+	}
+	if asked != 0 {
+		t.Fatalf("asked Nominatim %d times about places in the dataset", asked)
+	}
+
+	// Nowhere near a place: Nominatim answers, unless turned off.
+	loc, err = g.Reverse(ctx, 10, -140)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asked != 1 || loc.Provider != "nominatim" || loc.Country != "Ocean" {
+		t.Fatalf("fallback: asked %d, got %+v", asked, loc)
+	}
+	// Asked again, the fallback's answer comes from its cache.
+	loc, err = g.Reverse(ctx, 10, -140)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asked != 1 || loc.Provider != "nominatim" || loc.Country != "Ocean" {
+		t.Fatalf("cached fallback: asked %d, got %+v", asked, loc)
+	}
+	t.Setenv("USBVAULT_GEOCODE_FALLBACK", "0")
+	if _, err := g.Reverse(ctx, -10, -140); err == nil || asked != 1 {
+		t.Fatalf("without fallback: asked %d, err %v", asked, err)
+	}
+}
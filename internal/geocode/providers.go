@@ -0,0 +1,310 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Provider is a reverse geocoding service. USBVAULT_GEOCODE_PROVIDER picks
+// one: nominatim (the default), photon, google, mapbox or offline. Google
+// and Mapbox need USBVAULT_GEOCODE_API_KEY, offline needs the dataset in
+// USBVAULT_GEOCODE_OFFLINE_DB, and USBVAULT_GEOCODE_URL points the others
+// at another endpoint, such as a self-hosted Nominatim or Photon.
+type Provider interface {
+	// Name is recorded with each place the provider finds.
+	Name() string
+	// Endpoint is the URL lookups go to, or empty for a local dataset.
+	Endpoint() string
+	// Lookup returns the address at lat, lon, with no location fields
+	// set when there is none.
+	Lookup(ctx context.Context, client *http.Client, lat, lon float64) (*Location, error)
+}
+
+const (
+	publicPhoton = "https://photon.komoot.io/reverse"
+	googleURL    = "https://maps.googleapis.com/maps/api/geocode/json"
+	mapboxURL    = "https://api.mapbox.com/search/geocode/v6/reverse"
+)
+
+// maxRawJSON bounds the response kept with each cached place.
+const maxRawJSON = 64 * 1024
+
+// CurrentProvider returns the provider the settings select. They are read
+// on every call, so a reload takes effect with the next lookup.
+func CurrentProvider() (Provider, error) {
+	endpoint := func(def string) string {
+		if v := strings.TrimSpace(os.Getenv("USBVAULT_GEOCODE_URL")); v != "" {
+			return strings.TrimRight(v, "?")
+		}
+		return def
+	}
+	key := strings.TrimSpace(os.Getenv("USBVAULT_GEOCODE_API_KEY"))
+	switch name := strings.ToLower(strings.TrimSpace(os.Getenv("USBVAULT_GEOCODE_PROVIDER"))); name {
+	case "", "nominatim":
+		return nominatim{endpoint: endpoint(publicNominatim)}, nil
+	case "photon":
+		return photon{endpoint: endpoint(publicPhoton)}, nil
+	case "google":
+		if key == "" {
+			return nil, fmt.Errorf("%w: the google provider needs USBVAULT_GEOCODE_API_KEY", ErrUnavailable)
+		}
+		return google{endpoint: endpoint(googleURL), key: key}, nil
+	case "mapbox":
+		if key == "" {
+			return nil, fmt.Errorf("%w: the mapbox provider needs USBVAULT_GEOCODE_API_KEY", ErrUnavailable)
+		}
+		return mapbox{endpoint: endpoint(mapboxURL), key: key}, nil
+	case "offline":
+		path := strings.TrimSpace(os.Getenv("USBVAULT_GEOCODE_OFFLINE_DB"))
+		if path == "" {
+			return nil, fmt.Errorf("%w: the offline provider needs USBVAULT_GEOCODE_OFFLINE_DB", ErrUnavailable)
+		}
+		p := offline{path: path}
+		if fallbackEnabled() {
+			p.fallback = nominatim{endpoint: endpoint(publicNominatim)}
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown USBVAULT_GEOCODE_PROVIDER %q", ErrUnavailable, name)
+	}
+}
+
+// fallbackEnabled reports whether the offline provider may ask Nominatim
+// about positions its dataset has no place near. USBVAULT_GEOCODE_FALLBACK
+// turns that off, so an air-gapped vault never tries the network.
+func fallbackEnabled() bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("USBVAULT_GEOCODE_FALLBACK")))
+	return v != "0" && v != "false" && v != "no" && v != "off"
+}
+
+// getJSON fetches rawURL and decodes the answer into out.
+func getJSON(ctx context.Context, client *http.Client, rawURL string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("geocoder status: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// rawJSON is v as kept for debugging, cut to maxRawJSON.
+func rawJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	if len(b) > maxRawJSON {
+		b = b[:maxRawJSON]
+	}
+	return string(b)
+}
+
+type nominatim struct{ endpoint string }
+
+func (nominatim) Name() string       { return "nominatim" }
+func (p nominatim) Endpoint() string { return p.endpoint }
+
+func (p nominatim) Lookup(ctx context.Context, client *http.Client, lat, lon float64) (*Location, error) {
+	var parsed struct {
+		DisplayName string         `json:"display_name"`
+		Address     map[string]any `json:"address"`
+	}
+	rawURL := fmt.Sprintf("%s?format=jsonv2&lat=%.8f&lon=%.8f&zoom=18&addressdetails=1", p.endpoint, lat, lon)
+	if err := getJSON(ctx, client, rawURL, &parsed); err != nil {
+		return nil, err
+	}
+	get := func(key string) string {
+		s, _ := parsed.Address[key].(string)
+		return strings.TrimSpace(s)
+	}
+	return &Location{
+		Country:     get("country"),
+		State:       get("state"),
+		County:      get("county"),
+		City:        firstNonEmpty(get("city"), get("town"), get("village"), get("hamlet"), get("municipality")),
+		Road:        get("road"),
+		HouseNumber: get("house_number"),
+		Postcode:    get("postcode"),
+		DisplayName: strings.TrimSpace(parsed.DisplayName),
+		RawJSON:     rawJSON(map[string]any{"display_name": parsed.DisplayName, "address": parsed.Address}),
+	}, nil
+}
+
+// photon is Komoot's Photon, an OpenStreetMap geocoder often self-hosted
+// next to Nominatim.
+type photon struct{ endpoint string }
+
+func (photon) Name() string       { return "photon" }
+func (p photon) Endpoint() string { return p.endpoint }
+
+func (p photon) Lookup(ctx context.Context, client *http.Client, lat, lon float64) (*Location, error) {
+	var parsed struct {
+		Features []struct {
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	rawURL := fmt.Sprintf("%s?lat=%.8f&lon=%.8f&limit=1", p.endpoint, lat, lon)
+	if err := getJSON(ctx, client, rawURL, &parsed); err != nil {
+		return nil, err
+	}
+	if len(parsed.Features) == 0 {
+		return &Location{}, nil
+	}
+	props := parsed.Features[0].Properties
+	get := func(key string) string {
+		s, _ := props[key].(string)
+		return strings.TrimSpace(s)
+	}
+	loc := &Location{
+		Country:     get("country"),
+		State:       get("state"),
+		County:      get("county"),
+		City:        firstNonEmpty(get("city"), get("town"), get("village"), get("locality")),
+		Road:        get("street"),
+		HouseNumber: get("housenumber"),
+		Postcode:    get("postcode"),
+		RawJSON:     rawJSON(props),
+	}
+	// Photon has no display name; build one the way Nominatim reads.
+	var parts []string
+	for _, v := range []string{get("name"), strings.TrimSpace(loc.HouseNumber + " " + loc.Road), loc.City, loc.County, loc.State, loc.Postcode, loc.Country} {
+		if v != "" && (len(parts) == 0 || parts[len(parts)-1] != v) {
+			parts = append(parts, v)
+		}
+	}
+	loc.DisplayName = strings.Join(parts, ", ")
+	return loc, nil
+}
+
+type google struct{ endpoint, key string }
+
+func (google) Name() string       { return "google" }
+func (p google) Endpoint() string { return p.endpoint }
+
+func (p google) Lookup(ctx context.Context, client *http.Client, lat, lon float64) (*Location, error) {
+	var parsed struct {
+		Status       string `json:"status"`
+		ErrorMessage string `json:"error_message"`
+		Results      []struct {
+			FormattedAddress  string `json:"formatted_address"`
+			AddressComponents []struct {
+				LongName string   `json:"long_name"`
+				Types    []string `json:"types"`
+			} `json:"address_components"`
+		} `json:"results"`
+	}
+	q := url.Values{"latlng": {fmt.Sprintf("%.8f,%.8f", lat, lon)}, "key": {p.key}}
+	if err := getJSON(ctx, client, p.endpoint+"?"+q.Encode(), &parsed); err != nil {
+		return nil, err
+	}
+	switch parsed.Status {
+	case "OK", "ZERO_RESULTS":
+		if len(parsed.Results) == 0 {
+			return &Location{}, nil
+		}
+	default:
+		return nil, fmt.Errorf("google geocoder: %s %s", parsed.Status, parsed.ErrorMessage)
+	}
+	res := parsed.Results[0]
+	get := func(kind string) string {
+		for _, c := range res.AddressComponents {
+			for _, t := range c.Types {
+				if t == kind {
+					return strings.TrimSpace(c.LongName)
+				}
+			}
+		}
+		return ""
+	}
+	return &Location{
+		Country:     get("country"),
+		State:       get("administrative_area_level_1"),
+		County:      get("administrative_area_level_2"),
+		City:        firstNonEmpty(get("locality"), get("postal_town"), get("sublocality"), get("administrative_area_level_3")),
+		Road:        get("route"),
+		HouseNumber: get("street_number"),
+		Postcode:    get("postal_code"),
+		DisplayName: strings.TrimSpace(res.FormattedAddress),
+		RawJSON:     rawJSON(res),
+	}, nil
+}
+
+type mapbox struct{ endpoint, key string }
+
+func (mapbox) Name() string       { return "mapbox" }
+func (p mapbox) Endpoint() string { return p.endpoint }
+
+func (p mapbox) Lookup(ctx context.Context, client *http.Client, lat, lon float64) (*Location, error) {
+	type named struct {
+		Name string `json:"name"`
+	}
+	var parsed struct {
+		Features []struct {
+			Properties struct {
+				FullAddress string `json:"full_address"`
+				Context     struct {
+					Address *struct {
+						AddressNumber string `json:"address_number"`
+						StreetName    string `json:"street_name"`
+					} `json:"address"`
+					Street   *named `json:"street"`
+					Postcode *named `json:"postcode"`
+					Place    *named `json:"place"`
+					Locality *named `json:"locality"`
+					District *named `json:"district"`
+					Region   *named `json:"region"`
+					Country  *named `json:"country"`
+				} `json:"context"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	q := url.Values{
+		"longitude":    {fmt.Sprintf("%.8f", lon)},
+		"latitude":     {fmt.Sprintf("%.8f", lat)},
+		"access_token": {p.key},
+		"limit":        {"1"},
+	}
+	if err := getJSON(ctx, client, p.endpoint+"?"+q.Encode(), &parsed); err != nil {
+		return nil, err
+	}
+	if len(parsed.Features) == 0 {
+		return &Location{}, nil
+	}
+	props := parsed.Features[0].Properties
+	c := props.Context
+	name := func(n *named) string {
+		if n == nil {
+			return ""
+		}
+		return strings.TrimSpace(n.Name)
+	}
+	loc := &Location{
+		Country: name(c.Country),
+		State:   name(c.Region),
+		// In the US a Mapbox district is the county.
+		County:      name(c.District),
+		City:        firstNonEmpty(name(c.Place), name(c.Locality)),
+		Road:        name(c.Street),
+		Postcode:    name(c.Postcode),
+		DisplayName: strings.TrimSpace(props.FullAddress),
+		RawJSON:     rawJSON(props),
+	}
+	if c.Address != nil {
+		loc.HouseNumber = strings.TrimSpace(c.Address.AddressNumber)
+		loc.Road = firstNonEmpty(loc.Road, c.Address.StreetName)
+	}
+	return loc, nil
+}
@@ -0,0 +1,66 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProviders(t *testing.T) {
+	responses := map[string]string{
+		"nominatim": `{"display_name":"1 Main St, Denver","address":{"road":"Main St","house_number":"1","town":"Denver","county":"Denver County","state":"Colorado","country":"United States","postcode":"80202"}}`,
+		"photon":    `{"features":[{"properties":{"street":"Main St","housenumber":"1","city":"Denver","county":"Denver County","state":"Colorado","country":"United States","postcode":"80202"}}]}`,
+		"google":    `{"status":"OK","results":[{"formatted_address":"1 Main St, Denver, CO 80202, USA","address_components":[{"long_name":"1","types":["street_number"]},{"long_name":"Main St","types":["route"]},{"long_name":"Denver","types":["locality","political"]},{"long_name":"Denver County","types":["administrative_area_level_2"]},{"long_name":"Colorado","types":["administrative_area_level_1"]},{"long_name":"United States","types":["country"]},{"long_name":"80202","types":["postal_code"]}]}]}`,
+		"mapbox":    `{"features":[{"properties":{"full_address":"1 Main St, Denver, Colorado 80202, United States","context":{"address":{"address_number":"1","street_name":"Main St"},"postcode":{"name":"80202"},"place":{"name":"Denver"},"district":{"name":"Denver County"},"region":{"name":"Colorado"},"country":{"name":"United States"}}}}]}`,
+	}
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	t.Setenv("USBVAULT_GEOCODE_URL", srv.URL)
+	t.Setenv("USBVAULT_GEOCODE_API_KEY", "k")
+
+	for name, resp := range responses {
+		t.Setenv("USBVAULT_GEOCODE_PROVIDER", name)
+		p, err := CurrentProvider()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if p.Name() != name || p.Endpoint() != srv.URL {
+			t.Fatalf("%s: got provider %s at %s", name, p.Name(), p.Endpoint())
+		}
+		body = resp
+		loc, err := p.Lookup(context.Background(), srv.Client(), 39.75, -104.99)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if loc.Road != "Main St" || loc.HouseNumber != "1" || loc.City != "Denver" || loc.County != "Denver County" ||
+			loc.State != "Colorado" || loc.Country != "United States" || loc.Postcode != "80202" || loc.DisplayName == "" {
+			t.Fatalf("%s: got %+v", name, loc)
+		}
+	}
+
+	// An OK with no results is nowhere in particular, as ZERO_RESULTS is.
+	t.Setenv("USBVAULT_GEOCODE_PROVIDER", "google")
+	p, err := CurrentProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = `{"status":"OK","results":[]}`
+	if loc, err := p.Lookup(context.Background(), srv.Client(), 10, -140); err != nil || *loc != (Location{}) {
+		t.Fatalf("google with no results: got %+v, %v", loc, err)
+	}
+
+	t.Setenv("USBVAULT_GEOCODE_API_KEY", "")
+	t.Setenv("USBVAULT_GEOCODE_PROVIDER", "mapbox")
+	if _, err := CurrentProvider(); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("mapbox without a key: got %v", err)
+	}
+	t.Setenv("USBVAULT_GEOCODE_PROVIDER", "bing")
+	if _, err := CurrentProvider(); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("unknown provider: got %v", err)
+	}
+}
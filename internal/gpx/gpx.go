@@ -0,0 +1,129 @@
+// Package gpx reads GPS tracks from GPX files and places a moment in time
+// on them, so media from cameras without GPS, such as most action cams,
+// can be located from a phone or watch recording of the same trip.
+package gpx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Point is one timed fix of a track.
+type Point struct {
+	Time   time.Time
+	Lat    float64
+	Lon    float64
+	Ele    float64
+	HasEle bool
+}
+
+// Track is every timed point of a GPX file, in time order.
+type Track struct {
+	Name   string
+	Points []Point
+}
+
+// ErrNoPoints is returned for a file without any timed track point.
+var ErrNoPoints = errors.New("gpx file has no timed track points")
+
+type gpxFile struct {
+	Metadata struct {
+		Name string `xml:"name"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele"`
+	Time string   `xml:"time"`
+}
+
+// Parse reads the track points of every track and segment in a GPX file.
+// Points without a time cannot be matched to media and are left out, as
+// are points outside the valid coordinate range.
+func Parse(r io.Reader) (*Track, error) {
+	var f gpxFile
+	if err := xml.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid gpx: %w", err)
+	}
+	t := &Track{Name: strings.TrimSpace(f.Metadata.Name)}
+	for _, trk := range f.Tracks {
+		if t.Name == "" {
+			t.Name = strings.TrimSpace(trk.Name)
+		}
+		for _, seg := range trk.Segments {
+			for _, p := range seg.Points {
+				at, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(p.Time))
+				if err != nil || p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 {
+					continue
+				}
+				pt := Point{Time: at.UTC(), Lat: p.Lat, Lon: p.Lon}
+				if p.Ele != nil {
+					pt.Ele, pt.HasEle = *p.Ele, true
+				}
+				t.Points = append(t.Points, pt)
+			}
+		}
+	}
+	if len(t.Points) == 0 {
+		return nil, ErrNoPoints
+	}
+	sort.SliceStable(t.Points, func(i, j int) bool { return t.Points[i].Time.Before(t.Points[j].Time) })
+	return t, nil
+}
+
+// Start and End are the times of the first and last point.
+func (t *Track) Start() time.Time { return t.Points[0].Time }
+func (t *Track) End() time.Time   { return t.Points[len(t.Points)-1].Time }
+
+// Locate returns where the track was at a moment: the point recorded then,
+// or a position interpolated between the points either side. A moment
+// outside the track, or in a gap of more than maxGap between two points
+// (the receiver lost its fix, or recording was paused), has no position.
+func (t *Track) Locate(at time.Time, maxGap time.Duration) (lat, lon float64, ok bool) {
+	pts := t.Points
+	i := sort.Search(len(pts), func(i int) bool { return !pts[i].Time.Before(at) })
+	if i == len(pts) {
+		return 0, 0, false
+	}
+	if pts[i].Time.Equal(at) {
+		return pts[i].Lat, pts[i].Lon, true
+	}
+	if i == 0 {
+		return 0, 0, false
+	}
+	a, b := pts[i-1], pts[i]
+	span := b.Time.Sub(a.Time)
+	if span > maxGap {
+		return 0, 0, false
+	}
+	f := float64(at.Sub(a.Time)) / float64(span)
+	lon = a.Lon + (b.Lon-a.Lon)*f
+	// Across the antimeridian, go the short way round.
+	if d := b.Lon - a.Lon; d > 180 || d < -180 {
+		if d > 180 {
+			d -= 360
+		} else {
+			d += 360
+		}
+		lon = a.Lon + d*f
+		if lon > 180 {
+			lon -= 360
+		} else if lon < -180 {
+			lon += 360
+		}
+	}
+	return a.Lat + (b.Lat-a.Lat)*f, lon, true
+}
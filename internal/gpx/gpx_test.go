@@ -0,0 +1,90 @@
+package gpx
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk><name>Morning ride</name>
+    <trkseg>
+      <trkpt lat="45.0" lon="-122.0"><ele>100</ele><time>2026-06-01T10:00:00Z</time></trkpt>
+      <trkpt lat="45.1" lon="-122.2"><time>2026-06-01T10:01:00Z</time></trkpt>
+      <trkpt lat="46.0" lon="-121.0"></trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="45.5" lon="-122.5"><time>2026-06-01T12:01:00+02:00</time></trkpt>
+      <trkpt lat="45.3" lon="-122.3"><time>2026-06-01T10:30:00Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+func TestParseAndLocate(t *testing.T) {
+	track, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if track.Name != "Morning ride" || len(track.Points) != 4 {
+		t.Fatalf("track = %q with %d points, want 4 timed points", track.Name, len(track.Points))
+	}
+	if !track.Points[0].HasEle || track.Points[0].Ele != 100 || track.Points[1].HasEle {
+		t.Fatalf("elevations = %+v", track.Points[:2])
+	}
+	// Segments are merged in time order; 12:01+02:00 is 10:01 UTC.
+	if !track.End().Equal(time.Date(2026, 6, 1, 10, 30, 0, 0, time.UTC)) {
+		t.Fatalf("end = %v", track.End())
+	}
+
+	at := func(clock string) time.Time {
+		tm, err := time.Parse(time.RFC3339, "2026-06-01T"+clock+"Z")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	cases := []struct {
+		clock    string
+		lat, lon float64
+		ok       bool
+	}{
+		{"10:00:00", 45.0, -122.0, true},
+		{"10:00:30", 45.05, -122.1, true},
+		{"09:59:59", 0, 0, false},
+		{"10:30:01", 0, 0, false},
+		// 10:01 to 10:30 is longer than the allowed gap.
+		{"10:15:00", 0, 0, false},
+		{"10:30:00", 45.3, -122.3, true},
+	}
+	for _, tc := range cases {
+		lat, lon, ok := track.Locate(at(tc.clock), 5*time.Minute)
+		if ok != tc.ok || math.Abs(lat-tc.lat) > 1e-9 || math.Abs(lon-tc.lon) > 1e-9 {
+			t.Errorf("Locate(%s) = %v, %v, %v; want %v, %v, %v", tc.clock, lat, lon, ok, tc.lat, tc.lon, tc.ok)
+		}
+	}
+}
+
+func TestLocateAcrossAntimeridian(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	track := &Track{Points: []Point{
+		{Time: start, Lat: -17, Lon: 179},
+		{Time: start.Add(time.Minute), Lat: -17, Lon: -179},
+	}}
+	_, lon, ok := track.Locate(start.Add(45*time.Second), time.Hour)
+	if !ok || math.Abs(lon-(-179.5)) > 1e-9 {
+		t.Fatalf("lon = %v, %v; want -179.5", lon, ok)
+	}
+}
+
+func TestParseRejectsUntimedFiles(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<gpx><trk><trkseg><trkpt lat="1" lon="2"/></trkseg></trk></gpx>`))
+	if !errors.Is(err, ErrNoPoints) {
+		t.Fatalf("err = %v, want ErrNoPoints", err)
+	}
+	if _, err := Parse(strings.NewReader(`not xml`)); err == nil {
+		t.Fatal("want an error for non-XML input")
+	}
+}
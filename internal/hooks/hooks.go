@@ -0,0 +1,238 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EventPostIngestFile = "post-ingest-file"
+	EventPostSession    = "post-session"
+	EventPreDelete      = "pre-delete"
+	EventPostBackup     = "post-backup"
+	EventSecurityAlert  = "security-alert"
+	EventPowerIdle      = "power-idle"
+
+	maxCapturedOutput = 16 << 10
+
+	// fireQueueSize bounds the events Fire holds while a hook is running.
+	// A busy ingest fires once per file, so a slow hook must not turn into
+	// one process per file.
+	fireQueueSize = 256
+)
+
+// Runner invokes user-provided executables from a hooks directory. For an
+// event named E it runs <dir>/E (if executable) followed by every executable
+// in <dir>/E.d/ in lexical order. On Windows, where only .exe, .bat and .cmd
+// files run, <dir>/E is looked for as E.exe, E.bat or E.cmd. The JSON payload is written to stdin and
+// the event name is exported as USBVAULT_EVENT.
+//
+// Events passed to Fire run one at a time, in the order they were fired,
+// on a single background worker.
+//
+// A nil *Runner is valid and runs nothing.
+type Runner struct {
+	dir     string
+	timeout atomic.Int64 // time.Duration
+	logger  *log.Logger
+
+	startWorker sync.Once
+	queue       chan firedEvent
+	dropped     atomic.Int64
+}
+
+type firedEvent struct {
+	event   string
+	payload map[string]any
+}
+
+func New(dir string, timeout time.Duration, logger *log.Logger) *Runner {
+	r := &Runner{
+		dir:    filepath.Clean(dir),
+		logger: logger,
+		queue:  make(chan firedEvent, fireQueueSize),
+	}
+	r.SetTimeout(timeout)
+	return r
+}
+
+// SetTimeout changes the limit for hook runs started from now on.
+func (r *Runner) SetTimeout(timeout time.Duration) {
+	if r == nil {
+		return
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	r.timeout.Store(int64(timeout))
+}
+
+// Run executes all hooks for event synchronously and returns the first
+// failure. Pre-event callers treat a failure as a veto.
+func (r *Runner) Run(ctx context.Context, event string, payload map[string]any) error {
+	if r == nil {
+		return nil
+	}
+	scripts := r.scriptsFor(event)
+	if len(scripts) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"event": event,
+		"ts":    time.Now().UTC().Format(time.RFC3339Nano),
+		"data":  payload,
+	})
+	if err != nil {
+		return fmt.Errorf("encode hook payload: %w", err)
+	}
+
+	var firstErr error
+	for _, script := range scripts {
+		if err := r.runScript(ctx, event, script, body); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Fire queues hooks for event to run in the background, after those fired
+// before it. Errors are only logged. When the queue is full the event is
+// dropped and logged rather than blocking the caller.
+func (r *Runner) Fire(event string, payload map[string]any) {
+	if r == nil || len(r.scriptsFor(event)) == 0 {
+		return
+	}
+	r.startWorker.Do(func() { go r.work() })
+	select {
+	case r.queue <- firedEvent{event: event, payload: payload}:
+	default:
+		n := r.dropped.Add(1)
+		r.logger.Printf("hook queue full (%d waiting): dropped %s event (%d dropped so far)", fireQueueSize, event, n)
+	}
+}
+
+func (r *Runner) work() {
+	for ev := range r.queue {
+		_ = r.Run(context.Background(), ev.event, ev.payload)
+	}
+}
+
+func (r *Runner) runScript(ctx context.Context, event, script string, body []byte) error {
+	timeout := time.Duration(r.timeout.Load())
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, script)
+	cmd.Dir = r.dir
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), "USBVAULT_EVENT="+event)
+	out := &cappedBuffer{limit: maxCapturedOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	start := time.Now()
+	err := cmd.Run()
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	name := filepath.Base(script)
+	output := strings.TrimSpace(out.String())
+	if err != nil {
+		r.logger.Printf("hook %s (%s) failed after %s: %v: %s", name, event, time.Since(start).Round(time.Millisecond), err, output)
+		return fmt.Errorf("hook %s: %w", name, err)
+	}
+	if output != "" {
+		r.logger.Printf("hook %s (%s): %s", name, event, output)
+	}
+	return nil
+}
+
+func (r *Runner) scriptsFor(event string) []string {
+	if r.dir == "" || r.dir == "." {
+		return nil
+	}
+	out := make([]string, 0, 4)
+	names := []string{event}
+	if goos == "windows" {
+		names = []string{event + ".exe", event + ".bat", event + ".cmd"}
+	}
+	for _, name := range names {
+		if p := filepath.Join(r.dir, name); isExecutableFile(p) {
+			out = append(out, p)
+			break
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(r.dir, event+".d"))
+	if err != nil {
+		return out
+	}
+	names = make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := filepath.Join(r.dir, event+".d", name)
+		if isExecutableFile(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// goos is runtime.GOOS, settable so tests can check the Windows lookup.
+var goos = runtime.GOOS
+
+func isExecutableFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if goos == "windows" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".exe", ".bat", ".cmd":
+			return true
+		}
+		return false
+	}
+	return info.Mode().Perm()&0o111 != 0
+}
+
+type cappedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if room := c.limit - c.buf.Len(); room > 0 {
+		if len(p) > room {
+			c.buf.Write(p[:room])
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (c *cappedBuffer) String() string {
+	return c.buf.String()
+}
@@ -0,0 +1,159 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunPassesPayloadAndReportsFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell hooks are not portable to windows")
+	}
+	t.Parallel()
+
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "payload.json")
+	writeScript(t, filepath.Join(dir, EventPostIngestFile), "#!/bin/sh\ncat > '"+outPath+"'\n")
+	writeScript(t, filepath.Join(dir, EventPreDelete+".d", "10-deny"), "#!/bin/sh\necho refusing\nexit 3\n")
+
+	runner := New(dir, 5*time.Second, log.New(io.Discard, "", 0))
+	ctx := context.Background()
+
+	if err := runner.Run(ctx, EventPostIngestFile, map[string]any{"dest_path": "/library/a.jpg"}); err != nil {
+		t.Fatalf("Run(%s): %v", EventPostIngestFile, err)
+	}
+	raw, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("read captured payload: %v", err)
+	}
+	var got struct {
+		Event string         `json:"event"`
+		Data  map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if got.Event != EventPostIngestFile || got.Data["dest_path"] != "/library/a.jpg" {
+		t.Fatalf("payload = %s", raw)
+	}
+
+	if err := runner.Run(ctx, EventPreDelete, map[string]any{"id": 1}); err == nil {
+		t.Fatalf("Run(%s) expected veto error", EventPreDelete)
+	}
+	if err := runner.Run(ctx, EventPostBackup, nil); err != nil {
+		t.Fatalf("Run with no hooks installed: %v", err)
+	}
+}
+
+func TestRunTimesOut(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell hooks are not portable to windows")
+	}
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeScript(t, filepath.Join(dir, EventPostSession), "#!/bin/sh\nexec sleep 5\n")
+
+	runner := New(dir, 200*time.Millisecond, log.New(io.Discard, "", 0))
+	start := time.Now()
+	if err := runner.Run(context.Background(), EventPostSession, nil); err == nil {
+		t.Fatalf("Run expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("Run took %s, want hook killed near timeout", elapsed)
+	}
+}
+
+func TestFireRunsInOrderAndDropsWhenFull(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell hooks are not portable to windows")
+	}
+	t.Parallel()
+
+	dir := t.TempDir()
+	started, release, logPath := filepath.Join(dir, "started"), filepath.Join(dir, "release"), filepath.Join(dir, "log")
+	writeScript(t, filepath.Join(dir, EventPostIngestFile),
+		"#!/bin/sh\ntouch '"+started+"'\nwhile [ ! -f '"+release+"' ]; do sleep 0.05; done\ncat >> '"+logPath+"'\necho >> '"+logPath+"'\n")
+
+	runner := New(dir, 10*time.Second, log.New(io.Discard, "", 0))
+	runner.queue = make(chan firedEvent, 2)
+
+	// The first event holds the worker; two more fill the queue and the
+	// fourth has no room.
+	runner.Fire(EventPostIngestFile, map[string]any{"n": 1})
+	waitFor(t, started)
+	for n := 2; n <= 4; n++ {
+		runner.Fire(EventPostIngestFile, map[string]any{"n": n})
+	}
+	if got := runner.dropped.Load(); got != 1 {
+		t.Fatalf("dropped %d events, want 1", got)
+	}
+	if err := os.WriteFile(release, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var order []float64
+	deadline := time.Now().Add(10 * time.Second)
+	for len(order) < 3 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		raw, _ := os.ReadFile(logPath)
+		order = order[:0]
+		for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+			var got struct {
+				Data map[string]float64 `json:"data"`
+			}
+			if json.Unmarshal([]byte(line), &got) == nil {
+				order = append(order, got.Data["n"])
+			}
+		}
+	}
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Fatalf("hooks ran for %v, want [1 2 3]", order)
+	}
+}
+
+func TestWindowsHooksNeedAnExtension(t *testing.T) {
+	defer func(prev string) { goos = prev }(goos)
+	goos = "windows"
+
+	dir := t.TempDir()
+	writeScript(t, filepath.Join(dir, EventPostBackup), "")
+	writeScript(t, filepath.Join(dir, EventPostBackup+".bat"), "")
+	writeScript(t, filepath.Join(dir, EventPostBackup+".d", "10-copy.cmd"), "")
+	writeScript(t, filepath.Join(dir, EventPostBackup+".d", "20-notes.txt"), "")
+
+	runner := New(dir, time.Second, log.New(io.Discard, "", 0))
+	got := runner.scriptsFor(EventPostBackup)
+	want := []string{filepath.Join(dir, EventPostBackup+".bat"), filepath.Join(dir, EventPostBackup+".d", "10-copy.cmd")}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("scriptsFor = %q, want %q", got, want)
+	}
+}
+
+func waitFor(t *testing.T, path string) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+	}
+	t.Fatalf("%s never appeared", path)
+}
+
+func writeScript(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatalf("mkdir %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(body), 0o750); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
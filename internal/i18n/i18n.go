@@ -0,0 +1,227 @@
+// Package i18n holds the message catalogs and number and date formats for
+// the languages the vault answers in. Catalogs are keyed by the English
+// text, so a message missing from a catalog falls back to English, and the
+// English source needs no catalog at all.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+)
+
+//go:embed catalog/*.json
+var catalogFS embed.FS
+
+// Locale is one supported language and region.
+type Locale struct {
+	Tag      string // BCP 47, e.g. "de" or "en-GB"
+	messages map[string]string
+	dateTime string // time layout
+	date     string
+	decimal  string
+	group    string
+}
+
+// locales are the supported tags, lower-cased. A region only needs its own
+// entry when its formats differ from the language's.
+var locales = map[string]*Locale{
+	"en":    {Tag: "en", dateTime: "01/02/2006 3:04 PM MST", date: "01/02/2006", decimal: ".", group: ","},
+	"en-gb": {Tag: "en-GB", dateTime: "02/01/2006 15:04 MST", date: "02/01/2006", decimal: ".", group: ","},
+	"de":    {Tag: "de", dateTime: "02.01.2006 15:04 MST", date: "02.01.2006", decimal: ",", group: "."},
+	"es":    {Tag: "es", dateTime: "02/01/2006 15:04 MST", date: "02/01/2006", decimal: ",", group: "."},
+	"fr":    {Tag: "fr", dateTime: "02/01/2006 15:04 MST", date: "02/01/2006", decimal: ",", group: "\u202f"},
+	"pt":    {Tag: "pt", dateTime: "02/01/2006 15:04 MST", date: "02/01/2006", decimal: ",", group: "."},
+}
+
+var loadCatalogs = sync.OnceValue(func() error {
+	for _, loc := range locales {
+		lang, _, _ := strings.Cut(strings.ToLower(loc.Tag), "-")
+		raw, err := catalogFS.ReadFile(path.Join("catalog", lang+".json"))
+		if err != nil {
+			continue // English
+		}
+		if err := json.Unmarshal(raw, &loc.messages); err != nil {
+			return fmt.Errorf("catalog %s: %w", lang, err)
+		}
+	}
+	return nil
+})
+
+// Lookup returns the locale for a tag such as "de-AT", falling back from
+// the region to the language.
+func Lookup(tag string) (*Locale, bool) {
+	if err := loadCatalogs(); err != nil {
+		panic(err) // the catalogs are embedded; this is a build error
+	}
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if loc, ok := locales[tag]; ok {
+		return loc, true
+	}
+	lang, _, _ := strings.Cut(tag, "-")
+	loc, ok := locales[lang]
+	return loc, ok
+}
+
+// Default is the locale from USBVAULT_LOCALE, or English. It is used when a
+// request names no supported language and for text written outside a
+// request, such as security alerts.
+var Default = sync.OnceValue(func() *Locale {
+	if loc, ok := Lookup(config.Locale()); ok {
+		return loc
+	}
+	loc, _ := Lookup("en")
+	return loc
+})
+
+// Match picks the best supported locale from an Accept-Language header.
+func Match(header string) *Locale {
+	type choice struct {
+		tag string
+		q   float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if tag != "" && tag != "*" && q > 0 {
+			choices = append(choices, choice{tag, q})
+		}
+	}
+	slices.SortStableFunc(choices, func(a, b choice) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+	for _, c := range choices {
+		if loc, ok := Lookup(c.tag); ok {
+			return loc
+		}
+	}
+	return Default()
+}
+
+type contextKey struct{}
+
+// WithLocale returns a context that carries loc.
+func WithLocale(ctx context.Context, loc *Locale) context.Context {
+	return context.WithValue(ctx, contextKey{}, loc)
+}
+
+// FromContext returns the locale set by WithLocale, or Default.
+func FromContext(ctx context.Context) *Locale {
+	if loc, ok := ctx.Value(contextKey{}).(*Locale); ok && loc != nil {
+		return loc
+	}
+	return Default()
+}
+
+// T translates a message.
+func (l *Locale) T(msg string) string {
+	if s, ok := l.messages[msg]; ok {
+		return s
+	}
+	return msg
+}
+
+// Tf translates a format string and formats it. Translations may reorder
+// the arguments with explicit indexes such as %[2]s.
+func (l *Locale) Tf(format string, args ...any) string {
+	return fmt.Sprintf(l.T(format), args...)
+}
+
+// Time formats t in this machine's zone.
+func (l *Locale) Time(t time.Time) string {
+	return t.In(time.Local).Format(l.dateTime)
+}
+
+// Date formats the day of t in this machine's zone.
+func (l *Locale) Date(t time.Time) string {
+	return t.In(time.Local).Format(l.date)
+}
+
+// Timestamp formats a stored RFC 3339 time, returning anything else as is.
+func (l *Locale) Timestamp(s string) string {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return s
+	}
+	return l.Time(t)
+}
+
+// Number formats n with digit grouping.
+func (l *Locale) Number(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	return sign + l.groupDigits(s)
+}
+
+// Decimal formats f with prec digits after the decimal separator.
+func (l *Locale) Decimal(f float64, prec int) string {
+	s := strconv.FormatFloat(f, 'f', prec, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, ok := strings.Cut(s, ".")
+	s = sign + l.groupDigits(whole)
+	if ok {
+		s += l.decimal + frac
+	}
+	return s
+}
+
+// Bytes formats a size in binary units, as "1.5 GiB".
+func (l *Locale) Bytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return l.Number(n) + " B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return l.Decimal(float64(n)/float64(div), 1) + " " + string("KMGTPE"[exp]) + "iB"
+}
+
+func (l *Locale) groupDigits(s string) string {
+	if len(s) <= 3 {
+		return s
+	}
+	var b strings.Builder
+	head := len(s) % 3
+	if head > 0 {
+		b.WriteString(s[:head])
+	}
+	for i := head; i < len(s); i += 3 {
+		if b.Len() > 0 {
+			b.WriteString(l.group)
+		}
+		b.WriteString(s[i : i+3])
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package i18n
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMatchPrefersWeightedSupportedTags(t *testing.T) {
+	cases := map[string]string{
+		"de-CH,de;q=0.9,en;q=0.8":   "de",
+		"ja,fr;q=0.5,es;q=0.7":      "es",
+		"en-GB,en;q=0.9":            "en-GB",
+		"pt-BR":                     "pt",
+		"fr;q=0, es;q=0.1":          "es",
+		"xx, *":                     Default().Tag,
+		"":                          Default().Tag,
+		"es;q=bogus, de":            "de",
+		" EN-gb ; q=1 , fr ; q=0.2": "en-GB",
+	}
+	for header, want := range cases {
+		if got := Match(header).Tag; got != want {
+			t.Errorf("Match(%q) = %s, want %s", header, got, want)
+		}
+	}
+}
+
+func TestCatalogsAgreeOnKeysAndVerbs(t *testing.T) {
+	es, _ := Lookup("es")
+	keys := slices.Sorted(maps.Keys(es.messages))
+	for _, tag := range []string{"de", "fr", "pt"} {
+		loc, _ := Lookup(tag)
+		if got := slices.Sorted(maps.Keys(loc.messages)); !slices.Equal(got, keys) {
+			t.Errorf("%s catalog keys differ from es", tag)
+		}
+		for key, msg := range loc.messages {
+			if !slices.Equal(verbs(key), verbs(msg)) {
+				t.Errorf("%s: %q has verbs %v, want %v", tag, msg, verbs(msg), verbs(key))
+			}
+		}
+	}
+}
+
+var verbPattern = regexp.MustCompile(`%(?:\[(\d+)\])?([a-z])`)
+
+// verbs lists a format's verbs by the argument each one reads.
+func verbs(format string) []string {
+	out := []string{}
+	next := 1
+	for _, m := range verbPattern.FindAllStringSubmatch(format, -1) {
+		arg := next
+		if m[1] != "" {
+			arg, _ = strconv.Atoi(m[1])
+		}
+		next = arg + 1
+		for len(out) < arg {
+			out = append(out, "")
+		}
+		out[arg-1] = m[2]
+	}
+	return out
+}
+
+func TestTranslateAndFormat(t *testing.T) {
+	de, _ := Lookup("de-AT")
+	if got := de.Tf("Published to %s by %s", "nas", "ana"); got != "Von ana auf nas veröffentlicht" {
+		t.Fatalf("Tf = %q", got)
+	}
+	if got := de.T("no such message"); got != "no such message" {
+		t.Fatalf("missing message = %q", got)
+	}
+	if got := de.Number(-1234567); got != "-1.234.567" {
+		t.Fatalf("Number = %q", got)
+	}
+	if got := de.Bytes(3 << 20); got != "3,0 MiB" {
+		t.Fatalf("Bytes = %q", got)
+	}
+	en, _ := Lookup("en")
+	if got := en.Decimal(1234.5, 2); got != "1,234.50" {
+		t.Fatalf("Decimal = %q", got)
+	}
+	if got := en.Number(999); got != "999" {
+		t.Fatalf("Number = %q", got)
+	}
+
+	old := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = old })
+	if got := de.Timestamp("2026-10-16T14:05:00Z"); got != "16.10.2026 14:05 UTC" {
+		t.Fatalf("Timestamp = %q", got)
+	}
+	if got := en.Timestamp("2026-10-16T14:05:00Z"); got != "10/16/2026 2:05 PM UTC" {
+		t.Fatalf("Timestamp = %q", got)
+	}
+	if got := en.Timestamp("unknown"); got != "unknown" {
+		t.Fatalf("Timestamp = %q", got)
+	}
+}
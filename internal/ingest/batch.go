@@ -0,0 +1,150 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/hooks"
+	"businessplan/usbvault/internal/rules"
+)
+
+// batchMaxAge bounds how long a copied file waits for its record, so a slow
+// card still shows up in the library as it goes.
+const batchMaxAge = 30 * time.Second
+
+// recordBatch holds files that are copied into the library but whose
+// records are not committed yet. They are inserted together in one
+// transaction; only then is each file reported done, and so checkpointed.
+// A batch that rolls back takes its copies out of the library again, so
+// a resumed ingest copies them once more.
+type recordBatch struct {
+	size    int
+	dir     string    // source folder of the queued files
+	started time.Time // when the first file was queued
+	queued  []queuedRecord
+	shas    map[string]struct{}
+}
+
+type queuedRecord struct {
+	f        pendingFile
+	rec      *db.MediaRecord
+	outcome  rules.Outcome
+	sidecars []db.Sidecar // copied along with the file
+}
+
+func newRecordBatch(size int) *recordBatch {
+	return &recordBatch{size: max(size, 1), shas: map[string]struct{}{}}
+}
+
+// has reports whether content with shaHex is waiting in the batch.
+func (b *recordBatch) has(shaHex string) bool {
+	_, ok := b.shas[shaHex]
+	return ok
+}
+
+// queueRecord adds a copied file to the session's batch, committing the
+// batch first when the file is from another folder or the batch has waited
+// long enough, and after when it is full. The caller holds recordMu.
+func (m *Manager) queueRecord(ctx context.Context, sess *session, q queuedRecord) {
+	b := sess.batch
+	dir := filepath.Dir(q.f.path)
+	if len(b.queued) > 0 && (dir != b.dir || time.Since(b.started) >= batchMaxAge) {
+		m.flushRecords(ctx, sess)
+	}
+	if len(b.queued) == 0 {
+		b.dir, b.started = dir, time.Now()
+	}
+	b.queued = append(b.queued, q)
+	b.shas[q.rec.SHA256] = struct{}{}
+	if len(b.queued) >= b.size {
+		m.flushRecords(ctx, sess)
+	}
+}
+
+// flushRecords commits the session's batch and reports each file in it.
+// The caller holds recordMu.
+func (m *Manager) flushRecords(ctx context.Context, sess *session) {
+	b := sess.batch
+	if len(b.queued) == 0 {
+		return
+	}
+	queued := b.queued
+	b.queued = nil
+	clear(b.shas)
+
+	recs := make([]*db.MediaRecord, len(queued))
+	for i, q := range queued {
+		recs[i] = q.rec
+	}
+	rejected, err := m.store.InsertMediaBatch(ctx, recs)
+	if err != nil {
+		m.logger.Printf("ingest: recording %d files failed, removing their copies: %v", len(queued), err)
+	}
+	for i, q := range queued {
+		switch {
+		case err != nil:
+			_ = m.storage.Remove(ctx, q.rec.DestPath)
+			m.removeSidecars(ctx, q.sidecars)
+			sess.report(q.f, Result{}, fmt.Errorf("record: %w", err))
+		case rejected[i] != nil:
+			// Content that reached the library by another route since
+			// the duplicate check.
+			_ = m.storage.Remove(ctx, q.rec.DestPath)
+			m.removeSidecars(ctx, q.sidecars)
+			sess.report(q.f, Result{Duplicates: 1}, nil)
+		default:
+			m.recordIngested(ctx, sess, q)
+			sess.report(q.f, Result{Copied: 1}, nil)
+		}
+	}
+}
+
+// recordIngested does what follows a committed record: rule tags and
+// albums, named places, thumbnails, the audit entry and the
+// post-ingest-file hook.
+func (m *Manager) recordIngested(ctx context.Context, sess *session, q queuedRecord) {
+	rec := q.rec
+	m.applyRuleOutcome(ctx, rec, q.outcome)
+	if rec.GPSLat.Valid && rec.GPSLon.Valid {
+		if err := m.store.MatchMediaPlaces(ctx, rec.ID, rec.GPSLat.Float64, rec.GPSLon.Float64); err != nil {
+			m.logger.Printf("ingest: matching places of media %d: %v", rec.ID, err)
+		}
+	}
+	m.queueThumbnails(rec, sess.baseStorage)
+	if err := m.store.AddMediaSidecars(ctx, rec.ID, q.sidecars); err != nil {
+		m.logger.Printf("ingest: recording sidecars of media %d: %v", rec.ID, err)
+	}
+
+	detail := map[string]any{
+		"media_id":     rec.ID,
+		"sha256":       rec.SHA256,
+		"source_path":  rec.SourcePath,
+		"dest_path":    rec.DestPath,
+		"crc32":        rec.CRC32,
+		"capture_time": rec.CaptureTime,
+	}
+	if len(q.sidecars) > 0 {
+		kinds := make([]string, len(q.sidecars))
+		for i, sc := range q.sidecars {
+			kinds[i] = sc.Kind
+		}
+		detail["sidecars"] = kinds
+	}
+	_ = m.audit.Log(ctx, sess.actor, "file_ingested", detail)
+	m.hooks.Fire(hooks.EventPostIngestFile, map[string]any{
+		"kind":         rec.Kind,
+		"source_mount": sess.mount,
+		"source_path":  rec.SourcePath,
+		"dest_path":    rec.DestPath,
+		"sha256":       rec.SHA256,
+		"size_bytes":   rec.SizeBytes,
+		"capture_time": rec.CaptureTime,
+		"gps_lat":      nullFloatValue(rec.GPSLat),
+		"gps_lon":      nullFloatValue(rec.GPSLon),
+		"make":         rec.Make.String,
+		"model":        rec.Model.String,
+	})
+}
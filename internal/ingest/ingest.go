@@ -3,6 +3,7 @@ package ingest
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -12,13 +13,26 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/avchd"
+	"businessplan/usbvault/internal/budget"
+	"businessplan/usbvault/internal/clock"
 	"businessplan/usbvault/internal/config"
 	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/fault"
 	"businessplan/usbvault/internal/geocode"
+	"businessplan/usbvault/internal/hooks"
+	"businessplan/usbvault/internal/libcrypt"
 	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/pathname"
+	"businessplan/usbvault/internal/rules"
+	"businessplan/usbvault/internal/shrink"
+	"businessplan/usbvault/internal/sidecar"
+	"businessplan/usbvault/internal/storage"
+	"businessplan/usbvault/internal/usb"
 )
 
 const baseStorageSetting = "base_storage_dir"
@@ -29,10 +43,24 @@ const (
 	storageLayoutLocationDate = "location_date"
 )
 
+// ingestJobMaxAge is how long an interrupted mount ingest stays resumable.
+// A card that comes back later is simply ingested from the start again.
+const ingestJobMaxAge = 30 * 24 * time.Hour
+
+// Job kinds recorded in running_jobs while a session runs.
+const (
+	JobMount   = "ingest"
+	JobUpload  = "upload"
+	JobOrphans = "orphans"
+)
+
 type Manager struct {
 	store      *db.Store
 	audit      *audit.Logger
 	geocoder   *geocode.ReverseGeocoder
+	hooks      *hooks.Runner
+	libKey     *libcrypt.Key
+	storage    storage.Backend
 	logger     *log.Logger
 	jobs       chan string
 	processing sync.Map
@@ -45,6 +73,39 @@ type Manager struct {
 
 	rateMu      sync.Mutex
 	rateSamples []rateSample
+	rateBytes   int64 // all sample bytes since resetRateSamples
+
+	clock     *clock.Monitor
+	clockWait time.Duration
+
+	hashThreads atomic.Int32
+	maxWorkers  atomic.Int32 // cap on USBVAULT_INGEST_WORKERS; 0 is none
+
+	// With several ingest workers, destMu and destClaims keep two files
+	// from being given the same library path, and recordMu serializes the
+	// duplicate check and insert that end each file.
+	destMu     sync.Mutex
+	destClaims map[string]struct{}
+	recordMu   sync.Mutex
+
+	thumbs       chan thumbJob
+	thumbLimiter *budget.Limiter
+	ffmpeg       string
+}
+
+// pendingFile is a supported media file found by the scan pass.
+type pendingFile struct {
+	path     string
+	kind     string
+	size     int64
+	mtime    time.Time
+	sidecars []string // companion files to copy along; see sidecar.Match
+	avchd    *avchd.Clip
+}
+
+// checkpoint is what an ingest job records about f once it is done.
+func (f pendingFile) checkpoint() db.IngestCheckpoint {
+	return db.IngestCheckpoint{SizeBytes: f.size, MTime: f.mtime.UTC().Format(time.RFC3339Nano)}
 }
 
 type rateSample struct {
@@ -57,11 +118,39 @@ type Result struct {
 	Scanned    int `json:"scanned"`
 	Copied     int `json:"copied"`
 	Duplicates int `json:"duplicates"`
+	Skipped    int `json:"skipped"`
 	Errors     int `json:"errors"`
+	// Resumed counts files an interrupted ingest of the same mount had
+	// already dealt with, which were not looked at again.
+	Resumed int `json:"resumed"`
+}
+
+// session carries the per-run settings shared by every file in one mount or
+// upload ingest.
+type session struct {
+	mount       string
+	baseStorage string
+	layout      string
+	actor       string
+	rules       *rules.Set
+	volume      usb.Volume     // card filesystem, when file times need reading
+	cardZone    *time.Location // zone the camera clock is set to
+
+	batch  *recordBatch // copied files waiting for their records; see ingestAll
+	doneMu sync.Mutex
+	done   fileDone
+}
+
+// report tells the session's fileDone how f went. Workers and batch
+// commits both report, one at a time.
+func (s *session) report(f pendingFile, res Result, err error) {
+	s.doneMu.Lock()
+	defer s.doneMu.Unlock()
+	s.done(f, res, err)
 }
 
 type Status struct {
-	State          string  `json:"state"` // idle, scanning, ingesting, error
+	State          string  `json:"state"` // idle, waiting (for the clock), scanning, ingesting, error
 	Paused         bool    `json:"paused"`
 	Mount          string  `json:"mount"`
 	Phase          string  `json:"phase"` // scan, ingest
@@ -82,18 +171,50 @@ type Status struct {
 	LastResult     Result  `json:"last_result"`
 }
 
-func NewManager(store *db.Store, auditLogger *audit.Logger, geocoder *geocode.ReverseGeocoder, logger *log.Logger) *Manager {
+func NewManager(store *db.Store, auditLogger *audit.Logger, geocoder *geocode.ReverseGeocoder, hookRunner *hooks.Runner, logger *log.Logger) *Manager {
 	m := &Manager{
 		store:    store,
 		audit:    auditLogger,
 		geocoder: geocoder,
+		hooks:    hookRunner,
+		storage:  storage.NewLocal(),
 		logger:   logger,
 		jobs:     make(chan string, 16),
+		thumbs:   make(chan thumbJob, thumbQueueSize),
+
+		destClaims: map[string]struct{}{},
 	}
 	m.status = Status{State: "idle"}
 	return m
 }
 
+// SetClock makes mount ingest wait up to maxWait for a trusted system clock
+// and flags records written while it is untrusted.
+func (m *Manager) SetClock(c *clock.Monitor, maxWait time.Duration) {
+	m.clock = c
+	m.clockWait = maxWait
+}
+
+// SetHashThreads sets how many files are hashed at once, ahead of the one
+// being copied. One hashes each file just before it is copied.
+func (m *Manager) SetHashThreads(n int) {
+	m.hashThreads.Store(int32(max(1, n)))
+}
+
+// SetMaxWorkers caps the ingest workers of sessions started from now on,
+// below USBVAULT_INGEST_WORKERS. Zero removes the cap.
+func (m *Manager) SetMaxWorkers(n int) {
+	m.maxWorkers.Store(int32(max(0, n)))
+}
+
+// now is the ingest timestamp and whether the system clock is trusted.
+func (m *Manager) now() (time.Time, bool) {
+	if m.clock == nil {
+		return time.Now(), true
+	}
+	return m.clock.Now()
+}
+
 func (m *Manager) GetStatus() Status {
 	paused := m.IsPaused()
 
@@ -169,7 +290,19 @@ func (m *Manager) IsPaused() bool {
 	return m.paused
 }
 
+// SetLibraryKey enables encryption of newly ingested files. Call it before
+// Start.
+func (m *Manager) SetLibraryKey(key *libcrypt.Key) {
+	m.libKey = key
+}
+
+// SetStorage sets where library copies are written. Call it before Start.
+func (m *Manager) SetStorage(b storage.Backend) {
+	m.storage = b
+}
+
 func (m *Manager) Start(ctx context.Context) {
+	go m.runThumbnails(ctx)
 	go func() {
 		for {
 			select {
@@ -225,7 +358,7 @@ func (m *Manager) ProcessMount(ctx context.Context, mountPath, actor string) (Re
 	}
 	excludedMounts := config.ParsePathList(excludedRaw)
 
-	if shouldSkipMount(mountPath, baseStorage, excludedMounts) {
+	if ShouldSkipMount(mountPath, baseStorage, excludedMounts) {
 		_ = m.audit.Log(ctx, actor, "ingest_skipped_excluded_mount", map[string]any{
 			"mount":           mountPath,
 			"base_storage":    baseStorage,
@@ -238,6 +371,31 @@ func (m *Manager) ProcessMount(ctx context.Context, mountPath, actor string) (Re
 	if raw, ok, err := m.store.GetSetting(ctx, storageLayoutSetting); err == nil && ok {
 		layout = normalizeStorageLayout(raw)
 	}
+	sess := &session{
+		mount:       mountPath,
+		baseStorage: baseStorage,
+		layout:      layout,
+		actor:       actor,
+		rules:       m.loadRules(ctx),
+	}
+	sess.volume, sess.cardZone = m.cardClock(mountPath)
+
+	// A Pi that lost power boots with a wrong clock until NTP sets it.
+	// Give it a chance so records get real timestamps.
+	if m.clock != nil && !m.clock.Trusted() {
+		m.setStatus(Status{
+			State:     "waiting",
+			Mount:     mountPath,
+			UpdatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+			Message:   "Waiting for the system clock to be set...",
+		})
+		if !m.clock.WaitTrusted(ctx, 5*time.Second, m.clockWait) {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			m.logger.Printf("ingest %s: system clock is still not trusted; records will be flagged clock_uncertain", mountPath)
+		}
+	}
 
 	m.setStatus(Status{
 		State:     "scanning",
@@ -250,10 +408,15 @@ func (m *Manager) ProcessMount(ctx context.Context, mountPath, actor string) (Re
 	m.resetRateSamples()
 
 	_ = m.audit.Log(ctx, actor, "ingest_started", map[string]any{"mount": mountPath})
+	defer m.beginJob(ctx, JobMount, actor, mountPath)()
 
-	// First pass: count supported files and total bytes for percent/rate reporting.
-	var totalFiles int
+	// First pass: list supported files and count bytes for percent/rate reporting.
+	var files []pendingFile
 	var totalBytes int64
+	sidecars := map[string][]string{}
+	skip := m.loadSkipRules(ctx)
+	// AVCHD BDMV folders found so far, with the clips their playlists name.
+	bdmv := map[string]map[string]avchd.Clip{}
 	scanErr := filepath.WalkDir(mountPath, func(path string, d fs.DirEntry, walkErr error) error {
 		if err := m.waitIfPaused(ctx); err != nil {
 			return err
@@ -262,27 +425,56 @@ func (m *Manager) ProcessMount(ctx context.Context, mountPath, actor string) (Re
 			result.Errors++
 			return nil
 		}
+		if path == mountPath {
+			return nil
+		}
+		if rel, err := filepath.Rel(mountPath, path); err == nil && skip.Skipped(filepath.ToSlash(rel)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
 		if d.IsDir() {
-			if strings.HasPrefix(d.Name(), ".") {
+			// Only STREAM holds footage; the rest of BDMV is player
+			// index data and backups of it.
+			if _, ok := bdmv[filepath.Dir(path)]; ok && !strings.EqualFold(d.Name(), avchd.StreamDir) {
 				return filepath.SkipDir
 			}
+			if avchd.IsBDMV(path) {
+				clips, err := avchd.Clips(path)
+				if err != nil {
+					m.logger.Printf("ingest %s: AVCHD playlists: %v", path, err)
+				}
+				bdmv[path] = clips
+			}
 			return nil
 		}
 
 		kind, supported := config.IsSupportedMedia(path)
 		if !supported {
+			if _, ok := sidecar.KindOf(path); ok {
+				key := sidecar.Key(path, isMediaName)
+				sidecars[key] = append(sidecars[key], path)
+			}
 			return nil
 		}
-		_ = kind
 		result.Scanned++
-		totalFiles++
+		f := pendingFile{path: path, kind: kind}
+		if stream := filepath.Dir(path); strings.EqualFold(filepath.Base(stream), avchd.StreamDir) {
+			if clip, ok := bdmv[filepath.Dir(stream)][strings.TrimSuffix(d.Name(), filepath.Ext(d.Name()))]; ok {
+				f.avchd = &clip
+			}
+		}
 		if info, err := os.Stat(path); err == nil {
-			totalBytes += info.Size()
+			f.size = info.Size()
+			f.mtime = info.ModTime()
+			totalBytes += f.size
 		}
-		if totalFiles%50 == 0 {
+		files = append(files, f)
+		if len(files)%50 == 0 {
 			m.bumpStatus(func(st *Status) {
-				st.TotalFiles = totalFiles
+				st.TotalFiles = len(files)
 				st.TotalBytes = totalBytes
 				st.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
 			})
@@ -298,48 +490,57 @@ func (m *Manager) ProcessMount(ctx context.Context, mountPath, actor string) (Re
 		})
 		return result, scanErr
 	}
+	for i, f := range files {
+		if found := sidecars[sidecar.Key(f.path, isMediaName)]; len(found) > 0 {
+			files[i].sidecars = sidecar.Match(f.path, found)
+		}
+	}
+
+	// A card pulled out mid-ingest left a job behind; files it finished
+	// are not hashed or copied again.
+	jobID, done, err := m.store.OpenIngestJob(ctx, config.PathKey(mountPath), time.Now().Add(-ingestJobMaxAge))
+	if err != nil {
+		return result, fmt.Errorf("open ingest job: %w", err)
+	}
+	todo := make([]pendingFile, 0, len(files))
+	for _, f := range files {
+		if cp, ok := done[f.path]; ok && cp == f.checkpoint() {
+			result.Resumed++
+			totalBytes -= f.size
+			continue
+		}
+		todo = append(todo, f)
+	}
+	files = todo
+	message := "Ingesting media..."
+	if result.Resumed > 0 {
+		message = "Resuming import..."
+		_ = m.audit.Log(ctx, actor, "ingest_resumed", map[string]any{
+			"mount":        mountPath,
+			"already_done": result.Resumed,
+			"remaining":    len(files),
+		})
+	}
 
 	m.bumpStatus(func(st *Status) {
 		st.State = "ingesting"
 		st.Phase = "ingest"
-		st.TotalFiles = totalFiles
+		st.TotalFiles = len(files)
 		st.TotalBytes = totalBytes
-		st.Message = "Ingesting media..."
+		st.Message = message
 		st.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
 	})
 
 	// Second pass: ingest.
-	walkErr := filepath.WalkDir(mountPath, func(path string, d fs.DirEntry, walkErr error) error {
-		if err := m.waitIfPaused(ctx); err != nil {
-			return err
-		}
-		if walkErr != nil {
-			result.Errors++
-			return nil
-		}
-
-		if d.IsDir() {
-			if strings.HasPrefix(d.Name(), ".") {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		kind, supported := config.IsSupportedMedia(path)
-		if !supported {
-			return nil
-		}
-
-		m.bumpStatus(func(st *Status) {
-			st.CurrentPath = path
-			st.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
-		})
-
-		if err := m.ingestFile(ctx, mountPath, baseStorage, layout, path, kind, actor, &result); err != nil {
+	speed := m.startSpeedLog(mountPath)
+	walkErr := m.ingestAll(ctx, sess, files, func(f pendingFile, res Result, err error) {
+		result.add(res)
+		if err != nil {
 			result.Errors++
-			m.logger.Printf("ingest file error %s: %v", path, err)
+			m.logger.Printf("ingest file error %s: %v", f.path, err)
+		} else if err := m.store.CheckpointIngestFile(ctx, jobID, f.path, f.checkpoint(), fileOutcome(res)); err != nil {
+			m.logger.Printf("ingest checkpoint %s: %v", f.path, err)
 		}
-
 		m.bumpStatus(func(st *Status) {
 			st.ProcessedFiles++
 			st.CopiedFiles = result.Copied
@@ -347,9 +548,8 @@ func (m *Manager) ProcessMount(ctx context.Context, mountPath, actor string) (Re
 			st.Errors = result.Errors
 			st.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
 		})
-
-		return nil
 	})
+	m.finishSpeedLog(ctx, speed, result, walkErr != nil)
 
 	if walkErr != nil {
 		m.bumpStatus(func(st *Status) {
@@ -360,14 +560,25 @@ func (m *Manager) ProcessMount(ctx context.Context, mountPath, actor string) (Re
 		})
 		return result, walkErr
 	}
+	if err := m.store.FinishIngestJob(ctx, jobID); err != nil {
+		m.logger.Printf("finish ingest job %s: %v", mountPath, err)
+	}
 
 	_ = m.audit.Log(ctx, actor, "ingest_completed", map[string]any{
 		"mount":      mountPath,
 		"scanned":    result.Scanned,
 		"copied":     result.Copied,
 		"duplicates": result.Duplicates,
+		"skipped":    result.Skipped,
+		"resumed":    result.Resumed,
 		"errors":     result.Errors,
 	})
+	m.hooks.Fire(hooks.EventPostSession, map[string]any{
+		"source": "mount",
+		"mount":  mountPath,
+		"actor":  actor,
+		"result": result,
+	})
 
 	m.setStatus(Status{
 		State:      "idle",
@@ -382,6 +593,32 @@ func (m *Manager) ProcessMount(ctx context.Context, mountPath, actor string) (Re
 }
 
 func (m *Manager) ProcessUploadedFiles(ctx context.Context, actor string, srcPaths []string) (Result, error) {
+	return m.processFiles(ctx, actor, srcPaths, fileBatch{
+		mount:       "manual_upload",
+		job:         JobUpload,
+		source:      "upload",
+		preparing:   "Preparing uploaded media...",
+		ingesting:   "Ingesting uploaded media...",
+		auditAction: "upload_ingest_completed",
+	})
+}
+
+// fileBatch describes a list of files ingested outside a mount session.
+type fileBatch struct {
+	mount       string // shown as the session's mount and recorded as the source mount
+	job         string
+	source      string // the post-session hook's source
+	preparing   string
+	ingesting   string
+	auditAction string
+	// done, when set, is called with each file's outcome once it is final.
+	done func(path string, res Result)
+}
+
+// processFiles ingests srcPaths through the full metadata pipeline into the
+// library layout. Files that are not supported media, are empty or are gone
+// are passed over.
+func (m *Manager) processFiles(ctx context.Context, actor string, srcPaths []string, b fileBatch) (Result, error) {
 	var result Result
 	if len(srcPaths) == 0 {
 		return result, nil
@@ -403,24 +640,27 @@ func (m *Manager) ProcessUploadedFiles(ctx context.Context, actor string, srcPat
 	if raw, ok, err := m.store.GetSetting(ctx, storageLayoutSetting); err == nil && ok {
 		layout = normalizeStorageLayout(raw)
 	}
-
-	type item struct {
-		path string
-		kind string
-		size int64
+	sess := &session{
+		mount:       b.mount,
+		baseStorage: baseStorage,
+		layout:      layout,
+		actor:       actor,
+		rules:       m.loadRules(ctx),
 	}
-	items := make([]item, 0, len(srcPaths))
+
+	items := make([]pendingFile, 0, len(srcPaths))
 	var totalBytes int64
 
 	m.setStatus(Status{
 		State:     "scanning",
-		Mount:     "manual_upload",
+		Mount:     b.mount,
 		Phase:     "scan",
 		StartedAt: time.Now().UTC().Format(time.RFC3339Nano),
 		UpdatedAt: time.Now().UTC().Format(time.RFC3339Nano),
-		Message:   "Preparing uploaded media...",
+		Message:   b.preparing,
 	})
 	m.resetRateSamples()
+	defer m.beginJob(ctx, b.job, actor, fmt.Sprintf("%d files", len(srcPaths)))()
 
 	for _, rawPath := range srcPaths {
 		path := filepath.Clean(strings.TrimSpace(rawPath))
@@ -435,7 +675,7 @@ func (m *Manager) ProcessUploadedFiles(ctx context.Context, actor string, srcPat
 		if err != nil || info.IsDir() || info.Size() == 0 {
 			continue
 		}
-		items = append(items, item{path: path, kind: kind, size: info.Size()})
+		items = append(items, pendingFile{path: path, kind: kind, size: info.Size()})
 		totalBytes += info.Size()
 		result.Scanned++
 	}
@@ -445,24 +685,19 @@ func (m *Manager) ProcessUploadedFiles(ctx context.Context, actor string, srcPat
 		st.Phase = "ingest"
 		st.TotalFiles = len(items)
 		st.TotalBytes = totalBytes
-		st.Message = "Ingesting uploaded media..."
+		st.Message = b.ingesting
 		st.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
 	})
 
-	for _, it := range items {
-		if err := m.waitIfPaused(ctx); err != nil {
-			return result, err
-		}
-		m.bumpStatus(func(st *Status) {
-			st.CurrentPath = it.path
-			st.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
-		})
-
-		if err := m.ingestFile(ctx, "manual_upload", baseStorage, layout, it.path, it.kind, actor, &result); err != nil {
+	err = m.ingestAll(ctx, sess, items, func(it pendingFile, res Result, err error) {
+		result.add(res)
+		if err != nil {
 			result.Errors++
-			m.logger.Printf("upload ingest file error %s: %v", it.path, err)
+			m.logger.Printf("%s ingest file error %s: %v", b.source, it.path, err)
+		}
+		if b.done != nil {
+			b.done(it.path, res)
 		}
-
 		m.bumpStatus(func(st *Status) {
 			st.ProcessedFiles++
 			st.CopiedFiles = result.Copied
@@ -470,14 +705,23 @@ func (m *Manager) ProcessUploadedFiles(ctx context.Context, actor string, srcPat
 			st.Errors = result.Errors
 			st.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
 		})
+	})
+	if err != nil {
+		return result, err
 	}
 
-	_ = m.audit.Log(ctx, actor, "upload_ingest_completed", map[string]any{
+	_ = m.audit.Log(ctx, actor, b.auditAction, map[string]any{
 		"scanned":    result.Scanned,
 		"copied":     result.Copied,
 		"duplicates": result.Duplicates,
+		"skipped":    result.Skipped,
 		"errors":     result.Errors,
 	})
+	m.hooks.Fire(hooks.EventPostSession, map[string]any{
+		"source": b.source,
+		"actor":  actor,
+		"result": result,
+	})
 
 	m.setStatus(Status{
 		State:      "idle",
@@ -491,7 +735,24 @@ func (m *Manager) ProcessUploadedFiles(ctx context.Context, actor string, srcPat
 	return result, nil
 }
 
-func shouldSkipMount(mountPath, baseStorage string, excludedMounts []string) bool {
+// ShouldSkipMount reports whether a mount is never ingested: the storage
+// drive itself or a user-excluded mount.
+// beginJob records a session as running until the returned func is called,
+// so one cut off by a crash is reported at the next start.
+func (m *Manager) beginJob(ctx context.Context, kind, actor, detail string) func() {
+	id, err := m.store.BeginJob(ctx, kind, actor, detail)
+	if err != nil {
+		m.logger.Printf("record %s start: %v", kind, err)
+		return func() {}
+	}
+	return func() {
+		if err := m.store.EndJob(context.Background(), id); err != nil {
+			m.logger.Printf("record %s end: %v", kind, err)
+		}
+	}
+}
+
+func ShouldSkipMount(mountPath, baseStorage string, excludedMounts []string) bool {
 	// Never ingest from the destination storage drive/mount itself.
 	if config.IsPathWithin(baseStorage, mountPath) || config.IsPathWithin(mountPath, baseStorage) {
 		return true
@@ -539,6 +800,7 @@ func (m *Manager) resetRateSamples() {
 	m.rateMu.Lock()
 	defer m.rateMu.Unlock()
 	m.rateSamples = nil
+	m.rateBytes = 0
 }
 
 func (m *Manager) recordRateSample(bytes int64, files float64) {
@@ -553,6 +815,7 @@ func (m *Manager) recordRateSample(bytes int64, files float64) {
 	defer m.rateMu.Unlock()
 
 	m.rateSamples = append(m.rateSamples, rateSample{At: now, Bytes: bytes, Files: files})
+	m.rateBytes += bytes
 	trim := 0
 	for trim < len(m.rateSamples) && m.rateSamples[trim].At.Before(cutoff) {
 		trim++
@@ -651,48 +914,122 @@ func (m *Manager) waitIfPaused(ctx context.Context) error {
 	}
 }
 
-func (m *Manager) ingestFile(ctx context.Context, mountPath, baseStorage, layout, srcPath, kind, actor string, result *Result) error {
+// fileSums are a file's hashes, computed by hashAhead; done is closed once
+// they are set.
+type fileSums struct {
+	crc, sha string
+	err      error
+	done     chan struct{}
+}
+
+// hashAhead hashes files on the configured number of threads, running ahead
+// of the copy loop, and delivers the results in file order. It returns nil
+// with a single thread: ingestFile then hashes each file itself. The channel
+// is closed early when ctx ends.
+func (m *Manager) hashAhead(ctx context.Context, files []pendingFile) <-chan *fileSums {
+	threads := int(m.hashThreads.Load())
+	if threads <= 1 {
+		return nil
+	}
+	out := make(chan *fileSums, threads)
+	go func() {
+		defer close(out)
+		slots := make(chan struct{}, threads)
+		for _, f := range files {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			sums := &fileSums{done: make(chan struct{})}
+			go func() {
+				defer func() {
+					<-slots
+					close(sums.done)
+				}()
+				sums.crc, sums.sha, sums.err = m.hashFile(ctx, f)
+			}()
+			select {
+			case out <- sums:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// hashFile hashes f, counting hashing as half the work of ingesting it.
+func (m *Manager) hashFile(ctx context.Context, f pendingFile) (string, string, error) {
+	weight := 0.5 / float64(max(f.size, 1))
+	return media.ComputeHashesWithProgress(f.path, func(n int64) {
+		_ = m.waitIfPaused(ctx)
+		m.recordRateSample(n, float64(n)*weight)
+	})
+}
+
+// ingestFile copies one file and queues its record on the session's batch,
+// returning queued true; the file is reported when the batch is committed.
+// Otherwise it has set result for a file it skipped, or failed. sums, when
+// not nil, holds its hashes computed ahead of time.
+func (m *Manager) ingestFile(ctx context.Context, sess *session, f pendingFile, sums *fileSums, result *Result) (queued bool, err error) {
+	mountPath, baseStorage, actor := sess.mount, sess.baseStorage, sess.actor
+	srcPath, kind := f.path, f.kind
+
 	info, err := os.Stat(srcPath)
 	if err != nil {
-		return err
+		return false, err
 	}
 	if info.Size() == 0 {
-		return nil
+		return false, nil
 	}
 	fileSize := info.Size()
 	if fileSize <= 0 {
 		fileSize = 1
 	}
-	hashFileWeight := 0.5 / float64(fileSize)
 	copyFileWeight := 0.5 / float64(fileSize)
 
-	crcHex, shaHex, err := media.ComputeHashesWithProgress(srcPath, func(n int64) {
-		_ = m.waitIfPaused(ctx)
-		m.recordRateSample(n, float64(n)*hashFileWeight)
-	})
-	if err != nil {
-		return err
+	var crcHex, shaHex string
+	if sums != nil {
+		<-sums.done
+		crcHex, shaHex, err = sums.crc, sums.sha, sums.err
+	} else {
+		f.size = info.Size()
+		crcHex, shaHex, err = m.hashFile(ctx, f)
 	}
-
-	meta, err := media.ExtractMetadata(srcPath, kind)
 	if err != nil {
-		return err
+		return false, err
 	}
-	capture := normalizeCaptureTime(meta.CaptureTime, info.ModTime())
 
-	exists, err := m.store.MediaExists(ctx, crcHex, info.Size(), capture)
+	existingID, err := m.store.FindMediaBySHA256(ctx, shaHex)
 	if err != nil {
-		return err
+		return false, err
 	}
-	if exists {
+	if existingID > 0 {
 		result.Duplicates++
 		m.recordRateSample(0, 0.5)
 		_ = m.audit.Log(ctx, actor, "duplicate_skipped", map[string]any{
-			"source_path":  srcPath,
-			"crc32":        crcHex,
-			"capture_time": capture,
+			"source_path": srcPath,
+			"sha256":      shaHex,
+			"existing_id": existingID,
 		})
-		return nil
+		return false, nil
+	}
+
+	meta, err := media.ExtractMetadata(srcPath, kind)
+	if err != nil {
+		return false, err
+	}
+	if srt := f.sidecarOf(sidecar.KindSRT); srt != "" {
+		applyTelemetry(srt, &meta)
+	}
+	capture := normalizeCaptureTime(meta.CaptureTime, info.ModTime())
+	metadata := meta.RawJSON
+	if meta.CaptureFromMTime && sess.volume.LocalTimes() && sess.cardZone != nil {
+		capture, metadata = correctCardMTime(sess, info.ModTime(), metadata)
+	}
+	if f.avchd != nil {
+		metadata = withAVCHDClip(metadata, *f.avchd)
 	}
 
 	rec := &db.MediaRecord{
@@ -712,10 +1049,16 @@ func (m *Manager) ingestFile(ctx context.Context, mountPath, baseStorage, layout
 		CameraYaw:   meta.CameraYaw,
 		CameraPitch: meta.CameraPitch,
 		CameraRoll:  meta.CameraRoll,
-		Metadata:    meta.RawJSON,
+		Metadata:    metadata,
 		SourceMTime: info.ModTime().UTC().Format(time.RFC3339),
-		IngestedAt:  time.Now().UTC().Format(time.RFC3339),
+		DurationSec: meta.DurationSec,
+		VideoCodec:  meta.VideoCodec,
+		Width:       meta.Width,
+		Height:      meta.Height,
 	}
+	ingestedAt, trusted := m.now()
+	rec.IngestedAt = ingestedAt.UTC().Format(time.RFC3339)
+	rec.ClockUncertain = !trusted
 
 	if meta.GPSLat.Valid && meta.GPSLon.Valid {
 		if loc, err := m.geocoder.Reverse(ctx, meta.GPSLat.Float64, meta.GPSLon.Float64); err == nil && loc != nil {
@@ -731,41 +1074,147 @@ func (m *Manager) ingestFile(ctx context.Context, mountPath, baseStorage, layout
 		}
 	}
 
-	destPath, err := buildDestinationPath(baseStorage, layout, capture, srcPath, shaHex, rec)
+	outcome := sess.rules.Evaluate(ruleEnv(rec, meta))
+	if outcome.Skip {
+		result.Skipped++
+		m.recordRateSample(0, 0.5)
+		_ = m.audit.Log(ctx, actor, "ingest_rule_skipped", map[string]any{
+			"source_path": srcPath,
+			"rules":       outcome.Matched,
+		})
+		return false, nil
+	}
+	destRoot := baseStorage
+	if tier := sanitizeFolderName(outcome.Tier); tier != "" {
+		destRoot = filepath.Join(baseStorage, tier)
+	}
+
+	locate := func(path string) string {
+		rel, err := filepath.Rel(baseStorage, path)
+		if err != nil {
+			return path
+		}
+		return m.storage.Locate(baseStorage, rel)
+	}
+	taken := func(path string) bool {
+		loc := locate(path)
+		inUse, err := m.store.DestPathTaken(ctx, loc)
+		return err != nil || inUse || (storage.IsLocal(loc) && pathname.ExistsFold(loc))
+	}
+	destPath, err := m.claimDestination(func(claimed func(string) bool) (string, error) {
+		return buildDestinationPath(destRoot, sess.layout, capture, srcPath, shaHex, rec, func(path string) bool {
+			return claimed(path) || taken(path)
+		})
+	})
 	if err != nil {
-		return err
+		return false, err
+	}
+	defer m.releaseDestination(destPath)
+	rel, err := filepath.Rel(baseStorage, destPath)
+	if err != nil {
+		return false, err
 	}
 	var copiedThisFile int64
-	if err := copyFileAtomic(srcPath, destPath, info.Mode(), info.ModTime(), func(n int64) {
+	onProgress := func(n int64) {
 		_ = m.waitIfPaused(ctx)
 		copiedThisFile += n
 		m.addCopiedBytes(n)
 		m.recordRateSample(0, float64(n)*copyFileWeight)
-	}); err != nil {
+	}
+	if stored := m.compressedSize(srcPath, rec, shaHex); stored > 0 {
+		err = m.storeCompressed(ctx, baseStorage, rel, srcPath, info.Size(), shaHex, stored, info.ModTime(), onProgress)
+		rec.StoredBytes = sql.NullInt64{Int64: stored, Valid: true}
+	} else {
+		err = m.storeFile(ctx, baseStorage, rel, srcPath, info.Size(), info.ModTime(), onProgress)
+	}
+	if err != nil {
 		if copiedThisFile > 0 {
 			m.addCopiedBytes(-copiedThisFile)
 		}
-		return err
+		return false, err
+	}
+	rec.DestPath = m.storage.Locate(baseStorage, rel)
+	copied := m.copySidecars(ctx, baseStorage, destPath, f)
+
+	m.recordMu.Lock()
+	defer m.recordMu.Unlock()
+	// Another worker may have recorded or queued the same content while
+	// this copy ran.
+	existingID, err = m.store.FindMediaBySHA256(ctx, shaHex)
+	if err != nil || existingID > 0 || sess.batch.has(shaHex) {
+		_ = m.storage.Remove(ctx, rec.DestPath)
+		m.removeSidecars(ctx, copied)
+		if err != nil {
+			return false, err
+		}
+		result.Duplicates++
+		_ = m.audit.Log(ctx, actor, "duplicate_skipped", map[string]any{
+			"source_path": srcPath,
+			"sha256":      shaHex,
+			"existing_id": existingID,
+		})
+		return false, nil
 	}
-	rec.DestPath = destPath
+	m.queueRecord(ctx, sess, queuedRecord{f: f, rec: rec, outcome: outcome, sidecars: copied})
+	return true, nil
+}
 
-	if err := m.store.InsertMedia(ctx, rec); err != nil {
-		_ = os.Remove(destPath)
-		if strings.Contains(strings.ToLower(err.Error()), "unique") {
-			result.Duplicates++
-			return nil
-		}
-		return err
+// cardClock works out how file times on mountPath should be read. Without a
+// configured card timezone they are used as the operating system reads them.
+func (m *Manager) cardClock(mountPath string) (usb.Volume, *time.Location) {
+	zone, err := config.CardTimezone()
+	if err != nil {
+		m.logger.Printf("ingest %s: %v; file times used as read", mountPath, err)
+		return usb.Volume{}, nil
+	}
+	if zone == nil {
+		return usb.Volume{}, nil
 	}
+	vol, err := usb.VolumeOf(mountPath)
+	if err != nil {
+		m.logger.Printf("ingest %s: filesystem type: %v; file times used as read", mountPath, err)
+		return usb.Volume{}, nil
+	}
+	return vol, zone
+}
 
-	result.Copied++
-	_ = m.audit.Log(ctx, actor, "file_ingested", map[string]any{
-		"source_path":  srcPath,
-		"dest_path":    destPath,
-		"crc32":        crcHex,
-		"capture_time": capture,
-	})
-	return nil
+// correctCardMTime reads mtime, taken from a FAT or exFAT card, as the wall
+// clock time the camera wrote in the card timezone, and notes the
+// correction in the record's metadata. It returns the capture time and the
+// metadata JSON.
+func correctCardMTime(sess *session, mtime time.Time, metadata string) (string, string) {
+	corrected := sess.volume.RecordedWallClock(mtime, sess.cardZone)
+	raw := map[string]any{}
+	if err := json.Unmarshal([]byte(metadata), &raw); err != nil {
+		raw = map[string]any{}
+	}
+	raw["mtime_correction"] = map[string]any{
+		"filesystem":        sess.volume.FSType,
+		"read_zone":         sess.volume.ReadZone.String(),
+		"card_timezone":     sess.cardZone.String(),
+		"raw_mtime":         mtime.UTC().Format(time.RFC3339),
+		"offset_seconds":    int(mtime.Sub(corrected).Seconds()),
+		"precision_seconds": int(sess.volume.Precision().Seconds()),
+	}
+	out := metadata
+	if b, err := json.Marshal(raw); err == nil {
+		out = string(b)
+	}
+	return corrected.UTC().Format(time.RFC3339), out
+}
+
+// withAVCHDClip records which recording an AVCHD stream clip is part of, so
+// the pieces of a recording split across clips can be found together.
+func withAVCHDClip(metadata string, clip avchd.Clip) string {
+	raw := map[string]any{}
+	if err := json.Unmarshal([]byte(metadata), &raw); err != nil {
+		raw = map[string]any{}
+	}
+	raw["avchd"] = clip
+	if b, err := json.Marshal(raw); err == nil {
+		return string(b)
+	}
+	return metadata
 }
 
 func toNullString(v string) sql.NullString {
@@ -776,6 +1225,96 @@ func toNullString(v string) sql.NullString {
 	return sql.NullString{String: v, Valid: true}
 }
 
+func (m *Manager) loadRules(ctx context.Context) *rules.Set {
+	raw, ok, err := m.store.GetSetting(ctx, rules.SettingKey)
+	if err != nil || !ok {
+		return nil
+	}
+	set, err := rules.Parse(raw)
+	if err != nil {
+		m.logger.Printf("ingest rules ignored: %v", err)
+		return nil
+	}
+	return set
+}
+
+func (m *Manager) applyRuleOutcome(ctx context.Context, rec *db.MediaRecord, outcome rules.Outcome) {
+	if len(outcome.Matched) == 0 || rec.ID <= 0 {
+		return
+	}
+	if len(outcome.Tags) > 0 {
+		if _, err := m.store.AddMediaTags(ctx, rec.ID, outcome.Tags, "rule"); err != nil {
+			m.logger.Printf("ingest rule tags failed for %s: %v", rec.DestPath, err)
+		}
+	}
+	if outcome.Album != "" {
+		album, err := m.store.EnsureAlbum(ctx, outcome.Album)
+		if err == nil {
+			_, _, err = m.store.AddMediaToAlbum(ctx, album.ID, []int64{rec.ID})
+		}
+		if err != nil {
+			m.logger.Printf("ingest rule album %q failed for %s: %v", outcome.Album, rec.DestPath, err)
+		}
+	}
+}
+
+// ruleEnv exposes the fields a rule expression can reference.
+func ruleEnv(rec *db.MediaRecord, meta media.ExtractedMetadata) map[string]any {
+	env := map[string]any{
+		"kind":         rec.Kind,
+		"file_name":    rec.FileName,
+		"extension":    strings.TrimPrefix(rec.Extension, "."),
+		"source_path":  rec.SourcePath,
+		"mount":        rec.SourceMount,
+		"size_bytes":   float64(rec.SizeBytes),
+		"size_mb":      float64(rec.SizeBytes) / (1024 * 1024),
+		"capture_time": rec.CaptureTime,
+		"has_gps":      rec.GPSLat.Valid && rec.GPSLon.Valid,
+	}
+	if tm, err := time.Parse(time.RFC3339, rec.CaptureTime); err == nil {
+		env["year"] = float64(tm.Year())
+		env["month"] = float64(tm.Month())
+		env["hour"] = float64(tm.Hour())
+	}
+	setString := func(key string, v sql.NullString) {
+		if v.Valid && strings.TrimSpace(v.String) != "" {
+			env[key] = strings.TrimSpace(v.String)
+		}
+	}
+	setFloat := func(key string, v sql.NullFloat64) {
+		if v.Valid {
+			env[key] = v.Float64
+		}
+	}
+	setString("make", rec.Make)
+	setString("model", rec.Model)
+	setString("country", rec.Country)
+	setString("state", rec.State)
+	setString("county", rec.County)
+	setString("city", rec.City)
+	setString("road", rec.Road)
+	setFloat("lat", rec.GPSLat)
+	setFloat("lon", rec.GPSLon)
+	setFloat("yaw", rec.CameraYaw)
+	setFloat("pitch", rec.CameraPitch)
+	setFloat("roll", rec.CameraRoll)
+
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(meta.RawJSON), &raw); err == nil {
+		if d, ok := raw["duration_seconds"].(float64); ok {
+			env["duration"] = d
+		}
+	}
+	return env
+}
+
+func nullFloatValue(v sql.NullFloat64) any {
+	if v.Valid {
+		return v.Float64
+	}
+	return nil
+}
+
 func normalizeCaptureTime(raw string, fallback time.Time) string {
 	if raw != "" {
 		if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
@@ -785,24 +1324,22 @@ func normalizeCaptureTime(raw string, fallback time.Time) string {
 	return fallback.UTC().Format(time.RFC3339)
 }
 
-func buildDestinationPath(baseStorage, layout, capture, sourcePath, shaHex string, rec *db.MediaRecord) (string, error) {
+// buildDestinationPath picks a free library path for a file. taken reports
+// whether a candidate is already in use, on disk or in the database.
+func buildDestinationPath(baseStorage, layout, capture, sourcePath, shaHex string, rec *db.MediaRecord, taken func(string) bool) (string, error) {
 	tm, err := time.Parse(time.RFC3339, capture)
 	if err != nil {
 		tm = time.Now().UTC()
 	}
 
-	folder := filepath.Join(baseStorage, tm.Format("2006"), tm.Format("01"), tm.Format("02"))
+	var dirs []string
 	if normalizeStorageLayout(layout) == storageLayoutLocationDate {
-		locParts := buildLocationFolderParts(rec)
-		if len(locParts) > 0 {
-			folder = filepath.Join(append([]string{baseStorage}, append(locParts, tm.Format("2006"), tm.Format("01"), tm.Format("02"))...)...)
-		} else {
-			folder = filepath.Join(baseStorage, "Unknown", tm.Format("2006"), tm.Format("01"), tm.Format("02"))
+		dirs = buildLocationFolderParts(rec)
+		if len(dirs) == 0 {
+			dirs = []string{"Unknown"}
 		}
 	}
-	if err := os.MkdirAll(folder, 0o750); err != nil {
-		return "", err
-	}
+	dirs = append(dirs, tm.Format("2006"), tm.Format("01"), tm.Format("02"))
 
 	name := sanitizeFilename(filepath.Base(sourcePath))
 	ext := strings.ToLower(filepath.Ext(name))
@@ -816,14 +1353,18 @@ func buildDestinationPath(baseStorage, layout, capture, sourcePath, shaHex strin
 		shortHash = shaHex[:8]
 	}
 
+	// Keep the path short enough to survive a copy to a Windows drive.
+	dirs, base = pathname.Fit(dirs, base, "_"+shortHash+ext)
+	folder := filepath.Join(append([]string{baseStorage}, dirs...)...)
+
 	candidate := filepath.Join(folder, fmt.Sprintf("%s_%s%s", base, shortHash, ext))
-	if !fileExists(candidate) {
+	if !taken(candidate) {
 		return candidate, nil
 	}
 
 	for i := 1; i <= 10000; i++ {
 		alt := filepath.Join(folder, fmt.Sprintf("%s_%s_%d%s", base, shortHash, i, ext))
-		if !fileExists(alt) {
+		if !taken(alt) {
 			return alt, nil
 		}
 	}
@@ -865,77 +1406,92 @@ func buildLocationFolderParts(rec *db.MediaRecord) []string {
 }
 
 func sanitizeFolderName(name string) string {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return ""
-	}
-	name = strings.ReplaceAll(name, string(filepath.Separator), "_")
-	name = strings.Map(func(r rune) rune {
-		switch {
-		case r >= 'a' && r <= 'z':
-			return r
-		case r >= 'A' && r <= 'Z':
-			return r
-		case r >= '0' && r <= '9':
-			return r
-		case r == ' ':
-			return '_'
-		case r == '.', r == '-', r == '_':
-			return r
-		default:
-			return '_'
-		}
-	}, name)
-	name = strings.Trim(name, "_.")
-	if len(name) > 64 {
-		name = name[:64]
-	}
-	return name
+	return pathname.Folder(name, config.ASCIIFolderNames())
 }
 
-func copyFileAtomic(srcPath, dstPath string, srcMode fs.FileMode, modTime time.Time, onProgress func(int64)) error {
-	tmpPath := dstPath + ".part"
-
-	src, err := os.Open(srcPath)
+// storeFile copies size bytes of srcPath to rel below baseStorage on the
+// storage backend. With a library key the copy is encrypted on the way.
+func (m *Manager) storeFile(ctx context.Context, baseStorage, rel, srcPath string, size int64, modTime time.Time, onProgress func(int64)) error {
+	src, err := m.openSource(srcPath, onProgress)
 	if err != nil {
 		return err
 	}
 	defer src.Close()
+	return m.put(ctx, baseStorage, rel, src, size, modTime)
+}
 
-	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+// storeCompressed is storeFile for a file kept compressed, whose stored
+// form compressedSize found to be stored bytes long.
+func (m *Manager) storeCompressed(ctx context.Context, baseStorage, rel, srcPath string, size int64, shaHex string, stored int64, modTime time.Time, onProgress func(int64)) error {
+	src, err := m.openSource(srcPath, onProgress)
 	if err != nil {
 		return err
 	}
-
-	copyErr := func() error {
-		defer dst.Close()
-		copySrc := io.Reader(src)
-		if onProgress != nil {
-			copySrc = &progressReader{r: src, onProgress: onProgress}
-		}
-		buf := make([]byte, 1024*1024)
-		if _, err := io.CopyBuffer(dst, copySrc, buf); err != nil {
-			return err
-		}
-		if err := dst.Sync(); err != nil {
-			return err
-		}
-		return nil
+	defer src.Close()
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := shrink.Compress(pw, src, size, shaHex)
+		pw.CloseWithError(err)
 	}()
-	if copyErr != nil {
-		_ = os.Remove(tmpPath)
-		return copyErr
+	err = m.put(ctx, baseStorage, rel, pr, stored, modTime)
+	_ = pr.CloseWithError(errors.New("library write stopped"))
+	return err
+}
+
+// compressedSize returns how long rec's library copy would be stored
+// compressed, or 0 when compression is off, does not apply to the format,
+// or would not save at least an eighth of the file.
+func (m *Manager) compressedSize(srcPath string, rec *db.MediaRecord, shaHex string) int64 {
+	if !config.LosslessCompressionEnabled() || !shrink.Compressible(rec.Extension) || rec.SizeBytes < minCompressBytes {
+		return 0
 	}
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return 0
+	}
+	defer src.Close()
+	stored, err := shrink.StoredSize(src, rec.SizeBytes, shaHex)
+	if err != nil || stored > rec.SizeBytes-rec.SizeBytes/8 {
+		return 0
+	}
+	return stored
+}
 
-	if err := os.Rename(tmpPath, dstPath); err != nil {
-		_ = os.Remove(tmpPath)
-		return err
+// minCompressBytes is the smallest file compression is tried on; below it
+// the saving is not worth reading the file twice.
+const minCompressBytes = 64 << 10
+
+type sourceFile struct {
+	io.Reader
+	io.Closer
+}
+
+func (m *Manager) openSource(srcPath string, onProgress func(int64)) (io.ReadCloser, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
 	}
+	r := fault.Reader(fault.MediaRead, src)
+	if onProgress != nil {
+		r = &progressReader{r: r, onProgress: onProgress}
+	}
+	return sourceFile{Reader: r, Closer: src}, nil
+}
 
-	_ = os.Chtimes(dstPath, modTime, modTime)
-	_ = os.Chmod(dstPath, 0o440)
-	_ = srcMode
-	return nil
+// put writes size bytes from src to rel below baseStorage, encrypting them
+// on the way with a library key.
+func (m *Manager) put(ctx context.Context, baseStorage, rel string, src io.Reader, size int64, modTime time.Time) error {
+	if m.libKey == nil {
+		return m.storage.Put(ctx, baseStorage, rel, src, modTime)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(m.libKey.Encrypt(pw, src, size))
+	}()
+	err := m.storage.Put(ctx, baseStorage, rel, pr, modTime)
+	// Unblock the encryption when Put gave up early.
+	_ = pr.CloseWithError(errors.New("library write stopped"))
+	return err
 }
 
 type progressReader struct {
@@ -951,11 +1507,6 @@ func (p *progressReader) Read(b []byte) (int, error) {
 	return n, err
 }
 
-func fileExists(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
-}
-
 func sanitizeFilename(name string) string {
 	name = strings.ReplaceAll(name, string(filepath.Separator), "_")
 	name = strings.Map(func(r rune) rune {
@@ -974,3 +1525,16 @@ func sanitizeFilename(name string) string {
 	}, name)
 	return strings.Trim(name, "_.")
 }
+
+// fileOutcome names what ingestFile did with one file, from that file's
+// own result counters.
+func fileOutcome(res Result) string {
+	switch {
+	case res.Copied > 0:
+		return "copied"
+	case res.Duplicates > 0:
+		return "duplicate"
+	default:
+		return "skipped"
+	}
+}
@@ -0,0 +1,77 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestProcessMountCommitsInBatches(t *testing.T) {
+	t.Setenv("USBVAULT_INGEST_BATCH_SIZE", "3")
+
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "data", "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.SetSetting(ctx, baseStorageSetting, filepath.Join(root, "library")); err != nil {
+		t.Fatalf("set base storage: %v", err)
+	}
+	// Seven files over two folders; C004 repeats C000's bytes, so it is
+	// caught against the uncommitted batch rather than the database.
+	mountDir := filepath.Join(root, "mount")
+	for i := range 7 {
+		sub := filepath.Join(mountDir, "DCIM", fmt.Sprintf("10%d", i/5))
+		if err := os.MkdirAll(sub, 0o750); err != nil {
+			t.Fatal(err)
+		}
+		fill := byte(0x30 + i)
+		if i == 4 {
+			fill = 0x30
+		}
+		if err := createTestMediaFile(filepath.Join(sub, fmt.Sprintf("C%03d.mp4", i)), 1, fill); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := NewManager(store, audit.New(store), nil, nil, log.New(io.Discard, "", 0))
+	res, err := manager.ProcessMount(ctx, mountDir, "test")
+	if err != nil {
+		t.Fatalf("process mount: %v", err)
+	}
+	if res.Copied != 6 || res.Duplicates != 1 || res.Errors != 0 {
+		t.Fatalf("result = %+v, want 6 copied and 1 duplicate", res)
+	}
+	items, err := store.ListMedia(ctx, "", "", 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 6 {
+		t.Fatalf("%d records, want 6", len(items))
+	}
+	for _, rec := range items {
+		if rec.ID == 0 {
+			t.Fatalf("record without id: %+v", rec)
+		}
+		if _, err := os.Stat(rec.DestPath); err != nil {
+			t.Fatalf("library file %s: %v", rec.DestPath, err)
+		}
+	}
+
+	// Every file was checkpointed once its batch committed, so nothing is
+	// copied again.
+	res, err = manager.ProcessMount(ctx, mountDir, "test")
+	if err != nil || res.Copied != 0 || res.Duplicates != 7 {
+		t.Fatalf("second run = %+v, %v; want all duplicates", res, err)
+	}
+}
@@ -0,0 +1,90 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/shrink"
+	"businessplan/usbvault/internal/storage"
+)
+
+func TestProcessMountCompressesLosslessFormats(t *testing.T) {
+	for _, encrypted := range []bool{false, true} {
+		t.Run(map[bool]string{false: "plain", true: "encrypted"}[encrypted], func(t *testing.T) {
+			t.Setenv("USBVAULT_LOSSLESS_COMPRESSION", "1")
+			root := t.TempDir()
+			store, err := db.Open(filepath.Join(root, "data", "usbvault.db"))
+			if err != nil {
+				t.Fatalf("open db: %v", err)
+			}
+			defer store.Close()
+			ctx := context.Background()
+			if err := store.SetSetting(ctx, baseStorageSetting, filepath.Join(root, "library")); err != nil {
+				t.Fatal(err)
+			}
+
+			card := filepath.Join(root, "mount", "Screenshots")
+			if err := os.MkdirAll(card, 0o750); err != nil {
+				t.Fatal(err)
+			}
+			files := map[string][]byte{
+				"shot.bmp":  bytes.Repeat([]byte("BM white row "), 20000),
+				"noise.png": make([]byte, 200<<10),
+			}
+			_, _ = rand.Read(files["noise.png"])
+			for name, body := range files {
+				if err := os.WriteFile(filepath.Join(card, name), body, 0o640); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			manager := NewManager(store, audit.New(store), nil, nil, log.New(io.Discard, "", 0))
+			var key *libcrypt.Key
+			if encrypted {
+				key, err = libcrypt.LoadOrCreateKey(filepath.Join(root, "library.key"), []byte("passphrase"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				manager.SetLibraryKey(key)
+			}
+			res, err := manager.ProcessMount(ctx, filepath.Join(root, "mount"), "test")
+			if err != nil || res.Copied != 2 || res.Errors != 0 {
+				t.Fatalf("process mount = %+v, %v", res, err)
+			}
+			items, err := store.ListMedia(ctx, "", "", 10, 0)
+			if err != nil || len(items) != 2 {
+				t.Fatalf("media = %v, %v", items, err)
+			}
+			for _, rec := range items {
+				compressed := rec.FileName == "shot.bmp"
+				if rec.StoredBytes.Valid != compressed {
+					t.Fatalf("%s stored_bytes = %v", rec.FileName, rec.StoredBytes)
+				}
+				if compressed && rec.StoredBytes.Int64 >= rec.SizeBytes/8 {
+					t.Fatalf("%s stored in %d of %d bytes", rec.FileName, rec.StoredBytes.Int64, rec.SizeBytes)
+				}
+				if !encrypted && shrink.IsCompressed(rec.DestPath) != compressed {
+					t.Fatalf("%s compressed on disk = %v", rec.FileName, !compressed)
+				}
+				src, err := storage.OpenPlain(ctx, storage.NewLocal(), key, rec.DestPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := io.ReadAll(src)
+				_ = src.Close()
+				if err != nil || !bytes.Equal(got, files[rec.FileName]) {
+					t.Fatalf("%s read back %d bytes, %v", rec.FileName, len(got), err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+//go:build faultinject
+// +build faultinject
+
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/fault"
+)
+
+// Every failure after the copy has started must leave neither a partial
+// copy nor an unrecorded file, and a clean rerun must pick up the rest.
+func TestProcessMountRollsBackInjectedFaults(t *testing.T) {
+	for _, rule := range []fault.Rule{
+		{Point: fault.MediaRead, ErrorRate: 0.5},
+		{Point: fault.LibraryWrite, ErrorRate: 0.5},
+		{Point: fault.DBWrite, ErrorRate: 0.5, Err: fault.ErrDBBusy},
+	} {
+		t.Run(rule.Point, func(t *testing.T) {
+			root := t.TempDir()
+			store, err := db.Open(filepath.Join(root, "data", "usbvault.db"))
+			if err != nil {
+				t.Fatalf("open db: %v", err)
+			}
+			defer store.Close()
+			ctx := context.Background()
+			library := filepath.Join(root, "library")
+			if err := store.SetSetting(ctx, baseStorageSetting, library); err != nil {
+				t.Fatalf("set base storage: %v", err)
+			}
+			mountDir := filepath.Join(root, "mount")
+			if err := os.MkdirAll(mountDir, 0o750); err != nil {
+				t.Fatal(err)
+			}
+			for i := range 8 {
+				if err := createTestMediaFile(filepath.Join(mountDir, fmt.Sprintf("C%03d.mp4", i)), 2, byte(0x40+i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			manager := NewManager(store, audit.New(store), nil, nil, log.New(io.Discard, "", 0))
+
+			fault.Set(7, rule)
+			res, err := manager.ProcessMount(ctx, mountDir, "test")
+			fault.Reset()
+			if err != nil {
+				t.Fatalf("faulted ingest: %v", err)
+			}
+			if res.Errors == 0 || fault.Stats()[rule.Point].Errors == 0 {
+				t.Fatalf("no faults hit: %+v", res)
+			}
+			checkLibraryMatchesRecords(t, store, library, res.Copied)
+
+			res, err = manager.ProcessMount(ctx, mountDir, "test")
+			if err != nil || res.Errors != 0 {
+				t.Fatalf("clean ingest: %+v, %v", res, err)
+			}
+			checkLibraryMatchesRecords(t, store, library, 8)
+		})
+	}
+}
+
+func checkLibraryMatchesRecords(t *testing.T, store *db.Store, library string, want int) {
+	t.Helper()
+	recorded, err := store.DestPaths(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != want {
+		t.Fatalf("%d records, want %d", len(recorded), want)
+	}
+	files := 0
+	_ = filepath.WalkDir(library, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		files++
+		if strings.HasSuffix(path, ".part") {
+			t.Errorf("partial copy left behind: %s", path)
+		} else if _, ok := recorded[path]; !ok {
+			t.Errorf("file without record: %s", path)
+		}
+		return nil
+	})
+	if files != want {
+		t.Errorf("%d library files, want %d", files, want)
+	}
+}
@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/geocode"
+	"businessplan/usbvault/internal/media"
+)
+
+func TestProcessMountHashesAheadOnThreads(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "data", "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	baseStorage := filepath.Join(root, "library")
+	if err := store.SetSetting(ctx, baseStorageSetting, baseStorage); err != nil {
+		t.Fatalf("set base storage: %v", err)
+	}
+	mountDir := filepath.Join(root, "mount")
+	if err := os.MkdirAll(mountDir, 0o750); err != nil {
+		t.Fatalf("mkdir mount: %v", err)
+	}
+	var paths []string
+	for i := range 6 {
+		p := filepath.Join(mountDir, fmt.Sprintf("A%03d.mp4", i))
+		if err := createTestMediaFile(p, 1, byte(0x10+i%5)); err != nil { // A005 repeats A000
+			t.Fatalf("create %s: %v", p, err)
+		}
+		paths = append(paths, p)
+	}
+
+	manager := NewManager(store, audit.New(store), geocode.New(store), nil, log.New(io.Discard, "", 0))
+	manager.SetHashThreads(3)
+	res, err := manager.ProcessMount(ctx, mountDir, "test")
+	if err != nil {
+		t.Fatalf("process mount: %v", err)
+	}
+	if res.Copied != 5 || res.Duplicates != 1 || res.Errors != 0 {
+		t.Fatalf("result = %+v, want 5 copied and 1 duplicate", res)
+	}
+	for _, p := range paths[:5] {
+		_, sha, err := media.ComputeHashes(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := store.FindMediaBySHA256(ctx, sha)
+		if err != nil || id == 0 {
+			t.Fatalf("%s: no record for its hash (id %d, err %v)", filepath.Base(p), id, err)
+		}
+		rec, err := store.GetMediaByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.FileName != filepath.Base(p) {
+			t.Fatalf("hash of %s recorded for %s", filepath.Base(p), rec.FileName)
+		}
+	}
+}
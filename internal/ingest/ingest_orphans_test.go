@@ -0,0 +1,82 @@
+package ingest
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestImportOrphans(t *testing.T) {
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "data", "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	library := filepath.Join(root, "library")
+	if err := store.SetSetting(ctx, baseStorageSetting, library); err != nil {
+		t.Fatalf("set base storage: %v", err)
+	}
+	mountDir := filepath.Join(root, "mount")
+	if err := os.MkdirAll(mountDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestMediaFile(filepath.Join(mountDir, "C000.mp4"), 1, 0x30); err != nil {
+		t.Fatal(err)
+	}
+	manager := NewManager(store, audit.New(store), nil, nil, log.New(io.Discard, "", 0))
+	if res, err := manager.ProcessMount(ctx, mountDir, "test"); err != nil || res.Copied != 1 {
+		t.Fatalf("process mount = %+v, %v", res, err)
+	}
+
+	// Left in the library without records: a new file, a copy of one the
+	// library holds, and a file outside base storage that is never taken.
+	loose := filepath.Join(library, "Loose")
+	if err := os.MkdirAll(loose, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	orphan := filepath.Join(loose, "C001.mp4")
+	dupe := filepath.Join(loose, "copy.mp4")
+	outside := filepath.Join(mountDir, "C002.mp4")
+	for path, fill := range map[string]byte{orphan: 0x31, dupe: 0x30, outside: 0x32} {
+		if err := createTestMediaFile(path, 1, fill); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := manager.ImportOrphans(ctx, "test", []string{orphan, dupe, outside})
+	if err != nil {
+		t.Fatalf("ImportOrphans: %v", err)
+	}
+	if res.Copied != 1 || res.Duplicates != 1 || res.Skipped != 1 || res.Errors != 0 {
+		t.Fatalf("result = %+v, want 1 copied, 1 duplicate, 1 skipped", res)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Fatalf("imported orphan left in place: %v", err)
+	}
+	for _, path := range []string{dupe, outside} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+	items, err := store.ListMedia(ctx, "", "", 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("%d records, want 2", len(items))
+	}
+	for _, rec := range items {
+		if _, err := os.Stat(rec.DestPath); err != nil {
+			t.Fatalf("library file %s: %v", rec.DestPath, err)
+		}
+	}
+}
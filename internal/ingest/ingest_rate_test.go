@@ -47,7 +47,7 @@ func TestProcessMountReportsLiveMBps(t *testing.T) {
 		t.Fatalf("create file A002: %v", err)
 	}
 
-	manager := NewManager(store, audit.New(store), geocode.New(store), log.New(io.Discard, "", 0))
+	manager := NewManager(store, audit.New(store), geocode.New(store), nil, log.New(io.Discard, "", 0))
 
 	type resultWithErr struct {
 		result Result
@@ -77,6 +77,13 @@ func TestProcessMountReportsLiveMBps(t *testing.T) {
 			if maxFilesPerSec <= 0 {
 				t.Fatalf("expected files/s to become > 0 during ingest, got %.4f", maxFilesPerSec)
 			}
+			history, err := store.ListIngestSpeed(ctx, "")
+			if err != nil {
+				t.Fatalf("list ingest speed: %v", err)
+			}
+			if len(history) != 1 || history[0].Mount != mountDir || history[0].AvgMBps <= 0 || history[0].Outcome != "completed" {
+				t.Fatalf("ingest speed history = %+v, want one completed session for %s", history, mountDir)
+			}
 			return
 		case <-timeout:
 			t.Fatalf("timed out waiting for ingest completion")
@@ -104,7 +111,7 @@ func TestPauseResumeUpdatesStatus(t *testing.T) {
 	}
 	defer store.Close()
 
-	manager := NewManager(store, audit.New(store), geocode.New(store), log.New(io.Discard, "", 0))
+	manager := NewManager(store, audit.New(store), geocode.New(store), nil, log.New(io.Discard, "", 0))
 	manager.setStatus(Status{
 		State:     "ingesting",
 		StartedAt: time.Now().UTC().Format(time.RFC3339Nano),
@@ -0,0 +1,81 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/geocode"
+)
+
+func TestProcessMountResumesInterruptedJob(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "data", "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.SetSetting(ctx, baseStorageSetting, filepath.Join(root, "library")); err != nil {
+		t.Fatalf("set base storage: %v", err)
+	}
+	mountDir := filepath.Join(root, "mount")
+	if err := os.MkdirAll(mountDir, 0o750); err != nil {
+		t.Fatalf("mkdir mount: %v", err)
+	}
+	var files []pendingFile
+	for i := range 4 {
+		p := filepath.Join(mountDir, fmt.Sprintf("B%03d.mp4", i))
+		if err := createTestMediaFile(p, 1, byte(0x20+i)); err != nil {
+			t.Fatalf("create %s: %v", p, err)
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, pendingFile{path: p, kind: "video", size: info.Size(), mtime: info.ModTime()})
+	}
+
+	// The card was pulled after two files; the second was rewritten since.
+	jobID, _, err := store.OpenIngestJob(ctx, config.PathKey(mountDir), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("open job: %v", err)
+	}
+	for _, f := range files[:2] {
+		if err := store.CheckpointIngestFile(ctx, jobID, f.path, f.checkpoint(), "copied"); err != nil {
+			t.Fatalf("checkpoint: %v", err)
+		}
+	}
+	later := files[1].mtime.Add(time.Minute)
+	if err := os.Chtimes(files[1].path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager(store, audit.New(store), geocode.New(store), nil, log.New(io.Discard, "", 0))
+	res, err := manager.ProcessMount(ctx, mountDir, "test")
+	if err != nil {
+		t.Fatalf("process mount: %v", err)
+	}
+	if res.Resumed != 1 || res.Copied != 3 || res.Errors != 0 {
+		t.Fatalf("result = %+v, want 1 resumed and 3 copied", res)
+	}
+
+	_, done, err := store.OpenIngestJob(ctx, config.PathKey(mountDir), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("reopen job: %v", err)
+	}
+	if len(done) != 0 {
+		t.Fatalf("finished job left %d checkpoints behind", len(done))
+	}
+}
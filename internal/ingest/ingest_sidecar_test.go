@@ -0,0 +1,81 @@
+package ingest
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestProcessMountCopiesSidecars(t *testing.T) {
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "data", "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.SetSetting(ctx, baseStorageSetting, filepath.Join(root, "library")); err != nil {
+		t.Fatalf("set base storage: %v", err)
+	}
+	card := filepath.Join(root, "mount", "DCIM", "100MEDIA")
+	if err := os.MkdirAll(card, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestMediaFile(filepath.Join(card, "DJI_0001.MP4"), 1, 0x41); err != nil {
+		t.Fatal(err)
+	}
+	srt := "1\n00:00:00,000 --> 00:00:00,033\n<font size=\"28\">FrameCnt: 1 [latitude: 0.000000] [longitude: 0.000000]</font>\n\n" +
+		"2\n00:00:00,033 --> 00:00:00,066\n<font size=\"28\">FrameCnt: 2 [latitude: 45.512345] [longitude: -122.654321] [rel_alt: 30.0 abs_alt: 95.2] [gb_yaw: 12.5 gb_pitch: -30.0 gb_roll: 0.0]</font>\n"
+	files := map[string]string{
+		"DJI_0001.SRT": srt,
+		"DJI_0001.LRF": "proxy",
+		"notes.xmp":    "<x:xmpmeta/>",
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(card, name), []byte(body), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := NewManager(store, audit.New(store), nil, nil, log.New(io.Discard, "", 0))
+	res, err := manager.ProcessMount(ctx, filepath.Join(root, "mount"), "test")
+	if err != nil || res.Copied != 1 || res.Errors != 0 {
+		t.Fatalf("process mount = %+v, %v; want one file copied", res, err)
+	}
+	items, err := store.ListMedia(ctx, "", "", 10, 0)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("media = %v, %v", items, err)
+	}
+	rec := items[0]
+	if !rec.GPSLat.Valid || rec.GPSLat.Float64 != 45.512345 || rec.GPSLon.Float64 != -122.654321 {
+		t.Fatalf("gps = %v, %v; want the first fix from the SRT", rec.GPSLat, rec.GPSLon)
+	}
+	if !rec.CameraYaw.Valid || rec.CameraYaw.Float64 != 12.5 || rec.CameraPitch.Float64 != -30 {
+		t.Fatalf("gimbal = %v, %v", rec.CameraYaw, rec.CameraPitch)
+	}
+
+	sidecars, err := store.ListMediaSidecars(ctx, rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sidecars) != 2 || sidecars[0].Kind != "lrf" || sidecars[1].Kind != "srt" {
+		t.Fatalf("sidecars = %+v, want lrf and srt", sidecars)
+	}
+	for _, sc := range sidecars {
+		want := rec.DestPath[:len(rec.DestPath)-len(filepath.Ext(rec.DestPath))] + "." + sc.Kind
+		if sc.DestPath != want {
+			t.Fatalf("%s copied to %s, want %s", sc.FileName, sc.DestPath, want)
+		}
+		body, err := os.ReadFile(sc.DestPath)
+		if err != nil || string(body) != files[sc.FileName] {
+			t.Fatalf("%s copy = %q, %v", sc.FileName, body, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package ingest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestSkipRulesMatchNamesAndAnchoredPaths(t *testing.T) {
+	skip, err := ParseSkipRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"System Volume Information":    true,
+		"DCIM/.thumbnails":             true,
+		"DCIM/100MEDIA/._IMG_0001.JPG": true,
+		"found.007":                    true,
+		"MISC":                         true,
+		"misc":                         true,
+		"DCIM/MISC":                    false, // /MISC is anchored at the root
+		"DCIM/100MEDIA/IMG_0001.JPG":   false,
+	}
+	for rel, want := range cases {
+		if got := skip.Skipped(rel); got != want {
+			t.Errorf("Skipped(%q) = %v, want %v", rel, got, want)
+		}
+	}
+
+	if _, err := (SkipRules{Patterns: []string{"a/../b"}}).Normalize(); err == nil {
+		t.Fatal(".. accepted")
+	}
+	if _, err := (SkipRules{Patterns: []string{"[x"}}).Normalize(); err == nil {
+		t.Fatal("bad pattern accepted")
+	}
+	norm, err := (SkipRules{Patterns: []string{" /DCIM/ ", "PRIVATE/M4ROOT/", "/Keep", "/Keep", ""}}).Normalize()
+	if err != nil || !slices.Equal(norm.Patterns, []string{"/DCIM", "PRIVATE/M4ROOT", "/Keep"}) {
+		t.Fatalf("Normalize = %v, %v", norm.Patterns, err)
+	}
+}
+
+// mplBytes builds an AVCHD playlist whose clips after the first continue
+// one recording.
+func mplBytes(clips ...string) []byte {
+	raw := make([]byte, 30)
+	copy(raw, "MPLS0100")
+	binary.BigEndian.PutUint32(raw[8:], 20)
+	binary.BigEndian.PutUint16(raw[26:], uint16(len(clips)))
+	for i, c := range clips {
+		item := make([]byte, 22)
+		binary.BigEndian.PutUint16(item, 20)
+		copy(item[2:], c)
+		copy(item[7:], "M2TS")
+		item[12] = 1
+		if i > 0 {
+			item[12] = 5
+		}
+		raw = append(raw, item...)
+	}
+	return raw
+}
+
+func TestProcessMountSkipsSystemFoldersAndGroupsAVCHDClips(t *testing.T) {
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "data", "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.SetSetting(ctx, baseStorageSetting, filepath.Join(root, "library")); err != nil {
+		t.Fatalf("set base storage: %v", err)
+	}
+	mount := filepath.Join(root, "mount")
+	bdmv := filepath.Join(mount, "PRIVATE", "AVCHD", "BDMV")
+	files := map[string]byte{
+		"DCIM/100MEDIA/IMG_0001.JPG":          1,
+		"System Volume Information/X.JPG":     2,
+		".Trashes/501/Y.JPG":                  3,
+		"MISC/Z.JPG":                          4,
+		"PRIVATE/AVCHD/BDMV/STREAM/00000.MTS": 5,
+		"PRIVATE/AVCHD/BDMV/STREAM/00001.MTS": 6,
+		"PRIVATE/AVCHD/BDMV/META/DL/T.JPG":    7,
+		"PRIVATE/AVCHD/BDMV/BACKUP/B.MTS":     8,
+	}
+	for rel, fill := range files {
+		p := filepath.Join(mount, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestMediaFile(p, 1, fill); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(bdmv, "PLAYLIST"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bdmv, "PLAYLIST", "00000.MPL"), mplBytes("00000", "00001"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager(store, audit.New(store), nil, nil, log.New(io.Discard, "", 0))
+	res, err := manager.ProcessMount(ctx, mount, "test")
+	if err != nil || res.Copied != 3 || res.Errors != 0 {
+		t.Fatalf("process mount = %+v, %v; want three files copied", res, err)
+	}
+	items, err := store.ListMedia(ctx, "", "", 10, 0)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("media = %v, %v", items, err)
+	}
+	slices.SortFunc(items, func(a, b db.MediaRecord) int { return strings.Compare(a.FileName, b.FileName) })
+	for i, name := range []string{"00000.MTS", "00001.MTS"} {
+		rec := items[i]
+		if rec.FileName != name {
+			t.Fatalf("item %d = %s, want %s", i, rec.FileName, name)
+		}
+		var meta struct {
+			AVCHD struct {
+				Recording   string
+				Part, Parts int
+			}
+		}
+		if err := json.Unmarshal([]byte(rec.Metadata), &meta); err != nil {
+			t.Fatal(err)
+		}
+		if meta.AVCHD.Recording != "00000" || meta.AVCHD.Part != i+1 || meta.AVCHD.Parts != 2 {
+			t.Fatalf("%s avchd = %+v", name, meta.AVCHD)
+		}
+	}
+	if items[2].FileName != "IMG_0001.JPG" {
+		t.Fatalf("item 2 = %s", items[2].FileName)
+	}
+}
@@ -0,0 +1,82 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/geocode"
+)
+
+func TestProcessMountOnWorkers(t *testing.T) {
+	t.Setenv("USBVAULT_INGEST_WORKERS", "4")
+
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "data", "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.SetSetting(ctx, baseStorageSetting, filepath.Join(root, "library")); err != nil {
+		t.Fatalf("set base storage: %v", err)
+	}
+	mountDir := filepath.Join(root, "mount")
+	// Same names and times in each folder, so the files race for the same
+	// library paths; C000 and C001 hold the same bytes in both folders.
+	stamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for dir := range 2 {
+		sub := filepath.Join(mountDir, fmt.Sprintf("DCIM%d", dir))
+		if err := os.MkdirAll(sub, 0o750); err != nil {
+			t.Fatalf("mkdir mount: %v", err)
+		}
+		for i := range 4 {
+			fill := byte(0x30 + i)
+			if i >= 2 {
+				fill += byte(0x10 * (dir + 1))
+			}
+			p := filepath.Join(sub, fmt.Sprintf("C%03d.mp4", i))
+			if err := createTestMediaFile(p, 1, fill); err != nil {
+				t.Fatalf("create %s: %v", p, err)
+			}
+			if err := os.Chtimes(p, stamp, stamp); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	manager := NewManager(store, audit.New(store), geocode.New(store), nil, log.New(io.Discard, "", 0))
+	res, err := manager.ProcessMount(ctx, mountDir, "test")
+	if err != nil {
+		t.Fatalf("process mount: %v", err)
+	}
+	if res.Copied != 6 || res.Duplicates != 2 || res.Errors != 0 {
+		t.Fatalf("result = %+v, want 6 copied and 2 duplicates", res)
+	}
+
+	items, err := store.ListMedia(ctx, "", "", 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]bool{}
+	for _, rec := range items {
+		if paths[rec.DestPath] {
+			t.Fatalf("two records share %s", rec.DestPath)
+		}
+		paths[rec.DestPath] = true
+		if info, err := os.Stat(rec.DestPath); err != nil || info.Size() != rec.SizeBytes {
+			t.Fatalf("library file %s: %v", rec.DestPath, err)
+		}
+	}
+	if len(paths) != 6 {
+		t.Fatalf("%d records, want 6", len(paths))
+	}
+}
@@ -0,0 +1,60 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/libcrypt"
+)
+
+// ImportOrphans ingests files found under base storage without a record,
+// such as copies a crash left behind or files put there by hand, through
+// the same pipeline as uploads. A file copied into the library layout is
+// then removed from where it was, once its record is committed. A file
+// whose content the library already holds is left in place and counted as
+// a duplicate. Encrypted files are skipped, as their content cannot be
+// read as media, and so are paths outside base storage or in its work area.
+func (m *Manager) ImportOrphans(ctx context.Context, actor string, paths []string) (Result, error) {
+	baseStorage, ok, err := m.store.GetSetting(ctx, baseStorageSetting)
+	if err != nil {
+		return Result{}, err
+	}
+	if !ok || strings.TrimSpace(baseStorage) == "" {
+		return Result{}, errors.New("base storage is not configured")
+	}
+	baseStorage = filepath.Clean(baseStorage)
+	workDir := filepath.Join(baseStorage, config.WorkDirName)
+
+	var skipped int
+	importable := make([]string, 0, len(paths))
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if path == baseStorage || !config.IsPathWithin(path, baseStorage) || config.IsPathWithin(path, workDir) || libcrypt.IsEncrypted(path) {
+			skipped++
+			continue
+		}
+		importable = append(importable, path)
+	}
+	res, err := m.processFiles(ctx, actor, importable, fileBatch{
+		mount:       "library_orphans",
+		job:         JobOrphans,
+		source:      "orphans",
+		preparing:   "Preparing orphaned library files...",
+		ingesting:   "Importing orphaned library files...",
+		auditAction: "orphans_imported",
+		done: func(path string, res Result) {
+			if res.Copied == 0 {
+				return
+			}
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				m.logger.Printf("orphan import: remove %s: %v", path, err)
+			}
+		},
+	})
+	res.Skipped += skipped
+	return res, err
+}
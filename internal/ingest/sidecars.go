@@ -0,0 +1,110 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/sidecar"
+)
+
+func isMediaName(name string) bool {
+	_, ok := config.IsSupportedMedia(name)
+	return ok
+}
+
+// sidecarOf returns f's sidecar of kind, or "".
+func (f pendingFile) sidecarOf(kind string) string {
+	for _, path := range f.sidecars {
+		if k, _ := sidecar.KindOf(path); k == kind {
+			return path
+		}
+	}
+	return ""
+}
+
+// applyTelemetry fills in the position and gimbal angles a drone video
+// lacks from its DJI subtitle track, and notes where they came from in the
+// metadata. A subtitle that cannot be read is ignored.
+func applyTelemetry(srtPath string, meta *media.ExtractedMetadata) {
+	f, err := os.Open(srtPath)
+	if err != nil {
+		return
+	}
+	samples, err := sidecar.ParseSRT(f)
+	_ = f.Close()
+	if err != nil || len(samples) == 0 {
+		return
+	}
+	note := map[string]any{"source": filepath.Base(srtPath), "samples": len(samples)}
+	if fix, ok := sidecar.FirstFix(samples); ok && !(meta.GPSLat.Valid && meta.GPSLon.Valid) {
+		meta.GPSLat = sql.NullFloat64{Float64: fix.Lat, Valid: true}
+		meta.GPSLon = sql.NullFloat64{Float64: fix.Lon, Valid: true}
+		note["gps"] = true
+		if fix.HasAlt {
+			note["altitude_m"] = fix.Alt
+		}
+	}
+	if g, ok := sidecar.FirstGimbal(samples); ok && !meta.CameraYaw.Valid {
+		meta.CameraYaw = sql.NullFloat64{Float64: g.Yaw, Valid: true}
+		meta.CameraPitch = sql.NullFloat64{Float64: g.Pitch, Valid: true}
+		meta.CameraRoll = sql.NullFloat64{Float64: g.Roll, Valid: true}
+		note["gimbal"] = true
+	}
+	raw := map[string]any{}
+	if err := json.Unmarshal([]byte(meta.RawJSON), &raw); err != nil {
+		raw = map[string]any{}
+	}
+	raw["srt_telemetry"] = note
+	if out, err := json.Marshal(raw); err == nil {
+		meta.RawJSON = string(out)
+	}
+}
+
+// copySidecars copies f's sidecars next to its library copy at destPath. A
+// sidecar that cannot be copied is logged and left behind; the media file
+// is still ingested.
+func (m *Manager) copySidecars(ctx context.Context, baseStorage, destPath string, f pendingFile) []db.Sidecar {
+	var out []db.Sidecar
+	for _, path := range f.sidecars {
+		kind, _ := sidecar.KindOf(path)
+		info, err := os.Stat(path)
+		if err != nil {
+			m.logger.Printf("ingest: sidecar %s: %v", path, err)
+			continue
+		}
+		_, shaHex, err := media.ComputeHashes(path)
+		if err != nil {
+			m.logger.Printf("ingest: sidecar %s: %v", path, err)
+			continue
+		}
+		rel, err := filepath.Rel(baseStorage, sidecar.DestPath(destPath, path))
+		if err != nil {
+			continue
+		}
+		if err := m.storeFile(ctx, baseStorage, rel, path, info.Size(), info.ModTime(), nil); err != nil {
+			m.logger.Printf("ingest: sidecar %s: %v", path, err)
+			continue
+		}
+		out = append(out, db.Sidecar{
+			Kind:       kind,
+			FileName:   filepath.Base(path),
+			SourcePath: path,
+			DestPath:   m.storage.Locate(baseStorage, rel),
+			SizeBytes:  info.Size(),
+			SHA256:     shaHex,
+		})
+	}
+	return out
+}
+
+func (m *Manager) removeSidecars(ctx context.Context, sidecars []db.Sidecar) {
+	for _, sc := range sidecars {
+		_ = m.storage.Remove(ctx, sc.DestPath)
+	}
+}
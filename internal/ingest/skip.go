@@ -0,0 +1,110 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// SkipSettingKey holds the folders and files a card scan leaves out.
+const SkipSettingKey = "ingest_skip"
+
+const maxSkipPatterns = 100
+
+// DefaultSkipPatterns are skipped until the list is changed: hidden files
+// and the folders operating systems and cameras keep on a card.
+var DefaultSkipPatterns = []string{
+	".*",
+	"System Volume Information",
+	"$RECYCLE.BIN",
+	".Trashes",
+	"LOST.DIR",
+	"FOUND.[0-9][0-9][0-9]",
+	"/MISC",
+}
+
+// SkipRules decide what a card scan leaves out. A pattern without a slash
+// matches a file or folder name at any depth; one with a slash, or starting
+// with one, is anchored at the card root. Matching ignores case, since
+// cards are usually FAT, and skipping a folder skips everything below it.
+type SkipRules struct {
+	Patterns []string `json:"patterns"`
+}
+
+// Normalize trims the patterns, drops repeats and checks their syntax.
+func (s SkipRules) Normalize() (SkipRules, error) {
+	if len(s.Patterns) > maxSkipPatterns {
+		return SkipRules{}, fmt.Errorf("at most %d skip patterns", maxSkipPatterns)
+	}
+	out := SkipRules{Patterns: []string{}}
+	for _, p := range s.Patterns {
+		p = strings.TrimSpace(p)
+		anchored := strings.HasPrefix(p, "/")
+		p = strings.Trim(p, "/")
+		if p == "" {
+			continue
+		}
+		if slices.Contains(strings.Split(p, "/"), "..") {
+			return SkipRules{}, fmt.Errorf("pattern %q must not contain ..", p)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return SkipRules{}, fmt.Errorf("pattern %q: %w", p, err)
+		}
+		if anchored && !strings.Contains(p, "/") {
+			p = "/" + p
+		}
+		if !slices.Contains(out.Patterns, p) {
+			out.Patterns = append(out.Patterns, p)
+		}
+	}
+	return out, nil
+}
+
+// ParseSkipRules reads the saved rules. An empty value is the defaults.
+func ParseSkipRules(raw string) (SkipRules, error) {
+	if strings.TrimSpace(raw) == "" {
+		return SkipRules{Patterns: slices.Clone(DefaultSkipPatterns)}, nil
+	}
+	var s SkipRules
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return SkipRules{}, fmt.Errorf("invalid ingest skip rules: %w", err)
+	}
+	return s.Normalize()
+}
+
+// Skipped reports whether rel, a slash path relative to the card root, is
+// left out. Only its last element is tested; the scan does not descend into
+// skipped folders.
+func (s SkipRules) Skipped(rel string) bool {
+	rel = strings.ToLower(strings.Trim(rel, "/"))
+	name := path.Base(rel)
+	for _, p := range s.Patterns {
+		p = strings.ToLower(p)
+		target := name
+		if strings.Contains(p, "/") {
+			p, target = strings.TrimPrefix(p, "/"), rel
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSkipRules falls back to the defaults when the saved rules are broken,
+// so a bad setting does not fill the library with system files.
+func (m *Manager) loadSkipRules(ctx context.Context) SkipRules {
+	raw, _, err := m.store.GetSetting(ctx, SkipSettingKey)
+	if err == nil {
+		var s SkipRules
+		if s, err = ParseSkipRules(raw); err == nil {
+			return s
+		}
+	}
+	m.logger.Printf("ingest skip rules: %v; using defaults", err)
+	s, _ := ParseSkipRules("")
+	return s
+}
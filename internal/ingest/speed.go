@@ -0,0 +1,112 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/usb"
+)
+
+// Each card ingest leaves a speed record, so a reader or cable that has
+// become slow shows up against the same card's earlier sessions.
+
+const (
+	speedTick         = time.Second
+	speedSampleEvery  = 5 // ticks between stored samples
+	speedMinBytes     = 1 << 20
+	speedMaxSamples   = 720 // an hour of samples; longer sessions keep the first hour
+	speedOutcomeOK    = "completed"
+	speedOutcomeError = "failed"
+)
+
+// speedLog samples the ingest MB/s while a mount is ingested.
+type speedLog struct {
+	mount   string
+	started time.Time
+	stop    chan struct{}
+	done    chan struct{}
+
+	// Written by the sampling goroutine, read after done is closed.
+	paused  time.Duration
+	peak    float64
+	samples []db.IngestSpeedSample
+}
+
+// startSpeedLog starts sampling the ingest rate of mountPath. The rate
+// samples must have been reset when the session began.
+func (m *Manager) startSpeedLog(mountPath string) *speedLog {
+	l := &speedLog{
+		mount:   mountPath,
+		started: time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(l.done)
+		ticker := time.NewTicker(speedTick)
+		defer ticker.Stop()
+		ticks := 0
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+			}
+			if m.IsPaused() {
+				l.paused += speedTick
+				continue
+			}
+			mbps := m.currentMBps()
+			l.peak = max(l.peak, mbps)
+			if ticks++; ticks%speedSampleEvery == 0 && len(l.samples) < speedMaxSamples {
+				l.samples = append(l.samples, db.IngestSpeedSample{
+					OffsetSec: int(time.Since(l.started).Seconds()),
+					MBps:      mbps,
+				})
+			}
+		}
+	}()
+	return l
+}
+
+// finishSpeedLog stops sampling and stores the session, unless it read too
+// little to say anything about the card.
+func (m *Manager) finishSpeedLog(ctx context.Context, l *speedLog, result Result, failed bool) {
+	close(l.stop)
+	<-l.done
+
+	m.rateMu.Lock()
+	bytes := m.rateBytes
+	m.rateMu.Unlock()
+	if bytes < speedMinBytes {
+		return
+	}
+	active := time.Since(l.started) - l.paused
+	sess := db.IngestSpeedSession{
+		Mount:     l.mount,
+		MountKey:  config.PathKey(l.mount),
+		StartedAt: l.started.UTC().Format(time.RFC3339),
+		Seconds:   active.Seconds(),
+		Bytes:     bytes,
+		Files:     result.Copied + result.Duplicates + result.Skipped,
+		PeakMBps:  l.peak,
+		Outcome:   speedOutcomeOK,
+		Samples:   l.samples,
+	}
+	if failed {
+		sess.Outcome = speedOutcomeError
+	}
+	if active > 0 {
+		sess.AvgMBps = float64(bytes) / active.Seconds() / (1024 * 1024)
+	}
+	// A session shorter than one tick has no peak; its average stands in.
+	sess.PeakMBps = max(sess.PeakMBps, sess.AvgMBps)
+	if vol, err := usb.VolumeOf(l.mount); err == nil {
+		sess.FSType = vol.FSType
+	}
+	if _, err := m.store.RecordIngestSpeed(context.WithoutCancel(ctx), sess); err != nil {
+		m.logger.Printf("record ingest speed %s: %v", l.mount, err)
+	}
+}
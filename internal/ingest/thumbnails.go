@@ -0,0 +1,131 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"image"
+	"os"
+
+	"businessplan/usbvault/internal/budget"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/storage"
+)
+
+// thumbQueueSize bounds how far thumbnail rendering may fall behind the
+// copy. Images queued beyond it are left to the scheduled backfill.
+const thumbQueueSize = 256
+
+type thumbJob struct {
+	id          int64
+	kind        string
+	ext         string
+	sourcePath  string
+	destPath    string
+	baseStorage string
+}
+
+// SetFFmpeg sets the ffmpeg binary used for video posters. Videos get no
+// poster when it is empty. Call it before Start.
+func (m *Manager) SetFFmpeg(path string) {
+	m.ffmpeg = path
+}
+
+// SetThumbnailLimiter makes ingest-time thumbnail rendering share the
+// resource budget's cap on concurrent decodes. Call it before Start.
+func (m *Manager) SetThumbnailLimiter(l *budget.Limiter) {
+	m.thumbLimiter = l
+}
+
+// queueThumbnails hands a freshly ingested image or video to the thumbnail
+// worker. It never blocks the copy.
+func (m *Manager) queueThumbnails(rec *db.MediaRecord, baseStorage string) {
+	switch {
+	case rec.Kind == "image" && media.CanThumbnail(rec.Extension):
+	case rec.Kind == "video" && m.ffmpeg != "":
+	default:
+		return
+	}
+	select {
+	case m.thumbs <- thumbJob{id: rec.ID, kind: rec.Kind, ext: rec.Extension, sourcePath: rec.SourcePath, destPath: rec.DestPath, baseStorage: baseStorage}:
+	default:
+	}
+}
+
+// runThumbnails renders queued thumbnails one image at a time, so the
+// gallery has previews for a card as soon as it has been ingested.
+func (m *Manager) runThumbnails(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-m.thumbs:
+			if err := m.renderThumbnails(ctx, job); err != nil && !errors.Is(err, media.ErrNoPreview) && ctx.Err() == nil {
+				m.logger.Printf("thumbnail media %d: %v", job.id, err)
+			}
+		}
+	}
+}
+
+func (m *Manager) renderThumbnails(ctx context.Context, job thumbJob) error {
+	if m.thumbLimiter != nil {
+		if err := m.thumbLimiter.Acquire(ctx); err != nil {
+			return err
+		}
+		defer m.thumbLimiter.Release()
+	}
+	if job.kind == "video" {
+		return m.renderPoster(ctx, job)
+	}
+	src, err := storage.OpenPlain(ctx, m.storage, m.libKey, job.destPath)
+	if err != nil {
+		return err
+	}
+	img, err := media.DecodeThumbnailSource(src, job.ext)
+	_ = src.Close()
+	if err != nil {
+		return err
+	}
+	return m.writeThumbnails(job, img)
+}
+
+// renderPoster makes a video's thumbnails from a frame ffmpeg extracts and
+// records its duration. ffmpeg needs a plain local file, so an encrypted or
+// remote library copy is read from the card instead while it is still
+// attached.
+func (m *Manager) renderPoster(ctx context.Context, job thumbJob) error {
+	path := job.destPath
+	if !storage.IsPlainFile(path) {
+		if _, err := os.Stat(job.sourcePath); err != nil {
+			return nil
+		}
+		path = job.sourcePath
+	}
+	img, duration, err := media.ExtractPoster(ctx, m.ffmpeg, path)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	dur := sql.NullFloat64{Float64: duration, Valid: duration > 0}
+	if err != nil {
+		_ = m.store.SetVideoPoster(ctx, job.id, db.PosterFailed, dur)
+		return err
+	}
+	if err := m.writeThumbnails(job, img); err != nil {
+		return err
+	}
+	return m.store.SetVideoPoster(ctx, job.id, db.PosterReady, dur)
+}
+
+func (m *Manager) writeThumbnails(job thumbJob, img *image.RGBA) error {
+	thumbs, err := media.RenderThumbnails(img)
+	if err != nil {
+		return err
+	}
+	for size, body := range thumbs {
+		if err := media.WriteThumbnail(media.ThumbnailPath(job.baseStorage, job.id, size), body, m.libKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package ingest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+)
+
+// fileDone is told how one file went, with the counters ingestFile set for
+// that file alone. Calls never overlap.
+type fileDone func(f pendingFile, res Result, err error)
+
+// ingestAll ingests files on USBVAULT_INGEST_WORKERS workers, or fewer
+// under SetMaxWorkers, calling done after each. With one worker files go in
+// order, hashed ahead on the hash threads; with more, each worker hashes and
+// copies its own file. Records are committed in batches of
+// USBVAULT_INGEST_BATCH_SIZE, and a copied file is only reported done once
+// its batch is; the last batch is committed before ingestAll returns, even
+// when ctx has ended. It stops early, with the context's error, when ctx
+// ends.
+func (m *Manager) ingestAll(ctx context.Context, sess *session, files []pendingFile, done fileDone) error {
+	sess.batch = newRecordBatch(config.IngestBatchSize())
+	sess.done = done
+	defer func() {
+		m.recordMu.Lock()
+		defer m.recordMu.Unlock()
+		m.flushRecords(context.WithoutCancel(ctx), sess)
+	}()
+
+	workers := min(config.IngestWorkers(), len(files))
+	if limit := int(m.maxWorkers.Load()); limit > 0 {
+		workers = min(workers, limit)
+	}
+	if workers <= 1 {
+		return m.ingestInOrder(ctx, sess, files)
+	}
+
+	jobs := make(chan pendingFile)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				m.noteCurrentPath(f.path)
+				var res Result
+				if queued, err := m.ingestFile(ctx, sess, f, nil, &res); !queued {
+					sess.report(f, res, err)
+				}
+			}
+		}()
+	}
+
+	var err error
+	for _, f := range files {
+		if err = m.waitIfPaused(ctx); err != nil {
+			break
+		}
+		select {
+		case jobs <- f:
+			continue
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		break
+	}
+	close(jobs)
+	wg.Wait()
+	return err
+}
+
+func (m *Manager) ingestInOrder(ctx context.Context, sess *session, files []pendingFile) error {
+	hashCtx, stopHashing := context.WithCancel(ctx)
+	defer stopHashing()
+	ahead := m.hashAhead(hashCtx, files)
+	for _, f := range files {
+		if err := m.waitIfPaused(ctx); err != nil {
+			return err
+		}
+		var sums *fileSums
+		if ahead != nil {
+			if sums = <-ahead; sums == nil {
+				return ctx.Err()
+			}
+		}
+		m.noteCurrentPath(f.path)
+		var res Result
+		if queued, err := m.ingestFile(ctx, sess, f, sums, &res); !queued {
+			sess.report(f, res, err)
+		}
+	}
+	return nil
+}
+
+// noteCurrentPath shows path as the file being ingested. With several
+// workers it is the one started last.
+func (m *Manager) noteCurrentPath(path string) {
+	m.bumpStatus(func(st *Status) {
+		st.CurrentPath = path
+		st.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	})
+}
+
+// claimDestination runs pick with a check for paths other workers hold
+// and holds the path it returns until releaseDestination. Paths are
+// compared without case, as the library may be on a case-insensitive drive.
+func (m *Manager) claimDestination(pick func(claimed func(string) bool) (string, error)) (string, error) {
+	m.destMu.Lock()
+	defer m.destMu.Unlock()
+	path, err := pick(func(p string) bool {
+		_, ok := m.destClaims[strings.ToLower(p)]
+		return ok
+	})
+	if err != nil {
+		return "", err
+	}
+	m.destClaims[strings.ToLower(path)] = struct{}{}
+	return path, nil
+}
+
+func (m *Manager) releaseDestination(path string) {
+	m.destMu.Lock()
+	defer m.destMu.Unlock()
+	delete(m.destClaims, strings.ToLower(path))
+}
+
+// add counts one file's outcome into r.
+func (r *Result) add(o Result) {
+	r.Copied += o.Copied
+	r.Duplicates += o.Duplicates
+	r.Skipped += o.Skipped
+	r.Errors += o.Errors
+}
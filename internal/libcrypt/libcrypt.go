@@ -0,0 +1,347 @@
+// Package libcrypt encrypts library media at rest. Each file gets a random
+// key that is wrapped by the library master key and stored in the file's
+// header, so files stay self-describing when moved or restored from backup.
+// Plaintext is sealed in fixed-size AES-GCM chunks, which lets readers seek
+// and serve HTTP range requests without decrypting the whole file.
+package libcrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	fileMagic = "UVLIB001"
+	keyMagic  = "UVLKEY01"
+	keySize   = 32
+	saltSize  = 16
+	chunkSize = 64 << 10
+
+	// magic | wrap nonce | wrapped file key | chunk nonce prefix | plaintext size
+	headerSize = len(fileMagic) + 12 + keySize + 16 + 4 + 8
+)
+
+var (
+	ErrWrongPassphrase = errors.New("wrong library passphrase or corrupted key file")
+	ErrCorrupt         = errors.New("encrypted media is corrupted or was encrypted with a different key")
+)
+
+// Key is the unwrapped library master key.
+type Key struct {
+	master cipher.AEAD
+}
+
+// LoadOrCreateKey unwraps the master key stored at path with passphrase,
+// creating and persisting a new random key the first time.
+func LoadOrCreateKey(path string, passphrase []byte) (*Key, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createKey(path, passphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < len(keyMagic)+saltSize+12 || !bytes.Equal(raw[:len(keyMagic)], []byte(keyMagic)) {
+		return nil, errors.New("not a usbvault library key file")
+	}
+	salt := raw[len(keyMagic) : len(keyMagic)+saltSize]
+	nonce := raw[len(keyMagic)+saltSize : len(keyMagic)+saltSize+12]
+	kek, err := passphraseAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	master, err := kek.Open(nil, nonce, raw[len(keyMagic)+saltSize+12:], raw[:len(keyMagic)])
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return newKey(master)
+}
+
+func createKey(path string, passphrase []byte) (*Key, error) {
+	master := make([]byte, keySize)
+	salt := make([]byte, saltSize)
+	nonce := make([]byte, 12)
+	for _, b := range [][]byte{master, salt, nonce} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+	}
+	kek, err := passphraseAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(keyMagic), salt...)
+	out = append(out, nonce...)
+	out = kek.Seal(out, nonce, master, []byte(keyMagic))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	return newKey(master)
+}
+
+func newKey(master []byte) (*Key, error) {
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{master: aead}, nil
+}
+
+func passphraseAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	kek, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, keySize)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(kek)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted reports whether the file at path starts with the library
+// encryption header. Files ingested before encryption was enabled are not.
+func IsEncrypted(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return HasHeader(f)
+}
+
+// HasHeader is IsEncrypted for a file that is already open, such as an
+// object in remote storage.
+func HasHeader(r io.ReaderAt) bool {
+	buf := make([]byte, len(fileMagic))
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return false
+	}
+	return string(buf) == fileMagic
+}
+
+// EncryptedSize is the on-disk size of a plaintext of n bytes.
+func EncryptedSize(n int64) int64 {
+	chunks := n / chunkSize
+	if n%chunkSize != 0 || n == 0 {
+		chunks++
+	}
+	return int64(headerSize) + n + chunks*16
+}
+
+// Encrypt reads exactly size bytes of plaintext from src and writes the
+// encrypted form to dst.
+func (k *Key) Encrypt(dst io.Writer, src io.Reader, size int64) error {
+	fileKey := make([]byte, keySize)
+	wrapNonce := make([]byte, 12)
+	prefix := make([]byte, 4)
+	for _, b := range [][]byte{fileKey, wrapNonce, prefix} {
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+	}
+	header := make([]byte, 0, headerSize)
+	header = append(header, fileMagic...)
+	header = append(header, wrapNonce...)
+	header = k.master.Seal(header, wrapNonce, fileKey, []byte(fileMagic))
+	header = append(header, prefix...)
+	header = binary.BigEndian.AppendUint64(header, uint64(size))
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(fileKey)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, chunkSize)
+	sealed := make([]byte, 0, chunkSize+aead.Overhead())
+	remaining := size
+	for counter := uint64(0); ; counter++ {
+		n := int64(chunkSize)
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(src, buf[:n]); err != nil {
+			return fmt.Errorf("read plaintext: %w", err)
+		}
+		sealed = aead.Seal(sealed[:0], chunkNonce(prefix, counter), buf[:n], header)
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		remaining -= n
+		if remaining == 0 {
+			return nil
+		}
+	}
+}
+
+// Reader decrypts an encrypted media file. It implements io.ReadSeeker so it
+// can be passed to http.ServeContent.
+type Reader struct {
+	f      ReadAtCloser
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	size   int64
+
+	pos      int64
+	chunkIdx int64
+	chunk    []byte
+	sealed   []byte
+}
+
+// ReadAtCloser is an open encrypted file.
+type ReadAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// Open opens an encrypted media file for reading.
+func (k *Key) Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return k.NewReader(f, info.Size())
+}
+
+// NewReader decrypts f, an encrypted file of size bytes. It takes over f
+// and closes it on failure.
+func (k *Key) NewReader(f ReadAtCloser, size int64) (*Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		_ = f.Close()
+		return nil, ErrCorrupt
+	}
+	if string(header[:len(fileMagic)]) != fileMagic {
+		_ = f.Close()
+		return nil, errors.New("file is not encrypted")
+	}
+	off := len(fileMagic)
+	wrapNonce := header[off : off+12]
+	off += 12
+	fileKey, err := k.master.Open(nil, wrapNonce, header[off:off+keySize+16], []byte(fileMagic))
+	if err != nil {
+		_ = f.Close()
+		return nil, ErrCorrupt
+	}
+	off += keySize + 16
+	aead, err := newAEAD(fileKey)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	plainSize := int64(binary.BigEndian.Uint64(header[off+4:]))
+	if size != EncryptedSize(plainSize) {
+		_ = f.Close()
+		return nil, ErrCorrupt
+	}
+	return &Reader{
+		f:        f,
+		aead:     aead,
+		header:   header,
+		prefix:   header[off : off+4],
+		size:     plainSize,
+		chunkIdx: -1,
+		chunk:    make([]byte, 0, chunkSize),
+		sealed:   make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Size is the plaintext length.
+func (r *Reader) Size() int64 { return r.size }
+
+func (r *Reader) Close() error { return r.f.Close() }
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	idx := r.pos / chunkSize
+	if idx != r.chunkIdx {
+		if err := r.loadChunk(idx); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.chunk[r.pos-idx*chunkSize:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+func (r *Reader) loadChunk(idx int64) error {
+	plainLen := int64(chunkSize)
+	if rest := r.size - idx*chunkSize; rest < plainLen {
+		plainLen = rest
+	}
+	sealedLen := plainLen + int64(r.aead.Overhead())
+	off := int64(headerSize) + idx*int64(chunkSize+r.aead.Overhead())
+	buf := r.sealed[:sealedLen]
+	if _, err := r.f.ReadAt(buf, off); err != nil {
+		return ErrCorrupt
+	}
+	plain, err := r.aead.Open(r.chunk[:0], chunkNonce(r.prefix, uint64(idx)), buf, r.header)
+	if err != nil {
+		return ErrCorrupt
+	}
+	r.chunk = plain
+	r.chunkIdx = idx
+	return nil
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.pos + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = abs
+	return abs, nil
+}
+
+func chunkNonce(prefix []byte, counter uint64) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
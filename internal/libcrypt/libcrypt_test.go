@@ -0,0 +1,85 @@
+package libcrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedFileRoundTripAndSeek(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "library.key")
+	key, err := LoadOrCreateKey(keyPath, []byte("pass"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey: %v", err)
+	}
+	if _, err := LoadOrCreateKey(keyPath, []byte("nope")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("LoadOrCreateKey(wrong) err = %v", err)
+	}
+	// Reloading must yield the same master key.
+	key, err = LoadOrCreateKey(keyPath, []byte("pass"))
+	if err != nil {
+		t.Fatalf("reload key: %v", err)
+	}
+
+	for _, size := range []int{0, 10, chunkSize, 3*chunkSize + 123} {
+		plain := make([]byte, size)
+		if _, err := rand.Read(plain); err != nil {
+			t.Fatalf("rand: %v", err)
+		}
+		path := filepath.Join(dir, "media.bin")
+		var buf bytes.Buffer
+		if err := key.Encrypt(&buf, bytes.NewReader(plain), int64(size)); err != nil {
+			t.Fatalf("Encrypt(size=%d): %v", size, err)
+		}
+		if int64(buf.Len()) != EncryptedSize(int64(size)) {
+			t.Fatalf("encrypted len = %d, want %d", buf.Len(), EncryptedSize(int64(size)))
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if !IsEncrypted(path) {
+			t.Fatalf("IsEncrypted = false")
+		}
+
+		r, err := key.Open(path)
+		if err != nil {
+			t.Fatalf("Open(size=%d): %v", size, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("ReadAll(size=%d) mismatch, err=%v", size, err)
+		}
+		if size > chunkSize {
+			off := int64(chunkSize - 5)
+			if _, err := r.Seek(off, io.SeekStart); err != nil {
+				t.Fatalf("Seek: %v", err)
+			}
+			part := make([]byte, 40)
+			if _, err := io.ReadFull(r, part); err != nil || !bytes.Equal(part, plain[off:off+40]) {
+				t.Fatalf("ranged read across chunk boundary mismatch, err=%v", err)
+			}
+		}
+		_ = r.Close()
+	}
+
+	// Flip a ciphertext byte: reads must fail rather than return garbage.
+	path := filepath.Join(dir, "media.bin")
+	raw, _ := os.ReadFile(path)
+	raw[headerSize+10] ^= 0xff
+	_ = os.WriteFile(path, raw, 0o600)
+	r, err := key.Open(path)
+	if err != nil {
+		t.Fatalf("Open tampered: %v", err)
+	}
+	defer r.Close()
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("ReadAll tampered err = %v, want ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,210 @@
+// Package manifest reads, writes, and compares checksum manifests: one
+// "<sha256>  <path>" line per file, the format sha256sum prints. A vault
+// exports its library as one, and any old archive can be described by
+// running sha256sum over it, so two collections can be compared by content
+// without moving any files.
+package manifest
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+)
+
+// baseStorageSetting is where the vault keeps its library root.
+const baseStorageSetting = "base_storage_dir"
+
+// Entry is one file in a manifest.
+type Entry struct {
+	SHA256 string `json:"sha256"`
+	Path   string `json:"path"`
+}
+
+// Write prints entries in sha256sum format.
+func Write(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriterSize(w, 64<<10)
+	for _, e := range entries {
+		prefix, path := "", e.Path
+		if strings.ContainsAny(path, "\\\n\r") {
+			prefix, path = `\`, pathEscaper.Replace(path)
+		}
+		if _, err := fmt.Fprintf(bw, "%s%s  %s\n", prefix, e.SHA256, path); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// sha256sum marks a line whose path has a backslash or newline with a
+// leading backslash and escapes those characters.
+var (
+	pathEscaper   = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+	pathUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r")
+)
+
+// Library lists every media item in store by content hash. Paths are
+// relative to base storage, so manifests of two vaults line up.
+func Library(ctx context.Context, store *db.Store) ([]Entry, error) {
+	baseStorage, _, err := store.GetSetting(ctx, baseStorageSetting)
+	if err != nil {
+		return nil, err
+	}
+	baseStorage = filepath.Clean(strings.TrimSpace(baseStorage))
+	out := make([]Entry, 0)
+	err = store.MediaChecksums(ctx, func(sum, dest string) error {
+		p := dest
+		if baseStorage != "." && config.IsPathWithin(dest, baseStorage) {
+			if rel, err := filepath.Rel(baseStorage, dest); err == nil {
+				p = rel
+			}
+		}
+		out = append(out, Entry{SHA256: sum, Path: filepath.ToSlash(p)})
+		return nil
+	})
+	return out, err
+}
+
+// Parse reads a sha256sum manifest. Binary-mode lines ("<sha256> *<path>")
+// are accepted, and blank lines and # comments are skipped. Hashes are
+// lowercased.
+func Parse(r io.Reader) ([]Entry, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	var out []Entry
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		escaped := strings.HasPrefix(text, `\`)
+		if escaped {
+			text = text[1:]
+		}
+		sum, path, ok := strings.Cut(text, " ")
+		sum = strings.ToLower(sum)
+		if !ok || !validSHA256(sum) {
+			return nil, fmt.Errorf("line %d: expected \"<sha256>  <path>\"", line)
+		}
+		// sha256sum separates with a space and a mode flag: ' ' text, '*' binary.
+		if strings.HasPrefix(path, " ") || strings.HasPrefix(path, "*") {
+			path = path[1:]
+		}
+		if escaped {
+			path = pathUnescaper.Replace(path)
+		}
+		out = append(out, Entry{SHA256: sum, Path: path})
+	}
+	return out, sc.Err()
+}
+
+func validSHA256(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Diff is how two manifests differ by content. Files whose content appears
+// on both sides are only counted, whatever their paths.
+type Diff struct {
+	LocalFiles  int     `json:"local_files"`
+	RemoteFiles int     `json:"remote_files"`
+	Common      int     `json:"common"` // distinct contents on both sides
+	OnlyLocal   []Entry `json:"only_local"`
+	OnlyRemote  []Entry `json:"only_remote"`
+}
+
+// Compare reports which of local's contents remote lacks and the other way
+// round, each sorted by path.
+func Compare(local, remote []Entry) Diff {
+	localSums := sums(local)
+	remoteSums := sums(remote)
+	d := Diff{
+		LocalFiles:  len(local),
+		RemoteFiles: len(remote),
+		OnlyLocal:   missingFrom(local, remoteSums),
+		OnlyRemote:  missingFrom(remote, localSums),
+	}
+	for sum := range localSums {
+		if _, ok := remoteSums[sum]; ok {
+			d.Common++
+		}
+	}
+	return d
+}
+
+func sums(entries []Entry) map[string]struct{} {
+	out := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		out[e.SHA256] = struct{}{}
+	}
+	return out
+}
+
+func missingFrom(entries []Entry, other map[string]struct{}) []Entry {
+	out := make([]Entry, 0)
+	for _, e := range entries {
+		if _, ok := other[e.SHA256]; !ok {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// HashDir hashes every regular file under root, for an archive that is not
+// in a vault. Paths are relative to root with forward slashes. skip, when
+// set, is called with each directory and returns true to leave it out.
+func HashDir(root string, skip func(dir string) bool) ([]Entry, error) {
+	var out []Entry
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && skip != nil && skip(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		out = append(out, Entry{SHA256: sum, Path: filepath.ToSlash(rel)})
+		return nil
+	})
+	return out, err
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,86 @@
+package manifest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sum(c byte) string { return strings.Repeat(string(c), 64) }
+
+func TestParseSha256sumOutput(t *testing.T) {
+	in := "# made by sha256sum\n" +
+		sum('a') + "  DCIM/100/IMG_0001.JPG\n" +
+		strings.ToUpper(sum('b')) + " *DCIM/100/IMG 0002.JPG\r\n" +
+		"\n" +
+		`\` + sum('c') + `  odd\nname\\x.jpg` + "\n"
+	got, err := Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{
+		{sum('a'), "DCIM/100/IMG_0001.JPG"},
+		{sum('b'), "DCIM/100/IMG 0002.JPG"},
+		{sum('c'), "odd\nname\\x.jpg"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Parse = %q", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Parse(&buf)
+	if err != nil || len(again) != 3 || again[2] != want[2] {
+		t.Errorf("round trip = %q, %v", again, err)
+	}
+
+	if _, err := Parse(strings.NewReader("not-a-hash  x.jpg\n")); err == nil {
+		t.Error("Parse accepted a malformed line")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	local := []Entry{{sum('a'), "2024/a.jpg"}, {sum('b'), "2024/b.jpg"}, {sum('b'), "copy/b.jpg"}}
+	remote := []Entry{{sum('b'), "old/B.JPG"}, {sum('c'), "old/c.jpg"}}
+	d := Compare(local, remote)
+	if d.Common != 1 || d.LocalFiles != 3 || d.RemoteFiles != 2 {
+		t.Errorf("counts = %+v", d)
+	}
+	if len(d.OnlyLocal) != 1 || d.OnlyLocal[0].Path != "2024/a.jpg" {
+		t.Errorf("OnlyLocal = %v", d.OnlyLocal)
+	}
+	if len(d.OnlyRemote) != 1 || d.OnlyRemote[0].Path != "old/c.jpg" {
+		t.Errorf("OnlyRemote = %v", d.OnlyRemote)
+	}
+}
+
+func TestHashDir(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a", "skip"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "x.txt"), []byte("hello\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "skip", "y.txt"), []byte("y"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	got, err := HashDir(root, func(dir string) bool { return filepath.Base(dir) == "skip" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sha256sum of "hello\n".
+	want := Entry{"5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", "a/x.txt"}
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("HashDir = %v", got)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"hash/crc32"
 	"io"
 	"os"
+
+	"businessplan/usbvault/internal/fault"
 )
 
 func ComputeHashes(filePath string) (crcHex string, shaHex string, err error) {
@@ -22,9 +24,9 @@ func ComputeHashesWithProgress(filePath string, onProgress func(int64)) (crcHex
 
 	crc := crc32.NewIEEE()
 	sha := sha256.New()
-	src := io.Reader(f)
+	src := fault.Reader(fault.MediaRead, f)
 	if onProgress != nil {
-		src = &hashProgressReader{r: f, onProgress: onProgress}
+		src = &hashProgressReader{r: src, onProgress: onProgress}
 	}
 	buf := make([]byte, 1024*1024)
 	if _, err := io.CopyBuffer(io.MultiWriter(crc, sha), src, buf); err != nil {
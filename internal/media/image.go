@@ -0,0 +1,192 @@
+package media
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// maxDecodePixels guards against decompression bombs when rendering.
+const maxDecodePixels = 200_000_000
+
+var ErrImageTooLarge = errors.New("image dimensions are too large to render")
+
+// CanDecodeImage reports whether DecodeImage understands files with this
+// extension. RAW, HEIC, and TIFF files have to be delivered as-is.
+func CanDecodeImage(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg", ".jpe", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// DecodeImage decodes a JPEG, PNG, or GIF and applies its EXIF orientation,
+// so the result looks the way the camera showed it.
+func DecodeImage(r io.ReadSeeker) (*image.RGBA, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxDecodePixels {
+		return nil, ErrImageTooLarge
+	}
+	orientation := 1
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if x, err := exif.Decode(r); err == nil {
+		if tag, err := x.Get(exif.Orientation); err == nil {
+			if v, err := tag.Int(0); err == nil {
+				orientation = v
+			}
+		}
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return orient(toRGBA(src), orientation), nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+	return rgba
+}
+
+// orient applies an EXIF orientation (1-8) to img.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			si := img.PixOffset(x, y)
+			di := out.PixOffset(dx, dy)
+			copy(out.Pix[di:di+4], img.Pix[si:si+4])
+		}
+	}
+	return out
+}
+
+// ResizeToFit scales img down so neither side exceeds maxDim, keeping the
+// aspect ratio. Images that already fit are returned unchanged.
+func ResizeToFit(img *image.RGBA, maxDim int) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if maxDim <= 0 || (w <= maxDim && h <= maxDim) {
+		return img
+	}
+	scale := float64(maxDim) / float64(max(w, h))
+	dw := max(1, int(math.Round(float64(w)*scale)))
+	dh := max(1, int(math.Round(float64(h)*scale)))
+	return Resize(img, dw, dh)
+}
+
+// Resize resamples img to w x h with a triangle filter widened by the scale
+// factor, which averages all covered source pixels when shrinking.
+func Resize(img *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	tmp := image.NewRGBA(image.Rect(0, 0, w, sh))
+	for i, c := range contributions(sw, w) {
+		for y := 0; y < sh; y++ {
+			var acc [4]float64
+			for k, wt := range c.weights {
+				off := img.PixOffset(c.start+k, y)
+				for ch := 0; ch < 4; ch++ {
+					acc[ch] += wt * float64(img.Pix[off+ch])
+				}
+			}
+			storePixel(tmp, i, y, acc)
+		}
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for j, c := range contributions(sh, h) {
+		for x := 0; x < w; x++ {
+			var acc [4]float64
+			for k, wt := range c.weights {
+				off := tmp.PixOffset(x, c.start+k)
+				for ch := 0; ch < 4; ch++ {
+					acc[ch] += wt * float64(tmp.Pix[off+ch])
+				}
+			}
+			storePixel(out, x, j, acc)
+		}
+	}
+	return out
+}
+
+type contribution struct {
+	start   int
+	weights []float64
+}
+
+func contributions(srcLen, dstLen int) []contribution {
+	scale := float64(srcLen) / float64(dstLen)
+	support := math.Max(scale, 1)
+	out := make([]contribution, dstLen)
+	for i := range out {
+		center := (float64(i) + 0.5) * scale
+		left := max(0, int(math.Floor(center-support)))
+		right := min(srcLen-1, int(math.Ceil(center+support)))
+		weights := make([]float64, 0, right-left+1)
+		sum := 0.0
+		for j := left; j <= right; j++ {
+			wt := 1 - math.Abs((float64(j)+0.5-center)/support)
+			if wt < 0 {
+				wt = 0
+			}
+			weights = append(weights, wt)
+			sum += wt
+		}
+		if sum == 0 {
+			weights[len(weights)/2], sum = 1, 1
+		}
+		for k := range weights {
+			weights[k] /= sum
+		}
+		out[i] = contribution{start: left, weights: weights}
+	}
+	return out
+}
+
+func storePixel(img *image.RGBA, x, y int, acc [4]float64) {
+	off := img.PixOffset(x, y)
+	for ch := 0; ch < 4; ch++ {
+		img.Pix[off+ch] = uint8(math.Max(0, math.Min(255, math.Round(acc[ch]))))
+	}
+}
@@ -0,0 +1,564 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Files leaving the vault can have their position removed without changing
+// their length: the GPS IFD is emptied, the position text of QuickTime
+// atoms is zeroed, and XMP position values are blanked with spaces. The
+// file's other metadata, and its size, stay as they were, so a stripped
+// file still serves HTTP range requests.
+
+// ErrLocationNotStrippable is returned for files whose position cannot be
+// found reliably: unknown formats and videos with a timed metadata track,
+// which is where action cameras and drones log GPS.
+var ErrLocationNotStrippable = errors.New("location data cannot be removed from this file")
+
+// LocationSpan is a byte range of a file that holds position data and the
+// byte that overwrites it.
+type LocationSpan struct {
+	Off, Len int64
+	Fill     byte
+}
+
+// xmpUUID marks the uuid box MP4, CR3 and other ISO base media files keep
+// an XMP packet in.
+var xmpUUID = []byte{0xbe, 0x7a, 0xcf, 0xcb, 0x97, 0xa9, 0x42, 0xe8, 0x9c, 0x71, 0x99, 0x94, 0x91, 0xe3, 0xaf, 0xac}
+
+// xmpLocation matches XMP properties that hold a position, such as
+// exif:GPSLatitude or drone-dji:GpsLongitude, written as an attribute or
+// an element. The value is the last non-empty group.
+var xmpLocation = regexp.MustCompile(`(?i)[\w-]+:(?:gps\w*|\w*latitude|\w*longitude|\w*altitude)(?:\s*=\s*(?:"([^"]*)"|'([^']*)')|>([^<]*)<)`)
+
+const maxXMPScan = 64 << 20
+
+// CanStripLocation reports whether LocationSpans knows this format.
+func CanStripLocation(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return hasContainerEXIF(ext) || hasVideoAtoms(ext)
+}
+
+// LocationSpans finds the position data in a file. The read position of rs
+// is left at the start.
+func LocationSpans(rs io.ReadSeeker, ext string) ([]LocationSpan, error) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	r := &seekReaderAt{rs: rs}
+	var spans []LocationSpan
+	switch ext = strings.ToLower(ext); {
+	case ext == ".jpg" || ext == ".jpeg":
+		spans, err = jpegLocation(r, 0, size, 0)
+	case ext == ".heic" || ext == ".heif":
+		spans, err = heifLocation(r, size)
+	case ext == ".cr3":
+		spans, err = cr3Location(r, size)
+	case ext == ".raf":
+		spans, err = rafLocation(r, size)
+	case hasContainerEXIF(ext):
+		spans, err = tiffLocation(r, 0, size)
+	case hasVideoAtoms(ext):
+		spans, err = videoLocation(r, size)
+	default:
+		err = ErrLocationNotStrippable
+	}
+	if _, serr := rs.Seek(0, io.SeekStart); err == nil {
+		err = serr
+	}
+	if errors.Is(err, errNoEXIF) {
+		err = ErrLocationNotStrippable
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Off < spans[j].Off })
+	return spans, nil
+}
+
+// WithoutLocation returns a reader over rs with spans overwritten.
+func WithoutLocation(rs io.ReadSeeker, spans []LocationSpan) io.ReadSeeker {
+	return &redactReader{rs: rs, spans: spans}
+}
+
+type redactReader struct {
+	rs    io.ReadSeeker
+	spans []LocationSpan
+	pos   int64
+}
+
+func (r *redactReader) Read(p []byte) (int, error) {
+	n, err := r.rs.Read(p)
+	start, end := r.pos, r.pos+int64(n)
+	for _, s := range r.spans {
+		lo, hi := max(s.Off, start), min(s.Off+s.Len, end)
+		for i := lo; i < hi; i++ {
+			p[i-start] = s.Fill
+		}
+	}
+	r.pos = end
+	return n, err
+}
+
+func (r *redactReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.rs.Seek(offset, whence)
+	if err == nil {
+		r.pos = pos
+	}
+	return pos, err
+}
+
+// seekReaderAt reads at offsets of a ReadSeeker, such as a decrypting
+// library reader, that has no ReadAt of its own.
+type seekReaderAt struct {
+	rs io.ReadSeeker
+}
+
+func (s *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := s.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(s.rs, p)
+}
+
+// jpegLocation walks the segments of a JPEG at start up to the image data:
+// the Exif APP1, XMP APP1s, and the MPF APP2 whose extra images (such as
+// the larger previews phones add) carry EXIF of their own.
+func jpegLocation(r io.ReaderAt, start, end int64, depth int) ([]LocationSpan, error) {
+	var spans []LocationSpan
+	head := make([]byte, 4)
+	if _, err := r.ReadAt(head[:2], start); err != nil || head[0] != 0xff || head[1] != 0xd8 {
+		return nil, ErrLocationNotStrippable
+	}
+	for off := start + 2; off+4 <= end; {
+		if _, err := r.ReadAt(head, off); err != nil {
+			return nil, err
+		}
+		if head[0] != 0xff {
+			return nil, ErrLocationNotStrippable
+		}
+		marker := head[1]
+		switch {
+		case marker == 0xff: // fill byte
+			off++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd8):
+			off += 2
+			continue
+		case marker == 0xda || marker == 0xd9:
+			return spans, nil
+		}
+		length := int64(binary.BigEndian.Uint16(head[2:]))
+		body, next := off+4, off+2+length
+		if length < 2 || next > end {
+			return nil, ErrLocationNotStrippable
+		}
+		switch marker {
+		case 0xe1:
+			id, _ := readBox(r, body, next, 35)
+			switch {
+			case bytes.HasPrefix(id, []byte("Exif\x00\x00")):
+				s, err := tiffLocation(r, body+6, next)
+				if err != nil && !errors.Is(err, errNoEXIF) {
+					return nil, err
+				}
+				spans = append(spans, s...)
+			case bytes.HasPrefix(id, []byte("http://ns.adobe.com/")):
+				s, err := xmpLocationSpans(r, body, next)
+				if err != nil {
+					return nil, err
+				}
+				spans = append(spans, s...)
+			}
+		case 0xe2:
+			if depth > 0 {
+				break
+			}
+			id, _ := readBox(r, body, next, 4)
+			if string(id) == "MPF\x00" {
+				for _, img := range mpfImages(r, body+4, next) {
+					if img <= 0 || img >= end {
+						continue
+					}
+					s, err := jpegLocation(r, img, end, depth+1)
+					if err == nil {
+						spans = append(spans, s...)
+					}
+				}
+			}
+		}
+		off = next
+	}
+	return spans, nil
+}
+
+// mpfImages returns the file offsets of the images after the first that an
+// MPF index lists. Offsets count from the MPF TIFF header.
+func mpfImages(r io.ReaderAt, base, end int64) []int64 {
+	t, ifd0, err := openTIFF(r, base, end)
+	if err != nil {
+		return nil
+	}
+	ifd, err := t.ifd(ifd0)
+	if err != nil {
+		return nil
+	}
+	e, ok := ifd[0xb002]
+	if !ok {
+		return nil
+	}
+	var out []int64
+	for i := 0; i+16 <= len(e.raw); i += 16 {
+		if off := int64(t.bo.Uint32(e.raw[i+8:])); off > 0 {
+			out = append(out, base+off)
+		}
+	}
+	return out
+}
+
+// tiffLocation returns the GPS IFD of the TIFF structure at base, and the
+// position values of its XMP tag.
+func tiffLocation(r io.ReaderAt, base, end int64) ([]LocationSpan, error) {
+	t, ifd0, err := openTIFF(r, base, end)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := t.rawIFD(ifd0)
+	if err != nil {
+		return nil, err
+	}
+	var spans []LocationSpan
+	for _, e := range raw {
+		switch e.tag {
+		case 0x8825:
+			if e.count == 1 && (e.typ == 4 || e.typ == 13) {
+				s, err := t.ifdSpans(int64(e.value))
+				if err != nil {
+					return nil, ErrLocationNotStrippable
+				}
+				spans = append(spans, s...)
+			}
+		case 0x02bc:
+			size := e.count * tiffTypeSize(e.typ)
+			if size > 4 && int64(e.value)+size <= end-base {
+				s, err := xmpLocationSpans(r, base+int64(e.value), base+int64(e.value)+size)
+				if err != nil {
+					return nil, err
+				}
+				spans = append(spans, s...)
+			}
+		}
+	}
+	return spans, nil
+}
+
+type rawIFDEntry struct {
+	tag, typ uint16
+	count    int64
+	value    uint32 // the value itself when it fits, else its offset
+	at       int64  // offset of the entry
+}
+
+// rawIFD reads the entries of the IFD at off without resolving values.
+func (t *tiffReader) rawIFD(off int64) ([]rawIFDEntry, error) {
+	head, err := t.readAt(off, 2)
+	if err != nil {
+		return nil, err
+	}
+	n := int(t.bo.Uint16(head))
+	if n > maxIFDEntries {
+		return nil, errNoEXIF
+	}
+	body, err := t.readAt(off+2, n*12)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]rawIFDEntry, n)
+	for i := range n {
+		e := body[i*12 : i*12+12]
+		out[i] = rawIFDEntry{
+			tag:   t.bo.Uint16(e),
+			typ:   t.bo.Uint16(e[2:]),
+			count: int64(t.bo.Uint32(e[4:])),
+			value: t.bo.Uint32(e[8:]),
+			at:    off + 2 + int64(i)*12,
+		}
+	}
+	return out, nil
+}
+
+// ifdSpans covers an IFD's entries and the values stored outside it. The
+// entry count is zeroed with them, so readers see an empty IFD.
+func (t *tiffReader) ifdSpans(off int64) ([]LocationSpan, error) {
+	raw, err := t.rawIFD(off)
+	if err != nil {
+		return nil, err
+	}
+	spans := []LocationSpan{{Off: t.base + off, Len: 2 + int64(len(raw))*12 + 4}}
+	if t.base+off+spans[0].Len > t.end {
+		spans[0].Len = 2 + int64(len(raw))*12
+	}
+	for _, e := range raw {
+		size := e.count * tiffTypeSize(e.typ)
+		if size <= 4 || int64(e.value)+size > t.end-t.base {
+			continue
+		}
+		spans = append(spans, LocationSpan{Off: t.base + int64(e.value), Len: size})
+	}
+	return spans, nil
+}
+
+// xmpLocationSpans blanks the position values of an XMP packet.
+func xmpLocationSpans(r io.ReaderAt, start, end int64) ([]LocationSpan, error) {
+	if end-start > maxXMPScan {
+		return nil, ErrLocationNotStrippable
+	}
+	b, err := readBox(r, start, end, end-start)
+	if err != nil {
+		return nil, err
+	}
+	var spans []LocationSpan
+	for _, m := range xmpLocation.FindAllSubmatchIndex(b, -1) {
+		for g := 1; g <= 3; g++ {
+			if lo, hi := m[2*g], m[2*g+1]; lo >= 0 && hi > lo {
+				spans = append(spans, LocationSpan{Off: start + int64(lo), Len: int64(hi - lo), Fill: ' '})
+			}
+		}
+	}
+	return spans, nil
+}
+
+// heifLocation covers the Exif item of a HEIC/HEIF file, and XMP anywhere
+// in it, since its mime items are not worth locating one by one.
+func heifLocation(r io.ReaderAt, size int64) ([]LocationSpan, error) {
+	var exifID uint32
+	var locs map[uint32][2]int64
+	err := walkBoxes(r, 0, size, func(typ string, body, next int64) error {
+		if typ != "meta" {
+			return nil
+		}
+		return walkBoxes(r, body+4, next, func(typ string, body, next int64) error {
+			if next-body > maxContainerBox {
+				return nil
+			}
+			var err error
+			switch typ {
+			case "iinf":
+				exifID, err = heifExifItem(r, body, next)
+			case "iloc":
+				locs, err = heifItemLocations(r, body, next)
+			}
+			return err
+		})
+	})
+	if err != nil {
+		return nil, ErrLocationNotStrippable
+	}
+	var spans []LocationSpan
+	if loc, ok := locs[exifID]; exifID != 0 && ok && loc[1] >= 8 {
+		var skip [4]byte
+		if _, err := r.ReadAt(skip[:], loc[0]); err != nil {
+			return nil, err
+		}
+		s, err := tiffLocation(r, loc[0]+4+int64(binary.BigEndian.Uint32(skip[:])), loc[0]+loc[1])
+		if err != nil && !errors.Is(err, errNoEXIF) {
+			return nil, err
+		}
+		spans = append(spans, s...)
+	}
+	s, err := xmpLocationSpans(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	return append(spans, s...), nil
+}
+
+// cr3Location covers the CMT4 box of a Canon CR3, which holds the GPS IFD
+// as its own TIFF structure, and the XMP uuid box.
+func cr3Location(r io.ReaderAt, size int64) ([]LocationSpan, error) {
+	var spans []LocationSpan
+	err := walkBoxes(r, 0, size, func(typ string, body, next int64) error {
+		switch typ {
+		case "uuid":
+			return appendXMPBox(r, body, next, &spans)
+		case "moov":
+			return walkBoxes(r, body, next, func(typ string, body, next int64) error {
+				if typ != "uuid" || next-body < 16 {
+					return nil
+				}
+				id := make([]byte, 16)
+				if _, err := r.ReadAt(id, body); err != nil {
+					return err
+				}
+				if !bytes.Equal(id, cr3UUID) {
+					return nil
+				}
+				return walkBoxes(r, body+16, next, func(typ string, body, next int64) error {
+					if typ != "CMT4" {
+						return nil
+					}
+					t, ifd0, err := openTIFF(r, body, next)
+					if err != nil {
+						return nil
+					}
+					s, err := t.ifdSpans(ifd0)
+					if err != nil {
+						return nil
+					}
+					spans = append(spans, s...)
+					return nil
+				})
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, ErrLocationNotStrippable
+	}
+	return spans, nil
+}
+
+// appendXMPBox adds the position values of a uuid box when it is XMP.
+func appendXMPBox(r io.ReaderAt, body, next int64, spans *[]LocationSpan) error {
+	if next-body < 16 {
+		return nil
+	}
+	id := make([]byte, 16)
+	if _, err := r.ReadAt(id, body); err != nil {
+		return err
+	}
+	if !bytes.Equal(id, xmpUUID) {
+		return nil
+	}
+	s, err := xmpLocationSpans(r, body+16, next)
+	if err != nil {
+		return err
+	}
+	*spans = append(*spans, s...)
+	return nil
+}
+
+// rafLocation covers the JPEG preview of a Fujifilm RAF, which is where
+// its EXIF lives.
+func rafLocation(r io.ReaderAt, size int64) ([]LocationSpan, error) {
+	hdr := make([]byte, 92)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(hdr, []byte("FUJIFILMCCD-RAW")) {
+		return nil, ErrLocationNotStrippable
+	}
+	off, length := int64(binary.BigEndian.Uint32(hdr[84:])), int64(binary.BigEndian.Uint32(hdr[88:]))
+	if off <= 0 || length <= 0 || off+length > size {
+		return nil, ErrLocationNotStrippable
+	}
+	return jpegLocation(r, off, off+length, 0)
+}
+
+// telemetryCodecs are timed metadata tracks that log GPS sample by sample:
+// GoPro GPMF, DJI and camera motion metadata from 360 cameras.
+var telemetryCodecs = map[string]bool{"gpmd": true, "djmd": true, "camm": true}
+
+// videoLocation covers the ©xyz atoms, the QuickTime location keys, and
+// XMP of an MP4 or MOV. A telemetry track makes the file unstrippable.
+func videoLocation(r io.ReaderAt, size int64) ([]LocationSpan, error) {
+	var spans []LocationSpan
+	telemetry := false
+	var walk func(start, end int64) error
+	walk = func(start, end int64) error {
+		return walkBoxes(r, start, end, func(typ string, body, next int64) error {
+			switch typ {
+			case "moov", "trak", "mdia", "minf", "stbl", "udta":
+				return walk(body, next)
+			case "uuid":
+				return appendXMPBox(r, body, next, &spans)
+			case "XMP_":
+				s, err := xmpLocationSpans(r, body, next)
+				if err != nil {
+					return err
+				}
+				spans = append(spans, s...)
+			case "stsd":
+				// version and flags, entry count, then the first sample
+				// entry's size and type.
+				if b, err := readBox(r, body, next, 16); err == nil && len(b) == 16 && telemetryCodecs[string(b[12:16])] {
+					telemetry = true
+				}
+			case "\xa9xyz":
+				// A 16-bit length and language, then the text.
+				if next-body > 4 {
+					spans = append(spans, LocationSpan{Off: body + 4, Len: next - body - 4})
+				}
+			case "meta":
+				s, err := videoKeyLocation(r, body, next)
+				if err != nil {
+					return err
+				}
+				spans = append(spans, s...)
+			}
+			return nil
+		})
+	}
+	if err := walk(0, size); err != nil {
+		return nil, ErrLocationNotStrippable
+	}
+	if telemetry {
+		return nil, ErrLocationNotStrippable
+	}
+	return spans, nil
+}
+
+// videoKeyLocation covers the values of QuickTime location keys.
+func videoKeyLocation(r io.ReaderAt, start, end int64) ([]LocationSpan, error) {
+	if b, err := readBox(r, start, end, 8); err == nil && len(b) == 8 && string(b[4:8]) != "hdlr" {
+		start += 4
+	}
+	var keys []string
+	var spans []LocationSpan
+	err := walkBoxes(r, start, end, func(typ string, body, next int64) error {
+		switch typ {
+		case "keys":
+			b, err := readBox(r, body, next, maxContainerBox)
+			if err != nil || len(b) < 8 {
+				return nil
+			}
+			c := byteCursor{b: b}
+			c.skip(4)
+			count := c.uint(4)
+			for i := uint64(0); i < count && !c.bad; i++ {
+				size := int(c.uint(4))
+				c.skip(4)
+				if size < 8 || c.pos+size-8 > len(b) {
+					break
+				}
+				keys = append(keys, string(b[c.pos:c.pos+size-8]))
+				c.skip(size - 8)
+			}
+		case "ilst":
+			return walkBoxes(r, body, next, func(typ string, body, next int64) error {
+				idx := int(binary.BigEndian.Uint32([]byte(typ)))
+				if idx < 1 || idx > len(keys) || !strings.Contains(keys[idx-1], ".location.") {
+					return nil
+				}
+				return walkBoxes(r, body, next, func(typ string, body, next int64) error {
+					if typ == "data" && next-body > 8 {
+						spans = append(spans, LocationSpan{Off: body + 8, Len: next - body - 8})
+					}
+					return nil
+				})
+			})
+		}
+		return nil
+	})
+	return spans, err
+}
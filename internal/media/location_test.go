@@ -0,0 +1,156 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stripTestFile strips the position from a file written under name and
+// returns the path of the stripped copy.
+func stripTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	spans, err := LocationSpans(bytes.NewReader(data), filepath.Ext(name))
+	if err != nil {
+		t.Fatalf("LocationSpans: %v", err)
+	}
+	if len(spans) == 0 {
+		t.Fatal("no location spans found")
+	}
+	out, err := io.ReadAll(WithoutLocation(bytes.NewReader(data), spans))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(data) {
+		t.Fatalf("stripped file is %d bytes, want %d", len(out), len(data))
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, out, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStripLocationJPEG(t *testing.T) {
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	segment := func(marker byte, body []byte) []byte {
+		return append([]byte{0xff, marker, byte((len(body) + 2) >> 8), byte(len(body) + 2)}, body...)
+	}
+	tiff := buildTestTIFF(testIFD{tags: testIFD0, exif: &testExif, gps: &testGPS})
+	xmp := `http://ns.adobe.com/xap/1.0/` + "\x00" +
+		`<x:xmpmeta><rdf:Description exif:GPSLatitude="48,8.1N" drone-dji:GpsLongitude='-11.575' tiff:Make="Canon">` +
+		`<exif:GPSAltitude>520/1</exif:GPSAltitude></rdf:Description></x:xmpmeta>`
+	data := bytes.Join([][]byte{
+		{0xff, 0xd8},
+		segment(0xe1, append([]byte("Exif\x00\x00"), tiff...)),
+		segment(0xe1, []byte(xmp)),
+		img.Bytes()[2:],
+	}, nil)
+
+	path := stripTestFile(t, "IMG_0001.JPG", data)
+	meta, err := ExtractMetadata(path, "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.GPSLat.Valid || meta.GPSLon.Valid {
+		t.Fatalf("position survived: %v, %v", meta.GPSLat, meta.GPSLon)
+	}
+	if meta.Make.String != "Canon" || meta.CaptureFromMTime {
+		t.Fatalf("other metadata lost: make %q capture %q", meta.Make.String, meta.CaptureTime)
+	}
+	out, _ := os.ReadFile(path)
+	for _, leak := range []string{"48,8.1N", "-11.575", "520/1"} {
+		if bytes.Contains(out, []byte(leak)) {
+			t.Fatalf("XMP value %q survived", leak)
+		}
+	}
+	if !bytes.Contains(out, []byte(`tiff:Make="Canon"`)) {
+		t.Fatal("XMP lost values that are not a position")
+	}
+}
+
+func TestStripLocationTIFFAndCR3(t *testing.T) {
+	raw := buildTestTIFF(testIFD{tags: testIFD0, exif: &testExif, gps: &testGPS})
+	uuid := box("uuid", cr3UUID,
+		box("CMT1", buildTestTIFF(testIFD{tags: testIFD0})),
+		box("CMT2", buildTestTIFF(testExif)),
+		box("CMT4", buildTestTIFF(testGPS)),
+	)
+	cr3 := bytes.Join([][]byte{box("ftyp", []byte("crx \x00\x00\x00\x01crx isom")), box("moov", uuid)}, nil)
+
+	for name, data := range map[string][]byte{"IMG_0001.NEF": raw, "IMG_0002.CR3": cr3} {
+		path := stripTestFile(t, name, data)
+		meta, err := ExtractMetadata(path, "image")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if meta.GPSLat.Valid || meta.Model.String != "EOS R5" {
+			t.Fatalf("%s: position %v, model %q", name, meta.GPSLat, meta.Model.String)
+		}
+	}
+}
+
+func TestStripLocationVideo(t *testing.T) {
+	key := func(name string) []byte { return append(be32(uint32(8+len(name))), append([]byte("mdta"), name...)...) }
+	value := func(idx uint32, s string) []byte {
+		return append(be32(uint32(8+8+8+len(s))), append(be32(idx), box("data", be32(1), be32(0), []byte(s))...)...)
+	}
+	meta := box("meta",
+		box("hdlr", be32(0), be32(0), []byte("mdta"), make([]byte, 12)),
+		box("keys", be32(0), be32(2), key("com.apple.quicktime.location.ISO6709"), key("com.apple.quicktime.make")),
+		box("ilst", value(1, "+48.1351+011.5820+520.000/"), value(2, "Apple")),
+	)
+	text := func(typ, s string) []byte {
+		return box(typ, binary.BigEndian.AppendUint16(nil, uint16(len(s))), []byte{0x15, 0xc7}, []byte(s))
+	}
+	created := time.Date(2024, 5, 31, 20, 0, 0, 0, time.UTC)
+	path := writeTestVideo(t, "IMG_0001.MOV", testMvhd(created, 12), testVideoTrak("hvc1", 1920, 1080), meta,
+		box("udta", text("\xa9xyz", "-33.8688+151.2093/")))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stripped := stripTestFile(t, "IMG_0001.MOV", data)
+	got, err := ExtractMetadata(stripped, "video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GPSLat.Valid || got.Make.String != "Apple" || got.VideoCodec.String != "hvc1" {
+		t.Fatalf("position %v make %q codec %q", got.GPSLat, got.Make.String, got.VideoCodec.String)
+	}
+	out, _ := os.ReadFile(stripped)
+	if bytes.Contains(out, []byte("151.2093")) || bytes.Contains(out, []byte("011.5820")) {
+		t.Fatal("position text survived")
+	}
+}
+
+func TestStripLocationRefusesTelemetry(t *testing.T) {
+	entry := make([]byte, 16)
+	binary.BigEndian.PutUint32(entry, 16)
+	copy(entry[4:8], "gpmd")
+	gpmd := box("trak", box("mdia", box("hdlr", be32(0), be32(0), []byte("meta"), make([]byte, 12)),
+		box("minf", box("stbl", box("stsd", be32(0), be32(1), entry)))))
+	path := writeTestVideo(t, "GX010001.MP4", testMvhd(time.Now(), 5), testVideoTrak("avc1", 1920, 1080), gpmd)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LocationSpans(bytes.NewReader(data), ".MP4"); !errors.Is(err, ErrLocationNotStrippable) {
+		t.Fatalf("err = %v, want ErrLocationNotStrippable", err)
+	}
+	if _, err := LocationSpans(strings.NewReader("not a png"), ".png"); !errors.Is(err, ErrLocationNotStrippable) {
+		t.Fatalf("png err = %v", err)
+	}
+}
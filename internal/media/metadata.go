@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -24,6 +25,14 @@ type ExtractedMetadata struct {
 	CameraPitch sql.NullFloat64
 	CameraRoll  sql.NullFloat64
 	RawJSON     string
+	// Videos only.
+	DurationSec sql.NullFloat64
+	VideoCodec  sql.NullString
+	Width       sql.NullInt64
+	Height      sql.NullInt64
+	// CaptureFromMTime is set when CaptureTime is the file's modification
+	// time because the file carries no capture date of its own.
+	CaptureFromMTime bool
 }
 
 var (
@@ -44,6 +53,23 @@ func ExtractMetadata(filePath, kind string) (ExtractedMetadata, error) {
 			raw["exif_error"] = err.Error()
 		}
 	}
+	if kind == "video" && hasVideoAtoms(filepath.Ext(filePath)) {
+		videoMeta, err := parseVideoAtoms(filePath)
+		if err == nil {
+			meta = videoMeta
+		} else if !errors.Is(err, errNoVideoMetadata) {
+			raw["video_error"] = err.Error()
+		}
+		if meta.DurationSec.Valid {
+			raw["duration_seconds"] = meta.DurationSec.Float64
+		}
+		if meta.VideoCodec.Valid {
+			raw["video_codec"] = meta.VideoCodec.String
+		}
+		if meta.Width.Valid {
+			raw["width"], raw["height"] = meta.Width.Int64, meta.Height.Int64
+		}
+	}
 
 	if yaw, ok := parseDJIValue(filePath, regexYaw); ok {
 		meta.CameraYaw = sql.NullFloat64{Float64: yaw, Valid: true}
@@ -62,6 +88,7 @@ func ExtractMetadata(filePath, kind string) (ExtractedMetadata, error) {
 		if info, err := os.Stat(filePath); err == nil {
 			meta.CaptureTime = info.ModTime().UTC().Format(time.RFC3339)
 			raw["capture_time_fallback"] = "source_mod_time"
+			meta.CaptureFromMTime = true
 		}
 	}
 
@@ -85,11 +112,19 @@ func parseImageEXIF(filePath string) (ExtractedMetadata, error) {
 	}
 	defer f.Close()
 
+	if ext := filepath.Ext(filePath); hasContainerEXIF(ext) {
+		return parseContainerEXIF(f, ext)
+	}
 	x, err := exif.Decode(f)
 	if err != nil {
 		return ExtractedMetadata{}, err
 	}
+	return metadataFromEXIF(x), nil
+}
 
+// metadataFromEXIF keeps the capture time, position and camera of decoded
+// EXIF data.
+func metadataFromEXIF(x *exif.Exif) ExtractedMetadata {
 	out := ExtractedMetadata{}
 	if tm, err := x.DateTime(); err == nil {
 		out.CaptureTime = tm.UTC().Format(time.RFC3339)
@@ -114,7 +149,7 @@ func parseImageEXIF(filePath string) (ExtractedMetadata, error) {
 			}
 		}
 	}
-	return out, nil
+	return out
 }
 
 func parseDJIValue(filePath string, rx *regexp.Regexp) (float64, bool) {
@@ -0,0 +1,249 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/jpeg"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrNoPreview means a RAW file carries no JPEG preview this package can
+// decode.
+var ErrNoPreview = errors.New("no embedded preview")
+
+const (
+	maxPreviewIFDs  = 32
+	maxPreviewBytes = 32 << 20
+)
+
+// HasEmbeddedPreview reports whether files with this extension are RAW
+// formats whose camera-made JPEG preview EmbeddedJPEG can pull out: the
+// TIFF-based ones, Canon CR3 and Fujifilm RAF.
+func HasEmbeddedPreview(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".dng", ".arw", ".cr2", ".nef", ".nrw", ".pef", ".srw", ".rw2", ".orf", ".tif", ".tiff", ".cr3", ".raf":
+		return true
+	}
+	return false
+}
+
+// cr3PreviewUUID marks the top-level uuid box of a CR3 that holds the
+// PRVW box, a JPEG of about 1620x1080.
+var cr3PreviewUUID = []byte{0xea, 0xf4, 0x2b, 0x5e, 0x1c, 0x98, 0x4b, 0x88, 0xb9, 0xfb, 0xb7, 0xdc, 0x40, 0x6e, 0x4d, 0x16}
+
+type previewCandidate struct {
+	offset, length int64
+}
+
+// EmbeddedJPEG returns the largest decodable JPEG stored in a RAW file,
+// along with the orientation recorded in a TIFF-based file's first IFD (1
+// when none is recorded). Cameras embed a full-size or near full-size
+// preview, so this is far cheaper than developing the sensor data.
+func EmbeddedJPEG(r io.ReadSeeker) ([]byte, int, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+	head := make([]byte, 92)
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	n, _ := io.ReadFull(r, head)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("FUJIFILMCCD-RAW")):
+		return rafPreview(r, head, size)
+	case len(head) >= 12 && string(head[4:12]) == "ftypcrx ":
+		return cr3Preview(r, size)
+	}
+	readAt := func(off int64, n int) ([]byte, error) {
+		if off < 0 || off+int64(n) > size {
+			return nil, ErrNoPreview
+		}
+		if _, err := r.Seek(off, io.SeekStart); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+
+	hdr, err := readAt(0, 8)
+	if err != nil {
+		return nil, 0, err
+	}
+	var bo binary.ByteOrder
+	switch string(hdr[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, 0, ErrNoPreview
+	}
+
+	orientation := 0
+	var candidates []previewCandidate
+	queue := []int64{int64(bo.Uint32(hdr[4:]))}
+	seen := map[int64]bool{}
+	for len(queue) > 0 && len(seen) < maxPreviewIFDs {
+		off := queue[0]
+		queue = queue[1:]
+		if off == 0 || seen[off] {
+			continue
+		}
+		seen[off] = true
+		countBuf, err := readAt(off, 2)
+		if err != nil {
+			continue
+		}
+		count := int(bo.Uint16(countBuf))
+		entries, err := readAt(off+2, count*12+4)
+		if err != nil {
+			continue
+		}
+
+		var jpegOffset, jpegLength, stripOffset, stripLength int64
+		compression := 0
+		for i := 0; i < count; i++ {
+			e := entries[i*12 : i*12+12]
+			tag, typ, n := bo.Uint16(e), bo.Uint16(e[2:]), bo.Uint32(e[4:])
+			value := int64(bo.Uint32(e[8:]))
+			if typ == 3 {
+				value = int64(bo.Uint16(e[8:]))
+			}
+			switch tag {
+			case 0x0112: // Orientation
+				if len(seen) == 1 {
+					orientation = int(value)
+				}
+			case 0x014A: // SubIFDs
+				if n == 1 {
+					queue = append(queue, value)
+				} else if n <= maxPreviewIFDs {
+					if list, err := readAt(value, int(n)*4); err == nil {
+						for j := 0; j < int(n); j++ {
+							queue = append(queue, int64(bo.Uint32(list[j*4:])))
+						}
+					}
+				}
+			case 0x0201: // JPEGInterchangeFormat
+				jpegOffset = value
+			case 0x0202: // JPEGInterchangeFormatLength
+				jpegLength = value
+			case 0x0103: // Compression
+				compression = int(value)
+			case 0x0111: // StripOffsets
+				if n == 1 {
+					stripOffset = value
+				}
+			case 0x0117: // StripByteCounts
+				if n == 1 {
+					stripLength = value
+				}
+			case 0x002E: // Panasonic JpgFromRaw
+				candidates = append(candidates, previewCandidate{value, int64(n)})
+			}
+		}
+		if jpegOffset > 0 && jpegLength > 0 {
+			candidates = append(candidates, previewCandidate{jpegOffset, jpegLength})
+		}
+		if (compression == 6 || compression == 7) && stripOffset > 0 && stripLength > 0 {
+			candidates = append(candidates, previewCandidate{stripOffset, stripLength})
+		}
+		queue = append(queue, int64(bo.Uint32(entries[count*12:])))
+	}
+
+	// DNG keeps its lossless JPEG sensor data in strips too; Go cannot
+	// decode those, so the largest candidate that decodes wins.
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].length > candidates[j].length })
+	for _, c := range candidates {
+		if c.length > maxPreviewBytes {
+			continue
+		}
+		body, err := readAt(c.offset, int(c.length))
+		if err != nil || len(body) < 2 || body[0] != 0xFF || body[1] != 0xD8 {
+			continue
+		}
+		if _, err := jpeg.DecodeConfig(bytes.NewReader(body)); err != nil {
+			continue
+		}
+		if orientation == 0 {
+			orientation = 1
+		}
+		return body, orientation, nil
+	}
+	return nil, 0, ErrNoPreview
+}
+
+// checkedJPEG returns body when it is a JPEG Go can decode.
+func checkedJPEG(body []byte) ([]byte, int, error) {
+	if len(body) < 2 || body[0] != 0xFF || body[1] != 0xD8 {
+		return nil, 0, ErrNoPreview
+	}
+	if _, err := jpeg.DecodeConfig(bytes.NewReader(body)); err != nil {
+		return nil, 0, ErrNoPreview
+	}
+	return body, 1, nil
+}
+
+// rafPreview reads the JPEG a Fujifilm RAF names in its header.
+func rafPreview(r io.ReadSeeker, head []byte, size int64) ([]byte, int, error) {
+	if len(head) < 92 {
+		return nil, 0, ErrNoPreview
+	}
+	off, length := int64(binary.BigEndian.Uint32(head[84:])), int64(binary.BigEndian.Uint32(head[88:]))
+	if off <= 0 || length <= 0 || length > maxPreviewBytes || off+length > size {
+		return nil, 0, ErrNoPreview
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(io.NewSectionReader(&seekReaderAt{rs: r}, off, length), body); err != nil {
+		return nil, 0, err
+	}
+	return checkedJPEG(body)
+}
+
+// cr3Preview reads the PRVW box of a Canon CR3. The JPEG starts a few
+// header bytes into the box and runs to its end.
+func cr3Preview(r io.ReadSeeker, size int64) ([]byte, int, error) {
+	ra := &seekReaderAt{rs: r}
+	var body []byte
+	err := walkBoxes(ra, 0, size, func(typ string, start, next int64) error {
+		if typ != "uuid" || next-start < 16+8 {
+			return nil
+		}
+		id := make([]byte, 16)
+		if _, err := ra.ReadAt(id, start); err != nil {
+			return err
+		}
+		if !bytes.Equal(id, cr3PreviewUUID) {
+			return nil
+		}
+		// The uuid is followed by 8 bytes of Canon's own before the boxes.
+		return walkBoxes(ra, start+16+8, next, func(typ string, start, next int64) error {
+			if typ != "PRVW" || next-start > maxPreviewBytes {
+				return nil
+			}
+			box, err := readBox(ra, start, next, maxPreviewBytes)
+			if err != nil {
+				return err
+			}
+			if i := bytes.Index(box[:min(len(box), 64)], []byte{0xFF, 0xD8, 0xFF}); i >= 0 {
+				body = box[i:]
+			}
+			return errStopWalk
+		})
+	})
+	if err != nil && !errors.Is(err, errNoEXIF) {
+		return nil, 0, err
+	}
+	if body == nil {
+		return nil, 0, ErrNoPreview
+	}
+	return checkedJPEG(body)
+}
@@ -0,0 +1,126 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// tiffWithPreview builds a little-endian TIFF whose IFD0 records an
+// orientation and points at preview through JPEGInterchangeFormat, the
+// way NEF and CR2 files carry theirs.
+func tiffWithPreview(t *testing.T, preview []byte, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	buf.WriteString("II")
+	_ = binary.Write(&buf, le, uint16(42))
+	_ = binary.Write(&buf, le, uint32(8))
+
+	const entries = 3
+	dataOffset := uint32(8 + 2 + entries*12 + 4)
+	_ = binary.Write(&buf, le, uint16(entries))
+	writeEntry := func(tag, typ uint16, count, value uint32) {
+		_ = binary.Write(&buf, le, tag)
+		_ = binary.Write(&buf, le, typ)
+		_ = binary.Write(&buf, le, count)
+		_ = binary.Write(&buf, le, value)
+	}
+	writeEntry(0x0112, 3, 1, uint32(orientation))
+	writeEntry(0x0201, 4, 1, dataOffset)
+	writeEntry(0x0202, 4, 1, uint32(len(preview)))
+	_ = binary.Write(&buf, le, uint32(0))
+	buf.Write(preview)
+	return buf.Bytes()
+}
+
+func TestDecodeThumbnailSourceUsesEmbeddedPreview(t *testing.T) {
+	var preview bytes.Buffer
+	if err := jpeg.Encode(&preview, image.NewRGBA(image.Rect(0, 0, 64, 32)), nil); err != nil {
+		t.Fatal(err)
+	}
+	raw := tiffWithPreview(t, preview.Bytes(), 6)
+
+	body, orientation, err := EmbeddedJPEG(bytes.NewReader(raw))
+	if err != nil || orientation != 6 || !bytes.Equal(body, preview.Bytes()) {
+		t.Fatalf("EmbeddedJPEG = %d bytes, orientation %d, %v", len(body), orientation, err)
+	}
+	img, err := DecodeThumbnailSource(bytes.NewReader(raw), ".NEF")
+	if err != nil {
+		t.Fatalf("DecodeThumbnailSource: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 64 {
+		t.Fatalf("preview is %dx%d, want it turned to 32x64", b.Dx(), b.Dy())
+	}
+
+	if _, _, err := EmbeddedJPEG(bytes.NewReader(tiffWithPreview(t, []byte("not a jpeg"), 1))); err != ErrNoPreview {
+		t.Fatalf("bogus preview err = %v", err)
+	}
+}
+
+func TestRenderThumbnailsFitsEverySize(t *testing.T) {
+	thumbs, err := RenderThumbnails(image.NewRGBA(image.Rect(0, 0, 2000, 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range ThumbnailSizes {
+		img, err := jpeg.Decode(bytes.NewReader(thumbs[size]))
+		if err != nil {
+			t.Fatalf("%d px: %v", size, err)
+		}
+		if b := img.Bounds(); b.Dx() != size || b.Dy() != size/2 {
+			t.Fatalf("%d px thumbnail is %dx%d", size, b.Dx(), b.Dy())
+		}
+	}
+}
+
+func TestEmbeddedJPEGReadsCR3AndRAF(t *testing.T) {
+	var preview bytes.Buffer
+	if err := jpeg.Encode(&preview, image.NewRGBA(image.Rect(0, 0, 48, 32)), nil); err != nil {
+		t.Fatal(err)
+	}
+	box := func(typ string, body []byte) []byte {
+		out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+		return append(append(out, typ...), body...)
+	}
+
+	// A PRVW box has a few header bytes of Canon's own before the JPEG.
+	prvw := box("PRVW", append(make([]byte, 16), preview.Bytes()...))
+	uuid := box("uuid", append(append(append([]byte{}, cr3PreviewUUID...), make([]byte, 8)...), prvw...))
+	cr3 := append(box("ftyp", []byte("crx \x00\x00\x00\x01")), box("moov", nil)...)
+	cr3 = append(cr3, uuid...)
+	body, _, err := EmbeddedJPEG(bytes.NewReader(cr3))
+	if err != nil || !bytes.Equal(body, preview.Bytes()) {
+		t.Fatalf("cr3 preview = %d bytes, %v", len(body), err)
+	}
+
+	raf := make([]byte, 100)
+	copy(raf, "FUJIFILMCCD-RAW 0201")
+	binary.BigEndian.PutUint32(raf[84:], uint32(len(raf)))
+	binary.BigEndian.PutUint32(raf[88:], uint32(preview.Len()))
+	raf = append(raf, preview.Bytes()...)
+	if body, _, err := EmbeddedJPEG(bytes.NewReader(raf)); err != nil || !bytes.Equal(body, preview.Bytes()) {
+		t.Fatalf("raf preview = %d bytes, %v", len(body), err)
+	}
+}
+
+func TestDecodePPM(t *testing.T) {
+	ppm := append([]byte("P6\n# dcraw\n2 1\n65535\n"),
+		0xff, 0xff, 0, 0, 0, 0, // red
+		0, 0, 0, 0, 0x80, 0x00) // half blue
+	img, err := decodePPM(bytes.NewReader(ppm))
+	if err != nil {
+		t.Fatalf("decodePPM: %v", err)
+	}
+	if got := img.RGBAAt(0, 0); got.R != 255 || got.G != 0 || got.B != 0 || got.A != 255 {
+		t.Fatalf("pixel 0 = %+v", got)
+	}
+	if got := img.RGBAAt(1, 0); got.B != 127 {
+		t.Fatalf("pixel 1 = %+v", got)
+	}
+	if _, err := decodePPM(bytes.NewReader([]byte("P3\n1 1\n255\n0 0 0\n"))); err == nil {
+		t.Fatal("ascii PPM accepted")
+	}
+}
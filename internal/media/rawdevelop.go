@@ -0,0 +1,153 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoRAWConverter means no dcraw-compatible program is configured, so
+// RAW files without an embedded preview cannot be shown.
+var ErrNoRAWConverter = errors.New("no RAW converter is available")
+
+const (
+	developTimeout   = 2 * time.Minute
+	developStderrMax = 64 << 10
+)
+
+// IsRAW reports whether files with this extension hold camera sensor data
+// a browser cannot show.
+func IsRAW(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".dng", ".arw", ".cr2", ".cr3", ".nef", ".nrw", ".orf", ".raf", ".rw2", ".srw", ".x3f", ".3fr", ".iiq", ".pef":
+		return true
+	}
+	return false
+}
+
+// DevelopRAW has a dcraw-compatible converter develop the RAW file at
+// path at half size with the camera's white balance. It is the fallback
+// for files whose embedded preview cannot be read.
+func DevelopRAW(ctx context.Context, converter, path string) (*image.RGBA, error) {
+	if converter == "" {
+		return nil, ErrNoRAWConverter
+	}
+	ctx, cancel := context.WithTimeout(ctx, developTimeout)
+	defer cancel()
+
+	// -c writes to stdout, -w uses the camera white balance and -h
+	// develops at half size, which is plenty for a screen and four times
+	// faster. The ./ keeps a name starting with "-" from reading as a flag.
+	if !strings.HasPrefix(path, "/") {
+		path = "./" + path
+	}
+	cmd := exec.CommandContext(ctx, converter, "-c", "-w", "-h", path)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("raw converter timed out after %s", developTimeout)
+		}
+		msg := stderr.String()
+		if len(msg) > developStderrMax {
+			msg = msg[len(msg)-developStderrMax:]
+		}
+		if lines := strings.Split(strings.TrimSpace(msg), "\n"); len(lines) > 0 && lines[len(lines)-1] != "" {
+			return nil, fmt.Errorf("raw converter: %w: %s", err, lines[len(lines)-1])
+		}
+		return nil, fmt.Errorf("raw converter: %w", err)
+	}
+	return decodePPM(&stdout)
+}
+
+// decodePPM reads the binary PPM (P6) dcraw writes, with 8 or 16 bits per
+// sample.
+func decodePPM(r io.Reader) (*image.RGBA, error) {
+	br := bufio.NewReader(r)
+	var fields []int
+	magic := ""
+	for len(fields) < 3 {
+		tok, err := ppmToken(br)
+		if err != nil {
+			return nil, fmt.Errorf("ppm header: %w", err)
+		}
+		if magic == "" {
+			if tok != "P6" {
+				return nil, fmt.Errorf("ppm: not a binary PPM (%q)", tok)
+			}
+			magic = tok
+			continue
+		}
+		n, err := strconv.Atoi(tok)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("ppm header: bad number %q", tok)
+		}
+		fields = append(fields, n)
+	}
+	width, height, maxVal := fields[0], fields[1], fields[2]
+	if int64(width)*int64(height) > maxDecodePixels {
+		return nil, ErrImageTooLarge
+	}
+	if maxVal > 65535 {
+		return nil, fmt.Errorf("ppm: max value %d is out of range", maxVal)
+	}
+	sample := 1
+	if maxVal > 255 {
+		sample = 2
+	}
+	row := make([]byte, width*3*sample)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		if _, err := io.ReadFull(br, row); err != nil {
+			return nil, fmt.Errorf("ppm data: %w", err)
+		}
+		out := img.Pix[y*img.Stride:]
+		for x := range width {
+			for c := range 3 {
+				v := int(row[(x*3+c)*sample])
+				if sample == 2 {
+					v = v<<8 | int(row[(x*3+c)*2+1])
+				}
+				out[x*4+c] = byte(v * 255 / maxVal)
+			}
+			out[x*4+3] = 0xff
+		}
+	}
+	return img, nil
+}
+
+// ppmToken reads the next whitespace-separated header field, skipping
+// comments, and the single whitespace byte after it.
+func ppmToken(br *bufio.Reader) (string, error) {
+	var tok []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case b == '#' && len(tok) == 0:
+			if _, err := br.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r':
+			if len(tok) > 0 {
+				return string(tok), nil
+			}
+		default:
+			if len(tok) >= 16 {
+				return "", errors.New("header field too long")
+			}
+			tok = append(tok, b)
+		}
+	}
+}
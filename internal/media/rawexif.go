@@ -0,0 +1,583 @@
+package media
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// goexif reads a whole TIFF into memory, twice, and does not know the
+// HEIF or CR3 containers. The formats below are read here instead, by
+// walking only the IFDs that hold the capture date, camera and GPS
+// position.
+
+// errNoEXIF reads as a missing-EXIF error to isNoExifError.
+var errNoEXIF = errors.New("no exif data found")
+
+const (
+	maxIFDEntries   = 1000
+	maxIFDValue     = 64 << 10
+	maxContainerBox = 1 << 20
+)
+
+// cr3UUID marks the uuid box in a CR3 moov box that holds the CMT boxes.
+var cr3UUID = []byte{0x85, 0xc0, 0xb6, 0x87, 0x82, 0x0f, 0x11, 0xe0, 0x81, 0x11, 0xf4, 0xce, 0x46, 0x2b, 0x6a, 0x48}
+
+// hasContainerEXIF reports whether parseContainerEXIF reads this format.
+func hasContainerEXIF(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".tif", ".tiff", ".dng", ".arw", ".cr2", ".nef", ".nrw", ".pef", ".srw", ".rw2", ".orf", ".3fr",
+		".heic", ".heif", ".cr3", ".raf":
+		return true
+	}
+	return false
+}
+
+// parseContainerEXIF reads the metadata of a TIFF-based RAW, HEIC/HEIF,
+// CR3 or RAF file.
+func parseContainerEXIF(f *os.File, ext string) (ExtractedMetadata, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return ExtractedMetadata{}, err
+	}
+	size := info.Size()
+
+	var fields exifFields
+	switch strings.ToLower(ext) {
+	case ".heic", ".heif":
+		err = heifEXIF(f, size, &fields)
+	case ".cr3":
+		err = cr3EXIF(f, size, &fields)
+	case ".raf":
+		return rafEXIF(f, size)
+	default:
+		var t *tiffReader
+		var ifd0 int64
+		if t, ifd0, err = openTIFF(f, 0, size); err == nil {
+			t.readIFD0(ifd0, &fields)
+		}
+	}
+	if err != nil {
+		return ExtractedMetadata{}, err
+	}
+	return fields.metadata()
+}
+
+// exifFields are the tags ExtractMetadata keeps. The first value found
+// for each wins.
+type exifFields struct {
+	make, model        string
+	original, modified string // DateTimeOriginal and DateTime
+	offset             string // OffsetTimeOriginal, e.g. "+02:00"
+	latRef, lonRef     string
+	lat, lon           []float64
+}
+
+func (f exifFields) metadata() (ExtractedMetadata, error) {
+	var out ExtractedMetadata
+	stamp := f.original
+	if stamp == "" {
+		stamp = f.modified
+	}
+	if stamp != "" {
+		zone := time.Local
+		if tz, err := time.Parse("-07:00", f.offset); err == nil {
+			_, secs := tz.Zone()
+			zone = time.FixedZone("", secs)
+		}
+		if tm, err := time.ParseInLocation("2006:01:02 15:04:05", stamp, zone); err == nil {
+			out.CaptureTime = tm.UTC().Format(time.RFC3339)
+		}
+	}
+	if lat, ok := gpsDegrees(f.lat, f.latRef, "S"); ok {
+		if lon, ok := gpsDegrees(f.lon, f.lonRef, "W"); ok {
+			out.GPSLat = sql.NullFloat64{Float64: lat, Valid: true}
+			out.GPSLon = sql.NullFloat64{Float64: lon, Valid: true}
+		}
+	}
+	if f.make != "" {
+		out.Make = sql.NullString{String: f.make, Valid: true}
+	}
+	if f.model != "" {
+		out.Model = sql.NullString{String: f.model, Valid: true}
+	}
+	if out.CaptureTime == "" && !out.GPSLat.Valid && !out.Make.Valid && !out.Model.Valid {
+		return ExtractedMetadata{}, errNoEXIF
+	}
+	return out, nil
+}
+
+// gpsDegrees turns degrees, minutes and seconds into signed degrees.
+func gpsDegrees(dms []float64, ref, negative string) (float64, bool) {
+	if len(dms) != 3 {
+		return 0, false
+	}
+	deg := dms[0] + dms[1]/60 + dms[2]/3600
+	if deg > 180 {
+		return 0, false
+	}
+	if strings.EqualFold(ref, negative) {
+		deg = -deg
+	}
+	return deg, true
+}
+
+// tiffReader reads IFDs of a TIFF structure that starts at base in r.
+// Offsets inside it are relative to base.
+type tiffReader struct {
+	r         io.ReaderAt
+	base, end int64
+	bo        binary.ByteOrder
+}
+
+type ifdEntry struct {
+	typ uint16
+	raw []byte
+}
+
+// openTIFF reads the TIFF header at base and returns the offset of IFD0.
+// Olympus ORF and Panasonic RW2 use their own magic numbers.
+func openTIFF(r io.ReaderAt, base, end int64) (*tiffReader, int64, error) {
+	hdr := make([]byte, 8)
+	if base+8 > end {
+		return nil, 0, errNoEXIF
+	}
+	if _, err := r.ReadAt(hdr, base); err != nil {
+		return nil, 0, err
+	}
+	t := &tiffReader{r: r, base: base, end: end}
+	switch string(hdr[:2]) {
+	case "II":
+		t.bo = binary.LittleEndian
+	case "MM":
+		t.bo = binary.BigEndian
+	default:
+		return nil, 0, errNoEXIF
+	}
+	switch t.bo.Uint16(hdr[2:]) {
+	case 42, 0x4f52, 0x5352, 0x55:
+	default:
+		return nil, 0, errNoEXIF
+	}
+	return t, int64(t.bo.Uint32(hdr[4:])), nil
+}
+
+func (t *tiffReader) readAt(off int64, n int) ([]byte, error) {
+	if off < 0 || n < 0 || t.base+off+int64(n) > t.end {
+		return nil, errNoEXIF
+	}
+	buf := make([]byte, n)
+	if _, err := t.r.ReadAt(buf, t.base+off); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// ifd reads the entries of the IFD at off. Values that cannot be read, or
+// are larger than any tag kept here, are left out.
+func (t *tiffReader) ifd(off int64) (map[uint16]ifdEntry, error) {
+	head, err := t.readAt(off, 2)
+	if err != nil {
+		return nil, err
+	}
+	n := int(t.bo.Uint16(head))
+	if n == 0 || n > maxIFDEntries {
+		return nil, errNoEXIF
+	}
+	body, err := t.readAt(off+2, n*12)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint16]ifdEntry, n)
+	for i := range n {
+		e := body[i*12 : i*12+12]
+		tag, typ, count := t.bo.Uint16(e), t.bo.Uint16(e[2:]), int64(t.bo.Uint32(e[4:]))
+		size := count * tiffTypeSize(typ)
+		if size == 0 || size > maxIFDValue {
+			continue
+		}
+		raw := e[8 : 8+min(size, 4)]
+		if size > 4 {
+			if raw, err = t.readAt(int64(t.bo.Uint32(e[8:])), int(size)); err != nil {
+				continue
+			}
+		}
+		out[tag] = ifdEntry{typ: typ, raw: raw}
+	}
+	return out, nil
+}
+
+func tiffTypeSize(typ uint16) int64 {
+	switch typ {
+	case 1, 2, 6, 7:
+		return 1
+	case 3, 8:
+		return 2
+	case 4, 9, 11, 13:
+		return 4
+	case 5, 10, 12:
+		return 8
+	}
+	return 0
+}
+
+func (t *tiffReader) str(e ifdEntry) string {
+	if e.typ != 2 && e.typ != 7 {
+		return ""
+	}
+	s, _, _ := bytes.Cut(e.raw, []byte{0})
+	return strings.TrimSpace(string(s))
+}
+
+func (t *tiffReader) rationals(e ifdEntry) []float64 {
+	if e.typ != 5 {
+		return nil
+	}
+	out := make([]float64, 0, len(e.raw)/8)
+	for i := 0; i+8 <= len(e.raw); i += 8 {
+		num, den := t.bo.Uint32(e.raw[i:]), t.bo.Uint32(e.raw[i+4:])
+		if den == 0 {
+			return nil
+		}
+		out = append(out, float64(num)/float64(den))
+	}
+	return out
+}
+
+func (t *tiffReader) pointer(e ifdEntry) (int64, bool) {
+	if (e.typ != 4 && e.typ != 13) || len(e.raw) < 4 {
+		return 0, false
+	}
+	return int64(t.bo.Uint32(e.raw)), true
+}
+
+// readIFD0 reads the camera and file date from IFD0 and follows its
+// pointers to the Exif and GPS IFDs.
+func (t *tiffReader) readIFD0(off int64, f *exifFields) {
+	ifd, err := t.ifd(off)
+	if err != nil {
+		return
+	}
+	setOnce(&f.make, t.str(ifd[0x010f]))
+	setOnce(&f.model, t.str(ifd[0x0110]))
+	setOnce(&f.modified, t.str(ifd[0x0132]))
+	if p, ok := t.pointer(ifd[0x8769]); ok {
+		t.readExifIFD(p, f)
+	}
+	if p, ok := t.pointer(ifd[0x8825]); ok {
+		t.readGPSIFD(p, f)
+	}
+}
+
+func (t *tiffReader) readExifIFD(off int64, f *exifFields) {
+	ifd, err := t.ifd(off)
+	if err != nil {
+		return
+	}
+	setOnce(&f.original, t.str(ifd[0x9003]))
+	setOnce(&f.offset, t.str(ifd[0x9011]))
+}
+
+func (t *tiffReader) readGPSIFD(off int64, f *exifFields) {
+	ifd, err := t.ifd(off)
+	if err != nil || f.lat != nil {
+		return
+	}
+	f.latRef, f.lat = t.str(ifd[0x0001]), t.rationals(ifd[0x0002])
+	f.lonRef, f.lon = t.str(ifd[0x0003]), t.rationals(ifd[0x0004])
+}
+
+func setOnce(dst *string, v string) {
+	if *dst == "" {
+		*dst = v
+	}
+}
+
+// errStopWalk ends walkBoxes early without an error.
+var errStopWalk = errors.New("stop")
+
+// walkBoxes calls fn with the type, body start and end of each ISO base
+// media box between start and end.
+func walkBoxes(r io.ReaderAt, start, end int64, fn func(typ string, body, next int64) error) error {
+	hdr := make([]byte, 16)
+	for off := start; off+8 <= end; {
+		if _, err := r.ReadAt(hdr[:8], off); err != nil {
+			return err
+		}
+		size, typ, body := int64(binary.BigEndian.Uint32(hdr)), string(hdr[4:8]), off+8
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			if _, err := r.ReadAt(hdr[8:], off+8); err != nil {
+				return err
+			}
+			size, body = int64(binary.BigEndian.Uint64(hdr[8:])), off+16
+		}
+		if size < body-off || off+size > end {
+			return errNoEXIF
+		}
+		if err := fn(typ, body, off+size); err != nil {
+			if errors.Is(err, errStopWalk) {
+				return nil
+			}
+			return err
+		}
+		off += size
+	}
+	return nil
+}
+
+// heifEXIF finds the Exif item of a HEIC/HEIF file through the meta box's
+// item info and item location boxes.
+func heifEXIF(r io.ReaderAt, size int64, f *exifFields) error {
+	var exifID uint32
+	var locs map[uint32][2]int64
+	found := false
+	err := walkBoxes(r, 0, size, func(typ string, body, next int64) error {
+		if typ != "meta" {
+			return nil
+		}
+		found = true
+		// meta is a full box: version and flags come before its children.
+		return walkBoxes(r, body+4, next, func(typ string, body, next int64) error {
+			if next-body > maxContainerBox {
+				return nil
+			}
+			var err error
+			switch typ {
+			case "iinf":
+				exifID, err = heifExifItem(r, body, next)
+			case "iloc":
+				locs, err = heifItemLocations(r, body, next)
+			}
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	loc, ok := locs[exifID]
+	if !found || exifID == 0 || !ok || loc[1] < 8 {
+		return errNoEXIF
+	}
+	// The item starts with the offset of the TIFF header past its own
+	// four bytes, skipping "Exif\0\0".
+	var skip [4]byte
+	if _, err := r.ReadAt(skip[:], loc[0]); err != nil {
+		return err
+	}
+	start := loc[0] + 4 + int64(binary.BigEndian.Uint32(skip[:]))
+	t, ifd0, err := openTIFF(r, start, loc[0]+loc[1])
+	if err != nil {
+		return err
+	}
+	t.readIFD0(ifd0, f)
+	return nil
+}
+
+// heifExifItem returns the ID of the item of type Exif in an iinf box.
+func heifExifItem(r io.ReaderAt, body, end int64) (uint32, error) {
+	head := make([]byte, 8)
+	if _, err := r.ReadAt(head, body); err != nil {
+		return 0, err
+	}
+	entries := body + 6
+	if head[0] != 0 {
+		entries = body + 8
+	}
+	var id uint32
+	err := walkBoxes(r, entries, end, func(typ string, body, next int64) error {
+		if typ != "infe" || next-body < 12 {
+			return nil
+		}
+		b := make([]byte, 14)
+		n, _ := r.ReadAt(b[:min(int64(len(b)), next-body)], body)
+		if n < 12 {
+			return nil
+		}
+		b = b[:n]
+		var itemID uint32
+		var itemType string
+		switch b[0] {
+		case 2:
+			itemID, itemType = uint32(binary.BigEndian.Uint16(b[4:])), string(b[8:12])
+		case 3:
+			if len(b) < 14 {
+				return nil
+			}
+			itemID, itemType = binary.BigEndian.Uint32(b[4:]), string(b[10:14])
+		default:
+			return nil
+		}
+		if itemType == "Exif" {
+			id = itemID
+			return errStopWalk
+		}
+		return nil
+	})
+	return id, err
+}
+
+// heifItemLocations reads an iloc box into file offset and length by item
+// ID, using each item's first extent. Items stored in the idat box are left
+// out.
+func heifItemLocations(r io.ReaderAt, body, end int64) (map[uint32][2]int64, error) {
+	buf := make([]byte, end-body)
+	if _, err := r.ReadAt(buf, body); err != nil {
+		return nil, err
+	}
+	p := &byteCursor{b: buf}
+	version := p.uint(1)
+	p.skip(3)
+	sizes := p.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0xf)
+	sizes = p.uint(1)
+	baseSize, indexSize := int(sizes>>4), int(sizes&0xf)
+	if version == 0 {
+		indexSize = 0
+	}
+	count := p.uint(2)
+	if version == 2 {
+		count = p.uint(4)
+	}
+	out := map[uint32][2]int64{}
+	for range count {
+		if p.bad {
+			return nil, errNoEXIF
+		}
+		var id uint64
+		if version < 2 {
+			id = p.uint(2)
+		} else {
+			id = p.uint(4)
+		}
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = p.uint(2) & 0xf
+		}
+		p.skip(2) // data reference index
+		base := p.uint(baseSize)
+		extents := p.uint(2)
+		for i := range extents {
+			p.skip(indexSize)
+			off, length := p.uint(offsetSize), p.uint(lengthSize)
+			if i == 0 && method == 0 {
+				out[uint32(id)] = [2]int64{int64(base + off), int64(length)}
+			}
+		}
+	}
+	if p.bad {
+		return nil, errNoEXIF
+	}
+	return out, nil
+}
+
+// byteCursor reads big-endian integers of 0, 1, 2, 4 or 8 bytes, and
+// notes when it runs past the end instead of failing each read.
+type byteCursor struct {
+	b   []byte
+	pos int
+	bad bool
+}
+
+func (c *byteCursor) uint(n int) uint64 {
+	if n == 0 {
+		return 0
+	}
+	if c.pos+n > len(c.b) || (n != 1 && n != 2 && n != 4 && n != 8) {
+		c.bad = true
+		c.pos = len(c.b)
+		return 0
+	}
+	var v uint64
+	for _, b := range c.b[c.pos : c.pos+n] {
+		v = v<<8 | uint64(b)
+	}
+	c.pos += n
+	return v
+}
+
+func (c *byteCursor) skip(n int) {
+	if c.pos+n > len(c.b) {
+		c.bad = true
+		c.pos = len(c.b)
+		return
+	}
+	c.pos += n
+}
+
+// cr3EXIF reads the CMT boxes of a Canon CR3: CMT1 holds IFD0, CMT2 the
+// Exif IFD and CMT4 the GPS IFD, each as its own TIFF structure.
+func cr3EXIF(r io.ReaderAt, size int64, f *exifFields) error {
+	found := false
+	err := walkBoxes(r, 0, size, func(typ string, body, next int64) error {
+		if typ != "moov" {
+			return nil
+		}
+		return walkBoxes(r, body, next, func(typ string, body, next int64) error {
+			if typ != "uuid" || next-body < 16 {
+				return nil
+			}
+			id := make([]byte, 16)
+			if _, err := r.ReadAt(id, body); err != nil {
+				return err
+			}
+			if !bytes.Equal(id, cr3UUID) {
+				return nil
+			}
+			found = true
+			err := walkBoxes(r, body+16, next, func(typ string, body, next int64) error {
+				t, ifd0, err := openTIFF(r, body, next)
+				if err != nil {
+					return nil
+				}
+				switch typ {
+				case "CMT1":
+					t.readIFD0(ifd0, f)
+				case "CMT2":
+					t.readExifIFD(ifd0, f)
+				case "CMT4":
+					t.readGPSIFD(ifd0, f)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			return errStopWalk
+		})
+	})
+	if err == nil && !found {
+		err = errNoEXIF
+	}
+	return err
+}
+
+// rafEXIF reads the EXIF of the JPEG preview a Fujifilm RAF file embeds.
+func rafEXIF(r io.ReaderAt, size int64) (ExtractedMetadata, error) {
+	hdr := make([]byte, 92)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return ExtractedMetadata{}, err
+	}
+	if !bytes.HasPrefix(hdr, []byte("FUJIFILMCCD-RAW")) {
+		return ExtractedMetadata{}, errNoEXIF
+	}
+	off, length := int64(binary.BigEndian.Uint32(hdr[84:])), int64(binary.BigEndian.Uint32(hdr[88:]))
+	if off <= 0 || length <= 0 || off+length > size {
+		return ExtractedMetadata{}, fmt.Errorf("raf: preview at %d+%d is outside the file: %w", off, length, errNoEXIF)
+	}
+	x, err := exif.Decode(io.NewSectionReader(r, off, length))
+	if err != nil {
+		return ExtractedMetadata{}, err
+	}
+	return metadataFromEXIF(x), nil
+}
@@ -0,0 +1,173 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testTag struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+}
+
+type testIFD struct {
+	tags      []testTag
+	exif, gps *testIFD
+}
+
+func asciiTag(tag uint16, s string) testTag {
+	return testTag{tag: tag, typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+// rationalTag stores each value in thousandths.
+func rationalTag(tag uint16, vals ...float64) testTag {
+	data := make([]byte, 0, 8*len(vals))
+	for _, v := range vals {
+		data = binary.LittleEndian.AppendUint32(data, uint32(v*1000))
+		data = binary.LittleEndian.AppendUint32(data, 1000)
+	}
+	return testTag{tag: tag, typ: 5, count: uint32(len(vals)), data: data}
+}
+
+// buildTestTIFF lays out a little-endian TIFF with root as IFD0, writing
+// sub-IFDs first so their offsets are known.
+func buildTestTIFF(root testIFD) []byte {
+	buf := bytes.NewBuffer(make([]byte, 8))
+	var write func(ifd testIFD) uint32
+	write = func(ifd testIFD) uint32 {
+		tags := ifd.tags
+		for _, sub := range []struct {
+			tag uint16
+			ifd *testIFD
+		}{{0x8769, ifd.exif}, {0x8825, ifd.gps}} {
+			if sub.ifd != nil {
+				off := write(*sub.ifd)
+				tags = append(tags, testTag{tag: sub.tag, typ: 4, count: 1, data: binary.LittleEndian.AppendUint32(nil, off)})
+			}
+		}
+		start := uint32(buf.Len())
+		dataAt := start + 2 + uint32(len(tags))*12 + 4
+		var data []byte
+		_ = binary.Write(buf, binary.LittleEndian, uint16(len(tags)))
+		for _, tg := range tags {
+			for _, v := range []any{tg.tag, tg.typ, tg.count} {
+				_ = binary.Write(buf, binary.LittleEndian, v)
+			}
+			if len(tg.data) <= 4 {
+				buf.Write(append(tg.data, make([]byte, 4-len(tg.data))...))
+				continue
+			}
+			_ = binary.Write(buf, binary.LittleEndian, dataAt+uint32(len(data)))
+			data = append(data, tg.data...)
+		}
+		_ = binary.Write(buf, binary.LittleEndian, uint32(0))
+		buf.Write(data)
+		return start
+	}
+	ifd0 := write(root)
+	out := buf.Bytes()
+	copy(out, "II")
+	binary.LittleEndian.PutUint16(out[2:], 42)
+	binary.LittleEndian.PutUint32(out[4:], ifd0)
+	return out
+}
+
+func box(typ string, parts ...[]byte) []byte {
+	body := bytes.Join(parts, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+var (
+	testIFD0 = []testTag{asciiTag(0x010f, "Canon"), asciiTag(0x0110, "EOS R5"), asciiTag(0x0132, "2024:06:01 09:00:00")}
+	testExif = testIFD{tags: []testTag{asciiTag(0x9003, "2024:05:31 18:30:15"), asciiTag(0x9011, "+02:00")}}
+	testGPS  = testIFD{tags: []testTag{
+		asciiTag(0x0001, "N"), rationalTag(0x0002, 48, 8, 6),
+		asciiTag(0x0003, "W"), rationalTag(0x0004, 11, 34, 30),
+	}}
+)
+
+func checkTestMetadata(t *testing.T, path string) {
+	t.Helper()
+	meta, err := ExtractMetadata(path, "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.CaptureFromMTime || meta.CaptureTime != "2024-05-31T16:30:15Z" {
+		t.Fatalf("capture time = %q (from mtime %v)", meta.CaptureTime, meta.CaptureFromMTime)
+	}
+	if meta.Make.String != "Canon" || meta.Model.String != "EOS R5" {
+		t.Fatalf("camera = %q %q", meta.Make.String, meta.Model.String)
+	}
+	if !meta.GPSLat.Valid || meta.GPSLat.Float64 < 48.134 || meta.GPSLat.Float64 > 48.136 ||
+		!meta.GPSLon.Valid || meta.GPSLon.Float64 > -11.574 || meta.GPSLon.Float64 < -11.576 {
+		t.Fatalf("position = %v, %v", meta.GPSLat, meta.GPSLon)
+	}
+}
+
+func TestExtractMetadataReadsTIFFBasedRAW(t *testing.T) {
+	raw := buildTestTIFF(testIFD{tags: testIFD0, exif: &testExif, gps: &testGPS})
+	path := filepath.Join(t.TempDir(), "IMG_0001.NEF")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checkTestMetadata(t, path)
+}
+
+func TestExtractMetadataReadsHEIC(t *testing.T) {
+	tiff := buildTestTIFF(testIFD{tags: testIFD0, exif: &testExif, gps: &testGPS})
+	item := append([]byte{0, 0, 0, 6}, append([]byte("Exif\x00\x00"), tiff...)...)
+	ftyp := box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	infe := box("infe", []byte{2, 0, 0, 0}, []byte{0, 7}, []byte{0, 0}, []byte("Exif"), []byte{0})
+	iinf := box("iinf", []byte{0, 0, 0, 0}, []byte{0, 1}, infe)
+	ilocSize := 8 + 4 + 2 + 2 + 2 + 2 + 2 + 8 // header, sizes, count, id, data ref, extents, extent
+	metaSize := 8 + 4 + len(iinf) + ilocSize
+	itemAt := len(ftyp) + metaSize + 8
+	iloc := box("iloc", []byte{0, 0, 0, 0}, []byte{0x44, 0x00}, []byte{0, 1}, []byte{0, 7}, []byte{0, 0}, []byte{0, 1},
+		binary.BigEndian.AppendUint32(nil, uint32(itemAt)), binary.BigEndian.AppendUint32(nil, uint32(len(item))))
+	meta := box("meta", []byte{0, 0, 0, 0}, iinf, iloc)
+	file := bytes.Join([][]byte{ftyp, meta, box("mdat", item)}, nil)
+	if len(meta) != metaSize {
+		t.Fatalf("meta box is %d bytes, laid out for %d", len(meta), metaSize)
+	}
+
+	path := filepath.Join(t.TempDir(), "IMG_0002.HEIC")
+	if err := os.WriteFile(path, file, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checkTestMetadata(t, path)
+}
+
+func TestExtractMetadataReadsCR3(t *testing.T) {
+	uuid := box("uuid", cr3UUID,
+		box("CMT1", buildTestTIFF(testIFD{tags: testIFD0})),
+		box("CMT2", buildTestTIFF(testExif)),
+		box("CMT4", buildTestTIFF(testGPS)),
+	)
+	file := bytes.Join([][]byte{box("ftyp", []byte("crx \x00\x00\x00\x01crx isom")), box("moov", uuid)}, nil)
+
+	path := filepath.Join(t.TempDir(), "IMG_0003.CR3")
+	if err := os.WriteFile(path, file, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checkTestMetadata(t, path)
+}
+
+func TestExtractMetadataFallsBackOnBrokenRAW(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "IMG_0004.ARW")
+	if err := os.WriteFile(path, []byte("II*\x00\xff\xff\xff\x7fgarbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := ExtractMetadata(path, "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.CaptureFromMTime {
+		t.Fatalf("capture time %q not taken from mtime", meta.CaptureTime)
+	}
+}
@@ -0,0 +1,147 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/libcrypt"
+)
+
+// Thumbnail sizes, as the longest side in pixels. The small one fills grid
+// tiles; the large one is the preview pane, so nobody has to pull a 50 MB
+// RAW over the network just to look at it.
+const (
+	ThumbSmall = 320
+	ThumbLarge = 1024
+)
+
+// ThumbnailSizes are the sizes rendered for every image.
+var ThumbnailSizes = []int{ThumbSmall, ThumbLarge}
+
+// IsThumbnailSize reports whether size is one of ThumbnailSizes.
+func IsThumbnailSize(size int) bool {
+	for _, s := range ThumbnailSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// CanThumbnail reports whether thumbnails can be rendered for files with
+// this extension, either by decoding them or from their embedded preview.
+func CanThumbnail(ext string) bool {
+	return CanDecodeImage(ext) || HasEmbeddedPreview(ext)
+}
+
+// ThumbnailPath is the cached thumbnail of a media item at size, or "" when
+// no base storage is configured. Thumbnails are regenerable, so they live
+// in the thumbnails work area that backups skip. The small size keeps the
+// bare <id>.jpg name so caches from before the large size still count.
+func ThumbnailPath(baseStorage string, id int64, size int) string {
+	if baseStorage == "" {
+		return ""
+	}
+	name := strconv.FormatInt(id, 10) + ".jpg"
+	if size != ThumbSmall {
+		name = fmt.Sprintf("%d-%d.jpg", id, size)
+	}
+	return filepath.Join(config.WorkAreaDir(baseStorage, config.WorkAreaThumbnails),
+		strconv.FormatInt(id/1000, 10), name)
+}
+
+// RenditionPath is the cached browser-viewable JPEG of a RAW media item,
+// or "" when no base storage is configured. Like thumbnails, renditions
+// can be made again, so they live in the proxies work area.
+func RenditionPath(baseStorage string, id int64) string {
+	if baseStorage == "" {
+		return ""
+	}
+	return filepath.Join(config.WorkAreaDir(baseStorage, config.WorkAreaProxies), "jpeg",
+		strconv.FormatInt(id/1000, 10), strconv.FormatInt(id, 10)+".jpg")
+}
+
+// DecodeThumbnailSource decodes an image for thumbnailing. Formats
+// DecodeImage understands are decoded directly; RAW files use their
+// embedded JPEG preview, turned the way the camera recorded it.
+func DecodeThumbnailSource(r io.ReadSeeker, ext string) (*image.RGBA, error) {
+	if CanDecodeImage(ext) {
+		return DecodeImage(r)
+	}
+	if !HasEmbeddedPreview(ext) {
+		return nil, ErrNoPreview
+	}
+	body, orientation, err := EmbeddedJPEG(r)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxDecodePixels {
+		return nil, ErrImageTooLarge
+	}
+	src, err := jpeg.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return orient(toRGBA(src), orientation), nil
+}
+
+// RenderThumbnails encodes img at every one of ThumbnailSizes, largest
+// first, scaling each smaller size from the one before it.
+func RenderThumbnails(img *image.RGBA) (map[int][]byte, error) {
+	out := make(map[int][]byte, len(ThumbnailSizes))
+	for i := len(ThumbnailSizes) - 1; i >= 0; i-- {
+		size := ThumbnailSizes[i]
+		img = ResizeToFit(img, size)
+		quality := 80
+		if size == ThumbSmall {
+			quality = 75
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		out[size] = buf.Bytes()
+	}
+	return out, nil
+}
+
+// WriteThumbnail stores body at path through a temporary file, encrypting
+// it with key when library encryption is on.
+func WriteThumbnail(path string, body []byte, key *libcrypt.Key) (err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".thumb-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if key != nil {
+		err = key.Encrypt(tmp, bytes.NewReader(body), int64(len(body)))
+	} else {
+		_, err = tmp.Write(body)
+	}
+	if err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,112 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"businessplan/usbvault/internal/config"
+)
+
+// StreamProfile is a way of turning a video into MP4 a browser can play.
+// Height 0 remuxes: the streams are copied into a new container as they
+// are, which is quick but needs codecs the browser already plays.
+type StreamProfile struct {
+	Name   string
+	Height int
+}
+
+// StreamProfiles are the profiles /api/media/{id}/stream accepts.
+var StreamProfiles = []StreamProfile{
+	{Name: "remux"},
+	{Name: "480p", Height: 480},
+	{Name: "720p", Height: 720},
+	{Name: "1080p", Height: 1080},
+}
+
+// StreamProfileByName looks a profile up by its name.
+func StreamProfileByName(name string) (StreamProfile, bool) {
+	for _, p := range StreamProfiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return StreamProfile{}, false
+}
+
+// StreamCachePath is the cached output of a profile for one media item,
+// starting start seconds in, or "" when no base storage is configured.
+// Each item's outputs share a folder so they can be removed together.
+func StreamCachePath(baseStorage string, id int64, profile string, start int) string {
+	dir := StreamCacheDir(baseStorage, id)
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s-%d.mp4", profile, start))
+}
+
+// StreamCacheDir is the folder of an item's cached stream outputs.
+func StreamCacheDir(baseStorage string, id int64) string {
+	if baseStorage == "" {
+		return ""
+	}
+	return filepath.Join(StreamCacheRoot(baseStorage), strconv.FormatInt(id/1000, 10), strconv.FormatInt(id, 10))
+}
+
+// StreamCacheRoot holds every cached stream output. They can be made
+// again, so they live in the proxies work area.
+func StreamCacheRoot(baseStorage string) string {
+	return filepath.Join(config.WorkAreaDir(baseStorage, config.WorkAreaProxies), "stream")
+}
+
+// Transcode has ffmpeg write the video at path to w as fragmented MP4, so
+// playback can begin before it is done. start skips that many seconds in.
+// Metadata is dropped, a recorded position included. There is no time
+// limit; the caller's context ends it.
+func Transcode(ctx context.Context, ffmpeg, path string, p StreamProfile, start int, w io.Writer) error {
+	if ffmpeg == "" {
+		return ErrNoFFmpeg
+	}
+	args := []string{"-hide_banner", "-nostdin", "-loglevel", "error"}
+	if start > 0 {
+		args = append(args, "-ss", strconv.Itoa(start))
+	}
+	// The file: prefix keeps ffmpeg from reading a name such as
+	// "concat:..." as a protocol.
+	args = append(args, "-i", "file:"+path, "-map", "0:v:0", "-map", "0:a:0?", "-map_metadata", "-1", "-sn", "-dn")
+	if p.Height == 0 {
+		args = append(args, "-c", "copy")
+	} else {
+		// -2 keeps the width even, which H.264 needs; smaller videos are
+		// not scaled up.
+		args = append(args,
+			"-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", p.Height),
+			"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+			"-c:a", "aac", "-b:a", "128k", "-ac", "2")
+	}
+	args = append(args, "-movflags", "frag_keyframe+empty_moov+default_base_moof", "-f", "mp4", "pipe:1")
+
+	cmd := exec.CommandContext(ctx, ffmpeg, args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		msg := stderr.String()
+		if len(msg) > posterStderrMax {
+			msg = msg[len(msg)-posterStderrMax:]
+		}
+		if lines := strings.Split(strings.TrimSpace(msg), "\n"); len(lines) > 0 && lines[len(lines)-1] != "" {
+			return fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+		}
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoFFmpeg means no ffmpeg binary is configured, so videos get no
+// poster.
+var ErrNoFFmpeg = errors.New("ffmpeg is not available")
+
+// errNoFrame means ffmpeg ran but produced no frame, as it does when the
+// seek lands past the end of a short clip.
+var errNoFrame = errors.New("ffmpeg produced no frame")
+
+const (
+	posterTimeout   = time.Minute
+	posterMaxBytes  = 8 << 20
+	posterStderrMax = 64 << 10
+)
+
+var regexDuration = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
+// ExtractPoster has ffmpeg grab a frame one second into the video at path,
+// scaled to fit ThumbLarge, and reports the video's duration in seconds (0
+// when ffmpeg could not tell). ffmpeg applies the rotation the camera
+// recorded. Clips shorter than a second use their first frame.
+func ExtractPoster(ctx context.Context, ffmpeg, path string) (*image.RGBA, float64, error) {
+	if ffmpeg == "" {
+		return nil, 0, ErrNoFFmpeg
+	}
+	img, duration, err := grabFrame(ctx, ffmpeg, path, "1")
+	if errors.Is(err, errNoFrame) {
+		img, duration, err = grabFrame(ctx, ffmpeg, path, "0")
+	}
+	return img, duration, err
+}
+
+func grabFrame(ctx context.Context, ffmpeg, path, seek string) (*image.RGBA, float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, posterTimeout)
+	defer cancel()
+
+	scale := fmt.Sprintf("scale='min(%d,iw)':'min(%d,ih)':force_original_aspect_ratio=decrease", ThumbLarge, ThumbLarge)
+	// The file: prefix keeps ffmpeg from reading a name such as
+	// "concat:..." as a protocol.
+	cmd := exec.CommandContext(ctx, ffmpeg, "-hide_banner", "-nostdin",
+		"-ss", seek, "-i", "file:"+path,
+		"-frames:v", "1", "-vf", scale,
+		"-f", "image2pipe", "-c:v", "mjpeg", "-q:v", "3", "pipe:1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	duration := parseDuration(stderr.String())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, duration, fmt.Errorf("ffmpeg timed out after %s", posterTimeout)
+		}
+		msg := stderr.String()
+		if len(msg) > posterStderrMax {
+			msg = msg[len(msg)-posterStderrMax:]
+		}
+		if lines := strings.Split(strings.TrimSpace(msg), "\n"); len(lines) > 0 && lines[len(lines)-1] != "" {
+			return nil, duration, fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+		}
+		return nil, duration, fmt.Errorf("ffmpeg: %w", err)
+	}
+	if stdout.Len() == 0 {
+		return nil, duration, errNoFrame
+	}
+	if stdout.Len() > posterMaxBytes {
+		return nil, duration, fmt.Errorf("ffmpeg frame exceeds %d bytes", posterMaxBytes)
+	}
+	src, err := jpeg.Decode(&stdout)
+	if err != nil {
+		return nil, duration, fmt.Errorf("ffmpeg frame: %w", err)
+	}
+	return toRGBA(src), duration, nil
+}
+
+// parseDuration reads the "Duration: HH:MM:SS.ss" line ffmpeg prints for
+// its input, or returns 0.
+func parseDuration(stderr string) float64 {
+	m := regexDuration.FindStringSubmatch(stderr)
+	if m == nil {
+		return 0
+	}
+	h, _ := strconv.Atoi(m[1])
+	mins, _ := strconv.Atoi(m[2])
+	sec, _ := strconv.ParseFloat(m[3], 64)
+	return float64(h*3600+mins*60) + sec
+}
@@ -0,0 +1,60 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestExtractPosterFallsBackToFirstFrame(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+	dir := t.TempDir()
+	var frame bytes.Buffer
+	if err := jpeg.Encode(&frame, image.NewRGBA(image.Rect(0, 0, 96, 54)), nil); err != nil {
+		t.Fatal(err)
+	}
+	framePath := filepath.Join(dir, "frame.jpg")
+	if err := os.WriteFile(framePath, frame.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Like ffmpeg on a half-second clip: seeking to 1s yields no frame.
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	script := "#!/bin/sh\n" +
+		"echo '  Duration: 00:00:00.50, start: 0.000000, bitrate: 900 kb/s' >&2\n" +
+		"case \"$*\" in *'-ss 1 '*) exit 0;; esac\n" +
+		"case \"$*\" in *'-i file:/clips/DJI_0001.MP4 '*) ;; *) echo \"bad args: $*\" >&2; exit 1;; esac\n" +
+		"cat '" + framePath + "'\n"
+	if err := os.WriteFile(ffmpeg, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	img, duration, err := ExtractPoster(context.Background(), ffmpeg, "/clips/DJI_0001.MP4")
+	if err != nil {
+		t.Fatalf("ExtractPoster: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 96 || b.Dy() != 54 || duration != 0.5 {
+		t.Fatalf("poster %dx%d, duration %v", b.Dx(), b.Dy(), duration)
+	}
+	if _, _, err := ExtractPoster(context.Background(), "", "/clips/DJI_0001.MP4"); err != ErrNoFFmpeg {
+		t.Fatalf("without ffmpeg err = %v", err)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for in, want := range map[string]float64{
+		"  Duration: 01:02:03.25, start: 0.0": 3723.25,
+		"  Duration: N/A, bitrate: N/A":       0,
+		"":                                    0,
+	} {
+		if got := parseDuration(in); got != want {
+			t.Errorf("parseDuration(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
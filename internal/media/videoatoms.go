@@ -0,0 +1,321 @@
+package media
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MP4, MOV and the camera formats built on them keep their creation time,
+// duration and tracks in the moov atom, and phones add the position and
+// camera as QuickTime keys or udta atoms. Only those atoms are read.
+
+var (
+	errNoVideoMetadata = errors.New("no video metadata found")
+	errBadAtoms        = errors.New("malformed mp4/mov atoms")
+)
+
+const maxVideoString = 4 << 10
+
+// mp4Epoch is where mvhd times count from.
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// iso6709 matches the decimal-degree form phones write, e.g.
+// "+37.3318-122.0312+012.345/".
+var iso6709 = regexp.MustCompile(`^([+-]\d{1,2}(?:\.\d+)?)([+-]\d{1,3}(?:\.\d+)?)`)
+
+// hasVideoAtoms reports whether parseVideoAtoms reads this format.
+func hasVideoAtoms(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".mp4", ".mov", ".m4v", ".3gp", ".lrv", ".insv":
+		return true
+	}
+	return false
+}
+
+// videoFields are the atoms ExtractMetadata keeps. The first value found
+// for each wins.
+type videoFields struct {
+	created      time.Time // mvhd creation time, UTC
+	creationDate string    // com.apple.quicktime.creationdate, with zone
+	location     string    // ISO 6709
+	make, model  string
+	duration     float64 // seconds
+	codec        string  // sample entry type of the first video track
+	width        int
+	height       int
+}
+
+func parseVideoAtoms(filePath string) (ExtractedMetadata, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return ExtractedMetadata{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return ExtractedMetadata{}, err
+	}
+
+	var v videoFields
+	err = walkBoxes(f, 0, info.Size(), func(typ string, body, next int64) error {
+		if typ != "moov" {
+			return nil
+		}
+		if err := v.readMoov(f, body, next); err != nil {
+			return err
+		}
+		return errStopWalk
+	})
+	if errors.Is(err, errNoEXIF) {
+		return ExtractedMetadata{}, errBadAtoms
+	}
+	if err != nil {
+		return ExtractedMetadata{}, err
+	}
+	return v.metadata()
+}
+
+func (v *videoFields) readMoov(r io.ReaderAt, start, end int64) error {
+	return walkBoxes(r, start, end, func(typ string, body, next int64) error {
+		switch typ {
+		case "mvhd":
+			v.readMvhd(r, body, next)
+		case "trak":
+			return v.readTrak(r, body, next)
+		case "udta":
+			return v.readUdta(r, body, next)
+		case "meta":
+			return v.readKeys(r, body, next)
+		}
+		return nil
+	})
+}
+
+// readMvhd reads the movie's creation time and duration.
+func (v *videoFields) readMvhd(r io.ReaderAt, body, end int64) {
+	b, err := readBox(r, body, end, 32)
+	if err != nil || len(b) < 4 {
+		return
+	}
+	c := byteCursor{b: b}
+	version := c.uint(1)
+	c.skip(3)
+	var created, timescale, duration uint64
+	unknown := uint64(1<<32 - 1)
+	if version == 1 {
+		created = c.uint(8)
+		c.skip(8)
+		timescale, duration, unknown = c.uint(4), c.uint(8), 1<<64-1
+	} else {
+		created = c.uint(4)
+		c.skip(4)
+		timescale, duration = c.uint(4), c.uint(4)
+	}
+	if c.bad {
+		return
+	}
+	// Cameras without a clock write 0; anything before 1971 is as unset.
+	if tm := mp4Epoch.Add(time.Duration(created) * time.Second); created > 0 && tm.Year() > 1970 && tm.Year() < 3000 {
+		v.created = tm
+	}
+	if timescale > 0 && duration != unknown {
+		v.duration = float64(duration) / float64(timescale)
+	}
+}
+
+// readTrak takes the codec and frame size of the first video track.
+func (v *videoFields) readTrak(r io.ReaderAt, start, end int64) error {
+	if v.codec != "" {
+		return nil
+	}
+	var handler, codec string
+	var width, height int
+	var walk func(start, end int64) error
+	walk = func(start, end int64) error {
+		return walkBoxes(r, start, end, func(typ string, body, next int64) error {
+			switch typ {
+			case "mdia", "minf", "stbl":
+				return walk(body, next)
+			case "hdlr":
+				// version and flags, pre_defined, then the handler type.
+				if b, err := readBox(r, body, next, 12); err == nil && len(b) == 12 {
+					handler = string(b[8:12])
+				}
+			case "stsd":
+				// version and flags, entry count, then the first sample
+				// entry; a visual entry has width and height at 32.
+				if b, err := readBox(r, body, next, 8+36); err == nil && len(b) >= 16 {
+					codec = strings.TrimSpace(string(b[12:16]))
+					if len(b) == 8+36 {
+						width = int(binary.BigEndian.Uint16(b[8+32:]))
+						height = int(binary.BigEndian.Uint16(b[8+34:]))
+					}
+				}
+			}
+			return nil
+		})
+	}
+	if err := walk(start, end); err != nil {
+		return err
+	}
+	if handler == "vide" && codec != "" {
+		v.codec, v.width, v.height = codec, width, height
+	}
+	return nil
+}
+
+// readUdta reads the ©xyz, ©mak and ©mod atoms Android and some cameras
+// write: a 16-bit length and language, then the text.
+func (v *videoFields) readUdta(r io.ReaderAt, start, end int64) error {
+	return walkBoxes(r, start, end, func(typ string, body, next int64) error {
+		var dst *string
+		switch typ {
+		case "\xa9xyz":
+			dst = &v.location
+		case "\xa9mak":
+			dst = &v.make
+		case "\xa9mod":
+			dst = &v.model
+		case "meta":
+			return v.readKeys(r, body, next)
+		default:
+			return nil
+		}
+		b, err := readBox(r, body, next, maxVideoString)
+		if err != nil || len(b) < 4 {
+			return nil
+		}
+		n := min(int(binary.BigEndian.Uint16(b)), len(b)-4)
+		setOnce(dst, strings.TrimRight(string(b[4:4+n]), "\x00 "))
+		return nil
+	})
+}
+
+// readKeys reads the QuickTime metadata keys iPhones and many cameras
+// write: a keys atom naming each entry and an ilst atom holding the values
+// by 1-based key index.
+func (v *videoFields) readKeys(r io.ReaderAt, start, end int64) error {
+	// In QuickTime files meta is a plain atom; in MP4 it is a full box
+	// with version and flags before its children.
+	if b, err := readBox(r, start, end, 8); err == nil && len(b) == 8 && string(b[4:8]) != "hdlr" {
+		start += 4
+	}
+	var keys []string
+	return walkBoxes(r, start, end, func(typ string, body, next int64) error {
+		switch typ {
+		case "keys":
+			b, err := readBox(r, body, next, maxContainerBox)
+			if err != nil || len(b) < 8 {
+				return nil
+			}
+			c := byteCursor{b: b}
+			c.skip(4)
+			count := c.uint(4)
+			for i := uint64(0); i < count && !c.bad; i++ {
+				size := int(c.uint(4))
+				c.skip(4) // namespace, "mdta"
+				if size < 8 || c.pos+size-8 > len(b) {
+					break
+				}
+				keys = append(keys, string(b[c.pos:c.pos+size-8]))
+				c.skip(size - 8)
+			}
+		case "ilst":
+			return walkBoxes(r, body, next, func(typ string, body, next int64) error {
+				idx := int(binary.BigEndian.Uint32([]byte(typ)))
+				if idx < 1 || idx > len(keys) {
+					return nil
+				}
+				var dst *string
+				switch keys[idx-1] {
+				case "com.apple.quicktime.location.ISO6709":
+					dst = &v.location
+				case "com.apple.quicktime.creationdate":
+					dst = &v.creationDate
+				case "com.apple.quicktime.make":
+					dst = &v.make
+				case "com.apple.quicktime.model":
+					dst = &v.model
+				default:
+					return nil
+				}
+				return walkBoxes(r, body, next, func(typ string, body, next int64) error {
+					if typ != "data" {
+						return nil
+					}
+					// type indicator and locale, then the value.
+					if b, err := readBox(r, body, next, maxVideoString); err == nil && len(b) > 8 {
+						setOnce(dst, strings.TrimRight(string(b[8:]), "\x00 "))
+					}
+					return errStopWalk
+				})
+			})
+		}
+		return nil
+	})
+}
+
+// readBox returns up to limit bytes of a box body.
+func readBox(r io.ReaderAt, body, end int64, limit int64) ([]byte, error) {
+	b := make([]byte, min(end-body, limit))
+	n, err := r.ReadAt(b, body)
+	if err != nil && !(errors.Is(err, io.EOF) && n == len(b)) {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (v videoFields) metadata() (ExtractedMetadata, error) {
+	var out ExtractedMetadata
+	if tm, ok := parseQuickTimeDate(v.creationDate); ok {
+		out.CaptureTime = tm.UTC().Format(time.RFC3339)
+	} else if !v.created.IsZero() {
+		out.CaptureTime = v.created.Format(time.RFC3339)
+	}
+	if m := iso6709.FindStringSubmatch(v.location); m != nil {
+		lat, errLat := strconv.ParseFloat(m[1], 64)
+		lon, errLon := strconv.ParseFloat(m[2], 64)
+		if errLat == nil && errLon == nil && lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180 {
+			out.GPSLat = sql.NullFloat64{Float64: lat, Valid: true}
+			out.GPSLon = sql.NullFloat64{Float64: lon, Valid: true}
+		}
+	}
+	if v.make != "" {
+		out.Make = sql.NullString{String: v.make, Valid: true}
+	}
+	if v.model != "" {
+		out.Model = sql.NullString{String: v.model, Valid: true}
+	}
+	if v.duration > 0 {
+		out.DurationSec = sql.NullFloat64{Float64: v.duration, Valid: true}
+	}
+	if v.codec != "" {
+		out.VideoCodec = sql.NullString{String: v.codec, Valid: true}
+	}
+	if v.width > 0 && v.height > 0 {
+		out.Width = sql.NullInt64{Int64: int64(v.width), Valid: true}
+		out.Height = sql.NullInt64{Int64: int64(v.height), Valid: true}
+	}
+	if out.CaptureTime == "" && !out.GPSLat.Valid && !out.Make.Valid && !out.DurationSec.Valid && !out.VideoCodec.Valid {
+		return ExtractedMetadata{}, errNoVideoMetadata
+	}
+	return out, nil
+}
+
+// parseQuickTimeDate reads com.apple.quicktime.creationdate, which carries
+// the local time and its zone, e.g. "2024-05-01T12:00:00+0200".
+func parseQuickTimeDate(s string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02T15:04:05-0700", "2006-01-02T15:04:05Z07:00", "2006-01-02T15:04:05.000-0700"} {
+		if tm, err := time.Parse(layout, s); err == nil {
+			return tm, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,123 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func be32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+// testMvhd is a version 0 mvhd box with a 600 timescale.
+func testMvhd(created time.Time, seconds uint32) []byte {
+	secs := uint32(created.Sub(mp4Epoch) / time.Second)
+	return box("mvhd", be32(0), be32(secs), be32(secs), be32(600), be32(seconds*600), make([]byte, 80))
+}
+
+func testVideoTrak(codec string, width, height uint16) []byte {
+	entry := make([]byte, 36)
+	copy(entry[4:8], codec)
+	binary.BigEndian.PutUint16(entry[32:], width)
+	binary.BigEndian.PutUint16(entry[34:], height)
+	binary.BigEndian.PutUint32(entry, uint32(len(entry)))
+	hdlr := box("hdlr", be32(0), be32(0), []byte("vide"), make([]byte, 12))
+	stsd := box("stsd", be32(0), be32(1), entry)
+	return box("trak", box("tkhd", make([]byte, 84)),
+		box("mdia", hdlr, box("minf", box("stbl", stsd))))
+}
+
+func testSoundTrak() []byte {
+	entry := make([]byte, 36)
+	copy(entry[4:8], "mp4a")
+	binary.BigEndian.PutUint32(entry, uint32(len(entry)))
+	hdlr := box("hdlr", be32(0), be32(0), []byte("soun"), make([]byte, 12))
+	return box("trak", box("mdia", hdlr, box("minf", box("stbl", box("stsd", be32(0), be32(1), entry)))))
+}
+
+func writeTestVideo(t *testing.T, name string, moov ...[]byte) string {
+	t.Helper()
+	file := bytes.Join([][]byte{
+		box("ftyp", []byte("qt  \x00\x00\x02\x00qt  ")),
+		box("mdat", make([]byte, 64)),
+		box("moov", moov...),
+	}, nil)
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, file, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractMetadataReadsQuickTimeKeys(t *testing.T) {
+	key := func(name string) []byte { return append(be32(uint32(8+len(name))), append([]byte("mdta"), name...)...) }
+	value := func(idx uint32, s string) []byte {
+		return append(be32(uint32(8+8+8+len(s))), append(be32(idx), box("data", be32(1), be32(0), []byte(s))...)...)
+	}
+	meta := box("meta",
+		box("hdlr", be32(0), be32(0), []byte("mdta"), make([]byte, 12)),
+		box("keys", be32(0), be32(3),
+			key("com.apple.quicktime.location.ISO6709"),
+			key("com.apple.quicktime.make"),
+			key("com.apple.quicktime.creationdate")),
+		box("ilst",
+			value(1, "+48.1351+011.5820+520.000/"),
+			value(2, "Apple"),
+			value(3, "2024-05-31T18:30:15+0200")),
+	)
+	created := time.Date(2024, 5, 31, 20, 0, 0, 0, time.UTC)
+	path := writeTestVideo(t, "IMG_0001.MOV", testMvhd(created, 12), testSoundTrak(), testVideoTrak("hvc1", 3840, 2160), meta)
+
+	got, err := ExtractMetadata(path, "video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CaptureFromMTime || got.CaptureTime != "2024-05-31T16:30:15Z" {
+		t.Fatalf("capture time = %q (from mtime %v)", got.CaptureTime, got.CaptureFromMTime)
+	}
+	if got.GPSLat.Float64 != 48.1351 || got.GPSLon.Float64 != 11.582 || got.Make.String != "Apple" {
+		t.Fatalf("position %v,%v make %q", got.GPSLat, got.GPSLon, got.Make.String)
+	}
+	if got.DurationSec.Float64 != 12 || got.VideoCodec.String != "hvc1" || got.Width.Int64 != 3840 || got.Height.Int64 != 2160 {
+		t.Fatalf("duration %v codec %q size %vx%v", got.DurationSec, got.VideoCodec.String, got.Width, got.Height)
+	}
+}
+
+func TestExtractMetadataReadsMP4Udta(t *testing.T) {
+	text := func(typ, s string) []byte {
+		return box(typ, binary.BigEndian.AppendUint16(nil, uint16(len(s))), []byte{0x15, 0xc7}, []byte(s))
+	}
+	created := time.Date(2023, 8, 2, 7, 15, 0, 0, time.UTC)
+	path := writeTestVideo(t, "VID_0001.MP4", testMvhd(created, 90), testVideoTrak("avc1", 1920, 1080),
+		box("udta", text("\xa9xyz", "-33.8688+151.2093/"), text("\xa9mod", "Pixel 8")))
+
+	got, err := ExtractMetadata(path, "video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CaptureTime != "2023-08-02T07:15:00Z" {
+		t.Fatalf("capture time = %q", got.CaptureTime)
+	}
+	if got.GPSLat.Float64 != -33.8688 || got.GPSLon.Float64 != 151.2093 || got.Model.String != "Pixel 8" {
+		t.Fatalf("position %v,%v model %q", got.GPSLat, got.GPSLon, got.Model.String)
+	}
+	if got.VideoCodec.String != "avc1" || got.DurationSec.Float64 != 90 {
+		t.Fatalf("codec %q duration %v", got.VideoCodec.String, got.DurationSec)
+	}
+}
+
+func TestExtractMetadataVideoWithoutClockUsesMTime(t *testing.T) {
+	path := writeTestVideo(t, "GOPR0001.MP4", testMvhd(mp4Epoch, 5), testVideoTrak("avc1", 1280, 720))
+	got, err := ExtractMetadata(path, "video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CaptureFromMTime {
+		t.Fatalf("capture time %q not taken from mtime", got.CaptureTime)
+	}
+	if got.DurationSec.Float64 != 5 || got.Width.Int64 != 1280 {
+		t.Fatalf("duration %v width %v", got.DurationSec, got.Width)
+	}
+}
@@ -0,0 +1,193 @@
+// Package ocr reads text from photographed documents, whiteboards, and
+// signage with a local OCR command and indexes it for search. It is off
+// unless a command is configured, and images never leave the machine.
+//
+// Only images tagged with one of the configured tags (by default "document"
+// and "whiteboard", which the auto-tagger can assign) are read. The command
+// reads one JPEG on stdin and prints the text it found on stdout, so
+// tesseract works through a one-line wrapper:
+//
+//	#!/bin/sh
+//	exec tesseract stdin stdout -l eng 2>/dev/null
+package ocr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/vision"
+)
+
+const (
+	batchSize = 10
+	// maxTextBytes keeps a page of dense print while bounding the index.
+	maxTextBytes = 64 << 10
+)
+
+var ErrBusy = errors.New("text recognition already running")
+
+type Status struct {
+	Enabled      bool     `json:"enabled"`
+	State        string   `json:"state"` // idle, running, success, error
+	Tags         []string `json:"tags"`
+	LastStarted  string   `json:"last_started"`
+	LastFinished string   `json:"last_finished"`
+	Message      string   `json:"message"`
+	Scanned      int      `json:"scanned"`
+	WithText     int      `json:"with_text"`
+	Skipped      int      `json:"skipped"`
+	Pending      int64    `json:"pending"`
+}
+
+type Reader struct {
+	store   *db.Store
+	logger  *log.Logger
+	command string
+	timeout time.Duration
+	tags    []string
+	libKey  *libcrypt.Key
+
+	runMu  sync.Mutex
+	mu     sync.Mutex
+	status Status
+}
+
+// New returns a reader for images carrying any of tags.
+func New(store *db.Store, logger *log.Logger, command string, timeout time.Duration, tags []string) *Reader {
+	return &Reader{
+		store:   store,
+		logger:  logger,
+		command: command,
+		timeout: timeout,
+		tags:    tags,
+		status:  Status{Enabled: true, State: "idle", Tags: tags, Message: "Waiting for first pass."},
+	}
+}
+
+// SetLibraryKey lets the reader open encrypted library files.
+func (r *Reader) SetLibraryKey(key *libcrypt.Key) {
+	r.libKey = key
+}
+
+func (r *Reader) GetStatus(ctx context.Context) Status {
+	pending, _ := r.store.CountOCRTodos(ctx, r.tags)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.status
+	st.Pending = pending
+	return st
+}
+
+// Start reads immediately and then every interval until ctx ends, picking up
+// images as they are ingested or tagged.
+func (r *Reader) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := r.RunOnce(ctx); err != nil && !errors.Is(err, ErrBusy) && ctx.Err() == nil {
+				r.logger.Printf("text recognition failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce reads every tagged image that has not been read yet. A command
+// failure stops the pass without marking the image, so it is retried next
+// time; images that cannot be decoded are marked and skipped.
+func (r *Reader) RunOnce(ctx context.Context) error {
+	if !r.runMu.TryLock() {
+		return ErrBusy
+	}
+	defer r.runMu.Unlock()
+
+	r.mu.Lock()
+	r.status.State = "running"
+	r.status.LastStarted = time.Now().UTC().Format(time.RFC3339)
+	r.status.Message = "Reading text..."
+	r.mu.Unlock()
+
+	scanned, withText, skipped, err := r.readAll(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.LastFinished = time.Now().UTC().Format(time.RFC3339)
+	r.status.Scanned += scanned
+	r.status.WithText += withText
+	r.status.Skipped += skipped
+	if err != nil {
+		r.status.State = "error"
+		r.status.Message = err.Error()
+		return err
+	}
+	r.status.State = "success"
+	r.status.Message = fmt.Sprintf("Read %d images; %d had text.", scanned, withText)
+	return nil
+}
+
+func (r *Reader) readAll(ctx context.Context) (scanned, withText, skipped int, err error) {
+	for {
+		todos, err := r.store.ListOCRTodos(ctx, r.tags, batchSize)
+		if err != nil {
+			return scanned, withText, skipped, err
+		}
+		if len(todos) == 0 {
+			return scanned, withText, skipped, nil
+		}
+		for _, todo := range todos {
+			if err := ctx.Err(); err != nil {
+				return scanned, withText, skipped, err
+			}
+			text, err := r.read(ctx, todo)
+			scanErr := ""
+			if errors.Is(err, vision.ErrUndecodable) {
+				scanErr = err.Error()
+				skipped++
+			} else if err != nil {
+				return scanned, withText, skipped, err
+			}
+			if err := r.store.RecordOCR(ctx, todo.ID, text, scanErr); err != nil {
+				return scanned, withText, skipped, err
+			}
+			scanned++
+			if text != "" {
+				withText++
+			}
+		}
+	}
+}
+
+func (r *Reader) read(ctx context.Context, todo db.OCRTodo) (string, error) {
+	img, err := vision.LoadScaled(r.libKey, todo.DestPath, todo.Extension, vision.TextMaxDimension)
+	if err != nil {
+		return "", err
+	}
+	text, err := vision.RunText(ctx, r.command, r.timeout, img)
+	if err != nil {
+		return "", err
+	}
+	return truncate(text, maxTextBytes), nil
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,117 @@
+package ocr
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+func TestReaderIndexesTaggedImages(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("OCR stub is a shell script")
+	}
+	dir := t.TempDir()
+	store, err := db.Open(filepath.Join(dir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	insert := func(name string, n int) *db.MediaRecord {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		ts := time.Now().UTC().Format(time.RFC3339)
+		rec := &db.MediaRecord{
+			Kind: "image", FileName: name, Extension: ".png",
+			SourceMount: "/Volumes/Test", SourcePath: "/DCIM/" + name, DestPath: path,
+			SizeBytes: 1, CRC32: fmt.Sprintf("%08x", n), SHA256: fmt.Sprintf("%064x", n),
+			CaptureTime: ts, Metadata: "{}", SourceMTime: ts, IngestedAt: ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		return rec
+	}
+	plate := insert("plate.png", 1)
+	insert("porch.png", 2)
+	if _, err := store.AddMediaTags(ctx, plate.ID, []string{"document"}, db.TagSourceAuto); err != nil {
+		t.Fatalf("AddMediaTags: %v", err)
+	}
+
+	command := filepath.Join(dir, "ocr")
+	script := `#!/bin/sh
+cat >/dev/null
+printf 'ACME Heat Pump\nSerial SN-44127-B\n\f'
+`
+	if err := os.WriteFile(command, []byte(script), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := New(store, log.New(io.Discard, "", 0), command, 10*time.Second, []string{"document", "whiteboard"})
+	if err := reader.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if st := reader.GetStatus(ctx); st.Scanned != 1 || st.WithText != 1 || st.Pending != 0 {
+		t.Fatalf("status = %+v", st)
+	}
+
+	text, err := store.GetMediaText(ctx, plate.ID)
+	if err != nil || text == nil {
+		t.Fatalf("GetMediaText = %v, %v", text, err)
+	}
+	if text.Text != "ACME Heat Pump\nSerial SN-44127-B" {
+		t.Fatalf("text = %q", text.Text)
+	}
+
+	search := func(q string) []string {
+		items, err := store.ListMediaFiltered(ctx, "capture_time", "desc", 10, 0, db.MediaFilter{Query: q})
+		if err != nil {
+			t.Fatalf("search %q: %v", q, err)
+		}
+		names := make([]string, 0, len(items))
+		for _, item := range items {
+			names = append(names, item.FileName)
+		}
+		return names
+	}
+	for _, q := range []string{"sn-44127", "heat pump", "SN 4412", "acme serial"} {
+		if got := search(q); len(got) != 1 || got[0] != "plate.png" {
+			t.Fatalf("search %q = %v, want plate.png", q, got)
+		}
+	}
+	if got := search("porch"); len(got) != 1 || got[0] != "porch.png" {
+		t.Fatalf("file name search = %v", got)
+	}
+	for _, q := range []string{`"acme`, "acme OR NOT", "*", "heat AND (pump"} {
+		search(q)
+	}
+
+	if err := store.DeleteMediaByID(ctx, plate.ID); err != nil {
+		t.Fatalf("DeleteMediaByID: %v", err)
+	}
+	var indexed int
+	if err := store.DB.QueryRowContext(ctx, `SELECT COUNT(1) FROM ocr_text WHERE ocr_text MATCH 'acme'`).Scan(&indexed); err != nil {
+		t.Fatal(err)
+	}
+	if indexed != 0 {
+		t.Fatal("deleted media is still in the text index")
+	}
+}
@@ -0,0 +1,29 @@
+package pathname
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExistsFold reports whether path, or a name in the same folder that differs
+// from it only in case, exists. On case-insensitive volumes (APFS, exFAT,
+// NTFS) the plain stat already answers that; on case-sensitive ones the
+// folder is searched, because "IMG_001.jpg" and "img_001.JPG" would collide
+// as soon as the library is copied to one of the others.
+func ExistsFold(path string) bool {
+	if _, err := os.Lstat(path); err == nil {
+		return true
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	name := filepath.Base(path)
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+// Package pathname turns location and tier names into directory names and
+// archive path segments. Names keep their letters in any script, so "Köln"
+// and "静岡県" stay readable. With ascii set, accented Latin letters are
+// reduced to their base letters ("Köln" becomes "Koln") and anything else is
+// replaced, for filesystems or tools that only cope with ASCII.
+//
+// Library drives are often copied to Windows machines, so names also avoid
+// what Windows rejects: reserved device names, trailing dots and spaces, and
+// paths past MAX_PATH.
+package pathname
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	maxFolderBytes  = 64
+	maxSegmentBytes = 80
+)
+
+// MaxRelPath bounds a path below the library root, counted in UTF-16 units
+// as Windows counts them. It leaves room under the 260 of MAX_PATH for a
+// drive letter and a parent folder or two when the library is copied over.
+const MaxRelPath = 200
+
+// minFitRunes is as far as Fit shortens a folder name.
+const minFitRunes = 8
+
+// Folder returns name as a single directory name, or "" when nothing usable
+// is left. Spaces become underscores.
+func Folder(name string, ascii bool) string {
+	name = strings.Trim(clean(name, ascii, '_'), "_.")
+	return avoidReserved(strings.Trim(truncate(name, maxFolderBytes), "_."))
+}
+
+// ArchiveSegment returns name as one path segment of an archive entry, or ""
+// when nothing usable is left. Spaces are kept.
+func ArchiveSegment(name string, ascii bool) string {
+	name = strings.Trim(clean(name, ascii, ' '), "_. ")
+	return avoidReserved(strings.Trim(truncate(name, maxSegmentBytes), "_. "))
+}
+
+// File makes an already generated file name safe to create on Windows:
+// characters Windows forbids become "_", trailing dots and spaces go, and a
+// reserved device name gets a "_" appended.
+func File(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	return avoidReserved(strings.TrimRight(name, ". "))
+}
+
+// reservedNames are the DOS device names Windows will not open as files,
+// with or without an extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+func avoidReserved(name string) string {
+	stem, ext, hasExt := strings.Cut(name, ".")
+	if !reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		return name
+	}
+	if !hasExt {
+		return name + "_"
+	}
+	return stem + "_." + ext
+}
+
+// Fit shortens the longest of dirs, then stem, until dirs/stem+suffix is no
+// longer than MaxRelPath. suffix (a hash and extension) is kept whole, and
+// folders are not cut below a few characters, so a path may stay over the
+// limit when there is nothing sensible left to cut.
+func Fit(dirs []string, stem, suffix string) ([]string, string) {
+	dirs = append([]string(nil), dirs...)
+	for {
+		over := utf16Len(stem) + utf16Len(suffix) - MaxRelPath
+		for _, d := range dirs {
+			over += utf16Len(d) + 1
+		}
+		if over <= 0 {
+			return dirs, stem
+		}
+		longest := -1
+		for i, d := range dirs {
+			if n := utf8.RuneCountInString(d); n > minFitRunes && (longest < 0 || n > utf8.RuneCountInString(dirs[longest])) {
+				longest = i
+			}
+		}
+		if longest >= 0 {
+			d := dirs[longest]
+			keep := max(minFitRunes, utf8.RuneCountInString(d)-over)
+			d = strings.TrimRight(firstRunes(d, keep), "_. ")
+			if d == "" {
+				d = "_"
+			}
+			dirs[longest] = avoidReserved(d)
+			continue
+		}
+		n := utf8.RuneCountInString(stem)
+		if n <= 1 {
+			return dirs, stem
+		}
+		stem = strings.TrimRight(firstRunes(stem, max(1, n-over)), ". ")
+		if stem == "" {
+			stem = "_"
+		}
+	}
+}
+
+func firstRunes(s string, n int) string {
+	i := 0
+	for j := range s {
+		if i == n {
+			return s[:j]
+		}
+		i++
+	}
+	return s
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+func clean(name string, ascii bool, space rune) string {
+	name = strings.TrimSpace(name)
+	if ascii {
+		name = Transliterate(name)
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '.', r == '-', r == '_':
+			return r
+		case r == ' ':
+			return space
+		case ascii || r == utf8.RuneError:
+			return '_'
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsMark(r):
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// Transliterate replaces accented and other Latin letters with their plain
+// ASCII base letters. Characters it has no spelling for are left as they are.
+func Transliterate(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+		if t, ok := latin[r]; ok {
+			b.WriteString(t)
+			continue
+		}
+		if unicode.Is(unicode.Mn, r) {
+			continue // stray combining accent
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// latin covers Latin-1 Supplement and Latin Extended-A, which between them
+// spell most European place names, plus the Romanian comma-below letters.
+var latin = map[rune]string{
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Æ': "AE", 'Ç': "C",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I",
+	'Ð': "D", 'Ñ': "N", 'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U", 'Ý': "Y", 'Þ': "Th", 'ß': "ss",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae", 'ç': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ð': "d", 'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'þ': "th", 'ÿ': "y",
+
+	'Ā': "A", 'ā': "a", 'Ă': "A", 'ă': "a", 'Ą': "A", 'ą': "a",
+	'Ć': "C", 'ć': "c", 'Ĉ': "C", 'ĉ': "c", 'Ċ': "C", 'ċ': "c", 'Č': "C", 'č': "c",
+	'Ď': "D", 'ď': "d", 'Đ': "D", 'đ': "d",
+	'Ē': "E", 'ē': "e", 'Ĕ': "E", 'ĕ': "e", 'Ė': "E", 'ė': "e", 'Ę': "E", 'ę': "e", 'Ě': "E", 'ě': "e",
+	'Ĝ': "G", 'ĝ': "g", 'Ğ': "G", 'ğ': "g", 'Ġ': "G", 'ġ': "g", 'Ģ': "G", 'ģ': "g",
+	'Ĥ': "H", 'ĥ': "h", 'Ħ': "H", 'ħ': "h",
+	'Ĩ': "I", 'ĩ': "i", 'Ī': "I", 'ī': "i", 'Ĭ': "I", 'ĭ': "i", 'Į': "I", 'į': "i", 'İ': "I", 'ı': "i",
+	'Ĳ': "IJ", 'ĳ': "ij", 'Ĵ': "J", 'ĵ': "j", 'Ķ': "K", 'ķ': "k", 'ĸ': "k",
+	'Ĺ': "L", 'ĺ': "l", 'Ļ': "L", 'ļ': "l", 'Ľ': "L", 'ľ': "l", 'Ŀ': "L", 'ŀ': "l", 'Ł': "L", 'ł': "l",
+	'Ń': "N", 'ń': "n", 'Ņ': "N", 'ņ': "n", 'Ň': "N", 'ň': "n", 'ŉ': "n", 'Ŋ': "N", 'ŋ': "n",
+	'Ō': "O", 'ō': "o", 'Ŏ': "O", 'ŏ': "o", 'Ő': "O", 'ő': "o", 'Œ': "OE", 'œ': "oe",
+	'Ŕ': "R", 'ŕ': "r", 'Ŗ': "R", 'ŗ': "r", 'Ř': "R", 'ř': "r",
+	'Ś': "S", 'ś': "s", 'Ŝ': "S", 'ŝ': "s", 'Ş': "S", 'ş': "s", 'Š': "S", 'š': "s",
+	'Ţ': "T", 'ţ': "t", 'Ť': "T", 'ť': "t", 'Ŧ': "T", 'ŧ': "t",
+	'Ũ': "U", 'ũ': "u", 'Ū': "U", 'ū': "u", 'Ŭ': "U", 'ŭ': "u", 'Ů': "U", 'ů': "u",
+	'Ű': "U", 'ű': "u", 'Ų': "U", 'ų': "u",
+	'Ŵ': "W", 'ŵ': "w", 'Ŷ': "Y", 'ŷ': "y", 'Ÿ': "Y",
+	'Ź': "Z", 'ź': "z", 'Ż': "Z", 'ż': "z", 'Ž': "Z", 'ž': "z", 'ſ': "s",
+
+	'Ș': "S", 'ș': "s", 'Ț': "T", 'ț': "t",
+}
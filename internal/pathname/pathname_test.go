@@ -0,0 +1,93 @@
+package pathname
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFolder(t *testing.T) {
+	cases := []struct {
+		in    string
+		ascii bool
+		want  string
+	}{
+		{"Köln", false, "Köln"},
+		{"静岡県", false, "静岡県"},
+		{"Saint-Étienne", false, "Saint-Étienne"},
+		{"New York", false, "New_York"},
+		{"a/b\\c:d", false, "a_b_c_d"},
+		{"Köln", true, "Koln"},
+		{"Ko\u0308ln", true, "Koln"}, // decomposed, as macOS hands it back
+		{"Łódź Straße", true, "Lodz_Strasse"},
+		{"静岡県", true, ""},
+		{" ..Unknown.. ", false, "Unknown"},
+	}
+	for _, tc := range cases {
+		if got := Folder(tc.in, tc.ascii); got != tc.want {
+			t.Errorf("Folder(%q, %v) = %q, want %q", tc.in, tc.ascii, got, tc.want)
+		}
+	}
+}
+
+func TestArchiveSegmentKeepsSpaces(t *testing.T) {
+	if got := ArchiveSegment("São Paulo", false); got != "São Paulo" {
+		t.Errorf("ArchiveSegment = %q", got)
+	}
+	if got := ArchiveSegment("São Paulo", true); got != "Sao Paulo" {
+		t.Errorf("ArchiveSegment ascii = %q", got)
+	}
+}
+
+func TestFolderTruncatesOnCharacterBoundary(t *testing.T) {
+	got := Folder(strings.Repeat("県", 30), false)
+	if len(got) > maxFolderBytes || !utf8.ValidString(got) {
+		t.Fatalf("Folder truncated to %d bytes, valid UTF-8 %v", len(got), utf8.ValidString(got))
+	}
+}
+
+func TestWindowsReservedNames(t *testing.T) {
+	cases := map[string]string{
+		"CON":         "CON_",
+		"nul":         "nul_",
+		"Com1.jpg":    "Com1_.jpg",
+		"LPT9.tar.gz": "LPT9_.tar.gz",
+		"CONSOLE":     "CONSOLE",
+		"COM10":       "COM10",
+	}
+	for in, want := range cases {
+		if got := File(in); got != want {
+			t.Errorf("File(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := Folder("Aux", false); got != "Aux_" {
+		t.Errorf("Folder(Aux) = %q", got)
+	}
+	if got := File(`a:b*c?.jpg. `); got != "a_b_c_.jpg" {
+		t.Errorf("File = %q", got)
+	}
+}
+
+func TestFit(t *testing.T) {
+	long := strings.Repeat("Straße", 10)
+	dirs := []string{"Bayern", long, long, "2024", "06", "01"}
+	got, stem := Fit(dirs, "IMG_0001", "_0123abcd.jpg")
+	total := utf16Len(stem) + utf16Len("_0123abcd.jpg")
+	for _, d := range got {
+		total += utf16Len(d) + 1
+	}
+	if total > MaxRelPath {
+		t.Fatalf("Fit left %d units: %q", total, got)
+	}
+	if got[0] != "Bayern" || got[3] != "2024" || stem != "IMG_0001" {
+		t.Errorf("Fit shortened short parts: %q %q", got, stem)
+	}
+	if dirs[1] != long {
+		t.Error("Fit modified its argument")
+	}
+
+	_, stem = Fit([]string{"2024", "06", "01"}, strings.Repeat("x", 300), ".jpg")
+	if n := len(stem); n == 0 || n+len("2024/06/01/.jpg") > MaxRelPath {
+		t.Errorf("stem not shortened to fit: %d", n)
+	}
+}
@@ -0,0 +1,327 @@
+// Package power decides how hard a vault may work from where its power
+// comes from. A capture box on a solar panel and a battery reads its power
+// state from the operating system or a UPS and picks the matching profile,
+// which slows card polling, limits hashing, and holds back backups and
+// background jobs until there is power to spare.
+package power
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/scheduler"
+)
+
+// SettingKey stores Settings as JSON.
+const SettingKey = "power"
+
+// Power states, from most to least power available.
+const (
+	StateMains    = "mains"
+	StateBattery  = "battery"
+	StateCritical = "critical"
+)
+
+// Sources of the power state.
+const (
+	SourceManual = "manual" // the state set in Settings.State
+	SourceSysfs  = "sysfs"  // Linux /sys/class/power_supply
+	SourceNUT    = "nut"    // a UPS through Network UPS Tools' upsc
+)
+
+// When a profile lets backups start.
+const (
+	BackupsAny    = "any"
+	BackupsWindow = "window"
+	BackupsOff    = "off"
+)
+
+const (
+	maxScanSeconds     = 3600
+	maxHashWorkers     = 64
+	maxSuspendMinutes  = 24 * 60
+	defaultCriticalPct = 20
+	upscTimeout        = 10 * time.Second
+)
+
+// SysfsRoot is where power supplies are read from with SourceSysfs.
+var SysfsRoot = "/sys/class/power_supply"
+
+// Profile is what the vault may do in one power state.
+type Profile struct {
+	// USBScanSeconds is how often cards are looked for; 0 keeps
+	// USBVAULT_SCAN_INTERVAL_SECONDS.
+	USBScanSeconds int `json:"usb_scan_seconds"`
+	// HashWorkers caps the resource budget's hash threads and the ingest
+	// workers; 0 leaves them as configured.
+	HashWorkers  int    `json:"hash_workers"`
+	Backups      string `json:"backups"`
+	BackupWindow string `json:"backup_window,omitempty"` // daily, for BackupsWindow
+	// BackgroundJobs lets the scheduler run its jobs.
+	BackgroundJobs bool `json:"background_jobs"`
+	// SuspendAfterIdleMinutes fires the power-idle hook once the vault has
+	// been idle this long; 0 never does.
+	SuspendAfterIdleMinutes int `json:"suspend_after_idle_minutes"`
+}
+
+// Settings is the stored power setup.
+type Settings struct {
+	Source string `json:"source"`
+	State  string `json:"state"` // for SourceManual
+	UPS    string `json:"ups"`   // for SourceNUT, as upsc takes it: ups@host
+	// CriticalPercent is the battery charge below which the state is
+	// critical.
+	CriticalPercent int                `json:"critical_percent"`
+	Profiles        map[string]Profile `json:"profiles"`
+}
+
+// DefaultProfiles leave a vault on mains alone, hold a vault on battery to
+// one hash worker with backups around midday, and stop all but card ingest
+// on a nearly empty battery.
+func DefaultProfiles() map[string]Profile {
+	return map[string]Profile{
+		StateMains:    {Backups: BackupsAny, BackgroundJobs: true},
+		StateBattery:  {USBScanSeconds: 15, HashWorkers: 1, Backups: BackupsWindow, BackupWindow: "11:00-15:00"},
+		StateCritical: {USBScanSeconds: 60, HashWorkers: 1, Backups: BackupsOff, SuspendAfterIdleMinutes: 15},
+	}
+}
+
+// Default is a vault on mains power.
+func Default() Settings {
+	return Settings{Source: SourceManual, State: StateMains, CriticalPercent: defaultCriticalPct, Profiles: DefaultProfiles()}
+}
+
+// Parse reads Settings as stored under SettingKey and normalizes them.
+func Parse(raw string) (Settings, error) {
+	if strings.TrimSpace(raw) == "" {
+		return Default(), nil
+	}
+	var s Settings
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return Default(), err
+	}
+	return s.Normalize()
+}
+
+// Normalize fills in defaults, including the profile of any state left out,
+// and checks ranges.
+func (s Settings) Normalize() (Settings, error) {
+	s.Source = strings.ToLower(strings.TrimSpace(s.Source))
+	if s.Source == "" {
+		s.Source = SourceManual
+	}
+	s.State = strings.ToLower(strings.TrimSpace(s.State))
+	if s.State == "" {
+		s.State = StateMains
+	}
+	s.UPS = strings.TrimSpace(s.UPS)
+	if s.CriticalPercent == 0 {
+		s.CriticalPercent = defaultCriticalPct
+	}
+	switch s.Source {
+	case SourceManual, SourceSysfs:
+	case SourceNUT:
+		if s.UPS == "" || strings.HasPrefix(s.UPS, "-") {
+			return Settings{}, errors.New("ups must name the UPS, such as ups@localhost")
+		}
+	default:
+		return Settings{}, fmt.Errorf("source must be %s, %s, or %s", SourceManual, SourceSysfs, SourceNUT)
+	}
+	if !validState(s.State) {
+		return Settings{}, fmt.Errorf("state must be %s, %s, or %s", StateMains, StateBattery, StateCritical)
+	}
+	if s.CriticalPercent < 1 || s.CriticalPercent > 99 {
+		return Settings{}, errors.New("critical_percent must be between 1 and 99")
+	}
+
+	profiles := DefaultProfiles()
+	for state, p := range s.Profiles {
+		state = strings.ToLower(strings.TrimSpace(state))
+		if !validState(state) {
+			return Settings{}, fmt.Errorf("unknown power state %q", state)
+		}
+		p, err := p.normalize()
+		if err != nil {
+			return Settings{}, fmt.Errorf("%s: %w", state, err)
+		}
+		profiles[state] = p
+	}
+	s.Profiles = profiles
+	return s, nil
+}
+
+func validState(state string) bool {
+	return state == StateMains || state == StateBattery || state == StateCritical
+}
+
+func (p Profile) normalize() (Profile, error) {
+	p.Backups = strings.ToLower(strings.TrimSpace(p.Backups))
+	if p.Backups == "" {
+		p.Backups = BackupsAny
+	}
+	p.BackupWindow = strings.TrimSpace(p.BackupWindow)
+	switch p.Backups {
+	case BackupsAny, BackupsOff:
+		p.BackupWindow = ""
+	case BackupsWindow:
+		if p.BackupWindow == "" {
+			return Profile{}, errors.New("backups \"window\" needs a backup_window")
+		}
+		if err := scheduler.CheckWindow(p.BackupWindow); err != nil {
+			return Profile{}, err
+		}
+	default:
+		return Profile{}, fmt.Errorf("backups must be %s, %s, or %s", BackupsAny, BackupsWindow, BackupsOff)
+	}
+	if p.USBScanSeconds != 0 && (p.USBScanSeconds < 2 || p.USBScanSeconds > maxScanSeconds) {
+		return Profile{}, fmt.Errorf("usb_scan_seconds must be 0 or between 2 and %d", maxScanSeconds)
+	}
+	if p.HashWorkers < 0 || p.HashWorkers > maxHashWorkers {
+		return Profile{}, fmt.Errorf("hash_workers must be between 0 and %d", maxHashWorkers)
+	}
+	if p.SuspendAfterIdleMinutes < 0 || p.SuspendAfterIdleMinutes > maxSuspendMinutes {
+		return Profile{}, fmt.Errorf("suspend_after_idle_minutes must be between 0 and %d", maxSuspendMinutes)
+	}
+	return p, nil
+}
+
+// BackupAllowed reports whether a backup may start at t, and if not, why.
+func (p Profile) BackupAllowed(t time.Time) (bool, string) {
+	switch p.Backups {
+	case BackupsOff:
+		return false, "backups are off"
+	case BackupsWindow:
+		if !scheduler.InWindow(p.BackupWindow, t) {
+			return false, "backups only start between " + strings.Replace(p.BackupWindow, "-", " and ", 1)
+		}
+	}
+	return true, ""
+}
+
+// Reading is the power state found at one point in time.
+type Reading struct {
+	State string `json:"state"`
+	// ChargePercent is the battery charge, or -1 when unknown.
+	ChargePercent int    `json:"charge_percent"`
+	Detail        string `json:"detail,omitempty"`
+}
+
+// Read finds the current power state from the configured source.
+func Read(ctx context.Context, s Settings) (Reading, error) {
+	switch s.Source {
+	case SourceSysfs:
+		return readSysfs(SysfsRoot, s.CriticalPercent)
+	case SourceNUT:
+		ctx, cancel := context.WithTimeout(ctx, upscTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "upsc", s.UPS).Output()
+		if err != nil {
+			return Reading{}, fmt.Errorf("upsc %s: %w", s.UPS, err)
+		}
+		return parseUPSC(out, s.CriticalPercent)
+	}
+	return Reading{State: s.State, ChargePercent: -1, Detail: "set by hand"}, nil
+}
+
+func stateFor(onBattery, low bool, charge, criticalPct int) string {
+	switch {
+	case !onBattery:
+		return StateMains
+	case low || (charge >= 0 && charge < criticalPct):
+		return StateCritical
+	}
+	return StateBattery
+}
+
+// parseUPSC reads the ups.status flags (OL on line, OB on battery, LB low
+// battery) and battery.charge from upsc output.
+func parseUPSC(out []byte, criticalPct int) (Reading, error) {
+	var status string
+	charge := -1
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "ups.status":
+			status = value
+		case "battery.charge":
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				charge = int(f)
+			}
+		}
+	}
+	if status == "" {
+		return Reading{}, errors.New("upsc reported no ups.status")
+	}
+	flags := strings.Fields(status)
+	has := func(flag string) bool {
+		for _, f := range flags {
+			if f == flag {
+				return true
+			}
+		}
+		return false
+	}
+	onBattery := has("OB") && !has("OL")
+	return Reading{
+		State:         stateFor(onBattery, has("LB"), charge, criticalPct),
+		ChargePercent: charge,
+		Detail:        "ups " + status,
+	}, nil
+}
+
+// readSysfs looks at every supply below root. Any mains or USB supply that
+// is online means mains power; with none present, a discharging battery
+// means battery power. The lowest battery charge counts.
+func readSysfs(root string, criticalPct int) (Reading, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return Reading{}, err
+	}
+	read := func(dir, name string) string {
+		b, _ := os.ReadFile(filepath.Join(root, dir, name))
+		return strings.TrimSpace(string(b))
+	}
+	var hasMains, mainsOnline, hasBattery, discharging bool
+	charge := -1
+	for _, e := range entries {
+		switch read(e.Name(), "type") {
+		case "Mains", "USB", "USB_C", "USB_PD":
+			hasMains = true
+			if read(e.Name(), "online") == "1" {
+				mainsOnline = true
+			}
+		case "Battery":
+			hasBattery = true
+			if read(e.Name(), "status") == "Discharging" {
+				discharging = true
+			}
+			if n, err := strconv.Atoi(read(e.Name(), "capacity")); err == nil && (charge < 0 || n < charge) {
+				charge = n
+			}
+		}
+	}
+	if !hasMains && !hasBattery {
+		return Reading{}, fmt.Errorf("no power supplies found in %s", root)
+	}
+	onBattery := (hasMains && !mainsOnline) || (!hasMains && discharging)
+	detail := "external power"
+	if onBattery {
+		detail = "running on battery"
+	}
+	return Reading{State: stateFor(onBattery, false, charge, criticalPct), ChargePercent: charge, Detail: detail}, nil
+}
@@ -0,0 +1,97 @@
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseUPSC(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		out    string
+		state  string
+		charge int
+	}{
+		{"battery.charge: 100\nups.status: OL\n", StateMains, 100},
+		{"battery.charge: 64\nups.status: OB DISCHRG\n", StateBattery, 64},
+		{"battery.charge: 12\nups.status: OB DISCHRG\n", StateCritical, 12},
+		{"battery.charge: 40\nups.status: OB LB\n", StateCritical, 40},
+		{"ups.status: OL CHRG\n", StateMains, -1},
+	}
+	for _, c := range cases {
+		r, err := parseUPSC([]byte(c.out), 20)
+		if err != nil || r.State != c.state || r.ChargePercent != c.charge {
+			t.Errorf("parseUPSC(%q) = %+v, %v; want %s at %d%%", c.out, r, err, c.state, c.charge)
+		}
+	}
+	if _, err := parseUPSC([]byte("Init SSL without certificate database\n"), 20); err == nil {
+		t.Error("parseUPSC accepted output without ups.status")
+	}
+}
+
+func writeSupply(t *testing.T, root, name string, files map[string]string) {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range files {
+		if err := os.WriteFile(filepath.Join(dir, k), []byte(v+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadSysfs(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	if _, err := readSysfs(root, 20); err == nil {
+		t.Fatal("readSysfs without supplies succeeded")
+	}
+	writeSupply(t, root, "BAT0", map[string]string{"type": "Battery", "status": "Discharging", "capacity": "55"})
+	if r, err := readSysfs(root, 20); err != nil || r.State != StateBattery || r.ChargePercent != 55 {
+		t.Fatalf("battery only = %+v, %v", r, err)
+	}
+	writeSupply(t, root, "AC", map[string]string{"type": "Mains", "online": "1"})
+	if r, err := readSysfs(root, 20); err != nil || r.State != StateMains {
+		t.Fatalf("with mains online = %+v, %v", r, err)
+	}
+	writeSupply(t, root, "AC", map[string]string{"online": "0"})
+	writeSupply(t, root, "BAT0", map[string]string{"capacity": "9"})
+	if r, err := readSysfs(root, 20); err != nil || r.State != StateCritical {
+		t.Fatalf("mains offline at 9%% = %+v, %v", r, err)
+	}
+}
+
+func TestNormalizeAndBackupWindow(t *testing.T) {
+	t.Parallel()
+	s, err := Parse(`{"source": "manual", "state": "battery", "profiles": {"battery": {"backups": "window", "backup_window": "22:00-02:00", "hash_workers": 2}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := s.Profiles[StateBattery]
+	if p.HashWorkers != 2 || s.Profiles[StateCritical].Backups != BackupsOff || s.CriticalPercent != defaultCriticalPct {
+		t.Fatalf("normalized = %+v", s)
+	}
+	at := func(h int) time.Time { return time.Date(2026, 6, 1, h, 30, 0, 0, time.Local) }
+	if ok, _ := p.BackupAllowed(at(23)); !ok {
+		t.Error("backup refused inside its window")
+	}
+	if ok, why := p.BackupAllowed(at(12)); ok || why != "backups only start between 22:00 and 02:00" {
+		t.Errorf("backup outside its window = %v, %q", ok, why)
+	}
+
+	for _, bad := range []string{
+		`{"source": "nut"}`,
+		`{"state": "solar"}`,
+		`{"profiles": {"battery": {"backups": "window"}}}`,
+		`{"profiles": {"battery": {"usb_scan_seconds": 1}}}`,
+		`{"profiles": {"eclipse": {}}}`,
+	} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%s) accepted", bad)
+		}
+	}
+}
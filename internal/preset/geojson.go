@@ -0,0 +1,52 @@
+package preset
+
+import (
+	"encoding/json"
+
+	"businessplan/usbvault/internal/db"
+)
+
+// GeoEntry pairs an exported file name with its record.
+type GeoEntry struct {
+	Name   string
+	Record db.MediaRecord
+}
+
+// GeoJSON builds a FeatureCollection with one point per geotagged file, so
+// GIS tools can place the export without reading EXIF. Files without GPS
+// are left out.
+func GeoJSON(entries []GeoEntry) ([]byte, error) {
+	features := make([]map[string]any, 0, len(entries))
+	for _, e := range entries {
+		rec := e.Record
+		if !rec.GPSLat.Valid || !rec.GPSLon.Valid {
+			continue
+		}
+		props := map[string]any{
+			"file":         e.Name,
+			"capture_time": rec.CaptureTime,
+			"sha256":       rec.SHA256,
+		}
+		if rec.Make.Valid {
+			props["make"] = rec.Make.String
+		}
+		if rec.Model.Valid {
+			props["model"] = rec.Model.String
+		}
+		if rec.CameraYaw.Valid {
+			props["camera_yaw"] = rec.CameraYaw.Float64
+		}
+		if rec.CameraPitch.Valid {
+			props["camera_pitch"] = rec.CameraPitch.Float64
+		}
+		if rec.CameraRoll.Valid {
+			props["camera_roll"] = rec.CameraRoll.Float64
+		}
+		features = append(features, map[string]any{
+			"type":       "Feature",
+			"geometry":   map[string]any{"type": "Point", "coordinates": []float64{rec.GPSLon.Float64, rec.GPSLat.Float64}},
+			"properties": props,
+		})
+	}
+	return json.MarshalIndent(map[string]any{"type": "FeatureCollection", "features": features}, "", "  ")
+}
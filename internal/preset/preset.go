@@ -0,0 +1,215 @@
+// Package preset describes how media is prepared when it is exported:
+// delivered as originals, or re-encoded at a bounded size, optionally with a
+// GeoJSON index of where each file was taken.
+package preset
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"regexp"
+	"strings"
+
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/watermark"
+)
+
+const SettingKey = "export_presets"
+
+const (
+	FormatOriginal = "original"
+	FormatJPEG     = "jpeg"
+	FormatPNG      = "png"
+
+	VideosOriginal = "original"
+	VideosSkip     = "skip"
+)
+
+const maxPresets = 50
+
+// Preset is applied to every file in an export. Images that cannot be
+// decoded (RAW, HEIC, TIFF) are delivered as originals whatever the format,
+// except by proof presets, which watermark every image and leave out
+// anything they cannot watermark.
+type Preset struct {
+	Name         string `json:"name"`
+	Label        string `json:"label"`
+	Format       string `json:"format"`
+	MaxDimension int    `json:"max_dimension,omitempty"`
+	Quality      int    `json:"quality,omitempty"`
+	Videos       string `json:"videos"`
+	GeoJSON      bool   `json:"geojson,omitempty"`
+	Proof        bool   `json:"proof,omitempty"`
+	Builtin      bool   `json:"builtin,omitempty"`
+
+	Watermark *watermark.Spec `json:"watermark,omitempty"`
+}
+
+var builtins = []Preset{
+	{Name: "originals", Label: "Client originals", Format: FormatOriginal, Videos: VideosOriginal},
+	{Name: "web-2048", Label: "Web 2048px JPEG q85", Format: FormatJPEG, MaxDimension: 2048, Quality: 85, Videos: VideosSkip},
+	{Name: "gis", Label: "GIS originals with GeoJSON", Format: FormatOriginal, Videos: VideosOriginal, GeoJSON: true},
+	{Name: "proof-1600", Label: "Watermarked proofs 1600px", Format: FormatJPEG, MaxDimension: 1600, Quality: 80, Videos: VideosSkip, Proof: true, Watermark: defaultWatermark()},
+}
+
+func defaultWatermark() *watermark.Spec {
+	s := watermark.Default()
+	return &s
+}
+
+var nameRx = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,39}$`)
+
+func (p Preset) normalize() (Preset, error) {
+	p.Name = strings.ToLower(strings.TrimSpace(p.Name))
+	p.Label = strings.TrimSpace(p.Label)
+	p.Format = strings.ToLower(strings.TrimSpace(p.Format))
+	p.Videos = strings.ToLower(strings.TrimSpace(p.Videos))
+	p.Builtin = false
+	if !nameRx.MatchString(p.Name) {
+		return p, fmt.Errorf("preset name %q must be 1-40 lowercase letters, digits, - or _", p.Name)
+	}
+	if p.Label == "" {
+		p.Label = p.Name
+	}
+	switch p.Format {
+	case "", FormatOriginal:
+		p.Format = FormatOriginal
+		p.MaxDimension, p.Quality = 0, 0
+	case "jpg", FormatJPEG:
+		p.Format = FormatJPEG
+		if p.Quality == 0 {
+			p.Quality = 85
+		}
+		if p.Quality < 1 || p.Quality > 100 {
+			return p, fmt.Errorf("%s: quality must be 1-100", p.Name)
+		}
+	case FormatPNG:
+		p.Quality = 0
+	default:
+		return p, fmt.Errorf("%s: format must be original, jpeg, or png", p.Name)
+	}
+	if p.MaxDimension < 0 || p.MaxDimension > 20000 {
+		return p, fmt.Errorf("%s: max_dimension must be 0-20000", p.Name)
+	}
+	switch p.Videos {
+	case "":
+		p.Videos = VideosOriginal
+	case VideosOriginal, VideosSkip:
+	default:
+		return p, fmt.Errorf("%s: videos must be original or skip", p.Name)
+	}
+	if !p.Proof {
+		p.Watermark = nil
+		return p, nil
+	}
+	if p.Format == FormatOriginal {
+		return p, fmt.Errorf("%s: proof presets must convert to jpeg or png", p.Name)
+	}
+	// Videos cannot be watermarked, so proofs never carry them.
+	p.Videos = VideosSkip
+	if p.Watermark == nil {
+		p.Watermark = defaultWatermark()
+	}
+	mark, err := p.Watermark.Normalize()
+	if err != nil {
+		return p, fmt.Errorf("%s: %w", p.Name, err)
+	}
+	p.Watermark = &mark
+	return p, nil
+}
+
+// Compile validates user presets. Names must be unique and must not shadow
+// a built-in preset.
+func Compile(list []Preset) ([]Preset, error) {
+	if len(list) > maxPresets {
+		return nil, errors.New("too many presets")
+	}
+	out := make([]Preset, 0, len(list))
+	seen := map[string]bool{}
+	for _, b := range builtins {
+		seen[b.Name] = true
+	}
+	for _, p := range list {
+		p, err := p.normalize()
+		if err != nil {
+			return nil, err
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("preset %q already exists", p.Name)
+		}
+		seen[p.Name] = true
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// Parse reads the saved user presets.
+func Parse(raw string) ([]Preset, error) {
+	if strings.TrimSpace(raw) == "" {
+		return []Preset{}, nil
+	}
+	var list []Preset
+	if err := json.Unmarshal([]byte(raw), &list); err != nil {
+		return nil, fmt.Errorf("invalid export presets: %w", err)
+	}
+	return Compile(list)
+}
+
+// All returns the built-in presets followed by the user's.
+func All(user []Preset) []Preset {
+	out := make([]Preset, 0, len(builtins)+len(user))
+	for _, b := range builtins {
+		b.Builtin = true
+		out = append(out, b)
+	}
+	return append(out, user...)
+}
+
+// Default is the preset used when an export names none: plain originals.
+func Default() Preset {
+	return All(nil)[0]
+}
+
+func Find(user []Preset, name string) (Preset, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, p := range All(user) {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Preset{}, false
+}
+
+// Converts reports whether files with this kind and extension are
+// re-encoded rather than copied.
+func (p Preset) Converts(kind, ext string) bool {
+	return p.Format != FormatOriginal && kind == "image" && media.CanDecodeImage(ext)
+}
+
+// Extension is the file extension a converted file gets.
+func (p Preset) Extension() string {
+	if p.Format == FormatPNG {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// Render re-encodes one image according to the preset, stamping it with
+// mark when that is not nil.
+func (p Preset) Render(dst io.Writer, src io.ReadSeeker, mark *watermark.Mark) error {
+	img, err := media.DecodeImage(src)
+	if err != nil {
+		return err
+	}
+	img = media.ResizeToFit(img, p.MaxDimension)
+	if mark != nil {
+		mark.Apply(img)
+	}
+	if p.Format == FormatPNG {
+		return png.Encode(dst, img)
+	}
+	return jpeg.Encode(dst, img, &jpeg.Options{Quality: p.Quality})
+}
@@ -0,0 +1,137 @@
+package preset
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/watermark"
+)
+
+func TestCompileValidatesPresets(t *testing.T) {
+	t.Parallel()
+
+	list, err := Compile([]Preset{{Name: " Proofs ", Format: "JPG", MaxDimension: 1600}})
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	got := list[0]
+	if got.Name != "proofs" || got.Format != FormatJPEG || got.Quality != 85 || got.Videos != VideosOriginal || got.Label != "proofs" {
+		t.Fatalf("normalized preset = %+v", got)
+	}
+
+	for _, bad := range [][]Preset{
+		{{Name: "web-2048", Format: FormatJPEG}},
+		{{Name: "a", Format: "webp"}},
+		{{Name: "a", Format: FormatJPEG, Quality: 101}},
+		{{Name: "a", Videos: "transcode"}},
+		{{Name: "a"}, {Name: "A"}},
+		{{Name: "has space"}},
+	} {
+		if _, err := Compile(bad); err == nil {
+			t.Errorf("Compile(%+v) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestCompileProofPresets(t *testing.T) {
+	t.Parallel()
+
+	list, err := Compile([]Preset{{Name: "review", Format: FormatPNG, Proof: true}, {Name: "plain", Format: FormatJPEG, Watermark: &watermark.Spec{Text: "X"}}})
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if p := list[0]; p.Videos != VideosSkip || p.Watermark == nil || p.Watermark.Text != "PROOF" {
+		t.Fatalf("proof preset = %+v, want default watermark and skipped videos", p)
+	}
+	if list[1].Watermark != nil {
+		t.Fatalf("non-proof preset kept watermark %+v", list[1].Watermark)
+	}
+	for _, bad := range []Preset{
+		{Name: "a", Proof: true},
+		{Name: "a", Format: FormatJPEG, Proof: true, Watermark: &watermark.Spec{}},
+	} {
+		if _, err := Compile([]Preset{bad}); err == nil {
+			t.Errorf("Compile(%+v) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestRenderResizesAndConverts(t *testing.T) {
+	t.Parallel()
+
+	src := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 400; x++ {
+			src.Set(x, y, color.RGBA{R: 200, G: 40, B: 40, A: 255})
+		}
+	}
+	var in bytes.Buffer
+	if err := png.Encode(&in, src); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	p, ok := Find(nil, "web-2048")
+	if !ok {
+		t.Fatal("built-in web-2048 preset missing")
+	}
+	p.MaxDimension = 100
+	if !p.Converts("image", ".PNG") || p.Converts("image", ".dng") || p.Converts("video", ".mp4") {
+		t.Fatal("Converts picked the wrong files")
+	}
+	var out bytes.Buffer
+	if err := p.Render(&out, bytes.NewReader(in.Bytes()), nil); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	img, err := jpeg.Decode(&out)
+	if err != nil {
+		t.Fatalf("output is not a JPEG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 25 {
+		t.Fatalf("output is %dx%d, want 100x25", b.Dx(), b.Dy())
+	}
+	r, g, _, _ := img.At(50, 12).RGBA()
+	if r>>8 < 180 || g>>8 > 70 {
+		t.Fatalf("resized colour drifted: r=%d g=%d", r>>8, g>>8)
+	}
+}
+
+func TestGeoJSONSkipsUngeotaggedFiles(t *testing.T) {
+	t.Parallel()
+
+	body, err := GeoJSON([]GeoEntry{
+		{Name: "a.jpg", Record: db.MediaRecord{
+			GPSLat:    sql.NullFloat64{Float64: 40.5, Valid: true},
+			GPSLon:    sql.NullFloat64{Float64: -105.1, Valid: true},
+			CameraYaw: sql.NullFloat64{Float64: 90, Valid: true},
+		}},
+		{Name: "b.jpg"},
+	})
+	if err != nil {
+		t.Fatalf("GeoJSON: %v", err)
+	}
+	var fc struct {
+		Features []struct {
+			Geometry struct {
+				Coordinates []float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(body, &fc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(fc.Features) != 1 {
+		t.Fatalf("got %d features, want 1", len(fc.Features))
+	}
+	f := fc.Features[0]
+	if f.Geometry.Coordinates[0] != -105.1 || f.Geometry.Coordinates[1] != 40.5 || f.Properties["file"] != "a.jpg" || f.Properties["camera_yaw"] != 90.0 {
+		t.Fatalf("feature = %+v", f)
+	}
+}
@@ -0,0 +1,65 @@
+// Package provision brings a fresh Pi onto a network during first-boot
+// setup: it finds a wired connection, or runs a Wi-Fi access point for the
+// setup flow, and joins the Wi-Fi network chosen there. Networking is done
+// through NetworkManager, which current Raspberry Pi OS images use.
+package provision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"unicode/utf8"
+)
+
+var ErrUnsupported = errors.New("network provisioning needs Linux with NetworkManager")
+
+// hotspotConnection and wifiConnection name the NetworkManager profiles this
+// package creates, so a retry replaces them instead of piling up duplicates.
+const (
+	hotspotConnection = "usbvault-setup"
+	wifiConnection    = "usbvault-wifi"
+)
+
+// WiFi is a network to join once setup is complete. An empty passphrase
+// means an open network.
+type WiFi struct {
+	SSID       string `json:"wifi_ssid"`
+	Passphrase string `json:"wifi_passphrase"`
+}
+
+func (w WiFi) Validate() error {
+	if w.SSID == "" || len(w.SSID) > 32 {
+		return errors.New("wifi_ssid must be 1-32 bytes")
+	}
+	if w.Passphrase != "" {
+		if err := ValidatePassphrase(w.Passphrase); err != nil {
+			return fmt.Errorf("wifi_passphrase: %w", err)
+		}
+	}
+	return nil
+}
+
+// ValidatePassphrase checks a WPA2 passphrase: 8 to 63 characters.
+func ValidatePassphrase(p string) error {
+	if n := utf8.RuneCountInString(p); n < 8 || n > 63 {
+		return errors.New("must be 8-63 characters")
+	}
+	return nil
+}
+
+// runCommand runs nmcli and friends; tests replace it.
+var runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("%s %s: %w: %s", name, firstArg(args), err, out)
+	}
+	return out, nil
+}
+
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
@@ -0,0 +1,107 @@
+//go:build linux
+// +build linux
+
+package provision
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EthernetAddrs returns the IPv4 addresses of wired interfaces that have a
+// cable plugged in.
+func EthernetAddrs() ([]netip.Addr, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var out []netip.Addr
+	for _, iface := range ifaces {
+		if !strings.HasPrefix(iface.Name, "eth") && !strings.HasPrefix(iface.Name, "en") {
+			continue
+		}
+		carrier, err := os.ReadFile(filepath.Join("/sys/class/net", iface.Name, "carrier"))
+		if err != nil || strings.TrimSpace(string(carrier)) != "1" {
+			continue
+		}
+		out = append(out, ipv4Addrs(iface)...)
+	}
+	return out, nil
+}
+
+func ipv4Addrs(iface net.Interface) []netip.Addr {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var out []netip.Addr
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if addr, ok := netip.AddrFromSlice(ipNet.IP); ok && addr.Unmap().Is4() {
+			out = append(out, addr.Unmap())
+		}
+	}
+	return out
+}
+
+// StartHotspot brings up a WPA2 access point on ifname and returns the
+// address the vault is reachable on from it. NetworkManager serves DHCP on
+// the hotspot itself.
+func StartHotspot(ctx context.Context, ifname, ssid, passphrase string) (netip.Addr, error) {
+	_, _ = runCommand(ctx, "nmcli", "connection", "delete", hotspotConnection)
+	if _, err := runCommand(ctx, "nmcli", "device", "wifi", "hotspot",
+		"ifname", ifname, "con-name", hotspotConnection, "ssid", ssid, "password", passphrase); err != nil {
+		return netip.Addr{}, err
+	}
+	// The address is assigned shortly after the connection comes up.
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		if iface, err := net.InterfaceByName(ifname); err == nil {
+			if addrs := ipv4Addrs(*iface); len(addrs) > 0 {
+				return addrs[0], nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return netip.Addr{}, fmt.Errorf("hotspot on %s has no IPv4 address", ifname)
+		}
+		select {
+		case <-ctx.Done():
+			return netip.Addr{}, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// StopHotspot takes the access point down and removes its profile.
+func StopHotspot(ctx context.Context) error {
+	_, err := runCommand(ctx, "nmcli", "connection", "delete", hotspotConnection)
+	return err
+}
+
+// JoinWiFi saves w as an autoconnecting profile on ifname and connects to
+// it. The access point must be stopped first; the radio cannot do both.
+func JoinWiFi(ctx context.Context, ifname string, w WiFi) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	_, _ = runCommand(ctx, "nmcli", "connection", "delete", wifiConnection)
+	args := []string{"connection", "add", "type", "wifi", "con-name", wifiConnection,
+		"ifname", ifname, "ssid", w.SSID, "connection.autoconnect", "yes"}
+	if w.Passphrase != "" {
+		args = append(args, "wifi-sec.key-mgmt", "wpa-psk", "wifi-sec.psk", w.Passphrase)
+	}
+	if _, err := runCommand(ctx, "nmcli", args...); err != nil {
+		return err
+	}
+	_, err := runCommand(ctx, "nmcli", "connection", "up", wifiConnection)
+	return err
+}
@@ -0,0 +1,60 @@
+//go:build linux
+// +build linux
+
+package provision
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestJoinWiFiSavesAutoconnectProfile(t *testing.T) {
+	var calls []string
+	orig := runCommand
+	t.Cleanup(func() { runCommand = orig })
+	runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		return nil, nil
+	}
+
+	if err := JoinWiFi(context.Background(), "wlan0", WiFi{SSID: "Shop Floor", Passphrase: "hunter2hunter2"}); err != nil {
+		t.Fatalf("JoinWiFi: %v", err)
+	}
+	want := []string{
+		"nmcli connection delete usbvault-wifi",
+		"nmcli connection add type wifi con-name usbvault-wifi ifname wlan0 ssid Shop Floor connection.autoconnect yes wifi-sec.key-mgmt wpa-psk wifi-sec.psk hunter2hunter2",
+		"nmcli connection up usbvault-wifi",
+	}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("commands =\n%s", strings.Join(calls, "\n"))
+	}
+
+	calls = nil
+	if err := JoinWiFi(context.Background(), "wlan0", WiFi{SSID: "Guest"}); err != nil {
+		t.Fatalf("JoinWiFi(open): %v", err)
+	}
+	if strings.Contains(calls[1], "wifi-sec") {
+		t.Fatalf("open network got security settings: %s", calls[1])
+	}
+}
+
+func TestWiFiValidate(t *testing.T) {
+	cases := []struct {
+		w  WiFi
+		ok bool
+	}{
+		{WiFi{SSID: "Office", Passphrase: "12345678"}, true},
+		{WiFi{SSID: "Open"}, true},
+		{WiFi{}, false},
+		{WiFi{SSID: strings.Repeat("x", 33)}, false},
+		{WiFi{SSID: "Office", Passphrase: "short"}, false},
+		{WiFi{SSID: "Office", Passphrase: strings.Repeat("x", 64)}, false},
+	}
+	for _, tc := range cases {
+		if err := tc.w.Validate(); (err == nil) != tc.ok {
+			t.Errorf("Validate(%+v) = %v, want ok=%v", tc.w, err, tc.ok)
+		}
+	}
+}
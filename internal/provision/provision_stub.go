@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package provision
+
+import (
+	"context"
+	"net/netip"
+)
+
+func EthernetAddrs() ([]netip.Addr, error) {
+	return nil, nil
+}
+
+func StartHotspot(ctx context.Context, ifname, ssid, passphrase string) (netip.Addr, error) {
+	return netip.Addr{}, ErrUnsupported
+}
+
+func StopHotspot(ctx context.Context) error {
+	return ErrUnsupported
+}
+
+func JoinWiFi(ctx context.Context, ifname string, w WiFi) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,73 @@
+package publish
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"time"
+)
+
+// Item is one published file as listed in the gallery.
+type Item struct {
+	Name     string `json:"name"` // file name at the destination
+	Title    string `json:"title"`
+	Kind     string `json:"kind"` // "image" or "video"
+	Captured string `json:"captured,omitempty"`
+}
+
+// Index is album.json, for clients that build their own page.
+type Index struct {
+	Album       string `json:"album"`
+	PublishedAt string `json:"published_at"`
+	Items       []Item `json:"items"`
+}
+
+var galleryPage = template.Must(template.New("gallery").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Album}}</title>
+<style>
+body{margin:0;font-family:system-ui,sans-serif;background:#111;color:#eee}
+header{padding:1rem 1.5rem}
+h1{margin:0;font-size:1.4rem}
+p{margin:.25rem 0 0;color:#999;font-size:.85rem}
+main{display:grid;grid-template-columns:repeat(auto-fill,minmax(220px,1fr));gap:6px;padding:0 6px 6px}
+figure{margin:0;background:#000}
+figure a{display:block}
+img,video{display:block;width:100%;height:220px;object-fit:cover}
+figcaption{padding:.3rem .5rem;font-size:.75rem;color:#aaa;overflow:hidden;text-overflow:ellipsis;white-space:nowrap}
+</style>
+</head>
+<body>
+<header><h1>{{.Album}}</h1><p>{{len .Items}} files &middot; updated {{.PublishedAt}}</p></header>
+<main>
+{{- range .Items}}
+<figure>
+{{- if eq .Kind "video"}}<video src="{{.Name}}" controls preload="metadata"></video>
+{{- else}}<a href="{{.Name}}"><img src="{{.Name}}" alt="{{.Title}}" loading="lazy"></a>{{end}}
+<figcaption>{{.Title}}{{if .Captured}} &middot; {{.Captured}}{{end}}</figcaption>
+</figure>
+{{- end}}
+</main>
+</body>
+</html>
+`))
+
+// Gallery returns index.html and album.json for the published items.
+func Gallery(album string, items []Item, now time.Time) (page, index []byte, err error) {
+	idx := Index{Album: album, PublishedAt: now.UTC().Format(time.RFC3339), Items: items}
+	if idx.Items == nil {
+		idx.Items = []Item{}
+	}
+	var buf bytes.Buffer
+	if err := galleryPage.Execute(&buf, idx); err != nil {
+		return nil, nil, err
+	}
+	index, err = json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), index, nil
+}
@@ -0,0 +1,194 @@
+// Package publish delivers albums to places outside the vault: an S3 bucket
+// serving a static gallery, or a WebDAV folder. Delivery is one way; files
+// changed at the destination are overwritten on the next run.
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"businessplan/usbvault/internal/s3"
+)
+
+// Target is a folder published files are written to. Names are slash
+// paths relative to the folder.
+type Target interface {
+	Put(ctx context.Context, name, contentType string, body io.ReadSeeker) error
+	Delete(ctx context.Context, name string) error
+}
+
+// ParseS3 splits s3://bucket/prefix. The prefix may be empty, to publish
+// to the root of the bucket.
+func ParseS3(dest string) (bucket, prefix string, err error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(dest), "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("s3 destination %q must look like s3://bucket/folder", dest)
+	}
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("s3 destination %q must look like s3://bucket/folder", dest)
+	}
+	return bucket, strings.Trim(prefix, "/"), nil
+}
+
+type s3Target struct {
+	client         *s3.Client
+	bucket, prefix string
+}
+
+// NewS3 publishes to bucket below prefix.
+func NewS3(client *s3.Client, bucket, prefix string) Target {
+	return &s3Target{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}
+}
+
+func (t *s3Target) key(name string) string {
+	if t.prefix == "" {
+		return name
+	}
+	return t.prefix + "/" + name
+}
+
+func (t *s3Target) Put(ctx context.Context, name, contentType string, body io.ReadSeeker) error {
+	return t.client.UploadType(ctx, t.bucket, t.key(name), contentType, body)
+}
+
+func (t *s3Target) Delete(ctx context.Context, name string) error {
+	return t.client.Delete(ctx, t.bucket, t.key(name))
+}
+
+type webDAVTarget struct {
+	base     *url.URL
+	username string
+	secret   string
+	client   *http.Client
+}
+
+// ParseWebDAV checks that dest is an http or https folder URL.
+func ParseWebDAV(dest string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(dest))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webdav destination %q must be an http or https URL", dest)
+	}
+	if u.User != nil {
+		return nil, errors.New("put webdav credentials in username and secret, not the URL")
+	}
+	return u, nil
+}
+
+// NewWebDAV publishes below the folder at dest. With a username the secret
+// is sent as a password; without one it is sent as a bearer token.
+func NewWebDAV(dest, username, secret string, client *http.Client) (Target, error) {
+	u, err := ParseWebDAV(dest)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &webDAVTarget{base: u, username: username, secret: secret, client: client}, nil
+}
+
+func (t *webDAVTarget) url(name string) string {
+	u := *t.base
+	u.Path = path.Join(u.Path, name)
+	return u.String()
+}
+
+func (t *webDAVTarget) authorize(req *http.Request) {
+	switch {
+	case t.username != "":
+		req.SetBasicAuth(t.username, t.secret)
+	case t.secret != "":
+		req.Header.Set("Authorization", "Bearer "+t.secret)
+	}
+}
+
+func (t *webDAVTarget) do(ctx context.Context, method, name, contentType string, body io.Reader) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url(name), body)
+	if err != nil {
+		return 0, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	t.authorize(req)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Put sends the file. A 409 means a parent folder is missing, so the
+// folders are created and the file is sent again.
+func (t *webDAVTarget) Put(ctx context.Context, name, contentType string, body io.ReadSeeker) error {
+	status, err := t.do(ctx, http.MethodPut, name, contentType, body)
+	if err == nil && status == http.StatusConflict {
+		if err = t.mkdirs(ctx, name); err == nil {
+			if _, err = body.Seek(0, io.SeekStart); err == nil {
+				status, err = t.do(ctx, http.MethodPut, name, contentType, body)
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("webdav put %s: %w", name, err)
+	}
+	if status < 200 || status > 299 {
+		return fmt.Errorf("webdav put %s: %s", name, http.StatusText(status))
+	}
+	return nil
+}
+
+// mkdirs creates every folder from the server root down to the one
+// holding name. Folders that already exist answer 405 and are skipped, and
+// servers may refuse folders above the base, such as /remote.php/, so only
+// failures at or below the base count.
+func (t *webDAVTarget) mkdirs(ctx context.Context, name string) error {
+	full := path.Dir(path.Join(t.base.Path, name))
+	var dirs []string
+	for dir := full; dir != "/" && dir != "."; dir = path.Dir(dir) {
+		dirs = append(dirs, dir+"/")
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		u := *t.base
+		u.Path = dirs[i]
+		req, err := http.NewRequestWithContext(ctx, "MKCOL", u.String(), nil)
+		if err != nil {
+			return err
+		}
+		t.authorize(req)
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("webdav mkcol %s: %w", dirs[i], err)
+		}
+		_ = resp.Body.Close()
+		above := len(dirs[i]) < len(t.base.Path)
+		if (resp.StatusCode < 200 || resp.StatusCode > 299) && resp.StatusCode != http.StatusMethodNotAllowed && !above {
+			return fmt.Errorf("webdav mkcol %s: %s", dirs[i], http.StatusText(resp.StatusCode))
+		}
+	}
+	return nil
+}
+
+// Delete removes a file; one that is already gone is not an error.
+func (t *webDAVTarget) Delete(ctx context.Context, name string) error {
+	status, err := t.do(ctx, http.MethodDelete, name, "", nil)
+	if err != nil {
+		return fmt.Errorf("webdav delete %s: %w", name, err)
+	}
+	if (status < 200 || status > 299) && status != http.StatusNotFound {
+		return fmt.Errorf("webdav delete %s: %s", name, http.StatusText(status))
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package publish
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDAV keeps files and folders in memory. PUT into a missing folder
+// answers 409, as real servers do.
+type fakeDAV struct {
+	mu    sync.Mutex
+	dirs  map[string]bool
+	files map[string]string
+	types map[string]string
+}
+
+func (f *fakeDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, pass, ok := r.BasicAuth(); !ok || user != "client" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	p := r.URL.Path
+	switch r.Method {
+	case "MKCOL":
+		p = strings.TrimSuffix(p, "/")
+		if f.dirs[p] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !f.dirs[path.Dir(p)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.dirs[p] = true
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodPut:
+		if !f.dirs[path.Dir(p)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.files[p] = string(body)
+		f.types[p] = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if _, ok := f.files[p]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.files, p)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestWebDAVCreatesFoldersAndDeletes(t *testing.T) {
+	f := &fakeDAV{dirs: map[string]bool{"/": true}, files: map[string]string{}, types: map[string]string{}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	ctx := context.Background()
+
+	target, err := NewWebDAV(srv.URL+"/dav/clients/smith", "client", "secret", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Put(ctx, "IMG 0001.jpg", "image/jpeg", strings.NewReader("jpeg bytes")); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.files["/dav/clients/smith/IMG 0001.jpg"]; got != "jpeg bytes" {
+		t.Fatalf("published file = %q (files %v)", got, f.files)
+	}
+	if got := f.types["/dav/clients/smith/IMG 0001.jpg"]; got != "image/jpeg" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	if err := target.Put(ctx, "index.html", "text/html", strings.NewReader("<html>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Delete(ctx, "IMG 0001.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Delete(ctx, "IMG 0001.jpg"); err != nil {
+		t.Fatalf("deleting a missing file: %v", err)
+	}
+	if _, ok := f.files["/dav/clients/smith/IMG 0001.jpg"]; ok {
+		t.Fatal("file still present after Delete")
+	}
+
+	denied, _ := NewWebDAV(srv.URL+"/dav/clients/smith", "client", "wrong", srv.Client())
+	if err := denied.Put(ctx, "x.jpg", "image/jpeg", strings.NewReader("x")); err == nil {
+		t.Fatal("Put with a wrong password succeeded")
+	}
+}
+
+func TestParseDestinations(t *testing.T) {
+	t.Parallel()
+	if b, p, err := ParseS3("s3://site/galleries/smith/"); err != nil || b != "site" || p != "galleries/smith" {
+		t.Fatalf("ParseS3 = %q %q %v", b, p, err)
+	}
+	if b, p, err := ParseS3("s3://site"); err != nil || b != "site" || p != "" {
+		t.Fatalf("ParseS3 bucket root = %q %q %v", b, p, err)
+	}
+	for _, bad := range []string{"site/x", "s3:///x"} {
+		if _, _, err := ParseS3(bad); err == nil {
+			t.Errorf("ParseS3(%q) accepted", bad)
+		}
+	}
+	for _, bad := range []string{"ftp://host/x", "https://user:pw@host/x", "/local/path"} {
+		if _, err := ParseWebDAV(bad); err == nil {
+			t.Errorf("ParseWebDAV(%q) accepted", bad)
+		}
+	}
+}
+
+func TestGalleryEscapesNames(t *testing.T) {
+	t.Parallel()
+	page, index, err := Gallery(`Smith & "Jones"`, []Item{
+		{Name: "a b.jpg", Title: "<script>.jpg", Kind: "image"},
+		{Name: "clip.mp4", Title: "clip.mp4", Kind: "video"},
+	}, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(page)
+	for _, want := range []string{"Smith &amp; &#34;Jones&#34;", `src="a%20b.jpg"`, "&lt;script&gt;.jpg", `<video src="clip.mp4"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("page lacks %s", want)
+		}
+	}
+	if strings.Contains(html, "<script>") {
+		t.Error("page carries an unescaped title")
+	}
+	if !strings.Contains(string(index), `"published_at": "2026-03-01T12:00:00Z"`) {
+		t.Errorf("album.json = %s", index)
+	}
+}
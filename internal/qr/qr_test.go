@@ -0,0 +1,92 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" as 1-M, from the worked example in the specification.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := reedSolomon(data, 10); !bytes.Equal(got, want) {
+		t.Fatalf("reedSolomon = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	if got := formatBits(0); got != 0b101010000010010 {
+		t.Fatalf("formatBits(0) = %015b", got)
+	}
+	if got := formatBits(7); got != 0b100101010100000 {
+		t.Fatalf("formatBits(7) = %015b", got)
+	}
+	if got := versionBits(7); got != 0x07C94 {
+		t.Fatalf("versionBits(7) = %#x", got)
+	}
+}
+
+func TestEncodePicksSmallestVersion(t *testing.T) {
+	cases := []struct {
+		text string
+		size int
+	}{
+		{"http://vault/", 21},                // 13 bytes, version 1
+		{"http://192.168.100.200:4987/", 29}, // 28 bytes, version 3
+		{strings.Repeat("a", 213), 57},       // version 10 limit
+	}
+	for _, tc := range cases {
+		c, err := Encode(tc.text)
+		if err != nil {
+			t.Fatalf("Encode(%q): %v", tc.text, err)
+		}
+		if c.Size != tc.size {
+			t.Fatalf("Encode(%q) size = %d, want %d", tc.text, c.Size, tc.size)
+		}
+		// Finder patterns sit in three corners with a light separator.
+		for _, corner := range [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}} {
+			if !c.Dark(corner[0], corner[1]) || !c.Dark(corner[0]+3, corner[1]+3) || c.Dark(corner[0]+1, corner[1]+1) {
+				t.Fatalf("Encode(%q): no finder at %v", tc.text, corner)
+			}
+		}
+		if c.Dark(-1, 0) || c.Dark(c.Size, c.Size) {
+			t.Fatal("quiet zone is dark")
+		}
+	}
+	if _, err := Encode(strings.Repeat("a", 214)); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("Encode(214 bytes) err = %v, want ErrTooLong", err)
+	}
+}
+
+func TestSVGDrawsEveryDarkModule(t *testing.T) {
+	code, err := Encode("http://192.168.100.200:4987/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(code.SVG(256))
+	if !strings.HasPrefix(svg, `<svg `) || !strings.Contains(svg, `viewBox="0 0 37 37"`) {
+		t.Fatalf("unexpected svg header: %.120s", svg)
+	}
+	dark := 0
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Dark(x, y) {
+				dark++
+			}
+		}
+	}
+	drawn := 0
+	for _, run := range strings.Split(svg, "M")[1:] {
+		var x, y, w int
+		if _, err := fmt.Sscanf(run, "%d %dh%d", &x, &y, &w); err != nil {
+			t.Fatalf("bad path segment %q: %v", run, err)
+		}
+		drawn += w
+	}
+	if drawn != dark {
+		t.Fatalf("svg draws %d modules, code has %d dark", drawn, dark)
+	}
+}
@@ -0,0 +1,33 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// quietZone is the light border, in modules, readers need around a code.
+const quietZone = 4
+
+// SVG draws the code with its quiet zone, one unit per module, scaled to
+// px pixels wide. Runs of dark modules in a row become one rectangle.
+func (c *Code) SVG(px int) []byte {
+	n := c.Size + 2*quietZone
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`, n, n, px, px)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; {
+			if !c.Dark(x, y) {
+				x++
+				continue
+			}
+			start := x
+			for x < c.Size && c.Dark(x, y) {
+				x++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", start+quietZone, y+quietZone, x-start, x-start)
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.Bytes()
+}
@@ -0,0 +1,279 @@
+// Package relocate moves a library to a new base storage folder, such as a
+// larger drive. It copies the whole tree, work area included, checking each
+// copy against the SHA256 of its source, then points the database at the
+// copy in one transaction and only then changes the base storage setting.
+// The old tree is left where it was, to be removed by hand once the new one
+// has been checked.
+package relocate
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/disk"
+)
+
+// BaseStorageSetting is the setting holding the base storage folder.
+const BaseStorageSetting = "base_storage_dir"
+
+// Progress is how far a move has got.
+type Progress struct {
+	Phase       string `json:"phase"` // scan, copy, switch
+	TotalFiles  int    `json:"total_files"`
+	TotalBytes  int64  `json:"total_bytes"`
+	CopiedFiles int    `json:"copied_files"`
+	CopiedBytes int64  `json:"copied_bytes"`
+	// CaughtUp counts files that changed during the copy and were copied
+	// again, or for the first time, just before the switch.
+	CaughtUp int `json:"caught_up"`
+}
+
+// Result is what a finished move did.
+type Result struct {
+	Progress
+	From    string            `json:"from"`
+	To      string            `json:"to"`
+	Records db.RelocateResult `json:"records"`
+}
+
+// ErrVerify means a copy did not read back with the SHA256 of its source.
+var ErrVerify = errors.New("copy does not match its source")
+
+// Scratch work areas hold nothing worth moving.
+var skippedAreas = []string{config.WorkAreaBenchmark, config.WorkAreaExport}
+
+// Check reports why to cannot take the library now at from: it must be an
+// absolute path outside from (and from outside it), and empty or not there
+// yet.
+func Check(from, to string) error {
+	if to == "" || !filepath.IsAbs(to) {
+		return errors.New("the new folder must be an absolute path")
+	}
+	from, to = filepath.Clean(from), filepath.Clean(to)
+	if config.IsPathWithin(to, from) || config.IsPathWithin(from, to) {
+		return errors.New("the new folder must not be inside the library, or the library inside it")
+	}
+	entries, err := os.ReadDir(to)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return errors.New("the new folder is not empty")
+	}
+	return nil
+}
+
+// Move copies the library at from to to and points store at the copy.
+// progress, when set, is called as the move advances. Nothing in the
+// database changes unless every file was copied and verified; a failed or
+// stopped move leaves what it copied in to.
+func Move(ctx context.Context, store *db.Store, from, to string, progress func(Progress)) (Result, error) {
+	from, to = filepath.Clean(from), filepath.Clean(to)
+	res := Result{From: from, To: to}
+	report := func() {
+		if progress != nil {
+			progress(res.Progress)
+		}
+	}
+	if err := Check(from, to); err != nil {
+		return res, err
+	}
+	if info, err := os.Stat(from); err != nil || !info.IsDir() {
+		return res, fmt.Errorf("library folder %s is not available", from)
+	}
+
+	res.Phase = "scan"
+	report()
+	var files []string
+	err := walk(ctx, from, func(path string, info fs.FileInfo) error {
+		files = append(files, path)
+		res.TotalFiles++
+		res.TotalBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+	if err := os.MkdirAll(to, 0o750); err != nil {
+		return res, err
+	}
+	if usage, err := disk.Stat(to); err == nil && uint64(res.TotalBytes) > usage.FreeBytes {
+		return res, fmt.Errorf("the new folder has %d bytes free and the library needs %d", usage.FreeBytes, res.TotalBytes)
+	}
+
+	res.Phase = "copy"
+	report()
+	for _, src := range files {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		n, err := copyVerified(src, target(from, to, src))
+		if errors.Is(err, os.ErrNotExist) {
+			continue // removed since the scan
+		}
+		if err != nil {
+			return res, err
+		}
+		res.CopiedFiles++
+		res.CopiedBytes += n
+		report()
+	}
+
+	res.Phase = "switch"
+	report()
+	res.Records, err = store.RelocateLibrary(ctx, from, to, BaseStorageSetting, func(paths []string) error {
+		return catchUp(ctx, from, to, paths, &res.Progress)
+	})
+	return res, err
+}
+
+// catchUp copies the recorded files and trash folders that are missing
+// from to, or differ in size, as left by changes made during the copy.
+func catchUp(ctx context.Context, from, to string, paths []string, p *Progress) error {
+	for _, src := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := os.Stat(src)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // missing before the move too
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			err = catchUpFile(src, target(from, to, src), info, p)
+		} else {
+			err = walk(ctx, src, func(path string, fi fs.FileInfo) error {
+				return catchUpFile(path, target(from, to, path), fi, p)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func catchUpFile(src, dst string, info fs.FileInfo, p *Progress) error {
+	if got, err := os.Stat(dst); err == nil && got.Size() == info.Size() {
+		return nil
+	}
+	n, err := copyVerified(src, dst)
+	if err != nil {
+		return err
+	}
+	p.CaughtUp++
+	p.CopiedBytes += n
+	return nil
+}
+
+func target(from, to, path string) string {
+	return to + path[len(from):]
+}
+
+// walk calls fn for each regular file under root, leaving out the scratch
+// work areas and the partial copies of an ingest.
+func walk(ctx context.Context, root string, fn func(path string, info fs.FileInfo) error) error {
+	var skip []string
+	for _, area := range skippedAreas {
+		skip = append(skip, filepath.Join(root, config.WorkDirName, area))
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			for _, s := range skip {
+				if path == s {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(path, ".part") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(path, info)
+	})
+}
+
+// copyVerified copies src to dst through a temporary file, hashing what it
+// reads, then reads the copy back and only renames it into place when it
+// has the same SHA256. The copy keeps the source's permissions and
+// modification time.
+func copyVerified(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".relocate-*")
+	if err != nil {
+		return 0, err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	srcSum := sha256.New()
+	n, err := io.Copy(tmp, io.TeeReader(in, srcSum))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("copy %s: %w", src, err)
+	}
+
+	back, err := os.Open(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	dstSum := sha256.New()
+	_, err = io.Copy(dstSum, back)
+	back.Close()
+	if err != nil {
+		return 0, fmt.Errorf("read back %s: %w", dst, err)
+	}
+	if string(srcSum.Sum(nil)) != string(dstSum.Sum(nil)) {
+		return 0, fmt.Errorf("%s: %w", src, ErrVerify)
+	}
+	if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		return 0, err
+	}
+	if err := os.Chtimes(tmpPath, info.ModTime(), info.ModTime()); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,130 @@
+package relocate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+)
+
+func TestMove(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := db.Open(filepath.Join(root, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	from := filepath.Join(root, "old")
+	to := filepath.Join(root, "new")
+	if err := store.SetSetting(ctx, BaseStorageSetting, from); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o440); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert := func(n int, rel string) db.MediaRecord {
+		t.Helper()
+		path := filepath.Join(from, rel)
+		content := fmt.Sprintf("media %d", n)
+		write(path, content)
+		sum := sha256.Sum256([]byte(content))
+		rec := db.MediaRecord{
+			Kind: "image", FileName: filepath.Base(rel), Extension: ".jpg",
+			SourceMount: "/Volumes/Test", SourcePath: fmt.Sprintf("/DCIM/%d.jpg", n), DestPath: path,
+			SizeBytes: int64(len(content)), SHA256: hex.EncodeToString(sum[:]),
+			CaptureTime: "2026-03-01T10:00:00Z", IngestedAt: time.Now().UTC().Format(time.RFC3339),
+		}
+		if err := store.InsertMedia(ctx, &rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		return rec
+	}
+
+	kept := insert(1, "2026/03/01/kept.jpg")
+	xmp := filepath.Join(from, "2026/03/01/kept.xmp")
+	write(xmp, "<x/>")
+	if err := store.AddMediaSidecars(ctx, kept.ID, []db.Sidecar{{Kind: "xmp", FileName: "kept.xmp", SourcePath: "/DCIM/1.xmp", DestPath: xmp, SizeBytes: 4, SHA256: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	trashed := insert(2, "2026/03/01/trashed.jpg")
+	trashDir := filepath.Join(config.WorkAreaDir(from, config.WorkAreaTrash), fmt.Sprint(trashed.ID))
+	write(filepath.Join(trashDir, "trashed.jpg"), "media 2")
+	if err := os.Remove(trashed.DestPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.TrashMedia(ctx, trashed, nil, trashDir, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	write(filepath.Join(config.WorkAreaDir(from, config.WorkAreaBenchmark), "scratch"), "scratch")
+
+	if err := Check(from, filepath.Join(from, "inside")); err == nil {
+		t.Fatal("Check allowed a folder inside the library")
+	}
+
+	// A file ingested while the tree is copied is caught up at the switch.
+	var late db.MediaRecord
+	res, err := Move(ctx, store, from, to, func(p Progress) {
+		if p.Phase == "switch" && late.ID == 0 {
+			late = insert(3, "2026/03/02/late.jpg")
+		}
+	})
+	if err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if res.CopiedFiles != 3 || res.CaughtUp != 1 || res.Records.Media != 2 || res.Records.Sidecars != 1 || res.Records.Trash != 1 {
+		t.Fatalf("result = %+v", res)
+	}
+
+	if base, _, _ := store.GetSetting(ctx, BaseStorageSetting); base != to {
+		t.Fatalf("base storage = %q, want %q", base, to)
+	}
+	for _, id := range []int64{kept.ID, late.ID} {
+		rec, err := store.GetMediaByID(ctx, id)
+		if err != nil || rec == nil {
+			t.Fatalf("GetMediaByID(%d): %v", id, err)
+		}
+		if !config.IsPathWithin(rec.DestPath, to) {
+			t.Fatalf("dest_path %s not under %s", rec.DestPath, to)
+		}
+		if _, err := os.Stat(rec.DestPath); err != nil {
+			t.Fatalf("copy of %d: %v", id, err)
+		}
+	}
+	sidecars, err := store.ListMediaSidecars(ctx, kept.ID)
+	if err != nil || len(sidecars) != 1 || sidecars[0].DestPath != filepath.Join(to, "2026/03/01/kept.xmp") {
+		t.Fatalf("sidecars = %+v, %v", sidecars, err)
+	}
+	item, err := store.GetTrash(ctx, trashed.ID)
+	if err != nil || !config.IsPathWithin(item.TrashDir, to) || !config.IsPathWithin(item.Record.DestPath, to) {
+		t.Fatalf("trash = %+v, %v", item, err)
+	}
+	if _, err := os.Stat(filepath.Join(item.TrashDir, "trashed.jpg")); err != nil {
+		t.Fatalf("trashed file not copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.WorkAreaDir(to, config.WorkAreaBenchmark), "scratch")); !os.IsNotExist(err) {
+		t.Fatalf("benchmark scratch copied: %v", err)
+	}
+	if _, err := os.Stat(kept.DestPath); err != nil {
+		t.Fatalf("old copy removed: %v", err)
+	}
+
+	// The old folder still holds its copy, so nothing moves back into it.
+	if _, err := Move(ctx, store, to, from, nil); err == nil {
+		t.Fatal("Move into a non-empty folder succeeded")
+	}
+}
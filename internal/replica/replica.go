@@ -0,0 +1,472 @@
+// Package replica keeps this vault as an append-only standby of another one.
+// It pulls the source's JSON Lines export from its last cursor, fetches
+// media it does not already hold by content hash, and maps source ids to
+// local ones so album membership and tags can follow. Deletes on the source
+// are never applied.
+package replica
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/libcrypt"
+)
+
+const (
+	cursorSetting      = "replica_cursor"
+	baseStorageSetting = "base_storage_dir"
+	tagSource          = "replica"
+)
+
+var ErrBusy = errors.New("replication already running")
+
+type Status struct {
+	Enabled        bool   `json:"enabled"`
+	Source         string `json:"source"`
+	State          string `json:"state"` // idle, running, success, error
+	Cursor         int64  `json:"cursor"`
+	LastStarted    string `json:"last_started"`
+	LastFinished   string `json:"last_finished"`
+	Message        string `json:"message"`
+	MediaCopied    int    `json:"media_copied"`
+	MediaExisting  int    `json:"media_existing"`
+	DeletesSkipped int    `json:"deletes_skipped"`
+}
+
+type Replicator struct {
+	store    *db.Store
+	audit    *audit.Logger
+	logger   *log.Logger
+	source   string
+	username string
+	password string
+	client   *http.Client
+	libKey   *libcrypt.Key
+
+	runMu  sync.Mutex
+	mu     sync.Mutex
+	status Status
+}
+
+func New(store *db.Store, auditLogger *audit.Logger, logger *log.Logger, source, username, password string) *Replicator {
+	jar, _ := cookiejar.New(nil)
+	return &Replicator{
+		store:    store,
+		audit:    auditLogger,
+		logger:   logger,
+		source:   strings.TrimRight(source, "/"),
+		username: username,
+		password: password,
+		client:   &http.Client{Jar: jar, Timeout: 0},
+		status:   Status{Enabled: true, Source: source, State: "idle", Message: "Waiting for first run."},
+	}
+}
+
+// SetLibraryKey encrypts replicated media like locally ingested files.
+func (r *Replicator) SetLibraryKey(key *libcrypt.Key) {
+	r.libKey = key
+}
+
+func (r *Replicator) GetStatus() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Start runs a pass immediately and then every interval until ctx ends.
+func (r *Replicator) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := r.RunOnce(ctx); err != nil && !errors.Is(err, ErrBusy) {
+				r.logger.Printf("replication failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+type passStats struct {
+	copied, existing, deletes, rows int
+}
+
+// RunOnce pulls everything changed on the source since the stored cursor.
+// The cursor only advances after the whole delta has been applied, so a
+// failed pass is retried from the same point; applying a row twice is a
+// no-op.
+func (r *Replicator) RunOnce(ctx context.Context) error {
+	if !r.runMu.TryLock() {
+		return ErrBusy
+	}
+	defer r.runMu.Unlock()
+
+	r.mu.Lock()
+	r.status.State = "running"
+	r.status.LastStarted = time.Now().UTC().Format(time.RFC3339)
+	r.status.Message = "Pulling changes..."
+	r.mu.Unlock()
+
+	stats, cursor, err := r.pull(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.LastFinished = time.Now().UTC().Format(time.RFC3339)
+	r.status.MediaCopied += stats.copied
+	r.status.MediaExisting += stats.existing
+	r.status.DeletesSkipped += stats.deletes
+	if err != nil {
+		r.status.State = "error"
+		r.status.Message = err.Error()
+		return err
+	}
+	r.status.State = "success"
+	r.status.Cursor = cursor
+	r.status.Message = fmt.Sprintf("Applied %d rows; copied %d new media.", stats.rows, stats.copied)
+	if stats.rows > 0 {
+		_ = r.audit.Log(context.WithoutCancel(ctx), "system", "replication_applied", map[string]any{
+			"source":          r.source,
+			"cursor":          cursor,
+			"rows":            stats.rows,
+			"media_copied":    stats.copied,
+			"media_existing":  stats.existing,
+			"deletes_skipped": stats.deletes,
+		})
+	}
+	return nil
+}
+
+func (r *Replicator) pull(ctx context.Context) (passStats, int64, error) {
+	var stats passStats
+	baseStorage, ok, err := r.store.GetSetting(ctx, baseStorageSetting)
+	if err != nil {
+		return stats, 0, err
+	}
+	if !ok || strings.TrimSpace(baseStorage) == "" {
+		return stats, 0, errors.New("base storage is not configured")
+	}
+	since := int64(0)
+	if raw, ok, err := r.store.GetSetting(ctx, cursorSetting); err != nil {
+		return stats, 0, err
+	} else if ok {
+		since, _ = strconv.ParseInt(raw, 10, 64)
+	}
+
+	if err := r.login(ctx); err != nil {
+		return stats, 0, err
+	}
+
+	q := url.Values{}
+	q.Set("since", strconv.FormatInt(since, 10))
+	q.Set("types", strings.Join([]string{db.ExportMedia, db.ExportAlbum, db.ExportAlbumItem, db.ExportSmartAlbum, db.ExportMediaTag}, ","))
+	resp, err := r.get(ctx, "/api/export/db?"+q.Encode())
+	if err != nil {
+		return stats, 0, err
+	}
+	defer resp.Body.Close()
+
+	// Buffer the delta so downloads do not hold the export stream open.
+	rows := make([]db.ExportRow, 0)
+	cursor := int64(-1)
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for sc.Scan() {
+		var line struct {
+			db.ExportRow
+			Cursor int64  `json:"cursor"`
+			Error  string `json:"error"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			return stats, 0, fmt.Errorf("decode export line: %w", err)
+		}
+		switch line.Type {
+		case "cursor":
+			cursor = line.Cursor
+		case "error":
+			return stats, 0, fmt.Errorf("source export failed: %s", line.Error)
+		default:
+			rows = append(rows, line.ExportRow)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return stats, 0, fmt.Errorf("read export: %w", err)
+	}
+	if cursor < 0 {
+		return stats, 0, errors.New("source export ended without a cursor")
+	}
+
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return stats, 0, err
+		}
+		if row.Op == "delete" {
+			stats.deletes++
+			continue
+		}
+		stats.rows++
+		if err := r.apply(ctx, baseStorage, row, &stats); err != nil {
+			return stats, 0, fmt.Errorf("%s %v: %w", row.Type, row.Key, err)
+		}
+	}
+
+	if err := r.store.SetSetting(ctx, cursorSetting, strconv.FormatInt(cursor, 10)); err != nil {
+		return stats, 0, err
+	}
+	return stats, cursor, nil
+}
+
+func (r *Replicator) apply(ctx context.Context, baseStorage string, row db.ExportRow, stats *passStats) error {
+	switch row.Type {
+	case db.ExportMedia:
+		return r.applyMedia(ctx, baseStorage, row.Row, stats)
+	case db.ExportAlbum:
+		name := str(row.Row["name"])
+		if name == "" {
+			return nil
+		}
+		album, err := r.store.EnsureAlbum(ctx, name)
+		if err != nil {
+			return err
+		}
+		return r.store.SetReplicaLocalID(ctx, db.ExportAlbum, num(row.Row["id"]), album.ID)
+	case db.ExportAlbumItem:
+		albumID, err := r.store.ReplicaLocalID(ctx, db.ExportAlbum, num(row.Row["album_id"]))
+		if err != nil {
+			return err
+		}
+		mediaID, err := r.store.ReplicaLocalID(ctx, db.ExportMedia, num(row.Row["media_id"]))
+		if err != nil {
+			return err
+		}
+		if albumID == 0 || mediaID == 0 {
+			return nil
+		}
+		_, _, err = r.store.AddMediaToAlbum(ctx, albumID, []int64{mediaID})
+		return err
+	case db.ExportSmartAlbum:
+		albumID, err := r.store.ReplicaLocalID(ctx, db.ExportAlbum, num(row.Row["album_id"]))
+		if err != nil || albumID == 0 {
+			return err
+		}
+		var rules db.SmartRules
+		if err := json.Unmarshal([]byte(str(row.Row["rules_json"])), &rules); err != nil {
+			return err
+		}
+		_, err = r.store.SetSmartAlbumRules(ctx, albumID, rules)
+		return err
+	case db.ExportMediaTag:
+		mediaID, err := r.store.ReplicaLocalID(ctx, db.ExportMedia, num(row.Row["media_id"]))
+		if err != nil || mediaID == 0 {
+			return err
+		}
+		_, err = r.store.AddMediaTags(ctx, mediaID, []string{str(row.Row["tag"])}, tagSource)
+		return err
+	}
+	return nil
+}
+
+func (r *Replicator) applyMedia(ctx context.Context, baseStorage string, row map[string]any, stats *passStats) error {
+	remoteID := num(row["id"])
+	sum := strings.ToLower(str(row["sha256"]))
+	if len(sum) != 64 {
+		return errors.New("row has no sha256")
+	}
+	if localID, err := r.store.FindMediaBySHA256(ctx, sum); err != nil {
+		return err
+	} else if localID > 0 {
+		stats.existing++
+		if err := r.applyRating(ctx, localID, row); err != nil {
+			return err
+		}
+		return r.store.SetReplicaLocalID(ctx, db.ExportMedia, remoteID, localID)
+	}
+
+	rec := &db.MediaRecord{
+		Kind:        str(row["kind"]),
+		FileName:    str(row["file_name"]),
+		Extension:   str(row["extension"]),
+		SourceMount: "replica:" + r.source,
+		SourcePath:  str(row["dest_path"]),
+		SizeBytes:   num(row["size_bytes"]),
+		CRC32:       str(row["crc32"]),
+		SHA256:      sum,
+		CaptureTime: str(row["capture_time"]),
+		GPSLat:      nullFloat(row["gps_lat"]),
+		GPSLon:      nullFloat(row["gps_lon"]),
+		Make:        nullString(row["make"]),
+		Model:       nullString(row["model"]),
+		CameraYaw:   nullFloat(row["camera_yaw"]),
+		CameraPitch: nullFloat(row["camera_pitch"]),
+		CameraRoll:  nullFloat(row["camera_roll"]),
+		LocProvider: nullString(row["loc_provider"]),
+		Country:     nullString(row["loc_country"]),
+		State:       nullString(row["loc_state"]),
+		County:      nullString(row["loc_county"]),
+		City:        nullString(row["loc_city"]),
+		Road:        nullString(row["loc_road"]),
+		HouseNumber: nullString(row["loc_house_number"]),
+		Postcode:    nullString(row["loc_postcode"]),
+		DisplayName: nullString(row["loc_display_name"]),
+		Metadata:    str(row["metadata_json"]),
+		SourceMTime: str(row["source_mtime"]),
+		IngestedAt:  time.Now().UTC().Format(time.RFC3339),
+
+		SourceCard:    str(row["source_card"]),
+		SourceRelPath: str(row["source_rel_path"]),
+	}
+	if rec.Metadata == "" {
+		rec.Metadata = "{}"
+	}
+	rec.DestPath = destinationPath(baseStorage, rec)
+	if err := r.download(ctx, rec); err != nil {
+		return err
+	}
+	if err := r.store.InsertMedia(ctx, rec); err != nil {
+		_ = os.Remove(rec.DestPath)
+		return err
+	}
+	stats.copied++
+	if err := r.applyRating(ctx, rec.ID, row); err != nil {
+		return err
+	}
+	return r.store.SetReplicaLocalID(ctx, db.ExportMedia, remoteID, rec.ID)
+}
+
+// applyRating copies the source's star rating and favorite flag, which
+// change after ingest and so arrive again as updates to a known file.
+// Sources from before ratings send neither.
+func (r *Replicator) applyRating(ctx context.Context, localID int64, row map[string]any) error {
+	if _, ok := row["rating"]; !ok {
+		return nil
+	}
+	rating := int(min(max(num(row["rating"]), 0), db.MaxRating))
+	favorite := num(row["favorite"]) != 0
+	_, err := r.store.SetMediaRating(ctx, localID, &rating, &favorite)
+	return err
+}
+
+// download fetches the original bytes by hash and verifies them before the
+// file becomes visible. With a library key the bytes are encrypted as they
+// are written, so no plaintext copy touches the disk.
+func (r *Replicator) download(ctx context.Context, rec *db.MediaRecord) error {
+	resp, err := r.get(ctx, "/api/media/by-hash/"+rec.SHA256+"/download")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(rec.DestPath), 0o750); err != nil {
+		return err
+	}
+	tmp := rec.DestPath + ".part"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	body := io.TeeReader(io.LimitReader(resp.Body, rec.SizeBytes+1), hasher)
+	if r.libKey != nil {
+		err = r.libKey.Encrypt(out, body, rec.SizeBytes)
+		if err == nil {
+			// Drain anything beyond the expected size so the hash check catches it.
+			_, err = io.Copy(io.Discard, body)
+		}
+	} else {
+		_, err = io.Copy(out, body)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && hex.EncodeToString(hasher.Sum(nil)) != rec.SHA256 {
+		err = errors.New("downloaded content does not match sha256")
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, rec.DestPath); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	_ = os.Chmod(rec.DestPath, 0o440)
+	return nil
+}
+
+func destinationPath(baseStorage string, rec *db.MediaRecord) string {
+	year, month := "unknown", "00"
+	if t, err := time.Parse(time.RFC3339, rec.CaptureTime); err == nil {
+		year, month = t.Format("2006"), t.Format("01")
+	}
+	name := strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+			return c
+		}
+		return '_'
+	}, rec.FileName)
+	if name == "" {
+		name = "media" + rec.Extension
+	}
+	return filepath.Join(baseStorage, "replica", year, month, rec.SHA256[:12]+"_"+name)
+}
+
+func (r *Replicator) login(ctx context.Context) error {
+	body, _ := json.Marshal(map[string]string{"username": r.username, "password": r.password})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.source+"/api/login", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("login to source: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("login to source: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (r *Replicator) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.source+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: status %d: %s", strings.SplitN(path, "?", 2)[0], resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
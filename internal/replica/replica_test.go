@@ -0,0 +1,203 @@
+package replica
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/audit"
+	"businessplan/usbvault/internal/db"
+)
+
+func openStore(t *testing.T, name string) *db.Store {
+	t.Helper()
+	store, err := db.Open(filepath.Join(t.TempDir(), name))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+// fakeSource serves the subset of the vault API the replicator uses.
+func fakeSource(t *testing.T, store *db.Store, content map[string][]byte) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "uv_session", Value: "ok", Path: "/"})
+	})
+	authed := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if c, err := r.Cookie("uv_session"); err != nil || c.Value != "ok" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("GET /api/export/db", authed(func(w http.ResponseWriter, r *http.Request) {
+		since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		enc := json.NewEncoder(w)
+		cursor, err := store.ExportChanges(r.Context(), since, strings.Split(r.URL.Query().Get("types"), ","), func(row db.ExportRow) error {
+			return enc.Encode(row)
+		})
+		if err != nil {
+			t.Errorf("ExportChanges: %v", err)
+			return
+		}
+		_ = enc.Encode(map[string]any{"type": "cursor", "cursor": cursor})
+	}))
+	mux.HandleFunc("GET /api/media/by-hash/{sha256}/download", authed(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := content[r.PathValue("sha256")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func addSourceMedia(t *testing.T, store *db.Store, content map[string][]byte, name string, body []byte) int64 {
+	t.Helper()
+	sum := sha256.Sum256(body)
+	rec := &db.MediaRecord{
+		Kind:        "image",
+		FileName:    name,
+		Extension:   ".jpg",
+		SourceMount: "/Volumes/Test",
+		SourcePath:  "/DCIM/" + name,
+		DestPath:    "/srv/vault/" + name,
+		SizeBytes:   int64(len(body)),
+		CRC32:       "00000000",
+		SHA256:      hex.EncodeToString(sum[:]),
+		CaptureTime: "2026-03-04T05:06:07Z",
+		Metadata:    "{}",
+		SourceMTime: "2026-03-04T05:06:07Z",
+		IngestedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := store.InsertMedia(context.Background(), rec); err != nil {
+		t.Fatalf("InsertMedia: %v", err)
+	}
+	content[rec.SHA256] = body
+	return rec.ID
+}
+
+func TestRunOnceCopiesMediaAndSkipsDeletes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	source := openStore(t, "source.db")
+	content := map[string][]byte{}
+	first := addSourceMedia(t, source, content, "IMG_0001.JPG", []byte("first image bytes"))
+	second := addSourceMedia(t, source, content, "IMG_0002.JPG", []byte("second image bytes"))
+	album, err := source.CreateAlbum(ctx, "Trip")
+	if err != nil {
+		t.Fatalf("CreateAlbum: %v", err)
+	}
+	if _, _, err := source.AddMediaToAlbum(ctx, album.ID, []int64{first, second}); err != nil {
+		t.Fatalf("AddMediaToAlbum: %v", err)
+	}
+	if _, err := source.AddMediaTags(ctx, first, []string{"beach"}, "rule"); err != nil {
+		t.Fatalf("AddMediaTags: %v", err)
+	}
+	srv := fakeSource(t, source, content)
+
+	target := openStore(t, "target.db")
+	baseStorage := t.TempDir()
+	if err := target.SetSetting(ctx, baseStorageSetting, baseStorage); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	r := New(target, audit.New(target), log.New(io.Discard, "", 0), srv.URL, "admin", "secret")
+
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	st := r.GetStatus()
+	if st.State != "success" || st.MediaCopied != 2 {
+		t.Fatalf("status = %+v, want success with 2 copied", st)
+	}
+
+	for sum, body := range content {
+		id, err := target.FindMediaBySHA256(ctx, sum)
+		if err != nil || id == 0 {
+			t.Fatalf("FindMediaBySHA256(%s) = %d, %v", sum, id, err)
+		}
+		rec, err := target.GetMediaByID(ctx, id)
+		if err != nil {
+			t.Fatalf("GetMediaByID: %v", err)
+		}
+		if !strings.HasPrefix(rec.DestPath, baseStorage) {
+			t.Fatalf("DestPath %q is outside base storage", rec.DestPath)
+		}
+		got, err := os.ReadFile(rec.DestPath)
+		if err != nil || string(got) != string(body) {
+			t.Fatalf("replicated file = %q, %v; want %q", got, err, body)
+		}
+	}
+	firstLocal, _ := target.ReplicaLocalID(ctx, db.ExportMedia, first)
+	tags, err := target.ListMediaTags(ctx, firstLocal)
+	if err != nil || len(tags) != 1 || tags[0] != "beach" {
+		t.Fatalf("tags = %v, %v; want [beach]", tags, err)
+	}
+	albums, err := target.ListAlbums(ctx, 10)
+	if err != nil || len(albums) != 1 || albums[0].Name != "Trip" {
+		t.Fatalf("albums = %+v, %v; want Trip", albums, err)
+	}
+
+	// Deletes on the source never reach the standby.
+	if err := source.DeleteMediaByID(ctx, second); err != nil {
+		t.Fatalf("DeleteMediaByID: %v", err)
+	}
+	if err := r.RunOnce(ctx); err != nil {
+		t.Fatalf("second RunOnce: %v", err)
+	}
+	st = r.GetStatus()
+	if st.MediaCopied != 2 || st.DeletesSkipped == 0 {
+		t.Fatalf("status after delete = %+v, want no new copies and skipped deletes", st)
+	}
+	for sum := range content {
+		if id, _ := target.FindMediaBySHA256(ctx, sum); id == 0 {
+			t.Fatalf("media %s was removed from the standby", sum)
+		}
+	}
+}
+
+func TestRunOnceRejectsMismatchedContent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	source := openStore(t, "source.db")
+	content := map[string][]byte{}
+	addSourceMedia(t, source, content, "IMG_0001.JPG", []byte("original bytes"))
+	for sum := range content {
+		content[sum] = []byte("tampered bytes")
+	}
+	srv := fakeSource(t, source, content)
+
+	target := openStore(t, "target.db")
+	if err := target.SetSetting(ctx, baseStorageSetting, t.TempDir()); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	r := New(target, audit.New(target), log.New(io.Discard, "", 0), srv.URL, "admin", "secret")
+
+	if err := r.RunOnce(ctx); err == nil {
+		t.Fatal("RunOnce accepted content that does not match its hash")
+	}
+	if raw, ok, _ := target.GetSetting(ctx, cursorSetting); ok && raw != "0" {
+		t.Fatalf("cursor advanced to %s after a failed pass", raw)
+	}
+}
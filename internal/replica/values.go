@@ -0,0 +1,41 @@
+package replica
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Export rows arrive as generic JSON values; these helpers coerce them back
+// into column types.
+
+func str(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	}
+	return fmt.Sprint(v)
+}
+
+func num(v any) int64 {
+	switch t := v.(type) {
+	case float64:
+		return int64(t)
+	case int64:
+		return t
+	}
+	return 0
+}
+
+func nullString(v any) sql.NullString {
+	if v == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: str(v), Valid: true}
+}
+
+func nullFloat(v any) sql.NullFloat64 {
+	f, ok := v.(float64)
+	return sql.NullFloat64{Float64: f, Valid: ok}
+}
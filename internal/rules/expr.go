@@ -0,0 +1,463 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The expression language is intentionally small:
+//
+//	literals     'text' "text" 12 3.5 true false null
+//	identifiers  model, kind, duration, city, ...
+//	comparison   == != < <= > >=
+//	logic        && || !   (also: and, or, not)
+//	functions    contains(a, b) startsWith(a, b) endsWith(a, b) lower(a) upper(a)
+//
+// String comparisons with == and != are case-insensitive. Comparing against
+// a missing value yields false for every operator except !=.
+
+type node interface {
+	eval(env map[string]any) any
+}
+
+type literal struct{ v any }
+
+type ident struct{ name string }
+
+type unary struct {
+	op string
+	x  node
+}
+
+type binary struct {
+	op   string
+	l, r node
+}
+
+type call struct {
+	fn   string
+	args []node
+}
+
+func (n literal) eval(map[string]any) any { return n.v }
+
+func (n ident) eval(env map[string]any) any {
+	v, ok := env[n.name]
+	if !ok {
+		return nil
+	}
+	return normalizeValue(v)
+}
+
+func (n unary) eval(env map[string]any) any {
+	return !truthy(n.x.eval(env))
+}
+
+func (n binary) eval(env map[string]any) any {
+	switch n.op {
+	case "&&":
+		return truthy(n.l.eval(env)) && truthy(n.r.eval(env))
+	case "||":
+		return truthy(n.l.eval(env)) || truthy(n.r.eval(env))
+	}
+	return compare(n.op, n.l.eval(env), n.r.eval(env))
+}
+
+func (n call) eval(env map[string]any) any {
+	args := make([]any, len(n.args))
+	for i, a := range n.args {
+		args[i] = a.eval(env)
+	}
+	switch n.fn {
+	case "contains":
+		return strings.Contains(strings.ToLower(toString(args[0])), strings.ToLower(toString(args[1])))
+	case "startsWith":
+		return strings.HasPrefix(strings.ToLower(toString(args[0])), strings.ToLower(toString(args[1])))
+	case "endsWith":
+		return strings.HasSuffix(strings.ToLower(toString(args[0])), strings.ToLower(toString(args[1])))
+	case "lower":
+		return strings.ToLower(toString(args[0]))
+	case "upper":
+		return strings.ToUpper(toString(args[0]))
+	}
+	return nil
+}
+
+var functionArity = map[string]int{
+	"contains":   2,
+	"startsWith": 2,
+	"endsWith":   2,
+	"lower":      1,
+	"upper":      1,
+}
+
+func compare(op string, l, r any) bool {
+	if l == nil || r == nil {
+		switch op {
+		case "==":
+			return l == nil && r == nil
+		case "!=":
+			return (l == nil) != (r == nil)
+		}
+		return false
+	}
+
+	if lf, lok := l.(float64); lok {
+		if rf, rok := r.(float64); rok {
+			switch op {
+			case "==":
+				return lf == rf
+			case "!=":
+				return lf != rf
+			case "<":
+				return lf < rf
+			case "<=":
+				return lf <= rf
+			case ">":
+				return lf > rf
+			case ">=":
+				return lf >= rf
+			}
+			return false
+		}
+	}
+	if lb, lok := l.(bool); lok {
+		if rb, rok := r.(bool); rok {
+			switch op {
+			case "==":
+				return lb == rb
+			case "!=":
+				return lb != rb
+			}
+			return false
+		}
+	}
+
+	ls := strings.ToLower(toString(l))
+	rs := strings.ToLower(toString(r))
+	switch op {
+	case "==":
+		return ls == rs
+	case "!=":
+		return ls != rs
+	case "<":
+		return ls < rs
+	case "<=":
+		return ls <= rs
+	case ">":
+		return ls > rs
+	case ">=":
+		return ls >= rs
+	}
+	return false
+}
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	}
+	return true
+}
+
+func toString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	return fmt.Sprint(v)
+}
+
+func normalizeValue(v any) any {
+	switch t := v.(type) {
+	case int:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case float32:
+		return float64(t)
+	}
+	return v
+}
+
+// parse compiles an expression into an evaluable tree.
+func parse(src string) (node, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.peek().text, p.peek().pos)
+	}
+	return n, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func tokenize(src string) ([]token, error) {
+	out := make([]token, 0, 16)
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		c := rs[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			out = append(out, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			out = append(out, token{tokRParen, ")", i})
+			i++
+		case c == ',':
+			out = append(out, token{tokComma, ",", i})
+			i++
+		case c == '\'' || c == '"':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(rs) && rs[i] != c {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+				}
+				sb.WriteRune(rs[i])
+				i++
+			}
+			if i >= len(rs) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			out = append(out, token{tokString, sb.String(), start})
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])):
+			start := i
+			for i < len(rs) && (unicode.IsDigit(rs[i]) || rs[i] == '.') {
+				i++
+			}
+			out = append(out, token{tokNumber, string(rs[start:i]), start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_' || rs[i] == '.') {
+				i++
+			}
+			word := string(rs[start:i])
+			switch strings.ToLower(word) {
+			case "and":
+				out = append(out, token{tokOp, "&&", start})
+			case "or":
+				out = append(out, token{tokOp, "||", start})
+			case "not":
+				out = append(out, token{tokOp, "!", start})
+			default:
+				out = append(out, token{tokIdent, word, start})
+			}
+		default:
+			two := ""
+			if i+1 < len(rs) {
+				two = string(rs[i : i+2])
+			}
+			switch two {
+			case "==", "!=", "<=", ">=", "&&", "||":
+				out = append(out, token{tokOp, two, i})
+				i += 2
+				continue
+			}
+			switch c {
+			case '<', '>', '!':
+				out = append(out, token{tokOp, string(c), i})
+				i++
+			case '=':
+				out = append(out, token{tokOp, "==", i})
+				i++
+			default:
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+		}
+	}
+	out = append(out, token{tokEOF, "", len(rs)})
+	return out, nil
+}
+
+// maxDepth bounds how deeply parentheses, calls and ! nest, so a hostile
+// rule cannot exhaust the stack.
+const maxDepth = 64
+
+type parser struct {
+	toks  []token
+	pos   int
+	depth int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: "||", l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "&&" {
+		p.next()
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: "&&", l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokOp {
+		switch t.text {
+		case "==", "!=", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return binary{op: t.text, l: left, r: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, fmt.Errorf("expression nested more than %d deep at offset %d", maxDepth, p.peek().pos)
+	}
+	if t := p.peek(); t.kind == tokOp && t.text == "!" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unary{op: "!", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", t.text, t.pos)
+		}
+		return literal{v}, nil
+	case tokString:
+		return literal{t.text}, nil
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, fmt.Errorf("missing ) for ( at offset %d", t.pos)
+		}
+		return n, nil
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		}
+		if p.peek().kind != tokLParen {
+			return ident{name: strings.ToLower(t.text)}, nil
+		}
+		arity, ok := functionArity[t.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown function %q", t.text)
+		}
+		p.next()
+		args := make([]node, 0, arity)
+		for p.peek().kind != tokRParen {
+			if len(args) > 0 {
+				if p.next().kind != tokComma {
+					return nil, fmt.Errorf("expected , in call to %s", t.text)
+				}
+			}
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		p.next()
+		if len(args) != arity {
+			return nil, fmt.Errorf("%s expects %d argument(s), got %d", t.text, arity, len(args))
+		}
+		return call{fn: t.text, args: args}, nil
+	case tokEOF:
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
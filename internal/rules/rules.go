@@ -0,0 +1,144 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const SettingKey = "ingest_rules"
+
+// Rule is evaluated per file at ingest. When the When expression is true the
+// actions are applied; later matching rules add tags and may override the
+// album and tier chosen by earlier ones.
+type Rule struct {
+	Name  string   `json:"name"`
+	When  string   `json:"when"`
+	Tags  []string `json:"tags,omitempty"`
+	Album string   `json:"album,omitempty"`
+	Tier  string   `json:"tier,omitempty"`
+	Skip  bool     `json:"skip,omitempty"`
+	Stop  bool     `json:"stop,omitempty"`
+}
+
+type Outcome struct {
+	Matched []string `json:"matched"`
+	Tags    []string `json:"tags"`
+	Album   string   `json:"album"`
+	Tier    string   `json:"tier"`
+	Skip    bool     `json:"skip"`
+}
+
+type Set struct {
+	rules    []Rule
+	compiled []node
+}
+
+// Compile validates and compiles rules in order. Errors name the offending
+// rule so they can be shown to the user as-is.
+func Compile(list []Rule) (*Set, error) {
+	if len(list) > 500 {
+		return nil, errors.New("too many rules")
+	}
+	set := &Set{
+		rules:    make([]Rule, 0, len(list)),
+		compiled: make([]node, 0, len(list)),
+	}
+	for i, r := range list {
+		r.Name = strings.TrimSpace(r.Name)
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		r.When = strings.TrimSpace(r.When)
+		if r.When == "" {
+			return nil, fmt.Errorf("%s: when is required", r.Name)
+		}
+		n, err := parse(r.When)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+		r.Tags = normalizeTags(r.Tags)
+		r.Album = strings.TrimSpace(r.Album)
+		r.Tier = strings.TrimSpace(r.Tier)
+		set.rules = append(set.rules, r)
+		set.compiled = append(set.compiled, n)
+	}
+	return set, nil
+}
+
+// Parse decodes the persisted JSON form and compiles it.
+func Parse(raw string) (*Set, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Compile(nil)
+	}
+	var list []Rule
+	if err := json.Unmarshal([]byte(raw), &list); err != nil {
+		return nil, fmt.Errorf("decode rules: %w", err)
+	}
+	return Compile(list)
+}
+
+func (s *Set) Rules() []Rule {
+	if s == nil {
+		return nil
+	}
+	return append([]Rule(nil), s.rules...)
+}
+
+func (s *Set) Empty() bool {
+	return s == nil || len(s.rules) == 0
+}
+
+// Evaluate runs every rule against env. A nil set never matches.
+func (s *Set) Evaluate(env map[string]any) Outcome {
+	out := Outcome{}
+	if s == nil {
+		return out
+	}
+	seen := map[string]struct{}{}
+	for i, r := range s.rules {
+		if !truthy(s.compiled[i].eval(env)) {
+			continue
+		}
+		out.Matched = append(out.Matched, r.Name)
+		for _, tag := range r.Tags {
+			if _, ok := seen[tag]; ok {
+				continue
+			}
+			seen[tag] = struct{}{}
+			out.Tags = append(out.Tags, tag)
+		}
+		if r.Album != "" {
+			out.Album = r.Album
+		}
+		if r.Tier != "" {
+			out.Tier = r.Tier
+		}
+		if r.Skip {
+			out.Skip = true
+		}
+		if r.Stop || r.Skip {
+			break
+		}
+	}
+	return out
+}
+
+func normalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	seen := map[string]struct{}{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || len(t) > 64 {
+			continue
+		}
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		out = append(out, t)
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package rules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateAppliesMatchingRulesInOrder(t *testing.T) {
+	t.Parallel()
+
+	set, err := Compile([]Rule{
+		{Name: "test clips", When: `model == 'Mini 4 Pro' && duration < 3`, Tags: []string{"Test-Clip"}},
+		{Name: "drone", When: `contains(make, "dji")`, Tags: []string{"drone", "test-clip"}, Album: "Drone"},
+		{Name: "archive raw", When: `extension == 'dng' or extension == 'arw'`, Tier: "cold"},
+		{Name: "thumbnails", When: `startsWith(file_name, '.') || size_bytes < 1024`, Skip: true},
+	})
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	got := set.Evaluate(map[string]any{
+		"make":       "DJI",
+		"model":      "mini 4 pro",
+		"duration":   2.5,
+		"extension":  "mp4",
+		"file_name":  "DJI_0001.MP4",
+		"size_bytes": int64(4 << 20),
+	})
+	if !reflect.DeepEqual(got.Tags, []string{"test-clip", "drone"}) {
+		t.Fatalf("Tags = %#v", got.Tags)
+	}
+	if got.Album != "Drone" || got.Tier != "" || got.Skip {
+		t.Fatalf("Outcome = %#v", got)
+	}
+
+	// duration is unknown here, so the first rule must not match.
+	got = set.Evaluate(map[string]any{"model": "Mini 4 Pro", "extension": "dng", "size_bytes": 10.0})
+	if !reflect.DeepEqual(got.Matched, []string{"archive raw", "thumbnails"}) {
+		t.Fatalf("Matched = %#v", got.Matched)
+	}
+	if got.Tier != "cold" || !got.Skip {
+		t.Fatalf("Outcome = %#v", got)
+	}
+}
+
+func TestCompileRejectsInvalidExpressions(t *testing.T) {
+	t.Parallel()
+
+	cases := []string{
+		"",
+		"model ==",
+		"(kind == 'image'",
+		"nosuchfn(kind)",
+		"contains(kind)",
+		"kind == 'image",
+		"size_bytes > 10 $",
+		strings.Repeat("(", 65) + "true" + strings.Repeat(")", 65),
+		strings.Repeat("!", 100000) + "true",
+	}
+	for _, when := range cases {
+		if _, err := Compile([]Rule{{Name: "bad", When: when}}); err == nil {
+			t.Fatalf("Compile(%q) expected error", when)
+		}
+	}
+	deep := strings.Repeat("lower(", 30) + "kind" + strings.Repeat(")", 30)
+	if _, err := Compile([]Rule{{Name: "deep", When: deep + " == 'image'"}}); err != nil {
+		t.Fatalf("Compile(30 nested calls): %v", err)
+	}
+}
@@ -0,0 +1,458 @@
+// Package s3 is a small S3 client for backups, published albums, and
+// libraries kept in a bucket: streaming multipart uploads, whole and ranged
+// object reads, and deletes, signed with AWS Signature Version 4. It talks to AWS and to S3-compatible services such
+// as MinIO and Backblaze B2, so a vault does not need the aws CLI installed.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPartSize is the first part size of a multipart upload.
+	DefaultPartSize = 16 << 20
+	// MinPartSize is the smallest part S3 accepts, except for the last.
+	MinPartSize = 5 << 20
+
+	maxParts = 10000
+	// Parts double in size every partGrowEvery parts, up to partMaxShift
+	// doublings, so an archive of unknown length fits in maxParts without
+	// buffering huge parts for small libraries.
+	partGrowEvery = 2000
+	partMaxShift  = 4
+
+	partAttempts = 3
+)
+
+// retryDelay is the wait before a failed part is sent again, times the
+// attempt number.
+var retryDelay = time.Second
+
+var ErrNotConfigured = errors.New("s3 credentials are not configured")
+
+// Config is how to reach a bucket. Endpoint is empty for AWS; set it to the
+// base URL of an S3-compatible service, such as https://minio.local:9000 or
+// https://s3.us-west-004.backblazeb2.com. PathStyle puts the bucket in the
+// path instead of the host name, which MinIO needs.
+type Config struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token,omitempty"`
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	PathStyle       bool   `json:"path_style"`
+	PartSizeMiB     int    `json:"part_size_mib,omitempty"`
+}
+
+// Normalize trims fields, fills in defaults, and checks the result.
+func (c Config) Normalize() (Config, error) {
+	c.AccessKeyID = strings.TrimSpace(c.AccessKeyID)
+	c.SecretAccessKey = strings.TrimSpace(c.SecretAccessKey)
+	c.SessionToken = strings.TrimSpace(c.SessionToken)
+	c.Region = strings.TrimSpace(c.Region)
+	c.Endpoint = strings.TrimRight(strings.TrimSpace(c.Endpoint), "/")
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return c, ErrNotConfigured
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.Endpoint != "" {
+		u, err := url.Parse(c.Endpoint)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return c, fmt.Errorf("endpoint %q must be an http or https URL", c.Endpoint)
+		}
+	}
+	if c.PartSizeMiB != 0 && (int64(c.PartSizeMiB)<<20 < MinPartSize || c.PartSizeMiB > 512) {
+		return c, errors.New("part_size_mib must be between 5 and 512")
+	}
+	return c, nil
+}
+
+// Client uploads and reads objects.
+type Client struct {
+	cfg      Config
+	http     *http.Client
+	partSize int64
+	now      func() time.Time
+}
+
+// New returns a client for cfg, which is normalized first.
+func New(cfg Config) (*Client, error) {
+	cfg, err := cfg.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	part := int64(DefaultPartSize)
+	if cfg.PartSizeMiB > 0 {
+		part = int64(cfg.PartSizeMiB) << 20
+	}
+	return &Client{cfg: cfg, http: &http.Client{}, partSize: part, now: time.Now}, nil
+}
+
+// ParseURL splits s3://bucket/key.
+func ParseURL(dest string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(dest), "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("s3 destination %q must look like s3://bucket/key", dest)
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("s3 destination %q must look like s3://bucket/key", dest)
+	}
+	return bucket, key, nil
+}
+
+// Upload stores everything read from r as bucket/key. Input shorter than
+// one part is sent with a single PUT; anything longer goes up as a multipart
+// upload, which is aborted if a part cannot be sent.
+func (c *Client) Upload(ctx context.Context, bucket, key string, r io.Reader) error {
+	return c.UploadType(ctx, bucket, key, "", r)
+}
+
+// UploadType is Upload with a Content-Type stored on the object, for
+// files a browser fetches straight from the bucket.
+func (c *Client) UploadType(ctx context.Context, bucket, key, contentType string, r io.Reader) error {
+	var header http.Header
+	if contentType != "" {
+		header = http.Header{"Content-Type": {contentType}}
+	}
+	buf := make([]byte, c.partSize)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if err != nil {
+		resp, err := c.do(ctx, http.MethodPut, bucket, key, nil, buf[:n], header)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	uploadID, err := c.createMultipart(ctx, bucket, key, header)
+	if err != nil {
+		return err
+	}
+	if err := c.uploadParts(ctx, bucket, key, uploadID, r, buf); err != nil {
+		q := url.Values{"uploadId": {uploadID}}
+		if resp, aerr := c.do(context.WithoutCancel(ctx), http.MethodDelete, bucket, key, q, nil, nil); aerr == nil {
+			_ = resp.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *Client) uploadParts(ctx context.Context, bucket, key, uploadID string, r io.Reader, first []byte) error {
+	var parts []completedPart
+	buf, n := first, len(first)
+	for num := 1; ; num++ {
+		etag, err := c.uploadPart(ctx, bucket, key, uploadID, num, buf[:n])
+		if err != nil {
+			return fmt.Errorf("part %d: %w", num, err)
+		}
+		parts = append(parts, completedPart{PartNumber: num, ETag: etag})
+		if n < len(buf) {
+			break
+		}
+		if num == maxParts {
+			return fmt.Errorf("archive needs more than %d parts; raise part_size_mib", maxParts)
+		}
+		if size := c.partSize << min(num/partGrowEvery, partMaxShift); int64(len(buf)) != size {
+			buf = make([]byte, size)
+		}
+		var rerr error
+		n, rerr = io.ReadFull(r, buf)
+		if rerr != nil && !errors.Is(rerr, io.ErrUnexpectedEOF) && !errors.Is(rerr, io.EOF) {
+			return rerr
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	h := http.Header{"Content-Type": {"application/xml"}}
+	resp, err := c.do(ctx, http.MethodPost, bucket, key, url.Values{"uploadId": {uploadID}}, body, h)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// CompleteMultipartUpload can report an error inside a 200 response.
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if e := parseError(raw); e != nil {
+		return e
+	}
+	return nil
+}
+
+func (c *Client) uploadPart(ctx context.Context, bucket, key, uploadID string, num int, data []byte) (string, error) {
+	q := url.Values{"partNumber": {strconv.Itoa(num)}, "uploadId": {uploadID}}
+	var err error
+	for attempt := 1; attempt <= partAttempts; attempt++ {
+		var resp *http.Response
+		resp, err = c.do(ctx, http.MethodPut, bucket, key, q, data, nil)
+		if err == nil {
+			_ = resp.Body.Close()
+			return resp.Header.Get("ETag"), nil
+		}
+		if ctx.Err() != nil || attempt == partAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(attempt) * retryDelay):
+		}
+	}
+	return "", err
+}
+
+func (c *Client) createMultipart(ctx context.Context, bucket, key string, header http.Header) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, bucket, key, url.Values{"uploads": {""}}, nil, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&out); err != nil {
+		return "", fmt.Errorf("start multipart upload: %w", err)
+	}
+	if out.UploadID == "" {
+		return "", errors.New("start multipart upload: no upload id in response")
+	}
+	return out.UploadID, nil
+}
+
+// Open reads bucket/key. The caller closes the returned body.
+func (c *Client) Open(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, bucket, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// OpenRange reads n bytes of bucket/key from off on. The caller closes the
+// returned body.
+func (c *Client) OpenRange(ctx context.Context, bucket, key string, off, n int64) (io.ReadCloser, error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", off, off+n-1)}}
+	resp, err := c.do(ctx, http.MethodGet, bucket, key, nil, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat returns the size and last change of bucket/key.
+func (c *Client) Stat(ctx context.Context, bucket, key string) (int64, time.Time, error) {
+	resp, err := c.do(ctx, http.MethodHead, bucket, key, nil, nil, nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	_ = resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.ContentLength, modTime, nil
+}
+
+// Delete removes bucket/key. S3 reports success for keys that do not
+// exist, so deleting twice is not an error.
+func (c *Client) Delete(ctx context.Context, bucket, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, bucket, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// do sends one signed request and turns non-2xx responses into errors.
+func (c *Client) do(ctx context.Context, method, bucket, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u := c.objectURL(bucket, key)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	sum := sha256.Sum256(body)
+	c.sign(req, hex.EncodeToString(sum[:]), c.now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if e := parseError(raw); e != nil {
+			e.Status = resp.StatusCode
+			return nil, e
+		}
+		return nil, &Error{Status: resp.StatusCode, Message: strings.TrimSpace(string(raw))}
+	}
+	return resp, nil
+}
+
+// objectURL places the bucket in the host (virtual-hosted style) or the
+// path (path style).
+func (c *Client) objectURL(bucket, key string) *url.URL {
+	base := c.cfg.Endpoint
+	if base == "" {
+		base = "https://s3." + c.cfg.Region + ".amazonaws.com"
+	}
+	u, _ := url.Parse(base)
+	prefix := strings.TrimRight(u.Path, "/")
+	if c.cfg.PathStyle {
+		prefix += "/" + bucket
+	} else {
+		u.Host = bucket + "." + u.Host
+	}
+	u.Path = prefix + "/" + key
+	u.RawPath = uriEncode(prefix, false) + "/" + uriEncode(key, false)
+	return u
+}
+
+// Error is an S3 error response.
+type Error struct {
+	Status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: status %d: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+func parseError(raw []byte) *Error {
+	var e Error
+	if xml.Unmarshal(raw, &e) != nil || e.Code == "" {
+		return nil
+	}
+	return &e
+}
+
+// sign adds a Signature Version 4 Authorization header covering the host
+// and every header already on req.
+func (c *Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + strings.Join(strings.Fields(headers[k]), " ") + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + c.cfg.Region + "/s3/aws4_request"
+	canonSum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonSum[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretAccessKey), day)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKeyID, scope, signed, sig))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes query the way SigV4 expects: sorted by key, with
+// every value present even when empty.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and "/"
+// too when encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,24 @@
+//go:build linux
+// +build linux
+
+package scheduler
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadAverage reads the 1-minute load average from /proc/loadavg.
+func loadAverage() (float64, bool) {
+	raw, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	return load, err == nil
+}
@@ -0,0 +1,502 @@
+// Package scheduler runs the vault's heavy background jobs, a configured
+// number at a time, and only while the vault is otherwise idle: no card being ingested, no
+// backup running, and the CPU not already loaded. Each task can be limited
+// to a daily window and ranked against the others; when several are due,
+// the highest priority runs first.
+//
+// A task that is running when ingest or a backup starts, or when its window
+// closes, has its context cancelled and is picked up again once the vault is
+// idle. Tasks must therefore stop promptly on cancellation and resume where
+// they left off.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SettingKey stores Settings as JSON.
+const SettingKey = "scheduler"
+
+// DefaultMaxLoad is the 1-minute load average per CPU above which no task
+// is started.
+const DefaultMaxLoad = 0.75
+
+const (
+	maxPriority        = 100
+	maxIntervalMinutes = 7 * 24 * 60
+	maxLoadLimit       = 16
+)
+
+// Task is a job the scheduler runs. Interval and Priority are defaults that
+// settings can override.
+type Task struct {
+	Name     string
+	Interval time.Duration // between runs, counted from the end of the last
+	Priority int           // 0-100; higher runs first
+	Run      func(ctx context.Context) error
+}
+
+// TaskSettings configures one task. Window is "HH:MM-HH:MM" in local time
+// and may wrap past midnight; empty means any time. IntervalMinutes 0 keeps
+// the task's default.
+type TaskSettings struct {
+	Enabled         bool   `json:"enabled"`
+	Window          string `json:"window"`
+	Priority        int    `json:"priority"`
+	IntervalMinutes int    `json:"interval_minutes"`
+}
+
+// Settings configures the scheduler. Tasks missing from Tasks run with
+// their defaults.
+type Settings struct {
+	MaxLoad float64                 `json:"max_load"` // per CPU; 0 means DefaultMaxLoad
+	Tasks   map[string]TaskSettings `json:"tasks"`
+}
+
+// ParseSettings reads Settings as stored under SettingKey. An empty value
+// is the default settings.
+func ParseSettings(raw string) (Settings, error) {
+	var s Settings
+	if strings.TrimSpace(raw) == "" {
+		return s, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return Settings{}, err
+	}
+	return s, nil
+}
+
+// Normalize checks in against the registered tasks and trims windows.
+func (s *Scheduler) Normalize(in Settings) (Settings, error) {
+	if in.MaxLoad < 0 || in.MaxLoad > maxLoadLimit {
+		return Settings{}, fmt.Errorf("max_load must be between 0 and %d", maxLoadLimit)
+	}
+	out := Settings{MaxLoad: in.MaxLoad, Tasks: make(map[string]TaskSettings, len(in.Tasks))}
+	for name, ts := range in.Tasks {
+		if s.find(name) == nil {
+			return Settings{}, fmt.Errorf("unknown task %q", name)
+		}
+		ts.Window = strings.TrimSpace(ts.Window)
+		if _, _, err := parseWindow(ts.Window); err != nil {
+			return Settings{}, fmt.Errorf("%s: %w", name, err)
+		}
+		if ts.Priority < 0 || ts.Priority > maxPriority {
+			return Settings{}, fmt.Errorf("%s: priority must be between 0 and %d", name, maxPriority)
+		}
+		if ts.IntervalMinutes < 0 || ts.IntervalMinutes > maxIntervalMinutes {
+			return Settings{}, fmt.Errorf("%s: interval_minutes must be between 0 and %d", name, maxIntervalMinutes)
+		}
+		out.Tasks[name] = ts
+	}
+	return out, nil
+}
+
+// parseWindow parses "HH:MM-HH:MM" into minutes after midnight. An empty
+// window is the whole day.
+func parseWindow(w string) (int, int, error) {
+	if w == "" {
+		return 0, 0, nil
+	}
+	from, to, ok := strings.Cut(w, "-")
+	start, err1 := parseClock(from)
+	end, err2 := parseClock(to)
+	if !ok || err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("window %q must look like 22:00-06:00", w)
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("window %q is empty; leave it blank to allow any time", w)
+	}
+	return start, end, nil
+}
+
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, errors.New("invalid time of day")
+	}
+	return hour*60 + minute, nil
+}
+
+// inWindow reports whether t falls in window, which must already be valid.
+func inWindow(window string, t time.Time) bool {
+	if window == "" {
+		return true
+	}
+	start, end, err := parseWindow(window)
+	if err != nil {
+		return false
+	}
+	now := t.Hour()*60 + t.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// CheckWindow validates a daily window in the same "22:00-06:00" form as
+// task windows, for other settings limited to a time of day.
+func CheckWindow(window string) error {
+	_, _, err := parseWindow(window)
+	return err
+}
+
+// InWindow reports whether t falls in window; an empty window is all day.
+func InWindow(window string, t time.Time) bool {
+	return inWindow(window, t)
+}
+
+// TaskStatus is one task as the status endpoint shows it, with the
+// settings in effect.
+type TaskStatus struct {
+	Name            string `json:"name"`
+	Enabled         bool   `json:"enabled"`
+	Window          string `json:"window"`
+	Priority        int    `json:"priority"`
+	IntervalMinutes int    `json:"interval_minutes"`
+	State           string `json:"state"` // idle, running, paused, disabled
+	LastStarted     string `json:"last_started"`
+	LastFinished    string `json:"last_finished"`
+	LastError       string `json:"last_error"`
+	NextDue         string `json:"next_due"`
+}
+
+type Status struct {
+	Idle       bool         `json:"idle"`
+	BusyReason string       `json:"busy_reason"`
+	Load       float64      `json:"load"` // 1-minute load per CPU, -1 when unknown
+	MaxLoad    float64      `json:"max_load"`
+	MaxJobs    int          `json:"max_jobs"`
+	Running    []string     `json:"running"`
+	Tasks      []TaskStatus `json:"tasks"`
+}
+
+type task struct {
+	Task
+	state        string
+	lastStarted  time.Time
+	lastFinished time.Time
+	lastErr      string
+}
+
+type Scheduler struct {
+	logger *log.Logger
+	busy   func() string // why the vault is busy, or ""
+	load   func() (float64, bool)
+	now    func() time.Time
+
+	mu         sync.Mutex
+	tasks      []*task
+	settings   Settings
+	maxJobs    int
+	running    int
+	busyReason string
+}
+
+// New returns a scheduler that asks busy whether other work is under way;
+// busy returns a short reason, or "" when the vault is idle.
+func New(logger *log.Logger, busy func() string) *Scheduler {
+	return &Scheduler{logger: logger, busy: busy, load: loadPerCPU, now: time.Now, maxJobs: 1}
+}
+
+// SetMaxJobs sets how many tasks may run at once. Lowering it lets running
+// tasks finish.
+func (s *Scheduler) SetMaxJobs(n int) {
+	s.mu.Lock()
+	s.maxJobs = max(1, n)
+	s.mu.Unlock()
+}
+
+// Register adds a task. Tasks are registered before Start.
+func (s *Scheduler) Register(t Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = append(s.tasks, &task{Task: t, state: "idle"})
+}
+
+func (s *Scheduler) find(name string) *task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// SetSettings replaces the settings; they apply from the next tick. A
+// running task whose window no longer allows it is stopped.
+func (s *Scheduler) SetSettings(settings Settings) {
+	s.mu.Lock()
+	s.settings = settings
+	s.mu.Unlock()
+}
+
+// Settings returns the settings in effect for every task, defaults filled in.
+func (s *Scheduler) Settings() Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := Settings{MaxLoad: s.maxLoad(), Tasks: make(map[string]TaskSettings, len(s.tasks))}
+	for _, t := range s.tasks {
+		out.Tasks[t.Name] = s.effective(t)
+	}
+	return out
+}
+
+// effective is t's settings with defaults filled in. Callers hold s.mu.
+func (s *Scheduler) effective(t *task) TaskSettings {
+	ts, ok := s.settings.Tasks[t.Name]
+	if !ok {
+		return TaskSettings{Enabled: true, Priority: t.Priority, IntervalMinutes: int(t.Interval / time.Minute)}
+	}
+	if ts.IntervalMinutes == 0 {
+		ts.IntervalMinutes = int(t.Interval / time.Minute)
+	}
+	return ts
+}
+
+func (s *Scheduler) interval(t *task, ts TaskSettings) time.Duration {
+	if ts.IntervalMinutes > 0 {
+		return time.Duration(ts.IntervalMinutes) * time.Minute
+	}
+	return t.Interval
+}
+
+// maxLoad is the load limit in effect. Callers hold s.mu.
+func (s *Scheduler) maxLoad() float64 {
+	if s.settings.MaxLoad > 0 {
+		return s.settings.MaxLoad
+	}
+	return DefaultMaxLoad
+}
+
+// Start checks every tick for due tasks and starts them, up to the job
+// limit, while the vault is idle.
+func (s *Scheduler) Start(ctx context.Context, tick time.Duration) {
+	go func() {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for s.idleCheck(true) == "" {
+				t := s.claim(s.now())
+				if t == nil {
+					break
+				}
+				go s.run(ctx, t, tick)
+			}
+		}
+	}()
+}
+
+// idleCheck records and returns why the vault is busy, or "". The load
+// average is only consulted before starting a task: a running task raises
+// the load itself and must not preempt itself.
+func (s *Scheduler) idleCheck(withLoad bool) string {
+	reason := s.busy()
+	if reason == "" && withLoad {
+		if load, ok := s.load(); ok {
+			s.mu.Lock()
+			limit := s.maxLoad()
+			s.mu.Unlock()
+			if load > limit {
+				reason = fmt.Sprintf("CPU load %.2f per core is above %.2f", load, limit)
+			}
+		}
+	}
+	s.mu.Lock()
+	s.busyReason = reason
+	s.mu.Unlock()
+	return reason
+}
+
+// claim marks the next due task as running and returns it, or returns nil
+// when nothing is due or the job limit is reached.
+func (s *Scheduler) claim(now time.Time) *task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running >= s.maxJobs {
+		return nil
+	}
+	t := s.pick(now)
+	if t != nil {
+		t.state = "running"
+		t.lastStarted = now
+		s.running++
+	}
+	return t
+}
+
+// next returns the task claim would start at now, without starting it.
+func (s *Scheduler) next(now time.Time) *task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pick(now)
+}
+
+// pick chooses the due task to run at now: not running, enabled, inside its
+// window, its interval elapsed since it last finished. Ties in priority go
+// to the task that has waited longest. Callers hold s.mu.
+func (s *Scheduler) pick(now time.Time) *task {
+	var due []*task
+	for _, t := range s.tasks {
+		ts := s.effective(t)
+		if t.state == "running" || !ts.Enabled || !inWindow(ts.Window, now) {
+			continue
+		}
+		if !t.lastFinished.IsZero() && now.Sub(t.lastFinished) < s.interval(t, ts) {
+			continue
+		}
+		due = append(due, t)
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		pi, pj := s.effective(due[i]).Priority, s.effective(due[j]).Priority
+		if pi != pj {
+			return pi > pj
+		}
+		return due[i].lastFinished.Before(due[j].lastFinished)
+	})
+	return due[0]
+}
+
+// run runs t, already claimed, until it returns, cancelling it if the
+// vault becomes busy or t's window closes. A cancelled task is marked paused
+// and stays due.
+func (s *Scheduler) run(ctx context.Context, t *task, tick time.Duration) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var preempted string
+	var preemptMu sync.Mutex
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			reason := s.idleCheck(false)
+			if reason == "" {
+				s.mu.Lock()
+				ts := s.effective(t)
+				s.mu.Unlock()
+				if !ts.Enabled || !inWindow(ts.Window, s.now()) {
+					reason = "outside its window"
+				}
+			}
+			if reason != "" {
+				preemptMu.Lock()
+				preempted = reason
+				preemptMu.Unlock()
+				cancel()
+				return
+			}
+		}
+	}()
+
+	err := t.Run(runCtx)
+	close(done)
+
+	preemptMu.Lock()
+	reason := preempted
+	preemptMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	switch {
+	case ctx.Err() != nil:
+		t.state = "idle"
+	case reason != "":
+		t.state = "paused"
+		s.logger.Printf("scheduler: paused %s: %s", t.Name, reason)
+	default:
+		t.state = "idle"
+		t.lastFinished = s.now()
+		t.lastErr = ""
+		if err != nil {
+			t.lastErr = err.Error()
+			s.logger.Printf("scheduler: %s failed: %v", t.Name, err)
+		}
+	}
+}
+
+func (s *Scheduler) GetStatus() Status {
+	load, ok := s.load()
+	if !ok {
+		load = -1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Status{
+		Idle:       s.busyReason == "",
+		BusyReason: s.busyReason,
+		Load:       load,
+		MaxLoad:    s.maxLoad(),
+		MaxJobs:    s.maxJobs,
+		Running:    make([]string, 0, s.running),
+		Tasks:      make([]TaskStatus, 0, len(s.tasks)),
+	}
+	for _, t := range s.tasks {
+		ts := s.effective(t)
+		item := TaskStatus{
+			Name:            t.Name,
+			Enabled:         ts.Enabled,
+			Window:          ts.Window,
+			Priority:        ts.Priority,
+			IntervalMinutes: ts.IntervalMinutes,
+			State:           t.state,
+			LastStarted:     formatTime(t.lastStarted),
+			LastFinished:    formatTime(t.lastFinished),
+			LastError:       t.lastErr,
+		}
+		if !ts.Enabled {
+			item.State = "disabled"
+		} else if !t.lastFinished.IsZero() {
+			item.NextDue = formatTime(t.lastFinished.Add(s.interval(t, ts)))
+		}
+		st.Tasks = append(st.Tasks, item)
+		if t.state == "running" {
+			st.Running = append(st.Running, t.Name)
+		}
+	}
+	return st
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// loadPerCPU is the 1-minute load average divided by the number of CPUs.
+func loadPerCPU() (float64, bool) {
+	load, ok := loadAverage()
+	if !ok {
+		return 0, false
+	}
+	return load / float64(runtime.NumCPU()), true
+}
@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestScheduler(busy func() string) *Scheduler {
+	s := New(log.New(io.Discard, "", 0), busy)
+	s.load = func() (float64, bool) { return 0, false }
+	return s
+}
+
+func noop(context.Context) error { return nil }
+
+func TestInWindow(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2026, 3, 1, h, m, 0, 0, time.Local) }
+	cases := []struct {
+		window string
+		t      time.Time
+		want   bool
+	}{
+		{"", at(12, 0), true},
+		{"01:00-05:00", at(1, 0), true},
+		{"01:00-05:00", at(5, 0), false},
+		{"01:00-05:00", at(12, 0), false},
+		{"22:00-06:00", at(23, 30), true},
+		{"22:00-06:00", at(3, 0), true},
+		{"22:00-06:00", at(12, 0), false},
+	}
+	for _, c := range cases {
+		if got := inWindow(c.window, c.t); got != c.want {
+			t.Errorf("inWindow(%q, %s) = %v, want %v", c.window, c.t.Format("15:04"), got, c.want)
+		}
+	}
+}
+
+func TestNormalizeRejectsBadSettings(t *testing.T) {
+	s := newTestScheduler(func() string { return "" })
+	s.Register(Task{Name: "thumbs", Interval: time.Hour, Run: noop})
+
+	bad := []Settings{
+		{Tasks: map[string]TaskSettings{"nope": {Enabled: true}}},
+		{Tasks: map[string]TaskSettings{"thumbs": {Window: "25:00-01:00"}}},
+		{Tasks: map[string]TaskSettings{"thumbs": {Window: "02:00-02:00"}}},
+		{Tasks: map[string]TaskSettings{"thumbs": {Priority: 101}}},
+		{MaxLoad: -1},
+	}
+	for _, in := range bad {
+		if _, err := s.Normalize(in); err == nil {
+			t.Errorf("Normalize(%+v) accepted", in)
+		}
+	}
+	got, err := s.Normalize(Settings{Tasks: map[string]TaskSettings{"thumbs": {Enabled: true, Window: " 22:00-06:00 "}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Tasks["thumbs"].Window != "22:00-06:00" {
+		t.Fatalf("window not trimmed: %q", got.Tasks["thumbs"].Window)
+	}
+}
+
+func TestNextHonoursPriorityIntervalAndWindow(t *testing.T) {
+	s := newTestScheduler(func() string { return "" })
+	s.Register(Task{Name: "low", Interval: time.Hour, Priority: 10, Run: noop})
+	s.Register(Task{Name: "high", Interval: time.Hour, Priority: 90, Run: noop})
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+
+	if got := s.next(now); got == nil || got.Name != "high" {
+		t.Fatalf("next = %v, want high", got)
+	}
+	s.find("high").lastFinished = now.Add(-time.Minute)
+	if got := s.next(now); got == nil || got.Name != "low" {
+		t.Fatalf("next after high ran = %v, want low", got)
+	}
+
+	s.SetSettings(Settings{Tasks: map[string]TaskSettings{
+		"low": {Enabled: true, Window: "01:00-05:00", Priority: 10},
+	}})
+	if got := s.next(now); got != nil {
+		t.Fatalf("next outside window = %s, want none", got.Name)
+	}
+	s.SetSettings(Settings{Tasks: map[string]TaskSettings{
+		"low": {Enabled: false},
+	}})
+	if got := s.next(now); got != nil {
+		t.Fatalf("next with low disabled = %s, want none", got.Name)
+	}
+}
+
+func TestRunPausesWhenVaultBecomesBusy(t *testing.T) {
+	var busy atomic.Bool
+	s := newTestScheduler(func() string {
+		if busy.Load() {
+			return "ingest is ingesting"
+		}
+		return ""
+	})
+	started := make(chan struct{})
+	s.Register(Task{Name: "scrub", Interval: time.Hour, Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	tk := s.claim(time.Now())
+	if tk == nil || tk.Name != "scrub" {
+		t.Fatalf("claim = %v, want scrub", tk)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.run(context.Background(), tk, 10*time.Millisecond)
+		close(done)
+	}()
+	<-started
+	busy.Store(true)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not stopped when the vault became busy")
+	}
+
+	st := s.GetStatus()
+	if st.Tasks[0].State != "paused" || st.Tasks[0].LastFinished != "" {
+		t.Fatalf("status = %+v, want paused and not finished", st.Tasks[0])
+	}
+	if s.next(time.Now()) != tk {
+		t.Fatal("paused task is no longer due")
+	}
+}
+
+func TestClaimHonoursJobLimit(t *testing.T) {
+	s := newTestScheduler(func() string { return "" })
+	s.Register(Task{Name: "a", Interval: time.Hour, Priority: 20, Run: noop})
+	s.Register(Task{Name: "b", Interval: time.Hour, Priority: 10, Run: noop})
+	now := time.Now()
+
+	if got := s.claim(now); got == nil || got.Name != "a" {
+		t.Fatalf("first claim = %v, want a", got)
+	}
+	if got := s.claim(now); got != nil {
+		t.Fatalf("claim past the limit = %s, want none", got.Name)
+	}
+	s.SetMaxJobs(2)
+	if got := s.claim(now); got == nil || got.Name != "b" {
+		t.Fatalf("claim after raising the limit = %v, want b", got)
+	}
+	if st := s.GetStatus(); len(st.Running) != 2 {
+		t.Fatalf("running = %v, want both", st.Running)
+	}
+}
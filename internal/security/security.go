@@ -4,10 +4,12 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/base32"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"regexp"
+	"strings"
 
 	"golang.org/x/crypto/pbkdf2"
 )
@@ -60,3 +62,22 @@ func TokenHash(token string) string {
 	sum := sha256.Sum256([]byte(token))
 	return hex.EncodeToString(sum[:])
 }
+
+// NewRecoveryCode returns a one-time code that can stand in for a password,
+// as four groups of four letters and digits, such as abcd-ef23-ghij-kl45.
+func NewRecoveryCode() (string, error) {
+	bytes := make([]byte, 10)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(bytes))
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// RecoveryCodeHash hashes a recovery code as typed, ignoring case, spaces
+// and dashes.
+func RecoveryCodeHash(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return TokenHash(code)
+}
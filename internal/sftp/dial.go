@@ -0,0 +1,386 @@
+package sftp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	ErrUnknownHost    = errors.New("host key is not known")
+	ErrHostKeyChanged = errors.New("host key does not match known_hosts")
+	ErrNoKeys         = errors.New("no ssh private key available")
+)
+
+// Config says how to log in and which host keys to trust.
+//
+// Besides KeyFile, the user's unencrypted ~/.ssh/id_ed25519, id_ecdsa and
+// id_rsa and a running ssh-agent are offered, and ~/.ssh/known_hosts is
+// trusted next to KnownHostsFile, so a machine already set up for the ssh
+// binary keeps working.
+type Config struct {
+	KeyFile        string
+	KnownHostsFile string
+	// AcceptNewHostKeys records the key of a host seen for the first time
+	// in KnownHostsFile instead of refusing it. A changed key is always
+	// refused.
+	AcceptNewHostKeys bool
+	Timeout           time.Duration
+}
+
+// Target is a user@host destination.
+type Target struct {
+	User string
+	Host string
+	Port int
+}
+
+// ParseTarget reads "user@host" or "host". The user defaults to the
+// current one and the port to 22.
+func ParseTarget(s string, port int) (Target, error) {
+	t := Target{Host: strings.TrimSpace(s), Port: port}
+	if i := strings.LastIndex(t.Host, "@"); i >= 0 {
+		t.User, t.Host = t.Host[:i], t.Host[i+1:]
+	}
+	t.Host = strings.TrimSuffix(strings.TrimPrefix(t.Host, "["), "]")
+	if t.Host == "" || strings.ContainsAny(t.Host, " /") {
+		return t, fmt.Errorf("invalid ssh host %q", s)
+	}
+	if t.User == "" {
+		if u, err := user.Current(); err == nil {
+			t.User = u.Username
+		}
+	}
+	if t.Port <= 0 {
+		t.Port = 22
+	}
+	if t.Port > 65535 {
+		return t, fmt.Errorf("invalid ssh port %d", t.Port)
+	}
+	return t, nil
+}
+
+func (t Target) addr() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// Dial logs in to t and starts an SFTP session. Closing the client closes
+// the connection.
+func Dial(ctx context.Context, cfg Config, t Target) (*Client, error) {
+	auth, closeAgent, err := authMethods(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+	hostKeys, algos, err := cfg.hostKeyCallback(t)
+	if err != nil {
+		return nil, err
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	cc := &ssh.ClientConfig{
+		User:              t.User,
+		Auth:              auth,
+		HostKeyCallback:   hostKeys,
+		HostKeyAlgorithms: algos,
+		Timeout:           timeout,
+	}
+
+	d := net.Dialer{Timeout: timeout}
+	nc, err := d.DialContext(ctx, "tcp", t.addr())
+	if err != nil {
+		return nil, fmt.Errorf("ssh connect %s: %w", t.addr(), err)
+	}
+	// The handshake has no context of its own.
+	_ = nc.SetDeadline(time.Now().Add(timeout))
+	stop := context.AfterFunc(ctx, func() { _ = nc.Close() })
+	conn, chans, reqs, err := ssh.NewClientConn(nc, t.addr(), cc)
+	stop()
+	if err != nil {
+		_ = nc.Close()
+		return nil, fmt.Errorf("ssh login %s@%s: %w", t.User, t.addr(), err)
+	}
+	_ = nc.SetDeadline(time.Time{})
+	client := ssh.NewClient(conn, chans, reqs)
+
+	session, err := client.NewSession()
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("ssh session: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err == nil {
+		var stdout io.Reader
+		if stdout, err = session.StdoutPipe(); err == nil {
+			if err = session.RequestSubsystem("sftp"); err == nil {
+				c, err := NewClient(&sessionRW{Reader: stdout, WriteCloser: stdin, session: session, client: client})
+				if err == nil {
+					return c, nil
+				}
+				_ = client.Close()
+				return nil, err
+			}
+		}
+	}
+	_ = client.Close()
+	return nil, fmt.Errorf("ssh sftp subsystem: %w", err)
+}
+
+type sessionRW struct {
+	io.Reader
+	io.WriteCloser
+	session *ssh.Session
+	client  *ssh.Client
+}
+
+func (s *sessionRW) Close() error {
+	_ = s.WriteCloser.Close()
+	_ = s.session.Close()
+	return s.client.Close()
+}
+
+// authMethods offers the configured key, the user's default keys, and the
+// ssh-agent, in that order.
+func authMethods(cfg Config) ([]ssh.AuthMethod, func(), error) {
+	var signers []ssh.Signer
+	if cfg.KeyFile != "" {
+		signer, err := loadSigner(cfg.KeyFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, nil, err
+		}
+		if signer != nil {
+			signers = append(signers, signer)
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			// Keys that need a passphrase are left to the agent.
+			if signer, err := loadSigner(filepath.Join(home, ".ssh", name)); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+	}
+	methods := make([]ssh.AuthMethod, 0, 2)
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	closeAgent := func() {}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			closeAgent = func() { _ = conn.Close() }
+		}
+	}
+	if len(methods) == 0 {
+		return nil, nil, ErrNoKeys
+	}
+	return methods, closeAgent, nil
+}
+
+func loadSigner(path string) (ssh.Signer, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("ssh key %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// hostKeyCallback checks host keys against KnownHostsFile and the user's
+// known_hosts. It also returns the key algorithms already known for the
+// host, so the server is asked for a key it can be checked against.
+func (cfg Config) hostKeyCallback(t Target) (ssh.HostKeyCallback, []string, error) {
+	files := make([]string, 0, 2)
+	if cfg.KnownHostsFile != "" {
+		files = append(files, cfg.KnownHostsFile)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".ssh", "known_hosts"))
+	}
+	existing := files[:0]
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			existing = append(existing, f)
+		}
+	}
+	check := func(string, net.Addr, ssh.PublicKey) error { return &knownhosts.KeyError{} }
+	if len(existing) > 0 {
+		cb, err := knownhosts.New(existing...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("known_hosts: %w", err)
+		}
+		check = cb
+	}
+
+	var algos []string
+	if _, probe, err := ed25519.GenerateKey(rand.Reader); err == nil {
+		if signer, err := ssh.NewSignerFromKey(probe); err == nil {
+			var ke *knownhosts.KeyError
+			if errors.As(check(t.addr(), &net.TCPAddr{IP: net.IPv4zero, Port: t.Port}, signer.PublicKey()), &ke) {
+				algos = knownAlgorithms(ke.Want)
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		var ke *knownhosts.KeyError
+		if !errors.As(err, &ke) {
+			return err
+		}
+		fp := ssh.FingerprintSHA256(key)
+		if len(ke.Want) > 0 {
+			return fmt.Errorf("%w for %s (offered %s %s)", ErrHostKeyChanged, hostname, key.Type(), fp)
+		}
+		if !cfg.AcceptNewHostKeys || cfg.KnownHostsFile == "" {
+			return fmt.Errorf("%w: %s offered %s %s", ErrUnknownHost, hostname, key.Type(), fp)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return AddKnownHost(cfg.KnownHostsFile, hostname, key)
+	}, algos, nil
+}
+
+// knownAlgorithms lists the host key algorithms that can verify the keys
+// in want. RSA keys are accepted with any of their signature algorithms.
+func knownAlgorithms(want []knownhosts.KnownKey) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, k := range want {
+		algos := []string{k.Key.Type()}
+		if k.Key.Type() == ssh.KeyAlgoRSA {
+			algos = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, a := range algos {
+			if !seen[a] {
+				seen[a] = true
+				out = append(out, a)
+			}
+		}
+	}
+	return out
+}
+
+// AddKnownHost appends a host key to a known_hosts file.
+func AddKnownHost(path, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// KnownHost is one known_hosts entry.
+type KnownHost struct {
+	Hosts       []string `json:"hosts"`
+	Type        string   `json:"type"`
+	Fingerprint string   `json:"fingerprint"`
+	Marker      string   `json:"marker,omitempty"`
+}
+
+// ParseKnownHosts lists the entries of known_hosts data and fails on the
+// first line that does not parse.
+func ParseKnownHosts(data []byte) ([]KnownHost, error) {
+	out := make([]KnownHost, 0)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		marker, hosts, key, _, _, err := ssh.ParseKnownHosts(line)
+		if err != nil {
+			return nil, fmt.Errorf("known_hosts line %d: %w", n, err)
+		}
+		out = append(out, KnownHost{Hosts: hosts, Type: key.Type(), Fingerprint: ssh.FingerprintSHA256(key), Marker: marker})
+	}
+	return out, sc.Err()
+}
+
+// GenerateKey writes a new Ed25519 private key to path, replacing any key
+// there.
+func GenerateKey(path string) error {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	return writeKey(path, priv)
+}
+
+// ImportKey stores an OpenSSH or PEM private key at path, decrypting it
+// with passphrase when it is protected, so backups can run unattended.
+func ImportKey(path string, pemBytes, passphrase []byte) error {
+	var key any
+	var err error
+	if len(passphrase) > 0 {
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, passphrase)
+	} else {
+		key, err = ssh.ParseRawPrivateKey(pemBytes)
+	}
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return errors.New("the private key is protected; a passphrase is required")
+	}
+	if err != nil {
+		return fmt.Errorf("private key: %w", err)
+	}
+	return writeKey(path, key)
+}
+
+func writeKey(path string, key any) error {
+	block, err := ssh.MarshalPrivateKey(key, "usbvault backup")
+	if err != nil {
+		return fmt.Errorf("private key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(block), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// PublicKey returns the authorized_keys line and SHA256 fingerprint of the
+// private key at path.
+func PublicKey(path string) (string, string, error) {
+	signer, err := loadSigner(path)
+	if err != nil {
+		return "", "", err
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))) + " usbvault-backup"
+	return line, ssh.FingerprintSHA256(signer.PublicKey()), nil
+}
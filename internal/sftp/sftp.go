@@ -0,0 +1,623 @@
+// Package sftp is a small SFTP (version 3) client for backups: streaming
+// uploads and reads of single files over golang.org/x/crypto/ssh, with the
+// vault's own key and known_hosts handling, so a vault does not need the ssh
+// binary or an ssh_config set up for it.
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// Packet types, from draft-ietf-secsh-filexfer-02.
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpAttrs    = 105
+	fxpExtended = 200
+)
+
+const (
+	flagRead  = 0x01
+	flagWrite = 0x02
+	flagCreat = 0x08
+	flagTrunc = 0x10
+
+	attrSize        = 0x01
+	attrUIDGID      = 0x02
+	attrPermissions = 0x04
+)
+
+// Status codes.
+const (
+	StatusOK               = 0
+	StatusEOF              = 1
+	StatusNoSuchFile       = 2
+	StatusPermissionDenied = 3
+	StatusFailure          = 4
+)
+
+const (
+	// chunkSize is the data carried by one read or write request. 32 KiB is
+	// the most every server is required to accept.
+	chunkSize = 32 << 10
+	// maxInflight requests are kept outstanding per file, so throughput is
+	// not bound by round trips on slow links.
+	maxInflight = 64
+	// maxPacket guards against a corrupt length field.
+	maxPacket = 256 << 10
+)
+
+// StatusError is an error status returned by the server.
+type StatusError struct {
+	Code uint32
+	Msg  string
+	Op   string
+	Path string
+}
+
+func (e *StatusError) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = fmt.Sprintf("status %d", e.Code)
+	}
+	return fmt.Sprintf("sftp %s %s: %s", e.Op, e.Path, msg)
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case fs.ErrNotExist:
+		return e.Code == StatusNoSuchFile
+	case fs.ErrPermission:
+		return e.Code == StatusPermissionDenied
+	}
+	return false
+}
+
+var errClosed = errors.New("sftp connection closed")
+
+type response struct {
+	typ  byte
+	data []byte
+}
+
+// Client is an SFTP session. It is safe for concurrent use.
+type Client struct {
+	w      io.Writer
+	closer io.Closer
+
+	wmu sync.Mutex // serializes packets on w
+
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]chan response
+	err     error // why the reader stopped
+	exts    map[string]string
+}
+
+// NewClient starts an SFTP session over rw, typically the stdin and stdout
+// of an "sftp" subsystem. Closing the client closes rw.
+func NewClient(rw io.ReadWriteCloser) (*Client, error) {
+	c := &Client{w: rw, closer: rw, pending: make(map[uint32]chan response), exts: make(map[string]string)}
+	var b buffer
+	b.uint32(3)
+	if err := writePacket(rw, fxpInit, b); err != nil {
+		return nil, fmt.Errorf("sftp init: %w", err)
+	}
+	typ, data, err := readPacket(rw)
+	if err != nil {
+		return nil, fmt.Errorf("sftp init: %w", err)
+	}
+	if typ != fxpVersion {
+		return nil, fmt.Errorf("sftp init: unexpected packet type %d", typ)
+	}
+	r := reader{data: data}
+	if v := r.uint32(); v < 3 {
+		return nil, fmt.Errorf("sftp init: server speaks version %d", v)
+	}
+	for len(r.data) > 0 && r.err == nil {
+		name, value := r.string(), r.string()
+		c.exts[name] = value
+	}
+	go c.readLoop(rw)
+	return c, nil
+}
+
+func (c *Client) readLoop(r io.Reader) {
+	for {
+		typ, data, err := readPacket(r)
+		if err == nil && len(data) < 4 {
+			err = fmt.Errorf("sftp: short packet of type %d", typ)
+		}
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			for id, ch := range c.pending {
+				close(ch)
+				delete(c.pending, id)
+			}
+			c.mu.Unlock()
+			return
+		}
+		id := binary.BigEndian.Uint32(data)
+		c.mu.Lock()
+		ch, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ok {
+			ch <- response{typ: typ, data: data[4:]}
+		}
+	}
+}
+
+// Close ends the session.
+func (c *Client) Close() error {
+	return c.closer.Close()
+}
+
+// send writes a request and returns the channel its response arrives on.
+// The channel is closed without a value when the connection fails.
+func (c *Client) send(typ byte, fill func(*buffer)) (chan response, error) {
+	c.mu.Lock()
+	if c.err != nil {
+		defer c.mu.Unlock()
+		return nil, fmt.Errorf("%w: %v", errClosed, c.err)
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan response, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	var b buffer
+	b.uint32(id)
+	fill(&b)
+	// Writing may block until the server has read earlier requests, which
+	// needs the reader to keep taking responses, so mu is not held here.
+	c.wmu.Lock()
+	err := writePacket(c.w, typ, b)
+	c.wmu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (c *Client) wait(ch chan response) (response, error) {
+	resp, ok := <-ch
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return resp, fmt.Errorf("%w: %v", errClosed, c.err)
+	}
+	return resp, nil
+}
+
+func (c *Client) call(typ byte, fill func(*buffer)) (response, error) {
+	ch, err := c.send(typ, fill)
+	if err != nil {
+		return response{}, err
+	}
+	return c.wait(ch)
+}
+
+// status turns a response that should be a STATUS into an error, nil for OK.
+func status(resp response, op, p string) error {
+	if resp.typ != fxpStatus {
+		return fmt.Errorf("sftp %s %s: unexpected packet type %d", op, p, resp.typ)
+	}
+	r := reader{data: resp.data}
+	code, msg := r.uint32(), r.string()
+	if r.err != nil {
+		return fmt.Errorf("sftp %s %s: %w", op, p, r.err)
+	}
+	if code == StatusOK {
+		return nil
+	}
+	return &StatusError{Code: code, Msg: msg, Op: op, Path: p}
+}
+
+// FileInfo is what Stat reports.
+type FileInfo struct {
+	Size  int64
+	Mode  fs.FileMode
+	IsDir bool
+}
+
+// Stat returns size and type of p, following symlinks.
+func (c *Client) Stat(p string) (FileInfo, error) {
+	resp, err := c.call(fxpStat, func(b *buffer) { b.string(p) })
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if resp.typ != fxpAttrs {
+		return FileInfo{}, status(resp, "stat", p)
+	}
+	r := reader{data: resp.data}
+	flags := r.uint32()
+	var fi FileInfo
+	if flags&attrSize != 0 {
+		fi.Size = int64(r.uint64())
+	}
+	if flags&attrUIDGID != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&attrPermissions != 0 {
+		perm := r.uint32()
+		fi.Mode = fs.FileMode(perm & 0o777)
+		fi.IsDir = perm&0o170000 == 0o040000
+	}
+	if r.err != nil {
+		return FileInfo{}, fmt.Errorf("sftp stat %s: %w", p, r.err)
+	}
+	return fi, nil
+}
+
+// Mkdir creates one directory.
+func (c *Client) Mkdir(p string) error {
+	resp, err := c.call(fxpMkdir, func(b *buffer) {
+		b.string(p)
+		b.uint32(attrPermissions)
+		b.uint32(0o750)
+	})
+	if err != nil {
+		return err
+	}
+	return status(resp, "mkdir", p)
+}
+
+// MkdirAll creates p and any missing parents.
+func (c *Client) MkdirAll(p string) error {
+	p = path.Clean(p)
+	if p == "/" || p == "." {
+		return nil
+	}
+	if fi, err := c.Stat(p); err == nil {
+		if !fi.IsDir {
+			return fmt.Errorf("sftp mkdir %s: not a directory", p)
+		}
+		return nil
+	}
+	if err := c.MkdirAll(path.Dir(p)); err != nil {
+		return err
+	}
+	err := c.Mkdir(p)
+	if err != nil {
+		// Someone else may have created it in the meantime.
+		if fi, serr := c.Stat(p); serr == nil && fi.IsDir {
+			return nil
+		}
+	}
+	return err
+}
+
+// Remove deletes a file.
+func (c *Client) Remove(p string) error {
+	resp, err := c.call(fxpRemove, func(b *buffer) { b.string(p) })
+	if err != nil {
+		return err
+	}
+	return status(resp, "remove", p)
+}
+
+// Rename moves oldPath to newPath, replacing newPath when it exists. OpenSSH
+// servers do that atomically; elsewhere newPath is removed first.
+func (c *Client) Rename(oldPath, newPath string) error {
+	if _, ok := c.exts["posix-rename@openssh.com"]; ok {
+		resp, err := c.call(fxpExtended, func(b *buffer) {
+			b.string("posix-rename@openssh.com")
+			b.string(oldPath)
+			b.string(newPath)
+		})
+		if err != nil {
+			return err
+		}
+		return status(resp, "rename", oldPath)
+	}
+	if err := c.Remove(newPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	resp, err := c.call(fxpRename, func(b *buffer) {
+		b.string(oldPath)
+		b.string(newPath)
+	})
+	if err != nil {
+		return err
+	}
+	return status(resp, "rename", oldPath)
+}
+
+func (c *Client) open(p string, flags uint32, perm fs.FileMode) (*File, error) {
+	resp, err := c.call(fxpOpen, func(b *buffer) {
+		b.string(p)
+		b.uint32(flags)
+		if flags&flagCreat != 0 {
+			b.uint32(attrPermissions)
+			b.uint32(uint32(perm))
+		} else {
+			b.uint32(0)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.typ != fxpHandle {
+		return nil, status(resp, "open", p)
+	}
+	r := reader{data: resp.data}
+	handle := r.string()
+	if r.err != nil {
+		return nil, fmt.Errorf("sftp open %s: %w", p, r.err)
+	}
+	return &File{c: c, handle: handle, path: p}, nil
+}
+
+// Create opens p for writing, truncating it, with permissions 0640.
+func (c *Client) Create(p string) (*File, error) {
+	return c.open(p, flagWrite|flagCreat|flagTrunc, 0o640)
+}
+
+// Open opens p for reading.
+func (c *Client) Open(p string) (*File, error) {
+	return c.open(p, flagRead, 0)
+}
+
+// File is an open remote file. Writes and reads are sequential and
+// pipelined; a File is not safe for concurrent use.
+type File struct {
+	c      *Client
+	handle string
+	path   string
+	err    error
+
+	// Progress, when set, is called with the total bytes the server has
+	// acknowledged each time a write is confirmed.
+	Progress func(written int64)
+
+	writeOff int64
+	acked    int64
+	writes   []writeReq
+
+	readOff int64 // next byte Read returns
+	reqOff  int64 // offset of the next read request
+	reads   []readReq
+	buf     []byte
+	eof     bool
+}
+
+type writeReq struct {
+	n  int
+	ch chan response
+}
+
+type readReq struct {
+	n  int
+	ch chan response
+}
+
+// Write sends p, waiting only when maxInflight writes are outstanding.
+// Errors from earlier writes are reported by later calls and by Close.
+func (f *File) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), chunkSize)
+		for len(f.writes) >= maxInflight {
+			if err := f.ackWrite(); err != nil {
+				return written, err
+			}
+		}
+		chunk, off := p[:n], f.writeOff
+		ch, err := f.c.send(fxpWrite, func(b *buffer) {
+			b.string(f.handle)
+			b.uint64(uint64(off))
+			b.bytes(chunk)
+		})
+		if err != nil {
+			f.err = err
+			return written, err
+		}
+		f.writes = append(f.writes, writeReq{n: n, ch: ch})
+		f.writeOff += int64(n)
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (f *File) ackWrite() error {
+	w := f.writes[0]
+	f.writes = f.writes[1:]
+	resp, err := f.c.wait(w.ch)
+	if err == nil {
+		err = status(resp, "write", f.path)
+	}
+	if err != nil {
+		f.err = err
+		return err
+	}
+	f.acked += int64(w.n)
+	if f.Progress != nil {
+		f.Progress(f.acked)
+	}
+	return nil
+}
+
+// Read reads sequentially from the start of the file, keeping read
+// requests ahead of the caller.
+func (f *File) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		if f.eof {
+			return 0, io.EOF
+		}
+		for len(f.reads) < maxInflight {
+			off := f.reqOff
+			ch, err := f.c.send(fxpRead, func(b *buffer) {
+				b.string(f.handle)
+				b.uint64(uint64(off))
+				b.uint32(chunkSize)
+			})
+			if err != nil {
+				f.err = err
+				return 0, err
+			}
+			f.reads = append(f.reads, readReq{n: chunkSize, ch: ch})
+			f.reqOff += chunkSize
+		}
+		req := f.reads[0]
+		f.reads = f.reads[1:]
+		resp, err := f.c.wait(req.ch)
+		if err != nil {
+			f.err = err
+			return 0, err
+		}
+		if resp.typ != fxpData {
+			if err := status(resp, "read", f.path); err != nil {
+				var se *StatusError
+				if errors.As(err, &se) && se.Code == StatusEOF {
+					f.eof = true
+					continue
+				}
+				f.err = err
+				return 0, err
+			}
+			f.err = fmt.Errorf("sftp read %s: unexpected ok status", f.path)
+			return 0, f.err
+		}
+		r := reader{data: resp.data}
+		data := r.string()
+		if r.err != nil {
+			f.err = fmt.Errorf("sftp read %s: %w", f.path, r.err)
+			return 0, f.err
+		}
+		f.buf = []byte(data)
+		f.readOff += int64(len(data))
+		if len(data) < req.n {
+			// A short read leaves the requests already sent at the wrong
+			// offsets; drop them and continue from here.
+			f.reads = nil
+			f.reqOff = f.readOff
+		}
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// Close waits for outstanding writes and closes the handle. It returns the
+// first write error, if any.
+func (f *File) Close() error {
+	for len(f.writes) > 0 {
+		if err := f.ackWrite(); err != nil {
+			break
+		}
+	}
+	resp, err := f.c.call(fxpClose, func(b *buffer) { b.string(f.handle) })
+	if err == nil {
+		err = status(resp, "close", f.path)
+	}
+	if f.err != nil {
+		return f.err
+	}
+	return err
+}
+
+// buffer builds a packet payload.
+type buffer struct {
+	b []byte
+}
+
+func (b *buffer) uint32(v uint32) { b.b = binary.BigEndian.AppendUint32(b.b, v) }
+func (b *buffer) uint64(v uint64) { b.b = binary.BigEndian.AppendUint64(b.b, v) }
+func (b *buffer) string(s string) { b.uint32(uint32(len(s))); b.b = append(b.b, s...) }
+func (b *buffer) bytes(p []byte)  { b.uint32(uint32(len(p))); b.b = append(b.b, p...) }
+
+// reader parses a packet payload. The first error sticks and later reads
+// return zero values.
+type reader struct {
+	data []byte
+	err  error
+}
+
+var errShort = errors.New("truncated packet")
+
+func (r *reader) uint32() uint32 {
+	if r.err != nil || len(r.data) < 4 {
+		r.err = errShort
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return v
+}
+
+func (r *reader) uint64() uint64 {
+	if r.err != nil || len(r.data) < 8 {
+		r.err = errShort
+		return 0
+	}
+	v := binary.BigEndian.Uint64(r.data)
+	r.data = r.data[8:]
+	return v
+}
+
+func (r *reader) string() string {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.data)) < n {
+		r.err = errShort
+		return ""
+	}
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
+
+func writePacket(w io.Writer, typ byte, b buffer) error {
+	pkt := make([]byte, 0, 5+len(b.b))
+	pkt = binary.BigEndian.AppendUint32(pkt, uint32(1+len(b.b)))
+	pkt = append(pkt, typ)
+	pkt = append(pkt, b.b...)
+	_, err := w.Write(pkt)
+	return err
+}
+
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:4])
+	if n == 0 || n > maxPacket {
+		return 0, nil, fmt.Errorf("sftp: bad packet length %d", n)
+	}
+	data := make([]byte, n-1)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return hdr[4], data, nil
+}
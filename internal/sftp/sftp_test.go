@@ -0,0 +1,337 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// serveSFTP answers the requests the client makes, on files below root.
+// Reads return at most 10000 bytes, so short reads are exercised.
+func serveSFTP(rw io.ReadWriter, root string) {
+	local := func(p string) string { return filepath.Join(root, filepath.FromSlash(p)) }
+	handles := map[string]*os.File{}
+	reply := func(typ byte, id uint32, fill func(*buffer)) {
+		var b buffer
+		b.uint32(id)
+		if fill != nil {
+			fill(&b)
+		}
+		_ = writePacket(rw, typ, b)
+	}
+	sendStatus := func(id uint32, err error) {
+		code := uint32(StatusOK)
+		switch {
+		case errors.Is(err, io.EOF):
+			code = StatusEOF
+		case errors.Is(err, fs.ErrNotExist):
+			code = StatusNoSuchFile
+		case err != nil:
+			code = StatusFailure
+		}
+		reply(fxpStatus, id, func(b *buffer) {
+			b.uint32(code)
+			b.string("")
+			b.string("")
+		})
+	}
+	for {
+		typ, data, err := readPacket(rw)
+		if err != nil {
+			return
+		}
+		r := reader{data: data}
+		if typ == fxpInit {
+			var b buffer
+			b.uint32(3)
+			b.string("posix-rename@openssh.com")
+			b.string("1")
+			_ = writePacket(rw, fxpVersion, b)
+			continue
+		}
+		id := r.uint32()
+		switch typ {
+		case fxpOpen:
+			name, flags := r.string(), r.uint32()
+			mode := os.O_RDONLY
+			if flags&flagWrite != 0 {
+				mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			}
+			f, err := os.OpenFile(local(name), mode, 0o640)
+			if err != nil {
+				sendStatus(id, err)
+				continue
+			}
+			h := strconv.Itoa(len(handles))
+			handles[h] = f
+			reply(fxpHandle, id, func(b *buffer) { b.string(h) })
+		case fxpWrite:
+			f, off, chunk := handles[r.string()], r.uint64(), r.string()
+			_, err := f.WriteAt([]byte(chunk), int64(off))
+			sendStatus(id, err)
+		case fxpRead:
+			f, off, n := handles[r.string()], r.uint64(), r.uint32()
+			buf := make([]byte, min(n, 10000))
+			got, err := f.ReadAt(buf, int64(off))
+			if got == 0 {
+				sendStatus(id, err)
+				continue
+			}
+			reply(fxpData, id, func(b *buffer) { b.bytes(buf[:got]) })
+		case fxpClose:
+			h := r.string()
+			sendStatus(id, handles[h].Close())
+			delete(handles, h)
+		case fxpStat:
+			fi, err := os.Stat(local(r.string()))
+			if err != nil {
+				sendStatus(id, err)
+				continue
+			}
+			perm := uint32(fi.Mode().Perm())
+			if fi.IsDir() {
+				perm |= 0o040000
+			}
+			reply(fxpAttrs, id, func(b *buffer) {
+				b.uint32(attrSize | attrPermissions)
+				b.uint64(uint64(fi.Size()))
+				b.uint32(perm)
+			})
+		case fxpMkdir:
+			sendStatus(id, os.Mkdir(local(r.string()), 0o750))
+		case fxpRemove:
+			sendStatus(id, os.Remove(local(r.string())))
+		case fxpExtended:
+			_ = r.string()
+			oldPath, newPath := r.string(), r.string()
+			sendStatus(id, os.Rename(local(oldPath), local(newPath)))
+		default:
+			sendStatus(id, errors.New("unsupported"))
+		}
+	}
+}
+
+type pipeRW struct {
+	io.Reader
+	io.WriteCloser
+}
+
+func TestUploadAndReadBack(t *testing.T) {
+	root := t.TempDir()
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	go serveSFTP(pipeRW{Reader: serverR, WriteCloser: serverW}, root)
+	c, err := NewClient(pipeRW{Reader: clientR, WriteCloser: clientW})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Stat("/backups/vault.tar.gz"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat of missing file = %v", err)
+	}
+	if err := c.MkdirAll("/backups/2026/03"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]byte, 3<<20+123)
+	_, _ = rand.Read(want)
+	f, err := c.Create("/backups/2026/03/vault.tar.gz.partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var acked int64
+	f.Progress = func(n int64) { acked = n }
+	if _, err := io.Copy(f, bytes.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if acked != int64(len(want)) {
+		t.Fatalf("progress reported %d bytes, want %d", acked, len(want))
+	}
+	if err := c.Rename("/backups/2026/03/vault.tar.gz.partial", "/backups/2026/03/vault.tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := c.Stat("/backups/2026/03/vault.tar.gz")
+	if err != nil || fi.Size != int64(len(want)) || fi.IsDir {
+		t.Fatalf("Stat = %+v, %v", fi, err)
+	}
+
+	r, err := c.Open("/backups/2026/03/vault.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("read back %d bytes that differ from the %d written", len(got), len(want))
+	}
+}
+
+// startServer runs an ssh server with an sftp subsystem that accepts only
+// clientKey.
+func startServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey, root string) Target {
+	t.Helper()
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	cfg.AddHostKey(hostKey)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(nc, cfg)
+				if err != nil {
+					_ = nc.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for nch := range chans {
+					ch, reqs, err := nch.Accept()
+					if err != nil {
+						continue
+					}
+					go func() {
+						for req := range reqs {
+							ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+							_ = req.Reply(ok, nil)
+							if ok {
+								go func() {
+									serveSFTP(ch, root)
+									_ = ch.Close()
+								}()
+							}
+						}
+					}()
+				}
+			}()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return Target{User: "backup", Host: host, Port: p}
+}
+
+func newSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestDialHostKeys(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	dir := t.TempDir()
+	cfg := Config{KeyFile: filepath.Join(dir, "key"), KnownHostsFile: filepath.Join(dir, "known_hosts")}
+	if err := GenerateKey(cfg.KeyFile); err != nil {
+		t.Fatal(err)
+	}
+	line, _, err := PublicKey(cfg.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	target := startServer(t, newSigner(t), clientKey, root)
+	ctx := context.Background()
+
+	if _, err := Dial(ctx, cfg, target); !errors.Is(err, ErrUnknownHost) {
+		t.Fatalf("Dial to an unknown host = %v, want ErrUnknownHost", err)
+	}
+
+	cfg.AcceptNewHostKeys = true
+	c, err := Dial(ctx, cfg, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Mkdir("/in"); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+	known, err := os.ReadFile(cfg.KnownHostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := ParseKnownHosts(known)
+	if err != nil || len(hosts) != 1 || !strings.Contains(hosts[0].Hosts[0], target.Host) {
+		t.Fatalf("known_hosts = %+v, %v", hosts, err)
+	}
+
+	// Same address, new host key: refused even when new hosts are trusted.
+	other := startServer(t, newSigner(t), clientKey, root)
+	data := strings.Replace(string(known), strconv.Itoa(target.Port), strconv.Itoa(other.Port), 1)
+	if err := os.WriteFile(cfg.KnownHostsFile, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Dial(ctx, cfg, other); !errors.Is(err, ErrHostKeyChanged) {
+		t.Fatalf("Dial with a changed host key = %v, want ErrHostKeyChanged", err)
+	}
+}
+
+func TestImportKey(t *testing.T) {
+	t.Parallel()
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := pem.EncodeToMemory(block)
+	path := filepath.Join(t.TempDir(), "key")
+	if err := ImportKey(path, protected, nil); err == nil {
+		t.Fatal("imported a protected key without its passphrase")
+	}
+	if err := ImportKey(path, protected, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	_, fp, err := PublicKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := ssh.NewSignerFromKey(priv)
+	if fp != ssh.FingerprintSHA256(signer.PublicKey()) {
+		t.Fatalf("fingerprint %s does not match the imported key", fp)
+	}
+}
@@ -0,0 +1,264 @@
+// Package shrink keeps images that compress well, such as screenshots saved
+// as BMP or uncompressed TIFF, in less space in the library. A file is
+// stored as a header followed by a DEFLATE stream of its original bytes, so
+// reading it back gives exactly the file that was ingested, with the same
+// SHA256. Re-encoding the pixels (as lossless WebP, say) would save more on
+// some files but could not give the original file back.
+//
+// The header records the original length and SHA256, so a stored file is
+// self-describing and is checked against that hash when read to the end.
+package shrink
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	magic      = "USBVZ1\n\x00"
+	headerSize = len(magic) + 8 + sha256.Size
+	level      = flate.BestCompression
+)
+
+// ErrCorrupt is returned when a stored file does not inflate to its
+// recorded length and hash.
+var ErrCorrupt = errors.New("compressed library file is corrupt")
+
+// Compressible reports whether files with extension ext are worth trying:
+// formats that are often stored uncompressed or with weak compression.
+func Compressible(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".png", ".tif", ".tiff", ".bmp":
+		return true
+	}
+	return false
+}
+
+// IsCompressed reports whether the file at path starts with the header.
+func IsCompressed(path string) bool {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return HasHeader(f)
+}
+
+// HasHeader is IsCompressed for a file that is already open.
+func HasHeader(r io.ReaderAt) bool {
+	buf := make([]byte, len(magic))
+	n, _ := r.ReadAt(buf, 0)
+	return n == len(magic) && string(buf) == magic
+}
+
+// Compress reads exactly size bytes from src, whose SHA256 is sha256Hex,
+// and writes the stored form to dst. It returns the stored length.
+// Compressing the same bytes always gives the same output, so a first pass
+// to io.Discard tells exactly how long the stored file will be.
+func Compress(dst io.Writer, src io.Reader, size int64, sha256Hex string) (int64, error) {
+	sum, err := hex.DecodeString(sha256Hex)
+	if err != nil || len(sum) != sha256.Size {
+		return 0, fmt.Errorf("invalid sha256 %q", sha256Hex)
+	}
+	cw := &countingWriter{w: dst}
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = binary.BigEndian.AppendUint64(header, uint64(size))
+	header = append(header, sum...)
+	if _, err := cw.Write(header); err != nil {
+		return cw.n, err
+	}
+	zw, err := flate.NewWriter(cw, level)
+	if err != nil {
+		return cw.n, err
+	}
+	n, err := io.Copy(zw, io.LimitReader(src, size))
+	if err != nil {
+		return cw.n, err
+	}
+	if n != size {
+		return cw.n, io.ErrUnexpectedEOF
+	}
+	if err := zw.Close(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, nil
+}
+
+// StoredSize returns how long the stored form of src would be without
+// writing it anywhere.
+func StoredSize(src io.Reader, size int64, sha256Hex string) (int64, error) {
+	return Compress(io.Discard, src, size, sha256Hex)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Reader gives back the original bytes of a stored file. It implements
+// io.ReadSeeker so it can be passed to http.ServeContent: seeking forward
+// inflates and discards, and seeking back starts again from the top, which
+// suits the sequential reads and occasional range requests a library sees.
+type Reader struct {
+	src    io.ReadSeeker
+	closer io.Closer
+	size   int64
+	sum    []byte
+
+	zr     io.ReadCloser
+	pos    int64 // of zr in the original bytes
+	want   int64 // position the next Read starts at
+	hasher hash.Hash
+}
+
+// Open returns r unchanged when it does not hold a compressed file, and a
+// Reader over it when it does. Either way r is left at offset 0 and is
+// closed by closing the result.
+func Open(r io.ReadSeekCloser) (io.ReadSeekCloser, error) {
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(r, header)
+	if _, serr := r.Seek(0, io.SeekStart); serr != nil {
+		_ = r.Close()
+		return nil, serr
+	}
+	if n < len(magic) || !bytes.Equal(header[:len(magic)], []byte(magic)) {
+		return r, nil
+	}
+	if err != nil {
+		_ = r.Close()
+		return nil, ErrCorrupt
+	}
+	size := int64(binary.BigEndian.Uint64(header[len(magic):]))
+	if size < 0 {
+		_ = r.Close()
+		return nil, ErrCorrupt
+	}
+	return &Reader{
+		src:    r,
+		closer: r,
+		size:   size,
+		sum:    append([]byte(nil), header[len(magic)+8:]...),
+	}, nil
+}
+
+// Size is the original length.
+func (r *Reader) Size() int64 { return r.size }
+
+// SHA256 is the recorded hash of the original bytes.
+func (r *Reader) SHA256() string { return hex.EncodeToString(r.sum) }
+
+func (r *Reader) Close() error {
+	if r.zr != nil {
+		_ = r.zr.Close()
+	}
+	return r.closer.Close()
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.want >= r.size {
+		return 0, io.EOF
+	}
+	if r.zr == nil || r.want < r.pos {
+		if err := r.rewind(); err != nil {
+			return 0, err
+		}
+	}
+	if r.want > r.pos {
+		if _, err := io.CopyN(io.Discard, readerFunc(r.inflate), r.want-r.pos); err != nil {
+			return 0, corrupt(err)
+		}
+	}
+	if rest := r.size - r.pos; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	n, err := r.inflate(p)
+	r.want = r.pos
+	if err == io.EOF && r.pos < r.size {
+		return n, ErrCorrupt
+	}
+	if err != nil && err != io.EOF {
+		return n, corrupt(err)
+	}
+	if r.pos == r.size {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// inflate reads the next original bytes and checks the hash once the last
+// one is read.
+func (r *Reader) inflate(p []byte) (int, error) {
+	n, err := r.zr.Read(p)
+	r.hasher.Write(p[:n])
+	r.pos += int64(n)
+	if r.pos > r.size {
+		return n, ErrCorrupt
+	}
+	if r.pos == r.size && !bytes.Equal(r.hasher.Sum(nil), r.sum) {
+		return n, ErrCorrupt
+	}
+	return n, err
+}
+
+func (r *Reader) rewind() error {
+	if _, err := r.src.Seek(int64(headerSize), io.SeekStart); err != nil {
+		return err
+	}
+	if r.zr != nil {
+		_ = r.zr.Close()
+	}
+	r.zr = flate.NewReader(r.src)
+	r.pos = 0
+	r.hasher = sha256.New()
+	return nil
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.want + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.want = abs
+	return abs, nil
+}
+
+func corrupt(err error) error {
+	if errors.Is(err, ErrCorrupt) {
+		return err
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, new(flate.CorruptInputError)) {
+		return ErrCorrupt
+	}
+	return err
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
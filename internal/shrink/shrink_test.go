@@ -0,0 +1,97 @@
+package shrink
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+type nopCloser struct{ *bytes.Reader }
+
+func (nopCloser) Close() error { return nil }
+
+func open(t *testing.T, stored []byte) io.ReadSeekCloser {
+	t.Helper()
+	r, err := Open(nopCloser{bytes.NewReader(stored)})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return r
+}
+
+func TestCompressRoundTripAndSeek(t *testing.T) {
+	// A BMP-like run of repeated rows compresses well.
+	orig := bytes.Repeat([]byte("BM\x00\x00\xff\xff\xff\x00 row of white pixels "), 8000)
+	sum := sha256.Sum256(orig)
+	shaHex := hex.EncodeToString(sum[:])
+
+	size, err := StoredSize(bytes.NewReader(orig), int64(len(orig)), shaHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored bytes.Buffer
+	n, err := Compress(&stored, bytes.NewReader(orig), int64(len(orig)), shaHex)
+	if err != nil || n != size || int64(stored.Len()) != size {
+		t.Fatalf("Compress = %d, %v; StoredSize %d, wrote %d", n, err, size, stored.Len())
+	}
+	if size > int64(len(orig))/10 {
+		t.Fatalf("stored %d of %d bytes", size, len(orig))
+	}
+	if !HasHeader(bytes.NewReader(stored.Bytes())) {
+		t.Fatal("no header")
+	}
+
+	r := open(t, stored.Bytes())
+	if zr, ok := r.(*Reader); !ok || zr.Size() != int64(len(orig)) || zr.SHA256() != shaHex {
+		t.Fatalf("reader = %T", r)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, orig) {
+		t.Fatalf("read %d bytes, %v", len(got), err)
+	}
+
+	// Seeking forward and back, as http.ServeContent does for a range.
+	if end, err := r.Seek(0, io.SeekEnd); err != nil || end != int64(len(orig)) {
+		t.Fatalf("seek end = %d, %v", end, err)
+	}
+	buf := make([]byte, 10)
+	for _, off := range []int64{123456, 17, 200000} {
+		if _, err := r.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(r, buf); err != nil || !bytes.Equal(buf, orig[off:off+10]) {
+			t.Fatalf("at %d read %q, %v", off, buf, err)
+		}
+	}
+}
+
+func TestOpenPassesOtherFilesThrough(t *testing.T) {
+	plain := []byte("\x89PNG\r\n\x1a\n not compressed")
+	r := open(t, plain)
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("read %q, %v", got, err)
+	}
+}
+
+func TestReaderDetectsCorruption(t *testing.T) {
+	orig := bytes.Repeat([]byte("pixels"), 1000)
+	sum := sha256.Sum256(orig)
+	var stored bytes.Buffer
+	if _, err := Compress(&stored, bytes.NewReader(orig), int64(len(orig)), hex.EncodeToString(sum[:])); err != nil {
+		t.Fatal(err)
+	}
+
+	wrongHash := bytes.Clone(stored.Bytes())
+	wrongHash[headerSize-1] ^= 1
+	if _, err := io.ReadAll(open(t, wrongHash)); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("wrong hash: err = %v, want ErrCorrupt", err)
+	}
+	truncated := stored.Bytes()[:stored.Len()-4]
+	if _, err := io.ReadAll(open(t, truncated)); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("truncated: err = %v, want ErrCorrupt", err)
+	}
+}
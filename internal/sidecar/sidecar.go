@@ -0,0 +1,81 @@
+// Package sidecar finds the companion files cameras and drones write next
+// to their media, such as DJI .SRT telemetry subtitles, .LRF proxies, and
+// .XMP edits, and reads the flight data out of DJI subtitles.
+package sidecar
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Kinds of sidecar, named after their extension.
+const (
+	KindXMP = "xmp"
+	KindSRT = "srt"
+	KindGPX = "gpx"
+	KindLRF = "lrf"
+)
+
+// KindOf returns the sidecar kind of path by its extension.
+func KindOf(path string) (string, bool) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".xmp", ".srt", ".gpx", ".lrf":
+		return ext[1:], true
+	}
+	return "", false
+}
+
+// Key pairs media and sidecars: files in the same folder whose names match
+// up to the extension, ignoring case, share a key. A sidecar named after
+// the whole media file, such as IMG_0001.CR2.xmp, has the key of
+// IMG_0001.CR2. isMedia reports whether a name has a media extension.
+func Key(path string, isMedia func(string) bool) string {
+	dir, name := filepath.Split(path)
+	if _, ok := KindOf(name); ok {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+		if isMedia(name) {
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+	} else {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return strings.ToLower(filepath.Join(dir, name))
+}
+
+// Match picks the sidecars of a media file from the candidates that share
+// its key: one per kind, preferring a sidecar named after the whole media
+// file over one named after its stem.
+func Match(mediaPath string, candidates []string) []string {
+	mediaName := strings.ToLower(filepath.Base(mediaPath))
+	chosen := map[string]string{}
+	var kinds []string
+	for _, c := range candidates {
+		kind, ok := KindOf(c)
+		if !ok {
+			continue
+		}
+		prev, seen := chosen[kind]
+		if !seen {
+			kinds = append(kinds, kind)
+		}
+		if !seen || (!namedAfter(prev, mediaName) && namedAfter(c, mediaName)) {
+			chosen[kind] = c
+		}
+	}
+	out := make([]string, len(kinds))
+	for i, kind := range kinds {
+		out[i] = chosen[kind]
+	}
+	return out
+}
+
+func namedAfter(sidecarPath, mediaName string) bool {
+	name := strings.ToLower(filepath.Base(sidecarPath))
+	return strings.TrimSuffix(name, filepath.Ext(name)) == mediaName
+}
+
+// DestPath is where a sidecar is kept next to the library copy of its
+// media: the media path with the sidecar's extension, in lower case.
+func DestPath(mediaDest, sidecarPath string) string {
+	return strings.TrimSuffix(mediaDest, filepath.Ext(mediaDest)) + strings.ToLower(filepath.Ext(sidecarPath))
+}
@@ -0,0 +1,97 @@
+package sidecar
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func isMedia(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp4", ".jpg", ".cr2":
+		return true
+	}
+	return false
+}
+
+func TestKeyAndMatch(t *testing.T) {
+	dir := filepath.Join("card", "DCIM", "100MEDIA")
+	media := filepath.Join(dir, "IMG_0001.CR2")
+	for _, p := range []string{
+		media,
+		filepath.Join(dir, "img_0001.xmp"),
+		filepath.Join(dir, "IMG_0001.CR2.xmp"),
+		filepath.Join(dir, "IMG_0001.SRT"),
+	} {
+		if got, want := Key(p, isMedia), Key(media, isMedia); got != want {
+			t.Fatalf("Key(%s) = %q, want %q", p, got, want)
+		}
+	}
+	if Key(filepath.Join("other", "IMG_0001.xmp"), isMedia) == Key(media, isMedia) {
+		t.Fatal("sidecar in another folder shares the key")
+	}
+
+	got := Match(media, []string{
+		filepath.Join(dir, "img_0001.xmp"),
+		filepath.Join(dir, "IMG_0001.SRT"),
+		filepath.Join(dir, "IMG_0001.CR2.xmp"),
+	})
+	want := []string{filepath.Join(dir, "IMG_0001.CR2.xmp"), filepath.Join(dir, "IMG_0001.SRT")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Match = %v, want %v", got, want)
+	}
+
+	if got := DestPath(filepath.Join("lib", "DJI_0001.mp4"), filepath.Join(dir, "DJI_0001.SRT")); got != filepath.Join("lib", "DJI_0001.srt") {
+		t.Fatalf("DestPath = %q", got)
+	}
+}
+
+func TestParseSRT(t *testing.T) {
+	cases := []struct {
+		name string
+		srt  string
+		want []Sample
+	}{
+		{
+			name: "mavic",
+			srt: "1\n00:00:00,000 --> 00:00:00,033\n<font size=\"28\">SrtCnt : 1, DiffTime : 33ms\n" +
+				"[iso : 100] [latitude: 0.000000] [longitude: 0.000000] [rel_alt: 0.000 abs_alt: 0.000]</font>\n\n" +
+				"2\n00:00:01,033 --> 00:00:01,066\n<font size=\"28\">SrtCnt : 2\n" +
+				"[latitude: 45.512345] [longtitude: -122.654321] [rel_alt: 30.1 abs_alt: 95.2] [gb_yaw: -12.5 gb_pitch: -90.0 gb_roll: 0.0]</font>\n",
+			want: []Sample{{
+				Offset:      1033 * time.Millisecond,
+				HasPosition: true, Lat: 45.512345, Lon: -122.654321, Alt: 95.2, HasAlt: true,
+				HasGimbal: true, Yaw: -12.5, Pitch: -90,
+			}},
+		},
+		{
+			name: "phantom",
+			srt: "1\r\n00:00:02,500 --> 00:00:03,500\r\n" +
+				"HOME(-122.6500,45.5100) 2017.08.05 14:11:51\r\n" +
+				"GPS(-122.6543,45.5123,19) BAROMETER:30.1\r\n" +
+				"ISO:100 Shutter:60 EV:0 Fnum:F2.8 G.PRY (-25.0°,0.1°,170.2°)\r\n",
+			want: []Sample{{
+				Offset:      2500 * time.Millisecond,
+				HasPosition: true, Lat: 45.5123, Lon: -122.6543, Alt: 19, HasAlt: true,
+				HasGimbal: true, Yaw: 170.2, Pitch: -25, Roll: 0.1,
+			}},
+		},
+		{
+			name: "no telemetry",
+			srt:  "1\n00:00:00,000 --> 00:00:01,000\nHello\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseSRT(strings.NewReader(tc.srt))
+			if err != nil {
+				t.Fatalf("ParseSRT: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("ParseSRT = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package sidecar
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sample is the telemetry of one DJI subtitle cue.
+type Sample struct {
+	Offset time.Duration // from the start of the video
+
+	HasPosition bool
+	Lat, Lon    float64
+	Alt         float64 // metres above sea level, when the drone reports it
+	HasAlt      bool
+
+	HasGimbal        bool
+	Yaw, Pitch, Roll float64 // degrees
+}
+
+// maxSRTBytes bounds how much of a subtitle file is read. An hour of 30 fps
+// telemetry is around 40 MB.
+const maxSRTBytes = 64 << 20
+
+var (
+	srtCue = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2})[,.](\d{1,3})\s*-->`)
+	// Mavic 2, Air 2, Mini: [latitude: 44.1] [longitude: -122.1], with
+	// "longtitude" on some firmware.
+	srtLat    = regexp.MustCompile(`\[latitude\s*:\s*(-?[0-9.]+)`)
+	srtLon    = regexp.MustCompile(`\[longt?itude\s*:\s*(-?[0-9.]+)`)
+	srtAbsAlt = regexp.MustCompile(`abs_alt\s*:\s*(-?[0-9.]+)`)
+	// Phantom 3/4 and Inspire: GPS(lon, lat, alt).
+	srtGPS = regexp.MustCompile(`GPS\s*\(\s*(-?[0-9.]+)\s*,\s*(-?[0-9.]+)\s*,\s*(-?[0-9.]+)`)
+	// Gimbal angles, as [gb_yaw: 1 gb_pitch: 2 gb_roll: 3] or
+	// G.PRY (pitch°, roll°, yaw°).
+	srtGbYaw   = regexp.MustCompile(`gb_yaw\s*:\s*(-?[0-9.]+)`)
+	srtGbPitch = regexp.MustCompile(`gb_pitch\s*:\s*(-?[0-9.]+)`)
+	srtGbRoll  = regexp.MustCompile(`gb_roll\s*:\s*(-?[0-9.]+)`)
+	srtGPRY    = regexp.MustCompile(`G\.PRY\s*\(\s*(-?[0-9.]+)°?\s*,\s*(-?[0-9.]+)°?\s*,\s*(-?[0-9.]+)°?`)
+)
+
+// ParseSRT reads the telemetry DJI drones write as video subtitles. Cues
+// without telemetry are left out, and so are positions of 0, 0, which the
+// drone reports before it has a satellite fix.
+func ParseSRT(r io.Reader) ([]Sample, error) {
+	sc := bufio.NewScanner(io.LimitReader(r, maxSRTBytes))
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	var (
+		out  []Sample
+		cur  *Sample
+		text strings.Builder
+	)
+	flush := func() {
+		if cur != nil && parseTelemetry(cur, text.String()) {
+			out = append(out, *cur)
+		}
+		cur = nil
+		text.Reset()
+	}
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if m := srtCue.FindStringSubmatch(line); m != nil {
+			flush()
+			cur = &Sample{Offset: cueOffset(m)}
+			continue
+		}
+		if cur != nil {
+			text.WriteString(line)
+			text.WriteByte(' ')
+		}
+	}
+	flush()
+	return out, sc.Err()
+}
+
+func cueOffset(m []string) time.Duration {
+	h, _ := strconv.Atoi(m[1])
+	mins, _ := strconv.Atoi(m[2])
+	sec, _ := strconv.Atoi(m[3])
+	ms, _ := strconv.Atoi((m[4] + "00")[:3])
+	return time.Duration(h)*time.Hour + time.Duration(mins)*time.Minute +
+		time.Duration(sec)*time.Second + time.Duration(ms)*time.Millisecond
+}
+
+// parseTelemetry fills s from the text of one cue and reports whether it
+// held any.
+func parseTelemetry(s *Sample, text string) bool {
+	if lat, ok := number(srtLat, text); ok {
+		if lon, ok := number(srtLon, text); ok {
+			s.Lat, s.Lon, s.HasPosition = lat, lon, true
+		}
+		s.Alt, s.HasAlt = number(srtAbsAlt, text)
+	} else if m := srtGPS.FindStringSubmatch(text); m != nil {
+		lon, _ := strconv.ParseFloat(m[1], 64)
+		lat, _ := strconv.ParseFloat(m[2], 64)
+		alt, _ := strconv.ParseFloat(m[3], 64)
+		s.Lat, s.Lon, s.Alt = lat, lon, alt
+		s.HasPosition, s.HasAlt = true, true
+	}
+	if s.HasPosition && (s.Lat == 0 && s.Lon == 0 || s.Lat < -90 || s.Lat > 90 || s.Lon < -180 || s.Lon > 180) {
+		s.HasPosition, s.HasAlt = false, false
+	}
+
+	if yaw, ok := number(srtGbYaw, text); ok {
+		pitch, _ := number(srtGbPitch, text)
+		roll, _ := number(srtGbRoll, text)
+		s.Yaw, s.Pitch, s.Roll, s.HasGimbal = yaw, pitch, roll, true
+	} else if m := srtGPRY.FindStringSubmatch(text); m != nil {
+		s.Pitch, _ = strconv.ParseFloat(m[1], 64)
+		s.Roll, _ = strconv.ParseFloat(m[2], 64)
+		s.Yaw, _ = strconv.ParseFloat(m[3], 64)
+		s.HasGimbal = true
+	}
+	return s.HasPosition || s.HasGimbal
+}
+
+func number(re *regexp.Regexp, text string) (float64, bool) {
+	m := re.FindStringSubmatch(text)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	return v, err == nil
+}
+
+// FirstFix returns the first sample with a position.
+func FirstFix(samples []Sample) (Sample, bool) {
+	for _, s := range samples {
+		if s.HasPosition {
+			return s, true
+		}
+	}
+	return Sample{}, false
+}
+
+// FirstGimbal returns the first sample with gimbal angles.
+func FirstGimbal(samples []Sample) (Sample, bool) {
+	for _, s := range samples {
+		if s.HasGimbal {
+			return s, true
+		}
+	}
+	return Sample{}, false
+}
@@ -0,0 +1,236 @@
+// Package simcard writes synthetic camera cards for load and soak tests.
+package simcard
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Spec describes the synthetic card to write.
+type Spec struct {
+	Images    int
+	Videos    int
+	Dupes     int // images written a second time under another name
+	Width     int
+	VideoMiB  int
+	Start     time.Time // capture time of the first file; each next one is a minute later
+	Lat, Lon  float64
+	SpreadDeg float64 // images are placed at random within this many degrees of Lat/Lon
+	Seed      uint64
+}
+
+// Write fills dir with a camera-style DCIM tree: JPEGs carrying EXIF
+// capture time, camera and GPS, MP4s dated only by their file time, and
+// copies of some JPEGs so dedupe has something to find. It returns the
+// bytes written.
+func Write(dir string, spec Spec) (int64, error) {
+	rng := rand.New(rand.NewPCG(spec.Seed, spec.Seed^0x5eed))
+	folder := filepath.Join(dir, "DCIM", "100SIMUL")
+	if err := os.MkdirAll(folder, 0o755); err != nil {
+		return 0, err
+	}
+	var total int64
+	write := func(path string, data []byte, at time.Time) error {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return err
+		}
+		total += int64(len(data))
+		return os.Chtimes(path, at, at)
+	}
+
+	var images []string
+	for i := range spec.Images {
+		at := spec.Start.Add(time.Duration(i) * time.Minute)
+		lat := spec.Lat + (rng.Float64()*2-1)*spec.SpreadDeg
+		lon := spec.Lon + (rng.Float64()*2-1)*spec.SpreadDeg
+		data, err := fakeJPEG(rng, spec.Width, at, lat, lon)
+		if err != nil {
+			return total, err
+		}
+		path := filepath.Join(folder, fmt.Sprintf("IMG_%04d.JPG", i+1))
+		if err := write(path, data, at); err != nil {
+			return total, err
+		}
+		images = append(images, path)
+	}
+	for i := range spec.Videos {
+		at := spec.Start.Add(time.Duration(spec.Images+i) * time.Minute)
+		data := fakeMP4(rng, spec.VideoMiB<<20)
+		if err := write(filepath.Join(folder, fmt.Sprintf("VID_%04d.MP4", i+1)), data, at); err != nil {
+			return total, err
+		}
+	}
+
+	if spec.Dupes > 0 && len(images) > 0 {
+		copies := filepath.Join(dir, "DCIM", "101SIMUL")
+		if err := os.MkdirAll(copies, 0o755); err != nil {
+			return total, err
+		}
+		for i := range spec.Dupes {
+			src := images[i%len(images)]
+			data, err := os.ReadFile(src)
+			if err != nil {
+				return total, err
+			}
+			info, err := os.Stat(src)
+			if err != nil {
+				return total, err
+			}
+			if err := write(filepath.Join(copies, fmt.Sprintf("CPY_%04d.JPG", i+1)), data, info.ModTime()); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// fakeJPEG draws a noisy gradient, so every image hashes differently, and
+// adds an APP1 EXIF segment after the start-of-image marker.
+func fakeJPEG(rng *rand.Rand, width int, at time.Time, lat, lon float64) ([]byte, error) {
+	height := width * 3 / 4
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	r0, g0, b0 := rng.IntN(256), rng.IntN(256), rng.IntN(256)
+	for y := range height {
+		for x := range width {
+			n := rng.IntN(32)
+			img.Set(x, y, color.RGBA{
+				R: uint8(r0 + x*255/width + n),
+				G: uint8(g0 + y*255/height + n),
+				B: uint8(b0 + n),
+				A: 255,
+			})
+		}
+	}
+	var enc bytes.Buffer
+	if err := jpeg.Encode(&enc, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	app1 := append([]byte("Exif\x00\x00"), exifTIFF(at, lat, lon)...)
+	out := make([]byte, 0, enc.Len()+len(app1)+4)
+	out = append(out, enc.Bytes()[:2]...)
+	out = append(out, 0xff, 0xe1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(app1)+2))
+	out = append(out, app1...)
+	return append(out, enc.Bytes()[2:]...), nil
+}
+
+// fakeMP4 is an ftyp box followed by an mdat of random bytes. It is not
+// playable, but ingest only needs the extension, size and file time.
+func fakeMP4(rng *rand.Rand, size int) []byte {
+	ftyp := []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isommp41")
+	body := max(size-len(ftyp)-8, 0)
+	out := make([]byte, 0, len(ftyp)+8+body)
+	out = append(out, ftyp...)
+	out = binary.BigEndian.AppendUint32(out, uint32(8+body))
+	out = append(out, "mdat"...)
+	out = append(out, make([]byte, body)...)
+	_, _ = io.ReadFull(chacha(rng), out[len(out)-body:])
+	return out
+}
+
+func chacha(rng *rand.Rand) io.Reader {
+	var seed [32]byte
+	for i := 0; i < len(seed); i += 8 {
+		binary.LittleEndian.PutUint64(seed[i:], rng.Uint64())
+	}
+	return rand.NewChaCha8(seed)
+}
+
+// tiffEntry is one IFD entry; data longer than four bytes is stored after
+// the IFD.
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+}
+
+func asciiEntry(tag uint16, s string) tiffEntry {
+	return tiffEntry{tag: tag, typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+// degreesEntry writes an angle as degrees, minutes and seconds rationals.
+func degreesEntry(tag uint16, v float64) tiffEntry {
+	v = math.Abs(v)
+	deg := math.Floor(v)
+	mins := math.Floor((v - deg) * 60)
+	sec := ((v-deg)*60 - mins) * 60
+	var data []byte
+	for _, r := range [][2]uint32{{uint32(deg), 1}, {uint32(mins), 1}, {uint32(sec * 10000), 10000}} {
+		data = binary.BigEndian.AppendUint32(data, r[0])
+		data = binary.BigEndian.AppendUint32(data, r[1])
+	}
+	return tiffEntry{tag: tag, typ: 5, count: 3, data: data}
+}
+
+// exifTIFF builds a big-endian TIFF with IFD0 (camera), an Exif IFD
+// (capture time in UTC) and a GPS IFD.
+func exifTIFF(at time.Time, lat, lon float64) []byte {
+	latRef, lonRef := "N", "E"
+	if lat < 0 {
+		latRef = "S"
+	}
+	if lon < 0 {
+		lonRef = "W"
+	}
+	exifIFD := []tiffEntry{
+		asciiEntry(0x9003, at.UTC().Format("2006:01:02 15:04:05")),
+		asciiEntry(0x9011, "+00:00"),
+	}
+	gpsIFD := []tiffEntry{
+		asciiEntry(0x0001, latRef), degreesEntry(0x0002, lat),
+		asciiEntry(0x0003, lonRef), degreesEntry(0x0004, lon),
+	}
+
+	buf := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	ifd0At := len(buf)
+	ifd0 := []tiffEntry{
+		asciiEntry(0x010f, "USB Vault"),
+		asciiEntry(0x0110, "Simulated Card"),
+		{tag: 0x8769, typ: 4, count: 1, data: make([]byte, 4)},
+		{tag: 0x8825, typ: 4, count: 1, data: make([]byte, 4)},
+	}
+	buf = appendIFD(buf, ifd0)
+	exifAt := len(buf)
+	buf = appendIFD(buf, exifIFD)
+	gpsAt := len(buf)
+	buf = appendIFD(buf, gpsIFD)
+
+	// Point IFD0's third and fourth entries at the sub-IFDs.
+	binary.BigEndian.PutUint32(buf[ifd0At+2+2*12+8:], uint32(exifAt))
+	binary.BigEndian.PutUint32(buf[ifd0At+2+3*12+8:], uint32(gpsAt))
+	return buf
+}
+
+// appendIFD writes entries as an IFD at the end of buf, with no next IFD.
+func appendIFD(buf []byte, entries []tiffEntry) []byte {
+	dataAt := len(buf) + 2 + 12*len(entries) + 4
+	var data []byte
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(entries)))
+	for _, e := range entries {
+		buf = binary.BigEndian.AppendUint16(buf, e.tag)
+		buf = binary.BigEndian.AppendUint16(buf, e.typ)
+		buf = binary.BigEndian.AppendUint32(buf, e.count)
+		if len(e.data) <= 4 {
+			buf = append(buf, e.data...)
+			buf = append(buf, make([]byte, 4-len(e.data))...)
+			continue
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(dataAt+len(data)))
+		data = append(data, e.data...)
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	buf = binary.BigEndian.AppendUint32(buf, 0)
+	return append(buf, data...)
+}
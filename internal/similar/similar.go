@@ -0,0 +1,216 @@
+// Package similar finds visually similar library images. Every image gets a
+// 64-bit difference hash (dHash) that changes little under resizing,
+// recompression, and small exposure shifts, so alternate takes of the same
+// subject sit a few bits apart. Hashing is pure Go and runs in the
+// background; nothing leaves the machine.
+package similar
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"math/bits"
+	"slices"
+	"sync"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/vision"
+)
+
+const (
+	batchSize = 50
+	// loadDimension is plenty for a 9x8 hash and keeps decoding cheap.
+	loadDimension = 256
+
+	// DefaultMaxDistance keeps alternate takes and edits while leaving out
+	// unrelated scenes that happen to share a layout.
+	DefaultMaxDistance = 12
+	MaxDistance        = 24
+)
+
+var ErrBusy = errors.New("similarity indexing already running")
+
+// Hash returns the difference hash of img: each bit records whether a pixel
+// of a 9x8 grayscale thumbnail is brighter than its right neighbour.
+func Hash(img *image.RGBA) uint64 {
+	small := media.Resize(img, 9, 8)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if luma(small, x, y) > luma(small, x+1, y) {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func luma(img *image.RGBA, x, y int) uint32 {
+	c := img.RGBAAt(x, y)
+	return 299*uint32(c.R) + 587*uint32(c.G) + 114*uint32(c.B)
+}
+
+// Distance is the number of differing bits between two hashes, 0 to 64.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+type Match struct {
+	MediaID  int64
+	Distance int
+}
+
+// Rank returns up to limit candidates within maxDistance of target, closest
+// first, leaving out the item with id exclude.
+func Rank(target uint64, candidates []db.ImageHash, exclude int64, maxDistance, limit int) []Match {
+	out := make([]Match, 0)
+	for _, c := range candidates {
+		if c.MediaID == exclude {
+			continue
+		}
+		if d := Distance(target, c.Hash); d <= maxDistance {
+			out = append(out, Match{MediaID: c.MediaID, Distance: d})
+		}
+	}
+	slices.SortFunc(out, func(a, b Match) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), cmp.Compare(a.MediaID, b.MediaID))
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+type Status struct {
+	State        string `json:"state"` // idle, running, success, error
+	LastStarted  string `json:"last_started"`
+	LastFinished string `json:"last_finished"`
+	Message      string `json:"message"`
+	Hashed       int    `json:"hashed"`
+	Skipped      int    `json:"skipped"`
+	Pending      int64  `json:"pending"`
+}
+
+// Indexer hashes new images in the background.
+type Indexer struct {
+	store  *db.Store
+	logger *log.Logger
+	libKey *libcrypt.Key
+
+	runMu  sync.Mutex
+	mu     sync.Mutex
+	status Status
+}
+
+func New(store *db.Store, logger *log.Logger) *Indexer {
+	return &Indexer{
+		store:  store,
+		logger: logger,
+		status: Status{State: "idle", Message: "Waiting for first pass."},
+	}
+}
+
+// SetLibraryKey lets the indexer read encrypted library files.
+func (x *Indexer) SetLibraryKey(key *libcrypt.Key) {
+	x.libKey = key
+}
+
+func (x *Indexer) GetStatus(ctx context.Context) Status {
+	pending, _ := x.store.CountImageHashTodos(ctx)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	st := x.status
+	st.Pending = pending
+	return st
+}
+
+// Start indexes immediately and then every interval until ctx ends.
+func (x *Indexer) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := x.RunOnce(ctx); err != nil && !errors.Is(err, ErrBusy) && ctx.Err() == nil {
+				x.logger.Printf("similarity indexing failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce hashes every image that has not been hashed yet. Images that
+// cannot be decoded are marked and skipped.
+func (x *Indexer) RunOnce(ctx context.Context) error {
+	if !x.runMu.TryLock() {
+		return ErrBusy
+	}
+	defer x.runMu.Unlock()
+
+	x.mu.Lock()
+	x.status.State = "running"
+	x.status.LastStarted = time.Now().UTC().Format(time.RFC3339)
+	x.status.Message = "Hashing images..."
+	x.mu.Unlock()
+
+	hashed, skipped, err := x.hashAll(ctx)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.status.LastFinished = time.Now().UTC().Format(time.RFC3339)
+	x.status.Hashed += hashed
+	x.status.Skipped += skipped
+	if err != nil {
+		x.status.State = "error"
+		x.status.Message = err.Error()
+		return err
+	}
+	x.status.State = "success"
+	x.status.Message = fmt.Sprintf("Hashed %d images.", hashed)
+	return nil
+}
+
+func (x *Indexer) hashAll(ctx context.Context) (hashed, skipped int, err error) {
+	for {
+		todos, err := x.store.ListImageHashTodos(ctx, batchSize)
+		if err != nil {
+			return hashed, skipped, err
+		}
+		if len(todos) == 0 {
+			return hashed, skipped, nil
+		}
+		for _, todo := range todos {
+			if err := ctx.Err(); err != nil {
+				return hashed, skipped, err
+			}
+			var (
+				hash    uint64
+				scanErr string
+			)
+			img, err := vision.LoadScaled(x.libKey, todo.DestPath, todo.Extension, loadDimension)
+			switch {
+			case errors.Is(err, vision.ErrUndecodable):
+				scanErr = err.Error()
+				skipped++
+			case err != nil:
+				return hashed, skipped, err
+			default:
+				hash = Hash(img)
+				hashed++
+			}
+			if err := x.store.RecordImageHash(ctx, todo.ID, hash, scanErr); err != nil {
+				return hashed, skipped, err
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package similar
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/media"
+)
+
+// scene draws a bright disc at (cx, cy) on a diagonal gradient.
+func scene(w, h int, cx, cy float64, lift uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			v := uint8(40 + 120*fx*fy)
+			if (fx-cx)*(fx-cx)+(fy-cy)*(fy-cy) < 0.04 {
+				v = 230
+			}
+			v = min(v+lift, 255)
+			img.SetRGBA(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return img
+}
+
+func TestHashSurvivesResizeAndExposure(t *testing.T) {
+	t.Parallel()
+
+	original := Hash(scene(640, 480, 0.3, 0.4, 0))
+	if d := Distance(original, Hash(media.Resize(scene(640, 480, 0.3, 0.4, 0), 160, 120))); d > 2 {
+		t.Fatalf("resized copy distance = %d", d)
+	}
+	if d := Distance(original, Hash(scene(640, 480, 0.3, 0.4, 20))); d > 4 {
+		t.Fatalf("brighter copy distance = %d", d)
+	}
+	if d := Distance(original, Hash(scene(640, 480, 0.75, 0.7, 0))); d <= DefaultMaxDistance/2 {
+		t.Fatalf("different scene distance = %d, too close", d)
+	}
+}
+
+func TestIndexerFeedsRank(t *testing.T) {
+	dir := t.TempDir()
+	store, err := db.Open(filepath.Join(dir, "usbvault.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	insert := func(name string, n int, img image.Image) int64 {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		ts := time.Now().UTC().Format(time.RFC3339)
+		rec := &db.MediaRecord{
+			Kind: "image", FileName: name, Extension: ".png",
+			SourceMount: "/Volumes/Test", SourcePath: "/DCIM/" + name, DestPath: path,
+			SizeBytes: 1, CRC32: fmt.Sprintf("%08x", n), SHA256: fmt.Sprintf("%064x", n),
+			CaptureTime: ts, Metadata: "{}", SourceMTime: ts, IngestedAt: ts,
+		}
+		if err := store.InsertMedia(ctx, rec); err != nil {
+			t.Fatalf("InsertMedia: %v", err)
+		}
+		return rec.ID
+	}
+	first := insert("take1.png", 1, scene(320, 240, 0.3, 0.4, 0))
+	second := insert("take2.png", 2, scene(320, 240, 0.32, 0.4, 10))
+	insert("other.png", 3, scene(320, 240, 0.75, 0.7, 0))
+	broken := filepath.Join(dir, "broken.png")
+	if err := os.WriteFile(broken, []byte("not a png"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Now().UTC().Format(time.RFC3339)
+	if err := store.InsertMedia(ctx, &db.MediaRecord{
+		Kind: "image", FileName: "broken.png", Extension: ".png",
+		SourceMount: "/Volumes/Test", SourcePath: "/DCIM/broken.png", DestPath: broken,
+		SizeBytes: 1, CRC32: "00000004", SHA256: fmt.Sprintf("%064x", 4),
+		CaptureTime: ts, Metadata: "{}", SourceMTime: ts, IngestedAt: ts,
+	}); err != nil {
+		t.Fatalf("InsertMedia: %v", err)
+	}
+
+	indexer := New(store, log.New(io.Discard, "", 0))
+	if err := indexer.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if st := indexer.GetStatus(ctx); st.Hashed != 3 || st.Skipped != 1 || st.Pending != 0 {
+		t.Fatalf("status = %+v", st)
+	}
+
+	target, err := store.GetImageHash(ctx, first)
+	if err != nil || target == nil {
+		t.Fatalf("GetImageHash = %v, %v", target, err)
+	}
+	candidates, err := store.ListImageHashes(ctx, db.MediaFilter{})
+	if err != nil {
+		t.Fatalf("ListImageHashes: %v", err)
+	}
+	if len(candidates) != 3 {
+		t.Fatalf("candidates = %d, want 3 (broken image has no hash)", len(candidates))
+	}
+	matches := Rank(target.Hash, candidates, first, DefaultMaxDistance, 10)
+	if len(matches) != 1 || matches[0].MediaID != second {
+		t.Fatalf("matches = %+v, want only take2", matches)
+	}
+	if all := Rank(target.Hash, candidates, first, 64, 10); len(all) != 2 || all[0].MediaID != second {
+		t.Fatalf("ranking = %+v, want take2 first", all)
+	}
+}
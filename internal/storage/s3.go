@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/s3"
+)
+
+// S3 keeps the library in a bucket, below an optional key prefix. The
+// client is looked up for each call, so credentials saved while the vault
+// runs are used straight away.
+type S3 struct {
+	bucket string
+	prefix string
+	client func(context.Context) (*s3.Client, error)
+}
+
+// NewS3 returns the backend for an s3://bucket/prefix URL.
+func NewS3(url string, client func(context.Context) (*s3.Client, error)) (*S3, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(url), "s3://")
+	if !ok {
+		return nil, fmt.Errorf("s3 storage %q must look like s3://bucket/prefix", url)
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 storage %q must look like s3://bucket/prefix", url)
+	}
+	return &S3{bucket: bucket, prefix: strings.Trim(prefix, "/"), client: client}, nil
+}
+
+func (*S3) Name() string { return "s3" }
+
+// Locate keys the file by its path below the library folder, so the bucket
+// has the same layout as a local library.
+func (b *S3) Locate(_, rel string) string {
+	return "s3://" + b.bucket + "/" + path.Join(b.prefix, filepath.ToSlash(rel))
+}
+
+// Put uploads src. A multipart upload that fails is aborted, so no partial
+// object is left behind.
+func (b *S3) Put(ctx context.Context, base, rel string, src io.Reader, _ time.Time) error {
+	client, err := b.client(ctx)
+	if err != nil {
+		return err
+	}
+	_, key, err := s3.ParseURL(b.Locate(base, rel))
+	if err != nil {
+		return err
+	}
+	return client.Upload(ctx, b.bucket, key, src)
+}
+
+func (b *S3) Open(ctx context.Context, location string) (Object, error) {
+	if IsLocal(location) {
+		return openFile(location)
+	}
+	client, bucket, key, err := b.object(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	size, _, err := client.Stat(ctx, bucket, key)
+	if err != nil {
+		return nil, notExist(location, err)
+	}
+	return &object{ctx: ctx, client: client, bucket: bucket, key: key, size: size}, nil
+}
+
+func (b *S3) Stat(ctx context.Context, location string) (fs.FileInfo, error) {
+	if IsLocal(location) {
+		return os.Stat(location)
+	}
+	client, bucket, key, err := b.object(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	size, modTime, err := client.Stat(ctx, bucket, key)
+	if err != nil {
+		return nil, notExist(location, err)
+	}
+	return objectInfo{name: path.Base(key), size: size, modTime: modTime}, nil
+}
+
+// Remove deletes the object. S3 does not report whether it existed, so
+// removing a missing object succeeds.
+func (b *S3) Remove(ctx context.Context, location string) error {
+	if IsLocal(location) {
+		return os.Remove(location)
+	}
+	client, bucket, key, err := b.object(ctx, location)
+	if err != nil {
+		return err
+	}
+	return client.Delete(ctx, bucket, key)
+}
+
+func (b *S3) object(ctx context.Context, location string) (*s3.Client, string, string, error) {
+	bucket, key, err := s3.ParseURL(location)
+	if err != nil {
+		return nil, "", "", err
+	}
+	client, err := b.client(ctx)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return client, bucket, key, nil
+}
+
+// notExist makes a missing object match fs.ErrNotExist, as a missing file
+// does.
+func notExist(location string, err error) error {
+	var s3err *s3.Error
+	if errors.As(err, &s3err) && s3err.Status == http.StatusNotFound {
+		return &fs.PathError{Op: "open", Path: location, Err: fs.ErrNotExist}
+	}
+	return err
+}
+
+// object reads an S3 object with ranged GETs. Sequential reads share one
+// response; a seek starts a new one at the next read.
+type object struct {
+	ctx    context.Context
+	client *s3.Client
+	bucket string
+	key    string
+	size   int64
+
+	pos     int64
+	body    io.ReadCloser
+	bodyPos int64
+}
+
+func (o *object) Size() int64 { return o.size }
+
+func (o *object) Read(p []byte) (int, error) {
+	if o.pos >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil || o.bodyPos != o.pos {
+		o.closeBody()
+		body, err := o.client.OpenRange(o.ctx, o.bucket, o.key, o.pos, o.size-o.pos)
+		if err != nil {
+			return 0, err
+		}
+		o.body, o.bodyPos = body, o.pos
+	}
+	n, err := o.body.Read(p)
+	o.pos += int64(n)
+	o.bodyPos += int64(n)
+	if errors.Is(err, io.EOF) {
+		o.closeBody()
+		if o.pos < o.size {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
+
+func (o *object) ReadAt(p []byte, off int64) (int, error) {
+	if off >= o.size {
+		return 0, io.EOF
+	}
+	want := min(int64(len(p)), o.size-off)
+	body, err := o.client.OpenRange(o.ctx, o.bucket, o.key, off, want)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p[:want])
+	if err == nil && want < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (o *object) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = o.pos + offset
+	case io.SeekEnd:
+		abs = o.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	o.pos = abs
+	return abs, nil
+}
+
+func (o *object) Close() error {
+	o.closeBody()
+	return nil
+}
+
+func (o *object) closeBody() {
+	if o.body != nil {
+		_ = o.body.Close()
+		o.body = nil
+	}
+}
+
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i objectInfo) Name() string       { return i.name }
+func (i objectInfo) Size() int64        { return i.size }
+func (i objectInfo) Mode() fs.FileMode  { return 0o440 }
+func (i objectInfo) ModTime() time.Time { return i.modTime }
+func (i objectInfo) IsDir() bool        { return false }
+func (i objectInfo) Sys() any           { return nil }
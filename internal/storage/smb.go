@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrShareNotMounted is returned when the library folder of an SMB backend
+// is not on a mounted SMB share.
+var ErrShareNotMounted = errors.New("library folder is not on a mounted SMB share")
+
+// SMB keeps the library on an SMB share mounted on this machine, such as a
+// NAS folder mounted with mount.cifs. It writes like Local, but refuses to
+// while the share is not mounted, so copies never pile up on the vault's
+// own disk under the empty mount point.
+type SMB struct {
+	Local
+}
+
+// NewSMB returns the SMB share backend.
+func NewSMB() *SMB {
+	return &SMB{}
+}
+
+func (*SMB) Name() string { return "smb" }
+
+func (b *SMB) Put(ctx context.Context, base, rel string, src io.Reader, modTime time.Time) error {
+	ok, err := onSMBShare(base)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrShareNotMounted, base)
+	}
+	return b.Local.Put(ctx, base, rel, src, modTime)
+}
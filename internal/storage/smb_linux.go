@@ -0,0 +1,26 @@
+//go:build linux
+// +build linux
+
+package storage
+
+import "golang.org/x/sys/unix"
+
+// Filesystem magic numbers of the kernel's SMB clients.
+const (
+	cifsMagic = 0xFF534D42
+	smb2Magic = 0xFE534D42
+	smbMagic  = 0x517B
+)
+
+// onSMBShare reports whether path is on a mounted SMB share.
+func onSMBShare(path string) (bool, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false, err
+	}
+	switch uint32(st.Type) {
+	case cifsMagic, smb2Magic, smbMagic:
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package storage
+
+import "os"
+
+// onSMBShare can only tell an SMB share apart on Linux. Elsewhere any
+// existing folder is taken as the mounted share.
+func onSMBShare(path string) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,170 @@
+// Package storage is where library files are kept: a folder on the vault's
+// own disk, a folder on a mounted SMB share, or an S3 bucket. Ingest writes
+// through a Backend, and the server reads back through the same one.
+//
+// A file is named by its path below the library folder. The backend turns
+// that into the location recorded as the file's dest_path: the absolute
+// path for the filesystem backends, and s3://bucket/key for S3. Every
+// backend still opens plain paths, so files ingested before a switch to S3
+// stay readable where they are.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/fault"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/shrink"
+)
+
+// Object is an open library file.
+type Object interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+	// Size is the stored length, which for an encrypted file includes the
+	// encryption overhead.
+	Size() int64
+}
+
+// Backend writes library files and reads them back.
+type Backend interface {
+	// Name is "local", "smb", or "s3".
+	Name() string
+	// Locate returns the location a file at rel below base is stored at.
+	Locate(base, rel string) string
+	// Put stores everything read from src at Locate(base, rel). A file
+	// only appears there once it is complete.
+	Put(ctx context.Context, base, rel string, src io.Reader, modTime time.Time) error
+	Open(ctx context.Context, location string) (Object, error)
+	Stat(ctx context.Context, location string) (fs.FileInfo, error)
+	// Remove deletes the file at location. A file that is already gone
+	// reports an error matching fs.ErrNotExist.
+	Remove(ctx context.Context, location string) error
+}
+
+// IsLocal reports whether location is a path on this machine rather than
+// an object in remote storage.
+func IsLocal(location string) bool {
+	return !strings.Contains(location, "://")
+}
+
+// OpenPlain opens location for reading its original bytes: it decrypts a
+// file stored encrypted and inflates one stored compressed.
+func OpenPlain(ctx context.Context, b Backend, key *libcrypt.Key, location string) (io.ReadSeekCloser, error) {
+	obj, err := b.Open(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	if !libcrypt.HasHeader(obj) {
+		if !shrink.HasHeader(obj) {
+			return obj, nil
+		}
+		return shrink.Open(obj)
+	}
+	if key == nil {
+		_ = obj.Close()
+		return nil, errors.New("library file is encrypted but USBVAULT_LIBRARY_ENCRYPTION is not enabled")
+	}
+	plain, err := key.NewReader(obj, obj.Size())
+	if err != nil {
+		return nil, err
+	}
+	return shrink.Open(plain)
+}
+
+// IsPlainFile reports whether location is a local file holding its
+// original bytes as they are, which tools that need a path, such as
+// ffmpeg, can read directly.
+func IsPlainFile(location string) bool {
+	return IsLocal(location) && !libcrypt.IsEncrypted(location) && !shrink.IsCompressed(location)
+}
+
+// Local keeps the library in a folder on this machine.
+type Local struct{}
+
+// NewLocal returns the filesystem backend.
+func NewLocal() *Local {
+	return &Local{}
+}
+
+func (*Local) Name() string { return "local" }
+
+func (*Local) Locate(base, rel string) string {
+	return filepath.Join(base, rel)
+}
+
+// Put writes through a .part file that is synced and renamed into place,
+// then marks the copy read-only.
+func (l *Local) Put(ctx context.Context, base, rel string, src io.Reader, modTime time.Time) error {
+	dstPath := l.Locate(base, rel)
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0o750); err != nil {
+		return err
+	}
+	tmpPath := dstPath + ".part"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	copyErr := func() error {
+		defer dst.Close()
+		buf := make([]byte, 1024*1024)
+		if _, err := io.CopyBuffer(fault.Writer(fault.LibraryWrite, dst), src, buf); err != nil {
+			return err
+		}
+		return dst.Sync()
+	}()
+	if copyErr != nil {
+		_ = os.Remove(tmpPath)
+		return copyErr
+	}
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	_ = os.Chtimes(dstPath, modTime, modTime)
+	_ = os.Chmod(dstPath, 0o440)
+	return nil
+}
+
+func (*Local) Open(_ context.Context, location string) (Object, error) {
+	return openFile(location)
+}
+
+func (*Local) Stat(_ context.Context, location string) (fs.FileInfo, error) {
+	return os.Stat(location)
+}
+
+func (*Local) Remove(_ context.Context, location string) error {
+	return os.Remove(location)
+}
+
+type file struct {
+	*os.File
+	size int64
+}
+
+func (f *file) Size() int64 { return f.size }
+
+func openFile(path string) (Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		_ = f.Close()
+		return nil, &fs.PathError{Op: "open", Path: path, Err: errors.New("is a directory")}
+	}
+	return &file{File: f, size: info.Size()}, nil
+}
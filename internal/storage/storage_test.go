@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/s3"
+)
+
+func TestLocalPutOpenRemove(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	b := NewLocal()
+	rel := filepath.Join("2026", "03", "01", "IMG_0001.jpg")
+	modTime := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	if err := b.Put(ctx, base, rel, strings.NewReader("pixels"), modTime); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	loc := b.Locate(base, rel)
+	if loc != filepath.Join(base, rel) || !IsLocal(loc) {
+		t.Fatalf("Locate = %q", loc)
+	}
+	if _, err := os.Stat(loc + ".part"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf(".part left behind: %v", err)
+	}
+	info, err := b.Stat(ctx, loc)
+	if err != nil || info.Size() != 6 || !info.ModTime().Equal(modTime) {
+		t.Fatalf("Stat = %v, %v", info, err)
+	}
+	got := readAll(t, ctx, b, nil, loc)
+	if got != "pixels" {
+		t.Fatalf("read %q", got)
+	}
+	if err := b.Remove(ctx, loc); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := b.Remove(ctx, loc); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("second Remove = %v, want not exist", err)
+	}
+}
+
+func TestSMBRefusesUnmountedShare(t *testing.T) {
+	// A temporary folder is on the vault's own disk, like the mount point
+	// of a share that did not mount.
+	base := t.TempDir()
+	err := NewSMB().Put(context.Background(), base, "IMG_0001.jpg", strings.NewReader("pixels"), time.Now())
+	if !errors.Is(err, ErrShareNotMounted) {
+		t.Fatalf("Put = %v, want ErrShareNotMounted", err)
+	}
+	if _, err := os.Stat(filepath.Join(base, "IMG_0001.jpg")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("file written to unmounted share: %v", err)
+	}
+}
+
+type fakeBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = body
+	case http.MethodGet, http.MethodHead:
+		obj, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", "Sun, 01 Mar 2026 10:00:00 GMT")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(obj))
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3EncryptedRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	bucket := &fakeBucket{objects: map[string][]byte{}}
+	srv := httptest.NewServer(bucket)
+	defer srv.Close()
+	client, err := s3.New(s3.Config{AccessKeyID: "id", SecretAccessKey: "secret", Endpoint: srv.URL, PathStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewS3("s3://media/vault/", func(context.Context) (*s3.Client, error) { return client, nil })
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	key, err := libcrypt.LoadOrCreateKey(filepath.Join(t.TempDir(), "library.key"), []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := t.TempDir()
+	rel := filepath.Join("Oregon", "2026", "03", "01", "IMG_0001.jpg")
+	loc := b.Locate(base, rel)
+	if loc != "s3://media/vault/Oregon/2026/03/01/IMG_0001.jpg" || IsLocal(loc) {
+		t.Fatalf("Locate = %q", loc)
+	}
+	plain := bytes.Repeat([]byte("0123456789"), 20000)
+	pr, pw := io.Pipe()
+	go func() { pw.CloseWithError(key.Encrypt(pw, bytes.NewReader(plain), int64(len(plain)))) }()
+	if err := b.Put(ctx, base, rel, pr, time.Now()); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, ok := bucket.objects["/media/vault/Oregon/2026/03/01/IMG_0001.jpg"]; !ok {
+		t.Fatalf("objects = %v", bucket.objects)
+	}
+
+	if got := readAll(t, ctx, b, key, loc); got != string(plain) {
+		t.Fatalf("decrypted %d bytes, want %d", len(got), len(plain))
+	}
+	src, err := OpenPlain(ctx, b, key, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Seek(123457, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(src, buf); err != nil || string(buf) != "78901" {
+		t.Fatalf("read after seek = %q, %v", buf, err)
+	}
+	_ = src.Close()
+
+	// Files from before the switch are still read from the filesystem.
+	old := filepath.Join(base, "old.jpg")
+	if err := os.WriteFile(old, []byte("local"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, ctx, b, key, old); got != "local" {
+		t.Fatalf("local file read %q", got)
+	}
+
+	if err := b.Remove(ctx, loc); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := b.Stat(ctx, loc); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat after Remove = %v, want not exist", err)
+	}
+}
+
+func readAll(t *testing.T, ctx context.Context, b Backend, key *libcrypt.Key, loc string) string {
+	t.Helper()
+	src, err := OpenPlain(ctx, b, key, loc)
+	if err != nil {
+		t.Fatalf("open %s: %v", loc, err)
+	}
+	defer src.Close()
+	got, err := io.ReadAll(src)
+	if err != nil {
+		t.Fatalf("read %s: %v", loc, err)
+	}
+	return string(got)
+}
@@ -0,0 +1,120 @@
+package timelapse
+
+import (
+	"cmp"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+const (
+	// MaxInterval is the longest pause between two frames of a sequence.
+	// Intervalometers are rarely set longer, and a longer pause is taken
+	// as the end of the shoot.
+	MaxInterval = 2 * time.Minute
+
+	// A sequence is shot at a steady pace: at least regularShare of its
+	// pauses lie within half the typical pause, or a second, of it.
+	// Capture times are whole seconds, hence the second.
+	regularShare = 0.8
+)
+
+// Sequence is a run of stills detected as one time-lapse or burst.
+type Sequence struct {
+	MediaIDs []int64
+	Start    time.Time
+	End      time.Time
+	Interval time.Duration // typical pause between frames
+}
+
+type frame struct {
+	id   int64
+	name string
+	at   time.Time
+}
+
+// Detect finds time-lapse and burst sequences among candidates: at least
+// minFrames stills from the same card folder and camera, taken at a steady
+// pace with no pause longer than MaxInterval. Frames are ordered by capture
+// time, then by file name, which cameras number in shooting order.
+func Detect(candidates []db.TimelapseCandidate, minFrames int) []Sequence {
+	groups := map[string][]frame{}
+	for _, c := range candidates {
+		at, err := time.Parse(time.RFC3339, c.CaptureTime)
+		if err != nil {
+			continue
+		}
+		key := folderKey(c) + "\x00" + c.Make + "\x00" + c.Model
+		groups[key] = append(groups[key], frame{id: c.MediaID, name: c.FileName, at: at})
+	}
+
+	out := make([]Sequence, 0)
+	for _, frames := range groups {
+		if len(frames) < minFrames {
+			continue
+		}
+		slices.SortFunc(frames, func(a, b frame) int {
+			return cmp.Or(a.at.Compare(b.at), cmp.Compare(a.name, b.name), cmp.Compare(a.id, b.id))
+		})
+		start := 0
+		for i := 1; i <= len(frames); i++ {
+			if i < len(frames) && frames[i].at.Sub(frames[i-1].at) <= MaxInterval {
+				continue
+			}
+			if seq, ok := sequenceOf(frames[start:i], minFrames); ok {
+				out = append(out, seq)
+			}
+			start = i
+		}
+	}
+	slices.SortFunc(out, func(a, b Sequence) int {
+		return cmp.Or(a.Start.Compare(b.Start), cmp.Compare(a.MediaIDs[0], b.MediaIDs[0]))
+	})
+	return out
+}
+
+// folderKey names the card folder a still came from. Uploads and older
+// records without a card identity fall back to the folder they were read
+// from.
+func folderKey(c db.TimelapseCandidate) string {
+	if c.SourceRelPath != "" {
+		return c.SourceCard + "\x00" + path.Dir(c.SourceRelPath)
+	}
+	return c.SourceMount + "\x00" + filepath.Dir(c.SourcePath)
+}
+
+func sequenceOf(frames []frame, minFrames int) (Sequence, bool) {
+	if len(frames) < minFrames {
+		return Sequence{}, false
+	}
+	gaps := make([]time.Duration, len(frames)-1)
+	for i := 1; i < len(frames); i++ {
+		gaps[i-1] = frames[i].at.Sub(frames[i-1].at)
+	}
+	sorted := slices.Clone(gaps)
+	slices.Sort(sorted)
+	typical := sorted[len(sorted)/2]
+	tolerance := max(typical/2, time.Second)
+	steady := 0
+	for _, g := range gaps {
+		if g >= typical-tolerance && g <= typical+tolerance {
+			steady++
+		}
+	}
+	if float64(steady) < regularShare*float64(len(gaps)) {
+		return Sequence{}, false
+	}
+	seq := Sequence{
+		MediaIDs: make([]int64, len(frames)),
+		Start:    frames[0].at,
+		End:      frames[len(frames)-1].at,
+		Interval: typical,
+	}
+	for i, f := range frames {
+		seq.MediaIDs[i] = f.id
+	}
+	return seq, true
+}
@@ -0,0 +1,93 @@
+package timelapse
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"businessplan/usbvault/internal/db"
+)
+
+var t0 = time.Date(2024, 6, 1, 5, 0, 0, 0, time.UTC)
+
+// shots makes n stills from one card folder, interval apart, ids from first.
+func shots(first int64, n int, start time.Time, interval time.Duration, folder string) []db.TimelapseCandidate {
+	out := make([]db.TimelapseCandidate, n)
+	for i := range out {
+		out[i] = db.TimelapseCandidate{
+			MediaID:       first + int64(i),
+			FileName:      fmt.Sprintf("IMG_%04d.JPG", int(first)+i),
+			SourceCard:    "card-a",
+			SourceRelPath: folder + fmt.Sprintf("/IMG_%04d.JPG", int(first)+i),
+			Make:          "Canon",
+			Model:         "EOS R6",
+			CaptureTime:   start.Add(time.Duration(i) * interval).Format(time.RFC3339),
+		}
+	}
+	return out
+}
+
+func TestDetectSplitsOnLongPause(t *testing.T) {
+	candidates := shots(1, 40, t0, 5*time.Second, "DCIM/100CANON")
+	candidates = append(candidates, shots(41, 35, t0.Add(time.Hour), 5*time.Second, "DCIM/100CANON")...)
+
+	seqs := Detect(candidates, 30)
+	if len(seqs) != 2 {
+		t.Fatalf("sequences = %d, want 2", len(seqs))
+	}
+	if len(seqs[0].MediaIDs) != 40 || seqs[0].MediaIDs[0] != 1 || len(seqs[1].MediaIDs) != 35 || seqs[1].MediaIDs[0] != 41 {
+		t.Fatalf("sequences = %v", seqs)
+	}
+	if seqs[0].Interval != 5*time.Second {
+		t.Fatalf("interval = %s, want 5s", seqs[0].Interval)
+	}
+}
+
+func TestDetectBurstWithinOneSecond(t *testing.T) {
+	// A 10 fps burst: whole-second capture times repeat.
+	candidates := make([]db.TimelapseCandidate, 0, 40)
+	for i, c := range shots(1, 40, t0, 0, "DCIM/100CANON") {
+		c.CaptureTime = t0.Add(time.Duration(i/10) * time.Second).Format(time.RFC3339)
+		candidates = append(candidates, c)
+	}
+	seqs := Detect(candidates, 30)
+	if len(seqs) != 1 || len(seqs[0].MediaIDs) != 40 {
+		t.Fatalf("sequences = %v, want one of 40 frames", seqs)
+	}
+	for i, id := range seqs[0].MediaIDs {
+		if id != int64(i+1) {
+			t.Fatalf("frame %d is media %d; burst frames must keep file order", i, id)
+		}
+	}
+}
+
+func TestDetectIgnoresIrregularShooting(t *testing.T) {
+	// A photo walk: many shots, no pause over two minutes, no steady pace.
+	gaps := []time.Duration{3, 40, 7, 90, 15, 2, 60, 25, 110, 5}
+	candidates := make([]db.TimelapseCandidate, 0, 50)
+	at := t0
+	for i, c := range shots(1, 50, t0, 0, "DCIM/100CANON") {
+		c.CaptureTime = at.Format(time.RFC3339)
+		candidates = append(candidates, c)
+		at = at.Add(gaps[i%len(gaps)] * time.Second)
+	}
+	if seqs := Detect(candidates, 30); len(seqs) != 0 {
+		t.Fatalf("sequences = %v, want none", seqs)
+	}
+}
+
+func TestDetectKeepsFoldersAndCamerasApart(t *testing.T) {
+	a := shots(1, 20, t0, 2*time.Second, "DCIM/100CANON")
+	b := shots(21, 20, t0.Add(time.Second), 2*time.Second, "DCIM/101CANON")
+	if seqs := Detect(append(a, b...), 30); len(seqs) != 0 {
+		t.Fatalf("frames from two folders were joined: %v", seqs)
+	}
+
+	c := shots(41, 20, t0, 2*time.Second, "DCIM/100CANON")
+	for i := range c {
+		c[i].Model = "EOS R5"
+	}
+	if seqs := Detect(append(a, c...), 30); len(seqs) != 0 {
+		t.Fatalf("frames from two cameras were joined: %v", seqs)
+	}
+}
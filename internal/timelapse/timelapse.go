@@ -0,0 +1,348 @@
+// Package timelapse turns folders of stills shot as a time-lapse,
+// hyperlapse, or burst into something that plays. It finds runs of frames
+// taken at a steady pace and renders each into an MP4 with ffmpeg. The
+// stills stay in the library as they are; the video is a derivative kept
+// in the proxies work area and can always be rendered again from them.
+package timelapse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"businessplan/usbvault/internal/config"
+	"businessplan/usbvault/internal/db"
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/storage"
+)
+
+const (
+	baseStorageSetting = "base_storage_dir"
+
+	// frameMaxDimension renders at 1080p-class size whatever the stills'
+	// resolution.
+	frameMaxDimension = 1920
+	frameQuality      = 90
+	stderrMax         = 4 << 10
+)
+
+var ErrBusy = errors.New("time-lapse assembly already running")
+
+type Status struct {
+	Enabled      bool   `json:"enabled"`
+	State        string `json:"state"` // idle, running, success, error
+	LastStarted  string `json:"last_started"`
+	LastFinished string `json:"last_finished"`
+	Message      string `json:"message"`
+	Sequences    int    `json:"sequences"`
+	Rendered     int    `json:"rendered"`
+	Failed       int    `json:"failed"`
+	Pending      int64  `json:"pending"`
+}
+
+type Assembler struct {
+	store     *db.Store
+	logger    *log.Logger
+	ffmpeg    string
+	frameRate int
+	minFrames int
+	libKey    *libcrypt.Key
+
+	runMu  sync.Mutex
+	mu     sync.Mutex
+	status Status
+}
+
+// New returns an assembler that renders sequences of at least minFrames
+// stills at frameRate frames per second.
+func New(store *db.Store, logger *log.Logger, ffmpeg string, frameRate, minFrames int) *Assembler {
+	return &Assembler{
+		store:     store,
+		logger:    logger,
+		ffmpeg:    ffmpeg,
+		frameRate: frameRate,
+		minFrames: minFrames,
+		status:    Status{Enabled: true, State: "idle", Message: "Waiting for first pass."},
+	}
+}
+
+// SetLibraryKey lets the assembler read encrypted stills. Videos are then
+// stored encrypted too.
+func (a *Assembler) SetLibraryKey(key *libcrypt.Key) {
+	a.libKey = key
+}
+
+func (a *Assembler) GetStatus(ctx context.Context) Status {
+	pending, _ := a.store.CountPendingTimelapses(ctx)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st := a.status
+	st.Pending = pending
+	return st
+}
+
+// RunOnce detects sequences afresh and renders those without a current
+// video. A sequence that ffmpeg cannot render is marked failed and left
+// until its frames change or it is retried; an interrupted render is
+// picked up on the next pass.
+func (a *Assembler) RunOnce(ctx context.Context) error {
+	if !a.runMu.TryLock() {
+		return ErrBusy
+	}
+	defer a.runMu.Unlock()
+
+	a.mu.Lock()
+	a.status.State = "running"
+	a.status.LastStarted = time.Now().UTC().Format(time.RFC3339)
+	a.status.Message = "Looking for sequences..."
+	a.mu.Unlock()
+
+	sequences, rendered, failed, err := a.run(ctx)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status.LastFinished = time.Now().UTC().Format(time.RFC3339)
+	a.status.Rendered += rendered
+	a.status.Failed += failed
+	if err != nil {
+		a.status.State = "error"
+		a.status.Message = err.Error()
+		return err
+	}
+	a.status.Sequences = sequences
+	a.status.State = "success"
+	a.status.Message = fmt.Sprintf("Found %d sequences; rendered %d.", sequences, rendered)
+	return nil
+}
+
+func (a *Assembler) run(ctx context.Context) (sequences, rendered, failed int, err error) {
+	base, _, err := a.store.GetSetting(ctx, baseStorageSetting)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if base == "" {
+		return 0, 0, 0, errors.New("base storage is not set")
+	}
+	candidates, err := a.store.ListTimelapseCandidates(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	found := Detect(candidates, a.minFrames)
+	specs := make([]db.TimelapseSpec, len(found))
+	for i, seq := range found {
+		specs[i] = db.TimelapseSpec{
+			MediaIDs:    seq.MediaIDs,
+			StartTime:   seq.Start.UTC().Format(time.RFC3339),
+			EndTime:     seq.End.UTC().Format(time.RFC3339),
+			IntervalSec: seq.Interval.Seconds(),
+		}
+	}
+	_, _, _, stale, err := a.store.SyncTimelapses(ctx, specs)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for _, p := range stale {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			a.logger.Printf("timelapse: remove stale video: %v", err)
+		}
+	}
+
+	pending, err := a.store.ListPendingTimelapses(ctx)
+	if err != nil {
+		return len(found), 0, 0, err
+	}
+	for _, tl := range pending {
+		a.mu.Lock()
+		a.status.Message = fmt.Sprintf("Rendering %d frames...", tl.FrameCount)
+		a.mu.Unlock()
+
+		videoPath, size, err := a.render(ctx, base, tl.ID)
+		if ctx.Err() != nil {
+			return len(found), rendered, failed, ctx.Err()
+		}
+		if err != nil {
+			a.logger.Printf("timelapse %d: %v", tl.ID, err)
+			if err := a.store.RecordTimelapseRender(ctx, tl.ID, "", 0, err.Error()); err != nil {
+				return len(found), rendered, failed, err
+			}
+			failed++
+			continue
+		}
+		if err := a.store.RecordTimelapseRender(ctx, tl.ID, videoPath, size, ""); err != nil {
+			return len(found), rendered, failed, err
+		}
+		rendered++
+	}
+	return len(found), rendered, failed, nil
+}
+
+// VideoPath is where the video of sequence id is kept.
+func VideoPath(baseStorage string, id int64) string {
+	return filepath.Join(config.WorkAreaDir(baseStorage, config.WorkAreaProxies), "timelapse", strconv.FormatInt(id, 10)+".mp4")
+}
+
+// render encodes a sequence's frames with ffmpeg. The stills are decoded
+// here rather than by ffmpeg, so encrypted and RAW frames work, and fed to
+// it as JPEGs on stdin. Frames that cannot be decoded are left out.
+func (a *Assembler) render(ctx context.Context, base string, id int64) (string, int64, error) {
+	frames, err := a.store.ListTimelapseFrames(ctx, id)
+	if err != nil {
+		return "", 0, err
+	}
+	dest := VideoPath(base, id)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o750); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".render-*.mp4")
+	if err != nil {
+		return "", 0, err
+	}
+	tmpPath := tmp.Name()
+	_ = tmp.Close()
+	defer os.Remove(tmpPath)
+
+	var (
+		cmd     *exec.Cmd
+		stdin   io.WriteCloser
+		stderr  bytes.Buffer
+		written int
+		skipped int
+	)
+	for _, f := range frames {
+		if err := ctx.Err(); err != nil {
+			break
+		}
+		img, err := a.loadFrame(f)
+		if err != nil {
+			skipped++
+			continue
+		}
+		if cmd == nil {
+			// The first frame sets the size; the rest are fitted into it.
+			b := img.Bounds()
+			cmd = a.encoder(ctx, b.Dx()&^1, b.Dy()&^1, tmpPath)
+			cmd.Stderr = &stderr
+			if stdin, err = cmd.StdinPipe(); err != nil {
+				return "", 0, err
+			}
+			if err := cmd.Start(); err != nil {
+				return "", 0, fmt.Errorf("ffmpeg: %w", err)
+			}
+		}
+		if err := jpeg.Encode(stdin, img, &jpeg.Options{Quality: frameQuality}); err != nil {
+			break // ffmpeg has quit; Wait says why
+		}
+		written++
+	}
+	if cmd == nil {
+		return "", 0, fmt.Errorf("none of the %d frames could be decoded", len(frames))
+	}
+	_ = stdin.Close()
+	waitErr := cmd.Wait()
+	if err := ctx.Err(); err != nil {
+		return "", 0, err // the video stops short
+	}
+	if waitErr != nil {
+		return "", 0, ffmpegError(waitErr, stderr.String())
+	}
+	if skipped > 0 {
+		a.logger.Printf("timelapse %d: left out %d frames that could not be decoded", id, skipped)
+	}
+	if written < a.minFrames {
+		return "", 0, fmt.Errorf("only %d of %d frames could be decoded", written, len(frames))
+	}
+	return a.keep(tmpPath, dest)
+}
+
+// encoder is ffmpeg reading JPEG frames on stdin and writing an H.264 MP4
+// that browsers play and can start before it has fully loaded.
+func (a *Assembler) encoder(ctx context.Context, width, height int, out string) *exec.Cmd {
+	fit := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1",
+		width, height, width, height)
+	return exec.CommandContext(ctx, a.ffmpeg, "-hide_banner", "-loglevel", "error", "-y",
+		"-f", "image2pipe", "-c:v", "mjpeg", "-framerate", strconv.Itoa(a.frameRate), "-i", "pipe:0",
+		"-vf", fit, "-c:v", "libx264", "-crf", "20", "-pix_fmt", "yuv420p",
+		"-movflags", "+faststart", "-f", "mp4", "file:"+out)
+}
+
+func (a *Assembler) loadFrame(f db.TimelapseFrame) (*image.RGBA, error) {
+	src, err := a.openLibraryFile(f.DestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	img, err := media.DecodeThumbnailSource(src, f.Extension)
+	if err != nil {
+		return nil, err
+	}
+	return media.ResizeToFit(img, frameMaxDimension), nil
+}
+
+func (a *Assembler) openLibraryFile(path string) (io.ReadSeekCloser, error) {
+	return storage.OpenPlain(context.Background(), storage.NewLocal(), a.libKey, path)
+}
+
+// keep moves a rendered video into place, encrypting it on the way when
+// library encryption is on.
+func (a *Assembler) keep(tmpPath, dest string) (string, int64, error) {
+	if a.libKey == nil {
+		if err := os.Rename(tmpPath, dest); err != nil {
+			return "", 0, err
+		}
+		info, err := os.Stat(dest)
+		if err != nil {
+			return "", 0, err
+		}
+		return dest, info.Size(), nil
+	}
+	src, err := os.Open(tmpPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	enc, err := os.CreateTemp(filepath.Dir(dest), ".render-*.enc")
+	if err != nil {
+		return "", 0, err
+	}
+	if err := a.libKey.Encrypt(enc, src, info.Size()); err != nil {
+		_ = enc.Close()
+		_ = os.Remove(enc.Name())
+		return "", 0, err
+	}
+	if err := enc.Close(); err != nil {
+		_ = os.Remove(enc.Name())
+		return "", 0, err
+	}
+	if err := os.Rename(enc.Name(), dest); err != nil {
+		_ = os.Remove(enc.Name())
+		return "", 0, err
+	}
+	return dest, info.Size(), nil
+}
+
+func ffmpegError(err error, stderr string) error {
+	if len(stderr) > stderrMax {
+		stderr = stderr[len(stderr)-stderrMax:]
+	}
+	if lines := strings.Split(strings.TrimSpace(stderr), "\n"); len(lines) > 0 && lines[len(lines)-1] != "" {
+		return fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+	}
+	return fmt.Errorf("ffmpeg: %w", err)
+}
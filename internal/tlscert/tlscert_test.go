@@ -0,0 +1,59 @@
+package tlscert
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadOrCreateSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls", "cert.pem")
+	keyPath := filepath.Join(dir, "tls", "key.pem")
+
+	cert, created, err := LoadOrCreate(certPath, keyPath, []string{"localhost", "127.0.0.1", "[::1]", "0.0.0.0", "vault.lan"})
+	if err != nil || !created {
+		t.Fatalf("LoadOrCreate = created %v, %v", created, err)
+	}
+	if info, err := os.Stat(keyPath); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file = %v, %v", info, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parse leaf: %v", err)
+	}
+	if err := leaf.VerifyHostname("vault.lan"); err != nil {
+		t.Fatalf("VerifyHostname(vault.lan): %v", err)
+	}
+	if err := leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Fatalf("VerifyHostname(127.0.0.1): %v", err)
+	}
+	if len(leaf.IPAddresses) != 2 {
+		t.Fatalf("ip SANs = %v, want loopback only", leaf.IPAddresses)
+	}
+
+	again, created, err := LoadOrCreate(certPath, keyPath, nil)
+	if err != nil || created {
+		t.Fatalf("reload = created %v, %v", created, err)
+	}
+	if Fingerprint(again) != Fingerprint(cert) {
+		t.Fatalf("reloaded fingerprint %s, want %s", Fingerprint(again), Fingerprint(cert))
+	}
+	if fp := Fingerprint(cert); len(fp) != 95 || strings.Count(fp, ":") != 31 {
+		t.Fatalf("fingerprint = %q", fp)
+	}
+}
+
+func TestLoadOrCreateRefusesHalfPair(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(keyPath, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadOrCreate(certPath, keyPath, nil); err == nil {
+		t.Fatal("a lone key file should not be replaced by a new certificate")
+	}
+}
@@ -0,0 +1,7 @@
+package usb
+
+import "errors"
+
+// ErrEjectUnsupported is returned by Eject where the vault cannot unmount
+// volumes itself.
+var ErrEjectUnsupported = errors.New("ejecting volumes is not supported on this platform")
@@ -0,0 +1,21 @@
+//go:build darwin
+// +build darwin
+
+package usb
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Eject unmounts the volume at mountPoint and ejects its disk so the card
+// can be pulled.
+func Eject(ctx context.Context, mountPoint string) error {
+	out, err := exec.CommandContext(ctx, "diskutil", "eject", mountPoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("diskutil eject: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
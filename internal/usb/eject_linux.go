@@ -0,0 +1,56 @@
+//go:build linux
+// +build linux
+
+package usb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Eject unmounts the volume at mountPoint so the card can be pulled. It
+// asks udisks first, which lets the service user unmount what the desktop
+// automounted, and falls back to umount for fstab entries marked user.
+func Eject(ctx context.Context, mountPoint string) error {
+	mountPoint = filepath.Clean(mountPoint)
+	if dev := mountSource(mountPoint); strings.HasPrefix(dev, "/dev/") {
+		if _, err := exec.LookPath("udisksctl"); err == nil {
+			cmd := exec.CommandContext(ctx, "udisksctl", "unmount", "--no-user-interaction", "--block-device", dev)
+			if cmd.Run() == nil {
+				return nil
+			}
+		}
+	}
+	out, err := exec.CommandContext(ctx, "umount", mountPoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("umount: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// mountSource returns the device mounted exactly at mountPoint, or "".
+func mountSource(mountPoint string) string {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	source := ""
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		mp, _, _, ok := parseMountInfo(sc.Text())
+		if !ok || mp != mountPoint {
+			continue
+		}
+		_, post, _ := strings.Cut(sc.Text(), " - ")
+		if tail := strings.Fields(post); len(tail) >= 2 {
+			source = tail[1] // the last mount on a point is the visible one
+		}
+	}
+	return source
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package usb
+
+import "context"
+
+// Eject is not available here; use the operating system's own eject.
+func Eject(ctx context.Context, mountPoint string) error {
+	return ErrEjectUnsupported
+}
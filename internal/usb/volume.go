@@ -0,0 +1,53 @@
+package usb
+
+import (
+	"strings"
+	"time"
+)
+
+// Volume describes the filesystem a card is mounted with, as far as it
+// matters for reading file times.
+type Volume struct {
+	FSType string
+	// ReadZone is the zone the operating system assumes for the zoneless
+	// local times FAT and exFAT store. Nil for other filesystems.
+	ReadZone *time.Location
+}
+
+// LocalTimes reports whether the volume stores file times as local wall
+// clock time with no zone, as FAT and (usually) exFAT do.
+func (v Volume) LocalTimes() bool {
+	return v.ReadZone != nil
+}
+
+// Precision is the resolution of modification times on the volume.
+func (v Volume) Precision() time.Duration {
+	if isFAT(v.FSType) {
+		return 2 * time.Second
+	}
+	return 0
+}
+
+func isFAT(fstype string) bool {
+	switch strings.ToLower(fstype) {
+	case "vfat", "msdos", "fat", "fat16", "fat32":
+		return true
+	}
+	return false
+}
+
+func isFATOrExFAT(fstype string) bool {
+	return isFAT(fstype) || strings.EqualFold(fstype, "exfat")
+}
+
+// RecordedWallClock reinterprets t, a modification time read from v, as the
+// wall clock time a camera in zone card wrote, undoing the zone the
+// operating system assumed. It returns t unchanged for volumes that store
+// real instants.
+func (v Volume) RecordedWallClock(t time.Time, card *time.Location) time.Time {
+	if !v.LocalTimes() || card == nil {
+		return t
+	}
+	w := t.In(v.ReadZone)
+	return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), card)
+}
@@ -0,0 +1,30 @@
+//go:build darwin
+// +build darwin
+
+package usb
+
+import (
+	"syscall"
+	"time"
+)
+
+// VolumeOf reports the filesystem holding path. macOS reads FAT and exFAT
+// times in the Mac's own zone.
+func VolumeOf(path string) (Volume, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Volume{}, err
+	}
+	var name []byte
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	vol := Volume{FSType: string(name)}
+	if isFATOrExFAT(vol.FSType) {
+		vol.ReadZone = time.Local
+	}
+	return vol, nil
+}
@@ -0,0 +1,99 @@
+//go:build linux
+// +build linux
+
+package usb
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VolumeOf finds the mount holding path in /proc/self/mountinfo. The vfat
+// and exfat drivers read local times as UTC unless mounted with tz= or
+// time_offset=; the kernel's own timezone is almost always UTC as well.
+func VolumeOf(path string) (Volume, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return Volume{}, err
+	}
+	defer f.Close()
+
+	path = filepath.Clean(path)
+	var best string
+	var vol Volume
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		mountPoint, fstype, opts, ok := parseMountInfo(sc.Text())
+		if !ok || !withinMount(path, mountPoint) || len(mountPoint) < len(best) {
+			continue
+		}
+		best = mountPoint
+		vol = Volume{FSType: fstype}
+		if isFATOrExFAT(fstype) {
+			vol.ReadZone = linuxReadZone(opts)
+		}
+	}
+	return vol, sc.Err()
+}
+
+// parseMountInfo splits one mountinfo line: the mount point is field 5,
+// and the filesystem type and super options follow the " - " separator.
+func parseMountInfo(line string) (mountPoint, fstype, opts string, ok bool) {
+	pre, post, found := strings.Cut(line, " - ")
+	if !found {
+		return "", "", "", false
+	}
+	fields, tail := strings.Fields(pre), strings.Fields(post)
+	if len(fields) < 5 || len(tail) < 3 {
+		return "", "", "", false
+	}
+	return unescapeMountPath(fields[4]), tail[0], tail[2], true
+}
+
+// unescapeMountPath undoes the octal escapes (\040 for a space) the kernel
+// writes into mount paths.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func withinMount(path, mountPoint string) bool {
+	if mountPoint == "/" || path == mountPoint {
+		return true
+	}
+	return strings.HasPrefix(path, mountPoint+"/")
+}
+
+func linuxReadZone(opts string) *time.Location {
+	for _, opt := range strings.Split(opts, ",") {
+		key, val, _ := strings.Cut(opt, "=")
+		switch key {
+		case "tz":
+			if val == "UTC" {
+				return time.UTC
+			}
+		case "time_offset":
+			if minutes, err := strconv.Atoi(val); err == nil {
+				return time.FixedZone("time_offset", minutes*60)
+			}
+		}
+	}
+	return time.UTC
+}
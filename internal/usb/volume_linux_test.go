@@ -0,0 +1,23 @@
+package usb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	line := `41 28 8:17 / /media/pi/EOS\040DIGITAL rw,nosuid,nodev,relatime shared:25 - vfat /dev/sdb1 rw,uid=1000,fmask=0022,codepage=437,iocharset=ascii,shortname=mixed,time_offset=120,errors=remount-ro`
+	mountPoint, fstype, opts, ok := parseMountInfo(line)
+	if !ok || mountPoint != "/media/pi/EOS DIGITAL" || fstype != "vfat" {
+		t.Fatalf("parseMountInfo = %q, %q, %v", mountPoint, fstype, ok)
+	}
+	if _, offset := time.Now().In(linuxReadZone(opts)).Zone(); offset != 120*60 {
+		t.Errorf("time_offset zone = %d seconds", offset)
+	}
+	if linuxReadZone("rw,tz=UTC") != time.UTC || linuxReadZone("rw") != time.UTC {
+		t.Error("default read zone is not UTC")
+	}
+	if !withinMount("/media/pi/EOS DIGITAL/DCIM", mountPoint) || withinMount("/media/pi/EOS DIGITAL2", mountPoint) {
+		t.Error("withinMount matched the wrong paths")
+	}
+}
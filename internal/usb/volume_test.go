@@ -0,0 +1,29 @@
+package usb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordedWallClock(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A camera in Berlin wrote 14:30 local; Linux read the digits as UTC.
+	read := time.Date(2026, 7, 4, 14, 30, 0, 0, time.UTC)
+	fat := Volume{FSType: "vfat", ReadZone: time.UTC}
+
+	got := fat.RecordedWallClock(read, berlin)
+	if want := time.Date(2026, 7, 4, 12, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("RecordedWallClock = %v, want %v", got.UTC(), want)
+	}
+	if fat.Precision() != 2*time.Second {
+		t.Errorf("vfat precision = %v", fat.Precision())
+	}
+
+	ext4 := Volume{FSType: "ext4"}
+	if got := ext4.RecordedWallClock(read, berlin); !got.Equal(read) {
+		t.Errorf("ext4 time changed to %v", got)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build windows
+// +build windows
+
+package usb
+
+import (
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var procGetVolumeInformation = syscall.NewLazyDLL("kernel32.dll").NewProc("GetVolumeInformationW")
+
+// VolumeOf reports the filesystem of the drive holding path. Windows reads
+// FAT and exFAT times in the PC's own zone.
+func VolumeOf(path string) (Volume, error) {
+	root, err := syscall.UTF16PtrFromString(filepath.VolumeName(path) + `\`)
+	if err != nil {
+		return Volume{}, err
+	}
+	var fsName [32]uint16
+	r, _, err := procGetVolumeInformation.Call(
+		uintptr(unsafe.Pointer(root)),
+		0, 0, 0, 0, 0,
+		uintptr(unsafe.Pointer(&fsName[0])),
+		uintptr(len(fsName)),
+	)
+	if r == 0 {
+		return Volume{}, err
+	}
+	vol := Volume{FSType: syscall.UTF16ToString(fsName[:])}
+	if isFATOrExFAT(vol.FSType) {
+		vol.ReadZone = time.Local
+	}
+	return vol, nil
+}
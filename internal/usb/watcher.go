@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"businessplan/usbvault/internal/config"
@@ -15,33 +16,40 @@ import (
 
 type Watcher struct {
 	logger   *log.Logger
-	interval time.Duration
+	interval atomic.Int64 // time.Duration
 	roots    []string
 	seen     map[string]time.Time
 	onNew    func(string)
 }
 
 func NewWatcher(interval time.Duration, logger *log.Logger, onNew func(string)) *Watcher {
-	return &Watcher{
-		logger:   logger,
-		interval: interval,
-		roots:    config.MountRoots(),
-		seen:     map[string]time.Time{},
-		onNew:    onNew,
+	w := &Watcher{
+		logger: logger,
+		roots:  config.MountRoots(),
+		seen:   map[string]time.Time{},
+		onNew:  onNew,
 	}
+	w.SetInterval(interval)
+	return w
+}
+
+// SetInterval changes the polling interval from the next poll on.
+func (w *Watcher) SetInterval(interval time.Duration) {
+	w.interval.Store(int64(interval))
 }
 
 func (w *Watcher) Start(ctx context.Context) {
 	w.tick(ctx)
-	ticker := time.NewTicker(w.interval)
+	timer := time.NewTimer(time.Duration(w.interval.Load()))
 	go func() {
-		defer ticker.Stop()
+		defer timer.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-ticker.C:
+			case <-timer.C:
 				w.tick(ctx)
+				timer.Reset(time.Duration(w.interval.Load()))
 			}
 		}
 	}()
@@ -0,0 +1,145 @@
+// Package vision runs local model commands over library images. A command
+// receives one JPEG on stdin and prints a JSON result (or plain text, for
+// OCR) on stdout, so any on-device runtime (ONNX, TFLite, tesseract, a vendor
+// SDK) can be wrapped in a small script. Nothing leaves the machine.
+package vision
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"businessplan/usbvault/internal/libcrypt"
+	"businessplan/usbvault/internal/media"
+	"businessplan/usbvault/internal/storage"
+)
+
+// InputMaxDimension bounds the images handed to model commands. Detection
+// models work on far smaller inputs, and this keeps the pipe cheap.
+const InputMaxDimension = 1280
+
+// TextMaxDimension bounds images handed to OCR commands, which need small
+// print such as serial numbers to survive the downscale.
+const TextMaxDimension = 2560
+
+const maxOutputBytes = 4 << 20
+
+// ErrUndecodable marks files the pipeline cannot turn into pixels, such as
+// RAW and HEIC. Callers record them as skipped rather than retrying.
+var ErrUndecodable = errors.New("image cannot be decoded for analysis")
+
+// Load reads a library file, decrypting it with key when it was stored
+// encrypted, and prepares it for a model command. Missing files, and files
+// kept in remote storage, count as undecodable.
+func Load(key *libcrypt.Key, path, ext string) (*image.RGBA, error) {
+	return LoadScaled(key, path, ext, InputMaxDimension)
+}
+
+// LoadScaled is Load with a different bound on the longest side.
+func LoadScaled(key *libcrypt.Key, path, ext string, maxDim int) (*image.RGBA, error) {
+	if !media.CanDecodeImage(ext) {
+		return nil, ErrUndecodable
+	}
+	if !storage.IsLocal(path) {
+		return nil, fmt.Errorf("%w: file is in remote storage", ErrUndecodable)
+	}
+	src, err := storage.OpenPlain(context.Background(), storage.NewLocal(), key, path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: file is missing", ErrUndecodable)
+		}
+		return nil, err
+	}
+	defer src.Close()
+	return Prepare(ext, src, maxDim)
+}
+
+// Prepare decodes an image, applies its EXIF orientation, and scales it to
+// fit maxDim.
+func Prepare(ext string, src io.ReadSeeker, maxDim int) (*image.RGBA, error) {
+	if !media.CanDecodeImage(ext) {
+		return nil, ErrUndecodable
+	}
+	img, err := media.DecodeImage(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUndecodable, err)
+	}
+	return media.ResizeToFit(img, maxDim), nil
+}
+
+// Run sends img to command and decodes its JSON output into out.
+func Run(ctx context.Context, command string, timeout time.Duration, img image.Image, out any) error {
+	stdout, err := run(ctx, command, timeout, img)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(stdout, out); err != nil {
+		return fmt.Errorf("%s: invalid output: %w", command, err)
+	}
+	return nil
+}
+
+// RunText sends img to command and returns its output as text, trimmed of
+// surrounding whitespace. Invalid UTF-8 is replaced.
+func RunText(ctx context.Context, command string, timeout time.Duration, img image.Image) (string, error) {
+	stdout, err := run(ctx, command, timeout, img)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.ToValidUTF8(string(stdout), "\uFFFD")), nil
+}
+
+func run(ctx context.Context, command string, timeout time.Duration, img image.Image) ([]byte, error) {
+	var input bytes.Buffer
+	if err := jpeg.Encode(&input, img, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command)
+	cmd.Stdin = &input
+	stdout := &limitedBuffer{max: maxOutputBytes}
+	stderr := &limitedBuffer{max: 4096}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s: timed out after %s", command, timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", command, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", command, err)
+	}
+	if stdout.overflow {
+		return nil, fmt.Errorf("%s: output exceeds %d bytes", command, maxOutputBytes)
+	}
+	return stdout.Bytes(), nil
+}
+
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.overflow = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
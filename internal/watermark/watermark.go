@@ -0,0 +1,240 @@
+// Package watermark stamps review copies of images with a line of text or a
+// PNG overlay, so proofs handed to clients are not clean deliverables.
+package watermark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"businessplan/usbvault/internal/media"
+)
+
+const (
+	PositionCenter      = "center"
+	PositionBottomRight = "bottom-right"
+	PositionTile        = "tile"
+)
+
+const (
+	maxTextLen       = 64
+	maxOverlayPixels = 16_000_000
+	defaultOpacity   = 0.35
+)
+
+var ErrOverlayNotFound = errors.New("watermark overlay not found")
+
+var overlayNameRx = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,39}$`)
+
+// Spec configures a watermark. Exactly one of Text and Overlay is set;
+// Overlay names a PNG in the watermarks directory. Scale is the stamp's
+// width as a fraction of the image width.
+type Spec struct {
+	Text     string  `json:"text,omitempty"`
+	Overlay  string  `json:"overlay,omitempty"`
+	Opacity  float64 `json:"opacity,omitempty"`
+	Position string  `json:"position,omitempty"`
+	Scale    float64 `json:"scale,omitempty"`
+}
+
+// Default is the watermark used by proof presets that do not set their own.
+func Default() Spec {
+	s, _ := Spec{Text: "PROOF"}.Normalize()
+	return s
+}
+
+// Normalize fills defaults and checks ranges.
+func (s Spec) Normalize() (Spec, error) {
+	s.Text = strings.TrimSpace(s.Text)
+	s.Overlay = strings.ToLower(strings.TrimSpace(s.Overlay))
+	s.Position = strings.ToLower(strings.TrimSpace(s.Position))
+	switch {
+	case s.Text == "" && s.Overlay == "":
+		return s, errors.New("watermark needs text or an overlay")
+	case s.Text != "" && s.Overlay != "":
+		return s, errors.New("watermark takes text or an overlay, not both")
+	case len([]rune(s.Text)) > maxTextLen:
+		return s, fmt.Errorf("watermark text must be at most %d characters", maxTextLen)
+	case s.Overlay != "" && !ValidOverlayName(s.Overlay):
+		return s, fmt.Errorf("invalid watermark overlay name %q", s.Overlay)
+	}
+	if s.Opacity == 0 {
+		s.Opacity = defaultOpacity
+	}
+	if s.Opacity < 0.05 || s.Opacity > 1 {
+		return s, errors.New("watermark opacity must be 0.05-1")
+	}
+	switch s.Position {
+	case "":
+		s.Position = PositionCenter
+	case PositionCenter, PositionBottomRight, PositionTile:
+	default:
+		return s, fmt.Errorf("watermark position must be %s, %s, or %s", PositionCenter, PositionBottomRight, PositionTile)
+	}
+	if s.Scale == 0 {
+		s.Scale = 0.5
+		if s.Position != PositionCenter {
+			s.Scale = 0.25
+		}
+	}
+	if s.Scale < 0.05 || s.Scale > 1 {
+		return s, errors.New("watermark scale must be 0.05-1")
+	}
+	return s, nil
+}
+
+// Parse reads a stored watermark. An empty value means none and returns nil.
+func Parse(raw string) (*Spec, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var s Spec
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return nil, fmt.Errorf("invalid watermark: %w", err)
+	}
+	s, err := s.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ValidOverlayName reports whether name can be used for an overlay file.
+func ValidOverlayName(name string) bool {
+	return overlayNameRx.MatchString(name)
+}
+
+// OverlayPath is where the overlay called name is stored in dir.
+func OverlayPath(dir, name string) string {
+	return filepath.Join(dir, name+".png")
+}
+
+// ListOverlays returns the names of the PNG overlays in dir.
+func ListOverlays(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	out := make([]string, 0, len(entries))
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".png")
+		if ok && !e.IsDir() && ValidOverlayName(name) {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+// DecodeOverlay reads a PNG overlay, refusing ones too large to stamp.
+func DecodeOverlay(r io.ReadSeeker) (*image.RGBA, error) {
+	cfg, err := png.DecodeConfig(r)
+	if err != nil {
+		return nil, fmt.Errorf("overlay must be a PNG: %w", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxOverlayPixels {
+		return nil, errors.New("overlay image is too large")
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, err := png.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("overlay must be a PNG: %w", err)
+	}
+	out := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(out, out.Bounds(), src, src.Bounds().Min, draw.Src)
+	return out, nil
+}
+
+// Mark is a Spec ready to apply, with any overlay already decoded.
+type Mark struct {
+	spec    Spec
+	overlay *image.RGBA
+}
+
+// Load prepares spec, reading its overlay from dir.
+func Load(spec Spec, dir string) (*Mark, error) {
+	spec, err := spec.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	m := &Mark{spec: spec}
+	if spec.Overlay == "" {
+		return m, nil
+	}
+	f, err := os.Open(OverlayPath(dir, spec.Overlay))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrOverlayNotFound, spec.Overlay)
+		}
+		return nil, err
+	}
+	defer f.Close()
+	if m.overlay, err = DecodeOverlay(f); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Apply stamps img in place.
+func (m *Mark) Apply(img *image.RGBA) {
+	b := img.Bounds()
+	stamp := m.stamp(max(1, int(math.Round(float64(b.Dx())*m.spec.Scale))))
+	sw, sh := stamp.Bounds().Dx(), stamp.Bounds().Dy()
+	alpha := image.NewUniform(color.Alpha{A: uint8(math.Round(m.spec.Opacity * 255))})
+	at := func(x, y int) {
+		r := image.Rect(x, y, x+sw, y+sh)
+		draw.DrawMask(img, r, stamp, image.Point{}, alpha, image.Point{}, draw.Over)
+	}
+	switch m.spec.Position {
+	case PositionBottomRight:
+		margin := max(sh/2, b.Dx()/50)
+		at(b.Max.X-sw-margin, b.Max.Y-sh-margin)
+	case PositionTile:
+		stepX, stepY := sw+sw/2, sh*3
+		for row, y := 0, b.Min.Y+sh; y < b.Max.Y; row, y = row+1, y+stepY {
+			x := b.Min.X - (row%2)*stepX/2
+			for ; x < b.Max.X; x += stepX {
+				at(x, y)
+			}
+		}
+	default:
+		at(b.Min.X+(b.Dx()-sw)/2, b.Min.Y+(b.Dy()-sh)/2)
+	}
+}
+
+// stamp renders the watermark about width pixels wide. Text is drawn at an
+// integer multiple of the font size so it stays sharp, white with a dark
+// outline so it reads on light and dark images alike.
+func (m *Mark) stamp(width int) *image.RGBA {
+	if m.overlay != nil {
+		ow, oh := m.overlay.Bounds().Dx(), m.overlay.Bounds().Dy()
+		h := max(1, int(math.Round(float64(oh)*float64(width)/float64(ow))))
+		return media.Resize(m.overlay, width, h)
+	}
+	cells, cw, ch := textMask(m.spec.Text)
+	k := max(1, width/cw)
+	out := image.NewRGBA(image.Rect(0, 0, cw*k, ch*k))
+	fill := [3]color.RGBA{{}, {A: 200}, {R: 255, G: 255, B: 255, A: 255}}
+	for y, row := range cells {
+		for x, c := range row {
+			if c != 0 {
+				draw.Draw(out, image.Rect(x*k, y*k, (x+1)*k, (y+1)*k), image.NewUniform(fill[c]), image.Point{}, draw.Src)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func fill(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func changed(img *image.RGBA, r image.Rectangle, base color.RGBA) int {
+	n := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if img.RGBAAt(x, y) != base {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	s, err := Spec{Text: " Proof ", Position: "Bottom-Right"}.Normalize()
+	if err != nil {
+		t.Fatalf("Normalize: %v", err)
+	}
+	if s.Text != "Proof" || s.Position != PositionBottomRight || s.Opacity != defaultOpacity || s.Scale != 0.25 {
+		t.Fatalf("normalized = %+v", s)
+	}
+	for _, bad := range []Spec{
+		{},
+		{Text: "a", Overlay: "logo"},
+		{Overlay: "../logo"},
+		{Text: "a", Opacity: 2},
+		{Text: "a", Position: "top"},
+		{Text: "a", Scale: -1},
+	} {
+		if _, err := bad.Normalize(); err == nil {
+			t.Errorf("Normalize(%+v) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestApplyTextPositions(t *testing.T) {
+	t.Parallel()
+
+	base := color.RGBA{R: 30, G: 120, B: 30, A: 255}
+	center, err := Load(Spec{Text: "PROOF"}, "")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	img := fill(400, 300, base)
+	center.Apply(img)
+	if changed(img, image.Rect(150, 130, 250, 170), base) == 0 {
+		t.Fatal("center watermark did not touch the middle of the image")
+	}
+	if changed(img, image.Rect(0, 0, 40, 40), base) != 0 {
+		t.Fatal("center watermark touched the corner")
+	}
+
+	corner, err := Load(Spec{Text: "(c) 2024", Position: PositionBottomRight}, "")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	img = fill(400, 300, base)
+	corner.Apply(img)
+	if changed(img, image.Rect(200, 200, 400, 300), base) == 0 || changed(img, image.Rect(0, 0, 200, 150), base) != 0 {
+		t.Fatal("bottom-right watermark landed in the wrong place")
+	}
+
+	tiled, err := Load(Spec{Text: "X", Position: PositionTile, Scale: 0.1}, "")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	img = fill(400, 300, base)
+	tiled.Apply(img)
+	for _, q := range []image.Rectangle{image.Rect(0, 0, 200, 150), image.Rect(200, 150, 400, 300)} {
+		if changed(img, q, base) == 0 {
+			t.Fatalf("tiled watermark missed quadrant %v", q)
+		}
+	}
+}
+
+func TestOverlayFromDirectory(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if _, err := Load(Spec{Overlay: "logo"}, dir); err == nil {
+		t.Fatal("Load with missing overlay succeeded")
+	}
+	f, err := os.Create(filepath.Join(dir, "logo.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, fill(20, 10, color.RGBA{R: 255, A: 255})); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	names, err := ListOverlays(dir)
+	if err != nil || len(names) != 1 || names[0] != "logo" {
+		t.Fatalf("ListOverlays = %v, %v", names, err)
+	}
+	mark, err := Load(Spec{Overlay: "logo", Opacity: 1}, dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	img := fill(200, 200, color.RGBA{B: 255, A: 255})
+	mark.Apply(img)
+	if got := img.RGBAAt(100, 100); got.R < 250 || got.B > 5 {
+		t.Fatalf("overlay centre pixel = %v, want red", got)
+	}
+}
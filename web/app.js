@@ -2,6 +2,7 @@ const setupCard = document.querySelector('#setupCard');
 const loginCard = document.querySelector('#loginCard');
 const dashboard = document.querySelector('#dashboard');
 const statusChip = document.querySelector('#statusChip');
+const presenceChip = document.querySelector('#presenceChip');
 const setupError = document.querySelector('#setupError');
 const loginError = document.querySelector('#loginError');
 const storageLabel = document.querySelector('#storageLabel');
@@ -35,6 +36,10 @@ const mapCitySelect = document.querySelector('#mapCitySelect');
 const mapFilterApplyBtn = document.querySelector('#mapFilterApplyBtn');
 const mapFilterResetBtn = document.querySelector('#mapFilterResetBtn');
 const mapPointsInfo = document.querySelector('#mapPointsInfo');
+const mapGapsBtn = document.querySelector('#mapGapsBtn');
+const mapBookmarkSelect = document.querySelector('#mapBookmarkSelect');
+const mapBookmarkSaveBtn = document.querySelector('#mapBookmarkSaveBtn');
+const mapBookmarkDeleteBtn = document.querySelector('#mapBookmarkDeleteBtn');
 
 const setupForm = document.querySelector('#setupForm');
 const loginForm = document.querySelector('#loginForm');
@@ -49,8 +54,11 @@ const uploadMediaInput = document.querySelector('#uploadMediaInput');
 const selectAllBtn = document.querySelector('#selectAllBtn');
 const clearSelectionBtn = document.querySelector('#clearSelectionBtn');
 const deleteSelectedBtn = document.querySelector('#deleteSelectedBtn');
+const editSelectedBtn = document.querySelector('#editSelectedBtn');
+const trashBtn = document.querySelector('#trashBtn');
 const downloadSelectedFilesBtn = document.querySelector('#downloadSelectedFilesBtn');
 const downloadSelectedZipBtn = document.querySelector('#downloadSelectedZipBtn');
+const exportPresetSelect = document.querySelector('#exportPresetSelect');
 const deleteCurrentBtn = document.querySelector('#deleteCurrentBtn');
 const downloadCurrentBtn = document.querySelector('#downloadCurrentBtn');
 const backupForm = document.querySelector('#backupForm');
@@ -60,10 +68,14 @@ const backupSSHPort = document.querySelector('#backupSSHPort');
 const backupAPIMethod = document.querySelector('#backupAPIMethod');
 const backupAPIToken = document.querySelector('#backupAPIToken');
 const backupStatus = document.querySelector('#backupStatus');
+const pairingForm = document.querySelector('#pairingForm');
+const pairingQR = document.querySelector('#pairingQR');
+const pairingStatus = document.querySelector('#pairingStatus');
 const textFilterInput = document.querySelector('#textFilterInput');
 const kindFilterSelect = document.querySelector('#kindFilterSelect');
 const deviceFilterSelect = document.querySelector('#deviceFilterSelect');
 const gpsFilterSelect = document.querySelector('#gpsFilterSelect');
+const ratingFilterSelect = document.querySelector('#ratingFilterSelect');
 const captureFromInput = document.querySelector('#captureFromInput');
 const captureToInput = document.querySelector('#captureToInput');
 const applyMediaFilterBtn = document.querySelector('#applyMediaFilterBtn');
@@ -80,7 +92,10 @@ const albumList = document.querySelector('#albumList');
 const autoAlbumStateList = document.querySelector('#autoAlbumStateList');
 const newAlbumNameInput = document.querySelector('#newAlbumNameInput');
 const createAlbumBtn = document.querySelector('#createAlbumBtn');
+const createSmartAlbumBtn = document.querySelector('#createSmartAlbumBtn');
 const openAlbumFolderBtn = document.querySelector('#openAlbumFolderBtn');
+const renameAlbumBtn = document.querySelector('#renameAlbumBtn');
+const deleteAlbumBtn = document.querySelector('#deleteAlbumBtn');
 const addSelectedToAlbumBtn = document.querySelector('#addSelectedToAlbumBtn');
 const removeSelectedFromAlbumBtn = document.querySelector('#removeSelectedFromAlbumBtn');
 
@@ -88,7 +103,15 @@ let map;
 let mapLayer;
 let mapFull;
 let mapFullLayer;
+// Tile source from /api/status; the server's CSP allows only this origin.
+let mapTiles = { url: 'https://tile.openstreetmap.org/{z}/{x}/{y}.png', attribution: '&copy; OpenStreetMap contributors' };
 let lastPoints = [];
+// Past this many pins the maps draw server-side clusters for the visible
+// area instead, which stay readable however large the library is.
+const clusterThreshold = 2000;
+let clustered = false;
+const clusterState = new Map(); // Leaflet map -> { layer, seq }
+let gapsLayer = null;
 let ingestPoller;
 let ingestStatusRequest = null;
 let backupStatusRequest = null;
@@ -108,10 +131,15 @@ let selectedIDs = new Set();
 let currentPreviewID = null;
 let viewMode = 'all';
 let albums = [];
+let mapBookmarks = [];
 let activeAlbumID = 0;
 let mapStates = [];
 let mapCities = [];
 let deviceGroups = [];
+let heartbeatTimer;
+// ETags of what was last read, by URL. Saves send them back as If-Match so
+// a change someone else made in the meantime is refused, not overwritten.
+const etags = new Map();
 
 function leaflet() {
   // Leaflet's UMD build sets window.L (and window.leaflet). In ES modules, bare `L`
@@ -133,6 +161,7 @@ const mediaFilter = {
   deviceModel: '',
   deviceUnset: false,
   gps: '',
+  rating: '',
   from: '',
   to: '',
   sort: 'capture_time',
@@ -148,6 +177,11 @@ const mapFilter = {
   city: ''
 };
 
+// Pages opened by usbvault-kiosk carry ?kiosk=1 and follow monitor
+// hotplug: the launcher reports display changes to the server.
+const kioskMode = new URLSearchParams(window.location.search).has('kiosk');
+const KIOSK_DISPLAY_INTERVAL_MS = 5000;
+
 init().catch((err) => {
   console.error(err);
   statusChip.textContent = `Initialization error: ${err?.message || err}`;
@@ -157,17 +191,60 @@ async function init() {
   bindEvents();
   writeMediaFilterControls();
   writeMapFilterControls();
+  await redeemPairing();
   await refreshAuthState();
+  if (kioskMode) {
+    setInterval(followKioskDisplay, KIOSK_DISPLAY_INTERVAL_MS);
+  }
+}
+
+// A phone that scanned a pairing code opens /?pair=<token>. Trade the token
+// for a session and take it out of the address bar.
+async function redeemPairing() {
+  const params = new URLSearchParams(window.location.search);
+  const token = params.get('pair');
+  if (!token) return;
+  params.delete('pair');
+  const rest = params.toString();
+  window.history.replaceState(null, '', window.location.pathname + (rest ? `?${rest}` : ''));
+  try {
+    await api('/api/pair', { method: 'POST', body: { token } });
+  } catch (err) {
+    loginError.textContent = `Pairing failed: ${err.message}`;
+  }
+}
+
+async function followKioskDisplay() {
+  try {
+    const st = await api('/api/kiosk/display');
+    if (st.ui === 'touch') {
+      window.location.href = '/web/touch/touch.html?kiosk=1';
+    }
+  } catch {
+    // Not signed in yet; the login screen stays put.
+  }
 }
 
 function bindEvents() {
   setupForm?.addEventListener('submit', async (event) => {
     event.preventDefault();
     setupError.textContent = '';
-    const data = Object.fromEntries(new FormData(setupForm).entries());
+    const { wifi_ssid: ssid, wifi_passphrase: passphrase, setup_code: code, ...data } =
+      Object.fromEntries(new FormData(setupForm).entries());
+    if (code) data.setup_code = code;
+    if (ssid) data.network = { wifi_ssid: ssid, wifi_passphrase: passphrase || '' };
     try {
-      await api('/api/setup', { method: 'POST', body: data });
-      await refreshAuthState();
+      const res = await api('/api/setup', { method: 'POST', body: data });
+      setupForm.classList.add('hidden');
+      showRecoveryCodes(res.recovery_codes || []);
+      if (res.wifi_ssid) {
+        // The vault leaves this network for the chosen one.
+        setupCard.querySelector('p').textContent =
+          `Setup complete. Write down these recovery codes; each can sign in once if you lose your password. The vault is joining "${res.wifi_ssid}"; reconnect to that network to continue.`;
+        return;
+      }
+      setupCard.querySelector('p').textContent =
+        'Setup complete. Write down these recovery codes; each can sign in once if you lose your password. They are not shown again.';
     } catch (err) {
       setupError.textContent = err.message;
     }
@@ -176,7 +253,11 @@ function bindEvents() {
   loginForm?.addEventListener('submit', async (event) => {
     event.preventDefault();
     loginError.textContent = '';
-    const data = Object.fromEntries(new FormData(loginForm).entries());
+    const { recovery_code: code, new_password: newPassword, ...data } = Object.fromEntries(new FormData(loginForm).entries());
+    if (code) {
+      data.recovery_code = code;
+      data.new_password = newPassword;
+    }
     try {
       await api('/api/login', { method: 'POST', body: data });
       await refreshAuthState();
@@ -255,6 +336,14 @@ function bindEvents() {
     await deleteSelectedMedia(Array.from(selectedIDs));
   });
 
+  editSelectedBtn?.addEventListener('click', async () => {
+    await editSelectedMedia(Array.from(selectedIDs));
+  });
+
+  trashBtn?.addEventListener('click', async () => {
+    await restoreFromTrash();
+  });
+
   downloadSelectedFilesBtn?.addEventListener('click', () => {
     downloadSelectedAsFiles(Array.from(selectedIDs));
   });
@@ -303,6 +392,7 @@ function bindEvents() {
       mediaFilter.deviceModel = '';
       mediaFilter.deviceUnset = false;
       mediaFilter.gps = '';
+      mediaFilter.rating = '';
       mediaFilter.from = '';
       mediaFilter.to = '';
       mediaFilter.sort = 'capture_time';
@@ -359,6 +449,31 @@ function bindEvents() {
     }
   });
 
+  createSmartAlbumBtn?.addEventListener('click', async () => {
+    const name = String(newAlbumNameInput?.value || '').trim();
+    if (!name) {
+      statusChip.textContent = 'Album name is required.';
+      return;
+    }
+    const rules = smartRulesFromFilters();
+    if (!Object.keys(rules).length) {
+      statusChip.textContent = 'Set a location, date, device, kind or GPS filter first.';
+      return;
+    }
+    try {
+      const payload = await api('/api/albums', { method: 'POST', body: { name, rules } });
+      newAlbumNameInput.value = '';
+      await loadAlbums();
+      if (payload?.item?.id) {
+        activeAlbumID = Number(payload.item.id);
+      }
+      renderViewModeState();
+      await loadDashboardData();
+    } catch (err) {
+      statusChip.textContent = `Create smart album failed: ${err.message}`;
+    }
+  });
+
   openAlbumFolderBtn?.addEventListener('click', async () => {
     if (!activeAlbumID) {
       statusChip.textContent = 'Select an album first.';
@@ -378,6 +493,39 @@ function bindEvents() {
     }
   });
 
+  renameAlbumBtn?.addEventListener('click', async () => {
+    const album = albums.find((a) => Number(a.id) === Number(activeAlbumID));
+    if (!album) return;
+    const name = String(window.prompt('New album name', album.name) || '').trim();
+    if (!name || name === album.name) return;
+    try {
+      await api(`/api/albums/${album.id}`, { method: 'PATCH', body: { name }, ifMatch: albumETag(album.id) });
+      await loadAlbums();
+      statusChip.textContent = `Album renamed to ${name}.`;
+    } catch (err) {
+      statusChip.textContent = `Rename album failed: ${err.message}`;
+      if (err.status === 412) await loadAlbums();
+    }
+  });
+
+  deleteAlbumBtn?.addEventListener('click', async () => {
+    const album = albums.find((a) => Number(a.id) === Number(activeAlbumID));
+    if (!album) return;
+    if (!window.confirm(`Delete album "${album.name}"?\n\nIts media stay in the library.`)) return;
+    try {
+      await api(`/api/albums/${album.id}`, { method: 'DELETE', ifMatch: albumETag(album.id) });
+      activeAlbumID = 0;
+      selectedIDs.clear();
+      await loadAlbums();
+      renderViewModeState();
+      await loadDashboardData();
+      statusChip.textContent = `Album "${album.name}" deleted.`;
+    } catch (err) {
+      statusChip.textContent = `Delete album failed: ${err.message}`;
+      if (err.status === 412) await loadAlbums();
+    }
+  });
+
   addSelectedToAlbumBtn?.addEventListener('click', async () => {
     if (!activeAlbumID) {
       statusChip.textContent = 'Select an album first.';
@@ -386,7 +534,7 @@ function bindEvents() {
     const ids = Array.from(selectedIDs);
     if (!ids.length) return;
     try {
-      const res = await api(`/api/albums/${activeAlbumID}/add`, { method: 'POST', body: { ids } });
+      const res = await api(`/api/albums/${activeAlbumID}/add`, { method: 'POST', body: { ids }, ifMatch: albumETag(activeAlbumID) });
       await loadAlbums();
       statusChip.textContent = `Album updated: added ${res.added || 0}, skipped ${res.skipped || 0}`;
       if (viewMode === 'albums') {
@@ -394,6 +542,7 @@ function bindEvents() {
       }
     } catch (err) {
       statusChip.textContent = `Add to album failed: ${err.message}`;
+      if (err.status === 412) await loadAlbums();
     }
   });
 
@@ -405,13 +554,14 @@ function bindEvents() {
     const ids = Array.from(selectedIDs);
     if (!ids.length) return;
     try {
-      const res = await api(`/api/albums/${activeAlbumID}/remove`, { method: 'POST', body: { ids } });
+      const res = await api(`/api/albums/${activeAlbumID}/remove`, { method: 'POST', body: { ids }, ifMatch: albumETag(activeAlbumID) });
       selectedIDs.clear();
       await loadAlbums();
       statusChip.textContent = `Album updated: removed ${res.removed || 0}, skipped ${res.skipped || 0}`;
       await loadDashboardData();
     } catch (err) {
       statusChip.textContent = `Remove from album failed: ${err.message}`;
+      if (err.status === 412) await loadAlbums();
     }
   });
 
@@ -444,6 +594,20 @@ function bindEvents() {
     }
   });
 
+  pairingForm?.addEventListener('submit', async (event) => {
+    event.preventDefault();
+    const data = Object.fromEntries(new FormData(pairingForm).entries());
+    try {
+      const res = await api('/api/pairing', { method: 'POST', body: data });
+      pairingQR.src = `${res.qr_url}?t=${Date.now()}`;
+      pairingQR.classList.remove('hidden');
+      pairingStatus.textContent = `Scan with "${res.device}" before ${new Date(res.expires_at).toLocaleTimeString()}.`;
+    } catch (err) {
+      pairingQR.classList.add('hidden');
+      pairingStatus.textContent = `Pairing failed: ${err.message}`;
+    }
+  });
+
   backupMode?.addEventListener('change', () => {
     if (!backupDestination) return;
     const mode = backupMode.value;
@@ -451,6 +615,8 @@ function bindEvents() {
       backupDestination.placeholder = 'user@host:/backups/usbvault.tar.gz';
     } else if (mode === 'rsync') {
       backupDestination.placeholder = 'user@host:/backups/usbvault or /local/backup/dir';
+    } else if (mode === 'snapshot') {
+      backupDestination.placeholder = '/Volumes/BackupDrive/usbvault-snapshots';
     } else if (mode === 's3') {
       backupDestination.placeholder = 's3://bucket/usbvault/backup.tar.gz';
     } else if (mode === 'api') {
@@ -500,6 +666,48 @@ function bindEvents() {
     await loadMapData();
   });
 
+  mapGapsBtn?.addEventListener('click', async () => {
+    try {
+      await toggleCoverageGaps();
+    } catch (err) {
+      statusChip.textContent = `Coverage gaps failed: ${err.message}`;
+    }
+  });
+
+  mapBookmarkSelect?.addEventListener('change', () => {
+    const bookmark = mapBookmarks.find((b) => String(b.id) === mapBookmarkSelect.value);
+    if (bookmark && map) map.setView([bookmark.lat, bookmark.lon], bookmark.zoom);
+  });
+
+  mapBookmarkSaveBtn?.addEventListener('click', async () => {
+    if (!map) return;
+    const name = window.prompt('Bookmark name');
+    if (!name || !name.trim()) return;
+    const center = map.getCenter().wrap();
+    try {
+      const saved = await api('/api/map/bookmarks', {
+        method: 'POST',
+        body: { name: name.trim(), lat: center.lat, lon: center.lng, zoom: Math.round(map.getZoom()) }
+      });
+      await loadMapBookmarks();
+      if (mapBookmarkSelect) mapBookmarkSelect.value = String(saved.id);
+    } catch (err) {
+      statusChip.textContent = `Save bookmark failed: ${err.message}`;
+    }
+  });
+
+  mapBookmarkDeleteBtn?.addEventListener('click', async () => {
+    const bookmark = mapBookmarks.find((b) => String(b.id) === mapBookmarkSelect?.value);
+    if (!bookmark) return;
+    if (!window.confirm(`Delete bookmark "${bookmark.name}"?`)) return;
+    try {
+      await api(`/api/map/bookmarks/${bookmark.id}`, { method: 'DELETE' });
+      await loadMapBookmarks();
+    } catch (err) {
+      statusChip.textContent = `Delete bookmark failed: ${err.message}`;
+    }
+  });
+
   mapExpandBtn?.addEventListener('click', () => {
     openMapModal();
   });
@@ -518,6 +726,9 @@ function bindEvents() {
 
 async function refreshAuthState() {
   const status = await api('/api/status');
+  if (status.map_tiles) {
+    mapTiles = { url: status.map_tiles, attribution: status.map_attribution || '' };
+  }
 
   setupCard.classList.add('hidden');
   loginCard.classList.add('hidden');
@@ -526,7 +737,10 @@ async function refreshAuthState() {
   if (!status.has_users) {
     statusChip.textContent = 'Setup required';
     setupCard.classList.remove('hidden');
+    document.querySelector('#setupCodeField')?.classList.toggle('hidden', !status.setup_code_required);
+    document.querySelector('#setupNetworkFields')?.classList.toggle('hidden', !status.network_setup);
     stopIngestPolling();
+    stopHeartbeat();
     viewMode = 'all';
     activeAlbumID = 0;
     albums = [];
@@ -541,6 +755,7 @@ async function refreshAuthState() {
     statusChip.textContent = 'Login required';
     loginCard.classList.remove('hidden');
     stopIngestPolling();
+    stopHeartbeat();
     viewMode = 'all';
     activeAlbumID = 0;
     albums = [];
@@ -551,16 +766,49 @@ async function refreshAuthState() {
     return;
   }
 
-  statusChip.textContent = 'Authenticated';
-  storageLabel.textContent = `Storage: ${status.storage_dir || 'Not configured'}`;
+  statusChip.textContent = status.read_only ? 'Read-only' : 'Authenticated';
+  storageLabel.textContent = `Storage: ${status.storage_dir || 'Not configured'}${status.read_only ? ' (read-only)' : ''}`;
   dashboard.classList.remove('hidden');
   renderViewModeState();
   startIngestPolling();
+  startHeartbeat();
   await loadAlbums();
-  await Promise.all([loadMapFilterOptions(), loadDeviceOptions()]);
+  await Promise.all([loadMapFilterOptions(), loadDeviceOptions(), loadExportPresets(), loadMapBookmarks()]);
   await loadDashboardData();
 }
 
+async function loadExportPresets() {
+  if (!exportPresetSelect) return;
+  try {
+    const payload = await api('/api/export-presets');
+    const current = exportPresetSelect.value;
+    exportPresetSelect.innerHTML = '';
+    for (const preset of payload.presets || []) {
+      const option = document.createElement('option');
+      option.value = preset.name;
+      option.textContent = preset.label || preset.name;
+      exportPresetSelect.appendChild(option);
+    }
+    if (current) exportPresetSelect.value = current;
+  } catch {
+    // Guests cannot export; keep the default option.
+  }
+}
+
+async function loadMapBookmarks() {
+  if (!mapBookmarkSelect) return;
+  try {
+    const payload = await api('/api/map/bookmarks');
+    mapBookmarks = payload.items || [];
+  } catch {
+    // Guests have no bookmarks.
+    mapBookmarks = [];
+  }
+  mapBookmarkSelect.innerHTML = '';
+  addSelectOption(mapBookmarkSelect, '', 'Bookmarks');
+  mapBookmarks.forEach((b) => addSelectOption(mapBookmarkSelect, String(b.id), b.name));
+}
+
 async function loadDashboardData() {
   renderViewModeState();
   await Promise.all([
@@ -843,7 +1091,8 @@ function renderAlbums() {
     if (Number(activeAlbumID) === Number(album.id)) {
       row.classList.add('active');
     }
-    row.innerHTML = `<div class="name">${escapeHtml(album.name)}</div><div class="count">${Number(album.item_count || 0)}</div>`;
+    const smart = album.smart ? '<span class="smart">smart</span>' : '';
+    row.innerHTML = `<div class="name">${escapeHtml(album.name)}${smart}</div><div class="count">${Number(album.item_count || 0)}</div>`;
     row.addEventListener('click', async () => {
       activeAlbumID = Number(album.id);
       selectedIDs.clear();
@@ -901,7 +1150,12 @@ function renderViewModeState() {
   albumActions?.classList.toggle('hidden', !albumsMode);
   albumViewPanel?.classList.toggle('hidden', !albumsMode);
   openAlbumFolderBtn?.classList.toggle('hidden', !(albumsMode && activeAlbumID > 0));
-  removeSelectedFromAlbumBtn?.classList.toggle('hidden', !(albumsMode && activeAlbumID > 0));
+  renameAlbumBtn?.classList.toggle('hidden', !(albumsMode && activeAlbumID > 0));
+  deleteAlbumBtn?.classList.toggle('hidden', !(albumsMode && activeAlbumID > 0));
+  // Smart albums take their items from their rules.
+  const smart = albums.some((a) => Number(a.id) === Number(activeAlbumID) && a.smart);
+  addSelectedToAlbumBtn?.classList.toggle('hidden', smart);
+  removeSelectedFromAlbumBtn?.classList.toggle('hidden', !(albumsMode && activeAlbumID > 0) || smart);
 }
 
 async function loadDeviceOptions() {
@@ -1099,7 +1353,9 @@ function renderMapPointsInfo(mapRes) {
   const fallbackCount = Array.isArray(mapRes?.points) ? mapRes.points.length : 0;
   const count = Number((mapRes?.count ?? fallbackCount) || 0);
   const limit = Number(mapRes?.limit || 10000);
-  mapPointsInfo.textContent = `Pins: ${count.toLocaleString()} (limit ${limit.toLocaleString()})`;
+  mapPointsInfo.textContent = count >= clusterThreshold
+    ? `Pins: ${count.toLocaleString()}${count >= limit ? '+' : ''}, shown as clusters`
+    : `Pins: ${count.toLocaleString()} (limit ${limit.toLocaleString()})`;
 }
 
 function addSelectOption(select, value, label) {
@@ -1110,6 +1366,28 @@ function addSelectOption(select, value, label) {
   select.appendChild(option);
 }
 
+// smartRulesFromFilters saves the current filters, less the text search and
+// the nearby point, as the rules of a smart album.
+function smartRulesFromFilters() {
+  readMediaFilterControls();
+  const rules = {};
+  if (locFilter.state) rules.state = locFilter.state;
+  if (locFilter.county) rules.county = locFilter.county;
+  if (locFilter.city) rules.city = locFilter.city;
+  if (locFilter.road) rules.road = locFilter.road;
+  if (mediaFilter.kind) rules.kind = mediaFilter.kind;
+  if (mediaFilter.deviceUnset) {
+    rules.device_unknown = true;
+  } else {
+    if (mediaFilter.deviceMake) rules.device_make = mediaFilter.deviceMake;
+    if (mediaFilter.deviceModel) rules.device_model = mediaFilter.deviceModel;
+  }
+  if (mediaFilter.gps) rules.gps = mediaFilter.gps;
+  if (mediaFilter.from) rules.from = mediaFilter.from;
+  if (mediaFilter.to) rules.to = mediaFilter.to;
+  return rules;
+}
+
 function filterQuery(prefix) {
   readMediaFilterControls();
   const params = new URLSearchParams();
@@ -1126,6 +1404,11 @@ function filterQuery(prefix) {
     if (mediaFilter.deviceModel) params.set('device_model', mediaFilter.deviceModel);
   }
   if (mediaFilter.gps) params.set('gps', mediaFilter.gps);
+  if (mediaFilter.rating === 'favorite') {
+    params.set('favorite', 'yes');
+  } else if (mediaFilter.rating) {
+    params.set('min_rating', mediaFilter.rating);
+  }
   if (mediaFilter.q) params.set('q', mediaFilter.q);
   if (mediaFilter.from) params.set('from', mediaFilter.from);
   if (mediaFilter.to) params.set('to', mediaFilter.to);
@@ -1162,9 +1445,12 @@ function renderMedia(items) {
       tile.classList.add('selected');
     }
 
-    const mediaEl = item.kind === 'video'
+    let mediaEl = item.kind === 'video' && !item.thumb_url
       ? `<video muted preload="metadata" src="${item.preview_url}"></video>`
-      : `<img loading="lazy" src="${item.preview_url}" alt="${escapeHtml(item.file_name)}"/>`;
+      : `<img loading="lazy" src="${item.thumb_url || item.preview_url}" alt="${escapeHtml(item.file_name)}"/>`;
+    if (item.kind === 'video' && item.duration_sec) {
+      mediaEl += `<span class="duration">${formatDuration(item.duration_sec)}</span>`;
+    }
 
     tile.innerHTML = `${mediaEl}
       <div class="meta">
@@ -1214,18 +1500,75 @@ function renderPreview(item) {
   previewPane.className = 'preview-pane';
   if (item.kind === 'video') {
     previewPane.innerHTML = `
-      <video controls autoplay src="${item.preview_url}"></video>
+      <video controls autoplay src="${item.preview_url}"${item.large_thumb_url ? ` poster="${item.large_thumb_url}"` : ''}></video>
       <p><strong>${safeName}</strong><br/>${ts}</p>
+      ${ratingControlsHTML(item)}
     `;
+    bindRatingControls(item);
+    // Footage the browser cannot play, such as MXF, is transcoded by the
+    // vault instead.
+    const video = previewPane.querySelector('video');
+    video?.addEventListener('error', () => {
+      if (video.src.includes('/stream')) return;
+      video.src = `/api/media/${item.id}/stream?profile=720p`;
+      video.play().catch(() => {});
+    });
     return;
   }
 
   previewPane.innerHTML = `
-    <img src="${item.preview_url}" alt="${safeName}" />
+    <img src="${item.large_thumb_url || item.preview_url}" alt="${safeName}" />
     <p><strong>${safeName}</strong><br/>${ts}</p>
+    ${ratingControlsHTML(item)}
+    ${item.large_thumb_url ? `<p><a href="${item.preview_url}" target="_blank" rel="noopener">${item.preview_url.includes('format=jpeg') ? 'Open full size' : 'Open original'}</a></p>` : ''}
+  `;
+  bindRatingControls(item);
+}
+
+function ratingControlsHTML(item) {
+  const rating = Number(item.rating || 0);
+  const stars = [1, 2, 3, 4, 5]
+    .map((n) => `<button type="button" class="star${n <= rating ? ' on' : ''}" data-rating="${n}" title="${n} star${n === 1 ? '' : 's'}">&#9733;</button>`)
+    .join('');
+  return `
+    <div class="rating-controls">
+      ${stars}
+      <button type="button" class="favorite${item.favorite ? ' on' : ''}" title="Favorite">&#9829;</button>
+    </div>
   `;
 }
 
+function bindRatingControls(item) {
+  const box = previewPane.querySelector('.rating-controls');
+  if (!box) return;
+  box.querySelectorAll('.star').forEach((btn) => {
+    btn.addEventListener('click', () => {
+      // Clicking the current rating clears it.
+      const n = Number(btn.dataset.rating);
+      updateMediaRating(item, { rating: n === Number(item.rating || 0) ? 0 : n });
+    });
+  });
+  box.querySelector('.favorite')?.addEventListener('click', () => {
+    updateMediaRating(item, { favorite: !item.favorite });
+  });
+}
+
+async function updateMediaRating(item, change) {
+  try {
+    const data = await api(`/api/media/${item.id}`, { method: 'PATCH', body: change });
+    const updated = data?.item || {};
+    item.rating = Number(updated.rating || 0);
+    item.favorite = Boolean(updated.favorite);
+    if (Number(currentPreviewID) === Number(item.id)) {
+      const box = previewPane.querySelector('.rating-controls');
+      if (box) box.outerHTML = ratingControlsHTML(item);
+      bindRatingControls(item);
+    }
+  } catch (err) {
+    statusChip.textContent = `Rating failed: ${err.message}`;
+  }
+}
+
 function clearPreview() {
   currentPreviewID = null;
   if (deleteCurrentBtn) {
@@ -1253,7 +1596,7 @@ async function deleteSelectedMedia(ids) {
   }
 
   const label = normalized.length === 1 ? '1 file' : `${normalized.length} files`;
-  const confirmed = window.confirm(`Delete ${label}?\n\nThis removes files from storage and deletes their database records.`);
+  const confirmed = window.confirm(`Delete ${label}?\n\nThey go to the trash and can be restored until it is emptied.`);
   if (!confirmed) return;
 
   try {
@@ -1267,12 +1610,96 @@ async function deleteSelectedMedia(ids) {
       clearPreview();
     }
     await loadDashboardData();
-    statusChip.textContent = `Deleted ${result.deleted || 0} file(s), failed ${result.failed || 0}`;
+    statusChip.textContent = `Moved ${result.deleted || 0} file(s) to the trash, failed ${result.failed || 0}`;
   } catch (err) {
     statusChip.textContent = `Delete failed: ${err.message}`;
   }
 }
 
+async function restoreFromTrash() {
+  try {
+    const result = await api('/api/trash?limit=50');
+    const items = result.items || [];
+    if (!items.length) {
+      statusChip.textContent = 'The trash is empty';
+      return;
+    }
+    const lines = items.map((item) => `${item.media_id}  ${item.file_name}  (${item.deleted_at})`);
+    const answer = window.prompt(
+      `Items are kept ${result.retention_days} days after deletion.\n\n${lines.join('\n')}\n\nIDs to restore, separated by commas:`,
+      ''
+    );
+    if (answer === null) return;
+    const ids = answer.split(',').map((part) => Number(part.trim())).filter((id) => Number.isFinite(id) && id > 0);
+    if (!ids.length) return;
+    const restored = await api('/api/trash/restore', { method: 'POST', body: { ids } });
+    await loadDashboardData();
+    statusChip.textContent = `Restored ${restored.restored || 0} file(s), failed ${(restored.failed || 0) + (restored.conflict || 0)}`;
+  } catch (err) {
+    statusChip.textContent = `Restore failed: ${err.message}`;
+  }
+}
+
+// parseClockOffset reads a shift such as "+1h30m", "-2d" or "45s" as
+// seconds. It returns null when the text is not one.
+function parseClockOffset(raw) {
+  const text = String(raw || '').trim().toLowerCase().replace(/\s+/g, '');
+  if (!text) return 0;
+  const match = text.match(/^([+-])?((?:\d+[dhms])+)$/);
+  if (!match) return null;
+  const units = { d: 86400, h: 3600, m: 60, s: 1 };
+  let seconds = 0;
+  for (const [, n, unit] of match[2].matchAll(/(\d+)([dhms])/g)) {
+    seconds += Number(n) * units[unit];
+  }
+  return match[1] === '-' ? -seconds : seconds;
+}
+
+// editSelectedMedia corrects a batch, such as a card shot with the camera
+// clock off or without GPS. Blank answers leave a field alone and "-"
+// clears it.
+async function editSelectedMedia(ids) {
+  const normalized = Array.from(new Set((ids || []).map((id) => Number(id)).filter((id) => Number.isFinite(id) && id > 0)));
+  if (!normalized.length) {
+    statusChip.textContent = 'Select files to edit first';
+    return;
+  }
+
+  const label = normalized.length === 1 ? '1 file' : `${normalized.length} files`;
+  const shift = window.prompt(`Shift capture times of ${label} by (e.g. +1h, -30m, +1d2h; blank to keep)`, '');
+  if (shift === null) return;
+  const offset = parseClockOffset(shift);
+  if (offset === null) {
+    statusChip.textContent = `Not a time shift: ${shift}`;
+    return;
+  }
+  const place = window.prompt('Place as State / County / City (blank to keep, - to clear)', '');
+  if (place === null) return;
+  const camera = window.prompt('Camera as Make / Model (blank to keep, - to clear)', '');
+  if (camera === null) return;
+
+  const body = { ids: normalized };
+  if (offset) body.capture_offset_seconds = offset;
+  const assign = (text, names) => {
+    String(text).split('/').forEach((part, i) => {
+      const value = part.trim();
+      if (!value || i >= names.length) return;
+      body[names[i]] = value === '-' ? '' : value;
+    });
+  };
+  assign(place, ['state', 'county', 'city']);
+  assign(camera, ['make', 'model']);
+  if (Object.keys(body).length === 1) return;
+
+  try {
+    const result = await api('/api/media/edit', { method: 'POST', body });
+    await loadDashboardData();
+    statusChip.textContent = `Edited ${result.updated || 0} file(s)`;
+  } catch (err) {
+    statusChip.textContent = `Edit failed: ${err.message}`;
+  }
+}
+
 function readMediaFilterControls() {
   mediaFilter.q = String(textFilterInput?.value || '').trim();
   mediaFilter.kind = normalizeKindValue(kindFilterSelect?.value || '');
@@ -1295,6 +1722,7 @@ function readMediaFilterControls() {
     }
   }
   mediaFilter.gps = String(gpsFilterSelect?.value || '').trim().toLowerCase();
+  mediaFilter.rating = String(ratingFilterSelect?.value || '').trim();
   mediaFilter.from = normalizeDateToStartISO(captureFromInput?.value || '');
   mediaFilter.to = normalizeDateToEndISO(captureToInput?.value || '');
   mediaFilter.sort = String(sortBySelect?.value || 'capture_time').trim();
@@ -1316,6 +1744,7 @@ function writeMediaFilterControls() {
     }
   }
   if (gpsFilterSelect) gpsFilterSelect.value = mediaFilter.gps || '';
+  if (ratingFilterSelect) ratingFilterSelect.value = mediaFilter.rating || '';
   if (captureFromInput) captureFromInput.value = isoToDateValue(mediaFilter.from);
   if (captureToInput) captureToInput.value = isoToDateValue(mediaFilter.to);
   if (sortBySelect) sortBySelect.value = mediaFilter.sort || 'capture_time';
@@ -1417,7 +1846,7 @@ async function downloadSelectedAsZip(ids) {
       method: 'POST',
       credentials: 'include',
       headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ ids: normalized })
+      body: JSON.stringify({ ids: normalized, preset: exportPresetSelect?.value || '' })
     });
     if (!response.ok) {
       const payload = await response.json().catch(() => ({}));
@@ -1498,9 +1927,9 @@ function renderMap(points) {
   }
   if (!map) {
     map = L.map('map', { zoomControl: true }).setView([20, 0], 2);
-    L.tileLayer('https://tile.openstreetmap.org/{z}/{x}/{y}.png', {
+    L.tileLayer(mapTiles.url, {
       maxZoom: 19,
-      attribution: '&copy; OpenStreetMap contributors'
+      attribution: mapTiles.attribution
     }).addTo(map);
   }
 
@@ -1508,20 +1937,122 @@ function renderMap(points) {
     map.removeLayer(mapLayer);
   }
 
-  mapLayer = L.layerGroup();
-  const bounds = [];
+  clustered = lastPoints.length >= clusterThreshold;
+  mapLayer = clustered ? L.layerGroup() : pointLayer(L, points);
+  mapLayer.addTo(map);
+  fitPoints(map, points);
+  showClusters(map).catch(() => {});
+}
 
-  points.forEach((p) => {
+function pointLayer(L, points) {
+  const layer = L.layerGroup();
+  (points || []).forEach((p) => {
     if (typeof p.lat !== 'number' || typeof p.lon !== 'number') return;
     const marker = L.marker([p.lat, p.lon]).bindPopup(`${escapeHtml(p.file_name)}<br/>${new Date(p.capture_time).toLocaleString()}`);
-    marker.addTo(mapLayer);
-    bounds.push([p.lat, p.lon]);
+    marker.addTo(layer);
   });
+  return layer;
+}
 
-  mapLayer.addTo(map);
+function fitPoints(target, points) {
+  const bounds = (points || [])
+    .filter((p) => typeof p.lat === 'number' && typeof p.lon === 'number')
+    .map((p) => [p.lat, p.lon]);
   if (bounds.length) {
-    map.fitBounds(bounds, { padding: [20, 20] });
+    target.fitBounds(bounds, { padding: [20, 20] });
+  }
+}
+
+// showClusters redraws the clusters of target's visible area, or clears
+// them when the pins are few enough to show one by one. Each map follows
+// its own pans and zooms.
+async function showClusters(target) {
+  const L = leaflet();
+  let state = clusterState.get(target);
+  if (!state) {
+    state = { layer: null, seq: 0 };
+    clusterState.set(target, state);
+    target.on('moveend', () => showClusters(target).catch(() => {}));
+  }
+  const seq = ++state.seq;
+  if (!clustered) {
+    if (state.layer) target.removeLayer(state.layer);
+    state.layer = null;
+    return;
+  }
+  const params = new URLSearchParams(mapFilterQuery(''));
+  params.delete('limit');
+  params.set('bbox', target.getBounds().toBBoxString());
+  params.set('zoom', String(target.getZoom()));
+  const res = await api(`/api/map/clusters?${params.toString()}`);
+  if (seq !== state.seq) return;
+  const layer = L.layerGroup();
+  (res.clusters || []).forEach((c) => {
+    const size = c.count >= 1000 ? 52 : c.count >= 100 ? 44 : 36;
+    const marker = c.count === 1
+      ? L.marker([c.lat, c.lon])
+      : L.marker([c.lat, c.lon], {
+        icon: L.divIcon({ className: 'map-cluster', html: `<span>${c.count.toLocaleString()}</span>`, iconSize: [size, size] })
+      });
+    const thumbs = (c.samples || [])
+      .filter((sample) => sample.thumb_url)
+      .map((sample) => `<img src="${escapeHtml(sample.thumb_url)}" alt="" loading="lazy" />`)
+      .join('');
+    const span = c.from === c.to
+      ? new Date(c.from).toLocaleString()
+      : `${new Date(c.from).toLocaleDateString()} – ${new Date(c.to).toLocaleDateString()}`;
+    marker.bindPopup(`<div class="map-cluster-thumbs">${thumbs}</div>${c.count.toLocaleString()} item${c.count === 1 ? '' : 's'}<br/>${span}`);
+    if (c.count > 1) {
+      marker.on('dblclick', () => target.fitBounds([[c.bounds[0], c.bounds[1]], [c.bounds[2], c.bounds[3]]], { padding: [20, 20] }));
+    }
+    marker.addTo(layer);
+  });
+  if (state.layer) target.removeLayer(state.layer);
+  state.layer = layer;
+  layer.addTo(target);
+}
+
+// toggleCoverageGaps shades the grid cells and marks the roads in view that
+// have nothing captured in the map's timeframe. Red cells were never
+// covered; amber ones only at other times.
+async function toggleCoverageGaps() {
+  const L = leaflet();
+  if (!L || !map) return;
+  if (gapsLayer) {
+    map.removeLayer(gapsLayer);
+    gapsLayer = null;
+    mapGapsBtn?.classList.remove('active');
+    return;
+  }
+  readMapFilterControls();
+  if (!mapTimeRange(mapFilter.timeframe).from) {
+    statusChip.textContent = 'Pick a map timeframe to find coverage gaps.';
+    return;
   }
+  const params = new URLSearchParams(mapFilterQuery(''));
+  params.delete('limit');
+  params.set('bbox', map.getBounds().toBBoxString());
+  const res = await api(`/api/map/coverage-gaps?${params.toString()}`);
+  const layer = L.layerGroup();
+  const last = (at) => (at ? `last media ${new Date(at).toLocaleDateString()}` : 'never covered');
+  (res.cells || []).forEach((c) => {
+    const color = c.count ? '#f5a524' : '#e5484d';
+    L.rectangle([[c.bounds[0], c.bounds[1]], [c.bounds[2], c.bounds[3]]], { color, weight: 1, fillOpacity: 0.15 })
+      .bindPopup(c.count ? `${c.count.toLocaleString()} item${c.count === 1 ? '' : 's'}, ${last(c.last_capture)}` : last(''))
+      .addTo(layer);
+  });
+  (res.roads || []).forEach((road) => {
+    const place = [road.road, road.city || road.county, road.state].filter(Boolean).map(escapeHtml).join(', ');
+    L.circleMarker([road.lat, road.lon], { radius: 6, color: '#e5484d', fillOpacity: 0.8 })
+      .bindPopup(`${place}<br/>${road.count.toLocaleString()} item${road.count === 1 ? '' : 's'}, ${last(road.last_capture)}`)
+      .addTo(layer);
+  });
+  layer.addTo(map);
+  gapsLayer = layer;
+  mapGapsBtn?.classList.add('active');
+  const roads = (res.roads || []).length;
+  statusChip.textContent = `Coverage gaps: ${roads}${res.truncated ? '+' : ''} of ${res.roads_seen} roads, `
+    + `${(res.cells || []).length} of ${res.cells_total} areas with nothing in the timeframe.`;
 }
 
 function renderAudit(items) {
@@ -1553,9 +2084,9 @@ function openMapModal() {
   }
   if (!mapFull) {
     mapFull = L.map('mapFull', { zoomControl: true }).setView([20, 0], 2);
-    L.tileLayer('https://tile.openstreetmap.org/{z}/{x}/{y}.png', {
+    L.tileLayer(mapTiles.url, {
       maxZoom: 19,
-      attribution: '&copy; OpenStreetMap contributors'
+      attribution: mapTiles.attribution
     }).addTo(mapFull);
   }
 
@@ -1574,18 +2105,10 @@ function renderMapFull(points) {
   if (!L) return;
   if (!mapFull) return;
   if (mapFullLayer) mapFull.removeLayer(mapFullLayer);
-  mapFullLayer = L.layerGroup();
-  const bounds = [];
-  (points || []).forEach((p) => {
-    if (typeof p.lat !== 'number' || typeof p.lon !== 'number') return;
-    const marker = L.marker([p.lat, p.lon]).bindPopup(`${escapeHtml(p.file_name)}<br/>${new Date(p.capture_time).toLocaleString()}`);
-    marker.addTo(mapFullLayer);
-    bounds.push([p.lat, p.lon]);
-  });
+  mapFullLayer = clustered ? L.layerGroup() : pointLayer(L, points);
   mapFullLayer.addTo(mapFull);
-  if (bounds.length) {
-    mapFull.fitBounds(bounds, { padding: [20, 20] });
-  }
+  fitPoints(mapFull, points);
+  showClusters(mapFull).catch(() => {});
 }
 
 async function refreshBackupStatus() {
@@ -1638,14 +2161,84 @@ async function api(url, options = {}) {
     init.body = JSON.stringify(options.body);
   }
 
+  if (options.ifMatch) {
+    init.headers['If-Match'] = options.ifMatch;
+  } else if (init.method !== 'GET' && etags.has(url)) {
+    init.headers['If-Match'] = etags.get(url);
+  }
+
   const response = await fetch(url, init);
   const payload = await response.json().catch(() => ({}));
   if (!response.ok) {
-    throw new Error(payload.error || `Request failed: ${response.status}`);
+    const err = new Error(payload.error || `Request failed: ${response.status}`);
+    err.status = response.status;
+    throw err;
+  }
+  const etag = response.headers.get('ETag');
+  if (etag) {
+    etags.set(url, etag);
   }
   return payload;
 }
 
+// showRecoveryCodes lists the codes from setup once, with a button to go on
+// to the dashboard.
+function showRecoveryCodes(codes) {
+  const list = document.createElement('pre');
+  list.className = 'recovery-codes';
+  list.textContent = codes.join('\n');
+  const done = document.createElement('button');
+  done.type = 'button';
+  done.textContent = "I've saved them";
+  done.addEventListener('click', () => {
+    list.remove();
+    done.remove();
+    refreshAuthState().catch(() => {});
+  });
+  setupCard.append(list, done);
+}
+
+function albumETag(id) {
+  const album = albums.find((a) => Number(a.id) === Number(id));
+  return album ? `"${album.version}"` : undefined;
+}
+
+// startHeartbeat tells the server this session is open, and shows who else
+// is signed in so two people know not to edit the same thing at once.
+function startHeartbeat() {
+  if (heartbeatTimer) return;
+  const beat = async () => {
+    try {
+      const res = await api('/api/session/heartbeat', { method: 'POST', body: { view: viewMode } });
+      const others = res.items || [];
+      presenceChip.textContent = others.length
+        ? `Also signed in: ${others.map((p) => (p.device ? `${p.username} (${p.device})` : p.username)).join(', ')}`
+        : '';
+      presenceChip.classList.toggle('hidden', !others.length);
+    } catch {
+      presenceChip.classList.add('hidden');
+    }
+  };
+  heartbeatTimer = setInterval(beat, 30000);
+  beat();
+}
+
+function stopHeartbeat() {
+  if (!heartbeatTimer) return;
+  clearInterval(heartbeatTimer);
+  heartbeatTimer = undefined;
+  presenceChip.classList.add('hidden');
+}
+
+// formatDuration turns seconds into m:ss, or h:mm:ss for long clips.
+function formatDuration(seconds) {
+  const total = Math.round(Number(seconds));
+  const h = Math.floor(total / 3600);
+  const m = Math.floor((total % 3600) / 60);
+  const s = String(total % 60).padStart(2, '0');
+  return h > 0 ? `${h}:${String(m).padStart(2, '0')}:${s}` : `${m}:${s}`;
+}
+
 function escapeHtml(value) {
   return String(value)
     .replaceAll('&', '&amp;')
@@ -1725,6 +2318,10 @@ function renderIngestStatus(st) {
     } else {
       sub = 'Import paused';
     }
+  } else if (state === 'waiting') {
+    title = 'Waiting';
+    label = '...';
+    sub = st.message || 'Waiting for the system clock';
   } else if (state === 'scanning') {
     title = 'Scanning';
     label = '...';
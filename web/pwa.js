@@ -0,0 +1,9 @@
+// Registers the service worker that keeps the UI shell available offline.
+if ('serviceWorker' in navigator) {
+  window.addEventListener('load', () => {
+    navigator.serviceWorker.register('/sw.js', { scope: '/' })
+      .then(() => navigator.serviceWorker.ready)
+      .then((reg) => reg.active?.postMessage('sync'))
+      .catch((err) => console.warn('service worker unavailable', err));
+  });
+}
@@ -0,0 +1,119 @@
+// USB Vault service worker. It keeps the UI shell and recently viewed
+// thumbnails so the kiosk loads instantly, and answers API calls with a
+// clear error while the server is restarting. /api/offline-manifest says
+// what to keep.
+
+const SHELL_CACHE = 'usbvault-shell';
+const THUMB_CACHE = 'usbvault-thumbs';
+const VERSION_KEY = '/offline-version';
+const THUMB_LIMIT = 300;
+
+self.addEventListener('install', (event) => {
+  event.waitUntil(syncOffline().catch(() => {}));
+  self.skipWaiting();
+});
+
+self.addEventListener('activate', (event) => {
+  event.waitUntil(self.clients.claim());
+});
+
+self.addEventListener('message', (event) => {
+  if (event.data === 'sync') {
+    event.waitUntil(syncOffline().catch(() => {}));
+  }
+});
+
+self.addEventListener('fetch', (event) => {
+  const req = event.request;
+  const url = new URL(req.url);
+  if (url.origin !== self.location.origin) return;
+
+  if (req.method !== 'GET') {
+    // Thumbnails belong to whoever was signed in.
+    if (url.pathname === '/api/logout') {
+      event.waitUntil(caches.delete(THUMB_CACHE));
+    }
+    return;
+  }
+  if (/^\/api\/media\/\d+\/thumb(nail)?$/.test(url.pathname)) {
+    event.respondWith(cacheFirst(req));
+    return;
+  }
+  if (url.pathname.startsWith('/api/')) {
+    event.respondWith(fetch(req).catch(() => offlineResponse()));
+    return;
+  }
+  if (req.mode === 'navigate' || url.pathname.startsWith('/web/')) {
+    event.respondWith(staleWhileRevalidate(req, req.mode === 'navigate'));
+  }
+});
+
+async function syncOffline() {
+  const response = await fetch('/api/offline-manifest', { cache: 'no-store' });
+  if (!response.ok) return;
+  const manifest = await response.json();
+
+  const shell = await caches.open(SHELL_CACHE);
+  const known = await shell.match(VERSION_KEY);
+  if (!known || (await known.text()) !== manifest.version) {
+    await shell.addAll(manifest.shell);
+    await shell.put(VERSION_KEY, new Response(manifest.version));
+  }
+
+  const thumbs = await caches.open(THUMB_CACHE);
+  for (const url of manifest.thumbnails || []) {
+    if (await thumbs.match(url)) continue;
+    try {
+      const res = await fetch(url);
+      if (res.ok) await thumbs.put(url, res);
+    } catch {
+      return;
+    }
+  }
+  await pruneThumbs(thumbs);
+}
+
+async function cacheFirst(req) {
+  const thumbs = await caches.open(THUMB_CACHE);
+  const cached = await thumbs.match(req);
+  if (cached) return cached;
+  const res = await fetch(req);
+  if (res.ok) {
+    await thumbs.put(req, res.clone());
+    await pruneThumbs(thumbs);
+  }
+  return res;
+}
+
+// Cache keys come back oldest first.
+async function pruneThumbs(thumbs) {
+  const keys = await thumbs.keys();
+  for (const key of keys.slice(0, Math.max(0, keys.length - THUMB_LIMIT))) {
+    await thumbs.delete(key);
+  }
+}
+
+// Pages come from the cache at once and are refreshed behind the scenes,
+// so an upgrade shows up on the next load. Navigations are keyed by path:
+// /?pair=... and /web/touch/touch.html?kiosk=1 are the same shell.
+async function staleWhileRevalidate(req, navigate) {
+  const shell = await caches.open(SHELL_CACHE);
+  const key = navigate ? new URL(req.url).pathname : req;
+  const cached = await shell.match(key);
+  const refresh = fetch(req).then((res) => {
+    if (res.ok) shell.put(key, res.clone());
+    return res;
+  });
+  if (cached) {
+    refresh.catch(() => {});
+    return cached;
+  }
+  return refresh.catch(() => offlineResponse());
+}
+
+function offlineResponse() {
+  return new Response(JSON.stringify({ error: 'USB Vault is not reachable; it may be restarting.', offline: true }), {
+    status: 503,
+    headers: { 'Content-Type': 'application/json' }
+  });
+}
@@ -4,9 +4,18 @@ const tilesEl = document.querySelector('#tiles');
 const viewerInner = document.querySelector('#viewerInner');
 const refreshBtn = document.querySelector('#refresh');
 const logoutBtn = document.querySelector('#logout');
+const moreBtn = document.querySelector('#more');
+
+// One summary call drives every status widget; the Pi is too slow for a
+// poll per widget.
+const SUMMARY_INTERVAL_MS = 5000;
+// Opened by usbvault-kiosk: switch to the desktop UI when HDMI is plugged in.
+const kioskMode = new URLSearchParams(window.location.search).has('kiosk');
 
 let map;
 let mapLayer;
+let mapTiles = { url: 'https://tile.openstreetmap.org/{z}/{x}/{y}.png', attribution: '&copy; OpenStreetMap contributors' };
+let mediaPage = 1;
 
 init().catch((err) => {
   console.error(err);
@@ -15,6 +24,7 @@ init().catch((err) => {
 
 async function init() {
   refreshBtn.addEventListener('click', () => loadAll());
+  moreBtn.addEventListener('click', () => loadMedia(mediaPage + 1));
   logoutBtn.addEventListener('click', async () => {
     await api('/api/logout', { method: 'POST', body: {} });
     window.location.href = '/';
@@ -22,10 +32,14 @@ async function init() {
 
   await ensureAuthed();
   await loadAll();
+  setInterval(() => loadSummary().catch((err) => console.error(err)), SUMMARY_INTERVAL_MS);
 }
 
 async function ensureAuthed() {
   const st = await api('/api/status');
+  if (st.map_tiles) {
+    mapTiles = { url: st.map_tiles, attribution: st.map_attribution || '' };
+  }
   if (!st.has_users) {
     statusEl.textContent = 'Setup required on main UI';
     window.location.href = '/';
@@ -37,26 +51,63 @@ async function ensureAuthed() {
     return;
   }
   statusEl.textContent = 'Ready';
-  storageEl.textContent = st.storage_dir ? `Storage: ${st.storage_dir}` : 'Storage not configured';
 }
 
 async function loadAll() {
   statusEl.textContent = 'Loading...';
 
-  const [mediaRes, mapRes] = await Promise.all([
-    api('/api/media?size=220&sort=capture_time&order=desc'),
-    api('/api/map')
+  const [mapRes] = await Promise.all([
+    api('/api/map'),
+    loadSummary(),
+    loadMedia(1)
   ]);
-
-  renderMedia(mediaRes.items || []);
   renderMap(mapRes.points || []);
+}
 
-  statusEl.textContent = 'Ready';
+async function loadSummary() {
+  const summary = await api('/api/kiosk/summary');
+  renderSummary(summary);
 }
 
-function renderMedia(items) {
-  tilesEl.innerHTML = '';
-  if (!items.length) {
+function renderSummary(summary) {
+  if (kioskMode && summary.display && summary.display.ui === 'desktop') {
+    window.location.href = '/?kiosk=1';
+    return;
+  }
+  const ingest = summary.ingest || {};
+  if (ingest.state === 'scanning' || ingest.state === 'ingesting') {
+    statusEl.textContent = `Importing ${ingest.mount}: ${Math.round(ingest.percent || 0)}%`;
+  } else if (summary.mounts && summary.mounts.length) {
+    statusEl.textContent = `Ready - ${summary.mounts.length} card(s) attached`;
+  } else {
+    const last = ingest.last_result || {};
+    statusEl.textContent = last.scanned ? `Ready - last import copied ${last.copied} of ${last.scanned}` : 'Ready';
+  }
+  if (summary.open_alerts) {
+    statusEl.textContent += ` - ${summary.open_alerts} security alert(s)`;
+  }
+
+  if (!summary.has_storage) {
+    storageEl.textContent = 'Storage not configured';
+  } else if (summary.disk) {
+    storageEl.textContent = `Storage: ${summary.storage_dir} (${formatBytes(summary.disk.free_bytes)} free)`;
+  } else {
+    storageEl.textContent = `Storage: ${summary.storage_dir}`;
+  }
+}
+
+async function loadMedia(page) {
+  const res = await api(`/api/kiosk/media?page=${page}&sort=capture_time&order=desc`);
+  mediaPage = page;
+  renderMedia(res.items || [], page > 1);
+  moreBtn.hidden = !res.has_more;
+}
+
+function renderMedia(items, append) {
+  if (!append) {
+    tilesEl.innerHTML = '';
+  }
+  if (!items.length && !append) {
     tilesEl.innerHTML = '<div class="sub">No media imported yet. Insert a USB drive to trigger ingestion.</div>';
     return;
   }
@@ -65,9 +116,14 @@ function renderMedia(items) {
     const tile = document.createElement('div');
     tile.className = 'tile';
 
-    const preview = item.kind === 'video'
-      ? `<video muted preload="metadata" src="${item.preview_url}"></video>`
-      : `<img loading="lazy" src="${item.preview_url}" alt="${escapeHtml(item.file_name)}"/>`;
+    let preview;
+    if (item.thumb_url) {
+      preview = `<img loading="lazy" src="${item.thumb_url}" alt="${escapeHtml(item.file_name)}"/>`;
+    } else if (item.kind === 'video') {
+      preview = `<video muted preload="metadata" src="${item.preview_url}"></video>`;
+    } else {
+      preview = `<div class="no-thumb">${escapeHtml(item.file_name.split('.').pop().toUpperCase())}</div>`;
+    }
 
     tile.innerHTML = `${preview}
       <div class="meta">
@@ -101,9 +157,9 @@ function renderViewer(item) {
 function renderMap(points) {
   if (!map) {
     map = L.map('map', { zoomControl: false }).setView([20, 0], 2);
-    L.tileLayer('https://tile.openstreetmap.org/{z}/{x}/{y}.png', {
+    L.tileLayer(mapTiles.url, {
       maxZoom: 19,
-      attribution: '&copy; OpenStreetMap contributors'
+      attribution: mapTiles.attribution
     }).addTo(map);
   }
 
@@ -152,6 +208,16 @@ async function api(url, options = {}) {
   return payload;
 }
 
+function formatBytes(n) {
+  const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return `${n.toFixed(i ? 1 : 0)} ${units[i]}`;
+}
+
 function escapeHtml(value) {
   return String(value)
     .replaceAll('&', '&amp;')